@@ -1,5 +1,8 @@
 /**
- * Activity Feed Module (Placeholder)
+ * Activity Feed Module
  */
 
-export { ActivityFeedService } from './service';
+export * from './types';
+export * from './templates';
+export * from './sources';
+export * from './service';
@@ -0,0 +1,220 @@
+/**
+ * Activity Feed Service Tests
+ *
+ * Timelines over the fixture records in __fixtures__/timeline.json, where
+ * several ledger entries, hold events and a dispute share 12:00.
+ */
+
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import { ActivityFeedService } from './service';
+import {
+  beforeCondition,
+  compareTimeline,
+  disputeOpenedEvent,
+  holdPlacedEvent,
+  holdReleasedEvent,
+  ledgerEvent,
+  LedgerTimelineSource,
+} from './sources';
+import { ITimelineSource, TimelineEvent, TimelinePage, TimelinePosition } from './types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { InvalidCursorError } from '../services/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/ledger-entry.model');
+
+const fixture = JSON.parse(readFileSync(join(__dirname, '__fixtures__', 'timeline.json'), 'utf8'), (key, value) =>
+  ['timestamp', 'createdAt', 'updatedAt', 'expiresAt'].includes(key) ? new Date(value) : value
+);
+
+/**
+ * In-memory source with the same contract as the Mongo sources
+ */
+class FixtureSource implements ITimelineSource {
+  private all: TimelineEvent[];
+
+  constructor(all: TimelineEvent[]) {
+    this.all = all;
+  }
+
+  async events(_userId: string, before: TimelinePosition | null, limit: number): Promise<TimelineEvent[]> {
+    return [...this.all]
+      .sort(compareTimeline)
+      .filter(event => !before || compareTimeline(before, event) < 0)
+      .slice(0, limit);
+  }
+}
+
+const fixtureSources = (): ITimelineSource[] => {
+  const transactions = new Map(fixture.entries.map((e: any) => [e.entryId, e.transactionId]));
+  return [
+    new FixtureSource(fixture.entries.map(ledgerEvent)),
+    new FixtureSource(fixture.holds.map(holdPlacedEvent)),
+    new FixtureSource(fixture.holds.filter((h: any) => h.status !== 'ACTIVE').map(holdReleasedEvent)),
+    new FixtureSource(fixture.disputes.map((d: any) => disputeOpenedEvent(d, transactions.get(d.parentEntryId)))),
+  ];
+};
+
+const EXPECTED_ORDER = [
+  'ledger:e-04',
+  'ledger:e-03',
+  'ledger:e-02',
+  'hold-released:res-a',
+  'hold-placed:res-b',
+  'dispute-opened:ann-1',
+  'hold-placed:res-a',
+  'hold-released:res-c',
+  'hold-placed:res-c',
+  'ledger:e-01',
+];
+
+describe('ActivityFeedService', () => {
+  let service: ActivityFeedService;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    service = new ActivityFeedService(fixtureSources());
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should merge every source newest first, breaking timestamp ties by entry ID', async () => {
+    const page = await service.timeline(fixture.userId, null, 50);
+
+    expect(page.entries.map(e => e.id)).toEqual(EXPECTED_ORDER);
+    expect(page.nextCursor).toBeNull();
+  });
+
+  it('should page through shared timestamps without skipping or repeating entries', async () => {
+    for (const limit of [1, 2, 3, 4]) {
+      const ids: string[] = [];
+      let cursor: string | null = null;
+      do {
+        const page: TimelinePage = await service.timeline(fixture.userId, cursor, limit);
+        ids.push(...page.entries.map(e => e.id));
+        cursor = page.nextCursor;
+      } while (cursor);
+
+      expect(ids).toEqual(EXPECTED_ORDER);
+    }
+  });
+
+  it('should render the same page identically on every call', async () => {
+    const first = await service.timeline(fixture.userId, null, 3);
+    const again = await new ActivityFeedService(fixtureSources()).timeline(fixture.userId, null, 3);
+
+    expect(again).toEqual(first);
+
+    const next = await service.timeline(fixture.userId, first.nextCursor, 3);
+    const nextAgain = await service.timeline(fixture.userId, first.nextCursor, 3);
+    expect(nextAgain).toEqual(next);
+    expect(next.entries.map(e => e.id)).toEqual(EXPECTED_ORDER.slice(3, 6));
+  });
+
+  it('should tag each entry with its kind, summary and linked transactions', async () => {
+    const { entries } = await service.timeline(fixture.userId, null, 50);
+    const byId = new Map(entries.map(e => [e.id, e]));
+
+    expect(byId.get('ledger:e-04')).toMatchObject({
+      kind: 'transaction',
+      amount: 200,
+      summary: 'Received 200 points (admin_credit)',
+      transactionIds: ['tx-04'],
+    });
+    expect(byId.get('ledger:e-03')).toMatchObject({
+      kind: 'points_expired',
+      points: 50,
+      summary: '50 points expired',
+      transactionIds: ['tx-03'],
+    });
+    expect(byId.get('hold-placed:res-b')).toMatchObject({
+      kind: 'hold_placed',
+      summary: '100 points held until 2025-03-01T12:05:00.000Z',
+      transactionIds: [],
+    });
+    expect(byId.get('hold-released:res-c')).toMatchObject({ kind: 'hold_released', outcome: 'expired' });
+    expect(byId.get('dispute-opened:ann-1')).toMatchObject({
+      kind: 'dispute_opened',
+      entryId: 'e-02',
+      transactionIds: ['tx-02'],
+    });
+  });
+
+  it('should render summaries through supplied templates', async () => {
+    const localized = new ActivityFeedService(fixtureSources(), {
+      templates: {
+        'timeline.points_expired': '{points} points ont expiré',
+        'timeline.hold_placed': 'Réservation de {points} points',
+      },
+    });
+
+    const { entries } = await localized.timeline(fixture.userId, null, 50);
+    const byId = new Map(entries.map(e => [e.id, e]));
+
+    expect(byId.get('ledger:e-03')!.summary).toBe('50 points ont expiré');
+    expect(byId.get('hold-placed:res-b')!.summary).toBe('Réservation de 100 points');
+    expect(byId.get('ledger:e-04')!.summary).toBe('Received 200 points (admin_credit)');
+    expect(byId.get('hold-placed:res-b')).toMatchObject({
+      summaryKey: 'timeline.hold_placed',
+      summaryParams: { points: 100, expiresAt: '2025-03-01T12:05:00.000Z' },
+    });
+  });
+
+  it('should reject a cursor it did not issue', async () => {
+    await expect(service.timeline(fixture.userId, 'not-a-cursor')).rejects.toThrow(InvalidCursorError);
+    await expect(
+      service.timeline(fixture.userId, Buffer.from(JSON.stringify({ t: 'noon' })).toString('base64url'))
+    ).rejects.toThrow(InvalidCursorError);
+  });
+
+  it('should cap the page size', async () => {
+    const capped = new ActivityFeedService(fixtureSources(), { maxLimit: 4 });
+
+    const page = await capped.timeline(fixture.userId, null, 1000);
+
+    expect(page.entries).toHaveLength(4);
+    expect(page.nextCursor).not.toBeNull();
+  });
+});
+
+describe('timeline sources', () => {
+  const noon = new Date('2025-03-01T12:00:00.000Z');
+
+  it('should resume a source strictly after the cursor position', () => {
+    const older = { timestamp: { $lt: noon } };
+
+    expect(beforeCondition('timestamp', 'entryId', 'ledger:', null)).toEqual({});
+    expect(beforeCondition('timestamp', 'entryId', 'ledger:', { timestamp: noon, id: 'ledger:e-03' })).toEqual({
+      $or: [older, { timestamp: { $eq: noon }, entryId: { $lt: 'e-03' } }],
+    });
+    // Ledger IDs are greater than a dispute ID, so at a tie all of them were served first
+    expect(beforeCondition('timestamp', 'entryId', 'ledger:', { timestamp: noon, id: 'dispute-opened:ann-1' })).toEqual(
+      older
+    );
+    // Hold IDs are less than a ledger ID, so at a tie none of them has been served
+    expect(beforeCondition('timestamp', 'entryId', 'hold-placed:', { timestamp: noon, id: 'ledger:e-02' })).toEqual({
+      $or: [older, { timestamp: { $eq: noon } }],
+    });
+  });
+
+  it('should read a user\'s ledger entries newest first', async () => {
+    const query = {
+      sort: jest.fn().mockReturnThis(),
+      limit: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue([fixture.entries[3]]),
+    };
+    (LedgerEntryModel.find as jest.Mock).mockReturnValue(query);
+
+    const events = await new LedgerTimelineSource().events('user-1', null, 5);
+
+    expect(LedgerEntryModel.find).toHaveBeenCalledWith({ accountId: { $eq: 'user-1' }, accountType: 'user' });
+    expect(query.sort).toHaveBeenCalledWith({ timestamp: -1, entryId: -1 });
+    expect(query.limit).toHaveBeenCalledWith(5);
+    expect(events.map(e => e.id)).toEqual(['ledger:e-04']);
+  });
+});
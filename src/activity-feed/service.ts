@@ -1,25 +1,127 @@
 /**
- * Activity Feed Service (Placeholder)
- * 
- * This module will track user and model activity for reporting purposes.
- * Monitoring hooks are prepared for M1, implementation deferred to M2+.
- * 
- * Planned Features:
- * - User transaction timeline
- * - Model earnings feed
- * - Performance history
- * - Point balance changes
- * 
+ * Activity Feed Service
+ *
+ * A user's activity timeline: ledger transactions merged with events
+ * derived from reservations and dispute annotations, newest first.
+ *
+ * Every source is read from the cursor position, the results are merged
+ * in timeline order (timestamp descending, then entry ID descending) and
+ * cut at the page limit. Entry IDs are unique across sources, so the
+ * order is total and the same page comes back on every read. The cursor
+ * is the page's last position, so entries recorded after the first page
+ * was read never shift later pages.
+ *
+ * Summaries are rendered through an ISummaryRenderer from each entry's
+ * summaryKey and summaryParams; supply templates or a renderer to
+ * localize them.
+ *
  * Metrics:
- * - ACTIVITY_FEED_EVENT: Track when feed events are generated
- * 
- * When implementing this service:
- * 1. Import MetricsLogger from '../metrics'
- * 2. Use MetricEventType.ACTIVITY_FEED_EVENT for all feed generation
- * 3. Add alerting for feed generation failures
- * 4. Consider caching strategy for high-traffic users
+ * - ACTIVITY_FEED_EVENT: one per page served, with its entry count
  */
 
+import { MetricsLogger, MetricEventType } from '../metrics';
+import { InvalidCursorError } from '../services/types';
+import { defaultTimelineSources, compareTimeline } from './sources';
+import { ISummaryRenderer, TemplateRenderer, TimelineTemplates } from './templates';
+import { ITimelineSource, TimelineEntry, TimelinePage, TimelinePosition } from './types';
+
+/**
+ * Configuration for the activity feed
+ */
+export interface ActivityFeedConfig {
+  /** Page size when none is requested */
+  defaultLimit: number;
+
+  /** Largest page served */
+  maxLimit: number;
+
+  /** Template overrides for the default renderer */
+  templates: TimelineTemplates;
+
+  /** Renderer replacing the template renderer */
+  renderer?: ISummaryRenderer;
+}
+
+const DEFAULT_CONFIG: ActivityFeedConfig = {
+  defaultLimit: 20,
+  maxLimit: 100,
+  templates: {},
+};
+
+/**
+ * Activity Feed Service Implementation
+ */
 export class ActivityFeedService {
-  // Placeholder - to be implemented in M2+
+  private config: ActivityFeedConfig;
+  private sources: ITimelineSource[];
+  private renderer: ISummaryRenderer;
+
+  constructor(sources: ITimelineSource[] = defaultTimelineSources(), config: Partial<ActivityFeedConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.sources = sources;
+    this.renderer = this.config.renderer || new TemplateRenderer(this.config.templates);
+  }
+
+  /**
+   * One page of a user's timeline
+   *
+   * @param cursor nextCursor of the previous page; omit for the newest page
+   * @param limit Entries per page, capped at maxLimit
+   * @throws InvalidCursorError if the cursor cannot be decoded
+   */
+  async timeline(userId: string, cursor?: string | null, limit?: number): Promise<TimelinePage> {
+    const before = cursor ? decodeCursor(cursor) : null;
+    const size = Math.min(Math.max(Math.floor(limit || this.config.defaultLimit), 1), this.config.maxLimit);
+
+    const batches = await Promise.all(this.sources.map(source => source.events(userId, before, size)));
+    const merged = batches.flat().sort(compareTimeline);
+    const page = merged.slice(0, size);
+
+    // A source that filled its batch may hold more older entries
+    const more = merged.length > size || batches.some(batch => batch.length === size);
+    const last = page[page.length - 1];
+
+    const entries = page.map(
+      event => ({ ...event, summary: this.renderer.render(event.summaryKey, event.summaryParams) }) as TimelineEntry
+    );
+
+    MetricsLogger.incrementCounter(MetricEventType.ACTIVITY_FEED_EVENT, {
+      entries: entries.length,
+      paged: before !== null,
+    });
+
+    return {
+      entries,
+      nextCursor: more && last ? encodeCursor({ timestamp: last.timestamp, id: last.id }) : null,
+    };
+  }
+}
+
+function encodeCursor(position: TimelinePosition): string {
+  return Buffer.from(JSON.stringify({ t: new Date(position.timestamp).getTime(), id: position.id })).toString(
+    'base64url'
+  );
+}
+
+function decodeCursor(cursor: string): TimelinePosition {
+  let decoded: any;
+  try {
+    decoded = JSON.parse(Buffer.from(cursor, 'base64url').toString('utf8'));
+  } catch {
+    throw new InvalidCursorError(cursor);
+  }
+  if (!decoded || !Number.isSafeInteger(decoded.t) || typeof decoded.id !== 'string' || decoded.id.length === 0) {
+    throw new InvalidCursorError(cursor);
+  }
+  return { timestamp: new Date(decoded.t), id: decoded.id };
+}
+
+/**
+ * Factory function to create an activity feed service
+ */
+export function createActivityFeedService(
+  sources?: ITimelineSource[],
+  config?: Partial<ActivityFeedConfig>
+): ActivityFeedService {
+  return new ActivityFeedService(sources, config);
 }
@@ -0,0 +1,265 @@
+/**
+ * Timeline Sources
+ *
+ * Each source reads one collection newest first and maps its records to
+ * timeline events:
+ * - ledger entries: a transaction, or points_expired for expiry debits
+ * - reservations: hold_placed at creation, and hold_released when a hold
+ *   was released or lapsed (COMMITTED holds show up as their ledger debit)
+ * - ledger annotations: dispute_opened
+ *
+ * Event IDs are `<source>:<record ID>`, so timeline order is total and
+ * the Mongo queries can resume strictly after a cursor position.
+ */
+
+import { LedgerEntry } from '../ledger/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { ReservationModel, ReservationStatus } from '../db/models/reservation.model';
+import { LedgerAnnotationModel } from '../db/models/ledger-annotation.model';
+import { TransactionReason, TransactionType } from '../wallets/types';
+import { ITimelineSource, TimelineEvent, TimelinePosition } from './types';
+
+const LEDGER_PREFIX = 'ledger:';
+const HOLD_PLACED_PREFIX = 'hold-placed:';
+const HOLD_RELEASED_PREFIX = 'hold-released:';
+const DISPUTE_PREFIX = 'dispute-opened:';
+
+/**
+ * Reservation fields the hold events read
+ */
+export interface HoldRecord {
+  reservationId: string;
+  amount: number;
+  status: ReservationStatus;
+  createdAt: Date;
+  updatedAt: Date;
+  expiresAt: Date;
+}
+
+/**
+ * Annotation fields the dispute events read
+ */
+export interface DisputeRecord {
+  annotationId: string;
+  parentEntryId: string;
+  createdAt: Date;
+}
+
+/**
+ * Timeline order: newest first, ties broken by descending ID
+ */
+export function compareTimeline(a: TimelinePosition, b: TimelinePosition): number {
+  const byTime = new Date(b.timestamp).getTime() - new Date(a.timestamp).getTime();
+  if (byTime !== 0) {
+    return byTime;
+  }
+  return a.id < b.id ? 1 : a.id > b.id ? -1 : 0;
+}
+
+export function ledgerEvent(entry: LedgerEntry): TimelineEvent {
+  const base = {
+    id: `${LEDGER_PREFIX}${entry.entryId}`,
+    timestamp: entry.timestamp,
+    transactionIds: [entry.transactionId],
+    entryId: entry.entryId,
+  };
+
+  if (entry.reason === TransactionReason.POINT_EXPIRY) {
+    const points = Math.abs(entry.amount);
+    return {
+      ...base,
+      kind: 'points_expired',
+      points,
+      summaryKey: 'timeline.points_expired',
+      summaryParams: { points },
+    };
+  }
+
+  return {
+    ...base,
+    kind: 'transaction',
+    amount: entry.amount,
+    type: entry.type,
+    reason: entry.reason,
+    balanceState: entry.balanceState,
+    summaryKey: entry.type === TransactionType.CREDIT ? 'timeline.transaction.credit' : 'timeline.transaction.debit',
+    summaryParams: { points: Math.abs(entry.amount), reason: entry.reason },
+  };
+}
+
+export function holdPlacedEvent(hold: HoldRecord): TimelineEvent {
+  return {
+    id: `${HOLD_PLACED_PREFIX}${hold.reservationId}`,
+    kind: 'hold_placed',
+    timestamp: hold.createdAt,
+    transactionIds: [],
+    reservationId: hold.reservationId,
+    points: hold.amount,
+    expiresAt: hold.expiresAt,
+    summaryKey: 'timeline.hold_placed',
+    summaryParams: { points: hold.amount, expiresAt: new Date(hold.expiresAt).toISOString() },
+  };
+}
+
+export function holdReleasedEvent(hold: HoldRecord): TimelineEvent {
+  const outcome = hold.status === ReservationStatus.EXPIRED ? 'expired' : 'released';
+  return {
+    id: `${HOLD_RELEASED_PREFIX}${hold.reservationId}`,
+    kind: 'hold_released',
+    timestamp: hold.updatedAt,
+    transactionIds: [],
+    reservationId: hold.reservationId,
+    points: hold.amount,
+    outcome,
+    summaryKey: `timeline.hold_released.${outcome}`,
+    summaryParams: { points: hold.amount },
+  };
+}
+
+/**
+ * @param transactionId Transaction of the disputed entry, if it is still stored
+ */
+export function disputeOpenedEvent(dispute: DisputeRecord, transactionId?: string): TimelineEvent {
+  return {
+    id: `${DISPUTE_PREFIX}${dispute.annotationId}`,
+    kind: 'dispute_opened',
+    timestamp: dispute.createdAt,
+    transactionIds: transactionId ? [transactionId] : [],
+    annotationId: dispute.annotationId,
+    entryId: dispute.parentEntryId,
+    summaryKey: 'timeline.dispute_opened',
+    summaryParams: {},
+  };
+}
+
+/**
+ * Query condition for a source's records strictly after `before` in
+ * timeline order
+ *
+ * An ID with this source's prefix ties on the record ID; an ID of
+ * another source sorts wholly before or after every ID of this one.
+ */
+export function beforeCondition(
+  timeField: string,
+  idField: string,
+  prefix: string,
+  before: TimelinePosition | null
+): Record<string, unknown> {
+  if (!before) {
+    return {};
+  }
+
+  const timestamp = new Date(before.timestamp);
+  const older = { [timeField]: { $lt: timestamp } };
+
+  if (before.id.startsWith(prefix)) {
+    return {
+      $or: [older, { [timeField]: { $eq: timestamp }, [idField]: { $lt: before.id.slice(prefix.length) } }],
+    };
+  }
+  if (before.id < prefix) {
+    // Every ID of this source sorts after the cursor
+    return older;
+  }
+  return { $or: [older, { [timeField]: { $eq: timestamp } }] };
+}
+
+/**
+ * A user's ledger entries
+ */
+export class LedgerTimelineSource implements ITimelineSource {
+  async events(userId: string, before: TimelinePosition | null, limit: number): Promise<TimelineEvent[]> {
+    const entries = await LedgerEntryModel.find({
+      accountId: { $eq: userId },
+      accountType: 'user',
+      ...beforeCondition('timestamp', 'entryId', LEDGER_PREFIX, before),
+    })
+      .sort({ timestamp: -1, entryId: -1 })
+      .limit(limit)
+      .lean()
+      .exec();
+
+    return entries.map(entry => ledgerEvent(entry as unknown as LedgerEntry));
+  }
+}
+
+/**
+ * Holds placed by a user
+ */
+export class HoldPlacedTimelineSource implements ITimelineSource {
+  async events(userId: string, before: TimelinePosition | null, limit: number): Promise<TimelineEvent[]> {
+    const holds = await ReservationModel.find({
+      userId: { $eq: userId },
+      ...beforeCondition('createdAt', 'reservationId', HOLD_PLACED_PREFIX, before),
+    })
+      .sort({ createdAt: -1, reservationId: -1 })
+      .limit(limit)
+      .lean()
+      .exec();
+
+    return holds.map(hold => holdPlacedEvent(hold as HoldRecord));
+  }
+}
+
+/**
+ * A user's released and lapsed holds
+ * Stamped with the reservation's last update, which is the release.
+ */
+export class HoldReleasedTimelineSource implements ITimelineSource {
+  async events(userId: string, before: TimelinePosition | null, limit: number): Promise<TimelineEvent[]> {
+    const holds = await ReservationModel.find({
+      userId: { $eq: userId },
+      status: { $in: [ReservationStatus.RELEASED, ReservationStatus.EXPIRED] },
+      ...beforeCondition('updatedAt', 'reservationId', HOLD_RELEASED_PREFIX, before),
+    })
+      .sort({ updatedAt: -1, reservationId: -1 })
+      .limit(limit)
+      .lean()
+      .exec();
+
+    return holds.map(hold => holdReleasedEvent(hold as HoldRecord));
+  }
+}
+
+/**
+ * Disputes opened on a user's entries
+ * Annotations recorded before the account was tracked on them are not
+ * found.
+ */
+export class DisputeTimelineSource implements ITimelineSource {
+  async events(userId: string, before: TimelinePosition | null, limit: number): Promise<TimelineEvent[]> {
+    const disputes = await LedgerAnnotationModel.find({
+      accountId: { $eq: userId },
+      kind: 'dispute_opened',
+      ...beforeCondition('createdAt', 'annotationId', DISPUTE_PREFIX, before),
+    })
+      .sort({ createdAt: -1, annotationId: -1 })
+      .limit(limit)
+      .lean()
+      .exec();
+
+    if (disputes.length === 0) {
+      return [];
+    }
+
+    const entries = await LedgerEntryModel.find({ entryId: { $in: disputes.map(d => d.parentEntryId) } })
+      .select('entryId transactionId')
+      .lean()
+      .exec();
+    const transactions = new Map(entries.map(e => [e.entryId, e.transactionId]));
+
+    return disputes.map(dispute => disputeOpenedEvent(dispute, transactions.get(dispute.parentEntryId)));
+  }
+}
+
+/**
+ * Every built-in source
+ */
+export function defaultTimelineSources(): ITimelineSource[] {
+  return [
+    new LedgerTimelineSource(),
+    new HoldPlacedTimelineSource(),
+    new HoldReleasedTimelineSource(),
+    new DisputeTimelineSource(),
+  ];
+}
@@ -0,0 +1,58 @@
+/**
+ * Timeline Summary Templates
+ *
+ * Every summary is a template key plus parameters. Templates use `{name}`
+ * placeholders; downstream apps localize by supplying their own templates
+ * for the same keys, or by rendering summaryKey and summaryParams
+ * themselves.
+ */
+
+import { SummaryParams } from './types';
+
+/**
+ * Summary templates by key
+ */
+export type TimelineTemplates = Record<string, string>;
+
+/**
+ * Renders a summary from its key and parameters
+ */
+export interface ISummaryRenderer {
+  render(key: string, params: SummaryParams): string;
+}
+
+/**
+ * English summaries
+ */
+export const DEFAULT_TIMELINE_TEMPLATES: TimelineTemplates = {
+  'timeline.transaction.credit': 'Received {points} points ({reason})',
+  'timeline.transaction.debit': 'Spent {points} points ({reason})',
+  'timeline.points_expired': '{points} points expired',
+  'timeline.hold_placed': '{points} points held until {expiresAt}',
+  'timeline.hold_released.released': 'Hold of {points} points released',
+  'timeline.hold_released.expired': 'Hold of {points} points lapsed',
+  'timeline.dispute_opened': 'Dispute opened on a transaction',
+};
+
+/**
+ * Renderer that fills `{name}` placeholders from the parameters
+ * A key with no template renders as the key itself; a placeholder with
+ * no parameter is left as is.
+ */
+export class TemplateRenderer implements ISummaryRenderer {
+  private templates: TimelineTemplates;
+
+  constructor(templates: TimelineTemplates = {}) {
+    this.templates = { ...DEFAULT_TIMELINE_TEMPLATES, ...templates };
+  }
+
+  render(key: string, params: SummaryParams): string {
+    const template = this.templates[key];
+    if (template === undefined) {
+      return key;
+    }
+    return template.replace(/\{(\w+)\}/g, (placeholder, name: string) =>
+      Object.prototype.hasOwnProperty.call(params, name) ? String(params[name]) : placeholder
+    );
+  }
+}
@@ -0,0 +1,140 @@
+/**
+ * Activity Timeline Types
+ */
+
+import { TransactionReason, TransactionType } from '../wallets/types';
+
+/**
+ * Kinds of timeline entry
+ */
+export type TimelineKind = 'transaction' | 'points_expired' | 'hold_placed' | 'hold_released' | 'dispute_opened';
+
+/**
+ * Summary parameter values, all serialisable so a page renders the same
+ * wherever it is rendered
+ */
+export type SummaryParams = Record<string, string | number>;
+
+/**
+ * Fields shared by every timeline entry
+ */
+interface TimelineEntryBase {
+  /**
+   * Stable entry ID, `<source>:<record ID>`
+   * Breaks ties between entries that share a timestamp.
+   */
+  id: string;
+
+  timestamp: Date;
+
+  /** Summary rendered from summaryKey and summaryParams */
+  summary: string;
+
+  /** Template key of the summary, for clients that render their own */
+  summaryKey: string;
+
+  summaryParams: SummaryParams;
+
+  /** Ledger transactions the entry refers to */
+  transactionIds: string[];
+}
+
+/**
+ * A ledger entry of the user
+ */
+export interface TransactionTimelineEntry extends TimelineEntryBase {
+  kind: 'transaction';
+  entryId: string;
+  amount: number;
+  type: TransactionType;
+  reason: TransactionReason;
+  balanceState: 'available' | 'escrow' | 'earned';
+}
+
+/**
+ * Points removed by the expiry sweeper
+ */
+export interface PointsExpiredTimelineEntry extends TimelineEntryBase {
+  kind: 'points_expired';
+  entryId: string;
+  points: number;
+}
+
+/**
+ * Points held for a pending redemption
+ */
+export interface HoldPlacedTimelineEntry extends TimelineEntryBase {
+  kind: 'hold_placed';
+  reservationId: string;
+  points: number;
+  expiresAt: Date;
+}
+
+/**
+ * A hold returned to the balance, when released or when it lapsed
+ */
+export interface HoldReleasedTimelineEntry extends TimelineEntryBase {
+  kind: 'hold_released';
+  reservationId: string;
+  points: number;
+  outcome: 'released' | 'expired';
+}
+
+/**
+ * A dispute opened on one of the user's ledger entries
+ */
+export interface DisputeOpenedTimelineEntry extends TimelineEntryBase {
+  kind: 'dispute_opened';
+  annotationId: string;
+
+  /** Disputed ledger entry */
+  entryId: string;
+}
+
+/**
+ * One entry of a user's activity timeline, discriminated by kind
+ */
+export type TimelineEntry =
+  | TransactionTimelineEntry
+  | PointsExpiredTimelineEntry
+  | HoldPlacedTimelineEntry
+  | HoldReleasedTimelineEntry
+  | DisputeOpenedTimelineEntry;
+
+type Unrendered<T> = T extends TimelineEntry ? Omit<T, 'summary'> : never;
+
+/**
+ * A timeline entry before its summary is rendered
+ */
+export type TimelineEvent = Unrendered<TimelineEntry>;
+
+/**
+ * Position in a timeline: the last entry of the previous page
+ */
+export interface TimelinePosition {
+  timestamp: Date;
+  id: string;
+}
+
+/**
+ * A page of a timeline, newest first
+ */
+export interface TimelinePage {
+  entries: TimelineEntry[];
+
+  /** Cursor of the next (older) page, null on the last page */
+  nextCursor: string | null;
+}
+
+/**
+ * Source of one kind of timeline event
+ */
+export interface ITimelineSource {
+  /**
+   * A user's events strictly older than `before` in timeline order,
+   * newest first, at most `limit` of them
+   * Must be derived from stored records only, so repeated reads return
+   * the same events.
+   */
+  events(userId: string, before: TimelinePosition | null, limit: number): Promise<TimelineEvent[]>;
+}
@@ -0,0 +1,67 @@
+/**
+ * Amount Codec Tests
+ */
+
+import { AmountCodec, encodeAmount, decodeAmount } from './amount-codec';
+
+describe('AmountCodec', () => {
+  const beyondSafe = 2n ** 53n + 1n; // 9007199254740993
+
+  describe('encodeAmount', () => {
+    it('should keep numbers by default', () => {
+      expect(encodeAmount(100, 'number')).toBe(100);
+    });
+
+    it('should emit decimal strings when opted in', () => {
+      expect(encodeAmount(-250, 'string')).toBe('-250');
+      expect(encodeAmount(beyondSafe, 'string')).toBe('9007199254740993');
+    });
+
+    it('should refuse to encode unsafe values as numbers', () => {
+      expect(() => encodeAmount(beyondSafe, 'number')).toThrow('without precision loss');
+      expect(() => encodeAmount(1.5, 'string')).toThrow('safe integer');
+    });
+  });
+
+  describe('decodeAmount', () => {
+    it('should accept both string and number forms', () => {
+      expect(decodeAmount('9007199254740993')).toBe(beyondSafe);
+      expect(decodeAmount(' -42 ')).toBe(-42n);
+      expect(decodeAmount(42)).toBe(42n);
+    });
+
+    it('should reject unsafe numbers and malformed strings', () => {
+      expect(() => decodeAmount(2 ** 53 + 2)).toThrow('send it as a string');
+      expect(() => decodeAmount('1.5')).toThrow('Invalid amount string');
+      expect(() => decodeAmount('1e9')).toThrow('Invalid amount string');
+      expect(() => decodeAmount(true)).toThrow('Invalid amount');
+    });
+  });
+
+  it('should round-trip values beyond 2^53 as strings', () => {
+    const codec = new AmountCodec('string');
+    const values = [beyondSafe, 2n ** 62n - 1n, -(2n ** 63n)];
+
+    const text = codec.stringify(values.map(amount => ({ id: 'txn', amount })));
+    const parsed = codec.parse<{ amount: bigint }[]>(text);
+
+    expect(text).toContain('"amount":"9007199254740993"');
+    expect(parsed.map(row => row.amount)).toEqual(values);
+  });
+
+  it('should parse number-form bodies from older clients', () => {
+    const codec = new AmountCodec('string');
+
+    expect(codec.parse('{"amount":500,"reason":"bonus"}')).toEqual({ amount: 500n, reason: 'bonus' });
+  });
+
+  it('should leave non-amount and nested fields untouched', () => {
+    const codec = new AmountCodec('string');
+
+    expect(codec.encode({ amount: 5, count: 3, metadata: { amount: 7 } })).toEqual({
+      amount: '5',
+      count: 3,
+      metadata: { amount: 7 },
+    });
+  });
+});
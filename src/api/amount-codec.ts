@@ -0,0 +1,159 @@
+/**
+ * Amount JSON Codec
+ *
+ * JavaScript clients parse JSON numbers as IEEE-754 doubles, silently
+ * corrupting integers above 2^53. With the 'string' encoding, amounts are
+ * emitted as decimal strings ("9007199254740993") that clients can read
+ * with BigInt or a decimal library. Encoding is opt-in; the default
+ * 'number' encoding keeps the existing wire format.
+ *
+ * Decoding accepts both forms. Strings are read losslessly; numbers are
+ * only accepted when they are safe integers, since a larger JSON number
+ * has already lost precision by the time it reaches us.
+ */
+
+/**
+ * Wire encoding for amounts
+ */
+export type AmountEncoding = 'number' | 'string';
+
+/**
+ * An amount as it appears on the wire
+ */
+export type WireAmount = number | string;
+
+const INTEGER_PATTERN = /^-?\d+$/;
+
+/**
+ * Response fields carrying amounts
+ */
+export const DEFAULT_AMOUNT_FIELDS = [
+  'amount',
+  'previousBalance',
+  'newBalance',
+  'balanceBefore',
+  'balanceAfter',
+  'available',
+  'escrow',
+  'total',
+];
+
+/**
+ * Encode an amount for the wire
+ *
+ * @throws Error if a bigint beyond the safe range is encoded as a number
+ */
+export function encodeAmount(value: number | bigint, encoding: AmountEncoding): WireAmount {
+  if (typeof value === 'number' && !Number.isSafeInteger(value)) {
+    throw new Error(`Amount must be a safe integer: ${value}`);
+  }
+
+  if (encoding === 'string') {
+    return BigInt(value).toString();
+  }
+
+  if (typeof value === 'bigint') {
+    if (value > BigInt(Number.MAX_SAFE_INTEGER) || value < BigInt(Number.MIN_SAFE_INTEGER)) {
+      throw new Error(`Amount ${value} cannot be encoded as a JSON number without precision loss`);
+    }
+    return Number(value);
+  }
+
+  return value;
+}
+
+/**
+ * Decode a wire amount, accepting string or number forms
+ *
+ * @throws Error for non-integer strings or unsafe numbers
+ */
+export function decodeAmount(value: unknown): bigint {
+  if (typeof value === 'string') {
+    const trimmed = value.trim();
+    if (!INTEGER_PATTERN.test(trimmed)) {
+      throw new Error(`Invalid amount string: ${JSON.stringify(value)}`);
+    }
+    return BigInt(trimmed);
+  }
+
+  if (typeof value === 'number') {
+    if (!Number.isSafeInteger(value)) {
+      throw new Error(`Amount number is not a safe integer (send it as a string): ${value}`);
+    }
+    return BigInt(value);
+  }
+
+  if (typeof value === 'bigint') {
+    return value;
+  }
+
+  throw new Error(`Invalid amount: ${JSON.stringify(value)}`);
+}
+
+/**
+ * Codec that applies an amount encoding to response and request objects
+ */
+export class AmountCodec {
+  readonly encoding: AmountEncoding;
+  private amountFields: Set<string>;
+
+  constructor(encoding: AmountEncoding = 'number', amountFields: string[] = DEFAULT_AMOUNT_FIELDS) {
+    this.encoding = encoding;
+    this.amountFields = new Set(amountFields);
+  }
+
+  /**
+   * Encode the amount fields of an object, or of each object in an array
+   */
+  encode<T>(value: T): T {
+    return this.walk(value, (key, field) =>
+      this.amountFields.has(key) && (typeof field === 'number' || typeof field === 'bigint')
+        ? encodeAmount(field, this.encoding)
+        : field
+    );
+  }
+
+  /**
+   * Decode the amount fields of an object, or of each object in an array,
+   * to bigint
+   */
+  decode<T = any>(value: unknown): T {
+    return this.walk(value, (key, field) =>
+      this.amountFields.has(key) && field !== undefined && field !== null ? decodeAmount(field) : field
+    ) as T;
+  }
+
+  /**
+   * Serialize a response with encoded amounts
+   */
+  stringify(value: unknown): string {
+    return JSON.stringify(this.encode(value));
+  }
+
+  /**
+   * Parse a request body, decoding amount fields to bigint
+   */
+  parse<T = any>(text: string): T {
+    return this.decode<T>(JSON.parse(text));
+  }
+
+  /**
+   * Copy an object (or each object in an array), transforming its own
+   * fields only - nested objects such as metadata are left untouched
+   */
+  private walk(value: any, transform: (key: string, field: any) => any): any {
+    if (Array.isArray(value)) {
+      return value.map(item => this.walk(item, transform));
+    }
+
+    if (value === null || typeof value !== 'object' || value instanceof Date) {
+      return value;
+    }
+
+    const result: Record<string, any> = {};
+    for (const [key, field] of Object.entries(value)) {
+      result[key] = transform(key, field);
+    }
+    return result;
+  }
+}
@@ -0,0 +1,280 @@
+/**
+ * Error Mapping Tests
+ */
+
+import * as serviceTypes from '../services/types';
+import {
+  WalletServiceError,
+  AccountAlreadyMergedError,
+  AccountFrozenError,
+  AppendErrorCode,
+  AppendValidationError,
+  CrossTenantError,
+  DailyEarnCapExceededError,
+  DisputeStateError,
+  DuplicateBatchEntryError,
+  InvalidLedgerGroupError,
+  MissingGroupIdError,
+  MissingAdjustReasonError,
+  EntryNotFoundError,
+  ReferenceFormatError,
+  ReferenceOverdrawnError,
+  WriteQueueFullError,
+  DuplicateInBatchError,
+  DuplicateReferenceError,
+  EscrowAlreadyProcessedError,
+  EscrowNotFoundError,
+  IdempotencyConflictError,
+  IdempotencyKeyRejectedError,
+  InsufficientBalanceError,
+  InvalidAuthorizationError,
+  InvalidPointAmountError,
+  InvalidTimeRangeError,
+  IssuerQuotaExceededError,
+  LedgerAppendError,
+  LedgerInconsistencyError,
+  LedgerModeMismatchError,
+  MaintenanceModeError,
+  MirrorWriteError,
+  OptimisticLockError,
+  ProjectionLagError,
+  QuorumReadError,
+  QuorumWriteError,
+  ReadTokenExpiredError,
+  RedemptionAlreadyRecreditedError,
+  RedemptionNotFoundError,
+  RedemptionVelocityError,
+  ReferenceAliasCycleError,
+  ReferenceAlreadyAliasedError,
+  ReferenceAlreadyRecreditedError,
+  ReferenceLimitExceededError,
+  ReplayContentConflictError,
+  ReservationNotActiveError,
+  RewardSoldOutError,
+  SchemaViolationError,
+  TagNotIndexedError,
+  TailOverflowError,
+  TimestampRegressionError,
+  TransactionAlreadyConcealedError,
+  TransactionAlreadyCorrectedError,
+  UnauthorizedCommitterError,
+  UserIdRejectedError,
+  InvalidEarnAwardError,
+  InvalidCursorError,
+  GiftLimitExceededError,
+  GiftNotPendingError,
+  WalletApplicationConflictError,
+} from '../services/types';
+import {
+  mapServiceError,
+  mapGrpcError,
+  ERROR_MAPPINGS,
+  ErrorCategory,
+  GrpcStatusCode,
+} from './error-mapping';
+
+/** One instance of every WalletServiceError subclass, with PII in its message */
+const SAMPLES: Record<string, WalletServiceError> = {
+  InsufficientBalanceError: new InsufficientBalanceError(700, 500),
+  EscrowNotFoundError: new EscrowNotFoundError('escrow-secret'),
+  EscrowAlreadyProcessedError: new EscrowAlreadyProcessedError('escrow-secret', 'settled'),
+  InvalidAuthorizationError: new InvalidAuthorizationError('token for user-secret expired'),
+  OptimisticLockError: new OptimisticLockError('wallet', 'user-secret'),
+  IdempotencyConflictError: new IdempotencyConflictError('key-secret', { balance: 500 }),
+  RedemptionVelocityError: new RedemptionVelocityError('user-secret', 'daily', 5, 6),
+  AccountAlreadyMergedError: new AccountAlreadyMergedError('user-secret', 'user-other'),
+  AccountFrozenError: new AccountFrozenError('user-secret'),
+  CrossTenantError: new CrossTenantError('tenant-a', 'tenant-b'),
+  TagNotIndexedError: new TagNotIndexedError('campaign'),
+  MaintenanceModeError: new MaintenanceModeError('read_only', 'migrating shard 7', 30),
+  LedgerModeMismatchError: new LedgerModeMismatchError('double', 'single'),
+  LedgerInconsistencyError: new LedgerInconsistencyError('balance drift for user-secret', { drift: 12 }),
+  DuplicateReferenceError: new DuplicateReferenceError('user-secret', 'ref-1', new Date()),
+  InvalidPointAmountError: new InvalidPointAmountError(1.5, 'not an integer'),
+  MirrorWriteError: new MirrorWriteError('entry-1', 'mirror-east', 'timeout'),
+  QuorumReadError: new QuorumReadError('getEntry-secret', 2, ['replica-a'], [{ name: 'replica-b', error: 'timeout' }]),
+  QuorumWriteError: new QuorumWriteError('key-secret', 2, ['replica-a'], [{ name: 'replica-b', error: 'timeout' }]),
+  RewardSoldOutError: new RewardSoldOutError('tickets-2024'),
+  ReservationNotActiveError: new ReservationNotActiveError('res-1', 'EXPIRED'),
+  InvalidTimeRangeError: new InvalidTimeRangeError(new Date(2), new Date(1)),
+  TimestampRegressionError: new TimestampRegressionError(new Date(1), new Date(2)),
+  DisputeStateError: new DisputeStateError('entry-1', 'closed', 'reopen'),
+  ReferenceLimitExceededError: new ReferenceLimitExceededError('ref-1', 'earns', 3, 4),
+  LedgerAppendError: new LedgerAppendError(AppendErrorCode.STORAGE, 'key-secret', new Error('mongo at 10.0.0.5 down')),
+  TailOverflowError: new TailOverflowError('subscriber-1', 100),
+  ReadTokenExpiredError: new ReadTokenExpiredError('token-secret'),
+  ReferenceAlreadyAliasedError: new ReferenceAlreadyAliasedError('ref-a', 'ref-b'),
+  ReferenceAliasCycleError: new ReferenceAliasCycleError('ref-a', 'ref-b'),
+  TransactionAlreadyConcealedError: new TransactionAlreadyConcealedError('tx-secret'),
+  IssuerQuotaExceededError: new IssuerQuotaExceededError('issuer-secret', 'points', 1000, 1200),
+  UnauthorizedCommitterError: new UnauthorizedCommitterError('svc:rogue'),
+  InvalidEarnAwardError: new InvalidEarnAwardError('rule-secret', -5),
+  UserIdRejectedError: new UserIdRejectedError(new Error('user-secret@example.com looks like an email')),
+  IdempotencyKeyRejectedError: new IdempotencyKeyRejectedError(new Error('key-secret is not a UUIDv4')),
+  RedemptionAlreadyRecreditedError: new RedemptionAlreadyRecreditedError('tx-secret', 'tx-recredit'),
+  ReferenceAlreadyRecreditedError: new ReferenceAlreadyRecreditedError('batch-secret', 'recredit-batch-secret'),
+  TransactionAlreadyCorrectedError: new TransactionAlreadyCorrectedError('tx-secret', 'tx-correction'),
+  AppendValidationError: new AppendValidationError('custom', new Error('user-secret looked odd')),
+  InvalidCursorError: new InvalidCursorError('cursor-secret'),
+  GiftLimitExceededError: new GiftLimitExceededError('user-secret', 1000, 900, 200),
+  GiftNotPendingError: new GiftNotPendingError('gift-1', 'accepted'),
+  DuplicateBatchEntryError: new DuplicateBatchEntryError('batch-1', 'key-secret', 2, 0),
+  DuplicateInBatchError: new DuplicateInBatchError([['evt-secret-1', 'evt-secret-2']]),
+  RedemptionNotFoundError: new RedemptionNotFoundError('tx-secret'),
+  ProjectionLagError: new ProjectionLagError('balance-cache', 'user-secret', 7, 5),
+  SchemaViolationError: new SchemaViolationError('credit', [{ field: 'orderId', message: 'user-secret order is not a string' }]),
+  DailyEarnCapExceededError: new DailyEarnCapExceededError('user-secret', new Date(), 1000, 1200),
+  ReplayContentConflictError: new ReplayContentConflictError('key-secret', 'entry-1', ['amount']),
+  InvalidLedgerGroupError: new InvalidLedgerGroupError('Legs carry different group IDs', { groupIds: ['grp-secret', 'grp-2'] }),
+  MissingGroupIdError: new MissingGroupIdError('key-secret'),
+  MissingAdjustReasonError: new MissingAdjustReasonError('key-secret', 'admin_credit'),
+  EntryNotFoundError: new EntryNotFoundError('entry-1', 'user-secret'),
+  ReferenceFormatError: new ReferenceFormatError('order-secret', 'credit'),
+  ReferenceOverdrawnError: new ReferenceOverdrawnError('promo-secret', 50, -80),
+  WriteQueueFullError: new WriteQueueFullError(1000),
+  WalletApplicationConflictError: new WalletApplicationConflictError('key-secret', ['delta']),
+};
+
+describe('error mapping', () => {
+  beforeEach(() => {
+    jest.spyOn(console, 'error').mockImplementation(() => undefined);
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  describe('completeness', () => {
+    const subclasses = Object.entries(serviceTypes)
+      .filter(([, value]) => typeof value === 'function' && value.prototype instanceof WalletServiceError)
+      .map(([name]) => name);
+
+    it('has a sample for every WalletServiceError subclass', () => {
+      expect(subclasses.filter(name => !SAMPLES[name])).toEqual([]);
+    });
+
+    it.each(Object.entries(SAMPLES))('maps %s to an explicit code', (_name, error) => {
+      expect(ERROR_MAPPINGS[error.code]).toBeDefined();
+    });
+
+    it.each(Object.entries(SAMPLES))('never echoes the message or details of %s', (_name, error) => {
+      const http = mapServiceError(error);
+      const grpc = mapGrpcError(error);
+
+      expect(http.body.message).not.toBe(error.message);
+      expect(JSON.stringify(http)).not.toMatch(/secret|10\.0\.0\.5/);
+      expect(JSON.stringify(grpc)).not.toMatch(/secret|10\.0\.0\.5/);
+    });
+  });
+
+  describe('mapServiceError', () => {
+    it.each([
+      [new DuplicateReferenceError('u', 'r', new Date()), 409, ErrorCategory.DUPLICATE],
+      [new OptimisticLockError('wallet', 'u'), 409, ErrorCategory.CONFLICT],
+      [new EscrowNotFoundError('e'), 404, ErrorCategory.NOT_FOUND],
+      [new InsufficientBalanceError(2, 1), 402, ErrorCategory.INSUFFICIENT_BALANCE],
+      [new AccountFrozenError('u'), 423, ErrorCategory.FROZEN],
+      [new RedemptionVelocityError('u', 'daily', 1, 2), 429, ErrorCategory.RATE_LIMITED],
+      [new IssuerQuotaExceededError('i', 'points', 1, 2), 422, ErrorCategory.POLICY_VIOLATION],
+      [new MaintenanceModeError('read_only', 'm'), 503, ErrorCategory.MAINTENANCE],
+      [new UnauthorizedCommitterError('svc:x'), 403, ErrorCategory.UNAUTHORIZED],
+    ])('maps %p to %i', (error, statusCode, category) => {
+      const response = mapServiceError(error);
+
+      expect(response.statusCode).toBe(statusCode);
+      expect(response.body).toEqual({
+        error: error.code,
+        category,
+        message: ERROR_MAPPINGS[error.code].message,
+      });
+    });
+
+    it('maps unknown errors to an opaque 500 with a correlation ID', () => {
+      const response = mapServiceError(new TypeError('cannot read balance of undefined'));
+
+      expect(response.statusCode).toBe(500);
+      expect(response.body).toMatchObject({
+        error: 'INTERNAL_ERROR',
+        category: ErrorCategory.INTERNAL,
+        message: 'Internal server error',
+      });
+      expect(response.body.correlationId).toEqual(expect.any(String));
+      expect(console.error).toHaveBeenCalledWith(
+        expect.any(String),
+        expect.objectContaining({ correlationId: response.body.correlationId, message: 'cannot read balance of undefined' })
+      );
+    });
+
+    it('hides the code of internal service errors', () => {
+      const response = mapServiceError(new LedgerInconsistencyError('drift'), 'corr-1');
+
+      expect(response.statusCode).toBe(500);
+      expect(response.body).toMatchObject({ error: 'INTERNAL_ERROR', correlationId: 'corr-1' });
+    });
+
+    it('passes a supplied correlation ID through', () => {
+      expect(mapServiceError(new AccountFrozenError('u'), 'corr-1').body.correlationId).toBe('corr-1');
+    });
+
+    it('sets Retry-After for maintenance mode when the duration is known', () => {
+      expect(mapServiceError(new MaintenanceModeError('read_only', 'm', 30)).headers).toEqual({ 'Retry-After': '30' });
+      expect(mapServiceError(new MaintenanceModeError('read_only', 'm')).headers).toEqual({});
+    });
+
+    it('maps append failures by their typed cause', () => {
+      const error = LedgerAppendError.from(new InsufficientBalanceError(2, 1), { idempotencyKey: 'k' });
+
+      expect(mapServiceError(error)).toMatchObject({
+        statusCode: 402,
+        body: { error: 'INSUFFICIENT_BALANCE', category: ErrorCategory.INSUFFICIENT_BALANCE },
+      });
+    });
+
+    it('maps append failures without a typed cause by append code', () => {
+      const invalid = new LedgerAppendError(AppendErrorCode.INVALID, 'k', new Error('bad field'));
+      const storage = new LedgerAppendError(AppendErrorCode.STORAGE, 'k', new Error('socket hang up'));
+
+      expect(mapServiceError(invalid)).toMatchObject({ statusCode: 400, body: { category: ErrorCategory.INVALID } });
+      expect(mapServiceError(storage)).toMatchObject({ statusCode: 500, body: { error: 'INTERNAL_ERROR' } });
+    });
+  });
+
+  describe('mapGrpcError', () => {
+    it.each([
+      [new IdempotencyConflictError('k', {}), GrpcStatusCode.ALREADY_EXISTS],
+      [new DisputeStateError('e', 's', 'a'), GrpcStatusCode.ABORTED],
+      [new EscrowNotFoundError('e'), GrpcStatusCode.NOT_FOUND],
+      [new InsufficientBalanceError(2, 1), GrpcStatusCode.FAILED_PRECONDITION],
+      [new AccountFrozenError('u'), GrpcStatusCode.FAILED_PRECONDITION],
+      [new ReferenceLimitExceededError('r', 'earns', 1, 2), GrpcStatusCode.FAILED_PRECONDITION],
+      [new RedemptionVelocityError('u', 'daily', 1, 2), GrpcStatusCode.RESOURCE_EXHAUSTED],
+      [new MaintenanceModeError('read_only', 'm'), GrpcStatusCode.UNAVAILABLE],
+      [new CrossTenantError('a', 'b'), GrpcStatusCode.PERMISSION_DENIED],
+      [new InvalidPointAmountError(1.5, 'r'), GrpcStatusCode.INVALID_ARGUMENT],
+    ])('maps %p to status %i', (error, code) => {
+      const status = mapGrpcError(error);
+
+      expect(status.code).toBe(code);
+      expect(status.message).toBe(ERROR_MAPPINGS[error.code].message);
+      expect(status.metadata['error-code']).toBe(error.code);
+    });
+
+    it('maps unknown errors to INTERNAL with a correlation ID', () => {
+      const status = mapGrpcError('boom');
+
+      expect(status.code).toBe(GrpcStatusCode.INTERNAL);
+      expect(status.metadata).toMatchObject({ 'error-code': 'INTERNAL_ERROR', category: ErrorCategory.INTERNAL });
+      expect(status.metadata['correlation-id']).toEqual(expect.any(String));
+    });
+
+    it('carries retry-after for maintenance mode', () => {
+      expect(mapGrpcError(new MaintenanceModeError('read_only', 'm', 30)).metadata['retry-after']).toBe('30');
+    });
+
+    it('agrees with the HTTP mapping on category', () => {
+      for (const error of Object.values(SAMPLES)) {
+        expect(mapGrpcError(error, 'c').metadata.category).toBe(mapServiceError(error, 'c').body.category);
+      }
+    });
+  });
+});
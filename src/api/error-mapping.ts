@@ -0,0 +1,271 @@
+/**
+ * Service Error to HTTP and gRPC Response Mapping
+ *
+ * Translates typed service errors into status codes, bodies and headers
+ * for whichever HTTP framework hosts the controllers, and into gRPC
+ * statuses for the gRPC layer. Both are driven by one table keyed by
+ * error code, so the two transports always agree.
+ *
+ * Responses carry the machine-readable code, a category and a fixed,
+ * client-safe message. The error's own message and details may contain
+ * user IDs, balances or internal state and are never echoed. Unknown and
+ * internal errors become an opaque 500 / INTERNAL with a correlation ID
+ * that is logged alongside the real error.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { WalletServiceError, LedgerAppendError, AppendErrorCode } from '../services/types';
+
+/**
+ * Client-facing error categories
+ */
+export enum ErrorCategory {
+  DUPLICATE = 'duplicate',
+  CONFLICT = 'conflict',
+  NOT_FOUND = 'not_found',
+  INSUFFICIENT_BALANCE = 'insufficient_balance',
+  FROZEN = 'frozen',
+  RATE_LIMITED = 'rate_limited',
+  POLICY_VIOLATION = 'policy_violation',
+  MAINTENANCE = 'maintenance',
+  UNAUTHORIZED = 'unauthorized',
+  INVALID = 'invalid',
+  EXPIRED = 'expired',
+  UNAVAILABLE = 'unavailable',
+  INTERNAL = 'internal',
+}
+
+/**
+ * gRPC status codes, as defined by the gRPC specification
+ */
+export enum GrpcStatusCode {
+  OK = 0,
+  CANCELLED = 1,
+  UNKNOWN = 2,
+  INVALID_ARGUMENT = 3,
+  DEADLINE_EXCEEDED = 4,
+  NOT_FOUND = 5,
+  ALREADY_EXISTS = 6,
+  PERMISSION_DENIED = 7,
+  RESOURCE_EXHAUSTED = 8,
+  FAILED_PRECONDITION = 9,
+  ABORTED = 10,
+  OUT_OF_RANGE = 11,
+  UNIMPLEMENTED = 12,
+  INTERNAL = 13,
+  UNAVAILABLE = 14,
+  DATA_LOSS = 15,
+  UNAUTHENTICATED = 16,
+}
+
+/**
+ * Transport statuses for each category
+ */
+export const CATEGORY_STATUS: Record<ErrorCategory, { http: number; grpc: GrpcStatusCode }> = {
+  [ErrorCategory.DUPLICATE]: { http: 409, grpc: GrpcStatusCode.ALREADY_EXISTS },
+  [ErrorCategory.CONFLICT]: { http: 409, grpc: GrpcStatusCode.ABORTED },
+  [ErrorCategory.NOT_FOUND]: { http: 404, grpc: GrpcStatusCode.NOT_FOUND },
+  [ErrorCategory.INSUFFICIENT_BALANCE]: { http: 402, grpc: GrpcStatusCode.FAILED_PRECONDITION },
+  [ErrorCategory.FROZEN]: { http: 423, grpc: GrpcStatusCode.FAILED_PRECONDITION },
+  [ErrorCategory.RATE_LIMITED]: { http: 429, grpc: GrpcStatusCode.RESOURCE_EXHAUSTED },
+  [ErrorCategory.POLICY_VIOLATION]: { http: 422, grpc: GrpcStatusCode.FAILED_PRECONDITION },
+  [ErrorCategory.MAINTENANCE]: { http: 503, grpc: GrpcStatusCode.UNAVAILABLE },
+  [ErrorCategory.UNAUTHORIZED]: { http: 403, grpc: GrpcStatusCode.PERMISSION_DENIED },
+  [ErrorCategory.INVALID]: { http: 400, grpc: GrpcStatusCode.INVALID_ARGUMENT },
+  [ErrorCategory.EXPIRED]: { http: 410, grpc: GrpcStatusCode.FAILED_PRECONDITION },
+  [ErrorCategory.UNAVAILABLE]: { http: 503, grpc: GrpcStatusCode.UNAVAILABLE },
+  [ErrorCategory.INTERNAL]: { http: 500, grpc: GrpcStatusCode.INTERNAL },
+};
+
+/**
+ * Category and client-safe message for an error code
+ */
+export interface ErrorMapping {
+  category: ErrorCategory;
+  message: string;
+}
+
+/**
+ * Mapping for every WalletServiceError code
+ * A new error code must be added here; the spec fails otherwise.
+ */
+export const ERROR_MAPPINGS: Record<string, ErrorMapping> = {
+  ACCOUNT_ALREADY_MERGED: { category: ErrorCategory.CONFLICT, message: 'Account has been merged into another account' },
+  ACCOUNT_FROZEN: { category: ErrorCategory.FROZEN, message: 'Account is frozen' },
+  APPEND_VALIDATION_FAILED: { category: ErrorCategory.INVALID, message: 'Transaction failed validation' },
+  CROSS_TENANT: { category: ErrorCategory.UNAUTHORIZED, message: 'Resource belongs to a different tenant' },
+  DAILY_EARN_CAP_EXCEEDED: { category: ErrorCategory.POLICY_VIOLATION, message: 'Daily earn limit reached' },
+  DISPUTE_STATE_CONFLICT: { category: ErrorCategory.CONFLICT, message: 'Dispute is not in a state that allows this action' },
+  DUPLICATE_BATCH_ENTRY: { category: ErrorCategory.INVALID, message: 'Batch contains the same entry twice' },
+  DUPLICATE_IN_BATCH: { category: ErrorCategory.INVALID, message: 'Batch contains duplicate events' },
+  DUPLICATE_REFERENCE: { category: ErrorCategory.DUPLICATE, message: 'Reference has already been used' },
+  ESCROW_ALREADY_PROCESSED: { category: ErrorCategory.CONFLICT, message: 'Escrow has already been processed' },
+  ENTRY_NOT_FOUND: { category: ErrorCategory.NOT_FOUND, message: 'Entry not found' },
+  ESCROW_NOT_FOUND: { category: ErrorCategory.NOT_FOUND, message: 'Escrow not found' },
+  GIFT_LIMIT_EXCEEDED: { category: ErrorCategory.POLICY_VIOLATION, message: 'Gift limit exceeded' },
+  GIFT_NOT_PENDING: { category: ErrorCategory.CONFLICT, message: 'Gift is no longer pending' },
+  IDEMPOTENCY_CONFLICT: { category: ErrorCategory.DUPLICATE, message: 'Request has already been processed' },
+  IDEMPOTENCY_KEY_REJECTED: { category: ErrorCategory.INVALID, message: 'Idempotency key is not in an accepted format' },
+  INSUFFICIENT_BALANCE: { category: ErrorCategory.INSUFFICIENT_BALANCE, message: 'Insufficient balance' },
+  INVALID_AUTHORIZATION: { category: ErrorCategory.UNAUTHORIZED, message: 'Not authorized to perform this action' },
+  INVALID_CURSOR: { category: ErrorCategory.INVALID, message: 'Invalid pagination cursor' },
+  INVALID_EARN_AWARD: { category: ErrorCategory.INTERNAL, message: 'Internal server error' },
+  INVALID_LEDGER_GROUP: { category: ErrorCategory.INVALID, message: 'Invalid multi-leg group' },
+  INVALID_POINT_AMOUNT: { category: ErrorCategory.INVALID, message: 'Invalid point amount' },
+  INVALID_TIME_RANGE: { category: ErrorCategory.INVALID, message: 'Invalid time range' },
+  ISSUER_QUOTA_EXCEEDED: { category: ErrorCategory.POLICY_VIOLATION, message: 'Issuer quota exceeded' },
+  LEDGER_APPEND_FAILED: { category: ErrorCategory.INTERNAL, message: 'Internal server error' },
+  LEDGER_INCONSISTENT: { category: ErrorCategory.INTERNAL, message: 'Internal server error' },
+  LEDGER_MODE_MISMATCH: { category: ErrorCategory.CONFLICT, message: 'Ledger is configured for a different entry mode' },
+  MAINTENANCE_MODE: { category: ErrorCategory.MAINTENANCE, message: 'Service is temporarily unavailable for maintenance' },
+  MIRROR_WRITE_FAILED: { category: ErrorCategory.UNAVAILABLE, message: 'Service is temporarily unavailable' },
+  MISSING_ADJUST_REASON: { category: ErrorCategory.INVALID, message: 'Adjustment must state a reason' },
+  MISSING_GROUP_ID: { category: ErrorCategory.INVALID, message: 'Entry must belong to a group' },
+  OPTIMISTIC_LOCK_CONFLICT: { category: ErrorCategory.CONFLICT, message: 'Resource was modified concurrently; retry the request' },
+  PROJECTION_LAG: { category: ErrorCategory.UNAVAILABLE, message: 'Service is temporarily unavailable' },
+  QUORUM_READ_FAILED: { category: ErrorCategory.UNAVAILABLE, message: 'Service is temporarily unavailable' },
+  QUORUM_WRITE_FAILED: { category: ErrorCategory.UNAVAILABLE, message: 'Service is temporarily unavailable' },
+  READ_TOKEN_EXPIRED: { category: ErrorCategory.EXPIRED, message: 'Read token has expired' },
+  REDEMPTION_ALREADY_RECREDITED: { category: ErrorCategory.DUPLICATE, message: 'Redemption has already been re-credited' },
+  REDEMPTION_NOT_FOUND: { category: ErrorCategory.NOT_FOUND, message: 'Redemption not found' },
+  REDEMPTION_VELOCITY: { category: ErrorCategory.RATE_LIMITED, message: 'Too many redemptions; try again later' },
+  REFERENCE_ALIAS_CYCLE: { category: ErrorCategory.CONFLICT, message: 'Reference alias would create a cycle' },
+  REFERENCE_ALREADY_ALIASED: { category: ErrorCategory.CONFLICT, message: 'Reference is already aliased' },
+  REFERENCE_ALREADY_RECREDITED: { category: ErrorCategory.DUPLICATE, message: 'Reference has already been re-credited' },
+  REFERENCE_LIMIT_EXCEEDED: { category: ErrorCategory.POLICY_VIOLATION, message: 'Reference limit exceeded' },
+  REFERENCE_FORMAT: { category: ErrorCategory.INVALID, message: 'Reference is not in the expected format' },
+  REFERENCE_OVERDRAWN: { category: ErrorCategory.INSUFFICIENT_BALANCE, message: 'Insufficient balance under reference' },
+  REPLAY_CONTENT_CONFLICT: { category: ErrorCategory.CONFLICT, message: 'Request conflicts with an earlier request using the same key' },
+  WALLET_APPLICATION_CONFLICT: { category: ErrorCategory.CONFLICT, message: 'Request conflicts with an earlier request using the same key' },
+  RESERVATION_NOT_ACTIVE: { category: ErrorCategory.CONFLICT, message: 'Reservation is no longer active' },
+  REWARD_SOLD_OUT: { category: ErrorCategory.CONFLICT, message: 'Reward is sold out' },
+  SCHEMA_VIOLATION: { category: ErrorCategory.INVALID, message: 'Transaction does not match its schema' },
+  TAG_NOT_INDEXED: { category: ErrorCategory.INVALID, message: 'Tag is not queryable' },
+  TAIL_OVERFLOW: { category: ErrorCategory.UNAVAILABLE, message: 'Subscriber fell too far behind; reconnect' },
+  TIMESTAMP_REGRESSION: { category: ErrorCategory.CONFLICT, message: 'Entry timestamp precedes the latest entry' },
+  TRANSACTION_ALREADY_CONCEALED: { category: ErrorCategory.CONFLICT, message: 'Transaction has already been concealed' },
+  TRANSACTION_ALREADY_CORRECTED: { category: ErrorCategory.DUPLICATE, message: 'Transaction has already been corrected' },
+  UNAUTHORIZED_COMMITTER: { category: ErrorCategory.UNAUTHORIZED, message: 'Not authorized to write to the ledger' },
+  USER_ID_REJECTED: { category: ErrorCategory.INVALID, message: 'User ID is not an accepted identifier' },
+  WRITE_QUEUE_FULL: { category: ErrorCategory.RATE_LIMITED, message: 'Too many pending writes; try again later' },
+};
+
+const INTERNAL_MAPPING: ErrorMapping = { category: ErrorCategory.INTERNAL, message: 'Internal server error' };
+
+/**
+ * HTTP response derived from an error
+ */
+export interface HttpErrorResponse {
+  statusCode: number;
+  headers: Record<string, string>;
+  body: {
+    error: string;
+    category: ErrorCategory;
+    message: string;
+    correlationId?: string;
+  };
+}
+
+/**
+ * gRPC status derived from an error
+ */
+export interface GrpcErrorStatus {
+  code: GrpcStatusCode;
+  message: string;
+
+  /** Trailing metadata: error-code, category, correlation-id, retry-after */
+  metadata: Record<string, string>;
+}
+
+/**
+ * Transport-neutral result of classifying an error
+ */
+interface ResolvedError {
+  code: string;
+  mapping: ErrorMapping;
+  correlationId?: string;
+  retryAfterSeconds?: number;
+}
+
+/**
+ * Map an error thrown by a service to an HTTP response
+ * Unknown errors become an opaque 500.
+ */
+export function mapServiceError(error: unknown, correlationId?: string): HttpErrorResponse {
+  const resolved = resolveError(error, correlationId);
+
+  const headers: Record<string, string> = {};
+  if (resolved.retryAfterSeconds !== undefined) {
+    headers['Retry-After'] = String(resolved.retryAfterSeconds);
+  }
+
+  return {
+    statusCode: CATEGORY_STATUS[resolved.mapping.category].http,
+    headers,
+    body: {
+      error: resolved.code,
+      category: resolved.mapping.category,
+      message: resolved.mapping.message,
+      ...(resolved.correlationId !== undefined && { correlationId: resolved.correlationId }),
+    },
+  };
+}
+
+/**
+ * Map an error thrown by a service to a gRPC status
+ * Unknown errors become an opaque INTERNAL.
+ */
+export function mapGrpcError(error: unknown, correlationId?: string): GrpcErrorStatus {
+  const resolved = resolveError(error, correlationId);
+
+  const metadata: Record<string, string> = {
+    'error-code': resolved.code,
+    category: resolved.mapping.category,
+  };
+  if (resolved.correlationId !== undefined) {
+    metadata['correlation-id'] = resolved.correlationId;
+  }
+  if (resolved.retryAfterSeconds !== undefined) {
+    metadata['retry-after'] = String(resolved.retryAfterSeconds);
+  }
+
+  return {
+    code: CATEGORY_STATUS[resolved.mapping.category].grpc,
+    message: resolved.mapping.message,
+    metadata,
+  };
+}
+
+function resolveError(error: unknown, correlationId?: string): ResolvedError {
+  const mapping = error instanceof WalletServiceError ? mappingFor(error) : undefined;
+
+  if (!mapping || mapping.category === ErrorCategory.INTERNAL) {
+    const id = correlationId ?? uuidv4();
+    console.error('Unmapped service error:', {
+      correlationId: id,
+      name: error instanceof Error ? error.name : typeof error,
+      code: error instanceof WalletServiceError ? error.code : undefined,
+      message: error instanceof Error ? error.message : String(error),
+    });
+    return { code: 'INTERNAL_ERROR', mapping: INTERNAL_MAPPING, correlationId: id };
+  }
+
+  const serviceError = error as WalletServiceError;
+  const retryAfterSeconds =
+    mapping.category === ErrorCategory.MAINTENANCE ? serviceError.details?.retryAfterSeconds : undefined;
+
+  return {
+    code: serviceError.code,
+    mapping,
+    correlationId,
+    ...(retryAfterSeconds !== undefined && { retryAfterSeconds }),
+  };
+}
+
+function mappingFor(error: WalletServiceError): ErrorMapping | undefined {
+  // An append failure without a typed cause is either invalid input or storage
+  if (error instanceof LedgerAppendError && error.code === 'LEDGER_APPEND_FAILED') {
+    return error.appendCode === AppendErrorCode.INVALID ? ERROR_MAPPINGS.APPEND_VALIDATION_FAILED : INTERNAL_MAPPING;
+  }
+  return ERROR_MAPPINGS[error.code];
+}
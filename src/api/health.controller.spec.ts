@@ -0,0 +1,29 @@
+/**
+ * Health Controller Tests
+ */
+
+import { HealthController } from './health.controller';
+import { StartupReadiness } from '../ledger/startup-readiness';
+
+describe('HealthController', () => {
+  const readiness = (ready: boolean, status: 'healthy' | 'degraded' | 'unhealthy') =>
+    ({
+      isReady: jest.fn().mockReturnValue(ready),
+      health: jest.fn().mockReturnValue({ service: 'ledger', status, checkedAt: new Date() }),
+    }) as unknown as StartupReadiness;
+
+  it('should return 200 while ready, including when degraded', () => {
+    expect(new HealthController(readiness(true, 'healthy')).getHealth().statusCode).toBe(200);
+    expect(new HealthController(readiness(true, 'degraded')).getHealth()).toMatchObject({
+      statusCode: 200,
+      body: { status: 'degraded' },
+    });
+  });
+
+  it('should return 503 with the health body when not ready', () => {
+    expect(new HealthController(readiness(false, 'unhealthy')).getHealth()).toMatchObject({
+      statusCode: 503,
+      body: { service: 'ledger', status: 'unhealthy' },
+    });
+  });
+});
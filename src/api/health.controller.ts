@@ -0,0 +1,47 @@
+/**
+ * Health Controller
+ *
+ * GET /health, reporting the ledger startup self-check. Load balancers
+ * and orchestrators use the status code; ops read the body for the full
+ * self-check report.
+ */
+
+import { StartupReadiness } from '../ledger/startup-readiness';
+import { ServiceHealth } from '../services/types';
+
+/**
+ * Response for GET /health
+ */
+export interface HealthResponse {
+  /** 200 while ready (healthy or degraded), 503 otherwise */
+  statusCode: number;
+  body: ServiceHealth;
+}
+
+/**
+ * Health Controller Class
+ */
+export class HealthController {
+  private readiness: StartupReadiness;
+
+  constructor(readiness: StartupReadiness) {
+    this.readiness = readiness;
+  }
+
+  /**
+   * GET /health
+   */
+  getHealth(): HealthResponse {
+    return {
+      statusCode: this.readiness.isReady() ? 200 : 503,
+      body: this.readiness.health(),
+    };
+  }
+}
+
+/**
+ * Factory function to create controller instance
+ */
+export function createHealthController(readiness: StartupReadiness): HealthController {
+  return new HealthController(readiness);
+}
@@ -7,3 +7,6 @@
 export * from './events.controller';
 export * from './ledger.controller';
 export * from './wallet.controller';
+export * from './health.controller';
+export * from './error-mapping';
+export * from './amount-codec';
@@ -5,6 +5,7 @@
 import { LedgerController, ListTransactionsRequest } from './ledger.controller';
 import { ILedgerService, LedgerQueryResult, BalanceSnapshot, LedgerEntry } from '../ledger/types';
 import { TransactionType, TransactionReason } from '../wallets/types';
+import { SequenceWatermark } from '../ledger/read-your-writes';
 
 describe('LedgerController', () => {
   let controller: LedgerController;
@@ -108,6 +109,18 @@ describe('LedgerController', () => {
       );
     });
 
+    it('should reject an unknown type filter', async () => {
+      const request = {
+        userId: 'user-123',
+        type: 'refund',
+      } as unknown as ListTransactionsRequest;
+
+      await expect(controller.listTransactions(request)).rejects.toThrow(
+        'Invalid transaction type: refund'
+      );
+      expect(mockLedgerService.queryEntries).not.toHaveBeenCalled();
+    });
+
     it('should filter transactions by date range', async () => {
       const mockResult: LedgerQueryResult = {
         entries: [],
@@ -207,4 +220,108 @@ describe('LedgerController', () => {
       expect(response.total).toBe(750);
     });
   });
+
+  describe('amount encoding', () => {
+    it('should emit amounts as strings when configured', async () => {
+      const stringController = new LedgerController(mockLedgerService, { amountEncoding: 'string' });
+      mockLedgerService.queryEntries.mockResolvedValue({
+        entries: [
+          {
+            entryId: 'entry-1',
+            transactionId: 'txn-1',
+            accountId: 'user-123',
+            accountType: 'user',
+            amount: 100,
+            type: TransactionType.CREDIT,
+            balanceState: 'available',
+            stateTransition: 'none→available',
+            reason: TransactionReason.ADMIN_CREDIT,
+            idempotencyKey: 'idem-1',
+            requestId: 'req-1',
+            balanceBefore: 0,
+            balanceAfter: 100,
+            timestamp: new Date('2024-01-01T00:00:00Z'),
+            currency: 'points',
+            metadata: { amount: 3 },
+          },
+        ],
+        totalCount: 1,
+        offset: 0,
+        limit: 100,
+        hasMore: false,
+      });
+      mockLedgerService.getBalanceSnapshot.mockResolvedValue({
+        accountId: 'user-123',
+        accountType: 'user',
+        availableBalance: 500,
+        escrowBalance: 100,
+        asOf: new Date('2024-01-01T00:00:00Z'),
+        currency: 'points',
+      });
+
+      const list = await stringController.listTransactions({ userId: 'user-123' });
+      const balance = await stringController.getBalance('user-123');
+
+      expect(list.transactions[0]).toMatchObject({
+        amount: '100',
+        previousBalance: '0',
+        newBalance: '100',
+        metadata: { amount: 3 },
+      });
+      expect(list.pagination.total).toBe(1);
+      expect(balance).toMatchObject({ available: '500', escrow: '100', total: '600' });
+    });
+  });
+
+  describe('read-your-writes', () => {
+    let watermark: SequenceWatermark;
+    let consistent: LedgerController;
+
+    beforeEach(() => {
+      jest.useFakeTimers();
+      watermark = new SequenceWatermark('balance-cache');
+      consistent = new LedgerController(mockLedgerService, { readYourWrites: watermark, minSeqTimeoutMs: 200 });
+      mockLedgerService.getBalanceSnapshot.mockResolvedValue({
+        accountId: 'user-123',
+        accountType: 'user',
+        availableBalance: 400,
+        asOf: new Date('2024-01-01T00:00:00Z'),
+        currency: 'points',
+      });
+      mockLedgerService.queryEntries.mockResolvedValue({ entries: [], totalCount: 0, offset: 0, limit: 100, hasMore: false });
+    });
+
+    afterEach(() => {
+      jest.useRealTimers();
+    });
+
+    it('should wait for the projection before reading the balance', async () => {
+      const response = consistent.getBalance('user-123', 2);
+
+      await jest.advanceTimersByTimeAsync(150);
+      expect(mockLedgerService.getBalanceSnapshot).not.toHaveBeenCalled();
+
+      watermark.advance({ accountId: 'user-123', accountType: 'user', streamVersion: 2 } as LedgerEntry);
+
+      await expect(response).resolves.toMatchObject({ available: 400, stale: false });
+    });
+
+    it('should answer stale once the timeout expires', async () => {
+      const list = consistent.listTransactions({ userId: 'user-123', minSeq: 5 });
+
+      await jest.advanceTimersByTimeAsync(200);
+
+      await expect(list).resolves.toMatchObject({ stale: true });
+      expect(mockLedgerService.queryEntries).toHaveBeenCalled();
+    });
+
+    it('should not report staleness when no minSeq is given', async () => {
+      expect(await consistent.getBalance('user-123')).not.toHaveProperty('stale');
+      expect(await controller.getBalance('user-123', 5)).not.toHaveProperty('stale');
+    });
+
+    it('should reject a malformed minSeq', async () => {
+      await expect(consistent.getBalance('user-123', 0)).rejects.toThrow('minSeq must be a positive integer');
+    });
+  });
 });
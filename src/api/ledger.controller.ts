@@ -8,7 +8,10 @@
  */
 
 import { LedgerQueryFilter, LedgerQueryResult, BalanceSnapshot, ILedgerService } from '../ledger/types';
-import { TransactionType } from '../wallets/types';
+import { TransactionType, parseTransactionType } from '../wallets/types';
+import { SequenceWaiter } from '../ledger/read-your-writes';
+import { ProjectionLagError } from '../services/types';
+import { AmountCodec, AmountEncoding, WireAmount } from './amount-codec';
 
 /**
  * Request interface for GET /ledger/transactions
@@ -21,6 +24,9 @@ export interface ListTransactionsRequest {
   limit?: number;
   offset?: number;
   requestId?: string;
+
+  /** Read-your-writes: stream version of the user's last write (min_seq) */
+  minSeq?: number;
 }
 
 /**
@@ -30,14 +36,14 @@ export interface TransactionListResponse {
   transactions: Array<{
     id: string;
     userId: string;
-    amount: number;
+    amount: WireAmount;
     type: 'credit' | 'debit';
     reason: string;
     metadata?: Record<string, any>;
     timestamp: string;
     idempotencyKey: string;
-    previousBalance?: number;
-    newBalance?: number;
+    previousBalance?: WireAmount;
+    newBalance?: WireAmount;
     requestId?: string;
   }>;
   pagination: {
@@ -46,6 +52,9 @@ export interface TransactionListResponse {
     total: number;
     hasMore: boolean;
   };
+
+  /** Set when minSeq was given; true if it was not applied in time */
+  stale?: boolean;
 }
 
 /**
@@ -53,21 +62,53 @@ export interface TransactionListResponse {
  */
 export interface BalanceResponse {
   userId: string;
-  available: number;
-  escrow?: number;
-  total: number;
+  available: WireAmount;
+  escrow?: WireAmount;
+  total: WireAmount;
   asOf: string;
+
+  /** Set when minSeq was given; true if it was not applied in time */
+  stale?: boolean;
+}
+
+/**
+ * Options for the ledger controller
+ */
+export interface LedgerControllerOptions {
+  /**
+   * Wire encoding for amounts; 'string' avoids precision loss in
+   * JavaScript clients for values beyond 2^53 (default 'number')
+   */
+  amountEncoding?: AmountEncoding;
+
+  /**
+   * Projection the ledger service reads from, for read-your-writes.
+   * Requests with minSeq wait on it before reading; without it minSeq
+   * is ignored
+   */
+  readYourWrites?: SequenceWaiter;
+
+  /** Longest wait for minSeq before answering stale (default 1000) */
+  minSeqTimeoutMs?: number;
 }
 
+const DEFAULT_MIN_SEQ_TIMEOUT_MS = 1000;
+
 /**
  * Ledger Controller Class
  * Handles HTTP requests for ledger operations
  */
 export class LedgerController {
   private ledgerService: ILedgerService;
+  private amountCodec: AmountCodec;
+  private readYourWrites?: SequenceWaiter;
+  private minSeqTimeoutMs: number;
 
-  constructor(ledgerService: ILedgerService) {
+  constructor(ledgerService: ILedgerService, options: LedgerControllerOptions = {}) {
     this.ledgerService = ledgerService;
+    this.amountCodec = new AmountCodec(options.amountEncoding);
+    this.readYourWrites = options.readYourWrites;
+    this.minSeqTimeoutMs = options.minSeqTimeoutMs ?? DEFAULT_MIN_SEQ_TIMEOUT_MS;
   }
 
   /**
@@ -81,7 +122,7 @@ export class LedgerController {
     // Map string type to enum if provided
     let typeFilter: TransactionType | undefined;
     if (request.type && request.type !== 'all') {
-      typeFilter = request.type === 'credit' ? TransactionType.CREDIT : TransactionType.DEBIT;
+      typeFilter = parseTransactionType(request.type);
     }
 
     // Build filter from request parameters
@@ -97,12 +138,14 @@ export class LedgerController {
       sortOrder: 'desc',
     };
 
+    const stale = request.userId ? await this.awaitSeq(request.userId, request.minSeq) : undefined;
+
     // Query ledger service
     const result: LedgerQueryResult = await this.ledgerService.queryEntries(filter);
 
     // Map to response format matching OpenAPI spec
     return {
-      transactions: result.entries.map(entry => ({
+      transactions: this.amountCodec.encode(result.entries.map(entry => ({
         id: entry.transactionId,
         userId: entry.accountId,
         amount: entry.amount,
@@ -114,13 +157,14 @@ export class LedgerController {
         previousBalance: entry.balanceBefore,
         newBalance: entry.balanceAfter,
         requestId: entry.requestId,
-      })),
+      }))),
       pagination: {
         limit: result.limit,
         offset: result.offset,
         total: result.totalCount,
         hasMore: result.hasMore,
       },
+      ...(stale === undefined ? {} : { stale }),
     };
   }
 
@@ -129,9 +173,12 @@ export class LedgerController {
    * Returns the current ledger balance for the provided user ID
    * 
    * @param userId - User identifier
+   * @param minSeq - Stream version of the user's last write (min_seq)
    * @returns Promise<BalanceResponse>
    */
-  async getBalance(userId: string): Promise<BalanceResponse> {
+  async getBalance(userId: string, minSeq?: number): Promise<BalanceResponse> {
+    const stale = await this.awaitSeq(userId, minSeq);
+
     // Get current balance snapshot
     const snapshot: BalanceSnapshot = await this.ledgerService.getBalanceSnapshot(
       userId,
@@ -139,19 +186,47 @@ export class LedgerController {
     );
 
     // Map to response format matching OpenAPI spec
-    return {
+    return this.amountCodec.encode({
       userId: snapshot.accountId,
       available: snapshot.availableBalance,
       escrow: snapshot.escrowBalance,
       total: (snapshot.availableBalance || 0) + (snapshot.escrowBalance || 0),
       asOf: snapshot.asOf.toISOString(),
-    };
+      ...(stale === undefined ? {} : { stale }),
+    });
+  }
+
+  /**
+   * Wait for the read projection to apply a user's write
+   *
+   * @returns Whether the read will be stale, or undefined when not asked
+   */
+  private async awaitSeq(userId: string, minSeq: number | undefined): Promise<boolean | undefined> {
+    if (minSeq === undefined || !this.readYourWrites) {
+      return undefined;
+    }
+    if (!Number.isSafeInteger(minSeq) || minSeq < 1) {
+      throw new Error(`minSeq must be a positive integer: ${minSeq}`);
+    }
+
+    try {
+      await this.readYourWrites.waitForSeq(userId, minSeq, this.minSeqTimeoutMs);
+      return false;
+    } catch (error) {
+      if (error instanceof ProjectionLagError) {
+        return true;
+      }
+      throw error;
+    }
   }
 }
 
 /**
  * Factory function to create controller instance
  */
-export function createLedgerController(ledgerService: ILedgerService): LedgerController {
-  return new LedgerController(ledgerService);
+export function createLedgerController(
+  ledgerService: ILedgerService,
+  options?: LedgerControllerOptions
+): LedgerController {
+  return new LedgerController(ledgerService, options);
 }
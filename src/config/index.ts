@@ -1,7 +1,10 @@
 /**
  * Configuration Module
  * 
- * Provides configuration utilities and environment validation.
+ * Provides configuration utilities, environment validation and the
+ * program config shared by policy-applying components.
  */
 
 export * from './env-validator';
+export * from './program';
+export * from './program-store';
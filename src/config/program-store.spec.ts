@@ -0,0 +1,259 @@
+/**
+ * Program Config Store Tests
+ */
+
+import { PassThrough } from 'stream';
+import { ProgramConfigStore, changedSettings } from './program-store';
+import { ProgramConfig, defaultProgram } from './program';
+import { ValidatingLedgerService } from '../ledger/validating-ledger.service';
+import { programPolicyValidators } from '../ledger/append-validators';
+import { EarnIngestionService, EarnRulesEngine, ProgramEarnRule } from '../services/earn-ingestion.service';
+import { PointExpirationService } from '../services/point-expiration.service';
+import { UserExportService } from '../services/user-export.service';
+import { InvalidAuthorizationError } from '../services/types';
+import { AdminAccessLogModel } from '../db/models/admin-access-log.model';
+import { WalletModel } from '../db/models/wallet.model';
+import { EscrowItemModel } from '../db/models/escrow-item.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/admin-access-log.model');
+jest.mock('../db/models/wallet.model');
+jest.mock('../db/models/escrow-item.model');
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+describe('ProgramConfigStore', () => {
+  const admin = { adminId: 'admin-1', adminUsername: 'ops@example.com', roles: ['finance_admin'] };
+
+  const program = (changes: Partial<ProgramConfig> = {}): ProgramConfig => ({
+    ...defaultProgram(),
+    programId: 'rewards',
+    pointScale: 2,
+    maxCreditPerEntry: 5000,
+    earnRates: [{ currency: 'USD', pointsPerUnit: 100, minorUnitsPerUnit: 100 }],
+    expiration: { enabled: true, lifetimeDays: 30, gracePeriodDays: 0, warningPeriodDays: 7, sweepIntervalMinutes: 60 },
+    ...changes,
+  });
+
+  const accessLog = () => (AdminAccessLogModel.create as jest.Mock).mock.calls.map(([record]) => record);
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    (AdminAccessLogModel.create as jest.Mock).mockResolvedValue({});
+  });
+
+  it('should reject an invalid initial config', () => {
+    expect(() => new ProgramConfigStore(program({ maxCreditPerEntry: 0 }))).toThrow('Invalid program config');
+  });
+
+  it('should freeze the active config and keep it apart from the caller', () => {
+    const initial = program();
+    const store = new ProgramConfigStore(initial);
+    initial.earnRates[0].pointsPerUnit = 1;
+
+    expect(store.current().earnRates[0].pointsPerUnit).toBe(100);
+    expect(() => { (store.current() as any).allowOverdraft = true; }).toThrow(TypeError);
+    expect(() => { (store.current().expiration as any).enabled = false; }).toThrow(TypeError);
+    expect(() => { store.current().earnRates.push({ currency: 'EUR', pointsPerUnit: 1, minorUnitsPerUnit: 100 }); }).toThrow(TypeError);
+  });
+
+  it('should swap the config and record what changed', async () => {
+    const store = new ProgramConfigStore(program());
+    const previous = store.current();
+
+    const active = await store.reload(program({ allowOverdraft: true, maxCreditPerEntry: 2000 }), admin, 'req-1');
+
+    expect(store.current()).toBe(active);
+    expect(previous.allowOverdraft).toBe(false);
+    expect(accessLog()).toEqual([
+      expect.objectContaining({
+        operation: 'reloadProgramConfig',
+        adminId: 'admin-1',
+        target: 'program:rewards',
+        decision: 'allowed',
+        requestId: 'req-1',
+        details: {
+          changed: ['allowOverdraft', 'maxCreditPerEntry'],
+          previous: { allowOverdraft: false, maxCreditPerEntry: 5000 },
+          next: { allowOverdraft: true, maxCreditPerEntry: 2000 },
+        },
+      }),
+    ]);
+  });
+
+  it('should keep the active config when a reload is refused', async () => {
+    const store = new ProgramConfigStore(program());
+    const active = store.current();
+    const noSweep = program({
+      expiration: { enabled: true, lifetimeDays: 30, gracePeriodDays: 0, warningPeriodDays: 7 },
+    });
+
+    await expect(store.reload(noSweep, admin)).rejects.toThrow('no sweepIntervalMinutes');
+    await expect(store.reload(program({ programId: 'other' }), admin)).rejects.toThrow('Cannot reload program rewards');
+    await expect(store.reload(program({ pointScale: 3 }), admin)).rejects.toThrow('Cannot change the point scale');
+    await expect(store.reload(program(), { ...admin, adminId: '' })).rejects.toThrow(InvalidAuthorizationError);
+
+    (AdminAccessLogModel.create as jest.Mock).mockRejectedValueOnce(new Error('log unavailable'));
+    await expect(store.reload(program({ allowOverdraft: true }), admin)).rejects.toThrow('log unavailable');
+
+    expect(store.current()).toBe(active);
+  });
+
+  it('should apply concurrent reloads in call order', async () => {
+    const store = new ProgramConfigStore(program());
+
+    await Promise.allSettled([
+      store.reload(program({ maxCreditPerEntry: 1000 }), admin),
+      store.reload(program({ maxCreditPerEntry: 0 }), admin),
+      store.reload(program({ maxCreditPerEntry: 3000 }), admin),
+    ]);
+
+    expect(store.current().maxCreditPerEntry).toBe(3000);
+    expect(accessLog().map(record => record.details.next)).toEqual([
+      { maxCreditPerEntry: 1000 },
+      { maxCreditPerEntry: 3000 },
+    ]);
+  });
+
+  it('should list settings added, removed or changed', () => {
+    expect(changedSettings(program(), program())).toEqual([]);
+    expect(changedSettings(program(), program({ maxCreditPerEntry: undefined }))).toEqual(['maxCreditPerEntry']);
+    expect(changedSettings(program(), program({ earnRates: [] }))).toEqual(['earnRates']);
+  });
+
+  describe('shared by the policy-applying components', () => {
+    let entries: any[];
+    let store: ProgramConfigStore;
+    let ledger: ValidatingLedgerService;
+    let ingestion: EarnIngestionService;
+    let expiration: PointExpirationService;
+    let exporter: UserExportService;
+
+    const append = async (request: any) => {
+      const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+      if (existing) {
+        return { entry: existing, inserted: false };
+      }
+      const entry = { entryId: `entry-${entries.length + 1}`, timestamp: new Date(), ...request };
+      entries.push(entry);
+      return { entry, inserted: true };
+    };
+    const balance = () => entries.reduce((sum, e) => sum + e.amount, 0);
+
+    const statement = async () => {
+      const output = new PassThrough();
+      const chunks: string[] = [];
+      output.on('data', chunk => chunks.push(chunk.toString()));
+      await exporter.exportUser('user-1', output, 'json');
+      output.end();
+      return JSON.parse(chunks.join(''));
+    };
+
+    const debit = (amount: number) => ({
+      accountId: 'user-1',
+      accountType: 'user' as const,
+      amount: -amount,
+      type: TransactionType.DEBIT,
+      balanceState: 'available' as const,
+      stateTransition: 'available→none',
+      reason: TransactionReason.CHIP_MENU_PURCHASE,
+      idempotencyKey: `debit-${entries.length}`,
+      requestId: 'req-debit',
+      balanceBefore: balance(),
+      balanceAfter: balance() - amount,
+    });
+
+    const credit = (amount: number) => ({
+      ...debit(-amount),
+      type: TransactionType.CREDIT,
+      stateTransition: 'none→available',
+      reason: TransactionReason.ADMIN_CREDIT,
+    });
+
+    beforeEach(() => {
+      entries = [];
+      const inner: any = {
+        createEntry: jest.fn().mockImplementation(async (request: any) => (await append(request)).entry),
+        createEntryWithResult: jest.fn().mockImplementation(append),
+        getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string, accountType: 'user' | 'model') => ({
+          accountId,
+          accountType,
+          availableBalance: balance(),
+          escrowBalance: 0,
+          asOf: new Date(),
+          currency: 'points',
+        })),
+        queryEntries: jest.fn().mockImplementation(async (filter: any) => ({
+          entries: entries.slice(filter.offset, filter.offset + filter.limit),
+          totalCount: entries.length,
+          offset: filter.offset,
+          limit: filter.limit,
+          hasMore: filter.offset + filter.limit < entries.length,
+        })),
+      };
+      (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue({});
+      (WalletModel.findOne as jest.Mock).mockImplementation(async () => ({ availableBalance: balance(), escrowBalance: 0 }));
+      (EscrowItemModel.find as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+
+      store = new ProgramConfigStore(program());
+      ledger = new ValidatingLedgerService(inner, programPolicyValidators(store));
+      ingestion = new EarnIngestionService(inner, new EarnRulesEngine([new ProgramEarnRule(store)]), { program: store });
+      expiration = new PointExpirationService(inner, { program: store });
+      exporter = new UserExportService(inner, { program: store });
+    });
+
+    const purchase = (eventId: string, occurredAt: Date) => ({
+      eventId,
+      userId: 'user-1',
+      amount: 1234,
+      currency: 'USD',
+      reference: `order-${eventId}`,
+      occurredAt,
+    });
+
+    it('should apply one config to earns, expiry, statements and appends', async () => {
+      const occurredAt = new Date(Date.now() - 25 * DAY_MS);
+
+      const report = await ingestion.ingestEvents([purchase('evt-1', occurredAt)]);
+
+      expect(report.outcomes[0]).toMatchObject({ status: 'created', points: 1200 });
+      expect(entries[0].metadata.expiresAt).toBe(new Date(occurredAt.getTime() + 30 * DAY_MS).toISOString());
+      expect((await expiration.expiringPoints('user-1', 7 * DAY_MS)).total).toBe(1200);
+      expect((await expiration.expiringPoints('user-1', 1 * DAY_MS)).total).toBe(0);
+      expect(await statement()).toMatchObject({
+        transactions: [expect.objectContaining({ amount: '12' })],
+        summary: { availableBalance: '12', lifetimeCredits: '12' },
+      });
+      await expect(ledger.createEntry(credit(6000))).rejects.toThrow('credit of 6000 exceeds the rewards cap of 5000');
+      await expect(ledger.createEntry(debit(1300))).rejects.toThrow('program-overdraft');
+    });
+
+    it('should reach every component with a reload', async () => {
+      await ingestion.ingestEvents([purchase('evt-1', new Date(Date.now() - 25 * DAY_MS))]);
+      await expect(ledger.createEntry(credit(2400))).resolves.toMatchObject({ amount: 2400 });
+
+      await store.reload(
+        program({
+          allowOverdraft: true,
+          maxCreditPerEntry: 2000,
+          earnRates: [{ currency: 'USD', pointsPerUnit: 200, minorUnitsPerUnit: 100 }],
+          expiration: { enabled: false, lifetimeDays: 0, gracePeriodDays: 0, warningPeriodDays: 7 },
+        }),
+        admin
+      );
+
+      const report = await ingestion.ingestEvents([purchase('evt-2', new Date())]);
+      expect(report.outcomes[0]).toMatchObject({ status: 'created', points: 2400 });
+      expect(entries[entries.length - 1].metadata.expiresAt).toBeUndefined();
+      expect(await expiration.expiringPoints('user-1', 7 * DAY_MS)).toEqual({ userId: 'user-1', total: 0, lots: [] });
+      await expect(ledger.createEntry(credit(2400))).rejects.toThrow('exceeds the rewards cap of 2000');
+      await expect(ledger.createEntry(debit(balance() + 100))).resolves.toMatchObject({ balanceAfter: -100 });
+      expect(accessLog()[0].details.changed.sort()).toEqual(
+        ['allowOverdraft', 'earnRates', 'expiration', 'maxCreditPerEntry']
+      );
+    });
+  });
+});
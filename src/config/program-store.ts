@@ -0,0 +1,124 @@
+/**
+ * Program Config Store
+ *
+ * Holds the active program config and is the ProgramConfigSource every
+ * policy-applying component is given. The active config is frozen, so
+ * no consumer can change it in place, and reload() swaps it as a whole:
+ * a component reads either the old config or the new one, never a mix.
+ *
+ * Each reload is validated, then recorded in the admin access log with
+ * the settings it changed before it takes effect. Reloads are applied
+ * one at a time in call order. The point scale cannot be reloaded: every
+ * stored amount is in program units, so a new scale would reinterpret
+ * them all.
+ *
+ * @module config/program-store
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { AdminAccessLogModel } from '../db/models/admin-access-log.model';
+import { AdminContext } from '../services/admin-ops.service';
+import { InvalidAuthorizationError } from '../services/types';
+import { ProgramConfig, ProgramConfigSource, assertValidProgramConfig, defaultProgram } from './program';
+
+/**
+ * ProgramConfigStore implementation
+ */
+export class ProgramConfigStore implements ProgramConfigSource {
+  private active: ProgramConfig;
+  private reloading: Promise<unknown> = Promise.resolve();
+
+  /**
+   * @throws Error if the initial config is invalid
+   */
+  constructor(initial: ProgramConfig = defaultProgram()) {
+    assertValidProgramConfig(initial);
+    this.active = freezeProgram(initial);
+  }
+
+  current(): ProgramConfig {
+    return this.active;
+  }
+
+  /**
+   * Replace the active config
+   *
+   * @returns The config now active
+   * @throws Error if the config is invalid, names a different program or changes the point scale
+   * @throws InvalidAuthorizationError if no admin is identified
+   */
+  async reload(next: ProgramConfig, admin: AdminContext, requestId?: string): Promise<ProgramConfig> {
+    const run = this.reloading.then(() => this.apply(next, admin, requestId));
+    this.reloading = run.catch(() => undefined);
+    return run;
+  }
+
+  private async apply(next: ProgramConfig, admin: AdminContext, requestId?: string): Promise<ProgramConfig> {
+    if (!admin.adminId) {
+      throw new InvalidAuthorizationError('Reloading the program config requires an identified admin');
+    }
+    assertValidProgramConfig(next);
+    if (next.programId !== this.active.programId) {
+      throw new Error(`Cannot reload program ${this.active.programId} with config for ${next.programId}`);
+    }
+    if (next.pointScale !== this.active.pointScale) {
+      throw new Error(
+        `Cannot change the point scale of program ${this.active.programId} from ${this.active.pointScale} to ${next.pointScale}`
+      );
+    }
+
+    const frozen = freezeProgram(next);
+    const changed = changedSettings(this.active, frozen);
+
+    await AdminAccessLogModel.create({
+      logId: uuidv4(),
+      operation: 'reloadProgramConfig',
+      adminId: admin.adminId,
+      adminUsername: admin.adminUsername,
+      roles: admin.roles || [],
+      ipAddress: admin.ipAddress,
+      userAgent: admin.userAgent,
+      target: `program:${frozen.programId}`,
+      decision: 'allowed',
+      requestId,
+      details: {
+        changed,
+        previous: pick(this.active, changed),
+        next: pick(frozen, changed),
+      },
+    });
+
+    this.active = frozen;
+    return frozen;
+  }
+}
+
+/**
+ * Top-level settings whose values differ
+ */
+export function changedSettings(previous: ProgramConfig, next: ProgramConfig): (keyof ProgramConfig)[] {
+  const keys = new Set([...Object.keys(previous), ...Object.keys(next)] as (keyof ProgramConfig)[]);
+  return [...keys].filter(key => JSON.stringify(previous[key]) !== JSON.stringify(next[key]));
+}
+
+function pick(config: ProgramConfig, keys: (keyof ProgramConfig)[]): Partial<ProgramConfig> {
+  return Object.fromEntries(keys.map(key => [key, config[key]]));
+}
+
+/**
+ * Deep copy and freeze a config
+ */
+function freezeProgram(config: ProgramConfig): ProgramConfig {
+  const copy = structuredClone(config);
+  Object.freeze(copy.expiration);
+  copy.earnRates.forEach(rate => Object.freeze(rate));
+  Object.freeze(copy.earnRates);
+  return Object.freeze(copy);
+}
+
+/**
+ * Factory function to create a program config store
+ */
+export function createProgramConfigStore(initial?: ProgramConfig): ProgramConfigStore {
+  return new ProgramConfigStore(initial);
+}
@@ -0,0 +1,77 @@
+/**
+ * Program Configuration Tests
+ */
+
+import { ProgramConfig, assertValidProgramConfig, defaultProgram, validateProgramConfig } from './program';
+
+describe('validateProgramConfig', () => {
+  const withChanges = (changes: Partial<ProgramConfig>): ProgramConfig => ({ ...defaultProgram(), ...changes });
+
+  it('should accept the default program', () => {
+    expect(validateProgramConfig(defaultProgram())).toEqual([]);
+  });
+
+  it('should require a sweep interval when expiration is enabled', () => {
+    const config = withChanges({
+      expiration: { enabled: true, lifetimeDays: 365, gracePeriodDays: 0, warningPeriodDays: 7 },
+    });
+
+    expect(validateProgramConfig(config)).toEqual(['expiration is enabled but has no sweepIntervalMinutes']);
+  });
+
+  it('should accept disabled expiration without a sweep interval', () => {
+    const config = withChanges({
+      expiration: { enabled: false, lifetimeDays: 0, gracePeriodDays: 0, warningPeriodDays: 7 },
+    });
+
+    expect(validateProgramConfig(config)).toEqual([]);
+  });
+
+  it('should reject a warning period that outlasts the point lifetime', () => {
+    const config = withChanges({
+      expiration: { enabled: true, lifetimeDays: 7, gracePeriodDays: 0, warningPeriodDays: 14, sweepIntervalMinutes: 60 },
+    });
+
+    expect(validateProgramConfig(config)).toEqual([
+      'expiration.warningPeriodDays must be shorter than expiration.lifetimeDays',
+    ]);
+  });
+
+  it('should reject negative and fractional caps', () => {
+    expect(validateProgramConfig(withChanges({ maxCreditPerEntry: -1, maxDebitPerEntry: 2.5 }))).toEqual([
+      'maxCreditPerEntry must be a positive integer: -1',
+      'maxDebitPerEntry must be a positive integer: 2.5',
+    ]);
+  });
+
+  it('should reject malformed and duplicate earn rates', () => {
+    const config = withChanges({
+      earnRates: [
+        { currency: 'USD', pointsPerUnit: 1000, minorUnitsPerUnit: 100 },
+        { currency: 'USD', pointsPerUnit: 500, minorUnitsPerUnit: 100 },
+        { currency: 'euro', pointsPerUnit: -1, minorUnitsPerUnit: 0 },
+      ],
+    });
+
+    expect(validateProgramConfig(config)).toEqual([
+      'Duplicate earn rate for USD',
+      'Invalid earn rate currency: euro',
+      'Earn rate for euro must be a non-negative integer: -1',
+      'minorUnitsPerUnit for euro must be a positive integer: 0',
+    ]);
+  });
+
+  it('should reject an unknown timezone and an out-of-range scale', () => {
+    const errors = validateProgramConfig(withChanges({ defaultTimeZone: 'Mars/Olympus', pointScale: 9 }));
+
+    expect(errors).toHaveLength(2);
+    expect(errors).toContain('Unknown defaultTimeZone: Mars/Olympus');
+    expect(errors[0]).toMatch(/Point scale must be an integer/);
+  });
+
+  it('should report every problem at once when asserting', () => {
+    expect(() => assertValidProgramConfig(withChanges({ programId: '', maxCreditPerEntry: 0 }))).toThrow(
+      'Invalid program config: programId is required; maxCreditPerEntry must be a positive integer: 0'
+    );
+  });
+});
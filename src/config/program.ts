@@ -0,0 +1,194 @@
+/**
+ * Program Configuration
+ *
+ * One object holding the policies of a points program: overdraft and
+ * per-entry caps, the expiration window and sweep interval, earn rates,
+ * the default timezone and the point scale. Components that apply a
+ * policy read it from a ProgramConfigSource when they need it, instead
+ * of taking it as a constructor parameter, so every component follows
+ * the same settings and a reload reaches all of them at once.
+ *
+ * validateProgramConfig collects every problem with a config, including
+ * settings that are valid alone but contradict each other.
+ *
+ * @module config/program
+ */
+
+import { DEFAULT_POINT_SCALE, assertValidScale } from '../points/fixed-point';
+import { assertValidTimeZone } from '../ledger/timezone';
+
+/**
+ * When points expire and how the sweep runs
+ */
+export interface ExpirationPolicy {
+  enabled: boolean;
+
+  /** Days a credit lives before it expires */
+  lifetimeDays: number;
+
+  /** Days after expiry before the sweep debits a lot */
+  gracePeriodDays: number;
+
+  /** Days before expiry that users are warned */
+  warningPeriodDays: number;
+
+  /** How often the sweep runs, in minutes (required when enabled) */
+  sweepIntervalMinutes?: number;
+}
+
+/**
+ * Points earned per whole unit spent in one currency
+ */
+export interface EarnRate {
+  /** ISO 4217 currency code */
+  currency: string;
+
+  /** Program units earned per whole currency unit */
+  pointsPerUnit: number;
+
+  /** Minor units per whole unit (100 for cents) */
+  minorUnitsPerUnit: number;
+}
+
+/**
+ * The policies of a points program
+ */
+export interface ProgramConfig {
+  programId: string;
+
+  /** Decimal places of one point */
+  pointScale: number;
+
+  /** IANA timezone for users without one of their own */
+  defaultTimeZone: string;
+
+  /** Whether a debit may take a balance below zero */
+  allowOverdraft: boolean;
+
+  /** Largest single credit to a user, in program units (uncapped when unset) */
+  maxCreditPerEntry?: number;
+
+  /** Largest single debit from a user, in program units (uncapped when unset) */
+  maxDebitPerEntry?: number;
+
+  expiration: ExpirationPolicy;
+
+  earnRates: EarnRate[];
+}
+
+/**
+ * Where components read the active program config
+ */
+export interface ProgramConfigSource {
+  current(): ProgramConfig;
+}
+
+/**
+ * The default program: milli-points, no overdraft, no caps, points
+ * expiring after a year and swept hourly, one point per US dollar
+ */
+export function defaultProgram(): ProgramConfig {
+  return {
+    programId: 'default',
+    pointScale: DEFAULT_POINT_SCALE,
+    defaultTimeZone: 'UTC',
+    allowOverdraft: false,
+    expiration: {
+      enabled: true,
+      lifetimeDays: 365,
+      gracePeriodDays: 0,
+      warningPeriodDays: 7,
+      sweepIntervalMinutes: 60,
+    },
+    earnRates: [{ currency: 'USD', pointsPerUnit: 10 ** DEFAULT_POINT_SCALE, minorUnitsPerUnit: 100 }],
+  };
+}
+
+const CURRENCY_PATTERN = /^[A-Z]{3}$/;
+
+/**
+ * Every problem with a program config
+ *
+ * @returns Problems found, empty when the config is valid
+ */
+export function validateProgramConfig(config: ProgramConfig): string[] {
+  const errors: string[] = [];
+  const isCount = (value: number) => Number.isSafeInteger(value) && value >= 0;
+
+  if (!config.programId) {
+    errors.push('programId is required');
+  }
+
+  try {
+    assertValidScale(config.pointScale);
+  } catch (error) {
+    errors.push((error as Error).message);
+  }
+
+  try {
+    assertValidTimeZone(config.defaultTimeZone);
+  } catch {
+    errors.push(`Unknown defaultTimeZone: ${config.defaultTimeZone}`);
+  }
+
+  for (const cap of ['maxCreditPerEntry', 'maxDebitPerEntry'] as const) {
+    const value = config[cap];
+    if (value !== undefined && !(Number.isSafeInteger(value) && value > 0)) {
+      errors.push(`${cap} must be a positive integer: ${value}`);
+    }
+  }
+
+  const expiration = config.expiration;
+  for (const field of ['gracePeriodDays', 'warningPeriodDays'] as const) {
+    if (!isCount(expiration[field])) {
+      errors.push(`expiration.${field} must be a non-negative integer: ${expiration[field]}`);
+    }
+  }
+  if (expiration.enabled) {
+    if (!(Number.isSafeInteger(expiration.lifetimeDays) && expiration.lifetimeDays > 0)) {
+      errors.push(`expiration.lifetimeDays must be a positive integer: ${expiration.lifetimeDays}`);
+    } else if (expiration.warningPeriodDays >= expiration.lifetimeDays) {
+      errors.push('expiration.warningPeriodDays must be shorter than expiration.lifetimeDays');
+    }
+    if (expiration.sweepIntervalMinutes === undefined) {
+      errors.push('expiration is enabled but has no sweepIntervalMinutes');
+    }
+  }
+  if (
+    expiration.sweepIntervalMinutes !== undefined &&
+    !(Number.isSafeInteger(expiration.sweepIntervalMinutes) && expiration.sweepIntervalMinutes > 0)
+  ) {
+    errors.push(`expiration.sweepIntervalMinutes must be a positive integer: ${expiration.sweepIntervalMinutes}`);
+  }
+
+  const currencies = new Set<string>();
+  for (const rate of config.earnRates) {
+    if (!CURRENCY_PATTERN.test(rate.currency)) {
+      errors.push(`Invalid earn rate currency: ${rate.currency}`);
+    } else if (currencies.has(rate.currency)) {
+      errors.push(`Duplicate earn rate for ${rate.currency}`);
+    }
+    currencies.add(rate.currency);
+
+    if (!isCount(rate.pointsPerUnit)) {
+      errors.push(`Earn rate for ${rate.currency} must be a non-negative integer: ${rate.pointsPerUnit}`);
+    }
+    if (!(Number.isSafeInteger(rate.minorUnitsPerUnit) && rate.minorUnitsPerUnit > 0)) {
+      errors.push(`minorUnitsPerUnit for ${rate.currency} must be a positive integer: ${rate.minorUnitsPerUnit}`);
+    }
+  }
+
+  return errors;
+}
+
+/**
+ * Check a program config
+ *
+ * @throws Error listing every problem found
+ */
+export function assertValidProgramConfig(config: ProgramConfig): void {
+  const errors = validateProgramConfig(config);
+  if (errors.length > 0) {
+    throw new Error(`Invalid program config: ${errors.join('; ')}`);
+  }
+}
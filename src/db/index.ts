@@ -6,3 +6,4 @@
 
 export * from './connection';
 export * from './models';
+export * from './migrations';
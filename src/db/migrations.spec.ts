@@ -0,0 +1,192 @@
+/**
+ * Database Migrations Tests
+ */
+
+import { runMigrations, MIGRATIONS, Migration } from './migrations';
+import { MigrationModel } from './models/migration.model';
+import { DailyEarnCounterModel } from './models/daily-earn-counter.model';
+import { EarnReferenceClaimModel } from './models/earn-reference-claim.model';
+import { LedgerEntryModel } from './models/ledger-entry.model';
+import { LedgerTierStubModel } from './models/ledger-tier-stub.model';
+import { OutboxRecordModel } from './models/outbox-record.model';
+import { ReferenceEarnCounterModel } from './models/reference-earn-counter.model';
+import { ReferenceNetCounterModel } from './models/reference-net-counter.model';
+import { MetricsLogger } from '../metrics/logger';
+
+jest.mock('./models/migration.model');
+jest.mock('./models/daily-earn-counter.model');
+jest.mock('./models/earn-reference-claim.model');
+jest.mock('./models/ledger-entry.model');
+jest.mock('./models/ledger-tier-stub.model');
+jest.mock('./models/outbox-record.model');
+jest.mock('./models/reference-earn-counter.model');
+jest.mock('./models/reference-net-counter.model');
+
+describe('runMigrations', () => {
+  let recorded: string[];
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'logAlert').mockImplementation(() => undefined);
+    recorded = [];
+
+    (MigrationModel.find as jest.Mock).mockImplementation(() => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => recorded.map(name => ({ name }))),
+    }));
+    (MigrationModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      recorded.push(doc.name);
+      return doc;
+    });
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should apply pending migrations in order and record each once', async () => {
+    const calls: string[] = [];
+    const migrations: Migration[] = [
+      { name: 'first', up: async () => { calls.push('first'); } },
+      { name: 'second', up: async () => { calls.push('second'); } },
+    ];
+
+    await expect(runMigrations(migrations)).resolves.toEqual(['first', 'second']);
+    await expect(runMigrations(migrations)).resolves.toEqual([]);
+
+    expect(calls).toEqual(['first', 'second']);
+    expect(recorded).toEqual(['first', 'second']);
+  });
+
+  it('should leave a failed migration unrecorded so the next run retries it', async () => {
+    const migrations: Migration[] = [{ name: 'flaky', up: jest.fn().mockRejectedValueOnce(new Error('primary stepped down')) }];
+
+    await expect(runMigrations(migrations)).rejects.toThrow('primary stepped down');
+    expect(recorded).toEqual([]);
+
+    await expect(runMigrations(migrations)).resolves.toEqual(['flaky']);
+  });
+
+  const mockCollections = () => {
+    const collection = (name: string) => ({
+      createIndex: jest.fn().mockResolvedValue(`${name}_scoped`),
+      // The tier stub index was already dropped by an interrupted run
+      dropIndex: jest.fn().mockImplementation(async () => {
+        if (name === 'stubs') {
+          throw Object.assign(new Error('index not found'), { code: 27 });
+        }
+      }),
+    });
+    Object.defineProperty(LedgerEntryModel, 'collection', { value: collection('entries'), configurable: true });
+    Object.defineProperty(LedgerTierStubModel, 'collection', { value: collection('stubs'), configurable: true });
+    Object.defineProperty(OutboxRecordModel, 'collection', { value: collection('outbox'), configurable: true });
+    Object.defineProperty(ReferenceNetCounterModel, 'collection', { value: collection('counters'), configurable: true });
+    Object.defineProperty(EarnReferenceClaimModel, 'collection', { value: collection('claims'), configurable: true });
+    Object.defineProperty(DailyEarnCounterModel, 'collection', { value: collection('daily'), configurable: true });
+    Object.defineProperty(ReferenceEarnCounterModel, 'collection', { value: collection('earns'), configurable: true });
+  };
+
+  it('should replace the global idempotency indexes with scoped ones', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    for (const model of [LedgerEntryModel, LedgerTierStubModel]) {
+      expect(model.collection.createIndex).toHaveBeenCalledWith({ idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
+      expect(model.collection.dropIndex).toHaveBeenCalledWith('idempotencyKey_1');
+    }
+    expect(recorded).toContain('scope-idempotency-indexes');
+  });
+
+  it('should key ledger entries and outbox records by tenant', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    for (const model of [LedgerEntryModel, OutboxRecordModel]) {
+      expect(model.collection.createIndex).toHaveBeenCalledWith(
+        { tenantId: 1, idempotencyScope: 1, idempotencyKey: 1 },
+        { unique: true }
+      );
+      expect(model.collection.dropIndex).toHaveBeenCalledWith('idempotencyScope_1_idempotencyKey_1');
+    }
+    expect(recorded).toContain('tenant-idempotency-indexes');
+  });
+
+  it('should build the reference and committer indexes', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    expect(LedgerEntryModel.collection.createIndex).toHaveBeenCalledWith({ correlationId: 1 }, { name: 'correlationId_1' });
+    expect(LedgerEntryModel.collection.createIndex).toHaveBeenCalledWith(
+      { 'metadata.committedBy': 1, timestamp: 1 },
+      { name: 'committedBy_timestamp', partialFilterExpression: { 'metadata.committedBy': { $exists: true } } }
+    );
+    expect(recorded).toContain('secondary-ledger-indexes');
+  });
+
+  it('should reseed reference net counters under a tenant-scoped index', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    expect(ReferenceNetCounterModel.deleteMany).toHaveBeenCalledWith({});
+    expect(ReferenceNetCounterModel.collection.dropIndex).toHaveBeenCalledWith('reference_1');
+    expect(ReferenceNetCounterModel.collection.createIndex).toHaveBeenCalledWith(
+      { tenantId: 1, reference: 1 },
+      { unique: true }
+    );
+    expect(recorded).toContain('tenant-reference-net-counters');
+  });
+
+  it('should reseed earn reference claims under a tenant-scoped index', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    expect(EarnReferenceClaimModel.deleteMany).toHaveBeenCalledWith({});
+    expect(EarnReferenceClaimModel.collection.dropIndex).toHaveBeenCalledWith('accountId_1_reference_1');
+    expect(EarnReferenceClaimModel.collection.createIndex).toHaveBeenCalledWith(
+      { tenantId: 1, accountId: 1, reference: 1 },
+      { unique: true }
+    );
+    expect(recorded).toContain('tenant-earn-reference-claims');
+  });
+
+  it('should reseed daily earn counters under a tenant-scoped index', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    expect(DailyEarnCounterModel.deleteMany).toHaveBeenCalledWith({});
+    expect(DailyEarnCounterModel.collection.dropIndex).toHaveBeenCalledWith('userId_1_day_1');
+    expect(DailyEarnCounterModel.collection.createIndex).toHaveBeenCalledWith(
+      { tenantId: 1, userId: 1, day: 1 },
+      { unique: true }
+    );
+    expect(recorded).toContain('tenant-daily-earn-counters');
+  });
+
+  it('should reseed reference earn counters under a tenant-scoped index', async () => {
+    mockCollections();
+
+    await runMigrations(MIGRATIONS);
+
+    expect(ReferenceEarnCounterModel.deleteMany).toHaveBeenCalledWith({});
+    expect(ReferenceEarnCounterModel.collection.dropIndex).toHaveBeenCalledWith('reference_1');
+    expect(ReferenceEarnCounterModel.collection.createIndex).toHaveBeenCalledWith(
+      { tenantId: 1, reference: 1 },
+      { unique: true }
+    );
+    expect(recorded).toEqual([
+      'scope-idempotency-indexes',
+      'tenant-idempotency-indexes',
+      'secondary-ledger-indexes',
+      'tenant-reference-net-counters',
+      'tenant-earn-reference-claims',
+      'tenant-daily-earn-counters',
+      'tenant-reference-earn-counters',
+    ]);
+  });
+});
@@ -0,0 +1,160 @@
+/**
+ * Database Migrations
+ *
+ * Index changes Mongoose's autoIndex cannot make on its own: it builds
+ * indexes a schema declares but never drops one the schema no longer
+ * declares. Each migration runs once per deployment and is recorded in
+ * the migrations collection when it completes; run runMigrations from a
+ * deploy step before the new release takes traffic. Every migration is
+ * safe to re-run, so one interrupted part-way is simply run again.
+ */
+
+import { DailyEarnCounterModel } from './models/daily-earn-counter.model';
+import { EarnReferenceClaimModel } from './models/earn-reference-claim.model';
+import { LedgerEntryModel, SECONDARY_LEDGER_INDEXES } from './models/ledger-entry.model';
+import { LedgerTierStubModel } from './models/ledger-tier-stub.model';
+import { MigrationModel } from './models/migration.model';
+import { OutboxRecordModel } from './models/outbox-record.model';
+import { ReferenceEarnCounterModel } from './models/reference-earn-counter.model';
+import { ReferenceNetCounterModel } from './models/reference-net-counter.model';
+import { MetricsLogger } from '../metrics/logger';
+import { AlertSeverity } from '../metrics/types';
+
+/**
+ * One named, re-runnable database change
+ */
+export interface Migration {
+  name: string;
+  up(): Promise<void>;
+}
+
+/**
+ * MongoDB error code for dropping an index that does not exist
+ */
+const INDEX_NOT_FOUND = 27;
+
+/**
+ * Drop an index by name, ignoring one already dropped
+ */
+async function dropIndexIfExists(model: { collection: { dropIndex(name: string): Promise<unknown> } }, name: string): Promise<void> {
+  try {
+    await model.collection.dropIndex(name);
+  } catch (error: any) {
+    if (error?.code !== INDEX_NOT_FOUND) {
+      throw error;
+    }
+  }
+}
+
+/**
+ * Migrations in the order they apply
+ */
+export const MIGRATIONS: Migration[] = [
+  {
+    // Idempotency keys are unique per scope; the old global index would still reject a key reused in another scope
+    name: 'scope-idempotency-indexes',
+    async up() {
+      await LedgerEntryModel.collection.createIndex({ idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
+      await dropIndexIfExists(LedgerEntryModel, 'idempotencyKey_1');
+      await LedgerTierStubModel.collection.createIndex({ idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
+      await dropIndexIfExists(LedgerTierStubModel, 'idempotencyKey_1');
+    },
+  },
+  {
+    // Each tenant has its own idempotency keys, so two tenants can reuse one key
+    name: 'tenant-idempotency-indexes',
+    async up() {
+      for (const model of [LedgerEntryModel, OutboxRecordModel]) {
+        await model.collection.createIndex({ tenantId: 1, idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
+        await dropIndexIfExists(model, 'idempotencyScope_1_idempotencyKey_1');
+      }
+    },
+  },
+  {
+    // The reference and committer indexes were built by LedgerService, and never for a lazy index nobody queried
+    name: 'secondary-ledger-indexes',
+    async up() {
+      for (const index of [SECONDARY_LEDGER_INDEXES.reference, SECONDARY_LEDGER_INDEXES.committer]) {
+        await LedgerEntryModel.collection.createIndex(index.fields, index.options);
+      }
+    },
+  },
+  {
+    // Net counters are per tenant and their counted entries moved to reference_net_applications;
+    // the old counters are dropped and reseeded from the ledger on next use
+    name: 'tenant-reference-net-counters',
+    async up() {
+      await ReferenceNetCounterModel.deleteMany({});
+      await dropIndexIfExists(ReferenceNetCounterModel, 'reference_1');
+      await ReferenceNetCounterModel.collection.createIndex({ tenantId: 1, reference: 1 }, { unique: true });
+    },
+  },
+  {
+    // Earn reference claims are per tenant and stored account ID; the old claims, keyed by the
+    // account ID as given, are dropped and reseeded from the ledger on next use
+    name: 'tenant-earn-reference-claims',
+    async up() {
+      await EarnReferenceClaimModel.deleteMany({});
+      await dropIndexIfExists(EarnReferenceClaimModel, 'accountId_1_reference_1');
+      await EarnReferenceClaimModel.collection.createIndex({ tenantId: 1, accountId: 1, reference: 1 }, { unique: true });
+    },
+  },
+  {
+    // Daily earn counters are per tenant and record scoped idempotency keys; the old counters
+    // are dropped and reseeded from the ledger on next use
+    name: 'tenant-daily-earn-counters',
+    async up() {
+      await DailyEarnCounterModel.deleteMany({});
+      await dropIndexIfExists(DailyEarnCounterModel, 'userId_1_day_1');
+      await DailyEarnCounterModel.collection.createIndex({ tenantId: 1, userId: 1, day: 1 }, { unique: true });
+    },
+  },
+  {
+    // Reference earn counters are per tenant; the old counters, shared by every tenant using a
+    // reference, are dropped and reseeded from the ledger on next use
+    name: 'tenant-reference-earn-counters',
+    async up() {
+      await ReferenceEarnCounterModel.deleteMany({});
+      await dropIndexIfExists(ReferenceEarnCounterModel, 'reference_1');
+      await ReferenceEarnCounterModel.collection.createIndex({ tenantId: 1, reference: 1 }, { unique: true });
+    },
+  },
+];
+
+/**
+ * Apply the migrations not yet recorded, in order
+ *
+ * @returns Names of the migrations this call applied
+ */
+export async function runMigrations(migrations: Migration[] = MIGRATIONS): Promise<string[]> {
+  const done = await MigrationModel.find({ name: { $in: migrations.map(migration => migration.name) } }).lean().exec();
+  const applied = new Set(done.map((record: any) => record.name));
+
+  const ran: string[] = [];
+  for (const migration of migrations) {
+    if (applied.has(migration.name)) {
+      continue;
+    }
+
+    await migration.up();
+    try {
+      await MigrationModel.create({ name: migration.name, appliedAt: new Date() });
+    } catch (error: any) {
+      // A concurrent deploy step recorded it first
+      if (error?.code !== 11000) {
+        throw error;
+      }
+    }
+    ran.push(migration.name);
+
+    MetricsLogger.logAlert({
+      severity: AlertSeverity.INFO,
+      message: `Applied database migration ${migration.name}`,
+      metricType: 'database_migration',
+      timestamp: new Date(),
+      metadata: { migration: migration.name },
+    });
+  }
+
+  return ran;
+}
@@ -0,0 +1,48 @@
+/**
+ * Account Activity Model
+ * 
+ * Most recent ledger activity per user account, maintained on every
+ * append so dormancy queries never scan ledger history. Derived data:
+ * always reproducible from the ledger.
+ * Collection: account_activity
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IAccountActivity extends Document {
+  accountId: string;
+  lastActivityAt: Date;
+}
+
+const AccountActivitySchema = new Schema<IAccountActivity>(
+  {
+    accountId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    lastActivityAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'account_activity',
+  }
+);
+
+// Unique index on accountId
+AccountActivitySchema.index({ accountId: 1 }, { unique: true });
+
+// Index for dormancy range queries
+AccountActivitySchema.index({ lastActivityAt: 1 });
+
+// Index for most-recently-active queries (warm-up)
+AccountActivitySchema.index({ lastActivityAt: -1, accountId: 1 });
+
+export const AccountActivityModel = mongoose.model<IAccountActivity>(
+  'AccountActivity',
+  AccountActivitySchema
+);
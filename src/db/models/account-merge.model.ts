@@ -0,0 +1,106 @@
+/**
+ * Account Merge Model
+ * 
+ * Forward-only record of a duplicate account merged into a surviving account.
+ * Doubles as the alias map used to resolve merged user IDs.
+ * Never modified after creation - un-merge is not supported.
+ * Collection: account_merges
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IAccountMerge extends Document {
+  mergeId: string;
+  fromUserId: string;
+  toUserId: string;
+  transactionId: string;
+  correlationId: string;
+
+  /** Source's available balance moved to the target (negative when it carried a debt) */
+  amountMoved: number;
+  
+  /** Target's available balance before the merge */
+  targetBalanceBefore: number;
+  
+  committedBy: string;
+  createdAt: Date;
+}
+
+const AccountMergeSchema = new Schema<IAccountMerge>(
+  {
+    mergeId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    fromUserId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    toUserId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    transactionId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    correlationId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    amountMoved: {
+      type: Number,
+      required: true,
+    },
+    targetBalanceBefore: {
+      type: Number,
+      required: true,
+    },
+    committedBy: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'account_merges',
+  }
+);
+
+// Unique index on fromUserId - an account can only be merged away once
+AccountMergeSchema.index({ fromUserId: 1 }, { unique: true });
+
+// Index for finding everything merged into an account
+AccountMergeSchema.index({ toUserId: 1 });
+
+/**
+ * Immutability Protection
+ * Merges are forward-only and their records are never modified
+ */
+AccountMergeSchema.pre('updateOne', function() {
+  throw new Error('Account merge records are immutable and cannot be updated.');
+});
+
+AccountMergeSchema.pre('updateMany', function() {
+  throw new Error('Account merge records are immutable and cannot be updated.');
+});
+
+AccountMergeSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Account merge records are immutable and cannot be updated.');
+});
+
+export const AccountMergeModel = mongoose.model<IAccountMerge>('AccountMerge', AccountMergeSchema);
@@ -0,0 +1,119 @@
+/**
+ * Admin Access Log Model
+ *
+ * Append-only record of every support admin invocation: who called which
+ * operation on what target, and whether the RBAC check allowed it.
+ * Operations that change settings record what changed in details.
+ * Written before the operation runs, so no permitted call goes unlogged.
+ * Never modified after creation.
+ * Collection: admin_access_log
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export type AdminAccessDecision = 'allowed' | 'denied';
+
+export interface IAdminAccessLog extends Document {
+  logId: string;
+  operation: string;
+  adminId: string;
+  adminUsername: string;
+  roles: string[];
+  ipAddress?: string;
+  userAgent?: string;
+  target: string;
+  decision: AdminAccessDecision;
+  requestId?: string;
+  details?: Record<string, any>;
+  createdAt: Date;
+}
+
+const AdminAccessLogSchema = new Schema<IAdminAccessLog>(
+  {
+    logId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    operation: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 64,
+    },
+    adminId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    adminUsername: {
+      type: String,
+      trim: true,
+      maxlength: 256,
+    },
+    roles: {
+      type: [String],
+      default: [],
+    },
+    ipAddress: {
+      type: String,
+      trim: true,
+      maxlength: 64,
+    },
+    userAgent: {
+      type: String,
+      trim: true,
+      maxlength: 512,
+    },
+    target: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    decision: {
+      type: String,
+      required: true,
+      enum: ['allowed', 'denied'],
+    },
+    requestId: {
+      type: String,
+      trim: true,
+      maxlength: 128,
+    },
+    details: {
+      type: Schema.Types.Mixed,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'admin_access_log',
+  }
+);
+
+// Index for reviewing an operator's activity
+AdminAccessLogSchema.index({ adminId: 1, createdAt: -1 });
+
+// Index for reviewing access to a user or transaction
+AdminAccessLogSchema.index({ target: 1, createdAt: -1 });
+
+/**
+ * Immutability Protection
+ * Access log records are never modified
+ */
+AdminAccessLogSchema.pre('updateOne', function() {
+  throw new Error('Admin access log records are immutable and cannot be updated.');
+});
+
+AdminAccessLogSchema.pre('updateMany', function() {
+  throw new Error('Admin access log records are immutable and cannot be updated.');
+});
+
+AdminAccessLogSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Admin access log records are immutable and cannot be updated.');
+});
+
+export const AdminAccessLogModel = mongoose.model<IAdminAccessLog>('AdminAccessLog', AdminAccessLogSchema);
@@ -0,0 +1,64 @@
+/**
+ * Daily Earn Counter Model
+ *
+ * One row per tenant, user and earn day totalling the points earned
+ * that day, seeded from that tenant's ledger entries the first time the
+ * day is seen. Increments are conditional on the cap, so concurrent
+ * earns cannot both take the last points. idempotencyKeys lists the
+ * earns counted by idempotency scope and key, letting replays through.
+ * Collection: daily_earn_counters
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IDailyEarnCounter extends Document {
+  tenantId?: string;
+  userId: string;
+
+  /** Start of the user's local earn day */
+  day: Date;
+
+  points: number;
+
+  /** Counted earns as `${idempotencyScope ?? ''}\u0000${idempotencyKey}` */
+  idempotencyKeys: string[];
+}
+
+const DailyEarnCounterSchema = new Schema<IDailyEarnCounter>(
+  {
+    tenantId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 64,
+    },
+    userId: {
+      type: String,
+      required: true,
+      trim: true,
+    },
+    day: {
+      type: Date,
+      required: true,
+    },
+    points: {
+      type: Number,
+      required: true,
+      min: 0,
+    },
+    idempotencyKeys: {
+      type: [String],
+      default: [],
+    },
+  },
+  {
+    collection: 'daily_earn_counters',
+  }
+);
+
+DailyEarnCounterSchema.index({ tenantId: 1, userId: 1, day: 1 }, { unique: true });
+
+export const DailyEarnCounterModel = mongoose.model<IDailyEarnCounter>(
+  'DailyEarnCounter',
+  DailyEarnCounterSchema
+);
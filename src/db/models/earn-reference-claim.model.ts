@@ -0,0 +1,64 @@
+/**
+ * Earn Reference Claim Model
+ *
+ * One row per (tenant, user, upstream reference) recording the most
+ * recent earn that claimed the reference, keyed by the account ID the
+ * ledger stores. The unique index makes claiming atomic, so duplicate
+ * deliveries arriving concurrently cannot both pass the reference-dedup
+ * guard.
+ * Collection: earn_reference_claims
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IEarnReferenceClaim extends Document {
+  tenantId?: string;
+  accountId: string;
+  reference: string;
+  idempotencyKey: string;
+  claimedAt: Date;
+}
+
+const EarnReferenceClaimSchema = new Schema<IEarnReferenceClaim>(
+  {
+    tenantId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 64,
+    },
+    accountId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    reference: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    idempotencyKey: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    claimedAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'earn_reference_claims',
+  }
+);
+
+// Unique index on (tenantId, accountId, reference) - the claim that serialises duplicates
+EarnReferenceClaimSchema.index({ tenantId: 1, accountId: 1, reference: 1 }, { unique: true });
+
+export const EarnReferenceClaimModel = mongoose.model<IEarnReferenceClaim>(
+  'EarnReferenceClaim',
+  EarnReferenceClaimSchema
+);
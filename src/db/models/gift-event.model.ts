@@ -0,0 +1,106 @@
+/**
+ * Gift Event Model
+ *
+ * Append-only lifecycle events of user-to-user gifts. A gift is offered
+ * (sequence 0) and ends with exactly one of accepted, declined or expired
+ * (sequence 1); the unique index on (giftId, sequence) makes that final
+ * transition atomic, so an acceptance racing an expiry has one winner.
+ * Every event carries the gift's terms.
+ * Collection: gift_events
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export type GiftEventKind = 'offered' | 'accepted' | 'declined' | 'expired';
+
+export interface IGiftEvent extends Document {
+  eventId: string;
+  giftId: string;
+  sequence: number;
+  kind: GiftEventKind;
+  fromUserId: string;
+  toUserId: string;
+  points: number;
+
+  /** Hold on the sender's points */
+  reservationId: string;
+
+  /** When the offer lapses if not accepted */
+  expiresAt: Date;
+
+  createdAt: Date;
+}
+
+const GiftEventSchema = new Schema<IGiftEvent>(
+  {
+    eventId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    giftId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    sequence: {
+      type: Number,
+      required: true,
+      min: 0,
+      max: 1,
+    },
+    kind: {
+      type: String,
+      required: true,
+      enum: ['offered', 'accepted', 'declined', 'expired'],
+    },
+    fromUserId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    toUserId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    points: {
+      type: Number,
+      required: true,
+      min: 1,
+    },
+    reservationId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    expiresAt: {
+      type: Date,
+      required: true,
+    },
+    createdAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'gift_events',
+  }
+);
+
+// Unique index on (giftId, sequence) - one final transition per gift
+GiftEventSchema.index({ giftId: 1, sequence: 1 }, { unique: true });
+
+// Index for a sender's open offers (gifting limit)
+GiftEventSchema.index({ fromUserId: 1, kind: 1, expiresAt: 1 });
+
+// Index for the expiry sweeper
+GiftEventSchema.index({ kind: 1, expiresAt: 1 });
+
+export const GiftEventModel = mongoose.model<IGiftEvent>('GiftEvent', GiftEventSchema);
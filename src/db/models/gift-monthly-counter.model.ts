@@ -0,0 +1,56 @@
+/**
+ * Gift Monthly Counter Model
+ *
+ * One row per sender per UTC month totalling the points of the gifts they
+ * offered that month and have not had returned, seeded from gift_events
+ * the first time the month is seen. Increments are conditional on the
+ * monthly limit, so offers on several instances cannot together pass it.
+ * giftIds lists the gifts counted, so a decline or expiry returns each
+ * gift's points once.
+ * Collection: gift_monthly_counters
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IGiftMonthlyCounter extends Document {
+  userId: string;
+
+  /** Start of the UTC month */
+  month: Date;
+
+  points: number;
+  giftIds: string[];
+}
+
+const GiftMonthlyCounterSchema = new Schema<IGiftMonthlyCounter>(
+  {
+    userId: {
+      type: String,
+      required: true,
+      trim: true,
+    },
+    month: {
+      type: Date,
+      required: true,
+    },
+    points: {
+      type: Number,
+      required: true,
+      min: 0,
+    },
+    giftIds: {
+      type: [String],
+      default: [],
+    },
+  },
+  {
+    collection: 'gift_monthly_counters',
+  }
+);
+
+GiftMonthlyCounterSchema.index({ userId: 1, month: 1 }, { unique: true });
+
+export const GiftMonthlyCounterModel = mongoose.model<IGiftMonthlyCounter>(
+  'GiftMonthlyCounter',
+  GiftMonthlyCounterSchema
+);
@@ -15,3 +15,28 @@ export * from './wallet.model';
 export * from './model-wallet.model';
 export * from './ledger-entry.model';
 export * from './escrow-item.model';
+export * from './account-merge.model';
+export * from './system-account.model';
+export * from './ledger-mode.model';
+export * from './earn-reference-claim.model';
+export * from './account-activity.model';
+export * from './ledger-annotation.model';
+export * from './reference-earn-counter.model';
+export * from './reference-alias.model';
+export * from './admin-access-log.model';
+export * from './ledger-concealment.model';
+export * from './ledger-tier-stub.model';
+export * from './ledger-tier-manifest.model';
+export * from './reward-drop.model';
+export * from './ledger-attestation.model';
+export * from './ledger-digest.model';
+export * from './gift-event.model';
+export * from './gift-monthly-counter.model';
+export * from './daily-earn-counter.model';
+export * from './reference-net-counter.model';
+export * from './reference-net-application.model';
+export * from './outbox-record.model';
+export * from './ledger-reconciliation.model';
+export * from './wallet-application.model';
+export * from './migration.model';
+export * from './redemption-velocity-decision.model';
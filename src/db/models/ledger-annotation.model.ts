@@ -0,0 +1,95 @@
+/**
+ * Ledger Annotation Model
+ *
+ * Append-only notes linked to a ledger entry (e.g. dispute opened /
+ * resolved). Annotations never change the entry or any balance. Each
+ * annotation takes the next sequence number in its entry's chain; the
+ * unique index on (parentEntryId, sequence) makes appends atomic, so two
+ * concurrent transitions cannot both extend the chain.
+ * Collection: ledger_annotations
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export type LedgerAnnotationKind = 'dispute_opened' | 'dispute_resolved';
+
+export interface ILedgerAnnotation extends Document {
+  annotationId: string;
+  parentEntryId: string;
+  
+  /** Account of the annotated entry (unset on annotations recorded before it was tracked) */
+  accountId?: string;
+  
+  sequence: number;
+  kind: LedgerAnnotationKind;
+  actorId: string;
+  note: string;
+  compensation?: number;
+  createdAt: Date;
+}
+
+const LedgerAnnotationSchema = new Schema<ILedgerAnnotation>(
+  {
+    annotationId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    parentEntryId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    accountId: {
+      type: String,
+      trim: true,
+      maxlength: 128,
+    },
+    sequence: {
+      type: Number,
+      required: true,
+      min: 0,
+    },
+    kind: {
+      type: String,
+      required: true,
+      enum: ['dispute_opened', 'dispute_resolved'],
+    },
+    actorId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    note: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 1000,
+    },
+    compensation: {
+      type: Number,
+    },
+    createdAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'ledger_annotations',
+  }
+);
+
+// Unique index on (parentEntryId, sequence) - serialises transitions per entry
+LedgerAnnotationSchema.index({ parentEntryId: 1, sequence: 1 }, { unique: true });
+
+// Index for per-account annotation history (activity timeline)
+LedgerAnnotationSchema.index({ accountId: 1, createdAt: -1, annotationId: -1 });
+
+export const LedgerAnnotationModel = mongoose.model<ILedgerAnnotation>(
+  'LedgerAnnotation',
+  LedgerAnnotationSchema
+);
@@ -0,0 +1,87 @@
+/**
+ * Ledger Attestation Model
+ *
+ * Append-only chain checkpoints: the rolling chain hash and per-type
+ * stats of the ledger prefix ending at a sequence number. Restores are
+ * verified against them. Attestations are never modified or removed.
+ * Collection: ledger_attestations
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerAttestation extends Document {
+  /** Number of entries in the attested prefix */
+  sequence: number;
+  
+  /** Last entry of the prefix */
+  position: { timestamp: Date; entryId: string };
+  
+  chainHash: string;
+  
+  /** Entry count per transaction type */
+  counts: Record<string, number>;
+  
+  /** Amount sum per transaction type */
+  sums: Record<string, number>;
+  
+  takenAt: Date;
+}
+
+const LedgerAttestationSchema = new Schema<ILedgerAttestation>(
+  {
+    sequence: {
+      type: Number,
+      required: true,
+      unique: true,
+      min: 1,
+    },
+    position: {
+      timestamp: { type: Date, required: true },
+      entryId: { type: String, required: true, maxlength: 128 },
+    },
+    chainHash: {
+      type: String,
+      required: true,
+      maxlength: 128,
+    },
+    counts: {
+      type: Schema.Types.Mixed,
+      required: true,
+    },
+    sums: {
+      type: Schema.Types.Mixed,
+      required: true,
+    },
+    takenAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'ledger_attestations',
+  }
+);
+
+// Unique index on sequence
+LedgerAttestationSchema.index({ sequence: 1 }, { unique: true });
+
+/**
+ * Immutability Protection
+ * Attestations are never modified
+ */
+LedgerAttestationSchema.pre('updateOne', function() {
+  throw new Error('Ledger attestations are immutable and cannot be updated.');
+});
+
+LedgerAttestationSchema.pre('updateMany', function() {
+  throw new Error('Ledger attestations are immutable and cannot be updated.');
+});
+
+LedgerAttestationSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Ledger attestations are immutable and cannot be updated.');
+});
+
+export const LedgerAttestationModel = mongoose.model<ILedgerAttestation>(
+  'LedgerAttestation',
+  LedgerAttestationSchema
+);
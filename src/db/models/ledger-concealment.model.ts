@@ -0,0 +1,79 @@
+/**
+ * Ledger Concealment Model
+ *
+ * Append-only marker hiding a transaction's entries from default ledger
+ * reads, for legal holds such as a wrongly attributed entry. The entries
+ * themselves are untouched and remain visible to audit reads. A
+ * transaction can be concealed once; markers are never modified or
+ * removed.
+ * Collection: ledger_concealments
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerConcealment extends Document {
+  concealmentId: string;
+  transactionId: string;
+  committedBy: string;
+  reason: string;
+  createdAt: Date;
+}
+
+const LedgerConcealmentSchema = new Schema<ILedgerConcealment>(
+  {
+    concealmentId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    transactionId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    committedBy: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    reason: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 1000,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'ledger_concealments',
+  }
+);
+
+// Unique index on transactionId - a transaction is concealed at most once
+LedgerConcealmentSchema.index({ transactionId: 1 }, { unique: true });
+
+/**
+ * Immutability Protection
+ * Concealment markers are never modified
+ */
+LedgerConcealmentSchema.pre('updateOne', function() {
+  throw new Error('Ledger concealment records are immutable and cannot be updated.');
+});
+
+LedgerConcealmentSchema.pre('updateMany', function() {
+  throw new Error('Ledger concealment records are immutable and cannot be updated.');
+});
+
+LedgerConcealmentSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Ledger concealment records are immutable and cannot be updated.');
+});
+
+export const LedgerConcealmentModel = mongoose.model<ILedgerConcealment>(
+  'LedgerConcealment',
+  LedgerConcealmentSchema
+);
@@ -0,0 +1,61 @@
+/**
+ * Ledger Digest Model
+ *
+ * The running content digest of the whole ledger: the entry count and
+ * the digest lanes, each the sum of one 16-bit slice of every entry
+ * checksum. Maintained with $inc on every insert. Derived data: always
+ * reproducible from the ledger.
+ * Collection: ledger_digest
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerDigest extends Document {
+  /** Digest name; one document per ledger ('ledger') */
+  name: string;
+  
+  /** Entries folded in */
+  count: number;
+  
+  /** Lane sums keyed l0 (most significant slice) to l15 */
+  lanes: Record<string, number>;
+  
+  /** When the digest was last recomputed from scratch */
+  rebuiltAt?: Date;
+}
+
+const LedgerDigestSchema = new Schema<ILedgerDigest>(
+  {
+    name: {
+      type: String,
+      required: true,
+      unique: true,
+      maxlength: 64,
+    },
+    count: {
+      type: Number,
+      required: true,
+      default: 0,
+    },
+    lanes: {
+      type: Schema.Types.Mixed,
+      required: true,
+      default: {},
+    },
+    rebuiltAt: {
+      type: Date,
+    },
+  },
+  {
+    collection: 'ledger_digest',
+    minimize: false,
+  }
+);
+
+// Unique index on name
+LedgerDigestSchema.index({ name: 1 }, { unique: true });
+
+export const LedgerDigestModel = mongoose.model<ILedgerDigest>(
+  'LedgerDigest',
+  LedgerDigestSchema
+);
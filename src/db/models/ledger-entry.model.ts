@@ -12,7 +12,7 @@ export interface ILedgerEntry extends Document {
   entryId: string;
   transactionId: string;
   accountId: string;
-  accountType: 'user' | 'model';
+  accountType: 'user' | 'model' | 'system';
   amount: number;
   type: 'credit' | 'debit';
   balanceState: 'available' | 'escrow' | 'earned';
@@ -29,6 +29,12 @@ export interface ILedgerEntry extends Document {
   queueItemId?: string;
   featureType?: string;
   correlationId?: string;
+  groupId?: string;
+  signature?: string;
+  tenantId?: string;
+  idempotencyScope?: string;
+  streamVersion?: number;
+  indexedTags?: { key: string; value: string }[];
 }
 
 const LedgerEntrySchema = new Schema<ILedgerEntry>(
@@ -58,7 +64,7 @@ const LedgerEntrySchema = new Schema<ILedgerEntry>(
     accountType: {
       type: String,
       required: true,
-      enum: ['user', 'model'],
+      enum: ['user', 'model', 'system'],
     },
     amount: {
       type: Number,
@@ -150,7 +156,45 @@ const LedgerEntrySchema = new Schema<ILedgerEntry>(
       required: false,
       trim: true,
       maxlength: 128,
-      index: true,
+    },
+    groupId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 128,
+    },
+    signature: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 512,
+    },
+    tenantId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 64,
+    },
+    idempotencyScope: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 128,
+    },
+    streamVersion: {
+      type: Number,
+      required: false,
+      min: 1,
+    },
+    indexedTags: {
+      type: [
+        {
+          _id: false,
+          key: { type: String, required: true, maxlength: 64 },
+          value: { type: String, required: true, maxlength: 256 },
+        },
+      ],
+      default: undefined,
     },
   },
   {
@@ -162,11 +206,19 @@ const LedgerEntrySchema = new Schema<ILedgerEntry>(
 // Unique index on entryId
 LedgerEntrySchema.index({ entryId: 1 }, { unique: true });
 
-// Unique index on idempotencyKey to prevent duplicates
-LedgerEntrySchema.index({ idempotencyKey: 1 }, { unique: true });
+// Unique index on (tenantId, idempotencyScope, idempotencyKey) to prevent duplicates;
+// each tenant has its own keys, and entries without a scope share the tenant's namespace
+LedgerEntrySchema.index({ tenantId: 1, idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
 
-// Compound indexes for common queries
-LedgerEntrySchema.index({ accountId: 1, timestamp: -1 });
+// Unique per-user stream versions, so concurrent appends cannot share one
+LedgerEntrySchema.index(
+  { tenantId: 1, accountId: 1, streamVersion: 1 },
+  { unique: true, partialFilterExpression: { streamVersion: { $exists: true } } }
+);
+
+// Compound indexes for common queries; entryId matches the query tie-break
+// so time-ordered pages are read from the index without an in-memory sort
+LedgerEntrySchema.index({ accountId: 1, timestamp: -1, entryId: -1 });
 LedgerEntrySchema.index({ accountId: 1, type: 1, timestamp: -1 });
 LedgerEntrySchema.index({ accountId: 1, balanceState: 1, timestamp: -1 });
 LedgerEntrySchema.index({ transactionId: 1, timestamp: -1 });
@@ -177,11 +229,51 @@ LedgerEntrySchema.index({ escrowId: 1 }, { sparse: true });
 // Index for queue tracking
 LedgerEntrySchema.index({ queueItemId: 1 }, { sparse: true });
 
-// Index for correlation tracking
-LedgerEntrySchema.index({ correlationId: 1 }, { sparse: true });
+// Index for multi-leg group lookups
+LedgerEntrySchema.index({ groupId: 1 }, { sparse: true });
+
+/**
+ * Indexes for lookups by reference (correlationId) and by committer
+ * (metadata.committedBy). Declared below and also built by the
+ * secondary-ledger-indexes migration for deployments with autoIndex off;
+ * names are fixed so that either build is a no-op once the index exists.
+ */
+export const SECONDARY_LEDGER_INDEXES = {
+  reference: {
+    fields: { correlationId: 1 },
+    options: { name: 'correlationId_1' },
+  },
+  committer: {
+    fields: { 'metadata.committedBy': 1, timestamp: 1 },
+    options: {
+      name: 'committedBy_timestamp',
+      partialFilterExpression: { 'metadata.committedBy': { $exists: true } },
+    },
+  },
+} as const;
+
+// Indexes for reference and committer lookups
+LedgerEntrySchema.index(SECONDARY_LEDGER_INDEXES.reference.fields, SECONDARY_LEDGER_INDEXES.reference.options);
+LedgerEntrySchema.index(SECONDARY_LEDGER_INDEXES.committer.fields, SECONDARY_LEDGER_INDEXES.committer.options);
+
+// Tenant-scoped indexes so one tenant's volume doesn't slow another's queries
+LedgerEntrySchema.index(
+  { tenantId: 1, accountId: 1, timestamp: -1 },
+  { partialFilterExpression: { tenantId: { $exists: true } } }
+);
+LedgerEntrySchema.index(
+  { tenantId: 1, transactionId: 1, timestamp: -1 },
+  { partialFilterExpression: { tenantId: { $exists: true } } }
+);
+
+// Multikey index for configured tag lookups (e.g. all entries for a campaign)
+LedgerEntrySchema.index(
+  { 'indexedTags.key': 1, 'indexedTags.value': 1, timestamp: 1 },
+  { partialFilterExpression: { indexedTags: { $exists: true } } }
+);
 
-// Index for time-based queries and retention
-LedgerEntrySchema.index({ timestamp: 1 });
+// Index for time-based queries and retention (ties ordered by entryId)
+LedgerEntrySchema.index({ timestamp: 1, entryId: 1 });
 
 /**
  * Immutability Protection
@@ -0,0 +1,42 @@
+/**
+ * Ledger Mode Model
+ * 
+ * Records whether the ledger was initialised in single-entry or
+ * double-entry mode. Written once on first posting; later postings in
+ * the other mode are rejected so the two are never mixed.
+ * Collection: ledger_mode
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerMode extends Document {
+  key: string;
+  mode: 'single' | 'double';
+  createdAt: Date;
+}
+
+const LedgerModeSchema = new Schema<ILedgerMode>(
+  {
+    key: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 64,
+    },
+    mode: {
+      type: String,
+      required: true,
+      enum: ['single', 'double'],
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'ledger_mode',
+  }
+);
+
+// Unique index on key
+LedgerModeSchema.index({ key: 1 }, { unique: true });
+
+export const LedgerModeModel = mongoose.model<ILedgerMode>('LedgerMode', LedgerModeSchema);
@@ -0,0 +1,70 @@
+/**
+ * Ledger Reconciliation Marker Model
+ *
+ * Append-only marker recording that a transaction was reconciled against
+ * a settlement file. The transaction's entries are untouched. A
+ * transaction is marked once; markers are never modified or removed.
+ * Collection: ledger_reconciliations
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerReconciliationMarker extends Document {
+  markerId: string;
+  transactionId: string;
+  committedBy: string;
+  createdAt: Date;
+}
+
+const LedgerReconciliationMarkerSchema = new Schema<ILedgerReconciliationMarker>(
+  {
+    markerId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    transactionId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    committedBy: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'ledger_reconciliations',
+  }
+);
+
+// Unique index on transactionId - a transaction is reconciled at most once
+LedgerReconciliationMarkerSchema.index({ transactionId: 1 }, { unique: true });
+
+/**
+ * Immutability Protection
+ * Reconciliation markers are never modified
+ */
+LedgerReconciliationMarkerSchema.pre('updateOne', function() {
+  throw new Error('Ledger reconciliation markers are immutable and cannot be updated.');
+});
+
+LedgerReconciliationMarkerSchema.pre('updateMany', function() {
+  throw new Error('Ledger reconciliation markers are immutable and cannot be updated.');
+});
+
+LedgerReconciliationMarkerSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Ledger reconciliation markers are immutable and cannot be updated.');
+});
+
+export const LedgerReconciliationMarkerModel = mongoose.model<ILedgerReconciliationMarker>(
+  'LedgerReconciliationMarker',
+  LedgerReconciliationMarkerSchema
+);
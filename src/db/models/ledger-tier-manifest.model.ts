@@ -0,0 +1,85 @@
+/**
+ * Ledger Tier Manifest Model
+ *
+ * Append-only record of one batch of ledger entries moved to the archive
+ * tier: which entries, their combined checksum, the cutoff the run used
+ * and when the archive copy was verified. Manifests are never modified
+ * or removed.
+ * Collection: ledger_tier_manifests
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerTierManifest extends Document {
+  manifestId: string;
+  runId: string;
+  olderThan: Date;
+  entryIds: string[];
+  checksum: string;
+  verifiedAt: Date;
+  createdAt: Date;
+}
+
+const LedgerTierManifestSchema = new Schema<ILedgerTierManifest>(
+  {
+    manifestId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    runId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+      index: true,
+    },
+    olderThan: {
+      type: Date,
+      required: true,
+    },
+    entryIds: {
+      type: [String],
+      required: true,
+    },
+    checksum: {
+      type: String,
+      required: true,
+      maxlength: 128,
+    },
+    verifiedAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'ledger_tier_manifests',
+  }
+);
+
+// Manifests covering an entry, so a re-run passes over archived entries
+LedgerTierManifestSchema.index({ entryIds: 1 });
+
+/**
+ * Immutability Protection
+ * Tier manifests are never modified
+ */
+LedgerTierManifestSchema.pre('updateOne', function() {
+  throw new Error('Ledger tier manifests are immutable and cannot be updated.');
+});
+
+LedgerTierManifestSchema.pre('updateMany', function() {
+  throw new Error('Ledger tier manifests are immutable and cannot be updated.');
+});
+
+LedgerTierManifestSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Ledger tier manifests are immutable and cannot be updated.');
+});
+
+export const LedgerTierManifestModel = mongoose.model<ILedgerTierManifest>(
+  'LedgerTierManifest',
+  LedgerTierManifestSchema
+);
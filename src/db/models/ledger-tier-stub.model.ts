@@ -0,0 +1,128 @@
+/**
+ * Ledger Tier Stub Model
+ *
+ * Index record left in the primary store for a ledger entry that was
+ * moved to the archive tier. Stubs carry the fields reads select on, so
+ * lookups by entry, account, transaction and scoped idempotency key still find
+ * archived entries, plus the entry's checksum and the manifest that moved
+ * it. Stubs are
+ * never modified or removed.
+ * Collection: ledger_tier_stubs
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ILedgerTierStub extends Document {
+  entryId: string;
+  transactionId: string;
+  accountId: string;
+  accountType: 'user' | 'model' | 'system';
+  balanceState: 'available' | 'escrow' | 'earned';
+  balanceAfter: number;
+  idempotencyKey: string;
+  idempotencyScope?: string;
+  timestamp: Date;
+  checksum: string;
+  manifestId: string;
+  createdAt: Date;
+}
+
+const LedgerTierStubSchema = new Schema<ILedgerTierStub>(
+  {
+    entryId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    transactionId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+      index: true,
+    },
+    accountId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    accountType: {
+      type: String,
+      required: true,
+      enum: ['user', 'model', 'system'],
+    },
+    balanceState: {
+      type: String,
+      required: true,
+      enum: ['available', 'escrow', 'earned'],
+    },
+    balanceAfter: {
+      type: Number,
+      required: true,
+    },
+    idempotencyKey: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    idempotencyScope: {
+      type: String,
+      trim: true,
+      maxlength: 256,
+    },
+    timestamp: {
+      type: Date,
+      required: true,
+    },
+    checksum: {
+      type: String,
+      required: true,
+      maxlength: 128,
+    },
+    manifestId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+      index: true,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'ledger_tier_stubs',
+  }
+);
+
+// Unique index on entryId - an entry is tiered at most once
+LedgerTierStubSchema.index({ entryId: 1 }, { unique: true });
+
+// Unique index on (idempotencyScope, idempotencyKey) - keys of archived entries stay claimed in their scope
+LedgerTierStubSchema.index({ idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
+
+// Merged account reads
+LedgerTierStubSchema.index({ accountId: 1, accountType: 1, timestamp: -1, entryId: -1 });
+
+// Full scans in chain order
+LedgerTierStubSchema.index({ timestamp: 1, entryId: 1 });
+
+/**
+ * Immutability Protection
+ * Tier stubs are never modified
+ */
+LedgerTierStubSchema.pre('updateOne', function() {
+  throw new Error('Ledger tier stubs are immutable and cannot be updated.');
+});
+
+LedgerTierStubSchema.pre('updateMany', function() {
+  throw new Error('Ledger tier stubs are immutable and cannot be updated.');
+});
+
+LedgerTierStubSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Ledger tier stubs are immutable and cannot be updated.');
+});
+
+export const LedgerTierStubModel = mongoose.model<ILedgerTierStub>('LedgerTierStub', LedgerTierStubSchema);
@@ -0,0 +1,38 @@
+/**
+ * Migration Model
+ *
+ * One row per database migration that has run to completion, so each
+ * migration is applied once per deployment. Rows are written by
+ * runMigrations and never modified.
+ * Collection: migrations
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IMigration extends Document {
+  name: string;
+  appliedAt: Date;
+}
+
+const MigrationSchema = new Schema<IMigration>(
+  {
+    name: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    appliedAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'migrations',
+  }
+);
+
+// Unique index on name - a migration is recorded once
+MigrationSchema.index({ name: 1 }, { unique: true });
+
+export const MigrationModel = mongoose.model<IMigration>('Migration', MigrationSchema);
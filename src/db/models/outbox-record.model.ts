@@ -0,0 +1,65 @@
+/**
+ * Outbox Record Model
+ *
+ * One row per ledger append awaiting publication, staged before the
+ * entry is inserted so a crash between the insert and publishing loses
+ * nothing. Keyed like the ledger's idempotency index; a relay resolves a
+ * record to its committed entry by that key and sets publishedAt once
+ * the event is out. Published rows expire after a week.
+ * Collection: ledger_outbox
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IOutboxRecord extends Document {
+  outboxId: string;
+  idempotencyKey: string;
+  idempotencyScope?: string;
+  tenantId?: string;
+  stagedAt: Date;
+  publishedAt?: Date;
+}
+
+const OutboxRecordSchema = new Schema<IOutboxRecord>(
+  {
+    outboxId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 256,
+    },
+    idempotencyKey: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    idempotencyScope: {
+      type: String,
+      trim: true,
+      maxlength: 256,
+    },
+    tenantId: {
+      type: String,
+      trim: true,
+      maxlength: 64,
+    },
+    stagedAt: {
+      type: Date,
+      required: true,
+    },
+    publishedAt: {
+      type: Date,
+    },
+  },
+  {
+    collection: 'ledger_outbox',
+  }
+);
+
+OutboxRecordSchema.index({ tenantId: 1, idempotencyScope: 1, idempotencyKey: 1 }, { unique: true });
+OutboxRecordSchema.index({ publishedAt: 1, tenantId: 1, stagedAt: 1 });
+OutboxRecordSchema.index({ publishedAt: 1 }, { expireAfterSeconds: 7 * 24 * 60 * 60 });
+
+export const OutboxRecordModel = mongoose.model<IOutboxRecord>('OutboxRecord', OutboxRecordSchema);
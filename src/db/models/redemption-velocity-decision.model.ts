@@ -0,0 +1,120 @@
+/**
+ * Redemption Velocity Decision Model
+ *
+ * Append-only record of every redemption the redeem guard blocked and
+ * every block an operator overrode: the user, the rule, its limit and
+ * what was observed, and for overrides the authenticated operator.
+ * Never modified after creation.
+ * Collection: redemption_velocity_decisions
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export type RedemptionVelocityDecision = 'blocked' | 'overridden';
+
+export interface IRedemptionVelocityDecision extends Document {
+  decisionId: string;
+  userId: string;
+  decision: RedemptionVelocityDecision;
+  rule: string;
+  limit: number;
+  observed: number;
+  amount: number;
+  deviceId?: string;
+  overrideBy?: string;
+  idempotencyKey?: string;
+  requestId?: string;
+  createdAt: Date;
+}
+
+const RedemptionVelocityDecisionSchema = new Schema<IRedemptionVelocityDecision>(
+  {
+    decisionId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    userId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    decision: {
+      type: String,
+      required: true,
+      enum: ['blocked', 'overridden'],
+    },
+    rule: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 64,
+    },
+    limit: {
+      type: Number,
+      required: true,
+    },
+    observed: {
+      type: Number,
+      required: true,
+    },
+    amount: {
+      type: Number,
+      required: true,
+    },
+    deviceId: {
+      type: String,
+      trim: true,
+      maxlength: 256,
+    },
+    overrideBy: {
+      type: String,
+      trim: true,
+      maxlength: 128,
+    },
+    idempotencyKey: {
+      type: String,
+      trim: true,
+      maxlength: 256,
+    },
+    requestId: {
+      type: String,
+      trim: true,
+      maxlength: 128,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'redemption_velocity_decisions',
+  }
+);
+
+// Index for reviewing a user's blocks and overrides
+RedemptionVelocityDecisionSchema.index({ userId: 1, createdAt: -1 });
+
+// Index for reviewing an operator's overrides
+RedemptionVelocityDecisionSchema.index({ overrideBy: 1, createdAt: -1 }, { sparse: true });
+
+/**
+ * Immutability Protection
+ * Decision records are never modified
+ */
+RedemptionVelocityDecisionSchema.pre('updateOne', function() {
+  throw new Error('Redemption velocity decisions are immutable and cannot be updated.');
+});
+
+RedemptionVelocityDecisionSchema.pre('updateMany', function() {
+  throw new Error('Redemption velocity decisions are immutable and cannot be updated.');
+});
+
+RedemptionVelocityDecisionSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Redemption velocity decisions are immutable and cannot be updated.');
+});
+
+export const RedemptionVelocityDecisionModel = mongoose.model<IRedemptionVelocityDecision>(
+  'RedemptionVelocityDecision',
+  RedemptionVelocityDecisionSchema
+);
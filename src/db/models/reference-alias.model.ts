@@ -0,0 +1,78 @@
+/**
+ * Reference Alias Model
+ *
+ * Forward-only record that one reference (correlation ID) names the same
+ * event as another. Entries stay under the reference they were written
+ * with; reference queries and sums resolve through these records instead.
+ * Never modified after creation.
+ * Collection: reference_aliases
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IReferenceAlias extends Document {
+  aliasId: string;
+  alias: string;
+  canonical: string;
+  committedBy: string;
+  createdAt: Date;
+}
+
+const ReferenceAliasSchema = new Schema<IReferenceAlias>(
+  {
+    aliasId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    alias: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    canonical: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    committedBy: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+  },
+  {
+    timestamps: { createdAt: true, updatedAt: false },
+    collection: 'reference_aliases',
+  }
+);
+
+// Unique index on alias - a reference can only be aliased once
+ReferenceAliasSchema.index({ alias: 1 }, { unique: true });
+
+// Index for expanding a canonical reference to its aliases
+ReferenceAliasSchema.index({ canonical: 1 });
+
+/**
+ * Immutability Protection
+ * Aliases are forward-only and their records are never modified
+ */
+ReferenceAliasSchema.pre('updateOne', function() {
+  throw new Error('Reference alias records are immutable and cannot be updated.');
+});
+
+ReferenceAliasSchema.pre('updateMany', function() {
+  throw new Error('Reference alias records are immutable and cannot be updated.');
+});
+
+ReferenceAliasSchema.pre('findOneAndUpdate', function() {
+  throw new Error('Reference alias records are immutable and cannot be updated.');
+});
+
+export const ReferenceAliasModel = mongoose.model<IReferenceAlias>('ReferenceAlias', ReferenceAliasSchema);
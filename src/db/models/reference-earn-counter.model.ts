@@ -0,0 +1,60 @@
+/**
+ * Reference Earn Counter Model
+ *
+ * One row per tenant and upstream reference (correlation ID) counting
+ * the earns and points credited against it, seeded from that tenant's
+ * ledger entries the first time a reference is seen. Increments are conditional
+ * on the limits, so concurrent earns cannot both pass the last slot.
+ * idempotencyKeys lists the earns counted, letting replays through.
+ * Collection: reference_earn_counters
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IReferenceEarnCounter extends Document {
+  tenantId?: string;
+  reference: string;
+  count: number;
+  points: number;
+  idempotencyKeys: string[];
+}
+
+const ReferenceEarnCounterSchema = new Schema<IReferenceEarnCounter>(
+  {
+    tenantId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 64,
+    },
+    reference: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    count: {
+      type: Number,
+      required: true,
+      min: 0,
+    },
+    points: {
+      type: Number,
+      required: true,
+    },
+    idempotencyKeys: {
+      type: [String],
+      default: [],
+    },
+  },
+  {
+    collection: 'reference_earn_counters',
+  }
+);
+
+ReferenceEarnCounterSchema.index({ tenantId: 1, reference: 1 }, { unique: true });
+
+export const ReferenceEarnCounterModel = mongoose.model<IReferenceEarnCounter>(
+  'ReferenceEarnCounter',
+  ReferenceEarnCounterSchema
+);
@@ -0,0 +1,72 @@
+/**
+ * Reference Net Application Model
+ *
+ * One row per entry counted in a reference's net counter, keyed by the
+ * entry's tenant, reference and scoped idempotency key. The unique index
+ * makes recording an application atomic, so a replayed entry is counted
+ * once however many times it is submitted, without the counter document
+ * growing with every entry.
+ * Collection: reference_net_applications
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IReferenceNetApplication extends Document {
+  tenantId?: string;
+  reference: string;
+  idempotencyScope?: string;
+  idempotencyKey: string;
+  amount: number;
+  appliedAt: Date;
+}
+
+const ReferenceNetApplicationSchema = new Schema<IReferenceNetApplication>(
+  {
+    tenantId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 64,
+    },
+    reference: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    idempotencyScope: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 128,
+    },
+    idempotencyKey: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    amount: {
+      type: Number,
+      required: true,
+    },
+    appliedAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'reference_net_applications',
+  }
+);
+
+// Unique index on (tenant, reference, scoped key) - an entry is applied once
+ReferenceNetApplicationSchema.index(
+  { tenantId: 1, reference: 1, idempotencyScope: 1, idempotencyKey: 1 },
+  { unique: true }
+);
+
+export const ReferenceNetApplicationModel = mongoose.model<IReferenceNetApplication>(
+  'ReferenceNetApplication',
+  ReferenceNetApplicationSchema
+);
@@ -0,0 +1,51 @@
+/**
+ * Reference Net Counter Model
+ *
+ * One row per tenant and balance-constrained reference (correlation ID)
+ * holding the net of the user entries recorded against it, seeded from
+ * the ledger's correlationId index the first time the reference is seen.
+ * Debits are applied by an increment conditional on the net staying
+ * non-negative, so concurrent redemptions cannot both take the last
+ * points. The entries counted are recorded in reference_net_applications.
+ * Collection: reference_net_counters
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IReferenceNetCounter extends Document {
+  tenantId?: string;
+  reference: string;
+  net: number;
+}
+
+const ReferenceNetCounterSchema = new Schema<IReferenceNetCounter>(
+  {
+    tenantId: {
+      type: String,
+      required: false,
+      trim: true,
+      maxlength: 64,
+    },
+    reference: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    net: {
+      type: Number,
+      required: true,
+    },
+  },
+  {
+    collection: 'reference_net_counters',
+  }
+);
+
+// Unique index on (tenant, reference) - one counter per tenant's reference
+ReferenceNetCounterSchema.index({ tenantId: 1, reference: 1 }, { unique: true });
+
+export const ReferenceNetCounterModel = mongoose.model<IReferenceNetCounter>(
+  'ReferenceNetCounter',
+  ReferenceNetCounterSchema
+);
@@ -23,6 +23,7 @@ export interface IReservation extends Document {
   updatedAt: Date;
   expiresAt: Date;
   sourceCorrelationId?: string;
+  itemId?: string;
 }
 
 const ReservationSchema = new Schema<IReservation>(
@@ -61,6 +62,11 @@ const ReservationSchema = new Schema<IReservation>(
       trim: true,
       maxlength: 256,
     },
+    itemId: {
+      type: String,
+      trim: true,
+      maxlength: 128,
+    },
   },
   {
     timestamps: true,
@@ -71,9 +77,16 @@ const ReservationSchema = new Schema<IReservation>(
 // Indexes
 ReservationSchema.index({ reservationId: 1 }, { unique: true });
 ReservationSchema.index({ userId: 1, createdAt: -1 });
+ReservationSchema.index({ userId: 1, updatedAt: -1 });
 ReservationSchema.index({ status: 1, expiresAt: 1 });
+ReservationSchema.index({ itemId: 1, status: 1 }, { sparse: true });
 
 // TTL index - auto-expire based on expiresAt
-ReservationSchema.index({ expiresAt: 1 }, { expireAfterSeconds: 0 });
+// Reward drop reservations are kept: they are the drop's audit record,
+// and the expiry sweeper must see them to return their inventory.
+ReservationSchema.index(
+  { expiresAt: 1 },
+  { expireAfterSeconds: 0, partialFilterExpression: { itemId: { $exists: false } } }
+);
 
 export const ReservationModel = mongoose.model<IReservation>('Reservation', ReservationSchema);
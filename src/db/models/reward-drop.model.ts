@@ -0,0 +1,63 @@
+/**
+ * Reward Drop Model
+ * 
+ * Limited-inventory reward drops. `remaining` is claimed one unit at a
+ * time with a conditional $inc, so concurrent reservations never take
+ * more than the inventory; abandoned and expired reservations give
+ * their unit back.
+ * Collection: reward_drops
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IRewardDrop extends Document {
+  itemId: string;
+  
+  /** Points per unit */
+  cost: number;
+  
+  /** Units released for the drop */
+  inventory: number;
+  
+  /** Units not held by an active or committed reservation */
+  remaining: number;
+  
+  createdAt: Date;
+  updatedAt: Date;
+}
+
+const RewardDropSchema = new Schema<IRewardDrop>(
+  {
+    itemId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    cost: {
+      type: Number,
+      required: true,
+      min: 1,
+    },
+    inventory: {
+      type: Number,
+      required: true,
+      min: 0,
+    },
+    remaining: {
+      type: Number,
+      required: true,
+      min: 0,
+    },
+  },
+  {
+    timestamps: true,
+    collection: 'reward_drops',
+  }
+);
+
+// Unique index on itemId
+RewardDropSchema.index({ itemId: 1 }, { unique: true });
+
+export const RewardDropModel = mongoose.model<IRewardDrop>('RewardDrop', RewardDropSchema);
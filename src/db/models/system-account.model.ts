@@ -0,0 +1,43 @@
+/**
+ * System Account Model
+ * 
+ * Running balances of system counterparty accounts used in double-entry
+ * mode (e.g. points_issuance, points_redemption). Balances are only ever
+ * changed with atomic $inc so concurrent postings stay exact.
+ * Collection: system_accounts
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface ISystemAccount extends Document {
+  accountId: string;
+  balance: number;
+  createdAt: Date;
+  updatedAt: Date;
+}
+
+const SystemAccountSchema = new Schema<ISystemAccount>(
+  {
+    accountId: {
+      type: String,
+      required: true,
+      unique: true,
+      trim: true,
+      maxlength: 128,
+    },
+    balance: {
+      type: Number,
+      required: true,
+      default: 0,
+    },
+  },
+  {
+    timestamps: true,
+    collection: 'system_accounts',
+  }
+);
+
+// Unique index on accountId
+SystemAccountSchema.index({ accountId: 1 }, { unique: true });
+
+export const SystemAccountModel = mongoose.model<ISystemAccount>('SystemAccount', SystemAccountSchema);
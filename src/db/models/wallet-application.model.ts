@@ -0,0 +1,54 @@
+/**
+ * Wallet Application Model
+ *
+ * One row per ledger entry whose balance change has been applied to a
+ * wallet, keyed by the entry's idempotency key. The row commits in the
+ * same transaction as the wallet update, so its unique index is what
+ * makes re-applying a replayed entry a no-op.
+ * Collection: wallet_applications
+ */
+
+import mongoose, { Document, Schema } from 'mongoose';
+
+export interface IWalletApplication extends Document {
+  applicationKey: string;
+  userId: string;
+  delta: number;
+  appliedAt: Date;
+}
+
+const WalletApplicationSchema = new Schema<IWalletApplication>(
+  {
+    applicationKey: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 256,
+    },
+    userId: {
+      type: String,
+      required: true,
+      trim: true,
+      maxlength: 128,
+    },
+    delta: {
+      type: Number,
+      required: true,
+    },
+    appliedAt: {
+      type: Date,
+      required: true,
+    },
+  },
+  {
+    collection: 'wallet_applications',
+  }
+);
+
+// Unique index on applicationKey - a ledger entry moves a wallet at most once
+WalletApplicationSchema.index({ applicationKey: 1 }, { unique: true });
+
+export const WalletApplicationModel = mongoose.model<IWalletApplication>(
+  'WalletApplication',
+  WalletApplicationSchema
+);
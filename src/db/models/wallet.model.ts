@@ -14,6 +14,7 @@ export interface IWallet extends Document {
   escrowBalance: number;
   currency: string;
   version: number;
+  frozen?: boolean;
   createdAt: Date;
   updatedAt: Date;
 }
@@ -52,6 +53,11 @@ const WalletSchema = new Schema<IWallet>(
       required: true,
       default: 0,
     },
+    frozen: {
+      type: Boolean,
+      required: false,
+      default: false,
+    },
   },
   {
     timestamps: true,
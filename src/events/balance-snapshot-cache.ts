@@ -3,6 +3,7 @@
  * 
  * Maintains real-time cached balance snapshots by subscribing to wallet events.
  * Provides fast balance lookups without querying the database or ledger.
+ * The cache is also a replay Projector, so it can be warmed from the ledger.
  */
 
 import {
@@ -16,6 +17,8 @@ import {
 } from './types';
 import { getEventBus } from './event-bus';
 import { MetricsLogger, MetricEventType } from '../metrics';
+import { LedgerEntry, BalanceSnapshot } from '../ledger/types';
+import { Projector } from '../ledger/replay';
 
 /**
  * Cached balance snapshot
@@ -53,7 +56,8 @@ const DEFAULT_CONFIG: BalanceCacheConfig = {
 /**
  * Real-time balance snapshot cache
  */
-export class BalanceSnapshotCache {
+export class BalanceSnapshotCache implements Projector {
+  readonly name = 'balance-snapshot-cache';
   private cache: Map<string, CachedBalance> = new Map();
   private config: BalanceCacheConfig;
   private subscribed: boolean = false;
@@ -142,31 +146,62 @@ export class BalanceSnapshotCache {
    * Handle balance updated event
    */
   private handleBalanceUpdated(event: BalanceUpdatedEvent): void {
-    const key = this.getCacheKey(event.accountId, event.accountType);
+    this.setBalance(event.accountId, event.accountType, event.balanceState, event.balanceAfter, event.timestamp);
+  }
+
+  /**
+   * Set the balance of an entry's state from a replayed ledger entry
+   * System accounts are not cached.
+   */
+  apply(entry: LedgerEntry): void {
+    if (entry.accountType === 'system') {
+      return;
+    }
+    this.setBalance(entry.accountId, entry.accountType, entry.balanceState, entry.balanceAfter, new Date());
+  }
+
+  /**
+   * Discard every cached balance before a rebuild
+   */
+  reset(): void {
+    this.clear();
+  }
+
+  /**
+   * Set one balance state of a cached account
+   */
+  private setBalance(
+    accountId: string,
+    accountType: 'user' | 'model',
+    balanceState: 'available' | 'escrow' | 'earned',
+    balanceAfter: number,
+    at: Date
+  ): void {
+    const key = this.getCacheKey(accountId, accountType);
     const cached = this.cache.get(key);
 
     if (!cached) {
       // Initialize cache entry
       const newEntry: CachedBalance = {
-        accountId: event.accountId,
-        accountType: event.accountType,
-        availableBalance: event.accountType === 'user' && event.balanceState === 'available' ? event.balanceAfter : 0,
-        escrowBalance: event.accountType === 'user' && event.balanceState === 'escrow' ? event.balanceAfter : 0,
-        earnedBalance: event.accountType === 'model' && event.balanceState === 'earned' ? event.balanceAfter : 0,
-        lastUpdated: event.timestamp,
+        accountId,
+        accountType,
+        availableBalance: accountType === 'user' && balanceState === 'available' ? balanceAfter : 0,
+        escrowBalance: accountType === 'user' && balanceState === 'escrow' ? balanceAfter : 0,
+        earnedBalance: accountType === 'model' && balanceState === 'earned' ? balanceAfter : 0,
+        lastUpdated: at,
         version: 1,
       };
       this.cache.set(key, newEntry);
     } else {
       // Update existing entry
-      if (event.balanceState === 'available') {
-        cached.availableBalance = event.balanceAfter;
-      } else if (event.balanceState === 'escrow') {
-        cached.escrowBalance = event.balanceAfter;
-      } else if (event.balanceState === 'earned') {
-        cached.earnedBalance = event.balanceAfter;
+      if (balanceState === 'available') {
+        cached.availableBalance = balanceAfter;
+      } else if (balanceState === 'escrow') {
+        cached.escrowBalance = balanceAfter;
+      } else if (balanceState === 'earned') {
+        cached.earnedBalance = balanceAfter;
       }
-      cached.lastUpdated = event.timestamp;
+      cached.lastUpdated = at;
       cached.version++;
     }
 
@@ -323,6 +358,26 @@ export class BalanceSnapshotCache {
     return cached;
   }
 
+  /**
+   * Seed the cache with a balance snapshot read from the ledger, for warm-up
+   */
+  prime(snapshot: BalanceSnapshot): void {
+    const key = this.getCacheKey(snapshot.accountId, snapshot.accountType);
+    const cached = this.cache.get(key);
+
+    this.cache.set(key, {
+      accountId: snapshot.accountId,
+      accountType: snapshot.accountType,
+      availableBalance: snapshot.availableBalance,
+      escrowBalance: snapshot.escrowBalance,
+      earnedBalance: snapshot.earnedBalance,
+      lastUpdated: new Date(),
+      version: cached ? cached.version + 1 : 1,
+    });
+
+    this.evictIfNeeded();
+  }
+
   /**
    * Invalidate cache entry
    */
@@ -0,0 +1,229 @@
+/**
+ * Ledger Event Store Adapter Tests
+ *
+ * Contract: a consumer rebuilds balances from the adapter's output alone.
+ */
+
+import { LedgerEventStore } from './adapter';
+import { StreamEvent } from './types';
+import { LedgerTail } from '../ledger/ledger-tail';
+import { LedgerEntry, LedgerQueryFilter, LedgerQueryResult } from '../ledger/types';
+import { LedgerInconsistencyError } from '../services/types';
+import { TransactionType } from '../wallets/types';
+
+/**
+ * In-memory ledger stamping per-user stream versions, as LedgerService
+ * does with trackStreamVersions enabled
+ */
+class FakeLedger {
+  readonly entries: LedgerEntry[] = [];
+  private tail: LedgerTail;
+  private last = 0;
+
+  constructor(tail: LedgerTail) {
+    this.tail = tail;
+  }
+
+  append(accountId: string, amount: number, accountType: 'user' | 'model' = 'user'): LedgerEntry {
+    const history = this.entries.filter(e => e.accountId === accountId && e.accountType === accountType);
+    const balanceBefore = history.length > 0 ? history[history.length - 1].balanceAfter : 0;
+    const entry = {
+      entryId: `entry-${String(this.entries.length + 1).padStart(4, '0')}`,
+      transactionId: `tx-${this.entries.length + 1}`,
+      accountId,
+      accountType,
+      amount,
+      type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      reason: 'promotional_award',
+      balanceBefore,
+      balanceAfter: balanceBefore + amount,
+      currency: 'points',
+      timestamp: new Date((this.last = Math.max(Date.now(), this.last + 1))),
+      streamVersion: accountType === 'user' ? history.length + 1 : undefined,
+    } as LedgerEntry;
+    this.entries.push(entry);
+    this.tail.afterAppend(entry);
+    return entry;
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    const matching = this.entries.filter(e =>
+      (!filter.accountId || e.accountId === filter.accountId) &&
+      (!filter.accountType || e.accountType === filter.accountType) &&
+      (filter.fromStreamVersion === undefined ||
+        e.streamVersion === undefined ||
+        e.streamVersion >= filter.fromStreamVersion) &&
+      (!filter.startDate || e.timestamp.getTime() >= filter.startDate.getTime())
+    );
+    const offset = filter.offset || 0;
+    const limit = filter.limit || 100;
+    const entries = matching.slice(offset, offset + limit);
+    return { entries, totalCount: matching.length, offset, limit, hasMore: offset + entries.length < matching.length };
+  }
+}
+
+/**
+ * What a consumer can derive from events alone
+ */
+const balances = (events: StreamEvent[]): Map<string, number> => {
+  const result = new Map<string, number>();
+  for (const event of events) {
+    result.set(event.streamId, (result.get(event.streamId) || 0) + event.data.amount);
+  }
+  return result;
+};
+
+const take = async (iterator: AsyncGenerator<StreamEvent>, n: number): Promise<StreamEvent[]> => {
+  const events: StreamEvent[] = [];
+  while (events.length < n) {
+    const result = await iterator.next();
+    if (result.done) {
+      break;
+    }
+    events.push(result.value);
+  }
+  return events;
+};
+
+describe('LedgerEventStore', () => {
+  let tail: LedgerTail;
+  let ledger: FakeLedger;
+  let store: LedgerEventStore;
+
+  beforeEach(() => {
+    tail = new LedgerTail();
+    ledger = new FakeLedger(tail);
+    store = new LedgerEventStore(ledger, tail, { pageSize: 3 });
+  });
+
+  describe('readStream', () => {
+    it('should rebuild a user balance from the stream alone', async () => {
+      [100, -30, 250, -75, 40].forEach(amount => ledger.append('user-1', amount));
+      ledger.append('user-2', 500);
+
+      const events = await store.readStream('user-1');
+
+      expect(events.map(e => e.version)).toEqual([1, 2, 3, 4, 5]);
+      expect(balances(events).get('user-1')).toBe(285);
+      expect(events[events.length - 1].data.balanceAfter).toBe(285);
+      expect(events[0]).toMatchObject({ streamId: 'user-1', type: 'ledger.credit', data: { amount: 100 } });
+    });
+
+    it('should read from a version onwards', async () => {
+      [10, 20, 30, 40].forEach(amount => ledger.append('user-1', amount));
+
+      const events = await store.readStream('user-1', 3);
+
+      expect(events.map(e => [e.version, e.data.amount])).toEqual([[3, 30], [4, 40]]);
+      expect(events[0].data.balanceBefore + balances(events).get('user-1')!).toBe(100);
+    });
+
+    it('should query only the versions it returns', async () => {
+      [10, 20, 30, 40, 50, 60, 70].forEach(amount => ledger.append('user-1', amount));
+      const query = jest.spyOn(ledger, 'queryEntries');
+
+      await store.readStream('user-1', 6);
+
+      expect(query).toHaveBeenCalledTimes(1);
+      expect(query.mock.calls[0][0]).toMatchObject({ accountId: 'user-1', fromStreamVersion: 6 });
+    });
+
+    it('should return an empty stream for an unknown user', async () => {
+      await expect(store.readStream('user-9')).resolves.toEqual([]);
+    });
+
+    it('should reject a stream with a missing version', async () => {
+      [10, 20, 30].forEach(amount => ledger.append('user-1', amount));
+      ledger.entries.splice(1, 1);
+
+      await expect(store.readStream('user-1')).rejects.toThrow(LedgerInconsistencyError);
+    });
+
+    it('should reject entries written before versions were tracked', async () => {
+      ledger.append('user-1', 10).streamVersion = undefined;
+
+      await expect(store.readStream('user-1')).rejects.toThrow('has no stream version');
+    });
+  });
+
+  describe('subscribeAll', () => {
+    it('should replay history then deliver live appends exactly once', async () => {
+      ledger.append('user-1', 100);
+      ledger.append('model-1', 999, 'model');
+      ledger.append('user-2', 50);
+      ledger.append('user-1', -20);
+
+      const subscription = store.subscribeAll(null);
+      const history = await take(subscription, 3);
+
+      // Appended once catch-up has read the history
+      ledger.append('user-2', 25);
+      ledger.append('user-1', 5);
+      const rest = await take(subscription, 2);
+      await subscription.return();
+
+      const events = [...history, ...rest];
+      expect(events.map(e => e.eventId)).toEqual(['entry-0001', 'entry-0003', 'entry-0004', 'entry-0005', 'entry-0006']);
+      expect(balances(events)).toEqual(new Map([['user-1', 85], ['user-2', 75]]));
+    });
+
+    it('should not redeliver live appends that catch-up already read', async () => {
+      [10, 20, 30, 40].forEach(amount => ledger.append('user-1', amount));
+
+      const subscription = store.subscribeAll(null);
+      const early = await take(subscription, 2);
+      ledger.append('user-1', 50);
+      const caughtUp = await take(subscription, 3);
+      ledger.append('user-1', 60);
+      const live = await take(subscription, 1);
+      await subscription.return();
+
+      const events = [...early, ...caughtUp, ...live];
+      expect(events.map(e => e.data.amount)).toEqual([10, 20, 30, 40, 50, 60]);
+      expect(events.map(e => e.version)).toEqual([1, 2, 3, 4, 5, 6]);
+    });
+
+    it('should resume after a position without redelivering', async () => {
+      [100, 200, 300, 400, 500].forEach((amount, i) => ledger.append(`user-${i % 2}`, amount));
+      const first = store.subscribeAll(null);
+      const seen = await take(first, 2);
+      await first.return();
+
+      const resumed = store.subscribeAll(seen[1].position);
+      const later = await take(resumed, 3);
+      await resumed.return();
+
+      expect([...seen, ...later].map(e => e.data.amount)).toEqual([100, 200, 300, 400, 500]);
+    });
+
+    it('should let every stream be rebuilt consistently with readStream', async () => {
+      for (let i = 0; i < 20; i++) {
+        ledger.append(`user-${i % 3}`, i % 4 === 0 ? -5 : 10 + i);
+      }
+
+      const subscription = store.subscribeAll(null);
+      const events = await take(subscription, 20);
+      await subscription.return();
+
+      for (const userId of ['user-0', 'user-1', 'user-2']) {
+        const stream = events.filter(e => e.streamId === userId);
+        expect(stream.map(e => e.version)).toEqual(stream.map((_, i) => i + 1));
+        expect(stream).toEqual(await store.readStream(userId));
+      }
+    });
+
+    it('should stop when the signal aborts', async () => {
+      ledger.append('user-1', 10);
+      const controller = new AbortController();
+      const subscription = store.subscribeAll(null, { signal: controller.signal });
+
+      await take(subscription, 1);
+      const pending = subscription.next();
+      controller.abort();
+
+      await expect(pending).resolves.toEqual({ value: undefined, done: true });
+      expect(tail.tailStats()).toEqual([]);
+    });
+  });
+});
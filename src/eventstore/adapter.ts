@@ -0,0 +1,227 @@
+/**
+ * Ledger Event Store Adapter
+ *
+ * Exposes the ledger as an event store: one stream per user, whose
+ * versions are the stream versions LedgerService stamps at append time
+ * (enable trackStreamVersions), plus one global stream of every user
+ * entry in (timestamp, entryId) order.
+ *
+ * readStream() reads a user's history. subscribeAll() replays the global
+ * stream from a position and then follows live appends through a
+ * LedgerTail, which must be registered as a hook on the ledger that
+ * takes the writes. The tail is opened before the replay starts, so an
+ * entry appended during catch-up is delivered once, by whichever phase
+ * sees it first. Entries committed out of timestamp order by concurrent
+ * writers can arrive slightly out of position order; consumers should
+ * key on eventId.
+ *
+ * Stream IDs are stored account IDs, so they are tokens when user IDs
+ * are tokenized. Entries written before stream versions were tracked
+ * have no version; reading them is a LedgerInconsistencyError until the
+ * history is backfilled.
+ */
+
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import { LedgerTail, TailOverflowPolicy } from '../ledger/ledger-tail';
+import { comparePositions } from '../ledger/replay';
+import { LedgerInconsistencyError } from '../services/types';
+import { StreamEvent, EventPosition, SubscribeAllOptions } from './types';
+
+/**
+ * Ledger operations the adapter reads through
+ */
+export type EventStoreLedger = Pick<ILedgerService, 'queryEntries'>;
+
+/**
+ * Configuration for the event store adapter
+ */
+export interface LedgerEventStoreConfig {
+  /** Entries read per ledger query */
+  pageSize: number;
+
+  /** Live events buffered per subscription */
+  bufferSize: number;
+
+  /**
+   * How far before a subscription opened catch-up still dedupes against
+   * live delivery; covers appends timestamped just before committing
+   */
+  overlapMs: number;
+}
+
+const DEFAULT_CONFIG: LedgerEventStoreConfig = {
+  pageSize: 500,
+  bufferSize: 1000,
+  overlapMs: 60_000,
+};
+
+/**
+ * LedgerEventStore implementation
+ */
+export class LedgerEventStore {
+  private ledger: EventStoreLedger;
+  private tail: LedgerTail;
+  private config: LedgerEventStoreConfig;
+
+  constructor(ledger: EventStoreLedger, tail: LedgerTail, config: Partial<LedgerEventStoreConfig> = {}) {
+    this.ledger = ledger;
+    this.tail = tail;
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
+  /**
+   * Read a user's stream from a version onwards
+   * Earlier versions are filtered out by the ledger query, so reading the
+   * tail of a long stream does not page through its whole history.
+   *
+   * @param fromVersion First version to return (1 for the whole stream)
+   * @returns Events by ascending version
+   * @throws LedgerInconsistencyError if an entry is unversioned or a version is missing
+   */
+  async readStream(streamId: string, fromVersion = 1): Promise<StreamEvent[]> {
+    const events: StreamEvent[] = [];
+    let offset = 0;
+
+    for (;;) {
+      const page = await this.ledger.queryEntries({
+        accountId: streamId,
+        accountType: 'user',
+        fromStreamVersion: fromVersion,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: this.config.pageSize,
+      });
+
+      for (const entry of page.entries) {
+        events.push(toEvent(entry));
+      }
+
+      offset += page.entries.length;
+      if (!page.hasMore || page.entries.length === 0) {
+        break;
+      }
+    }
+
+    events.sort((a, b) => a.version - b.version);
+    events.forEach((event, i) => {
+      if (event.version !== fromVersion + i) {
+        throw new LedgerInconsistencyError(`Stream ${streamId} is missing version ${fromVersion + i}`, {
+          streamId,
+          version: fromVersion + i,
+        });
+      }
+    });
+
+    return events;
+  }
+
+  /**
+   * Every user event after a position, then live events as they are appended
+   * Pass the last event's position to resume; null starts from the beginning.
+   *
+   * @throws TailOverflowError if the consumer falls bufferSize events behind
+   */
+  async *subscribeAll(
+    from: EventPosition | null,
+    options: SubscribeAllOptions = {}
+  ): AsyncGenerator<StreamEvent, void, undefined> {
+    const subscription = this.tail.tail({
+      bufferSize: options.bufferSize || this.config.bufferSize,
+      overflow: TailOverflowPolicy.ERROR,
+      signal: options.signal,
+    });
+    const openedAt = Date.now();
+    const seen = new Set<string>();
+
+    try {
+      let after = from ? { timestamp: from.timestamp, entryId: from.eventId } : null;
+      let offset = 0;
+      for (;;) {
+        if (options.signal?.aborted) {
+          return;
+        }
+        const page = await this.ledger.queryEntries({
+          accountType: 'user',
+          startDate: after ? after.timestamp : undefined,
+          sortBy: 'timestamp',
+          sortOrder: 'asc',
+          offset,
+          limit: this.config.pageSize,
+        });
+
+        const fresh = page.entries.filter(entry => !after || comparePositions(entry, after) > 0);
+        for (const entry of fresh) {
+          if (new Date(entry.timestamp).getTime() >= openedAt - this.config.overlapMs) {
+            seen.add(entry.entryId);
+          }
+          yield toEvent(entry);
+        }
+
+        if (!page.hasMore || page.entries.length === 0) {
+          break;
+        }
+        if (fresh.length > 0) {
+          after = fresh[fresh.length - 1];
+          offset = 0;
+        } else {
+          // A full page at or before the position; step past it
+          offset += page.entries.length;
+        }
+      }
+
+      for await (const entry of subscription) {
+        if (entry.accountType !== 'user' || seen.has(entry.entryId)) {
+          continue;
+        }
+        yield toEvent(entry);
+      }
+    } finally {
+      subscription.close();
+    }
+  }
+}
+
+/**
+ * Wrap a ledger entry in a versioned envelope
+ *
+ * @throws LedgerInconsistencyError if the entry has no stream version
+ */
+export function toEvent(entry: LedgerEntry): StreamEvent {
+  if (entry.streamVersion === undefined) {
+    throw new LedgerInconsistencyError(`Entry ${entry.entryId} has no stream version`, {
+      entryId: entry.entryId,
+      streamId: entry.accountId,
+    });
+  }
+
+  return {
+    eventId: entry.entryId,
+    streamId: entry.accountId,
+    version: entry.streamVersion,
+    type: `ledger.${entry.type}`,
+    occurredAt: new Date(entry.timestamp),
+    position: { timestamp: new Date(entry.timestamp), eventId: entry.entryId },
+    data: {
+      transactionId: entry.transactionId,
+      amount: entry.amount,
+      balanceState: entry.balanceState,
+      reason: entry.reason,
+      balanceBefore: entry.balanceBefore,
+      balanceAfter: entry.balanceAfter,
+      currency: entry.currency,
+      correlationId: entry.correlationId,
+    },
+  };
+}
+
+/**
+ * Factory function to create a ledger event store
+ */
+export function createLedgerEventStore(
+  ledger: EventStoreLedger,
+  tail: LedgerTail,
+  config?: Partial<LedgerEventStoreConfig>
+): LedgerEventStore {
+  return new LedgerEventStore(ledger, tail, config);
+}
@@ -0,0 +1,6 @@
+/**
+ * Event Store Module
+ */
+
+export * from './types';
+export * from './adapter';
@@ -0,0 +1,69 @@
+/**
+ * Event Store Types
+ *
+ * Versioned envelopes for consumers that read the ledger as a generic
+ * event stream. Payloads use plain strings and numbers only, so a
+ * consumer needs none of the ledger's domain types.
+ */
+
+/**
+ * Global position of an event: the ledger's (timestamp, entryId) order
+ */
+export interface EventPosition {
+  timestamp: Date;
+  eventId: string;
+}
+
+/**
+ * Ledger entry payload carried by an event
+ */
+export interface LedgerEventData {
+  transactionId: string;
+
+  /** Signed points (positive credit, negative debit) */
+  amount: number;
+
+  /** Balance bucket the entry moved */
+  balanceState: string;
+
+  reason: string;
+  balanceBefore: number;
+  balanceAfter: number;
+  currency: string;
+  correlationId?: string;
+}
+
+/**
+ * One ledger entry in a versioned envelope
+ */
+export interface StreamEvent {
+  /** Ledger entry ID */
+  eventId: string;
+
+  /** Stream the event belongs to (the user ID) */
+  streamId: string;
+
+  /** Position in the stream, from 1 without gaps */
+  version: number;
+
+  /** Event type, e.g. ledger.credit */
+  type: string;
+
+  occurredAt: Date;
+
+  /** Where a subscribeAll consumer resumes after this event */
+  position: EventPosition;
+
+  data: LedgerEventData;
+}
+
+/**
+ * Options for a subscribeAll subscription
+ */
+export interface SubscribeAllOptions {
+  /** Stop the subscription when aborted */
+  signal?: AbortSignal;
+
+  /** Live events buffered before the subscription fails with TailOverflowError */
+  bufferSize?: number;
+}
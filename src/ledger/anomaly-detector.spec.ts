@@ -0,0 +1,46 @@
+/**
+ * Amount Anomaly Detector Tests
+ */
+
+import { StdDevAnomalyDetector } from './anomaly-detector';
+import { AmountStats } from './types';
+
+describe('StdDevAnomalyDetector', () => {
+  // Ten earlier amounts averaging 100 with a standard deviation of 10
+  const history: AmountStats = { count: 10, min: 85, max: 115, sum: 1000, mean: 100, stdDev: 10 };
+
+  const detector = (config: Partial<{ maxDeviations: number; minHistory: number }> = {}) =>
+    new StdDevAnomalyDetector({ maxDeviations: 3, onAnomaly: jest.fn(), ...config });
+
+  it('should not flag an amount within the configured deviations', () => {
+    expect(detector().isAnomalous(125, history)).toBe(false);
+    expect(detector().isAnomalous(130, history)).toBe(false);
+    expect(detector().isAnomalous(-75, history)).toBe(false);
+  });
+
+  it('should flag an outlier on either side of the mean', () => {
+    expect(detector().isAnomalous(131, history)).toBe(true);
+    expect(detector().isAnomalous(-5000, history)).toBe(true);
+    expect(detector().isAnomalous(60, history)).toBe(true);
+    expect(detector({ maxDeviations: 1 }).isAnomalous(115, history)).toBe(true);
+  });
+
+  it('should not judge accounts with too little history', () => {
+    const sparse = { ...history, count: 4 };
+
+    expect(detector().isAnomalous(100_000, sparse)).toBe(false);
+    expect(detector({ minHistory: 4 }).isAnomalous(100_000, sparse)).toBe(true);
+  });
+
+  it('should flag any change from a history of identical amounts', () => {
+    const constant: AmountStats = { count: 8, min: 50, max: 50, sum: 400, mean: 50, stdDev: 0 };
+
+    expect(detector().isAnomalous(50, constant)).toBe(false);
+    expect(detector().isAnomalous(51, constant)).toBe(true);
+  });
+
+  it('should reject an invalid configuration', () => {
+    expect(() => detector({ maxDeviations: 0 })).toThrow('maxDeviations must be positive');
+    expect(() => detector({ minHistory: 0 })).toThrow('minHistory must be a positive integer');
+  });
+});
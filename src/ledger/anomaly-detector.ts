@@ -0,0 +1,76 @@
+/**
+ * Amount Anomaly Detector
+ *
+ * Flags an appended amount that lies more than maxDeviations standard
+ * deviations from the mean of the account's earlier amounts of the same
+ * type, for fraud review. Plug it in as LedgerConfig.anomalyDetector: the
+ * entry is committed either way, and onAnomaly receives it afterwards
+ * without the append waiting on it.
+ *
+ * Amounts are compared as magnitudes, like AmountStats. Accounts with
+ * fewer than minHistory earlier entries are not judged, as a mean over a
+ * handful of entries says little. When every earlier amount was the same,
+ * any different amount is an outlier.
+ */
+
+import { AnomalyDetector, AmountStats, LedgerEntry } from './types';
+
+/**
+ * Configuration for the standard-deviation detector
+ */
+export interface StdDevAnomalyDetectorConfig {
+  /** Standard deviations from the mean beyond which an amount is flagged */
+  maxDeviations: number;
+
+  /** Fewest earlier entries of the type before amounts are judged */
+  minHistory: number;
+
+  /** Receives each flagged entry with the stats it was judged against */
+  onAnomaly: (entry: LedgerEntry, stats: AmountStats) => void | Promise<void>;
+}
+
+const DEFAULT_CONFIG: Pick<StdDevAnomalyDetectorConfig, 'minHistory'> = {
+  minHistory: 5,
+};
+
+/**
+ * Standard-deviation anomaly detector
+ */
+export class StdDevAnomalyDetector implements AnomalyDetector {
+  private config: StdDevAnomalyDetectorConfig;
+
+  /**
+   * @throws Error if maxDeviations is not positive or minHistory is not a positive integer
+   */
+  constructor(config: Partial<StdDevAnomalyDetectorConfig> & Pick<StdDevAnomalyDetectorConfig, 'maxDeviations' | 'onAnomaly'>) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+
+    if (!Number.isFinite(this.config.maxDeviations) || this.config.maxDeviations <= 0) {
+      throw new Error(`maxDeviations must be positive: ${this.config.maxDeviations}`);
+    }
+    if (!Number.isSafeInteger(this.config.minHistory) || this.config.minHistory < 1) {
+      throw new Error(`minHistory must be a positive integer: ${this.config.minHistory}`);
+    }
+  }
+
+  isAnomalous(amount: number, stats: AmountStats): boolean {
+    if (stats.count < this.config.minHistory) {
+      return false;
+    }
+
+    return Math.abs(Math.abs(amount) - stats.mean) > this.config.maxDeviations * stats.stdDev;
+  }
+
+  onAnomaly(entry: LedgerEntry, stats: AmountStats): void | Promise<void> {
+    return this.config.onAnomaly(entry, stats);
+  }
+}
+
+/**
+ * Factory function to create a standard-deviation anomaly detector
+ */
+export function createStdDevAnomalyDetector(
+  config: Partial<StdDevAnomalyDetectorConfig> & Pick<StdDevAnomalyDetectorConfig, 'maxDeviations' | 'onAnomaly'>
+): StdDevAnomalyDetector {
+  return new StdDevAnomalyDetector(config);
+}
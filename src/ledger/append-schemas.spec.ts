@@ -0,0 +1,125 @@
+/**
+ * Append Schema Tests
+ */
+
+import { AppendSchemaRegistry, schemaValidator, tagSchema } from './append-schemas';
+import { ValidatingLedgerService } from './validating-ledger.service';
+import { ILedgerService, CreateLedgerEntryRequest, LedgerEntry } from './types';
+import { SchemaViolationError, findErrorCause } from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('append schemas', () => {
+  const request: CreateLedgerEntryRequest = {
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 100,
+    metadata: { orderId: 'order-9', quantity: 2, giftWrapped: false },
+  };
+
+  const orderTags = tagSchema({
+    orderId: { type: 'string', required: true },
+    quantity: { type: 'integer' },
+    giftWrapped: { type: 'boolean' },
+  });
+
+  let registry: AppendSchemaRegistry;
+
+  beforeEach(() => {
+    registry = new AppendSchemaRegistry();
+  });
+
+  describe('tagSchema', () => {
+    it('accepts conforming tags and ignores tags outside the spec', async () => {
+      registry.register(TransactionType.CREDIT, orderTags);
+
+      await expect(registry.check(request)).resolves.toBeUndefined();
+      await expect(
+        registry.check({ ...request, metadata: { orderId: 'order-9', committedBy: 'svc:shop' } })
+      ).resolves.toBeUndefined();
+    });
+
+    it('reports every missing and mistyped tag', async () => {
+      registry.register(TransactionType.CREDIT, orderTags);
+
+      const error = await registry.check({ ...request, metadata: { quantity: 1.5, giftWrapped: 'yes' } }).catch(e => e);
+
+      expect(error).toBeInstanceOf(SchemaViolationError);
+      expect(error.code).toBe('SCHEMA_VIOLATION');
+      expect(error.violations).toEqual([
+        { field: 'orderId', message: 'orderId is required' },
+        { field: 'quantity', message: 'quantity must be integer, got number' },
+        { field: 'giftWrapped', message: 'giftWrapped must be boolean, got string' },
+      ]);
+    });
+
+    it('rejects an unknown tag type', () => {
+      expect(() => tagSchema({ orderId: { type: 'date' as any } })).toThrow('Unknown tag type for orderId: date');
+    });
+  });
+
+  describe('AppendSchemaRegistry', () => {
+    it('checks only the types that have a schema', async () => {
+      registry.register(TransactionType.DEBIT, orderTags);
+
+      await expect(registry.check({ ...request, metadata: undefined })).resolves.toBeUndefined();
+    });
+
+    it('turns a custom schema failure into a violation', async () => {
+      registry.register(TransactionType.CREDIT, r => {
+        if (r.reason !== TransactionReason.PROMOTIONAL_AWARD) {
+          throw new Error('credits must be promotional');
+        }
+      });
+
+      await expect(registry.check({ ...request, reason: TransactionReason.ADMIN_CREDIT })).rejects.toMatchObject({
+        details: { transactionType: 'credit', violations: [{ message: 'credits must be promotional' }] },
+      });
+    });
+
+    it('allows one schema per type until it is unregistered', () => {
+      const unregister = registry.register(TransactionType.CREDIT, orderTags);
+
+      expect(() => registry.register(TransactionType.CREDIT, orderTags)).toThrow('Schema already registered for credit');
+      unregister();
+      expect(() => registry.register(TransactionType.CREDIT, orderTags)).not.toThrow();
+    });
+  });
+
+  describe('schemaValidator', () => {
+    let inner: jest.Mocked<ILedgerService>;
+    let service: ValidatingLedgerService;
+
+    beforeEach(() => {
+      inner = {
+        createEntry: jest.fn().mockImplementation(async (r: CreateLedgerEntryRequest) => ({ entryId: 'e1', ...r }) as LedgerEntry),
+      } as unknown as jest.Mocked<ILedgerService>;
+      service = new ValidatingLedgerService(inner, [schemaValidator(registry)]);
+    });
+
+    it('appends a conforming entry', async () => {
+      registry.register(TransactionType.CREDIT, orderTags);
+
+      await expect(service.createEntry(request)).resolves.toMatchObject({ entryId: 'e1' });
+    });
+
+    it('rejects a non-conforming entry with the violations', async () => {
+      registry.register(TransactionType.CREDIT, orderTags);
+
+      const error = await service.createEntry({ ...request, metadata: { orderId: 42 } }).catch(e => e);
+
+      expect(inner.createEntry).not.toHaveBeenCalled();
+      expect(error.code).toBe('SCHEMA_VIOLATION');
+      expect(findErrorCause(error, SchemaViolationError)?.violations).toEqual([
+        { field: 'orderId', message: 'orderId must be string, got number' },
+      ]);
+    });
+  });
+});
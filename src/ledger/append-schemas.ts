@@ -0,0 +1,145 @@
+/**
+ * Append Schemas
+ *
+ * Teams attach metadata (tags, references) with their own shapes. An
+ * AppendSchemaRegistry holds one schema per transaction type, and
+ * schemaValidator runs the schema for each append's type in the
+ * validation chain, so those contracts are enforced at the ledger
+ * boundary. Types without a registered schema are not checked.
+ *
+ * A schema is any function that throws for a non-conforming entry.
+ * tagSchema builds one from a declared key/type spec. A violation rejects
+ * the append with a SchemaViolationError listing every offending field.
+ */
+
+import { CreateLedgerEntryRequest } from './types';
+import { AppendValidator, ValidationStage } from './validating-ledger.service';
+import { TransactionType } from '../wallets/types';
+import { SchemaViolation, SchemaViolationError } from '../services/types';
+
+/**
+ * Check an entry against a schema; throw to reject it
+ * A SchemaViolationError is passed through; any other error becomes one.
+ */
+export type AppendSchema = (request: CreateLedgerEntryRequest) => void | Promise<void>;
+
+/**
+ * Type a declared tag must have
+ */
+export type TagType = 'string' | 'number' | 'integer' | 'boolean';
+
+export interface TagSpec {
+  type: TagType;
+
+  /** Whether the tag must be present (default false) */
+  required?: boolean;
+}
+
+/**
+ * Schemas registered per transaction type
+ */
+export class AppendSchemaRegistry {
+  private schemas: Map<TransactionType, AppendSchema> = new Map();
+
+  /**
+   * Register the schema for a transaction type
+   *
+   * @returns Function that unregisters the schema
+   * @throws Error if the type already has a schema
+   */
+  register(type: TransactionType, schema: AppendSchema): () => void {
+    if (this.schemas.has(type)) {
+      throw new Error(`Schema already registered for ${type}`);
+    }
+
+    this.schemas.set(type, schema);
+    return () => {
+      if (this.schemas.get(type) === schema) {
+        this.schemas.delete(type);
+      }
+    };
+  }
+
+  /**
+   * Check an entry against its type's schema, if any
+   *
+   * @throws SchemaViolationError if the entry does not conform
+   */
+  async check(request: CreateLedgerEntryRequest): Promise<void> {
+    const schema = this.schemas.get(request.type);
+    if (!schema) {
+      return;
+    }
+
+    try {
+      await schema(request);
+    } catch (error) {
+      if (error instanceof SchemaViolationError) {
+        throw error;
+      }
+      throw new SchemaViolationError(request.type, [
+        { message: error instanceof Error ? error.message : String(error) },
+      ]);
+    }
+  }
+}
+
+/**
+ * Run a registry's schemas in the validation chain
+ */
+export function schemaValidator(registry: AppendSchemaRegistry, stage: ValidationStage = 'rules'): AppendValidator {
+  return {
+    name: 'append-schema',
+    stage,
+    validate(request: CreateLedgerEntryRequest): Promise<void> {
+      return registry.check(request);
+    },
+  };
+}
+
+/**
+ * Schema checking metadata tags against a key/type spec
+ * Tags not in the spec are allowed.
+ */
+export function tagSchema(spec: Record<string, TagSpec>): AppendSchema {
+  for (const [key, tag] of Object.entries(spec)) {
+    if (!['string', 'number', 'integer', 'boolean'].includes(tag.type)) {
+      throw new Error(`Unknown tag type for ${key}: ${tag.type}`);
+    }
+  }
+
+  return (request: CreateLedgerEntryRequest) => {
+    const tags = request.metadata || {};
+    const violations: SchemaViolation[] = [];
+
+    for (const [key, tag] of Object.entries(spec)) {
+      const value = tags[key];
+      if (value === undefined || value === null) {
+        if (tag.required) {
+          violations.push({ field: key, message: `${key} is required` });
+        }
+      } else if (!hasTagType(value, tag.type)) {
+        violations.push({ field: key, message: `${key} must be ${tag.type}, got ${typeName(value)}` });
+      }
+    }
+
+    if (violations.length > 0) {
+      throw new SchemaViolationError(request.type, violations);
+    }
+  };
+}
+
+function hasTagType(value: unknown, type: TagType): boolean {
+  switch (type) {
+    case 'integer':
+      return Number.isSafeInteger(value);
+    case 'number':
+      return typeof value === 'number' && Number.isFinite(value);
+    default:
+      return typeof value === type;
+  }
+}
+
+function typeName(value: unknown): string {
+  return Array.isArray(value) ? 'array' : typeof value;
+}
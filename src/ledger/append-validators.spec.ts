@@ -0,0 +1,115 @@
+/**
+ * Built-in Append Validator Tests
+ */
+
+import {
+  structuralValidator,
+  amountRulesValidator,
+  noOverdraftValidator,
+  frozenAccountValidator,
+  appendHookValidator,
+  reasonPermissionValidator,
+  programPolicyValidators,
+} from './append-validators';
+import { ValidationReadView } from './validating-ledger.service';
+import { CreateLedgerEntryRequest } from './types';
+import { InsufficientBalanceError, AccountFrozenError, InvalidAuthorizationError } from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { ProgramConfig, defaultProgram } from '../config/program';
+
+describe('append validators', () => {
+  const request: CreateLedgerEntryRequest = {
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: -100,
+    type: TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: 'available→none',
+    reason: TransactionReason.CHIP_MENU_PURCHASE,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 300,
+    balanceAfter: 200,
+  };
+
+  const view = (availableBalance: number, frozen = false): ValidationReadView => ({
+    balance: async () => ({
+      accountId: 'user-123',
+      accountType: 'user',
+      availableBalance,
+      escrowBalance: 0,
+      asOf: new Date(),
+      currency: 'points',
+    }),
+    wallet: async () => ({ userId: 'user-123', frozen }),
+    entries: jest.fn(),
+  });
+
+  it('structural: requires identifiers and known enum values', () => {
+    expect(() => structuralValidator.validate(request, view(0))).not.toThrow();
+    expect(() => structuralValidator.validate({ ...request, requestId: '' }, view(0))).toThrow('requestId is required');
+    expect(() => structuralValidator.validate({ ...request, balanceState: 'pending' as any }, view(0))).toThrow(
+      'Invalid balance state'
+    );
+  });
+
+  it('rules: checks amount sign and balance arithmetic', () => {
+    expect(() => amountRulesValidator.validate(request, view(0))).not.toThrow();
+    expect(() => amountRulesValidator.validate({ ...request, amount: 100, balanceAfter: 400 }, view(0))).toThrow(
+      'sign does not match'
+    );
+    expect(() => amountRulesValidator.validate({ ...request, balanceAfter: 250 }, view(0))).toThrow('balanceAfter');
+  });
+
+  it('policy: rejects a debit beyond the current balance', async () => {
+    await expect(noOverdraftValidator.validate(request, view(100))).resolves.toBeUndefined();
+    await expect(noOverdraftValidator.validate(request, view(99))).rejects.toBeInstanceOf(InsufficientBalanceError);
+  });
+
+  it('freeze: rejects appends to a frozen wallet', async () => {
+    await expect(frozenAccountValidator.validate(request, view(0))).resolves.toBeUndefined();
+    await expect(frozenAccountValidator.validate(request, view(0, true))).rejects.toBeInstanceOf(AccountFrozenError);
+  });
+
+  it('caps: runs an append hook guard', async () => {
+    const beforeAppend = jest.fn().mockRejectedValue(new Error('quota exceeded'));
+    const validator = appendHookValidator({ name: 'issuer-quota', beforeAppend });
+
+    expect(validator).toMatchObject({ name: 'issuer-quota', stage: 'caps' });
+    await expect(validator.validate(request, view(0))).rejects.toThrow('quota exceeded');
+    expect(beforeAppend).toHaveBeenCalledWith(request);
+  });
+
+  it('rbac: restricts listed reasons to permitted roles', async () => {
+    const validator = reasonPermissionValidator({
+      rolesOf: committedBy => (committedBy === 'ops:alex' ? ['finance_admin'] : ['support']),
+      permissions: { [TransactionReason.ADMIN_CREDIT]: ['finance_admin'] },
+    });
+    const adminCredit = { ...request, reason: TransactionReason.ADMIN_CREDIT };
+
+    await expect(
+      validator.validate({ ...adminCredit, metadata: { committedBy: 'ops:alex' } }, view(0))
+    ).resolves.toBeUndefined();
+    await expect(
+      validator.validate({ ...adminCredit, metadata: { committedBy: 'ops:sam' } }, view(0))
+    ).rejects.toBeInstanceOf(InvalidAuthorizationError);
+    await expect(validator.validate(adminCredit, view(0))).rejects.toBeInstanceOf(InvalidAuthorizationError);
+    await expect(validator.validate(request, view(0))).resolves.toBeUndefined();
+  });
+
+  it('program: applies the overdraft and cap settings current at append time', async () => {
+    let program: ProgramConfig = { ...defaultProgram(), programId: 'vip', maxDebitPerEntry: 50 };
+    const [overdraft, caps] = programPolicyValidators({ current: () => program });
+    const small = { ...request, amount: -40, balanceAfter: 260 };
+
+    expect(overdraft).toMatchObject({ name: 'program-overdraft', stage: 'policy' });
+    expect(caps).toMatchObject({ name: 'program-caps', stage: 'caps' });
+    await expect(overdraft.validate(small, view(10))).rejects.toBeInstanceOf(InsufficientBalanceError);
+    expect(() => caps.validate(request, view(0))).toThrow('debit of 100 exceeds the vip cap of 50');
+    expect(() => caps.validate({ ...request, accountType: 'model' }, view(0))).not.toThrow();
+
+    program = { ...program, allowOverdraft: true, maxDebitPerEntry: undefined };
+    await expect(overdraft.validate(small, view(10))).resolves.toBeUndefined();
+    expect(() => caps.validate(request, view(0))).not.toThrow();
+  });
+});
@@ -0,0 +1,216 @@
+/**
+ * Built-in Append Validators
+ *
+ * The standard checks for ValidatingLedgerService, one per stage:
+ * - structural: required fields and known enum values
+ * - rules: amount is a non-zero integer whose sign matches the type, and
+ *   balanceAfter follows from balanceBefore
+ * - policy: a debit may not take an account below zero
+ * - caps: any LedgerAppendHook guard (quotas, velocity and reference
+ *   limits) adapted with appendHookValidator
+ * - freeze: nothing is appended to a frozen user wallet
+ * - rbac: reasons restricted to committers holding a permitted role
+ *
+ * defaultValidators returns the ones that need no configuration.
+ * programValidators applies a program config's overdraft rule and
+ * per-entry caps instead, read afresh for every append.
+ */
+
+import { CreateLedgerEntryRequest, LedgerAppendHook } from './types';
+import { AppendValidator, ValidationReadView, ValidationStage } from './validating-ledger.service';
+import { TransactionReason, TransactionType, isValidTransactionType } from '../wallets/types';
+import { InsufficientBalanceError, AccountFrozenError, InvalidAuthorizationError } from '../services/types';
+import { ProgramConfigSource } from '../config/program';
+
+const ACCOUNT_TYPES = ['user', 'model', 'system'];
+const BALANCE_STATES = ['available', 'escrow', 'earned'];
+
+/**
+ * Required fields and known enum values
+ */
+export const structuralValidator: AppendValidator = {
+  name: 'structural',
+  stage: 'structural',
+  validate(request: CreateLedgerEntryRequest): void {
+    for (const field of ['accountId', 'idempotencyKey', 'requestId', 'stateTransition'] as const) {
+      if (!request[field]) {
+        throw new Error(`${field} is required`);
+      }
+    }
+
+    if (!ACCOUNT_TYPES.includes(request.accountType)) {
+      throw new Error(`Invalid account type: ${request.accountType}`);
+    }
+
+    if (!BALANCE_STATES.includes(request.balanceState)) {
+      throw new Error(`Invalid balance state: ${request.balanceState}`);
+    }
+
+    if (!(Object.values(TransactionReason) as string[]).includes(request.reason)) {
+      throw new Error(`Invalid transaction reason: ${request.reason}`);
+    }
+  },
+};
+
+/**
+ * Transaction type and amount rules
+ */
+export const amountRulesValidator: AppendValidator = {
+  name: 'amount-rules',
+  stage: 'rules',
+  validate(request: CreateLedgerEntryRequest): void {
+    if (!isValidTransactionType(request.type)) {
+      throw new Error(`Invalid transaction type: ${request.type}`);
+    }
+
+    if (!Number.isSafeInteger(request.amount) || request.amount === 0) {
+      throw new Error('Amount must be a non-zero integer');
+    }
+
+    if ((request.type === TransactionType.CREDIT) !== (request.amount > 0)) {
+      throw new Error(`Amount sign does not match transaction type ${request.type}`);
+    }
+
+    if (!Number.isSafeInteger(request.balanceBefore) || request.balanceAfter !== request.balanceBefore + request.amount) {
+      throw new Error('balanceAfter must equal balanceBefore plus amount');
+    }
+  },
+};
+
+/**
+ * A debit may not take a user or model balance below zero
+ */
+export const noOverdraftValidator: AppendValidator = {
+  name: 'no-overdraft',
+  stage: 'policy',
+  async validate(request: CreateLedgerEntryRequest, view: ValidationReadView): Promise<void> {
+    if (request.amount >= 0) {
+      return;
+    }
+
+    const snapshot = await view.balance();
+    if (!snapshot) {
+      return;
+    }
+
+    const current =
+      request.balanceState === 'available'
+        ? snapshot.availableBalance
+        : request.balanceState === 'escrow'
+          ? snapshot.escrowBalance || 0
+          : snapshot.earnedBalance || 0;
+    if (current + request.amount < 0) {
+      throw new InsufficientBalanceError(-request.amount, current);
+    }
+  },
+};
+
+/**
+ * Nothing is appended to a frozen user wallet
+ */
+export const frozenAccountValidator: AppendValidator = {
+  name: 'frozen-account',
+  stage: 'freeze',
+  async validate(request: CreateLedgerEntryRequest, view: ValidationReadView): Promise<void> {
+    const wallet = await view.wallet();
+    if (wallet?.frozen) {
+      throw new AccountFrozenError(request.accountId);
+    }
+  },
+};
+
+/**
+ * Run a LedgerAppendHook guard's beforeAppend as a validator
+ * Only beforeAppend is used; hooks reserving capacity there keep the
+ * reservation if a later validator rejects the append. Guards may reserve
+ * capacity, so adjustment previews skip them.
+ */
+export function appendHookValidator(hook: LedgerAppendHook, stage: ValidationStage = 'caps'): AppendValidator {
+  return {
+    name: hook.name,
+    stage,
+    sideEffects: true,
+    async validate(request: CreateLedgerEntryRequest): Promise<void> {
+      await hook.beforeAppend?.(request);
+    },
+  };
+}
+
+/**
+ * Options for the reason permission validator
+ */
+export interface ReasonPermissionOptions {
+  /** Roles held by a committer (metadata.committedBy) */
+  rolesOf(committedBy: string): string[] | Promise<string[]>;
+
+  /** Roles permitted to append each restricted reason; unlisted reasons are open */
+  permissions: Partial<Record<TransactionReason, string[]>>;
+}
+
+/**
+ * Restrict reasons to committers holding a permitted role
+ */
+export function reasonPermissionValidator(options: ReasonPermissionOptions): AppendValidator {
+  return {
+    name: 'reason-permissions',
+    stage: 'rbac',
+    async validate(request: CreateLedgerEntryRequest): Promise<void> {
+      const permitted = options.permissions[request.reason];
+      if (!permitted) {
+        return;
+      }
+
+      const committedBy: string | undefined = request.metadata?.committedBy;
+      const roles = committedBy ? await options.rolesOf(committedBy) : [];
+      if (!roles.some(role => permitted.includes(role))) {
+        throw new InvalidAuthorizationError(`${request.reason} requires one of: ${permitted.join(', ')}`);
+      }
+    },
+  };
+}
+
+/**
+ * The program's overdraft rule and per-entry user caps
+ */
+export function programPolicyValidators(program: ProgramConfigSource): AppendValidator[] {
+  return [
+    {
+      name: 'program-overdraft',
+      stage: 'policy',
+      async validate(request: CreateLedgerEntryRequest, view: ValidationReadView): Promise<void> {
+        if (!program.current().allowOverdraft) {
+          await noOverdraftValidator.validate(request, view);
+        }
+      },
+    },
+    {
+      name: 'program-caps',
+      stage: 'caps',
+      validate(request: CreateLedgerEntryRequest): void {
+        if (request.accountType !== 'user') {
+          return;
+        }
+
+        const { programId, maxCreditPerEntry, maxDebitPerEntry } = program.current();
+        const cap = request.amount > 0 ? maxCreditPerEntry : maxDebitPerEntry;
+        if (cap !== undefined && Math.abs(request.amount) > cap) {
+          throw new Error(`${request.type} of ${Math.abs(request.amount)} exceeds the ${programId} cap of ${cap}`);
+        }
+      },
+    },
+  ];
+}
+
+/**
+ * Built-in validators for a program, in chain order
+ */
+export function programValidators(program: ProgramConfigSource): AppendValidator[] {
+  return [structuralValidator, amountRulesValidator, ...programPolicyValidators(program), frozenAccountValidator];
+}
+
+/**
+ * Built-in validators that need no configuration, in chain order
+ */
+export function defaultValidators(): AppendValidator[] {
+  return [structuralValidator, amountRulesValidator, noOverdraftValidator, frozenAccountValidator];
+}
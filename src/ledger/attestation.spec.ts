@@ -0,0 +1,194 @@
+/**
+ * Ledger Attestation Tests
+ */
+
+import {
+  LedgerAttestor,
+  verifyPrefix,
+  verifyChainHash,
+  extendChainHash,
+  GENESIS_HASH,
+  IAttestationHistory,
+  IEntryScanStore,
+  LedgerAttestation,
+} from './attestation';
+import { LedgerEntry } from './types';
+import { ReplayPosition } from './replay';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('ledger attestation', () => {
+  const entry = (n: number, amount: number): LedgerEntry => ({
+    entryId: `entry-${String(n).padStart(3, '0')}`,
+    transactionId: `tx-${n}`,
+    accountId: 'user-1',
+    accountType: 'user',
+    amount,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `key-${n}`,
+    requestId: `req-${n}`,
+    balanceBefore: 0,
+    balanceAfter: amount,
+    timestamp: new Date(Date.UTC(2024, 0, 1, 0, n)),
+    currency: 'points',
+  });
+
+  const ledger = (count: number) => Array.from({ length: count }, (_, i) => entry(i + 1, i % 3 === 2 ? -5 : 10));
+
+  const scanStore = (entries: LedgerEntry[]): IEntryScanStore => ({
+    scanEntries: async (after: ReplayPosition | null, limit: number) =>
+      entries
+        .filter(e => !after || e.timestamp > after.timestamp || (+e.timestamp === +after.timestamp && e.entryId > after.entryId))
+        .slice(0, limit),
+  });
+
+  class MemoryHistory implements IAttestationHistory {
+    attestations: LedgerAttestation[] = [];
+
+    async latest() {
+      return this.attestations[this.attestations.length - 1] || null;
+    }
+
+    async list() {
+      return [...this.attestations];
+    }
+
+    async record(attestation: LedgerAttestation) {
+      this.attestations.push(attestation);
+    }
+  }
+
+  const attested = async (entries: LedgerEntry[], checkpointEvery = 4) => {
+    const history = new MemoryHistory();
+    const head = await new LedgerAttestor(scanStore(entries), history, { checkpointEvery, pageSize: 3 }).attest();
+    return { history, head };
+  };
+
+  describe('LedgerAttestor', () => {
+    it('records an attestation every checkpointEvery entries and at the head', async () => {
+      const { history, head } = await attested(ledger(10));
+
+      expect(history.attestations.map(a => a.sequence)).toEqual([4, 8, 10]);
+      expect(head).toMatchObject({ sequence: 10, counts: { credit: 7, debit: 3 }, sums: { credit: 70, debit: -15 } });
+      expect(history.attestations[2].chainHash).toBe(head.chainHash);
+    });
+
+    it('extends the chain from the latest attestation', async () => {
+      const entries = ledger(10);
+      const { history } = await attested(entries.slice(0, 6));
+
+      const head = await new LedgerAttestor(scanStore(entries), history, { checkpointEvery: 4 }).attest();
+
+      expect(history.attestations.map(a => a.sequence)).toEqual([4, 6, 8, 10]);
+      expect(head.chainHash).toBe(entries.reduce(extendChainHash, GENESIS_HASH));
+    });
+
+    it('leaves entries younger than the settle window for a later run', async () => {
+      const entries = ledger(6);
+      jest.spyOn(Date, 'now').mockReturnValue(entries[3].timestamp.getTime() + 60000);
+
+      const history = new MemoryHistory();
+      const head = await new LedgerAttestor(scanStore(entries), history, { checkpointEvery: 4 }).attest();
+
+      expect(head.sequence).toBe(4);
+      expect(history.attestations.map(a => a.sequence)).toEqual([4]);
+      jest.restoreAllMocks();
+    });
+
+    it('records nothing when the ledger has not grown', async () => {
+      const { history } = await attested(ledger(4));
+
+      await new LedgerAttestor(scanStore(ledger(4)), history, { checkpointEvery: 4 }).attest();
+
+      expect(history.attestations).toHaveLength(1);
+    });
+  });
+
+  describe('verifyPrefix', () => {
+    it('verifies a restore whose head has an attestation', async () => {
+      const entries = ledger(10);
+      const { history, head } = await attested(entries);
+
+      const report = await verifyPrefix(scanStore(entries.slice(0, 8)), history, head, { pageSize: 3 });
+
+      expect(report).toMatchObject({ status: 'verified', matched: { sequence: 8 }, restoredHead: { sequence: 8 } });
+    });
+
+    it('verifies a restore equal to the live head', async () => {
+      const entries = ledger(10);
+      const { history, head } = await attested(entries);
+
+      await expect(verifyPrefix(scanStore(entries), history, head)).resolves.toMatchObject({ status: 'verified' });
+    });
+
+    it('reports where a tampered restore diverged', async () => {
+      const entries = ledger(10);
+      const { history, head } = await attested(entries);
+      const tampered = entries.slice(0, 8);
+      tampered[5] = { ...tampered[5], amount: 1000 };
+
+      const report = await verifyPrefix(scanStore(tampered), history, head);
+
+      expect(report).toMatchObject({
+        status: 'diverged',
+        matched: { sequence: 4 },
+        divergence: { sequence: 8, field: 'chainHash' },
+      });
+    });
+
+    it('reports mismatched stats against an archived attestation', async () => {
+      const entries = ledger(8);
+      const { history, head } = await attested(entries);
+      history.attestations[1] = { ...history.attestations[1], sums: { credit: 60, debit: -5 } };
+
+      const report = await verifyPrefix(scanStore(entries), history, { sequence: 10, chainHash: head.chainHash });
+
+      expect(report).toMatchObject({ status: 'diverged', divergence: { sequence: 8, field: 'sums' } });
+    });
+
+    it('reports a restore longer than the live chain', async () => {
+      const entries = ledger(10);
+      const { history, head } = await attested(entries.slice(0, 8));
+
+      const report = await verifyPrefix(scanStore(entries), history, head);
+
+      expect(report).toMatchObject({ status: 'diverged', divergence: { field: 'length', expected: 8, actual: 10 } });
+    });
+
+    it('reports an unanchored restore with the last matched attestation', async () => {
+      const entries = ledger(10);
+      const { history, head } = await attested(entries);
+
+      const report = await verifyPrefix(scanStore(entries.slice(0, 6)), history, head);
+
+      expect(report).toMatchObject({ status: 'unanchored', matched: { sequence: 4 } });
+      expect(report.message).toBe('No attestation at sequence 6; verified through sequence 4');
+    });
+  });
+
+  describe('verifyChainHash', () => {
+    it('accepts the current head, in either case', async () => {
+      const entries = ledger(7);
+      const { head } = await attested(entries);
+
+      await expect(verifyChainHash(scanStore(entries), head.chainHash, { pageSize: 3 })).resolves.toBe(true);
+      await expect(verifyChainHash(scanStore(entries), head.chainHash.toUpperCase())).resolves.toBe(true);
+      await expect(verifyChainHash(scanStore([]), GENESIS_HASH)).resolves.toBe(true);
+    });
+
+    it('rejects a stale or forged hash', async () => {
+      const entries = ledger(7);
+      const { head: stale } = await attested(entries.slice(0, 6));
+      const forged = extendChainHash(GENESIS_HASH, { ...entries[0], amount: 1000 });
+
+      await expect(verifyChainHash(scanStore(entries), stale.chainHash)).resolves.toBe(false);
+      await expect(verifyChainHash(scanStore(entries), forged)).resolves.toBe(false);
+    });
+
+    it('rejects a value that is not a chain hash', async () => {
+      await expect(verifyChainHash(scanStore(ledger(2)), 'abc123')).rejects.toThrow('64 hex characters');
+    });
+  });
+});
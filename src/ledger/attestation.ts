@@ -0,0 +1,399 @@
+/**
+ * Ledger Attestation and Restore Verification
+ *
+ * The chain hash folds every entry, in (timestamp, entryId) order, into
+ * a rolling SHA-256:
+ *   hash(0) = GENESIS_HASH
+ *   hash(n) = sha256(hash(n-1) + entryChecksum(entry n))
+ * so the hash at sequence n commits to the exact first n entries.
+ *
+ * LedgerAttestor extends the chain from its latest attestation and
+ * records an attestation (sequence, chain hash, per-type counts and sums)
+ * every `checkpointEvery` entries and at the head. Run it right before
+ * each backup so the backup's head has an attestation of its own.
+ *
+ * An entry's timestamp is taken before it commits, so an append still in
+ * flight can land behind entries already scanned. The attestor therefore
+ * stops at entries younger than `settleMs`; by then every append stamped
+ * before them has committed or failed, and the chain never has to fold
+ * an entry in front of its head. On a tiered ledger, attest and verify
+ * over a TieredEntryScanStore so entries moved to the archive stay in
+ * the chain.
+ *
+ * verifyPrefix() replays a restored store from genesis and checks each
+ * attestation it passes. A restore is verified when its head matches an
+ * attestation at exactly its sequence. Otherwise the report names the
+ * last matched attestation and where the restore diverged, or says that
+ * no attestation anchors its head.
+ *
+ * verifyChainHash() confirms that a chain hash handed back by an outside
+ * attestation service is the current head of the live ledger, comparing
+ * in constant time, before anything signed against it is trusted.
+ */
+
+import { createHash, timingSafeEqual } from 'crypto';
+import { Model } from 'mongoose';
+import { LedgerEntry } from './types';
+import { ReplayPosition } from './replay';
+import { ISelfCheckStore } from './self-check';
+import { entryChecksum } from '../tiering/tiering';
+import { LedgerAttestationModel, ILedgerAttestation } from '../db/models/ledger-attestation.model';
+
+/**
+ * Chain hash of the empty ledger
+ */
+export const GENESIS_HASH = '0'.repeat(64);
+
+/**
+ * Chain state after a prefix of the ledger
+ */
+export interface ChainHead {
+  /** Number of entries in the prefix */
+  sequence: number;
+
+  chainHash: string;
+
+  /** Last entry of the prefix (null for the empty ledger) */
+  position: ReplayPosition | null;
+
+  /** Entry count per transaction type */
+  counts: Record<string, number>;
+
+  /** Amount sum per transaction type */
+  sums: Record<string, number>;
+}
+
+/**
+ * A recorded chain checkpoint
+ */
+export interface LedgerAttestation extends ChainHead {
+  position: ReplayPosition;
+
+  takenAt: Date;
+}
+
+/**
+ * Entries in (timestamp, entryId) order
+ * Implemented by MongoSelfCheckStore.
+ */
+export type IEntryScanStore = Pick<ISelfCheckStore, 'scanEntries'>;
+
+/**
+ * Durable attestation history
+ */
+export interface IAttestationHistory {
+  latest(): Promise<LedgerAttestation | null>;
+
+  /** Every attestation, by ascending sequence */
+  list(): Promise<LedgerAttestation[]>;
+
+  record(attestation: LedgerAttestation): Promise<void>;
+}
+
+/**
+ * Options for attestation and verification
+ */
+export interface AttestationOptions {
+  /** Entries read per page */
+  pageSize: number;
+
+  /** Attest every this many entries, as well as at the head */
+  checkpointEvery: number;
+
+  /** Entries younger than this are left for a later attestation */
+  settleMs: number;
+}
+
+const DEFAULT_OPTIONS: AttestationOptions = {
+  pageSize: 1000,
+  checkpointEvery: 10000,
+  settleMs: 60000,
+};
+
+/**
+ * Outcome of a restore verification
+ */
+export interface PrefixReport {
+  /**
+   * verified: the head matches an attestation at its sequence
+   * diverged: an attestation or the live head disagrees with the restore
+   * unanchored: everything checked matched, but no attestation exists at the head
+   */
+  status: 'verified' | 'diverged' | 'unanchored';
+
+  restoredHead: ChainHead;
+
+  /** Last attestation the restore matched */
+  matched: LedgerAttestation | null;
+
+  /** First disagreement, when diverged */
+  divergence?: {
+    sequence: number;
+    field: 'chainHash' | 'counts' | 'sums' | 'length';
+    expected: unknown;
+    actual: unknown;
+  };
+
+  message: string;
+}
+
+/**
+ * Extend a chain hash by one entry
+ */
+export function extendChainHash(previous: string, entry: LedgerEntry): string {
+  return createHash('sha256').update(previous).update(entryChecksum(entry)).digest('hex');
+}
+
+/**
+ * Chain state of the empty ledger
+ */
+export function genesisHead(): ChainHead {
+  return { sequence: 0, chainHash: GENESIS_HASH, position: null, counts: {}, sums: {} };
+}
+
+/**
+ * Fold one entry into a chain head, in place
+ */
+function advance(head: ChainHead, entry: LedgerEntry): void {
+  head.sequence++;
+  head.chainHash = extendChainHash(head.chainHash, entry);
+  head.position = { timestamp: entry.timestamp, entryId: entry.entryId };
+  head.counts[entry.type] = (head.counts[entry.type] || 0) + 1;
+  head.sums[entry.type] = (head.sums[entry.type] || 0) + entry.amount;
+}
+
+function sameStats(a: Record<string, number>, b: Record<string, number>): boolean {
+  const keys = new Set([...Object.keys(a), ...Object.keys(b)]);
+  return [...keys].every(key => (a[key] || 0) === (b[key] || 0));
+}
+
+/**
+ * Records chain attestations of the live ledger
+ */
+export class LedgerAttestor {
+  private store: IEntryScanStore;
+  private history: IAttestationHistory;
+  private options: AttestationOptions;
+
+  constructor(store: IEntryScanStore, history: IAttestationHistory, options: Partial<AttestationOptions> = {}) {
+    this.store = store;
+    this.history = history;
+    this.options = { ...DEFAULT_OPTIONS, ...options };
+  }
+
+  /**
+   * Extend the chain from the latest attestation and attest the new head
+   * Only entries older than the settle window are folded.
+   *
+   * @returns The chain head after the last settled entry
+   */
+  async attest(): Promise<ChainHead> {
+    const latest = await this.history.latest();
+    const head: ChainHead = latest
+      ? {
+          sequence: latest.sequence,
+          chainHash: latest.chainHash,
+          position: latest.position,
+          counts: { ...latest.counts },
+          sums: { ...latest.sums },
+        }
+      : genesisHead();
+    let attestedSequence = head.sequence;
+    const settledBy = Date.now() - this.options.settleMs;
+
+    scan: for (;;) {
+      const page = await this.store.scanEntries(head.position, this.options.pageSize);
+
+      for (const entry of page) {
+        if (new Date(entry.timestamp).getTime() > settledBy) {
+          break scan;
+        }
+        advance(head, entry);
+        if (head.sequence % this.options.checkpointEvery === 0) {
+          await this.record(head);
+          attestedSequence = head.sequence;
+        }
+      }
+
+      if (page.length < this.options.pageSize) {
+        break;
+      }
+    }
+
+    if (head.sequence > attestedSequence) {
+      await this.record(head);
+    }
+
+    return head;
+  }
+
+  private async record(head: ChainHead): Promise<void> {
+    await this.history.record({
+      sequence: head.sequence,
+      chainHash: head.chainHash,
+      position: head.position!,
+      counts: { ...head.counts },
+      sums: { ...head.sums },
+      takenAt: new Date(),
+    });
+  }
+}
+
+/**
+ * Verify that a restored store is a true prefix of the live ledger
+ *
+ * @param restored Store of the restored environment
+ * @param history Attestations of the live ledger
+ * @param liveHead Current head of the live chain
+ */
+export async function verifyPrefix(
+  restored: IEntryScanStore,
+  history: IAttestationHistory,
+  liveHead: Pick<ChainHead, 'sequence' | 'chainHash'>,
+  options: Partial<AttestationOptions> = {}
+): Promise<PrefixReport> {
+  const { pageSize } = { ...DEFAULT_OPTIONS, ...options };
+  const attestations = await history.list();
+  const head = genesisHead();
+  let matched: LedgerAttestation | null = null;
+  let next = 0;
+
+  const report = (
+    status: PrefixReport['status'],
+    message: string,
+    divergence?: PrefixReport['divergence']
+  ): PrefixReport => ({ status, restoredHead: head, matched, divergence, message });
+
+  const check = (attestation: LedgerAttestation): PrefixReport['divergence'] | undefined => {
+    if (head.chainHash !== attestation.chainHash) {
+      return { sequence: head.sequence, field: 'chainHash', expected: attestation.chainHash, actual: head.chainHash };
+    }
+    if (!sameStats(head.counts, attestation.counts)) {
+      return { sequence: head.sequence, field: 'counts', expected: attestation.counts, actual: { ...head.counts } };
+    }
+    if (!sameStats(head.sums, attestation.sums)) {
+      return { sequence: head.sequence, field: 'sums', expected: attestation.sums, actual: { ...head.sums } };
+    }
+    return undefined;
+  };
+
+  for (;;) {
+    const page = await restored.scanEntries(head.position, pageSize);
+
+    for (const entry of page) {
+      advance(head, entry);
+
+      while (next < attestations.length && attestations[next].sequence < head.sequence) {
+        next++;
+      }
+      if (next < attestations.length && attestations[next].sequence === head.sequence) {
+        const divergence = check(attestations[next]);
+        if (divergence) {
+          return report('diverged', `Restore diverges from the attestation at sequence ${head.sequence} (${divergence.field})`, divergence);
+        }
+        matched = attestations[next];
+      }
+    }
+
+    if (page.length < pageSize) {
+      break;
+    }
+  }
+
+  if (head.sequence > liveHead.sequence) {
+    return report('diverged', `Restore has ${head.sequence} entries; the live chain has ${liveHead.sequence}`, {
+      sequence: head.sequence,
+      field: 'length',
+      expected: liveHead.sequence,
+      actual: head.sequence,
+    });
+  }
+  if (head.sequence === liveHead.sequence && head.chainHash !== liveHead.chainHash) {
+    return report('diverged', `Restore diverges from the live head at sequence ${head.sequence}`, {
+      sequence: head.sequence,
+      field: 'chainHash',
+      expected: liveHead.chainHash,
+      actual: head.chainHash,
+    });
+  }
+
+  const anchored = (matched && matched.sequence === head.sequence) || head.sequence === liveHead.sequence;
+  if (!anchored) {
+    return report(
+      'unanchored',
+      matched
+        ? `No attestation at sequence ${head.sequence}; verified through sequence ${matched.sequence}`
+        : `No attestation at or below sequence ${head.sequence}`
+    );
+  }
+
+  return report('verified', `Restore matches the live chain at sequence ${head.sequence}`);
+}
+
+/**
+ * Whether a chain hash is the head of the ledger as it stands now
+ * The chain is recomputed from genesis, so a stale hash (the head of an
+ * earlier prefix) or a forged one does not match.
+ *
+ * @throws Error if the hash is not 64 hex characters
+ */
+export async function verifyChainHash(
+  store: IEntryScanStore,
+  chainHash: string,
+  options: Partial<AttestationOptions> = {}
+): Promise<boolean> {
+  if (!/^[0-9a-f]{64}$/i.test(chainHash)) {
+    throw new Error('Chain hash must be 64 hex characters');
+  }
+
+  const { pageSize } = { ...DEFAULT_OPTIONS, ...options };
+  const head = genesisHead();
+  for (;;) {
+    const page = await store.scanEntries(head.position, pageSize);
+    page.forEach(entry => advance(head, entry));
+    if (page.length < pageSize) {
+      break;
+    }
+  }
+
+  return timingSafeEqual(Buffer.from(head.chainHash, 'hex'), Buffer.from(chainHash, 'hex'));
+}
+
+/**
+ * Attestation history in the ledger_attestations collection
+ */
+export class MongoAttestationHistory implements IAttestationHistory {
+  private model: Model<ILedgerAttestation>;
+
+  constructor(model: Model<ILedgerAttestation> = LedgerAttestationModel) {
+    this.model = model;
+  }
+
+  async latest(): Promise<LedgerAttestation | null> {
+    const doc = await this.model.findOne({}).sort({ sequence: -1 }).lean().exec();
+    return doc ? toAttestation(doc) : null;
+  }
+
+  async list(): Promise<LedgerAttestation[]> {
+    const docs = await this.model.find({}).sort({ sequence: 1 }).lean().exec();
+    return docs.map(toAttestation);
+  }
+
+  async record(attestation: LedgerAttestation): Promise<void> {
+    try {
+      await this.model.create(attestation);
+    } catch (error: any) {
+      // A concurrent attestor recorded the same sequence
+      if (error.code !== 11000) {
+        throw error;
+      }
+    }
+  }
+}
+
+function toAttestation(doc: any): LedgerAttestation {
+  const attestation = { ...doc };
+  delete attestation._id;
+  delete attestation.__v;
+  return attestation;
+}
@@ -0,0 +1,145 @@
+/**
+ * Attribution Report Tests
+ */
+
+import {
+  generateAttributionReport,
+  renderAttributionCsv,
+  ATTRIBUTION_NONE,
+} from './attribution';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+import { InvalidTimeRangeError } from '../services/types';
+
+describe('generateAttributionReport', () => {
+  const from = new Date('2024-06-01T00:00:00Z');
+  const to = new Date('2024-06-30T23:59:59Z');
+
+  const ledgerOf = (entries: Partial<LedgerEntry>[]): jest.Mocked<ILedgerService> => ({
+    createEntry: jest.fn(),
+    queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+      const offset = filter.offset || 0;
+      const limit = filter.limit || 100;
+      return {
+        entries: entries.slice(offset, offset + limit),
+        totalCount: entries.length,
+        offset,
+        limit,
+        hasMore: offset + limit < entries.length,
+      };
+    }),
+    getEntry: jest.fn(),
+    getBalanceSnapshot: jest.fn(),
+    generateReconciliationReport: jest.fn(),
+    getAuditTrail: jest.fn(),
+    checkIdempotency: jest.fn(),
+    storeIdempotencyResult: jest.fn(),
+  } as any);
+
+  const credit = (amount: number, fields: Partial<LedgerEntry> = {}): Partial<LedgerEntry> => ({
+    accountId: 'user-1',
+    amount,
+    type: 'credit' as any,
+    ...fields,
+  });
+
+  const entries = [
+    credit(500, { correlationId: 'summer24-a', metadata: { campaign: 'summer', channel: 'email' } }),
+    credit(300, { correlationId: 'summer24-b', metadata: { campaign: 'summer' } }),
+    credit(700, { correlationId: 'referral-x', metadata: { campaign: 'referral', channel: 'app' } }),
+    credit(100, { correlationId: 'promo-1', metadata: { campaign: 42 } }),
+    credit(50, { metadata: { campaign: { nested: true } } }),
+    credit(25),
+  ];
+
+  it('should group by reference prefix and sort by total descending', async () => {
+    const report = await generateAttributionReport(ledgerOf(entries), from, to, {
+      groupBy: { by: 'referencePrefix' },
+    });
+
+    expect(report.groups).toEqual([
+      { key: 'summer24', count: 2, total: 800 },
+      { key: 'referral', count: 1, total: 700 },
+      { key: 'promo', count: 1, total: 100 },
+      { key: ATTRIBUTION_NONE, count: 2, total: 75 },
+    ]);
+    expect(report.other).toBeNull();
+    expect(report.totalCount).toBe(6);
+    expect(report.totalPoints).toBe(1675);
+  });
+
+  it('should bucket entries missing a metadata key as (none)', async () => {
+    const report = await generateAttributionReport(ledgerOf(entries), from, to, {
+      groupBy: { by: 'metadata', key: 'channel' },
+    });
+
+    expect(report.groups).toEqual([
+      { key: 'app', count: 1, total: 700 },
+      { key: 'email', count: 1, total: 500 },
+      { key: ATTRIBUTION_NONE, count: 4, total: 475 },
+    ]);
+  });
+
+  it('should only treat string and number values as tags', async () => {
+    const report = await generateAttributionReport(ledgerOf(entries), from, to, {
+      groupBy: { by: 'tag', key: 'campaign' },
+    });
+
+    expect(report.groups.map(g => g.key)).toEqual(['summer', 'referral', '42', ATTRIBUTION_NONE]);
+    expect(report.groups[3]).toEqual({ key: ATTRIBUTION_NONE, count: 2, total: 75 });
+  });
+
+  it('should fold groups past the top-N cutoff into an other bucket', async () => {
+    const report = await generateAttributionReport(ledgerOf(entries), from, to, {
+      groupBy: { by: 'referencePrefix' },
+      topN: 2,
+    });
+
+    expect(report.groups.map(g => g.key)).toEqual(['summer24', 'referral']);
+    expect(report.other).toEqual({ key: '(other)', groupCount: 2, count: 3, total: 175 });
+    expect(report.totalPoints).toBe(1675);
+  });
+
+  it('should stream user credits in the period page by page', async () => {
+    const many = Array.from({ length: 2500 }, (_, i) => credit(1, { correlationId: `c${i % 3}-x` }));
+    const ledger = ledgerOf(many);
+
+    const report = await generateAttributionReport(ledger, from, to, { groupBy: { by: 'referencePrefix' } });
+
+    expect(report.totalCount).toBe(2500);
+    expect(ledger.queryEntries).toHaveBeenCalledTimes(3);
+    expect(ledger.queryEntries).toHaveBeenCalledWith(
+      expect.objectContaining({
+        accountType: 'user',
+        balanceState: 'available',
+        type: 'credit',
+        startDate: from,
+        endDate: to,
+        limit: 1000,
+      })
+    );
+  });
+
+  it('should reject a period where from is after to', async () => {
+    await expect(
+      generateAttributionReport(ledgerOf([]), to, from, { groupBy: { by: 'referencePrefix' } })
+    ).rejects.toThrow(InvalidTimeRangeError);
+  });
+
+  it('should render CSV with the other bucket last', async () => {
+    const report = await generateAttributionReport(
+      ledgerOf([...entries, credit(10, { correlationId: 'winter24-1' })]),
+      from,
+      to,
+      { groupBy: { by: 'referencePrefix' }, topN: 4 }
+    );
+
+    expect(renderAttributionCsv(report)).toBe(
+      'group,count,total\n' +
+        'summer24,2,800\n' +
+        'referral,1,700\n' +
+        'promo,1,100\n' +
+        '(none),2,75\n' +
+        '(other),1,10\n'
+    );
+  });
+});
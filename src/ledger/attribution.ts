@@ -0,0 +1,206 @@
+/**
+ * Attribution Report
+ *
+ * Answers "which references or campaigns drove the most points" over a
+ * period. Streams user available-balance credits in [from, to] page by
+ * page and groups them by one of:
+ *
+ *   - referencePrefix: the correlationId up to the first separator
+ *     ("summer24-user-1" -> "summer24")
+ *   - tag: a string or number metadata value, as used for indexed tags
+ *   - metadata: any metadata value, objects rendered as JSON
+ *
+ * Entries without a value for the grouping key are bucketed as "(none)".
+ * Groups are sorted by total points descending; past the top-N cutoff the
+ * remainder is folded into a single "(other)" bucket.
+ */
+
+import { ILedgerService, LedgerEntry } from './types';
+import { TransactionType } from '../wallets/types';
+import { InvalidTimeRangeError } from '../services/types';
+
+/**
+ * How entries are grouped
+ */
+export type AttributionGroupKey =
+  | { by: 'referencePrefix'; separator?: string }
+  | { by: 'tag'; key: string }
+  | { by: 'metadata'; key: string };
+
+/**
+ * Bucket for entries without a value for the grouping key
+ */
+export const ATTRIBUTION_NONE = '(none)';
+
+/**
+ * Bucket for groups past the top-N cutoff
+ */
+export const ATTRIBUTION_OTHER = '(other)';
+
+/**
+ * Options for an attribution report
+ */
+export interface AttributionOptions {
+  groupBy: AttributionGroupKey;
+
+  /** Groups to report individually before folding the rest (default 10) */
+  topN?: number;
+}
+
+/**
+ * Points credited to one group
+ */
+export interface AttributionGroup {
+  key: string;
+
+  /** Number of credit entries */
+  count: number;
+
+  /** Sum of credited points */
+  total: number;
+}
+
+/**
+ * Attribution report
+ */
+export interface AttributionReport {
+  /** Period start (inclusive) */
+  from: Date;
+
+  /** Period end (inclusive) */
+  to: Date;
+
+  groupBy: AttributionGroupKey;
+
+  /** Top groups by total, descending */
+  groups: AttributionGroup[];
+
+  /** Remaining groups folded together, or null when nothing was cut */
+  other: (AttributionGroup & { groupCount: number }) | null;
+
+  /** Totals across all groups */
+  totalCount: number;
+  totalPoints: number;
+}
+
+/**
+ * Page size used when streaming the ledger
+ */
+const PAGE_SIZE = 1000;
+
+/**
+ * Group points credited in a period by reference prefix, tag or metadata key
+ *
+ * @throws InvalidTimeRangeError if from is after to
+ */
+export async function generateAttributionReport(
+  ledgerService: ILedgerService,
+  from: Date,
+  to: Date,
+  options: AttributionOptions
+): Promise<AttributionReport> {
+  if (from.getTime() > to.getTime()) {
+    throw new InvalidTimeRangeError(from, to);
+  }
+
+  const topN = options.topN ?? 10;
+  const buckets = new Map<string, AttributionGroup>();
+
+  let offset = 0;
+  let hasMore = true;
+
+  while (hasMore) {
+    const result = await ledgerService.queryEntries({
+      accountType: 'user',
+      balanceState: 'available',
+      type: TransactionType.CREDIT,
+      startDate: from,
+      endDate: to,
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset,
+      limit: PAGE_SIZE,
+    });
+
+    for (const entry of result.entries) {
+      const key = groupKeyOf(entry, options.groupBy);
+      let bucket = buckets.get(key);
+      if (!bucket) {
+        bucket = { key, count: 0, total: 0 };
+        buckets.set(key, bucket);
+      }
+      bucket.count++;
+      bucket.total += entry.amount;
+    }
+
+    offset += result.entries.length;
+    hasMore = result.hasMore && result.entries.length > 0;
+  }
+
+  const sorted = [...buckets.values()].sort(
+    (a, b) => b.total - a.total || b.count - a.count || a.key.localeCompare(b.key)
+  );
+  const groups = sorted.slice(0, topN);
+  const rest = sorted.slice(topN);
+
+  return {
+    from,
+    to,
+    groupBy: options.groupBy,
+    groups,
+    other: rest.length === 0
+      ? null
+      : {
+          key: ATTRIBUTION_OTHER,
+          groupCount: rest.length,
+          count: rest.reduce((sum, g) => sum + g.count, 0),
+          total: rest.reduce((sum, g) => sum + g.total, 0),
+        },
+    totalCount: sorted.reduce((sum, g) => sum + g.count, 0),
+    totalPoints: sorted.reduce((sum, g) => sum + g.total, 0),
+  };
+}
+
+/**
+ * Render an attribution report as CSV (group,count,total)
+ * The "(other)" bucket, when present, is the last row.
+ */
+export function renderAttributionCsv(report: AttributionReport): string {
+  const rows = report.groups.map(g => [g.key, g.count, g.total]);
+  if (report.other) {
+    rows.push([report.other.key, report.other.count, report.other.total]);
+  }
+
+  return ['group,count,total', ...rows.map(row => row.map(csvCell).join(','))].join('\n') + '\n';
+}
+
+/**
+ * Resolve the group an entry belongs to
+ */
+function groupKeyOf(entry: LedgerEntry, groupBy: AttributionGroupKey): string {
+  if (groupBy.by === 'referencePrefix') {
+    if (!entry.correlationId) {
+      return ATTRIBUTION_NONE;
+    }
+    return entry.correlationId.split(groupBy.separator ?? '-')[0] || ATTRIBUTION_NONE;
+  }
+
+  const value = entry.metadata ? entry.metadata[groupBy.key] : undefined;
+
+  if (groupBy.by === 'tag') {
+    return typeof value === 'string' || typeof value === 'number' ? String(value) : ATTRIBUTION_NONE;
+  }
+
+  if (value === undefined || value === null) {
+    return ATTRIBUTION_NONE;
+  }
+  return typeof value === 'object' ? JSON.stringify(value) : String(value);
+}
+
+/**
+ * Format a value as an RFC 4180 CSV cell
+ */
+function csvCell(value: string | number): string {
+  const text = String(value);
+  return /[",\r\n]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+}
@@ -0,0 +1,192 @@
+/**
+ * Full-Ledger Balance Recomputation Tests
+ */
+
+import { computeAllBalances, listLedgerUsers } from './balance-audit';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType } from '../wallets/types';
+import { LedgerInconsistencyError } from '../services/types';
+
+jest.mock('../db/models/ledger-entry.model');
+
+describe('computeAllBalances', () => {
+  let inFlight: number;
+  let peakInFlight: number;
+
+  const ledgerOf = (entries: Partial<LedgerEntry>[], latencyMs = 0): jest.Mocked<ILedgerService> => ({
+    createEntry: jest.fn(),
+    queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+      inFlight++;
+      peakInFlight = Math.max(peakInFlight, inFlight);
+      if (latencyMs > 0) {
+        await new Promise(resolve => setTimeout(resolve, latencyMs));
+      }
+      inFlight--;
+
+      const matching = entries.filter(
+        e => e.accountId === filter.accountId && (!filter.endDate || e.timestamp! <= filter.endDate)
+      );
+      const offset = filter.offset || 0;
+      const limit = filter.limit || 100;
+      return {
+        entries: matching.slice(offset, offset + limit),
+        totalCount: matching.length,
+        offset,
+        limit,
+        hasMore: offset + limit < matching.length,
+      };
+    }),
+    getEntry: jest.fn(),
+    getBalanceSnapshot: jest.fn(),
+    generateReconciliationReport: jest.fn(),
+    getAuditTrail: jest.fn(),
+    checkIdempotency: jest.fn(),
+    storeIdempotencyResult: jest.fn(),
+  } as any);
+
+  // Deterministic pseudo-random ledger for many users
+  const generateEntries = (users: number, entriesPerUser: number): Partial<LedgerEntry>[] => {
+    const entries: Partial<LedgerEntry>[] = [];
+    let seed = 42;
+    const next = () => (seed = (seed * 1103515245 + 12345) % 2147483648);
+
+    for (let u = 0; u < users; u++) {
+      let balance = u % 7 === 0 ? 500 : 0;
+      for (let i = 0; i < entriesPerUser; i++) {
+        const credit = balance === 0 || next() % 3 !== 0;
+        const amount = credit ? (next() % 1000) + 1 : Math.min(balance, (next() % 500) + 1);
+        entries.push({
+          entryId: `u${u}-e${i}`,
+          accountId: `user-${String(u).padStart(4, '0')}`,
+          amount: credit ? amount : -amount,
+          type: credit ? TransactionType.CREDIT : TransactionType.DEBIT,
+          balanceBefore: balance,
+          balanceAfter: balance + (credit ? amount : -amount),
+          timestamp: new Date(Date.UTC(2024, 0, 1) + i * 60000),
+        });
+        balance += credit ? amount : -amount;
+      }
+    }
+    return entries;
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    inFlight = 0;
+    peakInFlight = 0;
+  });
+
+  it('should produce the same balances in parallel as sequentially', async () => {
+    const entries = generateEntries(200, 12);
+    const closing = new Map<string, number>();
+    for (const entry of entries) {
+      closing.set(entry.accountId!, entry.balanceAfter!);
+    }
+    const userIds = [...closing.keys()].reverse();
+    const ledger = ledgerOf(entries);
+
+    const sequential = await computeAllBalances(ledger, 1, { userIds });
+    const parallel = await computeAllBalances(ledger, 16, { userIds });
+
+    expect([...parallel]).toEqual([...sequential]);
+    expect(sequential).toEqual(new Map([...closing].sort(([a], [b]) => (a < b ? -1 : 1))));
+  });
+
+  it('should page through users with more entries than one page', async () => {
+    const entries = Array.from({ length: 2500 }, (_, i) => ({
+      entryId: `e${i}`,
+      accountId: 'user-1',
+      amount: 2,
+      type: TransactionType.CREDIT,
+      balanceBefore: 2 * i,
+      balanceAfter: 2 * (i + 1),
+    }));
+
+    const balances = await computeAllBalances(ledgerOf(entries), 4, { userIds: ['user-1'] });
+
+    expect(balances.get('user-1')).toBe(5000);
+  });
+
+  it('should include the opening balance and respect asOf', async () => {
+    const entries = [
+      { entryId: 'e1', accountId: 'user-1', amount: 100, type: TransactionType.CREDIT, balanceBefore: 900, balanceAfter: 1000, timestamp: new Date('2024-01-01') },
+      { entryId: 'e2', accountId: 'user-1', amount: -400, type: TransactionType.DEBIT, balanceBefore: 1000, balanceAfter: 600, timestamp: new Date('2024-02-01') },
+    ];
+
+    const balances = await computeAllBalances(ledgerOf(entries), 2, {
+      userIds: ['user-1', 'user-2'],
+      asOf: new Date('2024-01-15'),
+    });
+
+    expect(balances).toEqual(new Map([['user-1', 1000], ['user-2', 0]]));
+  });
+
+  it('should fail rather than overflow the safe integer range', async () => {
+    const entries = [
+      { entryId: 'e1', accountId: 'user-1', amount: Number.MAX_SAFE_INTEGER, type: TransactionType.CREDIT, balanceBefore: 0, balanceAfter: 0 },
+      { entryId: 'e2', accountId: 'user-1', amount: Number.MAX_SAFE_INTEGER, type: TransactionType.CREDIT, balanceBefore: 0, balanceAfter: 0 },
+    ];
+
+    const error = await computeAllBalances(ledgerOf(entries), 2, { userIds: ['user-1'] }).catch(e => e);
+
+    expect(error).toBeInstanceOf(LedgerInconsistencyError);
+    expect(error.details).toEqual({ userId: 'user-1', balance: (2n * BigInt(Number.MAX_SAFE_INTEGER)).toString() });
+  });
+
+  it('should reject unsafe entry amounts', async () => {
+    const entries = [{ entryId: 'e1', accountId: 'user-1', amount: 1.5, type: TransactionType.CREDIT, balanceBefore: 0, balanceAfter: 0 }];
+
+    await expect(computeAllBalances(ledgerOf(entries), 1, { userIds: ['user-1'] })).rejects.toBeInstanceOf(
+      LedgerInconsistencyError
+    );
+  });
+
+  it('should reject an invalid concurrency', async () => {
+    await expect(computeAllBalances(ledgerOf([]), 0, { userIds: [] })).rejects.toThrow(
+      'concurrency must be a positive integer'
+    );
+  });
+
+  it('should compute every ledger user when no user IDs are given', async () => {
+    (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({
+      exec: jest.fn().mockResolvedValue(['user-2', 'user-1']),
+    });
+
+    const balances = await computeAllBalances(ledgerOf([]), 4);
+
+    expect([...balances.keys()]).toEqual(['user-1', 'user-2']);
+    expect(LedgerEntryModel.distinct).toHaveBeenCalledWith('accountId', {
+      accountType: { $eq: 'user' },
+      balanceState: { $eq: 'available' },
+    });
+    await expect(listLedgerUsers()).resolves.toEqual(['user-2', 'user-1']);
+  });
+
+  describe('benchmark', () => {
+    // Simulates a fixed per-query round trip to the database
+    const LATENCY_MS = 5;
+    const USERS = 64;
+
+    it('should keep concurrency queries in flight and finish proportionally faster', async () => {
+      const entries = generateEntries(USERS, 3);
+      const userIds = Array.from({ length: USERS }, (_, u) => `user-${String(u).padStart(4, '0')}`);
+
+      const time = async (concurrency: number) => {
+        peakInFlight = 0;
+        const started = process.hrtime.bigint();
+        const balances = await computeAllBalances(ledgerOf(entries, LATENCY_MS), concurrency, { userIds });
+        return { balances, ms: Number(process.hrtime.bigint() - started) / 1e6, peak: peakInFlight };
+      };
+
+      const sequential = await time(1);
+      const parallel = await time(16);
+
+      expect(sequential.peak).toBe(1);
+      expect(parallel.peak).toBe(16);
+      expect(parallel.balances).toEqual(sequential.balances);
+      // 64 round trips against 4; allow generous slack for timer jitter
+      expect(parallel.ms * 4).toBeLessThan(sequential.ms);
+    });
+  });
+});
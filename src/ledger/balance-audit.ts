@@ -0,0 +1,143 @@
+/**
+ * Full-Ledger Balance Recomputation
+ *
+ * Recomputes every user's available balance from their ledger entries
+ * for the periodic full-ledger audit. A user's balance is the balance
+ * before their first entry plus the sum of their credits minus their
+ * debits, as in the trial balance.
+ *
+ * Users are partitioned across a fixed number of workers, each paging
+ * through its own users' entries; the per-user results are merged once
+ * every worker has finished. Queries are I/O bound, so the speedup comes
+ * from keeping several queries in flight. The result does not depend on
+ * the concurrency: each user is computed by exactly one worker, and the
+ * merged map is ordered by user ID.
+ *
+ * Sums are accumulated as bigint. A balance outside the safe integer
+ * range fails the whole computation rather than losing precision.
+ */
+
+import { ILedgerService, LedgerEntry } from './types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType } from '../wallets/types';
+import { LedgerInconsistencyError } from '../services/types';
+
+/**
+ * Options for a full-ledger recomputation
+ */
+export interface ComputeAllBalancesOptions {
+  /** Users to compute (every user with ledger entries when unset) */
+  userIds?: string[];
+
+  /** Only count entries up to this point in time (inclusive) */
+  asOf?: Date;
+}
+
+/**
+ * Page size used when reading a user's entries
+ */
+const PAGE_SIZE = 1000;
+
+/**
+ * Recompute every user's available balance from the ledger
+ *
+ * @param concurrency Number of workers reading the ledger in parallel
+ * @returns Balances keyed by user ID, in user ID order
+ * @throws LedgerInconsistencyError if an amount or balance is not a safe integer
+ */
+export async function computeAllBalances(
+  ledgerService: ILedgerService,
+  concurrency: number,
+  options: ComputeAllBalancesOptions = {}
+): Promise<Map<string, number>> {
+  if (!Number.isInteger(concurrency) || concurrency < 1) {
+    throw new Error('concurrency must be a positive integer');
+  }
+
+  const userIds = [...new Set(options.userIds || (await listLedgerUsers()))].sort(compareIds);
+
+  // Round-robin keeps partitions even when user activity is clustered by ID
+  const partitions: string[][] = Array.from({ length: Math.min(concurrency, userIds.length) }, () => []);
+  userIds.forEach((userId, index) => partitions[index % partitions.length].push(userId));
+
+  const results = await Promise.all(
+    partitions.map(async partition => {
+      const balances = new Map<string, number>();
+      for (const userId of partition) {
+        balances.set(userId, await computeBalance(ledgerService, userId, options.asOf));
+      }
+      return balances;
+    })
+  );
+
+  const computed = new Map(results.flatMap(balances => [...balances]));
+  return new Map(userIds.map(userId => [userId, computed.get(userId)!]));
+}
+
+/**
+ * IDs of every user with available-balance entries
+ */
+export async function listLedgerUsers(): Promise<string[]> {
+  return LedgerEntryModel.distinct('accountId', {
+    accountType: { $eq: 'user' },
+    balanceState: { $eq: 'available' },
+  }).exec();
+}
+
+/**
+ * Recompute one user's available balance
+ */
+async function computeBalance(ledgerService: ILedgerService, userId: string, asOf?: Date): Promise<number> {
+  let balance: bigint | undefined;
+  let offset = 0;
+  let hasMore = true;
+
+  while (hasMore) {
+    const result = await ledgerService.queryEntries({
+      accountId: userId,
+      accountType: 'user',
+      balanceState: 'available',
+      endDate: asOf,
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset,
+      limit: PAGE_SIZE,
+    });
+
+    for (const entry of result.entries) {
+      if (balance === undefined) {
+        balance = toBigInt(entry.balanceBefore, entry);
+      }
+      const amount = toBigInt(entry.amount, entry);
+      const magnitude = amount < 0n ? -amount : amount;
+      balance += entry.type === TransactionType.CREDIT ? magnitude : -magnitude;
+    }
+
+    offset += result.entries.length;
+    hasMore = result.hasMore && result.entries.length > 0;
+  }
+
+  const total = balance ?? 0n;
+  if (total > BigInt(Number.MAX_SAFE_INTEGER) || total < BigInt(Number.MIN_SAFE_INTEGER)) {
+    throw new LedgerInconsistencyError(
+      `Balance for user ${userId} exceeds the safe integer range`,
+      { userId, balance: total.toString() }
+    );
+  }
+
+  return Number(total);
+}
+
+function toBigInt(value: number, entry: LedgerEntry): bigint {
+  if (!Number.isSafeInteger(value)) {
+    throw new LedgerInconsistencyError(
+      `Entry ${entry.entryId} has a non-integer or unsafe amount`,
+      { entryId: entry.entryId, value }
+    );
+  }
+  return BigInt(value);
+}
+
+function compareIds(a: string, b: string): number {
+  return a < b ? -1 : a > b ? 1 : 0;
+}
@@ -0,0 +1,195 @@
+/**
+ * Ledger Batch Builder Tests
+ */
+
+import { LedgerBatchBuilder } from './batch-builder';
+import { InMemoryLedgerService } from './testing/in-memory-ledger.service';
+import { CreateLedgerEntryRequest } from './types';
+import { AppendErrorCode, DuplicateBatchEntryError } from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+describe('LedgerBatchBuilder', () => {
+  const credit = (key: string, accountId = 'user-1'): CreateLedgerEntryRequest => ({
+    accountId,
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PURCHASE_EARN,
+    idempotencyKey: key,
+    requestId: `req-${key}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+  });
+
+  it('should commit every added entry in order under the batch transaction', async () => {
+    const ledger = new InMemoryLedgerService();
+    const batch = new LedgerBatchBuilder('etl-1');
+
+    batch.add(credit('row-1')).add(credit('row-2', 'user-2'));
+    batch.add({ ...credit('row-3'), transactionId: 'txn-own' });
+    expect(batch.size).toBe(3);
+    expect(ledger.size).toBe(0);
+
+    const result = await batch.commit(ledger);
+
+    expect(result).toMatchObject({ batchId: 'etl-1', transactionId: 'batch-etl-1', inserted: 3, replayed: 0 });
+    expect(result.entries.map(e => [e.idempotencyKey, e.transactionId])).toEqual([
+      ['row-1', 'batch-etl-1'],
+      ['row-2', 'batch-etl-1'],
+      ['row-3', 'txn-own'],
+    ]);
+    expect(ledger.size).toBe(3);
+  });
+
+  it('should reject an in-batch duplicate at add, naming the key', async () => {
+    const ledger = new InMemoryLedgerService();
+    const batch = new LedgerBatchBuilder('etl-1');
+    batch.add(credit('row-1')).add(credit('row-2'));
+
+    const error = (() => {
+      try {
+        batch.add(credit('row-1', 'user-2'));
+      } catch (e) {
+        return e as DuplicateBatchEntryError;
+      }
+    })();
+
+    expect(error).toBeInstanceOf(DuplicateBatchEntryError);
+    expect(error?.message).toContain('row-1');
+    expect(error?.details).toEqual({ batchId: 'etl-1', idempotencyKey: 'row-1', index: 2, firstIndex: 0 });
+    expect(batch.size).toBe(2);
+    expect(ledger.size).toBe(0);
+    // The same key in another scope is a different entry
+    expect(() => batch.add({ ...credit('row-1'), idempotencyScope: 'import' })).not.toThrow();
+  });
+
+  it('should reject invalid fields at add', () => {
+    const batch = new LedgerBatchBuilder();
+
+    expect(() => batch.add({ ...credit('row-1'), amount: -100 })).toThrow(
+      expect.objectContaining({ appendCode: AppendErrorCode.INVALID })
+    );
+    expect(batch.size).toBe(0);
+  });
+
+  it('should complete an interrupted commit when committed again', async () => {
+    const ledger = new InMemoryLedgerService();
+    const batch = new LedgerBatchBuilder('etl-1').add(credit('row-1')).add(credit('row-2')).add(credit('row-3'));
+    const flaky = {
+      createEntryWithResult: jest
+        .fn()
+        .mockImplementationOnce(request => ledger.createEntryWithResult(request))
+        .mockRejectedValueOnce(new Error('connection reset'))
+        .mockImplementation(request => ledger.createEntryWithResult(request)),
+    };
+
+    await expect(batch.commit(flaky)).rejects.toThrow('connection reset');
+    expect(ledger.size).toBe(1);
+
+    const result = await batch.commit(flaky);
+
+    expect(result).toMatchObject({ inserted: 2, replayed: 1 });
+    expect(result.entries.map(e => e.idempotencyKey)).toEqual(['row-1', 'row-2', 'row-3']);
+    expect(ledger.size).toBe(3);
+  });
+
+  it('should keep concurrent commits contiguous in (timestamp, entryId) order', async () => {
+    const ledger = new InMemoryLedgerService();
+    const batch = (batchId: string) => {
+      const builder = new LedgerBatchBuilder(batchId);
+      for (let row = 0; row < 12; row++) {
+        builder.add(credit(`${batchId}-row-${row}`, `user-${row}`));
+      }
+      return builder;
+    };
+
+    await Promise.all([batch('etl-1').commit(ledger), batch('etl-2').commit(ledger)]);
+
+    const { entries } = await ledger.queryEntries({ sortOrder: 'asc', limit: 100 });
+    const keys = entries.map(e => e.idempotencyKey);
+    const rows = (batchId: string) => Array.from({ length: 12 }, (_, row) => `${batchId}-row-${row}`);
+    expect([[...rows('etl-1'), ...rows('etl-2')], [...rows('etl-2'), ...rows('etl-1')]]).toContainEqual(keys);
+  });
+
+  describe('afterBatchAppend', () => {
+    beforeEach(() => {
+      jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    });
+
+    afterEach(() => {
+      jest.restoreAllMocks();
+    });
+
+    it('should notify each hook once with exactly the committed batch', async () => {
+      const ledger = new InMemoryLedgerService();
+      const batch = new LedgerBatchBuilder('etl-1').add(credit('row-1')).add(credit('row-2', 'user-2'));
+      const afterBatchAppend = jest.fn();
+      const afterAppend = jest.fn();
+
+      const result = await batch.commit(ledger, [{ name: 'event-bus', afterBatchAppend, afterAppend }]);
+
+      expect(afterBatchAppend).toHaveBeenCalledTimes(1);
+      expect(afterBatchAppend).toHaveBeenCalledWith(result.entries);
+      expect(afterAppend).not.toHaveBeenCalled();
+    });
+
+    it('should pass copies the hook cannot alter the result through', async () => {
+      const ledger = new InMemoryLedgerService();
+      const batch = new LedgerBatchBuilder('etl-1').add(credit('row-1'));
+
+      const result = await batch.commit(ledger, [
+        {
+          name: 'mutating',
+          afterBatchAppend(entries) {
+            entries[0].amount = 999;
+          },
+        },
+      ]);
+
+      expect(result.entries[0].amount).toBe(100);
+    });
+
+    it('should not notify when the commit fails', async () => {
+      const ledger = new InMemoryLedgerService();
+      const batch = new LedgerBatchBuilder('etl-1').add(credit('row-1')).add(credit('row-2'));
+      const failing = {
+        createEntryWithResult: jest
+          .fn()
+          .mockImplementationOnce(request => ledger.createEntryWithResult(request))
+          .mockRejectedValueOnce(new Error('connection reset')),
+      };
+      const afterBatchAppend = jest.fn();
+
+      await expect(batch.commit(failing, [{ name: 'event-bus', afterBatchAppend }])).rejects.toThrow(
+        'connection reset'
+      );
+      expect(afterBatchAppend).not.toHaveBeenCalled();
+    });
+
+    it('should report and swallow a failing hook', async () => {
+      const ledger = new InMemoryLedgerService();
+      const batch = new LedgerBatchBuilder('etl-1').add(credit('row-1'));
+      const next = jest.fn();
+
+      const result = await batch.commit(ledger, [
+        {
+          name: 'broken',
+          afterBatchAppend() {
+            throw new Error('bus down');
+          },
+        },
+        { name: 'event-bus', afterBatchAppend: next },
+      ]);
+
+      expect(result.inserted).toBe(1);
+      expect(next).toHaveBeenCalledTimes(1);
+      expect(MetricsLogger.incrementCounter).toHaveBeenCalledWith(
+        MetricEventType.LEDGER_HOOK_ERROR,
+        expect.objectContaining({ hook: 'broken', phase: 'afterBatchAppend', batchId: 'etl-1' })
+      );
+    });
+  });
+});
@@ -0,0 +1,171 @@
+/**
+ * Ledger Batch Builder
+ *
+ * Assembles a large ingest one entry at a time and appends it in one
+ * commit, so a multi-step job (e.g. an ETL run) checks each entry as it
+ * is produced instead of building and validating one giant array at the
+ * end. add() rejects an entry whose fields are invalid or whose
+ * idempotency key (within its scope) is already in the batch, naming the
+ * offending key, so the step that produced it is the one that fails.
+ *
+ * commit() appends the entries in the order they were added. Every entry
+ * without its own transaction ID is recorded under the batch's
+ * transaction ID, so the batch's audit trail shows what it wrote. Every
+ * entry without its own timestamp and entry ID shares one timestamp
+ * stamped by the commit, and takes an entry ID of one commit-wide prefix
+ * and its zero-padded position, so a commit's entries stay contiguous in
+ * the ledger's (timestamp, entryId) order even when other commits run
+ * concurrently. The entries are not written in one transaction; as with
+ * batch re-credits, a commit is made whole by its idempotency keys: one
+ * interrupted part-way is completed by committing the same batch again,
+ * which replays the entries already written and appends only the rest
+ * under the retry's own timestamp and prefix.
+ *
+ * Hooks passed to commit() are notified once per successful commit
+ * through afterBatchAppend, with the whole batch, so a bulk ingest can
+ * publish one batch-level event instead of one per entry. A commit that
+ * fails notifies nothing; its retry notifies with the whole batch,
+ * including entries the failed attempt wrote. Hook failures are reported
+ * and swallowed, as with afterAppend, so they cannot fail a committed
+ * batch.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { CreateLedgerEntryRequest, LedgerAppendHook, LedgerEntry } from './types';
+import { LedgerService, runEntryIds } from './ledger.service';
+import { validateEntryFields } from './entry-validation';
+import { AppendErrorCode, DuplicateBatchEntryError, LedgerAppendError } from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+type BatchLedger = Pick<LedgerService, 'createEntryWithResult'>;
+
+/**
+ * Result of committing a batch
+ */
+export interface BatchCommitResult {
+  batchId: string;
+
+  /** Transaction ID recorded on entries that did not carry one */
+  transactionId: string;
+
+  /** Committed entries, in the order they were added */
+  entries: LedgerEntry[];
+
+  /** Entries appended by this commit */
+  inserted: number;
+
+  /** Entries already recorded, e.g. by an interrupted earlier commit */
+  replayed: number;
+}
+
+/**
+ * Builder for a batch of ledger entries committed together
+ */
+export class LedgerBatchBuilder {
+  readonly batchId: string;
+  readonly transactionId: string;
+
+  private entries: CreateLedgerEntryRequest[] = [];
+  private positions = new Map<string, number>();
+
+  constructor(batchId: string = uuidv4()) {
+    this.batchId = batchId;
+    this.transactionId = `batch-${batchId}`;
+  }
+
+  /**
+   * Number of entries added so far
+   */
+  get size(): number {
+    return this.entries.length;
+  }
+
+  /**
+   * Add an entry to the batch
+   *
+   * @throws LedgerAppendError (INVALID) if a field is invalid
+   * @throws DuplicateBatchEntryError if the batch already holds the entry's idempotency key
+   */
+  add(request: CreateLedgerEntryRequest): this {
+    const invalid = validateEntryFields(request);
+    if (invalid) {
+      throw new LedgerAppendError(AppendErrorCode.INVALID, request.idempotencyKey, new Error(invalid));
+    }
+
+    const key = batchKey(request);
+    const firstIndex = this.positions.get(key);
+    if (firstIndex !== undefined) {
+      throw new DuplicateBatchEntryError(this.batchId, request.idempotencyKey, this.entries.length, firstIndex);
+    }
+
+    this.positions.set(key, this.entries.length);
+    this.entries.push({ ...request });
+    return this;
+  }
+
+  /**
+   * Append every entry in the batch to a ledger, in the order added, then
+   * notify hooks' afterBatchAppend with the committed entries
+   *
+   * @throws The first append error; committing again resumes after the entries already written
+   */
+  async commit(ledger: BatchLedger, hooks: LedgerAppendHook[] = []): Promise<BatchCommitResult> {
+    const committed: LedgerEntry[] = [];
+    let inserted = 0;
+    const timestamp = new Date();
+    const entryIds = runEntryIds(uuidv4(), this.entries.length);
+
+    for (const [index, request] of this.entries.entries()) {
+      const result = await ledger.createEntryWithResult({
+        ...request,
+        transactionId: request.transactionId || this.transactionId,
+        entryId: request.entryId || entryIds[index],
+        timestamp: request.timestamp || timestamp,
+      });
+      committed.push(result.entry);
+      if (result.inserted) {
+        inserted++;
+      }
+    }
+
+    for (const hook of hooks) {
+      if (!hook.afterBatchAppend) {
+        continue;
+      }
+
+      try {
+        // Copies, so a hook cannot alter the result or another hook's view
+        await hook.afterBatchAppend(committed.map(entry => structuredClone(entry)));
+      } catch (error) {
+        MetricsLogger.incrementCounter(MetricEventType.LEDGER_HOOK_ERROR, {
+          hook: hook.name,
+          phase: 'afterBatchAppend',
+          batchId: this.batchId,
+          error: error instanceof Error ? error.message : 'Unknown error',
+        });
+      }
+    }
+
+    return {
+      batchId: this.batchId,
+      transactionId: this.transactionId,
+      entries: committed,
+      inserted,
+      replayed: committed.length - inserted,
+    };
+  }
+}
+
+/**
+ * Identity of an entry within a batch: its idempotency key in its scope
+ */
+function batchKey(request: CreateLedgerEntryRequest): string {
+  return JSON.stringify([request.idempotencyScope || null, request.idempotencyKey]);
+}
+
+/**
+ * Factory function to create a batch builder
+ */
+export function createBatchBuilder(batchId?: string): LedgerBatchBuilder {
+  return new LedgerBatchBuilder(batchId);
+}
@@ -0,0 +1,68 @@
+/**
+ * Ledger Entry Codec Registry Tests
+ */
+
+import { CodecRegistry, EntryCodec, createCodecRegistry, jsonEntryCodec, msgpackEntryCodec } from './codec';
+import { LedgerEntry } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('CodecRegistry', () => {
+  const entry: LedgerEntry = {
+    entryId: 'entry-1',
+    transactionId: 'txn-1',
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 500,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 500,
+    timestamp: new Date('2024-06-01T12:00:00.000Z'),
+    currency: 'points',
+    metadata: { campaign: 'summer' },
+  };
+
+  it('should register the built-in codecs', () => {
+    const registry = createCodecRegistry();
+
+    expect(registry.formats()).toEqual(['json', 'msgpack']);
+    expect(registry.get('msgpack').version).toBe(1);
+  });
+
+  it.each(['json', 'msgpack'])('should round-trip an entry through the %s codec', format => {
+    const codec = createCodecRegistry().get(format);
+
+    expect(codec.decode(codec.encode(entry))).toEqual(entry);
+  });
+
+  it('should auto-detect the format when decoding', () => {
+    const registry = createCodecRegistry();
+
+    expect(registry.detect(jsonEntryCodec.encode(entry))).toBe(jsonEntryCodec);
+    expect(registry.detect(msgpackEntryCodec.encode(entry))).toBe(msgpackEntryCodec);
+    expect(registry.decode(msgpackEntryCodec.encode(entry))).toEqual(entry);
+    expect(() => registry.decode(Buffer.from('entry-1,500'))).toThrow('Unable to detect entry format');
+  });
+
+  it('should apply the same validation in every built-in codec', () => {
+    const invalid = { ...entry, amount: -500 } as LedgerEntry;
+
+    for (const codec of [jsonEntryCodec, msgpackEntryCodec]) {
+      expect(() => codec.decode(codec.encode(invalid))).toThrow('Amount sign does not match');
+    }
+    expect(() => jsonEntryCodec.decode(Buffer.from('{"entryId":'))).toThrow('Malformed JSON entry');
+  });
+
+  it('should accept custom codecs and refuse duplicate formats', () => {
+    const custom: EntryCodec = { ...jsonEntryCodec, format: 'json-v2', version: 2, detect: undefined };
+    const registry = createCodecRegistry().register(custom);
+
+    expect(registry.get('json-v2')).toBe(custom);
+    expect(() => registry.register(jsonEntryCodec)).toThrow('Codec already registered for format: json');
+    expect(() => new CodecRegistry().get('json')).toThrow('No codec registered for format: json');
+  });
+});
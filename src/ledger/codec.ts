@@ -0,0 +1,165 @@
+/**
+ * Ledger Entry Codec Registry
+ *
+ * One place to look up how ledger entries are serialized, so transports
+ * take an EntryCodec instead of hard-coding a format. Each codec names
+ * its format and version; createCodecRegistry() registers the built-ins
+ * (JSON and MessagePack) and callers may register more.
+ *
+ * Decoding can auto-detect the format from the first byte where the
+ * container allows it: a JSON entry is an object ("{"), a MessagePack
+ * entry is a map (0x80-0x8f, 0xde, 0xdf). Every built-in decoder applies
+ * validateDecodedEntry, so no format admits an entry another would reject.
+ */
+
+import { LedgerEntry } from './types';
+import { validateDecodedEntry } from './entry-validation';
+import { encodeEntryMsgpack, decodeEntryMsgpack, ENTRY_SCHEMA_VERSION } from './msgpack';
+
+/**
+ * Encodes and decodes single ledger entries in one format
+ */
+export interface EntryCodec {
+  /** Format name used for registry lookup (e.g. "json") */
+  readonly format: string;
+
+  /** Version of the format's encoding */
+  readonly version: number;
+
+  encode(entry: LedgerEntry): Buffer;
+
+  /**
+   * @throws Error if the data is malformed or describes an invalid entry
+   */
+  decode(data: Buffer): LedgerEntry;
+
+  /** Whether data looks like this codec's output; omit if undetectable */
+  detect?(data: Buffer): boolean;
+}
+
+/**
+ * JSON codec - the entry's JSON form, with the timestamp as an ISO string
+ */
+export const jsonEntryCodec: EntryCodec = {
+  format: 'json',
+  version: 1,
+
+  encode(entry: LedgerEntry): Buffer {
+    return Buffer.from(JSON.stringify(entry), 'utf8');
+  },
+
+  decode(data: Buffer): LedgerEntry {
+    let entry: any;
+    try {
+      entry = JSON.parse(data.toString('utf8'));
+    } catch (error: any) {
+      throw new Error(`Malformed JSON entry: ${error.message}`);
+    }
+
+    if (entry === null || typeof entry !== 'object' || Array.isArray(entry)) {
+      throw new Error('Encoded entry must be an object');
+    }
+
+    if (typeof entry.timestamp === 'string') {
+      entry.timestamp = new Date(entry.timestamp);
+    }
+
+    const invalid = validateDecodedEntry(entry);
+    if (invalid) {
+      throw new Error(`Invalid encoded entry: ${invalid}`);
+    }
+
+    return entry as LedgerEntry;
+  },
+
+  detect(data: Buffer): boolean {
+    return data.toString('utf8', 0, Math.min(data.length, 64)).trimStart().startsWith('{');
+  },
+};
+
+/**
+ * MessagePack codec - see ./msgpack for the field numbering
+ */
+export const msgpackEntryCodec: EntryCodec = {
+  format: 'msgpack',
+  version: ENTRY_SCHEMA_VERSION,
+  encode: encodeEntryMsgpack,
+  decode: decodeEntryMsgpack,
+
+  detect(data: Buffer): boolean {
+    return data.length > 0 && ((data[0] & 0xf0) === 0x80 || data[0] === 0xde || data[0] === 0xdf);
+  },
+};
+
+/**
+ * Registry of entry codecs keyed by format name
+ */
+export class CodecRegistry {
+  private codecs = new Map<string, EntryCodec>();
+
+  /**
+   * Register a codec
+   *
+   * @throws Error if the format is already registered
+   */
+  register(codec: EntryCodec): this {
+    if (this.codecs.has(codec.format)) {
+      throw new Error(`Codec already registered for format: ${codec.format}`);
+    }
+    this.codecs.set(codec.format, codec);
+    return this;
+  }
+
+  /**
+   * Look up a codec by format name
+   *
+   * @throws Error if no codec is registered for the format
+   */
+  get(format: string): EntryCodec {
+    const codec = this.codecs.get(format);
+    if (!codec) {
+      throw new Error(`No codec registered for format: ${format}`);
+    }
+    return codec;
+  }
+
+  has(format: string): boolean {
+    return this.codecs.has(format);
+  }
+
+  /**
+   * Registered format names, in registration order
+   */
+  formats(): string[] {
+    return [...this.codecs.keys()];
+  }
+
+  /**
+   * Find the codec whose output the data looks like
+   *
+   * @throws Error if no registered codec recognises the data
+   */
+  detect(data: Buffer): EntryCodec {
+    for (const codec of this.codecs.values()) {
+      if (codec.detect && codec.detect(data)) {
+        return codec;
+      }
+    }
+    throw new Error('Unable to detect entry format');
+  }
+
+  /**
+   * Decode an entry in the given format, or the detected one when omitted
+   */
+  decode(data: Buffer, format?: string): LedgerEntry {
+    const codec = format === undefined ? this.detect(data) : this.get(format);
+    return codec.decode(data);
+  }
+}
+
+/**
+ * Factory function to create a registry with the built-in codecs
+ */
+export function createCodecRegistry(): CodecRegistry {
+  return new CodecRegistry().register(jsonEntryCodec).register(msgpackEntryCodec);
+}
@@ -0,0 +1,155 @@
+/**
+ * Concealing Ledger Service Tests
+ */
+
+import { ConcealingLedgerService } from './concealing-ledger.service';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+import { TransactionAlreadyConcealedError } from '../services/types';
+import { LedgerConcealmentModel } from '../db/models/ledger-concealment.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+// Mock mongoose models
+jest.mock('../db/models/ledger-concealment.model');
+
+describe('ConcealingLedgerService', () => {
+  let stored: LedgerEntry[];
+  let markers: { transactionId: string }[];
+  let inner: jest.Mocked<ILedgerService>;
+  let service: ConcealingLedgerService;
+
+  const entry = (entryId: string, transactionId: string, amount: number, balanceAfter: number): LedgerEntry => ({
+    entryId,
+    transactionId,
+    accountId: 'user-1',
+    accountType: 'user',
+    amount,
+    type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: amount > 0 ? 'none→available' : 'available→none',
+    reason: amount > 0 ? TransactionReason.ADMIN_CREDIT : TransactionReason.ADMIN_DEBIT,
+    idempotencyKey: `key-${entryId}`,
+    requestId: 'req-1',
+    balanceBefore: balanceAfter - amount,
+    balanceAfter,
+    timestamp: new Date('2024-01-01T00:00:00Z'),
+    currency: 'points',
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    stored = [entry('entry-1', 'txn-1', 100, 100), entry('entry-2', 'txn-wrong', 40, 140)];
+    markers = [];
+
+    inner = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+        const entries = stored.filter(e => !filter.excludeTransactionIds?.includes(e.transactionId));
+        return { entries, totalCount: entries.length, offset: 0, limit: 100, hasMore: false };
+      }),
+      getEntry: jest.fn().mockImplementation(async (id: string) => stored.find(e => e.entryId === id) || null),
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string, accountType: 'user' | 'model') => ({
+        accountId,
+        accountType,
+        availableBalance: 140,
+        escrowBalance: 0,
+        asOf: new Date(),
+        currency: 'points',
+      })),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn().mockImplementation(async (transactionId: string) =>
+        stored
+          .filter(e => e.transactionId === transactionId)
+          .map(ledgerEntry => ({ auditId: ledgerEntry.entryId, ledgerEntry, auditedAt: new Date() }))
+      ),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    };
+    service = new ConcealingLedgerService(inner);
+
+    (LedgerConcealmentModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (markers.some(marker => marker.transactionId === doc.transactionId)) {
+        throw Object.assign(new Error('Duplicate key'), { code: 11000 });
+      }
+      markers.push(doc);
+      return doc;
+    });
+    (LedgerConcealmentModel.find as jest.Mock).mockImplementation(() => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => markers),
+    }));
+    (LedgerConcealmentModel.findOne as jest.Mock).mockImplementation(async (query: any) =>
+      markers.find(marker => marker.transactionId === query.transactionId.$eq) || null
+    );
+  });
+
+  it('should record a concealment marker with its author and reason', async () => {
+    const record = await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+    expect(record).toMatchObject({ transactionId: 'txn-wrong', committedBy: 'legal-1', reason: 'wrongly attributed' });
+    expect(LedgerConcealmentModel.create).toHaveBeenCalledWith(
+      expect.objectContaining({ transactionId: 'txn-wrong', committedBy: 'legal-1', reason: 'wrongly attributed' })
+    );
+  });
+
+  it('should hide a concealed transaction from default reads', async () => {
+    await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+    const result = await service.queryEntries({ accountId: 'user-1' });
+
+    expect(result.entries.map(e => e.entryId)).toEqual(['entry-1']);
+    expect(inner.queryEntries).toHaveBeenCalledWith({ accountId: 'user-1', excludeTransactionIds: ['txn-wrong'] });
+    await expect(service.getEntry('entry-2')).resolves.toBeNull();
+    await expect(service.getEntry('entry-1')).resolves.toMatchObject({ entryId: 'entry-1' });
+  });
+
+  it('should still return concealed transactions to audit reads', async () => {
+    await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+    const result = await service.queryEntriesIncludingConcealed({ accountId: 'user-1' });
+
+    expect(result.entries.map(e => e.entryId)).toEqual(['entry-1', 'entry-2']);
+    await expect(service.getEntryIncludingConcealed('entry-2')).resolves.toMatchObject({ entryId: 'entry-2' });
+    await expect(service.getAuditTrail('txn-wrong')).resolves.toHaveLength(1);
+    expect(stored).toHaveLength(2);
+  });
+
+  it('should reject concealing a transaction twice', async () => {
+    await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+    await expect(service.conceal('txn-wrong', 'legal-2', 'again')).rejects.toThrow(TransactionAlreadyConcealedError);
+  });
+
+  it('should reject unknown transactions and missing attribution', async () => {
+    await expect(service.conceal('txn-missing', 'legal-1', 'x')).rejects.toThrow('Transaction not found');
+    await expect(service.conceal('txn-1', '', 'x')).rejects.toThrow('committedBy and reason are required');
+    expect(LedgerConcealmentModel.create).not.toHaveBeenCalled();
+  });
+
+  describe('balances', () => {
+    it('should leave balances unchanged by default', async () => {
+      await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+      const snapshot = await service.getBalanceSnapshot('user-1', 'user');
+
+      expect(snapshot.availableBalance).toBe(140);
+    });
+
+    it('should back concealed amounts out when configured', async () => {
+      service = new ConcealingLedgerService(inner, { concealmentAffectsBalance: true });
+      await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+      const snapshot = await service.getBalanceSnapshot('user-1', 'user');
+
+      expect(snapshot.availableBalance).toBe(100);
+    });
+
+    it('should ignore concealed entries after the snapshot time', async () => {
+      service = new ConcealingLedgerService(inner, { concealmentAffectsBalance: true });
+      await service.conceal('txn-wrong', 'legal-1', 'wrongly attributed');
+
+      const snapshot = await service.getBalanceSnapshot('user-1', 'user', new Date('2023-12-31T00:00:00Z'));
+
+      expect(snapshot.availableBalance).toBe(140);
+    });
+  });
+});
@@ -0,0 +1,240 @@
+/**
+ * Concealing Ledger Service
+ *
+ * Wraps an ILedgerService so that a transaction can be hidden from
+ * default reads without deleting anything. conceal() appends an
+ * immutable concealment marker; queryEntries and getEntry then omit the
+ * transaction's entries, while the *IncludingConcealed reads and the
+ * audit trail still return everything.
+ *
+ * Whether a concealed transaction still counts towards balances is a
+ * configuration choice. By default it does, so concealment only changes
+ * what is shown. With concealmentAffectsBalance, concealed amounts are
+ * backed out of balance snapshots.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import { LedgerConcealmentModel } from '../db/models/ledger-concealment.model';
+import { TransactionAlreadyConcealedError } from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * A recorded concealment
+ */
+export interface ConcealmentRecord {
+  concealmentId: string;
+  transactionId: string;
+  committedBy: string;
+  reason: string;
+  concealedAt: Date;
+}
+
+/**
+ * Configuration for the concealing ledger service
+ */
+export interface ConcealmentConfig {
+  /** Back concealed amounts out of balance snapshots */
+  concealmentAffectsBalance: boolean;
+}
+
+const DEFAULT_CONFIG: ConcealmentConfig = {
+  concealmentAffectsBalance: false,
+};
+
+/**
+ * ConcealingLedgerService implementation
+ */
+export class ConcealingLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private config: ConcealmentConfig;
+
+  constructor(inner: ILedgerService, config: Partial<ConcealmentConfig> = {}) {
+    this.inner = inner;
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
+  /**
+   * Hide a transaction from default reads
+   *
+   * @throws TransactionAlreadyConcealedError if the transaction is already concealed
+   * @throws Error if the transaction has no entries
+   */
+  async conceal(transactionId: string, committedBy: string, reason: string): Promise<ConcealmentRecord> {
+    if (!transactionId) {
+      throw new Error('transactionId is required for concealment');
+    }
+
+    if (!committedBy || !reason) {
+      throw new Error('committedBy and reason are required for concealment');
+    }
+
+    const trail = await this.inner.getAuditTrail(transactionId);
+    if (trail.length === 0) {
+      throw new Error(`Transaction not found: ${transactionId}`);
+    }
+
+    const concealmentId = uuidv4();
+    try {
+      await LedgerConcealmentModel.create({ concealmentId, transactionId, committedBy, reason });
+    } catch (error: any) {
+      if (error && error.code === 11000) {
+        throw new TransactionAlreadyConcealedError(transactionId);
+      }
+      throw error;
+    }
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_TRANSACTION_CONCEALED, {
+      transactionId,
+      committedBy,
+      entryCount: trail.length,
+    });
+
+    return { concealmentId, transactionId, committedBy, reason, concealedAt: new Date() };
+  }
+
+  /**
+   * Whether a transaction has been concealed
+   */
+  async isConcealed(transactionId: string): Promise<boolean> {
+    return (await LedgerConcealmentModel.findOne({ transactionId: { $eq: transactionId } })) !== null;
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return this.inner.createEntry(request);
+  }
+
+  /**
+   * Query entries, omitting concealed transactions
+   */
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    const concealed = await this.concealedTransactionIds();
+    if (concealed.length === 0) {
+      return this.inner.queryEntries(filter);
+    }
+
+    return this.inner.queryEntries({
+      ...filter,
+      excludeTransactionIds: [...(filter.excludeTransactionIds || []), ...concealed],
+    });
+  }
+
+  /**
+   * Query entries including concealed transactions, for audit
+   */
+  async queryEntriesIncludingConcealed(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.inner.queryEntries(filter);
+  }
+
+  /**
+   * Get an entry by ID; null if its transaction is concealed
+   */
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    const entry = await this.inner.getEntry(entryId);
+    if (!entry || (await this.isConcealed(entry.transactionId))) {
+      return null;
+    }
+    return entry;
+  }
+
+  /**
+   * Get an entry by ID even if its transaction is concealed, for audit
+   */
+  async getEntryIncludingConcealed(entryId: string): Promise<LedgerEntry | null> {
+    return this.inner.getEntry(entryId);
+  }
+
+  /**
+   * Concealed entries still exist; concealment only hides them from reads
+   */
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.inner.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    const snapshot = await this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+    if (!this.config.concealmentAffectsBalance) {
+      return snapshot;
+    }
+
+    const adjusted = { ...snapshot };
+    for (const transactionId of await this.concealedTransactionIds()) {
+      for (const { ledgerEntry: entry } of await this.inner.getAuditTrail(transactionId)) {
+        if (
+          entry.accountId !== snapshot.accountId ||
+          entry.accountType !== accountType ||
+          (asOf && entry.timestamp > asOf)
+        ) {
+          continue;
+        }
+
+        if (entry.balanceState === 'available') {
+          adjusted.availableBalance -= entry.amount;
+        } else if (entry.balanceState === 'escrow' && adjusted.escrowBalance !== undefined) {
+          adjusted.escrowBalance -= entry.amount;
+        } else if (entry.balanceState === 'earned' && adjusted.earnedBalance !== undefined) {
+          adjusted.earnedBalance -= entry.amount;
+        }
+      }
+    }
+
+    return adjusted;
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  /**
+   * Audit trails always include concealed transactions
+   */
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.inner.getAuditTrail(transactionId);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  private async concealedTransactionIds(): Promise<string[]> {
+    const markers = await LedgerConcealmentModel.find({}, { transactionId: 1 }).lean().exec();
+    return markers.map((marker: any) => marker.transactionId);
+  }
+}
+
+/**
+ * Factory function to create a concealing ledger service
+ */
+export function createConcealingLedgerService(
+  inner: ILedgerService,
+  config?: Partial<ConcealmentConfig>
+): ConcealingLedgerService {
+  return new ConcealingLedgerService(inner, config);
+}
@@ -0,0 +1,211 @@
+/**
+ * Daily Aggregates Tests
+ */
+
+import { DailyAggregates } from './daily-aggregates';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+import { TransactionType } from '../wallets/types';
+import { StaticTimezoneSource } from './timezone';
+import { defaultProgram } from '../config/program';
+
+describe('DailyAggregates', () => {
+  let ledger: LedgerEntry[];
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  const entry = (accountId: string, amount: number, timestamp: string): LedgerEntry => ({
+    entryId: `entry-${ledger.length}`,
+    accountId,
+    accountType: 'user',
+    amount,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    timestamp: new Date(timestamp),
+  } as LedgerEntry);
+
+  beforeEach(() => {
+    ledger = [];
+    mockLedgerService = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+        const matching = ledger.filter(e =>
+          (!filter.accountId || e.accountId === filter.accountId) &&
+          (!filter.type || e.type === filter.type) &&
+          (!filter.startDate || e.timestamp >= filter.startDate) &&
+          (!filter.endDate || e.timestamp <= filter.endDate)
+        ).sort((a, b) => a.timestamp.getTime() - b.timestamp.getTime() || (a.entryId < b.entryId ? -1 : 1));
+        const offset = filter.offset || 0;
+        const limit = filter.limit || 100;
+        return {
+          entries: matching.slice(offset, offset + limit),
+          totalCount: matching.length,
+          offset,
+          limit,
+          hasMore: offset + limit < matching.length,
+        };
+      }),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+  });
+
+  const append = (aggregates: DailyAggregates, e: LedgerEntry) => {
+    ledger.push(e);
+    aggregates.afterAppend(e);
+  };
+
+  it('should return a zero-filled global series', async () => {
+    const aggregates = new DailyAggregates(mockLedgerService);
+    append(aggregates, entry('user-1', 100, '2024-03-01T10:00:00Z'));
+    append(aggregates, entry('user-2', 50, '2024-03-01T23:59:59Z'));
+    append(aggregates, entry('user-1', -30, '2024-03-03T09:00:00Z'));
+    append(aggregates, entry('user-1', 20, '2024-03-03T12:00:00Z'));
+
+    const series = await aggregates.series(
+      undefined,
+      new Date('2024-03-01T00:00:00Z'),
+      new Date('2024-03-03T00:00:00Z'),
+      TransactionType.CREDIT
+    );
+
+    expect(series).toEqual([
+      { day: '2024-03-01', count: 2, amount: 150 },
+      { day: '2024-03-02', count: 0, amount: 0 },
+      { day: '2024-03-03', count: 1, amount: 20 },
+    ]);
+  });
+
+  it('should derive per-user series from the ledger', async () => {
+    const aggregates = new DailyAggregates(mockLedgerService);
+    append(aggregates, entry('user-1', -30, '2024-03-01T09:00:00Z'));
+    append(aggregates, entry('user-2', -70, '2024-03-01T09:00:00Z'));
+
+    const series = await aggregates.series(
+      'user-1',
+      new Date('2024-03-01T00:00:00Z'),
+      new Date('2024-03-02T00:00:00Z'),
+      TransactionType.DEBIT
+    );
+
+    expect(series).toEqual([
+      { day: '2024-03-01', count: 1, amount: 30 },
+      { day: '2024-03-02', count: 0, amount: 0 },
+    ]);
+  });
+
+  it('should rebuild to exactly the incrementally maintained values', async () => {
+    const incremental = new DailyAggregates(mockLedgerService);
+    for (let i = 0; i < 2500; i++) {
+      const day = String(1 + (i % 28)).padStart(2, '0');
+      append(incremental, entry(`user-${i % 7}`, i % 3 === 0 ? -i : i, `2024-02-${day}T12:00:00Z`));
+    }
+
+    const rebuilt = new DailyAggregates(mockLedgerService);
+    await rebuilt.rebuild();
+
+    const from = new Date('2024-02-01T00:00:00Z');
+    const to = new Date('2024-02-29T00:00:00Z');
+    for (const type of [TransactionType.CREDIT, TransactionType.DEBIT]) {
+      expect(await rebuilt.series(undefined, from, to, type)).toEqual(
+        await incremental.series(undefined, from, to, type)
+      );
+    }
+  });
+
+  it('should use the user timezone for per-user day boundaries', async () => {
+    const aggregates = new DailyAggregates(mockLedgerService, {
+      timezoneSource: new StaticTimezoneSource({ 'user-1': 'Asia/Tokyo' }),
+    });
+    // 20:00 UTC on the 1st is already the 2nd in Tokyo
+    append(aggregates, entry('user-1', 100, '2024-03-01T20:00:00Z'));
+    append(aggregates, entry('user-1', 40, '2024-03-01T10:00:00Z'));
+
+    const series = await aggregates.series(
+      'user-1',
+      new Date('2024-03-01T00:00:00+09:00'),
+      new Date('2024-03-02T00:00:00+09:00'),
+      TransactionType.CREDIT
+    );
+
+    expect(series).toEqual([
+      { day: '2024-03-01', count: 1, amount: 40 },
+      { day: '2024-03-02', count: 1, amount: 100 },
+    ]);
+  });
+
+  it('should count each entry once across a 25-hour fall-back day', async () => {
+    const aggregates = new DailyAggregates(mockLedgerService, {
+      timezoneSource: new StaticTimezoneSource({ 'user-1': 'America/New_York' }),
+    });
+    // 01:30 local happens twice on 2024-11-03 (EDT then EST)
+    append(aggregates, entry('user-1', 10, '2024-11-03T05:30:00Z'));
+    append(aggregates, entry('user-1', 20, '2024-11-03T06:30:00Z'));
+    // 23:30 local on the 3rd is 04:30 UTC on the 4th
+    append(aggregates, entry('user-1', 30, '2024-11-04T04:30:00Z'));
+    append(aggregates, entry('user-1', 40, '2024-11-04T05:30:00Z'));
+
+    const series = await aggregates.series(
+      'user-1',
+      new Date('2024-11-02T12:00:00Z'),
+      new Date('2024-11-04T12:00:00Z'),
+      TransactionType.CREDIT
+    );
+
+    expect(series).toEqual([
+      { day: '2024-11-02', count: 0, amount: 0 },
+      { day: '2024-11-03', count: 3, amount: 60 },
+      { day: '2024-11-04', count: 1, amount: 40 },
+    ]);
+  });
+
+  it('should not lose entries on a 23-hour spring-forward day', async () => {
+    const aggregates = new DailyAggregates(mockLedgerService, { defaultTimeZone: 'America/New_York' });
+    // First and last instants of the 23-hour local day
+    append(aggregates, entry('user-1', 5, '2024-03-10T05:00:00Z'));
+    append(aggregates, entry('user-2', 7, '2024-03-11T03:59:59Z'));
+    append(aggregates, entry('user-2', 9, '2024-03-11T04:00:00Z'));
+
+    const series = await aggregates.series(
+      undefined,
+      new Date('2024-03-10T12:00:00Z'),
+      new Date('2024-03-11T12:00:00Z'),
+      TransactionType.CREDIT
+    );
+
+    expect(series).toEqual([
+      { day: '2024-03-10', count: 2, amount: 12 },
+      { day: '2024-03-11', count: 1, amount: 9 },
+    ]);
+  });
+
+  it('should take the default timezone from the program, keeping the projection\'s until reset', async () => {
+    let config = { ...defaultProgram(), defaultTimeZone: 'America/New_York' };
+    const aggregates = new DailyAggregates(mockLedgerService, { program: { current: () => config } });
+    // 22:00 on the 9th in New York
+    append(aggregates, entry('user-1', 10, '2024-03-10T03:00:00Z'));
+    const range = [new Date('2024-03-10T03:00:00Z'), new Date('2024-03-10T03:00:00Z')] as const;
+
+    expect(await aggregates.series(undefined, ...range, TransactionType.CREDIT)).toEqual([
+      { day: '2024-03-09', count: 1, amount: 10 },
+    ]);
+
+    config = { ...config, defaultTimeZone: 'UTC' };
+    expect((await aggregates.series(undefined, ...range, TransactionType.CREDIT))[0].day).toBe('2024-03-09');
+    expect((await aggregates.series('user-1', ...range, TransactionType.CREDIT))[0].day).toBe('2024-03-10');
+
+    await aggregates.rebuild();
+    expect(await aggregates.series(undefined, ...range, TransactionType.CREDIT)).toEqual([
+      { day: '2024-03-10', count: 1, amount: 10 },
+    ]);
+  });
+
+  it('should reject an inverted range', async () => {
+    const aggregates = new DailyAggregates(mockLedgerService);
+
+    await expect(
+      aggregates.series(undefined, new Date('2024-03-02'), new Date('2024-03-01'), TransactionType.CREDIT)
+    ).rejects.toThrow('from must not be after to');
+  });
+});
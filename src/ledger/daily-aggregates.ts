@@ -0,0 +1,239 @@
+/**
+ * Daily Aggregates Projection
+ *
+ * Per-day, per-transaction-type counts and summed amounts for analytics
+ * queries such as "points earned per day for the last 90 days", without
+ * scanning raw entries on every request.
+ *
+ * The global projection is maintained incrementally as a LedgerAppendHook
+ * and is exactly reproducible from the ledger via rebuild(), which replays
+ * it as a Projector on the replay engine. Per-user
+ * series are derived from the ledger on demand. Amounts are summed as
+ * absolute point values.
+ *
+ * Days are local calendar days: the user's timezone for per-user series
+ * and the program default (UTC unless configured) for the global series.
+ * With a program config, its defaultTimeZone is the program default. The
+ * global projection keeps the zone it was built in until it is reset, so
+ * a reload changing the default reaches the global series on rebuild and
+ * per-user series at once.
+ */
+
+import { ILedgerService, LedgerEntry, LedgerAppendHook, LedgerQueryFilter } from './types';
+import { Projector, ReplayEngine } from './replay';
+import { TransactionType } from '../wallets/types';
+import {
+  UserTimezoneSource,
+  assertValidTimeZone,
+  zonedDayKey,
+  nextDayKey,
+  startOfZonedDay,
+  resolveTimeZone,
+} from './timezone';
+import { ProgramConfigSource } from '../config/program';
+
+/**
+ * One day in an aggregate series
+ */
+export interface DayPoint {
+  /** UTC day (YYYY-MM-DD) */
+  day: string;
+
+  /** Number of entries */
+  count: number;
+
+  /** Sum of absolute entry amounts */
+  amount: number;
+}
+
+/**
+ * Page size used when reading the ledger
+ */
+const PAGE_SIZE = 1000;
+
+/**
+ * Aggregate bucket keyed by day then transaction type
+ */
+type DayBuckets = Map<string, Map<TransactionType, { count: number; amount: number }>>;
+
+/**
+ * Configuration for daily aggregates
+ */
+export interface DailyAggregatesConfig {
+  /** Source of per-user timezones */
+  timezoneSource?: UserTimezoneSource;
+
+  /** Program default timezone, used for the global series and as fallback */
+  defaultTimeZone: string;
+
+  /** Program config whose defaultTimeZone replaces defaultTimeZone */
+  program?: ProgramConfigSource;
+}
+
+const DEFAULT_CONFIG: DailyAggregatesConfig = {
+  defaultTimeZone: 'UTC',
+};
+
+/**
+ * DailyAggregates implementation
+ */
+export class DailyAggregates implements LedgerAppendHook, Projector {
+  readonly name = 'daily-aggregates';
+  private config: DailyAggregatesConfig;
+  private ledgerService: ILedgerService;
+  private buckets: DayBuckets = new Map();
+  private projectionTimeZone: string;
+
+  constructor(ledgerService: ILedgerService, config: Partial<DailyAggregatesConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    assertValidTimeZone(this.config.defaultTimeZone);
+    this.ledgerService = ledgerService;
+    this.projectionTimeZone = this.defaultTimeZone();
+  }
+
+  /**
+   * Fold a newly appended entry into the global projection
+   */
+  afterAppend(entry: LedgerEntry): void {
+    addToBuckets(this.buckets, entry, this.projectionTimeZone);
+  }
+
+  /**
+   * Fold a replayed entry into the global projection
+   */
+  apply(entry: LedgerEntry): void {
+    addToBuckets(this.buckets, entry, this.projectionTimeZone);
+  }
+
+  /**
+   * Discard the global projection, taking up the current default timezone
+   */
+  reset(): void {
+    this.buckets = new Map();
+    this.projectionTimeZone = this.defaultTimeZone();
+  }
+
+  /**
+   * Discard the global projection and recompute it from the ledger
+   * The current projection keeps serving reads until the replay finishes.
+   */
+  async rebuild(): Promise<void> {
+    const staging = new DailyAggregates(this.ledgerService, this.config);
+    await new ReplayEngine(this.ledgerService).register(staging).run({ fromScratch: true });
+    this.buckets = staging.buckets;
+    this.projectionTimeZone = staging.projectionTimeZone;
+  }
+
+  /**
+   * Get a zero-filled daily series for a transaction type
+   *
+   * @param userId User to aggregate, or undefined for the global series
+   * @param from Instant within the first day (inclusive)
+   * @param to Instant within the last day (inclusive)
+   * @param type Transaction type to aggregate
+   */
+  async series(
+    userId: string | undefined,
+    from: Date,
+    to: Date,
+    type: TransactionType
+  ): Promise<DayPoint[]> {
+    if (from.getTime() > to.getTime()) {
+      throw new Error('from must not be after to');
+    }
+
+    let buckets = this.buckets;
+    let timeZone = this.projectionTimeZone;
+
+    if (userId) {
+      timeZone = await resolveTimeZone(this.config.timezoneSource, userId, this.defaultTimeZone());
+      buckets = new Map();
+      const userBuckets = buckets;
+      const zone = timeZone;
+      await this.scan(
+        {
+          accountId: userId,
+          accountType: 'user',
+          type,
+          startDate: startOfZonedDay(zonedDayKey(from, zone), zone),
+          endDate: new Date(
+            startOfZonedDay(nextDayKey(zonedDayKey(to, zone)), zone).getTime() - 1
+          ),
+        },
+        entry => addToBuckets(userBuckets, entry, zone)
+      );
+    }
+
+    // Step by calendar day so 23- and 25-hour DST days each appear once
+    const points: DayPoint[] = [];
+    const lastDay = zonedDayKey(to, timeZone);
+    for (let day = zonedDayKey(from, timeZone); day <= lastDay; day = nextDayKey(day)) {
+      const bucket = buckets.get(day)?.get(type);
+      points.push({
+        day,
+        count: bucket ? bucket.count : 0,
+        amount: bucket ? bucket.amount : 0,
+      });
+    }
+
+    return points;
+  }
+
+  /**
+   * The program default timezone
+   */
+  private defaultTimeZone(): string {
+    return this.config.program ? this.config.program.current().defaultTimeZone : this.config.defaultTimeZone;
+  }
+
+  /**
+   * Page through ledger entries matching a filter in timestamp order
+   */
+  private async scan(
+    filter: LedgerQueryFilter,
+    visit: (entry: LedgerEntry) => void
+  ): Promise<void> {
+    let offset = 0;
+    let hasMore = true;
+
+    while (hasMore) {
+      const result = await this.ledgerService.queryEntries({
+        ...filter,
+        offset,
+        limit: PAGE_SIZE,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+      });
+      result.entries.forEach(visit);
+      offset += result.entries.length;
+      hasMore = result.hasMore && result.entries.length > 0;
+    }
+  }
+}
+
+/**
+ * Add an entry to a set of day buckets
+ */
+function addToBuckets(buckets: DayBuckets, entry: LedgerEntry, timeZone: string): void {
+  const day = zonedDayKey(new Date(entry.timestamp), timeZone);
+  let byType = buckets.get(day);
+  if (!byType) {
+    byType = new Map();
+    buckets.set(day, byType);
+  }
+
+  const bucket = byType.get(entry.type) || { count: 0, amount: 0 };
+  bucket.count++;
+  bucket.amount += Math.abs(entry.amount);
+  byType.set(entry.type, bucket);
+}
+
+/**
+ * Factory function to create a daily aggregates projection
+ */
+export function createDailyAggregates(
+  ledgerService: ILedgerService,
+  config?: Partial<DailyAggregatesConfig>
+): DailyAggregates {
+  return new DailyAggregates(ledgerService, config);
+}
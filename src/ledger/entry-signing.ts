@@ -0,0 +1,82 @@
+/**
+ * Ledger Entry Signing
+ *
+ * Ed25519 signatures over the immutable fields of a ledger entry.
+ * Signing happens at creation; verification can run on read so that
+ * rows tampered with in an untrusted storage layer are detected.
+ */
+
+import { createPrivateKey, createPublicKey, sign, verify, KeyObject } from 'crypto';
+
+/**
+ * Fields covered by the signature
+ */
+export interface SignedEntryFields {
+  entryId: string;
+  transactionId: string;
+  accountId: string;
+  accountType: string;
+  amount: number;
+  type: string;
+  balanceState: string;
+  reason: string;
+  idempotencyKey: string;
+  balanceBefore: number;
+  balanceAfter: number;
+  timestamp: Date;
+  currency: string;
+  correlationId?: string;
+}
+
+/**
+ * Build the canonical byte representation of an entry's signed fields
+ */
+export function canonicalizeEntry(entry: SignedEntryFields): Buffer {
+  const canonical = [
+    entry.entryId,
+    entry.transactionId,
+    entry.accountId,
+    entry.accountType,
+    entry.amount,
+    entry.type,
+    entry.balanceState,
+    entry.reason,
+    entry.idempotencyKey,
+    entry.balanceBefore,
+    entry.balanceAfter,
+    new Date(entry.timestamp).toISOString(),
+    entry.currency,
+    entry.correlationId ?? null,
+  ];
+
+  return Buffer.from(JSON.stringify(canonical), 'utf8');
+}
+
+/**
+ * Sign an entry with a PEM-encoded Ed25519 private key
+ * @returns Base64 signature
+ */
+export function signEntry(entry: SignedEntryFields, privateKeyPem: string | KeyObject): string {
+  const key = typeof privateKeyPem === 'string' ? createPrivateKey(privateKeyPem) : privateKeyPem;
+  return sign(null, canonicalizeEntry(entry), key).toString('base64');
+}
+
+/**
+ * Verify an entry's signature with a PEM-encoded Ed25519 public key
+ * Entries without a signature never verify.
+ */
+export function verifyEntrySignature(
+  entry: SignedEntryFields & { signature?: string },
+  publicKeyPem: string | KeyObject
+): boolean {
+  if (!entry.signature) {
+    return false;
+  }
+
+  try {
+    const key = typeof publicKeyPem === 'string' ? createPublicKey(publicKeyPem) : publicKeyPem;
+    return verify(null, canonicalizeEntry(entry), key, Buffer.from(entry.signature, 'base64'));
+  } catch {
+    return false;
+  }
+}
@@ -0,0 +1,113 @@
+/**
+ * Ledger Entry Field Validation
+ *
+ * Checks shared by every path that builds an entry from untrusted raw
+ * fields (recordEntry, wire decoders), so none of them can admit an entry
+ * the others would reject.
+ */
+
+import { TransactionType, TransactionReason, isValidTransactionType } from '../wallets/types';
+
+/**
+ * Raw entry fields subject to validation
+ */
+export interface ValidatedEntryFields {
+  idempotencyKey: string;
+  accountId: string;
+  type: string;
+  amount: number;
+  reason: string;
+  requestId: string;
+}
+
+/**
+ * Whether an amount has the sign its transaction type requires:
+ * credits positive, debits negative
+ */
+export function amountMatchesType(type: string, amount: number): boolean {
+  if (type === TransactionType.CREDIT) {
+    return amount > 0;
+  }
+  if (type === TransactionType.DEBIT) {
+    return amount < 0;
+  }
+  return false;
+}
+
+/**
+ * Check raw entry fields, returning the first problem found
+ */
+export function validateEntryFields(fields: ValidatedEntryFields): string | undefined {
+  if (!fields.idempotencyKey) {
+    return 'idempotencyKey is required';
+  }
+
+  if (!fields.accountId) {
+    return 'accountId is required';
+  }
+
+  if (!isValidTransactionType(fields.type)) {
+    return `Invalid transaction type: ${fields.type}`;
+  }
+
+  if (!Number.isSafeInteger(fields.amount) || fields.amount === 0) {
+    return 'Amount must be a non-zero integer';
+  }
+
+  if (!amountMatchesType(fields.type, fields.amount)) {
+    return `Amount sign does not match transaction type ${fields.type}`;
+  }
+
+  if (!(Object.values(TransactionReason) as string[]).includes(fields.reason)) {
+    return `Invalid transaction reason: ${fields.reason}`;
+  }
+
+  if (!fields.requestId) {
+    return 'requestId is required';
+  }
+
+  return undefined;
+}
+
+/**
+ * Fields every stored entry carries
+ */
+const DECODED_REQUIRED_FIELDS = [
+  'entryId',
+  'transactionId',
+  'accountId',
+  'accountType',
+  'amount',
+  'type',
+  'balanceState',
+  'stateTransition',
+  'reason',
+  'idempotencyKey',
+  'requestId',
+  'balanceBefore',
+  'balanceAfter',
+  'timestamp',
+  'currency',
+];
+
+/**
+ * Check a complete entry decoded from a wire format, returning the first
+ * problem found - the recordEntry checks plus the stored-only fields
+ */
+export function validateDecodedEntry(entry: Record<string, any>): string | undefined {
+  for (const name of DECODED_REQUIRED_FIELDS) {
+    if (entry[name] === undefined || entry[name] === null) {
+      return `${name} is required`;
+    }
+  }
+
+  if (!(entry.timestamp instanceof Date) || isNaN(entry.timestamp.getTime())) {
+    return 'timestamp must be a valid date';
+  }
+
+  if (!Number.isSafeInteger(entry.balanceBefore) || !Number.isSafeInteger(entry.balanceAfter)) {
+    return 'Balances must be integers';
+  }
+
+  return validateEntryFields(entry as ValidatedEntryFields);
+}
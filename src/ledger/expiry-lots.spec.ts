@@ -0,0 +1,79 @@
+/**
+ * Expiry Lot Projection Tests
+ */
+
+import { projectExpiryLots, expiredLots, consumedLots } from './expiry-lots';
+import { LedgerEntry } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('projectExpiryLots', () => {
+  let n = 0;
+  const entry = (amount: number, day: number, fields: Partial<LedgerEntry> = {}): LedgerEntry => ({
+    entryId: `entry-${++n}`,
+    transactionId: `tx-${n}`,
+    accountId: 'user-1',
+    accountType: 'user',
+    amount,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: amount >= 0 ? 'none→available' : 'available→none',
+    reason: amount >= 0 ? TransactionReason.PROMOTIONAL_AWARD : TransactionReason.CHIP_MENU_PURCHASE,
+    idempotencyKey: `key-${n}`,
+    requestId: `req-${n}`,
+    balanceBefore: 0,
+    balanceAfter: 0,
+    timestamp: new Date(Date.UTC(2025, 0, day)),
+    currency: 'points',
+    ...fields,
+  });
+  const expiring = (amount: number, day: number, expiresDay: number) =>
+    entry(amount, day, { metadata: { expiresAt: new Date(Date.UTC(2025, 0, expiresDay)).toISOString() } });
+
+  it('should consume the oldest lots first', () => {
+    const lots = projectExpiryLots([expiring(100, 1, 20), expiring(50, 2, 25), entry(-120, 3)]);
+
+    expect(lots.map(lot => [lot.amount, lot.remaining])).toEqual([[50, 30]]);
+  });
+
+  it('should replay entries in timestamp order regardless of input order', () => {
+    const credit = expiring(100, 1, 20);
+    const debit = entry(-40, 3);
+
+    expect(projectExpiryLots([debit, credit])).toEqual(projectExpiryLots([credit, debit]));
+  });
+
+  it('should take an expiry debit from the lots expired by its cut-off', () => {
+    const lots = projectExpiryLots([
+      entry(200, 1),
+      expiring(100, 2, 10),
+      entry(-100, 12, {
+        reason: TransactionReason.POINT_EXPIRY,
+        metadata: { expiredThrough: new Date(Date.UTC(2025, 0, 11)).toISOString() },
+      }),
+    ]);
+
+    // FIFO alone would have eaten the older, non-expiring credit instead
+    expect(lots).toHaveLength(1);
+    expect(lots[0]).toMatchObject({ amount: 200, remaining: 200, expiresAt: null });
+  });
+
+  it('should keep a carried-in balance as a non-expiring lot', () => {
+    const lots = projectExpiryLots([expiring(10, 5, 6)].map(e => ({ ...e, balanceBefore: 70 })));
+
+    expect(lots[0]).toMatchObject({ entryId: 'carried', remaining: 70, expiresAt: null });
+    expect(expiredLots(lots, new Date(Date.UTC(2025, 0, 31)))).toHaveLength(1);
+  });
+
+  it('should report the lots a debit drew down after the debits before it', () => {
+    const first = entry(100, 1);
+    const second = expiring(50, 2, 20);
+    const earlier = entry(-80, 3);
+    const debit = entry(-60, 4);
+
+    expect(consumedLots([debit, second, earlier, first], debit.entryId)).toEqual([
+      { entryId: first.entryId, creditedAt: first.timestamp, expiresAt: null, consumed: 20 },
+      { entryId: second.entryId, creditedAt: second.timestamp, expiresAt: new Date(Date.UTC(2025, 0, 20)), consumed: 40 },
+    ]);
+    expect(consumedLots([first, debit], 'entry-missing')).toBeNull();
+  });
+});
@@ -0,0 +1,242 @@
+/**
+ * Expiry Lot Projection
+ *
+ * Replays one user's available-balance entries into lots: each credit
+ * opens a lot carrying the credit's metadata.expiresAt (if any), and
+ * debits consume lots first-in first-out. An expiry debit instead takes
+ * the lots that had expired by its cut-off (metadata.expiredThrough,
+ * else its timestamp), which are exactly the lots the sweeper expired.
+ *
+ * The expiration sweeper and the expiring-points report both read
+ * expiredLots() off this projection, so a report's numbers are what the
+ * sweeper will expire if the user redeems nothing in the meantime.
+ * consumedLots() replays the same way up to one debit and reports which
+ * lots it drew down; redemptionLatencies() replays every debit and
+ * reports when each earned lot was first redeemed.
+ */
+
+import { LedgerEntry } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+/**
+ * Entry ID of the lot holding a balance carried in before the first entry
+ */
+const CARRIED_LOT = 'carried';
+
+/**
+ * Points from one credit not yet consumed
+ */
+export interface ExpiryLot {
+  /** Credit that opened the lot ('carried' for a balance predating the entries) */
+  entryId: string;
+
+  creditedAt: Date;
+
+  /** Null for points that never expire */
+  expiresAt: Date | null;
+
+  /** Points credited */
+  amount: number;
+
+  /** Points not yet consumed */
+  remaining: number;
+}
+
+/**
+ * Points one debit took from one lot
+ */
+export interface SourceLot {
+  /** Credit that opened the lot ('carried' for a balance predating the entries) */
+  entryId: string;
+
+  creditedAt: Date;
+
+  expiresAt: Date | null;
+
+  /** Points the debit took from the lot */
+  consumed: number;
+}
+
+/**
+ * How long one earned lot waited for its first redemption
+ */
+export interface RedemptionLatency {
+  /** Credit that opened the lot */
+  entryId: string;
+
+  creditedAt: Date;
+
+  /** Points credited */
+  amount: number;
+
+  /** Timestamp of the first redemption that took points from the lot; null if none has */
+  redeemedAt: Date | null;
+
+  /** redeemedAt - creditedAt in milliseconds; null if the lot was never redeemed */
+  latencyMs: number | null;
+}
+
+/**
+ * Project a user's lots from their available-balance entries
+ * Entries may arrive in any order; they are replayed by (timestamp, entryId).
+ */
+export function projectExpiryLots(entries: LedgerEntry[]): ExpiryLot[] {
+  return replay(entries).lots.filter(lot => lot.remaining > 0);
+}
+
+/**
+ * Lots a debit drew down, oldest first, after every earlier debit took its share
+ * Points no lot covered (an overdraft) are not listed. Null when the debit
+ * is not among the entries.
+ */
+export function consumedLots(entries: LedgerEntry[], debitEntryId: string): SourceLot[] | null {
+  const { taken } = replay(entries, debitEntryId);
+  return taken && taken.map(({ lot, amount }) => ({
+    entryId: lot.entryId,
+    creditedAt: lot.creditedAt,
+    expiresAt: lot.expiresAt,
+    consumed: amount,
+  }));
+}
+
+/**
+ * Time from each earned lot's credit to the first redemption drawing on
+ * it under FIFO, oldest lot first. Debits with other reasons (expiries,
+ * adjustments) still consume lots but are not redemptions. The carried-in
+ * balance is not an earned lot and is not listed.
+ *
+ * @param redemptionReasons Debit reasons counted as redemptions
+ */
+export function redemptionLatencies(entries: LedgerEntry[], redemptionReasons: readonly string[]): RedemptionLatency[] {
+  const firstRedeemed = new Map<ExpiryLot, Date>();
+  const { lots } = replay(entries, undefined, (debit, taken) => {
+    if (!redemptionReasons.includes(debit.reason)) {
+      return;
+    }
+    for (const { lot } of taken) {
+      if (!firstRedeemed.has(lot)) {
+        firstRedeemed.set(lot, new Date(debit.timestamp));
+      }
+    }
+  });
+
+  return lots
+    .filter(lot => lot.entryId !== CARRIED_LOT)
+    .map(lot => {
+      const redeemedAt = firstRedeemed.get(lot) ?? null;
+      return {
+        entryId: lot.entryId,
+        creditedAt: lot.creditedAt,
+        amount: lot.amount,
+        redeemedAt,
+        latencyMs: redeemedAt ? redeemedAt.getTime() - lot.creditedAt.getTime() : null,
+      };
+    });
+}
+
+/**
+ * Replay entries into lots, stopping after the debit `stopAt` if given
+ * onDebit sees what each debit took, in replay order.
+ *
+ * @returns Every lot opened, and what the stopping debit took
+ */
+function replay(
+  entries: LedgerEntry[],
+  stopAt?: string,
+  onDebit?: (debit: LedgerEntry, taken: Take[]) => void
+): { lots: ExpiryLot[]; taken: Take[] | null } {
+  const ordered = [...entries].sort(
+    (a, b) =>
+      new Date(a.timestamp).getTime() - new Date(b.timestamp).getTime() ||
+      (a.entryId < b.entryId ? -1 : a.entryId > b.entryId ? 1 : 0)
+  );
+  const lots: ExpiryLot[] = [];
+
+  // A balance carried in before the first entry never expires
+  if (ordered.length > 0 && ordered[0].balanceBefore > 0) {
+    lots.push({
+      entryId: CARRIED_LOT,
+      creditedAt: new Date(ordered[0].timestamp),
+      expiresAt: null,
+      amount: ordered[0].balanceBefore,
+      remaining: ordered[0].balanceBefore,
+    });
+  }
+
+  for (const entry of ordered) {
+    const magnitude = Math.abs(entry.amount);
+
+    if (entry.type === TransactionType.CREDIT) {
+      lots.push({
+        entryId: entry.entryId,
+        creditedAt: new Date(entry.timestamp),
+        expiresAt: entry.metadata?.expiresAt ? new Date(entry.metadata.expiresAt) : null,
+        amount: magnitude,
+        remaining: magnitude,
+      });
+      continue;
+    }
+
+    const taken: Take[] = [];
+    let remaining = magnitude;
+    if (entry.reason === TransactionReason.POINT_EXPIRY) {
+      const through = new Date(entry.metadata?.expiredThrough ?? entry.timestamp);
+      remaining = consume(expiredLots(lots, through), remaining, taken);
+    }
+    consume(lots, remaining, taken);
+    onDebit?.(entry, taken);
+
+    if (entry.entryId === stopAt) {
+      return { lots, taken: mergeTakes(taken, lots) };
+    }
+  }
+
+  return { lots, taken: null };
+}
+
+/**
+ * Lots with points left that expire at or before a cut-off, oldest first
+ */
+export function expiredLots(lots: ExpiryLot[], through: Date): ExpiryLot[] {
+  return lots.filter(lot => lot.remaining > 0 && lot.expiresAt !== null && lot.expiresAt <= through);
+}
+
+/**
+ * Points taken from one lot
+ */
+interface Take {
+  lot: ExpiryLot;
+  amount: number;
+}
+
+/**
+ * Consume an amount from lots in order, recording each take
+ *
+ * @returns The amount the lots could not cover
+ */
+function consume(lots: ExpiryLot[], amount: number, taken: Take[]): number {
+  let remaining = amount;
+  for (const lot of lots) {
+    if (remaining === 0) {
+      break;
+    }
+    const amountTaken = Math.min(lot.remaining, remaining);
+    if (amountTaken > 0) {
+      taken.push({ lot, amount: amountTaken });
+    }
+    lot.remaining -= amountTaken;
+    remaining -= amountTaken;
+  }
+  return remaining;
+}
+
+/**
+ * Combine takes from the same lot (an expiry can reach a lot twice), in lot order
+ */
+function mergeTakes(taken: Take[], lots: ExpiryLot[]): Take[] {
+  const byLot = new Map<ExpiryLot, number>();
+  for (const { lot, amount } of taken) {
+    byLot.set(lot, (byLot.get(lot) || 0) + amount);
+  }
+  return lots.filter(lot => byLot.has(lot)).map(lot => ({ lot, amount: byLot.get(lot)! }));
+}
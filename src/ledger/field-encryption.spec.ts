@@ -0,0 +1,66 @@
+/**
+ * Metadata Encryption Tests
+ */
+
+import { randomBytes } from 'crypto';
+import { MetadataCipher, SEALED_METADATA_FIELD } from './field-encryption';
+
+describe('MetadataCipher', () => {
+  const key = randomBytes(32);
+  const cipher = new MetadataCipher({ key });
+  const metadata = { comment: 'refund for order 1234', tags: ['vip'], score: 7, committedBy: 'ops:alice' };
+
+  it('round-trips metadata, sealing all but the clear keys', () => {
+    const stored = cipher.seal(metadata, 'entry-1')!;
+
+    expect(Object.keys(stored).sort()).toEqual([SEALED_METADATA_FIELD, 'committedBy']);
+    expect(stored.committedBy).toBe('ops:alice');
+    expect(JSON.stringify(stored)).not.toContain('refund');
+    expect(cipher.open(stored, 'entry-1')).toEqual(metadata);
+  });
+
+  it('uses a fresh nonce for every seal', () => {
+    const first = cipher.seal(metadata, 'entry-1')!;
+    const second = cipher.seal(metadata, 'entry-1')!;
+
+    expect(first[SEALED_METADATA_FIELD]).not.toBe(second[SEALED_METADATA_FIELD]);
+  });
+
+  it('fails loudly with the wrong key', () => {
+    const stored = cipher.seal(metadata, 'entry-1');
+
+    expect(() => new MetadataCipher({ key: randomBytes(32) }).open(stored, 'entry-1')).toThrow(
+      'Cannot decrypt metadata of entry entry-1: wrong key or altered data'
+    );
+  });
+
+  it('rejects sealed metadata moved to another entry or altered', () => {
+    const stored = cipher.seal(metadata, 'entry-1')!;
+    const parts = stored[SEALED_METADATA_FIELD].split('.');
+    const flipped = Buffer.from(parts[3], 'base64');
+    flipped[0] ^= 1;
+    parts[3] = flipped.toString('base64');
+
+    expect(() => cipher.open(stored, 'entry-2')).toThrow('wrong key or altered data');
+    expect(() => cipher.open({ ...stored, [SEALED_METADATA_FIELD]: parts.join('.') }, 'entry-1')).toThrow('altered data');
+    expect(() => cipher.open({ [SEALED_METADATA_FIELD]: 'v9.a.b.c' }, 'entry-1')).toThrow('unknown sealed format');
+  });
+
+  it('leaves clear-only and unsealed metadata as it is', () => {
+    expect(cipher.seal({ committedBy: 'svc:earn' }, 'entry-1')).toEqual({ committedBy: 'svc:earn' });
+    expect(cipher.seal(undefined, 'entry-1')).toBeUndefined();
+    expect(cipher.open({ comment: 'written before encryption' }, 'entry-1')).toEqual({ comment: 'written before encryption' });
+  });
+
+  it('honours custom clear keys alongside the required ones', () => {
+    const custom = new MetadataCipher({ key, clearKeys: ['score'] });
+    const stored = custom.seal({ ...metadata, correctionOf: 'tx-1' }, 'entry-1')!;
+
+    expect(Object.keys(stored).sort()).toEqual([SEALED_METADATA_FIELD, 'committedBy', 'correctionOf', 'score']);
+    expect(custom.isClear('originalTransactionId')).toBe(true);
+  });
+
+  it('rejects a key that is not 256 bits', () => {
+    expect(() => new MetadataCipher({ key: randomBytes(16) })).toThrow('must be 32 bytes');
+  });
+});
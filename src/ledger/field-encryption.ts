@@ -0,0 +1,142 @@
+/**
+ * Metadata Encryption at Rest
+ *
+ * Field-level encryption of entry metadata (comments and tags) for the
+ * durable store. A MetadataCipher seals every metadata key except a
+ * short list of clear keys into one AES-256-GCM ciphertext before the
+ * entry is written, and opens it when the entry is read. Structural
+ * fields (IDs, account, amount, type, timestamps) are never touched, so
+ * every index keeps working, and the clear keys are the metadata fields
+ * the store itself queries: the committer and the links between entries.
+ *
+ * The entry ID is bound in as additional authenticated data, so sealed
+ * metadata cannot be moved onto another entry. Opening with the wrong
+ * key, or opening altered data, throws rather than returning garbage.
+ * Entries written before encryption was enabled carry no sealed field
+ * and are read as they are.
+ */
+
+import { createCipheriv, createDecipheriv, randomBytes } from 'crypto';
+
+/**
+ * Metadata field holding the sealed keys
+ */
+export const SEALED_METADATA_FIELD = '_sealed';
+
+/**
+ * Metadata keys always left in clear, because the store queries them
+ */
+export const REQUIRED_CLEAR_METADATA_KEYS = [
+  'committedBy',
+  'correctionOf',
+  'recreditOf',
+  'originalTransactionId',
+  'parentEntryId',
+];
+
+const SEAL_VERSION = 'v1';
+const KEY_BYTES = 32;
+const IV_BYTES = 12;
+
+export interface MetadataCipherOptions {
+  /** 256-bit AES key */
+  key: Buffer;
+
+  /** Metadata keys stored in clear besides REQUIRED_CLEAR_METADATA_KEYS */
+  clearKeys?: string[];
+}
+
+/**
+ * Seals and opens entry metadata with AES-256-GCM
+ */
+export class MetadataCipher {
+  private key: Buffer;
+  private clearKeys: Set<string>;
+
+  /**
+   * @throws Error if the key is not 32 bytes
+   */
+  constructor(options: MetadataCipherOptions) {
+    if (options.key.length !== KEY_BYTES) {
+      throw new Error(`Metadata encryption key must be ${KEY_BYTES} bytes, got ${options.key.length}`);
+    }
+    this.key = Buffer.from(options.key);
+    this.clearKeys = new Set([...REQUIRED_CLEAR_METADATA_KEYS, ...(options.clearKeys ?? [])]);
+  }
+
+  /**
+   * Whether a metadata key is stored in clear
+   */
+  isClear(key: string): boolean {
+    return this.clearKeys.has(key);
+  }
+
+  /**
+   * Metadata as stored: clear keys as given, the rest sealed into one field
+   */
+  seal(metadata: Record<string, any> | undefined, entryId: string): Record<string, any> | undefined {
+    if (!metadata) {
+      return metadata;
+    }
+
+    const stored: Record<string, any> = {};
+    const sealed: Record<string, any> = {};
+    for (const [key, value] of Object.entries(metadata)) {
+      if (this.clearKeys.has(key)) {
+        stored[key] = value;
+      } else {
+        sealed[key] = value;
+      }
+    }
+    if (Object.keys(sealed).length === 0) {
+      return stored;
+    }
+
+    const iv = randomBytes(IV_BYTES);
+    const cipher = createCipheriv('aes-256-gcm', this.key, iv);
+    cipher.setAAD(Buffer.from(entryId, 'utf8'));
+    const ciphertext = Buffer.concat([cipher.update(JSON.stringify(sealed), 'utf8'), cipher.final()]);
+
+    stored[SEALED_METADATA_FIELD] = [SEAL_VERSION, iv, cipher.getAuthTag(), ciphertext]
+      .map(part => (typeof part === 'string' ? part : part.toString('base64')))
+      .join('.');
+    return stored;
+  }
+
+  /**
+   * Metadata as written, from its stored form
+   *
+   * @throws Error if the sealed field cannot be decrypted with this key
+   */
+  open(metadata: Record<string, any> | undefined, entryId: string): Record<string, any> | undefined {
+    if (!metadata || metadata[SEALED_METADATA_FIELD] === undefined) {
+      return metadata;
+    }
+
+    const { [SEALED_METADATA_FIELD]: sealed, ...clear } = metadata;
+    const [version, iv, tag, ciphertext] = String(sealed).split('.');
+    if (version !== SEAL_VERSION || ciphertext === undefined) {
+      throw new Error(`Cannot decrypt metadata of entry ${entryId}: unknown sealed format`);
+    }
+
+    let opened: Record<string, any>;
+    try {
+      const decipher = createDecipheriv('aes-256-gcm', this.key, Buffer.from(iv, 'base64'));
+      decipher.setAAD(Buffer.from(entryId, 'utf8'));
+      decipher.setAuthTag(Buffer.from(tag, 'base64'));
+      const plaintext = Buffer.concat([decipher.update(Buffer.from(ciphertext, 'base64')), decipher.final()]);
+      opened = JSON.parse(plaintext.toString('utf8'));
+    } catch {
+      throw new Error(`Cannot decrypt metadata of entry ${entryId}: wrong key or altered data`);
+    }
+
+    return { ...opened, ...clear };
+  }
+}
+
+/**
+ * Factory function to create a metadata cipher
+ */
+export function createMetadataCipher(options: MetadataCipherOptions): MetadataCipher {
+  return new MetadataCipher(options);
+}
@@ -0,0 +1,125 @@
+/**
+ * Liability Forecast Tests
+ *
+ * Golden test against the fixture ledger in __fixtures__/forecast, plus
+ * cohort allocation and model plug-in behaviour.
+ */
+
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import {
+  generateForecast,
+  TrailingAverageModel,
+  ForecastModel,
+  CohortHistory,
+} from './forecast';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+
+const loadFixture = (name: string) =>
+  JSON.parse(readFileSync(join(__dirname, '__fixtures__', 'forecast', `${name}.json`), 'utf8'));
+
+describe('generateForecast', () => {
+  const ledgerOf = (entries: Partial<LedgerEntry>[]): jest.Mocked<ILedgerService> => ({
+    createEntry: jest.fn(),
+    queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+      const offset = filter.offset || 0;
+      const limit = filter.limit || 100;
+      return {
+        entries: entries.slice(offset, offset + limit),
+        totalCount: entries.length,
+        offset,
+        limit,
+        hasMore: offset + limit < entries.length,
+      };
+    }),
+    getEntry: jest.fn(),
+    getBalanceSnapshot: jest.fn(),
+    generateReconciliationReport: jest.fn(),
+    getAuditTrail: jest.fn(),
+    checkIdempotency: jest.fn(),
+    storeIdempotencyResult: jest.fn(),
+  } as any);
+
+  it('should match the golden trailing-average forecast', async () => {
+    const fixture = loadFixture('cohorts');
+    const asOf = new Date(fixture.asOf);
+
+    const report = await generateForecast(ledgerOf(fixture.entries), {
+      asOf,
+      horizonMonths: fixture.horizonMonths,
+      model: new TrailingAverageModel(),
+    });
+
+    expect(report).toEqual({ asOf, ...fixture.expected });
+  });
+
+  it('should hand the model per-age cohort observations for completed months', async () => {
+    const fixture = loadFixture('cohorts');
+    let seen: CohortHistory | undefined;
+    const model: ForecastModel = {
+      name: 'capture',
+      rates: (_age, history) => {
+        seen = history;
+        return { redemption: 0, expiration: 0 };
+      },
+    };
+
+    const report = await generateForecast(ledgerOf(fixture.entries), {
+      asOf: new Date(fixture.asOf),
+      horizonMonths: 1,
+      model,
+    });
+
+    expect(seen!.asOfMonth).toBe('2024-04');
+    expect(seen!.observations).toEqual([
+      { cohortMonth: '2024-01', month: '2024-01', age: 0, outstandingStart: 1000, redeemed: 100, expired: 0 },
+      { cohortMonth: '2024-01', month: '2024-02', age: 1, outstandingStart: 900, redeemed: 180, expired: 0 },
+      { cohortMonth: '2024-01', month: '2024-03', age: 2, outstandingStart: 720, redeemed: 0, expired: 72 },
+      { cohortMonth: '2024-02', month: '2024-02', age: 0, outstandingStart: 500, redeemed: 50, expired: 0 },
+      { cohortMonth: '2024-02', month: '2024-03', age: 1, outstandingStart: 450, redeemed: 90, expired: 0 },
+    ]);
+    expect(report.months[0]).toEqual({
+      month: '2024-05',
+      expectedRedemptions: 0,
+      expectedExpirations: 0,
+      projectedOutstanding: 1208,
+    });
+  });
+
+  it('should consume the oldest cohort first', async () => {
+    const report = await generateForecast(
+      ledgerOf([
+        { accountId: 'user-1', amount: 100, type: 'credit', reason: 'promotional_award', balanceBefore: 0, timestamp: new Date('2024-01-10T00:00:00Z') },
+        { accountId: 'user-1', amount: 100, type: 'credit', reason: 'promotional_award', balanceBefore: 100, timestamp: new Date('2024-02-10T00:00:00Z') },
+        { accountId: 'user-1', amount: -150, type: 'debit', reason: 'chip_menu_purchase', balanceBefore: 200, timestamp: new Date('2024-03-10T00:00:00Z') },
+      ] as any),
+      { asOf: new Date('2024-03-31T00:00:00Z'), horizonMonths: 1, model: new TrailingAverageModel() }
+    );
+
+    expect(report.outstandingByCohort).toEqual({ '2024-02': 50 });
+    expect(report.currentOutstanding).toBe(50);
+  });
+
+  it('should ignore observations outside the trailing window', () => {
+    const model = new TrailingAverageModel({ trailingMonths: 1 });
+    const history: CohortHistory = {
+      asOfMonth: '2024-04',
+      observations: [
+        { cohortMonth: '2024-01', month: '2024-01', age: 0, outstandingStart: 100, redeemed: 90, expired: 0 },
+        { cohortMonth: '2024-03', month: '2024-03', age: 0, outstandingStart: 100, redeemed: 10, expired: 5 },
+      ],
+    };
+
+    expect(model.rates(0, history)).toEqual({ redemption: 0.1, expiration: 0.05 });
+    expect(model.rates(0, { asOfMonth: '2024-04', observations: [] })).toEqual({
+      redemption: 0,
+      expiration: 0,
+    });
+  });
+
+  it('should reject a non-positive horizon', async () => {
+    await expect(
+      generateForecast(ledgerOf([]), { horizonMonths: 0, model: new TrailingAverageModel() })
+    ).rejects.toThrow('horizonMonths must be a positive integer');
+  });
+});
@@ -0,0 +1,417 @@
+/**
+ * Liability Forecast
+ *
+ * Projects expected redemptions and expirations of currently outstanding
+ * points over the coming months. Every figure in the report is an
+ * ESTIMATE derived from historical behaviour, not a liability amount.
+ *
+ * Points are grouped into cohorts by the UTC month they were credited.
+ * Each user's debits consume their credits first-in first-out, which
+ * gives, per cohort and cohort age (months since issuance), how much
+ * was redeemed or expired and how much was still outstanding. A
+ * ForecastModel turns that history into monthly rates per age; the
+ * forecast applies them to each cohort's outstanding balance month by
+ * month. Forecast months start with the month after asOf.
+ *
+ * The result is deterministic for a given ledger, asOf and model.
+ */
+
+import { ILedgerService, LedgerEntry } from './types';
+import { TransactionType, TransactionReason, REDEMPTION_REASONS } from '../wallets/types';
+
+/**
+ * One cohort's behaviour during one completed month of its life
+ */
+export interface CohortObservation {
+  /** Month the cohort's points were credited (YYYY-MM) */
+  cohortMonth: string;
+
+  /** Month observed (YYYY-MM) */
+  month: string;
+
+  /** Months since issuance (0 = the issuance month) */
+  age: number;
+
+  /** Points outstanding at the start of the month */
+  outstandingStart: number;
+
+  /** Points redeemed during the month */
+  redeemed: number;
+
+  /** Points expired during the month */
+  expired: number;
+}
+
+/**
+ * History handed to a forecast model
+ */
+export interface CohortHistory {
+  /** Month containing asOf (YYYY-MM); observations cover earlier months only */
+  asOfMonth: string;
+
+  observations: CohortObservation[];
+}
+
+/**
+ * Monthly rates expected for a cohort at a given age
+ */
+export interface ForecastRates {
+  /** Fraction of outstanding points redeemed in the month */
+  redemption: number;
+
+  /** Fraction of outstanding points expired in the month */
+  expiration: number;
+}
+
+/**
+ * Estimator of monthly redemption and expiration rates
+ * Implement this to plug in a better model.
+ */
+export interface ForecastModel {
+  /** Model name recorded in the report */
+  readonly name: string;
+
+  /**
+   * Expected rates for a cohort at the given age
+   */
+  rates(age: number, history: CohortHistory): ForecastRates;
+}
+
+/**
+ * One forecast month
+ */
+export interface ForecastMonth {
+  /** Calendar month (YYYY-MM) */
+  month: string;
+
+  /** Estimated points redeemed during the month */
+  expectedRedemptions: number;
+
+  /** Estimated points expired during the month */
+  expectedExpirations: number;
+
+  /** Estimated points still outstanding at the end of the month */
+  projectedOutstanding: number;
+}
+
+/**
+ * Liability forecast report - all projected values are estimates
+ */
+export interface ForecastReport {
+  /** Ledger cut-off the forecast is based on (inclusive) */
+  asOf: Date;
+
+  /** Forecast model used */
+  model: string;
+
+  /** Always true: projected figures are statistical estimates */
+  isEstimate: true;
+
+  /** Points outstanding at asOf */
+  currentOutstanding: number;
+
+  /** Outstanding points per cohort month at asOf */
+  outstandingByCohort: Record<string, number>;
+
+  /** Month-by-month projection */
+  months: ForecastMonth[];
+}
+
+/**
+ * Options for generating a forecast
+ */
+export interface ForecastOptions {
+  /** Ledger cut-off (defaults to now) */
+  asOf?: Date;
+
+  /** Number of months to project */
+  horizonMonths: number;
+
+  /** Rate estimator */
+  model: ForecastModel;
+}
+
+/**
+ * Configuration for the trailing-average model
+ */
+export interface TrailingAverageConfig {
+  /** Completed months before asOf whose observations are averaged */
+  trailingMonths: number;
+}
+
+/**
+ * Trailing-average model
+ *
+ * The rate for an age is total points redeemed (or expired) at that age
+ * divided by total points outstanding at the start of that age, over
+ * observations in the trailing window. Ages with no observations fall
+ * back to the pooled rate across all ages in the window, and to zero
+ * when the window is empty.
+ */
+export class TrailingAverageModel implements ForecastModel {
+  readonly name = 'trailing-average';
+  private config: TrailingAverageConfig;
+
+  constructor(config: Partial<TrailingAverageConfig> = {}) {
+    this.config = { trailingMonths: 12, ...config };
+  }
+
+  rates(age: number, history: CohortHistory): ForecastRates {
+    const end = monthIndex(history.asOfMonth);
+    const window = history.observations.filter(obs => {
+      const index = monthIndex(obs.month);
+      return index < end && index >= end - this.config.trailingMonths && obs.outstandingStart > 0;
+    });
+
+    const atAge = window.filter(obs => obs.age === age);
+    return weightedRates(atAge.length > 0 ? atAge : window);
+  }
+}
+
+/**
+ * Page size used when reading the ledger
+ */
+const PAGE_SIZE = 1000;
+
+interface Lot {
+  cohort: string;
+  remaining: number;
+}
+
+interface CohortUsage {
+  issued: number;
+  /** Consumption keyed by age */
+  redeemed: Map<number, number>;
+  expired: Map<number, number>;
+  other: Map<number, number>;
+}
+
+/**
+ * Forecast redemptions and expirations of outstanding points
+ */
+export async function generateForecast(
+  ledgerService: ILedgerService,
+  options: ForecastOptions
+): Promise<ForecastReport> {
+  if (!Number.isInteger(options.horizonMonths) || options.horizonMonths < 1) {
+    throw new Error('horizonMonths must be a positive integer');
+  }
+
+  const asOf = options.asOf ?? new Date();
+  const asOfMonth = monthKey(asOf);
+  const lots = new Map<string, Lot[]>();
+  const cohorts = new Map<string, CohortUsage>();
+
+  let offset = 0;
+  let hasMore = true;
+
+  while (hasMore) {
+    const result = await ledgerService.queryEntries({
+      accountType: 'user',
+      balanceState: 'available',
+      endDate: asOf,
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset,
+      limit: PAGE_SIZE,
+    });
+
+    for (const entry of result.entries) {
+      applyEntry(entry, lots, cohorts);
+    }
+
+    offset += result.entries.length;
+    hasMore = result.hasMore && result.entries.length > 0;
+  }
+
+  const history: CohortHistory = {
+    asOfMonth,
+    observations: buildObservations(cohorts, asOfMonth),
+  };
+
+  // Outstanding by cohort, in cohort order so float sums are deterministic
+  const outstanding = new Map<string, number>();
+  for (const userLots of lots.values()) {
+    for (const lot of userLots) {
+      outstanding.set(lot.cohort, (outstanding.get(lot.cohort) || 0) + lot.remaining);
+    }
+  }
+  const cohortKeys = [...outstanding.keys()].sort();
+  const balances = cohortKeys.map(cohort => outstanding.get(cohort)!);
+
+  const months: ForecastMonth[] = [];
+  const asOfIndex = monthIndex(asOfMonth);
+
+  for (let m = 1; m <= options.horizonMonths; m++) {
+    let redemptions = 0;
+    let expirations = 0;
+
+    cohortKeys.forEach((cohort, i) => {
+      const age = asOfIndex + m - monthIndex(cohort);
+      const rates = options.model.rates(age, history);
+      const redeemed = balances[i] * clampRate(rates.redemption);
+      const expired = Math.min(balances[i] - redeemed, balances[i] * clampRate(rates.expiration));
+      balances[i] -= redeemed + expired;
+      redemptions += redeemed;
+      expirations += expired;
+    });
+
+    months.push({
+      month: monthLabel(asOfIndex + m),
+      expectedRedemptions: Math.round(redemptions),
+      expectedExpirations: Math.round(expirations),
+      projectedOutstanding: Math.round(balances.reduce((sum, b) => sum + b, 0)),
+    });
+  }
+
+  const outstandingByCohort: Record<string, number> = {};
+  for (const cohort of cohortKeys) {
+    outstandingByCohort[cohort] = outstanding.get(cohort)!;
+  }
+
+  return {
+    asOf,
+    model: options.model.name,
+    isEstimate: true,
+    currentOutstanding: cohortKeys.reduce((sum, cohort) => sum + outstanding.get(cohort)!, 0),
+    outstandingByCohort,
+    months,
+  };
+}
+
+/**
+ * Fold one entry into user lots and cohort usage
+ */
+function applyEntry(entry: LedgerEntry, lots: Map<string, Lot[]>, cohorts: Map<string, CohortUsage>): void {
+  const month = monthKey(new Date(entry.timestamp));
+  let userLots = lots.get(entry.accountId);
+
+  if (!userLots) {
+    userLots = [];
+    lots.set(entry.accountId, userLots);
+
+    // A balance carried in before the first entry becomes a lot of that month
+    if (entry.balanceBefore > 0) {
+      addLot(userLots, cohorts, month, entry.balanceBefore);
+    }
+  }
+
+  const magnitude = Math.abs(entry.amount);
+
+  if (entry.type === TransactionType.CREDIT) {
+    addLot(userLots, cohorts, month, magnitude);
+    return;
+  }
+
+  const kind = REDEMPTION_REASONS.includes(entry.reason)
+    ? 'redeemed'
+    : entry.reason === TransactionReason.POINT_EXPIRY
+      ? 'expired'
+      : 'other';
+
+  let remaining = magnitude;
+  while (remaining > 0 && userLots.length > 0) {
+    const lot = userLots[0];
+    const taken = Math.min(lot.remaining, remaining);
+    const usage = cohorts.get(lot.cohort)!;
+    const age = monthIndex(month) - monthIndex(lot.cohort);
+    usage[kind].set(age, (usage[kind].get(age) || 0) + taken);
+
+    lot.remaining -= taken;
+    remaining -= taken;
+    if (lot.remaining === 0) {
+      userLots.shift();
+    }
+  }
+}
+
+function addLot(userLots: Lot[], cohorts: Map<string, CohortUsage>, cohort: string, amount: number): void {
+  const last = userLots[userLots.length - 1];
+  if (last && last.cohort === cohort) {
+    last.remaining += amount;
+  } else {
+    userLots.push({ cohort, remaining: amount });
+  }
+
+  let usage = cohorts.get(cohort);
+  if (!usage) {
+    usage = { issued: 0, redeemed: new Map(), expired: new Map(), other: new Map() };
+    cohorts.set(cohort, usage);
+  }
+  usage.issued += amount;
+}
+
+/**
+ * Build per-cohort, per-age observations for months completed before asOf
+ */
+function buildObservations(cohorts: Map<string, CohortUsage>, asOfMonth: string): CohortObservation[] {
+  const observations: CohortObservation[] = [];
+  const end = monthIndex(asOfMonth);
+
+  for (const cohort of [...cohorts.keys()].sort()) {
+    const usage = cohorts.get(cohort)!;
+    const start = monthIndex(cohort);
+    let outstandingStart = usage.issued;
+
+    for (let index = start; index < end; index++) {
+      const age = index - start;
+      const redeemed = usage.redeemed.get(age) || 0;
+      const expired = usage.expired.get(age) || 0;
+      observations.push({
+        cohortMonth: cohort,
+        month: monthLabel(index),
+        age,
+        outstandingStart,
+        redeemed,
+        expired,
+      });
+      outstandingStart -= redeemed + expired + (usage.other.get(age) || 0);
+    }
+  }
+
+  return observations;
+}
+
+function weightedRates(observations: CohortObservation[]): ForecastRates {
+  let outstanding = 0;
+  let redeemed = 0;
+  let expired = 0;
+
+  for (const obs of observations) {
+    outstanding += obs.outstandingStart;
+    redeemed += obs.redeemed;
+    expired += obs.expired;
+  }
+
+  if (outstanding === 0) {
+    return { redemption: 0, expiration: 0 };
+  }
+
+  return { redemption: redeemed / outstanding, expiration: expired / outstanding };
+}
+
+function clampRate(rate: number): number {
+  return Number.isFinite(rate) ? Math.min(1, Math.max(0, rate)) : 0;
+}
+
+function monthKey(date: Date): string {
+  return date.toISOString().slice(0, 7);
+}
+
+function monthIndex(month: string): number {
+  const [year, mon] = month.split('-').map(Number);
+  return year * 12 + (mon - 1);
+}
+
+function monthLabel(index: number): string {
+  const year = Math.floor(index / 12);
+  const mon = (index % 12) + 1;
+  return `${year}-${String(mon).padStart(2, '0')}`;
+}
+
+/**
+ * Factory function to create the default trailing-average model
+ */
+export function createTrailingAverageModel(config?: Partial<TrailingAverageConfig>): TrailingAverageModel {
+  return new TrailingAverageModel(config);
+}
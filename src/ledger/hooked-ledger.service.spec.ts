@@ -0,0 +1,186 @@
+/**
+ * Hooked Ledger Service Tests
+ */
+
+import { HookedLedgerService, HookedInnerLedger, asyncAppendHook } from './hooked-ledger.service';
+import { LedgerEntry, CreateLedgerEntryRequest } from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+import {
+  AppendErrorCode,
+  DuplicateReferenceError,
+  RedemptionVelocityError,
+  InsufficientBalanceError,
+  findErrorCause,
+} from '../services/types';
+
+describe('HookedLedgerService', () => {
+  let inner: jest.Mocked<HookedInnerLedger>;
+  let service: HookedLedgerService;
+
+  const request = { accountId: 'user-123', amount: 100 } as CreateLedgerEntryRequest;
+  const entry = { entryId: 'entry-1', accountId: 'user-123', amount: 100 } as LedgerEntry;
+
+  beforeEach(() => {
+    inner = {
+      createEntry: jest.fn(),
+      createEntryWithResult: jest.fn().mockResolvedValue({ entry, inserted: true }),
+      queryEntries: jest.fn(),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+    service = new HookedLedgerService(inner);
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should run hooks in registration order around the append', async () => {
+    const calls: string[] = [];
+    inner.createEntryWithResult.mockImplementation(async () => {
+      calls.push('append');
+      return { entry, inserted: true };
+    });
+    service.registerHook({
+      name: 'first',
+      beforeAppend: () => { calls.push('first.before'); },
+      afterAppend: () => { calls.push('first.after'); },
+    });
+    service.registerHook({
+      name: 'second',
+      beforeAppend: () => { calls.push('second.before'); },
+      afterAppend: () => { calls.push('second.after'); },
+    });
+
+    await service.createEntry(request);
+
+    expect(calls).toEqual([
+      'first.before',
+      'second.before',
+      'append',
+      'first.after',
+      'second.after',
+    ]);
+  });
+
+  it('should let beforeAppend veto the append', async () => {
+    service.registerHook({
+      name: 'fraud-scan',
+      beforeAppend: () => { throw new Error('Rejected by fraud scan'); },
+    });
+
+    await expect(service.createEntry(request)).rejects.toThrow('Rejected by fraud scan');
+    expect(inner.createEntryWithResult).not.toHaveBeenCalled();
+  });
+
+  it.each([
+    [AppendErrorCode.DUPLICATE, new DuplicateReferenceError('user-123', 'kiosk-1', new Date()), DuplicateReferenceError],
+    [AppendErrorCode.RATE_LIMITED, new RedemptionVelocityError('user-123', 'per-minute', 5, 6), RedemptionVelocityError],
+    [AppendErrorCode.OVERDRAFT, new InsufficientBalanceError(100, 40), InsufficientBalanceError],
+  ] as const)('should report a %s hook rejection as an append error', async (code, cause, type) => {
+    service.registerHook({
+      name: 'guard',
+      beforeAppend: () => { throw cause; },
+    });
+
+    const error = await service.createEntry({ ...request, idempotencyKey: 'idem-1' }).catch(e => e);
+
+    expect(error.appendCode).toBe(code);
+    expect(error.idempotencyKey).toBe('idem-1');
+    expect(error.statusCode).toBe(cause.statusCode);
+    expect(findErrorCause(error, type as any)).toBe(cause);
+  });
+
+  it('should pass inner append failures through unchanged', async () => {
+    const failure = new Error('inner failure');
+    inner.createEntryWithResult.mockRejectedValue(failure);
+
+    await expect(service.createEntry(request)).rejects.toBe(failure);
+  });
+
+  it('should not notify afterAppend when the append replayed an existing entry', async () => {
+    const afterAppend = jest.fn();
+    service.registerHook({ name: 'projection', afterAppend });
+    inner.createEntryWithResult.mockResolvedValue({ entry, inserted: false });
+
+    await expect(service.createEntry(request)).resolves.toBe(entry);
+    await expect(service.createEntryWithResult(request)).resolves.toEqual({ entry, inserted: false });
+    expect(afterAppend).not.toHaveBeenCalled();
+  });
+
+  it('should isolate afterAppend failures from the append and later hooks', async () => {
+    const counter = jest.spyOn(MetricsLogger, 'incrementCounter');
+    const later = jest.fn();
+    service.registerHook({
+      name: 'broken',
+      afterAppend: () => { throw new Error('boom'); },
+    });
+    service.registerHook({ name: 'later', afterAppend: later });
+
+    await expect(service.createEntry(request)).resolves.toBe(entry);
+    expect(later).toHaveBeenCalledWith(entry);
+    expect(counter).toHaveBeenCalledWith(
+      MetricEventType.LEDGER_HOOK_ERROR,
+      expect.objectContaining({ hook: 'broken' })
+    );
+  });
+
+  it('should alert on slow hooks', async () => {
+    const alert = jest.spyOn(MetricsLogger, 'logAlert');
+    const slow = new HookedLedgerService(inner, { slowHookThresholdMs: 5 });
+    slow.registerHook({
+      name: 'slow',
+      afterAppend: () => new Promise(resolve => setTimeout(resolve, 20)),
+    });
+
+    await slow.createEntry(request);
+
+    expect(alert).toHaveBeenCalledWith(
+      expect.objectContaining({ metricType: MetricEventType.LEDGER_HOOK_SLOW })
+    );
+  });
+
+  it('should stop calling a hook once unregistered', async () => {
+    const afterAppend = jest.fn();
+    const unregister = service.registerHook({ name: 'temp', afterAppend });
+
+    unregister();
+    await service.createEntry(request);
+
+    expect(afterAppend).not.toHaveBeenCalled();
+  });
+
+  it('should not wait for async-adapted hooks', async () => {
+    let release!: () => void;
+    const afterAppend = jest.fn(() => new Promise<void>(resolve => { release = resolve; }));
+    service.registerHook(asyncAppendHook({ name: 'notifier', afterAppend }));
+
+    await expect(service.createEntry(request)).resolves.toBe(entry);
+    await new Promise(resolve => setImmediate(resolve));
+
+    expect(afterAppend).toHaveBeenCalledWith(entry);
+    release();
+  });
+
+  it('should defer an async-adapted afterBatchAppend and report its failures as async', async () => {
+    const counter = jest.spyOn(MetricsLogger, 'incrementCounter');
+    const afterBatchAppend = jest.fn().mockRejectedValue(new Error('bus down'));
+    const hook = asyncAppendHook({ name: 'batch-publisher', afterBatchAppend });
+
+    hook.afterBatchAppend!([entry]);
+    expect(afterBatchAppend).not.toHaveBeenCalled();
+
+    await new Promise(resolve => setImmediate(resolve));
+    await new Promise(resolve => setImmediate(resolve));
+
+    expect(afterBatchAppend).toHaveBeenCalledWith([entry]);
+    expect(counter).toHaveBeenCalledWith(
+      MetricEventType.LEDGER_HOOK_ERROR,
+      expect.objectContaining({ hook: 'batch-publisher', phase: 'afterBatchAppend', entryCount: 1, async: true })
+    );
+  });
+});
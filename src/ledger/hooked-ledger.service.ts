@@ -0,0 +1,257 @@
+/**
+ * Hooked Ledger Service
+ *
+ * Wraps an ILedgerService and notifies registered LedgerAppendHooks of
+ * each append, so projections such as balance caches, notifications and
+ * fraud scans can observe the ledger without each needing its own
+ * wrapper. Hooks run in registration order.
+ *
+ * Every hook invocation is timed; hooks exceeding slowHookThresholdMs
+ * raise a warning alert. afterAppend failures are reported and swallowed
+ * so an observer can never corrupt or fail a committed append.
+ *
+ * afterAppend fires only for entries the append actually inserted. An
+ * idempotent replay returns the existing entry without notifying, so a
+ * retried request is never observed twice.
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  CreateLedgerEntryResult,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+  LedgerAppendHook,
+} from './types';
+import { LedgerService } from './ledger.service';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+import { LedgerAppendError } from '../services/types';
+
+/**
+ * Configuration for the hooked ledger service
+ */
+export interface HookedLedgerConfig {
+  /** Hook duration above which a slow-hook alert is raised */
+  slowHookThresholdMs: number;
+}
+
+const DEFAULT_CONFIG: HookedLedgerConfig = {
+  slowHookThresholdMs: 100,
+};
+
+/**
+ * Ledger wrapped by the hooked ledger service
+ */
+export type HookedInnerLedger = ILedgerService & Pick<LedgerService, 'createEntryWithResult'>;
+
+/**
+ * HookedLedgerService implementation
+ */
+export class HookedLedgerService implements ILedgerService {
+  private inner: HookedInnerLedger;
+  private config: HookedLedgerConfig;
+  private hooks: LedgerAppendHook[] = [];
+
+  constructor(inner: HookedInnerLedger, config: Partial<HookedLedgerConfig> = {}) {
+    this.inner = inner;
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
+  /**
+   * Register a hook; hooks run in registration order
+   * @returns Function that unregisters the hook
+   */
+  registerHook(hook: LedgerAppendHook): () => void {
+    this.hooks.push(hook);
+    return () => {
+      this.hooks = this.hooks.filter(h => h !== hook);
+    };
+  }
+
+  /**
+   * Run beforeAppend hooks, append, then notify afterAppend hooks
+   *
+   * @throws LedgerAppendError if a beforeAppend hook rejects the entry
+   */
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return (await this.createEntryWithResult(request)).entry;
+  }
+
+  /**
+   * As createEntry, also reporting whether the entry was newly inserted
+   * afterAppend hooks are notified only when it was.
+   *
+   * @throws LedgerAppendError if a beforeAppend hook rejects the entry
+   */
+  async createEntryWithResult(request: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult> {
+    for (const hook of [...this.hooks]) {
+      if (hook.beforeAppend) {
+        const beforeAppend = hook.beforeAppend.bind(hook);
+        try {
+          await this.timeHook(hook, 'beforeAppend', () => beforeAppend(request));
+        } catch (error) {
+          throw LedgerAppendError.from(error, request);
+        }
+      }
+    }
+
+    const result = await this.inner.createEntryWithResult(request);
+    if (!result.inserted) {
+      return result;
+    }
+
+    const entry = result.entry;
+    for (const hook of [...this.hooks]) {
+      if (!hook.afterAppend) {
+        continue;
+      }
+
+      const afterAppend = hook.afterAppend.bind(hook);
+      try {
+        await this.timeHook(hook, 'afterAppend', () => afterAppend(entry));
+      } catch (error) {
+        MetricsLogger.incrementCounter(MetricEventType.LEDGER_HOOK_ERROR, {
+          hook: hook.name,
+          phase: 'afterAppend',
+          entryId: entry.entryId,
+          error: error instanceof Error ? error.message : 'Unknown error',
+        });
+      }
+    }
+
+    return result;
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.inner.queryEntries(filter);
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    return this.inner.getEntry(entryId);
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.inner.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.inner.getAuditTrail(transactionId);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  /**
+   * Run a hook phase, recording its duration and flagging slow hooks
+   */
+  private async timeHook(
+    hook: LedgerAppendHook,
+    phase: 'beforeAppend' | 'afterAppend',
+    fn: () => void | Promise<void>
+  ): Promise<void> {
+    const startTime = Date.now();
+    try {
+      await fn();
+    } finally {
+      const durationMs = Date.now() - startTime;
+      MetricsLogger.recordDuration(MetricEventType.LEDGER_HOOK_DURATION, durationMs, {
+        hook: hook.name,
+        phase,
+      });
+
+      if (durationMs > this.config.slowHookThresholdMs) {
+        MetricsLogger.logAlert({
+          severity: AlertSeverity.WARNING,
+          message: `Ledger hook ${hook.name} took ${durationMs}ms in ${phase}`,
+          metricType: MetricEventType.LEDGER_HOOK_SLOW,
+          timestamp: new Date(),
+          metadata: { hook: hook.name, phase, durationMs },
+        });
+      }
+    }
+  }
+}
+
+/**
+ * Adapt a hook so its afterAppend and afterBatchAppend run off the write path
+ * The append or commit returns without waiting; failures are still reported.
+ */
+export function asyncAppendHook(hook: LedgerAppendHook): LedgerAppendHook {
+  if (!hook.afterAppend && !hook.afterBatchAppend) {
+    return hook;
+  }
+
+  const defer = (phase: 'afterAppend' | 'afterBatchAppend', fn: () => void | Promise<void>, context: Record<string, unknown>) => {
+    setImmediate(() => {
+      Promise.resolve()
+        .then(fn)
+        .catch(error => {
+          MetricsLogger.incrementCounter(MetricEventType.LEDGER_HOOK_ERROR, {
+            hook: hook.name,
+            phase,
+            ...context,
+            async: true,
+            error: error instanceof Error ? error.message : 'Unknown error',
+          });
+        });
+    });
+  };
+
+  const afterAppend = hook.afterAppend?.bind(hook);
+  const afterBatchAppend = hook.afterBatchAppend?.bind(hook);
+  return {
+    name: hook.name,
+    beforeAppend: hook.beforeAppend?.bind(hook),
+    ...(afterAppend && {
+      afterAppend(entry: LedgerEntry): void {
+        defer('afterAppend', () => afterAppend(entry), { entryId: entry.entryId });
+      },
+    }),
+    ...(afterBatchAppend && {
+      afterBatchAppend(entries: LedgerEntry[]): void {
+        defer('afterBatchAppend', () => afterBatchAppend(entries), { entryCount: entries.length });
+      },
+    }),
+  };
+}
+
+/**
+ * Factory function to create a hooked ledger service
+ */
+export function createHookedLedgerService(
+  inner: HookedInnerLedger,
+  config?: Partial<HookedLedgerConfig>
+): HookedLedgerService {
+  return new HookedLedgerService(inner, config);
+}
@@ -0,0 +1,56 @@
+/**
+ * Idempotency Key Validator Tests
+ */
+
+import { uuidV4Validator, ulidValidator } from './id-validators';
+
+describe('idempotency key validators', () => {
+  describe('uuidV4Validator', () => {
+    it.each(['0b8a3c2e-5f1d-4e6a-9c7b-1d2e3f4a5b6c', '0B8A3C2E-5F1D-4E6A-AC7B-1D2E3F4A5B6C'])('accepts %s', key => {
+      expect(() => uuidV4Validator(key)).not.toThrow();
+    });
+
+    it.each([
+      '0b8a3c2e-5f1d-4e6a-9c7b-1d2e3f4a5b6c_system',
+      'conversion-0b8a3c2e-5f1d-4e6a-9c7b-1d2e3f4a5b6c-debit',
+    ])('accepts the derived leg key %s', key => {
+      expect(() => uuidV4Validator(key)).not.toThrow();
+    });
+
+    it.each([
+      ['a version 1 UUID', '0b8a3c2e-5f1d-1e6a-9c7b-1d2e3f4a5b6c'],
+      ['a wrong variant', '0b8a3c2e-5f1d-4e6a-7c7b-1d2e3f4a5b6c'],
+      ['no hyphens', '0b8a3c2e5f1d4e6a9c7b1d2e3f4a5b6c'],
+      ['a ULID', '01ARZ3NDEKTSV4RRFFQ69G5FAV'],
+      ['a UUID run into other characters', 'earn0b8a3c2e-5f1d-4e6a-9c7b-1d2e3f4a5b6c'],
+      ['a key with no ID', 'earn-1_debit'],
+      ['an empty key', ''],
+    ])('rejects %s', (_, key) => {
+      expect(() => uuidV4Validator(key)).toThrow('Expected a UUIDv4');
+    });
+  });
+
+  describe('ulidValidator', () => {
+    it.each(['01ARZ3NDEKTSV4RRFFQ69G5FAV', '01arz3ndektsv4rrffq69g5fav', '7ZZZZZZZZZZZZZZZZZZZZZZZZZ'])('accepts %s', key => {
+      expect(() => ulidValidator(key)).not.toThrow();
+    });
+
+    it('accepts a derived leg key', () => {
+      expect(() => ulidValidator('01ARZ3NDEKTSV4RRFFQ69G5FAV_credit')).not.toThrow();
+    });
+
+    it.each([
+      ['a timestamp past 2^48', '8ZZZZZZZZZZZZZZZZZZZZZZZZZ'],
+      ['an excluded letter', '01ARZ3NDEKTSV4RRFFQ69G5FAU'],
+      ['too few characters', '01ARZ3NDEKTSV4RRFFQ69G5FA'],
+      ['a UUIDv4', '0b8a3c2e-5f1d-4e6a-9c7b-1d2e3f4a5b6c'],
+      ['an empty key', ''],
+    ])('rejects %s', (_, key) => {
+      expect(() => ulidValidator(key)).toThrow('Expected a ULID');
+    });
+
+    it('does not echo the key in its error', () => {
+      expect(() => ulidValidator('key-secret')).toThrow(expect.objectContaining({ message: expect.not.stringContaining('secret') }));
+    });
+  });
+});
@@ -0,0 +1,42 @@
+/**
+ * Idempotency Key Validators
+ *
+ * Built-in formats for LedgerConfig.idempotencyKeyValidator, so a program
+ * that mandates one ID format has the ledger enforce it on every append
+ * instead of trusting each caller. A validator throws to reject a key;
+ * the thrown error becomes the cause of the append's
+ * IdempotencyKeyRejectedError. Error messages describe the expected
+ * format and never echo the key.
+ *
+ * The format applies to the base key the caller chose. Services append
+ * the legs of one operation under keys derived from it, such as
+ * `<key>_debit`, `<key>_system` or `conversion-<key>-credit`, so the
+ * built-ins accept a key holding a conforming ID as one whole
+ * `-`, `_` or `:` separated part. The same rule holds when validateAll
+ * re-checks stored legs.
+ */
+
+import { IdempotencyKeyValidator } from './types';
+
+const UUID_V4 = /(?:^|[-_:])[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}(?:$|[-_:])/i;
+
+// 48-bit timestamp then 80 random bits in Crockford base32; a leading digit above 7 would overflow 128 bits
+const ULID = /(?:^|[-_:])[0-7][0-9A-HJKMNP-TV-Z]{25}(?:$|[-_:])/i;
+
+/**
+ * Accept only RFC 4122 version 4 UUIDs, in either case
+ */
+export const uuidV4Validator: IdempotencyKeyValidator = key => {
+  if (!UUID_V4.test(key)) {
+    throw new Error('Expected a UUIDv4 (xxxxxxxx-xxxx-4xxx-[89ab]xxx-xxxxxxxxxxxx)');
+  }
+};
+
+/**
+ * Accept only ULIDs: 26 Crockford base32 characters, in either case
+ */
+export const ulidValidator: IdempotencyKeyValidator = key => {
+  if (!ULID.test(key)) {
+    throw new Error('Expected a ULID (26 Crockford base32 characters)');
+  }
+};
@@ -6,3 +6,48 @@
 
 export * from './types';
 export * from './ledger.service';
+export * from './hooked-ledger.service';
+export * from './daily-aggregates';
+export * from './trial-balance';
+export * from './posting-engine';
+export * from './maintenance-ledger.service';
+export * from './last-activity-index';
+export * from './top-k';
+export * from './timezone';
+export * from './tee-ledger.service';
+export * from './quorum-ledger.service';
+export * from './swappable-ledger.service';
+export * from './routed-ledger.service';
+export * from './forecast';
+export * from './expiry-lots';
+export * from './attribution';
+export * from './msgpack';
+export * from './codec';
+export * from './ledger-tail';
+export * from './concealing-ledger.service';
+export * from './balance-audit';
+export * from './replay';
+export * from './validating-ledger.service';
+export * from './append-validators';
+export * from './simulation';
+export * from './self-check';
+export * from './attestation';
+export * from './sign-audit';
+export * from './ledger-digest';
+export * from './startup-readiness';
+export * from './warmup';
+export * from './throttle';
+export * from './read-your-writes';
+export * from './append-schemas';
+export * from './wire-format';
+export * from './ledger-export';
+export * from './log-reader';
+export * from './field-encryption';
+export * from './batch-builder';
+export * from './id-validators';
+export * from './anomaly-detector';
+export * from './write-queue';
+export * from './outbox';
+export * from './user-archive';
+export * from './replica-lag';
+export * from './reconciliation-markers';
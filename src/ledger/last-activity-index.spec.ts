@@ -0,0 +1,118 @@
+/**
+ * Last Activity Index Tests
+ */
+
+import { LastActivityIndex } from './last-activity-index';
+import { LedgerEntry } from './types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { AccountActivityModel } from '../db/models/account-activity.model';
+
+jest.mock('../db/models/ledger-entry.model');
+jest.mock('../db/models/account-activity.model');
+
+describe('LastActivityIndex', () => {
+  let activity: Map<string, Date>;
+  let index: LastActivityIndex;
+
+  const entry = (accountId: string, timestamp: string, accountType = 'user'): LedgerEntry => ({
+    entryId: `entry-${accountId}-${timestamp}`,
+    accountId,
+    accountType,
+    amount: 10,
+    timestamp: new Date(timestamp),
+  } as LedgerEntry);
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    activity = new Map();
+    index = new LastActivityIndex();
+
+    // Emulate $max upserts and range queries over the activity collection
+    (AccountActivityModel.updateOne as jest.Mock).mockImplementation(
+      async (filter: any, update: any) => {
+        const accountId = filter.accountId.$eq;
+        const candidate: Date = update.$max.lastActivityAt;
+        const current = activity.get(accountId);
+        if (!current || candidate > current) {
+          activity.set(accountId, candidate);
+        }
+      }
+    );
+    (AccountActivityModel.find as jest.Mock).mockImplementation((query: any) => {
+      const rows = [...activity.entries()]
+        .filter(([, at]) => at < query.lastActivityAt.$lt)
+        .map(([accountId]) => ({ accountId }))
+        .sort((a, b) => a.accountId.localeCompare(b.accountId));
+      return {
+        sort: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(rows),
+      };
+    });
+    (AccountActivityModel.bulkWrite as jest.Mock).mockImplementation(async (ops: any[]) => {
+      for (const op of ops) {
+        activity.set(op.updateOne.filter.accountId.$eq, op.updateOne.update.$set.lastActivityAt);
+      }
+    });
+  });
+
+  it('should return users whose last activity predates the cutoff', async () => {
+    await index.afterAppend(entry('user-a', '2024-01-01T00:00:00Z'));
+    await index.afterAppend(entry('user-b', '2024-03-01T00:00:00Z'));
+
+    await expect(index.dormantUsers(new Date('2024-02-01T00:00:00Z'))).resolves.toEqual(['user-a']);
+  });
+
+  it('should exclude a user who became active after the cutoff', async () => {
+    await index.afterAppend(entry('user-a', '2024-01-01T00:00:00Z'));
+    await index.afterAppend(entry('user-a', '2024-02-15T00:00:00Z'));
+
+    await expect(index.dormantUsers(new Date('2024-02-01T00:00:00Z'))).resolves.toEqual([]);
+  });
+
+  it('should treat activity exactly at the cutoff as active', async () => {
+    await index.afterAppend(entry('user-a', '2024-02-01T00:00:00Z'));
+
+    await expect(index.dormantUsers(new Date('2024-02-01T00:00:00Z'))).resolves.toEqual([]);
+  });
+
+  it('should never move last activity backwards on out-of-order appends', async () => {
+    await index.afterAppend(entry('user-a', '2024-03-01T00:00:00Z'));
+    await index.afterAppend(entry('user-a', '2024-01-01T00:00:00Z'));
+
+    expect(activity.get('user-a')).toEqual(new Date('2024-03-01T00:00:00Z'));
+  });
+
+  it('should ignore model and system accounts', async () => {
+    await index.afterAppend(entry('model-1', '2024-01-01T00:00:00Z', 'model'));
+    await index.afterAppend(entry('points_issuance', '2024-01-01T00:00:00Z', 'system'));
+
+    expect(AccountActivityModel.updateOne).not.toHaveBeenCalled();
+  });
+
+  it('should return the most recently active users first, up to the limit', async () => {
+    const chain = {
+      sort: jest.fn().mockReturnThis(),
+      limit: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue([{ accountId: 'user-b' }, { accountId: 'user-a' }]),
+    };
+    (AccountActivityModel.find as jest.Mock).mockReturnValue(chain);
+
+    await expect(index.recentlyActiveUsers(2)).resolves.toEqual(['user-b', 'user-a']);
+    expect(chain.sort).toHaveBeenCalledWith({ lastActivityAt: -1, accountId: 1 });
+    expect(chain.limit).toHaveBeenCalledWith(2);
+  });
+
+  it('should rebuild the index from the ledger', async () => {
+    (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+      exec: jest.fn().mockResolvedValue([
+        { _id: 'user-a', lastActivityAt: new Date('2024-01-01T00:00:00Z') },
+        { _id: 'user-b', lastActivityAt: new Date('2024-03-01T00:00:00Z') },
+      ]),
+    });
+
+    await expect(index.rebuild()).resolves.toBe(2);
+    await expect(index.dormantUsers(new Date('2024-02-01T00:00:00Z'))).resolves.toEqual(['user-a']);
+  });
+});
@@ -0,0 +1,100 @@
+/**
+ * Last Activity Index
+ *
+ * Per-user timestamp of the most recent ledger entry, kept current as a
+ * LedgerAppendHook so re-engagement and expiry jobs can find dormant
+ * users with one indexed range query instead of scanning every history.
+ *
+ * Updates use $max, so appends observed out of order never move a
+ * user's last activity backwards. The index is exactly reproducible from
+ * the ledger via rebuild().
+ */
+
+import { LedgerEntry, LedgerAppendHook } from './types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { AccountActivityModel } from '../db/models/account-activity.model';
+
+/**
+ * Upserts per bulk write during rebuild
+ */
+const REBUILD_BATCH_SIZE = 1000;
+
+/**
+ * LastActivityIndex implementation
+ */
+export class LastActivityIndex implements LedgerAppendHook {
+  readonly name = 'last-activity-index';
+
+  /**
+   * Record a user's activity at the appended entry's timestamp
+   */
+  async afterAppend(entry: LedgerEntry): Promise<void> {
+    if (entry.accountType !== 'user') {
+      return;
+    }
+
+    await AccountActivityModel.updateOne(
+      { accountId: { $eq: entry.accountId } },
+      { $max: { lastActivityAt: new Date(entry.timestamp) } },
+      { upsert: true }
+    );
+  }
+
+  /**
+   * Get users whose most recent ledger entry predates a cutoff
+   *
+   * @param since Cutoff; users active at or after it are excluded
+   * @returns User IDs in ascending order
+   */
+  async dormantUsers(since: Date): Promise<string[]> {
+    const rows = await AccountActivityModel.find(
+      { lastActivityAt: { $lt: since } },
+      { accountId: 1 }
+    )
+      .sort({ accountId: 1 })
+      .lean()
+      .exec();
+
+    return rows.map((row: any) => row.accountId);
+  }
+
+  /**
+   * Get the most recently active users, for cache warm-up
+   *
+   * @param limit Number of users to return
+   * @returns User IDs, most recent activity first
+   */
+  async recentlyActiveUsers(limit: number): Promise<string[]> {
+    const rows = await AccountActivityModel.find({}, { accountId: 1 })
+      .sort({ lastActivityAt: -1, accountId: 1 })
+      .limit(limit)
+      .lean()
+      .exec();
+
+    return rows.map((row: any) => row.accountId);
+  }
+
+  /**
+   * Recompute every user's last activity from the ledger
+   */
+  async rebuild(): Promise<number> {
+    const rows = await LedgerEntryModel.aggregate([
+      { $match: { accountType: { $eq: 'user' } } },
+      { $group: { _id: '$accountId', lastActivityAt: { $max: '$timestamp' } } },
+    ]).exec();
+
+    for (let i = 0; i < rows.length; i += REBUILD_BATCH_SIZE) {
+      await AccountActivityModel.bulkWrite(
+        rows.slice(i, i + REBUILD_BATCH_SIZE).map((row: any) => ({
+          updateOne: {
+            filter: { accountId: { $eq: row._id } },
+            update: { $set: { lastActivityAt: row.lastActivityAt } },
+            upsert: true,
+          },
+        }))
+      );
+    }
+
+    return rows.length;
+  }
+}
@@ -0,0 +1,168 @@
+/**
+ * Incremental Ledger Digest Tests
+ */
+
+import { LedgerDigest, IDigestStore, DigestState, MongoDigestStore, checksumLanes, digestValue } from './ledger-digest';
+import { IEntryScanStore } from './attestation';
+import { LedgerEntry } from './types';
+import { ReplayPosition } from './replay';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { LedgerDigestModel } from '../db/models/ledger-digest.model';
+
+jest.mock('../db/models/ledger-digest.model');
+
+describe('LedgerDigest', () => {
+  const entry = (n: number, amount: number): LedgerEntry => ({
+    entryId: `entry-${String(n).padStart(5, '0')}`,
+    transactionId: `tx-${n}`,
+    accountId: `user-${n % 7}`,
+    accountType: 'user',
+    amount,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: amount >= 0 ? 'none→available' : 'available→none',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `key-${n}`,
+    requestId: `req-${n}`,
+    balanceBefore: 0,
+    balanceAfter: amount,
+    timestamp: new Date(Date.UTC(2024, 0, 1) + n * 1000),
+    currency: 'points',
+  });
+
+  const scanStore = (entries: LedgerEntry[]): IEntryScanStore & { scans: number } => {
+    const store = {
+      scans: 0,
+      scanEntries: async (after: ReplayPosition | null, limit: number) => {
+        store.scans++;
+        return entries
+          .filter(e => !after || e.timestamp > after.timestamp || (+e.timestamp === +after.timestamp && e.entryId > after.entryId))
+          .slice(0, limit);
+      },
+    };
+    return store;
+  };
+
+  class MemoryDigestStore implements IDigestStore {
+    state: DigestState = { count: 0, lanes: new Array(16).fill(0) };
+    reads = 0;
+
+    async add(count: number, lanes: number[]) {
+      this.state.count += count;
+      lanes.forEach((value, i) => (this.state.lanes[i] += value));
+    }
+
+    async read() {
+      this.reads++;
+      return { count: this.state.count, lanes: [...this.state.lanes] };
+    }
+
+    async replace(state: DigestState) {
+      this.state = { count: state.count, lanes: [...state.lanes] };
+    }
+  }
+
+  it('should match a from-scratch recomputation after many concurrent appends', async () => {
+    const entries = Array.from({ length: 5000 }, (_, i) => entry(i + 1, Math.floor(Math.random() * 2000) - 1000));
+    const store = new MemoryDigestStore();
+    const digest = new LedgerDigest(store, scanStore(entries), { pageSize: 250 });
+
+    // Folds land in arbitrary order, as with concurrent writers
+    const shuffled = [...entries].sort(() => Math.random() - 0.5);
+    await Promise.all(shuffled.map(e => digest.fold(e)));
+
+    const verification = await digest.verify();
+    expect(verification.consistent).toBe(true);
+    expect(verification.incremental).toEqual({ count: 5000, digest: expect.stringMatching(/^[0-9a-f]{64}$/) });
+    await expect(new LedgerDigest(new MemoryDigestStore(), scanStore(entries)).rebuild()).resolves.toEqual(
+      verification.incremental
+    );
+  });
+
+  it('should change when any entry changes', async () => {
+    const entries = Array.from({ length: 10 }, (_, i) => entry(i + 1, 10));
+    const tampered = entries.map((e, i) => (i === 4 ? { ...e, amount: 11 } : e));
+
+    const original = await new LedgerDigest(new MemoryDigestStore(), scanStore(entries)).rebuild();
+    const changed = await new LedgerDigest(new MemoryDigestStore(), scanStore(tampered)).rebuild();
+
+    expect(changed.count).toBe(original.count);
+    expect(changed.digest).not.toBe(original.digest);
+  });
+
+  it('should detect a missed fold and repair it on rebuild', async () => {
+    const entries = Array.from({ length: 20 }, (_, i) => entry(i + 1, 10));
+    const store = new MemoryDigestStore();
+    const digest = new LedgerDigest(store, scanStore(entries));
+    for (const e of entries.slice(1)) {
+      await digest.fold(e);
+    }
+
+    const before = await digest.verify();
+    expect(before.consistent).toBe(false);
+    expect(before.incremental.count).toBe(19);
+
+    await digest.rebuild();
+
+    await expect(digest.verify()).resolves.toMatchObject({ consistent: true });
+  });
+
+  it('should read the digest in constant time regardless of ledger size', async () => {
+    const timings: number[] = [];
+
+    for (const size of [100, 10000]) {
+      const entries = Array.from({ length: size }, (_, i) => entry(i + 1, 10));
+      const store = new MemoryDigestStore();
+      const scans = scanStore(entries);
+      const digest = new LedgerDigest(store, scans);
+      await Promise.all(entries.map(e => digest.fold(e)));
+
+      const started = process.hrtime.bigint();
+      for (let i = 0; i < 1000; i++) {
+        await digest.digest();
+      }
+      timings.push(Number(process.hrtime.bigint() - started));
+
+      // One state read per digest and no ledger scan
+      expect(store.reads).toBe(1000);
+      expect(scans.scans).toBe(0);
+    }
+
+    // A 100x larger ledger costs no more than noise
+    expect(timings[1]).toBeLessThan(timings[0] * 10);
+  });
+
+  it('should resolve lane carries into the 256-bit sum', () => {
+    const lanes = new Array(16).fill(0);
+    lanes[15] = 0x10000 * 3 + 1;
+
+    expect(digestValue({ count: 1, lanes }).digest).toBe('0'.repeat(58) + '030001');
+    expect(checksumLanes(entry(1, 10))).toHaveLength(16);
+  });
+});
+
+describe('MongoDigestStore', () => {
+  const exec = (value: any) => ({ lean: jest.fn().mockReturnThis(), exec: jest.fn().mockResolvedValue(value) });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+  });
+
+  it('should fold with a single upserted $inc', async () => {
+    (LedgerDigestModel.updateOne as jest.Mock).mockReturnValue(exec({}));
+    const lanes = Array.from({ length: 16 }, (_, i) => i);
+
+    await new MongoDigestStore().add(1, lanes);
+
+    const [query, update, options] = (LedgerDigestModel.updateOne as jest.Mock).mock.calls[0];
+    expect(query).toEqual({ name: { $eq: 'ledger' } });
+    expect(update.$inc).toMatchObject({ count: 1, 'lanes.l0': 0, 'lanes.l15': 15 });
+    expect(options).toEqual({ upsert: true });
+  });
+
+  it('should read a missing digest as empty', async () => {
+    (LedgerDigestModel.findOne as jest.Mock).mockReturnValue(exec(null));
+
+    await expect(new MongoDigestStore().read()).resolves.toEqual({ count: 0, lanes: new Array(16).fill(0) });
+  });
+});
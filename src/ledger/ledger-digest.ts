@@ -0,0 +1,228 @@
+/**
+ * Incremental Ledger Digest
+ *
+ * A content digest of the whole ledger that costs O(1) to read. The
+ * digest is the sum, mod 2^256, of every entry's checksum; addition
+ * commutes, so appends can be folded in by concurrent writers in any
+ * order and still agree with a from-scratch recomputation. (The
+ * attestation chain hash is order-sensitive and stays a batch job.)
+ *
+ * The sum is stored as 16 lanes, each the plain sum of one 16-bit slice
+ * of the checksums, so each fold is one atomic $inc. Lanes stay exact
+ * up to 2^37 entries; carries are resolved only when the digest is read.
+ *
+ * LedgerService folds each newly inserted entry (never an idempotent
+ * replay) when configured with a digest. A fold that fails after the
+ * insert leaves the digest behind the ledger; verify() detects that and
+ * rebuild() recomputes from a full scan. Rebuild while appends are
+ * paused, since appends landing mid-scan may be counted twice or missed.
+ */
+
+import { Model } from 'mongoose';
+import { LedgerEntry, LedgerDigestWriter } from './types';
+import { IEntryScanStore } from './attestation';
+import { ReplayPosition } from './replay';
+import { entryChecksum } from '../tiering/tiering';
+import { LedgerDigestModel, ILedgerDigest } from '../db/models/ledger-digest.model';
+
+const LANES = 16;
+const LANE_BITS = 16n;
+const MODULUS = 1n << 256n;
+
+/**
+ * Raw digest state: entry count and lane sums, most significant lane first
+ */
+export interface DigestState {
+  count: number;
+  lanes: number[];
+}
+
+/**
+ * A readable ledger digest
+ */
+export interface LedgerDigestValue {
+  /** Entries folded in */
+  count: number;
+
+  /** 64 hex characters */
+  digest: string;
+}
+
+/**
+ * Outcome of comparing the incremental digest with a recomputation
+ */
+export interface DigestVerification {
+  consistent: boolean;
+  incremental: LedgerDigestValue;
+  recomputed: LedgerDigestValue;
+}
+
+/**
+ * Durable digest state
+ */
+export interface IDigestStore {
+  /** Add to the count and lanes atomically */
+  add(count: number, lanes: number[]): Promise<void>;
+
+  read(): Promise<DigestState>;
+
+  /** Overwrite the state after a rebuild */
+  replace(state: DigestState): Promise<void>;
+}
+
+/**
+ * Options for rebuilds and verification
+ */
+export interface LedgerDigestOptions {
+  /** Entries read per page */
+  pageSize: number;
+}
+
+const DEFAULT_OPTIONS: LedgerDigestOptions = {
+  pageSize: 1000,
+};
+
+/**
+ * Split an entry's checksum into lane values
+ */
+export function checksumLanes(entry: LedgerEntry): number[] {
+  const checksum = entryChecksum(entry);
+  return Array.from({ length: LANES }, (_, i) => parseInt(checksum.slice(i * 4, i * 4 + 4), 16));
+}
+
+/**
+ * Resolve lane carries into the digest value
+ */
+export function digestValue(state: DigestState): LedgerDigestValue {
+  let sum = 0n;
+  for (let i = 0; i < LANES; i++) {
+    sum = (sum << LANE_BITS) + BigInt(state.lanes[i] || 0);
+  }
+
+  return { count: state.count, digest: (sum % MODULUS).toString(16).padStart(64, '0') };
+}
+
+function emptyState(): DigestState {
+  return { count: 0, lanes: new Array(LANES).fill(0) };
+}
+
+/**
+ * LedgerDigest implementation
+ */
+export class LedgerDigest implements LedgerDigestWriter {
+  private store: IDigestStore;
+  private entries: IEntryScanStore;
+  private options: LedgerDigestOptions;
+
+  constructor(store: IDigestStore, entries: IEntryScanStore, options: Partial<LedgerDigestOptions> = {}) {
+    this.store = store;
+    this.entries = entries;
+    this.options = { ...DEFAULT_OPTIONS, ...options };
+  }
+
+  /**
+   * Fold one newly inserted entry into the digest
+   */
+  async fold(entry: LedgerEntry): Promise<void> {
+    await this.store.add(1, checksumLanes(entry));
+  }
+
+  /**
+   * Current digest, from the maintained state alone
+   */
+  async digest(): Promise<LedgerDigestValue> {
+    return digestValue(await this.store.read());
+  }
+
+  /**
+   * Recompute the digest from every entry and store it
+   */
+  async rebuild(): Promise<LedgerDigestValue> {
+    const state = await this.recompute();
+    await this.store.replace(state);
+    return digestValue(state);
+  }
+
+  /**
+   * Compare the maintained digest with a from-scratch recomputation
+   */
+  async verify(): Promise<DigestVerification> {
+    const incremental = await this.digest();
+    const recomputed = digestValue(await this.recompute());
+
+    return {
+      consistent: incremental.count === recomputed.count && incremental.digest === recomputed.digest,
+      incremental,
+      recomputed,
+    };
+  }
+
+  private async recompute(): Promise<DigestState> {
+    const state = emptyState();
+    let position: ReplayPosition | null = null;
+
+    for (;;) {
+      const page = await this.entries.scanEntries(position, this.options.pageSize);
+
+      for (const entry of page) {
+        const lanes = checksumLanes(entry);
+        state.count++;
+        for (let i = 0; i < LANES; i++) {
+          state.lanes[i] += lanes[i];
+        }
+        position = { timestamp: entry.timestamp, entryId: entry.entryId };
+      }
+
+      if (page.length < this.options.pageSize) {
+        return state;
+      }
+    }
+  }
+}
+
+/**
+ * Digest state in the ledger_digest collection
+ */
+export class MongoDigestStore implements IDigestStore {
+  private model: Model<ILedgerDigest>;
+  private name: string;
+
+  constructor(model: Model<ILedgerDigest> = LedgerDigestModel, name = 'ledger') {
+    this.model = model;
+    this.name = name;
+  }
+
+  async add(count: number, lanes: number[]): Promise<void> {
+    const inc: Record<string, number> = { count };
+    lanes.forEach((value, i) => {
+      inc[`lanes.l${i}`] = value;
+    });
+
+    await this.model.updateOne({ name: { $eq: this.name } }, { $inc: inc }, { upsert: true }).exec();
+  }
+
+  async read(): Promise<DigestState> {
+    const doc = await this.model.findOne({ name: { $eq: this.name } }).lean().exec();
+    if (!doc) {
+      return emptyState();
+    }
+
+    const lanes = (doc.lanes || {}) as Record<string, number>;
+    return { count: doc.count, lanes: Array.from({ length: LANES }, (_, i) => lanes[`l${i}`] || 0) };
+  }
+
+  async replace(state: DigestState): Promise<void> {
+    const lanes: Record<string, number> = {};
+    state.lanes.forEach((value, i) => {
+      lanes[`l${i}`] = value;
+    });
+
+    await this.model
+      .updateOne(
+        { name: { $eq: this.name } },
+        { $set: { count: state.count, lanes, rebuiltAt: new Date() } },
+        { upsert: true }
+      )
+      .exec();
+  }
+}
@@ -0,0 +1,240 @@
+/**
+ * Resumable Ledger Export Tests
+ */
+
+import { PassThrough, Readable } from 'stream';
+import { exportFrom, exportLedger, snapshotLedger, restoreArtifact, replayOrdered } from './ledger-export';
+import { IEntryScanStore } from './attestation';
+import { InMemoryCheckpointStore, ReplayPosition } from './replay';
+import { LedgerEntry } from './types';
+import { WireContentType, decodeFrame, encodeFrame } from './wire-format';
+import { InMemoryLedgerService } from './testing/in-memory-ledger.service';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('ledger export', () => {
+  // Ten entries; pairs share a timestamp so ties are ordered by entry ID
+  const entries: LedgerEntry[] = Array.from({ length: 10 }, (_, i) => ({
+    entryId: `entry-${i}`,
+    transactionId: `txn-${i}`,
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: i + 1,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `key-${i}`,
+    requestId: `req-${i}`,
+    balanceBefore: 0,
+    balanceAfter: i + 1,
+    timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, Math.floor(i / 2))),
+    currency: 'points',
+  }));
+
+  const after = (position: ReplayPosition | null) => (entry: LedgerEntry) =>
+    !position ||
+    entry.timestamp.getTime() > position.timestamp.getTime() ||
+    (entry.timestamp.getTime() === position.timestamp.getTime() && entry.entryId > position.entryId);
+
+  let store: IEntryScanStore & { scanEntries: jest.Mock };
+  let output: PassThrough;
+  let chunks: Buffer[];
+
+  const frames = async () => {
+    // Let the stream deliver what was written
+    await new Promise(resolve => setImmediate(resolve));
+    const decoded = [];
+    let data = Buffer.concat(chunks);
+    for (let next = decodeFrame(data); next; next = decodeFrame(data)) {
+      decoded.push(next.frame);
+      data = data.subarray(next.bytes);
+    }
+    return decoded;
+  };
+
+  const exported = async () =>
+    (await frames()).flatMap(frame =>
+      frame.payload.toString('utf8').split('\n').filter(Boolean).map(line => JSON.parse(line).entryId)
+    );
+
+  const artifact = () => Readable.from([Buffer.concat(chunks)]);
+
+  beforeEach(() => {
+    store = {
+      scanEntries: jest.fn(async (position: ReplayPosition | null, limit: number) =>
+        entries.filter(after(position)).slice(0, limit)
+      ),
+    };
+    output = new PassThrough();
+    chunks = [];
+    output.on('data', chunk => chunks.push(chunk));
+  });
+
+  describe('exportFrom', () => {
+    it('exports a chunk from the start and returns the last position written', async () => {
+      const last = await exportFrom(store, output, null, 3);
+
+      expect(await exported()).toEqual(['entry-0', 'entry-1', 'entry-2']);
+      expect(last).toEqual({ timestamp: entries[2].timestamp, entryId: 'entry-2' });
+    });
+
+    it('resumes from a mid-ledger position, including a tie on its timestamp', async () => {
+      const resumed = await exportFrom(store, output, { timestamp: entries[4].timestamp, entryId: 'entry-4' }, 4, 3);
+
+      expect(await exported()).toEqual(['entry-5', 'entry-6', 'entry-7', 'entry-8']);
+      expect(resumed?.entryId).toBe('entry-8');
+      expect(store.scanEntries.mock.calls.map(call => call[1])).toEqual([3, 1]);
+      expect((await frames()).map(frame => frame.contentType)).toEqual([
+        WireContentType.LEDGER_EXPORT,
+        WireContentType.LEDGER_EXPORT,
+      ]);
+    });
+
+    it('stops at the end and returns the same position once nothing remains', async () => {
+      const end = await exportFrom(store, output, { timestamp: entries[7].timestamp, entryId: 'entry-7' }, 5);
+      const again = await exportFrom(store, output, end, 5);
+
+      expect(await exported()).toEqual(['entry-8', 'entry-9']);
+      expect(end?.entryId).toBe('entry-9');
+      expect(again).toEqual(end);
+    });
+
+    it('rejects a limit that is not a positive integer', async () => {
+      await expect(exportFrom(store, output, null, 0)).rejects.toThrow('positive integer');
+    });
+  });
+
+  describe('exportLedger', () => {
+    it('exports the whole ledger in checkpointed chunks', async () => {
+      const checkpoints = new InMemoryCheckpointStore();
+
+      const written = await exportLedger(store, output, checkpoints, { name: 'compliance', chunkSize: 4, pageSize: 3 });
+
+      expect(written).toBe(10);
+      expect(await exported()).toEqual(entries.map(e => e.entryId));
+      expect((await checkpoints.load('compliance'))?.position?.entryId).toBe('entry-9');
+    });
+
+    it('resumes after a crash from the last saved chunk', async () => {
+      const checkpoints = new InMemoryCheckpointStore();
+      const scan = store.scanEntries.getMockImplementation()!;
+      store.scanEntries.mockImplementationOnce(scan).mockImplementationOnce(scan).mockRejectedValueOnce(new Error('connection reset'));
+
+      await expect(exportLedger(store, output, checkpoints, { name: 'compliance', chunkSize: 4 })).rejects.toThrow(
+        'connection reset'
+      );
+      expect(await exported()).toEqual(['entry-0', 'entry-1', 'entry-2', 'entry-3', 'entry-4', 'entry-5', 'entry-6', 'entry-7']);
+
+      const resumed = await exportLedger(store, output, checkpoints, { name: 'compliance', chunkSize: 4 });
+
+      expect(resumed).toBe(2);
+      expect((await exported()).slice(8)).toEqual(['entry-8', 'entry-9']);
+    });
+
+    it('writes nothing when a finished export is run again', async () => {
+      const checkpoints = new InMemoryCheckpointStore();
+      await exportLedger(store, output, checkpoints, { name: 'compliance', chunkSize: 5 });
+
+      expect(await exportLedger(store, output, checkpoints, { name: 'compliance', chunkSize: 5 })).toBe(0);
+      expect(await exported()).toHaveLength(10);
+    });
+  });
+
+  describe('snapshotLedger', () => {
+    it('writes snapshot frames and an empty end frame', async () => {
+      const written = await snapshotLedger(store, output, 4);
+
+      const snapshotFrames = await frames();
+      expect(written).toBe(10);
+      expect(snapshotFrames.map(frame => frame.contentType)).toEqual(Array(4).fill(WireContentType.SNAPSHOT));
+      expect(snapshotFrames[3].payload).toHaveLength(0);
+      expect(await exported()).toEqual(entries.map(e => e.entryId));
+    });
+  });
+
+  describe('restoreArtifact', () => {
+    it('imports an export, replaying entries the ledger already holds', async () => {
+      const ledger = new InMemoryLedgerService();
+      await ledger.importEntry(entries[0]);
+      await exportLedger(store, output, new InMemoryCheckpointStore(), { name: 'compliance', pageSize: 3 });
+
+      const report = await restoreArtifact(artifact(), ledger);
+
+      expect(report).toEqual({ contentType: WireContentType.LEDGER_EXPORT, imported: 9, replayed: 1 });
+      expect((await ledger.getEntry('entry-7'))?.timestamp).toEqual(entries[7].timestamp);
+    });
+
+    it('restores a snapshot into an empty ledger', async () => {
+      const ledger = new InMemoryLedgerService();
+      await snapshotLedger(store, output, 3);
+
+      const report = await restoreArtifact(artifact(), ledger);
+
+      expect(report).toEqual({ contentType: WireContentType.SNAPSHOT, imported: 10, replayed: 0 });
+      expect(ledger.size).toBe(10);
+    });
+
+    it('refuses a snapshot that overlaps the ledger or lost its end frame', async () => {
+      await snapshotLedger(store, output, 3);
+      const snapshot = Buffer.concat(chunks);
+      const withoutEnd = snapshot.subarray(0, snapshot.length - encodeFrame(WireContentType.SNAPSHOT, Buffer.alloc(0)).length);
+      const ledger = new InMemoryLedgerService();
+      await ledger.importEntry(entries[4]);
+
+      await expect(restoreArtifact(Readable.from([snapshot]), ledger)).rejects.toThrow('already holds entry entry-4');
+      await expect(restoreArtifact(Readable.from([withoutEnd]), new InMemoryLedgerService())).rejects.toThrow(
+        'end frame is missing'
+      );
+    });
+
+    it('rejects a foreign file and an artifact mixing content types', async () => {
+      const foreign = Readable.from([Buffer.from(entries.map(e => JSON.stringify(e)).join('\n'), 'utf8')]);
+      const mixed = Readable.from([
+        encodeFrame(WireContentType.LEDGER_EXPORT, Buffer.from(JSON.stringify(entries[0]) + '\n', 'utf8')),
+        encodeFrame(WireContentType.SNAPSHOT, Buffer.from(JSON.stringify(entries[1]) + '\n', 'utf8')),
+      ]);
+
+      await expect(restoreArtifact(foreign, new InMemoryLedgerService())).rejects.toThrow('Unrecognized artifact');
+      await expect(restoreArtifact(mixed, new InMemoryLedgerService())).rejects.toThrow('mixes content types');
+    });
+  });
+
+  describe('replayOrdered', () => {
+    // The same entries as merged from shards: interleaved and reversed
+    const shuffled = [entries.filter((_, i) => i % 2 === 1).reverse(), entries.filter((_, i) => i % 2 === 0)].flat();
+
+    const importOrder = async (input: LedgerEntry[]) => {
+      const ledger = new InMemoryLedgerService();
+      const importEntry = jest.spyOn(ledger, 'importEntry');
+      const report = await replayOrdered(input, ledger);
+      return { report, imported: importEntry.mock.calls.map(([entry]) => entry.entryId) };
+    };
+
+    it('imports in (timestamp, entryId) order whatever the input order', async () => {
+      const canonical = entries.map(e => e.entryId);
+
+      for (const input of [shuffled, [...entries].reverse(), entries]) {
+        const { report, imported } = await importOrder(input);
+        expect(imported).toEqual(canonical);
+        expect(report.entries.map(e => e.entryId)).toEqual(canonical);
+        expect(report).toMatchObject({ imported: 10, replayed: 0 });
+      }
+    });
+
+    it('replays entries the target already holds', async () => {
+      const ledger = new InMemoryLedgerService();
+      await ledger.importEntry(entries[3]);
+
+      await expect(replayOrdered(shuffled, ledger)).resolves.toMatchObject({ imported: 9, replayed: 1 });
+    });
+
+    it('rejects duplicate entry IDs before importing anything', async () => {
+      const ledger = new InMemoryLedgerService();
+
+      await expect(replayOrdered([...shuffled, { ...entries[2] }], ledger)).rejects.toThrow(
+        'entry entry-2 appears more than once'
+      );
+      expect(ledger.size).toBe(0);
+    });
+  });
+});
@@ -0,0 +1,277 @@
+/**
+ * Resumable Ledger Export
+ *
+ * Writes the whole ledger in (timestamp, entryId) order, the order the
+ * replay engine and the attestation chain use, as LEDGER_EXPORT frames of
+ * the ledger wire format (see ./wire-format), one frame per page read
+ * with the page's entries as JSON lines. exportFrom
+ * writes one chunk after a position and returns the position of the last
+ * entry written, so an exporter that stops partway resumes from its last
+ * saved position instead of from the start.
+ *
+ * exportLedger drives exportFrom chunk by chunk and saves the position
+ * in a replay checkpoint store after each one. A chunk is written before
+ * its checkpoint is saved, so after a crash the last chunk may be
+ * written twice, never skipped; consumers dedup on entryId.
+ *
+ * snapshotLedger writes the whole ledger in one run as SNAPSHOT frames
+ * and ends it with an empty frame, so a snapshot cut short is detected.
+ * restoreArtifact reads either kind back, validating every frame, and
+ * dispatches on the content type: an export or a captured log is
+ * imported idempotently, so overlapping or resumed exports load cleanly,
+ * while a snapshot is restored only into a ledger that holds none of its
+ * entries.
+ *
+ * replayOrdered imports entries gathered out of order, such as the merged
+ * exports of several shards, in canonical (timestamp, entryId) order, so
+ * the same set of entries always builds the same ledger.
+ */
+
+import { Readable, Writable } from 'stream';
+import { once } from 'events';
+import { ReplayPosition, IReplayCheckpointStore, comparePositions } from './replay';
+import { IEntryScanStore } from './attestation';
+import { CreateLedgerEntryResult, LedgerEntry } from './types';
+import { jsonEntryCodec } from './codec';
+import { WireContentType, encodeFrame, readFrames } from './wire-format';
+
+/**
+ * Options for a whole-ledger export
+ */
+export interface LedgerExportOptions {
+  /** Checkpoint key of this export, so several exports can resume independently */
+  name: string;
+
+  /** Entries written between checkpoints */
+  chunkSize: number;
+
+  /** Entries read per page */
+  pageSize: number;
+}
+
+const DEFAULT_OPTIONS: Omit<LedgerExportOptions, 'name'> = {
+  chunkSize: 10000,
+  pageSize: 1000,
+};
+
+/**
+ * Ledger an artifact is restored into
+ */
+export interface IEntryImportTarget {
+  importEntry(entry: LedgerEntry): Promise<CreateLedgerEntryResult>;
+}
+
+/**
+ * Outcome of restoring an artifact
+ */
+export interface RestoreReport {
+  contentType: WireContentType;
+
+  /** Entries newly stored */
+  imported: number;
+
+  /** Entries the target already held (exports only) */
+  replayed: number;
+}
+
+/**
+ * Outcome of replaying entries in canonical order
+ */
+export interface OrderedReplayReport {
+  /** The entries in the order they were imported */
+  entries: LedgerEntry[];
+
+  /** Entries newly stored */
+  imported: number;
+
+  /** Entries the target already held */
+  replayed: number;
+}
+
+/**
+ * Write up to limit entries after a position to an output as JSON lines
+ *
+ * @param after Position of the last entry already exported (null for the start)
+ * @param output Destination stream (not ended by the call)
+ * @returns Position of the last entry written, or `after` when none remain
+ * @throws Error if limit is not a positive integer
+ */
+export async function exportFrom(
+  store: IEntryScanStore,
+  output: Writable,
+  after: ReplayPosition | null,
+  limit: number,
+  pageSize = DEFAULT_OPTIONS.pageSize
+): Promise<ReplayPosition | null> {
+  return (await writeChunk(store, output, after, limit, pageSize, WireContentType.LEDGER_EXPORT)).position;
+}
+
+/**
+ * Export the whole ledger in checkpointed chunks, resuming a previous run
+ *
+ * @returns Number of entries written by this run
+ */
+export async function exportLedger(
+  store: IEntryScanStore,
+  output: Writable,
+  checkpoints: IReplayCheckpointStore,
+  options: Partial<LedgerExportOptions> & Pick<LedgerExportOptions, 'name'>
+): Promise<number> {
+  const { name, chunkSize, pageSize } = { ...DEFAULT_OPTIONS, ...options };
+  let position = (await checkpoints.load(name))?.position ?? null;
+  let total = 0;
+
+  for (;;) {
+    const chunk = await writeChunk(store, output, position, chunkSize, pageSize, WireContentType.LEDGER_EXPORT);
+    if (chunk.written === 0) {
+      return total;
+    }
+
+    total += chunk.written;
+    position = chunk.position;
+    await checkpoints.save(name, { position, applied: [] });
+
+    if (chunk.written < chunkSize) {
+      return total;
+    }
+  }
+}
+
+/**
+ * Write the whole ledger to an output as a snapshot
+ *
+ * @returns Number of entries written
+ */
+export async function snapshotLedger(
+  store: IEntryScanStore,
+  output: Writable,
+  pageSize = DEFAULT_OPTIONS.pageSize
+): Promise<number> {
+  const chunk = await writeChunk(store, output, null, Number.MAX_SAFE_INTEGER, pageSize, WireContentType.SNAPSHOT);
+  await writeFrame(output, encodeFrame(WireContentType.SNAPSHOT, Buffer.alloc(0)));
+  return chunk.written;
+}
+
+/**
+ * Read an export or snapshot and store its entries in a ledger
+ *
+ * @throws Error if the input is not a valid artifact, mixes content types,
+ *   or is a snapshot that is incomplete or overlaps entries the target holds
+ */
+export async function restoreArtifact(input: Readable, target: IEntryImportTarget): Promise<RestoreReport> {
+  let report: RestoreReport | undefined;
+  let ended = false;
+
+  for await (const frame of readFrames(input)) {
+    if (frame.contentType === WireContentType.USER_ARCHIVE || frame.contentType === WireContentType.USER_ARCHIVE_MANIFEST) {
+      throw new Error('User archives are read with importUserArchive');
+    }
+    if (!report) {
+      report = { contentType: frame.contentType, imported: 0, replayed: 0 };
+    } else if (frame.contentType !== report.contentType) {
+      throw new Error(
+        `Artifact mixes content types: ${WireContentType[report.contentType]} and ${WireContentType[frame.contentType]}`
+      );
+    }
+    if (ended) {
+      throw new Error('Snapshot continues after its end frame');
+    }
+
+    const lines = frame.payload.toString('utf8').split('\n').filter(Boolean);
+    if (frame.contentType === WireContentType.SNAPSHOT && lines.length === 0) {
+      ended = true;
+      continue;
+    }
+
+    for (const line of lines) {
+      const entry = jsonEntryCodec.decode(Buffer.from(line, 'utf8'));
+      const result = await target.importEntry(entry);
+      if (result.inserted) {
+        report.imported++;
+      } else if (frame.contentType === WireContentType.SNAPSHOT) {
+        throw new Error(`Cannot restore snapshot: the ledger already holds entry ${entry.entryId}`);
+      } else {
+        report.replayed++;
+      }
+    }
+  }
+
+  if (!report) {
+    throw new Error('Artifact is empty');
+  }
+  if (report.contentType === WireContentType.SNAPSHOT && !ended) {
+    throw new Error('Snapshot is incomplete: its end frame is missing');
+  }
+  return report;
+}
+
+/**
+ * Import entries in (timestamp, entryId) order, whatever order they are
+ * given in
+ * The input is checked for duplicate entry IDs before anything is
+ * imported; entries the target already holds are replayed, as by
+ * restoreArtifact.
+ *
+ * @throws Error if two entries share an entry ID
+ */
+export async function replayOrdered(entries: LedgerEntry[], target: IEntryImportTarget): Promise<OrderedReplayReport> {
+  const seen = new Set<string>();
+  for (const entry of entries) {
+    if (seen.has(entry.entryId)) {
+      throw new Error(`Cannot replay: entry ${entry.entryId} appears more than once`);
+    }
+    seen.add(entry.entryId);
+  }
+
+  const ordered = [...entries].sort(comparePositions);
+  const report: OrderedReplayReport = { entries: ordered, imported: 0, replayed: 0 };
+  for (const entry of ordered) {
+    if ((await target.importEntry(entry)).inserted) {
+      report.imported++;
+    } else {
+      report.replayed++;
+    }
+  }
+  return report;
+}
+
+async function writeChunk(
+  store: IEntryScanStore,
+  output: Writable,
+  after: ReplayPosition | null,
+  limit: number,
+  pageSize: number,
+  contentType: WireContentType
+): Promise<{ position: ReplayPosition | null; written: number }> {
+  if (!Number.isSafeInteger(limit) || limit < 1) {
+    throw new Error(`Export limit must be a positive integer: ${limit}`);
+  }
+
+  let position = after;
+  let written = 0;
+
+  while (written < limit) {
+    const size = Math.min(pageSize, limit - written);
+    const page = await store.scanEntries(position, size);
+
+    if (page.length > 0) {
+      const lines = page.map(entry => JSON.stringify(entry) + '\n').join('');
+      await writeFrame(output, encodeFrame(contentType, Buffer.from(lines, 'utf8')));
+
+      const last = page[page.length - 1];
+      position = { timestamp: last.timestamp, entryId: last.entryId };
+      written += page.length;
+    }
+    if (page.length < size) {
+      break;
+    }
+  }
+
+  return { position, written };
+}
+
+async function writeFrame(output: Writable, frame: Buffer): Promise<void> {
+  if (!output.write(frame)) {
+    await once(output, 'drain');
+  }
+}
@@ -0,0 +1,219 @@
+/**
+ * Ledger Tail Tests
+ */
+
+import { LedgerTail, TailOverflowPolicy } from './ledger-tail';
+import { HookedLedgerService, HookedInnerLedger } from './hooked-ledger.service';
+import { LedgerEntry, CreateLedgerEntryRequest } from './types';
+import { TailOverflowError } from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+describe('LedgerTail', () => {
+  let tail: LedgerTail;
+
+  const entry = (i: number) => ({ entryId: `entry-${i}`, accountId: 'user-123', amount: i }) as LedgerEntry;
+
+  const drain = async (subscription: AsyncIterator<LedgerEntry>, count: number) => {
+    const ids: string[] = [];
+    for (let i = 0; i < count; i++) {
+      const result = await subscription.next();
+      ids.push(result.value.entryId);
+    }
+    return ids;
+  };
+
+  beforeEach(() => {
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    tail = new LedgerTail();
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should deliver appended entries in order to a waiting consumer', async () => {
+    const subscription = tail.tail({ subscriberId: 'dashboard' });
+    const pending = subscription.next();
+
+    tail.afterAppend(entry(1));
+    tail.afterAppend(entry(2));
+
+    expect((await pending).value.entryId).toBe('entry-1');
+    expect(await drain(subscription, 1)).toEqual(['entry-2']);
+    expect(subscription.stats()).toMatchObject({ delivered: 2, dropped: 0, buffered: 0 });
+  });
+
+  it('should drop the oldest buffered entries for a slow consumer under DROP_OLDEST', async () => {
+    const subscription = tail.tail({
+      subscriberId: 'slow-dashboard',
+      bufferSize: 3,
+      overflow: TailOverflowPolicy.DROP_OLDEST,
+    });
+
+    for (let i = 1; i <= 5; i++) {
+      tail.afterAppend(entry(i));
+    }
+
+    expect(tail.tailStats()).toEqual([
+      expect.objectContaining({ subscriberId: 'slow-dashboard', buffered: 3, dropped: 2 }),
+    ]);
+    expect(await drain(subscription, 3)).toEqual(['entry-3', 'entry-4', 'entry-5']);
+    expect(MetricsLogger.incrementCounter).toHaveBeenCalledWith(MetricEventType.LEDGER_TAIL_DROPPED, {
+      subscriberId: 'slow-dashboard',
+      policy: TailOverflowPolicy.DROP_OLDEST,
+    });
+  });
+
+  it('should discard incoming entries under DROP_NEWEST', async () => {
+    const subscription = tail.tail({ bufferSize: 2, overflow: TailOverflowPolicy.DROP_NEWEST });
+
+    for (let i = 1; i <= 4; i++) {
+      tail.afterAppend(entry(i));
+    }
+
+    expect(await drain(subscription, 2)).toEqual(['entry-1', 'entry-2']);
+    expect(subscription.stats().dropped).toBe(2);
+  });
+
+  it('should close the subscription with an overflow error under ERROR', async () => {
+    const subscription = tail.tail({ subscriberId: 'strict', bufferSize: 2, overflow: TailOverflowPolicy.ERROR });
+
+    for (let i = 1; i <= 3; i++) {
+      tail.afterAppend(entry(i));
+    }
+
+    expect(await drain(subscription, 2)).toEqual(['entry-1', 'entry-2']);
+    await expect(subscription.next()).rejects.toThrow(TailOverflowError);
+    expect(await subscription.next()).toEqual({ value: undefined, done: true });
+    expect(tail.tailStats()).toEqual([]);
+  });
+
+  it('should isolate subscribers from each other', async () => {
+    const slow = tail.tail({ bufferSize: 1, overflow: TailOverflowPolicy.DROP_NEWEST });
+    const fast = tail.tail({ bufferSize: 10 });
+
+    tail.afterAppend(entry(1));
+    tail.afterAppend(entry(2));
+
+    expect(await drain(fast, 2)).toEqual(['entry-1', 'entry-2']);
+    expect(slow.stats().dropped).toBe(1);
+    expect(fast.stats().dropped).toBe(0);
+  });
+
+  it('should stop delivering once a for await loop exits', async () => {
+    const subscription = tail.tail({ subscriberId: 'viewer' });
+    tail.afterAppend(entry(1));
+
+    for await (const received of subscription) {
+      expect(received.entryId).toBe('entry-1');
+      break;
+    }
+    tail.afterAppend(entry(2));
+
+    expect(subscription.stats()).toMatchObject({ closed: true, buffered: 0 });
+    expect(tail.tailStats()).toEqual([]);
+  });
+
+  it('should never hold up appends when no one consumes the tail', async () => {
+    const inner = {
+      createEntryWithResult: jest.fn().mockImplementation(async (request: CreateLedgerEntryRequest) => ({
+        entry: { entryId: request.idempotencyKey },
+        inserted: true,
+      })),
+    } as unknown as HookedInnerLedger;
+    const service = new HookedLedgerService(inner);
+    service.registerHook(tail);
+    const subscription = tail.tail({ bufferSize: 5, overflow: TailOverflowPolicy.DROP_OLDEST });
+
+    for (let i = 0; i < 50; i++) {
+      await service.createEntry({ idempotencyKey: `entry-${i}` } as CreateLedgerEntryRequest);
+    }
+
+    expect(subscription.stats()).toMatchObject({ buffered: 5, dropped: 45 });
+  });
+
+  describe('filters', () => {
+    const append = (entryId: string, accountId: string, extra: Partial<LedgerEntry> = {}) =>
+      tail.afterAppend({
+        entryId,
+        accountId,
+        amount: 10,
+        type: TransactionType.CREDIT,
+        reason: TransactionReason.PROMOTIONAL_AWARD,
+        ...extra,
+      } as LedgerEntry);
+
+    it('should deliver only the subscribed users entries', async () => {
+      const session = tail.tail({ filter: { userIds: ['user-1', 'user-2'] } });
+
+      append('e1', 'user-1');
+      append('e2', 'user-3');
+      append('e3', 'user-2');
+
+      expect(await drain(session, 2)).toEqual(['e1', 'e3']);
+      expect(session.stats().buffered).toBe(0);
+    });
+
+    it('should filter by type, reason and tags together', async () => {
+      const fulfillment = tail.tail({
+        filter: {
+          types: [TransactionType.DEBIT],
+          reasons: [TransactionReason.CHIP_MENU_PURCHASE],
+          tags: { region: 'eu' },
+        },
+      });
+
+      append('e1', 'user-1', { type: TransactionType.DEBIT, reason: TransactionReason.CHIP_MENU_PURCHASE, metadata: { region: 'eu' } });
+      append('e2', 'user-1', { type: TransactionType.DEBIT, reason: TransactionReason.POINT_EXPIRY, metadata: { region: 'eu' } });
+      append('e3', 'user-2', { type: TransactionType.DEBIT, reason: TransactionReason.CHIP_MENU_PURCHASE, metadata: { region: 'us' } });
+      append('e4', 'user-2', { type: TransactionType.DEBIT, reason: TransactionReason.CHIP_MENU_PURCHASE });
+
+      expect(await drain(fulfillment, 1)).toEqual(['e1']);
+      expect(fulfillment.stats().buffered).toBe(0);
+    });
+
+    it('should only evaluate subscriptions indexed under the appended user', () => {
+      const sessions = Array.from({ length: 1000 }, (_, i) => tail.tail({ filter: { userIds: [`user-${i}`] } }));
+      const matchSpies = sessions.map(session => jest.spyOn(session, 'matches'));
+
+      append('e1', 'user-7');
+
+      expect(matchSpies.filter(spy => spy.mock.calls.length > 0)).toEqual([matchSpies[7]]);
+      expect(sessions[7].stats().buffered).toBe(1);
+    });
+
+    it('should release every index entry when the signal aborts', () => {
+      const controllers = Array.from({ length: 50 }, () => new AbortController());
+      controllers.forEach((controller, i) =>
+        tail.tail({ filter: { userIds: [`user-${i}`, 'shared'] }, signal: controller.signal })
+      );
+      const firehose = new AbortController();
+      tail.tail({ signal: firehose.signal });
+
+      controllers.forEach(controller => controller.abort());
+      firehose.abort();
+
+      expect(tail.tailStats()).toEqual([]);
+      expect((tail as any).byUser.size).toBe(0);
+      expect((tail as any).allUsers.size).toBe(0);
+    });
+
+    it('should close at once when subscribed with an aborted signal', async () => {
+      const controller = new AbortController();
+      controller.abort();
+
+      const subscription = tail.tail({ signal: controller.signal });
+
+      expect(await subscription.next()).toEqual({ value: undefined, done: true });
+      expect(tail.tailStats()).toEqual([]);
+    });
+  });
+
+  it('should reject invalid buffer sizes and duplicate subscriber IDs', () => {
+    tail.tail({ subscriberId: 'dashboard' });
+
+    expect(() => tail.tail({ bufferSize: 0 })).toThrow('bufferSize must be a positive integer');
+    expect(() => tail.tail({ subscriberId: 'dashboard' })).toThrow('Tail subscriber already exists');
+  });
+});
@@ -0,0 +1,385 @@
+/**
+ * Ledger Tail
+ *
+ * Live feed of appended entries for dashboards and other observers.
+ * Register a LedgerTail as an append hook; each subscriber gets its own
+ * bounded buffer and consumes it as an async iterator.
+ *
+ * Appends never wait on a subscriber. When a buffer is full the
+ * subscriber's overflow policy decides what happens:
+ *
+ *   - DROP_OLDEST: the oldest buffered entry is discarded
+ *   - DROP_NEWEST: the incoming entry is discarded
+ *   - ERROR: the subscription is closed and its consumer receives a
+ *     TailOverflowError once the buffered entries are drained
+ *
+ * Dropped entries are counted per subscriber (tailStats) and in metrics.
+ * Entries are delivered in append order within each subscriber.
+ *
+ * A subscription may filter by user, transaction type, reason and
+ * metadata tags. Subscriptions naming users are indexed by user ID, so an
+ * append is only matched against the subscriptions for its account plus
+ * those without a user filter. Passing an AbortSignal closes the
+ * subscription when it is aborted.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { LedgerAppendHook, LedgerEntry } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { TailOverflowError } from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * What happens when a subscriber's buffer is full
+ */
+export enum TailOverflowPolicy {
+  DROP_OLDEST = 'drop_oldest',
+  DROP_NEWEST = 'drop_newest',
+  ERROR = 'error',
+}
+
+/**
+ * Entries a subscription receives; every set criterion must match
+ */
+export interface TailFilter {
+  /** Accounts to receive entries for */
+  userIds?: string[];
+
+  types?: TransactionType[];
+
+  reasons?: TransactionReason[];
+
+  /** Metadata values that must all match (compared as strings) */
+  tags?: Record<string, string>;
+}
+
+/**
+ * Options for a tail subscription
+ */
+export interface TailOptions {
+  /** Entries buffered before the overflow policy applies */
+  bufferSize: number;
+
+  overflow: TailOverflowPolicy;
+
+  /** Subscriber name used in stats and metrics (generated when unset) */
+  subscriberId?: string;
+
+  /** Only deliver matching entries (all entries when unset) */
+  filter?: TailFilter;
+
+  /** Close the subscription when aborted */
+  signal?: AbortSignal;
+}
+
+const DEFAULT_OPTIONS: TailOptions = {
+  bufferSize: 1000,
+  overflow: TailOverflowPolicy.DROP_OLDEST,
+};
+
+/**
+ * Delivery counters for one subscriber
+ */
+export interface TailSubscriberStats {
+  subscriberId: string;
+  overflow: TailOverflowPolicy;
+  bufferSize: number;
+
+  /** Entries waiting to be consumed */
+  buffered: number;
+
+  /** Entries handed to the consumer */
+  delivered: number;
+
+  /** Entries discarded by the overflow policy */
+  dropped: number;
+
+  closed: boolean;
+}
+
+/**
+ * A subscriber's view of the tail, consumed with for await
+ */
+export class TailSubscription implements AsyncIterableIterator<LedgerEntry> {
+  readonly subscriberId: string;
+
+  private options: TailOptions;
+  private onClose: (subscription: TailSubscription) => void;
+  private buffer: LedgerEntry[] = [];
+  private waiting: ((result: IteratorResult<LedgerEntry>) => void) | null = null;
+  private failure: Error | null = null;
+  private closed = false;
+  private delivered = 0;
+  private dropped = 0;
+
+  constructor(
+    subscriberId: string,
+    options: TailOptions,
+    onClose: (subscription: TailSubscription) => void
+  ) {
+    this.subscriberId = subscriberId;
+    this.options = options;
+    this.onClose = onClose;
+  }
+
+  /**
+   * User IDs the subscription is indexed under (empty for all users)
+   */
+  get userIds(): string[] {
+    return this.options.filter?.userIds || [];
+  }
+
+  /**
+   * Whether an entry passes the type, reason and tag criteria
+   * User IDs are matched by the tail's index rather than here.
+   */
+  matches(entry: LedgerEntry): boolean {
+    const filter = this.options.filter;
+    if (!filter) {
+      return true;
+    }
+
+    if (filter.types && !filter.types.includes(entry.type)) {
+      return false;
+    }
+
+    if (filter.reasons && !filter.reasons.includes(entry.reason)) {
+      return false;
+    }
+
+    if (filter.tags) {
+      const metadata = entry.metadata || {};
+      for (const [key, value] of Object.entries(filter.tags)) {
+        if (metadata[key] === undefined || metadata[key] === null || String(metadata[key]) !== value) {
+          return false;
+        }
+      }
+    }
+
+    return true;
+  }
+
+  /**
+   * Offer an appended entry; never blocks
+   */
+  push(entry: LedgerEntry): void {
+    if (this.closed) {
+      return;
+    }
+
+    if (this.waiting) {
+      const resolve = this.waiting;
+      this.clearWaiter();
+      this.delivered++;
+      resolve({ value: entry, done: false });
+      return;
+    }
+
+    if (this.buffer.length < this.options.bufferSize) {
+      this.buffer.push(entry);
+      return;
+    }
+
+    switch (this.options.overflow) {
+      case TailOverflowPolicy.DROP_OLDEST:
+        this.buffer.shift();
+        this.buffer.push(entry);
+        this.recordDrop();
+        break;
+      case TailOverflowPolicy.DROP_NEWEST:
+        this.recordDrop();
+        break;
+      case TailOverflowPolicy.ERROR:
+        this.failure = new TailOverflowError(this.subscriberId, this.options.bufferSize);
+        MetricsLogger.incrementCounter(MetricEventType.LEDGER_TAIL_OVERFLOW, {
+          subscriberId: this.subscriberId,
+          bufferSize: this.options.bufferSize,
+        });
+        this.close();
+        break;
+    }
+  }
+
+  /**
+   * Wait for the next entry; done once the subscription is closed and drained
+   *
+   * @throws TailOverflowError under the ERROR policy after the buffer drains
+   */
+  next(): Promise<IteratorResult<LedgerEntry>> {
+    if (this.buffer.length > 0) {
+      this.delivered++;
+      return Promise.resolve({ value: this.buffer.shift()!, done: false });
+    }
+
+    if (this.failure) {
+      const failure = this.failure;
+      this.failure = null;
+      return Promise.reject(failure);
+    }
+
+    if (this.closed) {
+      return Promise.resolve({ value: undefined, done: true });
+    }
+
+    return new Promise(resolve => {
+      this.waiting = resolve;
+    });
+  }
+
+  /**
+   * Stop receiving entries (called when a for await loop exits early)
+   */
+  async return(): Promise<IteratorResult<LedgerEntry>> {
+    this.buffer = [];
+    this.failure = null;
+    this.close();
+    return { value: undefined, done: true };
+  }
+
+  [Symbol.asyncIterator](): this {
+    return this;
+  }
+
+  /**
+   * Close the subscription; buffered entries can still be consumed
+   */
+  close(): void {
+    if (this.closed) {
+      return;
+    }
+    this.closed = true;
+    this.onClose(this);
+
+    // A waiting consumer has an empty buffer, so nothing is lost
+    if (this.waiting) {
+      const resolve = this.waiting;
+      this.clearWaiter();
+      resolve({ value: undefined, done: true });
+    }
+  }
+
+  stats(): TailSubscriberStats {
+    return {
+      subscriberId: this.subscriberId,
+      overflow: this.options.overflow,
+      bufferSize: this.options.bufferSize,
+      buffered: this.buffer.length,
+      delivered: this.delivered,
+      dropped: this.dropped,
+      closed: this.closed,
+    };
+  }
+
+  private recordDrop(): void {
+    this.dropped++;
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_TAIL_DROPPED, {
+      subscriberId: this.subscriberId,
+      policy: this.options.overflow,
+    });
+  }
+
+  private clearWaiter(): void {
+    this.waiting = null;
+  }
+}
+
+/**
+ * Ledger Tail Implementation
+ */
+export class LedgerTail implements LedgerAppendHook {
+  readonly name = 'ledger-tail';
+
+  private subscriptions = new Map<string, TailSubscription>();
+
+  /** Subscriptions without a user filter */
+  private allUsers = new Set<TailSubscription>();
+
+  /** Subscriptions with a user filter, by user ID */
+  private byUser = new Map<string, Set<TailSubscription>>();
+
+  /**
+   * Subscribe to entries appended from now on
+   *
+   * @throws Error if the subscriber ID is in use or the buffer size is invalid
+   */
+  tail(options: Partial<TailOptions> = {}): TailSubscription {
+    const resolved = { ...DEFAULT_OPTIONS, ...options };
+    const subscriberId = resolved.subscriberId || uuidv4();
+
+    if (!Number.isInteger(resolved.bufferSize) || resolved.bufferSize < 1) {
+      throw new Error('bufferSize must be a positive integer');
+    }
+
+    if (this.subscriptions.has(subscriberId)) {
+      throw new Error(`Tail subscriber already exists: ${subscriberId}`);
+    }
+
+    const signal = resolved.signal;
+    const onAbort = () => subscription.close();
+    const subscription = new TailSubscription(subscriberId, resolved, closed => {
+      signal?.removeEventListener('abort', onAbort);
+      this.unindex(closed);
+    });
+
+    this.subscriptions.set(subscriberId, subscription);
+    if (subscription.userIds.length === 0) {
+      this.allUsers.add(subscription);
+    }
+    for (const userId of subscription.userIds) {
+      if (!this.byUser.has(userId)) {
+        this.byUser.set(userId, new Set());
+      }
+      this.byUser.get(userId)!.add(subscription);
+    }
+
+    if (signal?.aborted) {
+      subscription.close();
+    } else {
+      signal?.addEventListener('abort', onAbort, { once: true });
+    }
+
+    return subscription;
+  }
+
+  /**
+   * Fan an appended entry out to the subscribers it matches
+   */
+  afterAppend(entry: LedgerEntry): void {
+    const candidates = [...this.allUsers, ...(this.byUser.get(entry.accountId) || [])];
+    for (const subscription of candidates) {
+      if (subscription.matches(entry)) {
+        subscription.push(entry);
+      }
+    }
+  }
+
+  /**
+   * Delivery counters per open subscription
+   * A closed subscription's final counters remain on its stats().
+   */
+  tailStats(): TailSubscriberStats[] {
+    return [...this.subscriptions.values()].map(subscription => subscription.stats());
+  }
+
+  /**
+   * Remove a closed subscription from every index
+   */
+  private unindex(subscription: TailSubscription): void {
+    this.subscriptions.delete(subscription.subscriberId);
+    this.allUsers.delete(subscription);
+    for (const userId of subscription.userIds) {
+      const subscribers = this.byUser.get(userId);
+      subscribers?.delete(subscription);
+      if (subscribers && subscribers.size === 0) {
+        this.byUser.delete(userId);
+      }
+    }
+  }
+}
+
+/**
+ * Factory function to create a ledger tail
+ */
+export function createLedgerTail(): LedgerTail {
+  return new LedgerTail();
+}
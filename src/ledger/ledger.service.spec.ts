@@ -2,11 +2,53 @@
  * Ledger Service Tests
  */
 
-import { LedgerService } from './ledger.service';
-import { CreateLedgerEntryRequest, LedgerQueryFilter } from './types';
+import {
+  LedgerService,
+  createTenantScopedLedgerService,
+  UNREFERENCED_GROUP,
+} from './ledger.service';
+import {
+  CrossTenantError,
+  TagNotIndexedError,
+  IdempotencyConflictError,
+  InvalidTimeRangeError,
+  TimestampRegressionError,
+  UnauthorizedCommitterError,
+  LedgerAppendError,
+  AppendErrorCode,
+  ReadTokenExpiredError,
+  UserIdRejectedError,
+  IdempotencyKeyRejectedError,
+  OptimisticLockError,
+  ReplayContentConflictError,
+  InvalidLedgerGroupError,
+  MissingGroupIdError,
+  MissingAdjustReasonError,
+  LedgerInconsistencyError,
+  EntryNotFoundError,
+  ReferenceFormatError,
+  findErrorCause,
+  isRetryableAppendError,
+} from '../services/types';
+import {
+  CreateLedgerEntryRequest,
+  LedgerEntry,
+  LedgerQueryFilter,
+  LedgerTracer,
+  IReferenceAliasResolver,
+  RecordEntryFields,
+} from './types';
 import { TransactionType, TransactionReason } from '../wallets/types';
 import { LedgerEntryModel } from '../db/models/ledger-entry.model';
 import { IdempotencyRecordModel } from '../db/models/idempotency.model';
+import { generateKeyPairSync, randomBytes } from 'crypto';
+import { PassThrough } from 'stream';
+import { signEntry } from './entry-signing';
+import { uuidV4Validator, ulidValidator } from './id-validators';
+import { StdDevAnomalyDetector } from './anomaly-detector';
+import { MetricsLogger, MetricEventType } from '../metrics';
+import { MetadataCipher, SEALED_METADATA_FIELD } from './field-encryption';
+import { resetOpStats } from './testing/op-stats';
 
 // Mock mongoose models
 jest.mock('../db/models/ledger-entry.model');
@@ -112,7 +154,9 @@ describe('LedgerService', () => {
       expect(result).toBeDefined();
       expect(result.entryId).toBe('entry-existing');
       expect(LedgerEntryModel.findOne).toHaveBeenCalledWith({
+        tenantId: { $exists: false },
         idempotencyKey: { $eq: 'idem-duplicate' },
+        idempotencyScope: { $exists: false },
       });
     });
 
@@ -151,97 +195,3711 @@ describe('LedgerService', () => {
     });
   });
 
-  describe('queryEntries', () => {
-    it('should query entries with filters', async () => {
-      const filter: LedgerQueryFilter = {
+  describe('monotonic timestamps', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-mono',
+      requestId: 'req-mono',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    // Latest stored entry, updated as appends succeed
+    let latest: any;
+
+    beforeEach(() => {
+      jest.useFakeTimers();
+      latest = null;
+      (LedgerEntryModel.findOne as jest.Mock).mockImplementation(() => ({
+        sort: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockImplementation(async () => latest),
+      }));
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+        latest = doc;
+        return doc;
+      });
+    });
+
+    afterEach(() => {
+      jest.useRealTimers();
+      (LedgerEntryModel.findOne as jest.Mock).mockReset();
+      (LedgerEntryModel.create as jest.Mock).mockReset();
+    });
+
+    const appendAt = (strict: LedgerService, iso: string, n: number) => {
+      jest.setSystemTime(new Date(iso));
+      return strict.createEntry({ ...request, idempotencyKey: `idem-mono-${n}` });
+    };
+
+    it('should accept appends in non-decreasing timestamp order', async () => {
+      const strict = new LedgerService({ enforceMonotonicTimestamps: true });
+
+      await appendAt(strict, '2024-01-01T00:00:00Z', 1);
+      await appendAt(strict, '2024-01-01T00:00:00Z', 2);
+      await appendAt(strict, '2024-01-01T00:00:05Z', 3);
+
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(3);
+    });
+
+    it('should reject an append timestamped before the last entry', async () => {
+      const strict = new LedgerService({ enforceMonotonicTimestamps: true });
+      await appendAt(strict, '2024-01-01T00:00:05Z', 1);
+
+      const error = await appendAt(strict, '2024-01-01T00:00:04Z', 2).catch(e => e);
+
+      expect(error.appendCode).toBe(AppendErrorCode.TIMESTAMP_REGRESSION);
+      expect(findErrorCause(error, TimestampRegressionError)).toBeDefined();
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(1);
+    });
+
+    it('should allow out-of-order appends by default', async () => {
+      await appendAt(service, '2024-01-01T00:00:05Z', 1);
+      await appendAt(service, '2024-01-01T00:00:04Z', 2);
+
+      expect(LedgerEntryModel.findOne).not.toHaveBeenCalled();
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(2);
+    });
+  });
+
+  describe('region', () => {
+    it('should prefix generated entry and transaction IDs with the region', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+      const regional = new LedgerService({ region: 'eu-west' });
+
+      const entry = await regional.createEntry({
         accountId: 'user-123',
         accountType: 'user',
+        amount: 100,
         type: TransactionType.CREDIT,
-        limit: 10,
-        offset: 0,
+        balanceState: 'available',
+        stateTransition: 'none→available',
+        reason: TransactionReason.PROMOTIONAL_AWARD,
+        idempotencyKey: 'idem-region',
+        requestId: 'req-region',
+        balanceBefore: 0,
+        balanceAfter: 100,
+      });
+
+      expect(entry.entryId).toMatch(/^eu-west:[0-9a-f-]{36}$/);
+      expect(entry.transactionId).toMatch(/^eu-west:/);
+    });
+
+    it('should reject a malformed region', () => {
+      expect(() => new LedgerService({ region: 'EU West' })).toThrow('Invalid region');
+    });
+  });
+
+  describe('allowed committers', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-committer',
+      requestId: 'req-committer',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
+
+    it('should accept an append by an allowed committer', async () => {
+      const guarded = new LedgerService({ allowedCommitters: ['svc:rewards', 'ops:alice'] });
+
+      await guarded.createEntry({ ...request, metadata: { committedBy: 'svc:rewards' } });
+
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(1);
+    });
+
+    it('should reject an append by a committer not on the allowlist', async () => {
+      const guarded = new LedgerService({ allowedCommitters: ['svc:rewards'] });
+
+      const error = await guarded.createEntry({ ...request, metadata: { committedBy: 'svc:unknown' } }).catch(e => e);
+
+      expect(error.appendCode).toBe(AppendErrorCode.UNAUTHORIZED);
+      expect(findErrorCause(error, UnauthorizedCommitterError)).toBeDefined();
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should reject an append without a committer when an allowlist is set', async () => {
+      const guarded = new LedgerService({ allowedCommitters: ['svc:rewards'] });
+
+      const error = await guarded.createEntry(request).catch(e => e);
+
+      expect(findErrorCause(error, UnauthorizedCommitterError)).toBeDefined();
+    });
+
+    it('should reject the wrong tenant before checking the committer', async () => {
+      const guarded = new LedgerService({ allowedCommitters: ['svc:rewards'], tenantId: 'brand-a' });
+
+      const error = await guarded.createEntry({ ...request, tenantId: 'brand-b' }).catch(e => e);
+
+      expect(findErrorCause(error, CrossTenantError)).toBeDefined();
+      expect(findErrorCause(error, UnauthorizedCommitterError)).toBeUndefined();
+    });
+
+    it('should not check committers when the allowlist is empty', async () => {
+      await new LedgerService({ allowedCommitters: [] }).createEntry(request);
+
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(1);
+    });
+  });
+
+  describe('metadata encryption', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-sealed',
+      requestId: 'req-sealed',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      metadata: { comment: 'goodwill after outage', tier: 'gold', committedBy: 'ops:alice' },
+    };
+    const key = randomBytes(32);
+    let stored: any;
+
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => (stored = doc));
+      (LedgerEntryModel.findOne as jest.Mock).mockImplementation(() => ({
+        lean: () => ({ exec: jest.fn().mockResolvedValue(stored) }),
+      }));
+    });
+
+    it('should store comment and tags sealed and return them decrypted', async () => {
+      const sealing = new LedgerService({ metadataCipher: new MetadataCipher({ key }) });
+
+      const entry = await sealing.createEntry(request);
+
+      expect(Object.keys(stored.metadata).sort()).toEqual([SEALED_METADATA_FIELD, 'committedBy']);
+      expect(JSON.stringify(stored)).not.toContain('goodwill');
+      expect(stored).toMatchObject({ accountId: 'user-123', amount: 100, type: TransactionType.CREDIT });
+      expect(entry.metadata).toEqual(request.metadata);
+      await expect(sealing.getEntry(entry.entryId)).resolves.toMatchObject({ metadata: request.metadata });
+    });
+
+    it('should fail a read with the wrong key', async () => {
+      const entry = await new LedgerService({ metadataCipher: new MetadataCipher({ key }) }).createEntry(request);
+      const wrongKey = new LedgerService({ metadataCipher: new MetadataCipher({ key: randomBytes(32) }) });
+
+      await expect(wrongKey.getEntry(entry.entryId)).rejects.toThrow('wrong key or altered data');
+    });
+
+    it('should refuse to index a tag the cipher seals', () => {
+      expect(() => new LedgerService({ indexedTagKeys: ['tier'], metadataCipher: new MetadataCipher({ key }) })).toThrow(
+        'Indexed tag tier is sealed by metadataCipher'
+      );
+      expect(
+        () => new LedgerService({ indexedTagKeys: ['tier'], metadataCipher: new MetadataCipher({ key, clearKeys: ['tier'] }) })
+      ).not.toThrow();
+    });
+  });
+
+  describe('default committers', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-default-committer',
+      requestId: 'req-default-committer',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    const defaulted = () =>
+      new LedgerService({
+        allowedCommitters: ['svc:earn', 'ops:alice'],
+        defaultCommitterByType: { [TransactionType.CREDIT]: 'svc:earn' },
+      });
+
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
+
+    it('should fill in the default committer for an append without one', async () => {
+      const entry = await defaulted().createEntry({ ...request, metadata: { source: 'earn-pipeline' } });
+
+      expect(entry.metadata).toEqual({ source: 'earn-pipeline', committedBy: 'svc:earn' });
+    });
+
+    it('should default the committer on recordEntry', async () => {
+      const entry = await defaulted().recordEntry({
+        accountId: 'user-123',
+        amount: 100,
+        type: TransactionType.CREDIT,
+        reason: TransactionReason.PROMOTIONAL_AWARD,
+        idempotencyKey: 'idem-record-default',
+        requestId: 'req-record-default',
+        balanceBefore: 0,
+      });
+
+      expect(entry.metadata?.committedBy).toBe('svc:earn');
+    });
+
+    it('should keep an explicit committer over the default', async () => {
+      const entry = await defaulted().createEntry({ ...request, metadata: { committedBy: 'ops:alice' } });
+
+      expect(entry.metadata?.committedBy).toBe('ops:alice');
+    });
+
+    it('should leave types without a default to the allowlist', async () => {
+      const error = await defaulted()
+        .createEntry({ ...request, type: TransactionType.DEBIT, amount: -10, balanceAfter: -10 })
+        .catch(e => e);
+
+      expect(findErrorCause(error, UnauthorizedCommitterError)).toBeDefined();
+    });
+
+    it('should report the append rules a request would break without appending it', () => {
+      const debit = { ...request, type: TransactionType.DEBIT, amount: -10, balanceAfter: -10 };
+
+      expect(defaulted().appendRuleViolations(request)).toEqual([]);
+      expect(defaulted().appendRuleViolations(debit).map(error => error.code)).toEqual(['UNAUTHORIZED_COMMITTER']);
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should reject an empty default committer', () => {
+      expect(() => new LedgerService({ defaultCommitterByType: { [TransactionType.CREDIT]: '' } })).toThrow(
+        'must not be empty'
+      );
+    });
+  });
+
+  describe('createEntryWithResult', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: -50,
+      type: TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: 'available→escrow',
+      reason: TransactionReason.CHIP_MENU_PURCHASE,
+      idempotencyKey: 'idem-result-1',
+      requestId: 'req-result-1',
+      balanceBefore: 100,
+      balanceAfter: 50,
+    };
+
+    it('should report a fresh insert', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const result = await service.createEntryWithResult(request);
+
+      expect(result.inserted).toBe(true);
+      expect(result.entry.idempotencyKey).toBe('idem-result-1');
+    });
+
+    it('should report an idempotent replay with the existing entry', async () => {
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { idempotencyKey: 1 };
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicateError);
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue({ ...request, entryId: 'entry-original', timestamp: new Date() }),
+      });
+
+      const result = await service.createEntryWithResult(request);
+
+      expect(result.inserted).toBe(false);
+      expect(result.entry.entryId).toBe('entry-original');
+    });
+
+    it('should propagate validation failures', async () => {
+      const validationError: any = new Error('LedgerEntry validation failed: reason: Path `reason` is required.');
+      validationError.name = 'ValidationError';
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(validationError);
+
+      await expect(service.createEntryWithResult(request)).rejects.toThrow('validation failed');
+      expect(LedgerEntryModel.findOne).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('importEntry', () => {
+    const recorded = {
+      entryId: 'entry-elsewhere',
+      transactionId: 'txn-elsewhere',
+      accountId: 'user-123',
+      accountType: 'user' as const,
+      amount: 75,
+      type: TransactionType.CREDIT,
+      balanceState: 'available' as const,
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-import-1',
+      requestId: 'req-import-1',
+      balanceBefore: 0,
+      balanceAfter: 75,
+      timestamp: new Date('2024-03-01T00:00:00Z'),
+      currency: 'points' as const,
+    };
+    const duplicate = () => Object.assign(new Error('Duplicate key'), { code: 11000 });
+
+    it('should store the entry with its ID and timestamp', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const result = await service.importEntry(recorded);
+
+      expect(result.inserted).toBe(true);
+      expect(LedgerEntryModel.create).toHaveBeenCalledWith(
+        expect.objectContaining({ entryId: 'entry-elsewhere', timestamp: recorded.timestamp })
+      );
+    });
+
+    it('should replay an entry already imported', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicate());
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(recorded),
+      });
+
+      const result = await service.importEntry(recorded);
+
+      expect(result).toEqual({ entry: expect.objectContaining({ entryId: 'entry-elsewhere' }), inserted: false });
+    });
+
+    it('should refuse an entry whose key is held by a different entry', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicate());
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(null),
+      });
+
+      await expect(service.importEntry(recorded)).rejects.toThrow('a different entry holds its ID or idempotency key');
+    });
+  });
+
+  describe('stream versions', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-stream-1',
+      requestId: 'req-stream',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    const lastVersion = (streamVersion?: number) => ({
+      sort: jest.fn().mockReturnThis(),
+      select: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue(streamVersion === undefined ? null : { streamVersion }),
+    });
+
+    const versionConflict = () => {
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { tenantId: 1, accountId: 1, streamVersion: 1 };
+      return duplicateError;
+    };
+
+    afterEach(() => {
+      (LedgerEntryModel.findOne as jest.Mock).mockReset();
+      (LedgerEntryModel.create as jest.Mock).mockReset();
+    });
+
+    it('should not version entries unless enabled', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const entry = await service.createEntry(request);
+
+      expect(entry.streamVersion).toBeUndefined();
+      expect(LedgerEntryModel.findOne).not.toHaveBeenCalled();
+    });
+
+    it('should start a user stream at version 1 and continue it', async () => {
+      const versioned = new LedgerService({ trackStreamVersions: true });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+      (LedgerEntryModel.findOne as jest.Mock)
+        .mockReturnValueOnce(lastVersion())
+        .mockReturnValueOnce(lastVersion(1));
+
+      const first = await versioned.createEntry(request);
+      const second = await versioned.createEntry({ ...request, idempotencyKey: 'idem-stream-2' });
+
+      expect([first.streamVersion, second.streamVersion]).toEqual([1, 2]);
+      expect(LedgerEntryModel.findOne).toHaveBeenCalledWith({
+        accountId: { $eq: 'user-123' },
+        streamVersion: { $exists: true },
+      });
+    });
+
+    it('should take the next version when a concurrent append won the race', async () => {
+      const versioned = new LedgerService({ trackStreamVersions: true });
+      (LedgerEntryModel.findOne as jest.Mock)
+        .mockReturnValueOnce(lastVersion(4))
+        .mockReturnValueOnce(lastVersion(5));
+      (LedgerEntryModel.create as jest.Mock)
+        .mockRejectedValueOnce(versionConflict())
+        .mockImplementationOnce(async (doc: any) => doc);
+
+      const entry = await versioned.createEntry(request);
+
+      expect(entry.streamVersion).toBe(6);
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(2);
+    });
+
+    it('should give up with a retryable error under sustained contention', async () => {
+      const versioned = new LedgerService({ trackStreamVersions: true });
+      (LedgerEntryModel.findOne as jest.Mock).mockImplementation(() => lastVersion(4));
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async () => {
+        throw versionConflict();
+      });
+
+      const error = await versioned.createEntry(request).catch(e => e);
+
+      expect(findErrorCause(error, OptimisticLockError)).toBeDefined();
+      expect(isRetryableAppendError(error)).toBe(true);
+      expect(LedgerEntryModel.create).toHaveBeenCalledTimes(5);
+    });
+
+    it('should not version model accounts', async () => {
+      const versioned = new LedgerService({ trackStreamVersions: true });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const entry = await versioned.createEntry({ ...request, accountId: 'model-1', accountType: 'model' });
+
+      expect(entry.streamVersion).toBeUndefined();
+      expect(LedgerEntryModel.findOne).not.toHaveBeenCalled();
+    });
+
+    describe('backfillStreamVersions', () => {
+      const legacy = (entryId: string, accountId: string, second: number, streamVersion?: number) => ({
+        entryId,
+        accountId,
+        timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, second)),
+        streamVersion,
+      });
+
+      // Serves the docs a page at a time, resuming after the keyset condition
+      const mockStore = (docs: any[]) => {
+        (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => {
+          const after = query.$or?.[1];
+          let limit = Infinity;
+          const chain: any = {
+            sort: jest.fn().mockReturnThis(),
+            select: jest.fn().mockReturnThis(),
+            limit: jest.fn().mockImplementation((n: number) => {
+              limit = n;
+              return chain;
+            }),
+            lean: jest.fn().mockReturnThis(),
+            exec: jest.fn().mockImplementation(async () =>
+              docs
+                .filter(doc => !after || doc.timestamp > after.timestamp.$eq ||
+                  (doc.timestamp.getTime() === after.timestamp.$eq.getTime() && doc.entryId > after.entryId.$gt))
+                .slice(0, limit)
+            ),
+          };
+          return chain;
+        });
+      };
+
+      let bulkWrite: jest.Mock;
+
+      beforeEach(() => {
+        bulkWrite = jest.fn().mockImplementation(async (ops: any[]) => ({ modifiedCount: ops.length }));
+        (LedgerEntryModel as any).collection = { bulkWrite };
+      });
+
+      afterEach(() => {
+        (LedgerEntryModel.find as jest.Mock).mockReset();
+      });
+
+      it('should number unversioned entries around the versions already assigned, per user', async () => {
+        mockStore([
+          legacy('e-1', 'user-a', 1),
+          legacy('e-2', 'user-b', 2, 1),
+          legacy('e-3', 'user-a', 3),
+          legacy('e-4', 'user-a', 4, 5),
+          legacy('e-5', 'user-a', 5),
+          legacy('e-6', 'user-b', 6),
+        ]);
+
+        await expect(service.backfillStreamVersions()).resolves.toBe(4);
+
+        expect(bulkWrite).toHaveBeenCalledTimes(1);
+        expect(bulkWrite.mock.calls[0][0].map((op: any) => [op.updateOne.filter.entryId, op.updateOne.update.$set.streamVersion]))
+          .toEqual([['e-1', 1], ['e-3', 2], ['e-5', 6], ['e-6', 2]]);
+        expect(bulkWrite.mock.calls[0][0][0].updateOne.filter.streamVersion).toEqual({ $in: [null, 0] });
+        expect(LedgerEntryModel.find).toHaveBeenCalledWith({ accountType: { $eq: 'user' } });
+      });
+
+      it('should change nothing when a stream cannot be numbered', async () => {
+        mockStore([legacy('e-1', 'user-a', 1), legacy('e-2', 'user-b', 2), legacy('e-3', 'user-a', 3, 1)]);
+
+        const error = await service.backfillStreamVersions().catch(e => e);
+
+        expect(error).toBeInstanceOf(LedgerInconsistencyError);
+        expect(bulkWrite).not.toHaveBeenCalled();
+      });
+
+      it('should stamp every page of the store', async () => {
+        mockStore(Array.from({ length: 2500 }, (_, i) => legacy(`e-${String(i).padStart(4, '0')}`, 'user-a', 0)));
+
+        await expect(service.backfillStreamVersions()).resolves.toBe(2500);
+
+        expect(bulkWrite).toHaveBeenCalledTimes(3);
+        expect(bulkWrite.mock.calls[2][0].at(-1).updateOne.update.$set.streamVersion).toBe(2500);
+      });
+    });
+  });
+
+  describe('idempotency scope', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'tx-1001',
+      requestId: 'req-scope',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    let stored: any[];
+
+    beforeEach(() => {
+      // Emulate the unique (idempotencyScope, idempotencyKey) index
+      stored = [];
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+        if (stored.some(e => e.idempotencyKey === doc.idempotencyKey && e.idempotencyScope === doc.idempotencyScope)) {
+          const duplicateError: any = new Error('Duplicate key');
+          duplicateError.code = 11000;
+          duplicateError.keyPattern = { idempotencyScope: 1, idempotencyKey: 1 };
+          throw duplicateError;
+        }
+        stored.push(doc);
+        return doc;
+      });
+      (LedgerEntryModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(
+          stored.find(e =>
+            e.idempotencyKey === query.idempotencyKey.$eq &&
+            (query.idempotencyScope.$exists === false
+              ? e.idempotencyScope === undefined
+              : e.idempotencyScope === query.idempotencyScope.$eq)
+          ) || null
+        ),
+      }));
+    });
+
+    afterEach(() => {
+      (LedgerEntryModel.findOne as jest.Mock).mockReset();
+      (LedgerEntryModel.create as jest.Mock).mockReset();
+    });
+
+    it('should accept the same key under different scopes', async () => {
+      const loyalty = await service.createEntryWithResult({ ...request, idempotencyScope: 'loyalty' });
+      const referrals = await service.createEntryWithResult({ ...request, idempotencyScope: 'referrals' });
+      const global = await service.createEntryWithResult(request);
+
+      expect([loyalty.inserted, referrals.inserted, global.inserted]).toEqual([true, true, true]);
+      expect(loyalty.entry.idempotencyScope).toBe('loyalty');
+      expect(global.entry.idempotencyScope).toBeUndefined();
+      expect(stored).toHaveLength(3);
+    });
+
+    it('should replay a repeated key within one scope', async () => {
+      const first = await service.createEntryWithResult({ ...request, idempotencyScope: 'loyalty' });
+      await service.createEntryWithResult({ ...request, idempotencyScope: 'referrals' });
+      const repeat = await service.createEntryWithResult({ ...request, idempotencyScope: 'loyalty' });
+
+      expect(repeat.inserted).toBe(false);
+      expect(repeat.entry.entryId).toBe(first.entry.entryId);
+      expect(repeat.entry.idempotencyScope).toBe('loyalty');
+    });
+
+    it('should reject a repeated key within one scope when recording', async () => {
+      const fields: RecordEntryFields = {
+        idempotencyKey: 'tx-1001',
+        accountId: 'user-123',
+        type: TransactionType.CREDIT,
+        amount: 100,
+        reason: TransactionReason.PROMOTIONAL_AWARD,
+        balanceBefore: 0,
+        requestId: 'req-scope',
+        idempotencyScope: 'referrals',
       };
+      await service.createEntryWithResult({ ...request, idempotencyScope: 'loyalty' });
+
+      await expect(service.recordEntry(fields)).resolves.toMatchObject({ idempotencyScope: 'referrals' });
+      const error = await service.recordEntry(fields).catch(e => e);
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.DUPLICATE);
+    });
+
+    it('should treat an empty scope as the global namespace', async () => {
+      await service.createEntryWithResult(request);
+      const repeat = await service.createEntryWithResult({ ...request, idempotencyScope: '' });
+
+      expect(repeat.inserted).toBe(false);
+      expect(stored).toHaveLength(1);
+    });
+  });
+
+  describe('append errors', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-err',
+      requestId: 'req-err',
+      transactionId: 'txn-err',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    it('should classify schema validation failures as invalid', async () => {
+      const validationError: any = new Error('LedgerEntry validation failed');
+      validationError.name = 'ValidationError';
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(validationError);
+
+      const error = await service.createEntry(request).catch(e => e);
+
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(error.statusCode).toBe(400);
+      expect(error.cause).toBe(validationError);
+    });
+
+    it('should classify unexpected failures as storage errors', async () => {
+      const networkError = new Error('connection reset');
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(networkError);
+
+      const error = await service.createEntry(request).catch(e => e);
+
+      expect(error.appendCode).toBe(AppendErrorCode.STORAGE);
+      expect(error.code).toBe('LEDGER_APPEND_FAILED');
+      expect(error.message).toBe('connection reset');
+      expect(error.cause).toBe(networkError);
+    });
+
+    it('should carry the offending transaction identifiers', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(new Error('boom'));
+
+      const error = await service.createEntryWithResult(request).catch(e => e);
+
+      expect(error.idempotencyKey).toBe('idem-err');
+      expect(error.transactionId).toBe('txn-err');
+    });
+
+    it('should keep the code and status of a typed cause', async () => {
+      const scoped = createTenantScopedLedgerService('brand-a');
+
+      const error = await scoped.createEntry({ ...request, tenantId: 'brand-b' }).catch(e => e);
+
+      expect(error.code).toBe(new CrossTenantError('brand-a', 'brand-b').code);
+      expect(error.statusCode).toBe(new CrossTenantError('brand-a', 'brand-b').statusCode);
+    });
+
+    it('should classify invalid record fields without appending', async () => {
+      const error = await service
+        .recordEntry({
+          idempotencyKey: 'idem-bad',
+          accountId: 'user-123',
+          type: TransactionType.CREDIT,
+          amount: 0,
+          reason: TransactionReason.PROMOTIONAL_AWARD,
+          balanceBefore: 0,
+          requestId: 'req-bad',
+        })
+        .catch(e => e);
+
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(error.idempotencyKey).toBe('idem-bad');
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('recordEntry', () => {
+    const fields = {
+      idempotencyKey: 'idem-record-1',
+      accountId: 'user-123',
+      type: TransactionType.CREDIT,
+      amount: 250,
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      balanceBefore: 100,
+      requestId: 'req-record-1',
+      committedBy: 'svc-promotions',
+      comment: 'spring campaign',
+    };
+
+    it('should build and append the entry in one call', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const entry = await service.recordEntry(fields);
+
+      expect(entry.balanceAfter).toBe(350);
+      expect(LedgerEntryModel.create).toHaveBeenCalledWith(
+        expect.objectContaining({
+          accountType: 'user',
+          balanceState: 'available',
+          stateTransition: 'none→available',
+          metadata: { committedBy: 'svc-promotions', comment: 'spring campaign' },
+        })
+      );
+    });
+
+    it('should reject invalid fields before appending', async () => {
+      await expect(
+        service.recordEntry({ ...fields, type: TransactionType.DEBIT })
+      ).rejects.toThrow('Amount sign does not match transaction type debit');
+      await expect(service.recordEntry({ ...fields, amount: 0 })).rejects.toThrow(
+        'Amount must be a non-zero integer'
+      );
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should reject a duplicate idempotency key', async () => {
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { idempotencyKey: 1 };
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicateError);
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue({ entryId: 'entry-original', ...fields, timestamp: new Date() }),
+      });
+
+      const error = await service.recordEntry(fields).catch(e => e);
+
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.DUPLICATE);
+      expect(findErrorCause(error, IdempotencyConflictError)).toBeDefined();
+    });
+  });
+
+  describe('recordInferred', () => {
+    const fields = {
+      idempotencyKey: 'idem-inferred-1',
+      accountId: 'user-123',
+      amount: 250,
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      balanceBefore: 100,
+      requestId: 'req-inferred-1',
+      committedBy: 'svc-import',
+      comment: 'legacy feed',
+    };
+
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
+
+    it('should record a positive amount as an earn', async () => {
+      const entry = await service.recordInferred(fields);
+
+      expect(entry.type).toBe(TransactionType.CREDIT);
+      expect(entry.balanceAfter).toBe(350);
+      expect(LedgerEntryModel.create).toHaveBeenCalledWith(
+        expect.objectContaining({
+          stateTransition: 'none→available',
+          metadata: { committedBy: 'svc-import', comment: 'legacy feed' },
+        })
+      );
+    });
+
+    it('should record a negative amount as a redemption', async () => {
+      const entry = await service.recordInferred({
+        ...fields,
+        amount: -40,
+        reason: TransactionReason.REWARD_DROP_REDEMPTION,
+      });
+
+      expect(entry.type).toBe(TransactionType.DEBIT);
+      expect(entry.balanceAfter).toBe(60);
+      expect(LedgerEntryModel.create).toHaveBeenCalledWith(
+        expect.objectContaining({ stateTransition: 'available→none' })
+      );
+    });
+
+    it('should reject a zero amount', async () => {
+      const error = await service.recordInferred({ ...fields, amount: 0 }).catch(e => e);
+
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(error.message).toContain('zero amount');
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('queryEntries', () => {
+    it('should query entries with filters', async () => {
+      const filter: LedgerQueryFilter = {
+        accountId: 'user-123',
+        accountType: 'user',
+        type: TransactionType.CREDIT,
+        limit: 10,
+        offset: 0,
+      };
+
+      const mockEntries = [
+        {
+          entryId: 'entry-1',
+          transactionId: 'txn-1',
+          accountId: 'user-123',
+          accountType: 'user',
+          amount: 100,
+          type: 'credit',
+          balanceState: 'available',
+          stateTransition: 'credit→available',
+          reason: 'user_signup_bonus',
+          idempotencyKey: 'idem-1',
+          requestId: 'req-1',
+          balanceBefore: 0,
+          balanceAfter: 100,
+          timestamp: new Date(),
+          currency: 'points',
+        },
+      ];
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(mockEntries),
+      });
+
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(1);
+
+      const result = await service.queryEntries(filter);
+
+      expect(result.entries).toHaveLength(1);
+      expect(result.totalCount).toBe(1);
+      expect(result.hasMore).toBe(false);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({
+          accountId: { $eq: 'user-123' },
+          accountType: { $eq: 'user' },
+          type: { $eq: 'credit' },
+        })
+      );
+    });
+
+    it('should filter by date range', async () => {
+      const startDate = new Date('2024-01-01');
+      const endDate = new Date('2024-12-31');
+
+      const filter: LedgerQueryFilter = {
+        accountId: 'user-456',
+        startDate,
+        endDate,
+        limit: 10,
+        offset: 0,
+      };
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await service.queryEntries(filter);
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({
+          timestamp: { $gte: startDate, $lte: endDate },
+        })
+      );
+    });
+
+    it('should enforce maximum limit of 1000', async () => {
+      const filter: LedgerQueryFilter = {
+        limit: 5000,
+        offset: 0,
+      };
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      const result = await service.queryEntries(filter);
+
+      expect(result.limit).toBe(1000);
+    });
+
+    it('should exclude the given transactions', async () => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await service.queryEntries({ accountId: 'user-123', excludeTransactionIds: ['txn-hidden'] });
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({ transactionId: { $nin: ['txn-hidden'] } })
+      );
+    });
+
+    it('should keep unversioned entries when filtering by stream version', async () => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await service.queryEntries({ accountId: 'user-123', fromStreamVersion: 40 });
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({ streamVersion: { $not: { $lt: 40 } } })
+      );
+    });
+  });
+
+  describe('account alias resolution', () => {
+    it('should query the surviving account for a merged account ID', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-survivor'),
+      };
+      const resolvingService = new LedgerService({}, resolver);
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await resolvingService.queryEntries({ accountId: 'user-merged' });
+
+      expect(resolver.resolveAccountId).toHaveBeenCalledWith('user-merged');
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({
+          accountId: { $eq: 'user-survivor' },
+        })
+      );
+    });
+
+    it('should include the accounts merged into the surviving account', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-survivor'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+      const resolvingService = new LedgerService({}, resolver);
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await resolvingService.queryEntries({ accountId: 'user-survivor' });
+
+      expect(resolver.aliasesOf).toHaveBeenCalledWith('user-survivor');
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({
+          accountId: { $in: ['user-survivor', 'user-merged'] },
+        })
+      );
+    });
+  });
+
+  describe('signature verification', () => {
+    const { privateKey, publicKey } = generateKeyPairSync('ed25519');
+    const privatePem = privateKey.export({ type: 'pkcs8', format: 'pem' }).toString();
+    const publicPem = publicKey.export({ type: 'spki', format: 'pem' }).toString();
+
+    const storedEntry = (entryId: string, amount: number) => {
+      const entry = {
+        entryId,
+        transactionId: `txn-${entryId}`,
+        accountId: 'user-123',
+        accountType: 'user',
+        amount,
+        type: 'credit',
+        balanceState: 'available',
+        stateTransition: 'credit→available',
+        reason: 'user_signup_bonus',
+        idempotencyKey: `idem-${entryId}`,
+        requestId: 'req-1',
+        balanceBefore: 0,
+        balanceAfter: amount,
+        timestamp: new Date('2024-01-01T00:00:00Z'),
+        currency: 'points',
+      };
+      return { ...entry, signature: signEntry(entry, privatePem) };
+    };
+
+    const mockFind = (entries: any[]) => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(entries),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(entries.length);
+    };
+
+    it('should sign new entries when a signing key is configured', async () => {
+      const signingService = new LedgerService({ signingPrivateKey: privatePem });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const result = await signingService.createEntry({
+        accountId: 'user-123',
+        accountType: 'user',
+        amount: 100,
+        type: TransactionType.CREDIT,
+        balanceState: 'available',
+        stateTransition: 'credit→available',
+        reason: TransactionReason.USER_SIGNUP_BONUS,
+        idempotencyKey: 'idem-signed',
+        requestId: 'req-signed',
+        balanceBefore: 0,
+        balanceAfter: 100,
+      });
+
+      expect(result.signature).toEqual(expect.any(String));
+    });
+
+    it('should skip tampered entries when verifyOnRead is enabled', async () => {
+      const tampered = { ...storedEntry('entry-2', 50), amount: 5000 };
+      mockFind([storedEntry('entry-1', 100), tampered]);
+
+      const verifyingService = new LedgerService({
+        verifyOnRead: true,
+        verificationPublicKey: publicPem,
+      });
+      const result = await verifyingService.queryEntries({ accountId: 'user-123' });
+
+      expect(result.entries.map(e => e.entryId)).toEqual(['entry-1']);
+    });
+
+    it('should report failed entry IDs from queryEntriesVerified', async () => {
+      const tampered = { ...storedEntry('entry-2', 50), balanceAfter: 9999 };
+      const unsigned = { ...storedEntry('entry-3', 10), signature: undefined };
+      mockFind([storedEntry('entry-1', 100), tampered, unsigned]);
+
+      const verifyingService = new LedgerService({ verificationPublicKey: publicPem });
+      const result = await verifyingService.queryEntriesVerified({ accountId: 'user-123' });
+
+      expect(result.entries.map(e => e.entryId)).toEqual(['entry-1']);
+      expect(result.failedEntryIds).toEqual(['entry-2', 'entry-3']);
+    });
+
+    it('should return null from getEntry for a tampered entry', async () => {
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue({ ...storedEntry('entry-4', 10), accountId: 'user-evil' }),
+      });
+
+      const verifyingService = new LedgerService({
+        verifyOnRead: true,
+        verificationPublicKey: publicPem,
+      });
+
+      await expect(verifyingService.getEntry('entry-4')).resolves.toBeNull();
+    });
+
+    it('should require a public key when verifyOnRead is enabled', () => {
+      expect(() => new LedgerService({ verifyOnRead: true })).toThrow('verificationPublicKey is required');
+    });
+  });
+
+  describe('tenant scoping', () => {
+    const baseRequest: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'credit→available',
+      reason: TransactionReason.USER_SIGNUP_BONUS,
+      idempotencyKey: 'idem-tenant',
+      requestId: 'req-tenant',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    const mockEmptyFind = () => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+    };
+
+    it('should stamp the tenant on entries created through a scoped service', async () => {
+      const scoped = createTenantScopedLedgerService('brand-a');
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const result = await scoped.createEntry(baseRequest);
+
+      expect(result.tenantId).toBe('brand-a');
+      expect(LedgerEntryModel.create).toHaveBeenCalledWith(
+        expect.objectContaining({ tenantId: 'brand-a' })
+      );
+    });
+
+    it('should reject entries carrying a different tenant', async () => {
+      const scoped = createTenantScopedLedgerService('brand-a');
+
+      const error = await scoped.createEntry({ ...baseRequest, tenantId: 'brand-b' }).catch(e => e);
+
+      expect(error.appendCode).toBe(AppendErrorCode.CROSS_TENANT);
+      expect(findErrorCause(error, CrossTenantError)).toBeDefined();
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should filter every query to the scoped tenant', async () => {
+      mockEmptyFind();
+      const scoped = createTenantScopedLedgerService('brand-a');
+
+      await scoped.queryEntries({ accountId: 'user-123' });
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({
+          accountId: { $eq: 'user-123' },
+          tenantId: { $eq: 'brand-a' },
+        })
+      );
+    });
+
+    it('should reject queries for another tenant', async () => {
+      const scoped = createTenantScopedLedgerService('brand-a');
+
+      await expect(
+        scoped.queryEntries({ accountId: 'user-123', tenantId: 'brand-b' })
+      ).rejects.toThrow(CrossTenantError);
+    });
+
+    it('should replay only the tenant\'s own entry on idempotency key collision', async () => {
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { tenantId: 1, idempotencyScope: 1, idempotencyKey: 1 };
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicateError);
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnValue({
+          exec: jest.fn().mockResolvedValue({ ...baseRequest, entryId: 'entry-a', tenantId: 'brand-a' }),
+        }),
+      });
+
+      const scoped = createTenantScopedLedgerService('brand-a');
+
+      const replayed = await scoped.createEntry(baseRequest);
+
+      expect(replayed.entryId).toBe('entry-a');
+      expect(LedgerEntryModel.findOne).toHaveBeenCalledWith(
+        expect.objectContaining({ tenantId: { $eq: 'brand-a' }, idempotencyKey: { $eq: baseRequest.idempotencyKey } })
+      );
+    });
+
+    it('should leave single-tenant queries unscoped', async () => {
+      mockEmptyFind();
+
+      await service.queryEntries({ accountId: 'user-123' });
+
+      const query = (LedgerEntryModel.find as jest.Mock).mock.calls[0][0];
+      expect(query).not.toHaveProperty('tenantId');
+    });
+
+    it('should reject malformed tenant IDs', () => {
+      expect(() => createTenantScopedLedgerService('bad tenant!')).toThrow('Invalid tenant ID');
+    });
+  });
+
+  describe('getEntry', () => {
+    it('should retrieve a specific entry by ID', async () => {
+      const mockEntry = {
+        entryId: 'entry-specific',
+        transactionId: 'txn-specific',
+        accountId: 'user-123',
+        accountType: 'user',
+        amount: 100,
+        type: 'credit',
+        balanceState: 'available',
+        stateTransition: 'credit→available',
+        reason: 'user_signup_bonus',
+        idempotencyKey: 'idem-specific',
+        requestId: 'req-specific',
+        balanceBefore: 0,
+        balanceAfter: 100,
+        timestamp: new Date(),
+        currency: 'points',
+      };
+
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(mockEntry),
+      });
+
+      const result = await service.getEntry('entry-specific');
+
+      expect(result).not.toBeNull();
+      expect(result?.entryId).toBe('entry-specific');
+      expect(LedgerEntryModel.findOne).toHaveBeenCalledWith({
+        entryId: { $eq: 'entry-specific' },
+      });
+    });
+
+    it('should return null if entry not found', async () => {
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(null),
+      });
+
+      const result = await service.getEntry('nonexistent');
+
+      expect(result).toBeNull();
+    });
+  });
+
+  describe('entryExists', () => {
+    it('should report a present entry without reading the document', async () => {
+      (LedgerEntryModel.exists as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue({ _id: 'oid-1' }),
+      });
+
+      await expect(service.entryExists('entry-specific')).resolves.toBe(true);
+
+      expect(LedgerEntryModel.exists).toHaveBeenCalledWith({ entryId: { $eq: 'entry-specific' } });
+      expect(LedgerEntryModel.findOne).not.toHaveBeenCalled();
+    });
+
+    it('should report an absent entry', async () => {
+      (LedgerEntryModel.exists as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue(null),
+      });
+
+      await expect(service.entryExists('nonexistent')).resolves.toBe(false);
+    });
+  });
+
+  describe('getBalanceSnapshot', () => {
+    it('should calculate balance snapshot for user', async () => {
+      const mockEntries = [
+        {
+          balanceState: 'available',
+          balanceAfter: 500,
+          timestamp: new Date('2024-01-01'),
+        },
+        {
+          balanceState: 'escrow',
+          balanceAfter: 100,
+          timestamp: new Date('2024-01-02'),
+        },
+      ];
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(mockEntries),
+      });
+
+      const result = await service.getBalanceSnapshot('user-123', 'user');
+
+      expect(result.accountId).toBe('user-123');
+      expect(result.accountType).toBe('user');
+      expect(result.availableBalance).toBe(500);
+      expect(result.escrowBalance).toBe(100);
+    });
+
+    it('should calculate balance snapshot for model', async () => {
+      const mockEntries = [
+        {
+          balanceState: 'earned',
+          balanceAfter: 1000,
+          timestamp: new Date('2024-01-01'),
+        },
+      ];
+
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(mockEntries),
+      });
+
+      const result = await service.getBalanceSnapshot('model-456', 'model');
+
+      expect(result.accountId).toBe('model-456');
+      expect(result.accountType).toBe('model');
+      expect(result.earnedBalance).toBe(1000);
+    });
+  });
+
+  describe('tag indexing', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-tag-1',
+      requestId: 'req-tag-1',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      metadata: { campaign_id: 'spring-2024', note: 'not indexed' },
+    };
+
+    it('should store only configured tag keys for indexing', async () => {
+      const tagged = new LedgerService({ indexedTagKeys: ['campaign_id'] });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      await tagged.createEntry(request);
+
+      expect(LedgerEntryModel.create).toHaveBeenCalledWith(
+        expect.objectContaining({
+          indexedTags: [{ key: 'campaign_id', value: 'spring-2024' }],
+        })
+      );
+    });
+
+    it('should not add indexed tags when no keys are configured', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      await service.createEntry(request);
+
+      const [doc] = (LedgerEntryModel.create as jest.Mock).mock.calls[0];
+      expect(doc.indexedTags).toBeUndefined();
+    });
+
+    it('should look up entries by an indexed tag', async () => {
+      const tagged = new LedgerService({ indexedTagKeys: ['campaign_id'] });
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([{ entryId: 'entry-1', ...request, timestamp: new Date() }]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(1);
+
+      const result = await tagged.getByTag('campaign_id', 'spring-2024');
+
+      expect(result.entries).toHaveLength(1);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({
+        indexedTags: {
+          $elemMatch: { key: { $eq: 'campaign_id' }, value: { $eq: 'spring-2024' } },
+        },
+      });
+    });
+
+    it('should reject lookups on unindexed keys', async () => {
+      const tagged = new LedgerService({ indexedTagKeys: ['campaign_id'] });
+
+      await expect(tagged.getByTag('note', 'anything')).rejects.toThrow(TagNotIndexedError);
+      expect(LedgerEntryModel.find).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('findThresholdCrossing', () => {
+    const history = (balances: number[]) =>
+      balances.map((balanceAfter, i) => ({
+        entryId: `entry-${i}`,
+        transactionId: `txn-${i}`,
+        accountId: 'user-123',
+        accountType: 'user',
+        amount: balanceAfter - (i === 0 ? 0 : balances[i - 1]),
+        type: 'credit',
+        balanceState: 'available',
+        balanceBefore: i === 0 ? 0 : balances[i - 1],
+        balanceAfter,
+        timestamp: new Date(Date.UTC(2024, 0, 1 + i)),
+        currency: 'points',
+      }));
+
+    const mockHistory = (entries: any[]) => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(entries),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(entries.length);
+    };
+
+    it('should return the entry where the balance first reaches the threshold', async () => {
+      mockHistory(history([200, 600, 1000, 1400]));
+
+      const crossing = await service.findThresholdCrossing('user-123', 1000);
+
+      expect(crossing?.entry.entryId).toBe('entry-2');
+      expect(crossing?.balance).toBe(1000);
+    });
+
+    it('should return the first crossing when the balance dips and re-crosses', async () => {
+      mockHistory(history([500, 1200, 300, 1500]));
+
+      const crossing = await service.findThresholdCrossing('user-123', 1000);
+
+      expect(crossing?.entry.entryId).toBe('entry-1');
+      expect(crossing?.balance).toBe(1200);
+    });
+
+    it('should return null when the threshold is never reached', async () => {
+      mockHistory(history([100, 400, 900]));
+
+      await expect(service.findThresholdCrossing('user-123', 1000)).resolves.toBeNull();
+    });
+
+    it('should replay the available balance in timestamp order', async () => {
+      mockHistory([]);
+
+      await service.findThresholdCrossing('user-123', 1000);
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({
+          accountId: { $eq: 'user-123' },
+          balanceState: { $eq: 'available' },
+        })
+      );
+    });
+  });
+
+
+  describe('findBalanceEquals', () => {
+    const history = (balances: number[]) =>
+      balances.map((balanceAfter, i) => ({
+        entryId: `entry-${i}`,
+        transactionId: `txn-${i}`,
+        accountId: 'user-123',
+        accountType: 'user',
+        amount: balanceAfter - (i === 0 ? 0 : balances[i - 1]),
+        type: 'credit',
+        balanceState: 'available',
+        balanceBefore: i === 0 ? 0 : balances[i - 1],
+        balanceAfter,
+        timestamp: new Date(Date.UTC(2024, 0, 1 + i)),
+        currency: 'points',
+      }));
+
+    const mockHistory = (entries: any[]) => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(entries),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(entries.length);
+    };
+
+    it('should return the transaction after which the balance equalled the target', async () => {
+      mockHistory(history([200, 500, 800]));
+
+      await expect(service.findBalanceEquals('user-123', 500)).resolves.toMatchObject({ transactionId: 'txn-1' });
+    });
+
+    it('should return the first of several times the balance equalled the target', async () => {
+      mockHistory(history([500, 900, 500, 300, 500]));
+
+      await expect(service.findBalanceEquals('user-123', 500)).resolves.toMatchObject({ transactionId: 'txn-0' });
+    });
+
+    it('should not match a balance the history only passed over', async () => {
+      mockHistory(history([200, 900, 100]));
+
+      await expect(service.findBalanceEquals('user-123', 500)).resolves.toBeNull();
+    });
+
+    it('should reject a target that is not an integer', async () => {
+      await expect(service.findBalanceEquals('user-123', 2.5)).rejects.toThrow('must be an integer');
+    });
+
+    it('should replay the user\'s history with merged accounts, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-123'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+      mockHistory(history([200, 500]));
+
+      await new LedgerService({}, resolver).findBalanceEquals('user-123', 500, 'tenant-a');
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({ tenantId: { $eq: 'tenant-a' }, accountId: { $in: ['user-123', 'user-merged'] } })
+      );
+    });
+  });
+
+  describe('peakBalance', () => {
+    const history = (balances: number[]) =>
+      balances.map((balanceAfter, i) => ({
+        entryId: `entry-${i}`,
+        transactionId: `txn-${i}`,
+        accountId: 'user-123',
+        accountType: 'user',
+        balanceState: 'available',
+        balanceAfter,
+        timestamp: new Date(Date.UTC(2024, 0, 1 + i)),
+      }));
+
+    // Applies the requested sort to the history, as the store would
+    const mockHistory = (entries: any[]) => {
+      let order: Record<string, 1 | -1> = {};
+      const chain = {
+        sort: jest.fn().mockImplementation(spec => {
+          order = spec;
+          return chain;
+        }),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockImplementation(async () => {
+          const sorted = [...entries].sort((a, b) => {
+            for (const [field, direction] of Object.entries(order)) {
+              if (a[field] < b[field]) return -direction;
+              if (a[field] > b[field]) return direction;
+            }
+            return 0;
+          });
+          return sorted[0] ?? null;
+        }),
+      };
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue(chain);
+    };
+
+    it('should return a peak reached mid-history', async () => {
+      mockHistory(history([200, 900, 400, 900, 300]));
+
+      // The second 900 is a tie and loses to the earlier one
+      await expect(service.peakBalance('user-123')).resolves.toEqual({
+        balance: 900,
+        timestamp: new Date(Date.UTC(2024, 0, 2)),
+      });
+      expect(LedgerEntryModel.findOne).toHaveBeenCalledWith({
+        accountId: { $eq: 'user-123' },
+        accountType: { $eq: 'user' },
+        balanceState: { $eq: 'available' },
+      });
+    });
+
+    it('should return the current balance when it is the peak', async () => {
+      mockHistory(history([200, 500, 300, 800]));
+
+      await expect(service.peakBalance('user-123')).resolves.toEqual({
+        balance: 800,
+        timestamp: new Date(Date.UTC(2024, 0, 4)),
+      });
+    });
+
+    it('should return zero and no timestamp for a user without entries', async () => {
+      mockHistory([]);
+
+      await expect(service.peakBalance('user-123')).resolves.toEqual({ balance: 0, timestamp: null });
+    });
+  });
+
+  describe('globalStats', () => {
+    const entry = (
+      accountId: string,
+      type: TransactionType,
+      reason: TransactionReason,
+      amount: number,
+      stateTransition = 'none→available'
+    ) => ({ accountId, accountType: 'user', balanceState: 'available', type, reason, amount, stateTransition });
+
+    // Applies the $group stage to the stored entries, as the store would
+    const mockStore = (entries: any[]) => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation(() => ({
+        exec: jest.fn().mockImplementation(async () => {
+          const groups = new Map<string, any>();
+          for (const e of entries) {
+            const escrowRefund = e.stateTransition === 'escrow→available';
+            const key = `${e.type}/${e.reason}/${escrowRefund}`;
+            const group = groups.get(key) || { _id: { type: e.type, reason: e.reason, escrowRefund }, total: 0 };
+            group.total += e.amount;
+            groups.set(key, group);
+          }
+          return [...groups.values()];
+        }),
+      }));
+    };
+
+    it('should total earns, redemptions and adjustments across users', async () => {
+      mockStore([
+        entry('user-1', TransactionType.CREDIT, TransactionReason.USER_SIGNUP_BONUS, 500),
+        entry('user-1', TransactionType.DEBIT, TransactionReason.CHIP_MENU_PURCHASE, -200),
+        entry('user-2', TransactionType.CREDIT, TransactionReason.PROMOTIONAL_AWARD, 300),
+        entry('user-2', TransactionType.DEBIT, TransactionReason.SLOT_MACHINE_PLAY, -50),
+        entry('user-2', TransactionType.CREDIT, TransactionReason.ADMIN_CREDIT, 40),
+        entry('user-3', TransactionType.CREDIT, TransactionReason.REFERRAL_BONUS, 100),
+        entry('user-3', TransactionType.DEBIT, TransactionReason.POINT_EXPIRY, -100),
+        entry('user-1', TransactionType.CREDIT, TransactionReason.ADMIN_REFUND, 200),
+      ]);
+
+      await expect(service.globalStats()).resolves.toEqual({
+        earned: 900,
+        redeemed: 250,
+        adjusted: 140,
+        net: 790,
+      });
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({ accountType: { $eq: 'user' }, balanceState: { $eq: 'available' } });
+    });
+
+    it('should count reward drops as redeemed and net out refunded escrow holds', async () => {
+      mockStore([
+        entry('user-1', TransactionType.CREDIT, TransactionReason.PURCHASE_EARN, 1000),
+        entry('user-1', TransactionType.DEBIT, TransactionReason.PERFORMANCE_REQUEST, -300, 'available→escrow'),
+        entry('user-1', TransactionType.CREDIT, TransactionReason.PERFORMANCE_ABANDONED, 300, 'escrow→available'),
+        entry('user-1', TransactionType.DEBIT, TransactionReason.PERFORMANCE_REQUEST, -200, 'available→escrow'),
+        entry('user-1', TransactionType.CREDIT, TransactionReason.PARTIAL_PERFORMANCE, 50, 'escrow→available'),
+        entry('user-2', TransactionType.DEBIT, TransactionReason.REWARD_DROP_REDEMPTION, -100, 'available→none'),
+      ]);
+
+      await expect(service.globalStats()).resolves.toEqual({
+        earned: 1000,
+        redeemed: 250,
+        adjusted: 0,
+        net: 750,
+      });
+    });
+
+    it('should return zeros for an empty store', async () => {
+      mockStore([]);
+
+      await expect(service.globalStats()).resolves.toEqual({ earned: 0, redeemed: 0, adjusted: 0, net: 0 });
+    });
+
+    it('should reject totals beyond the safe integer range', async () => {
+      mockStore([
+        entry('user-1', TransactionType.CREDIT, TransactionReason.USER_SIGNUP_BONUS, Number.MAX_SAFE_INTEGER),
+        entry('user-2', TransactionType.CREDIT, TransactionReason.PROMOTIONAL_AWARD, 10),
+      ]);
+
+      await expect(service.globalStats()).rejects.toThrow(LedgerInconsistencyError);
+    });
+
+    it('should read a large store in a single aggregation', async () => {
+      const entries = Array.from({ length: 50000 }, (_, i) =>
+        entry(`user-${i % 5000}`, TransactionType.CREDIT, TransactionReason.PURCHASE_EARN, 10)
+      );
+      mockStore(entries);
+
+      await expect(service.globalStats()).resolves.toMatchObject({ earned: 500000, net: 500000 });
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledTimes(1);
+      expect(LedgerEntryModel.find).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('amountPercentiles', () => {
+    const mockAmounts = (amounts: number[]) => {
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(amounts.map(amount => ({ amount }))),
+      });
+    };
+
+    it('should return the median and p90 of a known distribution', async () => {
+      // 1..100 in shuffled order
+      mockAmounts(Array.from({ length: 100 }, (_, i) => ((i * 37) % 100) + 1));
+
+      const result = await service.amountPercentiles(TransactionType.CREDIT, [0.5, 0.9, 0.99, 1]);
+
+      expect([...result.entries()]).toEqual([[0.5, 50], [0.9, 90], [0.99, 99], [1, 100]]);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        { type: { $eq: 'credit' }, accountType: { $eq: 'user' }, balanceState: { $eq: 'available' } },
+        { amount: 1, _id: 0 }
+      );
+    });
+
+    it('should measure redemptions by size', async () => {
+      mockAmounts([-500, -20, -100, -40, -60]);
+
+      const result = await service.amountPercentiles(TransactionType.DEBIT, [0, 0.5, 0.9]);
+
+      expect(result.get(0)).toBe(20);
+      expect(result.get(0.5)).toBe(60);
+      expect(result.get(0.9)).toBe(500);
+    });
+
+    it('should return zeros when there are no entries of the type', async () => {
+      mockAmounts([]);
+
+      const result = await service.amountPercentiles(TransactionType.DEBIT, [0.5, 0.99]);
+
+      expect([...result.entries()]).toEqual([[0.5, 0], [0.99, 0]]);
+    });
+
+    it('should reject a percentile outside [0, 1]', async () => {
+      await expect(service.amountPercentiles(TransactionType.CREDIT, [0.5, 90])).rejects.toThrow(
+        'Percentile must be between 0 and 1: 90'
+      );
+      expect(LedgerEntryModel.find).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('neighborEntries', () => {
+    const history = ['e-1', 'e-2', 'e-3', 'e-4'].map((entryId, i) => ({
+      entryId,
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 10,
+      // e-2 and e-3 share a timestamp and are ordered by entry ID
+      timestamp: new Date(Date.UTC(2024, 0, i === 2 ? 2 : i + 1)),
+    }));
+    const other = { ...history[1], entryId: 'e-other', accountId: 'user-456' };
+
+    // Evaluates the $eq/$lt/$gt/$or filters and sort the service sends
+    const matches = (doc: any, query: any): boolean =>
+      Object.entries(query).every(([field, condition]: [string, any]) => {
+        if (field === '$or') {
+          return condition.some((clause: any) => matches(doc, clause));
+        }
+        const value = doc[field] instanceof Date ? doc[field].getTime() : doc[field];
+        const operand = (v: any) => (v instanceof Date ? v.getTime() : v);
+        return (
+          (condition.$eq === undefined || value === operand(condition.$eq)) &&
+          (condition.$lt === undefined || value < operand(condition.$lt)) &&
+          (condition.$gt === undefined || value > operand(condition.$gt))
+        );
+      });
+
+    beforeEach(() => {
+      (LedgerEntryModel.findOne as jest.Mock).mockImplementation((query: any) => {
+        let order: Record<string, 1 | -1> = {};
+        const chain: any = {
+          sort: jest.fn().mockImplementation(spec => {
+            order = spec;
+            return chain;
+          }),
+          lean: jest.fn().mockReturnThis(),
+          exec: jest.fn().mockImplementation(async () => {
+            const found = [...history, other].filter(doc => matches(doc, query)).sort((a: any, b: any) => {
+              for (const [field, direction] of Object.entries(order)) {
+                if (a[field] < b[field]) return -direction;
+                if (a[field] > b[field]) return direction;
+              }
+              return 0;
+            });
+            return found[0] ?? null;
+          }),
+        };
+        return chain;
+      });
+    });
+
+    it('should return both neighbours of a middle entry', async () => {
+      const { previous, next } = await service.neighborEntries('user-123', 'e-2');
+
+      expect(previous?.entryId).toBe('e-1');
+      expect(next?.entryId).toBe('e-3');
+    });
+
+    it('should return no previous entry for the first entry', async () => {
+      const { previous, next } = await service.neighborEntries('user-123', 'e-1');
+
+      expect(previous).toBeNull();
+      expect(next?.entryId).toBe('e-2');
+    });
+
+    it('should return no next entry for the latest entry', async () => {
+      const { previous, next } = await service.neighborEntries('user-123', 'e-4');
+
+      expect(previous?.entryId).toBe('e-3');
+      expect(next).toBeNull();
+    });
+
+    it('should reject an entry outside the user\'s history', async () => {
+      await expect(service.neighborEntries('user-123', 'e-other')).rejects.toThrow(EntryNotFoundError);
+      await expect(service.neighborEntries('user-123', 'e-missing')).rejects.toThrow(EntryNotFoundError);
+    });
+  });
+
+  describe('typesPresent', () => {
+    const mockTypes = (types: string[]) => {
+      (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({ exec: jest.fn().mockResolvedValue(types) });
+    };
+
+    it('should return the single type a user has used', async () => {
+      mockTypes(['credit']);
+
+      await expect(service.typesPresent('user-123')).resolves.toEqual([TransactionType.CREDIT]);
+      expect(LedgerEntryModel.distinct).toHaveBeenCalledWith('type', {
+        accountId: { $eq: 'user-123' },
+        accountType: { $eq: 'user' },
+      });
+    });
+
+    it('should return every type in a stable order', async () => {
+      mockTypes(['debit', 'credit']);
+
+      await expect(service.typesPresent('user-123')).resolves.toEqual([TransactionType.CREDIT, TransactionType.DEBIT]);
+    });
+
+    it('should put other stored types after the known ones', async () => {
+      mockTypes(['transfer', 'debit', 'adjust']);
+
+      await expect(service.typesPresent('user-123')).resolves.toEqual([TransactionType.DEBIT, 'adjust', 'transfer']);
+    });
+
+    it('should return an empty list for a user without entries', async () => {
+      mockTypes([]);
+
+      await expect(service.typesPresent('user-123')).resolves.toEqual([]);
+    });
+
+    it('should include the types of accounts merged into the user', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-survivor'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+      mockTypes(['debit', 'credit']);
+
+      await new LedgerService({}, resolver).typesPresent('user-survivor', 'tenant-a');
+
+      expect(LedgerEntryModel.distinct).toHaveBeenCalledWith('type', {
+        tenantId: { $eq: 'tenant-a' },
+        accountId: { $in: ['user-survivor', 'user-merged'] },
+        accountType: { $eq: 'user' },
+      });
+    });
+  });
+
+  describe('conflicting replays', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-replay',
+      requestId: 'req-replay-1',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      metadata: { campaign: 'spring' },
+    };
+
+    const storedAs = (original: CreateLedgerEntryRequest) => {
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { idempotencyKey: 1 };
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicateError);
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue({
+          ...original,
+          entryId: 'entry-original',
+          transactionId: 'txn-original',
+          currency: 'points',
+          timestamp: new Date('2025-03-01T00:00:00Z'),
+        }),
+      });
+    };
+
+    it('should treat an identical replay as a duplicate', async () => {
+      service = new LedgerService({ rejectConflictingReplays: true });
+      storedAs(request);
+
+      // A retry carries its own request ID and may see different balances
+      const result = await service.createEntryWithResult({
+        ...request,
+        requestId: 'req-replay-2',
+        balanceBefore: 50,
+        balanceAfter: 150,
+      });
+
+      expect(result.inserted).toBe(false);
+      expect(result.entry.entryId).toBe('entry-original');
+    });
+
+    it('should reject a replay whose content differs', async () => {
+      service = new LedgerService({ rejectConflictingReplays: true });
+      storedAs(request);
+
+      const error = await service
+        .createEntryWithResult({ ...request, amount: 500, metadata: { campaign: 'summer' } })
+        .catch(e => e);
+
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.CONTENT_CONFLICT);
+      expect(isRetryableAppendError(error)).toBe(false);
+      expect(findErrorCause(error, ReplayContentConflictError)?.details).toEqual({
+        key: 'idem-replay',
+        entryId: 'entry-original',
+        fields: ['amount', 'metadata'],
+      });
+    });
+
+    it('should return the stored entry for a differing replay by default', async () => {
+      storedAs(request);
+
+      const result = await service.createEntryWithResult({ ...request, amount: 500 });
+
+      expect(result.inserted).toBe(false);
+      expect(result.entry.amount).toBe(100);
+    });
+  });
+
+  describe('sessions', () => {
+    const MINUTE = 60 * 1000;
+    const start = Date.UTC(2025, 0, 1);
+
+    const mockHistory = (minutes: number[]) => {
+      const entries = minutes.map((minute, i) => ({
+        entryId: `entry-${i}`,
+        accountId: 'user-123',
+        accountType: 'user',
+        amount: 10,
+        balanceState: 'available',
+        timestamp: new Date(start + minute * MINUTE),
+      }));
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(entries),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(entries.length);
+    };
+
+    const ids = (sessions: any[][]) => sessions.map(session => session.map(entry => entry.entryId));
+
+    it('should keep entries within the gap in one session', async () => {
+      mockHistory([0, 10, 25, 30]);
+
+      await expect(service.sessions('user-123', 15 * MINUTE).then(ids)).resolves.toEqual([
+        ['entry-0', 'entry-1', 'entry-2', 'entry-3'],
+      ]);
+    });
+
+    it('should start a new session after a gap longer than the limit', async () => {
+      mockHistory([0, 5, 120, 130, 131, 600]);
+
+      await expect(service.sessions('user-123', 30 * MINUTE).then(ids)).resolves.toEqual([
+        ['entry-0', 'entry-1'],
+        ['entry-2', 'entry-3', 'entry-4'],
+        ['entry-5'],
+      ]);
+    });
+
+    it('should keep entries with identical timestamps together and split only past the gap', async () => {
+      mockHistory([0, 0, 0, 30, 61]);
+
+      await expect(service.sessions('user-123', 30 * MINUTE).then(ids)).resolves.toEqual([
+        ['entry-0', 'entry-1', 'entry-2', 'entry-3'],
+        ['entry-4'],
+      ]);
+      await expect(service.sessions('user-123', 0).then(ids)).resolves.toEqual([
+        ['entry-0', 'entry-1', 'entry-2'],
+        ['entry-3'],
+        ['entry-4'],
+      ]);
+    });
+
+    it('should return no sessions for a user without entries and reject a negative gap', async () => {
+      mockHistory([]);
+
+      await expect(service.sessions('user-123', MINUTE)).resolves.toEqual([]);
+      await expect(service.sessions('user-123', -1)).rejects.toThrow('must not be negative');
+    });
+
+    it('should read the user\'s history with merged accounts, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-123'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+      mockHistory([0]);
+
+      await new LedgerService({}, resolver).sessions('user-123', MINUTE, 'tenant-a');
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+        expect.objectContaining({ tenantId: { $eq: 'tenant-a' }, accountId: { $in: ['user-123', 'user-merged'] } })
+      );
+    });
+  });
+
+  describe('appendRate', () => {
+    const now = new Date('2025-01-01T12:00:00Z');
+    // Seconds before now at which entries were appended
+    const ages = [0, 1, 2.5, 4, 9.999, 10, 30, 3600];
+
+    beforeEach(() => {
+      (LedgerEntryModel.countDocuments as jest.Mock).mockImplementation(async (query: any) =>
+        ages
+          .map(age => new Date(now.getTime() - age * 1000))
+          .filter(timestamp => timestamp > query.timestamp.$gt && timestamp <= query.timestamp.$lte).length
+      );
+    });
+
+    it('should divide the appends inside the window by its length in seconds', async () => {
+      await expect(service.appendRate(10_000, now)).resolves.toBe(0.5);
+      await expect(service.appendRate(60_000, now)).resolves.toBe(7 / 60);
+    });
+
+    it('should leave out entries on the window\'s opening edge and after now', async () => {
+      await expect(service.appendRate(1000, new Date(now.getTime() - 1000))).resolves.toBe(1);
+    });
+
+    it('should report zero for an idle window and reject a non-positive one', async () => {
+      await expect(service.appendRate(1000, new Date('2024-01-01T00:00:00Z'))).resolves.toBe(0);
+      await expect(service.appendRate(0, now)).rejects.toThrow('must be positive');
+    });
+  });
+
+  describe('balanceDelta', () => {
+    // Available balance 0 -> 100 -> 60 -> 260 -> 235 over four days
+    const amounts = [100, -40, 200, -25];
+    const entries = amounts.map((amount, i) => {
+      const balanceBefore = amounts.slice(0, i).reduce((sum, a) => sum + a, 0);
+      return {
+        entryId: `entry-${i}`,
+        accountId: 'user-123',
+        accountType: 'user',
+        amount,
+        balanceState: 'available',
+        balanceBefore,
+        balanceAfter: balanceBefore + amount,
+        timestamp: new Date(Date.UTC(2024, 0, 1 + i)),
+      };
+    });
+
+    // Evaluates the $match window and the $sum over the in-memory entries
+    beforeEach(() => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+        const { $gt, $lte } = pipeline[0].$match.timestamp;
+        const window = entries.filter(e => e.timestamp > $gt && e.timestamp <= $lte);
+        const rows = window.length ? [{ _id: null, delta: window.reduce((sum, e) => sum + e.amount, 0) }] : [];
+        return { exec: jest.fn().mockResolvedValue(rows) };
+      });
+    });
+
+    const day = (d: number) => new Date(Date.UTC(2024, 0, d));
+
+    it.each([
+      [day(1), day(4)],
+      [day(0), day(4)],
+      [day(2), day(3)],
+      [day(3), day(3)],
+      [day(5), day(9)],
+    ])('should equal the sum of amounts in (%s, %s]', async (from, to) => {
+      const expected = entries
+        .filter(e => e.timestamp > from && e.timestamp <= to)
+        .reduce((sum, e) => sum + e.amount, 0);
+
+      await expect(service.balanceDelta('user-123', from, to)).resolves.toBe(expected);
+    });
+
+    it('should match the available balance in one aggregation', async () => {
+      await service.balanceDelta('user-123', day(1), day(4));
+
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledTimes(1);
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        accountId: { $eq: 'user-123' },
+        accountType: { $eq: 'user' },
+        balanceState: { $eq: 'available' },
+        timestamp: { $gt: day(1), $lte: day(4) },
+      });
+      expect(pipeline[1]).toEqual({ $group: { _id: null, delta: { $sum: '$amount' } } });
+    });
+
+    it('should include the accounts merged into the account, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-123'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+
+      await new LedgerService({}, resolver).balanceDelta('user-123', day(1), day(4), 'user', 'tenant-a');
+
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        tenantId: { $eq: 'tenant-a' },
+        accountId: { $in: ['user-123', 'user-merged'] },
+        accountType: { $eq: 'user' },
+        balanceState: { $eq: 'available' },
+        timestamp: { $gt: day(1), $lte: day(4) },
+      });
+    });
+
+    it('should reject a range where from is after to', async () => {
+      await expect(service.balanceDelta('user-123', day(4), day(1))).rejects.toThrow(
+        InvalidTimeRangeError
+      );
+      expect(LedgerEntryModel.aggregate).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('referencesByUser', () => {
+    const entries = [
+      { entryId: 'e-1', accountId: 'user-123', correlationId: 'order-1', timestamp: new Date('2025-01-01T00:00:00Z') },
+      { entryId: 'e-2', accountId: 'user-123', correlationId: 'order-2', timestamp: new Date('2025-01-02T00:00:00Z') },
+      { entryId: 'e-3', accountId: 'user-123', correlationId: 'order-1', timestamp: new Date('2025-01-03T00:00:00Z') },
+      { entryId: 'e-4', accountId: 'user-123', correlationId: '', timestamp: new Date('2025-01-04T00:00:00Z') },
+      { entryId: 'e-5', accountId: 'user-123', timestamp: new Date('2025-01-05T00:00:00Z') },
+      { entryId: 'e-7', accountId: 'user-123', correlationId: 'order-4', timestamp: new Date('2025-01-06T00:00:00Z') },
+      { entryId: 'e-6', accountId: 'user-123', correlationId: 'order-3', timestamp: new Date('2025-01-06T00:00:00Z') },
+      { entryId: 'e-8', accountId: 'user-999', correlationId: 'order-9', timestamp: new Date('2025-01-01T00:00:00Z') },
+      { entryId: 'e-0', accountId: 'user-merged', correlationId: 'order-0', timestamp: new Date('2024-12-31T00:00:00Z') },
+    ];
+
+    // Evaluate the match, first-seen grouping and final sort over the fixture
+    beforeEach(() => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+        const match = pipeline[0].$match;
+        const firstSeen = new Map<string, any>();
+        entries
+          .filter(
+            e =>
+              (match.accountId.$in ?? [match.accountId.$eq]).includes(e.accountId) &&
+              e.correlationId &&
+              !match.correlationId.$nin.includes(e.correlationId)
+          )
+          .sort((a, b) => a.timestamp.getTime() - b.timestamp.getTime() || a.entryId.localeCompare(b.entryId))
+          .forEach(e => {
+            if (!firstSeen.has(e.correlationId!)) {
+              firstSeen.set(e.correlationId!, { _id: e.correlationId, firstSeenAt: e.timestamp, firstEntryId: e.entryId });
+            }
+          });
+        const rows = [...firstSeen.values()].sort(
+          (a, b) => a.firstSeenAt.getTime() - b.firstSeenAt.getTime() || a.firstEntryId.localeCompare(b.firstEntryId)
+        );
+        return { exec: jest.fn().mockResolvedValue(rows) };
+      });
+    });
+
+    it('should list each reference once, in first-seen order', async () => {
+      await expect(service.referencesByUser('user-123')).resolves.toEqual(['order-1', 'order-2', 'order-3', 'order-4']);
+    });
+
+    it('should exclude empty references and only read the user\'s entries', async () => {
+      await service.referencesByUser('user-999');
+
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        accountId: { $eq: 'user-999' },
+        accountType: { $eq: 'user' },
+        correlationId: { $exists: true, $nin: [null, ''] },
+      });
+      await expect(service.referencesByUser('user-999')).resolves.toEqual(['order-9']);
+      await expect(service.referencesByUser('user-none')).resolves.toEqual([]);
+    });
+
+    it('should include the references of accounts merged into the user, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-123'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+
+      await expect(new LedgerService({}, resolver).referencesByUser('user-123', 'tenant-a')).resolves.toEqual([
+        'order-0',
+        'order-1',
+        'order-2',
+        'order-3',
+        'order-4',
+      ]);
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toMatchObject({
+        tenantId: { $eq: 'tenant-a' },
+        accountId: { $in: ['user-123', 'user-merged'] },
+      });
+    });
+  });
+
+  describe('groupByReference', () => {
+    const at = (day: number) => new Date(Date.UTC(2025, 0, day));
+    const stored = [
+      { entryId: 'e-4', accountId: 'user-123', correlationId: 'order-2', amount: 50, timestamp: at(4) },
+      { entryId: 'e-1', accountId: 'user-123', correlationId: 'order-1', amount: 100, timestamp: at(1) },
+      { entryId: 'e-2', accountId: 'user-123', amount: 25, timestamp: at(2) },
+      { entryId: 'e-5', accountId: 'user-123', correlationId: 'order-1', amount: -100, timestamp: at(5) },
+      { entryId: 'e-3', accountId: 'user-123', correlationId: 'order-1-retry', amount: 10, timestamp: at(3) },
+      { entryId: 'e-6', accountId: 'user-123', correlationId: '', amount: 5, timestamp: at(5) },
+      { entryId: 'e-0', accountId: 'user-merged', correlationId: 'order-1', amount: 40, timestamp: at(0) },
+    ];
+
+    // Evaluate the account match and the (timestamp, entryId) sort over the fixture
+    beforeEach(() => {
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => ({
+        sort: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn(async () =>
+          stored
+            .filter(e => (query.accountId.$in ?? [query.accountId.$eq]).includes(e.accountId))
+            .sort((a, b) => a.timestamp.getTime() - b.timestamp.getTime() || a.entryId.localeCompare(b.entryId))
+        ),
+      }));
+    });
+
+    const grouping = (groups: Map<string, LedgerEntry[]>) =>
+      [...groups].map(([reference, entries]) => [reference, entries.map(e => e.entryId)]);
+
+    it('should group entries under their reference, oldest first, in first-seen order', async () => {
+      const groups = await service.groupByReference('user-123');
+
+      expect(grouping(groups)).toEqual([
+        ['order-1', ['e-1', 'e-5']],
+        [UNREFERENCED_GROUP, ['e-2', 'e-6']],
+        ['order-1-retry', ['e-3']],
+        ['order-2', ['e-4']],
+      ]);
+      expect(groups.get('order-1')!.map(e => e.amount)).toEqual([100, -100]);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({ accountId: { $eq: 'user-123' }, accountType: { $eq: 'user' } });
+    });
+
+    it('should fold aliased references into their canonical reference', async () => {
+      const aliased = new LedgerService({}, undefined, {
+        referenceGroup: jest.fn(),
+        canonicalMap: jest.fn(async () => new Map([['order-1-retry', 'order-1']])),
+      });
+
+      const groups = await aliased.groupByReference('user-123');
+
+      expect(groups.get('order-1')!.map(e => e.entryId)).toEqual(['e-1', 'e-3', 'e-5']);
+      expect(groups.has('order-1-retry')).toBe(false);
+    });
+
+    it('should return no groups for a user without entries', async () => {
+      await expect(service.groupByReference('user-none')).resolves.toEqual(new Map());
+    });
+
+    it('should include the entries of accounts merged into the user, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-123'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+
+      const groups = await new LedgerService({}, resolver).groupByReference('user-123', 'tenant-a');
+
+      expect(groups.get('order-1')!.map(e => e.entryId)).toEqual(['e-0', 'e-1', 'e-5']);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({
+        tenantId: { $eq: 'tenant-a' },
+        accountId: { $in: ['user-123', 'user-merged'] },
+        accountType: { $eq: 'user' },
+      });
+    });
+  });
+
+  describe('balancesByCurrency', () => {
+    const at = (day: number) => new Date(Date.UTC(2025, 0, day));
+    let entries: any[];
+    let latencyMs: number;
+
+    // Evaluate the match and the latest-entry grouping over the fixture
+    beforeEach(() => {
+      latencyMs = 0;
+      entries = [
+        { entryId: 'e-1', accountId: 'user-1', currency: 'points', balanceState: 'available', balanceAfter: 100, timestamp: at(1) },
+        { entryId: 'e-2', accountId: 'user-1', currency: 'points', balanceState: 'available', balanceAfter: 60, timestamp: at(2) },
+        { entryId: 'e-3', accountId: 'user-1', currency: 'gems', balanceState: 'available', balanceAfter: 5, timestamp: at(1) },
+        { entryId: 'e-4', accountId: 'user-1', currency: 'gems', balanceState: 'escrow', balanceAfter: 3, timestamp: at(3) },
+        { entryId: 'e-5', accountId: 'user-2', currency: 'points', balanceState: 'available', balanceAfter: 40, timestamp: at(1) },
+        { entryId: 'e-6', accountId: 'user-3', currency: 'tokens', balanceState: 'available', balanceAfter: 7, timestamp: at(1) },
+      ];
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+        const match = pipeline[0].$match;
+        const latest = new Map<string, any>();
+        entries
+          .filter(e => match.accountId.$in.includes(e.accountId) && e.balanceState === match.balanceState.$eq)
+          .sort((a, b) => a.timestamp.getTime() - b.timestamp.getTime() || a.entryId.localeCompare(b.entryId))
+          .forEach(e => latest.set(`${e.accountId}/${e.currency}`, e));
+        const rows = [...latest.values()].map(e => ({
+          _id: { accountId: e.accountId, currency: e.currency },
+          balance: e.balanceAfter,
+        }));
+        return {
+          exec: jest.fn().mockImplementation(() => new Promise(resolve => setTimeout(() => resolve(rows), latencyMs))),
+        };
+      });
+    });
+
+    it('should return each user\'s latest available balance in every currency', async () => {
+      const balances = await service.balancesByCurrency(['user-1', 'user-2']);
+
+      expect(balances).toEqual(
+        new Map([
+          ['user-1', new Map([['points', 60], ['gems', 5]])],
+          ['user-2', new Map([['points', 40]])],
+        ])
+      );
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledTimes(1);
+    });
+
+    it('should omit users with no entries and read nothing for no users', async () => {
+      await expect(service.balancesByCurrency(['user-3', 'user-none'])).resolves.toEqual(
+        new Map([['user-3', new Map([['tokens', 7]])]])
+      );
+      await expect(service.balancesByCurrency([])).resolves.toEqual(new Map());
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledTimes(1);
+    });
+
+    it('should only read the given users\' available entries', async () => {
+      await service.balancesByCurrency(['user-2', 'user-1', 'user-2']);
+
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        accountId: { $in: ['user-2', 'user-1'] },
+        accountType: { $eq: 'user' },
+        balanceState: { $eq: 'available' },
+      });
+    });
+
+    it('should add the balances of accounts merged into a user, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn(async (accountId: string) => accountId),
+        aliasesOf: jest.fn(async (accountId: string) => (accountId === 'user-1' ? ['user-3', 'user-merged'] : [])),
+      };
+      entries.push({ entryId: 'e-7', accountId: 'user-merged', currency: 'points', balanceState: 'available', balanceAfter: 15, timestamp: at(4) });
+
+      const balances = await new LedgerService({}, resolver).balancesByCurrency(['user-1', 'user-2'], 'tenant-a');
+
+      expect(balances).toEqual(
+        new Map([
+          ['user-1', new Map([['points', 75], ['gems', 5], ['tokens', 7]])],
+          ['user-2', new Map([['points', 40]])],
+        ])
+      );
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        tenantId: { $eq: 'tenant-a' },
+        accountId: { $in: ['user-1', 'user-3', 'user-merged', 'user-2'] },
+        accountType: { $eq: 'user' },
+        balanceState: { $eq: 'available' },
+      });
+    });
+
+    describe('benchmark', () => {
+      // Simulates a fixed per-query round trip to the database
+      const LATENCY_MS = 5;
+      const USERS = 40;
+
+      it('should answer for every user in one round trip instead of one per user', async () => {
+        const userIds = Array.from({ length: USERS }, (_, u) => `user-${String(u).padStart(4, '0')}`);
+        entries = userIds.flatMap((accountId, u) =>
+          ['points', 'gems'].map((currency, c) => ({
+            entryId: `e-${u}-${c}`,
+            accountId,
+            currency,
+            balanceState: 'available',
+            balanceAfter: u * 10 + c,
+            timestamp: at(1),
+          }))
+        );
+        latencyMs = LATENCY_MS;
+
+        const time = async (read: () => Promise<Map<string, Map<string, number>>>) => {
+          const started = process.hrtime.bigint();
+          const balances = await read();
+          return { balances, ms: Number(process.hrtime.bigint() - started) / 1e6 };
+        };
+
+        const perUser = await time(async () => {
+          const balances = new Map<string, Map<string, number>>();
+          for (const userId of userIds) {
+            for (const [id, currencies] of await service.balancesByCurrency([userId])) {
+              balances.set(id, currencies);
+            }
+          }
+          return balances;
+        });
+        const bulk = await time(() => service.balancesByCurrency(userIds));
+
+        expect(bulk.balances).toEqual(perUser.balances);
+        expect(bulk.balances.get('user-0039')).toEqual(new Map([['points', 390], ['gems', 391]]));
+        // 40 round trips against 1; allow generous slack for timer jitter
+        expect(bulk.ms * 4).toBeLessThan(perUser.ms);
+      });
+    });
+  });
+
+  describe('amountStats', () => {
+    const aggregateRows = (rows: any[]) =>
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({ exec: jest.fn().mockResolvedValue(rows) });
+
+    it('should return the single entry as min, max, sum and mean', async () => {
+      aggregateRows([{ _id: null, count: 1, min: 40, max: 40, sum: 40, stdDev: 0 }]);
+
+      await expect(service.amountStats('user-123', TransactionType.DEBIT)).resolves.toEqual({
+        count: 1,
+        min: 40,
+        max: 40,
+        sum: 40,
+        mean: 40,
+        stdDev: 0,
+      });
+    });
+
+    it('should compute the mean over multiple entries', async () => {
+      aggregateRows([{ _id: null, count: 3, min: 10, max: 200, sum: 300, stdDev: 81.6 }]);
+
+      await expect(service.amountStats('user-123', TransactionType.CREDIT)).resolves.toEqual({
+        count: 3,
+        min: 10,
+        max: 200,
+        sum: 300,
+        mean: 100,
+        stdDev: 81.6,
+      });
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        accountId: { $eq: 'user-123' },
+        accountType: { $eq: 'user' },
+        type: { $eq: TransactionType.CREDIT },
+      });
+      expect(pipeline[1]).toEqual({ $project: { magnitude: { $abs: '$amount' } } });
+      expect(pipeline[2].$group.stdDev).toEqual({ $stdDevPop: '$magnitude' });
+    });
+
+    it('should return zeroed stats without error when there are no entries', async () => {
+      aggregateRows([]);
+
+      await expect(service.amountStats('user-123', TransactionType.DEBIT)).resolves.toEqual({
+        count: 0,
+        min: 0,
+        max: 0,
+        sum: 0,
+        mean: 0,
+        stdDev: 0,
+      });
+    });
+
+    it('should include the entries of accounts merged into the user, within the tenant', async () => {
+      const resolver = {
+        resolveAccountId: jest.fn().mockResolvedValue('user-123'),
+        aliasesOf: jest.fn().mockResolvedValue(['user-merged']),
+      };
+      aggregateRows([]);
+
+      await new LedgerService({}, resolver).amountStats('user-123', TransactionType.DEBIT, 'tenant-a');
+
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toEqual({
+        tenantId: { $eq: 'tenant-a' },
+        accountId: { $in: ['user-123', 'user-merged'] },
+        accountType: { $eq: 'user' },
+        type: { $eq: TransactionType.DEBIT },
+      });
+    });
+  });
+
+  describe('sumByReference', () => {
+    it('should group entry amounts by correlationId in one aggregation', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([
+          { _id: 'pay-1', total: -500, entryCount: 1 },
+          { _id: 'pay-2', total: 250, entryCount: 2 },
+        ]),
+      });
+
+      const sums = await service.sumByReference({ accountType: 'user' });
+
+      expect(sums).toEqual([
+        { reference: 'pay-1', total: -500, entryCount: 1 },
+        { reference: 'pay-2', total: 250, entryCount: 2 },
+      ]);
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match).toMatchObject({
+        correlationId: { $exists: true, $ne: null },
+        accountType: { $eq: 'user' },
+      });
+    });
+  });
+
+  describe('references', () => {
+    it('should return no references for an empty store', async () => {
+      (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({ exec: jest.fn().mockResolvedValue([]) });
+
+      await expect(service.references()).resolves.toEqual([]);
+    });
+
+    it('should return the distinct non-empty references in order', async () => {
+      (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue(['pay-2', 'Pay-3', 'pay-1']),
+      });
+
+      await expect(service.references('tenant-a')).resolves.toEqual(['Pay-3', 'pay-1', 'pay-2']);
+      expect(LedgerEntryModel.distinct).toHaveBeenCalledWith('correlationId', {
+        correlationId: { $exists: true, $nin: [null, ''] },
+        tenantId: { $eq: 'tenant-a' },
+      });
+    });
+  });
+
+  describe('iterateReferences', () => {
+    // Distinct references served a page at a time from the pipeline's $match and $limit
+    const serve = (references: string[]) => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+        const after = pipeline[0].$match.correlationId.$gt;
+        const page = references.filter(ref => after === undefined || ref > after).slice(0, pipeline[4].$limit);
+        return { exec: jest.fn().mockResolvedValue(page.map(ref => ({ _id: ref }))) };
+      });
+    };
+
+    it('should visit nothing in an empty store', async () => {
+      serve([]);
+      const fn = jest.fn();
+
+      await expect(service.iterateReferences(fn)).resolves.toBe(0);
+      expect(fn).not.toHaveBeenCalled();
+    });
+
+    it('should visit every reference in order across pages', async () => {
+      const references = Array.from({ length: 2500 }, (_, i) => `pay-${String(i).padStart(5, '0')}`);
+      serve(references);
+      const visited: string[] = [];
+
+      await expect(service.iterateReferences(ref => void visited.push(ref))).resolves.toBe(2500);
+      expect(visited).toEqual(references);
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledTimes(3);
+    });
+
+    it('should sort on the reference before grouping', async () => {
+      serve(['pay-1']);
+
+      await service.iterateReferences(jest.fn());
+
+      const pipeline = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0][0];
+      expect(pipeline.slice(1, 3)).toEqual([
+        { $sort: { correlationId: 1 } },
+        { $group: { _id: '$correlationId' } },
+      ]);
+    });
+
+    it('should stop at the first error the callback throws', async () => {
+      serve(['pay-1', 'pay-2', 'pay-3']);
+      const fn = jest.fn().mockImplementation(async (ref: string) => {
+        if (ref === 'pay-2') {
+          throw new Error('dashboard unavailable');
+        }
+      });
+
+      await expect(service.iterateReferences(fn)).rejects.toThrow('dashboard unavailable');
+      expect(fn).toHaveBeenCalledTimes(2);
+    });
+  });
+
+  describe('secondary indexes', () => {
+    let createIndex: jest.Mock;
+
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-index-1',
+      requestId: 'req-index-1',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      correlationId: 'pay-1',
+      metadata: { committedBy: 'svc-payments' },
+    };
+
+    beforeEach(() => {
+      createIndex = jest.fn().mockResolvedValue('ok');
+      (LedgerEntryModel as any).collection = { createIndex };
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([{ entryId: 'entry-1', ...request, timestamp: new Date() }]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(1);
+    });
+
+    it('should build no index on the append or query path', async () => {
+      await service.createEntry(request);
+      const result = await service.getByCommitter('svc-payments');
+      await service.getByReference('pay-1');
+
+      expect(result.entries.map(entry => entry.entryId)).toEqual(['entry-1']);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({ 'metadata.committedBy': { $eq: 'svc-payments' } });
+      expect(createIndex).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('streamByCommitter', () => {
+    const from = new Date('2024-03-01T00:00:00Z');
+    const to = new Date('2024-03-31T23:59:59Z');
+    let stored: any[];
+
+    const doc = (i: number, committedBy: string, timestamp: Date) => ({
+      entryId: `entry-${String(i).padStart(4, '0')}`,
+      accountId: `user-${i % 7}`,
+      amount: 10,
+      idempotencyKey: `idem-stream-${i}`,
+      timestamp,
+      metadata: { committedBy },
+    });
+
+    // Evaluates the committer, window and keyset conditions the stream sends
+    const matches = (d: any, query: any): boolean =>
+      d.metadata.committedBy === query['metadata.committedBy'].$eq &&
+      d.timestamp >= query.timestamp.$gte &&
+      d.timestamp <= query.timestamp.$lte &&
+      (!query.$or ||
+        d.timestamp > query.$or[0].timestamp.$gt ||
+        (d.timestamp.getTime() === query.$or[1].timestamp.$eq.getTime() && d.entryId > query.$or[1].entryId.$gt));
+
+    const stream = async (committedBy: string) => {
+      const output = new PassThrough();
+      const chunks: string[] = [];
+      output.on('data', chunk => chunks.push(chunk.toString()));
+      const count = await service.streamByCommitter(output, committedBy, from, to);
+      output.end();
+      return { count, lines: chunks.join('').split('\n').filter(Boolean).map(line => JSON.parse(line)) };
+    };
+
+    beforeEach(() => {
+      (LedgerEntryModel as any).collection = { createIndex: jest.fn().mockResolvedValue('ok') };
+      stored = [
+        doc(0, 'ops-alice', new Date('2024-02-29T23:59:59Z')),
+        doc(1, 'ops-alice', from),
+        doc(2, 'ops-bob', new Date('2024-03-10T00:00:00Z')),
+        doc(3, 'ops-alice', new Date('2024-03-10T00:00:00Z')),
+        doc(4, 'ops-alice', to),
+        doc(5, 'ops-alice', new Date('2024-04-01T00:00:00Z')),
+      ];
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => {
+        let limit = Infinity;
+        const cursor: any = {
+          sort: jest.fn().mockReturnThis(),
+          limit: jest.fn((n: number) => ((limit = n), cursor)),
+          lean: jest.fn().mockReturnThis(),
+          exec: jest.fn(async () =>
+            stored
+              .filter(d => matches(d, query))
+              .sort((a, b) => a.timestamp - b.timestamp || (a.entryId < b.entryId ? -1 : 1))
+              .slice(0, limit)
+          ),
+        };
+        return cursor;
+      });
+    });
+
+    it('should write the committer entries inside the window as JSON lines, oldest first', async () => {
+      const { count, lines } = await stream('ops-alice');
+
+      expect(count).toBe(3);
+      expect(lines.map(line => line.entryId)).toEqual(['entry-0001', 'entry-0003', 'entry-0004']);
+      expect(lines[0]).toMatchObject({ idempotencyKey: 'idem-stream-1', timestamp: from.toISOString() });
+    });
+
+    it('should write nothing for a committer with no entries in the window', async () => {
+      await expect(stream('ops-carol')).resolves.toEqual({ count: 0, lines: [] });
+    });
+
+    it('should page through many entries without repeating ties', async () => {
+      const tied = new Date('2024-03-15T00:00:00Z');
+      stored = Array.from({ length: 1201 }, (_, i) => doc(i, 'ops-alice', i % 2 ? tied : new Date(from.getTime() + i)));
+
+      const { count, lines } = await stream('ops-alice');
+
+      expect(count).toBe(1201);
+      expect(new Set(lines.map(line => line.entryId)).size).toBe(1201);
+      expect(LedgerEntryModel.find).toHaveBeenCalledTimes(3);
+    });
+
+    it('should reject a window that ends before it starts', async () => {
+      await expect(service.streamByCommitter(new PassThrough(), 'ops-alice', to, from)).rejects.toThrow(
+        InvalidTimeRangeError
+      );
+    });
+  });
+
+  describe('committerNetImpact', () => {
+    const from = new Date('2024-03-01T00:00:00Z');
+    const to = new Date('2024-03-31T23:59:59Z');
+    const stored = [
+      // Earns and adjustments by ops-alice inside the window
+      { committedBy: 'ops-alice', accountType: 'user', amount: 500, timestamp: new Date('2024-03-02T00:00:00Z') },
+      { committedBy: 'ops-alice', accountType: 'user', amount: 250, timestamp: new Date('2024-03-05T00:00:00Z') },
+      { committedBy: 'ops-alice', accountType: 'user', amount: -120, timestamp: new Date('2024-03-09T00:00:00Z') },
+      { committedBy: 'ops-alice', accountType: 'user', amount: -30, timestamp: to },
+      // Window start is exclusive
+      { committedBy: 'ops-alice', accountType: 'user', amount: 1000, timestamp: from },
+      { committedBy: 'ops-alice', accountType: 'user', amount: 1000, timestamp: new Date('2024-04-01T00:00:00Z') },
+      // System legs are not user balances
+      { committedBy: 'ops-alice', accountType: 'system', amount: -500, timestamp: new Date('2024-03-02T00:00:00Z') },
+      { committedBy: 'ops-bob', accountType: 'user', amount: 75, timestamp: new Date('2024-03-02T00:00:00Z') },
+    ];
+
+    // Evaluate the committer, window and account type match, then sum
+    beforeEach(() => {
+      (LedgerEntryModel as any).collection = { createIndex: jest.fn().mockResolvedValue('ok') };
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+        const match = pipeline[0].$match;
+        const matching = stored.filter(
+          e =>
+            e.committedBy === match['metadata.committedBy'].$eq &&
+            e.timestamp > match.timestamp.$gt &&
+            e.timestamp <= match.timestamp.$lte &&
+            e.accountType === match.accountType.$eq
+        );
+        const rows = matching.length
+          ? [{ _id: null, net: matching.reduce((sum, e) => sum + e.amount, 0), count: matching.length }]
+          : [];
+        return { exec: jest.fn().mockResolvedValue(rows) };
+      });
+    });
+
+    it('should net a committer\'s earns against their adjustments over (from, to]', async () => {
+      await expect(service.committerNetImpact('ops-alice', from, to)).resolves.toEqual({ net: 600, count: 4 });
+      await expect(service.committerNetImpact('ops-bob', from, to)).resolves.toEqual({ net: 75, count: 1 });
+    });
+
+    it('should report zero for a committer with no entries in the window', async () => {
+      await expect(service.committerNetImpact('ops-carol', from, to)).resolves.toEqual({ net: 0, count: 0 });
+    });
+
+    it('should reject a window that ends before it starts', async () => {
+      await expect(service.committerNetImpact('ops-alice', to, from)).rejects.toThrow(InvalidTimeRangeError);
+      expect(LedgerEntryModel.aggregate).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('reference aliases', () => {
+    // pay-1-dup and pay-1-retry were aliased to pay-1
+    const referenceResolver: IReferenceAliasResolver = {
+      referenceGroup: jest.fn(async (reference: string) =>
+        reference === 'pay-1' ? ['pay-1', 'pay-1-dup', 'pay-1-retry'] : [reference]
+      ),
+      canonicalMap: jest.fn(async () => new Map([['pay-1-dup', 'pay-1'], ['pay-1-retry', 'pay-1']])),
+    };
+
+    beforeEach(() => {
+      service = new LedgerService({}, undefined, referenceResolver);
+    });
+
+    it('should return entries stored under aliases of a canonical reference', async () => {
+      const stored = [
+        { entryId: 'entry-1', correlationId: 'pay-1', amount: -300, timestamp: new Date() },
+        { entryId: 'entry-2', correlationId: 'pay-1-dup', amount: -200, timestamp: new Date() },
+      ];
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(stored),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(2);
+
+      const result = await service.getByReference('pay-1');
+
+      expect(result.entries.map(entry => entry.entryId)).toEqual(['entry-1', 'entry-2']);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({
+        correlationId: { $in: ['pay-1', 'pay-1-dup', 'pay-1-retry'] },
+      });
+    });
+
+    it('should order entries with a shared timestamp by entry ID', async () => {
+      const sort = jest.fn().mockReturnThis();
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort,
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await service.getByReference('pay-1', { offset: 100, limit: 100 });
+
+      expect(sort).toHaveBeenCalledWith({ timestamp: 1, entryId: 1 });
+    });
+
+    it('should query only the given reference without a resolver', async () => {
+      service = new LedgerService();
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+
+      await service.getByReference('pay-1');
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({ correlationId: { $in: ['pay-1'] } });
+    });
+
+    it('should sum across each alias group', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([
+          { _id: 'pay-0', total: 50, entryCount: 1 },
+          { _id: 'pay-1', total: -300, entryCount: 1 },
+          { _id: 'pay-1-dup', total: -200, entryCount: 2 },
+          { _id: 'pay-1-retry', total: 100, entryCount: 1 },
+          { _id: 'pay-2', total: 250, entryCount: 2 },
+        ]),
+      });
+
+      const sums = await service.sumByReference();
+
+      expect(sums).toEqual([
+        { reference: 'pay-0', total: 50, entryCount: 1 },
+        { reference: 'pay-1', total: -400, entryCount: 4 },
+        { reference: 'pay-2', total: 250, entryCount: 2 },
+      ]);
+    });
+  });
+
+  describe('isFullyReversed', () => {
+    const mockSums = (transactionIds: string[], rows: any[]) => {
+      (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue(transactionIds),
+      });
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue(rows),
+      });
+    };
+
+    it('should report a fully reversed reference', async () => {
+      mockSums(['txn-1', 'txn-2'], [
+        { _id: 'original', total: -500, entryCount: 2 },
+        { _id: 'reversal', total: 500, entryCount: 2 },
+      ]);
+
+      const status = await service.isFullyReversed('order-1');
+
+      expect(status).toEqual({
+        reference: 'order-1',
+        fullyReversed: true,
+        residual: 0,
+        originalTotal: -500,
+        reversalTotal: 500,
+        reversalCount: 2,
+      });
+      expect(LedgerEntryModel.distinct).toHaveBeenCalledWith('transactionId', { correlationId: { $eq: 'order-1' } });
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match.$or).toEqual([
+        { correlationId: { $eq: 'order-1' } },
+        { 'metadata.correctionOf': { $in: ['txn-1', 'txn-2'] } },
+        { 'metadata.recreditOf': { $in: ['txn-1', 'txn-2'] } },
+        { 'metadata.originalTransactionId': { $in: ['txn-1', 'txn-2'] } },
+      ]);
+      expect(pipeline[1].$group._id.$cond[0].$or).toContainEqual({ $in: ['$metadata.recreditOf', ['txn-1', 'txn-2']] });
+    });
+
+    it('should report the full amount for an unreversed reference', async () => {
+      mockSums(['txn-2'], [{ _id: 'original', total: -300, entryCount: 1 }]);
+
+      const status = await service.isFullyReversed('order-2');
+
+      expect(status).toMatchObject({ fullyReversed: false, residual: -300, reversalCount: 0 });
+    });
+
+    it('should report the residual of a partially reversed reference', async () => {
+      mockSums(['txn-3'], [
+        { _id: 'original', total: -300, entryCount: 1 },
+        { _id: 'reversal', total: 120, entryCount: 1 },
+      ]);
+
+      const status = await service.isFullyReversed('order-3');
+
+      expect(status).toMatchObject({ fullyReversed: false, residual: -180, reversalTotal: 120 });
+    });
+
+    it('should not report an unknown reference as reversed', async () => {
+      mockSums([], []);
+
+      const status = await service.isFullyReversed('order-4');
+
+      expect(status).toMatchObject({ fullyReversed: false, residual: 0 });
+      expect(LedgerEntryModel.aggregate).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('findOrphanedReversals', () => {
+    const entries = [
+      { entryId: 'e-1', transactionId: 'txn-earn', amount: 100, timestamp: new Date('2025-01-01T00:00:00Z') },
+      {
+        entryId: 'e-2',
+        transactionId: 'correction-txn-earn',
+        amount: -100,
+        timestamp: new Date('2025-01-02T00:00:00Z'),
+        metadata: { correctionOf: 'txn-earn' },
+      },
+      {
+        entryId: 'e-3',
+        transactionId: 'correction-txn-gone',
+        amount: -50,
+        timestamp: new Date('2025-01-03T00:00:00Z'),
+        metadata: { correctionOf: 'txn-gone' },
+      },
+      {
+        entryId: 'e-4',
+        transactionId: 'txn-clawback',
+        amount: -20,
+        timestamp: new Date('2025-01-04T00:00:00Z'),
+        metadata: { originalTransactionId: 'txn-typo' },
+      },
+    ];
+
+    const mockStore = (stored: any[]) => {
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => {
+        const fields = query.$or.map((clause: any) => Object.keys(clause)[0].replace('metadata.', ''));
+        const docs = stored.filter(e => fields.some((field: string) => e.metadata?.[field] !== undefined));
+        return { sort: () => ({ lean: () => ({ exec: jest.fn().mockResolvedValue(docs) }) }) };
+      });
+      (LedgerEntryModel.distinct as jest.Mock).mockImplementation((_field: string, query: any) => ({
+        exec: jest.fn().mockResolvedValue(
+          [...new Set(stored.map(e => e.transactionId))].filter(id => query.transactionId.$in.includes(id))
+        ),
+      }));
+    };
+
+    it('should report reversals whose original transaction is missing', async () => {
+      mockStore(entries);
 
-      const mockEntries = [
+      const orphans = await service.findOrphanedReversals();
+
+      expect(orphans.map(e => e.entryId)).toEqual(['e-3', 'e-4']);
+      const [, query] = (LedgerEntryModel.distinct as jest.Mock).mock.calls[0];
+      expect(query.transactionId.$in).toEqual(['txn-earn', 'txn-gone', 'txn-typo']);
+    });
+
+    it('should report nothing when every reversal links to a stored transaction', async () => {
+      mockStore(entries.slice(0, 2));
+
+      await expect(service.findOrphanedReversals()).resolves.toEqual([]);
+    });
+
+    it('should not look up originals when there are no reversals', async () => {
+      mockStore(entries.slice(0, 1));
+
+      await expect(service.findOrphanedReversals()).resolves.toEqual([]);
+      expect(LedgerEntryModel.distinct).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('findLogicalDuplicates', () => {
+    const stored = (entryId: string, day: number, fields: Record<string, any> = {}) => ({
+      entryId,
+      transactionId: `txn-${entryId}`,
+      accountId: 'user-1',
+      accountType: 'user',
+      amount: 100,
+      type: 'credit',
+      currency: 'points',
+      correlationId: 'order-1',
+      timestamp: new Date(Date.UTC(2025, 0, day)),
+      ...fields,
+    });
+
+    // Groups on the pipeline's composite key the way $group would, returning sets in reverse
+    const mockStore = (docs: any[]) => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+        const key = pipeline.find(stage => stage.$group).$group._id;
+        const sorted = [...docs].sort((a, b) => a.timestamp - b.timestamp || (a.entryId < b.entryId ? -1 : 1));
+        const sets = new Map<string, any[]>();
+        for (const doc of sorted.filter(d => d.correlationId)) {
+          const id = JSON.stringify(Object.values(key).map((path: any) => doc[path.slice(1)]));
+          sets.set(id, [...(sets.get(id) || []), doc]);
+        }
+        const rows = [...sets.values()].map(entries => ({ entryIds: entries.map(e => e.entryId), count: entries.length }));
+        return {
+          allowDiskUse: jest.fn().mockReturnThis(),
+          exec: jest.fn().mockResolvedValue(rows.filter(row => row.count >= 2).reverse()),
+        };
+      });
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => ({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(docs.filter(doc => query.entryId.$in.includes(doc.entryId))),
+      }));
+    };
+
+    it('should find nothing when every event is distinct', async () => {
+      mockStore([
+        stored('e-1', 1),
+        stored('e-2', 2, { amount: 200 }),
+        stored('e-3', 3, { accountId: 'user-2' }),
+        stored('e-4', 4, { type: 'debit', amount: -100 }),
+        stored('e-5', 5, { correlationId: 'order-2' }),
+        stored('e-6', 6, { correlationId: undefined }),
+        stored('e-7', 7, { correlationId: undefined }),
+      ]);
+
+      await expect(service.findLogicalDuplicates()).resolves.toEqual([]);
+    });
+
+    it('should group a duplicate pair regardless of IDs', async () => {
+      mockStore([stored('e-1', 1), stored('e-2', 2, { amount: 200 }), stored('e-3', 3)]);
+
+      const groups = await service.findLogicalDuplicates();
+
+      expect(groups.map(group => group.map(e => e.entryId))).toEqual([['e-1', 'e-3']]);
+      expect(groups[0].map(e => e.transactionId)).toEqual(['txn-e-1', 'txn-e-3']);
+    });
+
+    it('should order a triple by timestamp and the sets by their first entry', async () => {
+      mockStore([
+        stored('e-4', 4, { correlationId: 'order-2' }),
+        stored('e-2', 2),
+        stored('e-5', 5, { correlationId: 'order-2' }),
+        stored('e-1', 1),
+        stored('e-3', 3),
+      ]);
+
+      const groups = await service.findLogicalDuplicates();
+
+      expect(groups.map(group => group.map(e => e.entryId))).toEqual([
+        ['e-1', 'e-2', 'e-3'],
+        ['e-4', 'e-5'],
+      ]);
+      expect((LedgerEntryModel.aggregate as jest.Mock).mock.calls[0][0][0]).toEqual({
+        $match: { accountType: { $eq: 'user' }, correlationId: { $exists: true, $nin: [null, ''] } },
+      });
+    });
+
+    it('should group entry IDs on disk and fetch only the duplicate sets', async () => {
+      mockStore([stored('e-1', 1), stored('e-2', 2, { amount: 200 }), stored('e-3', 3)]);
+
+      await service.findLogicalDuplicates();
+
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline.find((stage: any) => stage.$group).$group.entryIds).toEqual({ $push: '$entryId' });
+      expect((LedgerEntryModel.aggregate as jest.Mock).mock.results[0].value.allowDiskUse).toHaveBeenCalledWith(true);
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({ entryId: { $in: ['e-1', 'e-3'] } });
+    });
+  });
+
+  describe('missingReferenceNumbers', () => {
+    const mockReferences = (references: string[]) => {
+      (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue(references),
+      });
+    };
+
+    it('should report no gaps for a contiguous sequence', async () => {
+      mockReferences(['order-1', 'order-2', 'order-3', 'order-4']);
+
+      const gaps = await service.missingReferenceNumbers('user-123', 'order-', 4);
+
+      expect(gaps).toEqual({ userId: 'user-123', prefix: 'order-', expectedMax: 4, missing: [], malformed: 0 });
+      const [field, query] = (LedgerEntryModel.distinct as jest.Mock).mock.calls[0];
+      expect(field).toBe('correlationId');
+      expect(query.accountId).toEqual({ $eq: 'user-123' });
+      expect(query.correlationId).toEqual({ $regex: '^order-' });
+    });
+
+    it('should list the numbers missing from a gapped sequence', async () => {
+      mockReferences(['order-1', 'order-3', 'order-6', 'order-9']);
+
+      const gaps = await service.missingReferenceNumbers('user-123', 'order-', 7);
+
+      expect(gaps.missing).toEqual([2, 4, 5, 7]);
+    });
+
+    it('should ignore malformed references and count them', async () => {
+      mockReferences(['order-1', 'order-02', 'order-x', 'order-', 'order-2b', 'order-3']);
+
+      const gaps = await service.missingReferenceNumbers('user-123', 'order-', 3);
+
+      expect(gaps).toMatchObject({ missing: [2], malformed: 4 });
+    });
+
+    it('should escape regular expression characters in the prefix', async () => {
+      mockReferences([]);
+
+      await service.missingReferenceNumbers('user-123', 'ord.(1)-', 1);
+
+      const [, query] = (LedgerEntryModel.distinct as jest.Mock).mock.calls[0];
+      expect(query.correlationId).toEqual({ $regex: '^ord\\.\\(1\\)-' });
+    });
+
+    it('should reject an invalid expected maximum', async () => {
+      await expect(service.missingReferenceNumbers('user-123', 'order-', -1)).rejects.toThrow('expectedMax');
+    });
+  });
+
+  describe('tracing', () => {
+    // Fake tracer recording each span and how it ended
+    const spans: { name: string; attributes: Record<string, unknown>; ended: boolean; error?: unknown }[] = [];
+    const tracer: LedgerTracer = {
+      startSpan: (name, attributes) => {
+        const span: (typeof spans)[number] = { name, attributes, ended: false };
+        spans.push(span);
+        return error => {
+          span.ended = true;
+          span.error = error;
+        };
+      },
+    };
+
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-trace',
+      requestId: 'req-trace',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      correlationId: 'order-trace',
+    };
+
+    beforeEach(() => {
+      spans.length = 0;
+      service = new LedgerService({ tracer });
+    });
+
+    it('should record a span around an append', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      await service.createEntry(request);
+
+      expect(spans).toEqual([
         {
-          entryId: 'entry-1',
-          transactionId: 'txn-1',
-          accountId: 'user-123',
-          accountType: 'user',
-          amount: 100,
-          type: 'credit',
-          balanceState: 'available',
-          stateTransition: 'credit→available',
-          reason: 'user_signup_bonus',
-          idempotencyKey: 'idem-1',
-          requestId: 'req-1',
-          balanceBefore: 0,
-          balanceAfter: 100,
-          timestamp: new Date(),
-          currency: 'points',
+          name: 'ledger.append',
+          attributes: {
+            method: 'append',
+            accountId: 'user-123',
+            reference: 'order-trace',
+            idempotencyKey: 'idem-trace',
+          },
+          ended: true,
+          error: undefined,
         },
-      ];
+      ]);
+    });
+
+    it('should end the span with the error when an append fails', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(new Error('connection reset'));
+
+      await expect(service.createEntry(request)).rejects.toThrow(LedgerAppendError);
 
+      expect(spans).toHaveLength(1);
+      expect(spans[0].ended).toBe(true);
+      expect(spans[0].error).toBeInstanceOf(LedgerAppendError);
+    });
+
+    it('should record query spans with the account and reference', async () => {
       (LedgerEntryModel.find as jest.Mock).mockReturnValue({
         sort: jest.fn().mockReturnThis(),
         skip: jest.fn().mockReturnThis(),
         limit: jest.fn().mockReturnThis(),
         lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue(mockEntries),
+        exec: jest.fn().mockResolvedValue([]),
+      });
+      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+      (LedgerEntryModel.distinct as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([]),
       });
 
-      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(1);
+      await service.queryEntries({ accountId: 'user-123' });
+      await service.isFullyReversed('order-trace');
 
-      const result = await service.queryEntries(filter);
+      expect(spans.map(span => [span.name, span.attributes, span.ended])).toEqual([
+        ['ledger.queryEntries', { method: 'queryEntries', accountId: 'user-123' }, true],
+        ['ledger.isFullyReversed', { method: 'isFullyReversed', reference: 'order-trace' }, true],
+      ]);
+    });
 
-      expect(result.entries).toHaveLength(1);
-      expect(result.totalCount).toBe(1);
-      expect(result.hasMore).toBe(false);
-      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
+    it('should include the tenant on spans of a scoped service', async () => {
+      service = new LedgerService({ tracer, tenantId: 'brand-a' });
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(null),
+      });
+
+      await service.getEntry('entry-1');
+
+      expect(spans[0].attributes).toEqual({ method: 'getEntry', entryId: 'entry-1', tenantId: 'brand-a' });
+    });
+  });
+
+  describe('getIndexStats', () => {
+    // Known appends: 5 entries over 2 accounts, 3 sharing 2 correlation IDs
+    const appends = [
+      { entryId: 'e1', idempotencyKey: 'k1', accountId: 'user-1', correlationId: 'c1' },
+      { entryId: 'e2', idempotencyKey: 'k2', accountId: 'model-1', correlationId: 'c1' },
+      { entryId: 'e3', idempotencyKey: 'k3', accountId: 'user-1', correlationId: 'c2' },
+      { entryId: 'e4', idempotencyKey: 'k4', accountId: 'user-1' },
+      { entryId: 'e5', idempotencyKey: 'k5', accountId: 'model-1' },
+    ];
+
+    const facetOf = (entries: Record<string, any>[]) => {
+      const group = (field: string) => {
+        const withField = entries.filter(e => e[field] !== undefined);
+        const distinct = new Set(withField.map(e => e[field]));
+        return withField.length ? [{ _id: null, count: distinct.size, entries: withField.length }] : [];
+      };
+      return {
+        total: entries.length ? [{ n: entries.length }] : [],
+        entryIds: group('entryId'),
+        idempotencyKeys: group('idempotencyKey'),
+        accounts: group('accountId'),
+        correlations: group('correlationId'),
+      };
+    };
+
+    const mockFacet = (entries: Record<string, any>[]) => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([facetOf(entries)]),
+      });
+    };
+
+    it('should report counts matching a known set of appends', async () => {
+      mockFacet(appends);
+
+      const stats = await service.getIndexStats();
+
+      expect(stats.totalEntries).toBe(5);
+      expect(stats.distinctEntryIds).toBe(5);
+      expect(stats.distinctIdempotencyKeys).toBe(5);
+      expect(stats.accounts).toEqual({ count: 2, entries: 5 });
+      expect(stats.correlations).toEqual({ count: 2, entries: 3 });
+    });
+
+    it('should report zeros for an empty ledger', async () => {
+      mockFacet([]);
+
+      const stats = await service.getIndexStats();
+
+      expect(stats.totalEntries).toBe(0);
+      expect(stats.accounts).toEqual({ count: 0, entries: 0 });
+    });
+
+    it('should report healthy when every index agrees', async () => {
+      mockFacet(appends);
+
+      const health = await service.healthCheck();
+
+      expect(health.status).toBe('healthy');
+      expect(health.metrics?.totalEntries).toBe(5);
+    });
+
+    it('should report unhealthy on duplicate entry IDs', async () => {
+      mockFacet([...appends, { ...appends[0], idempotencyKey: 'k6' }]);
+
+      const health = await service.healthCheck();
+
+      expect(health.status).toBe('unhealthy');
+      expect(health.message).toContain('duplicate entry IDs');
+    });
+
+    it('should report unhealthy when the query fails', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockRejectedValue(new Error('connection refused')),
+      });
+
+      const health = await service.healthCheck();
+
+      expect(health.status).toBe('unhealthy');
+      expect(health.message).toBe('connection refused');
+    });
+  });
+
+  describe('getCheckpoint', () => {
+    it('should return high-water mark and count from a single aggregation', async () => {
+      const highWaterMark = new Date('2024-01-05');
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([{ _id: null, count: 42, highWaterMark }]),
+      });
+
+      const checkpoint = await service.getCheckpoint();
+
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledTimes(1);
+      expect(checkpoint.highWaterMark).toEqual(highWaterMark);
+      expect(checkpoint.count).toBe(42);
+    });
+
+    it('should return an empty checkpoint for an empty ledger', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([]),
+      });
+
+      const checkpoint = await service.getCheckpoint();
+
+      expect(checkpoint.highWaterMark).toBeNull();
+      expect(checkpoint.count).toBe(0);
+    });
+
+    it('should stay consistent while entries are appended', async () => {
+      const stored: { timestamp: Date }[] = [];
+      (LedgerEntryModel.aggregate as jest.Mock).mockImplementation(() => ({
+        exec: jest.fn().mockImplementation(async () => {
+          const seen = [...stored];
+          if (seen.length === 0) return [];
+          const high = seen.reduce((max, e) => (e.timestamp > max ? e.timestamp : max), seen[0].timestamp);
+          return [{ _id: null, count: seen.length, highWaterMark: high }];
+        }),
+      }));
+
+      const appends = Array.from({ length: 20 }, (_, i) =>
+        Promise.resolve().then(() => {
+          stored.push({ timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, i)) });
+        })
+      );
+      const checkpoints = Array.from({ length: 20 }, () => service.getCheckpoint());
+
+      await Promise.all(appends);
+      for (const checkpoint of await Promise.all(checkpoints)) {
+        const atOrBelow = stored.filter(
+          e => checkpoint.highWaterMark && e.timestamp <= checkpoint.highWaterMark
+        ).length;
+        expect(checkpoint.count).toBe(atOrBelow);
+      }
+    });
+  });
+
+  describe('checkIdempotency', () => {
+    it('should return true if idempotency key exists', async () => {
+      (IdempotencyRecordModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue({ pointsIdempotencyKey: 'test-key' }),
+      });
+
+      const result = await service.checkIdempotency('test-key', 'credit');
+
+      expect(result).toBe(true);
+      expect(IdempotencyRecordModel.findOne).toHaveBeenCalledWith({
+        pointsIdempotencyKey: { $eq: 'test-key' },
+        eventScope: { $eq: 'credit' },
+      });
+    });
+
+    it('should return false if idempotency key does not exist', async () => {
+      (IdempotencyRecordModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(null),
+      });
+
+      const result = await service.checkIdempotency('new-key', 'debit');
+
+      expect(result).toBe(false);
+    });
+  });
+
+  describe('storeIdempotencyResult', () => {
+    it('should store idempotency result with TTL', async () => {
+      (IdempotencyRecordModel.create as jest.Mock).mockResolvedValue({});
+
+      const result = { success: true };
+      await service.storeIdempotencyResult('key-123', 'credit', result, 200, 86400);
+
+      expect(IdempotencyRecordModel.create).toHaveBeenCalledWith(
         expect.objectContaining({
-          accountId: { $eq: 'user-123' },
-          accountType: { $eq: 'user' },
-          type: { $eq: 'credit' },
+          pointsIdempotencyKey: 'key-123',
+          eventScope: 'credit',
+          storedResult: result,
         })
       );
     });
+  });
+
+  describe('read tokens', () => {
+    // Documents in the fake collection; a snapshot session reads the
+    // documents that existed when it was started, as MongoDB does
+    let stored: any[];
+
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 50,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-read-2',
+      requestId: 'req-read-2',
+      balanceBefore: 100,
+      balanceAfter: 150,
+    };
+
+    const matches = (doc: any, query: any) =>
+      (!query.accountId || doc.accountId === query.accountId.$eq) &&
+      (!query.entryId || doc.entryId === query.entryId.$eq) &&
+      (!query.timestamp?.$lte || doc.timestamp <= query.timestamp.$lte);
+
+    const queryOver = (query: any, single: boolean) => {
+      let documents = () => stored;
+      const chain: any = {
+        session: jest.fn((session: any) => {
+          documents = () => session.documents;
+          return chain;
+        }),
+        sort: jest.fn().mockReturnThis(),
+        skip: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn(async () => {
+          const found = documents().filter(doc => matches(doc, query));
+          return single ? found[0] || null : found;
+        }),
+      };
+      return chain;
+    };
+
+    beforeEach(() => {
+      stored = [
+        {
+          ...request,
+          entryId: 'entry-1',
+          transactionId: 'txn-1',
+          amount: 100,
+          idempotencyKey: 'idem-read-1',
+          balanceBefore: 0,
+          balanceAfter: 100,
+          timestamp: new Date(Date.now() - 1000),
+        },
+      ];
+      (LedgerEntryModel.startSession as jest.Mock).mockImplementation(async () => ({
+        documents: [...stored],
+        endSession: jest.fn(),
+      }));
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+        stored.push(doc);
+        return doc;
+      });
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => queryOver(query, false));
+      (LedgerEntryModel.findOne as jest.Mock).mockImplementation((query: any) => queryOver(query, true));
+      (LedgerEntryModel.countDocuments as jest.Mock).mockImplementation((query: any) => {
+        const count = (documents: any[]) => documents.filter(doc => matches(doc, query)).length;
+        return {
+          session: (session: any) => Promise.resolve(count(session.documents)),
+          then: (resolve: any, reject: any) => Promise.resolve(count(stored)).then(resolve, reject),
+        };
+      });
+    });
+
+    afterEach(() => {
+      jest.useRealTimers();
+      (LedgerEntryModel.startSession as jest.Mock).mockReset();
+      (LedgerEntryModel.create as jest.Mock).mockReset();
+      (LedgerEntryModel.find as jest.Mock).mockReset();
+      (LedgerEntryModel.findOne as jest.Mock).mockReset();
+      (LedgerEntryModel.countDocuments as jest.Mock).mockReset();
+    });
+
+    it('should not let a concurrent append leak into an open view', async () => {
+      const token = await service.beginRead();
+      const appended = await service.createEntry(request);
+
+      const inView = await service.queryEntriesAt(token, { accountId: 'user-123' });
+      const balance = await service.getBalanceSnapshotAt(token, 'user-123', 'user');
+      const entry = await service.getEntryAt(token, appended.entryId);
+      const current = await service.queryEntries({ accountId: 'user-123' });
+
+      expect(inView.entries.map(e => e.entryId)).toEqual(['entry-1']);
+      expect(inView.totalCount).toBe(1);
+      expect(balance).toMatchObject({ availableBalance: 100, asOf: token.asOf });
+      expect(entry).toBeNull();
+      expect(current.entries).toHaveLength(2);
+    });
+
+    it('should limit view queries to entries up to the view time', async () => {
+      const token = await service.beginRead();
+
+      await service.queryEntriesAt(token, { accountId: 'user-123', endDate: new Date(Date.now() + 60_000) });
+
+      const [query] = (LedgerEntryModel.find as jest.Mock).mock.calls[0];
+      expect(query.timestamp.$lte).toEqual(token.asOf);
+    });
+
+    it('should end the snapshot session on release', async () => {
+      const token = await service.beginRead();
+      const session = await (LedgerEntryModel.startSession as jest.Mock).mock.results[0].value;
+
+      await service.releaseRead(token);
+      await service.releaseRead(token);
+
+      expect(LedgerEntryModel.startSession).toHaveBeenCalledWith({ snapshot: true });
+      expect(session.endSession).toHaveBeenCalledTimes(1);
+      await expect(service.queryEntriesAt(token, {})).rejects.toThrow(ReadTokenExpiredError);
+    });
+
+    it('should release a view when its lifetime ends', async () => {
+      jest.useFakeTimers();
+      const token = await service.beginRead(5000);
+      const session = await (LedgerEntryModel.startSession as jest.Mock).mock.results[0].value;
+
+      jest.advanceTimersByTime(5000);
+
+      expect(session.endSession).toHaveBeenCalled();
+      await expect(service.getBalanceSnapshotAt(token, 'user-123', 'user')).rejects.toThrow(
+        ReadTokenExpiredError
+      );
+    });
+
+    it('should reject lifetimes outside the configured bound', async () => {
+      const bounded = new LedgerService({ maxReadTokenLifetimeMs: 10_000 });
+
+      await expect(bounded.beginRead(0)).rejects.toThrow('Read token lifetime must be between');
+      await expect(bounded.beginRead(10_001)).rejects.toThrow('Read token lifetime must be between');
+      expect(LedgerEntryModel.startSession).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('digest', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-digest',
+      requestId: 'req-digest',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
+
+    it('should fold each inserted entry into the digest', async () => {
+      const digest = { fold: jest.fn().mockResolvedValue(undefined) };
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const entry = await new LedgerService({ digest }).createEntry(request);
+
+      expect(digest.fold).toHaveBeenCalledWith(entry);
+    });
+
+    it('should not fold an idempotent replay', async () => {
+      const digest = { fold: jest.fn().mockResolvedValue(undefined) };
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { idempotencyKey: 1 };
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicateError);
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnValue({ exec: jest.fn().mockResolvedValue({ ...request, entryId: 'entry-existing' }) }),
+      });
+
+      const result = await new LedgerService({ digest }).createEntryWithResult(request);
+
+      expect(result.inserted).toBe(false);
+      expect(digest.fold).not.toHaveBeenCalled();
+    });
+
+    it('should keep the append when the fold fails', async () => {
+      const digest = { fold: jest.fn().mockRejectedValue(new Error('digest unavailable')) };
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+
+      const result = await new LedgerService({ digest }).createEntryWithResult(request);
+
+      expect(result.inserted).toBe(true);
+    });
+  });
 
-    it('should filter by date range', async () => {
-      const startDate = new Date('2024-01-01');
-      const endDate = new Date('2024-12-31');
+  describe('userIdTokenizer', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'alice@example.com',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-token',
+      requestId: 'req-token',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
 
-      const filter: LedgerQueryFilter = {
-        accountId: 'user-456',
-        startDate,
-        endDate,
-        limit: 10,
-        offset: 0,
-      };
+    // Deterministic pseudonym that maps a token to itself
+    const userIdTokenizer = (userId: string) =>
+      userId.startsWith('tok-') ? userId : `tok-${Buffer.from(userId).toString('hex').slice(0, 16)}`;
 
-      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+    it('should store the token and find the entry by the raw ID', async () => {
+      const stored: any[] = [];
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+        stored.push(doc);
+        return doc;
+      });
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => ({
         sort: jest.fn().mockReturnThis(),
         skip: jest.fn().mockReturnThis(),
         limit: jest.fn().mockReturnThis(),
         lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue([]),
-      });
-
-      (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+        exec: jest.fn().mockResolvedValue(stored.filter(doc => doc.accountId === query.accountId.$eq)),
+      }));
+      (LedgerEntryModel.countDocuments as jest.Mock).mockImplementation(async (query: any) =>
+        stored.filter(doc => doc.accountId === query.accountId.$eq).length
+      );
+      const tokenizing = new LedgerService({ userIdTokenizer });
 
-      await service.queryEntries(filter);
+      const entry = await tokenizing.createEntry(request);
+      const byRawId = await tokenizing.queryEntries({ accountId: 'alice@example.com', accountType: 'user' });
+      const byToken = await tokenizing.queryEntries({ accountId: entry.accountId });
 
-      expect(LedgerEntryModel.find).toHaveBeenCalledWith(
-        expect.objectContaining({
-          timestamp: { $gte: startDate, $lte: endDate },
-        })
-      );
+      expect(entry.accountId).toBe(userIdTokenizer('alice@example.com'));
+      expect(stored.map(doc => doc.accountId)).not.toContain('alice@example.com');
+      expect(byRawId.entries.map(e => e.entryId)).toEqual([entry.entryId]);
+      expect(byToken.entries.map(e => e.entryId)).toEqual([entry.entryId]);
     });
 
-    it('should enforce maximum limit of 1000', async () => {
-      const filter: LedgerQueryFilter = {
-        limit: 5000,
-        offset: 0,
-      };
+    it('should reject an append the tokenizer refuses, with its error as the cause', async () => {
+      const refusal = new Error('looks like an email');
+      const strict = new LedgerService({
+        userIdTokenizer: (userId: string) => {
+          if (userId.includes('@')) {
+            throw refusal;
+          }
+          return userId;
+        },
+      });
+
+      const error = await strict.createEntry(request).catch(e => e);
+
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(findErrorCause(error, UserIdRejectedError)!.cause).toBe(refusal);
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
 
+    it('should leave a query without an account type untokenized', async () => {
       (LedgerEntryModel.find as jest.Mock).mockReturnValue({
         sort: jest.fn().mockReturnThis(),
         skip: jest.fn().mockReturnThis(),
@@ -249,155 +3907,575 @@ describe('LedgerService', () => {
         lean: jest.fn().mockReturnThis(),
         exec: jest.fn().mockResolvedValue([]),
       });
-
       (LedgerEntryModel.countDocuments as jest.Mock).mockResolvedValue(0);
+      const tokenizer = jest.fn(userIdTokenizer);
 
-      const result = await service.queryEntries(filter);
+      await new LedgerService({ userIdTokenizer: tokenizer }).queryEntries({ accountId: 'model-7' });
 
-      expect(result.limit).toBe(1000);
+      expect(tokenizer).not.toHaveBeenCalled();
+      expect((LedgerEntryModel.find as jest.Mock).mock.calls[0][0].accountId).toEqual({ $eq: 'model-7' });
+    });
+
+    it('should leave non-user account IDs as given', async () => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+      const tokenizer = jest.fn(userIdTokenizer);
+
+      const entry = await new LedgerService({ userIdTokenizer: tokenizer }).createEntry({
+        ...request,
+        accountId: 'model-7',
+        accountType: 'model',
+      });
+
+      expect(entry.accountId).toBe('model-7');
+      expect(tokenizer).not.toHaveBeenCalled();
     });
   });
 
-  describe('getEntry', () => {
-    it('should retrieve a specific entry by ID', async () => {
-      const mockEntry = {
-        entryId: 'entry-specific',
-        transactionId: 'txn-specific',
-        accountId: 'user-123',
-        accountType: 'user',
-        amount: 100,
-        type: 'credit',
-        balanceState: 'available',
-        stateTransition: 'credit→available',
-        reason: 'user_signup_bonus',
-        idempotencyKey: 'idem-specific',
-        requestId: 'req-specific',
-        balanceBefore: 0,
-        balanceAfter: 100,
-        timestamp: new Date(),
-        currency: 'points',
-      };
+  describe('idempotency key validation', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: '01ARZ3NDEKTSV4RRFFQ69G5FAV',
+      requestId: 'req-ulid',
+      balanceBefore: 0,
+      balanceAfter: 100,
+    };
 
-      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
-        lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue(mockEntry),
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
+
+    it('should append a key the validator accepts', async () => {
+      const strict = new LedgerService({ idempotencyKeyValidator: ulidValidator });
+
+      await expect(strict.createEntry(request)).resolves.toMatchObject({ idempotencyKey: request.idempotencyKey });
+    });
+
+    it('should reject a key the validator refuses before the idempotency check', async () => {
+      const strict = new LedgerService({ idempotencyKeyValidator: uuidV4Validator });
+
+      const error = await strict.createEntry(request).catch(e => e);
+
+      expect(error).toBeInstanceOf(LedgerAppendError);
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(findErrorCause(error, IdempotencyKeyRejectedError)!.message).toContain('Expected a UUIDv4');
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+      expect(LedgerEntryModel.findOne).not.toHaveBeenCalled();
+    });
+
+    it('should accept any key without a validator', async () => {
+      await expect(service.createEntry({ ...request, idempotencyKey: 'legacy key #1' })).resolves.toBeDefined();
+    });
+  });
+
+  describe('anomaly detection', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 5000,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'idem-anomaly',
+      requestId: 'req-anomaly',
+      balanceBefore: 0,
+      balanceAfter: 5000,
+    };
+    let onAnomaly: jest.Mock;
+    let detecting: LedgerService;
+
+    beforeEach(() => {
+      jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+      // The account's earlier credits average 100 with a standard deviation of 10
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([{ _id: null, count: 10, min: 85, max: 115, sum: 1000, stdDev: 10 }]),
       });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+      onAnomaly = jest.fn();
+      detecting = new LedgerService({ anomalyDetector: new StdDevAnomalyDetector({ maxDeviations: 3, onAnomaly }) });
+    });
 
-      const result = await service.getEntry('entry-specific');
+    afterEach(() => {
+      jest.restoreAllMocks();
+    });
 
-      expect(result).not.toBeNull();
-      expect(result?.entryId).toBe('entry-specific');
-      expect(LedgerEntryModel.findOne).toHaveBeenCalledWith({
-        entryId: { $eq: 'entry-specific' },
+    const flushCallbacks = () => new Promise(resolve => setImmediate(resolve));
+
+    it('should commit an outlier and hand it to the callback with the prior stats', async () => {
+      const result = await detecting.createEntryWithResult(request);
+      await flushCallbacks();
+
+      expect(result.inserted).toBe(true);
+      expect(onAnomaly).toHaveBeenCalledWith(
+        expect.objectContaining({ idempotencyKey: 'idem-anomaly', amount: 5000 }),
+        expect.objectContaining({ count: 10, mean: 100, stdDev: 10 })
+      );
+      expect(MetricsLogger.incrementCounter).toHaveBeenCalledWith(
+        MetricEventType.LEDGER_AMOUNT_ANOMALY,
+        expect.objectContaining({ type: TransactionType.CREDIT })
+      );
+      const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+      expect(pipeline[0].$match.type).toEqual({ $eq: TransactionType.CREDIT });
+    });
+
+    it('should not flag an amount in line with the history', async () => {
+      await detecting.createEntry({ ...request, amount: 110, balanceAfter: 110 });
+      await flushCallbacks();
+
+      expect(onAnomaly).not.toHaveBeenCalled();
+    });
+
+    it('should not wait on or fail because of the callback', async () => {
+      onAnomaly.mockReturnValueOnce(new Promise(() => undefined));
+      await expect(detecting.createEntry(request)).resolves.toBeDefined();
+
+      onAnomaly.mockRejectedValueOnce(new Error('review queue down'));
+      await expect(detecting.createEntry({ ...request, idempotencyKey: 'idem-anomaly-2' })).resolves.toBeDefined();
+      await flushCallbacks();
+
+      expect(MetricsLogger.incrementCounter).toHaveBeenCalledWith(
+        MetricEventType.LEDGER_ANOMALY_CALLBACK_FAILED,
+        expect.objectContaining({ error: 'review queue down' })
+      );
+    });
+
+    it('should not consult the detector for non-user accounts or replays', async () => {
+      await detecting.createEntry({ ...request, accountId: 'model-7', accountType: 'model' });
+
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      duplicateError.keyPattern = { idempotencyKey: 1 };
+      (LedgerEntryModel.create as jest.Mock).mockRejectedValue(duplicateError);
+      (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue({ ...request, entryId: 'entry-original', timestamp: new Date() }),
       });
+      await detecting.createEntry(request);
+      await flushCallbacks();
+
+      expect(onAnomaly).not.toHaveBeenCalled();
     });
+  });
 
-    it('should return null if entry not found', async () => {
+  describe('opStats', () => {
+    const request: CreateLedgerEntryRequest = {
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: '01ARZ3NDEKTSV4RRFFQ69G5FAV',
+      requestId: 'req-stats',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      metadata: { committedBy: 'svc:rewards' },
+    };
+
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
       (LedgerEntryModel.findOne as jest.Mock).mockReturnValue({
         lean: jest.fn().mockReturnThis(),
         exec: jest.fn().mockResolvedValue(null),
       });
+      (LedgerEntryModel.exists as jest.Mock).mockReturnValue({ exec: jest.fn().mockResolvedValue(null) });
+    });
 
-      const result = await service.getEntry('nonexistent');
+    it('should count appends by outcome and each query method', async () => {
+      const counted = new LedgerService({ allowedCommitters: ['svc:rewards'], idempotencyKeyValidator: ulidValidator });
 
-      expect(result).toBeNull();
+      await counted.createEntry(request);
+      await counted.createEntry({ ...request, idempotencyKey: '01ARZ3NDEKTSV4RRFFQ69G5FAW' });
+      await counted.createEntry({ ...request, idempotencyKey: 'not-a-ulid' }).catch(() => undefined);
+      await counted.createEntry({ ...request, metadata: { committedBy: 'svc:unknown' } }).catch(() => undefined);
+      await counted.createEntry({ ...request, metadata: {} }).catch(() => undefined);
+      await counted.getEntry('entry-1');
+      await counted.getEntry('entry-2');
+      await counted.entryExists('entry-1');
+
+      expect(counted.opStats()).toEqual({
+        appendsSucceeded: 2,
+        appendsFailed: { [AppendErrorCode.INVALID]: 1, [AppendErrorCode.UNAUTHORIZED]: 2 },
+        queries: { getEntry: 2, entryExists: 1 },
+      });
+    });
+
+    it('should keep counts per instance and return a copy', async () => {
+      const stats = service.opStats();
+      await service.getEntry('entry-1');
+
+      expect(stats.queries).toEqual({});
+      expect(service.opStats().queries).toEqual({ getEntry: 1 });
+      expect(new LedgerService().opStats().queries).toEqual({});
+    });
+
+    it('should clear every count through the test helper', async () => {
+      await service.createEntry(request);
+      await service.getEntry('entry-1');
+
+      resetOpStats(service);
+
+      expect(service.opStats()).toEqual({ appendsSucceeded: 0, appendsFailed: {}, queries: {} });
     });
   });
 
-  describe('getBalanceSnapshot', () => {
-    it('should calculate balance snapshot for user', async () => {
-      const mockEntries = [
-        {
-          balanceState: 'available',
-          balanceAfter: 500,
-          timestamp: new Date('2024-01-01'),
-        },
-        {
-          balanceState: 'escrow',
-          balanceAfter: 100,
-          timestamp: new Date('2024-01-02'),
-        },
+  describe('multi-leg groups', () => {
+    const leg = (accountId: string, amount: number, key: string): CreateLedgerEntryRequest => ({
+      accountId,
+      accountType: 'user',
+      amount,
+      type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: amount >= 0 ? 'none→available' : 'available→none',
+      reason: TransactionReason.ADMIN_CREDIT,
+      idempotencyKey: key,
+      requestId: 'req-transfer',
+      balanceBefore: 500,
+      balanceAfter: 500 + amount,
+    });
+
+    beforeEach(() => {
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
+
+    it('should append a two-leg transfer under one assigned group ID', async () => {
+      const entries = await service.appendGroup([leg('user-1', -200, 'transfer-out'), leg('user-2', 200, 'transfer-in')]);
+
+      expect(entries.map(e => [e.accountId, e.amount])).toEqual([['user-1', -200], ['user-2', 200]]);
+      expect(entries[0].groupId).toMatch(/^group-[0-9a-f]{32}$/);
+      expect(entries[1].groupId).toBe(entries[0].groupId);
+      expect((LedgerEntryModel.create as jest.Mock).mock.calls.map(([doc]) => doc.groupId)).toEqual([
+        entries[0].groupId,
+        entries[0].groupId,
+      ]);
+    });
+
+    it('should derive the same group ID when an interrupted group is appended again', async () => {
+      const legs = [leg('user-1', -200, 'transfer-out'), leg('user-2', 200, 'transfer-in')];
+      (LedgerEntryModel.create as jest.Mock)
+        .mockImplementationOnce(async (doc: any) => doc)
+        .mockRejectedValueOnce(new Error('connection reset'));
+
+      await expect(service.appendGroup(legs)).rejects.toThrow();
+      const first = (LedgerEntryModel.create as jest.Mock).mock.calls[0][0].groupId;
+      const retried = await service.appendGroup(legs);
+
+      expect(retried.map(e => e.groupId)).toEqual([first, first]);
+      const scoped = await service.appendGroup(legs.map(l => ({ ...l, idempotencyScope: 'merchant-1' })));
+      expect(scoped[0].groupId).not.toBe(first);
+    });
+
+    it('should give every leg the group ID a leg already carries', async () => {
+      const entries = await service.appendGroup([
+        leg('user-1', -200, 'split-1'),
+        { ...leg('user-2', 100, 'split-2'), groupId: 'grp-split' },
+        leg('user-3', 100, 'split-3'),
+      ]);
+
+      expect(entries.map(e => e.groupId)).toEqual(['grp-split', 'grp-split', 'grp-split']);
+    });
+
+    it('should reject conflicting group IDs, a single leg or an invalid leg before writing', async () => {
+      await expect(
+        service.appendGroup([{ ...leg('user-1', -200, 'a'), groupId: 'grp-1' }, { ...leg('user-2', 200, 'b'), groupId: 'grp-2' }])
+      ).rejects.toThrow(InvalidLedgerGroupError);
+      await expect(service.appendGroup([leg('user-1', -200, 'a')])).rejects.toThrow(InvalidLedgerGroupError);
+      await expect(service.appendGroup([leg('user-1', -200, 'a'), { ...leg('user-2', 200, 'b'), amount: 0 }])).rejects.toThrow(
+        expect.objectContaining({ appendCode: AppendErrorCode.INVALID })
+      );
+
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should keep concurrent groups contiguous in (timestamp, entryId) order', async () => {
+      const written: any[] = [];
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+        await new Promise(resolve => setImmediate(resolve));
+        written.push(doc);
+        return doc;
+      });
+      const legs = (prefix: string) => [
+        leg('user-1', -300, `${prefix}-out`),
+        leg('user-2', 100, `${prefix}-in-1`),
+        leg('user-3', 200, `${prefix}-in-2`),
       ];
 
-      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
+      const [first, second] = await Promise.all([service.appendGroup(legs('a')), service.appendGroup(legs('b'))]);
+
+      // The appends interleave, so only the stamped order keeps each group together
+      expect(written.map(doc => doc.groupId)).not.toEqual([...first, ...second].map(e => e.groupId));
+      const ordered = [...written].sort(
+        (x, y) => x.timestamp.getTime() - y.timestamp.getTime() || (x.entryId < y.entryId ? -1 : 1)
+      );
+      const runs = ordered.map(doc => doc.groupId).filter((groupId, i, all) => groupId !== all[i - 1]);
+      expect(runs).toHaveLength(2);
+      expect(first.map(e => e.timestamp)).toEqual(Array(3).fill(first[0].timestamp));
+      expect(ordered.filter(doc => doc.groupId === first[0].groupId).map(doc => doc.idempotencyKey)).toEqual([
+        'a-out',
+        'a-in-1',
+        'a-in-2',
+      ]);
+    });
+
+    it('should return every leg of a group oldest first', async () => {
+      const docs = [
+        { ...leg('user-1', -200, 'transfer-out'), entryId: 'entry-1', transactionId: 'txn-1', groupId: 'grp-1', timestamp: new Date('2025-01-01T00:00:00Z'), currency: 'points' },
+        { ...leg('user-2', 200, 'transfer-in'), entryId: 'entry-2', transactionId: 'txn-2', groupId: 'grp-1', timestamp: new Date('2025-01-01T00:00:00Z'), currency: 'points' },
+      ];
+      const chain = {
         sort: jest.fn().mockReturnThis(),
         lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue(mockEntries),
+        exec: jest.fn().mockResolvedValue(docs),
+      };
+      (LedgerEntryModel.find as jest.Mock).mockReturnValue(chain);
+
+      const entries = await service.getByGroup('grp-1');
+
+      expect(LedgerEntryModel.find).toHaveBeenCalledWith({ groupId: { $eq: 'grp-1' } });
+      expect(chain.sort).toHaveBeenCalledWith({ timestamp: 1, entryId: 1 });
+      expect(entries.map(e => [e.entryId, e.groupId])).toEqual([['entry-1', 'grp-1'], ['entry-2', 'grp-1']]);
+    });
+
+    describe('with requireGroupId', () => {
+      let grouped: LedgerService;
+
+      beforeEach(() => {
+        grouped = new LedgerService({ requireGroupId: true });
       });
 
-      const result = await service.getBalanceSnapshot('user-123', 'user');
+      it('should append entries that belong to a group', async () => {
+        await expect(grouped.createEntry({ ...leg('user-1', 200, 'solo'), groupId: 'grp-solo' })).resolves.toMatchObject({
+          groupId: 'grp-solo',
+        });
+        await expect(
+          grouped.appendGroup([leg('user-1', -200, 'transfer-out'), leg('user-2', 200, 'transfer-in')])
+        ).resolves.toHaveLength(2);
+      });
 
-      expect(result.accountId).toBe('user-123');
-      expect(result.accountType).toBe('user');
-      expect(result.availableBalance).toBe(500);
-      expect(result.escrowBalance).toBe(100);
+      it('should reject an ungrouped entry', async () => {
+        const error = await grouped.createEntry(leg('user-1', 200, 'solo')).catch(e => e);
+
+        expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+        expect(findErrorCause(error, MissingGroupIdError)).toBeDefined();
+        expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+      });
+
+      it('should accept ungrouped entries when off', async () => {
+        await expect(service.createEntry(leg('user-1', 200, 'solo'))).resolves.toBeDefined();
+      });
     });
+  });
 
-    it('should calculate balance snapshot for model', async () => {
-      const mockEntries = [
-        {
-          balanceState: 'earned',
-          balanceAfter: 1000,
-          timestamp: new Date('2024-01-01'),
-        },
-      ];
+  describe('with requireAdjustComment', () => {
+    let strict: LedgerService;
 
-      (LedgerEntryModel.find as jest.Mock).mockReturnValue({
-        sort: jest.fn().mockReturnThis(),
-        lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue(mockEntries),
+    const entry = (reason: TransactionReason, amount: number, comment?: string): CreateLedgerEntryRequest => ({
+      accountId: 'user-123',
+      accountType: 'user',
+      amount,
+      type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: amount > 0 ? 'none→available' : 'available→none',
+      reason,
+      idempotencyKey: `idem-${reason}`,
+      requestId: `req-${reason}`,
+      balanceBefore: 500,
+      balanceAfter: 500 + amount,
+      metadata: comment === undefined ? undefined : { comment },
+    });
+
+    beforeEach(() => {
+      strict = new LedgerService({ requireAdjustComment: true });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
+
+    it('should append an adjustment with a comment', async () => {
+      await expect(strict.createEntry(entry(TransactionReason.ADMIN_CREDIT, 50, 'Goodwill for outage'))).resolves.toMatchObject({
+        metadata: { comment: 'Goodwill for outage' },
       });
+    });
 
-      const result = await service.getBalanceSnapshot('model-456', 'model');
+    it.each([undefined, '', '   '])('should reject an adjustment with comment %p', async comment => {
+      const error = await strict.createEntry(entry(TransactionReason.ADMIN_DEBIT, -50, comment)).catch(e => e);
 
-      expect(result.accountId).toBe('model-456');
-      expect(result.accountType).toBe('model');
-      expect(result.earnedBalance).toBe(1000);
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(findErrorCause(error, MissingAdjustReasonError)).toBeDefined();
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should leave comments optional on earns and redemptions', async () => {
+      await expect(strict.createEntry(entry(TransactionReason.PROMOTIONAL_AWARD, 100))).resolves.toBeDefined();
+      await expect(strict.createEntry(entry(TransactionReason.CHIP_MENU_PURCHASE, -100))).resolves.toBeDefined();
+    });
+
+    it('should accept adjustments without a comment when off', async () => {
+      await expect(service.createEntry(entry(TransactionReason.ADMIN_CREDIT, 50))).resolves.toBeDefined();
     });
   });
 
-  describe('checkIdempotency', () => {
-    it('should return true if idempotency key exists', async () => {
-      (IdempotencyRecordModel.findOne as jest.Mock).mockReturnValue({
-        lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue({ pointsIdempotencyKey: 'test-key' }),
+  describe('with referencePatterns', () => {
+    let strict: LedgerService;
+
+    const entry = (amount: number, correlationId?: string): CreateLedgerEntryRequest => ({
+      accountId: 'user-123',
+      accountType: 'user',
+      amount,
+      type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: amount > 0 ? 'none→available' : 'available→none',
+      reason: amount > 0 ? TransactionReason.PURCHASE_EARN : TransactionReason.REWARD_DROP_REDEMPTION,
+      idempotencyKey: `idem-${amount}-${correlationId}`,
+      requestId: 'req-ref',
+      balanceBefore: 500,
+      balanceAfter: 500 + amount,
+      correlationId,
+    });
+
+    beforeEach(() => {
+      strict = new LedgerService({
+        referencePatterns: {
+          [TransactionType.CREDIT]: /^ORD-\d{6}$/,
+          [TransactionType.DEBIT]: /^VCH-[A-Z0-9]{8}$/g,
+        },
       });
+      (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => doc);
+    });
 
-      const result = await service.checkIdempotency('test-key', 'credit');
+    it('should append references matching their type\'s pattern', async () => {
+      await expect(strict.createEntry(entry(100, 'ORD-123456'))).resolves.toMatchObject({ correlationId: 'ORD-123456' });
+      // Repeated to show a global pattern is not stateful
+      await expect(strict.createEntry(entry(-100, 'VCH-AB12CD34'))).resolves.toBeDefined();
+      await expect(strict.createEntry(entry(-50, 'VCH-AB12CD34'))).resolves.toBeDefined();
+    });
 
-      expect(result).toBe(true);
-      expect(IdempotencyRecordModel.findOne).toHaveBeenCalledWith({
-        pointsIdempotencyKey: { $eq: 'test-key' },
-        eventScope: { $eq: 'credit' },
+    it.each<[string, number, string]>([
+      ['an earn', 100, 'VCH-AB12CD34'],
+      ['a redemption', -100, 'ORD-123456'],
+      ['a truncated earn', 100, 'ORD-123'],
+    ])('should reject a malformed reference on %s', async (_, amount, reference) => {
+      const error = await strict.createEntry(entry(amount, reference)).catch(e => e);
+
+      expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+      expect(findErrorCause(error, ReferenceFormatError)?.details).toEqual({
+        reference,
+        type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
       });
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
     });
 
-    it('should return false if idempotency key does not exist', async () => {
-      (IdempotencyRecordModel.findOne as jest.Mock).mockReturnValue({
-        lean: jest.fn().mockReturnThis(),
-        exec: jest.fn().mockResolvedValue(null),
+    it('should leave entries without a reference alone', async () => {
+      await expect(strict.createEntry(entry(100))).resolves.toBeDefined();
+    });
+  });
+
+  describe('validateAll', () => {
+    let strict: LedgerService;
+
+    const stored = (entryId: string, overrides: Record<string, any> = {}) => ({
+      entryId,
+      transactionId: `txn-${entryId}`,
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PURCHASE_EARN,
+      idempotencyKey: `idem-${entryId}`,
+      requestId: `req-${entryId}`,
+      balanceBefore: 0,
+      balanceAfter: 100,
+      timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, Number(entryId.split('-')[1]))),
+      currency: 'points',
+      correlationId: 'ORD-123456',
+      ...overrides,
+    });
+
+    // Serves the stored docs a page at a time, resuming after the keyset condition
+    const mockStore = (docs: any[]) => {
+      (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => {
+        const after = query.$or?.[1];
+        let limit = Infinity;
+        const chain: any = {
+          sort: jest.fn().mockReturnThis(),
+          limit: jest.fn().mockImplementation((n: number) => {
+            limit = n;
+            return chain;
+          }),
+          lean: jest.fn().mockReturnThis(),
+          exec: jest.fn().mockImplementation(async () =>
+            docs
+              .filter(doc => !after || doc.timestamp > after.timestamp.$eq ||
+                (doc.timestamp.getTime() === after.timestamp.$eq.getTime() && doc.entryId > after.entryId.$gt))
+              .slice(0, limit)
+          ),
+        };
+        return chain;
       });
+    };
 
-      const result = await service.checkIdempotency('new-key', 'debit');
+    beforeEach(() => {
+      strict = new LedgerService({
+        requireAdjustComment: true,
+        referencePatterns: { [TransactionType.CREDIT]: /^ORD-\d{6}$/ },
+      });
+    });
 
-      expect(result).toBe(false);
+    it('should report every rule each violating entry breaks', async () => {
+      mockStore([
+        stored('e-1'),
+        stored('e-2', { amount: -100, balanceAfter: -100 }),
+        stored('e-3', { correlationId: 'VCH-1' }),
+        stored('e-4', { reason: TransactionReason.ADMIN_CREDIT, correlationId: 'ORD-1' }),
+        stored('e-5', { reason: TransactionReason.ADMIN_CREDIT, metadata: { comment: 'goodwill' } }),
+      ]);
+
+      const issues = await strict.validateAll();
+
+      expect(issues.map(issue => [issue.entryId, issue.transactionId, issue.rule])).toEqual([
+        ['e-2', 'txn-e-2', 'INVALID_ENTRY_FIELDS'],
+        ['e-3', 'txn-e-3', 'REFERENCE_FORMAT'],
+        ['e-4', 'txn-e-4', 'MISSING_ADJUST_REASON'],
+        ['e-4', 'txn-e-4', 'REFERENCE_FORMAT'],
+      ]);
+      expect(issues[0].message).toBe('Amount sign does not match transaction type credit');
+      expect(LedgerEntryModel.create).not.toHaveBeenCalled();
     });
-  });
 
-  describe('storeIdempotencyResult', () => {
-    it('should store idempotency result with TTL', async () => {
-      (IdempotencyRecordModel.create as jest.Mock).mockResolvedValue({});
+    it('should read every page of the store', async () => {
+      const docs = Array.from({ length: 2500 }, (_, i) => stored(`e-${i}`, { correlationId: i % 1000 === 0 ? 'bad' : 'ORD-123456' }));
+      mockStore(docs);
 
-      const result = { success: true };
-      await service.storeIdempotencyResult('key-123', 'credit', result, 200, 86400);
+      const issues = await strict.validateAll();
 
-      expect(IdempotencyRecordModel.create).toHaveBeenCalledWith(
-        expect.objectContaining({
-          pointsIdempotencyKey: 'key-123',
-          eventScope: 'credit',
-          storedResult: result,
-        })
-      );
+      expect(issues.map(issue => issue.entryId)).toEqual(['e-0', 'e-1000', 'e-2000']);
+      expect(LedgerEntryModel.find).toHaveBeenCalledTimes(3);
+    });
+
+    it('should find nothing in a store of valid entries', async () => {
+      mockStore([stored('e-1'), stored('e-2')]);
+
+      await expect(strict.validateAll()).resolves.toEqual([]);
+    });
+
+    it('should judge a derived leg by the base key it carries', async () => {
+      const ulid = '01ARZ3NDEKTSV4RRFFQ69G5FAV';
+      mockStore([
+        stored('e-1', { idempotencyKey: ulid }),
+        stored('e-2', { idempotencyKey: `${ulid}_system` }),
+        stored('e-3', { idempotencyKey: 'idem-e-3_system' }),
+      ]);
+
+      const issues = await new LedgerService({ idempotencyKeyValidator: ulidValidator }).validateAll();
+
+      expect(issues.map(issue => [issue.entryId, issue.rule])).toEqual([['e-3', 'IDEMPOTENCY_KEY_REJECTED']]);
     });
   });
 });
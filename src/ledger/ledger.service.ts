@@ -6,6 +6,10 @@
  */
 
 import { v4 as uuidv4 } from 'uuid';
+import { ClientSession } from 'mongoose';
+import { Writable } from 'stream';
+import { once } from 'events';
+import { createHash } from 'crypto';
 import {
   ILedgerService,
   LedgerEntry,
@@ -16,95 +20,1840 @@ import {
   ReconciliationReport,
   AuditTrailEntry,
   LedgerConfig,
+  IAccountAliasResolver,
+  IReferenceAliasResolver,
+  VerifiedLedgerQueryResult,
+  LedgerCheckpoint,
+  ReferenceSumFilter,
+  ReferenceSum,
+  ReferenceReversalStatus,
+  ReferenceSequenceGaps,
+  ThresholdCrossing,
+  CreateLedgerEntryResult,
+  LedgerIndexReport,
+  RecordEntryFields,
+  InferredEntryFields,
+  ReadToken,
+  AmountStats,
+  CommitterImpact,
+  LedgerAccountType,
+  OpCounters,
+  PeakBalance,
+  NeighborEntries,
+  GlobalSummary,
+  LedgerValidationIssue,
+  LedgerOutbox,
+  OutboxCursor,
+  OutboxEntry,
 } from './types';
+import { signEntry, verifyEntrySignature } from './entry-signing';
+import { validateEntryFields } from './entry-validation';
+import { opCountersOf } from './op-counters';
+import { MetricsLogger, MetricEventType } from '../metrics';
+import {
+  CrossTenantError,
+  TagNotIndexedError,
+  IdempotencyConflictError,
+  InvalidTimeRangeError,
+  TimestampRegressionError,
+  UnauthorizedCommitterError,
+  LedgerAppendError,
+  AppendErrorCode,
+  ReadTokenExpiredError,
+  UserIdRejectedError,
+  IdempotencyKeyRejectedError,
+  OptimisticLockError,
+  ReplayContentConflictError,
+  InvalidLedgerGroupError,
+  MissingGroupIdError,
+  MissingAdjustReasonError,
+  ReferenceFormatError,
+  LedgerInconsistencyError,
+  EntryNotFoundError,
+  WalletServiceError,
+  ServiceHealth,
+} from '../services/types';
+import { TransactionType, TransactionReason, REDEMPTION_REASONS } from '../wallets/types';
 import { LedgerEntryModel, ILedgerEntry } from '../db/models/ledger-entry.model';
 import { IdempotencyRecordModel } from '../db/models/idempotency.model';
+import { canonicalJson } from '../tiering/tiering';
+
+/**
+ * Tenant IDs are short slugs: letters, digits, underscore and hyphen
+ */
+const TENANT_ID_PATTERN = /^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$/;
+
+/**
+ * Validate a tenant identifier
+ * @throws Error if the tenant ID is malformed
+ */
+export function validateTenantId(tenantId: string): void {
+  if (!TENANT_ID_PATTERN.test(tenantId)) {
+    throw new Error(`Invalid tenant ID: ${tenantId}`);
+  }
+}
+
+/**
+ * Region names are short lowercase slugs: letters, digits and hyphen
+ */
+export const REGION_PATTERN = /^[a-z0-9][a-z0-9-]{0,31}$/;
+
+/**
+ * Group key under which groupByReference collects entries without a
+ * reference; never a stored reference, as an empty correlation ID is
+ * treated as none
+ */
+export const UNREFERENCED_GROUP = '';
+
+// Traced methods that write; every other traced method counts as a query in opStats()
+const WRITE_METHODS = new Set(['append', 'importEntry', 'markPublished', 'backfillStreamVersions']);
+
+/**
+ * Default configuration for ledger service
+ */
+const DEFAULT_CONFIG: LedgerConfig = {
+  enableAuditLogging: true,
+  retentionDays: 2555, // 7 years minimum for financial records
+  defaultCurrency: 'points',
+  enableReconciliation: true,
+  reconciliationFrequencyHours: 24,
+  alertOnReconciliationFailure: true,
+  verifyOnRead: false,
+  indexedTagKeys: [],
+  enforceMonotonicTimestamps: false,
+  maxReadTokenLifetimeMs: 60_000,
+  trackStreamVersions: false,
+  rejectConflictingReplays: false,
+  requireGroupId: false,
+  requireAdjustComment: false,
+};
+
+/**
+ * Metadata fields linking a reversing entry to the transaction it undoes:
+ * corrections, redemption re-credits and clawbacks
+ */
+const REVERSAL_LINK_FIELDS = ['correctionOf', 'recreditOf', 'originalTransactionId'] as const;
+
+/**
+ * Fields that make up a transaction's content, compared on replay when
+ * rejectConflictingReplays is set; per-attempt fields (request ID,
+ * balances read at call time) are left out so genuine retries still match
+ */
+const REPLAY_CONTENT_FIELDS = [
+  'accountId',
+  'accountType',
+  'amount',
+  'type',
+  'balanceState',
+  'stateTransition',
+  'reason',
+  'currency',
+  'correlationId',
+  'groupId',
+  'escrowId',
+  'queueItemId',
+  'featureType',
+] as const;
+
+/**
+ * Credit reasons globalStats counts as earned
+ */
+const EARN_REASONS: string[] = [
+  TransactionReason.USER_SIGNUP_BONUS,
+  TransactionReason.REFERRAL_BONUS,
+  TransactionReason.PROMOTIONAL_AWARD,
+  TransactionReason.PURCHASE_EARN,
+];
+
+/**
+ * Reasons of manual adjustments, which must carry a comment when
+ * requireAdjustComment is set
+ */
+const ADJUST_REASONS: string[] = [
+  TransactionReason.ADMIN_CREDIT,
+  TransactionReason.ADMIN_DEBIT,
+  TransactionReason.ADMIN_REFUND,
+];
+
+/**
+ * Attempts at a stream version before an append gives up on contention
+ */
+const STREAM_VERSION_ATTEMPTS = 5;
+
+/**
+ * Entries read per page by streamByCommitter
+ */
+const COMMITTER_STREAM_PAGE_SIZE = 500;
+
+/**
+ * Entries read per page by validateAll
+ */
+const VALIDATE_ALL_PAGE_SIZE = 1000;
+
+/**
+ * User entries read per page by backfillStreamVersions
+ */
+const BACKFILL_PAGE_SIZE = 1000;
+
+/**
+ * References read per page by iterateReferences
+ */
+const REFERENCE_PAGE_SIZE = 1000;
+
+/**
+ * Duplicate entries fetched per query by findLogicalDuplicates
+ */
+const DUPLICATE_FETCH_PAGE_SIZE = 1000;
+
+/**
+ * Transaction a reversing entry links to
+ */
+function linkedTransactionId(entry: LedgerEntry): string {
+  const field = REVERSAL_LINK_FIELDS.find(name => entry.metadata?.[name] !== undefined)!;
+  return String(entry.metadata![field]);
+}
+
+/**
+ * Whether an entry's metadata.comment holds more than whitespace
+ */
+function hasComment(request: CreateLedgerEntryRequest): boolean {
+  const comment = request.metadata?.comment;
+  return typeof comment === 'string' && comment.trim() !== '';
+}
+
+/**
+ * Group ID derived from the legs' scoped idempotency keys
+ * Appending the same legs again, in any order, yields the same ID, so a
+ * retried group keeps the ID of the attempt it completes.
+ */
+function derivedGroupId(legs: CreateLedgerEntryRequest[]): string {
+  const keys = legs.map(leg => `${leg.idempotencyScope ?? ''}\u0000${leg.idempotencyKey}`).sort();
+  return `group-${createHash('sha256').update(keys.join('\u0001')).digest('hex').slice(0, 32)}`;
+}
+
+/**
+ * Entry IDs for count entries appended together: a shared prefix and each
+ * position, padded to one width so the IDs sort in position order
+ */
+export function runEntryIds(prefix: string, count: number): string[] {
+  const width = String(Math.max(count - 1, 0)).length;
+  return Array.from({ length: count }, (_, index) => `${prefix}-${String(index).padStart(width, '0')}`);
+}
+
+/**
+ * Reject a replay whose transaction differs from the entry holding its key
+ * The replay is compared as it would have been stored (tokenized account,
+ * default currency), with metadata as submitted, in canonical form.
+ *
+ * @throws ReplayContentConflictError naming the fields that differ
+ */
+function assertSameContent(request: CreateLedgerEntryRequest, doc: Partial<ILedgerEntry>, stored: LedgerEntry): void {
+  const differing: string[] = REPLAY_CONTENT_FIELDS.filter(
+    field => canonicalJson(doc[field]) !== canonicalJson(stored[field])
+  );
+  if (canonicalJson(request.metadata ?? {}) !== canonicalJson(stored.metadata ?? {})) {
+    differing.push('metadata');
+  }
+  if (request.transactionId && request.transactionId !== stored.transactionId) {
+    differing.push('transactionId');
+  }
+
+  if (differing.length > 0) {
+    throw new ReplayContentConflictError(request.idempotencyKey, stored.entryId, differing);
+  }
+}
+
+/**
+ * An open read view: the snapshot session backing a read token
+ */
+interface ReadView {
+  token: ReadToken;
+  session: ClientSession;
+  expiryTimer: NodeJS.Timeout;
+}
+
+/**
+ * Bind a query to a read view's session, if any
+ */
+function inSession<Q extends { session(session: ClientSession | null): Q }>(
+  query: Q,
+  session?: ClientSession
+): Q {
+  return session ? query.session(session) : query;
+}
+
+/**
+ * LedgerService implementation
+ */
+export class LedgerService implements ILedgerService {
+  private config: LedgerConfig;
+  private aliasResolver?: IAccountAliasResolver;
+  private referenceResolver?: IReferenceAliasResolver;
+  private readViews = new Map<string, ReadView>();
+  private allowedCommitters: Set<string>;
+  private referencePatterns: Map<string, RegExp>;
+  private opCounters = opCountersOf(this);
+
+  constructor(
+    config: Partial<LedgerConfig> = {},
+    aliasResolver?: IAccountAliasResolver,
+    referenceResolver?: IReferenceAliasResolver
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.aliasResolver = aliasResolver;
+    this.referenceResolver = referenceResolver;
+    this.allowedCommitters = new Set(this.config.allowedCommitters || []);
+
+    if (this.config.verifyOnRead && !this.config.verificationPublicKey) {
+      throw new Error('verificationPublicKey is required when verifyOnRead is enabled');
+    }
+
+    if (this.config.tenantId !== undefined) {
+      validateTenantId(this.config.tenantId);
+    }
+
+    // An indexed tag is copied into indexedTags in clear, which would leak a sealed key
+    const cipher = this.config.metadataCipher;
+    const sealedTag = cipher && this.config.indexedTagKeys.find(key => !cipher.isClear(key));
+    if (sealedTag) {
+      throw new Error(`Indexed tag ${sealedTag} is sealed by metadataCipher; add it to clearKeys or stop indexing it`);
+    }
+
+    if (this.config.region !== undefined && !REGION_PATTERN.test(this.config.region)) {
+      throw new Error(`Invalid region: ${this.config.region}`);
+    }
+
+    for (const [type, committer] of Object.entries(this.config.defaultCommitterByType || {})) {
+      if (!committer) {
+        throw new Error(`Default committer for ${type} must not be empty`);
+      }
+    }
+
+    // Copied without g and y, whose lastIndex would make test() stateful
+    this.referencePatterns = new Map(
+      Object.entries(this.config.referencePatterns || {})
+        .filter((pair): pair is [string, RegExp] => pair[1] !== undefined)
+        .map(([type, pattern]) => [type, new RegExp(pattern.source, pattern.flags.replace(/[gy]/g, ''))])
+    );
+  }
+
+  /**
+   * Create a new immutable ledger entry
+   *
+   * @throws LedgerAppendError wrapping the underlying failure
+   */
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return (await this.createEntryWithResult(request)).entry;
+  }
+
+  /**
+   * Validate raw fields, build the entry and append it in one call
+   * Unlike createEntry, a repeated idempotency key is an error rather than
+   * a silent replay, so callers always learn which call committed.
+   *
+   * @throws LedgerAppendError (INVALID) on the first invalid field
+   * @throws LedgerAppendError (DUPLICATE) if the key was already recorded
+   */
+  async recordEntry(fields: RecordEntryFields): Promise<LedgerEntry> {
+    const invalid = validateEntryFields(fields);
+    if (invalid) {
+      throw new LedgerAppendError(AppendErrorCode.INVALID, fields.idempotencyKey, new Error(invalid));
+    }
+
+    const metadata: Record<string, any> = {};
+    if (fields.committedBy) {
+      metadata.committedBy = fields.committedBy;
+    }
+    if (fields.comment) {
+      metadata.comment = fields.comment;
+    }
+
+    const result = await this.createEntryWithResult({
+      accountId: fields.accountId,
+      accountType: fields.accountType || 'user',
+      amount: fields.amount,
+      type: fields.type,
+      balanceState: 'available',
+      stateTransition: fields.type === TransactionType.CREDIT ? 'none→available' : 'available→none',
+      reason: fields.reason,
+      idempotencyKey: fields.idempotencyKey,
+      idempotencyScope: fields.idempotencyScope,
+      requestId: fields.requestId,
+      balanceBefore: fields.balanceBefore,
+      balanceAfter: fields.balanceBefore + fields.amount,
+      correlationId: fields.correlationId,
+      metadata: Object.keys(metadata).length > 0 ? metadata : undefined,
+    });
+
+    if (!result.inserted) {
+      throw LedgerAppendError.from(
+        new IdempotencyConflictError(fields.idempotencyKey, result.entry),
+        fields
+      );
+    }
+
+    return result.entry;
+  }
+
+  /**
+   * Record an entry from a signed amount alone, for lenient intake paths
+   * (bulk feeds, migrations) whose sources carry no transaction type
+   * A positive amount is recorded as a credit (earn) and a negative one as
+   * a debit (redeem); otherwise this is recordEntry, so the strict path
+   * still rejects a type that disagrees with its amount.
+   *
+   * @throws LedgerAppendError (INVALID) for a zero amount or an invalid field
+   * @throws LedgerAppendError (DUPLICATE) if the key was already recorded
+   */
+  async recordInferred(fields: InferredEntryFields): Promise<LedgerEntry> {
+    if (fields.amount === 0) {
+      throw new LedgerAppendError(
+        AppendErrorCode.INVALID,
+        fields.idempotencyKey,
+        new Error('Cannot infer a transaction type from a zero amount')
+      );
+    }
+
+    return this.recordEntry({
+      ...fields,
+      type: fields.amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    });
+  }
+
+  /**
+   * Create a ledger entry and report whether it was newly inserted or an
+   * idempotent replay of an earlier request with the same key
+   * Saves callers on hot write paths a separate idempotency lookup.
+   *
+   * @throws LedgerAppendError wrapping the underlying failure
+   */
+  async createEntryWithResult(request: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult> {
+    const attributes = {
+      accountId: request.accountId,
+      reference: request.correlationId,
+      idempotencyKey: request.idempotencyKey,
+    };
+
+    return this.traced('append', attributes, async () => {
+      try {
+        const result = await this.appendEntry(request);
+        this.opCounters.recordAppend();
+        return result;
+      } catch (error) {
+        const appendError = LedgerAppendError.from(error, request);
+        this.opCounters.recordAppend(appendError.appendCode);
+        throw appendError;
+      }
+    });
+  }
+
+  /**
+   * Append the legs of one multi-leg operation (a transfer, split or
+   * correction) under a shared group ID, in order
+   * Legs carrying a group ID must all carry the same one, which the rest
+   * adopt; otherwise the ID is derived from the legs' scoped idempotency
+   * keys. Every leg is validated before any is written. Legs without
+   * their own timestamp and entry ID share one timestamp and take entry
+   * IDs of one prefix and their position, so a group stays contiguous in
+   * (timestamp, entryId) order beside concurrent groups. The legs are
+   * not written in one transaction: each append stages its outbox
+   * message and folds the digest outside any session, and those would
+   * not roll back with it. An append interrupted part-way leaves the
+   * legs already written visible to getByGroup; appending the same legs
+   * again completes it, and they land in the same group.
+   *
+   * @throws InvalidLedgerGroupError if there are fewer than two legs or their group IDs differ
+   * @throws LedgerAppendError (INVALID) if a leg's fields are invalid
+   * @throws LedgerAppendError wrapping the first failed append
+   */
+  async appendGroup(legs: CreateLedgerEntryRequest[]): Promise<LedgerEntry[]> {
+    if (legs.length < 2) {
+      throw new InvalidLedgerGroupError(`A group needs at least two legs, got ${legs.length}`);
+    }
+
+    const groupIds = [...new Set(legs.map(leg => leg.groupId).filter(Boolean))];
+    if (groupIds.length > 1) {
+      throw new InvalidLedgerGroupError('Legs carry different group IDs', { groupIds });
+    }
+
+    for (const leg of legs) {
+      const invalid = validateEntryFields(leg);
+      if (invalid) {
+        throw new LedgerAppendError(AppendErrorCode.INVALID, leg.idempotencyKey, new Error(invalid));
+      }
+    }
+
+    const groupId = groupIds[0] || derivedGroupId(legs);
+    const timestamp = new Date();
+    const entryIds = runEntryIds(this.newId(), legs.length);
+    const entries: LedgerEntry[] = [];
+    for (const [index, leg] of legs.entries()) {
+      const { entry } = await this.createEntryWithResult({
+        ...leg,
+        groupId,
+        entryId: leg.entryId || entryIds[index],
+        timestamp: leg.timestamp || timestamp,
+      });
+      entries.push(entry);
+    }
+    return entries;
+  }
+
+  /**
+   * Store an entry recorded by another ledger exactly as it was, keeping
+   * its IDs, timestamp and signature, for moving a history between stores
+   * An entry already held under the same ID is replayed.
+   *
+   * @throws Error if a different entry already holds the ID or idempotency key
+   */
+  async importEntry(entry: LedgerEntry): Promise<CreateLedgerEntryResult> {
+    return this.traced('importEntry', { accountId: entry.accountId, idempotencyKey: entry.idempotencyKey }, async () => {
+      const tenantId = this.resolveTenant(entry.tenantId);
+      const doc: Partial<ILedgerEntry> = { ...entry, tenantId, metadata: this.sealMetadata(entry.metadata, entry.entryId) };
+
+      const indexedTags = this.extractIndexedTags(entry.metadata);
+      if (indexedTags.length > 0) {
+        doc.indexedTags = indexedTags;
+      }
+
+      try {
+        const imported = this.mapToDomain(await LedgerEntryModel.create(doc));
+        await this.foldDigest(imported);
+        return { entry: imported, inserted: true };
+      } catch (error: any) {
+        if (error.code !== 11000) {
+          throw error;
+        }
+        const existing = await this.readEntry(entry.entryId);
+        if (!existing || existing.idempotencyKey !== entry.idempotencyKey || existing.amount !== entry.amount) {
+          throw new Error(`Cannot import entry ${entry.entryId}: a different entry holds its ID or idempotency key`);
+        }
+        return { entry: existing, inserted: false };
+      }
+    });
+  }
+
+  /**
+   * Build, sign and insert an entry, replaying on idempotency key collision
+   */
+  private async appendEntry(submitted: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult> {
+    const request = this.withDefaultCommitter(submitted);
+    this.assertIdempotencyKeyFormat(request.idempotencyKey);
+    const tenantId = this.resolveTenant(request.tenantId);
+
+    // The key check above passed, so the first violation is a later rule
+    const [violation] = this.ruleViolations(request);
+    if (violation) {
+      throw violation;
+    }
+
+    const accountId = request.accountType === 'user'
+      ? await this.tokenizeUserId(request.accountId)
+      : request.accountId;
+
+    // Generate IDs if not provided
+    const entryId = request.entryId || this.newId();
+    const transactionId = request.transactionId || this.newId();
+    const timestamp = request.timestamp ? new Date(request.timestamp) : new Date();
+
+    if (this.config.enforceMonotonicTimestamps) {
+      await this.assertNoTimestampRegression(timestamp, tenantId);
+    }
+
+    // Create ledger entry document
+    const entryDoc: Partial<ILedgerEntry> = {
+      entryId,
+      transactionId,
+      accountId,
+      accountType: request.accountType,
+      amount: request.amount,
+      type: request.type,
+      balanceState: request.balanceState,
+      stateTransition: request.stateTransition,
+      reason: request.reason,
+      idempotencyKey: request.idempotencyKey,
+      requestId: request.requestId,
+      balanceBefore: request.balanceBefore,
+      balanceAfter: request.balanceAfter,
+      timestamp,
+      currency: request.currency || this.config.defaultCurrency,
+      metadata: this.sealMetadata(request.metadata, entryId),
+      escrowId: request.escrowId,
+      queueItemId: request.queueItemId,
+      featureType: request.featureType,
+      correlationId: request.correlationId,
+      groupId: request.groupId || undefined,
+      tenantId,
+      idempotencyScope: request.idempotencyScope || undefined,
+    };
+
+    const indexedTags = this.extractIndexedTags(request.metadata);
+    if (indexedTags.length > 0) {
+      entryDoc.indexedTags = indexedTags;
+    }
+
+    if (this.config.signingPrivateKey) {
+      entryDoc.signature = signEntry(
+        { ...request, accountId, entryId, transactionId, timestamp, currency: entryDoc.currency! },
+        this.config.signingPrivateKey
+      );
+    }
+
+    // Judged against the history before this entry
+    const priorStats = this.config.anomalyDetector && request.accountType === 'user'
+      ? await this.readAmountStats({ $eq: accountId }, request.type, tenantId)
+      : undefined;
+
+    const versioned = this.config.trackStreamVersions && request.accountType === 'user';
+
+    // Staged ahead of the insert; a record left by a failed insert is discarded by pollOutbox
+    const outboxKey = { idempotencyKey: request.idempotencyKey, idempotencyScope: request.idempotencyScope, tenantId };
+    const stagedId = this.config.outbox ? await this.config.outbox.stage(outboxKey) : null;
+
+    for (let attempt = 1; ; attempt++) {
+      if (versioned) {
+        entryDoc.streamVersion = await this.nextStreamVersion(accountId, tenantId);
+      }
+
+      try {
+        // Insert entry (idempotency key ensures uniqueness)
+        const created = await LedgerEntryModel.create(entryDoc);
+
+        // Map to domain object
+        const entry = this.mapToDomain(created);
+        await this.foldDigest(entry);
+        if (priorStats) {
+          this.flagAnomaly(entry, priorStats);
+        }
+        return { entry, inserted: true };
+      } catch (error: any) {
+        // A concurrent append took this stream version; take the next one
+        if (error.code === 11000 && error.keyPattern?.streamVersion) {
+          if (attempt < STREAM_VERSION_ATTEMPTS) {
+            continue;
+          }
+          throw new OptimisticLockError('stream', accountId);
+        }
+
+        // Handle duplicate idempotency key
+        if (error.code === 11000 && error.keyPattern?.idempotencyKey) {
+          // Find and return existing entry
+          // Keys are unique per tenant, so only this tenant's entry can replay
+          const existing = await LedgerEntryModel.findOne({
+            tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+            idempotencyKey: { $eq: request.idempotencyKey },
+            idempotencyScope: request.idempotencyScope
+              ? { $eq: request.idempotencyScope }
+              : { $exists: false },
+          }).lean().exec();
+          if (existing) {
+            const replayed = this.mapToDomain(existing as any);
+            if (this.config.rejectConflictingReplays) {
+              assertSameContent(request, entryDoc, replayed);
+            }
+            // No record held the key: it was published and expired, or the entry predates the outbox
+            if (stagedId) {
+              await this.config.outbox!.unstage(stagedId);
+            }
+            return { entry: replayed, inserted: false };
+          }
+        }
+        throw error;
+      }
+    }
+  }
+
+  /**
+   * Hand a committed entry to the anomaly detector's callback if its amount
+   * is unusual; the callback runs detached so it cannot delay or fail the append
+   */
+  private flagAnomaly(entry: LedgerEntry, stats: AmountStats): void {
+    const detector = this.config.anomalyDetector!;
+    if (!detector.isAnomalous(entry.amount, stats)) {
+      return;
+    }
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_AMOUNT_ANOMALY, {
+      entryId: entry.entryId,
+      type: entry.type,
+    });
+    Promise.resolve()
+      .then(() => detector.onAnomaly(entry, stats))
+      .catch(error => {
+        MetricsLogger.incrementCounter(MetricEventType.LEDGER_ANOMALY_CALLBACK_FAILED, {
+          entryId: entry.entryId,
+          error: error instanceof Error ? error.message : 'Unknown error',
+        });
+      });
+  }
+
+  /**
+   * Metadata in its stored form: sealed when a cipher is configured
+   */
+  private sealMetadata(metadata: Record<string, any> | undefined, entryId: string): Record<string, any> | undefined {
+    return this.config.metadataCipher ? this.config.metadataCipher.seal(metadata, entryId) : metadata;
+  }
+
+  /**
+   * Fill in the type's default committer when the request carries none
+   */
+  private withDefaultCommitter(request: CreateLedgerEntryRequest): CreateLedgerEntryRequest {
+    const committer = this.config.defaultCommitterByType?.[request.type];
+    if (!committer || request.metadata?.committedBy) {
+      return request;
+    }
+
+    return { ...request, metadata: { ...request.metadata, committedBy: committer } };
+  }
+
+  /**
+   * Configured append rules a request would break, as the errors its
+   * append would throw, without appending it
+   * The type's default committer is filled in first, as on append. Lets
+   * a wrapper such as ValidatingLedgerService.previewAdjust report the
+   * rules this ledger enforces alongside its own chain.
+   */
+  appendRuleViolations(request: CreateLedgerEntryRequest): WalletServiceError[] {
+    return this.ruleViolations(this.withDefaultCommitter(request));
+  }
+
+  /**
+   * Configured append rules a request breaks, as the errors the append
+   * would throw, in the order it checks them
+   * Shared by appendEntry and validateAll so stored entries are judged by
+   * the same rules as live appends.
+   */
+  private ruleViolations(request: CreateLedgerEntryRequest): WalletServiceError[] {
+    const violations: WalletServiceError[] = [];
+
+    try {
+      this.assertIdempotencyKeyFormat(request.idempotencyKey);
+    } catch (error) {
+      violations.push(error as IdempotencyKeyRejectedError);
+    }
+
+    if (this.allowedCommitters.size > 0 && !this.allowedCommitters.has(request.metadata?.committedBy)) {
+      violations.push(new UnauthorizedCommitterError(request.metadata?.committedBy));
+    }
+
+    if (this.config.requireGroupId && !request.groupId) {
+      violations.push(new MissingGroupIdError(request.idempotencyKey));
+    }
+
+    if (this.config.requireAdjustComment && ADJUST_REASONS.includes(request.reason) && !hasComment(request)) {
+      violations.push(new MissingAdjustReasonError(request.idempotencyKey, request.reason));
+    }
+
+    const referencePattern = this.referencePatterns.get(request.type);
+    if (referencePattern && request.correlationId && !referencePattern.test(request.correlationId)) {
+      violations.push(new ReferenceFormatError(request.correlationId, request.type));
+    }
+
+    return violations;
+  }
+
+  /**
+   * Next version of a user's stream: one past the highest stored
+   * Gapless because a version is only consumed by a successful insert;
+   * the unique stream index rejects a concurrent append that read the
+   * same version, and that append retries.
+   */
+  private async nextStreamVersion(accountId: string, tenantId?: string): Promise<number> {
+    const last = await LedgerEntryModel.findOne(
+      this.scopeQuery({ accountId: { $eq: accountId }, streamVersion: { $exists: true } }, tenantId)
+    )
+      .sort({ streamVersion: -1 })
+      .select({ streamVersion: 1 })
+      .lean()
+      .exec();
+
+    return last ? (last as any).streamVersion + 1 : 1;
+  }
+
+  /**
+   * Fold a new entry into the running digest
+   * The entry is already durable, so a failed fold is reported rather
+   * than failing the append; LedgerDigest.verify() finds the gap.
+   */
+  private async foldDigest(entry: LedgerEntry): Promise<void> {
+    if (!this.config.digest) {
+      return;
+    }
+
+    try {
+      await this.config.digest.fold(entry);
+    } catch (error) {
+      MetricsLogger.incrementCounter(MetricEventType.LEDGER_DIGEST_FOLD_FAILED, {
+        entryId: entry.entryId,
+        error: error instanceof Error ? error.message : 'Unknown error',
+      });
+    }
+  }
+
+  /**
+   * Query ledger entries with filters
+   * With verifyOnRead enabled, entries failing signature checks are skipped
+   */
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.traced('queryEntries', { accountId: filter.accountId }, async () => {
+      const result = await this.fetchEntries(filter);
+
+      if (!this.config.verifyOnRead) {
+        return result;
+      }
+
+      return { ...result, entries: this.verifyResult(result).entries };
+    });
+  }
+
+  /**
+   * Query ledger entries and report which failed signature verification
+   * Requires a configured verification public key
+   */
+  async queryEntriesVerified(filter: LedgerQueryFilter): Promise<VerifiedLedgerQueryResult> {
+    return this.traced('queryEntriesVerified', { accountId: filter.accountId }, async () => {
+      if (!this.config.verificationPublicKey) {
+        throw new Error('verificationPublicKey is required for verified queries');
+      }
+
+      return this.verifyResult(await this.fetchEntries(filter));
+    });
+  }
+
+  /**
+   * Open a consistent read view for several queries
+   * Reads made with the token (queryEntriesAt, getEntryAt,
+   * getBalanceSnapshotAt) all see the ledger as of this call, so appends
+   * landing between them never produce a state that did not exist. The
+   * view is a MongoDB snapshot session, which requires a replica set.
+   *
+   * @param lifetimeMs How long the view may stay open (at most maxReadTokenLifetimeMs)
+   */
+  async beginRead(lifetimeMs: number = this.config.maxReadTokenLifetimeMs): Promise<ReadToken> {
+    const maxLifetime = this.config.maxReadTokenLifetimeMs;
+    if (!Number.isInteger(lifetimeMs) || lifetimeMs < 1 || lifetimeMs > maxLifetime) {
+      throw new Error(`Read token lifetime must be between 1 and ${maxLifetime} ms`);
+    }
+
+    const session = await LedgerEntryModel.startSession({ snapshot: true });
+    const asOf = new Date();
+    const token: ReadToken = {
+      tokenId: uuidv4(),
+      asOf,
+      expiresAt: new Date(asOf.getTime() + lifetimeMs),
+    };
+
+    // Release abandoned views so they do not pin snapshot history
+    const expiryTimer = setTimeout(() => {
+      void this.releaseRead(token);
+    }, lifetimeMs);
+    expiryTimer.unref();
+
+    this.readViews.set(token.tokenId, { token, session, expiryTimer });
+    return token;
+  }
+
+  /**
+   * Release a read view; releasing twice is a no-op
+   */
+  async releaseRead(token: ReadToken): Promise<void> {
+    const view = this.readViews.get(token.tokenId);
+    if (!view) {
+      return;
+    }
+
+    this.readViews.delete(token.tokenId);
+    clearTimeout(view.expiryTimer);
+    await view.session.endSession();
+  }
+
+  /**
+   * Query entries within a read view
+   * Entries timestamped after the view opened are excluded as well.
+   *
+   * @throws ReadTokenExpiredError if the token expired or was released
+   */
+  async queryEntriesAt(token: ReadToken, filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.traced('queryEntriesAt', { accountId: filter.accountId }, async () => {
+      const view = this.openView(token);
+      const endDate = filter.endDate && filter.endDate < token.asOf ? filter.endDate : token.asOf;
+      const result = await this.fetchEntries({ ...filter, endDate }, view.session);
+
+      if (!this.config.verifyOnRead) {
+        return result;
+      }
+
+      return { ...result, entries: this.verifyResult(result).entries };
+    });
+  }
+
+  /**
+   * Get entries carrying an indexed metadata tag, oldest first
+   * Only keys listed in indexedTagKeys are indexed, bounding index size.
+   *
+   * @throws TagNotIndexedError if the key is not configured for indexing
+   */
+  async getByTag(
+    key: string,
+    value: string,
+    options: { offset?: number; limit?: number } = {}
+  ): Promise<LedgerQueryResult> {
+    return this.traced('getByTag', { tag: key }, async () => {
+      if (!this.config.indexedTagKeys.includes(key)) {
+        throw new TagNotIndexedError(key);
+      }
+
+      const query = this.scopeQuery({
+        indexedTags: { $elemMatch: { key: { $eq: key }, value: { $eq: String(value) } } },
+      });
+      const limit = Math.min(options.limit || 100, 1000);
+      const offset = options.offset || 0;
+
+      const [entries, totalCount] = await Promise.all([
+        LedgerEntryModel.find(query)
+          .sort({ timestamp: 1 })
+          .skip(offset)
+          .limit(limit)
+          .lean()
+          .exec(),
+        LedgerEntryModel.countDocuments(query),
+      ]);
+
+      const result: LedgerQueryResult = {
+        entries: entries.map((doc: any) => this.mapToDomain(doc)),
+        totalCount,
+        offset,
+        limit,
+        hasMore: offset + entries.length < totalCount,
+      };
+
+      if (!this.config.verifyOnRead) {
+        return result;
+      }
+
+      return { ...result, entries: this.verifyResult(result).entries };
+    });
+  }
+
+  /**
+   * Get the ledger high-water mark and entry count
+   * Both come from one aggregation over the same documents, so the count
+   * always equals the number of entries at or below the high-water mark
+   * even while appends are in flight. Followers use this to size pulls
+   * and detect gaps.
+   */
+  async getCheckpoint(tenantId?: string): Promise<LedgerCheckpoint> {
+    const [row] = await LedgerEntryModel.aggregate([
+      { $match: this.scopeQuery({}, tenantId) },
+      {
+        $group: {
+          _id: null,
+          count: { $sum: 1 },
+          highWaterMark: { $max: '$timestamp' },
+        },
+      },
+    ]).exec();
+
+    return {
+      highWaterMark: row ? row.highWaterMark : null,
+      count: row ? row.count : 0,
+      takenAt: new Date(),
+    };
+  }
+
+  /**
+   * Sum entry amounts per reference (correlationId) in one aggregation
+   * Entries without a reference are excluded. Results are ordered by
+   * reference.
+   */
+  async sumByReference(filter: ReferenceSumFilter = {}): Promise<ReferenceSum[]> {
+    return this.traced('sumByReference', {}, async () => {
+      const query: any = { correlationId: { $exists: true, $ne: null } };
+
+      if (filter.accountType) {
+        query.accountType = { $eq: filter.accountType };
+      }
+
+      if (filter.startDate || filter.endDate) {
+        query.timestamp = {};
+        if (filter.startDate) {
+          query.timestamp.$gte = filter.startDate;
+        }
+        if (filter.endDate) {
+          query.timestamp.$lte = filter.endDate;
+        }
+      }
+
+      const rows = await LedgerEntryModel.aggregate([
+        { $match: this.scopeQuery(query, filter.tenantId) },
+        {
+          $group: {
+            _id: '$correlationId',
+            total: { $sum: '$amount' },
+            entryCount: { $sum: 1 },
+          },
+        },
+        { $sort: { _id: 1 } },
+      ]).exec();
+
+      const sums: ReferenceSum[] = rows.map((row: any) => ({
+        reference: row._id,
+        total: row.total,
+        entryCount: row.entryCount,
+      }));
+
+      if (!this.referenceResolver) {
+        return sums;
+      }
+
+      // Fold aliased references into their canonical reference
+      const canonical = await this.referenceResolver.canonicalMap();
+      const grouped = new Map<string, ReferenceSum>();
+      for (const sum of sums) {
+        const reference = canonical.get(sum.reference) || sum.reference;
+        const group = grouped.get(reference);
+        if (group) {
+          group.total += sum.total;
+          group.entryCount += sum.entryCount;
+        } else {
+          grouped.set(reference, { ...sum, reference });
+        }
+      }
+
+      // Same binary order as the aggregation's $sort
+      return [...grouped.values()].sort((a, b) =>
+        a.reference < b.reference ? -1 : a.reference > b.reference ? 1 : 0
+      );
+    });
+  }
+
+  /**
+   * Every distinct reference (correlationId) in the store, in binary order
+   * Read as one distinct query on the reference index, so no entry is
+   * scanned. Entries without a reference (or with an empty one) are
+   * excluded; references are returned as stored, aliases included. Use
+   * iterateReferences for stores with too many references to hold at once.
+   */
+  async references(tenantId?: string): Promise<string[]> {
+    return this.traced('references', {}, async () => {
+      const references: string[] = await LedgerEntryModel.distinct(
+        'correlationId',
+        this.scopeQuery({ correlationId: { $exists: true, $nin: [null, ''] } }, tenantId)
+      ).exec();
+
+      // Same binary order as iterateReferences' $sort
+      return [...references].sort((a, b) => (a < b ? -1 : a > b ? 1 : 0));
+    });
+  }
+
+  /**
+   * Call fn with each distinct reference, in the order of references()
+   * Reads one page at a time through the reference index, resuming after
+   * the last reference visited, so memory stays bounded however many
+   * references the store holds. Stops at, and rethrows, the first error fn
+   * throws.
+   *
+   * @returns Number of references visited
+   */
+  async iterateReferences(fn: (reference: string) => void | Promise<void>, tenantId?: string): Promise<number> {
+    return this.traced('iterateReferences', {}, async () => {
+      let visited = 0;
+      let last: string | undefined;
+
+      for (;;) {
+        const window: Record<string, any> = { correlationId: { $exists: true, $nin: [null, ''] } };
+        if (last !== undefined) {
+          window.correlationId.$gt = last;
+        }
+
+        const rows = await LedgerEntryModel.aggregate([
+          { $match: this.scopeQuery(window, tenantId) },
+          // Sorting on the indexed field first lets $group walk the index
+          // in order instead of scanning and hashing every entry
+          { $sort: { correlationId: 1 } },
+          { $group: { _id: '$correlationId' } },
+          { $sort: { _id: 1 } },
+          { $limit: REFERENCE_PAGE_SIZE },
+        ]).exec();
+
+        for (const row of rows) {
+          await fn(row._id);
+          visited++;
+        }
+
+        if (rows.length < REFERENCE_PAGE_SIZE) {
+          return visited;
+        }
+        last = rows[rows.length - 1]._id;
+      }
+    });
+  }
 
-/**
- * Default configuration for ledger service
- */
-const DEFAULT_CONFIG: LedgerConfig = {
-  enableAuditLogging: true,
-  retentionDays: 2555, // 7 years minimum for financial records
-  defaultCurrency: 'points',
-  enableReconciliation: true,
-  reconciliationFrequencyHours: 24,
-  alertOnReconciliationFailure: true,
-};
+  /**
+   * Program-wide totals over every user's available balance
+   * Earned is credits with an earn reason and redeemed the magnitude of
+   * debits with a redemption reason, less the escrow refunds returned to
+   * the available balance; every other entry (admin credits and debits,
+   * expiries, corrections, gifts) is adjusted, signed. Net is earned -
+   * redeemed + adjusted, the points outstanding. Read in one aggregation
+   * grouped by type and reason, so the store is never iterated per user.
+   *
+   * @throws LedgerInconsistencyError if a total exceeds the safe integer range
+   */
+  async globalStats(tenantId?: string): Promise<GlobalSummary> {
+    return this.traced('globalStats', {}, async () => {
+      const rows = await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery({ accountType: { $eq: 'user' }, balanceState: { $eq: 'available' } }, tenantId),
+        },
+        {
+          $group: {
+            _id: {
+              type: '$type',
+              reason: '$reason',
+              escrowRefund: { $eq: ['$stateTransition', 'escrow→available'] },
+            },
+            total: { $sum: '$amount' },
+          },
+        },
+      ]).exec();
 
-/**
- * LedgerService implementation
- */
-export class LedgerService implements ILedgerService {
-  private config: LedgerConfig;
+      const summary: GlobalSummary = { earned: 0, redeemed: 0, adjusted: 0, net: 0 };
+      const add = (field: keyof GlobalSummary, amount: number) => {
+        summary[field] += amount;
+        if (!Number.isSafeInteger(summary[field])) {
+          throw new LedgerInconsistencyError(`Global ${field} total exceeds the safe integer range`, { field });
+        }
+      };
 
-  constructor(config: Partial<LedgerConfig> = {}) {
-    this.config = { ...DEFAULT_CONFIG, ...config };
+      for (const row of rows) {
+        const { type, reason, escrowRefund } = row._id;
+        if (type === TransactionType.CREDIT && EARN_REASONS.includes(reason)) {
+          add('earned', row.total);
+        } else if (type === TransactionType.CREDIT && escrowRefund) {
+          // A refunded escrow hold was never redeemed
+          add('redeemed', -row.total);
+        } else if (type === TransactionType.DEBIT && REDEMPTION_REASONS.includes(reason)) {
+          add('redeemed', -row.total);
+        } else {
+          add('adjusted', row.total);
+        }
+        add('net', row.total);
+      }
+
+      return summary;
+    });
   }
 
   /**
-   * Create a new immutable ledger entry
+   * Percentiles of entry sizes for one transaction type across every
+   * user's available balance, e.g. the median, p90 and p99 redemption
+   * Sizes are amount magnitudes, so debit percentiles read as positive
+   * points. Uses the nearest-rank method: the p-th percentile of n sorted
+   * sizes is the ceil(p * n)-th smallest (the smallest for p = 0), which
+   * is always a stored size, never an interpolated one. Every amount of
+   * the type is read (projected to the amount alone) and sorted in memory,
+   * so this is an analytics call, not a request-path one.
+   *
+   * @param percentiles Fractions in [0, 1], e.g. 0.5 for the median
+   * @returns Size at each requested percentile (all 0 when there are no entries)
+   * @throws Error if a percentile is outside [0, 1]
    */
-  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
-    // Generate IDs if not provided
-    const entryId = uuidv4();
-    const transactionId = request.transactionId || uuidv4();
-    const timestamp = new Date();
+  async amountPercentiles(
+    type: TransactionType,
+    percentiles: number[],
+    tenantId?: string
+  ): Promise<Map<number, number>> {
+    return this.traced('amountPercentiles', {}, async () => {
+      const invalid = percentiles.find(p => !(p >= 0 && p <= 1));
+      if (invalid !== undefined) {
+        throw new Error(`Percentile must be between 0 and 1: ${invalid}`);
+      }
 
-    // Create ledger entry document
-    const entryDoc: Partial<ILedgerEntry> = {
-      entryId,
-      transactionId,
-      accountId: request.accountId,
-      accountType: request.accountType,
-      amount: request.amount,
-      type: request.type,
-      balanceState: request.balanceState,
-      stateTransition: request.stateTransition,
-      reason: request.reason,
-      idempotencyKey: request.idempotencyKey,
-      requestId: request.requestId,
-      balanceBefore: request.balanceBefore,
-      balanceAfter: request.balanceAfter,
-      timestamp,
-      currency: request.currency || this.config.defaultCurrency,
-      metadata: request.metadata,
-      escrowId: request.escrowId,
-      queueItemId: request.queueItemId,
-      featureType: request.featureType,
-      correlationId: request.correlationId,
+      const docs = await LedgerEntryModel.find(
+        this.scopeQuery(
+          { type: { $eq: type }, accountType: { $eq: 'user' }, balanceState: { $eq: 'available' } },
+          tenantId
+        ),
+        { amount: 1, _id: 0 }
+      )
+        .lean()
+        .exec();
+
+      const sizes = docs.map((doc: any) => Math.abs(doc.amount)).sort((a: number, b: number) => a - b);
+      return new Map(
+        percentiles.map(p => [
+          p,
+          sizes.length === 0 ? 0 : sizes[Math.min(sizes.length - 1, Math.max(0, Math.ceil(p * sizes.length) - 1))],
+        ])
+      );
+    });
+  }
+
+  /**
+   * Re-run the append rules against every stored entry and report each
+   * rule each entry breaks, e.g. after a bulk import or migration
+   * Checks are the field checks of recordEntry and the wire decoders
+   * (required fields, amount sign, known type and reason) and the rules
+   * this ledger is configured to enforce on append (idempotency key
+   * format, allowed committers, group IDs, adjustment comments, reference
+   * patterns), through the same code the append path uses. Nothing is
+   * modified. Entries are read a page at a time in (timestamp, entryId)
+   * order, so memory is bounded by the issues found.
+   */
+  async validateAll(tenantId?: string): Promise<LedgerValidationIssue[]> {
+    return this.traced('validateAll', {}, async () => {
+      const issues: LedgerValidationIssue[] = [];
+      let last: LedgerEntry | undefined;
+
+      for (;;) {
+        const window: Record<string, any> = {};
+        if (last) {
+          window.$or = [
+            { timestamp: { $gt: last.timestamp } },
+            { timestamp: { $eq: last.timestamp }, entryId: { $gt: last.entryId } },
+          ];
+        }
+
+        const docs = await LedgerEntryModel.find(this.scopeQuery(window, tenantId))
+          .sort({ timestamp: 1, entryId: 1 })
+          .limit(VALIDATE_ALL_PAGE_SIZE)
+          .lean()
+          .exec();
+
+        for (const entry of docs.map((doc: any) => this.mapToDomain(doc))) {
+          const issue = (rule: string, message: string) =>
+            issues.push({ entryId: entry.entryId, transactionId: entry.transactionId, rule, message });
+
+          const invalid = validateEntryFields(entry);
+          if (invalid) {
+            issue('INVALID_ENTRY_FIELDS', invalid);
+          }
+          for (const violation of this.ruleViolations(entry)) {
+            issue(violation.code, violation.message);
+          }
+          last = entry;
+        }
+
+        if (docs.length < VALIDATE_ALL_PAGE_SIZE) {
+          return issues;
+        }
+      }
+    });
+  }
+
+  /**
+   * Give each user entry without a stream version (or with version 0) the
+   * next version of its user's stream, in (timestamp, entryId) order,
+   * keeping versions already assigned
+   * The migration for legacy history, run with appends paused before
+   * trackStreamVersions is enabled. A first pass checks every stream and
+   * a second stamps the entries, so a history that cannot be numbered is
+   * left unchanged. Stamps are written to the collection directly, as
+   * migrations are, because the schema refuses updates to entries, and
+   * only land on an entry that is still unversioned. Stream versions are
+   * not signed, but they are part of an entry's checksum, so a configured
+   * digest must be rebuilt afterwards.
+   *
+   * @returns Number of entries stamped
+   * @throws LedgerInconsistencyError if an assigned version is not above
+   *   the one before it once gaps are filled
+   */
+  async backfillStreamVersions(tenantId?: string): Promise<number> {
+    return this.traced('backfillStreamVersions', {}, async () => {
+      await this.walkStreamVersions(tenantId, async () => undefined);
+
+      let stamped = 0;
+      await this.walkStreamVersions(tenantId, async stamps => {
+        const result = await LedgerEntryModel.collection.bulkWrite(
+          stamps.map(({ entryId, version }) => ({
+            updateOne: {
+              filter: { entryId, streamVersion: { $in: [null, 0] } },
+              update: { $set: { streamVersion: version } },
+            },
+          }))
+        );
+        stamped += result.modifiedCount;
+      });
+      return stamped;
+    });
+  }
+
+  /**
+   * Number the unversioned user entries a page at a time, passing each
+   * page's stamps to stamp
+   *
+   * @throws LedgerInconsistencyError if an assigned version is out of order
+   */
+  private async walkStreamVersions(
+    tenantId: string | undefined,
+    stamp: (stamps: { entryId: string; version: number }[]) => Promise<void>
+  ): Promise<void> {
+    // One past the last version of each tenant's user stream
+    const last = new Map<string, number>();
+    let after: { timestamp: Date; entryId: string } | undefined;
+
+    for (;;) {
+      const window: Record<string, any> = { accountType: { $eq: 'user' } };
+      if (after) {
+        window.$or = [
+          { timestamp: { $gt: after.timestamp } },
+          { timestamp: { $eq: after.timestamp }, entryId: { $gt: after.entryId } },
+        ];
+      }
+
+      const docs: any[] = await LedgerEntryModel.find(this.scopeQuery(window, tenantId))
+        .sort({ timestamp: 1, entryId: 1 })
+        .limit(BACKFILL_PAGE_SIZE)
+        .select({ entryId: 1, accountId: 1, tenantId: 1, timestamp: 1, streamVersion: 1 })
+        .lean()
+        .exec();
+
+      const stamps: { entryId: string; version: number }[] = [];
+      for (const doc of docs) {
+        const stream = `${doc.tenantId ?? ''}\u0000${doc.accountId}`;
+        const previous = last.get(stream) ?? 0;
+        if (!doc.streamVersion) {
+          stamps.push({ entryId: doc.entryId, version: previous + 1 });
+          last.set(stream, previous + 1);
+        } else if (doc.streamVersion <= previous) {
+          throw new LedgerInconsistencyError(
+            `Cannot backfill stream of ${doc.accountId}: entry ${doc.entryId} has version ${doc.streamVersion} ` +
+              `but follows version ${previous}`,
+            { entryId: doc.entryId, streamVersion: doc.streamVersion, previous }
+          );
+        } else {
+          last.set(stream, doc.streamVersion);
+        }
+      }
+
+      if (stamps.length > 0) {
+        await stamp(stamps);
+      }
+      if (docs.length < BACKFILL_PAGE_SIZE) {
+        return;
+      }
+      after = docs[docs.length - 1];
+    }
+  }
+
+  /**
+   * Get entries carrying a reference (correlationId), oldest first
+   * Entries sharing a timestamp are ordered by entry ID, so pages do not
+   * overlap or skip entries. With a reference resolver, entries stored
+   * under any reference in the same alias group are included.
+   */
+  async getByReference(
+    reference: string,
+    options: { offset?: number; limit?: number; tenantId?: string } = {}
+  ): Promise<LedgerQueryResult> {
+    return this.traced('getByReference', { reference }, async () => {
+      const references = this.referenceResolver
+        ? await this.referenceResolver.referenceGroup(reference)
+        : [reference];
+
+      const query = this.scopeQuery({ correlationId: { $in: references } }, options.tenantId);
+      const limit = Math.min(options.limit || 100, 1000);
+      const offset = options.offset || 0;
+
+      const [entries, totalCount] = await Promise.all([
+        LedgerEntryModel.find(query)
+          .sort({ timestamp: 1, entryId: 1 })
+          .skip(offset)
+          .limit(limit)
+          .lean()
+          .exec(),
+        LedgerEntryModel.countDocuments(query),
+      ]);
+
+      const result: LedgerQueryResult = {
+        entries: entries.map((doc: any) => this.mapToDomain(doc)),
+        totalCount,
+        offset,
+        limit,
+        hasMore: offset + entries.length < totalCount,
+      };
+
+      if (!this.config.verifyOnRead) {
+        return result;
+      }
+
+      return { ...result, entries: this.verifyResult(result).entries };
+    });
+  }
+
+  /**
+   * Get every leg of a multi-leg operation appended with appendGroup,
+   * oldest first
+   * A group whose append was interrupted returns the legs written so far.
+   */
+  async getByGroup(groupId: string, tenantId?: string): Promise<LedgerEntry[]> {
+    return this.traced('getByGroup', { groupId }, async () => {
+      const docs = await LedgerEntryModel.find(this.scopeQuery({ groupId: { $eq: groupId } }, tenantId))
+        .sort({ timestamp: 1, entryId: 1 })
+        .lean()
+        .exec();
+
+      const entries = docs.map((doc: any) => this.mapToDomain(doc));
+      if (!this.config.verifyOnRead) {
+        return entries;
+      }
+
+      const invalid = entries.filter(entry => !this.isSignatureValid(entry));
+      if (invalid.length > 0) {
+        this.reportInvalidSignatures(invalid.map(entry => entry.entryId));
+      }
+      return entries.filter(entry => !invalid.includes(entry));
+    });
+  }
+
+  /**
+   * Get entries appended by a committer (metadata.committedBy), oldest first
+   */
+  async getByCommitter(
+    committedBy: string,
+    options: { offset?: number; limit?: number; tenantId?: string } = {}
+  ): Promise<LedgerQueryResult> {
+    return this.traced('getByCommitter', {}, async () => {
+      const query = this.scopeQuery({ 'metadata.committedBy': { $eq: committedBy } }, options.tenantId);
+      const limit = Math.min(options.limit || 100, 1000);
+      const offset = options.offset || 0;
+
+      const [entries, totalCount] = await Promise.all([
+        LedgerEntryModel.find(query)
+          .sort({ timestamp: 1 })
+          .skip(offset)
+          .limit(limit)
+          .lean()
+          .exec(),
+        LedgerEntryModel.countDocuments(query),
+      ]);
+
+      const result: LedgerQueryResult = {
+        entries: entries.map((doc: any) => this.mapToDomain(doc)),
+        totalCount,
+        offset,
+        limit,
+        hasMore: offset + entries.length < totalCount,
+      };
+
+      if (!this.config.verifyOnRead) {
+        return result;
+      }
+
+      return { ...result, entries: this.verifyResult(result).entries };
+    });
+  }
+
+  /**
+   * Write a committer's entries over [from, to] to an output as JSON lines,
+   * oldest first. Reads one page at a time through the committer index,
+   * resuming after the last (timestamp, entryId) written, so memory stays
+   * bounded however many entries match.
+   *
+   * @param output Destination stream (not ended by the call)
+   * @returns Number of entries written
+   * @throws InvalidTimeRangeError if from is after to
+   */
+  async streamByCommitter(
+    output: Writable,
+    committedBy: string,
+    from: Date,
+    to: Date,
+    tenantId?: string
+  ): Promise<number> {
+    return this.traced('streamByCommitter', {}, async () => {
+      if (from.getTime() > to.getTime()) {
+        throw new InvalidTimeRangeError(from, to);
+      }
+
+      let written = 0;
+      let last: LedgerEntry | undefined;
+
+      for (;;) {
+        const window: Record<string, any> = {
+          'metadata.committedBy': { $eq: committedBy },
+          timestamp: { $gte: from, $lte: to },
+        };
+        if (last) {
+          window.$or = [
+            { timestamp: { $gt: last.timestamp } },
+            { timestamp: { $eq: last.timestamp }, entryId: { $gt: last.entryId } },
+          ];
+        }
+
+        const docs = await LedgerEntryModel.find(this.scopeQuery(window, tenantId))
+          .sort({ timestamp: 1, entryId: 1 })
+          .limit(COMMITTER_STREAM_PAGE_SIZE)
+          .lean()
+          .exec();
+        if (docs.length === 0) {
+          return written;
+        }
+
+        const page = docs.map((doc: any) => this.mapToDomain(doc));
+        last = page[page.length - 1];
+        const invalid = this.config.verifyOnRead ? page.filter(entry => !this.isSignatureValid(entry)) : [];
+        if (invalid.length > 0) {
+          this.reportInvalidSignatures(invalid.map(entry => entry.entryId));
+        }
+
+        for (const entry of page.filter(e => !invalid.includes(e))) {
+          if (!output.write(JSON.stringify(entry) + '\n')) {
+            await once(output, 'drain');
+          }
+          written++;
+        }
+
+        if (docs.length < COMMITTER_STREAM_PAGE_SIZE) {
+          return written;
+        }
+      }
+    });
+  }
+
+  /**
+   * Net change a committer's entries made to user balances over (from, to]
+   * Debits carry negative amounts, so the signed sum of the committer's
+   * user entries is what they added minus what they removed. Summed in one
+   * aggregation over the committer index.
+   *
+   * @throws InvalidTimeRangeError if from is after to
+   */
+  async committerNetImpact(committedBy: string, from: Date, to: Date, tenantId?: string): Promise<CommitterImpact> {
+    return this.traced('committerNetImpact', {}, async () => {
+      if (from.getTime() > to.getTime()) {
+        throw new InvalidTimeRangeError(from, to);
+      }
+
+      const rows = await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery(
+            {
+              'metadata.committedBy': { $eq: committedBy },
+              timestamp: { $gt: from, $lte: to },
+              accountType: { $eq: 'user' },
+            },
+            tenantId
+          ),
+        },
+        { $group: { _id: null, net: { $sum: '$amount' }, count: { $sum: 1 } } },
+      ]).exec();
+
+      if (rows.length === 0) {
+        return { net: 0, count: 0 };
+      }
+
+      return { net: rows[0].net, count: rows[0].count };
+    });
+  }
+
+  /**
+   * Check that a reference nets to zero with its reversal entries
+   * A reversal is an entry whose REVERSAL_LINK_FIELDS link names one of
+   * the reference's transactions, whatever its own reference; an entry
+   * under the reference that links back into it counts as a reversal,
+   * not an original. Both sums come from one aggregation. A reference
+   * with no entries of its own is never reported as fully reversed.
+   */
+  async isFullyReversed(reference: string, tenantId?: string): Promise<ReferenceReversalStatus> {
+    return this.traced('isFullyReversed', { reference }, async () => {
+      const transactionIds: string[] = await LedgerEntryModel.distinct(
+        'transactionId',
+        this.scopeQuery({ correlationId: { $eq: reference } }, tenantId)
+      ).exec();
+
+      const rows = transactionIds.length === 0 ? [] : await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery({
+            $or: [
+              { correlationId: { $eq: reference } },
+              ...REVERSAL_LINK_FIELDS.map(field => ({ [`metadata.${field}`]: { $in: transactionIds } })),
+            ],
+          }, tenantId),
+        },
+        {
+          $group: {
+            _id: {
+              $cond: [
+                { $or: REVERSAL_LINK_FIELDS.map(field => ({ $in: [`$metadata.${field}`, transactionIds] })) },
+                'reversal',
+                'original',
+              ],
+            },
+            total: { $sum: '$amount' },
+            entryCount: { $sum: 1 },
+          },
+        },
+      ]).exec();
+
+      const original = rows.find((row: any) => row._id === 'original');
+      const reversed = rows.find((row: any) => row._id === 'reversal');
+      const residual = (original ? original.total : 0) + (reversed ? reversed.total : 0);
+
+      return {
+        reference,
+        fullyReversed: Boolean(original) && residual === 0,
+        residual,
+        originalTotal: original ? original.total : 0,
+        reversalTotal: reversed ? reversed.total : 0,
+        reversalCount: reversed ? reversed.entryCount : 0,
+      };
+    });
+  }
+
+  /**
+   * Find reversing entries whose linked original transaction is not in
+   * the store, oldest first, for cleaning up broken links that would
+   * otherwise fail reconciliation
+   * An entry links through the first REVERSAL_LINK_FIELDS field it carries.
+   */
+  async findOrphanedReversals(tenantId?: string): Promise<LedgerEntry[]> {
+    return this.traced('findOrphanedReversals', {}, async () => {
+      const docs = await LedgerEntryModel.find(
+        this.scopeQuery({
+          $or: REVERSAL_LINK_FIELDS.map(field => ({ [`metadata.${field}`]: { $exists: true } })),
+        }, tenantId)
+      )
+        .sort({ timestamp: 1, entryId: 1 })
+        .lean()
+        .exec();
+
+      const reversals = docs.map((doc: any) => this.mapToDomain(doc));
+      if (reversals.length === 0) {
+        return [];
+      }
+
+      const linked = reversals.map(entry => linkedTransactionId(entry));
+      const present = new Set<string>(
+        await LedgerEntryModel.distinct(
+          'transactionId',
+          this.scopeQuery({ transactionId: { $in: [...new Set(linked)] } }, tenantId)
+        ).exec()
+      );
+
+      return reversals.filter((_, i) => !present.has(linked[i]));
+    });
+  }
+
+  /**
+   * Find logical duplicates across the store: two or more user entries
+   * with the same account, type, amount, currency and reference under
+   * different IDs, which indicate an upstream double-send
+   * Grouped in one aggregation on the composite key, which collects only
+   * entry IDs and may spill to disk; the entries of the duplicate sets are
+   * fetched afterwards. Entries without a reference are skipped, as
+   * repeated unreferenced amounts are routine.
+   *
+   * @returns Each duplicate set ordered by (timestamp, entryId), sets ordered by their first entry
+   */
+  async findLogicalDuplicates(tenantId?: string): Promise<LedgerEntry[][]> {
+    return this.traced('findLogicalDuplicates', {}, async () => {
+      const rows = await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery(
+            { accountType: { $eq: 'user' }, correlationId: { $exists: true, $nin: [null, ''] } },
+            tenantId
+          ),
+        },
+        { $sort: { timestamp: 1, entryId: 1 } },
+        {
+          $group: {
+            _id: {
+              accountId: '$accountId',
+              type: '$type',
+              amount: '$amount',
+              currency: '$currency',
+              correlationId: '$correlationId',
+            },
+            entryIds: { $push: '$entryId' },
+            count: { $sum: 1 },
+          },
+        },
+        { $match: { count: { $gte: 2 } } },
+      ])
+        .allowDiskUse(true)
+        .exec();
+
+      const entryIds: string[] = rows.flatMap((row: any) => row.entryIds);
+      const entries = new Map<string, LedgerEntry>();
+      for (let i = 0; i < entryIds.length; i += DUPLICATE_FETCH_PAGE_SIZE) {
+        const docs = await LedgerEntryModel.find(
+          this.scopeQuery({ entryId: { $in: entryIds.slice(i, i + DUPLICATE_FETCH_PAGE_SIZE) } }, tenantId)
+        )
+          .lean()
+          .exec();
+        for (const doc of docs) {
+          entries.set(doc.entryId, this.mapToDomain(doc as any));
+        }
+      }
+
+      // $push keeps the sorted input order within a set; sets come out of $group unordered
+      const groups: LedgerEntry[][] = rows.map((row: any) => row.entryIds.map((entryId: string) => entries.get(entryId)!));
+      return groups.sort(
+        ([a], [b]) =>
+          new Date(a.timestamp).getTime() - new Date(b.timestamp).getTime() ||
+          (a.entryId < b.entryId ? -1 : a.entryId > b.entryId ? 1 : 0)
+      );
+    });
+  }
+
+  /**
+   * Find numbers missing from a user's sequentially numbered references
+   * (prefix + 1, prefix + 2, ...), which indicate dropped upstream events
+   * References are read as distinct values, so repeated entries for one
+   * reference count once. Numbers above expectedMax are ignored.
+   */
+  async missingReferenceNumbers(
+    userId: string,
+    prefix: string,
+    expectedMax: number,
+    tenantId?: string
+  ): Promise<ReferenceSequenceGaps> {
+    if (!Number.isSafeInteger(expectedMax) || expectedMax < 0) {
+      throw new Error('expectedMax must be a non-negative integer');
+    }
+
+    return this.traced('missingReferenceNumbers', { accountId: userId, reference: prefix }, async () => {
+      userId = await this.tokenizeUserId(userId);
+      const escaped = prefix.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+      const references: string[] = await LedgerEntryModel.distinct(
+        'correlationId',
+        this.scopeQuery(
+          {
+            accountId: { $eq: userId },
+            accountType: { $eq: 'user' },
+            correlationId: { $regex: `^${escaped}` },
+          },
+          tenantId
+        )
+      ).exec();
+
+      const seen = new Set<number>();
+      let malformed = 0;
+      for (const reference of references) {
+        const suffix = reference.slice(prefix.length);
+        if (!/^[1-9]\d*$/.test(suffix)) {
+          malformed++;
+          continue;
+        }
+        seen.add(Number(suffix));
+      }
+
+      const missing: number[] = [];
+      for (let n = 1; n <= expectedMax; n++) {
+        if (!seen.has(n)) {
+          missing.push(n);
+        }
+      }
+
+      return { userId, prefix, expectedMax, missing, malformed };
+    });
+  }
+
+  /**
+   * Count entries per index so operators can spot discrepancies
+   * Entry IDs and idempotency keys are unique, so each should equal the
+   * total; every entry belongs to exactly one account.
+   */
+  async getIndexStats(tenantId?: string): Promise<LedgerIndexReport> {
+    const groupCount = (field: string) => [
+      { $group: { _id: field, entries: { $sum: 1 } } },
+      { $group: { _id: null, count: { $sum: 1 }, entries: { $sum: '$entries' } } },
+    ];
+
+    const [row] = await LedgerEntryModel.aggregate([
+      { $match: this.scopeQuery({}, tenantId) },
+      {
+        $facet: {
+          total: [{ $count: 'n' }],
+          entryIds: groupCount('$entryId'),
+          idempotencyKeys: groupCount('$idempotencyKey'),
+          accounts: groupCount('$accountId'),
+          correlations: [
+            { $match: { correlationId: { $exists: true, $ne: null } } },
+            ...groupCount('$correlationId'),
+          ],
+        },
+      },
+    ]).exec();
+
+    const first = (facet?: any[]) => (facet && facet[0]) || {};
+
+    return {
+      totalEntries: first(row?.total).n || 0,
+      distinctEntryIds: first(row?.entryIds).count || 0,
+      distinctIdempotencyKeys: first(row?.idempotencyKeys).count || 0,
+      accounts: {
+        count: first(row?.accounts).count || 0,
+        entries: first(row?.accounts).entries || 0,
+      },
+      correlations: {
+        count: first(row?.correlations).count || 0,
+        entries: first(row?.correlations).entries || 0,
+      },
+      generatedAt: new Date(),
     };
+  }
+
+  /**
+   * Check ledger health from its index statistics
+   * Duplicate entry IDs or idempotency keys mean a unique index was
+   * bypassed and the ledger is unhealthy.
+   */
+  async healthCheck(): Promise<ServiceHealth> {
+    const checkedAt = new Date();
 
     try {
-      // Insert entry (idempotency key ensures uniqueness)
-      const created = await LedgerEntryModel.create(entryDoc);
-
-      // Map to domain object
-      return this.mapToDomain(created);
-    } catch (error: any) {
-      // Handle duplicate idempotency key
-      if (error.code === 11000 && error.keyPattern?.idempotencyKey) {
-        // Find and return existing entry
-        const existing = await LedgerEntryModel.findOne({ 
-          idempotencyKey: { $eq: request.idempotencyKey } 
-        }).lean().exec();
-        if (existing) {
-          return this.mapToDomain(existing as any);
-        }
+      const stats = await this.getIndexStats();
+      const problems: string[] = [];
+
+      if (stats.distinctEntryIds !== stats.totalEntries) {
+        problems.push('duplicate entry IDs');
       }
-      throw error;
+      if (stats.distinctIdempotencyKeys !== stats.totalEntries) {
+        problems.push('duplicate idempotency keys');
+      }
+      if (stats.accounts.entries !== stats.totalEntries) {
+        problems.push('entries without an account');
+      }
+
+      return {
+        service: 'ledger',
+        status: problems.length === 0 ? 'healthy' : 'unhealthy',
+        message: problems.length === 0 ? undefined : `Index discrepancies: ${problems.join(', ')}`,
+        checkedAt,
+        metrics: { ...stats },
+      };
+    } catch (error) {
+      return {
+        service: 'ledger',
+        status: 'unhealthy',
+        message: error instanceof Error ? error.message : 'Unknown error',
+        checkedAt,
+      };
     }
   }
 
   /**
-   * Query ledger entries with filters
+   * Cumulative counts of this instance's appends, by outcome, and of each
+   * query method's calls
+   * Cheap enough to poll; the returned object is a copy.
    */
-  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+  opStats(): OpCounters {
+    return this.opCounters.snapshot();
+  }
+
+  /**
+   * Execute a filtered ledger query
+   */
+  private async fetchEntries(filter: LedgerQueryFilter, session?: ClientSession): Promise<LedgerQueryResult> {
     // Build query
-    const query: any = {};
+    const query: any = this.scopeQuery({}, filter.tenantId);
 
     if (filter.accountId) {
-      query.accountId = { $eq: filter.accountId };
+      const accountId = await this.resolveAccountId(filter.accountId, filter.accountType);
+      query.accountId = await this.historyAccounts(accountId);
     }
 
     if (filter.accountType) {
@@ -135,6 +1884,15 @@ export class LedgerService implements ILedgerService {
       query.featureType = { $eq: filter.featureType };
     }
 
+    if (filter.excludeTransactionIds && filter.excludeTransactionIds.length > 0) {
+      query.transactionId = { $nin: filter.excludeTransactionIds };
+    }
+
+    if (filter.fromStreamVersion !== undefined) {
+      // $not keeps entries with no version at all
+      query.streamVersion = { $not: { $lt: filter.fromStreamVersion } };
+    }
+
     // Date range filter
     if (filter.startDate || filter.endDate) {
       query.timestamp = {};
@@ -153,17 +1911,18 @@ export class LedgerService implements ILedgerService {
     // Sorting
     const sortField = filter.sortBy || 'timestamp';
     const sortOrder = filter.sortOrder === 'asc' ? 1 : -1;
-    const sort: any = { [sortField]: sortOrder };
+    // Entry ID breaks ties so paging is stable
+    const sort: any = { [sortField]: sortOrder, entryId: sortOrder };
 
     // Execute query
     const [entries, totalCount] = await Promise.all([
-      LedgerEntryModel.find(query)
+      inSession(LedgerEntryModel.find(query), session)
         .sort(sort)
         .skip(offset)
         .limit(limit)
         .lean()
         .exec(),
-      LedgerEntryModel.countDocuments(query),
+      inSession(LedgerEntryModel.countDocuments(query), session),
     ]);
 
     // Map results
@@ -180,11 +1939,131 @@ export class LedgerService implements ILedgerService {
    * Get a specific ledger entry by ID
    */
   async getEntry(entryId: string): Promise<LedgerEntry | null> {
-    const entry = await LedgerEntryModel.findOne({ 
+    return this.traced('getEntry', { entryId }, async () => {
+      return this.readEntry(entryId);
+    });
+  }
+
+  /**
+   * Check whether an entry exists without reading the document
+   * Cheaper than getEntry for callers that only need a yes or no, such as
+   * dedup checks before an append. Signatures are not verified.
+   */
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.traced('entryExists', { entryId }, async () => {
+      const found = await LedgerEntryModel.exists(this.scopeQuery({ entryId: { $eq: entryId } })).exec();
+      return found !== null;
+    });
+  }
+
+  /**
+   * Committed entries awaiting publication, oldest staged first
+   * Records are read a page at a time and resolved to their entries by
+   * idempotency key, one query per page. A record whose entry is not in
+   * the ledger yet is skipped while its append may still be in flight,
+   * and discarded once it is older than the outbox's abandonAfterMs; the
+   * poll pages on past skipped records, so appends in flight never hide
+   * committed ones staged after them. Returned entries stay pending until
+   * markPublished() acknowledges them.
+   *
+   * @param limit Most entries to return
+   * @throws Error if no outbox is configured
+   */
+  async pollOutbox(limit: number): Promise<OutboxEntry[]> {
+    return this.traced('pollOutbox', {}, async () => {
+      const outbox = this.requireOutbox();
+      const entries: OutboxEntry[] = [];
+      const cutoff = Date.now() - outbox.abandonAfterMs;
+      let after: OutboxCursor | undefined;
+
+      while (entries.length < limit) {
+        const records = await outbox.pending(limit, this.config.tenantId, after);
+        if (records.length === 0) {
+          break;
+        }
+
+        const docs = await LedgerEntryModel.find(
+          this.scopeQuery({ idempotencyKey: { $in: [...new Set(records.map(record => record.idempotencyKey))] } })
+        )
+          .lean()
+          .exec();
+
+        const abandoned: string[] = [];
+        for (const record of records) {
+          const doc = docs.find(
+            (candidate: any) =>
+              candidate.idempotencyKey === record.idempotencyKey &&
+              (candidate.idempotencyScope || undefined) === (record.idempotencyScope || undefined) &&
+              candidate.tenantId === record.tenantId
+          );
+          if (doc) {
+            if (entries.length < limit) {
+              entries.push({ outboxId: record.outboxId, entry: this.mapToDomain(doc as any) });
+            }
+          } else if (record.stagedAt.getTime() < cutoff) {
+            abandoned.push(record.outboxId);
+          }
+        }
+
+        await outbox.discard(abandoned);
+        if (records.length < limit) {
+          break;
+        }
+        after = records[records.length - 1];
+      }
+
+      return entries;
+    });
+  }
+
+  /**
+   * Acknowledge published outbox entries so pollOutbox stops returning them
+   * Unknown and already acknowledged IDs are ignored.
+   *
+   * @throws Error if no outbox is configured
+   */
+  async markPublished(outboxIds: string[]): Promise<void> {
+    return this.traced('markPublished', {}, async () => {
+      await this.requireOutbox().markPublished(outboxIds);
+    });
+  }
+
+  private requireOutbox(): LedgerOutbox {
+    if (!this.config.outbox) {
+      throw new Error('outbox is required for outbox polling');
+    }
+    return this.config.outbox;
+  }
+
+  /**
+   * Get a specific ledger entry by ID within a read view
+   *
+   * @throws ReadTokenExpiredError if the token expired or was released
+   */
+  async getEntryAt(token: ReadToken, entryId: string): Promise<LedgerEntry | null> {
+    return this.traced('getEntryAt', { entryId }, async () => {
+      return this.readEntry(entryId, this.openView(token).session);
+    });
+  }
+
+  private async readEntry(entryId: string, session?: ClientSession): Promise<LedgerEntry | null> {
+    const query = LedgerEntryModel.findOne(this.scopeQuery({ 
       entryId: { $eq: entryId } 
-    }).lean().exec();
+    }));
+    const entry = await inSession(query, session).lean().exec();
+
+    if (!entry) {
+      return null;
+    }
 
-    return entry ? this.mapToDomain(entry as any) : null;
+    const mapped = this.mapToDomain(entry as any);
+
+    if (this.config.verifyOnRead && !this.isSignatureValid(mapped)) {
+      this.reportInvalidSignatures([mapped.entryId]);
+      return null;
+    }
+
+    return mapped;
   }
 
   /**
@@ -195,17 +2074,47 @@ export class LedgerService implements ILedgerService {
     accountType: 'user' | 'model',
     asOf?: Date
   ): Promise<BalanceSnapshot> {
-    const query: any = {
+    return this.traced('getBalanceSnapshot', { accountId }, async () => {
+      return this.readBalanceSnapshot(accountId, accountType, asOf);
+    });
+  }
+
+  /**
+   * Get an account's balance snapshot within a read view, as of the
+   * moment the view was opened
+   *
+   * @throws ReadTokenExpiredError if the token expired or was released
+   */
+  async getBalanceSnapshotAt(
+    token: ReadToken,
+    accountId: string,
+    accountType: 'user' | 'model'
+  ): Promise<BalanceSnapshot> {
+    return this.traced('getBalanceSnapshotAt', { accountId }, async () => {
+      const view = this.openView(token);
+      return this.readBalanceSnapshot(accountId, accountType, token.asOf, view.session);
+    });
+  }
+
+  private async readBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date,
+    session?: ClientSession
+  ): Promise<BalanceSnapshot> {
+    accountId = await this.resolveAccountId(accountId, accountType);
+
+    const query: any = this.scopeQuery({
       accountId: { $eq: accountId },
       accountType: { $eq: accountType },
-    };
+    });
 
     if (asOf) {
       query.timestamp = { $lte: asOf };
     }
 
     // Get all entries up to the specified time
-    const entries = await LedgerEntryModel.find(query)
+    const entries = await inSession(LedgerEntryModel.find(query), session)
       .sort({ timestamp: 1 })
       .lean()
       .exec();
@@ -244,6 +2153,466 @@ export class LedgerService implements ILedgerService {
     return snapshot;
   }
 
+  /**
+   * Find the entry at which an account's available balance first reached
+   * or exceeded a threshold, replaying its history in timestamp order
+   * Later dips and re-crossings are ignored - the first crossing wins.
+   *
+   * @returns The crossing entry and resulting balance, or null if the
+   * balance never reached the threshold
+   */
+  async findThresholdCrossing(
+    accountId: string,
+    threshold: number,
+    accountType: 'user' | 'model' = 'user'
+  ): Promise<ThresholdCrossing | null> {
+    return this.traced('findThresholdCrossing', { accountId }, async () => {
+      const entry = await this.firstAvailableEntry(accountId, accountType, e => e.balanceAfter >= threshold);
+      return entry ? { entry, balance: entry.balanceAfter } : null;
+    });
+  }
+
+  /**
+   * Find the first entry after which a user's available balance was
+   * exactly the target, replaying the history (merged accounts included)
+   * in timestamp order
+   *
+   * @returns The entry, or null if the balance never equalled the target
+   * @throws Error if the target is not an integer
+   */
+  async findBalanceEquals(userId: string, target: number, tenantId?: string): Promise<LedgerEntry | null> {
+    if (!Number.isSafeInteger(target)) {
+      throw new Error(`Target balance must be an integer: ${target}`);
+    }
+
+    return this.traced('findBalanceEquals', { accountId: userId }, () =>
+      this.firstAvailableEntry(userId, 'user', entry => entry.balanceAfter === target, tenantId)
+    );
+  }
+
+  /**
+   * Highest available balance a user ever held and when it was first reached
+   * Read in one query as the entry with the largest balanceAfter, ties
+   * going to the earliest by (timestamp, entryId).
+   */
+  async peakBalance(userId: string, tenantId?: string): Promise<PeakBalance> {
+    return this.traced('peakBalance', { accountId: userId }, async () => {
+      userId = await this.resolveAccountId(userId, 'user');
+
+      const peak = await LedgerEntryModel.findOne(
+        this.scopeQuery(
+          { accountId: { $eq: userId }, accountType: { $eq: 'user' }, balanceState: { $eq: 'available' } },
+          tenantId
+        )
+      )
+        .sort({ balanceAfter: -1, timestamp: 1, entryId: 1 })
+        .lean()
+        .exec();
+
+      return peak ? { balance: peak.balanceAfter, timestamp: peak.timestamp } : { balance: 0, timestamp: null };
+    });
+  }
+
+  /**
+   * Entries immediately before and after one entry in a user's history,
+   * for context around a disputed transaction
+   * History is ordered by (timestamp, entryId) across every balance state;
+   * each neighbour is one indexed query, so the history is never pulled.
+   *
+   * @throws EntryNotFoundError if the entry is not in the user's history
+   */
+  async neighborEntries(userId: string, entryId: string, tenantId?: string): Promise<NeighborEntries> {
+    return this.traced('neighborEntries', { accountId: userId, entryId }, async () => {
+      userId = await this.resolveAccountId(userId, 'user');
+      const history = { accountId: { $eq: userId }, accountType: { $eq: 'user' } };
+
+      const target = await LedgerEntryModel.findOne(
+        this.scopeQuery({ ...history, entryId: { $eq: entryId } }, tenantId)
+      ).lean().exec();
+      if (!target) {
+        throw new EntryNotFoundError(entryId, userId);
+      }
+
+      const neighbor = async (direction: 1 | -1) => {
+        const beyond = direction === 1 ? '$gt' : '$lt';
+        const doc = await LedgerEntryModel.findOne(
+          this.scopeQuery(
+            {
+              ...history,
+              $or: [
+                { timestamp: { [beyond]: target.timestamp } },
+                { timestamp: { $eq: target.timestamp }, entryId: { [beyond]: target.entryId } },
+              ],
+            },
+            tenantId
+          )
+        )
+          .sort({ timestamp: direction, entryId: direction })
+          .lean()
+          .exec();
+        return doc ? this.mapToDomain(doc as any) : null;
+      };
+
+      return { previous: await neighbor(-1), next: await neighbor(1) };
+    });
+  }
+
+  /**
+   * Distinct transaction types in a user's history, for hiding filters
+   * that would match nothing
+   * Read as one distinct query on the account index, over the accounts
+   * merged into the user as well. Known types come in TransactionType
+   * order (credits, then debits), followed by any other stored type
+   * alphabetically.
+   */
+  async typesPresent(userId: string, tenantId?: string): Promise<TransactionType[]> {
+    return this.traced('typesPresent', { accountId: userId }, async () => {
+      const accounts = await this.historyAccounts(await this.resolveAccountId(userId, 'user'));
+
+      const types: string[] = await LedgerEntryModel.distinct(
+        'type',
+        this.scopeQuery({ accountId: accounts, accountType: { $eq: 'user' } }, tenantId)
+      ).exec();
+
+      const known: string[] = Object.values(TransactionType);
+      const rank = (type: string) => (known.includes(type) ? known.indexOf(type) : known.length);
+      return [...types].sort((a, b) => rank(a) - rank(b) || a.localeCompare(b)) as TransactionType[];
+    });
+  }
+
+  /**
+   * Group a user's entries into sessions: runs of entries, oldest first,
+   * split wherever the time between adjacent entries exceeds gapMs
+   * Entries with the same timestamp always share a session. The history
+   * is read through queryEntries, so it includes merged accounts.
+   *
+   * @throws Error if gapMs is negative
+   */
+  async sessions(userId: string, gapMs: number, tenantId?: string): Promise<LedgerEntry[][]> {
+    if (!Number.isFinite(gapMs) || gapMs < 0) {
+      throw new Error(`Session gap must not be negative: ${gapMs}`);
+    }
+
+    return this.traced('sessions', { accountId: userId }, async () => {
+      const sessions: LedgerEntry[][] = [];
+      let last: LedgerEntry | undefined;
+      let offset = 0;
+      let hasMore = true;
+
+      while (hasMore) {
+        const result = await this.queryEntries({
+          accountId: userId,
+          accountType: 'user',
+          tenantId,
+          sortBy: 'timestamp',
+          sortOrder: 'asc',
+          offset,
+          limit: 1000,
+        });
+
+        for (const entry of result.entries) {
+          if (!last || new Date(entry.timestamp).getTime() - new Date(last.timestamp).getTime() > gapMs) {
+            sessions.push([]);
+          }
+          sessions[sessions.length - 1].push(entry);
+          last = entry;
+        }
+
+        offset += result.entries.length;
+        hasMore = result.hasMore && result.entries.length > 0;
+      }
+
+      return sessions;
+    });
+  }
+
+  /**
+   * First available-balance entry of an account, oldest first, that matches
+   */
+  private async firstAvailableEntry(
+    accountId: string,
+    accountType: 'user' | 'model',
+    matches: (entry: LedgerEntry) => boolean,
+    tenantId?: string
+  ): Promise<LedgerEntry | null> {
+    let offset = 0;
+    let hasMore = true;
+
+    while (hasMore) {
+      const result = await this.queryEntries({
+        accountId,
+        accountType,
+        tenantId,
+        balanceState: 'available',
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: 1000,
+      });
+
+      const found = result.entries.find(matches);
+      if (found) {
+        return found;
+      }
+
+      offset += result.entries.length;
+      hasMore = result.hasMore && result.entries.length > 0;
+    }
+
+    return null;
+  }
+
+  /**
+   * Change in an account's available balance over (from, to]
+   * Equals the balance as of `to` minus the balance as of `from`, summed
+   * from the amounts of the entries in the window in one aggregation, so
+   * it does not depend on which of two same-timestamp entries sorts first
+   * or on the balanceBefore and balanceAfter snapshots they carry. The
+   * account's history includes the accounts merged into it.
+   *
+   * @throws InvalidTimeRangeError if from is after to
+   */
+  async balanceDelta(
+    accountId: string,
+    from: Date,
+    to: Date,
+    accountType: 'user' | 'model' = 'user',
+    tenantId?: string
+  ): Promise<number> {
+    return this.traced('balanceDelta', { accountId }, async () => {
+      if (from.getTime() > to.getTime()) {
+        throw new InvalidTimeRangeError(from, to);
+      }
+
+      const accounts = await this.historyAccounts(await this.resolveAccountId(accountId, accountType));
+
+      const rows = await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery(
+            {
+              accountId: accounts,
+              accountType: { $eq: accountType },
+              balanceState: { $eq: 'available' },
+              timestamp: { $gt: from, $lte: to },
+            },
+            tenantId
+          ),
+        },
+        { $group: { _id: null, delta: { $sum: '$amount' } } },
+      ]).exec();
+
+      return rows.length === 0 ? 0 : rows[0].delta;
+    });
+  }
+
+  /**
+   * Appends per second over the window ending at now, counted from entry
+   * timestamps in (now - windowMs, now], for capacity planning without
+   * external metrics
+   *
+   * @throws Error if windowMs is not positive
+   */
+  async appendRate(windowMs: number, now: Date = new Date(), tenantId?: string): Promise<number> {
+    if (!Number.isFinite(windowMs) || windowMs <= 0) {
+      throw new Error(`Append rate window must be positive: ${windowMs}`);
+    }
+
+    return this.traced('appendRate', {}, async () => {
+      const from = new Date(now.getTime() - windowMs);
+      const appended = await LedgerEntryModel.countDocuments(
+        this.scopeQuery({ timestamp: { $gt: from, $lte: now } }, tenantId)
+      );
+
+      return appended / (windowMs / 1000);
+    });
+  }
+
+  /**
+   * Count, min, max, sum, mean and standard deviation of a user's entry
+   * amounts of one type, computed in a single aggregation. Amounts are
+   * taken as magnitudes, so debit statistics read as positive values. The
+   * user's history includes the accounts merged into it. No entries gives
+   * zeroed stats.
+   */
+  async amountStats(userId: string, type: TransactionType, tenantId?: string): Promise<AmountStats> {
+    return this.traced('amountStats', { accountId: userId }, async () => {
+      const accounts = await this.historyAccounts(await this.resolveAccountId(userId, 'user'));
+      return this.readAmountStats(accounts, type, tenantId);
+    });
+  }
+
+  private async readAmountStats(
+    accounts: { $eq: string } | { $in: string[] },
+    type: TransactionType,
+    tenantId?: string
+  ): Promise<AmountStats> {
+    const rows = await LedgerEntryModel.aggregate([
+      {
+        $match: this.scopeQuery(
+          {
+            accountId: accounts,
+            accountType: { $eq: 'user' },
+            type: { $eq: type },
+          },
+          tenantId
+        ),
+      },
+      { $project: { magnitude: { $abs: '$amount' } } },
+      {
+        $group: {
+          _id: null,
+          count: { $sum: 1 },
+          min: { $min: '$magnitude' },
+          max: { $max: '$magnitude' },
+          sum: { $sum: '$magnitude' },
+          stdDev: { $stdDevPop: '$magnitude' },
+        },
+      },
+    ]).exec();
+
+    if (rows.length === 0 || rows[0].count === 0) {
+      return { count: 0, min: 0, max: 0, sum: 0, mean: 0, stdDev: 0 };
+    }
+
+    const { count, min, max, sum, stdDev } = rows[0];
+    return { count, min, max, sum, mean: sum / count, stdDev };
+  }
+
+  /**
+   * Distinct references (correlation IDs) across a user's entries, in the
+   * order they were first seen; entries without a reference are skipped
+   * Grouped in one aggregation over the user and the accounts merged into
+   * it, so only the references leave the database.
+   */
+  async referencesByUser(userId: string, tenantId?: string): Promise<string[]> {
+    return this.traced('referencesByUser', { accountId: userId }, async () => {
+      const accounts = await this.historyAccounts(await this.resolveAccountId(userId, 'user'));
+
+      const rows = await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery(
+            {
+              accountId: accounts,
+              accountType: { $eq: 'user' },
+              correlationId: { $exists: true, $nin: [null, ''] },
+            },
+            tenantId
+          ),
+        },
+        { $sort: { timestamp: 1, entryId: 1 } },
+        {
+          $group: {
+            _id: '$correlationId',
+            firstSeenAt: { $first: '$timestamp' },
+            firstEntryId: { $first: '$entryId' },
+          },
+        },
+        { $sort: { firstSeenAt: 1, firstEntryId: 1 } },
+      ]).exec();
+
+      return rows.map((row: any) => row._id);
+    });
+  }
+
+  /**
+   * A user's entries grouped by reference (correlation ID), each group
+   * oldest first and the groups in the order their reference was first
+   * seen. The user's history includes the accounts merged into it.
+   * Entries without a reference are collected under UNREFERENCED_GROUP;
+   * with a reference resolver, aliased references fold into their
+   * canonical reference.
+   */
+  async groupByReference(userId: string, tenantId?: string): Promise<Map<string, LedgerEntry[]>> {
+    return this.traced('groupByReference', { accountId: userId }, async () => {
+      const accounts = await this.historyAccounts(await this.resolveAccountId(userId, 'user'));
+
+      const docs = await LedgerEntryModel.find(
+        this.scopeQuery({ accountId: accounts, accountType: { $eq: 'user' } }, tenantId)
+      )
+        .sort({ timestamp: 1, entryId: 1 })
+        .lean()
+        .exec();
+      const canonical = this.referenceResolver ? await this.referenceResolver.canonicalMap() : new Map<string, string>();
+
+      const groups = new Map<string, LedgerEntry[]>();
+      for (const doc of docs) {
+        const entry = this.mapToDomain(doc as any);
+        const reference = entry.correlationId
+          ? canonical.get(entry.correlationId) || entry.correlationId
+          : UNREFERENCED_GROUP;
+        const group = groups.get(reference);
+        if (group) {
+          group.push(entry);
+        } else {
+          groups.set(reference, [entry]);
+        }
+      }
+      return groups;
+    });
+  }
+
+  /**
+   * Available balance per currency for a set of users, from each user's
+   * latest entry in each currency, computed in one aggregation so every
+   * balance is read in the same pass. A user's balance adds those of the
+   * accounts merged into it. Users with no entries are omitted.
+   *
+   * @returns Balances keyed by user ID as given, then by currency
+   */
+  async balancesByCurrency(userIds: string[], tenantId?: string): Promise<Map<string, Map<string, number>>> {
+    return this.traced('balancesByCurrency', {}, async () => {
+      const requested = [...new Set(userIds)];
+      const histories = await Promise.all(
+        requested.map(async userId => this.historyAccountIds(await this.resolveAccountId(userId, 'user')))
+      );
+      const balances = new Map<string, Map<string, number>>();
+      if (requested.length === 0) {
+        return balances;
+      }
+
+      const rows = await LedgerEntryModel.aggregate([
+        {
+          $match: this.scopeQuery(
+            {
+              accountId: { $in: [...new Set(histories.flat())] },
+              accountType: { $eq: 'user' },
+              balanceState: { $eq: 'available' },
+            },
+            tenantId
+          ),
+        },
+        { $sort: { timestamp: 1, entryId: 1 } },
+        {
+          $group: {
+            _id: { accountId: '$accountId', currency: '$currency' },
+            balance: { $last: '$balanceAfter' },
+          },
+        },
+        { $sort: { '_id.accountId': 1, '_id.currency': 1 } },
+      ]).exec();
+
+      const byAccount = new Map<string, Map<string, number>>();
+      for (const row of rows) {
+        const currencies = byAccount.get(row._id.accountId) ?? new Map<string, number>();
+        currencies.set(row._id.currency, row.balance);
+        byAccount.set(row._id.accountId, currencies);
+      }
+
+      requested.forEach((userId, index) => {
+        const currencies = new Map<string, number>();
+        for (const accountId of histories[index]) {
+          for (const [currency, balance] of byAccount.get(accountId) ?? []) {
+            currencies.set(currency, (currencies.get(currency) ?? 0) + balance);
+          }
+        }
+        if (currencies.size > 0) {
+          balances.set(userId, currencies);
+        }
+      });
+      return balances;
+    });
+  }
+
   /**
    * Generate reconciliation report
    */
@@ -252,6 +2621,8 @@ export class LedgerService implements ILedgerService {
     accountType: 'user' | 'model',
     dateRange: { start: Date; end: Date }
   ): Promise<ReconciliationReport> {
+    accountId = await this.resolveAccountId(accountId, accountType);
+
     // Get starting balance (before start date)
     const startSnapshot = await this.getBalanceSnapshot(
       accountId,
@@ -260,11 +2631,11 @@ export class LedgerService implements ILedgerService {
     );
 
     // Get entries in date range
-    const entries = await LedgerEntryModel.find({
+    const entries = await LedgerEntryModel.find(this.scopeQuery({
       accountId: { $eq: accountId },
       accountType: { $eq: accountType },
       timestamp: { $gte: dateRange.start, $lte: dateRange.end },
-    })
+    }))
       .sort({ timestamp: 1 })
       .lean()
       .exec();
@@ -321,18 +2692,20 @@ export class LedgerService implements ILedgerService {
    * Get audit trail for a transaction
    */
   async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
-    const entries = await LedgerEntryModel.find({
-      transactionId: { $eq: transactionId },
-    })
-      .sort({ timestamp: 1 })
-      .lean()
-      .exec();
+    return this.traced('getAuditTrail', { transactionId }, async () => {
+      const entries = await LedgerEntryModel.find(this.scopeQuery({
+        transactionId: { $eq: transactionId },
+      }))
+        .sort({ timestamp: 1 })
+        .lean()
+        .exec();
 
-    return entries.map(entry => ({
-      auditId: entry.entryId,
-      ledgerEntry: this.mapToDomain(entry as any),
-      auditedAt: entry.timestamp,
-    }));
+      return entries.map(entry => ({
+        auditId: entry.entryId,
+        ledgerEntry: this.mapToDomain(entry as any),
+        auditedAt: entry.timestamp,
+      }));
+    });
   }
 
   /**
@@ -370,6 +2743,235 @@ export class LedgerService implements ILedgerService {
     });
   }
 
+  /**
+   * Look up the view behind a read token
+   *
+   * @throws ReadTokenExpiredError if the token expired or was released
+   */
+  private openView(token: ReadToken): ReadView {
+    const view = this.readViews.get(token.tokenId);
+    if (!view || view.token.expiresAt.getTime() <= Date.now()) {
+      if (view) {
+        void this.releaseRead(token);
+      }
+      throw new ReadTokenExpiredError(token.tokenId);
+    }
+    return view;
+  }
+
+  /**
+   * Generate an entry or transaction ID, prefixed with the region if set
+   * so IDs assigned in different regions never collide
+   */
+  private newId(): string {
+    return this.config.region ? `${this.config.region}:${uuidv4()}` : uuidv4();
+  }
+
+  /**
+   * Run an operation inside a tracer span, ending it with any error
+   * Without a configured tracer the operation runs directly. Query
+   * methods are counted in opStats() here.
+   */
+  private async traced<T>(
+    method: string,
+    attributes: Record<string, string | undefined>,
+    operation: () => Promise<T>
+  ): Promise<T> {
+    if (!WRITE_METHODS.has(method)) {
+      this.opCounters.recordQuery(method);
+    }
+
+    const tracer = this.config.tracer;
+    if (!tracer) {
+      return operation();
+    }
+
+    const spanAttributes: Record<string, string> = { method };
+    for (const [key, value] of Object.entries(attributes)) {
+      if (value !== undefined) {
+        spanAttributes[key] = value;
+      }
+    }
+    if (this.config.tenantId !== undefined) {
+      spanAttributes.tenantId = this.config.tenantId;
+    }
+
+    const end = tracer.startSpan(`ledger.${method}`, spanAttributes);
+    try {
+      const result = await operation();
+      end();
+      return result;
+    } catch (error) {
+      end(error);
+      throw error;
+    }
+  }
+
+  /**
+   * Split a query result into verified entries and failed entry IDs
+   */
+  private verifyResult(result: LedgerQueryResult): VerifiedLedgerQueryResult {
+    const entries: LedgerEntry[] = [];
+    const failedEntryIds: string[] = [];
+
+    for (const entry of result.entries) {
+      if (this.isSignatureValid(entry)) {
+        entries.push(entry);
+      } else {
+        failedEntryIds.push(entry.entryId);
+      }
+    }
+
+    if (failedEntryIds.length > 0) {
+      this.reportInvalidSignatures(failedEntryIds);
+    }
+
+    return { ...result, entries, failedEntryIds };
+  }
+
+  /**
+   * Check an entry's signature against the configured public key
+   */
+  private isSignatureValid(entry: LedgerEntry): boolean {
+    return verifyEntrySignature(entry, this.config.verificationPublicKey!);
+  }
+
+  /**
+   * Record entries that failed signature verification
+   */
+  private reportInvalidSignatures(entryIds: string[]): void {
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_SIGNATURE_INVALID, {
+      count: entryIds.length,
+      entryIds,
+    });
+  }
+
+  /**
+   * Determine the tenant for a write or read
+   * A scoped service stamps its own tenant and rejects any other
+   */
+  private resolveTenant(requested?: string): string | undefined {
+    const scoped = this.config.tenantId;
+
+    if (scoped === undefined) {
+      if (requested !== undefined) {
+        validateTenantId(requested);
+      }
+      return requested;
+    }
+
+    if (requested !== undefined && requested !== scoped) {
+      throw new CrossTenantError(scoped, requested);
+    }
+
+    return scoped;
+  }
+
+  /**
+   * Restrict a query to the active tenant (unchanged in single-tenant mode)
+   */
+  private scopeQuery(query: Record<string, any>, requestedTenant?: string): Record<string, any> {
+    const tenantId = this.resolveTenant(requestedTenant);
+    return tenantId === undefined ? query : { ...query, tenantId: { $eq: tenantId } };
+  }
+
+  /**
+   * Reject a timestamp earlier than the latest entry in scope
+   * Catches clock skew between writers. The check is not atomic with the
+   * insert, so concurrent writers can still interleave within the window.
+   *
+   * @throws TimestampRegressionError if the timestamp goes backwards
+   */
+  private async assertNoTimestampRegression(timestamp: Date, tenantId?: string): Promise<void> {
+    const last = await LedgerEntryModel.findOne(this.scopeQuery({}, tenantId))
+      .sort({ timestamp: -1 })
+      .lean()
+      .exec();
+
+    if (last && timestamp.getTime() < new Date(last.timestamp).getTime()) {
+      throw new TimestampRegressionError(timestamp, new Date(last.timestamp));
+    }
+  }
+
+  /**
+   * Collect configured tag keys present in entry metadata
+   */
+  private extractIndexedTags(metadata?: Record<string, any>): { key: string; value: string }[] {
+    if (!metadata) {
+      return [];
+    }
+
+    return this.config.indexedTagKeys
+      .filter(key => typeof metadata[key] === 'string' || typeof metadata[key] === 'number')
+      .map(key => ({ key, value: String(metadata[key]) }));
+  }
+
+  /**
+   * Resolve a query's account ID to the stored one: tokenize user IDs,
+   * then follow a merged account alias to the surviving account
+   * Only IDs queried as user accounts are tokenized; an unspecified
+   * account type is left as given, so a stored token still matches.
+   *
+   * @throws UserIdRejectedError if the tokenizer rejects a user ID
+   */
+  private async resolveAccountId(accountId: string, accountType?: LedgerAccountType): Promise<string> {
+    if (accountType === 'user') {
+      accountId = await this.tokenizeUserId(accountId);
+    }
+    return this.aliasResolver ? this.aliasResolver.resolveAccountId(accountId) : accountId;
+  }
+
+  /**
+   * accountId condition matching a resolved account's history, which
+   * includes the accounts merged into it
+   */
+  private async historyAccounts(accountId: string): Promise<{ $eq: string } | { $in: string[] }> {
+    const accountIds = await this.historyAccountIds(accountId);
+    return accountIds.length > 1 ? { $in: accountIds } : { $eq: accountId };
+  }
+
+  /**
+   * A resolved account and the accounts merged into it
+   */
+  private async historyAccountIds(accountId: string): Promise<string[]> {
+    const aliases = this.aliasResolver?.aliasesOf ? await this.aliasResolver.aliasesOf(accountId) : [];
+    return [accountId, ...aliases];
+  }
+
+  /**
+   * Apply the configured idempotency key validator
+   *
+   * @throws IdempotencyKeyRejectedError wrapping the validator's error
+   */
+  private assertIdempotencyKeyFormat(key: string): void {
+    if (!this.config.idempotencyKeyValidator) {
+      return;
+    }
+
+    try {
+      this.config.idempotencyKeyValidator(key);
+    } catch (error) {
+      throw new IdempotencyKeyRejectedError(error);
+    }
+  }
+
+  /**
+   * Apply the configured user ID tokenizer
+   *
+   * @throws UserIdRejectedError wrapping the tokenizer's error
+   */
+  private async tokenizeUserId(userId: string): Promise<string> {
+    if (!this.config.userIdTokenizer) {
+      return userId;
+    }
+
+    try {
+      return await this.config.userIdTokenizer(userId);
+    } catch (error) {
+      throw new UserIdRejectedError(error);
+    }
+  }
+
   /**
    * Map database document to domain object
    */
@@ -390,18 +2992,40 @@ export class LedgerService implements ILedgerService {
       balanceAfter: doc.balanceAfter,
       timestamp: doc.timestamp,
       currency: doc.currency,
-      metadata: doc.metadata,
+      metadata: this.config.metadataCipher ? this.config.metadataCipher.open(doc.metadata, doc.entryId) : doc.metadata,
       escrowId: doc.escrowId,
       queueItemId: doc.queueItemId,
       featureType: doc.featureType,
       correlationId: doc.correlationId,
+      groupId: doc.groupId,
+      signature: doc.signature,
+      tenantId: doc.tenantId,
+      idempotencyScope: doc.idempotencyScope,
+      streamVersion: doc.streamVersion,
     };
   }
 }
 
+/**
+ * Create a ledger service scoped to a single tenant
+ * Every write is stamped with the tenant and every read is filtered to it
+ */
+export function createTenantScopedLedgerService(
+  tenantId: string,
+  config: Partial<LedgerConfig> = {},
+  aliasResolver?: IAccountAliasResolver,
+  referenceResolver?: IReferenceAliasResolver
+): ILedgerService {
+  return new LedgerService({ ...config, tenantId }, aliasResolver, referenceResolver);
+}
+
 /**
  * Factory function to create ledger service instance
  */
-export function createLedgerService(config?: Partial<LedgerConfig>): ILedgerService {
-  return new LedgerService(config);
+export function createLedgerService(
+  config?: Partial<LedgerConfig>,
+  aliasResolver?: IAccountAliasResolver,
+  referenceResolver?: IReferenceAliasResolver
+): ILedgerService {
+  return new LedgerService(config, aliasResolver, referenceResolver);
 }
@@ -0,0 +1,138 @@
+/**
+ * Ledger Log Reader Tests
+ */
+
+import { LedgerLogReader } from './log-reader';
+import { IEntryScanStore } from './attestation';
+import { LedgerTail } from './ledger-tail';
+import { ReplayPosition } from './replay';
+import { LedgerEntry } from './types';
+import { WireContentType, decodeFrame } from './wire-format';
+
+describe('LedgerLogReader', () => {
+  let entries: LedgerEntry[];
+  let store: IEntryScanStore;
+  let chunks: Buffer[];
+
+  const entry = (i: number) =>
+    ({ entryId: `entry-${i}`, timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, i)), amount: i, metadata: { z: 1, a: 2 } }) as any;
+
+  const after = (position: ReplayPosition | null) => (e: LedgerEntry) =>
+    !position ||
+    e.timestamp.getTime() > position.timestamp.getTime() ||
+    (e.timestamp.getTime() === position.timestamp.getTime() && e.entryId > position.entryId);
+
+  // Records read so far, decoded from the raw bytes
+  const records = () => {
+    const decoded = [];
+    let data = Buffer.concat(chunks);
+    for (let next = decodeFrame(data); next; next = decodeFrame(data)) {
+      decoded.push(next.frame);
+      data = data.subarray(next.bytes);
+    }
+    return decoded;
+  };
+
+  const ids = () => records().map(frame => JSON.parse(frame.payload.toString('utf8')).entryId);
+
+  const until = async (condition: () => boolean) => {
+    for (let i = 0; i < 200 && !condition(); i++) {
+      await new Promise(resolve => setTimeout(resolve, 5));
+    }
+    expect(condition()).toBe(true);
+  };
+
+  const read = (reader: LedgerLogReader) => {
+    reader.on('data', chunk => chunks.push(chunk));
+    return reader;
+  };
+
+  beforeEach(() => {
+    entries = [0, 1, 2, 3, 4].map(entry);
+    store = { scanEntries: jest.fn(async (position, limit) => entries.filter(after(position)).slice(0, limit)) };
+    chunks = [];
+  });
+
+  it('streams the whole ledger in order as canonical log records', async () => {
+    const reader = read(new LedgerLogReader(store, { pageSize: 2, pollIntervalMs: 60_000 }));
+
+    await until(() => ids().length === 5);
+    reader.destroy();
+
+    expect(ids()).toEqual(['entry-0', 'entry-1', 'entry-2', 'entry-3', 'entry-4']);
+    expect(records().every(frame => frame.contentType === WireContentType.LOG_RECORD)).toBe(true);
+    expect(records()[0].payload.toString('utf8')).toBe(
+      '{"amount":0,"entryId":"entry-0","metadata":{"a":2,"z":1},"timestamp":"2024-01-01T00:00:00.000Z"}'
+    );
+    expect(reader.lastPosition?.entryId).toBe('entry-4');
+  });
+
+  it('makes a new append readable as soon as the tail reports it', async () => {
+    const tail = new LedgerTail();
+    const start = { timestamp: entries[2].timestamp, entryId: 'entry-2' };
+    const reader = read(new LedgerLogReader(store, { tail, after: start, pollIntervalMs: 60_000 }));
+    await until(() => ids().length === 2);
+
+    entries.push(entry(5));
+    tail.afterAppend(entries[5]);
+
+    await until(() => ids().length === 3);
+    reader.destroy();
+    expect(ids()).toEqual(['entry-3', 'entry-4', 'entry-5']);
+  });
+
+  it('picks up appends by polling when no tail is given', async () => {
+    const reader = read(new LedgerLogReader(store, { pollIntervalMs: 10 }));
+    await until(() => ids().length === 5);
+
+    entries.push(entry(5), entry(6));
+
+    await until(() => ids().length === 7);
+    reader.destroy();
+    expect(ids().slice(5)).toEqual(['entry-5', 'entry-6']);
+  });
+
+  it('closes cleanly while waiting for appends', async () => {
+    const tail = new LedgerTail();
+    const errors: Error[] = [];
+    const reader = read(new LedgerLogReader(store, { tail, pollIntervalMs: 60_000 }));
+    reader.on('error', error => errors.push(error));
+    await until(() => ids().length === 5);
+
+    reader.destroy();
+    await until(() => reader.closed);
+    entries.push(entry(5));
+    tail.afterAppend(entries[5]);
+    await new Promise(resolve => setTimeout(resolve, 20));
+
+    expect(errors).toEqual([]);
+    expect(ids()).toHaveLength(5);
+    expect(tail.tailStats()).toEqual([]);
+  });
+
+  it('holds back an entry until it is older than the settle window', async () => {
+    const reader = read(new LedgerLogReader(store, { pollIntervalMs: 10, settleMs: 100 }));
+    await until(() => ids().length === 5);
+
+    entries.push({ ...entry(5), timestamp: new Date() });
+    entries.push({ ...entry(6), timestamp: new Date(Date.now() + 1) });
+    await new Promise(resolve => setTimeout(resolve, 30));
+    expect(ids()).toHaveLength(5);
+
+    await until(() => ids().length === 7);
+    reader.destroy();
+    expect(ids().slice(5)).toEqual(['entry-5', 'entry-6']);
+  });
+
+  it('fails the stream when the store cannot be read', async () => {
+    (store.scanEntries as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    const reader = new LedgerLogReader(store);
+
+    const error = await new Promise<Error>(resolve => {
+      reader.on('error', resolve);
+      reader.resume();
+    });
+
+    expect(error.message).toBe('connection reset');
+  });
+});
@@ -0,0 +1,209 @@
+/**
+ * Ledger Log Reader
+ *
+ * The ordered ledger as a plain byte stream, for log shippers and other
+ * tools that tail a stream rather than call an API. A LedgerLogReader is
+ * a Readable that emits every entry in (timestamp, entryId) order, each
+ * as one LOG_RECORD frame of the ledger wire format (see ./wire-format)
+ * carrying the entry's canonical JSON, then keeps following the ledger:
+ * once it has caught up it waits for new entries instead of ending.
+ *
+ * The scan store is the only source of records, so the stream has no
+ * duplicates. An entry's timestamp is taken before it commits, so an
+ * append still in flight can land behind entries already read; like the
+ * attestor, the reader therefore holds back entries younger than
+ * `settleMs`, and the stream has no gaps as long as every append commits
+ * within it. An append slower than that is missed. A LedgerTail, when
+ * given, only wakes the reader as soon as something is appended; without
+ * one, or for appends made by other processes, the reader polls. Reads
+ * respect backpressure: nothing is scanned while the consumer is behind.
+ *
+ * destroy() closes the reader at any point, including while it waits,
+ * and it closes without an error.
+ */
+
+import { Readable } from 'stream';
+import { ReplayPosition } from './replay';
+import { IEntryScanStore } from './attestation';
+import { LedgerEntry } from './types';
+import { LedgerTail, TailOverflowPolicy, TailSubscription } from './ledger-tail';
+import { WireContentType, encodeFrame } from './wire-format';
+import { canonicalJson } from '../tiering/tiering';
+
+/**
+ * Options for a log reader
+ */
+export interface LogReaderOptions {
+  /** Position to start after (null for the start of the ledger) */
+  after: ReplayPosition | null;
+
+  /** Entries read per scan */
+  pageSize: number;
+
+  /** How long to wait for an append before scanning again, in milliseconds */
+  pollIntervalMs: number;
+
+  /** Tail whose appends wake the reader without waiting for the poll */
+  tail?: LedgerTail;
+
+  /** Entries younger than this are held back until they are, in milliseconds */
+  settleMs: number;
+}
+
+const DEFAULT_OPTIONS: LogReaderOptions = {
+  after: null,
+  pageSize: 500,
+  pollIntervalMs: 1000,
+  settleMs: 5000,
+};
+
+/**
+ * Encode an entry as a log record frame
+ */
+export function encodeLogRecord(entry: LedgerEntry): Buffer {
+  return encodeFrame(WireContentType.LOG_RECORD, Buffer.from(canonicalJson(entry), 'utf8'));
+}
+
+/**
+ * Readable stream of the ordered ledger that follows new appends
+ */
+export class LedgerLogReader extends Readable {
+  private store: IEntryScanStore;
+  private options: LogReaderOptions;
+  private position: ReplayPosition | null;
+  private subscription?: TailSubscription;
+  private pumping = false;
+  private wake: (() => void) | null = null;
+  private appended = false;
+  private pollTimer?: NodeJS.Timeout;
+
+  /**
+   * @throws Error if pageSize is not a positive integer
+   */
+  constructor(store: IEntryScanStore, options: Partial<LogReaderOptions> = {}) {
+    super();
+    this.store = store;
+    this.options = { ...DEFAULT_OPTIONS, ...options };
+    this.position = this.options.after;
+
+    if (!Number.isSafeInteger(this.options.pageSize) || this.options.pageSize < 1) {
+      throw new Error(`pageSize must be a positive integer: ${this.options.pageSize}`);
+    }
+
+    if (this.options.tail) {
+      this.subscription = this.options.tail.tail({ bufferSize: 1, overflow: TailOverflowPolicy.DROP_NEWEST });
+      void this.watch(this.subscription);
+    }
+  }
+
+  /**
+   * Position of the last entry emitted
+   */
+  get lastPosition(): ReplayPosition | null {
+    return this.position;
+  }
+
+  _read(): void {
+    if (!this.pumping) {
+      this.pumping = true;
+      void this.pump();
+    }
+  }
+
+  _destroy(error: Error | null, callback: (error?: Error | null) => void): void {
+    this.subscription?.close();
+    this.wakeUp();
+    callback(error);
+  }
+
+  /**
+   * Scan and push records until the consumer is full, waiting at the end of the ledger
+   */
+  private async pump(): Promise<void> {
+    try {
+      while (!this.destroyed) {
+        this.appended = false;
+        const page = await this.store.scanEntries(this.position, this.options.pageSize);
+        if (this.destroyed) {
+          return;
+        }
+
+        if (page.length === 0) {
+          await this.waitForAppend();
+          continue;
+        }
+
+        const settledBy = Date.now() - this.options.settleMs;
+        let wanted = true;
+        let unsettled: LedgerEntry | undefined;
+        for (const entry of page) {
+          if (new Date(entry.timestamp).getTime() > settledBy) {
+            unsettled = entry;
+            break;
+          }
+          wanted = this.push(encodeLogRecord(entry));
+          this.position = { timestamp: entry.timestamp, entryId: entry.entryId };
+        }
+        if (!wanted) {
+          this.pumping = false;
+          return;
+        }
+        if (unsettled) {
+          await this.wait(new Date(unsettled.timestamp).getTime() + this.options.settleMs - Date.now());
+        }
+      }
+    } catch (error) {
+      this.destroy(error as Error);
+    }
+  }
+
+  /**
+   * Resolve on the next append, the poll interval or close, whichever comes first
+   */
+  private waitForAppend(): Promise<void> {
+    // An append reported during the scan may not be in its results
+    if (this.appended || this.destroyed) {
+      return Promise.resolve();
+    }
+
+    return this.wait(this.options.pollIntervalMs);
+  }
+
+  /**
+   * Resolve after ms, on an append or on close, whichever comes first
+   */
+  private wait(ms: number): Promise<void> {
+    if (this.destroyed) {
+      return Promise.resolve();
+    }
+
+    return new Promise(resolve => {
+      this.wake = resolve;
+      this.pollTimer = setTimeout(() => this.wakeUp(), Math.max(0, ms));
+    });
+  }
+
+  private wakeUp(): void {
+    this.appended = true;
+    clearTimeout(this.pollTimer);
+    const wake = this.wake;
+    this.wake = null;
+    wake?.();
+  }
+
+  /**
+   * Wake the reader for every append the tail reports
+   */
+  private async watch(subscription: TailSubscription): Promise<void> {
+    while (!(await subscription.next()).done) {
+      this.wakeUp();
+    }
+  }
+}
+
+/**
+ * Factory function to create a log reader
+ */
+export function createLogReader(store: IEntryScanStore, options?: Partial<LogReaderOptions>): LedgerLogReader {
+  return new LedgerLogReader(store, options);
+}
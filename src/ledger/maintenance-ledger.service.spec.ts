@@ -0,0 +1,91 @@
+/**
+ * Maintenance Ledger Service Tests
+ */
+
+import { MaintenanceLedgerService, WriteMode } from './maintenance-ledger.service';
+import { ILedgerService, CreateLedgerEntryRequest, LedgerEntry } from './types';
+import { MaintenanceModeError } from '../services/types';
+import { mapServiceError } from '../api/error-mapping';
+
+describe('MaintenanceLedgerService', () => {
+  let inner: jest.Mocked<ILedgerService>;
+  let service: MaintenanceLedgerService;
+
+  const request = { accountId: 'user-123', amount: 100 } as CreateLedgerEntryRequest;
+  const entry = { entryId: 'entry-1' } as LedgerEntry;
+
+  beforeEach(() => {
+    inner = {
+      createEntry: jest.fn().mockResolvedValue(entry),
+      queryEntries: jest.fn().mockResolvedValue({ entries: [], totalCount: 0, offset: 0, limit: 100, hasMore: false }),
+      getEntry: jest.fn().mockResolvedValue(entry),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+    service = new MaintenanceLedgerService(inner);
+  });
+
+  it('should pass writes through in normal mode', async () => {
+    await expect(service.createEntry(request)).resolves.toBe(entry);
+    expect(service.healthCheck().status).toBe('healthy');
+  });
+
+  it('should reject writes but serve reads in read-only mode', async () => {
+    await service.setWriteMode(WriteMode.READ_ONLY, {
+      message: 'Index migration',
+      expectedDurationMs: 90000,
+    });
+
+    const error = await service.createEntry(request).catch(e => e);
+
+    expect(error).toBeInstanceOf(MaintenanceModeError);
+    expect(error.statusCode).toBe(503);
+    expect(error.message).toContain('Index migration');
+    expect(inner.createEntry).not.toHaveBeenCalled();
+    await expect(service.getEntry('entry-1')).resolves.toBe(entry);
+  });
+
+  it('should report the mode through status and health', async () => {
+    await service.setWriteMode(WriteMode.READ_ONLY, { message: 'Index migration' });
+
+    expect(service.getWriteModeStatus()).toMatchObject({
+      mode: WriteMode.READ_ONLY,
+      message: 'Index migration',
+      inFlightWrites: 0,
+    });
+    expect(service.healthCheck().status).toBe('degraded');
+
+    await service.setWriteMode(WriteMode.NORMAL);
+    expect(service.getWriteModeStatus().message).toBeUndefined();
+  });
+
+  it('should wait for in-flight writes when draining', async () => {
+    let finish!: (value: LedgerEntry) => void;
+    inner.createEntry.mockReturnValue(new Promise(resolve => { finish = resolve; }));
+
+    const inFlight = service.createEntry(request);
+    let drained = false;
+    const drain = service.setWriteMode(WriteMode.DRAIN).then(() => { drained = true; });
+
+    await expect(service.createEntry(request)).rejects.toThrow(MaintenanceModeError);
+    await Promise.resolve();
+    expect(drained).toBe(false);
+
+    finish(entry);
+    await expect(inFlight).resolves.toBe(entry);
+    await drain;
+    expect(drained).toBe(true);
+  });
+
+  it('should map to 503 with Retry-After', async () => {
+    await service.setWriteMode(WriteMode.READ_ONLY, { expectedDurationMs: 90500 });
+
+    const response = mapServiceError(await service.createEntry(request).catch(e => e));
+
+    expect(response.statusCode).toBe(503);
+    expect(response.headers['Retry-After']).toBe('91');
+  });
+});
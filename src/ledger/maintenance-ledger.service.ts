@@ -0,0 +1,211 @@
+/**
+ * Maintenance Ledger Service
+ *
+ * Wraps an ILedgerService with a runtime write-mode switch so writes can
+ * be paused during backend migrations while reads stay up:
+ * - NORMAL: all operations pass through
+ * - READ_ONLY: writes fail immediately with MaintenanceModeError
+ * - DRAIN: new writes fail; setWriteMode resolves once in-flight writes
+ *   have finished, so the operator knows the store is quiescent
+ *
+ * The mode, operator message and expected duration change together as a
+ * single state object, so readers never observe a half-applied change.
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import { MaintenanceModeError, ServiceHealth } from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Ledger write modes
+ */
+export enum WriteMode {
+  NORMAL = 'normal',
+  READ_ONLY = 'read_only',
+  DRAIN = 'drain',
+}
+
+/**
+ * Options supplied by the operator when leaving normal mode
+ */
+export interface WriteModeOptions {
+  /** Message returned to rejected writers */
+  message?: string;
+
+  /** Expected duration, surfaced to clients as Retry-After */
+  expectedDurationMs?: number;
+}
+
+/**
+ * Current write mode state
+ */
+export interface WriteModeStatus {
+  mode: WriteMode;
+  message?: string;
+  expectedDurationMs?: number;
+
+  /** When the current mode was entered */
+  since: Date;
+
+  /** Writes currently executing against the inner service */
+  inFlightWrites: number;
+}
+
+/**
+ * MaintenanceLedgerService implementation
+ */
+export class MaintenanceLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private state: Omit<WriteModeStatus, 'inFlightWrites'> = {
+    mode: WriteMode.NORMAL,
+    since: new Date(),
+  };
+  private inFlightWrites = 0;
+  private drainWaiters: (() => void)[] = [];
+
+  constructor(inner: ILedgerService) {
+    this.inner = inner;
+  }
+
+  /**
+   * Switch write mode
+   * In DRAIN mode the returned promise resolves once in-flight writes finish.
+   */
+  async setWriteMode(mode: WriteMode, options: WriteModeOptions = {}): Promise<void> {
+    const previous = this.state.mode;
+    this.state = {
+      mode,
+      message: mode === WriteMode.NORMAL ? undefined : options.message,
+      expectedDurationMs: mode === WriteMode.NORMAL ? undefined : options.expectedDurationMs,
+      since: new Date(),
+    };
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_WRITE_MODE_CHANGED, {
+      from: previous,
+      to: mode,
+      message: options.message,
+      expectedDurationMs: options.expectedDurationMs,
+    });
+
+    if (mode === WriteMode.DRAIN && this.inFlightWrites > 0) {
+      await new Promise<void>(resolve => this.drainWaiters.push(resolve));
+    }
+  }
+
+  /**
+   * Get the current write mode state
+   */
+  getWriteModeStatus(): WriteModeStatus {
+    return { ...this.state, inFlightWrites: this.inFlightWrites };
+  }
+
+  /**
+   * Report degraded health while writes are paused
+   */
+  healthCheck(): ServiceHealth {
+    const status = this.getWriteModeStatus();
+    return {
+      service: 'ledger',
+      status: status.mode === WriteMode.NORMAL ? 'healthy' : 'degraded',
+      message: status.mode === WriteMode.NORMAL ? undefined : status.message,
+      checkedAt: new Date(),
+      metrics: { ...status },
+    };
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return this.write('createEntry', () => this.inner.createEntry(request));
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.inner.queryEntries(filter);
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    return this.inner.getEntry(entryId);
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.inner.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.inner.getAuditTrail(transactionId);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.write('storeIdempotencyResult', () =>
+      this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds)
+    );
+  }
+
+  /**
+   * Run a write if the mode allows it, tracking it as in flight
+   */
+  private async write<T>(operation: string, fn: () => Promise<T>): Promise<T> {
+    const { mode, message, expectedDurationMs } = this.state;
+
+    if (mode !== WriteMode.NORMAL) {
+      MetricsLogger.incrementCounter(MetricEventType.LEDGER_WRITE_REJECTED, { operation, mode });
+      throw new MaintenanceModeError(
+        mode,
+        message || 'Ledger is in maintenance',
+        expectedDurationMs !== undefined ? Math.ceil(expectedDurationMs / 1000) : undefined
+      );
+    }
+
+    this.inFlightWrites++;
+    try {
+      return await fn();
+    } finally {
+      this.inFlightWrites--;
+      if (this.inFlightWrites === 0 && this.drainWaiters.length > 0) {
+        const waiters = this.drainWaiters;
+        this.drainWaiters = [];
+        waiters.forEach(resolve => resolve());
+      }
+    }
+  }
+}
+
+/**
+ * Factory function to create a maintenance ledger service
+ */
+export function createMaintenanceLedgerService(inner: ILedgerService): MaintenanceLedgerService {
+  return new MaintenanceLedgerService(inner);
+}
@@ -0,0 +1,156 @@
+/**
+ * MessagePack Entry Codec Tests
+ */
+
+import {
+  encodeEntryMsgpack,
+  decodeEntryMsgpack,
+  encodeMsgpack,
+  decodeMsgpack,
+  ENTRY_FIELD_NUMBERS,
+  ENTRY_SCHEMA_VERSION,
+} from './msgpack';
+import { LedgerEntry } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('MessagePack entry codec', () => {
+  const entry: LedgerEntry = {
+    entryId: 'entry-1',
+    transactionId: 'txn-1',
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: -250,
+    type: TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: 'available→escrow',
+    reason: TransactionReason.CHIP_MENU_PURCHASE,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 1000,
+    balanceAfter: 750,
+    timestamp: new Date('2024-06-01T12:34:56.789Z'),
+    currency: 'points',
+    escrowId: 'escrow-1',
+    metadata: { source: 'kiosk', nested: { tier: 3, tags: ['a', 'b'] }, ratio: 0.5, flag: true },
+  };
+
+  // Normalise an entry to its JSON form for comparison
+  const asJson = (value: LedgerEntry) => JSON.parse(JSON.stringify(value));
+
+  it('should round-trip an entry to the same JSON form', () => {
+    const decoded = decodeEntryMsgpack(encodeEntryMsgpack(entry));
+
+    expect(asJson(decoded)).toEqual(asJson(entry));
+    expect(decoded.timestamp).toBeInstanceOf(Date);
+  });
+
+  it('should be more compact than JSON', () => {
+    expect(encodeEntryMsgpack(entry).length).toBeLessThan(Buffer.from(JSON.stringify(entry)).length);
+  });
+
+  it('should round-trip entries with only required fields', () => {
+    const minimal: LedgerEntry = { ...entry };
+    delete minimal.escrowId;
+    delete minimal.metadata;
+
+    const decoded = decodeEntryMsgpack(encodeEntryMsgpack(minimal));
+
+    expect(asJson(decoded)).toEqual(asJson(minimal));
+    expect(decoded).not.toHaveProperty('metadata');
+  });
+
+  it('should key fields by number and carry the schema version', () => {
+    const fields = decodeMsgpack(encodeEntryMsgpack(entry)) as Map<number, unknown>;
+
+    expect(fields.get(0)).toBe(ENTRY_SCHEMA_VERSION);
+    expect(fields.get(ENTRY_FIELD_NUMBERS.accountId)).toBe('user-123');
+    expect(fields.has(ENTRY_FIELD_NUMBERS.signature)).toBe(false);
+  });
+
+  it('should skip unknown field numbers from newer writers', () => {
+    const fields = decodeMsgpack(encodeEntryMsgpack(entry)) as Map<number, unknown>;
+    fields.set(999, 'future field');
+
+    expect(asJson(decodeEntryMsgpack(encodeMsgpack(fields)))).toEqual(asJson(entry));
+  });
+
+  it('should reject a newer schema version', () => {
+    const fields = decodeMsgpack(encodeEntryMsgpack(entry)) as Map<number, unknown>;
+    fields.set(0, ENTRY_SCHEMA_VERSION + 1);
+
+    expect(() => decodeEntryMsgpack(encodeMsgpack(fields))).toThrow('Unsupported entry schema version');
+  });
+
+  it('should apply recordEntry validation on decode', () => {
+    const withField = (name: string, value: unknown) => {
+      const fields = decodeMsgpack(encodeEntryMsgpack(entry)) as Map<number, unknown>;
+      fields.set(ENTRY_FIELD_NUMBERS[name], value);
+      return encodeMsgpack(fields);
+    };
+
+    expect(() => decodeEntryMsgpack(withField('type', 'refund'))).toThrow('Invalid transaction type');
+    expect(() => decodeEntryMsgpack(withField('reason', 'free_money'))).toThrow('Invalid transaction reason');
+    expect(() => decodeEntryMsgpack(withField('amount', 1.5))).toThrow('Amount must be a non-zero integer');
+    expect(() => decodeEntryMsgpack(withField('amount', 250))).toThrow('Amount sign does not match');
+    expect(() => decodeEntryMsgpack(withField('accountId', ''))).toThrow('accountId is required');
+    expect(() => decodeEntryMsgpack(withField('timestamp', 'yesterday'))).toThrow('timestamp must be a valid date');
+  });
+
+  it('should reject entries missing required fields', () => {
+    const fields = decodeMsgpack(encodeEntryMsgpack(entry)) as Map<number, unknown>;
+    fields.delete(ENTRY_FIELD_NUMBERS.entryId);
+
+    expect(() => decodeEntryMsgpack(encodeMsgpack(fields))).toThrow('entryId is required');
+  });
+
+  it('should reject malformed messages', () => {
+    const encoded = encodeEntryMsgpack(entry);
+
+    expect(() => decodeEntryMsgpack(encoded.subarray(0, encoded.length - 3))).toThrow('Truncated');
+    expect(() => decodeEntryMsgpack(Buffer.concat([encoded, Buffer.from([0x00])]))).toThrow('Trailing bytes');
+    expect(() => decodeEntryMsgpack(encodeMsgpack(['not', 'a', 'map']))).toThrow('must be a map');
+    expect(() => decodeEntryMsgpack(Buffer.from([0xc1]))).toThrow('Invalid MessagePack type byte');
+  });
+
+  describe('value encoding', () => {
+    it.each([
+      0, 127, 128, 255, 65535, 65536, 2 ** 32, Number.MAX_SAFE_INTEGER,
+      -1, -32, -33, -128, -129, -32768, -32769, -(2 ** 31) - 1, Number.MIN_SAFE_INTEGER,
+    ])('should round-trip integer %d', value => {
+      expect(decodeMsgpack(encodeMsgpack(value))).toBe(value);
+    });
+
+    it('should round-trip strings across length formats', () => {
+      for (const length of [0, 31, 32, 255, 256, 70000]) {
+        const value = 'x'.repeat(length);
+        expect(decodeMsgpack(encodeMsgpack(value))).toBe(value);
+      }
+      expect(decodeMsgpack(encodeMsgpack('→ ünïcode'))).toBe('→ ünïcode');
+    });
+
+    it('should round-trip dates before the epoch', () => {
+      const date = new Date('1969-12-31T23:59:59.123Z');
+      expect(decodeMsgpack(encodeMsgpack(date))).toEqual(date);
+    });
+
+    it('should decode 32 and 64-bit timestamps from other writers', () => {
+      const ts32 = Buffer.from([0xd6, 0xff, 0x66, 0x5b, 0x12, 0x00]);
+      const ts64 = Buffer.alloc(10);
+      ts64[0] = 0xd7;
+      ts64[1] = 0xff;
+      ts64.writeUInt32BE((500_000_000 << 2) >>> 0, 2);
+      ts64.writeUInt32BE(0x665b1200, 6);
+
+      expect(decodeMsgpack(ts32)).toEqual(new Date(0x665b1200 * 1000));
+      expect(decodeMsgpack(ts64)).toEqual(new Date(0x665b1200 * 1000 + 500));
+    });
+
+    it('should reject 64-bit integers outside the safe range', () => {
+      const buf = Buffer.alloc(9);
+      buf[0] = 0xcf;
+      buf.writeBigUInt64BE(2n ** 60n, 1);
+
+      expect(() => decodeMsgpack(buf)).toThrow('exceeds the safe integer range');
+    });
+  });
+});
@@ -0,0 +1,404 @@
+/**
+ * MessagePack Entry Codec
+ *
+ * Compact binary encoding of ledger entries for inter-service transfer,
+ * where JSON grows too large once metadata is attached. An encoded entry
+ * is a MessagePack map keyed by stable field numbers rather than names:
+ *
+ *   - Field numbers are never reused or renumbered; retired fields are
+ *     listed in RESERVED_ENTRY_FIELDS
+ *   - Field 0 carries the schema version; decoders reject newer versions
+ *   - Unknown field numbers from newer writers are skipped on decode
+ *
+ * Decoding applies the same field validation as LedgerService.recordEntry,
+ * so a malformed message cannot introduce an entry the ledger would
+ * refuse. Timestamps use the MessagePack timestamp extension (type -1).
+ */
+
+import { LedgerEntry } from './types';
+import { validateDecodedEntry } from './entry-validation';
+
+/**
+ * Current entry schema version
+ */
+export const ENTRY_SCHEMA_VERSION = 1;
+
+/**
+ * Field numbers of encoded entry fields - append only
+ */
+export const ENTRY_FIELD_NUMBERS: Record<string, number> = {
+  entryId: 1,
+  transactionId: 2,
+  accountId: 3,
+  accountType: 4,
+  amount: 5,
+  type: 6,
+  balanceState: 7,
+  stateTransition: 8,
+  reason: 9,
+  idempotencyKey: 10,
+  requestId: 11,
+  balanceBefore: 12,
+  balanceAfter: 13,
+  timestamp: 14,
+  currency: 15,
+  metadata: 16,
+  escrowId: 17,
+  queueItemId: 18,
+  featureType: 19,
+  correlationId: 20,
+  signature: 21,
+  tenantId: 22,
+  metadataErased: 23,
+};
+
+/**
+ * Field numbers that must never be assigned again
+ */
+export const RESERVED_ENTRY_FIELDS: number[] = [];
+
+const FIELD_NAMES = new Map<number, string>(
+  Object.entries(ENTRY_FIELD_NUMBERS).map(([name, number]) => [number, name])
+);
+
+const TIMESTAMP_EXT = -1;
+
+/**
+ * Encode a ledger entry as MessagePack
+ */
+export function encodeEntryMsgpack(entry: LedgerEntry): Buffer {
+  const fields = new Map<number, unknown>([[0, ENTRY_SCHEMA_VERSION]]);
+
+  for (const [name, number] of Object.entries(ENTRY_FIELD_NUMBERS)) {
+    const value = (entry as any)[name];
+    if (value !== undefined) {
+      fields.set(number, name === 'timestamp' ? new Date(value) : value);
+    }
+  }
+
+  return encodeMsgpack(fields);
+}
+
+/**
+ * Decode and validate a MessagePack ledger entry
+ *
+ * @throws Error if the message is malformed, from a newer schema version,
+ * or describes an invalid entry
+ */
+export function decodeEntryMsgpack(data: Buffer): LedgerEntry {
+  const decoded = decodeMsgpack(data);
+  if (!(decoded instanceof Map)) {
+    throw new Error('Encoded entry must be a map');
+  }
+
+  const version = decoded.get(0);
+  if (typeof version !== 'number' || version < 1) {
+    throw new Error('Encoded entry is missing its schema version');
+  }
+  if (version > ENTRY_SCHEMA_VERSION) {
+    throw new Error(`Unsupported entry schema version: ${version}`);
+  }
+
+  const entry: Record<string, any> = {};
+  for (const [number, value] of decoded) {
+    const name = typeof number === 'number' ? FIELD_NAMES.get(number) : undefined;
+    if (name !== undefined) {
+      entry[name] = value;
+    }
+  }
+
+  if (entry.metadata !== undefined) {
+    entry.metadata = toPlainObject(entry.metadata);
+  }
+
+  const invalid = validateDecodedEntry(entry);
+  if (invalid) {
+    throw new Error(`Invalid encoded entry: ${invalid}`);
+  }
+
+  return entry as LedgerEntry;
+}
+
+/**
+ * Encode a value as MessagePack
+ * Supports null, booleans, numbers, bigints, strings, Buffers, Dates,
+ * arrays, Maps and plain objects.
+ */
+export function encodeMsgpack(value: unknown): Buffer {
+  const chunks: Buffer[] = [];
+  writeValue(value, chunks);
+  return Buffer.concat(chunks);
+}
+
+/**
+ * Decode a MessagePack value
+ * Maps with only string keys decode to Maps as well; callers convert as
+ * needed. 64-bit integers outside the safe range are rejected.
+ */
+export function decodeMsgpack(data: Buffer): unknown {
+  const reader = { data, offset: 0 };
+  const value = readValue(reader);
+  if (reader.offset !== data.length) {
+    throw new Error('Trailing bytes after MessagePack value');
+  }
+  return value;
+}
+
+function writeValue(value: unknown, out: Buffer[]): void {
+  if (value === null || value === undefined) {
+    out.push(Buffer.from([0xc0]));
+  } else if (typeof value === 'boolean') {
+    out.push(Buffer.from([value ? 0xc3 : 0xc2]));
+  } else if (typeof value === 'number') {
+    if (Number.isSafeInteger(value)) {
+      writeInteger(BigInt(value), out);
+    } else {
+      const buf = Buffer.alloc(9);
+      buf[0] = 0xcb;
+      buf.writeDoubleBE(value, 1);
+      out.push(buf);
+    }
+  } else if (typeof value === 'bigint') {
+    writeInteger(value, out);
+  } else if (typeof value === 'string') {
+    const bytes = Buffer.from(value, 'utf8');
+    writeHeader(bytes.length, 0xa0, 31, [0xd9, 0xda, 0xdb], out);
+    out.push(bytes);
+  } else if (Buffer.isBuffer(value)) {
+    writeHeader(value.length, -1, 0, [0xc4, 0xc5, 0xc6], out);
+    out.push(value);
+  } else if (value instanceof Date) {
+    writeTimestamp(value, out);
+  } else if (Array.isArray(value)) {
+    writeHeader(value.length, 0x90, 15, [-1, 0xdc, 0xdd], out);
+    value.forEach(item => writeValue(item, out));
+  } else if (value instanceof Map) {
+    writeHeader(value.size, 0x80, 15, [-1, 0xde, 0xdf], out);
+    for (const [key, item] of value) {
+      writeValue(key, out);
+      writeValue(item, out);
+    }
+  } else if (typeof value === 'object') {
+    const entries = Object.entries(value as Record<string, unknown>).filter(([, v]) => v !== undefined);
+    writeHeader(entries.length, 0x80, 15, [-1, 0xde, 0xdf], out);
+    for (const [key, item] of entries) {
+      writeValue(key, out);
+      writeValue(item, out);
+    }
+  } else {
+    throw new Error(`Cannot encode ${typeof value} as MessagePack`);
+  }
+}
+
+/**
+ * Write a length header: fix format when it fits, else 8/16/32-bit forms
+ * (a -1 marker means the width is unavailable for the type)
+ */
+function writeHeader(length: number, fixBase: number, fixMax: number, codes: number[], out: Buffer[]): void {
+  if (fixBase >= 0 && length <= fixMax) {
+    out.push(Buffer.from([fixBase | length]));
+  } else if (codes[0] >= 0 && length <= 0xff) {
+    out.push(Buffer.from([codes[0], length]));
+  } else if (length <= 0xffff) {
+    const buf = Buffer.alloc(3);
+    buf[0] = codes[1];
+    buf.writeUInt16BE(length, 1);
+    out.push(buf);
+  } else {
+    const buf = Buffer.alloc(5);
+    buf[0] = codes[2];
+    buf.writeUInt32BE(length, 1);
+    out.push(buf);
+  }
+}
+
+function writeInteger(value: bigint, out: Buffer[]): void {
+  if (value >= 0n) {
+    if (value <= 0x7fn) {
+      out.push(Buffer.from([Number(value)]));
+    } else if (value <= 0xffn) {
+      out.push(Buffer.from([0xcc, Number(value)]));
+    } else if (value <= 0xffffn) {
+      const buf = Buffer.alloc(3);
+      buf[0] = 0xcd;
+      buf.writeUInt16BE(Number(value), 1);
+      out.push(buf);
+    } else if (value <= 0xffffffffn) {
+      const buf = Buffer.alloc(5);
+      buf[0] = 0xce;
+      buf.writeUInt32BE(Number(value), 1);
+      out.push(buf);
+    } else {
+      const buf = Buffer.alloc(9);
+      buf[0] = 0xcf;
+      buf.writeBigUInt64BE(value, 1);
+      out.push(buf);
+    }
+  } else if (value >= -32n) {
+    out.push(Buffer.from([Number(value) & 0xff]));
+  } else if (value >= -0x80n) {
+    const buf = Buffer.alloc(2);
+    buf[0] = 0xd0;
+    buf.writeInt8(Number(value), 1);
+    out.push(buf);
+  } else if (value >= -0x8000n) {
+    const buf = Buffer.alloc(3);
+    buf[0] = 0xd1;
+    buf.writeInt16BE(Number(value), 1);
+    out.push(buf);
+  } else if (value >= -0x80000000n) {
+    const buf = Buffer.alloc(5);
+    buf[0] = 0xd2;
+    buf.writeInt32BE(Number(value), 1);
+    out.push(buf);
+  } else {
+    const buf = Buffer.alloc(9);
+    buf[0] = 0xd3;
+    buf.writeBigInt64BE(value, 1);
+    out.push(buf);
+  }
+}
+
+/**
+ * Write a Date as a timestamp 96 extension (nanoseconds + signed seconds)
+ */
+function writeTimestamp(date: Date, out: Buffer[]): void {
+  const ms = date.getTime();
+  const seconds = Math.floor(ms / 1000);
+  const buf = Buffer.alloc(15);
+  buf[0] = 0xc7;
+  buf[1] = 12;
+  buf.writeInt8(TIMESTAMP_EXT, 2);
+  buf.writeUInt32BE((ms - seconds * 1000) * 1000000, 3);
+  buf.writeBigInt64BE(BigInt(seconds), 7);
+  out.push(buf);
+}
+
+interface Reader {
+  data: Buffer;
+  offset: number;
+}
+
+function take(reader: Reader, length: number): Buffer {
+  if (reader.offset + length > reader.data.length) {
+    throw new Error('Truncated MessagePack value');
+  }
+  const slice = reader.data.subarray(reader.offset, reader.offset + length);
+  reader.offset += length;
+  return slice;
+}
+
+function readValue(reader: Reader): unknown {
+  const code = take(reader, 1)[0];
+
+  if (code <= 0x7f) return code;
+  if (code >= 0xe0) return code - 0x100;
+  if ((code & 0xe0) === 0xa0) return take(reader, code & 0x1f).toString('utf8');
+  if ((code & 0xf0) === 0x90) return readArray(reader, code & 0x0f);
+  if ((code & 0xf0) === 0x80) return readMap(reader, code & 0x0f);
+
+  switch (code) {
+    case 0xc0: return null;
+    case 0xc2: return false;
+    case 0xc3: return true;
+    case 0xc4: return Buffer.from(take(reader, take(reader, 1)[0]));
+    case 0xc5: return Buffer.from(take(reader, take(reader, 2).readUInt16BE(0)));
+    case 0xc6: return Buffer.from(take(reader, take(reader, 4).readUInt32BE(0)));
+    case 0xc7: return readExt(reader, take(reader, 1)[0]);
+    case 0xc8: return readExt(reader, take(reader, 2).readUInt16BE(0));
+    case 0xc9: return readExt(reader, take(reader, 4).readUInt32BE(0));
+    case 0xca: return take(reader, 4).readFloatBE(0);
+    case 0xcb: return take(reader, 8).readDoubleBE(0);
+    case 0xcc: return take(reader, 1)[0];
+    case 0xcd: return take(reader, 2).readUInt16BE(0);
+    case 0xce: return take(reader, 4).readUInt32BE(0);
+    case 0xcf: return toSafeInteger(take(reader, 8).readBigUInt64BE(0));
+    case 0xd0: return take(reader, 1).readInt8(0);
+    case 0xd1: return take(reader, 2).readInt16BE(0);
+    case 0xd2: return take(reader, 4).readInt32BE(0);
+    case 0xd3: return toSafeInteger(take(reader, 8).readBigInt64BE(0));
+    case 0xd4: return readExt(reader, 1);
+    case 0xd5: return readExt(reader, 2);
+    case 0xd6: return readExt(reader, 4);
+    case 0xd7: return readExt(reader, 8);
+    case 0xd8: return readExt(reader, 16);
+    case 0xd9: return take(reader, take(reader, 1)[0]).toString('utf8');
+    case 0xda: return take(reader, take(reader, 2).readUInt16BE(0)).toString('utf8');
+    case 0xdb: return take(reader, take(reader, 4).readUInt32BE(0)).toString('utf8');
+    case 0xdc: return readArray(reader, take(reader, 2).readUInt16BE(0));
+    case 0xdd: return readArray(reader, take(reader, 4).readUInt32BE(0));
+    case 0xde: return readMap(reader, take(reader, 2).readUInt16BE(0));
+    case 0xdf: return readMap(reader, take(reader, 4).readUInt32BE(0));
+    default:
+      throw new Error(`Invalid MessagePack type byte 0x${code.toString(16)}`);
+  }
+}
+
+function readArray(reader: Reader, length: number): unknown[] {
+  const items: unknown[] = [];
+  for (let i = 0; i < length; i++) {
+    items.push(readValue(reader));
+  }
+  return items;
+}
+
+function readMap(reader: Reader, size: number): Map<unknown, unknown> {
+  const map = new Map<unknown, unknown>();
+  for (let i = 0; i < size; i++) {
+    const key = readValue(reader);
+    map.set(key, readValue(reader));
+  }
+  return map;
+}
+
+function readExt(reader: Reader, length: number): Date {
+  const type = take(reader, 1).readInt8(0);
+  const body = take(reader, length);
+
+  if (type !== TIMESTAMP_EXT) {
+    throw new Error(`Unsupported MessagePack extension type ${type}`);
+  }
+
+  if (length === 4) {
+    return new Date(body.readUInt32BE(0) * 1000);
+  }
+  if (length === 8) {
+    const nanoseconds = body.readUInt32BE(0) >>> 2;
+    const seconds = (body.readUInt32BE(0) & 0x03) * 0x100000000 + body.readUInt32BE(4);
+    return new Date(seconds * 1000 + Math.floor(nanoseconds / 1000000));
+  }
+  if (length === 12) {
+    const nanoseconds = body.readUInt32BE(0);
+    const seconds = Number(body.readBigInt64BE(4));
+    return new Date(seconds * 1000 + Math.floor(nanoseconds / 1000000));
+  }
+
+  throw new Error(`Invalid MessagePack timestamp length ${length}`);
+}
+
+function toSafeInteger(value: bigint): number {
+  if (value > BigInt(Number.MAX_SAFE_INTEGER) || value < BigInt(Number.MIN_SAFE_INTEGER)) {
+    throw new Error(`MessagePack integer ${value} exceeds the safe integer range`);
+  }
+  return Number(value);
+}
+
+/**
+ * Convert decoded Maps with string keys back into plain objects
+ */
+function toPlainObject(value: unknown): any {
+  if (value instanceof Map) {
+    const result: Record<string, any> = {};
+    for (const [key, item] of value) {
+      if (typeof key !== 'string') {
+        throw new Error('Metadata keys must be strings');
+      }
+      result[key] = toPlainObject(item);
+    }
+    return result;
+  }
+  if (Array.isArray(value)) {
+    return value.map(toPlainObject);
+  }
+  return value;
+}
@@ -0,0 +1,65 @@
+/**
+ * Ledger Operation Counters
+ *
+ * Built-in cumulative counts of what a ledger service has done, for a
+ * quick look at ledger activity where no metrics stack is wired up.
+ * Each LedgerService instance owns one set, read via opStats(). Counts
+ * are plain increments on the event loop, so no update is lost or torn.
+ *
+ * The counters only grow; resetOpStats() from the testing utilities is
+ * the one way to clear them.
+ */
+
+import { OpCounters } from './types';
+
+/**
+ * Mutable counters behind LedgerService.opStats()
+ */
+export class OpCounterSet {
+  private appendsSucceeded = 0;
+  private appendsFailed = new Map<string, number>();
+  private queries = new Map<string, number>();
+
+  recordAppend(failure?: string): void {
+    if (failure === undefined) {
+      this.appendsSucceeded++;
+    } else {
+      this.appendsFailed.set(failure, (this.appendsFailed.get(failure) || 0) + 1);
+    }
+  }
+
+  recordQuery(method: string): void {
+    this.queries.set(method, (this.queries.get(method) || 0) + 1);
+  }
+
+  /**
+   * Copy of the current counts; later operations do not change it
+   */
+  snapshot(): OpCounters {
+    return {
+      appendsSucceeded: this.appendsSucceeded,
+      appendsFailed: Object.fromEntries(this.appendsFailed),
+      queries: Object.fromEntries(this.queries),
+    };
+  }
+
+  reset(): void {
+    this.appendsSucceeded = 0;
+    this.appendsFailed.clear();
+    this.queries.clear();
+  }
+}
+
+const owners = new WeakMap<object, OpCounterSet>();
+
+/**
+ * The counter set belonging to a service, created on first use
+ */
+export function opCountersOf(owner: object): OpCounterSet {
+  let counters = owners.get(owner);
+  if (!counters) {
+    counters = new OpCounterSet();
+    owners.set(owner, counters);
+  }
+  return counters;
+}
@@ -0,0 +1,199 @@
+/**
+ * Ledger Outbox Tests
+ */
+
+import { OutboxStore } from './outbox';
+import { LedgerService } from './ledger.service';
+import { CreateLedgerEntryRequest } from './types';
+import { OutboxRecordModel } from '../db/models/outbox-record.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/outbox-record.model');
+jest.mock('../db/models/ledger-entry.model');
+
+describe('Ledger outbox', () => {
+  // In-memory ledger_outbox and ledger_entries collections
+  let records: any[];
+  let entries: any[];
+  let service: LedgerService;
+  let now: number;
+
+  const request = (idempotencyKey: string): CreateLedgerEntryRequest => ({
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey,
+    requestId: `req-${idempotencyKey}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+  });
+
+  // Query chain resolving to the docs read when it is executed
+  const chainOf = (docs: () => any) => {
+    const chain: any = { exec: jest.fn().mockImplementation(async () => docs()) };
+    chain.sort = jest.fn().mockReturnValue(chain);
+    chain.limit = jest.fn().mockReturnValue(chain);
+    chain.lean = jest.fn().mockReturnValue(chain);
+    return chain;
+  };
+
+  // Unpublished records in staging order, after the query's cursor if it has one
+  const pendingFor = (query: any) => {
+    const after = query.$or?.[1];
+    return records
+      .filter(r => !r.publishedAt && (!query.outboxId || query.outboxId.$in.includes(r.outboxId)))
+      .filter(r => !after || r.stagedAt > after.stagedAt.$eq || (+r.stagedAt === +after.stagedAt.$eq && r.outboxId > after.outboxId.$gt))
+      .sort((a, b) => a.stagedAt - b.stagedAt || (a.outboxId < b.outboxId ? -1 : 1));
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    now = Date.UTC(2024, 0, 1);
+    jest.spyOn(Date, 'now').mockImplementation(() => now);
+    records = [];
+    entries = [];
+
+    (OutboxRecordModel.updateOne as jest.Mock).mockImplementation(async (filter: any, update: any) => {
+      if (records.some(r => r.idempotencyKey === filter.idempotencyKey.$eq)) {
+        return { upsertedCount: 0 };
+      }
+      // Staged a millisecond apart so the staging order is the append order
+      records.push({ ...update.$setOnInsert, stagedAt: new Date(now + records.length) });
+      return { upsertedCount: 1 };
+    });
+    (OutboxRecordModel.deleteOne as jest.Mock).mockImplementation(async (filter: any) => {
+      records = records.filter(r => r.publishedAt || r.outboxId !== filter.outboxId.$eq);
+    });
+    (OutboxRecordModel.find as jest.Mock).mockImplementation((query: any) => {
+      let limit = Infinity;
+      const chain = chainOf(() => pendingFor(query).slice(0, limit));
+      chain.limit.mockImplementation((n: number) => {
+        limit = n;
+        return chain;
+      });
+      return chain;
+    });
+    (OutboxRecordModel.updateMany as jest.Mock).mockImplementation(async (filter: any, update: any) => {
+      pendingFor(filter).forEach(r => (r.publishedAt = update.$set.publishedAt));
+    });
+    (OutboxRecordModel.deleteMany as jest.Mock).mockImplementation(async (filter: any) => {
+      const discarded = pendingFor(filter);
+      records = records.filter(r => !discarded.includes(r));
+    });
+
+    (LedgerEntryModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (entries.some(e => e.idempotencyKey === doc.idempotencyKey)) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000, keyPattern: { idempotencyKey: 1 } });
+      }
+      entries.push(doc);
+      return doc;
+    });
+    (LedgerEntryModel.findOne as jest.Mock).mockImplementation((query: any) =>
+      chainOf(() => entries.find(e => e.idempotencyKey === query.idempotencyKey.$eq) ?? null)
+    );
+    (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) =>
+      chainOf(() => entries.filter(e => query.idempotencyKey.$in.includes(e.idempotencyKey)))
+    );
+
+    service = new LedgerService({ outbox: new OutboxStore({ abandonAfterMs: 60000 }) });
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should yield an outbox entry for every committed append', async () => {
+    const first = await service.createEntry(request('earn-1'));
+    const second = await service.createEntry(request('earn-2'));
+
+    const polled = await service.pollOutbox(10);
+
+    expect(polled.map(item => item.entry.entryId)).toEqual([first.entryId, second.entryId]);
+    expect(records).toHaveLength(2);
+  });
+
+  it('should yield the entry when the append reports a failure after committing', async () => {
+    (LedgerEntryModel.create as jest.Mock).mockImplementationOnce(async (doc: any) => {
+      entries.push(doc);
+      throw new Error('connection reset');
+    });
+
+    await expect(service.createEntry(request('earn-1'))).rejects.toThrow();
+    now += 120000;
+
+    const polled = await service.pollOutbox(10);
+    expect(polled.map(item => item.entry.idempotencyKey)).toEqual(['earn-1']);
+  });
+
+  it('should keep the record of an append still in flight and discard it once abandoned', async () => {
+    (LedgerEntryModel.create as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.createEntry(request('earn-1'))).rejects.toThrow();
+
+    await expect(service.pollOutbox(10)).resolves.toEqual([]);
+    expect(records).toHaveLength(1);
+
+    now += 120000;
+    await expect(service.pollOutbox(10)).resolves.toEqual([]);
+    expect(records).toHaveLength(0);
+  });
+
+  it('should page past appends still in flight to the committed ones behind them', async () => {
+    (LedgerEntryModel.create as jest.Mock)
+      .mockRejectedValueOnce(new Error('connection reset'))
+      .mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.createEntry(request('earn-1'))).rejects.toThrow();
+    await expect(service.createEntry(request('earn-2'))).rejects.toThrow();
+    await service.createEntry(request('earn-3'));
+    await service.createEntry(request('earn-4'));
+
+    const polled = await service.pollOutbox(2);
+
+    expect(polled.map(item => item.entry.idempotencyKey)).toEqual(['earn-3', 'earn-4']);
+    expect(records).toHaveLength(4);
+  });
+
+  it('should stage a replayed append once', async () => {
+    await service.createEntry(request('earn-1'));
+    await service.createEntry(request('earn-1'));
+
+    await expect(service.pollOutbox(10)).resolves.toHaveLength(1);
+  });
+
+  it('should not republish a replay whose record was published and expired', async () => {
+    await service.createEntry(request('earn-1'));
+    records = [];
+
+    await service.createEntry(request('earn-1'));
+
+    await expect(service.pollOutbox(10)).resolves.toEqual([]);
+    expect(records).toHaveLength(0);
+    expect(OutboxRecordModel.deleteOne).toHaveBeenCalledWith({
+      outboxId: { $eq: expect.any(String) },
+      publishedAt: { $exists: false },
+    });
+  });
+
+  it('should stop returning only the acknowledged entries', async () => {
+    for (const key of ['earn-1', 'earn-2', 'earn-3']) {
+      await service.createEntry(request(key));
+    }
+    const polled = await service.pollOutbox(2);
+    expect(polled).toHaveLength(2);
+
+    await service.markPublished([polled[0].outboxId]);
+
+    const remaining = await service.pollOutbox(10);
+    expect(remaining.map(item => item.entry.idempotencyKey)).toEqual(['earn-2', 'earn-3']);
+  });
+
+  it('should require a configured outbox', async () => {
+    await expect(new LedgerService().pollOutbox(10)).rejects.toThrow('outbox is required');
+  });
+});
@@ -0,0 +1,146 @@
+/**
+ * Ledger Outbox
+ *
+ * Transactional outbox for publishing ledger events (e.g. to Kafka)
+ * without losing one to a crash between the commit and the publish.
+ * Plug an OutboxStore in as LedgerConfig.outbox: every append stages a
+ * record under its idempotency key before the entry is inserted, and a
+ * relay reads committed entries back with LedgerService.pollOutbox(),
+ * publishes them, and acknowledges them with markPublished().
+ *
+ * The store has no multi-document transactions, so the record is written
+ * first and the entry is the proof of commit: pollOutbox only returns
+ * records whose entry is in the ledger. A record whose append never
+ * committed is discarded once it is older than abandonAfterMs. Records
+ * live in ledger_outbox, so unpublished ones survive restarts; delivery
+ * is at least once, and consumers dedupe on the entry ID.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { LedgerOutbox, OutboxCursor, OutboxKey, OutboxRecord } from './types';
+import { OutboxRecordModel } from '../db/models/outbox-record.model';
+
+/**
+ * Configuration for the outbox store
+ */
+export interface OutboxStoreConfig {
+  /** Age after which a record with no committed entry is discarded */
+  abandonAfterMs: number;
+}
+
+const DEFAULT_CONFIG: OutboxStoreConfig = {
+  abandonAfterMs: 10 * 60 * 1000,
+};
+
+/**
+ * Outbox Store Implementation
+ */
+export class OutboxStore implements LedgerOutbox {
+  private config: OutboxStoreConfig;
+
+  /**
+   * @throws Error if abandonAfterMs is not positive
+   */
+  constructor(config: Partial<OutboxStoreConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+
+    if (!Number.isFinite(this.config.abandonAfterMs) || this.config.abandonAfterMs <= 0) {
+      throw new Error(`abandonAfterMs must be positive: ${this.config.abandonAfterMs}`);
+    }
+  }
+
+  get abandonAfterMs(): number {
+    return this.config.abandonAfterMs;
+  }
+
+  async stage(key: OutboxKey): Promise<string | null> {
+    const outboxId = uuidv4();
+    try {
+      const result = await OutboxRecordModel.updateOne(
+        this.keyQuery(key),
+        {
+          $setOnInsert: {
+            outboxId,
+            idempotencyKey: key.idempotencyKey,
+            ...(key.idempotencyScope && { idempotencyScope: key.idempotencyScope }),
+            ...(key.tenantId !== undefined && { tenantId: key.tenantId }),
+            stagedAt: new Date(),
+          },
+        },
+        { upsert: true }
+      );
+      return result.upsertedCount === 1 ? outboxId : null;
+    } catch (error: any) {
+      // A concurrent append with the same key staged it first
+      if (error.code === 11000) {
+        return null;
+      }
+      throw error;
+    }
+  }
+
+  async unstage(outboxId: string): Promise<void> {
+    await OutboxRecordModel.deleteOne({ outboxId: { $eq: outboxId }, publishedAt: { $exists: false } });
+  }
+
+  async pending(limit: number, tenantId?: string, after?: OutboxCursor): Promise<OutboxRecord[]> {
+    const query: Record<string, any> = { publishedAt: { $exists: false } };
+    if (tenantId !== undefined) {
+      query.tenantId = { $eq: tenantId };
+    }
+    if (after) {
+      query.$or = [
+        { stagedAt: { $gt: after.stagedAt } },
+        { stagedAt: { $eq: after.stagedAt }, outboxId: { $gt: after.outboxId } },
+      ];
+    }
+
+    const docs = await OutboxRecordModel.find(query)
+      .sort({ stagedAt: 1, outboxId: 1 })
+      .limit(limit)
+      .lean()
+      .exec();
+
+    return docs.map((doc: any) => ({
+      outboxId: doc.outboxId,
+      idempotencyKey: doc.idempotencyKey,
+      idempotencyScope: doc.idempotencyScope,
+      tenantId: doc.tenantId,
+      stagedAt: doc.stagedAt,
+    }));
+  }
+
+  async markPublished(outboxIds: string[]): Promise<void> {
+    if (outboxIds.length === 0) {
+      return;
+    }
+
+    await OutboxRecordModel.updateMany(
+      { outboxId: { $in: outboxIds }, publishedAt: { $exists: false } },
+      { $set: { publishedAt: new Date() } }
+    );
+  }
+
+  async discard(outboxIds: string[]): Promise<void> {
+    if (outboxIds.length === 0) {
+      return;
+    }
+
+    await OutboxRecordModel.deleteMany({ outboxId: { $in: outboxIds }, publishedAt: { $exists: false } });
+  }
+
+  private keyQuery(key: OutboxKey): Record<string, any> {
+    return {
+      tenantId: key.tenantId !== undefined ? { $eq: key.tenantId } : { $exists: false },
+      idempotencyKey: { $eq: key.idempotencyKey },
+      idempotencyScope: key.idempotencyScope ? { $eq: key.idempotencyScope } : { $exists: false },
+    };
+  }
+}
+
+/**
+ * Factory function to create an outbox store
+ */
+export function createOutboxStore(config?: Partial<OutboxStoreConfig>): OutboxStore {
+  return new OutboxStore(config);
+}
@@ -0,0 +1,198 @@
+/**
+ * Posting Engine Tests
+ */
+
+import { PostingEngine } from './posting-engine';
+import { CreateLedgerEntryRequest, LedgerEntry } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { LedgerModeModel } from '../db/models/ledger-mode.model';
+import { SystemAccountModel } from '../db/models/system-account.model';
+import { LedgerInconsistencyError, LedgerModeMismatchError } from '../services/types';
+
+// Mock mongoose models
+jest.mock('../db/models/ledger-entry.model');
+jest.mock('../db/models/ledger-mode.model');
+jest.mock('../db/models/system-account.model');
+
+describe('PostingEngine', () => {
+  let mockLedgerService: { createEntry: jest.Mock; createEntryWithResult: jest.Mock };
+  let systemBalance: number;
+
+  const request: CreateLedgerEntryRequest = {
+    transactionId: 'txn-1',
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 100,
+  };
+
+  const mockMode = (mode: string) => {
+    (LedgerModeModel.findOneAndUpdate as jest.Mock).mockResolvedValue({ key: 'entry_mode', mode });
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    systemBalance = 0;
+    mockLedgerService = {
+      createEntry: jest.fn().mockImplementation(async (req: CreateLedgerEntryRequest) => ({
+        ...req,
+        entryId: `entry-${req.idempotencyKey}`,
+        timestamp: new Date(),
+      } as LedgerEntry)),
+    } as any;
+
+    // Unique idempotency key index: the first append of a key wins
+    const appended = new Map<string, LedgerEntry>();
+    mockLedgerService.createEntryWithResult = jest.fn().mockImplementation(async (req: CreateLedgerEntryRequest) => {
+      const existing = appended.get(req.idempotencyKey);
+      if (existing) {
+        return { entry: existing, inserted: false };
+      }
+      const entry = { ...req, entryId: `entry-${req.idempotencyKey}`, timestamp: new Date() } as LedgerEntry;
+      appended.set(req.idempotencyKey, entry);
+      return { entry, inserted: true };
+    });
+
+    (SystemAccountModel.findOne as jest.Mock).mockImplementation(() => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => ({ balance: systemBalance })),
+    }));
+    (SystemAccountModel.findOneAndUpdate as jest.Mock).mockImplementation(
+      async (_query: any, update: any) => {
+        systemBalance += update.$inc.balance;
+        return { balance: systemBalance };
+      }
+    );
+  });
+
+  it('should write only the user leg in single-entry mode', async () => {
+    mockMode('single');
+    const engine = new PostingEngine(mockLedgerService as any);
+
+    const result = await engine.post(request);
+
+    expect(result.systemEntry).toBeUndefined();
+    expect(mockLedgerService.createEntry).toHaveBeenCalledTimes(1);
+  });
+
+  it('should mirror a credit against the issuance account', async () => {
+    mockMode('double');
+    const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+    const { entry, systemEntry } = await engine.post(request);
+
+    expect(systemEntry).toMatchObject({
+      accountId: 'points_issuance',
+      accountType: 'system',
+      amount: -100,
+      type: TransactionType.DEBIT,
+      transactionId: entry.transactionId,
+      correlationId: entry.correlationId,
+      balanceBefore: 0,
+      balanceAfter: -100,
+      idempotencyKey: 'idem-1_system',
+    });
+    expect(systemEntry?.metadata?.parentEntryId).toBe(entry.entryId);
+    expect(entry.amount + systemEntry!.amount).toBe(0);
+  });
+
+  it('should mirror a debit against the redemption account', async () => {
+    mockMode('double');
+    const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+    const { systemEntry } = await engine.post({
+      ...request,
+      amount: -40,
+      type: TransactionType.DEBIT,
+      reason: TransactionReason.CHIP_MENU_PURCHASE,
+      idempotencyKey: 'idem-2',
+    });
+
+    expect(systemEntry).toMatchObject({
+      accountId: 'points_redemption',
+      amount: 40,
+      type: TransactionType.CREDIT,
+    });
+  });
+
+  it('should not write a second system leg or move the account on retry', async () => {
+    mockMode('double');
+    const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+    const first = await engine.post(request);
+
+    const { systemEntry } = await engine.post(request);
+
+    expect(systemEntry).toEqual(first.systemEntry);
+    expect(SystemAccountModel.findOneAndUpdate).toHaveBeenCalledTimes(1);
+    expect(systemBalance).toBe(-100);
+  });
+
+  it('should leave the system account untouched when the system leg fails', async () => {
+    mockMode('double');
+    mockLedgerService.createEntryWithResult.mockRejectedValueOnce(new Error('connection reset'));
+    const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+    await expect(engine.post(request)).rejects.toThrow('connection reset');
+
+    expect(SystemAccountModel.findOneAndUpdate).not.toHaveBeenCalled();
+    expect(systemBalance).toBe(0);
+  });
+
+  it('should reject posting to a ledger initialised in the other mode', async () => {
+    mockMode('single');
+    const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+    await expect(engine.post(request)).rejects.toThrow(LedgerModeMismatchError);
+    expect(mockLedgerService.createEntry).not.toHaveBeenCalled();
+  });
+
+  it('should reject direct postings to system accounts', async () => {
+    const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+    await expect(
+      engine.post({ ...request, accountId: 'points_issuance', accountType: 'system' })
+    ).rejects.toThrow('System accounts are posted to only as counterparties');
+  });
+
+  describe('verifyZeroSum', () => {
+    it('should pass when all amounts sum to zero', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([{ _id: null, total: 0 }]),
+      });
+      const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+      await expect(engine.verifyZeroSum()).resolves.toBeUndefined();
+    });
+
+    it('should fail when the ledger does not balance', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([{ _id: null, total: 25 }]),
+      });
+      const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+      await expect(engine.verifyZeroSum()).rejects.toThrow(LedgerInconsistencyError);
+    });
+
+    it('should sum only the given tenant\'s entries', async () => {
+      (LedgerEntryModel.aggregate as jest.Mock).mockReturnValue({
+        exec: jest.fn().mockResolvedValue([{ _id: null, total: 0 }]),
+      });
+      const engine = new PostingEngine(mockLedgerService as any, { mode: 'double' });
+
+      await engine.verifyZeroSum('tenant-a');
+
+      expect(LedgerEntryModel.aggregate).toHaveBeenCalledWith([
+        { $match: { tenantId: { $eq: 'tenant-a' } } },
+        { $group: { _id: null, total: { $sum: '$amount' } } },
+      ]);
+    });
+  });
+});
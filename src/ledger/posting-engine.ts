@@ -0,0 +1,215 @@
+/**
+ * Posting Engine
+ *
+ * Writes ledger postings in single-entry or double-entry mode. In
+ * double-entry mode every user or model leg is mirrored by a system leg
+ * of equal and opposite amount, so the ledger sums to exactly zero like
+ * a conventional double-entry book:
+ * - Credits are issued from a system issuance account
+ * - Debits are returned to a system redemption account
+ *
+ * Both legs share the transaction and correlation IDs; the system leg
+ * records the user leg's entry ID as its parentEntryId. Retrying a
+ * posting is safe: both legs are deduplicated by idempotency key, and the
+ * system account balance moves only when its leg is inserted. The system
+ * leg's balanceBefore is read before the append, so concurrent postings
+ * against one system account may record overlapping balances; the
+ * account's own balance is always exact.
+ *
+ * The mode is fixed when the engine is constructed and recorded on first
+ * posting. A ledger initialised in one mode rejects postings in the
+ * other. In double-entry deployments all writes must go through the
+ * engine.
+ */
+
+import { LedgerEntry, CreateLedgerEntryRequest } from './types';
+import { LedgerService } from './ledger.service';
+import { TransactionType } from '../wallets/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { LedgerModeModel } from '../db/models/ledger-mode.model';
+import { SystemAccountModel } from '../db/models/system-account.model';
+import { LedgerInconsistencyError, LedgerModeMismatchError } from '../services/types';
+
+/**
+ * Ledger entry mode
+ */
+export type PostingMode = 'single' | 'double';
+
+/**
+ * Configuration for the posting engine
+ */
+export interface PostingEngineConfig {
+  /** Entry mode (single-entry is the default) */
+  mode: PostingMode;
+
+  /** System account credited legs are issued from */
+  issuanceAccountId: string;
+
+  /** System account debited legs are returned to */
+  redemptionAccountId: string;
+}
+
+const DEFAULT_CONFIG: PostingEngineConfig = {
+  mode: 'single',
+  issuanceAccountId: 'points_issuance',
+  redemptionAccountId: 'points_redemption',
+};
+
+/**
+ * Key of the ledger mode marker record
+ */
+const MODE_KEY = 'entry_mode';
+
+/**
+ * Result of a posting
+ */
+export interface PostingResult {
+  /** User or model leg */
+  entry: LedgerEntry;
+
+  /** System leg (double-entry mode only) */
+  systemEntry?: LedgerEntry;
+}
+
+type PostingLedger = Pick<LedgerService, 'createEntry' | 'createEntryWithResult'>;
+
+/**
+ * PostingEngine implementation
+ */
+export class PostingEngine {
+  private config: PostingEngineConfig;
+  private ledgerService: PostingLedger;
+  private modeChecked = false;
+
+  constructor(ledgerService: PostingLedger, config: Partial<PostingEngineConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Post an entry, mirroring it against a system account in double-entry mode
+   * @throws LedgerModeMismatchError if the ledger was initialised in the other mode
+   */
+  async post(request: CreateLedgerEntryRequest): Promise<PostingResult> {
+    if (request.accountType === 'system') {
+      throw new Error('System accounts are posted to only as counterparties');
+    }
+
+    await this.ensureMode();
+
+    if (this.config.mode === 'single') {
+      return { entry: await this.ledgerService.createEntry(request) };
+    }
+
+    // Deterministic so a retried posting links to the same reference
+    const correlationId = request.correlationId || `posting-${request.idempotencyKey}`;
+    const entry = await this.ledgerService.createEntry({ ...request, correlationId });
+    const isCredit = request.type === TransactionType.CREDIT;
+    const systemAccountId = isCredit
+      ? this.config.issuanceAccountId
+      : this.config.redemptionAccountId;
+    const amount = -entry.amount;
+
+    const account = await SystemAccountModel.findOne({
+      accountId: { $eq: systemAccountId },
+    }).lean().exec();
+    const balanceBefore = account ? account.balance : 0;
+
+    const { entry: systemEntry, inserted } = await this.ledgerService.createEntryWithResult({
+      transactionId: entry.transactionId,
+      accountId: systemAccountId,
+      accountType: 'system',
+      amount,
+      type: isCredit ? TransactionType.DEBIT : TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: isCredit ? 'available→none' : 'none→available',
+      reason: request.reason,
+      idempotencyKey: `${request.idempotencyKey}_system`,
+      requestId: request.requestId,
+      balanceBefore,
+      balanceAfter: balanceBefore + amount,
+      currency: request.currency,
+      correlationId,
+      tenantId: request.tenantId,
+      metadata: {
+        parentEntryId: entry.entryId,
+        counterpartyAccountId: request.accountId,
+      },
+    });
+
+    // A replayed leg already moved the account
+    if (inserted) {
+      const updated = await SystemAccountModel.findOneAndUpdate(
+        { accountId: { $eq: systemAccountId } },
+        { $inc: { balance: amount } },
+        { new: true, upsert: true }
+      );
+
+      if (!updated) {
+        throw new Error(`Failed to update system account: ${systemAccountId}`);
+      }
+    }
+
+    return { entry, systemEntry };
+  }
+
+  /**
+   * Assert the sum of every ledger amount is exactly zero
+   * Every posting carries its tenant on both legs, so each tenant's
+   * entries balance on their own; pass tenantId to check one tenant.
+   *
+   * @throws LedgerInconsistencyError if the ledger does not balance
+   */
+  async verifyZeroSum(tenantId?: string): Promise<void> {
+    if (this.config.mode !== 'double') {
+      throw new Error('verifyZeroSum requires double-entry mode');
+    }
+
+    const pipeline: any[] = [{ $group: { _id: null, total: { $sum: '$amount' } } }];
+    if (tenantId) {
+      pipeline.unshift({ $match: { tenantId: { $eq: tenantId } } });
+    }
+
+    const [row] = await LedgerEntryModel.aggregate(pipeline).exec();
+    const total = row ? row.total : 0;
+
+    if (total !== 0) {
+      throw new LedgerInconsistencyError('Double-entry ledger does not sum to zero', { total, tenantId });
+    }
+  }
+
+  /**
+   * Record the engine's mode on first use and reject a mismatch
+   */
+  private async ensureMode(): Promise<void> {
+    if (this.modeChecked) {
+      return;
+    }
+
+    const marker = await LedgerModeModel.findOneAndUpdate(
+      { key: { $eq: MODE_KEY } },
+      { $setOnInsert: { key: MODE_KEY, mode: this.config.mode } },
+      { new: true, upsert: true }
+    );
+
+    if (!marker) {
+      throw new Error('Failed to record ledger mode');
+    }
+
+    if (marker.mode !== this.config.mode) {
+      throw new LedgerModeMismatchError(this.config.mode, marker.mode);
+    }
+
+    this.modeChecked = true;
+  }
+}
+
+/**
+ * Factory function to create a posting engine
+ */
+export function createPostingEngine(
+  ledgerService: PostingLedger,
+  config?: Partial<PostingEngineConfig>
+): PostingEngine {
+  return new PostingEngine(ledgerService, config);
+}
@@ -0,0 +1,339 @@
+/**
+ * Quorum Ledger Service Tests
+ */
+
+import { QuorumLedgerService } from './quorum-ledger.service';
+import { ILedgerService, LedgerEntry, CreateLedgerEntryRequest } from './types';
+import { TransactionReason } from '../wallets/types';
+import { QuorumReadError, QuorumWriteError, IdempotencyConflictError } from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+describe('QuorumLedgerService', () => {
+  const mockLedger = (name: string): jest.Mocked<ILedgerService> => ({
+    createEntry: jest.fn().mockImplementation(async (request: CreateLedgerEntryRequest) => ({
+      entryId: `${name}-${request.idempotencyKey}`,
+      accountId: request.accountId,
+      amount: request.amount,
+    } as LedgerEntry)),
+    queryEntries: jest.fn(),
+    getEntry: jest.fn(),
+    entryExists: jest.fn(),
+    getBalanceSnapshot: jest.fn().mockResolvedValue({ accountId: 'user-123', availableBalance: 100 }),
+    generateReconciliationReport: jest.fn(),
+    getAuditTrail: jest.fn(),
+    checkIdempotency: jest.fn(),
+    storeIdempotencyResult: jest.fn(),
+  } as any);
+
+  const request = { accountId: 'user-123', amount: 100, reason: TransactionReason.PROMOTIONAL_AWARD, idempotencyKey: 'idem-1' } as CreateLedgerEntryRequest;
+
+  let a: jest.Mocked<ILedgerService>;
+  let b: jest.Mocked<ILedgerService>;
+  let c: jest.Mocked<ILedgerService>;
+  let service: QuorumLedgerService;
+
+  beforeEach(() => {
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    a = mockLedger('a');
+    b = mockLedger('b');
+    c = mockLedger('c');
+    service = new QuorumLedgerService(
+      [
+        { name: 'a', ledger: a },
+        { name: 'b', ledger: b },
+        { name: 'c', ledger: c },
+      ],
+      2
+    );
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should write to every replica and succeed when the quorum acknowledges', async () => {
+    const result = await service.createEntryWithQuorum(request);
+
+    for (const ledger of [a, b, c]) {
+      expect(ledger.createEntry).toHaveBeenCalledWith(expect.objectContaining(request));
+    }
+    expect(result.entry.entryId).toBe('a-idem-1');
+    expect(result.acknowledged).toEqual(expect.arrayContaining(['a', 'b']));
+    expect(result.failed).toEqual([]);
+  });
+
+  it('should send every replica the same entry ID and timestamp', async () => {
+    await service.createEntryWithQuorum(request);
+
+    const [sent] = a.createEntry.mock.calls[0];
+    expect(sent.entryId).toEqual(expect.any(String));
+    expect(sent.timestamp).toBeInstanceOf(Date);
+    for (const ledger of [b, c]) {
+      expect(ledger.createEntry.mock.calls[0][0]).toMatchObject({ entryId: sent.entryId, timestamp: sent.timestamp });
+    }
+  });
+
+  it('should keep an entry ID and timestamp the caller stamped', async () => {
+    const timestamp = new Date('2024-01-01T00:00:00Z');
+
+    await service.createEntryWithQuorum({ ...request, entryId: 'entry-1', timestamp });
+
+    for (const ledger of [a, b, c]) {
+      expect(ledger.createEntry.mock.calls[0][0]).toMatchObject({ entryId: 'entry-1', timestamp });
+    }
+  });
+
+  it('should store an idempotency result on a write quorum', async () => {
+    c.storeIdempotencyResult.mockRejectedValue(new Error('connection reset'));
+
+    await service.storeIdempotencyResult('idem-1', 'award', { ok: true }, 200, 60);
+
+    for (const ledger of [a, b, c]) {
+      expect(ledger.storeIdempotencyResult).toHaveBeenCalledWith('idem-1', 'award', { ok: true }, 200, 60);
+    }
+  });
+
+  it('should reject an idempotency result too few replicas stored', async () => {
+    b.storeIdempotencyResult.mockRejectedValue(new Error('connection reset'));
+    c.storeIdempotencyResult.mockRejectedValue(new Error('connection reset'));
+
+    await expect(service.storeIdempotencyResult('idem-1', 'award', { ok: true }, 200, 60)).rejects.toBeInstanceOf(
+      QuorumWriteError
+    );
+  });
+
+  it('should resolve once the quorum is met without waiting for a slow replica', async () => {
+    c.createEntry.mockReturnValue(new Promise(() => undefined));
+
+    const result = await service.createEntryWithQuorum(request);
+
+    expect(result).toMatchObject({ acknowledged: ['a', 'b'], pending: ['c'] });
+  });
+
+  it('should report which replica failed when the quorum is still met', async () => {
+    b.createEntry.mockRejectedValue(new Error('connection reset'));
+
+    const result = await service.createEntryWithQuorum(request);
+
+    expect(result).toMatchObject({
+      acknowledged: ['a', 'c'],
+      failed: [{ name: 'b', error: 'connection reset' }],
+      pending: [],
+    });
+    expect(MetricsLogger.incrementCounter).toHaveBeenCalledWith(
+      MetricEventType.LEDGER_REPLICA_WRITE_FAILED,
+      expect.objectContaining({ replica: 'b', idempotencyKey: 'idem-1' })
+    );
+  });
+
+  it('should reject with the failures when the quorum is not met', async () => {
+    b.createEntry.mockRejectedValue(new Error('connection reset'));
+    c.createEntry.mockRejectedValue(new Error('disk full'));
+
+    const error = await service.createEntry(request).catch(e => e);
+
+    expect(error).toBeInstanceOf(QuorumWriteError);
+    expect(error.details).toMatchObject({
+      writeQuorum: 2,
+      acknowledged: ['a'],
+      failed: [
+        { name: 'b', error: 'connection reset' },
+        { name: 'c', error: 'disk full' },
+      ],
+    });
+  });
+
+  it('should report the stamped entry ID and timestamp so a retry writes the same entry', async () => {
+    b.createEntry.mockRejectedValueOnce(new Error('connection reset'));
+    c.createEntry.mockRejectedValueOnce(new Error('disk full'));
+
+    const error = await service.createEntry(request).catch(e => e);
+    const [sent] = a.createEntry.mock.calls[0];
+    expect(error.details).toMatchObject({ entryId: sent.entryId, timestamp: sent.timestamp });
+
+    await service.createEntry({ ...request, entryId: error.details.entryId, timestamp: error.details.timestamp });
+
+    for (const ledger of [b, c]) {
+      expect(ledger.createEntry.mock.calls[1][0]).toMatchObject({ entryId: sent.entryId, timestamp: sent.timestamp });
+    }
+  });
+
+  it('should count a duplicate rejection as an acknowledgement', async () => {
+    const existing = { entryId: 'b-original' } as LedgerEntry;
+    a.createEntry.mockRejectedValue(new Error('connection reset'));
+    b.createEntry.mockRejectedValue(new IdempotencyConflictError('idem-1', existing));
+    c.createEntry.mockRejectedValue(Object.assign(new Error('E11000 duplicate key'), { code: 11000 }));
+
+    const result = await service.createEntryWithQuorum(request);
+
+    expect(result).toMatchObject({ entry: existing, acknowledged: ['b', 'c'] });
+  });
+
+  it('should throw the duplicate error when no replica returned the entry', async () => {
+    const duplicate = Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+    for (const ledger of [a, b, c]) {
+      ledger.createEntry.mockRejectedValue(duplicate);
+    }
+
+    await expect(service.createEntry(request)).rejects.toBe(duplicate);
+  });
+
+  it('should read from the first replica and fall back on failure', async () => {
+    a.getBalanceSnapshot.mockRejectedValue(new Error('primary down'));
+
+    await expect(service.getBalanceSnapshot('user-123', 'user')).resolves.toMatchObject({ availableBalance: 100 });
+    expect(b.getBalanceSnapshot).toHaveBeenCalledWith('user-123', 'user', undefined);
+    expect(c.getBalanceSnapshot).not.toHaveBeenCalled();
+  });
+
+  it('should reject a quorum larger than the replica set', () => {
+    expect(() => new QuorumLedgerService([{ name: 'a', ledger: a }], 2)).toThrow('Write quorum');
+    expect(() => new QuorumLedgerService([{ name: 'a', ledger: a }], 1, { readQuorum: 2 })).toThrow('Read quorum');
+  });
+
+  describe('read preference', () => {
+    const entry = (entryId: string, minute: number) =>
+      ({
+        entryId,
+        accountId: 'user-123',
+        amount: 10,
+        idempotencyKey: `key-${minute}`,
+        timestamp: new Date(Date.UTC(2025, 0, 1, 0, minute)),
+      }) as LedgerEntry;
+    const page = (...entries: LedgerEntry[]) => ({ entries, totalCount: entries.length, offset: 0, limit: 100, hasMore: false });
+
+    // c lags: it has not yet received e-3
+    beforeEach(() => {
+      a.queryEntries.mockResolvedValue(page(entry('e-3', 3), entry('e-2', 2), entry('e-1', 1)));
+      b.queryEntries.mockResolvedValue(page(entry('e-3', 3), entry('e-2', 2), entry('e-1', 1)));
+      c.queryEntries.mockResolvedValue(page(entry('e-2', 2), entry('e-1', 1)));
+    });
+
+    const ids = (result: { entries: LedgerEntry[] }) => result.entries.map(e => e.entryId);
+
+    it('should read from the first replica under primary', async () => {
+      const result = await service.queryEntries({ accountId: 'user-123' });
+
+      expect(ids(result)).toEqual(['e-3', 'e-2', 'e-1']);
+      expect(b.queryEntries).not.toHaveBeenCalled();
+    });
+
+    it('should rotate replicas under any, returning possibly stale but valid results', async () => {
+      const any = service.withReadPreference('any');
+
+      const results = [];
+      for (let i = 0; i < 3; i++) {
+        results.push(ids(await any.queryEntries({ accountId: 'user-123' })));
+      }
+
+      expect(results).toEqual([['e-3', 'e-2', 'e-1'], ['e-3', 'e-2', 'e-1'], ['e-2', 'e-1']]);
+      for (const ledger of [a, b, c]) {
+        expect(ledger.queryEntries).toHaveBeenCalledTimes(1);
+      }
+    });
+
+    it('should fall back to the next replica under any', async () => {
+      const any = new QuorumLedgerService([{ name: 'a', ledger: a }, { name: 'b', ledger: b }], 1, { readPreference: 'any' });
+      b.getEntry.mockResolvedValue(entry('e-1', 1));
+      a.getEntry.mockRejectedValue(new Error('replica down'));
+
+      await any.getEntry('e-1');
+      await expect(any.getEntry('e-1')).resolves.toMatchObject({ entryId: 'e-1' });
+      expect(b.getEntry).toHaveBeenCalledTimes(2);
+    });
+
+    it('should merge and dedupe a majority\'s results under quorum', async () => {
+      a.queryEntries.mockResolvedValue(page(entry('e-2', 2), entry('e-1', 1)));
+      b.queryEntries.mockResolvedValue(page(entry('e-3', 3), entry('e-1', 1)));
+      c.queryEntries.mockReturnValue(new Promise(() => undefined));
+
+      const result = await service.withReadPreference('quorum').queryEntries({ accountId: 'user-123' });
+
+      expect(ids(result)).toEqual(['e-3', 'e-2', 'e-1']);
+      expect(result).toMatchObject({ totalCount: 3, hasMore: false });
+    });
+
+    it('should keep the requested order and limit when merging', async () => {
+      const quorum = new QuorumLedgerService(
+        [
+          { name: 'a', ledger: a },
+          { name: 'b', ledger: b },
+          { name: 'c', ledger: c },
+        ],
+        2,
+        { readPreference: 'quorum', readQuorum: 3 }
+      );
+      a.queryEntries.mockResolvedValue({ ...page(entry('e-1', 1), entry('e-3', 3)), limit: 2, totalCount: 3, hasMore: true });
+      b.queryEntries.mockResolvedValue({ ...page(entry('e-1', 1), entry('e-2', 2)), limit: 2, totalCount: 3, hasMore: true });
+      c.queryEntries.mockResolvedValue({ ...page(entry('e-1', 1)), limit: 2 });
+
+      const result = await quorum.queryEntries({ accountId: 'user-123', sortOrder: 'asc', limit: 2 });
+
+      expect(ids(result)).toEqual(['e-1', 'e-2']);
+      expect(result).toMatchObject({ limit: 2, totalCount: 3, hasMore: true });
+    });
+
+    it('should cut an offset page from the merge of each replica\'s leading entries', async () => {
+      const held = {
+        a: [entry('e-1', 1), entry('e-2', 2), entry('e-3', 3), entry('e-4', 4)],
+        b: [entry('e-1', 1), entry('e-2', 2), entry('e-4', 4)],
+      };
+      for (const [ledger, entries] of [[a, held.a], [b, held.b]] as const) {
+        ledger.queryEntries.mockImplementation(async filter => {
+          const offset = filter.offset!;
+          const window = entries.slice(offset, offset + filter.limit!);
+          const hasMore = offset + window.length < entries.length;
+          return { entries: window, totalCount: entries.length, offset, limit: filter.limit!, hasMore };
+        });
+      }
+      c.queryEntries.mockReturnValue(new Promise(() => undefined));
+
+      const result = await service.withReadPreference('quorum').queryEntries({ sortOrder: 'asc', offset: 2, limit: 2 });
+
+      expect(ids(result)).toEqual(['e-3', 'e-4']);
+      expect(b.queryEntries).toHaveBeenCalledWith(expect.objectContaining({ offset: 0, limit: 4 }));
+      expect(result).toMatchObject({ offset: 2, limit: 2, totalCount: 4, hasMore: false });
+    });
+
+    it('should dedupe copies of an entry stored under different IDs', async () => {
+      a.queryEntries.mockResolvedValue(page(entry('a-1', 1)));
+      b.queryEntries.mockResolvedValue(page(entry('b-1', 1)));
+      a.getAuditTrail.mockResolvedValue([{ auditId: 'a-1', ledgerEntry: entry('a-1', 1), auditedAt: new Date() }]);
+      b.getAuditTrail.mockResolvedValue([{ auditId: 'b-1', ledgerEntry: entry('b-1', 1), auditedAt: new Date() }]);
+      c.queryEntries.mockReturnValue(new Promise(() => undefined));
+      c.getAuditTrail.mockReturnValue(new Promise(() => undefined));
+      const quorum = service.withReadPreference('quorum');
+
+      expect(ids(await quorum.queryEntries({}))).toEqual(['a-1']);
+      expect(await quorum.getAuditTrail('txn-1')).toHaveLength(1);
+    });
+
+    it('should find an entry any quorum replica holds', async () => {
+      a.getEntry.mockResolvedValue(null);
+      b.getEntry.mockResolvedValue(entry('e-3', 3));
+      a.entryExists.mockResolvedValue(false);
+      b.entryExists.mockResolvedValue(true);
+      c.getEntry.mockReturnValue(new Promise(() => undefined));
+      c.entryExists.mockReturnValue(new Promise(() => undefined));
+      const quorum = service.withReadPreference('quorum');
+
+      await expect(quorum.getEntry('e-3')).resolves.toMatchObject({ entryId: 'e-3' });
+      await expect(quorum.entryExists('e-3')).resolves.toBe(true);
+    });
+
+    it('should reject a quorum read once a majority cannot answer', async () => {
+      a.queryEntries.mockRejectedValue(new Error('replica down'));
+      b.queryEntries.mockRejectedValue(new Error('timeout'));
+      c.queryEntries.mockReturnValue(new Promise(() => undefined));
+
+      const error = await service.withReadPreference('quorum').queryEntries({}).catch(e => e);
+
+      expect(error).toBeInstanceOf(QuorumReadError);
+      expect(error.details).toMatchObject({ readQuorum: 2, responded: [] });
+      expect(MetricsLogger.incrementCounter).toHaveBeenCalledWith(
+        MetricEventType.LEDGER_REPLICA_READ_FAILED,
+        expect.objectContaining({ replica: 'a', operation: 'queryEntries' })
+      );
+    });
+  });
+});
@@ -0,0 +1,509 @@
+/**
+ * Quorum Ledger Service
+ *
+ * Replicates every entry to several independent ledgers and treats an
+ * append as durable once a write quorum of them acknowledge it.
+ *
+ * Writes go to every replica concurrently. The entry ID and timestamp
+ * are stamped once before the fan-out, so every replica stores the same
+ * entry. A write resolves as soon as writeQuorum replicas have
+ * acknowledged, and rejects with a QuorumWriteError as soon as the
+ * quorum can no longer be reached. The error's details carry the stamped
+ * entryId and timestamp; a caller that retries with them catches lagging
+ * replicas up with identical copies.
+ * Replicas still in flight at that point are reported as pending; their
+ * later failures are logged, and retrying the request with the same
+ * idempotency key catches them up.
+ *
+ * A duplicate rejection means the replica already holds the key, so it
+ * counts as an acknowledgement. The entry returned is the first one a
+ * replica returned. If every acknowledgement was a duplicate rejection,
+ * the duplicate error is thrown, just as a single ledger would throw it.
+ * Idempotency results are written the same way and need the same quorum.
+ *
+ * Reads follow a read preference, set per store and overridable per
+ * query through withReadPreference:
+ * - primary: the first replica, falling back to the next one when a
+ *   replica fails (the default)
+ * - any: one replica, rotating across reads to spread load, with the same
+ *   fallback; the replica may lag the others, so a read can be stale but
+ *   never invents entries
+ * - quorum: readQuorum replicas (a majority by default) answer and their
+ *   results are merged, so an entry any of them holds is returned.
+ *   Queries and audit trails are deduplicated by idempotency key, so an
+ *   entry several replicas hold is returned once. A query reads the first offset + limit entries
+ *   from each replica and cuts the page from the merge, so a lagging
+ *   replica cannot shift the window. Reads that cannot be merged
+ *   (balances, reports, idempotency) are served as under primary.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import {
+  QuorumReadError,
+  QuorumWriteError,
+  LedgerAppendError,
+  AppendErrorCode,
+  IdempotencyConflictError,
+  findErrorCause,
+} from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Page size of a query without a limit, and the largest page a ledger returns
+ */
+const DEFAULT_QUERY_LIMIT = 100;
+const MAX_QUERY_LIMIT = 1000;
+
+/**
+ * A replica ledger and the name used for it in errors and metrics
+ */
+export interface LedgerReplica {
+  name: string;
+  ledger: ILedgerService;
+}
+
+/**
+ * Outcome of a quorum write
+ */
+export interface QuorumWriteResult {
+  /** First entry returned by a replica */
+  entry: LedgerEntry;
+
+  /** Replicas that wrote the entry or already held it */
+  acknowledged: string[];
+
+  failed: { name: string; error: string }[];
+
+  /** Replicas that had not answered when the outcome was decided */
+  pending: string[];
+}
+
+/**
+ * How reads are served across replicas
+ */
+export type ReadPreference = 'primary' | 'any' | 'quorum';
+
+/**
+ * Read options of a quorum ledger
+ */
+export interface QuorumReadOptions {
+  readPreference: ReadPreference;
+
+  /** Replicas that must answer a quorum read (default: a majority) */
+  readQuorum?: number;
+}
+
+/**
+ * QuorumLedgerService implementation
+ */
+export class QuorumLedgerService implements ILedgerService {
+  private replicas: LedgerReplica[];
+  private writeQuorum: number;
+  private readPreference: ReadPreference;
+  private readQuorum: number;
+  private nextReplica = 0;
+
+  constructor(replicas: LedgerReplica[], writeQuorum: number, options: Partial<QuorumReadOptions> = {}) {
+    if (replicas.length === 0) {
+      throw new Error('Quorum ledger needs at least one replica');
+    }
+    if (!Number.isInteger(writeQuorum) || writeQuorum < 1 || writeQuorum > replicas.length) {
+      throw new Error(`Write quorum must be an integer from 1 to ${replicas.length}, got ${writeQuorum}`);
+    }
+    const readQuorum = options.readQuorum ?? Math.floor(replicas.length / 2) + 1;
+    if (!Number.isInteger(readQuorum) || readQuorum < 1 || readQuorum > replicas.length) {
+      throw new Error(`Read quorum must be an integer from 1 to ${replicas.length}, got ${readQuorum}`);
+    }
+    this.replicas = [...replicas];
+    this.writeQuorum = writeQuorum;
+    this.readPreference = options.readPreference || 'primary';
+    this.readQuorum = readQuorum;
+  }
+
+  /**
+   * The same replicas read with another preference, for one query or a
+   * group of them; writes behave as on this ledger
+   */
+  withReadPreference(readPreference: ReadPreference): QuorumLedgerService {
+    return new QuorumLedgerService(this.replicas, this.writeQuorum, { readPreference, readQuorum: this.readQuorum });
+  }
+
+  /**
+   * Write to every replica and report which acknowledged
+   *
+   * @throws QuorumWriteError if fewer than writeQuorum replicas acknowledge;
+   *   its details carry the entryId and timestamp to retry with
+   * @throws The duplicate error if every acknowledgement was a duplicate
+   *   rejection that did not return the existing entry
+   */
+  async createEntryWithQuorum(submitted: CreateLedgerEntryRequest): Promise<QuorumWriteResult> {
+    // Stamped once, so the replicas' copies are the same entry
+    const stamped = { entryId: submitted.entryId || uuidv4(), timestamp: submitted.timestamp || new Date() };
+    const request: CreateLedgerEntryRequest = { ...submitted, ...stamped };
+    const acknowledged: string[] = [];
+    const failed: { name: string; error: string }[] = [];
+    const answered = new Set<string>();
+    let entry: LedgerEntry | null = null;
+    let duplicate: unknown;
+
+    return new Promise<QuorumWriteResult>((resolve, reject) => {
+      let decided = false;
+
+      const decide = () => {
+        if (decided) {
+          return;
+        }
+        const outstanding = this.replicas.length - answered.size;
+        const pending = this.replicas.filter(replica => !answered.has(replica.name)).map(replica => replica.name);
+
+        if (acknowledged.length >= this.writeQuorum && (entry || outstanding === 0)) {
+          decided = true;
+          if (!entry) {
+            reject(duplicate);
+            return;
+          }
+          resolve({ entry, acknowledged: [...acknowledged], failed: [...failed], pending });
+        } else if (acknowledged.length + outstanding < this.writeQuorum) {
+          decided = true;
+          reject(
+            new QuorumWriteError(request.idempotencyKey, this.writeQuorum, [...acknowledged], [...failed], stamped)
+          );
+        }
+      };
+
+      for (const replica of this.replicas) {
+        replica.ledger.createEntry(request).then(
+          written => {
+            answered.add(replica.name);
+            acknowledged.push(replica.name);
+            entry = entry || written;
+            decide();
+          },
+          error => {
+            answered.add(replica.name);
+            if (this.isDuplicate(error, request)) {
+              acknowledged.push(replica.name);
+              const conflict = findErrorCause(error, IdempotencyConflictError);
+              const existing = conflict && conflict.details && conflict.details.existingResult;
+              if (existing && existing.entryId) {
+                entry = entry || existing;
+              }
+              duplicate = duplicate || error;
+            } else {
+              const cause = error instanceof Error ? error.message : 'Unknown error';
+              failed.push({ name: replica.name, error: cause });
+              MetricsLogger.incrementCounter(MetricEventType.LEDGER_REPLICA_WRITE_FAILED, {
+                replica: replica.name,
+                idempotencyKey: request.idempotencyKey,
+                error: cause,
+              });
+            }
+            decide();
+          }
+        );
+      }
+    });
+  }
+
+  /**
+   * Write to every replica, resolving once the write quorum acknowledges
+   *
+   * @throws QuorumWriteError if fewer than writeQuorum replicas acknowledge
+   */
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    const result = await this.createEntryWithQuorum(request);
+    return result.entry;
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    if (this.readPreference !== 'quorum') {
+      return this.read('queryEntries', ledger => ledger.queryEntries(filter));
+    }
+
+    const offset = filter.offset || 0;
+    const limit = Math.min(filter.limit || DEFAULT_QUERY_LIMIT, MAX_QUERY_LIMIT);
+    const windows = await this.readFromQuorum('queryEntries', ledger => leadingEntries(ledger, filter, offset + limit));
+    const byKey = new Map<string, LedgerEntry>();
+    for (const entry of windows.flatMap(window => window.entries)) {
+      byKey.set(entryIdentity(entry), byKey.get(entryIdentity(entry)) || entry);
+    }
+
+    const merged = [...byKey.values()].sort(entryOrder(filter));
+    const entries = merged.slice(offset, offset + limit);
+    const totalCount = Math.max(...windows.map(window => window.totalCount), merged.length);
+    return {
+      entries,
+      totalCount,
+      offset,
+      limit,
+      hasMore: offset + entries.length < totalCount,
+    };
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    if (this.readPreference !== 'quorum') {
+      return this.read('getEntry', ledger => ledger.getEntry(entryId));
+    }
+
+    const results = await this.readFromQuorum('getEntry', ledger => ledger.getEntry(entryId));
+    return results.find(entry => entry !== null) ?? null;
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    if (this.readPreference !== 'quorum') {
+      return this.read('entryExists', ledger => ledger.entryExists(entryId));
+    }
+
+    return (await this.readFromQuorum('entryExists', ledger => ledger.entryExists(entryId))).some(Boolean);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.read('getBalanceSnapshot', ledger => ledger.getBalanceSnapshot(accountId, accountType, asOf));
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.read('generateReconciliationReport', ledger =>
+      ledger.generateReconciliationReport(accountId, accountType, dateRange)
+    );
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    if (this.readPreference !== 'quorum') {
+      return this.read('getAuditTrail', ledger => ledger.getAuditTrail(transactionId));
+    }
+
+    const trails = await this.readFromQuorum('getAuditTrail', ledger => ledger.getAuditTrail(transactionId));
+    const byKey = new Map<string, AuditTrailEntry>();
+    for (const audit of trails.flat()) {
+      const identity = entryIdentity(audit.ledgerEntry);
+      byKey.set(identity, byKey.get(identity) || audit);
+    }
+    return [...byKey.values()].sort((x, y) => entryOrder({ sortOrder: 'asc' })(x.ledgerEntry, y.ledgerEntry));
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.read('checkIdempotency', ledger => ledger.checkIdempotency(key, operationType));
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    await this.writeToQuorum(key, ledger =>
+      ledger.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds)
+    );
+  }
+
+  /**
+   * Run a write on every replica, resolving once writeQuorum succeed
+   *
+   * @throws QuorumWriteError as soon as writeQuorum replicas can no longer succeed
+   */
+  private writeToQuorum(key: string, run: (ledger: ILedgerService) => Promise<void>): Promise<void> {
+    const acknowledged: string[] = [];
+    const failed: { name: string; error: string }[] = [];
+
+    return new Promise<void>((resolve, reject) => {
+      let decided = false;
+
+      const decide = () => {
+        if (decided) {
+          return;
+        }
+        if (acknowledged.length >= this.writeQuorum) {
+          decided = true;
+          resolve();
+        } else if (this.replicas.length - failed.length < this.writeQuorum) {
+          decided = true;
+          reject(new QuorumWriteError(key, this.writeQuorum, [...acknowledged], [...failed]));
+        }
+      };
+
+      for (const replica of this.replicas) {
+        Promise.resolve()
+          .then(() => run(replica.ledger))
+          .then(
+            () => {
+              acknowledged.push(replica.name);
+              decide();
+            },
+            error => {
+              const cause = error instanceof Error ? error.message : 'Unknown error';
+              failed.push({ name: replica.name, error: cause });
+              MetricsLogger.incrementCounter(MetricEventType.LEDGER_REPLICA_WRITE_FAILED, {
+                replica: replica.name,
+                idempotencyKey: key,
+                error: cause,
+              });
+              decide();
+            }
+          );
+      }
+    });
+  }
+
+  /**
+   * Run an operation on the first replica that succeeds, starting from
+   * the first replica (primary) or from the next one in rotation (any)
+   *
+   * @throws The last replica's error if every replica fails
+   */
+  private async read<T>(operation: string, run: (ledger: ILedgerService) => Promise<T>): Promise<T> {
+    let lastError: unknown;
+    const start = this.readPreference === 'any' ? this.nextReplica++ % this.replicas.length : 0;
+    const ordered = [...this.replicas.slice(start), ...this.replicas.slice(0, start)];
+
+    for (const replica of ordered) {
+      try {
+        return await run(replica.ledger);
+      } catch (error) {
+        lastError = error;
+        MetricsLogger.incrementCounter(MetricEventType.LEDGER_REPLICA_READ_FAILED, {
+          replica: replica.name,
+          operation,
+          error: error instanceof Error ? error.message : 'Unknown error',
+        });
+      }
+    }
+
+    throw lastError;
+  }
+
+  /**
+   * Run an operation on every replica, resolving with the first readQuorum
+   * results without waiting for slower replicas
+   *
+   * @throws QuorumReadError as soon as readQuorum replicas can no longer answer
+   */
+  private readFromQuorum<T>(operation: string, run: (ledger: ILedgerService) => Promise<T>): Promise<T[]> {
+    const results: T[] = [];
+    const responded: string[] = [];
+    const failed: { name: string; error: string }[] = [];
+
+    return new Promise<T[]>((resolve, reject) => {
+      let decided = false;
+
+      const decide = () => {
+        if (decided) {
+          return;
+        }
+        if (results.length >= this.readQuorum) {
+          decided = true;
+          resolve([...results]);
+        } else if (this.replicas.length - failed.length < this.readQuorum) {
+          decided = true;
+          reject(new QuorumReadError(operation, this.readQuorum, [...responded], [...failed]));
+        }
+      };
+
+      for (const replica of this.replicas) {
+        Promise.resolve()
+          .then(() => run(replica.ledger))
+          .then(
+            result => {
+              responded.push(replica.name);
+              results.push(result);
+              decide();
+            },
+            error => {
+              const cause = error instanceof Error ? error.message : 'Unknown error';
+              failed.push({ name: replica.name, error: cause });
+              MetricsLogger.incrementCounter(MetricEventType.LEDGER_REPLICA_READ_FAILED, {
+                replica: replica.name,
+                operation,
+                error: cause,
+              });
+              decide();
+            }
+          );
+      }
+    });
+  }
+
+  private isDuplicate(error: unknown, request: CreateLedgerEntryRequest): boolean {
+    if (error && (error as any).code === 11000) {
+      return true;
+    }
+    return LedgerAppendError.from(error, request).appendCode === AppendErrorCode.DUPLICATE;
+  }
+}
+
+/**
+ * The first count entries a replica holds for a query, read a page at a
+ * time from the start, with the replica's total
+ */
+async function leadingEntries(
+  ledger: ILedgerService,
+  filter: LedgerQueryFilter,
+  count: number
+): Promise<{ entries: LedgerEntry[]; totalCount: number }> {
+  const entries: LedgerEntry[] = [];
+  let totalCount = 0;
+
+  while (entries.length < count) {
+    const page = await ledger.queryEntries({
+      ...filter,
+      offset: entries.length,
+      limit: Math.min(count - entries.length, MAX_QUERY_LIMIT),
+    });
+    entries.push(...page.entries);
+    totalCount = page.totalCount;
+    if (!page.hasMore || page.entries.length === 0) {
+      break;
+    }
+  }
+
+  return { entries: entries.slice(0, count), totalCount };
+}
+
+/**
+ * What makes two replicas' entries the same entry: its idempotency key
+ * within its tenant and scope
+ */
+function entryIdentity(entry: LedgerEntry): string {
+  return [entry.tenantId ?? '', entry.idempotencyScope ?? '', entry.idempotencyKey].join('\u0000');
+}
+
+/**
+ * Comparator matching a single ledger's query order: the sort field
+ * (timestamp by default, newest first), then entry ID
+ */
+function entryOrder(filter: Pick<LedgerQueryFilter, 'sortBy' | 'sortOrder'>): (x: LedgerEntry, y: LedgerEntry) => number {
+  const direction = filter.sortOrder === 'asc' ? 1 : -1;
+  const key = (entry: LedgerEntry) =>
+    filter.sortBy === 'amount' ? entry.amount : new Date(entry.timestamp).getTime();
+
+  return (x, y) => direction * (key(x) - key(y) || (x.entryId < y.entryId ? -1 : x.entryId > y.entryId ? 1 : 0));
+}
+
+/**
+ * Factory function to create a quorum ledger
+ */
+export function createQuorumLedgerService(
+  replicas: LedgerReplica[],
+  writeQuorum: number,
+  options: Partial<QuorumReadOptions> = {}
+): QuorumLedgerService {
+  return new QuorumLedgerService(replicas, writeQuorum, options);
+}
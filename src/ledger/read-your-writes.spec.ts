@@ -0,0 +1,108 @@
+/**
+ * Read-Your-Writes Tests
+ */
+
+import { SequenceWatermark, WatermarkedProjector } from './read-your-writes';
+import { Projector } from './replay';
+import { LedgerEntry } from './types';
+import { ProjectionLagError } from '../services/types';
+
+const entry = (accountId: string, streamVersion?: number, accountType: LedgerEntry['accountType'] = 'user') =>
+  ({ entryId: `entry-${accountId}-${streamVersion}`, accountId, accountType, streamVersion } as LedgerEntry);
+
+describe('SequenceWatermark', () => {
+  let watermark: SequenceWatermark;
+
+  beforeEach(() => {
+    jest.useFakeTimers();
+    watermark = new SequenceWatermark('balance-cache');
+  });
+
+  afterEach(() => {
+    jest.useRealTimers();
+  });
+
+  it('should resolve at once when the sequence is already applied', async () => {
+    watermark.advance(entry('user-1', 3));
+
+    await expect(watermark.waitForSeq('user-1', 2, 100)).resolves.toBeUndefined();
+    expect(watermark.appliedSeq('user-1')).toBe(3);
+  });
+
+  it('should resolve when the projection catches up just before the deadline', async () => {
+    watermark.advance(entry('user-1', 1));
+    const wait = watermark.waitForSeq('user-1', 2, 100);
+
+    await jest.advanceTimersByTimeAsync(99);
+    watermark.advance(entry('user-1', 2));
+    await jest.advanceTimersByTimeAsync(10);
+
+    await expect(wait).resolves.toBeUndefined();
+    expect(jest.getTimerCount()).toBe(0);
+  });
+
+  it('should reject with the lag when the deadline passes first', async () => {
+    watermark.advance(entry('user-1', 1));
+    const wait = watermark.waitForSeq('user-1', 3, 100);
+    const settled = expect(wait).rejects.toThrow(ProjectionLagError);
+
+    await jest.advanceTimersByTimeAsync(100);
+    await settled;
+    await expect(wait).rejects.toMatchObject({
+      code: 'PROJECTION_LAG',
+      details: { projection: 'balance-cache', userId: 'user-1', seq: 3, applied: 1 },
+    });
+
+    // A late catch-up does not resurrect a timed-out waiter
+    watermark.advance(entry('user-1', 3));
+    expect(jest.getTimerCount()).toBe(0);
+  });
+
+  it('should wake only the waiters a version satisfies', async () => {
+    const resolved: string[] = [];
+    watermark.waitForSeq('user-1', 1, 1000).then(() => resolved.push('user-1@1'));
+    watermark.waitForSeq('user-1', 2, 1000).then(() => resolved.push('user-1@2'));
+    watermark.waitForSeq('user-2', 1, 1000).then(() => resolved.push('user-2@1'));
+
+    watermark.advance(entry('user-1', 1));
+    await Promise.resolve();
+
+    expect(resolved).toEqual(['user-1@1']);
+    expect(jest.getTimerCount()).toBe(2);
+  });
+
+  it('should ignore entries without a user stream version and never move backwards', () => {
+    watermark.advance(entry('user-1', 5));
+    watermark.advance(entry('user-1', 4));
+    watermark.advance(entry('user-1'));
+    watermark.advance(entry('model-1', 9, 'model'));
+
+    expect(watermark.appliedSeq('user-1')).toBe(5);
+    expect(watermark.appliedSeq('model-1')).toBe(0);
+  });
+});
+
+describe('WatermarkedProjector', () => {
+  it('should advance only after the wrapped projector applied the entry', async () => {
+    let release!: () => void;
+    const inner: Projector = {
+      name: 'daily-aggregates',
+      apply: jest.fn(() => new Promise<void>(resolve => (release = resolve))),
+      reset: jest.fn(),
+    };
+    const projector = new WatermarkedProjector(inner);
+
+    const applying = projector.afterAppend(entry('user-1', 1));
+    expect(projector.appliedSeq('user-1')).toBe(0);
+
+    release();
+    await applying;
+    expect(projector.appliedSeq('user-1')).toBe(1);
+    await expect(projector.waitForSeq('user-1', 1, 0)).resolves.toBeUndefined();
+
+    await projector.reset();
+    expect(inner.reset).toHaveBeenCalled();
+    expect(projector.appliedSeq('user-1')).toBe(0);
+    expect(projector.name).toBe('daily-aggregates');
+  });
+});
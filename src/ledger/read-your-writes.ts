@@ -0,0 +1,171 @@
+/**
+ * Read-Your-Writes
+ *
+ * Projections (the balance cache, daily aggregates, anything fed by the
+ * replay engine or an append hook) apply entries after the write that
+ * produced them returns, so a user who just redeemed can read a stale
+ * balance. A write returns the user's stream version (the per-user
+ * sequence assigned when trackStreamVersions is on); a reader passes it
+ * back and waits until the projection has applied at least that far.
+ *
+ * A SequenceWatermark records the highest stream version applied per
+ * user and wakes waiters as it advances. WatermarkedProjector wraps a
+ * projector so its watermark advances only after the entry is applied.
+ * Entries without a stream version (system and model accounts, or
+ * ledgers that do not track versions) never advance a watermark.
+ *
+ * Watermarks are process-local: a reader must wait on the copy of the
+ * projection it is about to read.
+ */
+
+import { LedgerAppendHook, LedgerEntry } from './types';
+import { Projector } from './replay';
+import { ProjectionLagError } from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * A projection a reader can wait on
+ */
+export interface SequenceWaiter {
+  /** Projection name, used in errors and metrics */
+  readonly name: string;
+
+  /**
+   * Highest stream version applied for a user (0 before any)
+   */
+  appliedSeq(userId: string): number;
+
+  /**
+   * Resolve once the user's stream version `seq` has been applied
+   *
+   * @throws ProjectionLagError if it is not applied within timeoutMs
+   */
+  waitForSeq(userId: string, seq: number, timeoutMs: number): Promise<void>;
+}
+
+interface Waiter {
+  seq: number;
+  resolve: () => void;
+  timer: NodeJS.Timeout;
+}
+
+/**
+ * Per-user applied stream versions with waiters
+ */
+export class SequenceWatermark implements SequenceWaiter {
+  readonly name: string;
+  private applied: Map<string, number> = new Map();
+  private waiters: Map<string, Set<Waiter>> = new Map();
+
+  constructor(name: string) {
+    this.name = name;
+  }
+
+  appliedSeq(userId: string): number {
+    return this.applied.get(userId) || 0;
+  }
+
+  /**
+   * Record an applied entry and wake the waiters it satisfies
+   */
+  advance(entry: LedgerEntry): void {
+    if (entry.accountType !== 'user' || entry.streamVersion === undefined) {
+      return;
+    }
+    if (entry.streamVersion <= this.appliedSeq(entry.accountId)) {
+      return;
+    }
+    this.applied.set(entry.accountId, entry.streamVersion);
+
+    const waiting = this.waiters.get(entry.accountId);
+    for (const waiter of waiting || []) {
+      if (waiter.seq <= entry.streamVersion) {
+        this.release(entry.accountId, waiter);
+        waiter.resolve();
+      }
+    }
+  }
+
+  /**
+   * Forget every applied version, before a rebuild
+   * Pending waiters keep waiting for the rebuild to reach them.
+   */
+  reset(): void {
+    this.applied.clear();
+  }
+
+  waitForSeq(userId: string, seq: number, timeoutMs: number): Promise<void> {
+    if (seq <= this.appliedSeq(userId)) {
+      return Promise.resolve();
+    }
+
+    return new Promise((resolve, reject) => {
+      const waiter: Waiter = {
+        seq,
+        resolve,
+        timer: setTimeout(() => {
+          this.release(userId, waiter);
+          const applied = this.appliedSeq(userId);
+          MetricsLogger.incrementCounter(MetricEventType.LEDGER_PROJECTION_LAGGED, {
+            projection: this.name,
+            lag: seq - applied,
+          });
+          reject(new ProjectionLagError(this.name, userId, seq, applied));
+        }, timeoutMs),
+      };
+
+      const waiting = this.waiters.get(userId) || new Set<Waiter>();
+      waiting.add(waiter);
+      this.waiters.set(userId, waiting);
+    });
+  }
+
+  private release(userId: string, waiter: Waiter): void {
+    clearTimeout(waiter.timer);
+    const waiting = this.waiters.get(userId);
+    waiting?.delete(waiter);
+    if (waiting?.size === 0) {
+      this.waiters.delete(userId);
+    }
+  }
+}
+
+/**
+ * A projector whose readers can wait for their own writes
+ *
+ * Register it with the replay engine, as an append hook, or both, in
+ * place of the projector it wraps. Reads go to the wrapped projector.
+ */
+export class WatermarkedProjector implements Projector, LedgerAppendHook, SequenceWaiter {
+  readonly name: string;
+  private inner: Projector;
+  private watermark: SequenceWatermark;
+
+  constructor(inner: Projector) {
+    this.inner = inner;
+    this.name = inner.name;
+    this.watermark = new SequenceWatermark(inner.name);
+  }
+
+  async apply(entry: LedgerEntry): Promise<void> {
+    await this.inner.apply(entry);
+    this.watermark.advance(entry);
+  }
+
+  async afterAppend(entry: LedgerEntry): Promise<void> {
+    await this.apply(entry);
+  }
+
+  async reset(): Promise<void> {
+    this.watermark.reset();
+    await this.inner.reset?.();
+  }
+
+  appliedSeq(userId: string): number {
+    return this.watermark.appliedSeq(userId);
+  }
+
+  waitForSeq(userId: string, seq: number, timeoutMs: number): Promise<void> {
+    return this.watermark.waitForSeq(userId, seq, timeoutMs);
+  }
+}
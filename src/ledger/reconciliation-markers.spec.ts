@@ -0,0 +1,117 @@
+/**
+ * Reconciliation Markers Tests
+ */
+
+import { ReconciliationMarkers } from './reconciliation-markers';
+import { LedgerEntry, LedgerQueryFilter } from './types';
+import { LedgerReconciliationMarkerModel } from '../db/models/ledger-reconciliation.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/ledger-reconciliation.model');
+
+describe('ReconciliationMarkers', () => {
+  let stored: LedgerEntry[];
+  let markers: { transactionId: string }[];
+  let markersService: ReconciliationMarkers;
+
+  const entry = (entryId: string, transactionId: string, timestamp: string): LedgerEntry => ({
+    entryId,
+    transactionId,
+    accountId: 'user-1',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PURCHASE_EARN,
+    idempotencyKey: `key-${entryId}`,
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 100,
+    timestamp: new Date(timestamp),
+    currency: 'points',
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    stored = [
+      entry('entry-1', 'txn-1', '2024-01-05T00:00:00Z'),
+      entry('entry-2', 'txn-2', '2024-01-10T00:00:00Z'),
+      entry('entry-3', 'txn-2', '2024-01-10T00:00:00Z'),
+      entry('entry-4', 'txn-3', '2024-01-20T00:00:00Z'),
+      entry('entry-5', 'txn-4', '2024-02-01T00:00:00Z'),
+    ];
+    markers = [];
+
+    markersService = new ReconciliationMarkers({
+      queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+        const entries = stored.filter(e => !filter.endDate || e.timestamp <= filter.endDate);
+        return { entries, totalCount: entries.length, offset: 0, limit: 1000, hasMore: false };
+      }),
+      getAuditTrail: jest.fn().mockImplementation(async (transactionId: string) =>
+        stored
+          .filter(e => e.transactionId === transactionId)
+          .map(ledgerEntry => ({ auditId: ledgerEntry.entryId, ledgerEntry, auditedAt: new Date() }))
+      ),
+    });
+
+    (LedgerReconciliationMarkerModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (markers.some(marker => marker.transactionId === doc.transactionId)) {
+        throw Object.assign(new Error('Duplicate key'), { code: 11000 });
+      }
+      markers.push(doc);
+      return doc;
+    });
+    (LedgerReconciliationMarkerModel.find as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () =>
+        markers.filter(marker => query.transactionId.$in.includes(marker.transactionId))
+      ),
+    }));
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should return only the unmarked entries older than the cutoff', async () => {
+    await markersService.markReconciled(['txn-2'], 'finance-close');
+
+    const unreconciled = await markersService.unreconciledBefore(new Date('2024-01-20T00:00:00Z'));
+
+    expect(unreconciled.map(e => e.entryId)).toEqual(['entry-1']);
+  });
+
+  it('should append one marker per transaction without touching entries', async () => {
+    const before = JSON.stringify(stored);
+
+    const written = await markersService.markReconciled(['txn-1', 'txn-3', 'txn-1'], 'finance-close');
+
+    expect(written.map(marker => marker.transactionId)).toEqual(['txn-1', 'txn-3']);
+    expect(written[0]).toMatchObject({ committedBy: 'finance-close' });
+    expect(markers).toHaveLength(2);
+    expect(JSON.stringify(stored)).toBe(before);
+  });
+
+  it('should keep the original marker when a transaction is marked again', async () => {
+    await markersService.markReconciled(['txn-1'], 'finance-close');
+
+    const written = await markersService.markReconciled(['txn-1', 'txn-2'], 'finance-rerun');
+
+    expect(written.map(marker => marker.transactionId)).toEqual(['txn-2']);
+    expect(markers).toHaveLength(2);
+  });
+
+  it('should write no markers when a transaction does not exist', async () => {
+    await expect(markersService.markReconciled(['txn-1', 'txn-missing'], 'finance-close')).rejects.toThrow(
+      'Transaction not found: txn-missing'
+    );
+    expect(LedgerReconciliationMarkerModel.create).not.toHaveBeenCalled();
+  });
+
+  it('should require committedBy', async () => {
+    await expect(markersService.markReconciled(['txn-1'], '')).rejects.toThrow('committedBy is required');
+  });
+});
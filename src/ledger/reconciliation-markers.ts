@@ -0,0 +1,122 @@
+/**
+ * Reconciliation Markers
+ *
+ * Tracks which transactions the finance close has reconciled against a
+ * settlement file. Entries are immutable, so reconciliation is never a
+ * field on the entry: markReconciled appends one immutable marker per
+ * transaction (who reconciled it, and when), and unreconciledBefore
+ * reads the entries of transactions without one. The markers are the
+ * audit record of the close.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { ILedgerService, LedgerEntry } from './types';
+import { LedgerReconciliationMarkerModel } from '../db/models/ledger-reconciliation.model';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * A recorded reconciliation
+ */
+export interface ReconciliationMarker {
+  markerId: string;
+  transactionId: string;
+  committedBy: string;
+  reconciledAt: Date;
+}
+
+/**
+ * Entries read per page by unreconciledBefore
+ */
+const PAGE_SIZE = 1000;
+
+/**
+ * Reconciliation markers over a ledger
+ */
+export class ReconciliationMarkers {
+  private ledger: Pick<ILedgerService, 'queryEntries' | 'getAuditTrail'>;
+
+  constructor(ledger: Pick<ILedgerService, 'queryEntries' | 'getAuditTrail'>) {
+    this.ledger = ledger;
+  }
+
+  /**
+   * Mark transactions as reconciled
+   * Every transaction is checked before any marker is written. Marking a
+   * transaction that is already reconciled is a no-op, so a close can be
+   * re-run with the same settlement file; its original marker stands.
+   *
+   * @returns The markers written by this call
+   * @throws Error if committedBy is missing or a transaction has no entries
+   */
+  async markReconciled(transactionIds: string[], committedBy: string): Promise<ReconciliationMarker[]> {
+    if (!committedBy) {
+      throw new Error('committedBy is required for reconciliation');
+    }
+
+    const unique = [...new Set(transactionIds)];
+    for (const transactionId of unique) {
+      if (!transactionId || (await this.ledger.getAuditTrail(transactionId)).length === 0) {
+        throw new Error(`Transaction not found: ${transactionId}`);
+      }
+    }
+
+    const written: ReconciliationMarker[] = [];
+    for (const transactionId of unique) {
+      const markerId = uuidv4();
+      try {
+        await LedgerReconciliationMarkerModel.create({ markerId, transactionId, committedBy });
+      } catch (error: any) {
+        if (error && error.code === 11000) {
+          continue;
+        }
+        throw error;
+      }
+      written.push({ markerId, transactionId, committedBy, reconciledAt: new Date() });
+    }
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_TRANSACTIONS_RECONCILED, {
+      committedBy,
+      transactionCount: written.length,
+    });
+
+    return written;
+  }
+
+  /**
+   * Entries older than cutoff whose transaction has no reconciliation
+   * marker, oldest first
+   * Reads the ledger a page at a time, looking up the markers for each
+   * page's transactions.
+   */
+  async unreconciledBefore(cutoff: Date): Promise<LedgerEntry[]> {
+    const unreconciled: LedgerEntry[] = [];
+    let offset = 0;
+
+    for (;;) {
+      const result = await this.ledger.queryEntries({
+        endDate: cutoff,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: PAGE_SIZE,
+      });
+
+      // endDate is inclusive; an entry at the cutoff is not older than it
+      const older = result.entries.filter(entry => entry.timestamp.getTime() < cutoff.getTime());
+      if (older.length > 0) {
+        const markers = await LedgerReconciliationMarkerModel.find({
+          transactionId: { $in: [...new Set(older.map(entry => entry.transactionId))] },
+        })
+          .lean()
+          .exec();
+        const reconciled = new Set(markers.map((marker: any) => marker.transactionId));
+        unreconciled.push(...older.filter(entry => !reconciled.has(entry.transactionId)));
+      }
+
+      offset += result.entries.length;
+      if (!result.hasMore || result.entries.length === 0) {
+        return unreconciled;
+      }
+    }
+  }
+}
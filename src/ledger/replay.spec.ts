@@ -0,0 +1,293 @@
+/**
+ * Replay Engine Tests
+ */
+
+import { ReplayEngine, InMemoryCheckpointStore, Projector } from './replay';
+import { DailyAggregates } from './daily-aggregates';
+import { BalanceSnapshotCache } from '../events/balance-snapshot-cache';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+import { TransactionType } from '../wallets/types';
+
+describe('ReplayEngine', () => {
+  let ledger: LedgerEntry[];
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  const entry = (accountId: string, amount: number, timestamp: string): LedgerEntry => {
+    const balanceBefore = ledger
+      .filter(e => e.accountId === accountId)
+      .reduce((sum, e) => sum + e.amount, 0);
+    return {
+      entryId: `entry-${String(ledger.length).padStart(4, '0')}`,
+      transactionId: `tx-${ledger.length}`,
+      accountId,
+      accountType: 'user',
+      amount,
+      type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      balanceBefore,
+      balanceAfter: balanceBefore + amount,
+      timestamp: new Date(timestamp),
+    } as LedgerEntry;
+  };
+
+  const append = (e: LedgerEntry) => {
+    ledger.push(e);
+  };
+
+  // Many entries share a timestamp so batches split ties
+  const seed = (count: number) => {
+    for (let i = 0; i < count; i++) {
+      const day = String(1 + (i % 5)).padStart(2, '0');
+      const hour = String(Math.floor(i / 40) % 24).padStart(2, '0');
+      append(entry(`user-${i % 9}`, i % 4 === 0 ? -(i % 50) : i % 70, `2024-03-${day}T${hour}:00:00Z`));
+    }
+  };
+
+  /**
+   * Projector recording the entry IDs it saw, per account
+   */
+  class Recorder implements Projector {
+    seen: Map<string, string[]> = new Map();
+
+    constructor(readonly name: string) {}
+
+    apply(e: LedgerEntry): void {
+      this.seen.set(e.accountId, [...(this.seen.get(e.accountId) || []), e.entryId]);
+    }
+
+    reset(): void {
+      this.seen = new Map();
+    }
+  }
+
+  const ledgerOrder = (): Map<string, string[]> => {
+    const byAccount = new Map<string, string[]>();
+    const ordered = [...ledger].sort(
+      (a, b) => a.timestamp.getTime() - b.timestamp.getTime() || (a.entryId < b.entryId ? -1 : 1)
+    );
+    for (const e of ordered) {
+      byAccount.set(e.accountId, [...(byAccount.get(e.accountId) || []), e.entryId]);
+    }
+    return byAccount;
+  };
+
+  beforeEach(() => {
+    ledger = [];
+    mockLedgerService = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+        const matching = ledger
+          .filter(e => !filter.startDate || e.timestamp >= filter.startDate)
+          .sort((a, b) => a.timestamp.getTime() - b.timestamp.getTime() || (a.entryId < b.entryId ? -1 : 1));
+        const offset = filter.offset || 0;
+        const limit = filter.limit || 100;
+        return {
+          entries: matching.slice(offset, offset + limit),
+          totalCount: matching.length,
+          offset,
+          limit,
+          hasMore: offset + limit < matching.length,
+        };
+      }),
+      getEntry: jest.fn(),
+      entryExists: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+  });
+
+  it('should apply every entry once in per-account order with parallel workers', async () => {
+    seed(300);
+    const recorder = new Recorder('recorder');
+    const engine = new ReplayEngine(mockLedgerService, new InMemoryCheckpointStore(), {
+      batchSize: 32,
+      parallelism: 4,
+    });
+
+    const report = await engine.register(recorder).run();
+
+    expect(report).toEqual({ entriesRead: 300, applied: { recorder: 300 }, aborted: false });
+    expect(recorder.seen).toEqual(ledgerOrder());
+  });
+
+  it('should resume from its checkpoint and apply only new entries', async () => {
+    seed(50);
+    const checkpoints = new InMemoryCheckpointStore();
+    const recorder = new Recorder('recorder');
+    await new ReplayEngine(mockLedgerService, checkpoints, { batchSize: 16 }).register(recorder).run();
+
+    append(entry('user-1', 5, '2024-04-01T00:00:00Z'));
+    append(entry('user-2', 7, '2024-04-01T00:00:00Z'));
+    const report = await new ReplayEngine(mockLedgerService, checkpoints, { batchSize: 16 }).register(recorder).run();
+
+    expect(report.applied).toEqual({ recorder: 2 });
+    expect(recorder.seen).toEqual(ledgerOrder());
+    await expect(checkpoints.load('recorder')).resolves.toEqual({
+      position: { timestamp: new Date('2024-04-01T00:00:00Z'), entryId: 'entry-0051' },
+      applied: [],
+    });
+  });
+
+  it('should let a newly registered projector catch up without replaying to the others', async () => {
+    seed(40);
+    const checkpoints = new InMemoryCheckpointStore();
+    const existing = new Recorder('existing');
+    await new ReplayEngine(mockLedgerService, checkpoints).register(existing).run();
+
+    const added = new Recorder('added');
+    const report = await new ReplayEngine(mockLedgerService, checkpoints).register(existing).register(added).run();
+
+    expect(report.applied).toEqual({ existing: 0, added: 40 });
+    expect(added.seen).toEqual(ledgerOrder());
+  });
+
+  it('should start projectors without a checkpoint from a given position', async () => {
+    seed(10);
+    const recorder = new Recorder('recorder');
+    const from = { timestamp: ledger[4].timestamp, entryId: ledger[4].entryId };
+
+    await new ReplayEngine(mockLedgerService).register(recorder).run({ from });
+
+    const applied = [...recorder.seen.values()].flat();
+    expect(applied).not.toContain(ledger[4].entryId);
+    expect(applied).toContain(ledger[9].entryId);
+  });
+
+  it('should reset projectors when rebuilding from scratch', async () => {
+    seed(20);
+    const checkpoints = new InMemoryCheckpointStore();
+    const recorder = new Recorder('recorder');
+    await new ReplayEngine(mockLedgerService, checkpoints).register(recorder).run();
+
+    const report = await new ReplayEngine(mockLedgerService, checkpoints).register(recorder).run({ fromScratch: true });
+
+    expect(report.applied).toEqual({ recorder: 20 });
+    expect(recorder.seen).toEqual(ledgerOrder());
+  });
+
+  it('should reject a second projector with the same name', () => {
+    const engine = new ReplayEngine(mockLedgerService).register(new Recorder('recorder'));
+
+    expect(() => engine.register(new Recorder('recorder'))).toThrow('already registered');
+  });
+
+  it('should reject invalid configuration', () => {
+    expect(() => new ReplayEngine(mockLedgerService, undefined, { batchSize: 0 })).toThrow('batchSize');
+    expect(() => new ReplayEngine(mockLedgerService, undefined, { parallelism: 1.5 })).toThrow('parallelism');
+  });
+
+  describe('chaos', () => {
+    const from = new Date('2024-03-01T00:00:00Z');
+    const to = new Date('2024-03-05T00:00:00Z');
+
+    /**
+     * Wrap a projector so the process "dies" before the given applies
+     */
+    const killedAt = (projector: Projector, killPoints: number[]): Projector => {
+      let applies = 0;
+      return {
+        name: projector.name,
+        apply: (e: LedgerEntry) => {
+          applies++;
+          if (killPoints.includes(applies)) {
+            throw new Error('replay killed');
+          }
+          return projector.apply(e);
+        },
+        reset: () => projector.reset?.(),
+      };
+    };
+
+    const cachedBalances = (cache: BalanceSnapshotCache) =>
+      Array.from({ length: 9 }, (_, i) => {
+        const cached = cache.getBalance(`user-${i}`, 'user');
+        return cached && { ...cached, lastUpdated: undefined };
+      });
+
+    const expectSameProjections = async (
+      resumed: { aggregates: DailyAggregates; cache: BalanceSnapshotCache },
+      rebuilt: { aggregates: DailyAggregates; cache: BalanceSnapshotCache }
+    ) => {
+      for (const type of [TransactionType.CREDIT, TransactionType.DEBIT]) {
+        expect(await resumed.aggregates.series(undefined, from, to, type)).toEqual(
+          await rebuilt.aggregates.series(undefined, from, to, type)
+        );
+      }
+      // Equal versions mean every entry was applied exactly once
+      expect(cachedBalances(resumed.cache)).toEqual(cachedBalances(rebuilt.cache));
+    };
+
+    const rebuildFromScratch = async () => {
+      const aggregates = new DailyAggregates(mockLedgerService);
+      const cache = new BalanceSnapshotCache({ enabled: false });
+      await new ReplayEngine(mockLedgerService).register(aggregates).register(cache).run({ fromScratch: true });
+      return { aggregates, cache };
+    };
+
+    it('should resume after being killed mid-stream to the same result as a rebuild', async () => {
+      seed(400);
+      const checkpoints = new InMemoryCheckpointStore();
+      const aggregates = new DailyAggregates(mockLedgerService);
+      const cache = new BalanceSnapshotCache({ enabled: false });
+      const flakyAggregates = killedAt(aggregates, [17, 18, 150, 151, 152, 390]);
+      const flakyCache = killedAt(cache, [3, 96, 97, 260]);
+
+      let kills = 0;
+      for (;;) {
+        // A fresh engine per attempt, as after a process restart
+        const engine = new ReplayEngine(mockLedgerService, checkpoints, { batchSize: 25, parallelism: 3 })
+          .register(flakyAggregates)
+          .register(flakyCache);
+        try {
+          await engine.run();
+          break;
+        } catch (error: any) {
+          expect(error.message).toBe('replay killed');
+          kills++;
+        }
+      }
+
+      expect(kills).toBeGreaterThan(0);
+      await expectSameProjections({ aggregates, cache }, await rebuildFromScratch());
+    });
+
+    it('should resume after an abort mid-batch to the same result as a rebuild', async () => {
+      seed(250);
+      const checkpoints = new InMemoryCheckpointStore();
+      const aggregates = new DailyAggregates(mockLedgerService);
+      const cache = new BalanceSnapshotCache({ enabled: false });
+
+      let applies = 0;
+      let controller = new AbortController();
+      const aborting: Projector = {
+        name: aggregates.name,
+        apply: (e: LedgerEntry) => {
+          if (++applies % 70 === 0) {
+            controller.abort();
+          }
+          aggregates.apply(e);
+        },
+      };
+
+      let aborts = 0;
+      for (;;) {
+        const report = await new ReplayEngine(mockLedgerService, checkpoints, { batchSize: 40, parallelism: 2 })
+          .register(aborting)
+          .register(cache)
+          .run({ signal: controller.signal });
+        if (!report.aborted) {
+          break;
+        }
+        aborts++;
+        controller = new AbortController();
+      }
+
+      expect(aborts).toBeGreaterThan(0);
+      expect(applies).toBe(250);
+      await expectSameProjections({ aggregates, cache }, await rebuildFromScratch());
+    });
+  });
+});
@@ -0,0 +1,395 @@
+/**
+ * Ledger Replay Engine
+ *
+ * One shared loop for rebuilding derived state from the ledger. The
+ * engine streams entries in (timestamp, entryId) order and hands each to
+ * every registered Projector that has not seen it yet.
+ *
+ * Each projector has its own checkpoint, so projectors resume
+ * independently: a run streams from the earliest checkpoint and skips
+ * entries a projector has already applied. A checkpoint is a stream
+ * position plus the IDs applied beyond it, which keeps it exact even
+ * when a run stops partway through a batch. Checkpoints are saved after
+ * every batch and whenever a run stops early, including on failure.
+ *
+ * Within a batch, entries are grouped by account and the groups are
+ * applied by up to `parallelism` workers. Each account's entries are
+ * applied in ledger order; entries of different accounts may interleave,
+ * so projectors must not depend on cross-account order.
+ *
+ * A projector whose state outlives the process should persist its state
+ * and checkpoint together, or be rebuilt from scratch after a crash.
+ */
+
+import { ILedgerService, LedgerEntry } from './types';
+
+/**
+ * Position of an entry in the replay stream
+ */
+export interface ReplayPosition {
+  timestamp: Date;
+  entryId: string;
+}
+
+/**
+ * How far a projector has got
+ */
+export interface ReplayCheckpoint {
+  /** Last position applied in full (null before the first entry) */
+  position: ReplayPosition | null;
+
+  /** Entries beyond position that were already applied */
+  applied: string[];
+}
+
+/**
+ * Derived state rebuilt from the ledger
+ */
+export interface Projector {
+  /** Projector name, used as its checkpoint key */
+  readonly name: string;
+
+  /**
+   * Fold one entry into the projection
+   * Entries of one account arrive in ledger order.
+   */
+  apply(entry: LedgerEntry): void | Promise<void>;
+
+  /**
+   * Discard the projection before a rebuild from scratch
+   */
+  reset?(): void | Promise<void>;
+}
+
+/**
+ * Durable store of projector checkpoints
+ */
+export interface IReplayCheckpointStore {
+  load(projectorName: string): Promise<ReplayCheckpoint | null>;
+
+  save(projectorName: string, checkpoint: ReplayCheckpoint): Promise<void>;
+}
+
+/**
+ * Process-local checkpoint store for development, tests and one-off
+ * rebuilds
+ */
+export class InMemoryCheckpointStore implements IReplayCheckpointStore {
+  private checkpoints: Map<string, ReplayCheckpoint> = new Map();
+
+  async load(projectorName: string): Promise<ReplayCheckpoint | null> {
+    const checkpoint = this.checkpoints.get(projectorName);
+    return checkpoint ? structuredClone(checkpoint) : null;
+  }
+
+  async save(projectorName: string, checkpoint: ReplayCheckpoint): Promise<void> {
+    this.checkpoints.set(projectorName, structuredClone(checkpoint));
+  }
+}
+
+/**
+ * Configuration for the replay engine
+ */
+export interface ReplayConfig {
+  /** Entries read per batch */
+  batchSize: number;
+
+  /** Accounts applied concurrently within a batch */
+  parallelism: number;
+}
+
+const DEFAULT_CONFIG: ReplayConfig = {
+  batchSize: 1000,
+  parallelism: 1,
+};
+
+/**
+ * Options for one replay run
+ */
+export interface ReplayRunOptions {
+  /** Reset every projector and ignore stored checkpoints */
+  fromScratch?: boolean;
+
+  /** Start position for projectors without a checkpoint */
+  from?: ReplayPosition;
+
+  /** Stop as soon as possible when aborted */
+  signal?: AbortSignal;
+}
+
+/**
+ * Outcome of a replay run
+ */
+export interface ReplayReport {
+  /** Entries read from the ledger */
+  entriesRead: number;
+
+  /** Entries applied, by projector */
+  applied: Record<string, number>;
+
+  /** Whether the run stopped early because its signal was aborted */
+  aborted: boolean;
+}
+
+/**
+ * In-memory progress of one projector during a run
+ */
+interface ProjectorState {
+  projector: Projector;
+  position: ReplayPosition | null;
+  applied: Set<string>;
+  count: number;
+}
+
+/**
+ * Replay Engine Implementation
+ */
+export class ReplayEngine {
+  private ledgerService: ILedgerService;
+  private checkpoints: IReplayCheckpointStore;
+  private config: ReplayConfig;
+  private projectors: Projector[] = [];
+
+  constructor(
+    ledgerService: ILedgerService,
+    checkpoints: IReplayCheckpointStore = new InMemoryCheckpointStore(),
+    config: Partial<ReplayConfig> = {}
+  ) {
+    this.ledgerService = ledgerService;
+    this.checkpoints = checkpoints;
+    this.config = { ...DEFAULT_CONFIG, ...config };
+
+    if (!Number.isInteger(this.config.batchSize) || this.config.batchSize < 1) {
+      throw new Error('batchSize must be a positive integer');
+    }
+
+    if (!Number.isInteger(this.config.parallelism) || this.config.parallelism < 1) {
+      throw new Error('parallelism must be a positive integer');
+    }
+  }
+
+  /**
+   * Register a projector
+   *
+   * @throws Error if a projector with the same name is registered
+   */
+  register(projector: Projector): this {
+    if (this.projectors.some(registered => registered.name === projector.name)) {
+      throw new Error(`Projector already registered: ${projector.name}`);
+    }
+    this.projectors.push(projector);
+    return this;
+  }
+
+  /**
+   * Stream the ledger through every registered projector until caught up
+   */
+  async run(options: ReplayRunOptions = {}): Promise<ReplayReport> {
+    const states = await this.loadStates(options);
+    const report: ReplayReport = { entriesRead: 0, applied: {}, aborted: false };
+
+    // Stream from the earliest projector position
+    let after: ReplayPosition | null = null;
+    if (states.length > 0 && states.every(state => state.position !== null)) {
+      after = states
+        .map(state => state.position!)
+        .reduce((earliest, position) => (comparePositions(position, earliest) < 0 ? position : earliest));
+    }
+
+    try {
+      while (states.length > 0) {
+        if (options.signal?.aborted) {
+          report.aborted = true;
+          break;
+        }
+
+        const batch = await this.readBatch(after);
+        if (batch.length === 0) {
+          break;
+        }
+        report.entriesRead += batch.length;
+
+        await this.applyBatch(batch, states, options.signal);
+        if (options.signal?.aborted) {
+          report.aborted = true;
+          break;
+        }
+
+        const last = positionOf(batch[batch.length - 1]);
+        for (const state of states) {
+          if (state.position === null || comparePositions(last, state.position) > 0) {
+            state.position = last;
+            state.applied.clear();
+          }
+          await this.save(state);
+        }
+        after = last;
+      }
+    } finally {
+      // Exact checkpoints for a partly applied batch
+      for (const state of states) {
+        if (state.applied.size > 0) {
+          await this.save(state);
+        }
+        report.applied[state.projector.name] = state.count;
+      }
+    }
+
+    return report;
+  }
+
+  /**
+   * Load each projector's checkpoint, or reset it for a rebuild
+   */
+  private async loadStates(options: ReplayRunOptions): Promise<ProjectorState[]> {
+    const states: ProjectorState[] = [];
+
+    for (const projector of this.projectors) {
+      let checkpoint: ReplayCheckpoint | null = null;
+      if (options.fromScratch) {
+        await projector.reset?.();
+      } else {
+        checkpoint = await this.checkpoints.load(projector.name);
+      }
+
+      states.push({
+        projector,
+        position: checkpoint ? checkpoint.position : options.from || null,
+        applied: new Set(checkpoint ? checkpoint.applied : []),
+        count: 0,
+      });
+    }
+
+    return states;
+  }
+
+  /**
+   * Read the next batch of entries after a position
+   * Relies on the ledger service ordering ties on timestamp by entry ID.
+   */
+  private async readBatch(after: ReplayPosition | null): Promise<LedgerEntry[]> {
+    const batch: LedgerEntry[] = [];
+    let offset = 0;
+
+    while (batch.length < this.config.batchSize) {
+      const page = await this.ledgerService.queryEntries({
+        startDate: after ? after.timestamp : undefined,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: this.config.batchSize,
+      });
+
+      for (const entry of page.entries) {
+        if (!after || comparePositions(positionOf(entry), after) > 0) {
+          batch.push(entry);
+        }
+      }
+
+      offset += page.entries.length;
+      if (!page.hasMore || page.entries.length === 0) {
+        break;
+      }
+    }
+
+    return batch.slice(0, this.config.batchSize);
+  }
+
+  /**
+   * Apply a batch, account by account across the worker pool
+   */
+  private async applyBatch(batch: LedgerEntry[], states: ProjectorState[], signal?: AbortSignal): Promise<void> {
+    const byAccount = new Map<string, LedgerEntry[]>();
+    for (const entry of batch) {
+      const key = `${entry.accountType}:${entry.accountId}`;
+      if (!byAccount.has(key)) {
+        byAccount.set(key, []);
+      }
+      byAccount.get(key)!.push(entry);
+    }
+
+    const groups = [...byAccount.values()];
+    let next = 0;
+    let failed = false;
+
+    const worker = async () => {
+      while (!failed && !signal?.aborted && next < groups.length) {
+        const group = groups[next++];
+        for (const entry of group) {
+          if (failed || signal?.aborted) {
+            return;
+          }
+          await this.applyEntry(entry, states);
+        }
+      }
+    };
+
+    const workers = Array.from({ length: Math.min(this.config.parallelism, groups.length) }, async () => {
+      try {
+        await worker();
+      } catch (error) {
+        failed = true;
+        throw error;
+      }
+    });
+
+    const results = await Promise.allSettled(workers);
+    const failure = results.find(result => result.status === 'rejected');
+    if (failure) {
+      throw (failure as PromiseRejectedResult).reason;
+    }
+  }
+
+  /**
+   * Apply one entry to every projector that has not seen it
+   */
+  private async applyEntry(entry: LedgerEntry, states: ProjectorState[]): Promise<void> {
+    const position = positionOf(entry);
+
+    for (const state of states) {
+      const seen =
+        (state.position !== null && comparePositions(position, state.position) <= 0) ||
+        state.applied.has(entry.entryId);
+      if (seen) {
+        continue;
+      }
+
+      await state.projector.apply(entry);
+      state.applied.add(entry.entryId);
+      state.count++;
+    }
+  }
+
+  private async save(state: ProjectorState): Promise<void> {
+    await this.checkpoints.save(state.projector.name, {
+      position: state.position,
+      applied: [...state.applied],
+    });
+  }
+}
+
+/**
+ * Order two stream positions
+ */
+export function comparePositions(a: ReplayPosition, b: ReplayPosition): number {
+  const byTime = new Date(a.timestamp).getTime() - new Date(b.timestamp).getTime();
+  if (byTime !== 0) {
+    return byTime;
+  }
+  return a.entryId < b.entryId ? -1 : a.entryId > b.entryId ? 1 : 0;
+}
+
+function positionOf(entry: LedgerEntry): ReplayPosition {
+  return { timestamp: entry.timestamp, entryId: entry.entryId };
+}
+
+/**
+ * Factory function to create a replay engine
+ */
+export function createReplayEngine(
+  ledgerService: ILedgerService,
+  checkpoints?: IReplayCheckpointStore,
+  config?: Partial<ReplayConfig>
+): ReplayEngine {
+  return new ReplayEngine(ledgerService, checkpoints, config);
+}
@@ -0,0 +1,60 @@
+/**
+ * Replica Lag Tests
+ */
+
+import { CheckpointSource, replicaLag } from './replica-lag';
+
+describe('replicaLag', () => {
+  const store = (count: number, highWaterMark: string | null): CheckpointSource => ({
+    getCheckpoint: jest.fn().mockResolvedValue({
+      count,
+      highWaterMark: highWaterMark ? new Date(highWaterMark) : null,
+      takenAt: new Date(),
+    }),
+  });
+
+  it('should report the gap of a follower behind its primary', async () => {
+    const report = await replicaLag(
+      store(120, '2024-01-01T12:00:30Z'),
+      store(100, '2024-01-01T12:00:00Z')
+    );
+
+    expect(report).toMatchObject({ sequenceLag: 20, timeLagMs: 30000, followerAhead: false });
+  });
+
+  it('should report no lag for a caught-up follower', async () => {
+    const report = await replicaLag(
+      store(120, '2024-01-01T12:00:30Z'),
+      store(120, '2024-01-01T12:00:30Z')
+    );
+
+    expect(report).toMatchObject({ sequenceLag: 0, timeLagMs: 0, followerAhead: false });
+  });
+
+  it('should clamp and flag a follower ahead of its primary', async () => {
+    const report = await replicaLag(
+      store(100, '2024-01-01T12:00:00Z'),
+      store(105, '2024-01-01T12:00:10Z')
+    );
+
+    expect(report).toMatchObject({ sequenceLag: 0, timeLagMs: 0, followerAhead: true });
+  });
+
+  it('should measure an empty follower against the primary\'s entries', async () => {
+    const report = await replicaLag(store(3, '2024-01-01T12:00:00Z'), store(0, null));
+
+    expect(report.sequenceLag).toBe(3);
+    expect(report.timeLagMs).toBe(Date.parse('2024-01-01T12:00:00Z'));
+    expect(report.followerAhead).toBe(false);
+  });
+
+  it('should read both checkpoints for the tenant', async () => {
+    const primary = store(1, '2024-01-01T12:00:00Z');
+    const follower = store(1, '2024-01-01T12:00:00Z');
+
+    await replicaLag(primary, follower, 'tenant-a');
+
+    expect(primary.getCheckpoint).toHaveBeenCalledWith('tenant-a');
+    expect(follower.getCheckpoint).toHaveBeenCalledWith('tenant-a');
+  });
+});
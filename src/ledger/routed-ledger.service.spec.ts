@@ -0,0 +1,343 @@
+/**
+ * Routed Ledger Service Tests
+ */
+
+import { HashRing, LedgerShard, RoutedLedgerService } from './routed-ledger.service';
+import { ILedgerService, CreateLedgerEntryRequest, LedgerEntry } from './types';
+import { InMemoryLedgerService, verifyImmutability, assertAppendOnly } from './testing';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+const credit = (accountId: string, key: string, amount = 100): CreateLedgerEntryRequest => ({
+  accountId,
+  accountType: 'user',
+  amount,
+  type: TransactionType.CREDIT,
+  balanceState: 'available',
+  stateTransition: 'none→available',
+  reason: TransactionReason.PROMOTIONAL_AWARD,
+  idempotencyKey: key,
+  requestId: `req-${key}`,
+  balanceBefore: 0,
+  balanceAfter: amount,
+  correlationId: `ref-${key}`,
+});
+
+const users = Array.from({ length: 24 }, (_, i) => `user-${i}`);
+
+const member = (name: string): LedgerShard => ({ name, ledger: new InMemoryLedgerService(name) });
+
+/**
+ * Optional contract stages a store opts into
+ */
+interface ContractStages {
+  /** Run the immutability harness; `skip` lists methods it must not call */
+  immutability?: { skip?: string[] };
+
+  /** Run the randomized append-only property (needs one append order across the store) */
+  appendOnly?: { operations: number };
+}
+
+// Behaviours every ledger shows, run against one store and a routed pair
+describe.each<[string, () => ILedgerService, ContractStages]>([
+  ['a single store', () => new InMemoryLedgerService(), { immutability: {}, appendOnly: { operations: 300 } }],
+  // addMember needs a real shard and is covered below
+  ['a two-member routed store', () => new RoutedLedgerService([member('a'), member('b')]), { immutability: { skip: ['addMember'] } }],
+])('ledger contract on %s', (_, build, stages) => {
+  let ledger: ILedgerService;
+
+  beforeEach(async () => {
+    ledger = build();
+    for (const [i, userId] of users.entries()) {
+      await ledger.createEntry(credit(userId, `grant-${i}`, 100 + i));
+    }
+  });
+
+  it('replays a repeated idempotency key', async () => {
+    const first = await ledger.createEntry(credit('user-3', 'again', 40));
+    const second = await ledger.createEntry(credit('user-3', 'again', 40));
+
+    expect(second.entryId).toBe(first.entryId);
+    expect((await ledger.getBalanceSnapshot('user-3', 'user')).availableBalance).toBe(103 + 40);
+  });
+
+  it('pages an account history in order', async () => {
+    await ledger.createEntry(credit('user-5', 'second'));
+    await ledger.createEntry(credit('user-5', 'third'));
+
+    const first = await ledger.queryEntries({ accountId: 'user-5', sortOrder: 'asc', limit: 2 });
+    const rest = await ledger.queryEntries({ accountId: 'user-5', sortOrder: 'asc', offset: 2, limit: 2 });
+
+    expect([...first.entries, ...rest.entries].map(e => e.idempotencyKey)).toEqual(['grant-5', 'second', 'third']);
+    expect(first).toMatchObject({ totalCount: 3, hasMore: true });
+    expect(rest.hasMore).toBe(false);
+  });
+
+  it('lists and counts every entry once across the store', async () => {
+    const all = await ledger.queryEntries({ sortBy: 'amount', sortOrder: 'desc', limit: 1000 });
+    const page = await ledger.queryEntries({ sortBy: 'amount', sortOrder: 'desc', offset: 5, limit: 3 });
+
+    expect(all.totalCount).toBe(users.length);
+    expect(all.entries.map(e => e.amount)).toEqual(users.map((__, i) => 100 + i).reverse());
+    expect(page.entries.map(e => e.amount)).toEqual([118, 117, 116]);
+  });
+
+  it('finds entries by ID and transaction', async () => {
+    const entry = await ledger.createEntry({ ...credit('user-7', 'tx-1'), transactionId: 'txn-shared' });
+    await ledger.createEntry({ ...credit('user-8', 'tx-2'), transactionId: 'txn-shared' });
+
+    expect(await ledger.getEntry(entry.entryId)).toMatchObject({ idempotencyKey: 'tx-1' });
+    expect(await ledger.entryExists(entry.entryId)).toBe(true);
+    expect(await ledger.getEntry('missing')).toBeNull();
+    expect((await ledger.getAuditTrail('txn-shared')).map(a => a.ledgerEntry.accountId).sort()).toEqual(['user-7', 'user-8']);
+  });
+
+  it('keeps idempotency records', async () => {
+    await ledger.storeIdempotencyResult('op-1', 'redeem', { ok: true }, 200, 60);
+
+    expect(await ledger.checkIdempotency('op-1', 'redeem')).toBe(true);
+    expect(await ledger.checkIdempotency('op-2', 'redeem')).toBe(false);
+  });
+
+  (stages.immutability ? it : it.skip)('cannot alter or remove an entry (immutability)', async () => {
+    const report = await verifyImmutability(ledger, {
+      fixtures: [credit('user-30', 'fixture-1'), credit('user-31', 'fixture-2', 250)],
+      skip: stages.immutability?.skip,
+    });
+
+    expect(report).toMatchObject({ passed: true, altered: [], missing: [] });
+    expect(report.exercised).toEqual(expect.arrayContaining(['createEntry', 'queryEntries', 'getBalanceSnapshot']));
+  });
+
+  (stages.appendOnly ? it : it.skip)('only ever appends (randomized)', async () => {
+    for (const seed of [1, 2, 3]) {
+      await assertAppendOnly(ledger, { operations: stages.appendOnly!.operations, seed });
+    }
+  });
+});
+
+describe('HashRing', () => {
+  it('only moves keys onto an added member', () => {
+    const ring = new HashRing(['a', 'b']);
+    const grown = ring.withMember('c');
+    const keys = Array.from({ length: 500 }, (_, i) => `user-${i}`);
+
+    const moved = keys.filter(key => ring.ownerOf(key) !== grown.ownerOf(key));
+
+    expect(moved.every(key => grown.ownerOf(key) === 'c')).toBe(true);
+    expect(moved.length).toBeGreaterThan(80);
+    expect(moved.length).toBeLessThan(260);
+  });
+});
+
+describe('RoutedLedgerService', () => {
+  let a: LedgerShard;
+  let b: LedgerShard;
+  let routed: RoutedLedgerService;
+
+  const memberOf = (shard: LedgerShard) => shard.ledger as InMemoryLedgerService;
+
+  beforeEach(async () => {
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    a = member('a');
+    b = member('b');
+    routed = new RoutedLedgerService([a, b]);
+    for (const [i, userId] of users.entries()) {
+      await routed.createEntry(credit(userId, `grant-${i}`));
+    }
+  });
+
+  it('rejects an empty or duplicated member list', () => {
+    expect(() => new RoutedLedgerService([])).toThrow('at least one member');
+    expect(() => new RoutedLedgerService([member('a'), member('a')])).toThrow('Duplicate member name: a');
+  });
+
+  it('keeps each account on the member owning it', async () => {
+    expect(memberOf(a).size).toBeGreaterThan(0);
+    expect(memberOf(b).size).toBeGreaterThan(0);
+    expect(memberOf(a).size + memberOf(b).size).toBe(users.length);
+
+    for (const userId of users) {
+      const owner = routed.ownerOf(userId) === 'a' ? a : b;
+      expect((await owner.ledger.queryEntries({ accountId: userId })).totalCount).toBe(1);
+    }
+  });
+
+  it('rejects two members holding different entries under one ID', async () => {
+    const [entry] = (await a.ledger.queryEntries({ limit: 1 })).entries;
+    await b.ledger.importEntry({ ...entry, idempotencyKey: 'forged', accountId: 'someone-else' });
+
+    await expect(routed.getEntry(entry.entryId)).rejects.toThrow(`Entry ID ${entry.entryId} is held by different entries`);
+    await expect(routed.queryEntries({})).rejects.toThrow('held by different entries');
+  });
+
+  it('reads only each member\'s leading entries for a store-wide page', async () => {
+    const reads = [jest.spyOn(a.ledger, 'queryEntries'), jest.spyOn(b.ledger, 'queryEntries')];
+
+    const page = await routed.queryEntries({ sortOrder: 'asc', offset: 4, limit: 3 });
+
+    expect(page.entries).toHaveLength(3);
+    expect(page).toMatchObject({ totalCount: users.length, hasMore: true });
+    for (const read of reads) {
+      for (const [filter] of read.mock.calls) {
+        expect(filter.offset! + filter.limit!).toBeLessThanOrEqual(7);
+      }
+    }
+  });
+
+  it('reports whether an append inserted', async () => {
+    const first = await routed.createEntryWithResult(credit('user-3', 'with-result', 40));
+    const replay = await routed.createEntryWithResult(credit('user-3', 'with-result', 40));
+
+    expect(first.inserted).toBe(true);
+    expect(replay).toMatchObject({ inserted: false, entry: { entryId: first.entry.entryId } });
+  });
+
+  describe('getByReference', () => {
+    const onA = () => users.find(userId => routed.ownerOf(userId) === 'a')!;
+    const onB = () => users.find(userId => routed.ownerOf(userId) === 'b')!;
+    const order = (accountId: string, key: string, amount: number) => ({ ...credit(accountId, key, amount), correlationId: 'order-9' });
+
+    const orderedByTime = (entries: LedgerEntry[]) =>
+      [...entries].sort(
+        (x, y) => new Date(x.timestamp).getTime() - new Date(y.timestamp).getTime() || (x.entryId < y.entryId ? -1 : 1)
+      );
+
+    it('merges a reference spanning two members into one oldest-first list', async () => {
+      const written = [
+        await routed.createEntry(order(onA(), 'order-9-earn', 300)),
+        await routed.createEntry(order(onB(), 'order-9-gift', 50)),
+        await routed.createEntry(order(onA(), 'order-9-bonus', 25)),
+        await routed.createEntry(order(onB(), 'order-9-share', 10)),
+      ];
+
+      const result = await routed.getByReference('order-9');
+
+      expect(result.totalCount).toBe(4);
+      expect(result.entries.map(e => e.entryId)).toEqual(orderedByTime(written).map(e => e.entryId));
+      expect(new Set(result.entries.map(e => e.accountId))).toEqual(new Set([onA(), onB()]));
+      expect((await memberOf(a).getByReference('order-9')).totalCount).toBe(2);
+      expect((await memberOf(b).getByReference('order-9')).totalCount).toBe(2);
+    });
+
+    it('returns a replicated entry once', async () => {
+      const original = await routed.createEntry(order(onA(), 'order-9-earn', 300));
+      await routed.createEntry(order(onB(), 'order-9-gift', 50));
+      await b.ledger.importEntry(original);
+
+      const result = await routed.getByReference('order-9');
+
+      expect(result.totalCount).toBe(2);
+      expect(result.entries.filter(e => e.entryId === original.entryId)).toHaveLength(1);
+    });
+
+    it('pages the merged list across members', async () => {
+      for (let i = 0; i < 6; i++) {
+        await routed.createEntry(order(i % 2 ? onA() : onB(), `order-9-part-${i}`, 10 + i));
+      }
+      const all = (await routed.getByReference('order-9')).entries;
+
+      const page = await routed.getByReference('order-9', { offset: 2, limit: 3 });
+
+      expect(page).toMatchObject({ totalCount: 6, offset: 2, limit: 3, hasMore: true });
+      expect(page.entries.map(e => e.entryId)).toEqual(all.slice(2, 5).map(e => e.entryId));
+      await expect(routed.getByReference('order-none')).resolves.toMatchObject({ entries: [], totalCount: 0 });
+    });
+  });
+
+  describe('addMember', () => {
+    let c: LedgerShard;
+
+    beforeEach(() => {
+      c = member('c');
+    });
+
+    it('copies the accounts the new member owns and then routes them there', async () => {
+      const before = new Map(users.map(userId => [userId, routed.ownerOf(userId)]));
+
+      const report = await routed.addMember(c);
+
+      const moving = users.filter(userId => routed.ownerOf(userId) === 'c');
+      expect(moving.length).toBeGreaterThan(0);
+      expect(report).toEqual({ member: 'c', movedAccounts: expect.arrayContaining(moving), copiedEntries: moving.length });
+      expect(report.movedAccounts).toHaveLength(moving.length);
+      for (const userId of users.filter(u => !moving.includes(u))) {
+        expect(routed.ownerOf(userId)).toBe(before.get(userId));
+      }
+
+      // The copy keeps IDs, and the old owner keeps its entries
+      const userId = moving[0];
+      const old = before.get(userId) === 'a' ? a : b;
+      const [original] = (await old.ledger.queryEntries({ accountId: userId })).entries;
+      expect((await c.ledger.queryEntries({ accountId: userId })).entries).toEqual([original]);
+
+      const all = await routed.queryEntries({ limit: 1000 });
+      expect(all.totalCount).toBe(users.length);
+      expect(new Set(all.entries.map(e => e.entryId)).size).toBe(users.length);
+      expect(await routed.getEntry(original.entryId)).toEqual(original);
+    });
+
+    it('sends later writes and replays of a moved account to its new owner', async () => {
+      await routed.addMember(c);
+      const userId = users.find(u => routed.ownerOf(u) === 'c')!;
+      const index = users.indexOf(userId);
+
+      const replay = await routed.createEntry(credit(userId, `grant-${index}`));
+      await routed.createEntry(credit(userId, 'after-move', 25));
+
+      expect(replay.idempotencyKey).toBe(`grant-${index}`);
+      expect((await routed.getBalanceSnapshot(userId, 'user')).availableBalance).toBe(125);
+      expect((await c.ledger.queryEntries({ accountId: userId })).totalCount).toBe(2);
+    });
+
+    it('carries over writes made while an account is being copied', async () => {
+      const importEntry = memberOf(c).importEntry.bind(memberOf(c));
+      const written: Promise<LedgerEntry>[] = [];
+      let mover = '';
+      jest.spyOn(memberOf(c), 'importEntry').mockImplementation(async (entry: LedgerEntry) => {
+        // The first copied account gets a write while its copy runs
+        if (!mover) {
+          mover = entry.accountId;
+          written.push(routed.createEntry(credit(mover, 'during-copy', 7)));
+        }
+        return importEntry(entry);
+      });
+
+      await routed.addMember(c);
+      await Promise.all(written);
+
+      expect(routed.ownerOf(mover)).toBe('c');
+      const history = await routed.queryEntries({ accountId: mover, sortOrder: 'asc' });
+      expect(history.entries.map(e => e.idempotencyKey)).toContain('during-copy');
+      expect((await routed.getBalanceSnapshot(mover, 'user')).availableBalance).toBe(107);
+    });
+
+    it('leaves an account on its old owner while its copy does not verify', async () => {
+      const importEntry = memberOf(c).importEntry.bind(memberOf(c));
+      const spy = jest
+        .spyOn(memberOf(c), 'importEntry')
+        .mockImplementationOnce(async (entry: LedgerEntry) => importEntry({ ...entry, amount: entry.amount + 1 }));
+
+      await expect(routed.addMember(c)).rejects.toThrow('does not match');
+      const stalled = (await c.ledger.queryEntries({})).entries[0].accountId;
+      expect(routed.ownerOf(stalled)).not.toBe('c');
+      await expect(routed.addMember(member('d'))).rejects.toThrow('Resharding onto c is already in progress');
+
+      // The bad copy is kept (append-only) and keeps failing verification
+      spy.mockRestore();
+      await expect(routed.addMember(c)).rejects.toThrow('does not match');
+      expect(routed.ownerOf(stalled)).not.toBe('c');
+    });
+
+    it('resumes a move interrupted by a failed copy', async () => {
+      const importEntry = memberOf(c).importEntry.bind(memberOf(c));
+      jest.spyOn(memberOf(c), 'importEntry').mockRejectedValueOnce(new Error('member unavailable')).mockImplementation(importEntry);
+
+      await expect(routed.addMember(c)).rejects.toThrow('member unavailable');
+      const report = await routed.addMember(c);
+
+      expect(report.movedAccounts.length).toBe(users.filter(u => routed.ownerOf(u) === 'c').length);
+      expect((await routed.queryEntries({ limit: 1000 })).totalCount).toBe(users.length);
+    });
+  });
+});
@@ -0,0 +1,576 @@
+/**
+ * Routed Ledger Service
+ *
+ * Partitions accounts across several member ledgers. Each account is
+ * owned by one member, chosen by consistent hashing on the account ID,
+ * and every account-scoped call goes to its owner: appends, queries
+ * filtered by accountId, balance snapshots and reconciliation. An
+ * account's whole history therefore lives on one member, which enforces
+ * its idempotency keys exactly as a single ledger would.
+ *
+ * Calls that are not account-scoped fan out to every member and merge:
+ * queries without an accountId, getEntry, entryExists, audit trails and
+ * getByReference, as one reference can span accounts on several members.
+ * Merged entries are deduplicated by entry ID and sorted with the entry
+ * ID as tie-break, so the result never depends on which member answered
+ * first. Two members holding different entries under one ID is an error.
+ * A query without an accountId reads only the first offset + limit
+ * entries of each member, and its totalCount is the members' counts
+ * summed, so it also counts the old copies a reshard left behind.
+ *
+ * addMember() reshards onto a new member. For each account the new
+ * member takes over, the account's history is copied entry for entry
+ * (IDs, timestamps and signatures kept) while writes continue; then the
+ * account's writes are held, the copy catches up, the two histories are
+ * compared, and only then does the account's routing flip. Fan-out reads
+ * include the new member from the start, and copies are deduplicated by
+ * entry ID, so reads during the move see each entry once. Old copies are
+ * never deleted: the ledger is append-only.
+ *
+ * Members must store account IDs as given (no user ID tokenizer), since
+ * resharding routes the account IDs it finds in the stored entries.
+ */
+
+import { createHash } from 'crypto';
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  CreateLedgerEntryResult,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * A ledger that can take entries recorded by another ledger as they were
+ */
+export interface ShardLedger extends ILedgerService {
+  createEntryWithResult(request: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult>;
+  importEntry(entry: LedgerEntry): Promise<CreateLedgerEntryResult>;
+  getByReference(reference: string, options?: ReferenceReadOptions): Promise<LedgerQueryResult>;
+}
+
+/**
+ * Paging and tenant options of a reference lookup
+ */
+export interface ReferenceReadOptions {
+  offset?: number;
+  limit?: number;
+  tenantId?: string;
+}
+
+/**
+ * A member ledger and the name it is placed on the ring under
+ */
+export interface LedgerShard {
+  name: string;
+  ledger: ShardLedger;
+}
+
+/**
+ * Outcome of adding a member
+ */
+export interface ReshardReport {
+  member: string;
+
+  /** Accounts now owned by the new member */
+  movedAccounts: string[];
+
+  /** Entries written to the new member (replayed copies not counted) */
+  copiedEntries: number;
+}
+
+/**
+ * Configuration for the routed ledger
+ */
+export interface RoutedLedgerConfig {
+  /** Points each member places on the ring; more points spread accounts more evenly */
+  virtualNodes: number;
+
+  /** Entries read per page when scanning or copying */
+  pageSize: number;
+}
+
+const DEFAULT_CONFIG: RoutedLedgerConfig = {
+  virtualNodes: 64,
+  pageSize: 500,
+};
+
+function hash32(value: string): number {
+  return createHash('sha256').update(value).digest().readUInt32BE(0);
+}
+
+/**
+ * Consistent-hash ring over member names
+ * Adding a member only moves keys onto the new member.
+ */
+export class HashRing {
+  readonly members: string[];
+  private virtualNodes: number;
+  private points: { hash: number; member: string }[];
+
+  constructor(members: string[], virtualNodes = DEFAULT_CONFIG.virtualNodes) {
+    this.members = [...members];
+    this.virtualNodes = virtualNodes;
+    this.points = members
+      .flatMap(member => Array.from({ length: virtualNodes }, (_, i) => ({ hash: hash32(`${member}#${i}`), member })))
+      .sort((a, b) => a.hash - b.hash || (a.member < b.member ? -1 : 1));
+  }
+
+  /**
+   * Member owning a key: the first point at or after the key's hash
+   */
+  ownerOf(key: string): string {
+    const target = hash32(key);
+    let low = 0;
+    let high = this.points.length;
+    while (low < high) {
+      const mid = (low + high) >>> 1;
+      if (this.points[mid].hash < target) {
+        low = mid + 1;
+      } else {
+        high = mid;
+      }
+    }
+    return this.points[low % this.points.length].member;
+  }
+
+  withMember(member: string): HashRing {
+    return new HashRing([...this.members, member], this.virtualNodes);
+  }
+}
+
+/**
+ * A reshard in progress
+ */
+interface Move {
+  shard: LedgerShard;
+  ring: HashRing;
+
+  /** Accounts copied, verified and routed to the new member */
+  moved: Set<string>;
+}
+
+/**
+ * Writes in flight for one account
+ */
+interface InFlight {
+  count: number;
+  waiters: (() => void)[];
+}
+
+/**
+ * RoutedLedgerService implementation
+ */
+export class RoutedLedgerService implements ILedgerService {
+  private config: RoutedLedgerConfig;
+  private shards = new Map<string, LedgerShard>();
+  private ring: HashRing;
+  private move?: Move;
+  private gates = new Map<string, Promise<void>>();
+  private inFlight = new Map<string, InFlight>();
+
+  constructor(shards: LedgerShard[], config: Partial<RoutedLedgerConfig> = {}) {
+    if (shards.length === 0) {
+      throw new Error('Routed ledger needs at least one member');
+    }
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    for (const shard of shards) {
+      if (this.shards.has(shard.name)) {
+        throw new Error(`Duplicate member name: ${shard.name}`);
+      }
+      this.shards.set(shard.name, shard);
+    }
+    this.ring = new HashRing(shards.map(shard => shard.name), this.config.virtualNodes);
+  }
+
+  /**
+   * Member an account's calls are routed to
+   */
+  ownerOf(accountId: string): string {
+    if (this.move && this.move.moved.has(accountId)) {
+      return this.move.shard.name;
+    }
+    return this.ring.ownerOf(accountId);
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return this.write(request.accountId, ledger => ledger.createEntry(request));
+  }
+
+  /**
+   * Append on the account's owner, reporting whether it inserted
+   */
+  async createEntryWithResult(request: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult> {
+    return this.write(request.accountId, ledger => ledger.createEntryWithResult(request));
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    if (filter.accountId) {
+      return this.ownerLedger(filter.accountId).queryEntries(filter);
+    }
+
+    const offset = filter.offset || 0;
+    const limit = Math.min(filter.limit || 100, 1000);
+    // The page lies within the members' first offset + limit entries
+    const windows = await Promise.all(
+      [...this.shards.values()].map(async shard => ({
+        member: shard.name,
+        ...(await this.readLeading(shard.ledger, filter, offset + limit)),
+      }))
+    );
+    const merged = this.merge(
+      windows.flatMap(window => window.entries.map(entry => ({ member: window.member, entry }))),
+      filter
+    );
+
+    return {
+      entries: merged.slice(offset, offset + limit),
+      totalCount: Math.max(merged.length, windows.reduce((sum, window) => sum + window.totalCount, 0)),
+      offset,
+      limit,
+      hasMore: offset + limit < merged.length || windows.some(window => window.truncated),
+    };
+  }
+
+  /**
+   * Entries carrying a reference across every member, oldest first
+   * Each member is read in full concurrently, then merged and paged.
+   */
+  async getByReference(reference: string, options: ReferenceReadOptions = {}): Promise<LedgerQueryResult> {
+    const offset = options.offset || 0;
+    const limit = Math.min(options.limit || 100, 1000);
+    const lists = await Promise.all(
+      [...this.shards.values()].map(async shard =>
+        (
+          await this.readPages((pageOffset, pageLimit) =>
+            shard.ledger.getByReference(reference, { tenantId: options.tenantId, offset: pageOffset, limit: pageLimit })
+          )
+        ).map(entry => ({ member: shard.name, entry }))
+      )
+    );
+    const merged = this.merge(lists.flat(), { sortBy: 'timestamp', sortOrder: 'asc' });
+
+    return {
+      entries: merged.slice(offset, offset + limit),
+      totalCount: merged.length,
+      offset,
+      limit,
+      hasMore: offset + limit < merged.length,
+    };
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    const found = await Promise.all(
+      [...this.shards.values()].map(async shard => ({ member: shard.name, entry: await shard.ledger.getEntry(entryId) }))
+    );
+    const held = found.filter((f): f is { member: string; entry: LedgerEntry } => f.entry !== null);
+    return held.length > 0 ? this.merge(held, {})[0] : null;
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    const found = await Promise.all([...this.shards.values()].map(shard => shard.ledger.entryExists(entryId)));
+    return found.some(Boolean);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.ownerLedger(accountId).getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.ownerLedger(accountId).generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  /**
+   * Audit trail across members; a transaction's entries of different
+   * accounts may live on different members
+   */
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    const trails = await Promise.all(
+      [...this.shards.values()].map(async shard =>
+        (await shard.ledger.getAuditTrail(transactionId)).map(audit => ({ member: shard.name, entry: audit.ledgerEntry, audit }))
+      )
+    );
+    const audits = new Map(trails.flat().map(t => [t.entry.entryId, t.audit]));
+    return this.merge(trails.flat(), { sortBy: 'timestamp', sortOrder: 'asc' }).map(entry => audits.get(entry.entryId)!);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    const found = await Promise.all(
+      [...this.shards.values()].map(shard => shard.ledger.checkIdempotency(key, operationType))
+    );
+    return found.some(Boolean);
+  }
+
+  /**
+   * Stored on the member owning the key; checkIdempotency asks every
+   * member, so records survive a reshard moving the key
+   */
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.shards
+      .get(this.ring.ownerOf(`idempotency:${key}`))!
+      .ledger.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  /**
+   * Add a member and move onto it the accounts it now owns
+   * A failed move leaves the failing account on its old owner; calling
+   * addMember again with the same member resumes.
+   *
+   * @throws Error if another reshard is in progress, or a copy does not match its original
+   */
+  async addMember(shard: LedgerShard): Promise<ReshardReport> {
+    if (this.move && this.move.shard.name !== shard.name) {
+      throw new Error(`Resharding onto ${this.move.shard.name} is already in progress`);
+    }
+    if (!this.move) {
+      if (this.shards.has(shard.name)) {
+        throw new Error(`Duplicate member name: ${shard.name}`);
+      }
+      this.move = { shard, ring: this.ring.withMember(shard.name), moved: new Set() };
+      this.shards.set(shard.name, shard);
+    }
+
+    const move = this.move;
+    const moving = await this.accountsMovingTo(move);
+    let copiedEntries = 0;
+    for (const [accountId, from] of moving) {
+      copiedEntries += await this.moveAccount(accountId, this.shards.get(from)!, move);
+    }
+
+    this.ring = move.ring;
+    const movedAccounts = [...move.moved];
+    this.move = undefined;
+    return { member: shard.name, movedAccounts, copiedEntries };
+  }
+
+  /**
+   * Accounts the new ring gives to the new member, with their current owners
+   * Stale copies left on earlier owners are passed over.
+   */
+  private async accountsMovingTo(move: Move): Promise<Map<string, string>> {
+    const moving = new Map<string, string>();
+
+    for (const shard of this.shards.values()) {
+      if (shard.name === move.shard.name) {
+        continue;
+      }
+      for (const entry of await this.readAll(shard.ledger, { sortBy: 'timestamp', sortOrder: 'asc' })) {
+        const accountId = entry.accountId;
+        if (
+          !move.moved.has(accountId) &&
+          this.ring.ownerOf(accountId) === shard.name &&
+          move.ring.ownerOf(accountId) === move.shard.name
+        ) {
+          moving.set(accountId, shard.name);
+        }
+      }
+    }
+
+    return moving;
+  }
+
+  /**
+   * Copy, hold writes, catch up, verify, then route the account to the new member
+   *
+   * @returns Entries written to the new member
+   */
+  private async moveAccount(accountId: string, from: LedgerShard, move: Move): Promise<number> {
+    let copied = await this.copyHistory(accountId, from, move.shard);
+
+    const reopen = await this.holdWrites(accountId);
+    try {
+      copied += await this.copyHistory(accountId, from, move.shard);
+      await this.verifyCopy(accountId, from, move.shard);
+      move.moved.add(accountId);
+    } finally {
+      reopen();
+    }
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_SHARD_ACCOUNT_MOVED, {
+      accountId,
+      from: from.name,
+      to: move.shard.name,
+      copiedEntries: copied,
+    });
+    return copied;
+  }
+
+  private async copyHistory(accountId: string, from: LedgerShard, to: LedgerShard): Promise<number> {
+    let copied = 0;
+    for (const entry of await this.history(from.ledger, accountId)) {
+      if ((await to.ledger.importEntry(entry)).inserted) {
+        copied++;
+      }
+    }
+    return copied;
+  }
+
+  /**
+   * @throws Error unless the copy holds the same entries in the same order
+   */
+  private async verifyCopy(accountId: string, from: LedgerShard, to: LedgerShard): Promise<void> {
+    const fingerprint = (entries: LedgerEntry[]) =>
+      JSON.stringify(entries.map(e => [e.entryId, e.idempotencyKey, e.amount, e.balanceState, e.signature]));
+    const [original, copy] = await Promise.all([this.history(from.ledger, accountId), this.history(to.ledger, accountId)]);
+
+    if (fingerprint(original) !== fingerprint(copy)) {
+      throw new Error(`Copy of account ${accountId} on ${to.name} does not match ${from.name}`);
+    }
+  }
+
+  private history(ledger: ILedgerService, accountId: string): Promise<LedgerEntry[]> {
+    return this.readAll(ledger, { accountId, sortBy: 'timestamp', sortOrder: 'asc' });
+  }
+
+  private readAll(ledger: ILedgerService, filter: LedgerQueryFilter): Promise<LedgerEntry[]> {
+    return this.readPages((offset, limit) => ledger.queryEntries({ ...filter, offset, limit }));
+  }
+
+  /**
+   * A member's first count entries for a query, with its total and
+   * whether it holds more
+   */
+  private async readLeading(
+    ledger: ILedgerService,
+    filter: LedgerQueryFilter,
+    count: number
+  ): Promise<{ entries: LedgerEntry[]; totalCount: number; truncated: boolean }> {
+    const entries: LedgerEntry[] = [];
+    let totalCount = 0;
+    let hasMore = true;
+
+    while (hasMore && entries.length < count) {
+      const page = await ledger.queryEntries({
+        ...filter,
+        offset: entries.length,
+        limit: Math.min(this.config.pageSize, count - entries.length),
+      });
+      entries.push(...page.entries);
+      totalCount = page.totalCount;
+      hasMore = page.hasMore && page.entries.length > 0;
+    }
+
+    return { entries, totalCount, truncated: hasMore };
+  }
+
+  private async readPages(read: (offset: number, limit: number) => Promise<LedgerQueryResult>): Promise<LedgerEntry[]> {
+    const entries: LedgerEntry[] = [];
+    let hasMore = true;
+
+    while (hasMore) {
+      const page = await read(entries.length, this.config.pageSize);
+      entries.push(...page.entries);
+      hasMore = page.hasMore && page.entries.length > 0;
+    }
+
+    return entries;
+  }
+
+  /**
+   * Deduplicate by entry ID and sort as the ledger does, entry ID breaking ties
+   *
+   * @throws Error if two members hold different entries under one ID
+   */
+  private merge(found: { member: string; entry: LedgerEntry }[], filter: LedgerQueryFilter): LedgerEntry[] {
+    const byId = new Map<string, { member: string; entry: LedgerEntry }>();
+
+    for (const item of found) {
+      const held = byId.get(item.entry.entryId);
+      if (!held) {
+        byId.set(item.entry.entryId, item);
+      } else if (
+        held.entry.idempotencyKey !== item.entry.idempotencyKey ||
+        held.entry.accountId !== item.entry.accountId ||
+        held.entry.amount !== item.entry.amount
+      ) {
+        throw new Error(`Entry ID ${item.entry.entryId} is held by different entries on ${held.member} and ${item.member}`);
+      }
+    }
+
+    const value = (entry: LedgerEntry) =>
+      filter.sortBy === 'amount' ? entry.amount : new Date(entry.timestamp).getTime();
+    const direction = filter.sortOrder === 'asc' ? 1 : -1;
+    return [...byId.values()]
+      .map(item => item.entry)
+      .sort((a, b) => {
+        const byField = value(a) - value(b);
+        return direction * (byField || (a.entryId < b.entryId ? -1 : a.entryId > b.entryId ? 1 : 0));
+      });
+  }
+
+  private ownerLedger(accountId: string): ShardLedger {
+    return this.shards.get(this.ownerOf(accountId))!.ledger;
+  }
+
+  /**
+   * Run a write on the account's owner once its writes are not held
+   */
+  private async write<T>(accountId: string, run: (ledger: ShardLedger) => Promise<T>): Promise<T> {
+    while (this.gates.has(accountId)) {
+      await this.gates.get(accountId);
+    }
+
+    const calls = this.inFlight.get(accountId) || { count: 0, waiters: [] };
+    calls.count++;
+    this.inFlight.set(accountId, calls);
+
+    try {
+      return await run(this.ownerLedger(accountId));
+    } finally {
+      calls.count--;
+      if (calls.count === 0) {
+        this.inFlight.delete(accountId);
+        calls.waiters.forEach(resolve => resolve());
+      }
+    }
+  }
+
+  /**
+   * Hold new writes for an account and wait for those in flight
+   *
+   * @returns Function releasing the held writes
+   */
+  private async holdWrites(accountId: string): Promise<() => void> {
+    let release!: () => void;
+    this.gates.set(accountId, new Promise<void>(resolve => (release = resolve)));
+
+    const calls = this.inFlight.get(accountId);
+    if (calls && calls.count > 0) {
+      await new Promise<void>(resolve => calls.waiters.push(resolve));
+    }
+
+    return () => {
+      this.gates.delete(accountId);
+      release();
+    };
+  }
+}
+
+/**
+ * Factory function to create a routed ledger
+ */
+export function createRoutedLedgerService(
+  shards: LedgerShard[],
+  config?: Partial<RoutedLedgerConfig>
+): RoutedLedgerService {
+  return new RoutedLedgerService(shards, config);
+}
@@ -0,0 +1,242 @@
+/**
+ * Startup Self-Check Tests
+ */
+
+import { generateKeyPairSync } from 'crypto';
+import { selfCheck, CheckLevel, ISelfCheckStore, MongoSelfCheckStore } from './self-check';
+import { signEntry } from './entry-signing';
+import { LedgerEntry } from './types';
+import { ReplayPosition } from './replay';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+const scopedKey = (key: string, scope?: string) => `${scope ?? ''}|${key}`;
+
+/**
+ * Store over in-memory entries and wallet balances
+ */
+class MemoryStore implements ISelfCheckStore {
+  constructor(public entries: LedgerEntry[], public wallets: Record<string, number>, public keyIndex?: Map<string, LedgerEntry>) {}
+
+  async countEntries() {
+    return this.entries.length;
+  }
+
+  async countActiveWallets() {
+    return Object.keys(this.wallets).length;
+  }
+
+  async walletAvailableTotal() {
+    return Object.values(this.wallets).reduce((sum, balance) => sum + balance, 0);
+  }
+
+  async ledgerAvailableTotal() {
+    const latest = new Map<string, number>();
+    for (const entry of this.ordered().filter(e => e.accountType === 'user' && e.balanceState === 'available')) {
+      latest.set(entry.accountId, entry.balanceAfter);
+    }
+    return [...latest.values()].reduce((sum, balance) => sum + balance, 0);
+  }
+
+  async headEntry() {
+    const ordered = this.ordered();
+    return ordered[ordered.length - 1] || null;
+  }
+
+  async sampleEntries(size: number) {
+    return this.entries.slice(0, size);
+  }
+
+  async findByIdempotencyKey(key: string, scope?: string) {
+    const index = this.keyIndex || new Map(this.entries.map(e => [scopedKey(e.idempotencyKey, e.idempotencyScope), e]));
+    return index.get(scopedKey(key, scope)) || null;
+  }
+
+  async scanEntries(after: ReplayPosition | null, limit: number) {
+    return this.ordered()
+      .filter(e => !after || e.timestamp > after.timestamp || (+e.timestamp === +after.timestamp && e.entryId > after.entryId))
+      .slice(0, limit);
+  }
+
+  private ordered() {
+    return [...this.entries].sort((a, b) => +a.timestamp - +b.timestamp || (a.entryId < b.entryId ? -1 : 1));
+  }
+}
+
+describe('selfCheck', () => {
+  const { privateKey, publicKey } = generateKeyPairSync('ed25519');
+  const publicPem = publicKey.export({ type: 'spki', format: 'pem' }).toString();
+
+  const entry = (n: number, accountId: string, balanceBefore: number, amount: number): LedgerEntry => {
+    const e: LedgerEntry = {
+      entryId: `entry-${String(n).padStart(3, '0')}`,
+      transactionId: `tx-${n}`,
+      accountId,
+      accountType: 'user',
+      amount,
+      type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: `key-${n}`,
+      requestId: `req-${n}`,
+      balanceBefore,
+      balanceAfter: balanceBefore + amount,
+      timestamp: new Date(Date.UTC(2024, 0, 1, 0, n)),
+      currency: 'points',
+    };
+    e.signature = signEntry(e, privateKey);
+    return e;
+  };
+
+  const healthyLedger = () => [
+    entry(1, 'user-1', 0, 100),
+    entry(2, 'user-2', 0, 50),
+    entry(3, 'user-1', 100, -30),
+    entry(4, 'user-1', 70, 5),
+  ];
+
+  const names = (report: { checks: { name: string; passed: boolean }[] }) =>
+    report.checks.map(check => [check.name, check.passed]);
+
+  it('passes every level on a consistent ledger', async () => {
+    const store = new MemoryStore(healthyLedger(), { 'user-1': 75, 'user-2': 50 });
+
+    const report = await selfCheck(store, CheckLevel.FULL, { verificationPublicKey: publicPem, pageSize: 2 });
+
+    expect(report.passed).toBe(true);
+    expect(names(report)).toEqual([
+      ['counts', true],
+      ['stats', true],
+      ['head', true],
+      ['sample', true],
+      ['chain', true],
+    ]);
+    expect(report.checks[4].message).toMatch('4 entries replayed across 2 balance chains');
+  });
+
+  it('runs only the checks of the requested level', async () => {
+    const store = new MemoryStore(healthyLedger(), { 'user-1': 75, 'user-2': 50 });
+
+    expect(names(await selfCheck(store, CheckLevel.QUICK)).map(([name]) => name)).toEqual(['counts', 'stats', 'head']);
+    expect(names(await selfCheck(store, CheckLevel.STANDARD)).map(([name]) => name)).toEqual([
+      'counts',
+      'stats',
+      'head',
+      'sample',
+    ]);
+  });
+
+  it('passes on an empty ledger', async () => {
+    const report = await selfCheck(new MemoryStore([], {}), CheckLevel.FULL);
+
+    expect(report.passed).toBe(true);
+    expect(report.checks.find(check => check.name === 'head')!.message).toBe('Ledger is empty');
+  });
+
+  it('fails quick checks on a partially restored ledger', async () => {
+    // Wallets restored from a later backup than the ledger
+    const store = new MemoryStore(healthyLedger().slice(0, 1), { 'user-1': 75, 'user-2': 50, 'user-3': 10 });
+
+    const report = await selfCheck(store, CheckLevel.QUICK);
+
+    expect(report.passed).toBe(false);
+    expect(names(report)).toEqual([
+      ['counts', false],
+      ['stats', false],
+      ['head', true],
+    ]);
+    expect(report.checks[1].message).toBe('Wallet available total 135 does not match ledger total 100');
+  });
+
+  it('fails the head check on a tampered or future head entry', async () => {
+    const tampered = healthyLedger();
+    tampered[3] = { ...tampered[3], amount: 500, balanceAfter: 570 };
+    const future = healthyLedger();
+    future[3] = { ...future[3], timestamp: new Date(Date.now() + 60 * 60 * 1000) };
+
+    const tamperedReport = await selfCheck(new MemoryStore(tampered, { 'user-1': 570, 'user-2': 50 }), CheckLevel.QUICK, {
+      verificationPublicKey: publicPem,
+    });
+    const futureReport = await selfCheck(new MemoryStore(future, { 'user-1': 75, 'user-2': 50 }), CheckLevel.QUICK);
+
+    expect(tamperedReport.checks[2]).toMatchObject({ passed: false, message: expect.stringContaining('invalid signature') });
+    expect(futureReport.checks[2]).toMatchObject({ passed: false, message: expect.stringContaining('future') });
+  });
+
+  it('reports sampled entries missing from the idempotency key index', async () => {
+    const entries = healthyLedger();
+    const store = new MemoryStore(entries, { 'user-1': 75, 'user-2': 50 }, new Map([[scopedKey(entries[0].idempotencyKey), entries[0]]]));
+
+    const report = await selfCheck(store, CheckLevel.STANDARD, { sampleSize: 2 });
+    const sample = report.checks.find(check => check.name === 'sample')!;
+
+    expect(sample).toMatchObject({
+      passed: false,
+      severity: 'warning',
+      message: '1 of 2 sampled entries failed',
+      examples: ['entry-002: not found by idempotency key'],
+    });
+  });
+
+  it('looks sampled entries up within their idempotency scope', async () => {
+    const [first, second] = healthyLedger();
+    const entries = [
+      { ...first, idempotencyKey: 'shared-key', idempotencyScope: 'merchant-a' },
+      { ...second, idempotencyKey: 'shared-key', idempotencyScope: 'merchant-b' },
+    ];
+
+    const report = await selfCheck(new MemoryStore(entries, {}), CheckLevel.STANDARD, { sampleSize: 2 });
+
+    expect(report.checks.find(check => check.name === 'sample')).toMatchObject({ passed: true });
+  });
+
+  it('finds a gap in an account balance chain on full replay', async () => {
+    const entries = healthyLedger();
+    entries.splice(2, 1);
+
+    const report = await selfCheck(new MemoryStore(entries, { 'user-1': 75, 'user-2': 50 }), CheckLevel.FULL, {
+      pageSize: 1,
+    });
+
+    expect(report.checks.find(check => check.name === 'chain')).toMatchObject({
+      passed: false,
+      severity: 'critical',
+      examples: ['entry-004: balanceBefore 70 does not follow 100'],
+    });
+  });
+
+  it('caps the reported examples', async () => {
+    const entries = Array.from({ length: 10 }, (_, i) => ({ ...entry(i, 'user-1', 0, 10), balanceAfter: 99 }));
+
+    const report = await selfCheck(new MemoryStore(entries, {}), CheckLevel.FULL, { maxExamples: 3 });
+    const chain = report.checks.find(check => check.name === 'chain')!;
+
+    expect(chain.examples).toHaveLength(3);
+    expect(chain.message).toMatch(/^19 problems/);
+  });
+
+  it('rejects an unknown level', async () => {
+    await expect(selfCheck(new MemoryStore([], {}), 'thorough' as CheckLevel)).rejects.toThrow('Unknown check level');
+  });
+
+  describe('MongoSelfCheckStore', () => {
+    it('pages entries by timestamp then entry ID', async () => {
+      const chain = { sort: jest.fn().mockReturnThis(), limit: jest.fn().mockReturnThis(), lean: jest.fn().mockReturnThis(), exec: jest.fn().mockResolvedValue([{ _id: 'x', __v: 0, entryId: 'e1' }]) };
+      const model = { find: jest.fn().mockReturnValue(chain) };
+      const store = new MongoSelfCheckStore(model as any, {} as any);
+      const after = { timestamp: new Date('2024-01-01T00:00:00Z'), entryId: 'e0' };
+
+      const page = await store.scanEntries(after, 50);
+
+      expect(model.find).toHaveBeenCalledWith({
+        $or: [
+          { timestamp: { $gt: after.timestamp } },
+          { timestamp: { $eq: after.timestamp }, entryId: { $gt: 'e0' } },
+        ],
+      });
+      expect(chain.sort).toHaveBeenCalledWith({ timestamp: 1, entryId: 1 });
+      expect(chain.limit).toHaveBeenCalledWith(50);
+      expect(page).toEqual([{ entryId: 'e1' }]);
+    });
+  });
+});
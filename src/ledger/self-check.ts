@@ -0,0 +1,373 @@
+/**
+ * Startup Integrity Self-Check
+ *
+ * Verifies the ledger before the service takes traffic, so a partially
+ * restored backup is caught at startup rather than by users. Levels are
+ * cumulative:
+ * - quick: entry counts against active wallets, wallet totals against
+ *   each user's latest ledger balance, and the head (latest) entry
+ * - standard: also a random sample of entries, each checked for a valid
+ *   signature and for membership of the idempotency key index
+ * - full: also replays every entry in order, checking each account's
+ *   balance chain (balanceBefore of an entry equals balanceAfter of the
+ *   previous one) and every signature
+ *
+ * Signatures are only checked when a verification public key is given.
+ * Each check records whether it passed and a short reason; failures are
+ * kept to a bounded list of examples so a badly damaged ledger still
+ * produces a readable report.
+ */
+
+import { Model } from 'mongoose';
+import { LedgerEntry } from './types';
+import { ReplayPosition } from './replay';
+import { verifyEntrySignature } from './entry-signing';
+import { LedgerEntryModel, ILedgerEntry } from '../db/models/ledger-entry.model';
+import { WalletModel, IWallet } from '../db/models/wallet.model';
+
+/**
+ * How thoroughly to check the ledger
+ */
+export enum CheckLevel {
+  QUICK = 'quick',
+  STANDARD = 'standard',
+  FULL = 'full',
+}
+
+const LEVEL_ORDER: CheckLevel[] = [CheckLevel.QUICK, CheckLevel.STANDARD, CheckLevel.FULL];
+
+/**
+ * Storage read by the self-check
+ */
+export interface ISelfCheckStore {
+  /** Total ledger entries */
+  countEntries(): Promise<number>;
+
+  /** Wallets that have moved past version 0 */
+  countActiveWallets(): Promise<number>;
+
+  /** Sum of wallet available balances */
+  walletAvailableTotal(): Promise<number>;
+
+  /** Sum of each user's latest available-balance balanceAfter */
+  ledgerAvailableTotal(): Promise<number>;
+
+  /** Latest entry by timestamp, then entry ID */
+  headEntry(): Promise<LedgerEntry | null>;
+
+  /** Up to size entries chosen at random */
+  sampleEntries(size: number): Promise<LedgerEntry[]>;
+
+  /** Entry stored under an idempotency key in a scope, looked up through its index */
+  findByIdempotencyKey(key: string, scope?: string): Promise<LedgerEntry | null>;
+
+  /** Entries after a position, ordered by timestamp then entry ID */
+  scanEntries(after: ReplayPosition | null, limit: number): Promise<LedgerEntry[]>;
+}
+
+/**
+ * Outcome of one check
+ */
+export interface CheckResult {
+  name: string;
+
+  /** 'critical' failures mean the ledger cannot be trusted */
+  severity: 'critical' | 'warning';
+
+  passed: boolean;
+  message: string;
+
+  /** Example failures, up to maxExamples */
+  examples?: string[];
+}
+
+/**
+ * Report of a self-check run
+ */
+export interface CheckReport {
+  level: CheckLevel;
+  passed: boolean;
+  checks: CheckResult[];
+  startedAt: Date;
+  durationMs: number;
+}
+
+/**
+ * Options for a self-check
+ */
+export interface SelfCheckOptions {
+  /** Entries sampled at the standard level */
+  sampleSize: number;
+
+  /** Entries read per page during a full replay */
+  pageSize: number;
+
+  /** Example failures kept per check */
+  maxExamples: number;
+
+  /** How far in the future the head entry may be */
+  maxClockSkewMs: number;
+
+  /** PEM public key; signatures are skipped when unset */
+  verificationPublicKey?: string;
+}
+
+const DEFAULT_OPTIONS: SelfCheckOptions = {
+  sampleSize: 100,
+  pageSize: 1000,
+  maxExamples: 20,
+  maxClockSkewMs: 5 * 60 * 1000,
+};
+
+/**
+ * Run the self-check at the given level
+ * Check failures are reported, not thrown; a store error is thrown.
+ */
+export async function selfCheck(
+  store: ISelfCheckStore,
+  level: CheckLevel,
+  options: Partial<SelfCheckOptions> = {}
+): Promise<CheckReport> {
+  const opts = { ...DEFAULT_OPTIONS, ...options };
+  const startedAt = new Date();
+  const depth = LEVEL_ORDER.indexOf(level);
+  if (depth < 0) {
+    throw new Error(`Unknown check level: ${level}`);
+  }
+
+  const checks: CheckResult[] = [
+    await checkCounts(store),
+    await checkStats(store),
+    await checkHead(store, opts),
+  ];
+  if (depth >= 1) {
+    checks.push(await checkSample(store, opts));
+  }
+  if (depth >= 2) {
+    checks.push(await checkChain(store, opts));
+  }
+
+  return {
+    level,
+    passed: checks.every(check => check.passed),
+    checks,
+    startedAt,
+    durationMs: Date.now() - startedAt.getTime(),
+  };
+}
+
+async function checkCounts(store: ISelfCheckStore): Promise<CheckResult> {
+  const [entries, wallets] = await Promise.all([store.countEntries(), store.countActiveWallets()]);
+
+  // Every balance change appends at least one entry
+  const passed = entries >= wallets;
+  return {
+    name: 'counts',
+    severity: 'critical',
+    passed,
+    message: passed
+      ? `${entries} entries for ${wallets} active wallets`
+      : `Only ${entries} entries for ${wallets} active wallets`,
+  };
+}
+
+async function checkStats(store: ISelfCheckStore): Promise<CheckResult> {
+  const [wallets, ledger] = await Promise.all([store.walletAvailableTotal(), store.ledgerAvailableTotal()]);
+
+  const passed = wallets === ledger;
+  return {
+    name: 'stats',
+    severity: 'critical',
+    passed,
+    message: passed
+      ? `Wallet and ledger available totals agree at ${ledger}`
+      : `Wallet available total ${wallets} does not match ledger total ${ledger}`,
+  };
+}
+
+async function checkHead(store: ISelfCheckStore, options: SelfCheckOptions): Promise<CheckResult> {
+  const head = await store.headEntry();
+  const result = (passed: boolean, message: string): CheckResult => ({
+    name: 'head',
+    severity: 'critical',
+    passed,
+    message,
+  });
+
+  if (!head) {
+    return result(true, 'Ledger is empty');
+  }
+  if (new Date(head.timestamp).getTime() > Date.now() + options.maxClockSkewMs) {
+    return result(false, `Head entry ${head.entryId} is timestamped in the future`);
+  }
+  if (options.verificationPublicKey && !verifyEntrySignature(head, options.verificationPublicKey)) {
+    return result(false, `Head entry ${head.entryId} has an invalid signature`);
+  }
+  return result(true, `Head entry ${head.entryId} at ${new Date(head.timestamp).toISOString()}`);
+}
+
+async function checkSample(store: ISelfCheckStore, options: SelfCheckOptions): Promise<CheckResult> {
+  const sample = await store.sampleEntries(options.sampleSize);
+  const failures = new Failures(options.maxExamples);
+
+  for (const entry of sample) {
+    if (options.verificationPublicKey && !verifyEntrySignature(entry, options.verificationPublicKey)) {
+      failures.add(`${entry.entryId}: invalid signature`);
+    }
+    const indexed = await store.findByIdempotencyKey(entry.idempotencyKey, entry.idempotencyScope);
+    if (!indexed || indexed.entryId !== entry.entryId) {
+      failures.add(`${entry.entryId}: not found by idempotency key`);
+    }
+  }
+
+  return failures.result(
+    'sample',
+    'warning',
+    `${sample.length} sampled entries verified`,
+    `${failures.count} of ${sample.length} sampled entries failed`
+  );
+}
+
+async function checkChain(store: ISelfCheckStore, options: SelfCheckOptions): Promise<CheckResult> {
+  const failures = new Failures(options.maxExamples);
+  const lastBalance = new Map<string, number>();
+  let position: ReplayPosition | null = null;
+  let replayed = 0;
+
+  for (;;) {
+    const page = await store.scanEntries(position, options.pageSize);
+    for (const entry of page) {
+      replayed++;
+      if (entry.balanceBefore + entry.amount !== entry.balanceAfter) {
+        failures.add(`${entry.entryId}: balanceAfter does not equal balanceBefore plus amount`);
+      }
+
+      const chain = `${entry.accountType}:${entry.accountId}:${entry.balanceState}`;
+      const previous = lastBalance.get(chain);
+      if (previous !== undefined && previous !== entry.balanceBefore) {
+        failures.add(`${entry.entryId}: balanceBefore ${entry.balanceBefore} does not follow ${previous}`);
+      }
+      lastBalance.set(chain, entry.balanceAfter);
+
+      if (options.verificationPublicKey && !verifyEntrySignature(entry, options.verificationPublicKey)) {
+        failures.add(`${entry.entryId}: invalid signature`);
+      }
+    }
+
+    if (page.length < options.pageSize) {
+      break;
+    }
+    const last = page[page.length - 1];
+    position = { timestamp: last.timestamp, entryId: last.entryId };
+  }
+
+  return failures.result(
+    'chain',
+    'critical',
+    `${replayed} entries replayed across ${lastBalance.size} balance chains`,
+    `${failures.count} problems in ${replayed} replayed entries`
+  );
+}
+
+/**
+ * Failure counter keeping a bounded list of examples
+ */
+class Failures {
+  count = 0;
+  private examples: string[] = [];
+
+  constructor(private max: number) {}
+
+  add(example: string): void {
+    this.count++;
+    if (this.examples.length < this.max) {
+      this.examples.push(example);
+    }
+  }
+
+  result(name: string, severity: CheckResult['severity'], ok: string, failed: string): CheckResult {
+    if (this.count === 0) {
+      return { name, severity, passed: true, message: ok };
+    }
+    return { name, severity, passed: false, message: failed, examples: this.examples };
+  }
+}
+
+/**
+ * Self-check store reading the ledger and wallet collections directly
+ */
+export class MongoSelfCheckStore implements ISelfCheckStore {
+  private entries: Model<ILedgerEntry>;
+  private wallets: Model<IWallet>;
+
+  constructor(entries: Model<ILedgerEntry> = LedgerEntryModel, wallets: Model<IWallet> = WalletModel) {
+    this.entries = entries;
+    this.wallets = wallets;
+  }
+
+  async countEntries(): Promise<number> {
+    return this.entries.estimatedDocumentCount();
+  }
+
+  async countActiveWallets(): Promise<number> {
+    return this.wallets.countDocuments({ version: { $gt: 0 } });
+  }
+
+  async walletAvailableTotal(): Promise<number> {
+    const [row] = await this.wallets.aggregate([{ $group: { _id: null, total: { $sum: '$availableBalance' } } }]);
+    return row ? row.total : 0;
+  }
+
+  async ledgerAvailableTotal(): Promise<number> {
+    const [row] = await this.entries.aggregate([
+      { $match: { accountType: 'user', balanceState: 'available' } },
+      { $sort: { accountId: 1, timestamp: 1, entryId: 1 } },
+      { $group: { _id: '$accountId', balance: { $last: '$balanceAfter' } } },
+      { $group: { _id: null, total: { $sum: '$balance' } } },
+    ]);
+    return row ? row.total : 0;
+  }
+
+  async headEntry(): Promise<LedgerEntry | null> {
+    const doc = await this.entries.findOne({}).sort({ timestamp: -1, entryId: -1 }).lean().exec();
+    return doc ? toEntry(doc) : null;
+  }
+
+  async sampleEntries(size: number): Promise<LedgerEntry[]> {
+    const docs = await this.entries.aggregate([{ $sample: { size } }]);
+    return docs.map(toEntry);
+  }
+
+  async findByIdempotencyKey(key: string, scope?: string): Promise<LedgerEntry | null> {
+    const doc = await this.entries
+      .findOne({ idempotencyKey: { $eq: key }, idempotencyScope: scope ? { $eq: scope } : { $exists: false } })
+      .lean()
+      .exec();
+    return doc ? toEntry(doc) : null;
+  }
+
+  async scanEntries(after: ReplayPosition | null, limit: number): Promise<LedgerEntry[]> {
+    const query = after
+      ? {
+          $or: [
+            { timestamp: { $gt: after.timestamp } },
+            { timestamp: { $eq: after.timestamp }, entryId: { $gt: after.entryId } },
+          ],
+        }
+      : {};
+
+    const docs = await this.entries.find(query).sort({ timestamp: 1, entryId: 1 }).limit(limit).lean().exec();
+    return docs.map(toEntry);
+  }
+}
+
+/**
+ * Strip storage-only fields from a ledger document
+ */
+function toEntry(doc: any): LedgerEntry {
+  const entry = { ...doc };
+  delete entry._id;
+  delete entry.__v;
+  delete entry.indexedTags;
+  return entry;
+}
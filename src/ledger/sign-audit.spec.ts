@@ -0,0 +1,65 @@
+/**
+ * Amount-Sign Audit Tests
+ */
+
+import { auditSignViolations } from './sign-audit';
+import { IEntryScanStore } from './attestation';
+import { ReplayPosition } from './replay';
+import { LedgerEntry } from './types';
+import { TransactionType } from '../wallets/types';
+
+describe('auditSignViolations', () => {
+  const entry = (n: number, type: TransactionType, amount: number): LedgerEntry =>
+    ({
+      entryId: `entry-${String(n).padStart(2, '0')}`,
+      accountId: 'user-1',
+      type,
+      amount,
+      timestamp: new Date(Date.UTC(2019, 0, 1, n)),
+      metadata: { legacyId: `L${n}` },
+    }) as LedgerEntry;
+
+  const scanStore = (entries: LedgerEntry[]): IEntryScanStore => ({
+    scanEntries: async (after: ReplayPosition | null, limit: number) =>
+      entries
+        .filter(e => !after || e.timestamp > after.timestamp || (+e.timestamp === +after.timestamp && e.entryId > after.entryId))
+        .slice(0, limit),
+  });
+
+  const ledger = [
+    entry(1, TransactionType.CREDIT, 500),
+    entry(2, TransactionType.CREDIT, -50),
+    entry(3, TransactionType.DEBIT, -200),
+    entry(4, TransactionType.DEBIT, 75),
+    entry(5, TransactionType.CREDIT, 0),
+    entry(6, TransactionType.DEBIT, -10),
+    entry(7, 'transfer' as TransactionType, 10),
+  ];
+
+  it('should return the entries whose sign contradicts their type, in ledger order', async () => {
+    const violations = await auditSignViolations(scanStore(ledger));
+
+    expect(violations.map(e => e.entryId)).toEqual(['entry-02', 'entry-04', 'entry-05', 'entry-07']);
+  });
+
+  it('should find the same violations whatever the page size', async () => {
+    for (const pageSize of [1, 2, 3, 7]) {
+      const violations = await auditSignViolations(scanStore(ledger), { pageSize });
+      expect(violations.map(e => e.entryId)).toEqual(['entry-02', 'entry-04', 'entry-05', 'entry-07']);
+    }
+  });
+
+  it('should return copies that leave the stored entries untouched', async () => {
+    const stored = ledger.map(e => ({ ...e, metadata: { ...e.metadata } }));
+
+    const violations = await auditSignViolations(scanStore(ledger));
+    violations[0].amount = 50;
+    violations[0].metadata!.legacyId = 'changed';
+
+    expect(ledger).toEqual(stored);
+  });
+
+  it('should report nothing for a clean ledger', async () => {
+    await expect(auditSignViolations(scanStore([ledger[0], ledger[2]]))).resolves.toEqual([]);
+  });
+});
@@ -0,0 +1,60 @@
+/**
+ * Amount-Sign Audit
+ *
+ * Finds stored entries whose amount sign contradicts their type (a
+ * credit that is not positive, a debit that is not negative). Appends
+ * reject such entries, but data loaded before the rule was enforced, or
+ * imported bypassing it, may still carry them.
+ *
+ * The audit reads only. Remediate each violation with a compensating
+ * adjustment; the entries themselves are never changed.
+ */
+
+import { LedgerEntry } from './types';
+import { ReplayPosition } from './replay';
+import { IEntryScanStore } from './attestation';
+import { amountMatchesType } from './entry-validation';
+
+/**
+ * Options for a sign audit
+ */
+export interface SignAuditOptions {
+  /** Entries read per page */
+  pageSize: number;
+}
+
+const DEFAULT_OPTIONS: SignAuditOptions = {
+  pageSize: 1000,
+};
+
+/**
+ * Scan the whole ledger for amount-sign violations
+ *
+ * @returns Copies of the violating entries, in (timestamp, entryId) order
+ */
+export async function auditSignViolations(
+  store: IEntryScanStore,
+  options: Partial<SignAuditOptions> = {}
+): Promise<LedgerEntry[]> {
+  const { pageSize } = { ...DEFAULT_OPTIONS, ...options };
+  const violations: LedgerEntry[] = [];
+  let position: ReplayPosition | null = null;
+
+  for (;;) {
+    const page = await store.scanEntries(position, pageSize);
+
+    for (const entry of page) {
+      if (!amountMatchesType(entry.type, entry.amount)) {
+        violations.push({ ...entry, metadata: entry.metadata && { ...entry.metadata } });
+      }
+    }
+
+    if (page.length < pageSize) {
+      break;
+    }
+    const last = page[page.length - 1];
+    position = { timestamp: last.timestamp, entryId: last.entryId };
+  }
+
+  return violations;
+}
@@ -0,0 +1,104 @@
+/**
+ * What-If Simulation Tests
+ */
+
+import { simulateBalances, HypotheticalTransaction } from './simulation';
+import { ILedgerService } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('simulateBalances', () => {
+  let balances: Record<string, number>;
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  const tx = (key: string, accountId: string, amount: number, overrides: Partial<HypotheticalTransaction> = {}) => ({
+    idempotencyKey: key,
+    accountId,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    amount,
+    reason: amount >= 0 ? TransactionReason.PROMOTIONAL_AWARD : TransactionReason.CHIP_MENU_PURCHASE,
+    requestId: `req-${key}`,
+    ...overrides,
+  });
+
+  beforeEach(() => {
+    balances = { 'user-1': 500, 'user-2': 0 };
+    mockLedgerService = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn(),
+      getEntry: jest.fn(),
+      entryExists: jest.fn(),
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string) => ({
+        accountId,
+        accountType: 'user',
+        availableBalance: balances[accountId] || 0,
+        escrowBalance: 0,
+        asOf: new Date(),
+        currency: 'points',
+      })),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn().mockRejectedValue(new Error('simulation must not write')),
+    } as any;
+  });
+
+  it('projects balances from the current state plus the hypothetical set', async () => {
+    const result = await simulateBalances(mockLedgerService, [
+      tx('bonus-1', 'user-1', 250),
+      tx('bonus-2', 'user-2', 100),
+      tx('spend-1', 'user-1', -700),
+      tx('bonus-3', 'user-3', 50),
+    ]);
+
+    expect(result.balances).toEqual(
+      new Map([
+        ['user-1', 50],
+        ['user-2', 100],
+        ['user-3', 50],
+      ])
+    );
+    expect(result).toMatchObject({ applied: 4, errors: [] });
+  });
+
+  it('leaves the real ledger untouched', async () => {
+    await simulateBalances(mockLedgerService, [tx('bonus-1', 'user-1', 250), tx('bonus-2', 'user-2', 100)]);
+
+    expect(mockLedgerService.createEntry).not.toHaveBeenCalled();
+    expect(mockLedgerService.storeIdempotencyResult).not.toHaveBeenCalled();
+    await expect(mockLedgerService.getBalanceSnapshot('user-1', 'user')).resolves.toMatchObject({
+      availableBalance: 500,
+    });
+    expect(balances).toEqual({ 'user-1': 500, 'user-2': 0 });
+  });
+
+  it('reports and skips invalid transactions while applying the rest', async () => {
+    const result = await simulateBalances(mockLedgerService, [
+      tx('wrong-sign', 'user-1', 100, { type: TransactionType.DEBIT }),
+      tx('bonus-1', 'user-1', 100),
+      tx('bonus-1', 'user-1', 100),
+      tx('overdraw', 'user-2', -10),
+      tx('bad-reason', 'user-2', 10, { reason: 'free_money' }),
+    ]);
+
+    expect(result.balances.get('user-1')).toBe(600);
+    expect(result.balances.get('user-2')).toBe(0);
+    expect(result.applied).toBe(1);
+    expect(result.errors.map(error => [error.index, error.idempotencyKey])).toEqual([
+      [0, 'wrong-sign'],
+      [2, 'bonus-1'],
+      [3, 'overdraw'],
+      [4, 'bad-reason'],
+    ]);
+    expect(result.errors[0].message).toMatch('sign does not match');
+    expect(result.errors[2].message).toMatch('Insufficient balance');
+  });
+
+  it('reads each user balance once, as of the given instant', async () => {
+    const asOf = new Date('2024-03-01T00:00:00Z');
+
+    await simulateBalances(mockLedgerService, [tx('a', 'user-1', 10), tx('b', 'user-1', 20)], { asOf });
+
+    expect(mockLedgerService.getBalanceSnapshot).toHaveBeenCalledTimes(1);
+    expect(mockLedgerService.getBalanceSnapshot).toHaveBeenCalledWith('user-1', 'user', asOf);
+  });
+});
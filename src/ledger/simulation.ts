@@ -0,0 +1,108 @@
+/**
+ * What-If Simulation
+ *
+ * Applies a hypothetical set of transactions, such as a planned bonus
+ * campaign, to a copy of the current user balances and returns the
+ * balances that would result. The ledger is only read: balances are
+ * cloned from balance snapshots and nothing is appended, so a
+ * simulation never changes real state.
+ *
+ * Each hypothetical transaction is checked with the same field rules as
+ * recordEntry (including the amount sign matching the type) and applied
+ * in order to the user's available balance. A transaction that is
+ * invalid, repeats an idempotency key or would overdraw the balance is
+ * reported and skipped; the rest still apply.
+ */
+
+import { ILedgerService } from './types';
+import { validateEntryFields, ValidatedEntryFields } from './entry-validation';
+
+/**
+ * Hypothetical transaction against a user's available balance
+ */
+export type HypotheticalTransaction = ValidatedEntryFields;
+
+/**
+ * Hypothetical transaction that was not applied
+ */
+export interface SimulationError {
+  /** Position in the hypothetical set */
+  index: number;
+
+  idempotencyKey: string;
+
+  message: string;
+}
+
+/**
+ * Outcome of a simulation
+ */
+export interface SimulationResult {
+  /** Projected available balance per user touched by the set */
+  balances: Map<string, number>;
+
+  /** Transactions applied */
+  applied: number;
+
+  /** Transactions skipped, in input order */
+  errors: SimulationError[];
+}
+
+/**
+ * Options for a simulation
+ */
+export interface SimulationOptions {
+  /** Start from balances as of this instant instead of now */
+  asOf?: Date;
+}
+
+/**
+ * Project user balances after a hypothetical set of transactions
+ */
+export async function simulateBalances(
+  ledgerService: ILedgerService,
+  hypothetical: HypotheticalTransaction[],
+  options: SimulationOptions = {}
+): Promise<SimulationResult> {
+  const result: SimulationResult = { balances: new Map(), applied: 0, errors: [] };
+  const seenKeys = new Set<string>();
+
+  for (const [index, transaction] of hypothetical.entries()) {
+    const reject = (message: string) =>
+      result.errors.push({ index, idempotencyKey: transaction.idempotencyKey, message });
+
+    const invalid = validateEntryFields(transaction);
+    if (invalid) {
+      reject(invalid);
+      continue;
+    }
+
+    if (seenKeys.has(transaction.idempotencyKey)) {
+      reject(`Duplicate idempotency key: ${transaction.idempotencyKey}`);
+      continue;
+    }
+    seenKeys.add(transaction.idempotencyKey);
+
+    let balance = result.balances.get(transaction.accountId);
+    if (balance === undefined) {
+      const snapshot = await ledgerService.getBalanceSnapshot(transaction.accountId, 'user', options.asOf);
+      balance = snapshot.availableBalance;
+      result.balances.set(transaction.accountId, balance);
+    }
+
+    const projected = balance + transaction.amount;
+    if (projected < 0) {
+      reject(`Insufficient balance. Required: ${-transaction.amount}, Available: ${balance}`);
+      continue;
+    }
+    if (!Number.isSafeInteger(projected)) {
+      reject('Projected balance exceeds the safe integer range');
+      continue;
+    }
+
+    result.balances.set(transaction.accountId, projected);
+    result.applied++;
+  }
+
+  return result;
+}
@@ -0,0 +1,129 @@
+/**
+ * Startup Readiness Gate Tests
+ */
+
+import { StartupReadiness } from './startup-readiness';
+import { selfCheck, CheckLevel, CheckReport, CheckResult, ISelfCheckStore } from './self-check';
+import { MetricsLogger, AlertSeverity } from '../metrics';
+
+jest.mock('./self-check', () => ({
+  ...jest.requireActual('./self-check'),
+  selfCheck: jest.fn(),
+}));
+
+describe('StartupReadiness', () => {
+  const store = {} as ISelfCheckStore;
+
+  const report = (...checks: Partial<CheckResult>[]): CheckReport => {
+    const results = checks.map(check => ({ name: 'counts', severity: 'critical' as const, passed: true, message: '', ...check }));
+    return {
+      level: CheckLevel.QUICK,
+      passed: results.every(check => check.passed),
+      checks: results,
+      startedAt: new Date(),
+      durationMs: 1,
+    };
+  };
+
+  beforeEach(() => {
+    jest.spyOn(MetricsLogger, 'logAlert').mockImplementation(() => undefined);
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+    (selfCheck as jest.Mock).mockReset();
+  });
+
+  it('is not ready before the self-check has run', () => {
+    const readiness = new StartupReadiness(store);
+
+    expect(readiness.isReady()).toBe(false);
+    expect(readiness.health()).toMatchObject({ status: 'unhealthy', message: 'Self-check has not run' });
+  });
+
+  it('becomes ready and healthy when every check passes', async () => {
+    (selfCheck as jest.Mock).mockResolvedValue(report({ name: 'counts' }, { name: 'stats' }));
+    const readiness = new StartupReadiness(store, { level: CheckLevel.STANDARD, checkOptions: { sampleSize: 10 } });
+
+    await expect(readiness.start()).resolves.toBe(true);
+
+    expect(selfCheck).toHaveBeenCalledWith(store, CheckLevel.STANDARD, { sampleSize: 10 });
+    expect(readiness.health()).toMatchObject({ status: 'healthy', metrics: { ready: true, level: 'standard' } });
+    expect(MetricsLogger.logAlert).not.toHaveBeenCalled();
+  });
+
+  it('refuses readiness on a critical failure and exposes the report', async () => {
+    const failed = report({ name: 'counts' }, { name: 'stats', passed: false, message: 'totals differ' });
+    (selfCheck as jest.Mock).mockResolvedValue(failed);
+    const readiness = new StartupReadiness(store);
+
+    await expect(readiness.start()).resolves.toBe(false);
+
+    expect(readiness.health()).toMatchObject({
+      status: 'unhealthy',
+      message: 'Self-check failed: stats',
+      metrics: { ready: false, selfCheck: failed },
+    });
+    expect(MetricsLogger.logAlert).toHaveBeenCalledWith(
+      expect.objectContaining({ severity: AlertSeverity.CRITICAL, metadata: expect.objectContaining({ failed: ['stats'] }) })
+    );
+  });
+
+  it('applies the configured strictness to warnings', async () => {
+    (selfCheck as jest.Mock).mockResolvedValue(report({ name: 'sample', severity: 'warning', passed: false }));
+
+    const lenient = new StartupReadiness(store, { strictness: 'critical' });
+    const strict = new StartupReadiness(store, { strictness: 'any' });
+
+    await expect(lenient.start()).resolves.toBe(true);
+    await expect(strict.start()).resolves.toBe(false);
+    expect(lenient.health()).toMatchObject({ status: 'degraded', message: 'Self-check reported: sample' });
+  });
+
+  it('never blocks with strictness off', async () => {
+    (selfCheck as jest.Mock).mockResolvedValue(report({ name: 'chain', passed: false }));
+    const readiness = new StartupReadiness(store, { strictness: 'off' });
+
+    await expect(readiness.start()).resolves.toBe(true);
+    expect(readiness.health().status).toBe('degraded');
+  });
+
+  it('stays ready but degraded while warm-up is incomplete', async () => {
+    (selfCheck as jest.Mock).mockResolvedValue(report({ name: 'counts' }));
+    const warmStore = { recentlyActiveUsers: jest.fn().mockResolvedValue(['user-1']) };
+    const cache = { name: 'balance-cache', warm: jest.fn().mockResolvedValue(undefined) };
+    const bloom = { name: 'bloom', warm: jest.fn().mockRejectedValue(new Error('out of memory')) };
+    const readiness = new StartupReadiness(store, { warmup: { store: warmStore, targets: [cache, bloom] } });
+
+    await expect(readiness.start()).resolves.toBe(true);
+
+    expect(cache.warm).toHaveBeenCalledWith({ recentUsers: ['user-1'] });
+    expect(readiness.health()).toMatchObject({
+      status: 'degraded',
+      message: 'Warm-up incomplete: bloom failed',
+      metrics: { warmup: { completed: ['balance-cache'] } },
+    });
+  });
+
+  it('skips warm-up when the self-check blocks readiness', async () => {
+    (selfCheck as jest.Mock).mockResolvedValue(report({ name: 'counts', passed: false }));
+    const target = { name: 'balance-cache', warm: jest.fn() };
+    const readiness = new StartupReadiness(store, {
+      warmup: { store: { recentlyActiveUsers: jest.fn() }, targets: [target] },
+    });
+
+    await expect(readiness.start()).resolves.toBe(false);
+    expect(target.warm).not.toHaveBeenCalled();
+  });
+
+  it('refuses readiness when the self-check cannot run', async () => {
+    (selfCheck as jest.Mock).mockRejectedValue(new Error('connection refused'));
+    const readiness = new StartupReadiness(store, { strictness: 'off' });
+
+    await expect(readiness.start()).resolves.toBe(false);
+    expect(readiness.health()).toMatchObject({
+      status: 'unhealthy',
+      message: 'Self-check could not run: connection refused',
+    });
+  });
+});
@@ -0,0 +1,223 @@
+/**
+ * Startup Readiness Gate
+ *
+ * Runs the ledger self-check once at startup and decides whether the
+ * service may enter its ready state. Strictness sets which failures
+ * block readiness:
+ * - any: every failed check
+ * - critical: only failed critical checks; warnings leave the service
+ *   ready but degraded
+ * - off: nothing blocks; failures are only reported
+ *
+ * A self-check that cannot run at all (for example, storage unreachable)
+ * always blocks. The last report is exposed through health() for the
+ * health endpoint, so ops can see exactly which check failed.
+ *
+ * When a warm-up plan is configured, it runs after a passing self-check
+ * and start() resolves only once warm-up completes or its deadline
+ * passes. Incomplete warm-up never blocks; the service is ready but
+ * degraded until the next start().
+ */
+
+import { selfCheck, ISelfCheckStore, CheckLevel, CheckReport, SelfCheckOptions } from './self-check';
+import { warmup, IWarmupStore, Warmable, WarmupOptions, WarmupReport } from './warmup';
+import { ServiceHealth } from '../services/types';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+
+/**
+ * Which self-check failures block readiness
+ */
+export type SelfCheckStrictness = 'any' | 'critical' | 'off';
+
+/**
+ * Components to warm before the service reports ready
+ */
+export interface WarmupPlan {
+  store: IWarmupStore;
+
+  targets: Warmable[];
+
+  options?: Partial<WarmupOptions>;
+}
+
+/**
+ * Configuration for the startup readiness gate
+ */
+export interface StartupReadinessConfig {
+  /** Self-check level run at startup */
+  level: CheckLevel;
+
+  strictness: SelfCheckStrictness;
+
+  /** Options passed through to the self-check */
+  checkOptions: Partial<SelfCheckOptions>;
+
+  /** Warm-up run after a passing self-check */
+  warmup?: WarmupPlan;
+}
+
+const DEFAULT_CONFIG: StartupReadinessConfig = {
+  level: CheckLevel.QUICK,
+  strictness: 'critical',
+  checkOptions: {},
+};
+
+/**
+ * Startup Readiness Gate Implementation
+ */
+export class StartupReadiness {
+  private config: StartupReadinessConfig;
+  private store: ISelfCheckStore;
+  private ready = false;
+  private report?: CheckReport;
+  private error?: string;
+  private checkedAt?: Date;
+  private warmupReport?: WarmupReport;
+  private warmupError?: string;
+
+  constructor(store: ISelfCheckStore, config: Partial<StartupReadinessConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.store = store;
+  }
+
+  /**
+   * Run the self-check and enter the ready state if it allows
+   *
+   * @returns Whether the service is ready
+   */
+  async start(): Promise<boolean> {
+    this.checkedAt = new Date();
+    this.report = undefined;
+    this.error = undefined;
+    this.warmupReport = undefined;
+    this.warmupError = undefined;
+
+    try {
+      this.report = await selfCheck(this.store, this.config.level, this.config.checkOptions);
+      this.ready = !this.blocks(this.report);
+    } catch (error) {
+      this.error = error instanceof Error ? error.message : String(error);
+      this.ready = false;
+    }
+
+    if (!this.ready) {
+      MetricsLogger.logAlert({
+        severity: AlertSeverity.CRITICAL,
+        message: 'Ledger self-check failed; service will not become ready',
+        metricType: MetricEventType.LEDGER_SELF_CHECK_FAILED,
+        timestamp: this.checkedAt,
+        metadata: {
+          level: this.config.level,
+          strictness: this.config.strictness,
+          failed: this.failedChecks().map(check => check.name),
+          error: this.error,
+        },
+      });
+    }
+
+    if (this.ready && this.config.warmup) {
+      const { store, targets, options } = this.config.warmup;
+      try {
+        this.warmupReport = await warmup(store, targets, options);
+      } catch (error) {
+        this.warmupError = error instanceof Error ? error.message : String(error);
+      }
+    }
+
+    return this.ready;
+  }
+
+  /**
+   * Whether the service may take traffic
+   */
+  isReady(): boolean {
+    return this.ready;
+  }
+
+  /**
+   * Health status including the last self-check report
+   */
+  health(): ServiceHealth {
+    const failed = this.failedChecks();
+    const warmupProblem = this.warmupProblem();
+    let status: ServiceHealth['status'];
+    let message: string;
+
+    if (!this.checkedAt) {
+      status = 'unhealthy';
+      message = 'Self-check has not run';
+    } else if (!this.ready) {
+      status = 'unhealthy';
+      message = this.error
+        ? `Self-check could not run: ${this.error}`
+        : `Self-check failed: ${failed.map(check => check.name).join(', ')}`;
+    } else if (failed.length > 0) {
+      status = 'degraded';
+      message = `Self-check reported: ${failed.map(check => check.name).join(', ')}`;
+    } else if (warmupProblem) {
+      status = 'degraded';
+      message = `Warm-up incomplete: ${warmupProblem}`;
+    } else {
+      status = 'healthy';
+      message = 'Self-check passed';
+    }
+
+    return {
+      service: 'ledger',
+      status,
+      message,
+      checkedAt: this.checkedAt || new Date(),
+      metrics: {
+        ready: this.ready,
+        level: this.config.level,
+        strictness: this.config.strictness,
+        selfCheck: this.report,
+        warmup: this.warmupReport,
+      },
+    };
+  }
+
+  private blocks(report: CheckReport): boolean {
+    switch (this.config.strictness) {
+      case 'off':
+        return false;
+      case 'critical':
+        return report.checks.some(check => !check.passed && check.severity === 'critical');
+      default:
+        return !report.passed;
+    }
+  }
+
+  private warmupProblem(): string | undefined {
+    if (this.warmupError) {
+      return `could not run: ${this.warmupError}`;
+    }
+    if (!this.warmupReport) {
+      return undefined;
+    }
+
+    const { failed, pending, timedOut } = this.warmupReport;
+    const problems: string[] = [];
+    if (timedOut) {
+      problems.push(`deadline passed with ${pending.join(', ')} pending`);
+    }
+    if (failed.length > 0) {
+      problems.push(`${failed.map(target => target.name).join(', ')} failed`);
+    }
+    return problems.length > 0 ? problems.join('; ') : undefined;
+  }
+
+  private failedChecks() {
+    return this.report ? this.report.checks.filter(check => !check.passed) : [];
+  }
+}
+
+/**
+ * Factory function to create a startup readiness gate
+ */
+export function createStartupReadiness(
+  store: ISelfCheckStore,
+  config?: Partial<StartupReadinessConfig>
+): StartupReadiness {
+  return new StartupReadiness(store, config);
+}
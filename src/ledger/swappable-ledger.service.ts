@@ -0,0 +1,166 @@
+/**
+ * Swappable Ledger Service
+ *
+ * A stable ILedgerService handle over a replaceable inner ledger, for
+ * blue-green cutovers: build a fresh store from a snapshot, then swap()
+ * it in without restarting.
+ *
+ * Each call reads the current inner ledger once and runs entirely on it,
+ * so a call in flight during a swap finishes on the old ledger and every
+ * call made after the swap goes to the new one. No call ever mixes the
+ * two.
+ *
+ * Writes still in flight on the old ledger when it is swapped out land
+ * there, not in the new one. Put the handle behind a
+ * MaintenanceLedgerService in DRAIN mode while the snapshot is taken, or
+ * use swapAndDrain() to know when the old ledger has gone quiet.
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Calls in flight on one inner ledger
+ */
+interface InFlight {
+  count: number;
+  waiters: (() => void)[];
+}
+
+/**
+ * SwappableLedgerService implementation
+ */
+export class SwappableLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private inFlight = new Map<ILedgerService, InFlight>();
+  private generation = 0;
+
+  constructor(inner: ILedgerService) {
+    this.inner = inner;
+  }
+
+  /**
+   * The ledger calls are currently routed to
+   */
+  current(): ILedgerService {
+    return this.inner;
+  }
+
+  /**
+   * Route all subsequent calls to another ledger
+   *
+   * @returns The ledger that was swapped out; calls already running on it finish there
+   */
+  swap(next: ILedgerService): ILedgerService {
+    const previous = this.inner;
+    this.inner = next;
+    this.generation++;
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_STORE_SWAPPED, {
+      generation: this.generation,
+      inFlightOnPrevious: this.inFlight.get(previous)?.count || 0,
+    });
+
+    return previous;
+  }
+
+  /**
+   * Swap, then wait for the calls still running on the old ledger
+   *
+   * @returns The old ledger, once nothing is in flight on it
+   */
+  async swapAndDrain(next: ILedgerService): Promise<ILedgerService> {
+    const previous = this.swap(next);
+    const calls = this.inFlight.get(previous);
+    if (calls && calls.count > 0 && previous !== next) {
+      await new Promise<void>(resolve => calls.waiters.push(resolve));
+    }
+    return previous;
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return this.run(inner => inner.createEntry(request));
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.run(inner => inner.queryEntries(filter));
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    return this.run(inner => inner.getEntry(entryId));
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.run(inner => inner.entryExists(entryId));
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.run(inner => inner.getBalanceSnapshot(accountId, accountType, asOf));
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.run(inner => inner.generateReconciliationReport(accountId, accountType, dateRange));
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.run(inner => inner.getAuditTrail(transactionId));
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.run(inner => inner.checkIdempotency(key, operationType));
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.run(inner => inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds));
+  }
+
+  /**
+   * Run a call on the ledger current at its start, tracking it as in flight
+   */
+  private async run<T>(fn: (inner: ILedgerService) => Promise<T>): Promise<T> {
+    const inner = this.inner;
+    const calls = this.inFlight.get(inner) || { count: 0, waiters: [] };
+    calls.count++;
+    this.inFlight.set(inner, calls);
+
+    try {
+      return await fn(inner);
+    } finally {
+      calls.count--;
+      if (calls.count === 0) {
+        this.inFlight.delete(inner);
+        calls.waiters.forEach(resolve => resolve());
+      }
+    }
+  }
+}
+
+/**
+ * Factory function to create a swappable ledger service
+ */
+export function createSwappableLedgerService(inner: ILedgerService): SwappableLedgerService {
+  return new SwappableLedgerService(inner);
+}
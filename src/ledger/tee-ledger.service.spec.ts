@@ -0,0 +1,106 @@
+/**
+ * Tee Ledger Service Tests
+ */
+
+import { TeeLedgerService } from './tee-ledger.service';
+import { ILedgerService, LedgerEntry, CreateLedgerEntryRequest } from './types';
+import { TransactionReason } from '../wallets/types';
+import { MirrorWriteError } from '../services/types';
+
+describe('TeeLedgerService', () => {
+  let primary: jest.Mocked<ILedgerService>;
+  let audit: jest.Mocked<ILedgerService>;
+  let service: TeeLedgerService;
+
+  const mockLedger = (): jest.Mocked<ILedgerService> => ({
+    createEntry: jest.fn().mockImplementation(async (request: CreateLedgerEntryRequest) => ({
+      entryId: `entry-${request.idempotencyKey}`,
+      accountId: request.accountId,
+      amount: request.amount,
+      reason: request.reason,
+    } as LedgerEntry)),
+    queryEntries: jest.fn(),
+    getEntry: jest.fn(),
+    getBalanceSnapshot: jest.fn(),
+    generateReconciliationReport: jest.fn(),
+    getAuditTrail: jest.fn(),
+    checkIdempotency: jest.fn(),
+    storeIdempotencyResult: jest.fn(),
+  } as any);
+
+  const request = (reason: TransactionReason, idempotencyKey = 'idem-1') =>
+    ({ accountId: 'user-123', amount: 100, reason, idempotencyKey } as CreateLedgerEntryRequest);
+
+  beforeEach(() => {
+    primary = mockLedger();
+    audit = mockLedger();
+    service = new TeeLedgerService(primary, {
+      [TransactionReason.ADMIN_CREDIT]: { name: 'audit', ledger: audit },
+      [TransactionReason.ADMIN_DEBIT]: { name: 'audit', ledger: audit },
+    });
+  });
+
+  it('should write adjustments to both the primary and the mirror', async () => {
+    const entry = await service.createEntry(request(TransactionReason.ADMIN_CREDIT));
+
+    expect(entry.entryId).toBe('entry-idem-1');
+    expect(primary.createEntry).toHaveBeenCalledTimes(1);
+    expect(audit.createEntry).toHaveBeenCalledWith(
+      expect.objectContaining({ idempotencyKey: 'idem-1', reason: TransactionReason.ADMIN_CREDIT })
+    );
+  });
+
+  it('should write earns to the primary only', async () => {
+    await service.createEntry(request(TransactionReason.PROMOTIONAL_AWARD));
+
+    expect(primary.createEntry).toHaveBeenCalledTimes(1);
+    expect(audit.createEntry).not.toHaveBeenCalled();
+  });
+
+  it('should write the primary before the mirror', async () => {
+    const order: string[] = [];
+    primary.createEntry.mockImplementation(async () => {
+      order.push('primary');
+      return { entryId: 'entry-1' } as LedgerEntry;
+    });
+    audit.createEntry.mockImplementation(async () => {
+      order.push('audit');
+      return { entryId: 'entry-1' } as LedgerEntry;
+    });
+
+    await service.createEntry(request(TransactionReason.ADMIN_DEBIT));
+
+    expect(order).toEqual(['primary', 'audit']);
+  });
+
+  it('should not mirror when the primary write fails', async () => {
+    primary.createEntry.mockRejectedValue(new Error('primary down'));
+
+    await expect(service.createEntry(request(TransactionReason.ADMIN_CREDIT))).rejects.toThrow(
+      'primary down'
+    );
+    expect(audit.createEntry).not.toHaveBeenCalled();
+  });
+
+  it('should surface a mirror failure with the committed primary entry', async () => {
+    audit.createEntry.mockRejectedValue(new Error('audit store unavailable'));
+
+    const error = await service.createEntry(request(TransactionReason.ADMIN_CREDIT)).catch(e => e);
+
+    expect(error).toBeInstanceOf(MirrorWriteError);
+    expect(error.details).toMatchObject({
+      entryId: 'entry-idem-1',
+      route: 'audit',
+      cause: 'audit store unavailable',
+    });
+    expect(error.details.entry.entryId).toBe('entry-idem-1');
+    expect(primary.createEntry).toHaveBeenCalledTimes(1);
+  });
+
+  it('should serve reads from the primary', async () => {
+    primary.getEntry.mockResolvedValue({ entryId: 'entry-1' } as LedgerEntry);
+
+    await expect(service.getEntry('entry-1')).resolves.toEqual({ entryId: 'entry-1' });
+    expect(audit.getEntry).not.toHaveBeenCalled();
+  });
+});
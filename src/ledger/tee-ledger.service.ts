@@ -0,0 +1,143 @@
+/**
+ * Tee Ledger Service
+ *
+ * Wraps a primary ILedgerService and mirrors entries with selected
+ * reasons (e.g. admin adjustments) to additional ledgers, such as a
+ * high-scrutiny audit store with its own retention. Every entry goes to
+ * the primary; reads are always served by the primary.
+ *
+ * Ordering: the primary write happens first and a primary failure is
+ * thrown before any mirror is attempted. A committed primary entry
+ * cannot be rolled back, so a mirror failure is raised afterwards as a
+ * MirrorWriteError carrying the primary entry. The mirror receives the
+ * same idempotency key, so retrying the original request is the
+ * recovery path: the primary deduplicates and the mirror catches up.
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import { TransactionReason } from '../wallets/types';
+import { MirrorWriteError } from '../services/types';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+
+/**
+ * A mirror ledger and the name used for it in errors and metrics
+ */
+export interface LedgerMirrorRoute {
+  name: string;
+  ledger: ILedgerService;
+}
+
+/**
+ * Mirror routes keyed by transaction reason
+ */
+export type LedgerMirrorRoutes = Partial<Record<TransactionReason, LedgerMirrorRoute>>;
+
+/**
+ * TeeLedgerService implementation
+ */
+export class TeeLedgerService implements ILedgerService {
+  private primary: ILedgerService;
+  private routes: LedgerMirrorRoutes;
+
+  constructor(primary: ILedgerService, routes: LedgerMirrorRoutes) {
+    this.primary = primary;
+    this.routes = { ...routes };
+  }
+
+  /**
+   * Write to the primary, then to the mirror routed for the entry's reason
+   *
+   * @throws MirrorWriteError if the primary write succeeded but the mirror failed
+   */
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    const entry = await this.primary.createEntry(request);
+
+    const route = this.routes[request.reason];
+    if (!route) {
+      return entry;
+    }
+
+    try {
+      await route.ledger.createEntry(request);
+    } catch (error) {
+      const cause = error instanceof Error ? error.message : 'Unknown error';
+
+      MetricsLogger.incrementCounter(MetricEventType.LEDGER_MIRROR_FAILED, {
+        route: route.name,
+        entryId: entry.entryId,
+        reason: request.reason,
+        error: cause,
+      });
+      MetricsLogger.logAlert({
+        severity: AlertSeverity.WARNING,
+        message: `Ledger entry ${entry.entryId} not mirrored to ${route.name}`,
+        metricType: MetricEventType.LEDGER_MIRROR_FAILED,
+        timestamp: new Date(),
+        metadata: {
+          route: route.name,
+          entryId: entry.entryId,
+          idempotencyKey: request.idempotencyKey,
+        },
+      });
+
+      throw new MirrorWriteError(entry.entryId, route.name, cause, entry);
+    }
+
+    return entry;
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.primary.queryEntries(filter);
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    return this.primary.getEntry(entryId);
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.primary.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.primary.getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.primary.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.primary.getAuditTrail(transactionId);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.primary.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.primary.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+}
@@ -0,0 +1,79 @@
+/**
+ * Append-Only Property Tests
+ */
+
+import { assertAppendOnly } from './append-only-property';
+import { InMemoryLedgerService } from './in-memory-ledger.service';
+import { CreateLedgerEntryRequest, LedgerEntry } from '../types';
+
+describe('assertAppendOnly', () => {
+  /** Stores that break the append-only promise in different ways */
+  class RewritingLedger extends InMemoryLedgerService {
+    async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+      const entry = await super.createEntry(request);
+      const entries: LedgerEntry[] = (this as any).entries;
+      if (entries.length > 3) {
+        entries[1].amount += 1;
+      }
+      return entry;
+    }
+  }
+
+  class EvictingLedger extends InMemoryLedgerService {
+    async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+      const entry = await super.createEntry(request);
+      const self = this as any;
+      if (self.entries.length > 4) {
+        self.entries = self.entries.slice(1);
+      }
+      return entry;
+    }
+  }
+
+  class AliasingLedger extends InMemoryLedgerService {
+    private handedOut: LedgerEntry[] = [];
+
+    async getEntry(entryId: string): Promise<LedgerEntry | null> {
+      const entry = await super.getEntry(entryId);
+      if (entry) {
+        this.handedOut.push(entry);
+      }
+      return entry;
+    }
+
+    async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+      // Reuses objects it already returned
+      this.handedOut.forEach(entry => (entry.metadata = { ...entry.metadata, reused: true }));
+      return super.createEntry(request);
+    }
+  }
+
+  it('passes a store that only appends', async () => {
+    const ledger = new InMemoryLedgerService();
+
+    await expect(assertAppendOnly(ledger, { operations: 200, seed: 7 })).resolves.toBeUndefined();
+    expect(ledger.size).toBeGreaterThan(0);
+  });
+
+  it('fails a store that alters an earlier entry', async () => {
+    await expect(assertAppendOnly(new RewritingLedger(), { operations: 100 })).rejects.toThrow('entry at position 1 changed');
+  });
+
+  it('fails a store that removes entries', async () => {
+    await expect(assertAppendOnly(new EvictingLedger(), { operations: 100 })).rejects.toThrow('Append-only violated');
+  });
+
+  it('fails a store that changes an entry it already returned', async () => {
+    await expect(assertAppendOnly(new AliasingLedger(), { operations: 100 })).rejects.toThrow('was changed afterwards');
+  });
+
+  it('replays the same sequence for the same seed', async () => {
+    const failure = (seed: number) =>
+      assertAppendOnly(new AliasingLedger(), { operations: 100, seed }).catch((error: Error) => error.message);
+
+    const first = await failure(42);
+
+    expect(first).toContain('seed 42');
+    await expect(failure(42)).resolves.toBe(first);
+  });
+});
@@ -0,0 +1,164 @@
+/**
+ * Append-Only Property
+ *
+ * Randomized check of the ledger's append-only promise. assertAppendOnly
+ * drives a store through a seeded sequence of appends, idempotent
+ * replays and reads, and after every operation checks two invariants:
+ * - every entry the store has returned so far still has the content it
+ *   had when returned, so the store never changes an object it handed out
+ * - the full ledger, listed oldest first, starts with the previous
+ *   listing unchanged, so earlier entries are never altered, removed or
+ *   reordered and new ones only land at the end
+ *
+ * The listing is read through queryEntries in ascending order, so the
+ * store must order entries it appended in append order. A violation
+ * throws with the seed and the operation that exposed it; rerunning with
+ * that seed replays the same sequence.
+ *
+ * Not for production use.
+ */
+
+import { ILedgerService, CreateLedgerEntryRequest, LedgerEntry, LedgerQueryResult } from '../types';
+import { TransactionType, TransactionReason } from '../../wallets/types';
+import { entryChecksum } from '../../tiering/tiering';
+
+/**
+ * Options for assertAppendOnly
+ */
+export interface AppendOnlyOptions {
+  /** Operations to run */
+  operations: number;
+
+  /** Seed of the operation sequence (default 1) */
+  seed?: number;
+
+  /** Accounts appended to (default 5) */
+  accounts?: number;
+}
+
+type Operation = 'append' | 'replay' | 'getEntry' | 'queryEntries' | 'getBalanceSnapshot' | 'getAuditTrail';
+
+const OPERATIONS: Operation[] = ['append', 'append', 'replay', 'getEntry', 'queryEntries', 'getBalanceSnapshot', 'getAuditTrail'];
+
+/**
+ * Entries read per page when listing the whole ledger
+ */
+const LISTING_PAGE_SIZE = 1000;
+
+/**
+ * Run a random sequence of operations and check the append-only invariants after each
+ *
+ * @throws Error describing the first violation
+ */
+export async function assertAppendOnly(ledger: ILedgerService, options: AppendOnlyOptions): Promise<void> {
+  const seed = options.seed ?? 1;
+  const accounts = options.accounts ?? 5;
+  const next = random(seed);
+  const pick = <T>(items: T[]): T => items[Math.floor(next() * items.length)];
+
+  const requests: CreateLedgerEntryRequest[] = [];
+  const appended: LedgerEntry[] = [];
+  const returned: Array<{ entry: LedgerEntry; checksum: string }> = [];
+  let listing = (await listAll(ledger)).map(entryChecksum);
+
+  const fail = (step: number, operation: Operation, problem: string): never => {
+    throw new Error(`Append-only violated after operation ${step} (${operation}, seed ${seed}): ${problem}`);
+  };
+  const keep = (entry: LedgerEntry | null) => {
+    if (entry) {
+      returned.push({ entry, checksum: entryChecksum(entry) });
+    }
+  };
+
+  for (let step = 1; step <= options.operations; step++) {
+    const operation = appended.length === 0 ? 'append' : pick(OPERATIONS);
+
+    switch (operation) {
+      case 'append': {
+        const amount = 1 + Math.floor(next() * 500);
+        const request: CreateLedgerEntryRequest = {
+          accountId: `append-only-${Math.floor(next() * accounts)}`,
+          accountType: 'user',
+          amount,
+          type: TransactionType.CREDIT,
+          balanceState: 'available',
+          stateTransition: 'none→available',
+          reason: TransactionReason.PROMOTIONAL_AWARD,
+          idempotencyKey: `append-only-${seed}-${step}`,
+          requestId: `append-only-${seed}-${step}`,
+          balanceBefore: 0,
+          balanceAfter: amount,
+        };
+        const entry = await ledger.createEntry(request);
+        requests.push(request);
+        appended.push(entry);
+        keep(entry);
+        break;
+      }
+      case 'replay': {
+        const i = Math.floor(next() * requests.length);
+        const replayed = await ledger.createEntry(requests[i]);
+        if (entryChecksum(replayed) !== entryChecksum(appended[i])) {
+          fail(step, operation, `replay of ${requests[i].idempotencyKey} returned a different entry`);
+        }
+        keep(replayed);
+        break;
+      }
+      case 'getEntry':
+        keep(await ledger.getEntry(pick(appended).entryId));
+        break;
+      case 'queryEntries':
+        (await ledger.queryEntries({ accountId: pick(appended).accountId })).entries.forEach(keep);
+        break;
+      case 'getBalanceSnapshot':
+        await ledger.getBalanceSnapshot(pick(appended).accountId, 'user');
+        break;
+      case 'getAuditTrail':
+        (await ledger.getAuditTrail(pick(appended).transactionId)).forEach(audit => keep(audit.ledgerEntry));
+        break;
+    }
+
+    const changed = returned.find(({ entry, checksum }) => entryChecksum(entry) !== checksum);
+    if (changed) {
+      fail(step, operation, `returned entry ${changed.entry.entryId} was changed afterwards`);
+    }
+
+    const current = (await listAll(ledger)).map(entryChecksum);
+    if (current.length < listing.length) {
+      fail(step, operation, `ledger shrank from ${listing.length} to ${current.length} entries`);
+    }
+    const moved = listing.findIndex((checksum, i) => current[i] !== checksum);
+    if (moved !== -1) {
+      fail(step, operation, `entry at position ${moved} changed`);
+    }
+    if (operation === 'append' && current.length !== listing.length + 1) {
+      fail(step, operation, `append grew the ledger by ${current.length - listing.length} entries`);
+    }
+    listing = current;
+  }
+}
+
+/**
+ * Every entry, oldest first
+ */
+async function listAll(ledger: ILedgerService): Promise<LedgerEntry[]> {
+  const entries: LedgerEntry[] = [];
+  let page: LedgerQueryResult;
+  do {
+    page = await ledger.queryEntries({ sortOrder: 'asc', offset: entries.length, limit: LISTING_PAGE_SIZE });
+    entries.push(...page.entries);
+  } while (page.hasMore && page.entries.length > 0);
+  return entries;
+}
+
+/**
+ * Deterministic pseudo-random source (mulberry32)
+ */
+function random(seed: number): () => number {
+  return () => {
+    seed = (seed + 0x6d2b79f5) | 0;
+    let t = Math.imul(seed ^ (seed >>> 15), 1 | seed);
+    t = (t + Math.imul(t ^ (t >>> 7), 61 | t)) ^ t;
+    return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+  };
+}
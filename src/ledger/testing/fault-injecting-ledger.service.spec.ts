@@ -0,0 +1,118 @@
+/**
+ * Fault Injecting Ledger Service Tests
+ */
+
+import { FaultInjectingLedgerService } from './fault-injecting-ledger.service';
+import { ILedgerService, CreateLedgerEntryRequest } from '../types';
+import { TransactionType, TransactionReason } from '../../wallets/types';
+
+describe('FaultInjectingLedgerService', () => {
+  let inner: jest.Mocked<ILedgerService>;
+  let service: FaultInjectingLedgerService;
+
+  const request: CreateLedgerEntryRequest = {
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 100,
+  };
+
+  const emptyResult = { entries: [], totalCount: 0, offset: 0, limit: 100, hasMore: false };
+
+  beforeEach(() => {
+    inner = {
+      createEntry: jest.fn().mockResolvedValue({ entryId: 'entry-1' }),
+      queryEntries: jest.fn().mockResolvedValue(emptyResult),
+      getEntry: jest.fn().mockResolvedValue(null),
+      getBalanceSnapshot: jest.fn().mockResolvedValue({ accountId: 'user-123' }),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn().mockResolvedValue([]),
+      checkIdempotency: jest.fn().mockResolvedValue(false),
+      storeIdempotencyResult: jest.fn().mockResolvedValue(undefined),
+    } as any;
+    service = new FaultInjectingLedgerService(inner);
+  });
+
+  it('should delegate when no faults are injected', async () => {
+    await expect(service.createEntry(request)).resolves.toEqual({ entryId: 'entry-1' });
+    expect(inner.createEntry).toHaveBeenCalledWith(request);
+  });
+
+  it('should fail the next createEntry once, then resume', async () => {
+    service.failNextCreateEntry(new Error('write timeout'));
+
+    await expect(service.createEntry(request)).rejects.toThrow('write timeout');
+    expect(inner.createEntry).not.toHaveBeenCalled();
+
+    await expect(service.createEntry(request)).resolves.toEqual({ entryId: 'entry-1' });
+  });
+
+  it('should queue multiple one-shot faults in order', async () => {
+    service.failNext('checkIdempotency', new Error('first'));
+    service.failNext('checkIdempotency', new Error('second'));
+
+    await expect(service.checkIdempotency('k', 'op')).rejects.toThrow('first');
+    await expect(service.checkIdempotency('k', 'op')).rejects.toThrow('second');
+    await expect(service.checkIdempotency('k', 'op')).resolves.toBe(false);
+  });
+
+  it('should fail queries for one account until cleared', async () => {
+    service.failQueriesForAccount('user-123', new Error('shard unavailable'));
+
+    await expect(service.queryEntries({ accountId: 'user-123' })).rejects.toThrow('shard unavailable');
+    await expect(service.getBalanceSnapshot('user-123', 'user')).rejects.toThrow('shard unavailable');
+    await expect(service.queryEntries({ accountId: 'user-456' })).resolves.toEqual(emptyResult);
+
+    service.clearAccountFault('user-123');
+
+    await expect(service.queryEntries({ accountId: 'user-123' })).resolves.toEqual(emptyResult);
+  });
+
+  it('should drop all faults on clearFaults', async () => {
+    service.failNextCreateEntry(new Error('boom'));
+    service.failQueriesForAccount('user-123', new Error('boom'));
+
+    service.clearFaults();
+
+    await expect(service.createEntry(request)).resolves.toBeDefined();
+    await expect(service.queryEntries({ accountId: 'user-123' })).resolves.toBeDefined();
+  });
+
+  describe('latency', () => {
+    beforeEach(() => {
+      jest.useFakeTimers();
+    });
+
+    afterEach(() => {
+      jest.useRealTimers();
+    });
+
+    it('should delay a method until the latency is cleared', async () => {
+      service.setLatency('queryEntries', 500);
+
+      let settled = false;
+      const pending = service.queryEntries({ accountId: 'user-123' }).then(() => (settled = true));
+      await jest.advanceTimersByTimeAsync(499);
+      expect(settled).toBe(false);
+      await jest.advanceTimersByTimeAsync(1);
+      await pending;
+      expect(settled).toBe(true);
+
+      service.clearLatency('queryEntries');
+      await expect(service.queryEntries({ accountId: 'user-123' })).resolves.toEqual(emptyResult);
+    });
+
+    it('should leave other methods undelayed', async () => {
+      service.setLatency('queryEntries', 500);
+
+      await expect(service.getEntry('entry-1')).resolves.toBeNull();
+    });
+  });
+});
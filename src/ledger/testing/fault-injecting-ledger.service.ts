@@ -0,0 +1,200 @@
+/**
+ * Fault Injecting Ledger Service
+ *
+ * Test double that wraps any ILedgerService and returns controlled
+ * failures from specific methods, delegating everything else. Used to
+ * exercise retry and fallback paths without touching the real ledger.
+ * Latency can also be added to a method, to exercise paths that react
+ * to a slow store.
+ *
+ * Not for production use.
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from '../types';
+
+/**
+ * Ledger service methods that can have faults injected
+ */
+export type LedgerServiceMethod = keyof ILedgerService;
+
+/**
+ * FaultInjectingLedgerService implementation
+ */
+export class FaultInjectingLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private pendingFaults: Map<LedgerServiceMethod, Error[]> = new Map();
+  private accountFaults: Map<string, Error> = new Map();
+  private latencies: Map<LedgerServiceMethod, number> = new Map();
+
+  constructor(inner: ILedgerService) {
+    this.inner = inner;
+  }
+
+  /**
+   * Fail the next call to a method with the given error
+   * Multiple calls queue multiple one-shot failures
+   */
+  failNext(method: LedgerServiceMethod, error: Error): void {
+    const queue = this.pendingFaults.get(method) || [];
+    queue.push(error);
+    this.pendingFaults.set(method, queue);
+  }
+
+  /**
+   * Fail the next createEntry call with the given error
+   */
+  failNextCreateEntry(error: Error): void {
+    this.failNext('createEntry', error);
+  }
+
+  /**
+   * Fail every queryEntries and getBalanceSnapshot call for an account
+   * until the fault is cleared
+   */
+  failQueriesForAccount(accountId: string, error: Error): void {
+    this.accountFaults.set(accountId, error);
+  }
+
+  /**
+   * Remove an account fault
+   */
+  clearAccountFault(accountId: string): void {
+    this.accountFaults.delete(accountId);
+  }
+
+  /**
+   * Delay every call to a method by the given time until cleared
+   */
+  setLatency(method: LedgerServiceMethod, ms: number): void {
+    this.latencies.set(method, ms);
+  }
+
+  /**
+   * Remove the latency from a method, or from every method
+   */
+  clearLatency(method?: LedgerServiceMethod): void {
+    if (method) {
+      this.latencies.delete(method);
+    } else {
+      this.latencies.clear();
+    }
+  }
+
+  /**
+   * Remove all pending and account faults and all latency
+   */
+  clearFaults(): void {
+    this.pendingFaults.clear();
+    this.accountFaults.clear();
+    this.latencies.clear();
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    await this.delay('createEntry');
+    this.throwIfPending('createEntry');
+    return this.inner.createEntry(request);
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    await this.delay('queryEntries');
+    this.throwIfPending('queryEntries');
+    this.throwIfAccountFault(filter.accountId);
+    return this.inner.queryEntries(filter);
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    await this.delay('getEntry');
+    this.throwIfPending('getEntry');
+    return this.inner.getEntry(entryId);
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    await this.delay('entryExists');
+    this.throwIfPending('entryExists');
+    return this.inner.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    await this.delay('getBalanceSnapshot');
+    this.throwIfPending('getBalanceSnapshot');
+    this.throwIfAccountFault(accountId);
+    return this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    await this.delay('generateReconciliationReport');
+    this.throwIfPending('generateReconciliationReport');
+    this.throwIfAccountFault(accountId);
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    await this.delay('getAuditTrail');
+    this.throwIfPending('getAuditTrail');
+    return this.inner.getAuditTrail(transactionId);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    await this.delay('checkIdempotency');
+    this.throwIfPending('checkIdempotency');
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    await this.delay('storeIdempotencyResult');
+    this.throwIfPending('storeIdempotencyResult');
+    return this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  /**
+   * Wait out the latency set for a method, if any
+   */
+  private async delay(method: LedgerServiceMethod): Promise<void> {
+    const ms = this.latencies.get(method);
+    if (ms) {
+      await new Promise(resolve => setTimeout(resolve, ms));
+    }
+  }
+
+  /**
+   * Consume and throw the next one-shot fault for a method, if any
+   */
+  private throwIfPending(method: LedgerServiceMethod): void {
+    const queue = this.pendingFaults.get(method);
+    if (queue && queue.length > 0) {
+      throw queue.shift()!;
+    }
+  }
+
+  /**
+   * Throw the standing fault for an account, if any
+   */
+  private throwIfAccountFault(accountId?: string): void {
+    if (accountId && this.accountFaults.has(accountId)) {
+      throw this.accountFaults.get(accountId)!;
+    }
+  }
+}
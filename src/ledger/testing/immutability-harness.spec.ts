@@ -0,0 +1,140 @@
+/**
+ * Immutability Harness Tests
+ */
+
+import { verifyImmutability, recordMutations } from './immutability-harness';
+import { InMemoryLedgerService } from './in-memory-ledger.service';
+import { CreateLedgerEntryRequest, LedgerEntry } from '../types';
+import { TransactionType, TransactionReason } from '../../wallets/types';
+
+describe('immutability harness', () => {
+  const fixture = (accountId: string, key: string, amount = 100): CreateLedgerEntryRequest => ({
+    accountId,
+    accountType: 'user',
+    amount,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: key,
+    requestId: `req-${key}`,
+    balanceBefore: 0,
+    balanceAfter: amount,
+  });
+
+  const fixtures = [fixture('user-1', 'f-1'), fixture('user-2', 'f-2', 40)];
+
+  /** Stores with a method that breaks the ledger's guarantees */
+  class AmendingLedger extends InMemoryLedgerService {
+    async amend(entryId: string): Promise<void> {
+      const entry = (this as any).entries.find((e: LedgerEntry) => e.entryId === entryId);
+      if (entry) {
+        entry.amount += 1;
+      }
+    }
+  }
+
+  class PurgingLedger extends InMemoryLedgerService {
+    async purge(accountId: string, accountType: string): Promise<void> {
+      const self = this as any;
+      self.entries = self.entries.filter((e: LedgerEntry) => e.accountId !== accountId || e.accountType !== accountType);
+    }
+  }
+
+  it('passes a store whose methods only append and read', async () => {
+    const report = await verifyImmutability(new InMemoryLedgerService(), { fixtures });
+
+    expect(report).toMatchObject({ passed: true, altered: [], missing: [], countBefore: 2, mutations: [] });
+    expect(report.countAfter).toBeGreaterThanOrEqual(2);
+    expect(report.exercised).toEqual(expect.arrayContaining(['createEntry', 'importEntry', 'getAuditTrail']));
+  });
+
+  it('finds a method that alters an entry', async () => {
+    const ledger = new AmendingLedger();
+
+    const report = await verifyImmutability(ledger, { fixtures });
+
+    expect(report.passed).toBe(false);
+    expect(report.exercised).toContain('amend');
+    expect(report.altered).toHaveLength(1);
+  });
+
+  it('finds a method that removes entries', async () => {
+    const report = await verifyImmutability(new PurgingLedger(), { fixtures });
+
+    expect(report.passed).toBe(false);
+    expect(report.exercised).toContain('purge');
+    expect(report.missing).toHaveLength(1);
+  });
+
+  it('skips listed methods and runs explicit calls', async () => {
+    const amend = jest.fn(async (ledger: any, entries: LedgerEntry[]) => ledger.amend(entries[1].entryId));
+
+    const report = await verifyImmutability(new AmendingLedger(), { fixtures, skip: ['amend'], calls: [amend] });
+
+    expect(report.exercised).not.toContain('amend');
+    expect(amend).toHaveBeenCalled();
+    expect(report.altered).toHaveLength(1);
+  });
+
+  it('stops waiting on a call that never settles', async () => {
+    class BlockingLedger extends InMemoryLedgerService {
+      waitForever(): Promise<void> {
+        return new Promise(() => undefined);
+      }
+    }
+
+    const report = await verifyImmutability(new BlockingLedger(), { fixtures, callTimeoutMs: 5 });
+
+    expect(report).toMatchObject({ passed: true });
+    expect(report.exercised).toContain('waitForever');
+  });
+
+  it('rejects an empty fixture set', async () => {
+    await expect(verifyImmutability(new InMemoryLedgerService(), { fixtures: [] })).rejects.toThrow('at least one fixture');
+  });
+
+  describe('recordMutations', () => {
+    const collection = () => ({
+      insertOne: jest.fn().mockResolvedValue({}),
+      updateOne: jest.fn().mockResolvedValue({}),
+      deleteMany: jest.fn().mockResolvedValue({}),
+      bulkWrite: jest.fn().mockResolvedValue({}),
+    });
+
+    it('records updates, deletes and mutating bulk writes but not inserts', async () => {
+      const target = collection();
+      const updateOne = target.updateOne;
+      const log = recordMutations(target);
+
+      await target.insertOne({ entryId: 'e1' });
+      await target.bulkWrite([{ insertOne: { document: {} } }]);
+      await target.updateOne({ entryId: 'e1' }, { $set: { amount: 1 } });
+      await target.bulkWrite([{ insertOne: { document: {} } }, { deleteOne: { filter: {} } }]);
+      await target.deleteMany({});
+
+      expect(log.operations).toEqual(['updateOne', 'bulkWrite', 'deleteMany']);
+      expect(updateOne).toHaveBeenCalledWith({ entryId: 'e1' }, { $set: { amount: 1 } });
+
+      log.restore();
+      expect(target.updateOne).toBe(updateOne);
+    });
+
+    it('fails a store that issues a mutation to its collection', async () => {
+      const target = collection();
+      class WritingLedger extends InMemoryLedgerService {
+        async touch(entryId: string): Promise<void> {
+          await target.updateOne({ entryId }, { $set: { touched: true } });
+        }
+      }
+      const log = recordMutations(target);
+
+      const report = await verifyImmutability(new WritingLedger(), { fixtures, mutations: log });
+
+      expect(report.passed).toBe(false);
+      expect(report.altered).toEqual([]);
+      expect(report.mutations.length).toBeGreaterThan(0);
+      expect(new Set(report.mutations)).toEqual(new Set(['updateOne']));
+    });
+  });
+});
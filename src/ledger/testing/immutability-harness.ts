@@ -0,0 +1,244 @@
+/**
+ * Immutability Harness
+ *
+ * Checks that no method of a ledger store can alter or remove an entry.
+ * verifyImmutability appends a fixture set, records each stored entry's
+ * checksum and the store's entry count, then calls every method the
+ * store has. Methods are found by walking the prototype chain, so
+ * private helpers and methods added later are covered without listing
+ * them. Each method is called with a fixed set of argument shapes built
+ * from the fixtures (nothing, an entry ID, a transaction ID, an account,
+ * a query filter, a fixture request, a stored entry); errors are
+ * expected and ignored. Afterwards every original entry must still be
+ * readable with the same checksum, and the count must not have dropped.
+ * Appends are allowed.
+ *
+ * Methods needing arguments the shapes cannot supply get explicit calls
+ * through `calls`. For a MongoDB store, recordMutations wraps the ledger
+ * collection and reports every update, replace, delete or drop issued
+ * through it, whatever the store's own methods return.
+ *
+ * Not for production use.
+ */
+
+import { ILedgerService, CreateLedgerEntryRequest, LedgerEntry } from '../types';
+import { entryChecksum } from '../../tiering/tiering';
+
+/**
+ * Collection operations that change or remove documents
+ */
+export const MUTATING_OPERATIONS = [
+  'updateOne',
+  'updateMany',
+  'replaceOne',
+  'deleteOne',
+  'deleteMany',
+  'findOneAndUpdate',
+  'findOneAndReplace',
+  'findOneAndDelete',
+  'bulkWrite',
+  'drop',
+] as const;
+
+/**
+ * Mutating operations issued while recording
+ */
+export interface MutationLog {
+  /** Operation names in the order they were issued */
+  readonly operations: string[];
+
+  /** Put the collection's own methods back */
+  restore(): void;
+}
+
+/**
+ * Record every mutating operation issued through a collection
+ * Operations still run, so the store behaves as it would unobserved.
+ * bulkWrite is recorded only when it holds an update, replace or delete.
+ */
+export function recordMutations(collection: Record<string, any>): MutationLog {
+  const operations: string[] = [];
+  const originals = new Map<string, unknown>();
+
+  for (const name of MUTATING_OPERATIONS) {
+    const original = collection[name];
+    if (typeof original !== 'function') {
+      continue;
+    }
+
+    originals.set(name, Object.prototype.hasOwnProperty.call(collection, name) ? original : undefined);
+    collection[name] = function (this: unknown, ...args: any[]) {
+      if (name !== 'bulkWrite' || (args[0] || []).some((op: Record<string, unknown>) => !('insertOne' in op))) {
+        operations.push(name);
+      }
+      return original.apply(this, args);
+    };
+  }
+
+  return {
+    operations,
+    restore: () => {
+      for (const [name, original] of originals) {
+        if (original === undefined) {
+          delete collection[name];
+        } else {
+          collection[name] = original;
+        }
+      }
+    },
+  };
+}
+
+/**
+ * Options for verifyImmutability
+ */
+export interface ImmutabilityOptions {
+  /** Entries appended before any method is exercised (at least one) */
+  fixtures: CreateLedgerEntryRequest[];
+
+  /** Explicit calls, run after the discovered ones, for methods with unusual arguments */
+  calls?: Array<(ledger: ILedgerService, entries: LedgerEntry[]) => Promise<unknown>>;
+
+  /** Methods never called (for example ones that block until an event) */
+  skip?: string[];
+
+  /** Longest wait for one call (default 1000ms) */
+  callTimeoutMs?: number;
+
+  /** Mutation log of the store's collection, checked alongside the entries */
+  mutations?: MutationLog;
+}
+
+export interface ImmutabilityReport {
+  passed: boolean;
+
+  /** Methods called, in the order they were discovered */
+  exercised: string[];
+
+  /** Entry IDs whose checksum changed */
+  altered: string[];
+
+  /** Entry IDs that can no longer be read */
+  missing: string[];
+
+  countBefore: number;
+  countAfter: number;
+
+  /** Mutating operations issued to the collection */
+  mutations: string[];
+}
+
+const DEFAULT_CALL_TIMEOUT_MS = 1000;
+
+/**
+ * Prove that exercising a store leaves its entries intact
+ *
+ * @throws Error if there are no fixtures or a fixture cannot be read back
+ */
+export async function verifyImmutability(
+  ledger: ILedgerService,
+  options: ImmutabilityOptions
+): Promise<ImmutabilityReport> {
+  if (options.fixtures.length === 0) {
+    throw new Error('verifyImmutability needs at least one fixture');
+  }
+
+  const entries: LedgerEntry[] = [];
+  const checksums = new Map<string, string>();
+  for (const fixture of options.fixtures) {
+    const created = await ledger.createEntry(fixture);
+    const stored = await ledger.getEntry(created.entryId);
+    if (!stored) {
+      throw new Error(`Fixture ${fixture.idempotencyKey} cannot be read back`);
+    }
+    entries.push(stored);
+    checksums.set(stored.entryId, entryChecksum(stored));
+  }
+  const countBefore = await countEntries(ledger);
+  const mutationsBefore = options.mutations?.operations.length ?? 0;
+
+  const timeoutMs = options.callTimeoutMs ?? DEFAULT_CALL_TIMEOUT_MS;
+  const exercised = discoverMethods(ledger).filter(name => !(options.skip || []).includes(name));
+  for (const name of exercised) {
+    for (const args of argumentShapes(options.fixtures[0], entries[0])) {
+      await settle(() => (ledger as any)[name](...args), timeoutMs);
+    }
+  }
+  for (const call of options.calls || []) {
+    await settle(() => call(ledger, entries), timeoutMs);
+  }
+
+  const altered: string[] = [];
+  const missing: string[] = [];
+  for (const [entryId, checksum] of checksums) {
+    const now = await ledger.getEntry(entryId).catch(() => null);
+    if (!now) {
+      missing.push(entryId);
+    } else if (entryChecksum(now) !== checksum) {
+      altered.push(entryId);
+    }
+  }
+  const countAfter = await countEntries(ledger);
+  const mutations = options.mutations?.operations.slice(mutationsBefore) ?? [];
+
+  return {
+    passed: altered.length === 0 && missing.length === 0 && countAfter >= countBefore && mutations.length === 0,
+    exercised,
+    altered,
+    missing,
+    countBefore,
+    countAfter,
+    mutations,
+  };
+}
+
+/**
+ * Every method on the store's prototype chain, getters excluded
+ */
+function discoverMethods(ledger: ILedgerService): string[] {
+  const names: string[] = [];
+  for (let proto = Object.getPrototypeOf(ledger); proto && proto !== Object.prototype; proto = Object.getPrototypeOf(proto)) {
+    for (const name of Object.getOwnPropertyNames(proto)) {
+      const descriptor = Object.getOwnPropertyDescriptor(proto, name)!;
+      if (name !== 'constructor' && typeof descriptor.value === 'function' && !names.includes(name)) {
+        names.push(name);
+      }
+    }
+  }
+  return names;
+}
+
+function argumentShapes(fixture: CreateLedgerEntryRequest, entry: LedgerEntry): unknown[][] {
+  return [
+    [],
+    [entry.entryId],
+    [entry.transactionId],
+    [entry.accountId, entry.accountType],
+    [{ accountId: entry.accountId, limit: 10 }],
+    [fixture],
+    [structuredClone(entry)],
+  ];
+}
+
+/**
+ * Run a call, ignoring its result, its error and anything past the timeout
+ */
+async function settle(call: () => unknown, timeoutMs: number): Promise<void> {
+  let timer: NodeJS.Timeout | undefined;
+  try {
+    await Promise.race([
+      Promise.resolve().then(call),
+      new Promise(resolve => {
+        timer = setTimeout(resolve, timeoutMs);
+      }),
+    ]);
+  } catch {
+    // Rejected arguments are expected; only the stored entries matter
+  } finally {
+    clearTimeout(timer);
+  }
+}
+
+async function countEntries(ledger: ILedgerService): Promise<number> {
+  return (await ledger.queryEntries({ limit: 1 })).totalCount;
+}
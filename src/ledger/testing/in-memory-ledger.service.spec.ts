@@ -0,0 +1,199 @@
+/**
+ * In-Memory Ledger Service Tests
+ */
+
+import { InMemoryLedgerService } from './in-memory-ledger.service';
+import { HookedLedgerService } from '../hooked-ledger.service';
+import { CreateLedgerEntryRequest, LedgerEntry } from '../types';
+import { TransactionType, TransactionReason } from '../../wallets/types';
+
+describe('InMemoryLedgerService reset', () => {
+  const credit = (key: string): CreateLedgerEntryRequest => ({
+    accountId: 'user-1',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: key,
+    requestId: `req-${key}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+  });
+
+  const env = process.env.NODE_ENV;
+
+  afterEach(() => {
+    process.env.NODE_ENV = env;
+  });
+
+  it('empties entries, idempotency keys and balances', async () => {
+    const ledger = new InMemoryLedgerService('suite', { resettable: true });
+    const first = await ledger.createEntry(credit('key-1'));
+    await ledger.storeIdempotencyResult('key-1', 'award');
+
+    ledger.reset();
+
+    expect(ledger.size).toBe(0);
+    await expect(ledger.getEntry(first.entryId)).resolves.toBeNull();
+    await expect(ledger.checkIdempotency('key-1', 'award')).resolves.toBe(false);
+    await expect(ledger.getBalanceSnapshot('user-1', 'user')).resolves.toMatchObject({ availableBalance: 0 });
+  });
+
+  it('keeps the store\'s name, options and the wiring around it', async () => {
+    const ledger = new InMemoryLedgerService('suite', { resettable: true });
+    const seen: string[] = [];
+    const hooked = new HookedLedgerService(ledger);
+    hooked.registerHook({
+      name: 'recorder',
+      afterAppend: async entry => {
+        seen.push(entry.idempotencyKey);
+      },
+    });
+    const before = await hooked.createEntry(credit('key-1'));
+
+    ledger.reset();
+    const after = await hooked.createEntry(credit('key-1'));
+
+    expect(after.entryId).toMatch(/^suite-/);
+    expect(after.entryId).not.toBe(before.entryId);
+    expect(after.timestamp.getTime()).toBeGreaterThan(before.timestamp.getTime());
+    expect(seen).toEqual(['key-1', 'key-1']);
+    expect(() => ledger.reset()).not.toThrow();
+  });
+
+  it('refuses a store not created resettable', async () => {
+    const ledger = new InMemoryLedgerService();
+    await ledger.createEntry(credit('key-1'));
+
+    expect(() => ledger.reset()).toThrow('not created resettable');
+    expect(ledger.size).toBe(1);
+  });
+
+  it('is unavailable in production', () => {
+    process.env.NODE_ENV = 'production';
+
+    expect(() => new InMemoryLedgerService('suite', { resettable: true }).reset()).toThrow('unavailable in production');
+  });
+});
+
+describe('InMemoryLedgerService backfillStreamVersions', () => {
+  let minute = 0;
+
+  // An entry as recorded elsewhere, with or without a stream version
+  const legacy = (key: string, accountId: string, streamVersion?: number): LedgerEntry => ({
+    entryId: `legacy-${key}`,
+    transactionId: `txn-${key}`,
+    accountId,
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: key,
+    requestId: `req-${key}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+    timestamp: new Date(Date.UTC(2023, 0, 1, 0, ++minute)),
+    currency: 'points',
+    streamVersion,
+  });
+
+  const versions = async (ledger: InMemoryLedgerService, accountId: string, tenantId?: string) =>
+    (await ledger.queryEntries({ accountId, tenantId, sortOrder: 'asc' })).entries.map(entry => entry.streamVersion);
+
+  it('numbers unsequenced entries around the versions already assigned, per user', async () => {
+    const ledger = new InMemoryLedgerService('migration', { allowBackfill: true });
+    for (const entry of [
+      legacy('a1', 'user-a'),
+      legacy('b1', 'user-b', 1),
+      legacy('a2', 'user-a'),
+      legacy('a3', 'user-a', 3),
+      legacy('b2', 'user-b'),
+      legacy('a4', 'user-a', 0),
+    ]) {
+      await ledger.importEntry(entry);
+    }
+
+    expect(ledger.backfillStreamVersions()).toBe(4);
+
+    await expect(versions(ledger, 'user-a')).resolves.toEqual([1, 2, 3, 4]);
+    await expect(versions(ledger, 'user-b')).resolves.toEqual([1, 2]);
+    expect(ledger.backfillStreamVersions()).toBe(0);
+  });
+
+  it('numbers the same user separately under each tenant', async () => {
+    const ledger = new InMemoryLedgerService('migration', { allowBackfill: true });
+    for (const entry of [
+      { ...legacy('a1', 'user-a'), tenantId: 'tenant-1' },
+      { ...legacy('a1', 'user-a'), tenantId: 'tenant-2', entryId: 'legacy-t2-a1' },
+      { ...legacy('a2', 'user-a', 2), tenantId: 'tenant-2' },
+      { ...legacy('a2', 'user-a'), tenantId: 'tenant-1', entryId: 'legacy-t1-a2' },
+    ]) {
+      await ledger.importEntry(entry);
+    }
+
+    expect(ledger.backfillStreamVersions()).toBe(3);
+
+    await expect(versions(ledger, 'user-a', 'tenant-1')).resolves.toEqual([1, 2]);
+    await expect(versions(ledger, 'user-a', 'tenant-2')).resolves.toEqual([1, 2]);
+  });
+
+  it('leaves a fully sequenced history and non-user entries alone', async () => {
+    const ledger = new InMemoryLedgerService('migration', { allowBackfill: true });
+    await ledger.importEntry(legacy('a1', 'user-a', 1));
+    await ledger.importEntry(legacy('a2', 'user-a', 5));
+    await ledger.importEntry({ ...legacy('m1', 'model-1'), accountType: 'model' });
+
+    expect(ledger.backfillStreamVersions()).toBe(0);
+    await expect(versions(ledger, 'user-a')).resolves.toEqual([1, 5]);
+    await expect(versions(ledger, 'model-1')).resolves.toEqual([undefined]);
+  });
+
+  it('changes nothing when filling a gap would break the order', async () => {
+    const ledger = new InMemoryLedgerService('migration', { allowBackfill: true });
+    await ledger.importEntry(legacy('a1', 'user-a', 1));
+    await ledger.importEntry(legacy('b1', 'user-b'));
+    await ledger.importEntry(legacy('a2', 'user-a'));
+    await ledger.importEntry(legacy('a3', 'user-a', 2));
+
+    expect(() => ledger.backfillStreamVersions()).toThrow('entry legacy-a3 has version 2 but follows version 2');
+
+    await expect(versions(ledger, 'user-a')).resolves.toEqual([1, undefined, 2]);
+    await expect(versions(ledger, 'user-b')).resolves.toEqual([undefined]);
+  });
+
+  it('continues each stream from the backfill once appends are tracked', async () => {
+    const ledger = new InMemoryLedgerService('migration', { allowBackfill: true, trackStreamVersions: true });
+    await ledger.importEntry(legacy('a1', 'user-a'));
+    await ledger.importEntry(legacy('a2', 'user-a'));
+    ledger.backfillStreamVersions();
+
+    const appended = await ledger.createEntry({
+      accountId: 'user-a',
+      accountType: 'user',
+      amount: 50,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey: 'a3',
+      requestId: 'req-a3',
+      balanceBefore: 200,
+      balanceAfter: 250,
+    });
+
+    expect(appended.streamVersion).toBe(3);
+    await expect(versions(ledger, 'user-a')).resolves.toEqual([1, 2, 3]);
+  });
+
+  it('refuses a store not created with allowBackfill', async () => {
+    const ledger = new InMemoryLedgerService();
+    await ledger.importEntry(legacy('a1', 'user-a'));
+
+    expect(() => ledger.backfillStreamVersions()).toThrow('not created with allowBackfill');
+    await expect(versions(ledger, 'user-a')).resolves.toEqual([undefined]);
+  });
+});
@@ -0,0 +1,331 @@
+/**
+ * In-Memory Ledger Service
+ *
+ * Test double that keeps entries in process memory and follows the
+ * ledger's contract: an idempotency key is unique within its scope and a
+ * repeated key replays the stored entry, queries honour the filter,
+ * sort and paging fields, and balances are summed per balance state.
+ * Used where a test needs several independent stores.
+ *
+ * A store built with `resettable` can be emptied with reset(), so a
+ * suite can reuse one store and the wiring around it between tests.
+ * Other stores refuse, as does every store when NODE_ENV is production,
+ * so reset() cannot be mistaken for a way to delete ledger entries.
+ *
+ * A store built with `trackStreamVersions` numbers each user's appends,
+ * as LedgerService does with the option of the same name. A store built
+ * with `allowBackfill` can run backfillStreamVersions(), the migration
+ * that stamps stream versions onto legacy user entries recorded before
+ * versions were tracked, so suites can rehearse it against imported
+ * history. It is the one method that changes stored entries, which is
+ * why other stores refuse it.
+ *
+ * Not for production use.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  CreateLedgerEntryResult,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from '../types';
+
+/**
+ * Options for an in-memory ledger
+ */
+export interface InMemoryLedgerOptions {
+  /** Allow reset() between tests (default false) */
+  resettable?: boolean;
+
+  /** Allow backfillStreamVersions() to stamp stored entries (default false) */
+  allowBackfill?: boolean;
+
+  /** Give each user entry the next version of its stream on append (default false) */
+  trackStreamVersions?: boolean;
+}
+
+/**
+ * InMemoryLedgerService implementation
+ */
+export class InMemoryLedgerService implements ILedgerService {
+  private entries: LedgerEntry[] = [];
+  private idempotency = new Set<string>();
+  private name: string;
+  private sequence = 0;
+  private resettable: boolean;
+  private allowBackfill: boolean;
+  private trackStreamVersions: boolean;
+
+  /**
+   * @param name Prefix of generated entry IDs, so stores never assign the same ID
+   */
+  constructor(name = 'memory', options: InMemoryLedgerOptions = {}) {
+    this.name = name;
+    this.resettable = options.resettable === true;
+    this.allowBackfill = options.allowBackfill === true;
+    this.trackStreamVersions = options.trackStreamVersions === true;
+  }
+
+  /**
+   * Empty the store for the next test, keeping its name and options
+   * Runs synchronously, so no append or read can observe a partial reset.
+   * Timestamps keep increasing across resets.
+   *
+   * @throws Error unless the store is resettable and NODE_ENV is not production
+   */
+  reset(): void {
+    if (process.env.NODE_ENV === 'production') {
+      throw new Error('In-memory ledger reset is unavailable in production');
+    }
+    if (!this.resettable) {
+      throw new Error(`In-memory ledger ${this.name} was not created resettable`);
+    }
+
+    this.entries = [];
+    this.idempotency.clear();
+  }
+
+  /**
+   * Give each user entry without a stream version the next version of its
+   * user's stream, in stored order, keeping versions already assigned.
+   * Checks every stream before changing any entry, and runs synchronously,
+   * so no append or read can observe a partial backfill. LedgerService
+   * has the same migration for stored history.
+   *
+   * @returns Number of entries stamped
+   * @throws Error unless the store allows backfills, or if an assigned
+   *   version is not above the one before it once gaps are filled
+   */
+  backfillStreamVersions(): number {
+    if (!this.allowBackfill) {
+      throw new Error(`In-memory ledger ${this.name} was not created with allowBackfill`);
+    }
+
+    const last = new Map<string, number>();
+    const stamps: Array<{ entry: LedgerEntry; version: number }> = [];
+    for (const entry of this.entries) {
+      if (entry.accountType !== 'user') {
+        continue;
+      }
+
+      // Streams are per tenant and user, as nextStreamVersion numbers them
+      const stream = `${entry.tenantId ?? ''}\u0000${entry.accountId}`;
+      const previous = last.get(stream) ?? 0;
+      if (entry.streamVersion === undefined || entry.streamVersion === 0) {
+        stamps.push({ entry, version: previous + 1 });
+        last.set(stream, previous + 1);
+      } else if (entry.streamVersion <= previous) {
+        throw new Error(
+          `Cannot backfill stream of ${entry.accountId}: entry ${entry.entryId} has version ${entry.streamVersion} ` +
+            `but follows version ${previous}`
+        );
+      } else {
+        last.set(stream, entry.streamVersion);
+      }
+    }
+
+    stamps.forEach(({ entry, version }) => (entry.streamVersion = version));
+    return stamps.length;
+  }
+
+  /**
+   * Number of entries held
+   */
+  get size(): number {
+    return this.entries.length;
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return (await this.createEntryWithResult(request)).entry;
+  }
+
+  async createEntryWithResult(request: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult> {
+    const existing = this.entries.find(
+      e =>
+        e.tenantId === request.tenantId &&
+        e.idempotencyKey === request.idempotencyKey &&
+        e.idempotencyScope === request.idempotencyScope
+    );
+    if (existing) {
+      return { entry: structuredClone(existing), inserted: false };
+    }
+
+    const entry: LedgerEntry = {
+      ...structuredClone(request),
+      entryId: request.entryId || `${this.name}-${uuidv4()}`,
+      transactionId: request.transactionId || uuidv4(),
+      // Strictly increasing, so entries keep their append order
+      timestamp: request.timestamp ? new Date(request.timestamp) : new Date(Date.UTC(2024, 0, 1) + ++this.sequence),
+      currency: request.currency || 'points',
+    };
+    if (this.trackStreamVersions && entry.accountType === 'user') {
+      entry.streamVersion = this.nextStreamVersion(entry);
+    }
+    this.entries.push(entry);
+    return { entry: structuredClone(entry), inserted: true };
+  }
+
+  /**
+   * One past the highest version of the entry's user stream
+   */
+  private nextStreamVersion(entry: LedgerEntry): number {
+    return (
+      this.entries
+        .filter(e => e.tenantId === entry.tenantId && e.accountId === entry.accountId && e.accountType === 'user')
+        .reduce((highest, e) => Math.max(highest, e.streamVersion || 0), 0) + 1
+    );
+  }
+
+  /**
+   * Store an entry recorded elsewhere as it was; replays one held under the same ID
+   */
+  async importEntry(entry: LedgerEntry): Promise<CreateLedgerEntryResult> {
+    const held = this.entries.find(e => e.entryId === entry.entryId);
+    if (held) {
+      return { entry: structuredClone(held), inserted: false };
+    }
+    if (
+      this.entries.some(
+        e =>
+          e.tenantId === entry.tenantId &&
+          e.idempotencyKey === entry.idempotencyKey &&
+          e.idempotencyScope === entry.idempotencyScope
+      )
+    ) {
+      throw new Error(`Cannot import entry ${entry.entryId}: its idempotency key is held by another entry`);
+    }
+    this.entries.push(structuredClone(entry));
+    return { entry: structuredClone(entry), inserted: true };
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    const fields = ['accountId', 'accountType', 'type', 'reason', 'balanceState', 'escrowId', 'queueItemId', 'featureType', 'tenantId'] as const;
+    const matching = this.entries.filter(
+      entry =>
+        fields.every(field => filter[field] === undefined || entry[field] === filter[field]) &&
+        !(filter.excludeTransactionIds || []).includes(entry.transactionId) &&
+        (filter.fromStreamVersion === undefined ||
+          entry.streamVersion === undefined ||
+          entry.streamVersion >= filter.fromStreamVersion) &&
+        (!filter.startDate || entry.timestamp >= filter.startDate) &&
+        (!filter.endDate || entry.timestamp <= filter.endDate)
+    );
+
+    const field = filter.sortBy || 'timestamp';
+    const direction = filter.sortOrder === 'asc' ? 1 : -1;
+    matching.sort((a, b) => {
+      const byField = Number(a[field]) - Number(b[field]);
+      return direction * (byField || (a.entryId < b.entryId ? -1 : a.entryId > b.entryId ? 1 : 0));
+    });
+
+    const offset = filter.offset || 0;
+    const limit = Math.min(filter.limit || 100, 1000);
+    return {
+      entries: structuredClone(matching.slice(offset, offset + limit)),
+      totalCount: matching.length,
+      offset,
+      limit,
+      hasMore: offset + limit < matching.length,
+    };
+  }
+
+  /**
+   * Entries carrying a reference (correlationId), oldest first
+   */
+  async getByReference(
+    reference: string,
+    options: { offset?: number; limit?: number; tenantId?: string } = {}
+  ): Promise<LedgerQueryResult> {
+    const matching = this.entries.filter(
+      entry => entry.correlationId === reference && (options.tenantId === undefined || entry.tenantId === options.tenantId)
+    );
+
+    const offset = options.offset || 0;
+    const limit = Math.min(options.limit || 100, 1000);
+    return {
+      entries: structuredClone(matching.slice(offset, offset + limit)),
+      totalCount: matching.length,
+      offset,
+      limit,
+      hasMore: offset + limit < matching.length,
+    };
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    const entry = this.entries.find(e => e.entryId === entryId);
+    return entry ? structuredClone(entry) : null;
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.entries.some(e => e.entryId === entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf: Date = new Date()
+  ): Promise<BalanceSnapshot> {
+    const held = this.entries.filter(
+      e => e.accountId === accountId && e.accountType === accountType && e.timestamp <= asOf
+    );
+    const sum = (state: LedgerEntry['balanceState']) =>
+      held.filter(e => e.balanceState === state).reduce((total, e) => total + e.amount, 0);
+
+    return {
+      accountId,
+      accountType,
+      availableBalance: sum('available'),
+      escrowBalance: sum('escrow'),
+      earnedBalance: sum('earned'),
+      asOf,
+      currency: 'points',
+    };
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    const held = this.entries.filter(e => e.accountId === accountId && e.accountType === accountType);
+    const before = held.filter(e => e.timestamp < dateRange.start).reduce((sum, e) => sum + e.amount, 0);
+    const inRange = held.filter(e => e.timestamp >= dateRange.start && e.timestamp <= dateRange.end);
+    const totalCredits = inRange.filter(e => e.amount > 0).reduce((sum, e) => sum + e.amount, 0);
+    const totalDebits = inRange.filter(e => e.amount < 0).reduce((sum, e) => sum - e.amount, 0);
+    const calculatedBalance = before + totalCredits - totalDebits;
+
+    return {
+      accountId,
+      accountType,
+      startingBalance: before,
+      totalCredits,
+      totalDebits,
+      calculatedBalance,
+      actualBalance: calculatedBalance,
+      difference: 0,
+      reconciled: true,
+      reportedAt: new Date(),
+      dateRange,
+    };
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.entries
+      .filter(e => e.transactionId === transactionId)
+      .map(e => ({ auditId: e.entryId, ledgerEntry: structuredClone(e), auditedAt: e.timestamp }));
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.idempotency.has(`${operationType}:${key}`);
+  }
+
+  async storeIdempotencyResult(key: string, operationType: string): Promise<void> {
+    this.idempotency.add(`${operationType}:${key}`);
+  }
+}
@@ -0,0 +1,12 @@
+/**
+ * Ledger Test Utilities
+ * 
+ * Test doubles for exercising code that depends on the ledger.
+ * Not exported from the main ledger module.
+ */
+
+export * from './fault-injecting-ledger.service';
+export * from './in-memory-ledger.service';
+export * from './immutability-harness';
+export * from './append-only-property';
+export * from './op-stats';
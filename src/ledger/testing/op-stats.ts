@@ -0,0 +1,19 @@
+/**
+ * Operation Counter Reset
+ *
+ * LedgerService.opStats() counts only grow in production. resetOpStats
+ * clears one instance's counts so a test can assert on the operations it
+ * performs alone.
+ *
+ * Not for production use.
+ */
+
+import { LedgerService } from '../ledger.service';
+import { opCountersOf } from '../op-counters';
+
+/**
+ * Clear every count opStats() reports for a ledger service
+ */
+export function resetOpStats(ledger: LedgerService): void {
+  opCountersOf(ledger).reset();
+}
@@ -0,0 +1,205 @@
+/**
+ * Iteration Throttle Tests
+ */
+
+import { IterationThrottle, LatencyWindow, ThrottleControl } from './throttle';
+import { FaultInjectingLedgerService } from './testing';
+import { ILedgerService } from './types';
+
+describe('IterationThrottle', () => {
+  beforeEach(() => {
+    jest.useFakeTimers();
+  });
+
+  afterEach(() => {
+    jest.useRealTimers();
+  });
+
+  /**
+   * Run to completion, stopping the clock at the last timer
+   */
+  const drain = async (run: Promise<void>): Promise<void> => {
+    await jest.runAllTimersAsync();
+    await run;
+  };
+
+  const batches = (throttle: IterationThrottle, count: number, entries: number, bytes = 0) =>
+    (async () => {
+      for (let i = 0; i < count; i++) {
+        await throttle.consume(entries, bytes);
+      }
+    })();
+
+  it('should hold a run to entriesPerSecond', async () => {
+    const throttle = new IterationThrottle({ entriesPerSecond: 500 });
+
+    await drain(batches(throttle, 10, 100));
+
+    expect(throttle.report()).toMatchObject({ entries: 1000, elapsedMs: 2000, throttledMs: 2000 });
+    expect(throttle.report().entriesPerSecond).toBe(500);
+  });
+
+  it('should apply whichever of the limits is tighter', async () => {
+    const throttle = new IterationThrottle({ entriesPerSecond: 1_000_000, bytesPerSecond: 1000 });
+
+    await drain(batches(throttle, 4, 1, 500));
+
+    expect(throttle.report()).toMatchObject({ bytes: 2000, elapsedMs: 2000, bytesPerSecond: 1000 });
+  });
+
+  it('should not run unthrottled batches through timers', async () => {
+    const throttle = new IterationThrottle();
+
+    await batches(throttle, 5, 100, 1000);
+
+    expect(throttle.report()).toMatchObject({ entries: 500, throttledMs: 0, elapsedMs: 0 });
+  });
+
+  describe('against a slow store', () => {
+    let ledger: FaultInjectingLedgerService;
+
+    beforeEach(() => {
+      const inner = {
+        queryEntries: jest.fn().mockResolvedValue({ entries: [], totalCount: 0, offset: 0, limit: 100, hasMore: false }),
+        getBalanceSnapshot: jest.fn().mockResolvedValue({ accountId: 'user-1' }),
+      } as unknown as ILedgerService;
+      ledger = new FaultInjectingLedgerService(inner);
+    });
+
+    const readBatches = (throttle: IterationThrottle, count: number) =>
+      (async () => {
+        throttle.start();
+        for (let i = 0; i < count; i++) {
+          await ledger.queryEntries({ limit: 100 });
+          await throttle.consume(100);
+        }
+      })();
+
+    it('should count time spent reading towards the budget', async () => {
+      ledger.setLatency('queryEntries', 150);
+      const throttle = new IterationThrottle({ entriesPerSecond: 500 });
+
+      await drain(readBatches(throttle, 10));
+
+      expect(throttle.report()).toMatchObject({ elapsedMs: 2000, throttledMs: 500 });
+    });
+
+    it('should not throttle a store already slower than the limit', async () => {
+      ledger.setLatency('queryEntries', 300);
+      const throttle = new IterationThrottle({ entriesPerSecond: 500 });
+
+      await drain(readBatches(throttle, 10));
+
+      expect(throttle.report()).toMatchObject({ elapsedMs: 3000, throttledMs: 0 });
+    });
+
+    it('should back off while user reads are slow and recover once they are fast', async () => {
+      const latencies = new LatencyWindow(5);
+      const userRead = () => latencies.time(() => ledger.getBalanceSnapshot('user-1', 'user'));
+      const throttle = new IterationThrottle({
+        entriesPerSecond: 1000,
+        latencyProbe: latencies.probe(),
+        recoveryFactor: 2,
+      });
+
+      ledger.setLatency('getBalanceSnapshot', 400);
+      await drain(userRead());
+      await drain(batches(throttle, 3, 100));
+
+      // Rate halves before each batch: 200ms, 400ms, 800ms
+      expect(throttle.report()).toMatchObject({ backoffs: 3, elapsedMs: 1400 });
+
+      ledger.clearLatency();
+      for (let i = 0; i < 5; i++) {
+        await userRead();
+      }
+      await drain(batches(throttle, 4, 100));
+
+      // Rate doubles back to the limit and stays there: 400ms, 200ms, 100ms, 100ms
+      expect(throttle.report()).toMatchObject({ backoffs: 3, elapsedMs: 2200 });
+    });
+
+    it('should not back off below minRateFactor', async () => {
+      const throttle = new IterationThrottle({ entriesPerSecond: 1000, latencyProbe: () => 1000 });
+
+      await drain(batches(throttle, 6, 100));
+
+      const before = Date.now();
+      await drain(batches(throttle, 1, 100));
+      expect(Date.now() - before).toBe(2000);
+      expect(throttle.report().backoffs).toBe(7);
+    });
+  });
+
+  describe('ThrottleControl', () => {
+    it('should hold a paused run between batches and record the pause', async () => {
+      const control = new ThrottleControl();
+      const throttle = new IterationThrottle({ entriesPerSecond: 1000 }, control);
+
+      const run = batches(throttle, 5, 100);
+      await jest.advanceTimersByTimeAsync(250);
+      control.pause();
+      await jest.advanceTimersByTimeAsync(10_000);
+
+      expect(control.paused).toBe(true);
+      expect(throttle.report().entries).toBe(300);
+
+      control.resume();
+      await drain(run);
+
+      expect(throttle.report()).toMatchObject({ entries: 500, pausedMs: 9950, elapsedMs: 10_450 });
+    });
+
+    it('should slow a running job by an operator rate factor', async () => {
+      const control = new ThrottleControl();
+      const throttle = new IterationThrottle({ entriesPerSecond: 500 }, control);
+
+      control.setRateFactor(0.5);
+      await drain(batches(throttle, 10, 100));
+
+      expect(throttle.report().elapsedMs).toBe(4000);
+
+      control.setRateFactor(null);
+      const before = Date.now();
+      await drain(batches(throttle, 1, 100));
+      expect(Date.now() - before).toBe(200);
+    });
+
+    it('should reject rate factors outside (0, 1]', () => {
+      const control = new ThrottleControl();
+
+      expect(() => control.setRateFactor(0)).toThrow('rate factor must be in (0, 1]');
+      expect(() => control.setRateFactor(2)).toThrow('rate factor must be in (0, 1]');
+    });
+  });
+
+  it('should reject invalid configuration', () => {
+    expect(() => new IterationThrottle({ entriesPerSecond: 0 })).toThrow('entriesPerSecond must be positive');
+    expect(() => new IterationThrottle({ latencyProbe: () => 0 })).toThrow(
+      'Adaptive throttling needs entriesPerSecond or bytesPerSecond'
+    );
+  });
+});
+
+describe('LatencyWindow', () => {
+  it('should report nearest-rank percentiles of recent samples', () => {
+    const latencies = new LatencyWindow(100);
+    expect(latencies.percentile(0.99)).toBeUndefined();
+
+    for (let ms = 1; ms <= 100; ms++) {
+      latencies.record(ms);
+    }
+
+    expect(latencies.percentile(0.99)).toBe(99);
+    expect(latencies.percentile(0.5)).toBe(50);
+    expect(latencies.probe(1)()).toBe(100);
+  });
+
+  it('should drop samples beyond its size', () => {
+    const latencies = new LatencyWindow(3);
+
+    [900, 10, 20, 30].forEach(ms => latencies.record(ms));
+
+    expect(latencies.percentile(1)).toBe(30);
+  });
+});
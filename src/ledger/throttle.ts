@@ -0,0 +1,319 @@
+/**
+ * Iteration Throttle
+ *
+ * Paces bulk reads of the ledger (exports, tiering runs) so they cannot
+ * crowd out user-facing traffic. A run calls consume() after each batch
+ * with what it read and wrote, and is held back to the configured
+ * entries-per-second and bytes-per-second; time spent doing the work
+ * counts towards the budget, so a slow store is never throttled twice.
+ *
+ * In adaptive mode a latency probe (e.g. p99 of recent user reads) is
+ * checked before each batch. Above the threshold the rate is cut by
+ * backoffFactor, down to minRateFactor of the configured rate; at or
+ * below it the rate recovers by recoveryFactor per batch.
+ *
+ * A ThrottleControl lets operators pause, resume or re-rate a running
+ * job without cancelling it. Pauses take effect between batches.
+ */
+
+/**
+ * Recent latency of the traffic being protected, in milliseconds
+ * (undefined when there is no recent sample)
+ */
+export type LatencyProbe = () => number | undefined;
+
+/**
+ * Rolling window of call latencies, the usual source of a LatencyProbe
+ */
+export class LatencyWindow {
+  private samples: number[] = [];
+  private size: number;
+
+  constructor(size = 200) {
+    this.size = size;
+  }
+
+  record(ms: number): void {
+    this.samples.push(ms);
+    if (this.samples.length > this.size) {
+      this.samples.shift();
+    }
+  }
+
+  /**
+   * Time a call and record its latency, whether or not it fails
+   */
+  async time<T>(fn: () => Promise<T>): Promise<T> {
+    const startedAt = Date.now();
+    try {
+      return await fn();
+    } finally {
+      this.record(Date.now() - startedAt);
+    }
+  }
+
+  /**
+   * Nearest-rank percentile of the window (undefined when empty)
+   */
+  percentile(p: number): number | undefined {
+    if (this.samples.length === 0) {
+      return undefined;
+    }
+    const sorted = [...this.samples].sort((a, b) => a - b);
+    return sorted[Math.min(sorted.length - 1, Math.ceil(p * sorted.length) - 1)];
+  }
+
+  /**
+   * Probe reading a percentile of the window, p99 by default
+   */
+  probe(p = 0.99): LatencyProbe {
+    return () => this.percentile(p);
+  }
+}
+
+/**
+ * Configuration for an iteration throttle
+ */
+export interface ThrottleConfig {
+  /** Entries per second (unlimited when unset) */
+  entriesPerSecond?: number;
+
+  /** Output bytes per second (unlimited when unset) */
+  bytesPerSecond?: number;
+
+  /** Enables adaptive mode */
+  latencyProbe?: LatencyProbe;
+
+  /** Probe latency above which the rate backs off */
+  latencyThresholdMs: number;
+
+  /** Rate multiplier applied on each backoff */
+  backoffFactor: number;
+
+  /** Rate multiplier applied on each healthy probe, up to the full rate */
+  recoveryFactor: number;
+
+  /** Lowest fraction of the configured rate adaptive mode backs off to */
+  minRateFactor: number;
+}
+
+const DEFAULT_CONFIG: ThrottleConfig = {
+  latencyThresholdMs: 250,
+  backoffFactor: 0.5,
+  recoveryFactor: 1.25,
+  minRateFactor: 0.05,
+};
+
+/**
+ * Throughput of a throttled run
+ */
+export interface ThrottleReport {
+  entries: number;
+  bytes: number;
+
+  /** Wall time from the start of the run to the last batch, including pauses */
+  elapsedMs: number;
+
+  /** Time held back by the rate limits */
+  throttledMs: number;
+
+  /** Time spent paused by an operator */
+  pausedMs: number;
+
+  /** Times the latency probe forced a backoff */
+  backoffs: number;
+
+  /** Effective throughput over the elapsed time */
+  entriesPerSecond: number;
+  bytesPerSecond: number;
+}
+
+/**
+ * Operator handle on a running throttled job
+ */
+export class ThrottleControl {
+  private resumed: Promise<void> | null = null;
+  private release: (() => void) | null = null;
+  private override: number | null = null;
+
+  get paused(): boolean {
+    return this.resumed !== null;
+  }
+
+  /**
+   * Fraction of the configured rate set by an operator (null when unset)
+   */
+  get rateFactor(): number | null {
+    return this.override;
+  }
+
+  /**
+   * Hold the job before its next batch
+   */
+  pause(): void {
+    if (!this.resumed) {
+      this.resumed = new Promise(resolve => {
+        this.release = resolve;
+      });
+    }
+  }
+
+  resume(): void {
+    const release = this.release;
+    this.resumed = null;
+    this.release = null;
+    release?.();
+  }
+
+  /**
+   * Slow the job to a fraction of its configured rate (null restores it)
+   */
+  setRateFactor(factor: number | null): void {
+    if (factor !== null && !(factor > 0 && factor <= 1)) {
+      throw new Error('rate factor must be in (0, 1]');
+    }
+    this.override = factor;
+  }
+
+  /**
+   * Resolves once the job is not paused
+   */
+  async whenResumed(): Promise<void> {
+    while (this.resumed) {
+      await this.resumed;
+    }
+  }
+}
+
+/**
+ * IterationThrottle implementation
+ */
+export class IterationThrottle {
+  private config: ThrottleConfig;
+  private control?: ThrottleControl;
+  private startedAt: number | null = null;
+  private lastAt = 0;
+  private readyAt = 0;
+  private adaptiveFactor = 1;
+  private entries = 0;
+  private bytes = 0;
+  private throttledMs = 0;
+  private pausedMs = 0;
+  private backoffs = 0;
+
+  constructor(config: Partial<ThrottleConfig> = {}, control?: ThrottleControl) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.control = control;
+
+    for (const key of ['entriesPerSecond', 'bytesPerSecond'] as const) {
+      const rate = this.config[key];
+      if (rate !== undefined && !(rate > 0)) {
+        throw new Error(`${key} must be positive`);
+      }
+    }
+    if (this.config.latencyProbe && !this.config.entriesPerSecond && !this.config.bytesPerSecond) {
+      throw new Error('Adaptive throttling needs entriesPerSecond or bytesPerSecond');
+    }
+  }
+
+  /**
+   * Mark the start of the run; otherwise the first consume() marks it
+   */
+  start(): void {
+    if (this.startedAt === null) {
+      this.startedAt = Date.now();
+      this.lastAt = this.startedAt;
+    }
+  }
+
+  /**
+   * Account for a finished batch, waiting until the next may start
+   */
+  async consume(entries: number, bytes = 0): Promise<void> {
+    this.start();
+    const now = Date.now();
+    this.entries += entries;
+    this.bytes += bytes;
+
+    this.adapt();
+
+    // The batch began when the previous one was released
+    const cost = this.costMs(entries, bytes) / this.rateFactor();
+    this.readyAt = Math.max(this.readyAt, this.lastAt) + cost;
+    const wait = this.readyAt - now;
+    if (wait > 0) {
+      await sleep(wait);
+      this.throttledMs += wait;
+    }
+
+    if (this.control?.paused) {
+      const pausedAt = Date.now();
+      await this.control.whenResumed();
+      this.pausedMs += Date.now() - pausedAt;
+    }
+
+    this.lastAt = Date.now();
+  }
+
+  /**
+   * Throughput so far
+   */
+  report(): ThrottleReport {
+    const elapsedMs = this.startedAt === null ? 0 : this.lastAt - this.startedAt;
+    const seconds = elapsedMs / 1000;
+    return {
+      entries: this.entries,
+      bytes: this.bytes,
+      elapsedMs,
+      throttledMs: this.throttledMs,
+      pausedMs: this.pausedMs,
+      backoffs: this.backoffs,
+      entriesPerSecond: seconds > 0 ? this.entries / seconds : 0,
+      bytesPerSecond: seconds > 0 ? this.bytes / seconds : 0,
+    };
+  }
+
+  /**
+   * Back off or recover from the latency probe
+   */
+  private adapt(): void {
+    if (!this.config.latencyProbe) {
+      return;
+    }
+
+    const latency = this.config.latencyProbe();
+    if (latency !== undefined && latency > this.config.latencyThresholdMs) {
+      this.adaptiveFactor = Math.max(this.config.minRateFactor, this.adaptiveFactor * this.config.backoffFactor);
+      this.backoffs++;
+    } else {
+      this.adaptiveFactor = Math.min(1, this.adaptiveFactor * this.config.recoveryFactor);
+    }
+  }
+
+  private rateFactor(): number {
+    return Math.min(this.adaptiveFactor, this.control?.rateFactor ?? 1);
+  }
+
+  /**
+   * Time a batch is allowed at the full rate
+   */
+  private costMs(entries: number, bytes: number): number {
+    const byEntries = this.config.entriesPerSecond ? (entries / this.config.entriesPerSecond) * 1000 : 0;
+    const byBytes = this.config.bytesPerSecond ? (bytes / this.config.bytesPerSecond) * 1000 : 0;
+    return Math.max(byEntries, byBytes);
+  }
+}
+
+function sleep(ms: number): Promise<void> {
+  return new Promise(resolve => setTimeout(resolve, ms));
+}
+
+/**
+ * Factory function to create an iteration throttle
+ */
+export function createIterationThrottle(
+  config?: Partial<ThrottleConfig>,
+  control?: ThrottleControl
+): IterationThrottle {
+  return new IterationThrottle(config, control);
+}
@@ -0,0 +1,80 @@
+/**
+ * Timezone Day Boundary Tests
+ */
+
+import {
+  zonedDayKey,
+  nextDayKey,
+  startOfZonedDay,
+  zonedDayRange,
+  resolveTimeZone,
+  assertValidTimeZone,
+  StaticTimezoneSource,
+} from './timezone';
+
+const HOUR_MS = 3600000;
+
+describe('timezone day boundaries', () => {
+  it('should key an instant by its local calendar day', () => {
+    const instant = new Date('2024-03-01T20:00:00Z');
+
+    expect(zonedDayKey(instant, 'UTC')).toBe('2024-03-01');
+    expect(zonedDayKey(instant, 'Asia/Tokyo')).toBe('2024-03-02');
+    expect(zonedDayKey(instant, 'America/Los_Angeles')).toBe('2024-03-01');
+  });
+
+  it('should find local midnight in UTC', () => {
+    expect(startOfZonedDay('2024-03-02', 'Asia/Tokyo')).toEqual(new Date('2024-03-01T15:00:00Z'));
+    expect(startOfZonedDay('2024-07-01', 'America/New_York')).toEqual(new Date('2024-07-01T04:00:00Z'));
+  });
+
+  it('should produce a 23-hour day on the spring-forward transition', () => {
+    const { start, end } = zonedDayRange('2024-03-10', 'America/New_York');
+
+    expect(start).toEqual(new Date('2024-03-10T05:00:00Z'));
+    expect(end.getTime() + 1 - start.getTime()).toBe(23 * HOUR_MS);
+  });
+
+  it('should produce a 25-hour day on the fall-back transition', () => {
+    const { start, end } = zonedDayRange('2024-11-03', 'America/New_York');
+
+    expect(start).toEqual(new Date('2024-11-03T04:00:00Z'));
+    expect(end.getTime() + 1 - start.getTime()).toBe(25 * HOUR_MS);
+  });
+
+  it('should tile consecutive days without gaps or overlaps across DST', () => {
+    let day = '2024-11-01';
+    for (let i = 0; i < 5; i++) {
+      const next = nextDayKey(day);
+      expect(zonedDayRange(day, 'Europe/London').end.getTime() + 1).toBe(
+        startOfZonedDay(next, 'Europe/London').getTime()
+      );
+      day = next;
+    }
+  });
+
+  it('should handle zones where DST skips local midnight', () => {
+    // Chile springs forward at 00:00 -> 01:00
+    const start = startOfZonedDay('2024-09-08', 'America/Santiago');
+
+    expect(zonedDayKey(start, 'America/Santiago')).toBe('2024-09-08');
+    expect(zonedDayKey(new Date(start.getTime() - 1), 'America/Santiago')).toBe('2024-09-07');
+  });
+
+  it('should step calendar days across month and year ends', () => {
+    expect(nextDayKey('2024-02-28')).toBe('2024-02-29');
+    expect(nextDayKey('2024-12-31')).toBe('2025-01-01');
+  });
+
+  it('should fall back to the program default timezone', async () => {
+    const source = new StaticTimezoneSource({ 'user-1': 'Asia/Tokyo' });
+
+    await expect(resolveTimeZone(source, 'user-1', 'UTC')).resolves.toBe('Asia/Tokyo');
+    await expect(resolveTimeZone(source, 'user-2', 'Europe/Berlin')).resolves.toBe('Europe/Berlin');
+    await expect(resolveTimeZone(undefined, 'user-1', 'UTC')).resolves.toBe('UTC');
+  });
+
+  it('should reject unknown timezones', () => {
+    expect(() => assertValidTimeZone('Mars/Olympus_Mons')).toThrow(RangeError);
+  });
+});
@@ -0,0 +1,176 @@
+/**
+ * Timezone-Aware Day Boundaries
+ *
+ * Ledger timestamps are always stored in UTC. Derivation layers that
+ * group by "day" resolve the user's IANA timezone through a
+ * UserTimezoneSource, falling back to a program default, and use the
+ * helpers here so day boundaries follow local midnight. Days around DST
+ * transitions are 23 or 25 hours long; stepping by calendar date rather
+ * than by 24 hours keeps every instant in exactly one day.
+ */
+
+/**
+ * Supplies a user's IANA timezone (e.g. "Asia/Tokyo")
+ */
+export interface UserTimezoneSource {
+  /**
+   * Get the user's timezone, or undefined to use the program default
+   */
+  getTimeZone(userId: string): Promise<string | undefined>;
+}
+
+/**
+ * Fixed-zone source, useful for single-region programs and tests
+ */
+export class StaticTimezoneSource implements UserTimezoneSource {
+  private zones: Map<string, string>;
+
+  constructor(zones: Record<string, string> = {}) {
+    this.zones = new Map(Object.entries(zones));
+  }
+
+  async getTimeZone(userId: string): Promise<string | undefined> {
+    return this.zones.get(userId);
+  }
+}
+
+const formatters = new Map<string, Intl.DateTimeFormat>();
+
+/**
+ * Get a cached formatter producing numeric local date/time parts
+ */
+function formatterFor(timeZone: string): Intl.DateTimeFormat {
+  let formatter = formatters.get(timeZone);
+  if (!formatter) {
+    formatter = new Intl.DateTimeFormat('en-US', {
+      timeZone,
+      hourCycle: 'h23',
+      year: 'numeric',
+      month: '2-digit',
+      day: '2-digit',
+      hour: '2-digit',
+      minute: '2-digit',
+      second: '2-digit',
+    });
+    formatters.set(timeZone, formatter);
+  }
+  return formatter;
+}
+
+/**
+ * Validate an IANA timezone name
+ *
+ * @throws RangeError if the zone is unknown
+ */
+export function assertValidTimeZone(timeZone: string): void {
+  formatterFor(timeZone);
+}
+
+/**
+ * Local calendar fields of an instant in a zone
+ */
+function localParts(date: Date, timeZone: string): Record<string, number> {
+  const parts: Record<string, number> = {};
+  for (const part of formatterFor(timeZone).formatToParts(date)) {
+    if (part.type !== 'literal') {
+      parts[part.type] = Number(part.value);
+    }
+  }
+  return parts;
+}
+
+/**
+ * Offset of a zone from UTC at an instant, in milliseconds
+ */
+function zoneOffsetMs(date: Date, timeZone: string): number {
+  const p = localParts(date, timeZone);
+  const asUtc = Date.UTC(p.year, p.month - 1, p.day, p.hour, p.minute, p.second);
+  return asUtc - Math.floor(date.getTime() / 1000) * 1000;
+}
+
+/**
+ * Local calendar day (YYYY-MM-DD) of an instant in a zone
+ */
+export function zonedDayKey(date: Date, timeZone: string): string {
+  const p = localParts(date, timeZone);
+  return `${p.year}-${pad(p.month)}-${pad(p.day)}`;
+}
+
+/**
+ * The calendar day after a day key
+ */
+export function nextDayKey(day: string): string {
+  const [year, month, date] = day.split('-').map(Number);
+  return new Date(Date.UTC(year, month - 1, date + 1)).toISOString().slice(0, 10);
+}
+
+/**
+ * First instant of a local calendar day
+ * Resolves the offset twice so days starting next to a DST transition
+ * land on the correct side of it.
+ */
+export function startOfZonedDay(day: string, timeZone: string): Date {
+  const [year, month, date] = day.split('-').map(Number);
+  const localMidnight = Date.UTC(year, month - 1, date);
+
+  let instant = localMidnight - zoneOffsetMs(new Date(localMidnight), timeZone);
+  instant = localMidnight - zoneOffsetMs(new Date(instant), timeZone);
+
+  // Where local midnight is skipped by a DST jump, the day starts later
+  while (zonedDayKey(new Date(instant), timeZone) < day) {
+    instant += 3600000;
+  }
+
+  return new Date(instant);
+}
+
+/**
+ * Instant of a local wall-clock time in a zone
+ * Resolves the offset twice, as startOfZonedDay does, so times next to a
+ * DST transition use the offset in force at that time.
+ */
+export function zonedTimeToUtc(
+  local: { year: number; month: number; day: number; hour: number; minute: number; second: number; millisecond?: number },
+  timeZone: string
+): Date {
+  const wallClock = Date.UTC(
+    local.year,
+    local.month - 1,
+    local.day,
+    local.hour,
+    local.minute,
+    local.second,
+    local.millisecond || 0
+  );
+
+  let instant = wallClock - zoneOffsetMs(new Date(wallClock), timeZone);
+  instant = wallClock - zoneOffsetMs(new Date(instant), timeZone);
+
+  return new Date(instant);
+}
+
+/**
+ * UTC bounds of a local calendar day: [start, end] inclusive, 23-25 hours long
+ */
+export function zonedDayRange(day: string, timeZone: string): { start: Date; end: Date } {
+  return {
+    start: startOfZonedDay(day, timeZone),
+    end: new Date(startOfZonedDay(nextDayKey(day), timeZone).getTime() - 1),
+  };
+}
+
+/**
+ * Resolve a user's timezone, falling back to the program default
+ */
+export async function resolveTimeZone(
+  source: UserTimezoneSource | undefined,
+  userId: string,
+  fallback: string
+): Promise<string> {
+  const zone = source ? await source.getTimeZone(userId) : undefined;
+  return zone || fallback;
+}
+
+function pad(value: number): string {
+  return String(value).padStart(2, '0');
+}
@@ -0,0 +1,177 @@
+/**
+ * Top-K Tracker Tests
+ */
+
+import { TopKTracker, TOP_K_WINDOWS, TOP_K_METRICS, TopKWindow, TopKMetric } from './top-k';
+import { LedgerEntry } from './types';
+import { TransactionType } from '../wallets/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+const START = new Date('2024-03-01T00:00:00Z').getTime();
+
+const WINDOW_MS: Record<TopKWindow, number> = {
+  '5m': 5 * 60 * 1000,
+  '1h': 60 * 60 * 1000,
+  '24h': 24 * 60 * 60 * 1000,
+};
+
+const BOUND_CASES: [TopKWindow, TopKMetric][] = TOP_K_WINDOWS.flatMap(window =>
+  TOP_K_METRICS.map((metric): [TopKWindow, TopKMetric] => [window, metric])
+);
+
+const entry = (accountId: string, at: number, amount = 10, accountType = 'user'): LedgerEntry => ({
+  entryId: `entry-${accountId}-${at}`,
+  accountId,
+  accountType,
+  amount,
+  type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+  timestamp: new Date(at),
+} as LedgerEntry);
+
+/**
+ * Deterministic pseudo-random source (mulberry32)
+ */
+const random = (seed: number) => () => {
+  seed = (seed + 0x6d2b79f5) | 0;
+  let t = Math.imul(seed ^ (seed >>> 15), 1 | seed);
+  t = (t + Math.imul(t ^ (t >>> 7), 61 | t)) ^ t;
+  return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+};
+
+/**
+ * Zipf-like workload: a few heavy users over a long tail of 5000
+ */
+const zipfWorkload = (n: number, spanMs: number, seed: number): LedgerEntry[] => {
+  const next = random(seed);
+  return Array.from({ length: n }, (_, i) => {
+    const rank = Math.floor(Math.pow(5000, next()));
+    const amount = next() < 0.2 ? -25 : 1 + Math.floor(next() * 100);
+    return entry(`user-${rank}`, START + Math.floor((i * spanMs) / n), amount);
+  });
+};
+
+const exact = (entries: LedgerEntry[], metric: TopKMetric): Map<string, number> => {
+  const totals = new Map<string, number>();
+  for (const e of entries) {
+    const value = metric === 'count' ? 1 : e.amount > 0 ? e.amount : 0;
+    if (value > 0) {
+      totals.set(e.accountId, (totals.get(e.accountId) || 0) + value);
+    }
+  }
+  return totals;
+};
+
+describe('TopKTracker', () => {
+  it('should rank users exactly while they fit in capacity', () => {
+    const tracker = new TopKTracker({ capacity: 10 });
+    ['a', 'b', 'b', 'c', 'c', 'c'].forEach((user, i) => tracker.afterAppend(entry(user, START + i)));
+
+    expect(tracker.top('5m', 'count', 2, new Date(START + 10))).toEqual([
+      { userId: 'c', estimate: 3, error: 0 },
+      { userId: 'b', estimate: 2, error: 0 },
+    ]);
+    expect(tracker.top('5m', 'earned', 1, new Date(START + 10))).toEqual([
+      { userId: 'c', estimate: 30, error: 0 },
+    ]);
+  });
+
+  it('should ignore model accounts and count only credits as earned', () => {
+    const tracker = new TopKTracker();
+    tracker.afterAppend(entry('model-1', START, 500, 'model'));
+    tracker.afterAppend(entry('user-1', START, -40));
+    tracker.afterAppend(entry('user-1', START, 15));
+
+    const now = new Date(START + 1);
+    expect(tracker.top('1h', 'count', 5, now)).toEqual([{ userId: 'user-1', estimate: 2, error: 0 }]);
+    expect(tracker.top('1h', 'earned', 5, now)).toEqual([{ userId: 'user-1', estimate: 15, error: 0 }]);
+  });
+
+  it('should slide activity out of shorter windows first', () => {
+    const tracker = new TopKTracker();
+    tracker.afterAppend(entry('early', START));
+    tracker.afterAppend(entry('late', START + 50 * 60 * 1000));
+
+    const now = new Date(START + 50 * 60 * 1000);
+    expect(tracker.top('5m', 'count', 5, now).map(r => r.userId)).toEqual(['late']);
+    expect(tracker.top('1h', 'count', 5, now).map(r => r.userId)).toEqual(['early', 'late']);
+    expect(tracker.top('24h', 'count', 5, new Date(START + 25 * 60 * 60 * 1000))).toEqual([]);
+  });
+
+  it('should drop entries older than the live buckets', () => {
+    const tracker = new TopKTracker();
+    tracker.afterAppend(entry('current', START + 10 * 60 * 1000));
+    tracker.afterAppend(entry('stale', START - 20 * 60 * 1000));
+
+    const now = new Date(START + 10 * 60 * 1000);
+    expect(tracker.top('5m', 'count', 5, now).map(r => r.userId)).toEqual(['current']);
+    expect(tracker.top('1h', 'count', 5, now).map(r => r.userId)).toEqual(['current', 'stale']);
+  });
+
+  it.each(BOUND_CASES)(
+    'should stay within the documented bounds over %s by %s',
+    (window, metric) => {
+      const capacity = 50;
+      const tracker = new TopKTracker({ capacity });
+      const workload = zipfWorkload(20000, 24 * 60 * 60 * 1000, 7);
+      workload.forEach(e => tracker.afterAppend(e));
+
+      const now = new Date(START + 24 * 60 * 60 * 1000 - 1);
+      const total = tracker.total(window, metric, now);
+      // Windows cover whole buckets (12 by default)
+      const bucketMs = WINDOW_MS[window] / 12;
+      const inWindow = workload.filter(e =>
+        Math.floor(e.timestamp.getTime() / bucketMs) > Math.floor(now.getTime() / bucketMs) - 12
+      );
+      const truth = exact(inWindow, metric);
+      expect(total).toBe([...truth.values()].reduce((a, b) => a + b, 0));
+
+      const ranked = tracker.top(window, metric, capacity, now);
+      for (const row of ranked) {
+        const actual = truth.get(row.userId) || 0;
+        expect(row.estimate).toBeGreaterThanOrEqual(actual);
+        expect(row.estimate - row.error).toBeLessThanOrEqual(actual);
+        expect(row.error).toBeLessThanOrEqual(total / capacity);
+      }
+
+      // Every user above total / capacity is reported
+      const reported = new Set(tracker.top(window, metric, Number.MAX_SAFE_INTEGER, now).map(r => r.userId));
+      for (const [userId, value] of truth) {
+        if (value > total / capacity) {
+          expect(reported.has(userId)).toBe(true);
+        }
+      }
+
+      // The true heaviest user leads
+      expect(truth.get(ranked[0].userId)).toBe(Math.max(...truth.values()));
+    }
+  );
+
+  it('should keep memory bounded regardless of user cardinality', () => {
+    const tracker = new TopKTracker({ capacity: 20, bucketsPerWindow: 4 });
+    for (let i = 0; i < 10000; i++) {
+      tracker.afterAppend(entry(`user-${i}`, START + i));
+    }
+
+    expect(tracker.stats()).toEqual({ capacity: 20, bucketsPerWindow: 4, trackedCounters: 3 * 2 * 20 });
+  });
+
+  it('should publish each window and metric to the metrics surface', () => {
+    const logMetric = jest.spyOn(MetricsLogger, 'logMetric').mockImplementation(() => undefined);
+    const tracker = new TopKTracker();
+    tracker.afterAppend(entry('user-1', START));
+
+    tracker.publish(3, new Date(START + 1));
+
+    expect(logMetric).toHaveBeenCalledTimes(6);
+    expect(logMetric).toHaveBeenCalledWith(expect.objectContaining({
+      type: MetricEventType.LEDGER_TOP_USERS,
+      value: 10,
+      metadata: { window: '24h', metric: 'earned', users: [{ userId: 'user-1', estimate: 10, error: 0 }] },
+    }));
+    logMetric.mockRestore();
+  });
+
+  it('should reject an invalid capacity', () => {
+    expect(() => new TopKTracker({ capacity: 0 })).toThrow('capacity');
+  });
+});
@@ -0,0 +1,318 @@
+/**
+ * Top-K Active Users
+ *
+ * Approximate most-active users over sliding windows, kept current as a
+ * LedgerAppendHook so operators can spot abuse and hot partitions
+ * without querying the ledger. Two metrics are tracked: entries per user
+ * and points earned per user (summed credits).
+ *
+ * Each window is a ring of bucketsPerWindow buckets, and each bucket is a
+ * weighted Space-Saving summary of at most `capacity` users, so memory is
+ * bounded by windows x metrics x buckets x capacity counters regardless
+ * of how many users append.
+ *
+ * Accuracy: within one bucket Space-Saving never underestimates, and
+ * overestimates any user by at most (bucket total / capacity). Merging
+ * the live buckets keeps both properties, so every reported estimate is
+ * an upper bound on the user's true value and is at most
+ * (window total / capacity) too high; `error` is a tighter per-user
+ * bound (estimate - error is a lower bound). Any user whose true value
+ * exceeds window total / capacity is guaranteed to be tracked. A window
+ * covers between its length and one bucket more, since buckets expire
+ * whole.
+ */
+
+import { LedgerEntry, LedgerAppendHook } from './types';
+import { TransactionType } from '../wallets/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Sliding windows tracked
+ */
+export type TopKWindow = '5m' | '1h' | '24h';
+
+/**
+ * Ranking metrics tracked
+ */
+export type TopKMetric = 'count' | 'earned';
+
+/**
+ * One ranked user
+ */
+export interface TopKEntry {
+  userId: string;
+
+  /** Estimated value; never below the true value */
+  estimate: number;
+
+  /** Maximum overestimate; estimate - error is a lower bound */
+  error: number;
+}
+
+/**
+ * Tracker size, for the stats surface
+ */
+export interface TopKStats {
+  capacity: number;
+  bucketsPerWindow: number;
+
+  /** Counters currently held across every window, metric and bucket */
+  trackedCounters: number;
+}
+
+/**
+ * Configuration for the top-K tracker
+ */
+export interface TopKTrackerConfig {
+  /** Users tracked per bucket; bounds memory and error */
+  capacity: number;
+
+  /** Buckets per window; more buckets slide more smoothly */
+  bucketsPerWindow: number;
+}
+
+const DEFAULT_CONFIG: TopKTrackerConfig = {
+  capacity: 100,
+  bucketsPerWindow: 12,
+};
+
+const WINDOW_MS: Record<TopKWindow, number> = {
+  '5m': 5 * 60 * 1000,
+  '1h': 60 * 60 * 1000,
+  '24h': 24 * 60 * 60 * 1000,
+};
+
+export const TOP_K_WINDOWS = Object.keys(WINDOW_MS) as TopKWindow[];
+export const TOP_K_METRICS: TopKMetric[] = ['count', 'earned'];
+
+/**
+ * Weighted Space-Saving summary of one bucket
+ */
+class SpaceSaving {
+  readonly counters = new Map<string, { value: number; error: number }>();
+  total = 0;
+  private capacity: number;
+
+  constructor(capacity: number) {
+    this.capacity = capacity;
+  }
+
+  add(userId: string, weight: number): void {
+    this.total += weight;
+    const counter = this.counters.get(userId);
+    if (counter) {
+      counter.value += weight;
+      return;
+    }
+    if (this.counters.size < this.capacity) {
+      this.counters.set(userId, { value: weight, error: 0 });
+      return;
+    }
+
+    // Evict the smallest counter; the newcomer inherits it as error
+    const [minUser, min] = this.minCounter();
+    this.counters.delete(minUser);
+    this.counters.set(userId, { value: min.value + weight, error: min.value });
+  }
+
+  /**
+   * Upper bound for any user not held (0 until the summary is full)
+   */
+  floor(): number {
+    return this.counters.size < this.capacity ? 0 : this.minCounter()[1].value;
+  }
+
+  private minCounter(): [string, { value: number; error: number }] {
+    let min: [string, { value: number; error: number }] | undefined;
+    for (const pair of this.counters) {
+      if (!min || pair[1].value < min[1].value) {
+        min = pair;
+      }
+    }
+    return min!;
+  }
+}
+
+/**
+ * One bucket of a window ring
+ */
+interface Bucket {
+  /** Bucket number since the epoch (timestamp / bucket length) */
+  epoch: number;
+  summaries: Record<TopKMetric, SpaceSaving>;
+}
+
+/**
+ * TopKTracker implementation
+ */
+export class TopKTracker implements LedgerAppendHook {
+  readonly name = 'top-k-tracker';
+  private config: TopKTrackerConfig;
+  private rings: Record<TopKWindow, (Bucket | undefined)[]>;
+
+  constructor(config: Partial<TopKTrackerConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    if (!Number.isInteger(this.config.capacity) || this.config.capacity < 1) {
+      throw new Error('capacity must be a positive integer');
+    }
+    if (!Number.isInteger(this.config.bucketsPerWindow) || this.config.bucketsPerWindow < 1) {
+      throw new Error('bucketsPerWindow must be a positive integer');
+    }
+    this.rings = {
+      '5m': new Array(this.config.bucketsPerWindow),
+      '1h': new Array(this.config.bucketsPerWindow),
+      '24h': new Array(this.config.bucketsPerWindow),
+    };
+  }
+
+  /**
+   * Count a user entry at its timestamp
+   * Entries older than a window's oldest live bucket are ignored there.
+   */
+  afterAppend(entry: LedgerEntry): void {
+    if (entry.accountType !== 'user') {
+      return;
+    }
+
+    const at = new Date(entry.timestamp).getTime();
+    const earned = entry.type === TransactionType.CREDIT && entry.amount > 0 ? entry.amount : 0;
+
+    for (const window of TOP_K_WINDOWS) {
+      const bucket = this.bucketFor(window, at);
+      if (!bucket) {
+        continue;
+      }
+      bucket.summaries.count.add(entry.accountId, 1);
+      if (earned > 0) {
+        bucket.summaries.earned.add(entry.accountId, earned);
+      }
+    }
+  }
+
+  /**
+   * Get the approximate top users of a window
+   *
+   * @param k Users to return; ranks beyond capacity carry no guarantee
+   * @param now End of the window
+   * @returns Users by estimate descending, ties by user ID
+   */
+  top(window: TopKWindow, metric: TopKMetric, k: number, now: Date = new Date()): TopKEntry[] {
+    const live = this.liveBuckets(window, now.getTime()).map(bucket => bucket.summaries[metric]);
+    const floors = live.map(summary => summary.floor());
+
+    const candidates = new Set<string>();
+    for (const summary of live) {
+      summary.counters.forEach((_, userId) => candidates.add(userId));
+    }
+
+    const ranked: TopKEntry[] = [];
+    for (const userId of candidates) {
+      let estimate = 0;
+      let error = 0;
+      live.forEach((summary, i) => {
+        const counter = summary.counters.get(userId);
+        const floor = counter ? counter.error : floors[i];
+        estimate += counter ? counter.value : floor;
+        error += floor;
+      });
+      ranked.push({ userId, estimate, error });
+    }
+
+    ranked.sort((a, b) => b.estimate - a.estimate || (a.userId < b.userId ? -1 : 1));
+    return ranked.slice(0, Math.max(0, k));
+  }
+
+  /**
+   * Sum of a metric over a window (exact)
+   */
+  total(window: TopKWindow, metric: TopKMetric, now: Date = new Date()): number {
+    return this.liveBuckets(window, now.getTime())
+      .reduce((sum, bucket) => sum + bucket.summaries[metric].total, 0);
+  }
+
+  /**
+   * Counters held, to confirm memory stays bounded
+   */
+  stats(): TopKStats {
+    let trackedCounters = 0;
+    for (const window of TOP_K_WINDOWS) {
+      for (const bucket of this.rings[window]) {
+        if (bucket) {
+          trackedCounters += bucket.summaries.count.counters.size + bucket.summaries.earned.counters.size;
+        }
+      }
+    }
+
+    return {
+      capacity: this.config.capacity,
+      bucketsPerWindow: this.config.bucketsPerWindow,
+      trackedCounters,
+    };
+  }
+
+  /**
+   * Log the top users of every window and metric to the metrics surface
+   */
+  publish(k: number, now: Date = new Date()): void {
+    for (const window of TOP_K_WINDOWS) {
+      for (const metric of TOP_K_METRICS) {
+        MetricsLogger.logMetric({
+          type: MetricEventType.LEDGER_TOP_USERS,
+          value: this.total(window, metric, now),
+          timestamp: now,
+          metadata: { window, metric, users: this.top(window, metric, k, now) },
+        });
+      }
+    }
+  }
+
+  /**
+   * Bucket an instant falls in, recycling an expired slot
+   * Returns undefined when the instant predates the slot's live bucket.
+   */
+  private bucketFor(window: TopKWindow, at: number): Bucket | undefined {
+    const epoch = Math.floor(at / this.bucketMs(window));
+    const ring = this.rings[window];
+    const slot = ((epoch % ring.length) + ring.length) % ring.length;
+    const bucket = ring[slot];
+
+    if (bucket && bucket.epoch === epoch) {
+      return bucket;
+    }
+    if (bucket && bucket.epoch > epoch) {
+      return undefined;
+    }
+
+    const fresh: Bucket = {
+      epoch,
+      summaries: {
+        count: new SpaceSaving(this.config.capacity),
+        earned: new SpaceSaving(this.config.capacity),
+      },
+    };
+    ring[slot] = fresh;
+    return fresh;
+  }
+
+  /**
+   * Buckets overlapping the window ending at an instant
+   */
+  private liveBuckets(window: TopKWindow, at: number): Bucket[] {
+    const current = Math.floor(at / this.bucketMs(window));
+    const ring = this.rings[window];
+    return ring.filter((bucket): bucket is Bucket =>
+      bucket !== undefined && bucket.epoch <= current && bucket.epoch > current - ring.length
+    );
+  }
+
+  private bucketMs(window: TopKWindow): number {
+    return WINDOW_MS[window] / this.config.bucketsPerWindow;
+  }
+}
+
+/**
+ * Factory function to create a top-K tracker
+ */
+export function createTopKTracker(config?: Partial<TopKTrackerConfig>): TopKTracker {
+  return new TopKTracker(config);
+}
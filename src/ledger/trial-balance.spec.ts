@@ -0,0 +1,85 @@
+/**
+ * Trial Balance Tests
+ *
+ * Golden tests against fixture ledgers in __fixtures__/trial-balance.
+ */
+
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import { generateTrialBalance } from './trial-balance';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from './types';
+import { LedgerInconsistencyError } from '../services/types';
+
+const loadFixture = (name: string) =>
+  JSON.parse(readFileSync(join(__dirname, '__fixtures__', 'trial-balance', `${name}.json`), 'utf8'));
+
+describe('generateTrialBalance', () => {
+  const ledgerOf = (entries: Partial<LedgerEntry>[]): jest.Mocked<ILedgerService> => ({
+    createEntry: jest.fn(),
+    queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+      const offset = filter.offset || 0;
+      const limit = filter.limit || 100;
+      return {
+        entries: entries.slice(offset, offset + limit),
+        totalCount: entries.length,
+        offset,
+        limit,
+        hasMore: offset + limit < entries.length,
+      };
+    }),
+    getEntry: jest.fn(),
+    getBalanceSnapshot: jest.fn(),
+    generateReconciliationReport: jest.fn(),
+    getAuditTrail: jest.fn(),
+    checkIdempotency: jest.fn(),
+    storeIdempotencyResult: jest.fn(),
+  } as any);
+
+  it.each(['balanced', 'empty'])('should match the golden report for %s ledger', async name => {
+    const fixture = loadFixture(name);
+    const asOf = new Date('2024-06-30T23:59:59Z');
+
+    const report = await generateTrialBalance(ledgerOf(fixture.entries), asOf);
+
+    expect(report).toEqual({ asOf, ...fixture.expected });
+  });
+
+  it('should raise a hard error for a corrupted ledger', async () => {
+    const fixture = loadFixture('corrupted');
+
+    const error = await generateTrialBalance(ledgerOf(fixture.entries)).catch(e => e);
+
+    expect(error).toBeInstanceOf(LedgerInconsistencyError);
+    expect(error.message).toBe(fixture.expectedError);
+  });
+
+  it('should stream user available entries up to asOf across pages', async () => {
+    const entries = Array.from({ length: 2500 }, (_, i) => ({
+      entryId: `e${i}`,
+      accountId: 'user-1',
+      amount: 1,
+      type: 'credit',
+      reason: 'promotional_award',
+      balanceBefore: i,
+      balanceAfter: i + 1,
+    })) as Partial<LedgerEntry>[];
+    const ledger = ledgerOf(entries);
+    const asOf = new Date('2024-06-30T00:00:00Z');
+
+    const report = await generateTrialBalance(ledger, asOf);
+
+    expect(report.outstandingLiability).toBe(2500);
+    expect(ledger.queryEntries).toHaveBeenCalledTimes(3);
+    expect(ledger.queryEntries).toHaveBeenCalledWith(
+      expect.objectContaining({ accountType: 'user', balanceState: 'available', endDate: asOf })
+    );
+  });
+
+  it('should reject non-integer amounts', async () => {
+    const ledger = ledgerOf([
+      { entryId: 'e1', accountId: 'user-1', amount: 1.5, type: 'credit', reason: 'x', balanceBefore: 0, balanceAfter: 1.5 } as any,
+    ]);
+
+    await expect(generateTrialBalance(ledger)).rejects.toThrow(LedgerInconsistencyError);
+  });
+});
@@ -0,0 +1,213 @@
+/**
+ * Trial Balance Report
+ *
+ * System-wide invariant check for accounting. Streams every user
+ * available-balance entry up to a point in time and verifies that
+ *
+ *   opening balances + total credits = total debits + outstanding liability
+ *
+ * where outstanding liability is the sum of each user's closing balance.
+ * Credits cover earns, admin adjustments and refunds; debits cover
+ * redemptions, expiry, admin adjustments and chargebacks.
+ *
+ * Sums are accumulated as bigint so a large ledger cannot silently lose
+ * precision. Any inconsistency - a user whose entries do not add up to
+ * their closing balance, or a global mismatch - indicates corruption and
+ * is raised as a LedgerInconsistencyError rather than reported.
+ */
+
+import { ILedgerService, LedgerEntry } from './types';
+import { TransactionType } from '../wallets/types';
+import { LedgerInconsistencyError } from '../services/types';
+
+/**
+ * Trial balance across all user accounts
+ */
+export interface TrialBalanceReport {
+  /** Point in time the report covers (inclusive) */
+  asOf: Date;
+
+  /** Credit totals keyed by transaction reason */
+  creditsByReason: Record<string, number>;
+
+  /** Debit magnitudes keyed by transaction reason */
+  debitsByReason: Record<string, number>;
+
+  /** Sum of all credits */
+  totalCredits: number;
+
+  /** Sum of all debit magnitudes */
+  totalDebits: number;
+
+  /** Sum of each account's balance before its first entry */
+  openingBalances: number;
+
+  /** Opening balances plus credits minus debits */
+  impliedOutstanding: number;
+
+  /** Sum of each account's closing balance */
+  outstandingLiability: number;
+
+  /** Number of accounts with entries */
+  accountCount: number;
+
+  /** Number of entries read */
+  entryCount: number;
+}
+
+/**
+ * Page size used when streaming the ledger
+ */
+const PAGE_SIZE = 1000;
+
+interface AccountTotals {
+  opening: bigint;
+  net: bigint;
+  closing: bigint;
+}
+
+/**
+ * Compute the trial balance as of a point in time
+ *
+ * @throws LedgerInconsistencyError if the ledger does not balance
+ */
+export async function generateTrialBalance(
+  ledgerService: ILedgerService,
+  asOf: Date = new Date()
+): Promise<TrialBalanceReport> {
+  const credits = new Map<string, bigint>();
+  const debits = new Map<string, bigint>();
+  const accounts = new Map<string, AccountTotals>();
+  let entryCount = 0;
+
+  let offset = 0;
+  let hasMore = true;
+
+  while (hasMore) {
+    const result = await ledgerService.queryEntries({
+      accountType: 'user',
+      balanceState: 'available',
+      endDate: asOf,
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset,
+      limit: PAGE_SIZE,
+    });
+
+    for (const entry of result.entries) {
+      applyEntry(entry, credits, debits, accounts);
+      entryCount++;
+    }
+
+    offset += result.entries.length;
+    hasMore = result.hasMore && result.entries.length > 0;
+  }
+
+  let openingBalances = 0n;
+  let outstandingLiability = 0n;
+
+  for (const [accountId, totals] of accounts) {
+    if (totals.opening + totals.net !== totals.closing) {
+      throw new LedgerInconsistencyError(
+        `Entries for account ${accountId} do not sum to its closing balance`,
+        {
+          accountId,
+          opening: totals.opening.toString(),
+          net: totals.net.toString(),
+          closing: totals.closing.toString(),
+        }
+      );
+    }
+    openingBalances += totals.opening;
+    outstandingLiability += totals.closing;
+  }
+
+  const totalCredits = sum(credits);
+  const totalDebits = sum(debits);
+  const impliedOutstanding = openingBalances + totalCredits - totalDebits;
+
+  if (impliedOutstanding !== outstandingLiability) {
+    throw new LedgerInconsistencyError(
+      'Sum of account balances does not equal the global net',
+      {
+        impliedOutstanding: impliedOutstanding.toString(),
+        outstandingLiability: outstandingLiability.toString(),
+      }
+    );
+  }
+
+  return {
+    asOf,
+    creditsByReason: toRecord(credits),
+    debitsByReason: toRecord(debits),
+    totalCredits: toSafeNumber(totalCredits),
+    totalDebits: toSafeNumber(totalDebits),
+    openingBalances: toSafeNumber(openingBalances),
+    impliedOutstanding: toSafeNumber(impliedOutstanding),
+    outstandingLiability: toSafeNumber(outstandingLiability),
+    accountCount: accounts.size,
+    entryCount,
+  };
+}
+
+/**
+ * Fold one entry into the running totals
+ */
+function applyEntry(
+  entry: LedgerEntry,
+  credits: Map<string, bigint>,
+  debits: Map<string, bigint>,
+  accounts: Map<string, AccountTotals>
+): void {
+  const amount = toBigInt(entry.amount, entry);
+  const magnitude = amount < 0n ? -amount : amount;
+  const bucket = entry.type === TransactionType.CREDIT ? credits : debits;
+  bucket.set(entry.reason, (bucket.get(entry.reason) || 0n) + magnitude);
+
+  const signed = entry.type === TransactionType.CREDIT ? magnitude : -magnitude;
+  let totals = accounts.get(entry.accountId);
+  if (!totals) {
+    totals = {
+      opening: toBigInt(entry.balanceBefore, entry),
+      net: 0n,
+      closing: 0n,
+    };
+    accounts.set(entry.accountId, totals);
+  }
+  totals.net += signed;
+  totals.closing = toBigInt(entry.balanceAfter, entry);
+}
+
+function toBigInt(value: number, entry: LedgerEntry): bigint {
+  if (!Number.isSafeInteger(value)) {
+    throw new LedgerInconsistencyError(
+      `Entry ${entry.entryId} has a non-integer or unsafe amount`,
+      { entryId: entry.entryId, value }
+    );
+  }
+  return BigInt(value);
+}
+
+function toSafeNumber(value: bigint): number {
+  const result = Number(value);
+  if (!Number.isSafeInteger(result)) {
+    throw new RangeError(`Trial balance total exceeds safe integer range: ${value}`);
+  }
+  return result;
+}
+
+function sum(values: Map<string, bigint>): bigint {
+  let total = 0n;
+  for (const value of values.values()) {
+    total += value;
+  }
+  return total;
+}
+
+function toRecord(values: Map<string, bigint>): Record<string, number> {
+  const record: Record<string, number> = {};
+  for (const [key, value] of values) {
+    record[key] = toSafeNumber(value);
+  }
+  return record;
+}
@@ -8,6 +8,13 @@
  */
 
 import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetadataCipher } from './field-encryption';
+
+/**
+ * Ledger account types
+ * System accounts are counterparties used only in double-entry mode.
+ */
+export type LedgerAccountType = 'user' | 'model' | 'system';
 
 /**
  * Ledger entry representing an immutable transaction record
@@ -24,7 +31,7 @@ export interface LedgerEntry {
   accountId: string;
   
   /** Account type */
-  accountType: 'user' | 'model';
+  accountType: LedgerAccountType;
   
   /** Transaction amount (signed: positive credit, negative debit) */
   amount: number;
@@ -73,20 +80,44 @@ export interface LedgerEntry {
   
   /** Correlation ID for multi-entry transactions */
   correlationId?: string;
+  
+  /** Shared by every leg of one multi-leg operation appended with appendGroup */
+  groupId?: string;
+  
+  /** Ed25519 signature over the entry's immutable fields (base64) */
+  signature?: string;
+  
+  /** Owning tenant (absent in single-tenant deployments) */
+  tenantId?: string;
+  
+  /** Idempotency namespace the key is unique within (absent means global) */
+  idempotencyScope?: string;
+  
+  /** Position in the user's stream, from 1 without gaps (when tracked) */
+  streamVersion?: number;
+  
+  /** Set when metadata was crypto-shredded and can no longer be read */
+  metadataErased?: boolean;
 }
 
 /**
  * Request to create a ledger entry
  */
 export interface CreateLedgerEntryRequest {
+  /** Entry ID (generated if not provided; a replicated write stamps one for every copy) */
+  entryId?: string;
+
   /** Transaction ID (generated if not provided) */
   transactionId?: string;
+
+  /** Entry timestamp (the append time if not provided) */
+  timestamp?: Date;
   
   /** Account identifier */
   accountId: string;
   
   /** Account type */
-  accountType: 'user' | 'model';
+  accountType: LedgerAccountType;
   
   /** Transaction amount */
   amount: number;
@@ -132,6 +163,77 @@ export interface CreateLedgerEntryRequest {
   
   /** Correlation ID for grouped entries */
   correlationId?: string;
+  
+  /** Group ID (set by appendGroup, which assigns one if no leg carries it) */
+  groupId?: string;
+  
+  /** Owning tenant (stamped automatically by tenant-scoped services) */
+  tenantId?: string;
+  
+  /**
+   * Idempotency namespace, for programs sharing a store whose keys may
+   * overlap; duplicates are detected on (scope, key). Omit for the
+   * global namespace.
+   */
+  idempotencyScope?: string;
+}
+
+/**
+ * Raw fields for recording a ledger entry in one call
+ */
+export interface RecordEntryFields {
+  /** Idempotency key (a repeat is rejected as a duplicate) */
+  idempotencyKey: string;
+  
+  /** Account the entry belongs to */
+  accountId: string;
+  
+  /** Account type (defaults to user) */
+  accountType?: LedgerAccountType;
+  
+  /** Transaction type */
+  type: TransactionType;
+  
+  /** Signed amount (positive credit, negative debit) */
+  amount: number;
+  
+  /** Structured reason code */
+  reason: TransactionReason;
+  
+  /** Balance before the entry; balanceAfter is derived */
+  balanceBefore: number;
+  
+  /** Request ID for tracing */
+  requestId: string;
+  
+  /** Correlation ID linking related entries */
+  correlationId?: string;
+  
+  /** Operator or service recording the entry */
+  committedBy?: string;
+  
+  /** Free-text note (no PII) */
+  comment?: string;
+  
+  /** Idempotency namespace the key is unique within (absent means global) */
+  idempotencyScope?: string;
+}
+
+/**
+ * Raw fields for recording an entry whose type follows from the amount's
+ * sign (lenient intake); see LedgerService.recordInferred
+ */
+export type InferredEntryFields = Omit<RecordEntryFields, 'type'>;
+
+/**
+ * Outcome of creating a ledger entry
+ */
+export interface CreateLedgerEntryResult {
+  /** Created entry, or the existing entry on replay */
+  entry: LedgerEntry;
+  
+  /** False when the idempotency key matched an existing entry */
+  inserted: boolean;
 }
 
 /**
@@ -142,7 +244,7 @@ export interface LedgerQueryFilter {
   accountId?: string;
   
   /** Filter by account type */
-  accountType?: 'user' | 'model';
+  accountType?: LedgerAccountType;
   
   /** Filter by transaction type */
   type?: TransactionType;
@@ -162,6 +264,18 @@ export interface LedgerQueryFilter {
   /** Filter by feature type */
   featureType?: string;
   
+  /** Filter by tenant (must match the service scope when scoped) */
+  tenantId?: string;
+  
+  /** Omit entries belonging to these transactions */
+  excludeTransactionIds?: string[];
+  
+  /**
+   * Only entries at or after this stream version; entries without a
+   * version are kept, so a reader can tell unbackfilled history from none
+   */
+  fromStreamVersion?: number;
+  
   /** Start date (inclusive) */
   startDate?: Date;
   
@@ -201,6 +315,247 @@ export interface LedgerQueryResult {
   hasMore: boolean;
 }
 
+/**
+ * Ledger query result with signature verification outcome
+ */
+export interface VerifiedLedgerQueryResult extends LedgerQueryResult {
+  /** Entry IDs that failed signature verification and were skipped */
+  failedEntryIds: string[];
+}
+
+/**
+ * Ledger high-water mark and entry count from a single read
+ */
+export interface LedgerCheckpoint {
+  /** Latest entry timestamp (null when the ledger is empty) */
+  highWaterMark: Date | null;
+  
+  /** Number of entries at or below the high-water mark */
+  count: number;
+  
+  /** When the checkpoint was taken */
+  takenAt: Date;
+}
+
+/**
+ * Handle on a consistent read view opened with beginRead
+ * Reads made with the token see the ledger as it was when the view was
+ * opened; release it with releaseRead once done.
+ */
+export interface ReadToken {
+  tokenId: string;
+  
+  /** When the view was opened; later appends are not visible */
+  asOf: Date;
+  
+  /** When the view is released if the caller has not released it */
+  expiresAt: Date;
+}
+
+/**
+ * Filter for summing ledger amounts by reference
+ */
+export interface ReferenceSumFilter {
+  /** Account type to include */
+  accountType?: LedgerAccountType;
+  
+  /** Earliest entry timestamp (inclusive) */
+  startDate?: Date;
+  
+  /** Latest entry timestamp (inclusive) */
+  endDate?: Date;
+  
+  /** Tenant scope */
+  tenantId?: string;
+}
+
+/**
+ * Net ledger amount recorded against one reference (correlationId)
+ */
+export interface ReferenceSum {
+  reference: string;
+  
+  /** Signed sum of entry amounts */
+  total: number;
+  
+  /** Number of entries carrying the reference */
+  entryCount: number;
+}
+
+/**
+ * Whether a reference has been fully reversed
+ */
+export interface ReferenceReversalStatus {
+  reference: string;
+  
+  /** True when the reference has entries and nets to zero with its reversals */
+  fullyReversed: boolean;
+  
+  /** Amount left unreversed (original plus reversal totals) */
+  residual: number;
+  
+  /** Signed sum of the reference's own entries */
+  originalTotal: number;
+  
+  /** Signed sum of the reversal entries */
+  reversalTotal: number;
+  
+  /** Number of reversal entries */
+  reversalCount: number;
+}
+
+/**
+ * Numbers missing from a user's sequentially numbered references
+ */
+export interface ReferenceSequenceGaps {
+  userId: string;
+  
+  prefix: string;
+  
+  /** Highest number expected; 1..expectedMax is checked */
+  expectedMax: number;
+  
+  /** Numbers in 1..expectedMax with no entry, ascending */
+  missing: number[];
+  
+  /** References with the prefix whose remainder is not a positive integer */
+  malformed: number;
+}
+
+/**
+ * Amount statistics over a user's entries of one transaction type
+ */
+export interface AmountStats {
+  count: number;
+  
+  /** Smallest entry magnitude; 0 when count is 0 */
+  min: number;
+  
+  /** Largest entry magnitude; 0 when count is 0 */
+  max: number;
+  
+  /** Sum of entry magnitudes */
+  sum: number;
+  
+  /** sum / count; 0 when count is 0 */
+  mean: number;
+  
+  /** Population standard deviation of entry magnitudes; 0 when count is 0 */
+  stdDev: number;
+}
+
+/**
+ * Net effect of one committer's entries on user balances over a window
+ */
+export interface CommitterImpact {
+  /** Signed sum of entry amounts: credits add, debits subtract */
+  net: number;
+  
+  /** Number of entries the committer appended */
+  count: number;
+}
+
+/**
+ * Cumulative operation counts kept by one ledger service instance
+ */
+export interface OpCounters {
+  /** Appends that committed, including idempotent replays */
+  appendsSucceeded: number;
+  
+  /** Failed appends by append error code */
+  appendsFailed: Record<string, number>;
+  
+  /** Invocations of each query method, by method name */
+  queries: Record<string, number>;
+}
+
+/**
+ * Entry counts per ledger index, for spotting indexing discrepancies
+ */
+export interface LedgerIndexReport {
+  /** Total entries */
+  totalEntries: number;
+  
+  /** Distinct entry IDs (equals totalEntries when healthy) */
+  distinctEntryIds: number;
+  
+  /** Distinct idempotency keys (equals totalEntries when healthy) */
+  distinctIdempotencyKeys: number;
+  
+  /** Distinct accounts and the entries across them */
+  accounts: { count: number; entries: number };
+  
+  /** Distinct correlation IDs and the entries carrying one */
+  correlations: { count: number; entries: number };
+  
+  /** Report generation timestamp */
+  generatedAt: Date;
+}
+
+/**
+ * Entry at which an account's running balance first reached a threshold
+ */
+export interface ThresholdCrossing {
+  /** Entry that took the balance to or past the threshold */
+  entry: LedgerEntry;
+  
+  /** Available balance after that entry */
+  balance: number;
+}
+
+/**
+ * Program-wide totals across every user's available balance
+ */
+export interface GlobalSummary {
+  /** Points ever earned */
+  earned: number;
+  
+  /** Points ever redeemed, as a positive magnitude, net of escrow refunds */
+  redeemed: number;
+  
+  /** Net of every other entry (admin adjustments, expiries, corrections) */
+  adjusted: number;
+  
+  /** Points outstanding: earned - redeemed + adjusted */
+  net: number;
+}
+
+/**
+ * A stored entry breaking an append rule, found by validateAll
+ */
+export interface LedgerValidationIssue {
+  entryId: string;
+  
+  transactionId: string;
+  
+  /** Code of the error the append would throw (INVALID_ENTRY_FIELDS for field checks) */
+  rule: string;
+  
+  message: string;
+}
+
+/**
+ * Entries either side of one entry in an account's history
+ */
+export interface NeighborEntries {
+  /** Entry just before; null for the first entry */
+  previous: LedgerEntry | null;
+  
+  /** Entry just after; null for the latest entry */
+  next: LedgerEntry | null;
+}
+
+/**
+ * Highest available balance a user ever held
+ */
+export interface PeakBalance {
+  /** Balance after the peak entry; 0 for a user without entries */
+  balance: number;
+  
+  /** Timestamp of the earliest entry that reached the peak; null for a user without entries */
+  timestamp: Date | null;
+}
+
 /**
  * Balance snapshot at a point in time
  */
@@ -313,6 +668,11 @@ export interface ILedgerService {
    */
   getEntry(entryId: string): Promise<LedgerEntry | null>;
   
+  /**
+   * Check whether a ledger entry exists without reading it
+   */
+  entryExists(entryId: string): Promise<boolean>;
+  
   /**
    * Get balance snapshot at a point in time
    */
@@ -347,6 +707,191 @@ export interface ILedgerService {
     statusCode: number,
     ttlSeconds: number
   ): Promise<void>;
+
+  /**
+   * Configured append rules a request would break, as the errors its
+   * append would throw, without appending it (optional)
+   */
+  appendRuleViolations?(request: CreateLedgerEntryRequest): Error[];
+}
+
+/**
+ * Observer of ledger appends
+ *
+ * beforeAppend runs before the entry is written and may veto it by
+ * throwing. afterAppend runs synchronously after the entry is durably
+ * created - the append call does not return until it completes - but its
+ * errors are isolated and never fail the append. Wrap slow observers
+ * with asyncAppendHook so they run off the write path.
+ */
+export interface LedgerAppendHook {
+  /** Hook name used in metrics and alerts */
+  name: string;
+
+  /**
+   * Called before an entry is written; throw to reject the append
+   */
+  beforeAppend?(request: CreateLedgerEntryRequest): void | Promise<void>;
+
+  /**
+   * Called after an entry is written; not called when the append replayed
+   * an existing entry under its idempotency key
+   */
+  afterAppend?(entry: LedgerEntry): void | Promise<void>;
+
+  /**
+   * Called once with every entry of a batch after its commit succeeds
+   * (see LedgerBatchBuilder.commit); receives copies
+   */
+  afterBatchAppend?(entries: LedgerEntry[]): void | Promise<void>;
+}
+
+/**
+ * Ends a span; receives the error when the operation failed
+ */
+export type LedgerSpanEnd = (error?: unknown) => void;
+
+/**
+ * Tracing hook wrapped around ledger operations
+ * Adapt this to OpenTelemetry (or any tracer) at the call site; the
+ * ledger itself has no tracing dependency.
+ */
+export interface LedgerTracer {
+  /**
+   * Start a span named after the operation (e.g. "ledger.append")
+   * Attributes carry the method and the account or reference involved.
+   */
+  startSpan(name: string, attributes: Record<string, string | number | boolean>): LedgerSpanEnd;
+}
+
+/**
+ * Maps a caller's user ID to the pseudonymous token stored in the ledger,
+ * throwing to reject one (e.g. a clear email address)
+ * Must be deterministic and map a token to itself, as stored IDs read
+ * back from entries are passed in again.
+ */
+export type UserIdTokenizer = (userId: string) => string | Promise<string>;
+
+/**
+ * Checks the format of an append's idempotency key, throwing to reject
+ * it (see ./id-validators for the built-in formats)
+ */
+export type IdempotencyKeyValidator = (key: string) => void;
+
+/**
+ * Flags appended amounts that are unusual for the account, without
+ * blocking the append (see ./anomaly-detector for the standard-deviation
+ * detector)
+ */
+export interface AnomalyDetector {
+  /**
+   * Whether an amount is unusual against the account's stats for its
+   * type, taken before the entry was written
+   */
+  isAnomalous(amount: number, stats: AmountStats): boolean;
+  
+  /**
+   * Receives each flagged entry once committed; never awaited by the
+   * append, and its errors are reported and dropped
+   */
+  onAnomaly(entry: LedgerEntry, stats: AmountStats): void | Promise<void>;
+}
+
+/**
+ * Receives each newly inserted entry to keep a running digest current
+ * Implemented by LedgerDigest.
+ */
+export interface LedgerDigestWriter {
+  fold(entry: LedgerEntry): Promise<void>;
+}
+
+/**
+ * Append a record in the outbox stands for; an append's idempotency key
+ * names the same entry across retries and replays
+ */
+export interface OutboxKey {
+  idempotencyKey: string;
+  idempotencyScope?: string;
+  tenantId?: string;
+}
+
+/**
+ * Outbox record awaiting publication
+ */
+export interface OutboxRecord extends OutboxKey {
+  outboxId: string;
+  stagedAt: Date;
+}
+
+/**
+ * Position in the outbox's staging order
+ */
+export type OutboxCursor = Pick<OutboxRecord, 'outboxId' | 'stagedAt'>;
+
+/**
+ * Committed entry awaiting publication, returned by pollOutbox
+ */
+export interface OutboxEntry {
+  /** Passed to markPublished once the entry's event is published */
+  outboxId: string;
+
+  entry: LedgerEntry;
+}
+
+/**
+ * Durable store of appends awaiting publication
+ * Implemented by OutboxStore.
+ */
+export interface LedgerOutbox {
+  /** Staged records whose append has not committed after this long are discarded */
+  readonly abandonAfterMs: number;
+
+  /** Stage an append before its insert; the new record's ID, or null when a record already held the key */
+  stage(key: OutboxKey): Promise<string | null>;
+
+  /** Remove a record staged by an append that then replayed an existing entry */
+  unstage(outboxId: string): Promise<void>;
+
+  /** Oldest unpublished records, oldest first, staged after the after record if given */
+  pending(limit: number, tenantId?: string, after?: OutboxCursor): Promise<OutboxRecord[]>;
+
+  markPublished(outboxIds: string[]): Promise<void>;
+
+  /** Remove records whose append never committed */
+  discard(outboxIds: string[]): Promise<void>;
+}
+
+/**
+ * Resolves merged account aliases to the surviving account
+ */
+export interface IAccountAliasResolver {
+  /**
+   * Resolve an account ID through the alias map
+   * Returns the input unchanged if it was never merged
+   */
+  resolveAccountId(accountId: string): Promise<string>;
+
+  /**
+   * Account IDs merged into accountId, directly or through a chain
+   * Lets account queries keep returning the merged accounts' history.
+   */
+  aliasesOf?(accountId: string): Promise<string[]>;
+}
+
+/**
+ * Resolves aliased references (correlation IDs) to their canonical reference
+ */
+export interface IReferenceAliasResolver {
+  /**
+   * Canonical reference followed by every reference aliased to it,
+   * directly or transitively; [reference] if it was never aliased
+   */
+  referenceGroup(reference: string): Promise<string[]>;
+  
+  /**
+   * Canonical reference for every aliased reference
+   */
+  canonicalMap(): Promise<Map<string, string>>;
 }
 
 /**
@@ -370,6 +915,126 @@ export interface LedgerConfig {
   
   /** Alert on reconciliation failures */
   alertOnReconciliationFailure: boolean;
+  
+  /** PEM-encoded Ed25519 private key used to sign new entries */
+  signingPrivateKey?: string;
+  
+  /** Verify entry signatures on read and skip entries that fail */
+  verifyOnRead: boolean;
+  
+  /** PEM-encoded Ed25519 public key used for read verification */
+  verificationPublicKey?: string;
+  
+  /** Tenant this service is scoped to (unset for single-tenant mode) */
+  tenantId?: string;
+  
+  /** Metadata keys indexed for tag lookups (e.g. campaign_id) */
+  indexedTagKeys: string[];
+  
+  /**
+   * Reject appends timestamped earlier than the latest entry, so arrival
+   * order equals timestamp order (off by default; backfills need it off)
+   */
+  enforceMonotonicTimestamps: boolean;
+  
+  /**
+   * Stamp each user entry with the next version of the user's stream, for
+   * event-store consumers (off by default; costs a read per append)
+   */
+  trackStreamVersions: boolean;
+  
+  /**
+   * Compare a replayed request with the entry already holding its
+   * idempotency key and reject it when the transaction differs, instead
+   * of returning the stored entry (off by default)
+   */
+  rejectConflictingReplays: boolean;
+  
+  /**
+   * Reject entries without a group ID, for deployments that record every
+   * operation as a group (off by default; appendGroup always assigns one)
+   */
+  requireGroupId: boolean;
+  
+  /**
+   * Reject manual adjustments (admin credits, debits and refunds) whose
+   * metadata.comment is empty; other entries may still omit a comment
+   * (off by default)
+   */
+  requireAdjustComment: boolean;
+  
+  /** Spans around appends and queries (no tracing when unset) */
+  tracer?: LedgerTracer;
+  
+  /**
+   * Longest a read token may stay open, in milliseconds; keep it within
+   * the database's snapshot history window
+   */
+  maxReadTokenLifetimeMs: number;
+  
+  /**
+   * committedBy values allowed to append; an append by anyone else is
+   * rejected (no check when unset or empty)
+   */
+  allowedCommitters?: string[];
+  
+  /**
+   * committedBy filled in for appends of a type that carry none, for
+   * automated flows that always commit as the same system principal; an
+   * explicit committer always wins (no defaults when unset)
+   */
+  defaultCommitterByType?: Partial<Record<TransactionType, string>>;
+  
+  /**
+   * Pattern a non-empty reference (correlationId) must match, per type,
+   * e.g. order IDs on credits and voucher codes on debits; types without
+   * a pattern accept any reference (no checks when unset)
+   */
+  referencePatterns?: Partial<Record<TransactionType, RegExp>>;
+  
+  /**
+   * Encrypts entry metadata at rest, apart from its clear keys; reads
+   * decrypt it and fail on the wrong key (stored in clear when unset)
+   */
+  metadataCipher?: MetadataCipher;
+  
+  /**
+   * Region this store serves in an active-active deployment; generated
+   * entry and transaction IDs are prefixed with it (e.g. "eu-west:<uuid>")
+   */
+  region?: string;
+  
+  /**
+   * Running digest folded on every insert, never on an idempotent replay
+   * (no digest maintained when unset)
+   */
+  digest?: LedgerDigestWriter;
+  
+  /**
+   * Stages every append before its insert, so each committed entry can
+   * be read back from pollOutbox until it is marked published (no outbox
+   * kept when unset)
+   */
+  outbox?: LedgerOutbox;
+  
+  /**
+   * Applied to user account IDs on append and on every query input, so
+   * only tokens are stored and lookups by the raw ID still match (IDs
+   * are stored as given when unset)
+   */
+  userIdTokenizer?: UserIdTokenizer;
+  
+  /**
+   * Run on every append before the idempotency check, so keys in the
+   * wrong format are never stored (any key is accepted when unset)
+   */
+  idempotencyKeyValidator?: IdempotencyKeyValidator;
+  
+  /**
+   * Consulted on every new user entry with the account's amount stats for
+   * the entry's type (no anomaly checks when unset)
+   */
+  anomalyDetector?: AnomalyDetector;
 }
 
 /**
@@ -0,0 +1,133 @@
+/**
+ * User Archive Tests
+ */
+
+import { PassThrough, Readable } from 'stream';
+import { exportUserArchive, importUserArchive } from './user-archive';
+import { CreateLedgerEntryRequest, LedgerQueryFilter } from './types';
+import { WireContentType, decodeFrame, encodeFrame } from './wire-format';
+import { InMemoryLedgerService } from './testing/in-memory-ledger.service';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('user archive', () => {
+  let ledger: InMemoryLedgerService;
+  let output: PassThrough;
+  let chunks: Buffer[];
+
+  const request = (accountId: string, i: number): CreateLedgerEntryRequest => ({
+    accountId,
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `${accountId}-${i}`,
+    requestId: `req-${accountId}-${i}`,
+    balanceBefore: i * 100,
+    balanceAfter: (i + 1) * 100,
+  });
+
+  const frames = async () => {
+    // Let the stream deliver what was written
+    await new Promise(resolve => setImmediate(resolve));
+    const decoded = [];
+    let data = Buffer.concat(chunks);
+    for (let next = decodeFrame(data); next; next = decodeFrame(data)) {
+      decoded.push(next.frame);
+      data = data.subarray(next.bytes);
+    }
+    return decoded;
+  };
+
+  const archiveOf = (parts: Buffer[]) => Readable.from([Buffer.concat(parts)]);
+
+  beforeEach(async () => {
+    ledger = new InMemoryLedgerService('source');
+    for (let i = 0; i < 3; i++) {
+      await ledger.createEntry(request('user-123', i));
+      await ledger.createEntry(request('user-456', i));
+    }
+    output = new PassThrough();
+    chunks = [];
+    output.on('data', chunk => chunks.push(chunk));
+  });
+
+  it('should round-trip only the user\'s entries into another store', async () => {
+    const manifest = await exportUserArchive(ledger, output, 'user-123');
+    const written = await frames();
+
+    expect(manifest).toMatchObject({ userId: 'user-123', accountId: 'user-123', entryCount: 3 });
+    expect(written.map(frame => frame.contentType)).toEqual([
+      WireContentType.USER_ARCHIVE,
+      WireContentType.USER_ARCHIVE_MANIFEST,
+    ]);
+
+    const entries = await importUserArchive(archiveOf(chunks));
+    const source = (await ledger.queryEntries({ accountId: 'user-123', sortBy: 'timestamp', sortOrder: 'asc' })).entries;
+    expect(entries).toEqual(source);
+
+    const target = new InMemoryLedgerService('target');
+    for (const entry of entries) {
+      await target.importEntry(entry);
+    }
+    expect((await target.queryEntries({ sortBy: 'timestamp', sortOrder: 'asc' })).entries).toEqual(source);
+  });
+
+  it('should check entries against the stored account ID of a tokenizing ledger', async () => {
+    for (let i = 0; i < 2; i++) {
+      await ledger.createEntry(request('tok-user-123', i));
+    }
+    // Queries by user ID as a tokenizing ledger does, returning the tokenized entries
+    const tokenizing = {
+      queryEntries: (filter: LedgerQueryFilter) =>
+        ledger.queryEntries({ ...filter, accountId: filter.accountId === 'user-123' ? 'tok-user-123' : filter.accountId }),
+    };
+
+    const manifest = await exportUserArchive(tokenizing, output, 'user-123');
+    await frames();
+
+    expect(manifest).toMatchObject({ userId: 'user-123', accountId: 'tok-user-123', entryCount: 2 });
+    const entries = await importUserArchive(archiveOf(chunks));
+    expect(entries.map(entry => entry.accountId)).toEqual(['tok-user-123', 'tok-user-123']);
+  });
+
+  it('should detect an entry rewritten with its frame re-checksummed', async () => {
+    await exportUserArchive(ledger, output, 'user-123');
+    const [entryFrame, manifestFrame] = await frames();
+
+    const tampered = entryFrame.payload.toString('utf8').replace('"amount":100', '"amount":900');
+    const parts = [
+      encodeFrame(WireContentType.USER_ARCHIVE, Buffer.from(tampered, 'utf8')),
+      encodeFrame(WireContentType.USER_ARCHIVE_MANIFEST, manifestFrame.payload),
+    ];
+
+    await expect(importUserArchive(archiveOf(parts))).rejects.toThrow('digest mismatch');
+  });
+
+  it('should detect a corrupted frame', async () => {
+    await exportUserArchive(ledger, output, 'user-123');
+    await frames();
+    const data = Buffer.concat(chunks);
+    data[20] ^= 0xff;
+
+    await expect(importUserArchive(archiveOf([data]))).rejects.toThrow('checksum mismatch');
+  });
+
+  it('should reject an archive without its manifest', async () => {
+    await exportUserArchive(ledger, output, 'user-123');
+    const [entryFrame] = await frames();
+
+    await expect(
+      importUserArchive(archiveOf([encodeFrame(WireContentType.USER_ARCHIVE, entryFrame.payload)]))
+    ).rejects.toThrow('manifest is missing');
+  });
+
+  it('should export an empty archive for a user without entries', async () => {
+    const manifest = await exportUserArchive(ledger, output, 'user-789');
+
+    expect(manifest.entryCount).toBe(0);
+    expect(await frames()).toHaveLength(1);
+    await expect(importUserArchive(archiveOf(chunks))).resolves.toEqual([]);
+  });
+});
@@ -0,0 +1,205 @@
+/**
+ * User Archive
+ *
+ * Self-contained, verifiable copy of one user's entries, for
+ * data-portability requests and moving a user between programs without
+ * exporting the whole ledger. An archive is a sequence of USER_ARCHIVE
+ * frames of the ledger wire format (see ./wire-format), each holding a
+ * page of entries as JSON lines in history order, closed by one
+ * USER_ARCHIVE_MANIFEST frame naming the user, the account ID its
+ * entries are stored under, the entry count and a SHA-256 digest over
+ * every entry line. The account ID differs from the user ID when the
+ * ledger tokenizes user IDs, and it is what the import checks entries
+ * against.
+ *
+ * Frame checksums catch corruption within a frame; the manifest catches
+ * entries that were dropped, reordered or rewritten with their frame
+ * re-checksummed. Anyone can recompute both, so an archive from an
+ * untrusted source should also be checked against the ledger's signing
+ * key, which importUserArchive does when given verificationPublicKey.
+ *
+ * importUserArchive returns the entries rather than storing them; the
+ * caller appends them to the target store, typically with importEntry,
+ * which keeps their IDs and replays any the target already holds.
+ */
+
+import { createHash } from 'crypto';
+import { once } from 'events';
+import { Readable, Writable } from 'stream';
+import { ILedgerService, LedgerEntry } from './types';
+import { jsonEntryCodec } from './codec';
+import { verifyEntrySignature } from './entry-signing';
+import { WireContentType, encodeFrame, readFrames } from './wire-format';
+
+/**
+ * What closes a user archive
+ */
+export interface UserArchiveManifest {
+  /** User ID the archive was requested for */
+  userId: string;
+
+  /** Account ID the entries are stored under (userId for an empty archive) */
+  accountId: string;
+
+  entryCount: number;
+
+  /** SHA-256 over every entry line in order, hex */
+  sha256: string;
+
+  exportedAt: string;
+}
+
+/**
+ * Options for reading a user archive
+ */
+export interface UserArchiveImportOptions {
+  /** Reject entries whose signature does not verify with this key (unchecked when unset) */
+  verificationPublicKey?: string;
+}
+
+/**
+ * Entries read per page when exporting
+ */
+const PAGE_SIZE = 1000;
+
+/**
+ * Write a user's entries, oldest first, and their manifest to an output
+ *
+ * @param output Destination stream (not ended by the call)
+ * @returns The manifest written
+ */
+export async function exportUserArchive(
+  ledger: Pick<ILedgerService, 'queryEntries'>,
+  output: Writable,
+  userId: string
+): Promise<UserArchiveManifest> {
+  if (!userId) {
+    throw new Error('userId is required for a user archive');
+  }
+
+  const hash = createHash('sha256');
+  let accountId: string | undefined;
+  let entryCount = 0;
+  let offset = 0;
+  let hasMore = true;
+
+  while (hasMore) {
+    const result = await ledger.queryEntries({
+      accountId: userId,
+      accountType: 'user',
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset,
+      limit: PAGE_SIZE,
+    });
+
+    for (const entry of result.entries) {
+      accountId = accountId ?? entry.accountId;
+      if (entry.accountId !== accountId) {
+        throw new Error(`User ${userId} has entries under both ${accountId} and ${entry.accountId}`);
+      }
+    }
+
+    if (result.entries.length > 0) {
+      const lines = result.entries.map(entry => JSON.stringify(entry) + '\n').join('');
+      hash.update(lines, 'utf8');
+      await writeFrame(output, encodeFrame(WireContentType.USER_ARCHIVE, Buffer.from(lines, 'utf8')));
+      entryCount += result.entries.length;
+    }
+
+    offset += result.entries.length;
+    hasMore = result.hasMore && result.entries.length > 0;
+  }
+
+  const manifest: UserArchiveManifest = {
+    userId,
+    accountId: accountId ?? userId,
+    entryCount,
+    sha256: hash.digest('hex'),
+    exportedAt: new Date().toISOString(),
+  };
+  await writeFrame(output, encodeFrame(WireContentType.USER_ARCHIVE_MANIFEST, Buffer.from(JSON.stringify(manifest), 'utf8')));
+  return manifest;
+}
+
+/**
+ * Read and verify a user archive
+ *
+ * @returns The archive's entries, oldest first
+ * @throws Error if a frame is invalid, the manifest is missing or does not
+ *   match the entries, an entry belongs to another account, or a signature
+ *   fails to verify
+ */
+export async function importUserArchive(
+  input: Readable,
+  options: UserArchiveImportOptions = {}
+): Promise<LedgerEntry[]> {
+  const hash = createHash('sha256');
+  const entries: LedgerEntry[] = [];
+  let manifest: UserArchiveManifest | undefined;
+
+  for await (const frame of readFrames(input)) {
+    if (manifest) {
+      throw new Error('User archive continues after its manifest');
+    }
+
+    if (frame.contentType === WireContentType.USER_ARCHIVE_MANIFEST) {
+      manifest = parseManifest(frame.payload);
+      continue;
+    }
+    if (frame.contentType !== WireContentType.USER_ARCHIVE) {
+      throw new Error(`Not a user archive: found a ${WireContentType[frame.contentType]} frame`);
+    }
+
+    hash.update(frame.payload);
+    for (const line of frame.payload.toString('utf8').split('\n').filter(Boolean)) {
+      entries.push(jsonEntryCodec.decode(Buffer.from(line, 'utf8')));
+    }
+  }
+
+  if (!manifest) {
+    throw new Error('User archive is incomplete: its manifest is missing');
+  }
+  if (entries.length !== manifest.entryCount) {
+    throw new Error(`User archive holds ${entries.length} entries; its manifest lists ${manifest.entryCount}`);
+  }
+  if (hash.digest('hex') !== manifest.sha256) {
+    throw new Error('User archive digest mismatch: entries were altered');
+  }
+
+  for (const entry of entries) {
+    if (entry.accountType !== 'user' || entry.accountId !== manifest.accountId) {
+      throw new Error(`Entry ${entry.entryId} does not belong to account ${manifest.accountId}`);
+    }
+    if (options.verificationPublicKey && !verifyEntrySignature(entry, options.verificationPublicKey)) {
+      throw new Error(`Entry ${entry.entryId} failed signature verification`);
+    }
+  }
+
+  return entries;
+}
+
+function parseManifest(payload: Buffer): UserArchiveManifest {
+  let manifest: any;
+  try {
+    manifest = JSON.parse(payload.toString('utf8'));
+  } catch (error: any) {
+    throw new Error(`Malformed user archive manifest: ${error.message}`);
+  }
+
+  if (
+    typeof manifest?.userId !== 'string' ||
+    typeof manifest.accountId !== 'string' ||
+    !Number.isSafeInteger(manifest.entryCount) ||
+    typeof manifest.sha256 !== 'string'
+  ) {
+    throw new Error('Malformed user archive manifest: userId, accountId, entryCount and sha256 are required');
+  }
+  return manifest;
+}
+
+async function writeFrame(output: Writable, frame: Buffer): Promise<void> {
+  if (!output.write(frame)) {
+    await once(output, 'drain');
+  }
+}
@@ -0,0 +1,261 @@
+/**
+ * Validating Ledger Service Tests
+ */
+
+import { ValidatingLedgerService, AppendValidator, ValidationStage } from './validating-ledger.service';
+import { appendHookValidator, defaultValidators, programValidators } from './append-validators';
+import { ILedgerService, CreateLedgerEntryRequest, LedgerEntry } from './types';
+import { WalletModel } from '../db/models/wallet.model';
+import {
+  AppendErrorCode,
+  AppendValidationError,
+  AccountFrozenError,
+  IdempotencyKeyRejectedError,
+  MissingAdjustReasonError,
+  findErrorCause,
+} from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { defaultProgram } from '../config/program';
+
+jest.mock('../db/models/wallet.model');
+
+describe('ValidatingLedgerService', () => {
+  let inner: jest.Mocked<ILedgerService>;
+  let calls: string[];
+
+  const request: CreateLedgerEntryRequest = {
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: 'idem-1',
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 100,
+  };
+
+  const recording = (name: string, stage: ValidationStage, fail = false): AppendValidator => ({
+    name,
+    stage,
+    validate: () => {
+      calls.push(name);
+      if (fail) {
+        throw new Error(`${name} failed`);
+      }
+    },
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    calls = [];
+    inner = {
+      createEntry: jest.fn().mockImplementation(async (r: CreateLedgerEntryRequest) => ({ entryId: 'e1', ...r }) as LedgerEntry),
+      queryEntries: jest.fn(),
+      getEntry: jest.fn(),
+      entryExists: jest.fn(),
+      getBalanceSnapshot: jest.fn().mockResolvedValue({
+        accountId: 'user-123',
+        accountType: 'user',
+        availableBalance: 500,
+        escrowBalance: 0,
+        asOf: new Date(),
+        currency: 'points',
+      }),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+    (WalletModel.findOne as jest.Mock).mockReturnValue({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue({ userId: 'user-123', frozen: false }),
+    });
+  });
+
+  it('runs validators by stage, then in registration order', async () => {
+    const service = new ValidatingLedgerService(inner, [
+      recording('rbac', 'rbac'),
+      recording('cap-a', 'caps'),
+      recording('structural', 'structural'),
+      recording('cap-b', 'caps'),
+      recording('freeze', 'freeze'),
+    ]);
+    service.register(recording('policy', 'policy'));
+
+    await service.createEntry(request);
+
+    expect(calls).toEqual(['structural', 'policy', 'cap-a', 'cap-b', 'freeze', 'rbac']);
+    expect(inner.createEntry).toHaveBeenCalledWith(request);
+  });
+
+  it('stops at the first failure and names the validator', async () => {
+    const service = new ValidatingLedgerService(inner, [
+      recording('structural', 'structural'),
+      recording('quota', 'caps', true),
+      recording('freeze', 'freeze'),
+    ]);
+
+    const error = await service.createEntry(request).catch(e => e);
+
+    expect(calls).toEqual(['structural', 'quota']);
+    expect(inner.createEntry).not.toHaveBeenCalled();
+    expect(error.appendCode).toBe(AppendErrorCode.INVALID);
+    expect(error.message).toBe('quota: quota failed');
+    expect(findErrorCause(error, AppendValidationError)?.validator).toBe('quota');
+  });
+
+  it('keeps the code and status of a typed validator error', async () => {
+    (WalletModel.findOne as jest.Mock).mockReturnValue({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue({ userId: 'user-123', frozen: true }),
+    });
+    const service = new ValidatingLedgerService(inner, defaultValidators());
+
+    const error = await service.createEntry(request).catch(e => e);
+
+    expect(error.statusCode).toBe(423);
+    expect(error.code).toBe('ACCOUNT_FROZEN');
+    expect(findErrorCause(error, AccountFrozenError)).toBeDefined();
+  });
+
+  it('supports program-specific validators next to the built-ins', async () => {
+    // Example: a program that only awards promotions in multiples of 50
+    const promotionStep: AppendValidator = {
+      name: 'promotion-step',
+      stage: 'policy',
+      validate(r) {
+        if (r.reason === TransactionReason.PROMOTIONAL_AWARD && r.amount % 50 !== 0) {
+          throw new Error('Promotional awards must be multiples of 50');
+        }
+      },
+    };
+    const service = new ValidatingLedgerService(inner, defaultValidators());
+    service.register(promotionStep);
+
+    await expect(service.createEntry(request)).resolves.toMatchObject({ entryId: 'e1' });
+    const error = await service
+      .createEntry({ ...request, amount: 120, balanceAfter: 120 })
+      .catch(e => e);
+
+    expect(findErrorCause(error, AppendValidationError)?.validator).toBe('promotion-step');
+  });
+
+  it('loads account state once per append for every validator', async () => {
+    const reader = (name: string): AppendValidator => ({
+      name,
+      stage: 'policy',
+      validate: async (_r, view) => {
+        await view.balance();
+        await view.wallet();
+      },
+    });
+    const service = new ValidatingLedgerService(inner, [reader('a'), reader('b')]);
+
+    await service.createEntry(request);
+
+    expect(inner.getBalanceSnapshot).toHaveBeenCalledTimes(1);
+    expect(WalletModel.findOne).toHaveBeenCalledTimes(1);
+  });
+
+  it('rejects duplicate validator names and unknown stages', () => {
+    const service = new ValidatingLedgerService(inner, [recording('a', 'rules')]);
+
+    expect(() => service.register(recording('a', 'policy'))).toThrow('already registered');
+    expect(() => service.register(recording('b', 'later' as ValidationStage))).toThrow('Unknown validation stage');
+  });
+
+  it('stops running a validator once unregistered', async () => {
+    const service = new ValidatingLedgerService(inner);
+    const unregister = service.register(recording('a', 'rules'));
+    unregister();
+
+    await service.createEntry(request);
+
+    expect(calls).toEqual([]);
+  });
+
+  describe('previewAdjust', () => {
+    // Balance 500; single debits capped at 1000
+    const program = { current: () => ({ ...defaultProgram(), programId: 'vip', maxDebitPerEntry: 1000 }) };
+
+    it('projects a benign adjustment without appending it', async () => {
+      const service = new ValidatingLedgerService(inner, programValidators(program));
+
+      const preview = await service.previewAdjust('user-123', 200, 'admin-1');
+
+      expect(preview.current.availableBalance).toBe(500);
+      expect(preview.projected).toMatchObject({ availableBalance: 700, escrowBalance: 0 });
+      expect(preview.violations).toEqual([]);
+      expect(inner.createEntry).not.toHaveBeenCalled();
+      expect(inner.getBalanceSnapshot).toHaveBeenCalledTimes(1);
+    });
+
+    it('lists every guard a large debit would trip', async () => {
+      const service = new ValidatingLedgerService(inner, programValidators(program));
+
+      const preview = await service.previewAdjust('user-123', -5000);
+
+      expect(preview.projected.availableBalance).toBe(-4500);
+      expect(preview.violations).toEqual([
+        {
+          validator: 'program-overdraft',
+          stage: 'policy',
+          code: 'INSUFFICIENT_BALANCE',
+          message: 'Insufficient balance. Required: 5000, Available: 500',
+        },
+        {
+          validator: 'program-caps',
+          stage: 'caps',
+          code: undefined,
+          message: 'debit of 5000 exceeds the vip cap of 1000',
+        },
+      ]);
+      expect(inner.createEntry).not.toHaveBeenCalled();
+    });
+
+    it('skips validators with side effects', async () => {
+      const beforeAppend = jest.fn();
+      const service = new ValidatingLedgerService(inner, [
+        ...defaultValidators(),
+        appendHookValidator({ name: 'daily-cap', beforeAppend }),
+      ]);
+
+      const preview = await service.previewAdjust('user-123', 100);
+
+      expect(preview.skipped).toEqual(['daily-cap', 'ledger-append-rules']);
+      expect(beforeAppend).not.toHaveBeenCalled();
+    });
+
+    it('includes the append rules the inner ledger enforces', async () => {
+      inner.appendRuleViolations = jest.fn().mockReturnValue([
+        new IdempotencyKeyRejectedError(new Error('not a UUID')),
+        new MissingAdjustReasonError('adjust-preview', TransactionReason.ADMIN_CREDIT),
+      ]);
+      const service = new ValidatingLedgerService(inner, defaultValidators());
+
+      const preview = await service.previewAdjust('user-123', 200, 'admin-1');
+
+      expect(preview.violations).toEqual([
+        {
+          validator: 'ledger-append-rules',
+          stage: 'rules',
+          code: 'MISSING_ADJUST_REASON',
+          message: 'Adjustment adjust-preview (admin_credit) has no comment; this ledger requires one',
+        },
+      ]);
+      expect(preview.skipped).toEqual([]);
+      expect(inner.appendRuleViolations).toHaveBeenCalledWith(
+        expect.objectContaining({ reason: TransactionReason.ADMIN_CREDIT, metadata: { committedBy: 'admin-1' } })
+      );
+    });
+
+    it('rejects a zero adjustment', async () => {
+      const service = new ValidatingLedgerService(inner, defaultValidators());
+
+      await expect(service.previewAdjust('user-123', 0)).rejects.toThrow('non-zero integer');
+    });
+  });
+});
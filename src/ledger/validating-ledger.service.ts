@@ -0,0 +1,372 @@
+/**
+ * Validating Ledger Service
+ *
+ * Wraps an ILedgerService and runs every append through one ordered chain
+ * of AppendValidators, so entry checks live in one place instead of being
+ * spread over constructors, wrappers and storage constraints.
+ *
+ * Validators run by stage, then in registration order within a stage:
+ *   structural → rules → policy → caps → freeze → rbac
+ * The first failure stops the chain and the append is rejected with an
+ * AppendValidationError naming the validator. Validators read the
+ * account's existing state through a ValidationReadView, which loads each
+ * piece of state at most once per append so every validator sees the
+ * same values.
+ *
+ * The built-in validators are in append-validators; deployments register
+ * their own alongside them.
+ *
+ * previewAdjust runs the chain against a proposed manual adjustment
+ * without appending it, so an operator can see the projected balance and
+ * every guard the adjustment would trip before committing it.
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from './types';
+import { WalletModel } from '../db/models/wallet.model';
+import {
+  LedgerAppendError,
+  AppendValidationError,
+  WalletServiceError,
+  IdempotencyKeyRejectedError,
+} from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Stages of the validation chain, in the order they run
+ */
+export const VALIDATION_STAGES = ['structural', 'rules', 'policy', 'caps', 'freeze', 'rbac'] as const;
+
+export type ValidationStage = (typeof VALIDATION_STAGES)[number];
+
+/**
+ * Name reported for the inner ledger's own append rules in a preview
+ */
+const LEDGER_APPEND_RULES = 'ledger-append-rules';
+
+/**
+ * Wallet state visible to validators
+ */
+export interface ValidationWallet {
+  userId: string;
+  frozen?: boolean;
+}
+
+/**
+ * Read access to the existing state of the account being appended to
+ */
+export interface ValidationReadView {
+  /** Current balances (null for system accounts) */
+  balance(): Promise<BalanceSnapshot | null>;
+
+  /** The user's wallet (null for non-user accounts or a missing wallet) */
+  wallet(): Promise<ValidationWallet | null>;
+
+  /** Ledger entries of the account matching a filter */
+  entries(filter?: Omit<LedgerQueryFilter, 'accountId' | 'accountType'>): Promise<LedgerQueryResult>;
+}
+
+/**
+ * One check in the validation chain
+ */
+export interface AppendValidator {
+  /** Validator name, reported with its failures */
+  readonly name: string;
+
+  /** Chain stage the validator runs in */
+  readonly stage: ValidationStage;
+
+  /**
+   * Whether validate changes state (e.g. reserves capacity), so
+   * previewAdjust must not run it
+   */
+  readonly sideEffects?: boolean;
+
+  /**
+   * Check an entry before it is appended; throw to reject it
+   */
+  validate(request: CreateLedgerEntryRequest, view: ValidationReadView): void | Promise<void>;
+}
+
+/**
+ * A validator a previewed adjustment would fail
+ */
+export interface PreviewViolation {
+  validator: string;
+
+  stage: ValidationStage;
+
+  /** Code of a typed validator error (e.g. INSUFFICIENT_BALANCE) */
+  code?: string;
+
+  message: string;
+}
+
+/**
+ * Projected effect of a manual adjustment, computed without appending it
+ */
+export interface AdjustPreview {
+  userId: string;
+
+  /** Signed adjustment (positive credit, negative debit) */
+  amount: number;
+
+  /** Balances before the adjustment */
+  current: BalanceSnapshot;
+
+  /** Balances the adjustment would leave */
+  projected: BalanceSnapshot;
+
+  /** Every validator the adjustment would fail, in chain order (empty when it would be accepted) */
+  violations: PreviewViolation[];
+
+  /** Validators not run because they have side effects, and the inner ledger's rules when it cannot report them */
+  skipped: string[];
+}
+
+/**
+ * ValidatingLedgerService implementation
+ */
+export class ValidatingLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private validators: AppendValidator[] = [];
+
+  constructor(inner: ILedgerService, validators: AppendValidator[] = []) {
+    this.inner = inner;
+    validators.forEach(validator => this.register(validator));
+  }
+
+  /**
+   * Register a validator in its stage, after those already registered
+   * @returns Function that unregisters the validator
+   */
+  register(validator: AppendValidator): () => void {
+    if (!VALIDATION_STAGES.includes(validator.stage)) {
+      throw new Error(`Unknown validation stage: ${validator.stage}`);
+    }
+    if (this.validators.some(registered => registered.name === validator.name)) {
+      throw new Error(`Validator already registered: ${validator.name}`);
+    }
+
+    this.validators.push(validator);
+    return () => {
+      this.validators = this.validators.filter(v => v !== validator);
+    };
+  }
+
+  /**
+   * Registered validators in the order they run
+   */
+  chain(): AppendValidator[] {
+    // Array sort is stable, so registration order holds within a stage
+    return [...this.validators].sort(
+      (a, b) => VALIDATION_STAGES.indexOf(a.stage) - VALIDATION_STAGES.indexOf(b.stage)
+    );
+  }
+
+  /**
+   * Run the validation chain, then append
+   *
+   * @throws LedgerAppendError wrapping the AppendValidationError of the first failing validator
+   */
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    const view = this.readView(request);
+
+    for (const validator of this.chain()) {
+      try {
+        await validator.validate(request, view);
+      } catch (error) {
+        MetricsLogger.incrementCounter(MetricEventType.LEDGER_VALIDATION_FAILED, {
+          validator: validator.name,
+          stage: validator.stage,
+          accountId: request.accountId,
+          idempotencyKey: request.idempotencyKey,
+        });
+        throw LedgerAppendError.from(new AppendValidationError(validator.name, error), request);
+      }
+    }
+
+    return this.inner.createEntry(request);
+  }
+
+  /**
+   * Show what a manual adjustment to a user's available balance would do
+   * Runs the whole chain, not stopping at the first failure, against the
+   * admin credit or debit the adjustment would append, then the inner
+   * ledger's own append rules (adjustment comments, allowed committers,
+   * reference patterns), and projects the balances it would leave.
+   * Nothing is appended. Validators with side effects are skipped and
+   * listed, since running them would not be a preview, as are the inner
+   * ledger's rules when it cannot report them.
+   *
+   * @param committedBy Operator the adjustment would be recorded under, for role checks
+   * @throws Error if amount is not a non-zero integer
+   */
+  async previewAdjust(userId: string, amount: number, committedBy?: string): Promise<AdjustPreview> {
+    if (!Number.isSafeInteger(amount) || amount === 0) {
+      throw new Error('Adjustment must be a non-zero integer');
+    }
+
+    const credit = amount > 0;
+    const current = await this.inner.getBalanceSnapshot(userId, 'user');
+
+    const request: CreateLedgerEntryRequest = {
+      accountId: userId,
+      accountType: 'user',
+      amount,
+      type: credit ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: credit ? 'none→available' : 'available→none',
+      reason: credit ? TransactionReason.ADMIN_CREDIT : TransactionReason.ADMIN_DEBIT,
+      idempotencyKey: 'adjust-preview',
+      requestId: 'adjust-preview',
+      balanceBefore: current.availableBalance,
+      balanceAfter: current.availableBalance + amount,
+      metadata: committedBy ? { committedBy } : undefined,
+    };
+    // The balance already read is the one validators see
+    const view: ValidationReadView = { ...this.readView(request), balance: () => Promise.resolve(current) };
+
+    const violations: PreviewViolation[] = [];
+    const skipped: string[] = [];
+    for (const validator of this.chain()) {
+      if (validator.sideEffects) {
+        skipped.push(validator.name);
+        continue;
+      }
+
+      try {
+        await validator.validate(request, view);
+      } catch (error) {
+        violations.push({
+          validator: validator.name,
+          stage: validator.stage,
+          code: error instanceof WalletServiceError ? error.code : undefined,
+          message: error instanceof Error ? error.message : String(error),
+        });
+      }
+    }
+
+    if (this.inner.appendRuleViolations) {
+      for (const error of this.inner.appendRuleViolations(request)) {
+        // The preview's idempotency key is a placeholder, not the adjustment's
+        if (error instanceof IdempotencyKeyRejectedError) {
+          continue;
+        }
+        violations.push({
+          validator: LEDGER_APPEND_RULES,
+          stage: 'rules',
+          code: error instanceof WalletServiceError ? error.code : undefined,
+          message: error.message,
+        });
+      }
+    } else {
+      skipped.push(LEDGER_APPEND_RULES);
+    }
+
+    return {
+      userId,
+      amount,
+      current,
+      projected: { ...current, availableBalance: current.availableBalance + amount },
+      violations,
+      skipped,
+    };
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    return this.inner.queryEntries(filter);
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    return this.inner.getEntry(entryId);
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.inner.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    return this.inner.getAuditTrail(transactionId);
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  /**
+   * Read view over the request's account, loading each value once
+   */
+  private readView(request: CreateLedgerEntryRequest): ValidationReadView {
+    const { accountId, accountType } = request;
+    let balance: Promise<BalanceSnapshot | null> | undefined;
+    let wallet: Promise<ValidationWallet | null> | undefined;
+
+    return {
+      balance: () => {
+        if (!balance) {
+          balance =
+            accountType === 'system'
+              ? Promise.resolve(null)
+              : this.inner.getBalanceSnapshot(accountId, accountType);
+        }
+        return balance;
+      },
+      wallet: () => {
+        if (!wallet) {
+          wallet =
+            accountType === 'user'
+              ? WalletModel.findOne({ userId: { $eq: accountId } }).lean<ValidationWallet>().exec()
+              : Promise.resolve(null);
+        }
+        return wallet;
+      },
+      entries: filter => this.inner.queryEntries({ ...filter, accountId, accountType }),
+    };
+  }
+}
+
+/**
+ * Factory function to create a validating ledger service
+ */
+export function createValidatingLedgerService(
+  inner: ILedgerService,
+  validators?: AppendValidator[]
+): ValidatingLedgerService {
+  return new ValidatingLedgerService(inner, validators);
+}
@@ -0,0 +1,122 @@
+/**
+ * Store Warm-up Tests
+ */
+
+import { warmup, CachedBalanceReader, IWarmupStore, Warmable, WarmupContext } from './warmup';
+import { BalanceSnapshotCache } from '../events/balance-snapshot-cache';
+
+describe('warmup', () => {
+  const store = (users: string[] = ['user-1', 'user-2', 'user-3']): IWarmupStore => ({
+    recentlyActiveUsers: jest.fn().mockImplementation(async (limit: number) => users.slice(0, limit)),
+  });
+
+  // Resolves only when released, so tests control completion order
+  const gated = (name: string) => {
+    let release!: () => void;
+    const done = new Promise<void>(resolve => {
+      release = resolve;
+    });
+    const target: Warmable & { warm: jest.Mock } = { name, warm: jest.fn().mockReturnValue(done) };
+    return { target, release };
+  };
+
+  const flush = () => new Promise(resolve => setImmediate(resolve));
+
+  it('warms every target with the top-K recent users', async () => {
+    const warmStore = store();
+    const targets = ['a', 'b'].map(name => ({ name, warm: jest.fn().mockResolvedValue(undefined) }));
+
+    const report = await warmup(warmStore, targets, { topK: 2 });
+
+    expect(warmStore.recentlyActiveUsers).toHaveBeenCalledWith(2);
+    for (const target of targets) {
+      expect(target.warm).toHaveBeenCalledWith({ recentUsers: ['user-1', 'user-2'] });
+    }
+    expect(report).toMatchObject({ completed: ['a', 'b'], failed: [], pending: [], timedOut: false });
+  });
+
+  it('runs at most the configured number of targets at once', async () => {
+    const targets = ['a', 'b', 'c'].map(gated);
+
+    const done = warmup(store(), targets.map(t => t.target), { concurrency: 2 });
+    await flush();
+
+    expect(targets.map(t => t.target.warm.mock.calls.length)).toEqual([1, 1, 0]);
+    targets[0].release();
+    await flush();
+    expect(targets[2].target.warm).toHaveBeenCalledTimes(1);
+
+    targets[1].release();
+    targets[2].release();
+    await expect(done).resolves.toMatchObject({ completed: ['a', 'b', 'c'] });
+  });
+
+  it('reports progress and keeps going past a failing target', async () => {
+    const onProgress = jest.fn();
+    const targets = [
+      { name: 'bloom', warm: jest.fn().mockRejectedValue(new Error('out of memory')) },
+      { name: 'stats', warm: jest.fn().mockResolvedValue(undefined) },
+    ];
+
+    const report = await warmup(store(), targets, { concurrency: 1, onProgress });
+
+    expect(report).toMatchObject({ completed: ['stats'], failed: [{ name: 'bloom', error: 'out of memory' }] });
+    expect(onProgress.mock.calls.map(([progress]) => progress)).toEqual([
+      { name: 'bloom', completed: 1, total: 2, error: 'out of memory' },
+      { name: 'stats', completed: 2, total: 2, error: undefined },
+    ]);
+  });
+
+  it('returns at the deadline without starting further targets', async () => {
+    const slow = gated('slow');
+    const queued = { name: 'queued', warm: jest.fn().mockResolvedValue(undefined) };
+
+    const report = await warmup(store(), [slow.target, queued], { concurrency: 1, deadlineMs: 10 });
+
+    expect(report).toMatchObject({ completed: [], pending: ['slow', 'queued'], timedOut: true });
+    slow.release();
+    await flush();
+    expect(queued.warm).not.toHaveBeenCalled();
+  });
+
+  it('rejects an invalid concurrency', async () => {
+    await expect(warmup(store(), [], { concurrency: 0 })).rejects.toThrow('concurrency');
+  });
+
+  describe('CachedBalanceReader', () => {
+    const ledger = () => ({
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string, accountType: 'user' | 'model') => ({
+        accountId,
+        accountType,
+        availableBalance: accountId === 'user-1' ? 500 : 20,
+        escrowBalance: 0,
+        asOf: new Date(),
+        currency: 'points',
+      })),
+    });
+
+    it('answers balances of warmed users without touching the ledger', async () => {
+      const backend = ledger();
+      const reader = new CachedBalanceReader(backend, new BalanceSnapshotCache({ enabled: false }));
+
+      await warmup(store(['user-1', 'user-2']), [reader]);
+      backend.getBalanceSnapshot.mockClear();
+
+      await expect(reader.getBalanceSnapshot('user-1', 'user')).resolves.toMatchObject({ availableBalance: 500 });
+      await expect(reader.getBalanceSnapshot('user-2', 'user')).resolves.toMatchObject({ availableBalance: 20 });
+      expect(backend.getBalanceSnapshot).not.toHaveBeenCalled();
+    });
+
+    it('reads a cold account from the ledger once, then from the cache', async () => {
+      const backend = ledger();
+      const reader = new CachedBalanceReader(backend, new BalanceSnapshotCache({ enabled: false }));
+      const context: WarmupContext = { recentUsers: [] };
+      await reader.warm(context);
+
+      await reader.getBalanceSnapshot('user-9', 'user');
+      await reader.getBalanceSnapshot('user-9', 'user');
+
+      expect(backend.getBalanceSnapshot).toHaveBeenCalledTimes(1);
+    });
+  });
+});
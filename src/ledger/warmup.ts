@@ -0,0 +1,242 @@
+/**
+ * Store Warm-up
+ *
+ * A freshly started instance has empty in-memory read structures, so its
+ * first balance queries all fall through to MongoDB. warmup() rebuilds the
+ * registered Warmable components before the instance takes traffic:
+ * - the store supplies the top-K users by recent activity once, and every
+ *   component warms from that same list
+ * - at most `concurrency` components warm at once
+ * - onProgress is called as each component finishes or fails
+ * - past the deadline no further components start and warmup() returns;
+ *   components already running finish in the background
+ *
+ * A failing component never stops the others; it is reported and the
+ * instance simply stays cold for it. StartupReadiness runs warm-up after
+ * the self-check and reports degraded when warm-up is incomplete.
+ */
+
+import { BalanceSnapshot } from './types';
+import { LedgerService } from './ledger.service';
+import { BalanceSnapshotCache } from '../events/balance-snapshot-cache';
+
+/**
+ * Query warm-up needs from the store
+ * Implemented by LastActivityIndex.
+ */
+export interface IWarmupStore {
+  /** User IDs, most recent activity first */
+  recentlyActiveUsers(limit: number): Promise<string[]>;
+}
+
+/**
+ * Input shared by every component in one warm-up
+ */
+export interface WarmupContext {
+  /** Top-K users by recent activity, most recent first */
+  recentUsers: string[];
+}
+
+/**
+ * A component that can rebuild its state before the instance is ready
+ */
+export interface Warmable {
+  readonly name: string;
+
+  warm(context: WarmupContext): Promise<void>;
+}
+
+/**
+ * Progress reported after each component finishes
+ */
+export interface WarmupProgress {
+  /** Component that just finished */
+  name: string;
+
+  /** Components finished so far, including failed ones */
+  completed: number;
+
+  total: number;
+
+  /** Set when the component failed */
+  error?: string;
+}
+
+/**
+ * Warm-up options
+ */
+export interface WarmupOptions {
+  /** Components warmed at once */
+  concurrency: number;
+
+  /** Recently active users passed to each component */
+  topK: number;
+
+  /** Stop waiting after this many milliseconds; 0 waits for every component */
+  deadlineMs: number;
+
+  onProgress?: (progress: WarmupProgress) => void;
+}
+
+/**
+ * Outcome of a warm-up
+ */
+export interface WarmupReport {
+  completed: string[];
+
+  failed: { name: string; error: string }[];
+
+  /** Components running or not started when the deadline passed */
+  pending: string[];
+
+  timedOut: boolean;
+
+  startedAt: Date;
+
+  durationMs: number;
+}
+
+const DEFAULT_OPTIONS: WarmupOptions = {
+  concurrency: 4,
+  topK: 1000,
+  deadlineMs: 0,
+};
+
+/**
+ * Warm every target with bounded concurrency
+ *
+ * @throws Error if the options are invalid or the store query fails
+ */
+export async function warmup(
+  store: IWarmupStore,
+  targets: Warmable[],
+  options: Partial<WarmupOptions> = {}
+): Promise<WarmupReport> {
+  const config: WarmupOptions = { ...DEFAULT_OPTIONS, ...options };
+
+  if (!Number.isInteger(config.concurrency) || config.concurrency < 1) {
+    throw new Error(`Warm-up concurrency must be a positive integer, got ${config.concurrency}`);
+  }
+  if (!Number.isInteger(config.topK) || config.topK < 0) {
+    throw new Error(`Warm-up topK must be a non-negative integer, got ${config.topK}`);
+  }
+
+  const startedAt = new Date();
+  const context: WarmupContext = {
+    recentUsers: targets.length > 0 && config.topK > 0 ? await store.recentlyActiveUsers(config.topK) : [],
+  };
+
+  const completed: string[] = [];
+  const failed: { name: string; error: string }[] = [];
+  const running = new Set<string>();
+  let next = 0;
+  let expired = false;
+
+  const worker = async (): Promise<void> => {
+    while (!expired && next < targets.length) {
+      const target = targets[next++];
+      running.add(target.name);
+      let error: string | undefined;
+
+      try {
+        await target.warm(context);
+        completed.push(target.name);
+      } catch (err) {
+        error = err instanceof Error ? err.message : String(err);
+        failed.push({ name: target.name, error });
+      }
+
+      running.delete(target.name);
+      config.onProgress?.({
+        name: target.name,
+        completed: completed.length + failed.length,
+        total: targets.length,
+        error,
+      });
+    }
+  };
+
+  const workers = Promise.all(
+    Array.from({ length: Math.min(config.concurrency, targets.length) }, () => worker())
+  );
+
+  let timedOut = false;
+  if (config.deadlineMs > 0) {
+    let timer: NodeJS.Timeout | undefined;
+    const deadline = new Promise<boolean>(resolve => {
+      timer = setTimeout(() => resolve(true), config.deadlineMs);
+    });
+    timedOut = await Promise.race([workers.then(() => false), deadline]);
+    clearTimeout(timer);
+  } else {
+    await workers;
+  }
+
+  // Snapshot before expiring, so late finishers cannot change the report
+  const pending = timedOut ? [...running, ...targets.slice(next).map(target => target.name)] : [];
+  expired = true;
+
+  return {
+    completed: [...completed],
+    failed: [...failed],
+    pending,
+    timedOut,
+    startedAt,
+    durationMs: Date.now() - startedAt.getTime(),
+  };
+}
+
+/**
+ * Read-through balance source over a BalanceSnapshotCache
+ *
+ * Answers from the cache when it can and falls back to the ledger,
+ * priming the cache with the result. As a Warmable it primes the
+ * balances of the recently active users before the first request.
+ */
+export class CachedBalanceReader implements Warmable {
+  readonly name = 'balance-cache';
+  private ledger: Pick<LedgerService, 'getBalanceSnapshot'>;
+  private cache: BalanceSnapshotCache;
+  private currency: string;
+
+  constructor(
+    ledger: Pick<LedgerService, 'getBalanceSnapshot'>,
+    cache: BalanceSnapshotCache,
+    currency: string = 'points'
+  ) {
+    this.ledger = ledger;
+    this.cache = cache;
+    this.currency = currency;
+  }
+
+  /**
+   * Get an account's current balance, from the cache when present
+   */
+  async getBalanceSnapshot(accountId: string, accountType: 'user' | 'model'): Promise<BalanceSnapshot> {
+    const cached = this.cache.getBalance(accountId, accountType);
+    if (cached) {
+      return {
+        accountId,
+        accountType,
+        availableBalance: cached.availableBalance,
+        escrowBalance: cached.escrowBalance,
+        earnedBalance: cached.earnedBalance,
+        asOf: cached.lastUpdated,
+        currency: this.currency,
+      };
+    }
+
+    const snapshot = await this.ledger.getBalanceSnapshot(accountId, accountType);
+    this.cache.prime(snapshot);
+    return snapshot;
+  }
+
+  /**
+   * Prime the balances of the recently active users
+   */
+  async warm(context: WarmupContext): Promise<void> {
+    for (const userId of context.recentUsers) {
+      this.cache.prime(await this.ledger.getBalanceSnapshot(userId, 'user'));
+    }
+  }
+}
@@ -0,0 +1,69 @@
+/**
+ * Ledger Wire Format Tests
+ */
+
+import { Readable } from 'stream';
+import { WIRE_MAGIC, WIRE_FORMAT_VERSION, WireContentType, encodeFrame, decodeFrame, readFrames } from './wire-format';
+
+describe('ledger wire format', () => {
+  const collect = async (input: Readable) => {
+    const frames = [];
+    for await (const frame of readFrames(input)) {
+      frames.push(frame);
+    }
+    return frames;
+  };
+
+  it.each([WireContentType.LEDGER_EXPORT, WireContentType.SNAPSHOT])('reads back a frame of content type %i', contentType => {
+    const payload = Buffer.from('{"entryId":"entry-1"}\n', 'utf8');
+
+    const frame = encodeFrame(contentType, payload);
+
+    expect(frame.subarray(0, 4)).toEqual(WIRE_MAGIC);
+    expect(decodeFrame(frame)).toEqual({
+      frame: { version: WIRE_FORMAT_VERSION, contentType, payload },
+      bytes: frame.length,
+    });
+  });
+
+  it('reads frames split across arbitrary stream chunks', async () => {
+    const data = Buffer.concat([
+      encodeFrame(WireContentType.SNAPSHOT, Buffer.from('first', 'utf8')),
+      encodeFrame(WireContentType.SNAPSHOT, Buffer.alloc(0)),
+    ]);
+    const pieces = Array.from({ length: Math.ceil(data.length / 7) }, (_, i) => data.subarray(i * 7, i * 7 + 7));
+
+    const frames = await collect(Readable.from(pieces));
+
+    expect(frames.map(frame => frame.payload.toString('utf8'))).toEqual(['first', '']);
+  });
+
+  it('rejects a foreign file by its magic', async () => {
+    expect(() => decodeFrame(Buffer.from('{"entryId":"entry-1"}', 'utf8'))).toThrow('Unrecognized artifact');
+    await expect(collect(Readable.from([Buffer.from('PK\u0003\u0004zip', 'binary')]))).rejects.toThrow(
+      'Unrecognized artifact'
+    );
+  });
+
+  it('rejects an unknown version or content type', () => {
+    const frame = encodeFrame(WireContentType.LEDGER_EXPORT, Buffer.from('x'));
+
+    const future = Buffer.from(frame);
+    future[4] = WIRE_FORMAT_VERSION + 1;
+    const unknownType = Buffer.from(frame);
+    unknownType[5] = 0x7f;
+
+    expect(() => decodeFrame(future)).toThrow(`Unsupported wire format version ${WIRE_FORMAT_VERSION + 1}`);
+    expect(() => decodeFrame(unknownType)).toThrow('Unknown artifact content type 127');
+  });
+
+  it('rejects an altered or truncated frame', async () => {
+    const frame = encodeFrame(WireContentType.LEDGER_EXPORT, Buffer.from('payload', 'utf8'));
+    const altered = Buffer.from(frame);
+    altered[12] ^= 0x01;
+
+    expect(() => decodeFrame(altered)).toThrow('checksum mismatch');
+    expect(decodeFrame(frame.subarray(0, frame.length - 1))).toBeNull();
+    await expect(collect(Readable.from([frame.subarray(0, frame.length - 1)]))).rejects.toThrow('truncated');
+  });
+});
@@ -0,0 +1,157 @@
+/**
+ * Ledger Wire Format
+ *
+ * One self-describing, framed format for every artifact the ledger
+ * persists, so a reader can tell what a file holds and which version
+ * wrote it before trusting a byte of it. An artifact is a sequence of
+ * frames, each one:
+ *
+ *   magic (4) | version (1) | content type (1) | payload length (4, BE) | payload | SHA-256 (32)
+ *
+ * The checksum covers the header and payload of its own frame, so a
+ * truncated or altered frame is rejected on its own and a stream can be
+ * validated frame by frame without holding the whole artifact. The magic
+ * starts with a non-ASCII byte, so a frame is never mistaken for JSON
+ * or text.
+ *
+ * A new encoding is a new version; readers reject versions they do not
+ * know rather than guessing.
+ */
+
+import { createHash } from 'crypto';
+import { Readable } from 'stream';
+
+/**
+ * Bytes every frame starts with
+ */
+export const WIRE_MAGIC = Buffer.from([0x89, 0x52, 0x52, 0x57]);
+
+/**
+ * Version of the frame layout written by this build
+ */
+export const WIRE_FORMAT_VERSION = 1;
+
+/**
+ * What an artifact holds
+ */
+export enum WireContentType {
+  /** Checkpointed ledger export (see ./ledger-export) */
+  LEDGER_EXPORT = 1,
+
+  /** Point-in-time copy of the whole ledger */
+  SNAPSHOT = 2,
+
+  /** Live log of entries, one record per frame (see ./log-reader) */
+  LOG_RECORD = 3,
+
+  /** One user's entries for portability (see ./user-archive) */
+  USER_ARCHIVE = 4,
+
+  /** Manifest closing a user archive */
+  USER_ARCHIVE_MANIFEST = 5,
+}
+
+const HEADER_BYTES = WIRE_MAGIC.length + 1 + 1 + 4;
+const CHECKSUM_BYTES = 32;
+
+/**
+ * Largest payload a frame may carry
+ */
+export const MAX_FRAME_PAYLOAD_BYTES = 64 * 1024 * 1024;
+
+/**
+ * A decoded frame
+ */
+export interface WireFrame {
+  version: number;
+  contentType: WireContentType;
+  payload: Buffer;
+}
+
+/**
+ * Frame a payload
+ *
+ * @throws Error if the payload is larger than MAX_FRAME_PAYLOAD_BYTES
+ */
+export function encodeFrame(contentType: WireContentType, payload: Buffer): Buffer {
+  if (payload.length > MAX_FRAME_PAYLOAD_BYTES) {
+    throw new Error(`Frame payload of ${payload.length} bytes exceeds ${MAX_FRAME_PAYLOAD_BYTES}`);
+  }
+
+  const header = Buffer.alloc(HEADER_BYTES);
+  WIRE_MAGIC.copy(header, 0);
+  header.writeUInt8(WIRE_FORMAT_VERSION, WIRE_MAGIC.length);
+  header.writeUInt8(contentType, WIRE_MAGIC.length + 1);
+  header.writeUInt32BE(payload.length, WIRE_MAGIC.length + 2);
+
+  return Buffer.concat([header, payload, checksum(header, payload)]);
+}
+
+/**
+ * Decode the frame at the start of data
+ *
+ * @returns The frame and the bytes it occupied, or null if data ends before the frame does
+ * @throws Error if the data is not a frame of a known version and content type, or fails its checksum
+ */
+export function decodeFrame(data: Buffer): { frame: WireFrame; bytes: number } | null {
+  const magic = data.subarray(0, WIRE_MAGIC.length);
+  if (!WIRE_MAGIC.subarray(0, magic.length).equals(magic)) {
+    throw new Error(`Unrecognized artifact: expected magic ${WIRE_MAGIC.toString('hex')}, found ${magic.toString('hex')}`);
+  }
+  if (data.length < HEADER_BYTES) {
+    return null;
+  }
+
+  const version = data.readUInt8(WIRE_MAGIC.length);
+  if (version !== WIRE_FORMAT_VERSION) {
+    throw new Error(`Unsupported wire format version ${version} (this build reads ${WIRE_FORMAT_VERSION})`);
+  }
+  const contentType = data.readUInt8(WIRE_MAGIC.length + 1);
+  if (WireContentType[contentType] === undefined) {
+    throw new Error(`Unknown artifact content type ${contentType}`);
+  }
+  const length = data.readUInt32BE(WIRE_MAGIC.length + 2);
+  if (length > MAX_FRAME_PAYLOAD_BYTES) {
+    throw new Error(`Frame payload of ${length} bytes exceeds ${MAX_FRAME_PAYLOAD_BYTES}`);
+  }
+
+  const bytes = HEADER_BYTES + length + CHECKSUM_BYTES;
+  if (data.length < bytes) {
+    return null;
+  }
+
+  const header = data.subarray(0, HEADER_BYTES);
+  const payload = data.subarray(HEADER_BYTES, HEADER_BYTES + length);
+  if (!checksum(header, payload).equals(data.subarray(HEADER_BYTES + length, bytes))) {
+    throw new Error('Frame checksum mismatch: artifact is corrupt or truncated');
+  }
+
+  return { frame: { version, contentType, payload: Buffer.from(payload) }, bytes };
+}
+
+/**
+ * Read frames from a stream as they arrive
+ *
+ * @throws Error on the first invalid frame, or if the stream ends inside a frame
+ */
+export async function* readFrames(input: Readable): AsyncGenerator<WireFrame> {
+  let buffered = Buffer.alloc(0);
+
+  for await (const chunk of input) {
+    buffered = Buffer.concat([buffered, Buffer.isBuffer(chunk) ? chunk : Buffer.from(chunk)]);
+
+    for (let decoded = decodeFrame(buffered); decoded; decoded = decodeFrame(buffered)) {
+      buffered = buffered.subarray(decoded.bytes);
+      yield decoded.frame;
+    }
+  }
+
+  if (buffered.length > 0) {
+    decodeFrame(buffered);
+    throw new Error('Artifact ends inside a frame: it is truncated');
+  }
+}
+
+function checksum(header: Buffer, payload: Buffer): Buffer {
+  return createHash('sha256').update(header).update(payload).digest();
+}
@@ -0,0 +1,138 @@
+/**
+ * Ledger Write Queue Tests
+ */
+
+import { LedgerWriteQueue, exponentialBackoff } from './write-queue';
+import { CreateLedgerEntryRequest, LedgerEntry } from './types';
+import { WriteQueueFullError, InsufficientBalanceError, MaintenanceModeError } from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('LedgerWriteQueue', () => {
+  let written: string[];
+  let ledger: { createEntryWithResult: jest.Mock };
+
+  const request = (idempotencyKey: string): CreateLedgerEntryRequest => ({
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 10,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey,
+    requestId: `req-${idempotencyKey}`,
+    balanceBefore: 0,
+    balanceAfter: 10,
+  });
+
+  const tick = () => new Promise(resolve => setImmediate(resolve));
+
+  beforeEach(() => {
+    written = [];
+    // Stores with a varying latency, so out-of-order writes would show
+    ledger = {
+      createEntryWithResult: jest.fn().mockImplementation(async (req: CreateLedgerEntryRequest) => {
+        await new Promise(resolve => setTimeout(resolve, written.length % 3));
+        written.push(req.idempotencyKey);
+        return { entry: { entryId: `entry-${req.idempotencyKey}` } as LedgerEntry, inserted: true };
+      }),
+    };
+  });
+
+  it('should write concurrent submissions in submission order with ordered sequences', async () => {
+    const queue = new LedgerWriteQueue(ledger, { maxDepth: 4 });
+    const keys = Array.from({ length: 12 }, (_, i) => `key-${i}`);
+
+    const results = await Promise.all(keys.map(key => queue.appendAsync(request(key))));
+
+    expect(written).toEqual(keys);
+    expect(results.map(result => result.sequence)).toEqual(keys.map((_, i) => i + 1));
+    expect(results.map(result => result.entry.entryId)).toEqual(keys.map(key => `entry-${key}`));
+    expect(queue.depth).toBe(0);
+  });
+
+  it('should reject a submission when full under the reject policy', async () => {
+    const queue = new LedgerWriteQueue(ledger, { maxDepth: 2, whenFull: 'reject' });
+
+    const first = queue.appendAsync(request('key-1'));
+    const second = queue.appendAsync(request('key-2'));
+    const error = await queue.appendAsync(request('key-3')).catch(e => e);
+
+    expect(error).toBeInstanceOf(WriteQueueFullError);
+    expect(error.details).toEqual({ maxDepth: 2 });
+    await Promise.all([first, second]);
+    await expect(queue.appendAsync(request('key-4'))).resolves.toMatchObject({ sequence: 3 });
+    expect(written).toEqual(['key-1', 'key-2', 'key-4']);
+  });
+
+  it('should hold a submission until a slot frees under the block policy', async () => {
+    let release!: () => void;
+    ledger.createEntryWithResult.mockImplementationOnce(async (req: CreateLedgerEntryRequest) => {
+      await new Promise<void>(resolve => (release = resolve));
+      written.push(req.idempotencyKey);
+      return { entry: { entryId: 'entry-key-1' } as LedgerEntry, inserted: true };
+    });
+    const queue = new LedgerWriteQueue(ledger, { maxDepth: 1, whenFull: 'block' });
+
+    const first = queue.appendAsync(request('key-1'));
+    let admitted = false;
+    const second = queue.appendAsync(request('key-2')).then(result => {
+      admitted = true;
+      return result;
+    });
+    await tick();
+
+    expect(admitted).toBe(false);
+    expect(ledger.createEntryWithResult).toHaveBeenCalledTimes(1);
+
+    release();
+    expect(await second).toMatchObject({ sequence: 2 });
+    expect(await first).toMatchObject({ sequence: 1 });
+    expect(written).toEqual(['key-1', 'key-2']);
+  });
+
+  it('should retry a retryable failure with backoff and keep order', async () => {
+    ledger.createEntryWithResult.mockRejectedValueOnce(new MaintenanceModeError('read_only', 'migrating', 1));
+    const backoff = jest.fn().mockReturnValue(1);
+    const queue = new LedgerWriteQueue(ledger, { backoff });
+
+    await Promise.all([queue.appendAsync(request('key-1')), queue.appendAsync(request('key-2'))]);
+
+    expect(backoff).toHaveBeenCalledWith(1, expect.any(MaintenanceModeError));
+    expect(written).toEqual(['key-1', 'key-2']);
+  });
+
+  it('should reject a request once the backoff gives up and write the next', async () => {
+    ledger.createEntryWithResult.mockRejectedValueOnce(new InsufficientBalanceError(500, 100));
+    const queue = new LedgerWriteQueue(ledger);
+
+    const first = queue.appendAsync(request('key-1'));
+    const second = queue.appendAsync(request('key-2'));
+
+    await expect(first).rejects.toThrow(InsufficientBalanceError);
+    await expect(second).resolves.toMatchObject({ sequence: 2 });
+    expect(ledger.createEntryWithResult).toHaveBeenCalledTimes(2);
+  });
+
+  it('should settle every admitted request before drain resolves', async () => {
+    const queue = new LedgerWriteQueue(ledger, { maxDepth: 1 });
+    const submissions = ['key-1', 'key-2', 'key-3'].map(key => queue.appendAsync(request(key)));
+
+    await queue.drain();
+
+    expect(written).toEqual(['key-1', 'key-2', 'key-3']);
+    await Promise.all(submissions);
+  });
+
+  it('should double the delay and give up after the last attempt', () => {
+    const backoff = exponentialBackoff(10, 3);
+    const transient = new MaintenanceModeError('read_only', 'migrating', 1);
+
+    expect([1, 2, 3, 4].map(attempt => backoff(attempt, transient))).toEqual([10, 20, 40, null]);
+    expect(backoff(1, new InsufficientBalanceError(500, 100))).toBeNull();
+  });
+
+  it('should reject a non-positive max depth', () => {
+    expect(() => new LedgerWriteQueue(ledger, { maxDepth: 0 })).toThrow('maxDepth must be a positive integer');
+  });
+});
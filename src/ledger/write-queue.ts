@@ -0,0 +1,191 @@
+/**
+ * Ledger Write Queue
+ *
+ * Bounded queue in front of a ledger for producers that should not wait
+ * on the store for each append. appendAsync() admits a request, numbers
+ * it, and returns a promise that settles once a single background writer
+ * has committed it; the writer appends admitted requests one at a time in
+ * admission order, so entries reach the store in the order they were
+ * submitted and sequence numbers follow that order.
+ *
+ * At most maxDepth requests are admitted (queued or being written) at a
+ * time. When the queue is full the whenFull policy decides:
+ *
+ *   - 'block': the submitter waits for a slot; waiting submitters are
+ *     admitted first come, first served
+ *   - 'reject': the submission fails at once with WriteQueueFullError
+ *
+ * A failed append is retried after the delay the backoff returns, and
+ * rejected to its submitter once the backoff gives up; the writer then
+ * moves on to the next request. Retries replay on the request's
+ * idempotency key, so a write that landed before its failure was
+ * reported is never doubled. The queue holds requests in memory only;
+ * a request is durable once its promise resolves.
+ */
+
+import { CreateLedgerEntryRequest, CreateLedgerEntryResult } from './types';
+import { LedgerService } from './ledger.service';
+import { WriteQueueFullError, isRetryableAppendError } from '../services/types';
+
+/**
+ * The part of the ledger the queue writes through
+ */
+export type QueueLedger = Pick<LedgerService, 'createEntryWithResult'>;
+
+/**
+ * Delay in milliseconds before retry number `attempt` of a failed
+ * append, or null to give up and reject it
+ */
+export type WriteBackoff = (attempt: number, error: unknown) => number | null;
+
+/**
+ * Configuration for a write queue
+ */
+export interface WriteQueueConfig {
+  /** Requests admitted (queued or being written) at once */
+  maxDepth: number;
+
+  /** What a submission does when the queue is full */
+  whenFull: 'block' | 'reject';
+
+  backoff: WriteBackoff;
+}
+
+/**
+ * Result of a queued append
+ */
+export interface QueuedAppendResult extends CreateLedgerEntryResult {
+  /** Admission order, from 1 */
+  sequence: number;
+}
+
+/**
+ * Backoff doubling from baseMs, giving up after maxAttempts retries or at
+ * the first failure isRetryableAppendError rejects
+ */
+export function exponentialBackoff(baseMs = 50, maxAttempts = 5): WriteBackoff {
+  return (attempt, error) =>
+    attempt > maxAttempts || !isRetryableAppendError(error) ? null : baseMs * 2 ** (attempt - 1);
+}
+
+const DEFAULT_CONFIG: WriteQueueConfig = {
+  maxDepth: 1000,
+  whenFull: 'block',
+  backoff: exponentialBackoff(),
+};
+
+interface QueuedWrite {
+  request: CreateLedgerEntryRequest;
+  sequence: number;
+  resolve: (result: QueuedAppendResult) => void;
+  reject: (error: unknown) => void;
+}
+
+/**
+ * Ledger Write Queue Implementation
+ */
+export class LedgerWriteQueue {
+  private config: WriteQueueConfig;
+  private items: QueuedWrite[] = [];
+  private waiters: Array<() => void> = [];
+  private admitted = 0;
+  private lastSequence = 0;
+  private writer: Promise<void> | null = null;
+
+  /**
+   * @throws Error if maxDepth is not a positive integer
+   */
+  constructor(private ledger: QueueLedger, config?: Partial<WriteQueueConfig>) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+
+    if (!Number.isSafeInteger(this.config.maxDepth) || this.config.maxDepth < 1) {
+      throw new Error(`maxDepth must be a positive integer: ${this.config.maxDepth}`);
+    }
+  }
+
+  /**
+   * Requests admitted and not yet settled
+   */
+  get depth(): number {
+    return this.items.length;
+  }
+
+  /**
+   * Queue an append behind every request admitted before it
+   *
+   * @throws WriteQueueFullError if the queue is full and whenFull is 'reject'
+   * @throws LedgerAppendError wrapping the last failure once the backoff gives up
+   */
+  async appendAsync(request: CreateLedgerEntryRequest): Promise<QueuedAppendResult> {
+    // Waiting submitters go first, so a newcomer never takes their slot
+    if (this.admitted < this.config.maxDepth && this.waiters.length === 0) {
+      this.admitted++;
+    } else if (this.config.whenFull === 'reject') {
+      throw new WriteQueueFullError(this.config.maxDepth);
+    } else {
+      // The slot is handed over already counted
+      await new Promise<void>(resolve => this.waiters.push(resolve));
+    }
+
+    return new Promise<QueuedAppendResult>((resolve, reject) => {
+      this.items.push({ request, sequence: ++this.lastSequence, resolve, reject });
+      if (!this.writer) {
+        this.writer = this.run();
+      }
+    });
+  }
+
+  /**
+   * Resolves once every admitted request has settled
+   */
+  async drain(): Promise<void> {
+    // A woken submitter holds a slot before its request is queued
+    while (this.admitted > 0) {
+      await (this.writer || Promise.resolve());
+    }
+  }
+
+  private async run(): Promise<void> {
+    while (this.items.length > 0) {
+      const item = this.items[0];
+      try {
+        item.resolve({ ...(await this.write(item.request)), sequence: item.sequence });
+      } catch (error) {
+        item.reject(error);
+      }
+      this.items.shift();
+      this.release();
+    }
+    this.writer = null;
+  }
+
+  private async write(request: CreateLedgerEntryRequest): Promise<CreateLedgerEntryResult> {
+    for (let attempt = 1; ; attempt++) {
+      try {
+        return await this.ledger.createEntryWithResult(request);
+      } catch (error) {
+        const delay = this.config.backoff(attempt, error);
+        if (delay === null) {
+          throw error;
+        }
+        await new Promise(resolve => setTimeout(resolve, delay));
+      }
+    }
+  }
+
+  private release(): void {
+    const next = this.waiters.shift();
+    if (next) {
+      next();
+    } else {
+      this.admitted--;
+    }
+  }
+}
+
+/**
+ * Factory function to create a write queue
+ */
+export function createWriteQueue(ledger: QueueLedger, config?: Partial<WriteQueueConfig>): LedgerWriteQueue {
+  return new LedgerWriteQueue(ledger, config);
+}
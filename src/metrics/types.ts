@@ -31,6 +31,53 @@ export enum MetricEventType {
   RESERVATION_COMMITTED = 'reservation.committed',
   RESERVATION_RELEASED = 'reservation.released',
   RESERVATION_EXPIRED = 'reservation.expired',
+  GIFT_OFFERED = 'gift.offered',
+  GIFT_ACCEPTED = 'gift.accepted',
+  GIFT_RETURNED = 'gift.returned',
+  
+  // Ledger integrity metrics
+  LEDGER_SIGNATURE_INVALID = 'ledger.signature.invalid',
+  LEDGER_DATA_ERASED = 'ledger.data.erased',
+  LEDGER_TRANSACTION_CONCEALED = 'ledger.transaction.concealed',
+  LEDGER_TRANSACTIONS_RECONCILED = 'ledger.transactions.reconciled',
+  LEDGER_ENTRIES_TIERED = 'ledger.entries.tiered',
+  LEDGER_TIER_VERIFICATION_FAILED = 'ledger.tier.verification_failed',
+  LEDGER_HOOK_DURATION = 'ledger.hook.duration',
+  LEDGER_HOOK_ERROR = 'ledger.hook.error',
+  LEDGER_HOOK_SLOW = 'ledger.hook.slow',
+  LEDGER_VALIDATION_FAILED = 'ledger.validation.failed',
+  REGION_DIVERGENCE_CHECKED = 'ledger.region.divergence_checked',
+  REGION_DIVERGENCE_CONFLICT = 'ledger.region.divergence_conflict',
+  LEDGER_SELF_CHECK_FAILED = 'ledger.self_check.failed',
+  LEDGER_TAIL_DROPPED = 'ledger.tail.dropped',
+  LEDGER_TAIL_OVERFLOW = 'ledger.tail.overflow',
+  LEDGER_PROJECTION_LAGGED = 'ledger.projection.lagged',
+  LEDGER_WRITE_MODE_CHANGED = 'ledger.write_mode.changed',
+  LEDGER_WRITE_REJECTED = 'ledger.write.rejected',
+  LEDGER_STORE_SWAPPED = 'ledger.store.swapped',
+  LEDGER_SHARD_ACCOUNT_MOVED = 'ledger.shard.account_moved',
+  LEDGER_MIRROR_FAILED = 'ledger.mirror.failed',
+  LEDGER_REPLICA_WRITE_FAILED = 'ledger.replica.write_failed',
+  LEDGER_REPLICA_READ_FAILED = 'ledger.replica.read_failed',
+  LEDGER_DIGEST_FOLD_FAILED = 'ledger.digest.fold_failed',
+  LEDGER_TOP_USERS = 'ledger.top_users',
+  LEDGER_AMOUNT_ANOMALY = 'ledger.amount.anomaly',
+  LEDGER_ANOMALY_CALLBACK_FAILED = 'ledger.amount.anomaly_callback_failed',
+  
+  // Redemption guard metrics
+  REDEMPTION_VELOCITY_BLOCKED = 'redemption.velocity.blocked',
+  REDEMPTION_VELOCITY_OVERRIDE = 'redemption.velocity.override',
+  REDEMPTION_REFERENCE_OVERDRAWN = 'redemption.reference_overdrawn',
+  
+  // Earn guard metrics
+  EARN_DUPLICATE_REFERENCE = 'earn.duplicate_reference',
+  EARN_REFERENCE_LIMIT_EXCEEDED = 'earn.reference_limit_exceeded',
+  ISSUER_QUOTA_EXCEEDED = 'earn.issuer_quota_exceeded',
+  ISSUER_QUOTA_SOFT_THRESHOLD = 'earn.issuer_quota_soft_threshold',
+  EARN_DAILY_CAP_EXCEEDED = 'earn.daily_cap_exceeded',
+  
+  // Expiration metrics
+  POINT_EXPIRATION_SWEEP_FAILED = 'expiration.sweep_failed',
   
   // Activity feed metrics (placeholder for future)
   ACTIVITY_FEED_EVENT = 'activity.feed.event',
@@ -0,0 +1,260 @@
+/**
+ * Program Conversion Tests
+ */
+
+import { ConversionService, ConversionRateTable, programAccountId } from './conversion';
+import { createPointProgram } from './program';
+import { WalletModel } from '../db/models/wallet.model';
+import {
+  AccountFrozenError,
+  InsufficientBalanceError,
+  InvalidPointAmountError,
+  WalletApplicationConflictError,
+} from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { applyWalletDelta } from '../wallets/wallet-application';
+
+jest.mock('../db/models/wallet.model');
+jest.mock('../wallets/wallet-application');
+
+describe('ConversionService', () => {
+  const vip = createPointProgram({ programId: 'vip', scale: 2 });
+  const retail = createPointProgram({ programId: 'retail', scale: 0 });
+  const rates = new ConversionRateTable([
+    { version: 1, effectiveFrom: new Date('2024-01-01T00:00:00Z'), rates: { 'vip->retail': '1.5' } },
+    { version: 2, effectiveFrom: new Date('2024-06-01T00:00:00Z'), rates: { 'vip->retail': '2.5' } },
+  ]);
+
+  let entries: any[];
+  let opening: Record<string, number>;
+  let appliedKeys: Map<string, number>;
+  let mockLedgerService: { createEntryWithResult: jest.Mock; getByReference: jest.Mock; getBalanceSnapshot: jest.Mock };
+
+  const service = (config = {}) => new ConversionService(mockLedgerService as any, [vip, retail], rates, config);
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    entries = [];
+    opening = { [programAccountId('vip', 'user-1')]: 5000 };
+
+    mockLedgerService = {
+      getByReference: jest.fn().mockImplementation(async (reference: string, options: any) => {
+        const matching = entries.filter(e => e.correlationId === reference);
+        return { entries: matching.slice(0, options.limit), totalCount: matching.length };
+      }),
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string) => ({
+        accountId,
+        availableBalance: entries
+          .filter(e => e.accountId === accountId)
+          .reduce((sum, e) => sum + e.amount, opening[accountId] || 0),
+      })),
+      // Unique idempotency key index: the first insert wins, later calls replay it
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, timestamp: new Date(), ...request };
+        entries.push(entry);
+        return { entry, inserted: true };
+      }),
+    };
+    (WalletModel.findOne as jest.Mock).mockResolvedValue({ userId: 'user-1', frozen: false });
+    (WalletModel.updateOne as jest.Mock).mockResolvedValue({ acknowledged: true });
+
+    appliedKeys = new Map();
+    // One application per key, as the wallet_applications unique index enforces
+    (applyWalletDelta as jest.Mock).mockImplementation(async (_userId: string, delta: number, key: string) => {
+      if (appliedKeys.has(key)) {
+        if (appliedKeys.get(key) !== delta) {
+          throw new WalletApplicationConflictError(key, ['delta']);
+        }
+        return false;
+      }
+      appliedKeys.set(key, delta);
+      return true;
+    });
+  });
+
+  it('should append a linked debit and credit at the current rate version', async () => {
+    const result = await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+
+    expect(result).toMatchObject({ debited: 1000, credited: 25, rateVersion: 2, rate: '2.5', forfeited: false, replayed: false });
+    expect(entries).toHaveLength(2);
+    expect(result.debitEntry).toMatchObject({
+      accountId: 'vip:user-1',
+      amount: -1000,
+      type: TransactionType.DEBIT,
+      reason: TransactionReason.PROGRAM_CONVERSION,
+      balanceBefore: 5000,
+      balanceAfter: 4000,
+      correlationId: 'conversion-conv-1',
+      metadata: { rateVersion: 2, rate: '2.5' },
+    });
+    expect(result.creditEntry).toMatchObject({
+      accountId: 'retail:user-1',
+      amount: 25,
+      type: TransactionType.CREDIT,
+      balanceBefore: 0,
+      balanceAfter: 25,
+      correlationId: 'conversion-conv-1',
+      metadata: { rateVersion: 2, debitEntryId: result.debitEntry.entryId },
+    });
+  });
+
+  it('should move the source wallet before the debit and the target wallet after the credit', async () => {
+    await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+
+    expect(WalletModel.updateOne).toHaveBeenCalledWith(
+      { userId: { $eq: 'vip:user-1' } },
+      { $setOnInsert: { userId: 'vip:user-1', availableBalance: 5000, currency: 'points' } },
+      { upsert: true }
+    );
+    expect(applyWalletDelta).toHaveBeenCalledWith('vip:user-1', -1000, 'conversion-conv-1-debit');
+    expect(applyWalletDelta).toHaveBeenCalledWith('retail:user-1', 25, 'conversion-conv-1-credit');
+
+    const [debitApplied, creditApplied] = (applyWalletDelta as jest.Mock).mock.invocationCallOrder;
+    const [debitAppended, creditAppended] = mockLedgerService.createEntryWithResult.mock.invocationCallOrder;
+    expect(debitApplied).toBeLessThan(debitAppended);
+    expect(creditAppended).toBeLessThan(creditApplied);
+  });
+
+  it('should key wallets by the stored account ID', async () => {
+    const tokenize = (id: string) => (id.startsWith('tok-') ? id : `tok-${id}`);
+    const original = mockLedgerService.createEntryWithResult.getMockImplementation()!;
+    mockLedgerService.createEntryWithResult.mockImplementation(async (request: any) =>
+      original({ ...request, accountId: tokenize(request.accountId) })
+    );
+
+    await service({ userIdTokenizer: tokenize }).convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+
+    expect(WalletModel.findOne).toHaveBeenCalledWith({ userId: { $eq: 'tok-user-1' } });
+    expect(WalletModel.updateOne).toHaveBeenCalledWith(
+      { userId: { $eq: 'tok-vip:user-1' } },
+      expect.anything(),
+      { upsert: true }
+    );
+    expect(applyWalletDelta).toHaveBeenCalledWith('tok-vip:user-1', -1000, 'conversion-conv-1-debit');
+    expect(applyWalletDelta).toHaveBeenCalledWith('tok-retail:user-1', 25, 'conversion-conv-1-credit');
+  });
+
+  it('should append a debit whose append was rejected on re-run, but only for the same amount', async () => {
+    mockLedgerService.createEntryWithResult.mockRejectedValueOnce(new Error('committer not allowed'));
+
+    await expect(service().convert('user-1', 'vip', 'retail', 1000, 'conv-1')).rejects.toThrow('committer not allowed');
+    expect(entries).toHaveLength(0);
+
+    await expect(service().convert('user-1', 'vip', 'retail', 2000, 'conv-1')).rejects.toThrow(
+      WalletApplicationConflictError
+    );
+    expect(entries).toHaveLength(0);
+
+    const result = await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+    expect(result).toMatchObject({ debited: 1000, credited: 25 });
+    expect(entries.map(e => e.amount)).toEqual([-1000, 25]);
+  });
+
+  it('should append nothing when a concurrent conversion spent the balance', async () => {
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new InsufficientBalanceError(1000, 500));
+
+    await expect(service().convert('user-1', 'vip', 'retail', 1000, 'conv-1')).rejects.toThrow(InsufficientBalanceError);
+    expect(entries).toHaveLength(0);
+  });
+
+  it('should return the original result when re-run with the same key', async () => {
+    const first = await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+    const again = await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+
+    expect(again).toMatchObject({ credited: first.credited, rateVersion: first.rateVersion, replayed: true });
+    expect(again.debitEntry.entryId).toBe(first.debitEntry.entryId);
+    expect(again.creditEntry.entryId).toBe(first.creditEntry.entryId);
+    expect(entries).toHaveLength(2);
+  });
+
+  it('should reject reusing a key for a different conversion', async () => {
+    await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+
+    await expect(service().convert('user-1', 'vip', 'retail', 2000, 'conv-1')).rejects.toThrow('different conversion');
+  });
+
+  it('should complete a conversion interrupted after the debit', async () => {
+    const original = mockLedgerService.createEntryWithResult.getMockImplementation()!;
+    mockLedgerService.createEntryWithResult
+      .mockImplementationOnce(original)
+      .mockRejectedValueOnce(new Error('connection reset'));
+
+    await expect(service().convert('user-1', 'vip', 'retail', 1000, 'conv-1')).rejects.toThrow('connection reset');
+    expect(entries).toHaveLength(1);
+
+    const result = await service().convert('user-1', 'vip', 'retail', 1000, 'conv-1');
+
+    expect(result).toMatchObject({ credited: 25, replayed: true });
+    expect(entries.map(e => e.amount)).toEqual([-1000, 25]);
+    expect([...appliedKeys.keys()]).toEqual(['conversion-conv-1-debit', 'conversion-conv-1-credit']);
+  });
+
+  describe('remainders', () => {
+    it('should refuse a conversion leaving a remainder by default', async () => {
+      await expect(service().convert('user-1', 'vip', 'retail', 101, 'conv-1')).rejects.toThrow(InvalidPointAmountError);
+      expect(entries).toHaveLength(0);
+    });
+
+    it('should credit the rounded-down amount under the forfeit policy', async () => {
+      const result = await service({ remainderPolicy: 'forfeit' }).convert('user-1', 'vip', 'retail', 101, 'conv-1');
+
+      expect(result).toMatchObject({ debited: 101, credited: 2, forfeited: true });
+      expect(result.debitEntry.metadata).toMatchObject({ forfeited: true });
+    });
+
+    it('should refuse a conversion to less than one target unit under either policy', async () => {
+      await expect(service({ remainderPolicy: 'forfeit' }).convert('user-1', 'vip', 'retail', 20, 'conv-1')).rejects.toThrow(
+        'less than one retail unit'
+      );
+    });
+  });
+
+  describe('policies', () => {
+    it('should enforce program minimums', async () => {
+      const guarded = service({ policies: { vip: { minimumDebit: 500 }, retail: { minimumCredit: 10 } } });
+
+      await expect(guarded.convert('user-1', 'vip', 'retail', 400, 'conv-1')).rejects.toThrow('vip conversion minimum');
+      await expect(guarded.convert('user-1', 'vip', 'retail', 520, 'conv-2')).resolves.toMatchObject({ credited: 13 });
+      await expect(
+        service({ policies: { retail: { minimumCredit: 30 } } }).convert('user-1', 'vip', 'retail', 1000, 'conv-3')
+      ).rejects.toThrow('retail minimum credit');
+    });
+
+    it('should reject a frozen account', async () => {
+      (WalletModel.findOne as jest.Mock).mockResolvedValue({ userId: 'user-1', frozen: true });
+
+      await expect(service().convert('user-1', 'vip', 'retail', 1000, 'conv-1')).rejects.toThrow(AccountFrozenError);
+    });
+
+    it('should reject an insufficient source balance', async () => {
+      await expect(service().convert('user-1', 'vip', 'retail', 6000, 'conv-1')).rejects.toThrow(InsufficientBalanceError);
+      expect(entries).toHaveLength(0);
+    });
+
+    it('should reject unknown programs and pairs without a rate', async () => {
+      await expect(service().convert('user-1', 'vip', 'gold', 1000, 'conv-1')).rejects.toThrow('Unknown program');
+      await expect(service().convert('user-1', 'retail', 'vip', 10, 'conv-1')).rejects.toThrow('No conversion rate');
+    });
+  });
+
+  describe('ConversionRateTable', () => {
+    it('should pick the latest version in effect', () => {
+      expect(rates.rateFor('vip', 'retail', new Date('2024-03-01T00:00:00Z'))).toEqual({ version: 1, rate: '1.5' });
+      expect(rates.rateFor('vip', 'retail', new Date('2024-07-01T00:00:00Z'))).toEqual({ version: 2, rate: '2.5' });
+      expect(() => rates.rateFor('vip', 'retail', new Date('2023-01-01T00:00:00Z'))).toThrow('No conversion rate table');
+    });
+
+    it('should reject duplicate versions and non-positive rates', () => {
+      const at = new Date('2024-01-01T00:00:00Z');
+      expect(() => new ConversionRateTable([
+        { version: 1, effectiveFrom: at, rates: {} },
+        { version: 1, effectiveFrom: at, rates: {} },
+      ])).toThrow('Duplicate');
+      expect(() => new ConversionRateTable([{ version: 1, effectiveFrom: at, rates: { 'a->b': '0' } }])).toThrow('positive');
+    });
+  });
+});
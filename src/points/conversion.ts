@@ -0,0 +1,474 @@
+/**
+ * Program Conversion
+ *
+ * Converts a user's points in one program into points in another, such
+ * as VIP credits into retail points. All programs share the ledger; a
+ * user's balance in a program lives in the account
+ * programAccountId(programId, userId).
+ *
+ * Rates come from a versioned rate table: each version takes effect at a
+ * point in time and lists a decimal rate (target points per source point)
+ * per program pair. The rate version used is recorded on both entries.
+ *
+ * A conversion appends a linked pair: a debit in the source program and
+ * a credit of the converted amount in the target program, sharing the
+ * correlation ID `conversion-<idempotencyKey>`. The debit, recorded under
+ * a key derived from the caller's idempotency key, is the atomic claim;
+ * the credit key is derived from it. Like PostingEngine postings, a
+ * conversion interrupted between the two appends is completed by
+ * re-running it with the same key, and a re-run of a completed conversion
+ * returns the original result without appending anything.
+ *
+ * Each program account also has a wallet, created from its ledger balance
+ * the first time the account takes part in a conversion. The debit moves
+ * its wallet through applyWalletDelta before it is appended, so the
+ * conditional $inc is the balance check: two conversions with different
+ * keys cannot both spend the same points. A debit whose append is then
+ * rejected leaves its wallet application behind; re-running with the same
+ * key appends it, and applyWalletDelta refuses a re-run under that key
+ * for another amount. The credit cannot fail for want of funds, so it is
+ * appended first and its stored entry applied, as other flows do.
+ *
+ * Wallets are keyed by the account ID the ledger stores. Give the service
+ * the ledger's userIdTokenizer, so the frozen check and the debit, which
+ * moves its wallet before there is an entry to read the ID from, use the
+ * stored ID too.
+ *
+ * Converted amounts rarely land exactly on the target program's minimum
+ * unit. The remainder policy is explicit: 'refuse' rejects such a
+ * conversion, 'forfeit' credits the amount rounded down and the user
+ * forfeits the fraction.
+ *
+ * @module points/conversion
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { PointProgram } from './program';
+import { parseDecimal, toSafeNumber } from './fixed-point';
+import { LedgerService } from '../ledger/ledger.service';
+import { LedgerEntry, UserIdTokenizer } from '../ledger/types';
+import { WalletModel } from '../db/models/wallet.model';
+import {
+  AccountFrozenError,
+  InsufficientBalanceError,
+  InvalidPointAmountError,
+  UserIdRejectedError,
+} from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { applyWalletDelta } from '../wallets/wallet-application';
+
+/**
+ * Ledger account holding a user's balance in a program
+ */
+export function programAccountId(programId: string, userId: string): string {
+  return `${programId}:${userId}`;
+}
+
+/**
+ * One version of the conversion rate table
+ */
+export interface ConversionRateVersion {
+  version: number;
+
+  /** When this version takes effect */
+  effectiveFrom: Date;
+
+  /** Decimal target points per source point, keyed `<from>-><to>` */
+  rates: Record<string, string>;
+}
+
+/**
+ * Versioned conversion rates
+ */
+export class ConversionRateTable {
+  private versions: ConversionRateVersion[];
+
+  constructor(versions: ConversionRateVersion[]) {
+    const sorted = [...versions].sort((a, b) => a.version - b.version);
+    for (let i = 1; i < sorted.length; i++) {
+      if (sorted[i].version === sorted[i - 1].version) {
+        throw new Error(`Duplicate rate table version: ${sorted[i].version}`);
+      }
+      if (sorted[i].effectiveFrom < sorted[i - 1].effectiveFrom) {
+        throw new Error(`Rate table version ${sorted[i].version} takes effect before version ${sorted[i - 1].version}`);
+      }
+    }
+    for (const version of sorted) {
+      for (const [pair, rate] of Object.entries(version.rates)) {
+        if (parseDecimal(rate).mantissa <= 0n) {
+          throw new Error(`Rate for ${pair} in version ${version.version} must be positive`);
+        }
+      }
+    }
+    this.versions = sorted;
+  }
+
+  /**
+   * Rate for a program pair under the version in effect at a time
+   *
+   * @throws Error if no version is in effect or it has no rate for the pair
+   */
+  rateFor(fromProgram: string, toProgram: string, at: Date = new Date()): { version: number; rate: string } {
+    const current = [...this.versions].reverse().find(version => version.effectiveFrom <= at);
+    if (!current) {
+      throw new Error(`No conversion rate table in effect at ${at.toISOString()}`);
+    }
+
+    const rate = current.rates[`${fromProgram}->${toProgram}`];
+    if (rate === undefined) {
+      throw new Error(`No conversion rate from ${fromProgram} to ${toProgram} in version ${current.version}`);
+    }
+
+    return { version: current.version, rate };
+  }
+}
+
+/**
+ * Per-program conversion limits, in the program's units
+ */
+export interface ProgramConversionPolicy {
+  /** Smallest amount that may be converted out of the program */
+  minimumDebit?: number;
+
+  /** Smallest amount that may be credited into the program */
+  minimumCredit?: number;
+}
+
+/**
+ * Configuration for the conversion service
+ */
+export interface ConversionConfig {
+  /** What to do when the converted amount is not a whole target unit */
+  remainderPolicy: 'refuse' | 'forfeit';
+
+  /** Limits keyed by program ID */
+  policies: Record<string, ProgramConversionPolicy>;
+
+  /** Currency stamped on conversion entries */
+  defaultCurrency: string;
+
+  /** The ledger's userIdTokenizer (user IDs are stored as given when unset) */
+  userIdTokenizer?: UserIdTokenizer;
+}
+
+const DEFAULT_CONFIG: ConversionConfig = {
+  remainderPolicy: 'refuse',
+  policies: {},
+  defaultCurrency: 'points',
+};
+
+/**
+ * Outcome of a conversion
+ */
+export interface ConversionResult {
+  userId: string;
+  fromProgram: string;
+  toProgram: string;
+
+  /** Units debited from the source program */
+  debited: number;
+
+  /** Units credited to the target program */
+  credited: number;
+
+  rateVersion: number;
+  rate: string;
+
+  /** Whether a fraction of a target unit was forfeited */
+  forfeited: boolean;
+
+  debitEntry: LedgerEntry;
+  creditEntry: LedgerEntry;
+
+  /** True when the idempotency key had already been used */
+  replayed: boolean;
+}
+
+type ConversionLedger = Pick<LedgerService, 'createEntryWithResult' | 'getByReference' | 'getBalanceSnapshot'>;
+
+/**
+ * Program Conversion Service Implementation
+ */
+export class ConversionService {
+  private config: ConversionConfig;
+  private ledgerService: ConversionLedger;
+  private programs: Map<string, PointProgram<number>>;
+  private rates: ConversionRateTable;
+
+  constructor(
+    ledgerService: ConversionLedger,
+    programs: PointProgram<number>[],
+    rates: ConversionRateTable,
+    config: Partial<ConversionConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+    this.programs = new Map(programs.map(program => [program.programId, program]));
+    this.rates = rates;
+  }
+
+  /**
+   * Convert a user's points from one program to another
+   *
+   * @param amount Units of the source program to convert
+   * @throws InvalidPointAmountError if the amount breaks a minimum or
+   * leaves a remainder under the refuse policy
+   * @throws AccountFrozenError if the user's wallet is frozen
+   * @throws InsufficientBalanceError if the source balance is too low
+   * @throws UserIdRejectedError if the tokenizer rejects an account ID
+   * @throws WalletApplicationConflictError if an unappended debit under the key moved another amount
+   * @throws Error if the key was already used for a different conversion
+   */
+  async convert(
+    userId: string,
+    fromProgram: string,
+    toProgram: string,
+    amount: number,
+    idempotencyKey: string
+  ): Promise<ConversionResult> {
+    if (!userId || !idempotencyKey) {
+      throw new Error('userId and idempotencyKey are required');
+    }
+    if (fromProgram === toProgram) {
+      throw new Error('Cannot convert a program into itself');
+    }
+    const source = this.requireProgram(fromProgram);
+    const target = this.requireProgram(toProgram);
+
+    const correlationId = `conversion-${idempotencyKey}`;
+    const prior = await this.ledgerService.getByReference(correlationId, { limit: 2 });
+    const priorDebit = prior.entries.find(entry => entry.type === TransactionType.DEBIT);
+    if (priorDebit) {
+      this.assertSameConversion(priorDebit, userId, fromProgram, toProgram, amount, idempotencyKey);
+      const priorCredit = prior.entries.find(entry => entry.type === TransactionType.CREDIT);
+      const creditEntry = priorCredit || (await this.appendCredit(priorDebit));
+      return this.toResult(priorDebit, creditEntry, true);
+    }
+
+    if (amount <= 0) {
+      throw new InvalidPointAmountError(amount, 'conversion amount must be positive');
+    }
+    source.validate(amount);
+
+    const sourcePolicy = this.config.policies[fromProgram] || {};
+    const targetPolicy = this.config.policies[toProgram] || {};
+    if (sourcePolicy.minimumDebit !== undefined && amount < sourcePolicy.minimumDebit) {
+      throw new InvalidPointAmountError(amount, `below the ${fromProgram} conversion minimum of ${sourcePolicy.minimumDebit}`);
+    }
+
+    const { version, rate } = this.rates.rateFor(fromProgram, toProgram);
+    const { credited, forfeited } = this.convertUnits(amount, source, target, rate);
+    if (credited === 0) {
+      throw new InvalidPointAmountError(amount, `converts to less than one ${toProgram} unit`);
+    }
+    if (forfeited && this.config.remainderPolicy === 'refuse') {
+      throw new InvalidPointAmountError(amount, `does not convert to a whole number of ${toProgram} units`);
+    }
+    if (targetPolicy.minimumCredit !== undefined && credited < targetPolicy.minimumCredit) {
+      throw new InvalidPointAmountError(amount, `converts below the ${toProgram} minimum credit of ${targetPolicy.minimumCredit}`);
+    }
+
+    const wallet = await WalletModel.findOne({ userId: { $eq: await this.storedAccountId(userId) } });
+    if (wallet?.frozen) {
+      throw new AccountFrozenError(userId);
+    }
+
+    const sourceAccount = programAccountId(fromProgram, userId);
+    const sourceWallet = await this.storedAccountId(sourceAccount);
+    const balance = await this.programBalance(sourceAccount, sourceWallet);
+    if (balance < amount) {
+      throw new InsufficientBalanceError(amount, balance);
+    }
+
+    // Also throws InsufficientBalanceError if a concurrent conversion spent the balance
+    await applyWalletDelta(sourceWallet, -amount, `${correlationId}-debit`);
+
+    const { entry: debitEntry, inserted } = await this.ledgerService.createEntryWithResult({
+      transactionId: uuidv4(),
+      accountId: sourceAccount,
+      accountType: 'user',
+      amount: -amount,
+      type: TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: 'available→none',
+      reason: TransactionReason.PROGRAM_CONVERSION,
+      idempotencyKey: `${correlationId}-debit`,
+      requestId: correlationId,
+      balanceBefore: balance,
+      balanceAfter: balance - amount,
+      currency: this.config.defaultCurrency,
+      correlationId,
+      metadata: {
+        userId,
+        fromProgram,
+        toProgram,
+        debited: amount,
+        credited,
+        rateVersion: version,
+        rate,
+        forfeited,
+        creditTransactionId: uuidv4(),
+      },
+    });
+
+    // A concurrent call with the same key won the claim
+    if (!inserted) {
+      this.assertSameConversion(debitEntry, userId, fromProgram, toProgram, amount, idempotencyKey);
+    }
+
+    const creditEntry = await this.appendCredit(debitEntry);
+    return this.toResult(debitEntry, creditEntry, !inserted);
+  }
+
+  private assertSameConversion(
+    debit: LedgerEntry,
+    userId: string,
+    fromProgram: string,
+    toProgram: string,
+    amount: number,
+    idempotencyKey: string
+  ): void {
+    const meta = debit.metadata || {};
+    if (meta.userId !== userId || meta.fromProgram !== fromProgram || meta.toProgram !== toProgram || meta.debited !== amount) {
+      throw new Error(`Idempotency key ${idempotencyKey} was used for a different conversion`);
+    }
+  }
+
+  /**
+   * Append (or replay) the credit leg described by a debit leg, then
+   * apply the stored entry to its wallet
+   */
+  private async appendCredit(debit: LedgerEntry): Promise<LedgerEntry> {
+    const meta = debit.metadata!;
+    const targetAccount = programAccountId(meta.toProgram, meta.userId);
+    const idempotencyKey = `${debit.correlationId}-credit`;
+    const balance = await this.programBalance(targetAccount, await this.storedAccountId(targetAccount));
+
+    const { entry } = await this.ledgerService.createEntryWithResult({
+      transactionId: meta.creditTransactionId,
+      accountId: targetAccount,
+      accountType: 'user',
+      amount: meta.credited,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROGRAM_CONVERSION,
+      idempotencyKey,
+      requestId: debit.requestId,
+      balanceBefore: balance,
+      balanceAfter: balance + meta.credited,
+      currency: debit.currency,
+      correlationId: debit.correlationId,
+      metadata: {
+        userId: meta.userId,
+        fromProgram: meta.fromProgram,
+        toProgram: meta.toProgram,
+        rateVersion: meta.rateVersion,
+        rate: meta.rate,
+        debitEntryId: debit.entryId,
+        debitTransactionId: debit.transactionId,
+      },
+    });
+
+    await applyWalletDelta(entry.accountId, entry.amount, entry.idempotencyKey);
+    return entry;
+  }
+
+  /**
+   * Ledger balance of a program account
+   * Creates the account's wallet, under its stored ID, from that balance
+   * if it has none. Every leg reads the balance before it is appended, so
+   * the first conversion always seeds the wallet before any of its own
+   * entries reach the ledger.
+   */
+  private async programBalance(accountId: string, walletId: string): Promise<number> {
+    const balance = (await this.ledgerService.getBalanceSnapshot(accountId, 'user')).availableBalance;
+    try {
+      await WalletModel.updateOne(
+        { userId: { $eq: walletId } },
+        { $setOnInsert: { userId: walletId, availableBalance: balance, currency: this.config.defaultCurrency } },
+        { upsert: true }
+      );
+    } catch (error: any) {
+      // A concurrent conversion created the wallet first
+      if (error?.code !== 11000) {
+        throw error;
+      }
+    }
+    return balance;
+  }
+
+  /**
+   * Source units to target units, rounded down to the target's minimum unit
+   */
+  private convertUnits(
+    amount: number,
+    source: PointProgram<number>,
+    target: PointProgram<number>,
+    rate: string
+  ): { credited: number; forfeited: boolean } {
+    const parsed = parseDecimal(rate);
+
+    // amount / 10^fromScale * rate * 10^toScale / minimumUnit, kept exact
+    const numerator = BigInt(amount) * parsed.mantissa * 10n ** BigInt(target.scale);
+    const denominator = 10n ** BigInt(source.scale + parsed.places) * BigInt(target.minimumUnit);
+
+    const steps = numerator / denominator;
+    return {
+      credited: toSafeNumber(steps * BigInt(target.minimumUnit), amount),
+      forfeited: numerator % denominator !== 0n,
+    };
+  }
+
+  /**
+   * The account ID the ledger stores for a user or program account
+   */
+  private async storedAccountId(accountId: string): Promise<string> {
+    if (!this.config.userIdTokenizer) {
+      return accountId;
+    }
+
+    try {
+      return await this.config.userIdTokenizer(accountId);
+    } catch (error) {
+      throw new UserIdRejectedError(error);
+    }
+  }
+
+  private toResult(debit: LedgerEntry, credit: LedgerEntry, replayed: boolean): ConversionResult {
+    const meta = debit.metadata!;
+    return {
+      userId: meta.userId,
+      fromProgram: meta.fromProgram,
+      toProgram: meta.toProgram,
+      debited: meta.debited,
+      credited: meta.credited,
+      rateVersion: meta.rateVersion,
+      rate: meta.rate,
+      forfeited: meta.forfeited,
+      debitEntry: debit,
+      creditEntry: credit,
+      replayed,
+    };
+  }
+
+  private requireProgram(programId: string): PointProgram<number> {
+    const program = this.programs.get(programId);
+    if (!program) {
+      throw new Error(`Unknown program: ${programId}`);
+    }
+    return program;
+  }
+}
+
+/**
+ * Factory function to create a conversion service
+ */
+export function createConversionService(
+  ledgerService: ConversionLedger,
+  programs: PointProgram<number>[],
+  rates: ConversionRateTable,
+  config?: Partial<ConversionConfig>
+): ConversionService {
+  return new ConversionService(ledgerService, programs, rates, config);
+}
@@ -0,0 +1,89 @@
+/**
+ * Fixed-Point Amount Tests
+ */
+
+import {
+  fromDecimal,
+  toDecimal,
+  formatPoints,
+  divideRoundHalfEven,
+} from './fixed-point';
+import { InvalidPointAmountError } from '../services/types';
+
+describe('fixed-point amounts', () => {
+  describe('fromDecimal', () => {
+    it('should convert decimals to milli-points by default', () => {
+      expect(fromDecimal('2.5')).toBe(2500);
+      expect(fromDecimal('0.001')).toBe(1);
+      expect(fromDecimal('-3')).toBe(-3000);
+      expect(fromDecimal(' 10.25 ')).toBe(10250);
+    });
+
+    it('should honour an explicit scale', () => {
+      expect(fromDecimal('2.5', 1)).toBe(25);
+      expect(fromDecimal('7', 0)).toBe(7);
+    });
+
+    it('should reject more decimal places than the scale instead of rounding', () => {
+      expect(() => fromDecimal('2.0005', 3)).toThrow(InvalidPointAmountError);
+      expect(() => fromDecimal('2.5', 0)).toThrow('more than 0 decimal places');
+    });
+
+    it('should reject malformed input', () => {
+      for (const value of ['', 'abc', '1e3', '1.', '.5', '1,000', '0x10']) {
+        expect(() => fromDecimal(value)).toThrow(InvalidPointAmountError);
+      }
+    });
+
+    it('should reject values outside the safe integer range', () => {
+      expect(() => fromDecimal('9007199254740.992', 3)).toThrow('exceeds the safe integer range');
+    });
+
+    it('should reject unsupported scales', () => {
+      expect(() => fromDecimal('1', 7)).toThrow('Point scale must be an integer');
+    });
+  });
+
+  describe('toDecimal', () => {
+    it('should render minimal decimal strings', () => {
+      expect(toDecimal(2500)).toBe('2.5');
+      expect(toDecimal(1)).toBe('0.001');
+      expect(toDecimal(-1250)).toBe('-1.25');
+      expect(toDecimal(3000)).toBe('3');
+      expect(toDecimal(0)).toBe('0');
+    });
+
+    it('should round-trip with fromDecimal', () => {
+      for (const value of ['0.001', '2.5', '-17.042', '123456789.999']) {
+        expect(toDecimal(fromDecimal(value))).toBe(value);
+      }
+    });
+
+    it('should reject fractional units', () => {
+      expect(() => toDecimal(2.5)).toThrow(InvalidPointAmountError);
+    });
+  });
+
+  describe('formatPoints', () => {
+    it('should group thousands', () => {
+      expect(formatPoints(1234500)).toBe('1,234.5');
+      expect(formatPoints(-1234567000)).toBe('-1,234,567');
+      expect(formatPoints(999000)).toBe('999');
+    });
+  });
+
+  describe('divideRoundHalfEven', () => {
+    it('should round halves to the nearest even quotient', () => {
+      expect(divideRoundHalfEven(5n, 2n)).toBe(2n);
+      expect(divideRoundHalfEven(7n, 2n)).toBe(4n);
+      expect(divideRoundHalfEven(-5n, 2n)).toBe(-2n);
+      expect(divideRoundHalfEven(-7n, 2n)).toBe(-4n);
+    });
+
+    it('should round non-halves to the nearest quotient', () => {
+      expect(divideRoundHalfEven(10n, 3n)).toBe(3n);
+      expect(divideRoundHalfEven(11n, 3n)).toBe(4n);
+      expect(divideRoundHalfEven(-11n, 3n)).toBe(-4n);
+    });
+  });
+});
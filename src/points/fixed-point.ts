@@ -0,0 +1,151 @@
+/**
+ * Fixed-Point Point Amounts
+ *
+ * Ledger amounts are integers in a program's smallest unit. A scale of 3
+ * means one point is 1000 units (milli-points), so 2.5 points is 2500.
+ * Conversions are exact: decimal strings are parsed digit by digit and
+ * never pass through floating point.
+ *
+ * Rounding policy: wherever a computation produces a fraction of the
+ * smallest unit, it is rounded half-to-even exactly once, at the end of
+ * the computation. Parsing never rounds - input with more decimal places
+ * than the scale allows is rejected.
+ *
+ * @module points/fixed-point
+ */
+
+import { InvalidPointAmountError } from '../services/types';
+
+/**
+ * Default scale: milli-points
+ */
+export const DEFAULT_POINT_SCALE = 3;
+
+/**
+ * Largest supported scale, keeping realistic balances within safe integers
+ */
+export const MAX_POINT_SCALE = 6;
+
+const DECIMAL_PATTERN = /^([+-])?(\d+)(?:\.(\d+))?$/;
+
+/**
+ * A decimal parsed into an integer mantissa and a count of decimal places
+ */
+export interface ParsedDecimal {
+  mantissa: bigint;
+  places: number;
+}
+
+/**
+ * Validate a scale
+ */
+export function assertValidScale(scale: number): void {
+  if (!Number.isInteger(scale) || scale < 0 || scale > MAX_POINT_SCALE) {
+    throw new Error(`Point scale must be an integer between 0 and ${MAX_POINT_SCALE}: ${scale}`);
+  }
+}
+
+/**
+ * Parse a decimal string exactly
+ *
+ * @throws InvalidPointAmountError if the string is not a plain decimal
+ */
+export function parseDecimal(value: string): ParsedDecimal {
+  const match = DECIMAL_PATTERN.exec(typeof value === 'string' ? value.trim() : '');
+  if (!match) {
+    throw new InvalidPointAmountError(value, 'not a decimal number');
+  }
+
+  const [, sign, whole, fraction = ''] = match;
+  const mantissa = BigInt(whole + fraction);
+  return { mantissa: sign === '-' ? -mantissa : mantissa, places: fraction.length };
+}
+
+/**
+ * Convert a decimal string to integer units at the given scale
+ *
+ * @example fromDecimal('2.5', 3) === 2500
+ * @throws InvalidPointAmountError if the value has more decimal places than
+ * the scale or does not fit in a safe integer
+ */
+export function fromDecimal(value: string, scale: number = DEFAULT_POINT_SCALE): number {
+  assertValidScale(scale);
+  const { mantissa, places } = parseDecimal(value);
+
+  if (places > scale) {
+    throw new InvalidPointAmountError(value, `more than ${scale} decimal places`);
+  }
+
+  return toSafeNumber(mantissa * 10n ** BigInt(scale - places), value);
+}
+
+/**
+ * Render integer units at the given scale as a minimal decimal string
+ *
+ * @example toDecimal(2500, 3) === '2.5'
+ */
+export function toDecimal(units: number, scale: number = DEFAULT_POINT_SCALE): string {
+  assertValidScale(scale);
+  assertSafeUnits(units);
+
+  const negative = units < 0;
+  const digits = Math.abs(units).toString().padStart(scale + 1, '0');
+  const whole = digits.slice(0, digits.length - scale);
+  const fraction = digits.slice(digits.length - scale).replace(/0+$/, '');
+
+  return `${negative ? '-' : ''}${whole}${fraction ? `.${fraction}` : ''}`;
+}
+
+/**
+ * Render integer units for display, with thousands separators
+ *
+ * @example formatPoints(1234500, 3) === '1,234.5'
+ */
+export function formatPoints(units: number, scale: number = DEFAULT_POINT_SCALE): string {
+  const [whole, fraction] = toDecimal(units, scale).split('.');
+  const grouped = whole.replace(/\B(?=(\d{3})+(?!\d))/g, ',');
+  return fraction ? `${grouped}.${fraction}` : grouped;
+}
+
+/**
+ * Divide and round half-to-even - the single rounding policy for points
+ */
+export function divideRoundHalfEven(numerator: bigint, denominator: bigint): bigint {
+  if (denominator === 0n) {
+    throw new Error('Division by zero');
+  }
+
+  if (denominator < 0n) {
+    numerator = -numerator;
+    denominator = -denominator;
+  }
+
+  const quotient = numerator / denominator;
+  const remainder = numerator % denominator;
+  const doubled = (remainder < 0n ? -remainder : remainder) * 2n;
+
+  if (doubled < denominator || (doubled === denominator && quotient % 2n === 0n)) {
+    return quotient;
+  }
+
+  return quotient + (numerator < 0n ? -1n : 1n);
+}
+
+/**
+ * Convert a bigint to a number, rejecting values outside the safe range
+ */
+export function toSafeNumber(value: bigint, original: string | number = value.toString()): number {
+  if (value > BigInt(Number.MAX_SAFE_INTEGER) || value < BigInt(Number.MIN_SAFE_INTEGER)) {
+    throw new InvalidPointAmountError(original, 'exceeds the safe integer range');
+  }
+  return Number(value);
+}
+
+/**
+ * Reject non-integer or unsafe unit amounts
+ */
+function assertSafeUnits(units: number): void {
+  if (!Number.isSafeInteger(units)) {
+    throw new InvalidPointAmountError(units, 'units must be a safe integer');
+  }
+}
@@ -0,0 +1,9 @@
+/**
+ * Points Module Exports
+ * 
+ * Central export point for fixed-point amounts and point programs
+ */
+
+export * from './fixed-point';
+export * from './program';
+export * from './conversion';
@@ -0,0 +1,77 @@
+/**
+ * Point Program Tests
+ */
+
+import { createPointProgram } from './program';
+import { InvalidPointAmountError } from '../services/types';
+
+describe('PointProgram', () => {
+  const milli = createPointProgram({ programId: 'dollars-2x', scale: 3 });
+
+  it('should convert and render amounts at the program scale', () => {
+    const units = milli.fromDecimal('2.5');
+
+    expect(units).toBe(2500);
+    expect(milli.toDecimal(units)).toBe('2.5');
+    expect(milli.format(milli.fromDecimal('1234.5'))).toBe('1,234.5');
+  });
+
+  it('should compute earns exactly in scaled units', () => {
+    expect(milli.earn('12.34', '2.5')).toBe(30850);
+    expect(milli.earn('1', '2.5')).toBe(2500);
+    expect(milli.earn('0', '2.5')).toBe(0);
+  });
+
+  it('should round earns half-to-even once at the end', () => {
+    // 0.0005 * 1 = 0.5 milli-points -> 0; 0.0015 * 1 = 1.5 -> 2
+    expect(milli.earn('0.0005', '1')).toBe(0);
+    expect(milli.earn('0.0015', '1')).toBe(2);
+    // 0.3333 * 3 = 0.9999 points = 999.9 milli-points -> 1000
+    expect(milli.earn('0.3333', '3')).toBe(1000);
+  });
+
+  it('should round earns to the minimum unit', () => {
+    const halves = createPointProgram({ programId: 'halves', scale: 3, minimumUnit: 500 });
+
+    // 2.25 points is exactly between 2.0 and 2.5 -> even step (2.0)
+    expect(halves.earn('0.9', '2.5')).toBe(2000);
+    expect(halves.earn('1', '2.4')).toBe(2500);
+  });
+
+  it('should reject amounts that are not multiples of the minimum unit', () => {
+    const halves = createPointProgram({ programId: 'halves', scale: 3, minimumUnit: 500 });
+
+    expect(halves.fromDecimal('1.5')).toBe(1500);
+    expect(() => halves.fromDecimal('1.25')).toThrow(InvalidPointAmountError);
+    expect(() => halves.validate(1250)).toThrow('not a multiple of the minimum unit 500');
+  });
+
+  it('should reject negative earn inputs', () => {
+    expect(() => milli.earn('-1', '2')).toThrow('earn base must not be negative');
+    expect(() => milli.earn('1', '-2')).toThrow('earn rate must not be negative');
+  });
+
+  it('should sum amounts of the same program', () => {
+    expect(milli.add(milli.fromDecimal('1.5'), milli.fromDecimal('2.25'))).toBe(3750);
+  });
+
+  it('should not allow its scale to be changed after construction', () => {
+    expect(() => {
+      (milli as any).scale = 2;
+    }).toThrow(TypeError);
+  });
+
+  it('should not accept amounts from a program at another scale', () => {
+    const centi = createPointProgram({ programId: 'legacy', scale: 2 });
+    const amount = centi.fromDecimal('1.5');
+
+    // @ts-expect-error scale-2 amounts are not scale-3 amounts
+    milli.toDecimal(amount);
+  });
+
+  it('should reject invalid minimum units', () => {
+    expect(() => createPointProgram({ programId: 'bad', scale: 3, minimumUnit: 0 })).toThrow(
+      'minimumUnit must be a positive integer'
+    );
+  });
+});
@@ -0,0 +1,161 @@
+/**
+ * Point Programs
+ *
+ * A program fixes the scale of its point amounts. Every conversion,
+ * validation and earn calculation for the program goes through it, so
+ * there is no free-standing scale argument to get wrong. Amounts are
+ * branded with the program's scale: passing an amount from a program at
+ * one scale to a program at another is a compile-time error.
+ *
+ * @module points/program
+ */
+
+import { InvalidPointAmountError } from '../services/types';
+import {
+  DEFAULT_POINT_SCALE,
+  assertValidScale,
+  parseDecimal,
+  fromDecimal,
+  toDecimal,
+  formatPoints,
+  divideRoundHalfEven,
+  toSafeNumber,
+} from './fixed-point';
+
+/**
+ * Integer units at scale S
+ */
+export type ScaledPoints<S extends number> = number & { readonly __pointScale: S };
+
+/**
+ * Configuration for a point program
+ */
+export interface PointProgramConfig<S extends number> {
+  /** Program identifier */
+  programId: string;
+
+  /** Decimal places of one point (3 = milli-points) */
+  scale: S;
+
+  /**
+   * Smallest amount the program awards or accepts, in units
+   * (e.g. 500 at scale 3 restricts amounts to half points)
+   */
+  minimumUnit?: number;
+}
+
+/**
+ * Point Program Implementation
+ */
+export class PointProgram<S extends number = typeof DEFAULT_POINT_SCALE> {
+  readonly programId: string;
+  readonly scale: S;
+  readonly minimumUnit: number;
+
+  constructor(config: PointProgramConfig<S>) {
+    assertValidScale(config.scale);
+
+    const minimumUnit = config.minimumUnit ?? 1;
+    if (!Number.isSafeInteger(minimumUnit) || minimumUnit < 1) {
+      throw new Error(`minimumUnit must be a positive integer: ${minimumUnit}`);
+    }
+
+    this.programId = config.programId;
+    this.scale = config.scale;
+    this.minimumUnit = minimumUnit;
+    Object.freeze(this);
+  }
+
+  /**
+   * Parse a decimal point amount into program units
+   *
+   * @throws InvalidPointAmountError if it has too many decimal places or is
+   * not a multiple of the minimum unit
+   */
+  fromDecimal(value: string): ScaledPoints<S> {
+    return this.validate(fromDecimal(value, this.scale));
+  }
+
+  /**
+   * Render program units as a minimal decimal string
+   */
+  toDecimal(units: ScaledPoints<S>): string {
+    return toDecimal(units, this.scale);
+  }
+
+  /**
+   * Render program units for display
+   */
+  format(units: ScaledPoints<S>): string {
+    return formatPoints(units, this.scale);
+  }
+
+  /**
+   * Check that a raw unit amount is valid for this program
+   *
+   * @throws InvalidPointAmountError if it is not a safe integer or not a
+   * multiple of the minimum unit
+   */
+  validate(units: number): ScaledPoints<S> {
+    if (!Number.isSafeInteger(units)) {
+      throw new InvalidPointAmountError(units, 'units must be a safe integer');
+    }
+
+    if (units % this.minimumUnit !== 0) {
+      throw new InvalidPointAmountError(
+        units,
+        `not a multiple of the minimum unit ${this.minimumUnit} for program ${this.programId}`
+      );
+    }
+
+    return units as ScaledPoints<S>;
+  }
+
+  /**
+   * Sum amounts of this program
+   */
+  add(...amounts: ScaledPoints<S>[]): ScaledPoints<S> {
+    const total = amounts.reduce((sum, amount) => sum + BigInt(amount), 0n);
+    return toSafeNumber(total) as ScaledPoints<S>;
+  }
+
+  /**
+   * Compute the points earned for a base amount at a per-unit rate
+   * The exact product is rounded half-to-even once, to the nearest
+   * multiple of the minimum unit.
+   *
+   * @example new PointProgram({ programId: 'p', scale: 3 }).earn('12.34', '2.5') === 30850
+   * @param base Decimal base amount (e.g. dollars spent)
+   * @param rate Decimal points per unit of base
+   * @throws InvalidPointAmountError if either value is negative or malformed
+   */
+  earn(base: string, rate: string): ScaledPoints<S> {
+    const parsedBase = parseDecimal(base);
+    const parsedRate = parseDecimal(rate);
+
+    if (parsedBase.mantissa < 0n) {
+      throw new InvalidPointAmountError(base, 'earn base must not be negative');
+    }
+
+    if (parsedRate.mantissa < 0n) {
+      throw new InvalidPointAmountError(rate, 'earn rate must not be negative');
+    }
+
+    // base * rate * 10^scale / minimumUnit, kept exact until the final division
+    const numerator = parsedBase.mantissa * parsedRate.mantissa * 10n ** BigInt(this.scale);
+    const denominator =
+      10n ** BigInt(parsedBase.places + parsedRate.places) * BigInt(this.minimumUnit);
+
+    const steps = divideRoundHalfEven(numerator, denominator);
+    return toSafeNumber(steps * BigInt(this.minimumUnit), `${base} * ${rate}`) as ScaledPoints<S>;
+  }
+}
+
+/**
+ * Factory function to create a point program
+ * The scale's literal type is preserved so amounts from programs at
+ * different scales cannot be mixed.
+ */
+export function createPointProgram<S extends number>(config: PointProgramConfig<S>): PointProgram<S> {
+  return new PointProgram(config);
+}
@@ -0,0 +1,7 @@
+/**
+ * External Reconciliation Module Exports
+ */
+
+export { matchExternalRecords } from './matcher';
+export { reconcileAgainst } from './streaming';
+export * from './types';
@@ -0,0 +1,138 @@
+/**
+ * External Reconciliation Matcher Tests
+ */
+
+import { matchExternalRecords } from './matcher';
+import { ExternalRecord, MatchOptions } from './types';
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+
+describe('matchExternalRecords', () => {
+  let ledger: LedgerEntry[];
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  const entry = (entryId: string, correlationId: string, amount: number, timestamp: string): LedgerEntry => ({
+    entryId,
+    correlationId,
+    accountId: 'user-123',
+    amount,
+    timestamp: new Date(timestamp),
+  } as LedgerEntry);
+
+  const record = (externalId: string, reference: string, amount: number, timestamp: string): ExternalRecord => ({
+    externalId,
+    reference,
+    amount,
+    timestamp: new Date(timestamp),
+  });
+
+  const options: MatchOptions = {
+    startDate: new Date('2024-05-01T00:00:00Z'),
+    endDate: new Date('2024-05-01T23:59:59Z'),
+    timingToleranceHours: 2,
+    amountTolerance: 0,
+  };
+
+  beforeEach(() => {
+    ledger = [];
+    mockLedgerService = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn().mockImplementation(async (filter: any) => {
+        const inRange = ledger.filter(
+          e => e.timestamp >= filter.startDate && e.timestamp <= filter.endDate
+        );
+        return {
+          entries: inRange.slice(filter.offset, filter.offset + filter.limit),
+          totalCount: inRange.length,
+          offset: filter.offset,
+          limit: filter.limit,
+          hasMore: filter.offset + filter.limit < inRange.length,
+        };
+      }),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+  });
+
+  it('should classify matched, unmatched and mismatched records', async () => {
+    ledger = [
+      entry('e1', 'pay-1', -100, '2024-05-01T10:00:00Z'),
+      entry('e2', 'pay-2', -50, '2024-05-01T11:00:00Z'),
+      entry('e3', 'pay-3', -75, '2024-05-01T12:00:00Z'),
+    ];
+    const records = [
+      record('x1', 'pay-1', 100, '2024-05-01T11:30:00Z'),
+      record('x2', 'pay-2', 55, '2024-05-01T11:00:00Z'),
+      record('x4', 'pay-4', 20, '2024-05-01T13:00:00Z'),
+    ];
+
+    const report = await matchExternalRecords(mockLedgerService, records, options);
+
+    expect(report.matched.map(m => [m.entry.entryId, m.record.externalId])).toEqual([['e1', 'x1']]);
+    expect(report.amountMismatches).toHaveLength(1);
+    expect(report.amountMismatches[0].difference).toBe(5);
+    expect(report.unmatchedEntries.map(e => e.entryId)).toEqual(['e3']);
+    expect(report.unmatchedRecords.map(r => r.externalId)).toEqual(['x4']);
+    expect(report.summary).toEqual({
+      matched: 1,
+      unmatchedEntries: 1,
+      unmatchedRecords: 1,
+      amountMismatches: 1,
+    });
+  });
+
+  it('should not match entries outside the timing tolerance', async () => {
+    ledger = [entry('e1', 'pay-1', -100, '2024-05-01T06:00:00Z')];
+    const records = [record('x1', 'pay-1', 100, '2024-05-01T09:00:00Z')];
+
+    const report = await matchExternalRecords(mockLedgerService, records, options);
+
+    expect(report.matched).toHaveLength(0);
+    expect(report.unmatchedEntries).toHaveLength(1);
+    expect(report.unmatchedRecords).toHaveLength(1);
+  });
+
+  it('should match entries in the tolerance margin outside the period', async () => {
+    ledger = [entry('e1', 'pay-1', -100, '2024-04-30T23:00:00Z')];
+    const records = [record('x1', 'pay-1', 100, '2024-05-01T00:30:00Z')];
+
+    const report = await matchExternalRecords(mockLedgerService, records, options);
+
+    expect(report.matched).toHaveLength(1);
+  });
+
+  it('should pair duplicate references deterministically regardless of input order', async () => {
+    ledger = [
+      entry('e2', 'pay-1', -100, '2024-05-01T10:05:00Z'),
+      entry('e1', 'pay-1', -100, '2024-05-01T10:00:00Z'),
+    ];
+    const records = [
+      record('x2', 'pay-1', 100, '2024-05-01T10:06:00Z'),
+      record('x1', 'pay-1', 100, '2024-05-01T10:01:00Z'),
+    ];
+
+    const forward = await matchExternalRecords(mockLedgerService, records, options);
+    const reversed = await matchExternalRecords(mockLedgerService, [...records].reverse(), options);
+
+    const pairs = (r: typeof forward) => r.matched.map(m => [m.entry.entryId, m.record.externalId]);
+    expect(pairs(forward)).toEqual([['e1', 'x1'], ['e2', 'x2']]);
+    expect(pairs(reversed)).toEqual(pairs(forward));
+  });
+
+  it('should produce a JSON-serializable report', async () => {
+    ledger = [entry('e1', 'pay-1', -100, '2024-05-01T10:00:00Z')];
+
+    const report = await matchExternalRecords(
+      mockLedgerService,
+      [record('x1', 'pay-1', 100, '2024-05-01T10:00:00Z')],
+      options
+    );
+
+    const roundTripped = JSON.parse(JSON.stringify(report));
+    expect(roundTripped.summary.matched).toBe(1);
+    expect(roundTripped.period.start).toBe('2024-05-01T00:00:00.000Z');
+  });
+});
@@ -0,0 +1,174 @@
+/**
+ * External Reconciliation Matcher
+ *
+ * Matches a processor settlement file against ledger entries by
+ * reference (the entry's correlationId) and amount. Ledger entries are
+ * read for the settlement period widened by the timing tolerance, so an
+ * entry may be up to timingToleranceHours before or after its record.
+ *
+ * Matching is deterministic when a reference appears more than once on
+ * either side: both sides are ordered by timestamp then ID, and each
+ * record pairs with the earliest unpaired entry within tolerance whose
+ * amount agrees, falling back to the earliest with a differing amount.
+ */
+
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import {
+  ExternalRecord,
+  MatchOptions,
+  MatchReport,
+  MatchedPair,
+  AmountMismatch,
+} from './types';
+
+const HOUR_MS = 3600000;
+
+/**
+ * Page size used when reading the ledger
+ */
+const PAGE_SIZE = 1000;
+
+/**
+ * Match external records against ledger entries
+ */
+export async function matchExternalRecords(
+  ledgerService: ILedgerService,
+  records: ExternalRecord[],
+  options: MatchOptions
+): Promise<MatchReport> {
+  if (options.startDate.getTime() > options.endDate.getTime()) {
+    throw new Error('startDate must not be after endDate');
+  }
+
+  if (options.timingToleranceHours < 0 || options.amountTolerance < 0) {
+    throw new Error('Tolerances must not be negative');
+  }
+
+  const toleranceMs = options.timingToleranceHours * HOUR_MS;
+  const entries = await loadEntries(ledgerService, options, toleranceMs);
+
+  const entriesByRef = groupBy(
+    entries.filter(entry => !!entry.correlationId).sort(compareEntries),
+    entry => entry.correlationId!
+  );
+  const sortedRecords = [...records].sort(compareRecords);
+
+  const paired = new Set<LedgerEntry>();
+  const matched: MatchedPair[] = [];
+  const amountMismatches: AmountMismatch[] = [];
+  const unmatchedRecords: ExternalRecord[] = [];
+
+  for (const record of sortedRecords) {
+    const candidates = (entriesByRef.get(record.reference) || []).filter(
+      entry =>
+        !paired.has(entry) &&
+        Math.abs(new Date(entry.timestamp).getTime() - new Date(record.timestamp).getTime()) <= toleranceMs
+    );
+
+    const exact = candidates.find(
+      entry => Math.abs(record.amount - Math.abs(entry.amount)) <= options.amountTolerance
+    );
+
+    if (exact) {
+      paired.add(exact);
+      matched.push({ reference: record.reference, entry: exact, record });
+    } else if (candidates.length > 0) {
+      const entry = candidates[0];
+      paired.add(entry);
+      amountMismatches.push({
+        reference: record.reference,
+        entry,
+        record,
+        difference: record.amount - Math.abs(entry.amount),
+      });
+    } else {
+      unmatchedRecords.push(record);
+    }
+  }
+
+  // Only entries inside the period proper are expected to have a record;
+  // those read in the tolerance margin belong to neighbouring files
+  const unmatchedEntries = entries
+    .filter(entry => {
+      const t = new Date(entry.timestamp).getTime();
+      return (
+        !paired.has(entry) &&
+        t >= options.startDate.getTime() &&
+        t <= options.endDate.getTime()
+      );
+    })
+    .sort(compareEntries);
+
+  return {
+    period: { start: options.startDate, end: options.endDate },
+    generatedAt: new Date(),
+    matched,
+    unmatchedEntries,
+    unmatchedRecords,
+    amountMismatches,
+    summary: {
+      matched: matched.length,
+      unmatchedEntries: unmatchedEntries.length,
+      unmatchedRecords: unmatchedRecords.length,
+      amountMismatches: amountMismatches.length,
+    },
+  };
+}
+
+/**
+ * Read every ledger entry in the period widened by the timing tolerance
+ */
+async function loadEntries(
+  ledgerService: ILedgerService,
+  options: MatchOptions,
+  toleranceMs: number
+): Promise<LedgerEntry[]> {
+  const entries: LedgerEntry[] = [];
+  let offset = 0;
+  let hasMore = true;
+
+  while (hasMore) {
+    const result = await ledgerService.queryEntries({
+      ...options.ledgerFilter,
+      startDate: new Date(options.startDate.getTime() - toleranceMs),
+      endDate: new Date(options.endDate.getTime() + toleranceMs),
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset,
+      limit: PAGE_SIZE,
+    });
+    entries.push(...result.entries);
+    offset += result.entries.length;
+    hasMore = result.hasMore && result.entries.length > 0;
+  }
+
+  return entries;
+}
+
+function compareEntries(a: LedgerEntry, b: LedgerEntry): number {
+  return (
+    new Date(a.timestamp).getTime() - new Date(b.timestamp).getTime() ||
+    a.entryId.localeCompare(b.entryId)
+  );
+}
+
+function compareRecords(a: ExternalRecord, b: ExternalRecord): number {
+  return (
+    new Date(a.timestamp).getTime() - new Date(b.timestamp).getTime() ||
+    a.externalId.localeCompare(b.externalId)
+  );
+}
+
+function groupBy<T>(items: T[], key: (item: T) => string): Map<string, T[]> {
+  const groups = new Map<string, T[]>();
+  for (const item of items) {
+    const k = key(item);
+    const group = groups.get(k);
+    if (group) {
+      group.push(item);
+    } else {
+      groups.set(k, [item]);
+    }
+  }
+  return groups;
+}
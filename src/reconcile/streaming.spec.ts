@@ -0,0 +1,112 @@
+/**
+ * Streaming Reconciliation Tests
+ */
+
+import { reconcileAgainst } from './streaming';
+import { ExternalReferenceAmount } from './types';
+import { ReferenceSum } from '../ledger/types';
+
+describe('reconcileAgainst', () => {
+  const ledgerWith = (sums: ReferenceSum[]) => ({
+    sumByReference: jest.fn().mockResolvedValue(sums),
+  });
+
+  async function* source(pairs: ExternalReferenceAmount[]): AsyncIterable<ExternalReferenceAmount> {
+    for (const pair of pairs) {
+      yield pair;
+    }
+  }
+
+  it('should match references whose totals agree', async () => {
+    const ledger = ledgerWith([
+      { reference: 'pay-1', total: -500, entryCount: 1 },
+      { reference: 'pay-2', total: 250, entryCount: 2 },
+    ]);
+
+    const report = await reconcileAgainst(
+      ledger,
+      source([
+        { reference: 'pay-1', amount: 500 },
+        { reference: 'pay-2', amount: 250 },
+      ])
+    );
+
+    expect(report.matched.map(m => m.reference)).toEqual(['pay-1', 'pay-2']);
+    expect(report.summary).toEqual({ matched: 2, ledgerOnly: 0, externalOnly: 0, amountMismatches: 0 });
+    expect(report.externalRecordsRead).toBe(2);
+  });
+
+  it('should report ledger-only and external-only references', async () => {
+    const ledger = ledgerWith([
+      { reference: 'pay-1', total: 100, entryCount: 1 },
+      { reference: 'pay-ledger', total: 75, entryCount: 1 },
+    ]);
+
+    const report = await reconcileAgainst(
+      ledger,
+      source([
+        { reference: 'pay-1', amount: 100 },
+        { reference: 'pay-external', amount: 40 },
+      ])
+    );
+
+    expect(report.ledgerOnly).toEqual([{ reference: 'pay-ledger', total: 75, entryCount: 1 }]);
+    expect(report.externalOnly).toEqual([{ reference: 'pay-external', amount: 40 }]);
+    expect(report.summary.matched).toBe(1);
+  });
+
+  it('should report divergent amounts with the difference', async () => {
+    const ledger = ledgerWith([{ reference: 'pay-1', total: -300, entryCount: 1 }]);
+
+    const report = await reconcileAgainst(ledger, source([{ reference: 'pay-1', amount: 320 }]));
+
+    expect(report.amountMismatches).toEqual([
+      { reference: 'pay-1', ledgerAmount: 300, externalAmount: 320, difference: 20 },
+    ]);
+    expect(report.matched).toHaveLength(0);
+  });
+
+  it('should sum repeated external references before comparing', async () => {
+    const ledger = ledgerWith([{ reference: 'pay-1', total: 300, entryCount: 2 }]);
+
+    const report = await reconcileAgainst(
+      ledger,
+      source([
+        { reference: 'pay-1', amount: 100 },
+        { reference: 'pay-1', amount: 200 },
+      ])
+    );
+
+    expect(report.matched).toEqual([{ reference: 'pay-1', ledgerAmount: 300, externalAmount: 300 }]);
+  });
+
+  it('should honour the amount tolerance', async () => {
+    const ledger = ledgerWith([{ reference: 'pay-1', total: 300, entryCount: 1 }]);
+
+    const report = await reconcileAgainst(ledger, source([{ reference: 'pay-1', amount: 301 }]), {
+      amountTolerance: 1,
+    });
+
+    expect(report.summary.matched).toBe(1);
+  });
+
+  it('should pass the ledger filter through to sumByReference', async () => {
+    const ledger = ledgerWith([]);
+    const ledgerFilter = { accountType: 'user' as const, startDate: new Date('2024-05-01') };
+
+    await reconcileAgainst(ledger, source([]), { ledgerFilter });
+
+    expect(ledger.sumByReference).toHaveBeenCalledWith(ledgerFilter);
+  });
+
+  it('should propagate errors from the external source', async () => {
+    const ledger = ledgerWith([]);
+
+    async function* failing(): AsyncIterable<ExternalReferenceAmount> {
+      yield { reference: 'pay-1', amount: 1 };
+      throw new Error('settlement file truncated');
+    }
+
+    await expect(reconcileAgainst(ledger, failing())).rejects.toThrow('settlement file truncated');
+  });
+});
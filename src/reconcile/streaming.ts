@@ -0,0 +1,97 @@
+/**
+ * Streaming Reconciliation by Reference
+ *
+ * Compares per-reference ledger totals against an external settlement
+ * source read one (reference, amount) pair at a time. Ledger totals come
+ * from a single sumByReference aggregation; the external source is never
+ * buffered, so memory is bounded by the number of ledger references
+ * rather than the size of the settlement file.
+ *
+ * External pairs sharing a reference are summed before comparison.
+ * Amounts are compared against the absolute ledger total, matching the
+ * unsigned amounts processors report.
+ */
+
+import { LedgerService } from '../ledger/ledger.service';
+import { ReferenceSum } from '../ledger/types';
+import {
+  ExternalReferenceAmount,
+  ReconcileAgainstOptions,
+  ReconcileReport,
+  ReferenceMatch,
+  ReferenceMismatch,
+} from './types';
+
+/**
+ * Reconcile ledger reference totals against a streamed external source
+ *
+ * @param ledgerService Ledger to sum by reference
+ * @param external Async iterable of external (reference, amount) pairs
+ * @param options Ledger filter and amount tolerance
+ * @throws Whatever the external source throws while being read
+ */
+export async function reconcileAgainst(
+  ledgerService: Pick<LedgerService, 'sumByReference'>,
+  external: AsyncIterable<ExternalReferenceAmount>,
+  options: ReconcileAgainstOptions = {}
+): Promise<ReconcileReport> {
+  const amountTolerance = options.amountTolerance ?? 0;
+  if (amountTolerance < 0) {
+    throw new Error('amountTolerance must not be negative');
+  }
+
+  const sums = await ledgerService.sumByReference(options.ledgerFilter);
+  const ledgerByRef = new Map<string, ReferenceSum>(sums.map(sum => [sum.reference, sum]));
+  const externalTotals = new Map<string, number>();
+  const externalOnly: ExternalReferenceAmount[] = [];
+  let externalRecordsRead = 0;
+
+  for await (const { reference, amount } of external) {
+    externalRecordsRead++;
+
+    if (!Number.isFinite(amount)) {
+      throw new Error(`Invalid external amount for reference ${reference}: ${amount}`);
+    }
+
+    if (ledgerByRef.has(reference)) {
+      externalTotals.set(reference, (externalTotals.get(reference) ?? 0) + amount);
+    } else {
+      externalOnly.push({ reference, amount });
+    }
+  }
+
+  const matched: ReferenceMatch[] = [];
+  const amountMismatches: ReferenceMismatch[] = [];
+  const ledgerOnly: ReferenceSum[] = [];
+
+  for (const sum of sums) {
+    const externalAmount = externalTotals.get(sum.reference);
+    if (externalAmount === undefined) {
+      ledgerOnly.push(sum);
+      continue;
+    }
+
+    const ledgerAmount = Math.abs(sum.total);
+    const difference = externalAmount - ledgerAmount;
+    if (Math.abs(difference) <= amountTolerance) {
+      matched.push({ reference: sum.reference, ledgerAmount, externalAmount });
+    } else {
+      amountMismatches.push({ reference: sum.reference, ledgerAmount, externalAmount, difference });
+    }
+  }
+
+  return {
+    generatedAt: new Date(),
+    externalRecordsRead,
+    matched,
+    ledgerOnly,
+    externalOnly,
+    amountMismatches,
+    summary: {
+      matched: matched.length,
+      ledgerOnly: ledgerOnly.length,
+      externalOnly: externalOnly.length,
+      amountMismatches: amountMismatches.length,
+    },
+  };
+}
@@ -0,0 +1,153 @@
+/**
+ * External Reconciliation Types
+ */
+
+import { LedgerEntry, LedgerQueryFilter, ReferenceSum, ReferenceSumFilter } from '../ledger/types';
+
+/**
+ * A settlement record received from an external processor
+ */
+export interface ExternalRecord {
+  /** Processor's own record identifier */
+  externalId: string;
+
+  /** Reference shared with the ledger (matched against correlationId) */
+  reference: string;
+
+  /** Settled amount (unsigned) */
+  amount: number;
+
+  /** When the processor recorded the settlement */
+  timestamp: Date;
+}
+
+/**
+ * Options for matching external records against the ledger
+ */
+export interface MatchOptions {
+  /** Start of the settlement period (inclusive) */
+  startDate: Date;
+
+  /** End of the settlement period (inclusive) */
+  endDate: Date;
+
+  /** How far a ledger entry may precede or follow its record */
+  timingToleranceHours: number;
+
+  /** Largest amount difference still treated as a match */
+  amountTolerance: number;
+
+  /** Additional ledger filters (e.g. reason or featureType) */
+  ledgerFilter?: Omit<LedgerQueryFilter, 'startDate' | 'endDate' | 'offset' | 'limit'>;
+}
+
+/**
+ * A ledger entry and external record that reconciled
+ */
+export interface MatchedPair {
+  reference: string;
+  entry: LedgerEntry;
+  record: ExternalRecord;
+}
+
+/**
+ * A ledger entry and external record sharing a reference but not an amount
+ */
+export interface AmountMismatch extends MatchedPair {
+  /** Record amount minus absolute ledger amount */
+  difference: number;
+}
+
+/**
+ * Outcome of a reconciliation run, safe to serialize for finance
+ */
+export interface MatchReport {
+  /** Settlement period covered */
+  period: { start: Date; end: Date };
+
+  /** Report generation timestamp */
+  generatedAt: Date;
+
+  matched: MatchedPair[];
+
+  /** Ledger entries in the period with no external record */
+  unmatchedEntries: LedgerEntry[];
+
+  /** External records with no ledger entry */
+  unmatchedRecords: ExternalRecord[];
+
+  amountMismatches: AmountMismatch[];
+
+  summary: {
+    matched: number;
+    unmatchedEntries: number;
+    unmatchedRecords: number;
+    amountMismatches: number;
+  };
+}
+
+/**
+ * One (reference, amount) pair read from an external settlement source
+ */
+export interface ExternalReferenceAmount {
+  reference: string;
+
+  /** Settled amount (unsigned) */
+  amount: number;
+}
+
+/**
+ * Options for streaming reconciliation by reference
+ */
+export interface ReconcileAgainstOptions {
+  /** Ledger entries to sum (defaults to the whole ledger) */
+  ledgerFilter?: ReferenceSumFilter;
+
+  /** Largest amount difference still treated as a match */
+  amountTolerance?: number;
+}
+
+/**
+ * A reference whose ledger and external totals agree
+ */
+export interface ReferenceMatch {
+  reference: string;
+  ledgerAmount: number;
+  externalAmount: number;
+}
+
+/**
+ * A reference present on both sides with differing totals
+ */
+export interface ReferenceMismatch extends ReferenceMatch {
+  /** External amount minus absolute ledger amount */
+  difference: number;
+}
+
+/**
+ * Outcome of a streaming reconciliation by reference
+ */
+export interface ReconcileReport {
+  /** Report generation timestamp */
+  generatedAt: Date;
+
+  /** External pairs read from the source */
+  externalRecordsRead: number;
+
+  matched: ReferenceMatch[];
+
+  /** References in the ledger never seen externally */
+  ledgerOnly: ReferenceSum[];
+
+  /** External pairs whose reference is not in the ledger */
+  externalOnly: ExternalReferenceAmount[];
+
+  amountMismatches: ReferenceMismatch[];
+
+  summary: {
+    matched: number;
+    ledgerOnly: number;
+    externalOnly: number;
+    amountMismatches: number;
+  };
+}
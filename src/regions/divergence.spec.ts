@@ -0,0 +1,182 @@
+/**
+ * Region Divergence Tests
+ */
+
+import { detectDivergence, reconcileRegions } from './divergence';
+import { InMemoryRegionLedger } from './region-ledger';
+import { CreateLedgerEntryRequest } from '../ledger/types';
+import { MetricsLogger, AlertSeverity } from '../metrics';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('region divergence', () => {
+  const since = new Date('2024-06-01T00:00:00Z');
+  let east: InMemoryRegionLedger;
+  let west: InMemoryRegionLedger;
+
+  const request = (key: string, overrides: Partial<CreateLedgerEntryRequest> = {}): CreateLedgerEntryRequest => ({
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: key,
+    requestId: `req-${key}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+    ...overrides,
+  });
+
+  const appendAt = async (region: InMemoryRegionLedger, iso: string, r: CreateLedgerEntryRequest) => {
+    jest.setSystemTime(new Date(iso));
+    return region.append(r);
+  };
+
+  // Append in one region, then replicate the same payload to the other
+  const replicated = async (key: string, iso: string, lagIso: string = iso) => {
+    const entry = await appendAt(east, iso, request(key));
+    await appendAt(west, lagIso, request(key, { transactionId: entry.transactionId }));
+  };
+
+  beforeEach(() => {
+    jest.useFakeTimers();
+    jest.spyOn(MetricsLogger, 'logAlert').mockImplementation(() => undefined);
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    east = new InMemoryRegionLedger('us-east');
+    west = new InMemoryRegionLedger('us-west');
+  });
+
+  afterEach(() => {
+    jest.useRealTimers();
+    jest.restoreAllMocks();
+  });
+
+  it('matches entries replicated with equal payloads', async () => {
+    await replicated('k1', '2024-06-02T00:00:00Z');
+    await replicated('k2', '2024-06-03T00:00:00Z', '2024-06-03T00:00:05Z');
+
+    const report = await detectDivergence(east, west, since);
+
+    expect(report).toMatchObject({
+      regions: ['us-east', 'us-west'],
+      matched: 2,
+      conflicts: [],
+      unreplicated: [],
+      unreplicatedCount: 0,
+      truncated: false,
+    });
+    expect(MetricsLogger.logAlert).not.toHaveBeenCalled();
+  });
+
+  it('reports entries not yet replicated as lag, by region', async () => {
+    await replicated('k1', '2024-06-02T00:00:00Z');
+    await appendAt(east, '2024-06-04T00:00:00Z', request('only-east'));
+    await appendAt(west, '2024-06-03T00:00:00Z', request('only-west'));
+
+    const report = await detectDivergence(east, west, since);
+
+    expect(report.conflicts).toEqual([]);
+    expect(report.unreplicated.map(u => [u.region, u.idempotencyKey])).toEqual([
+      ['us-east', 'only-east'],
+      ['us-west', 'only-west'],
+    ]);
+    expect(report.oldestUnreplicated).toEqual(new Date('2024-06-03T00:00:00Z'));
+  });
+
+  it('reports the same key with differing payloads as a conflict and alerts', async () => {
+    await appendAt(east, '2024-06-02T00:00:00Z', request('k1'));
+    await appendAt(west, '2024-06-02T00:00:00Z', request('k1', { amount: 250, balanceAfter: 250 }));
+
+    const report = await detectDivergence(east, west, since);
+
+    expect(report.conflicts).toHaveLength(1);
+    expect(report.conflicts[0]).toMatchObject({ idempotencyKey: 'k1', fields: ['transactionId', 'amount', 'balanceAfter'] });
+    expect(Object.keys(report.conflicts[0].entryIds)).toEqual(['us-east', 'us-west']);
+    expect(report.unreplicatedCount).toBe(0);
+    expect(MetricsLogger.logAlert).toHaveBeenCalledWith(expect.objectContaining({ severity: AlertSeverity.CRITICAL }));
+  });
+
+  it('finds a copy that was appended before the cutoff in the other region', async () => {
+    await appendAt(west, '2024-05-31T23:59:00Z', request('k1'));
+    const original = await west.findByKeys(['k1']);
+    await appendAt(east, '2024-06-01T00:01:00Z', request('k1', { transactionId: original[0].transactionId }));
+
+    const report = await detectDivergence(east, west, since);
+
+    expect(report).toMatchObject({ matched: 1, unreplicatedCount: 0, conflicts: [] });
+  });
+
+  it('compares each pair once when both copies fall in the window', async () => {
+    await appendAt(east, '2024-06-02T00:00:00Z', request('k1'));
+    await appendAt(west, '2024-06-02T00:00:00Z', request('k1', { amount: 250, balanceAfter: 250 }));
+    await replicated('k2', '2024-06-02T00:00:00Z');
+
+    const report = await detectDivergence(east, west, since);
+
+    expect(report.conflicts).toHaveLength(1);
+    expect(report.matched).toBe(1);
+  });
+
+  it('reconciles by copying unreplicated entries both ways, idempotently', async () => {
+    await replicated('k1', '2024-06-02T00:00:00Z');
+    await appendAt(east, '2024-06-04T00:00:00Z', request('only-east', { metadata: { committedBy: 'svc:earn' } }));
+    await appendAt(west, '2024-06-03T00:00:00Z', request('only-west'));
+
+    const reconciled = await reconcileRegions(east, west, since);
+    expect(reconciled.copied).toBe(2);
+    expect(east.size).toBe(3);
+    expect(west.size).toBe(3);
+
+    const after = await detectDivergence(east, west, since);
+    expect(after).toMatchObject({ matched: 3, unreplicatedCount: 0, conflicts: [] });
+
+    const again = await reconcileRegions(east, west, since);
+    expect(again.copied).toBe(0);
+  });
+
+  it('leaves conflicts in place when reconciling', async () => {
+    await appendAt(east, '2024-06-02T00:00:00Z', request('k1'));
+    await appendAt(west, '2024-06-02T00:00:00Z', request('k1', { amount: 250, balanceAfter: 250 }));
+
+    const report = await reconcileRegions(east, west, since);
+
+    expect(report.copied).toBe(0);
+    expect(report.conflicts).toHaveLength(1);
+    expect((await west.findByKeys(['k1']))[0].amount).toBe(250);
+  });
+
+  it('streams both regions a page at a time', async () => {
+    for (let i = 0; i < 7; i++) {
+      await replicated(`k${i}`, '2024-06-02T00:00:00Z');
+    }
+    const scan = jest.spyOn(east, 'scanByKey');
+    const lookups = jest.spyOn(west, 'findByKeys');
+
+    const report = await detectDivergence(east, west, since, { pageSize: 3 });
+
+    expect(report.matched).toBe(7);
+    expect(scan.mock.calls.map(([, afterKey, limit]) => [afterKey, limit])).toEqual([
+      [undefined, 3],
+      ['k2', 3],
+      ['k5', 3],
+    ]);
+    expect(lookups.mock.calls.every(([keys]) => keys.length <= 3)).toBe(true);
+  });
+
+  it('caps the reported lists and flags truncation', async () => {
+    for (let i = 0; i < 5; i++) {
+      await appendAt(east, '2024-06-02T00:00:00Z', request(`k${i}`));
+    }
+
+    const report = await detectDivergence(east, west, since, { maxReported: 2 });
+
+    expect(report.unreplicated).toHaveLength(2);
+    expect(report.unreplicatedCount).toBe(5);
+    expect(report.truncated).toBe(true);
+  });
+
+  it('refuses to compare a region with itself', async () => {
+    await expect(detectDivergence(east, new InMemoryRegionLedger('us-east'), since)).rejects.toThrow('itself');
+  });
+});
@@ -0,0 +1,7 @@
+/**
+ * Multi-Region Module Exports
+ */
+
+export { detectDivergence, reconcileRegions, DivergenceOptions } from './divergence';
+export { MongoRegionLedger, InMemoryRegionLedger } from './region-ledger';
+export * from './types';
@@ -0,0 +1,53 @@
+/**
+ * Region Ledger Tests
+ */
+
+import { MongoRegionLedger } from './region-ledger';
+import { ILedgerService } from '../ledger/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+
+jest.mock('../db/models/ledger-entry.model');
+
+describe('MongoRegionLedger', () => {
+  let inner: jest.Mocked<ILedgerService>;
+  let region: MongoRegionLedger;
+
+  const chain = (rows: any[]) => ({
+    sort: jest.fn().mockReturnThis(),
+    limit: jest.fn().mockReturnThis(),
+    lean: jest.fn().mockReturnThis(),
+    exec: jest.fn().mockResolvedValue(rows),
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    inner = { createEntry: jest.fn() } as any;
+    region = new MongoRegionLedger('eu-west', inner);
+  });
+
+  it('scans by idempotency key after a key and cutoff', async () => {
+    const query = chain([{ _id: 'oid', __v: 0, entryId: 'e1', idempotencyKey: 'k2' }]);
+    (LedgerEntryModel.find as jest.Mock).mockReturnValue(query);
+    const since = new Date('2024-06-01T00:00:00Z');
+
+    const entries = await region.scanByKey(since, 'k1', 50);
+
+    expect(LedgerEntryModel.find).toHaveBeenCalledWith({ timestamp: { $gte: since }, idempotencyKey: { $gt: 'k1' } });
+    expect(query.sort).toHaveBeenCalledWith({ idempotencyKey: 1 });
+    expect(query.limit).toHaveBeenCalledWith(50);
+    expect(entries).toEqual([{ entryId: 'e1', idempotencyKey: 'k2' }]);
+  });
+
+  it('looks entries up by key and appends through the region ledger', async () => {
+    (LedgerEntryModel.find as jest.Mock).mockReturnValue(chain([]));
+
+    await expect(region.findByKeys([])).resolves.toEqual([]);
+    expect(LedgerEntryModel.find).not.toHaveBeenCalled();
+
+    await region.findByKeys(['k1', 'k2']);
+    expect(LedgerEntryModel.find).toHaveBeenCalledWith({ idempotencyKey: { $in: ['k1', 'k2'] } });
+
+    await region.append({ idempotencyKey: 'k1' } as any);
+    expect(inner.createEntry).toHaveBeenCalledWith({ idempotencyKey: 'k1' });
+  });
+});
@@ -0,0 +1,108 @@
+/**
+ * Region Ledgers
+ *
+ * IRegionLedger implementations. MongoRegionLedger reads a region's
+ * ledger collection directly, so the model must be bound to that
+ * region's connection, and appends through the region's ledger service.
+ * InMemoryRegionLedger is a process-local region for development and
+ * tests.
+ */
+
+import { Model } from 'mongoose';
+import { v4 as uuidv4 } from 'uuid';
+import { CreateLedgerEntryRequest, ILedgerService, LedgerEntry } from '../ledger/types';
+import { LedgerEntryModel, ILedgerEntry } from '../db/models/ledger-entry.model';
+import { IRegionLedger } from './types';
+
+export class MongoRegionLedger implements IRegionLedger {
+  readonly region: string;
+  private ledger: ILedgerService;
+  private model: Model<ILedgerEntry>;
+
+  constructor(region: string, ledger: ILedgerService, model: Model<ILedgerEntry> = LedgerEntryModel) {
+    this.region = region;
+    this.ledger = ledger;
+    this.model = model;
+  }
+
+  async scanByKey(since: Date, afterKey: string | undefined, limit: number): Promise<LedgerEntry[]> {
+    const query: Record<string, any> = { timestamp: { $gte: since } };
+    if (afterKey !== undefined) {
+      query.idempotencyKey = { $gt: afterKey };
+    }
+
+    const docs = await this.model.find(query).sort({ idempotencyKey: 1 }).limit(limit).lean().exec();
+    return docs.map(toEntry);
+  }
+
+  async findByKeys(keys: string[]): Promise<LedgerEntry[]> {
+    if (keys.length === 0) {
+      return [];
+    }
+
+    const docs = await this.model.find({ idempotencyKey: { $in: keys } }).lean().exec();
+    return docs.map(toEntry);
+  }
+
+  async append(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    return this.ledger.createEntry(request);
+  }
+}
+
+export class InMemoryRegionLedger implements IRegionLedger {
+  readonly region: string;
+  private entries: Map<string, LedgerEntry> = new Map();
+
+  constructor(region: string) {
+    this.region = region;
+  }
+
+  async scanByKey(since: Date, afterKey: string | undefined, limit: number): Promise<LedgerEntry[]> {
+    return [...this.entries.values()]
+      .filter(entry => entry.timestamp >= since && (afterKey === undefined || entry.idempotencyKey > afterKey))
+      .sort((a, b) => (a.idempotencyKey < b.idempotencyKey ? -1 : 1))
+      .slice(0, limit)
+      .map(entry => structuredClone(entry));
+  }
+
+  async findByKeys(keys: string[]): Promise<LedgerEntry[]> {
+    return keys
+      .filter(key => this.entries.has(key))
+      .map(key => structuredClone(this.entries.get(key)!));
+  }
+
+  async append(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    const existing = this.entries.get(request.idempotencyKey);
+    if (existing) {
+      return structuredClone(existing);
+    }
+
+    const entry: LedgerEntry = {
+      ...structuredClone(request),
+      entryId: `${this.region}:${uuidv4()}`,
+      transactionId: request.transactionId || `${this.region}:${uuidv4()}`,
+      timestamp: new Date(),
+      currency: request.currency || 'points',
+    };
+    this.entries.set(entry.idempotencyKey, entry);
+    return structuredClone(entry);
+  }
+
+  /**
+   * Number of entries in the region
+   */
+  get size(): number {
+    return this.entries.size;
+  }
+}
+
+/**
+ * Strip storage-only fields from a ledger document
+ */
+function toEntry(doc: any): LedgerEntry {
+  const entry = { ...doc };
+  delete entry._id;
+  delete entry.__v;
+  delete entry.indexedTags;
+  return entry;
+}
@@ -0,0 +1,87 @@
+/**
+ * Multi-Region Types
+ */
+
+import { CreateLedgerEntryRequest, LedgerEntry } from '../ledger/types';
+
+/**
+ * One region's ledger, as seen by divergence detection and reconciliation
+ * An append is identified across regions by its idempotency key: a
+ * replicated entry keeps the key but gets the target region's entry ID.
+ */
+export interface IRegionLedger {
+  /** Region name */
+  readonly region: string;
+
+  /**
+   * Entries timestamped at or after since whose idempotency key sorts
+   * after afterKey, in idempotency key order
+   */
+  scanByKey(since: Date, afterKey: string | undefined, limit: number): Promise<LedgerEntry[]>;
+
+  /**
+   * Entries with the given idempotency keys, at any timestamp
+   */
+  findByKeys(keys: string[]): Promise<LedgerEntry[]>;
+
+  /**
+   * Append an entry; an idempotency key already present replays the
+   * existing entry
+   */
+  append(request: CreateLedgerEntryRequest): Promise<LedgerEntry>;
+}
+
+/**
+ * Entry appended in both regions with differing payloads
+ */
+export interface DivergenceConflict {
+  idempotencyKey: string;
+
+  /** Entry ID in each region */
+  entryIds: Record<string, string>;
+
+  /** Payload fields whose values differ */
+  fields: string[];
+}
+
+/**
+ * Entry present in one region only, usually replication lag
+ */
+export interface UnreplicatedEntry {
+  idempotencyKey: string;
+  entryId: string;
+
+  /** Region holding the entry */
+  region: string;
+
+  timestamp: Date;
+}
+
+/**
+ * Result of comparing two regions
+ */
+export interface DivergenceReport {
+  regions: [string, string];
+  since: Date;
+
+  /** Entries compared in both regions */
+  matched: number;
+
+  /** True conflicts; any conflict is a serious fault */
+  conflicts: DivergenceConflict[];
+
+  /** Entries not yet replicated to the other region (benign lag) */
+  unreplicated: UnreplicatedEntry[];
+
+  /** Unreplicated entries counted, including any beyond the reported list */
+  unreplicatedCount: number;
+
+  /** Timestamp of the oldest unreplicated entry, a measure of the lag */
+  oldestUnreplicated?: Date;
+
+  /** Whether any list was cut at maxReported */
+  truncated: boolean;
+
+  /** Entries copied across by reconcileRegions */
+  copied: number;
+}
@@ -0,0 +1,55 @@
+/**
+ * Hold-Aware Affordability Tests
+ */
+
+import { HoldAwareBalance } from './affordability';
+import { InvalidPointAmountError } from '../services/types';
+
+describe('HoldAwareBalance', () => {
+  const balances = (available: number, holds: number[]) => {
+    const calls: string[] = [];
+    const ledger = {
+      getBalanceSnapshot: jest.fn().mockImplementation(async () => {
+        calls.push('balance');
+        return { accountId: 'user-1', availableBalance: available };
+      }),
+    };
+    const reservations = {
+      getUserReservations: jest.fn().mockImplementation(async () => {
+        calls.push('holds');
+        return holds.map((amount, i) => ({ reservationId: `res-${i}`, amount }));
+      }),
+    };
+    return { balance: new HoldAwareBalance(ledger as any, reservations as any), calls };
+  };
+
+  it('should allow a redemption covered by the balance with no holds', async () => {
+    await expect(balances(500, []).balance.canRedeem('user-1', 500)).resolves.toEqual({ canRedeem: true, available: 500 });
+  });
+
+  it('should refuse a redemption the committed balance covers but active holds block', async () => {
+    await expect(balances(500, [200, 150]).balance.canRedeem('user-1', 200)).resolves.toEqual({
+      canRedeem: false,
+      available: 150,
+    });
+  });
+
+  it('should allow a redemption covered after holds', async () => {
+    await expect(balances(500, [200]).balance.canRedeem('user-1', 300)).resolves.toEqual({ canRedeem: true, available: 300 });
+  });
+
+  it('should read the holds before the balance', async () => {
+    const { balance, calls } = balances(500, [200]);
+
+    await balance.availableBalance('user-1');
+
+    expect(calls).toEqual(['holds', 'balance']);
+  });
+
+  it('should reject a non-positive or fractional amount', async () => {
+    const { balance } = balances(500, []);
+
+    await expect(balance.canRedeem('user-1', 0)).rejects.toThrow(InvalidPointAmountError);
+    await expect(balance.canRedeem('user-1', 1.5)).rejects.toThrow(InvalidPointAmountError);
+  });
+});
@@ -0,0 +1,66 @@
+/**
+ * Hold-Aware Affordability
+ *
+ * The single answer to "can this redemption proceed right now": the
+ * ledger's available balance less the user's active points reservations
+ * (holds) must cover the amount. Escrow holds need no adjustment; they
+ * have already moved points out of the available balance.
+ *
+ * The holds are read before the balance. A hold confirmed between the
+ * two reads is then counted both as a hold and as its ledger debit, so
+ * a race can only understate what the user can spend, never overstate it.
+ */
+
+import { ReservationService } from './service';
+import { LedgerService } from '../ledger/ledger.service';
+import { InvalidPointAmountError } from '../services/types';
+
+/**
+ * Outcome of an affordability check
+ */
+export interface RedeemCheck {
+  canRedeem: boolean;
+
+  /** Available balance less active holds */
+  available: number;
+}
+
+/**
+ * Balance reader that accounts for active holds
+ */
+export class HoldAwareBalance {
+  private ledgerService: Pick<LedgerService, 'getBalanceSnapshot'>;
+  private reservations: Pick<ReservationService, 'getUserReservations'>;
+
+  constructor(
+    ledgerService: Pick<LedgerService, 'getBalanceSnapshot'>,
+    reservations: Pick<ReservationService, 'getUserReservations'>
+  ) {
+    this.ledgerService = ledgerService;
+    this.reservations = reservations;
+  }
+
+  /**
+   * Available balance less the user's active holds
+   */
+  async availableBalance(userId: string): Promise<number> {
+    const holds = await this.reservations.getUserReservations(userId);
+    const snapshot = await this.ledgerService.getBalanceSnapshot(userId, 'user');
+
+    return holds.reduce((available, hold) => available - hold.amount, snapshot.availableBalance);
+  }
+
+  /**
+   * Whether the user can redeem an amount now, and the balance it was checked against
+   *
+   * @throws InvalidPointAmountError if the amount is not a positive integer
+   */
+  async canRedeem(userId: string, amount: number): Promise<RedeemCheck> {
+    if (!Number.isInteger(amount) || amount <= 0) {
+      throw new InvalidPointAmountError(amount, 'must be a positive integer');
+    }
+
+    const available = await this.availableBalance(userId);
+    return { canRedeem: available >= amount, available };
+  }
+}
@@ -0,0 +1,488 @@
+/**
+ * Gift Service Tests
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { Gift, GiftService } from './gift';
+import { GiftEventModel } from '../db/models/gift-event.model';
+import { GiftMonthlyCounterModel } from '../db/models/gift-monthly-counter.model';
+import { ReservationStatus } from '../db/models/reservation.model';
+import { WalletModel } from '../db/models/wallet.model';
+import { applyWalletDelta, findWalletApplication } from '../wallets/wallet-application';
+import {
+  AccountFrozenError,
+  GiftLimitExceededError,
+  GiftNotPendingError,
+  InsufficientBalanceError,
+} from '../services/types';
+import { TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/gift-event.model');
+jest.mock('../db/models/gift-monthly-counter.model');
+jest.mock('../db/models/reservation.model');
+jest.mock('../db/models/wallet.model');
+jest.mock('../wallets/wallet-application');
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+const tick = () => new Promise(resolve => setImmediate(resolve));
+
+/**
+ * Evaluate the query operators the gift service uses against a document
+ */
+const matches = (doc: any, query: any): boolean =>
+  Object.entries(query).every(([field, condition]: [string, any]) => {
+    if (field === '$or') {
+      return condition.some((branch: any) => matches(doc, branch));
+    }
+    if (condition === null || typeof condition !== 'object' || condition instanceof Date) {
+      return doc[field] === condition;
+    }
+    const value = doc[field] instanceof Date ? doc[field].getTime() : doc[field];
+    const operand = (v: any) => (v instanceof Date ? v.getTime() : v);
+    return Object.entries(condition).every(([op, expected]: [string, any]) => {
+      switch (op) {
+        case '$eq':
+          return value === operand(expected);
+        case '$gt':
+          return value > operand(expected);
+        case '$gte':
+          return value >= operand(expected);
+        case '$lt':
+          return value < operand(expected);
+        case '$lte':
+          return value <= operand(expected);
+        case '$in':
+          return expected.includes(value);
+        default:
+          throw new Error(`Unsupported operator ${op}`);
+      }
+    });
+  });
+
+describe('GiftService', () => {
+  let events: any[];
+  let reservations: Map<string, any>;
+  let entries: any[];
+  let counters: any[];
+  let applied: Map<string, { userId: string; delta: number }>;
+  let balances: Record<string, number>;
+  let frozen: Set<string>;
+  let lookupDelay: number;
+  let mockReservations: any;
+  let mockLedgerService: any;
+  let service: GiftService;
+
+  const query = (run: (sort?: any, limit?: number) => any) => {
+    let sort: any;
+    let limit: number | undefined;
+    const chain: any = {
+      sort: jest.fn().mockImplementation((value: any) => {
+        sort = value;
+        return chain;
+      }),
+      limit: jest.fn().mockImplementation((value: number) => {
+        limit = value;
+        return chain;
+      }),
+      select: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => {
+        for (let i = 0; i < lookupDelay; i++) {
+          await tick();
+        }
+        return run(sort, limit);
+      }),
+    };
+    return chain;
+  };
+
+  // Status transitions are conditional on ACTIVE, like the reservation service's updates
+  const transition = (reservationId: string, status: ReservationStatus) => {
+    const reservation = reservations.get(reservationId);
+    if (!reservation || reservation.status !== ReservationStatus.ACTIVE) {
+      return null;
+    }
+    reservation.status = status;
+    return { ...reservation };
+  };
+
+  const stage = (giftId: string) => events.filter(e => e.giftId === giftId).map(e => e.kind);
+
+  // Net wallet move of a gift's sender debit and any return of it
+  const senderMoved = (giftId: string) =>
+    [...applied.entries()]
+      .filter(([key]) => key.startsWith(`gift-${giftId}-debit`))
+      .reduce((sum, [, application]) => sum + application.delta, 0);
+
+  const walletDelta = async (userId: string, delta: number, key: string) => {
+    if (applied.has(key)) {
+      return false;
+    }
+    applied.set(key, { userId, delta });
+    return true;
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    let n = 0;
+    (uuidv4 as jest.Mock).mockImplementation(() => `uuid-${++n}`);
+    events = [];
+    reservations = new Map();
+    entries = [];
+    counters = [];
+    applied = new Map();
+    balances = { 'user-a': 5000, 'user-b': 0 };
+    frozen = new Set();
+    lookupDelay = 0;
+
+    (GiftEventModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      await tick();
+      if (events.some(e => e.giftId === doc.giftId && e.sequence === doc.sequence)) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      events.push({ ...doc });
+      return doc;
+    });
+    (GiftEventModel.findOne as jest.Mock).mockImplementation((q: any) =>
+      query(() => {
+        const event = events.find(e => matches(e, q));
+        return event ? { ...event } : null;
+      })
+    );
+    (GiftEventModel.find as jest.Mock).mockImplementation((q: any) =>
+      query((sort, limit) => {
+        const found = events.filter(e => matches(e, q));
+        if (sort) {
+          found.sort((a, b) => a.expiresAt.getTime() - b.expiresAt.getTime() || (a.giftId < b.giftId ? -1 : 1));
+        }
+        return found.slice(0, limit ?? found.length).map(e => ({ ...e }));
+      })
+    );
+    const counterFor = (q: any) =>
+      counters.find(c => c.userId === q.userId.$eq && c.month.getTime() === q.month.$eq.getTime());
+    (GiftMonthlyCounterModel.findOne as jest.Mock).mockImplementation((q: any) =>
+      query(() => {
+        const counter = counterFor(q);
+        return counter ? { ...counter, giftIds: [...counter.giftIds] } : null;
+      })
+    );
+    (GiftMonthlyCounterModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      await tick();
+      if (counterFor({ userId: { $eq: doc.userId }, month: { $eq: doc.month } })) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      counters.push({ ...doc, giftIds: [...doc.giftIds] });
+      return doc;
+    });
+    // Conditional updates, applied atomically as MongoDB would
+    (GiftMonthlyCounterModel.updateOne as jest.Mock).mockImplementation(async (q: any, update: any) => {
+      await tick();
+      const counter = counterFor(q);
+      const matched =
+        counter &&
+        (q.giftIds.$ne === undefined || !counter.giftIds.includes(q.giftIds.$ne)) &&
+        (q.giftIds.$eq === undefined || counter.giftIds.includes(q.giftIds.$eq)) &&
+        (q.points === undefined || counter.points <= q.points.$lte);
+      if (!matched) {
+        return { modifiedCount: 0 };
+      }
+      counter.points += update.$inc.points;
+      if (update.$push) {
+        counter.giftIds.push(update.$push.giftIds);
+      } else {
+        counter.giftIds = counter.giftIds.filter((giftId: string) => giftId !== update.$pull.giftIds);
+      }
+      return { modifiedCount: 1 };
+    });
+    (applyWalletDelta as jest.Mock).mockImplementation(walletDelta);
+    (findWalletApplication as jest.Mock).mockImplementation(async (key: string) => applied.get(key) ?? null);
+    (WalletModel.find as jest.Mock).mockImplementation((q: any) =>
+      query(() => q.userId.$in.map((userId: string) => ({ userId, frozen: frozen.has(userId) })))
+    );
+
+    mockReservations = {
+      createReservation: jest.fn().mockImplementation(async (request: any) => {
+        const reservation = { ...request, status: ReservationStatus.ACTIVE };
+        reservations.set(request.reservationId, reservation);
+        return reservation;
+      }),
+      commitReservation: jest.fn().mockImplementation(async ({ reservationId }: any) =>
+        transition(reservationId, ReservationStatus.COMMITTED)
+      ),
+      releaseReservation: jest.fn().mockImplementation(async ({ reservationId }: any) =>
+        transition(reservationId, ReservationStatus.RELEASED)
+      ),
+      getUserReservations: jest.fn().mockImplementation(async (userId: string) =>
+        [...reservations.values()].filter(r => r.userId === userId && r.status === ReservationStatus.ACTIVE)
+      ),
+    };
+
+    mockLedgerService = {
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string) => ({
+        accountId,
+        availableBalance: balances[accountId] ?? 0,
+      })),
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        await tick();
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, timestamp: new Date(), ...request };
+        entries.push(entry);
+        balances[request.accountId] = request.balanceAfter;
+        return { entry, inserted: true };
+      }),
+    };
+
+    service = new GiftService(mockLedgerService, mockReservations, { monthlyLimit: 1000 });
+  });
+
+  it('should hold the sender\'s points and record a pending offer', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+
+    expect(gift).toMatchObject({ fromUserId: 'user-a', toUserId: 'user-b', points: 300, state: 'pending' });
+    expect(gift.expiresAt.getTime() - gift.offeredAt.getTime()).toBe(7 * DAY_MS);
+    expect(reservations.get(gift.reservationId)).toMatchObject({
+      userId: 'user-a',
+      amount: 300,
+      status: ReservationStatus.ACTIVE,
+      sourceCorrelationId: `gift-${gift.giftId}`,
+    });
+    expect(stage(gift.giftId)).toEqual(['offered']);
+    expect(entries).toHaveLength(0);
+  });
+
+  it('should turn an accepted gift into a debit and credit pair', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+
+    const { gift: accepted, transactionId } = await service.acceptGift(gift.giftId);
+
+    expect(accepted.state).toBe('accepted');
+    expect(stage(gift.giftId)).toEqual(['offered', 'accepted']);
+    expect(reservations.get(gift.reservationId).status).toBe(ReservationStatus.COMMITTED);
+    expect(entries).toEqual([
+      expect.objectContaining({
+        transactionId,
+        accountId: 'user-a',
+        amount: -300,
+        balanceBefore: 5000,
+        balanceAfter: 4700,
+        reason: TransactionReason.GIFT_SENT,
+        idempotencyKey: `gift-${gift.giftId}-debit`,
+      }),
+      expect.objectContaining({
+        transactionId,
+        accountId: 'user-b',
+        amount: 300,
+        balanceBefore: 0,
+        balanceAfter: 300,
+        reason: TransactionReason.GIFT_RECEIVED,
+        idempotencyKey: `gift-${gift.giftId}-credit`,
+      }),
+    ]);
+  });
+
+  it('should return the same transfer when an accept is retried', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+
+    const first = await service.acceptGift(gift.giftId);
+    const again = await service.acceptGift(gift.giftId);
+
+    expect(again.transactionId).toBe(first.transactionId);
+    expect(entries).toHaveLength(2);
+    expect([...applied.keys()]).toEqual([`gift-${gift.giftId}-debit`, `gift-${gift.giftId}-credit`]);
+  });
+
+  it('should move the wallets when a retried accept finds the pair already written', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+    (applyWalletDelta as jest.Mock)
+      .mockImplementationOnce(walletDelta)
+      .mockImplementationOnce(walletDelta)
+      .mockRejectedValueOnce(new Error('connection lost'));
+
+    await expect(service.acceptGift(gift.giftId)).rejects.toThrow('connection lost');
+    expect(entries).toHaveLength(2);
+    expect([...applied.keys()]).toEqual([`gift-${gift.giftId}-debit`]);
+
+    await service.acceptGift(gift.giftId);
+
+    expect(entries).toHaveLength(2);
+    expect(applyWalletDelta).toHaveBeenCalledWith('user-a', -300, `gift-${gift.giftId}-debit`);
+    expect(applyWalletDelta).toHaveBeenCalledWith('user-b', 300, `gift-${gift.giftId}-credit`);
+    expect([...applied.keys()]).toEqual([`gift-${gift.giftId}-debit`, `gift-${gift.giftId}-credit`]);
+  });
+
+  it('should leave the gift pending when the sender\'s wallet cannot cover it', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new InsufficientBalanceError(300, 100));
+
+    await expect(service.acceptGift(gift.giftId)).rejects.toThrow(InsufficientBalanceError);
+
+    expect(stage(gift.giftId)).toEqual(['offered']);
+    expect(reservations.get(gift.reservationId).status).toBe(ReservationStatus.ACTIVE);
+    expect(entries).toHaveLength(0);
+    expect(applied.size).toBe(0);
+
+    await expect(service.declineGift(gift.giftId)).resolves.toMatchObject({ state: 'declined' });
+    expect(reservations.get(gift.reservationId).status).toBe(ReservationStatus.RELEASED);
+  });
+
+  it('should return the wallet debit of an accept that stopped before it was recorded', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+    (GiftEventModel.create as jest.Mock).mockRejectedValueOnce(new Error('connection lost'));
+
+    await expect(service.acceptGift(gift.giftId)).rejects.toThrow('connection lost');
+    expect(senderMoved(gift.giftId)).toBe(-300);
+
+    await service.expireStaleOffers(new Date(gift.expiresAt.getTime() + 1));
+    await service.expireStaleOffers(new Date(gift.expiresAt.getTime() + 1));
+
+    expect(stage(gift.giftId)).toEqual(['offered', 'expired']);
+    expect(applied.get(`gift-${gift.giftId}-debit-return`)).toEqual({ userId: 'user-a', delta: 300 });
+    expect(senderMoved(gift.giftId)).toBe(0);
+    expect(entries).toHaveLength(0);
+  });
+
+  it('should release the hold when a gift is declined', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 300);
+
+    await expect(service.declineGift(gift.giftId)).resolves.toMatchObject({ state: 'declined' });
+    await expect(service.declineGift(gift.giftId)).resolves.toMatchObject({ state: 'declined' });
+
+    expect(reservations.get(gift.reservationId).status).toBe(ReservationStatus.RELEASED);
+    await expect(service.acceptGift(gift.giftId)).rejects.toThrow(GiftNotPendingError);
+    expect(entries).toHaveLength(0);
+  });
+
+  it('should count this month\'s offers that were not returned against the limit', async () => {
+    const now = new Date();
+    const lastMonth = new Date(Date.UTC(now.getUTCFullYear(), now.getUTCMonth() - 1, 1));
+    const offered = (giftId: string, points: number, createdAt: Date, final?: string) => {
+      events.push({ giftId, sequence: 0, kind: 'offered', fromUserId: 'user-a', toUserId: 'user-b', points, createdAt });
+      if (final) {
+        events.push({ giftId, sequence: 1, kind: final, fromUserId: 'user-a', toUserId: 'user-b', points, createdAt });
+      }
+    };
+    offered('old', 900, lastMonth, 'accepted');
+    offered('sent', 400, now, 'accepted');
+    offered('declined', 800, now, 'declined');
+
+    await service.offerGift('user-a', 'user-b', 350);
+    expect(await service.usedThisMonth('user-a')).toBe(750);
+
+    const error = await service.offerGift('user-a', 'user-c', 300).catch(e => e);
+    expect(error).toBeInstanceOf(GiftLimitExceededError);
+    expect(error.details).toMatchObject({ limit: 1000, used: 750, requested: 300 });
+
+    await expect(service.offerGift('user-a', 'user-c', 250)).resolves.toMatchObject({ state: 'pending' });
+  });
+
+  it('should return a declined gift\'s points to the monthly limit once', async () => {
+    const gift = await service.offerGift('user-a', 'user-b', 600);
+
+    await service.declineGift(gift.giftId);
+    await service.declineGift(gift.giftId);
+
+    expect(await service.usedThisMonth('user-a')).toBe(0);
+    await expect(service.offerGift('user-a', 'user-b', 1000)).resolves.toMatchObject({ state: 'pending' });
+  });
+
+  it('should not let concurrent offers pass the limit together', async () => {
+    const results = await Promise.allSettled([1, 2, 3, 4].map(() => service.offerGift('user-a', 'user-b', 300)));
+
+    expect(results.filter(r => r.status === 'fulfilled')).toHaveLength(3);
+    expect(results.filter(r => r.status === 'rejected').map(r => (r as PromiseRejectedResult).reason)).toEqual([
+      expect.any(GiftLimitExceededError),
+    ]);
+  });
+
+  it('should hold the limit across instances', async () => {
+    const instances = [1, 2, 3, 4].map(() => new GiftService(mockLedgerService, mockReservations, { monthlyLimit: 1000 }));
+
+    const results = await Promise.allSettled(instances.map(instance => instance.offerGift('user-a', 'user-b', 300)));
+
+    expect(results.filter(r => r.status === 'fulfilled')).toHaveLength(3);
+    expect(await service.usedThisMonth('user-a')).toBe(900);
+  });
+
+  it('should refuse a gift the held balance cannot cover', async () => {
+    balances['user-a'] = 500;
+    await service.offerGift('user-a', 'user-b', 400);
+
+    await expect(service.offerGift('user-a', 'user-c', 200)).rejects.toThrow(InsufficientBalanceError);
+  });
+
+  it('should refuse gifts from or to a frozen account', async () => {
+    frozen.add('user-b');
+    await expect(service.offerGift('user-a', 'user-b', 100)).rejects.toThrow(AccountFrozenError);
+
+    frozen.clear();
+    const gift = await service.offerGift('user-a', 'user-b', 100);
+    frozen.add('user-a');
+
+    await expect(service.acceptGift(gift.giftId)).rejects.toThrow(AccountFrozenError);
+    expect(stage(gift.giftId)).toEqual(['offered']);
+  });
+
+  it('should expire lapsed offers once and release their holds', async () => {
+    const stale = await service.offerGift('user-a', 'user-b', 100);
+    const accepted = await service.offerGift('user-a', 'user-b', 200);
+    await service.acceptGift(accepted.giftId);
+    const after = new Date(stale.expiresAt.getTime() + 1);
+
+    await expect(service.expireStaleOffers(after)).resolves.toBe(1);
+    await expect(service.expireStaleOffers(after)).resolves.toBe(0);
+
+    expect(stage(stale.giftId)).toEqual(['offered', 'expired']);
+    expect(reservations.get(stale.reservationId).status).toBe(ReservationStatus.RELEASED);
+    expect(stage(accepted.giftId)).toEqual(['offered', 'accepted']);
+    await expect(service.acceptGift(stale.giftId)).rejects.toThrow(GiftNotPendingError);
+  });
+
+  it('should page the sweeper past offers that were already settled', async () => {
+    const sweeper = new GiftService(mockLedgerService, mockReservations, { monthlyLimit: 1000, sweepBatchSize: 2 });
+    const gifts: Gift[] = [];
+    for (let i = 0; i < 5; i++) {
+      gifts.push(await sweeper.offerGift('user-a', 'user-b', 10));
+    }
+    await sweeper.declineGift(gifts[0].giftId);
+    await sweeper.declineGift(gifts[1].giftId);
+
+    await expect(sweeper.expireStaleOffers(new Date(Date.now() + 8 * DAY_MS))).resolves.toBe(3);
+  });
+
+  it('should give an accept racing an expiry exactly one winner', async () => {
+    for (let round = 0; round < 12; round++) {
+      lookupDelay = round % 3;
+      const gift = await service.offerGift('user-a', 'user-b', 10);
+      const lapse = new Date(gift.expiresAt.getTime() + 1);
+
+      const [accept, expired] = await Promise.all([
+        service.acceptGift(gift.giftId).catch(e => e),
+        round % 2 === 0 ? service.expireStaleOffers(lapse) : tick().then(() => service.expireStaleOffers(lapse)),
+      ]);
+
+      const outcome = stage(gift.giftId);
+      const pair = entries.filter(e => e.correlationId === `gift-${gift.giftId}`);
+      const hold = reservations.get(gift.reservationId).status;
+
+      if (outcome[1] === 'accepted') {
+        expect(accept.transactionId).toBeDefined();
+        expect(expired).toBe(0);
+        expect(pair).toHaveLength(2);
+        expect(hold).toBe(ReservationStatus.COMMITTED);
+        expect(senderMoved(gift.giftId)).toBe(-10);
+      } else {
+        expect(outcome[1]).toBe('expired');
+        expect(accept).toBeInstanceOf(GiftNotPendingError);
+        expect(expired).toBe(1);
+        expect(pair).toHaveLength(0);
+        expect(hold).toBe(ReservationStatus.RELEASED);
+        expect(senderMoved(gift.giftId)).toBe(0);
+      }
+      expect(outcome).toHaveLength(2);
+    }
+  });
+});
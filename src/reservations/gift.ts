@@ -0,0 +1,701 @@
+/**
+ * Gift Service
+ *
+ * User-to-user gifting on the hold and ledger primitives:
+ * - offerGift() checks the sender's monthly limit and hold-aware balance,
+ *   holds the points as a reservation and records an `offered` event
+ * - acceptGift() debits the sender's wallet, records `accepted`,
+ *   commits the hold and writes the transfer pair: a GIFT_SENT debit on
+ *   the sender and a GIFT_RECEIVED credit on the recipient, under one
+ *   transaction ID
+ * - declineGift(), or expireStaleOffers() once the offer has lapsed,
+ *   records `declined` / `expired` and releases the hold
+ *
+ * A gift's state is its event chain in gift_events. The final event is
+ * appended at sequence 1, which the unique index lets exactly one
+ * transition take, so an acceptance racing an expiry or a decline has a
+ * single winner. Side effects follow the event and are idempotent (the
+ * hold transitions are conditional on ACTIVE, the ledger entries are
+ * keyed `gift-<giftId>-debit` / `-credit`, and each is applied to its
+ * wallet with applyWalletDelta under the same key), so retrying an
+ * accept or a decline completes one interrupted after its event was
+ * recorded, including one interrupted before a wallet moved.
+ *
+ * The sender's wallet is debited before `accepted` is recorded, so a
+ * wallet that no longer covers the gift leaves it pending instead of
+ * accepted with a ledger debit the wallet never took. The GIFT_SENT
+ * entry then re-drives that debit as a no-op. If the accept loses the
+ * race to a decline or an expiry, or stops before recording its event
+ * and the gift later lapses, the debit is returned under
+ * `gift-<giftId>-debit-return` by whichever side settles the gift.
+ *
+ * The monthly limit counts the points of the gifts a sender offered in
+ * the UTC month, less those declined or expired. It is held in
+ * gift_monthly_counters, seeded from gift_events the first time a month
+ * is seen, and each offer is counted by a single conditional increment,
+ * so offers on several instances cannot together pass the limit. A
+ * declined or expired gift returns its points to the month it was
+ * offered in.
+ *
+ * Frozen accounts can neither offer, receive nor accept gifts.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { ReservationService } from './service';
+import { HoldAwareBalance } from './affordability';
+import { GiftEventModel, GiftEventKind, IGiftEvent } from '../db/models/gift-event.model';
+import { GiftMonthlyCounterModel } from '../db/models/gift-monthly-counter.model';
+import { WalletModel } from '../db/models/wallet.model';
+import { applyWalletDelta, findWalletApplication } from '../wallets/wallet-application';
+import { LedgerService } from '../ledger/ledger.service';
+import { UserIdTokenizer } from '../ledger/types';
+import {
+  AccountFrozenError,
+  GiftLimitExceededError,
+  GiftNotPendingError,
+  InsufficientBalanceError,
+  InvalidPointAmountError,
+  UserIdRejectedError,
+} from '../services/types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+/**
+ * Configuration for gifting
+ */
+export interface GiftConfig {
+  /** Points a user may gift per calendar month (UTC) */
+  monthlyLimit: number;
+
+  /** How long a recipient has to accept */
+  offerTtlMs: number;
+
+  /**
+   * How long the hold outlives the offer, so the gift sweeper rather than
+   * the reservation sweeper ends it
+   */
+  holdGraceMs: number;
+
+  /** Offers read per sweeper page */
+  sweepBatchSize: number;
+
+  /** How far back the sweeper looks for lapsed offers */
+  sweepLookbackMs: number;
+
+  /** Currency stamped on gift entries */
+  defaultCurrency: string;
+
+  /** The ledger's userIdTokenizer (user IDs are stored as given when unset) */
+  userIdTokenizer?: UserIdTokenizer;
+}
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+const DEFAULT_CONFIG: GiftConfig = {
+  monthlyLimit: 10000,
+  offerTtlMs: 7 * DAY_MS,
+  holdGraceMs: DAY_MS,
+  sweepBatchSize: 500,
+  sweepLookbackMs: 30 * DAY_MS,
+  defaultCurrency: 'points',
+};
+
+/**
+ * Gift lifecycle state
+ */
+export type GiftState = 'pending' | 'accepted' | 'declined' | 'expired';
+
+/**
+ * A gift, as derived from its events
+ */
+export interface Gift {
+  giftId: string;
+  fromUserId: string;
+  toUserId: string;
+  points: number;
+  reservationId: string;
+  state: GiftState;
+  offeredAt: Date;
+  expiresAt: Date;
+
+  /** When the gift was accepted, declined or expired */
+  settledAt?: Date;
+}
+
+/**
+ * Result of accepting a gift
+ */
+export interface GiftAcceptance {
+  gift: Gift;
+
+  /** Transaction of the debit and credit pair */
+  transactionId: string;
+}
+
+type GiftLedger = Pick<LedgerService, 'createEntryWithResult' | 'getBalanceSnapshot'>;
+
+/**
+ * Gift Service Implementation
+ */
+export class GiftService {
+  private config: GiftConfig;
+  private ledgerService: GiftLedger;
+  private reservations: ReservationService;
+  private balances: HoldAwareBalance;
+  private offerQueues = new Map<string, Promise<void>>();
+
+  constructor(ledgerService: GiftLedger, reservations: ReservationService, config: Partial<GiftConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+    this.reservations = reservations;
+    this.balances = new HoldAwareBalance(ledgerService, reservations);
+  }
+
+  /**
+   * Offer points to another user, holding them until the gift settles
+   *
+   * @throws InvalidPointAmountError if points is not a positive integer
+   * @throws AccountFrozenError if either account is frozen
+   * @throws GiftLimitExceededError if the gift would pass the sender's monthly limit
+   * @throws InsufficientBalanceError if available points less active holds do not cover the gift
+   */
+  async offerGift(fromUserId: string, toUserId: string, points: number): Promise<Gift> {
+    if (!Number.isSafeInteger(points) || points < 1) {
+      throw new InvalidPointAmountError(points, 'must be a positive integer');
+    }
+    if (fromUserId === toUserId) {
+      throw new Error('Cannot gift points to yourself');
+    }
+
+    return this.serialize(fromUserId, async () => {
+      await this.assertNotFrozen(fromUserId, toUserId);
+
+      const now = new Date();
+      const giftId = uuidv4();
+      await this.countOffer(fromUserId, giftId, points, now);
+
+      const { canRedeem, available } = await this.balances.canRedeem(fromUserId, points);
+      if (!canRedeem) {
+        await this.uncountOffer(fromUserId, giftId, points, now);
+        throw new InsufficientBalanceError(points, available);
+      }
+
+      const reservationId = uuidv4();
+      const expiresAt = new Date(now.getTime() + this.config.offerTtlMs);
+
+      try {
+        await this.reservations.createReservation({
+          reservationId,
+          userId: fromUserId,
+          amount: points,
+          expiresAt: new Date(expiresAt.getTime() + this.config.holdGraceMs),
+          sourceCorrelationId: `gift-${giftId}`,
+        });
+      } catch (error) {
+        await this.uncountOffer(fromUserId, giftId, points, now);
+        throw error;
+      }
+
+      const offer = {
+        eventId: uuidv4(),
+        giftId,
+        sequence: 0,
+        kind: 'offered' as GiftEventKind,
+        fromUserId,
+        toUserId,
+        points,
+        reservationId,
+        expiresAt,
+        createdAt: now,
+      };
+      try {
+        await GiftEventModel.create(offer);
+      } catch (error) {
+        await this.reservations.releaseReservation({ reservationId });
+        await this.uncountOffer(fromUserId, giftId, points, now);
+        throw error;
+      }
+
+      MetricsLogger.incrementCounter(MetricEventType.GIFT_OFFERED, { giftId, points });
+
+      return toGift(offer, null);
+    });
+  }
+
+  /**
+   * Accept a gift, moving the held points to the recipient
+   * Re-accepting an accepted gift returns its transfer, so an accept
+   * interrupted after the acceptance was recorded can be retried.
+   *
+   * @throws GiftNotPendingError if the gift was declined or has expired
+   * @throws AccountFrozenError if either account is frozen
+   * @throws InsufficientBalanceError if the sender no longer has the points
+   *   or their wallet no longer covers them; the gift stays pending
+   * @throws UserIdRejectedError if the tokenizer rejects the sender's ID
+   */
+  async acceptGift(giftId: string): Promise<GiftAcceptance> {
+    const offer = await this.requireOffer(giftId);
+    let final = await this.finalEvent(giftId);
+
+    if (!final) {
+      const now = new Date();
+      if (new Date(offer.expiresAt).getTime() <= now.getTime()) {
+        throw new GiftNotPendingError(giftId, 'expired');
+      }
+
+      await this.assertNotFrozen(offer.fromUserId, offer.toUserId);
+
+      const snapshot = await this.ledgerService.getBalanceSnapshot(offer.fromUserId, 'user');
+      if (snapshot.availableBalance < offer.points) {
+        throw new InsufficientBalanceError(offer.points, snapshot.availableBalance);
+      }
+
+      // Take the points from the wallet first: a wallet that cannot cover
+      // them must stop the accept before it is recorded
+      await applyWalletDelta(await this.storedUserId(offer.fromUserId), -offer.points, debitKey(giftId));
+
+      final = (await this.appendFinal(offer, 'accepted', now)).final;
+    }
+
+    if (final.kind !== 'accepted') {
+      await this.returnWalletDebit(offer);
+      throw new GiftNotPendingError(giftId, final.kind);
+    }
+
+    await this.reservations.commitReservation({ reservationId: offer.reservationId });
+    const transactionId = await this.transfer(offer);
+
+    return { gift: toGift(offer, final), transactionId };
+  }
+
+  /**
+   * Decline a gift and release the sender's hold
+   * Declining a declined gift is a no-op.
+   *
+   * @throws GiftNotPendingError if the gift was accepted or has expired
+   */
+  async declineGift(giftId: string): Promise<Gift> {
+    const offer = await this.requireOffer(giftId);
+    const final = (await this.finalEvent(giftId)) || (await this.appendFinal(offer, 'declined', new Date())).final;
+
+    if (final.kind !== 'declined') {
+      throw new GiftNotPendingError(giftId, final.kind);
+    }
+
+    await this.release(offer, final);
+    return toGift(offer, final);
+  }
+
+  /**
+   * Current state of a gift
+   */
+  async getGift(giftId: string): Promise<Gift | null> {
+    const offer = await GiftEventModel.findOne({ giftId: { $eq: giftId }, sequence: 0 }).lean().exec();
+    return offer ? toGift(offer, await this.finalEvent(giftId)) : null;
+  }
+
+  /**
+   * Expire offers that lapsed unaccepted and release their holds
+   * Safe to run concurrently and repeatedly: each expiry is claimed by
+   * its event, so an offer is expired at most once.
+   *
+   * @returns Number of offers this run expired
+   */
+  async expireStaleOffers(now: Date = new Date()): Promise<number> {
+    const since = new Date(now.getTime() - this.config.sweepLookbackMs);
+    let after: { expiresAt: Date; giftId: string } | null = null;
+    let expired = 0;
+
+    for (;;) {
+      const window = after
+        ? {
+            $or: [
+              { expiresAt: { $gt: after.expiresAt, $lte: now } },
+              { expiresAt: { $eq: after.expiresAt }, giftId: { $gt: after.giftId } },
+            ],
+          }
+        : { expiresAt: { $gt: since, $lte: now } };
+
+      const offers: any[] = await GiftEventModel.find({ kind: 'offered', ...window })
+        .sort({ expiresAt: 1, giftId: 1 })
+        .limit(this.config.sweepBatchSize)
+        .lean()
+        .exec();
+
+      const settled = await this.settledGiftIds(offers.map(offer => offer.giftId));
+
+      for (const offer of offers) {
+        if (settled.has(offer.giftId)) {
+          continue;
+        }
+        const { final, appended } = await this.appendFinal(offer, 'expired', now);
+        if (appended) {
+          await this.release(offer, final);
+          expired++;
+        }
+      }
+
+      if (offers.length < this.config.sweepBatchSize) {
+        break;
+      }
+      const last = offers[offers.length - 1];
+      after = { expiresAt: last.expiresAt, giftId: last.giftId };
+    }
+
+    return expired;
+  }
+
+  /**
+   * Points the user has gifted this month: offers made this month that
+   * were not declined or expired
+   */
+  async usedThisMonth(userId: string, now: Date = new Date()): Promise<number> {
+    return (await this.loadCounter(userId, monthStart(now))).points;
+  }
+
+  /**
+   * Count an offer against its sender's month
+   *
+   * @throws GiftLimitExceededError if it would pass the monthly limit
+   */
+  private async countOffer(userId: string, giftId: string, points: number, at: Date): Promise<void> {
+    const month = monthStart(at);
+    await this.loadCounter(userId, month);
+
+    const result = await GiftMonthlyCounterModel.updateOne(
+      {
+        userId: { $eq: userId },
+        month: { $eq: month },
+        giftIds: { $ne: giftId },
+        points: { $lte: this.config.monthlyLimit - points },
+      },
+      {
+        $inc: { points },
+        $push: { giftIds: giftId },
+      }
+    );
+
+    if (result.modifiedCount === 1) {
+      return;
+    }
+
+    const current = await this.loadCounter(userId, month);
+    throw new GiftLimitExceededError(userId, this.config.monthlyLimit, current.points, points);
+  }
+
+  /**
+   * Return a counted offer's points to the month it was offered in
+   * Conditional on the gift still being counted, so it returns them once.
+   */
+  private async uncountOffer(userId: string, giftId: string, points: number, offeredAt: Date): Promise<void> {
+    await GiftMonthlyCounterModel.updateOne(
+      {
+        userId: { $eq: userId },
+        month: { $eq: monthStart(offeredAt) },
+        giftIds: { $eq: giftId },
+      },
+      {
+        $inc: { points: -points },
+        $pull: { giftIds: giftId },
+      }
+    );
+  }
+
+  /**
+   * Load a sender's counter for a month, seeding it from gift_events if missing
+   */
+  private async loadCounter(userId: string, month: Date): Promise<{ points: number; giftIds: string[] }> {
+    const query = { userId: { $eq: userId }, month: { $eq: month } };
+    const existing = await GiftMonthlyCounterModel.findOne(query).lean().exec();
+    if (existing) {
+      return existing;
+    }
+
+    const offers = await GiftEventModel.find({
+      fromUserId: { $eq: userId },
+      kind: 'offered',
+      createdAt: { $gte: month, $lt: nextMonthStart(month) },
+    })
+      .lean()
+      .exec();
+    const returned = await this.returnedGiftIds(offers.map(offer => offer.giftId));
+    const counted = offers.filter(offer => !returned.has(offer.giftId));
+
+    const seed = {
+      userId,
+      month,
+      points: counted.reduce((sum, offer) => sum + offer.points, 0),
+      giftIds: counted.map(offer => offer.giftId),
+    };
+
+    try {
+      await GiftMonthlyCounterModel.create(seed);
+    } catch (error: any) {
+      // Another writer seeded it first
+      if (error.code !== 11000) {
+        throw error;
+      }
+      const seeded = await GiftMonthlyCounterModel.findOne(query).lean().exec();
+      if (seeded) {
+        return seeded;
+      }
+    }
+
+    return seed;
+  }
+
+  /**
+   * Write the transfer pair of an accepted gift and apply it to both wallets
+   * The sender's wallet was debited before the gift was accepted, so its
+   * re-drive is a no-op; the recipient's is re-driven on every call, so
+   * an accept retried after a crash between the credit and its wallet
+   * update completes it.
+   *
+   * @returns The pair's transaction ID
+   */
+  private async transfer(offer: GiftOffer): Promise<string> {
+    const correlationId = `gift-${offer.giftId}`;
+    const sender = await this.ledgerService.getBalanceSnapshot(offer.fromUserId, 'user');
+
+    const { entry: debit } = await this.ledgerService.createEntryWithResult({
+      transactionId: uuidv4(),
+      accountId: offer.fromUserId,
+      accountType: 'user',
+      amount: -offer.points,
+      type: TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: 'available→none',
+      reason: TransactionReason.GIFT_SENT,
+      idempotencyKey: debitKey(offer.giftId),
+      requestId: correlationId,
+      balanceBefore: sender.availableBalance,
+      balanceAfter: sender.availableBalance - offer.points,
+      currency: this.config.defaultCurrency,
+      correlationId,
+      featureType: 'gift',
+      metadata: { giftId: offer.giftId, toUserId: offer.toUserId },
+    });
+
+    await applyWalletDelta(debit.accountId, debit.amount, debit.idempotencyKey);
+
+    const recipient = await this.ledgerService.getBalanceSnapshot(offer.toUserId, 'user');
+    const transactionId = debit.transactionId;
+
+    const { entry: credit } = await this.ledgerService.createEntryWithResult({
+      transactionId,
+      accountId: offer.toUserId,
+      accountType: 'user',
+      amount: offer.points,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.GIFT_RECEIVED,
+      idempotencyKey: `${correlationId}-credit`,
+      requestId: correlationId,
+      balanceBefore: recipient.availableBalance,
+      balanceAfter: recipient.availableBalance + offer.points,
+      currency: this.config.defaultCurrency,
+      correlationId,
+      featureType: 'gift',
+      metadata: { giftId: offer.giftId, fromUserId: offer.fromUserId },
+    });
+
+    if (await applyWalletDelta(credit.accountId, credit.amount, credit.idempotencyKey)) {
+      MetricsLogger.incrementCounter(MetricEventType.GIFT_ACCEPTED, { giftId: offer.giftId, points: offer.points });
+    }
+
+    return transactionId;
+  }
+
+  private async release(offer: GiftOffer, final: GiftFinal): Promise<void> {
+    await this.returnWalletDebit(offer);
+    await this.uncountOffer(offer.fromUserId, offer.giftId, offer.points, offer.createdAt);
+    const released = await this.reservations.releaseReservation({ reservationId: offer.reservationId });
+    if (released) {
+      MetricsLogger.incrementCounter(MetricEventType.GIFT_RETURNED, {
+        giftId: offer.giftId,
+        points: offer.points,
+        outcome: final.kind,
+      });
+    }
+  }
+
+  /**
+   * Return the wallet debit of an accept that did not win the gift
+   * The return is keyed by the gift, so the losing accept and the decline
+   * or expiry that beat it can both call this and it moves the wallet once.
+   */
+  private async returnWalletDebit(offer: GiftOffer): Promise<void> {
+    const debit = await findWalletApplication(debitKey(offer.giftId));
+    if (debit) {
+      await applyWalletDelta(debit.userId, -debit.delta, `${debitKey(offer.giftId)}-return`);
+    }
+  }
+
+  /**
+   * Record a gift's final transition
+   *
+   * @returns The final event, and whether it is this one rather than one a
+   *   concurrent transition recorded first
+   */
+  private async appendFinal(
+    offer: GiftOffer,
+    kind: GiftEventKind,
+    at: Date
+  ): Promise<{ final: GiftFinal; appended: boolean }> {
+    const event = {
+      eventId: uuidv4(),
+      giftId: offer.giftId,
+      sequence: 1,
+      kind,
+      fromUserId: offer.fromUserId,
+      toUserId: offer.toUserId,
+      points: offer.points,
+      reservationId: offer.reservationId,
+      expiresAt: offer.expiresAt,
+      createdAt: at,
+    };
+
+    try {
+      await GiftEventModel.create(event);
+      return { final: event, appended: true };
+    } catch (error: any) {
+      if (error.code !== 11000) {
+        throw error;
+      }
+      const winner = await this.finalEvent(offer.giftId);
+      if (!winner) {
+        throw error;
+      }
+      return { final: winner, appended: false };
+    }
+  }
+
+  private async requireOffer(giftId: string): Promise<GiftOffer> {
+    const offer = await GiftEventModel.findOne({ giftId: { $eq: giftId }, sequence: 0 }).lean().exec();
+    if (!offer) {
+      throw new GiftNotPendingError(giftId, 'not found');
+    }
+    return offer;
+  }
+
+  private async finalEvent(giftId: string): Promise<GiftFinal | null> {
+    return GiftEventModel.findOne({ giftId: { $eq: giftId }, sequence: 1 }).lean().exec();
+  }
+
+  private async settledGiftIds(giftIds: string[]): Promise<Set<string>> {
+    if (giftIds.length === 0) {
+      return new Set();
+    }
+    const finals = await GiftEventModel.find({ giftId: { $in: giftIds }, sequence: 1 }).select('giftId').lean().exec();
+    return new Set(finals.map(final => final.giftId));
+  }
+
+  private async returnedGiftIds(giftIds: string[]): Promise<Set<string>> {
+    if (giftIds.length === 0) {
+      return new Set();
+    }
+    const finals = await GiftEventModel.find({
+      giftId: { $in: giftIds },
+      sequence: 1,
+      kind: { $in: ['declined', 'expired'] },
+    })
+      .select('giftId')
+      .lean()
+      .exec();
+    return new Set(finals.map(final => final.giftId));
+  }
+
+  private async assertNotFrozen(fromUserId: string, toUserId: string): Promise<void> {
+    const wallets = await WalletModel.find({ userId: { $in: [fromUserId, toUserId] } })
+      .select('userId frozen')
+      .lean()
+      .exec();
+
+    for (const userId of [fromUserId, toUserId]) {
+      if (wallets.some(wallet => wallet.userId === userId && wallet.frozen)) {
+        throw new AccountFrozenError(userId);
+      }
+    }
+  }
+
+  /**
+   * The account ID the ledger stores for a user, which keys its wallet
+   */
+  private async storedUserId(userId: string): Promise<string> {
+    if (!this.config.userIdTokenizer) {
+      return userId;
+    }
+
+    try {
+      return await this.config.userIdTokenizer(userId);
+    } catch (error) {
+      throw new UserIdRejectedError(error);
+    }
+  }
+
+  /**
+   * Run offers from one sender one at a time, in arrival order
+   */
+  private async serialize<T>(userId: string, offer: () => Promise<T>): Promise<T> {
+    const previous = this.offerQueues.get(userId) || Promise.resolve();
+    const run = previous.then(offer);
+    const tail = run.then(
+      () => undefined,
+      () => undefined
+    );
+    this.offerQueues.set(userId, tail);
+
+    try {
+      return await run;
+    } finally {
+      if (this.offerQueues.get(userId) === tail) {
+        this.offerQueues.delete(userId);
+      }
+    }
+  }
+}
+
+type GiftOffer = Pick<
+  IGiftEvent,
+  'giftId' | 'fromUserId' | 'toUserId' | 'points' | 'reservationId' | 'expiresAt' | 'createdAt'
+>;
+
+type GiftFinal = Pick<IGiftEvent, 'kind' | 'createdAt'>;
+
+function debitKey(giftId: string): string {
+  return `gift-${giftId}-debit`;
+}
+
+function monthStart(at: Date): Date {
+  return new Date(Date.UTC(at.getUTCFullYear(), at.getUTCMonth(), 1));
+}
+
+function nextMonthStart(month: Date): Date {
+  return new Date(Date.UTC(month.getUTCFullYear(), month.getUTCMonth() + 1, 1));
+}
+
+function toGift(offer: GiftOffer, final: GiftFinal | null): Gift {
+  return {
+    giftId: offer.giftId,
+    fromUserId: offer.fromUserId,
+    toUserId: offer.toUserId,
+    points: offer.points,
+    reservationId: offer.reservationId,
+    state: final ? (final.kind as GiftState) : 'pending',
+    offeredAt: offer.createdAt,
+    expiresAt: offer.expiresAt,
+    settledAt: final ? final.createdAt : undefined,
+  };
+}
+
+/**
+ * Factory function to create a gift service
+ */
+export function createGiftService(
+  ledgerService: GiftLedger,
+  reservations: ReservationService,
+  config?: Partial<GiftConfig>
+): GiftService {
+  return new GiftService(ledgerService, reservations, config);
+}
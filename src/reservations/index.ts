@@ -3,4 +3,7 @@
  */
 
 export { ReservationService } from './service';
+export * from './reward-drop';
+export * from './affordability';
+export * from './gift';
 export * from './types';
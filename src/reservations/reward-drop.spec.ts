@@ -0,0 +1,301 @@
+/**
+ * Reward Drop Service Tests
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { RewardDropService } from './reward-drop';
+import { ReservationModel, ReservationStatus } from '../db/models/reservation.model';
+import { RewardDropModel } from '../db/models/reward-drop.model';
+import { applyWalletDelta, findWalletApplication } from '../wallets/wallet-application';
+import { InsufficientBalanceError, ReservationNotActiveError, RewardSoldOutError } from '../services/types';
+import { TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/reservation.model');
+jest.mock('../db/models/reward-drop.model');
+jest.mock('../wallets/wallet-application');
+
+describe('RewardDropService', () => {
+  let drops: Map<string, any>;
+  let reservations: Map<string, any>;
+  let entries: any[];
+  let applied: Map<string, { userId: string; delta: number }>;
+  let balances: Record<string, number>;
+  let mockReservations: any;
+  let mockLedgerService: any;
+  let service: RewardDropService;
+
+  const exec = (value: () => any) => ({ lean: jest.fn().mockReturnThis(), exec: jest.fn().mockImplementation(async () => value()) });
+
+  // Status transitions are conditional on ACTIVE, like the reservation service's updates
+  const transition = (reservationId: string, status: ReservationStatus) => {
+    const reservation = reservations.get(reservationId);
+    if (!reservation || reservation.status !== ReservationStatus.ACTIVE) {
+      return null;
+    }
+    reservation.status = status;
+    return { ...reservation };
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    let n = 0;
+    (uuidv4 as jest.Mock).mockImplementation(() => `uuid-${++n}`);
+    drops = new Map();
+    reservations = new Map();
+    entries = [];
+    balances = {};
+
+    (RewardDropModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      drops.set(doc.itemId, { ...doc });
+      return doc;
+    });
+    (RewardDropModel.findOne as jest.Mock).mockImplementation((query: any) =>
+      exec(() => (drops.has(query.itemId.$eq) ? { ...drops.get(query.itemId.$eq) } : null))
+    );
+    // Conditional $inc: check and decrement happen in one step
+    (RewardDropModel.findOneAndUpdate as jest.Mock).mockImplementation((query: any) =>
+      exec(() => {
+        const drop = drops.get(query.itemId.$eq);
+        if (!drop || drop.remaining <= 0) {
+          return null;
+        }
+        drop.remaining--;
+        return { ...drop };
+      })
+    );
+    (RewardDropModel.updateOne as jest.Mock).mockImplementation((query: any, update: any) =>
+      exec(() => {
+        drops.get(query.itemId.$eq).remaining += update.$inc.remaining;
+      })
+    );
+    (ReservationModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => {
+      const counts = new Map<string, number>();
+      for (const reservation of reservations.values()) {
+        if (reservation.itemId === pipeline[0].$match.itemId.$eq) {
+          counts.set(reservation.status, (counts.get(reservation.status) || 0) + 1);
+        }
+      }
+      return exec(() => [...counts].map(([status, count]) => ({ _id: status, count })));
+    });
+    applied = new Map();
+    // One application per key, as the wallet_applications unique index enforces
+    (applyWalletDelta as jest.Mock).mockImplementation(async (userId: string, delta: number, key: string) => {
+      if (applied.has(key)) {
+        return false;
+      }
+      applied.set(key, { userId, delta });
+      return true;
+    });
+    (findWalletApplication as jest.Mock).mockImplementation(async (key: string) => applied.get(key) ?? null);
+
+    mockReservations = {
+      createReservation: jest.fn().mockImplementation(async (request: any) => {
+        const reservation = { ...request, status: ReservationStatus.ACTIVE };
+        reservations.set(request.reservationId, reservation);
+        return reservation;
+      }),
+      commitReservation: jest.fn().mockImplementation(async ({ reservationId }: any) =>
+        transition(reservationId, ReservationStatus.COMMITTED)
+      ),
+      releaseReservation: jest.fn().mockImplementation(async ({ reservationId }: any) =>
+        transition(reservationId, ReservationStatus.RELEASED)
+      ),
+      getReservation: jest.fn().mockImplementation(async (reservationId: string) =>
+        reservations.has(reservationId) ? { ...reservations.get(reservationId) } : null
+      ),
+      getUserReservations: jest.fn().mockImplementation(async (userId: string) =>
+        [...reservations.values()].filter(r => r.userId === userId && r.status === ReservationStatus.ACTIVE)
+      ),
+      onReservationExpired: jest.fn(),
+    };
+
+    mockLedgerService = {
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string) => ({
+        accountId,
+        availableBalance: balances[accountId] ?? 1000,
+      })),
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, ...request };
+        entries.push(entry);
+        balances[request.accountId] = request.balanceAfter;
+        return { entry, inserted: true };
+      }),
+    };
+
+    service = new RewardDropService(mockLedgerService, mockReservations);
+  });
+
+  it('should reserve a unit, hold the points and debit them on confirm', async () => {
+    await service.createDrop('tickets', 300, 2);
+
+    const reservationId = await service.reserve('user-1', 'tickets');
+
+    expect(drops.get('tickets').remaining).toBe(1);
+    expect(reservations.get(reservationId)).toMatchObject({ userId: 'user-1', amount: 300, itemId: 'tickets' });
+
+    const entry = await service.confirm(reservationId);
+
+    expect(entry).toMatchObject({
+      accountId: 'user-1',
+      amount: -300,
+      balanceBefore: 1000,
+      balanceAfter: 700,
+      reason: TransactionReason.REWARD_DROP_REDEMPTION,
+      idempotencyKey: `reward-drop-${reservationId}`,
+      correlationId: reservationId,
+      metadata: { itemId: 'tickets', reservationId },
+    });
+    expect(reservations.get(reservationId).status).toBe(ReservationStatus.COMMITTED);
+  });
+
+  it('should return the original entry when a confirm is retried', async () => {
+    await service.createDrop('tickets', 300, 1);
+    const reservationId = await service.reserve('user-1', 'tickets');
+
+    const first = await service.confirm(reservationId);
+    const again = await service.confirm(reservationId);
+
+    expect(again.entryId).toBe(first.entryId);
+    expect(entries).toHaveLength(1);
+    expect([...applied.keys()]).toEqual([`reward-drop-${reservationId}`]);
+  });
+
+  it('should debit the wallet when a confirm is retried after the wallet debit failed', async () => {
+    await service.createDrop('tickets', 300, 1);
+    const reservationId = await service.reserve('user-1', 'tickets');
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.confirm(reservationId)).rejects.toThrow('connection reset');
+    expect(reservations.get(reservationId).status).toBe(ReservationStatus.ACTIVE);
+    expect(entries).toHaveLength(0);
+
+    await service.confirm(reservationId);
+
+    expect(entries).toHaveLength(1);
+    expect(applyWalletDelta).toHaveBeenLastCalledWith('user-1', -300, `reward-drop-${reservationId}`);
+    expect([...applied.keys()]).toEqual([`reward-drop-${reservationId}`]);
+  });
+
+  it('should abandon a reservation the wallet cannot cover without writing the debit', async () => {
+    await service.createDrop('tickets', 300, 1);
+    const reservationId = await service.reserve('user-1', 'tickets');
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new InsufficientBalanceError(300, 100));
+
+    await expect(service.confirm(reservationId)).rejects.toThrow(InsufficientBalanceError);
+
+    expect(reservations.get(reservationId).status).toBe(ReservationStatus.RELEASED);
+    expect(drops.get('tickets').remaining).toBe(1);
+    expect(entries).toHaveLength(0);
+    expect(applied.size).toBe(0);
+  });
+
+  it('should return the wallet debit of a confirm whose reservation expired before the commit', async () => {
+    await service.createDrop('tickets', 300, 1);
+    const reservationId = await service.reserve('user-1', 'tickets');
+    mockReservations.commitReservation.mockImplementationOnce(async () => {
+      transition(reservationId, ReservationStatus.EXPIRED);
+      return null;
+    });
+
+    await expect(service.confirm(reservationId)).rejects.toThrow(ReservationNotActiveError);
+
+    expect(entries).toHaveLength(0);
+    expect(applied.get(`reward-drop-${reservationId}`)).toEqual({ userId: 'user-1', delta: -300 });
+    expect(applied.get(`reward-drop-${reservationId}-return`)).toEqual({ userId: 'user-1', delta: 300 });
+  });
+
+  it('should return the wallet debit of a confirm that stopped before the commit once the hold expires', async () => {
+    await service.createDrop('tickets', 300, 1);
+    service.start();
+    const reservationId = await service.reserve('user-1', 'tickets');
+    mockReservations.commitReservation.mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.confirm(reservationId)).rejects.toThrow('connection reset');
+
+    transition(reservationId, ReservationStatus.EXPIRED);
+    const [onExpired] = mockReservations.onReservationExpired.mock.calls[0];
+    await onExpired('user-1', 300, reservationId);
+
+    expect(drops.get('tickets').remaining).toBe(1);
+    expect(entries).toHaveLength(0);
+    expect(applied.get(`reward-drop-${reservationId}-return`)).toEqual({ userId: 'user-1', delta: 300 });
+  });
+
+  it('should return the unit when a reservation is abandoned', async () => {
+    await service.createDrop('tickets', 300, 1);
+    const reservationId = await service.reserve('user-1', 'tickets');
+
+    await expect(service.reserve('user-2', 'tickets')).rejects.toThrow(RewardSoldOutError);
+    await expect(service.abandon(reservationId)).resolves.toBe(true);
+    await expect(service.abandon(reservationId)).resolves.toBe(false);
+
+    expect(drops.get('tickets').remaining).toBe(1);
+    await expect(service.confirm(reservationId)).rejects.toThrow(ReservationNotActiveError);
+    await expect(service.reserve('user-2', 'tickets')).resolves.toBeDefined();
+  });
+
+  it('should return the unit when the hold expires', async () => {
+    await service.createDrop('tickets', 300, 1);
+    service.start();
+    const reservationId = await service.reserve('user-1', 'tickets');
+    transition(reservationId, ReservationStatus.EXPIRED);
+
+    const [onExpired] = mockReservations.onReservationExpired.mock.calls[0];
+    await onExpired('user-1', 300, reservationId);
+
+    expect(drops.get('tickets').remaining).toBe(1);
+  });
+
+  it('should count active holds against the balance', async () => {
+    await service.createDrop('tickets', 400, 5);
+    await service.reserve('user-1', 'tickets');
+    await service.reserve('user-1', 'tickets');
+
+    await expect(service.reserve('user-1', 'tickets')).rejects.toThrow(InsufficientBalanceError);
+    expect(drops.get('tickets').remaining).toBe(3);
+  });
+
+  it('should abandon a reservation whose points were spent before confirm', async () => {
+    await service.createDrop('tickets', 300, 1);
+    const reservationId = await service.reserve('user-1', 'tickets');
+    balances['user-1'] = 100;
+
+    await expect(service.confirm(reservationId)).rejects.toThrow(InsufficientBalanceError);
+
+    expect(reservations.get(reservationId).status).toBe(ReservationStatus.RELEASED);
+    expect(drops.get('tickets').remaining).toBe(1);
+    expect(entries).toHaveLength(0);
+  });
+
+  it('should never confirm more redemptions than the inventory under 10k concurrent reservations', async () => {
+    const inventory = 500;
+    await service.createDrop('concert', 100, inventory);
+    const users = Array.from({ length: 10000 }, (_, i) => `user-${i}`);
+
+    const reserveAll = () =>
+      Promise.allSettled(users.map(userId => service.reserve(userId, 'concert')));
+    const reserved = (results: PromiseSettledResult<string>[]) =>
+      results.filter((r): r is PromiseFulfilledResult<string> => r.status === 'fulfilled').map(r => r.value);
+
+    const firstWave = await reserveAll();
+    const held = reserved(firstWave);
+    expect(held).toHaveLength(inventory);
+    expect(firstWave.filter(r => r.status === 'rejected').every(r => (r as PromiseRejectedResult).reason instanceof RewardSoldOutError)).toBe(true);
+
+    // Every fifth holder abandons while the rest confirm, then a second wave competes for the returned units
+    await Promise.all(held.map((reservationId, i) => (i % 5 === 0 ? service.abandon(reservationId) : service.confirm(reservationId))));
+    const secondWave = reserved(await reserveAll());
+    expect(secondWave).toHaveLength(inventory / 5);
+    await Promise.all(secondWave.map(reservationId => service.confirm(reservationId)));
+
+    const audit = await service.audit('concert');
+    expect(audit).toMatchObject({ inventory, remaining: 0, active: 0, confirmed: inventory, released: inventory / 5, consistent: true });
+
+    // Each confirmed reservation has exactly one ledger debit
+    const committed = [...reservations.values()].filter(r => r.status === ReservationStatus.COMMITTED);
+    expect(entries).toHaveLength(committed.length);
+    expect(new Set(entries.map(e => e.correlationId))).toEqual(new Set(committed.map(r => r.reservationId)));
+  }, 30000);
+});
@@ -0,0 +1,381 @@
+/**
+ * Reward Drop Service
+ *
+ * Flash-sale redemption of limited-inventory rewards. A redemption is a
+ * reservation followed by a confirm or an abandon:
+ * - reserve() checks the user can cover the cost, claims one unit of the
+ *   drop's inventory and holds the points as an ACTIVE points reservation
+ * - confirm() debits the wallet, commits the reservation and debits the
+ *   points on the ledger
+ * - abandon(), or expiry of the hold, releases it and returns the unit
+ *
+ * Inventory claims on one item are queued in arrival order within the
+ * process, and each claim is a conditional $inc on the drop's remaining
+ * count, so concurrent instances never claim more units than exist.
+ * Every unit is held by at most one ACTIVE or COMMITTED reservation,
+ * so confirmed redemptions can never exceed the inventory.
+ *
+ * Audit: reservations for drops carry the itemId and are kept after
+ * expiry, and each confirmed reservation has exactly one ledger debit
+ * under the idempotency key `reward-drop-<reservationId>` with the
+ * reservation ID as its correlation ID. The wallet is debited with
+ * applyWalletDelta under the same key before the reservation is
+ * committed, so a wallet that no longer covers the cost abandons the
+ * reservation instead of leaving a ledger debit the wallet never took;
+ * the entry's own wallet step is then a no-op. A wallet debit whose
+ * reservation is abandoned or expires instead of committing is returned
+ * under `reward-drop-<reservationId>-return`. audit() rebuilds the
+ * drop's counts from the reservations.
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { ReservationService } from './service';
+import { HoldAwareBalance } from './affordability';
+import { ReservationModel, ReservationStatus } from '../db/models/reservation.model';
+import { RewardDropModel, IRewardDrop } from '../db/models/reward-drop.model';
+import { applyWalletDelta, findWalletApplication } from '../wallets/wallet-application';
+import { LedgerEntry, UserIdTokenizer } from '../ledger/types';
+import { LedgerService } from '../ledger/ledger.service';
+import {
+  InsufficientBalanceError,
+  ReservationNotActiveError,
+  RewardSoldOutError,
+  UserIdRejectedError,
+} from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+/**
+ * Configuration for the reward drop service
+ */
+export interface RewardDropConfig {
+  /** How long a reservation holds its unit and points before it lapses */
+  holdTtlMs: number;
+
+  /** Currency stamped on redemption entries */
+  defaultCurrency: string;
+
+  /** The ledger's userIdTokenizer (user IDs are stored as given when unset) */
+  userIdTokenizer?: UserIdTokenizer;
+}
+
+const DEFAULT_CONFIG: RewardDropConfig = {
+  holdTtlMs: 5 * 60 * 1000,
+  defaultCurrency: 'points',
+};
+
+/**
+ * A drop's reservation counts, rebuilt from its reservations
+ */
+export interface RewardDropAudit {
+  itemId: string;
+  inventory: number;
+  remaining: number;
+  active: number;
+  confirmed: number;
+  released: number;
+  expired: number;
+
+  /** Whether remaining equals inventory less active and confirmed reservations */
+  consistent: boolean;
+}
+
+type DropLedger = Pick<LedgerService, 'createEntryWithResult' | 'getBalanceSnapshot'>;
+
+/**
+ * Reward Drop Service Implementation
+ */
+export class RewardDropService {
+  private config: RewardDropConfig;
+  private ledgerService: DropLedger;
+  private reservations: ReservationService;
+  private balances: HoldAwareBalance;
+  private claimQueues = new Map<string, Promise<void>>();
+  private started = false;
+
+  constructor(
+    ledgerService: DropLedger,
+    reservations: ReservationService,
+    config: Partial<RewardDropConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+    this.reservations = reservations;
+    this.balances = new HoldAwareBalance(ledgerService, reservations);
+  }
+
+  /**
+   * Return the inventory of drop reservations as they expire
+   * Registers with the reservation expiry sweeper, which claims each
+   * expiry atomically, so a unit is returned exactly once.
+   */
+  start(): void {
+    if (this.started) {
+      return;
+    }
+    this.started = true;
+
+    this.reservations.onReservationExpired(async (_userId, _amount, reservationId) => {
+      const reservation = await this.reservations.getReservation(reservationId);
+      if (reservation && reservation.itemId) {
+        await this.returnWalletDebit(reservationId);
+        await this.returnUnit(reservation.itemId);
+      }
+    });
+  }
+
+  /**
+   * Release a drop with a fixed inventory
+   */
+  async createDrop(itemId: string, cost: number, inventory: number): Promise<IRewardDrop> {
+    if (!Number.isInteger(cost) || cost < 1) {
+      throw new Error(`Reward cost must be a positive integer, got ${cost}`);
+    }
+    if (!Number.isInteger(inventory) || inventory < 0) {
+      throw new Error(`Reward inventory must be a non-negative integer, got ${inventory}`);
+    }
+
+    return RewardDropModel.create({ itemId, cost, inventory, remaining: inventory });
+  }
+
+  /**
+   * Claim one unit of a drop and hold the user's points for it
+   *
+   * @returns The reservation ID to confirm or abandon
+   * @throws InsufficientBalanceError if available points less active holds do not cover the cost
+   * @throws RewardSoldOutError if no unit is left
+   */
+  async reserve(userId: string, itemId: string): Promise<string> {
+    const drop = await RewardDropModel.findOne({ itemId: { $eq: itemId } }).lean().exec();
+    if (!drop) {
+      throw new Error(`Reward drop not found: ${itemId}`);
+    }
+
+    const { canRedeem, available } = await this.balances.canRedeem(userId, drop.cost);
+    if (!canRedeem) {
+      throw new InsufficientBalanceError(drop.cost, available);
+    }
+
+    const claimed = await this.serialize(itemId, () =>
+      RewardDropModel.findOneAndUpdate(
+        { itemId: { $eq: itemId }, remaining: { $gt: 0 } },
+        { $inc: { remaining: -1 } },
+        { new: true }
+      ).exec()
+    );
+    if (!claimed) {
+      throw new RewardSoldOutError(itemId);
+    }
+
+    const reservationId = uuidv4();
+    try {
+      await this.reservations.createReservation({
+        reservationId,
+        userId,
+        amount: drop.cost,
+        expiresAt: new Date(Date.now() + this.config.holdTtlMs),
+        itemId,
+      });
+    } catch (error) {
+      await this.returnUnit(itemId);
+      throw error;
+    }
+
+    return reservationId;
+  }
+
+  /**
+   * Convert a reservation into a redemption
+   * Re-confirming a confirmed reservation returns its ledger entry, so
+   * a confirm interrupted after the commit can be retried.
+   *
+   * @throws ReservationNotActiveError if the reservation was abandoned or has expired
+   * @throws InsufficientBalanceError if the points were spent since the reservation
+   *   or the wallet no longer covers them; the reservation is abandoned
+   * @throws UserIdRejectedError if the tokenizer rejects the user's ID
+   */
+  async confirm(reservationId: string): Promise<LedgerEntry> {
+    const reservation = await this.reservations.getReservation(reservationId);
+    if (!reservation || !reservation.itemId) {
+      throw new ReservationNotActiveError(reservationId, 'not found');
+    }
+
+    if (reservation.status === ReservationStatus.ACTIVE) {
+      if (new Date(reservation.expiresAt).getTime() <= Date.now()) {
+        throw new ReservationNotActiveError(reservationId, ReservationStatus.EXPIRED);
+      }
+    } else if (reservation.status !== ReservationStatus.COMMITTED) {
+      throw new ReservationNotActiveError(reservationId, reservation.status);
+    }
+
+    const snapshot = await this.ledgerService.getBalanceSnapshot(reservation.userId, 'user');
+
+    if (reservation.status === ReservationStatus.ACTIVE) {
+      if (snapshot.availableBalance < reservation.amount) {
+        await this.abandon(reservationId);
+        throw new InsufficientBalanceError(reservation.amount, snapshot.availableBalance);
+      }
+
+      // Take the points from the wallet first: a wallet that cannot cover
+      // them must stop the confirm before the reservation is committed
+      try {
+        await applyWalletDelta(
+          await this.storedUserId(reservation.userId),
+          -reservation.amount,
+          redemptionKey(reservationId)
+        );
+      } catch (error) {
+        if (error instanceof InsufficientBalanceError) {
+          await this.abandon(reservationId);
+        }
+        throw error;
+      }
+
+      const committed = await this.reservations.commitReservation({ reservationId });
+      if (!committed) {
+        // Abandoned or expired between the read and the commit
+        await this.returnWalletDebit(reservationId);
+        throw new ReservationNotActiveError(reservationId, 'no longer active');
+      }
+    }
+
+    const { entry } = await this.ledgerService.createEntryWithResult({
+      transactionId: uuidv4(),
+      accountId: reservation.userId,
+      accountType: 'user',
+      amount: -reservation.amount,
+      type: TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: 'available→none',
+      reason: TransactionReason.REWARD_DROP_REDEMPTION,
+      idempotencyKey: redemptionKey(reservationId),
+      requestId: redemptionKey(reservationId),
+      balanceBefore: snapshot.availableBalance,
+      balanceAfter: snapshot.availableBalance - reservation.amount,
+      currency: this.config.defaultCurrency,
+      correlationId: reservationId,
+      featureType: 'reward_drop',
+      metadata: { itemId: reservation.itemId, reservationId },
+    });
+
+    // The wallet was debited before the commit, so this only re-applies a debit taken by an older confirm
+    await applyWalletDelta(entry.accountId, entry.amount, entry.idempotencyKey);
+
+    return entry;
+  }
+
+  /**
+   * Release a reservation and return its unit to the drop
+   *
+   * @returns Whether the reservation was active and is now released
+   */
+  async abandon(reservationId: string): Promise<boolean> {
+    const released = await this.reservations.releaseReservation({ reservationId });
+    if (!released || !released.itemId) {
+      return false;
+    }
+
+    await this.returnWalletDebit(reservationId);
+    await this.returnUnit(released.itemId);
+    return true;
+  }
+
+  /**
+   * Rebuild a drop's counts from its reservations
+   */
+  async audit(itemId: string): Promise<RewardDropAudit> {
+    const drop = await RewardDropModel.findOne({ itemId: { $eq: itemId } }).lean().exec();
+    if (!drop) {
+      throw new Error(`Reward drop not found: ${itemId}`);
+    }
+
+    const rows = await ReservationModel.aggregate([
+      { $match: { itemId: { $eq: itemId } } },
+      { $group: { _id: '$status', count: { $sum: 1 } } },
+    ]).exec();
+    const count = (status: ReservationStatus) => {
+      const row = rows.find((r: any) => r._id === status);
+      return row ? row.count : 0;
+    };
+
+    const active = count(ReservationStatus.ACTIVE);
+    const confirmed = count(ReservationStatus.COMMITTED);
+
+    return {
+      itemId,
+      inventory: drop.inventory,
+      remaining: drop.remaining,
+      active,
+      confirmed,
+      released: count(ReservationStatus.RELEASED),
+      expired: count(ReservationStatus.EXPIRED),
+      consistent: drop.remaining === drop.inventory - active - confirmed,
+    };
+  }
+
+  /**
+   * Return the wallet debit of a confirm whose reservation did not commit
+   * The return is keyed by the reservation, so the confirm and the abandon
+   * or expiry that beat it can both call this and it moves the wallet once.
+   */
+  private async returnWalletDebit(reservationId: string): Promise<void> {
+    const debit = await findWalletApplication(redemptionKey(reservationId));
+    if (debit) {
+      await applyWalletDelta(debit.userId, -debit.delta, `${redemptionKey(reservationId)}-return`);
+    }
+  }
+
+  /**
+   * The account ID the ledger stores for a user, which keys its wallet
+   */
+  private async storedUserId(userId: string): Promise<string> {
+    if (!this.config.userIdTokenizer) {
+      return userId;
+    }
+
+    try {
+      return await this.config.userIdTokenizer(userId);
+    } catch (error) {
+      throw new UserIdRejectedError(error);
+    }
+  }
+
+  private async returnUnit(itemId: string): Promise<void> {
+    await RewardDropModel.updateOne({ itemId: { $eq: itemId } }, { $inc: { remaining: 1 } }).exec();
+  }
+
+  /**
+   * Run claims on one item one at a time, in arrival order
+   */
+  private async serialize<T>(itemId: string, claim: () => Promise<T>): Promise<T> {
+    const previous = this.claimQueues.get(itemId) || Promise.resolve();
+    const run = previous.then(claim);
+    const tail = run.then(
+      () => undefined,
+      () => undefined
+    );
+    this.claimQueues.set(itemId, tail);
+
+    try {
+      return await run;
+    } finally {
+      if (this.claimQueues.get(itemId) === tail) {
+        this.claimQueues.delete(itemId);
+      }
+    }
+  }
+}
+
+function redemptionKey(reservationId: string): string {
+  return `reward-drop-${reservationId}`;
+}
+
+/**
+ * Factory function to create a reward drop service
+ */
+export function createRewardDropService(
+  ledgerService: DropLedger,
+  reservations: ReservationService,
+  config?: Partial<RewardDropConfig>
+): RewardDropService {
+  return new RewardDropService(ledgerService, reservations, config);
+}
@@ -0,0 +1,113 @@
+/**
+ * Reservation Service Tests
+ */
+
+import { ReservationService } from './service';
+import { ReservationModel, ReservationStatus } from '../db/models/reservation.model';
+
+// Mock mongoose models
+jest.mock('../db/models/reservation.model');
+
+describe('ReservationService', () => {
+  let service: ReservationService;
+
+  const mockCandidates = (candidates: any[]) => {
+    (ReservationModel.find as jest.Mock).mockReturnValue({
+      sort: jest.fn().mockReturnThis(),
+      limit: jest.fn().mockResolvedValue(candidates),
+    });
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    service = new ReservationService({ sweepIntervalMs: 1000 });
+  });
+
+  afterEach(() => {
+    service.close();
+    jest.useRealTimers();
+  });
+
+  describe('sweepExpiredReservations', () => {
+    it('should fire the expiry callback for a lapsed reservation', async () => {
+      const reservation = {
+        reservationId: 'res-1',
+        userId: 'user-123',
+        amount: 250,
+        status: ReservationStatus.EXPIRED,
+      };
+      mockCandidates([{ reservationId: 'res-1' }]);
+      (ReservationModel.findOneAndUpdate as jest.Mock).mockResolvedValue(reservation);
+
+      const handler = jest.fn();
+      service.onReservationExpired(handler);
+
+      const count = await service.sweepExpiredReservations();
+
+      expect(count).toBe(1);
+      expect(handler).toHaveBeenCalledWith('user-123', 250, 'res-1');
+      expect(ReservationModel.findOneAndUpdate).toHaveBeenCalledWith(
+        { reservationId: 'res-1', status: ReservationStatus.ACTIVE },
+        expect.objectContaining({
+          $set: expect.objectContaining({ status: ReservationStatus.EXPIRED }),
+        }),
+        { new: true }
+      );
+    });
+
+    it('should not fire the callback when the reservation was committed first', async () => {
+      mockCandidates([{ reservationId: 'res-2' }]);
+      (ReservationModel.findOneAndUpdate as jest.Mock).mockResolvedValue(null);
+
+      const handler = jest.fn();
+      service.onReservationExpired(handler);
+
+      const count = await service.sweepExpiredReservations();
+
+      expect(count).toBe(0);
+      expect(handler).not.toHaveBeenCalled();
+    });
+
+    it('should keep notifying remaining handlers when one throws', async () => {
+      mockCandidates([{ reservationId: 'res-3' }]);
+      (ReservationModel.findOneAndUpdate as jest.Mock).mockResolvedValue({
+        reservationId: 'res-3',
+        userId: 'user-456',
+        amount: 10,
+      });
+
+      const failing = jest.fn().mockRejectedValue(new Error('notify failed'));
+      const succeeding = jest.fn();
+      service.onReservationExpired(failing);
+      service.onReservationExpired(succeeding);
+
+      await service.sweepExpiredReservations();
+
+      expect(failing).toHaveBeenCalled();
+      expect(succeeding).toHaveBeenCalledWith('user-456', 10, 'res-3');
+    });
+  });
+
+  describe('expiry sweeper', () => {
+    it('should sweep on the configured tick', async () => {
+      jest.useFakeTimers();
+      mockCandidates([]);
+
+      service.onReservationExpired(jest.fn());
+      await jest.advanceTimersByTimeAsync(1000);
+
+      expect(ReservationModel.find).toHaveBeenCalledTimes(1);
+    });
+
+    it('should stop sweeping after close', async () => {
+      jest.useFakeTimers();
+      mockCandidates([]);
+
+      service.onReservationExpired(jest.fn());
+      service.close();
+      await jest.advanceTimersByTimeAsync(5000);
+
+      expect(ReservationModel.find).not.toHaveBeenCalled();
+    });
+  });
+});
@@ -5,15 +5,30 @@
  */
 
 import { ReservationModel, ReservationStatus, IReservation } from '../db/models/reservation.model';
-import { MetricsLogger, MetricEventType } from '../metrics';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
 import {
   CreateReservationRequest,
   CommitReservationRequest,
   ReleaseReservationRequest,
   ReservationStats,
+  ReservationExpiredHandler,
+  ReservationServiceConfig,
 } from './types';
 
+const DEFAULT_CONFIG: ReservationServiceConfig = {
+  sweepIntervalMs: 60000,
+  sweepBatchSize: 1000,
+};
+
 export class ReservationService {
+  private config: ReservationServiceConfig;
+  private expiredHandlers: ReservationExpiredHandler[] = [];
+  private sweepInterval?: NodeJS.Timeout;
+
+  constructor(config: Partial<ReservationServiceConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
   /**
    * Create a new reservation
    */
@@ -25,6 +40,7 @@ export class ReservationService {
       status: ReservationStatus.ACTIVE,
       expiresAt: request.expiresAt,
       sourceCorrelationId: request.sourceCorrelationId,
+      itemId: request.itemId,
     });
 
     // Log reservation created metric
@@ -130,6 +146,112 @@ export class ReservationService {
     return expiredCount;
   }
 
+  /**
+   * Register a callback fired when a reservation expires without commit.
+   * The first registration starts the background expiry sweeper.
+   */
+  onReservationExpired(handler: ReservationExpiredHandler): void {
+    this.expiredHandlers.push(handler);
+
+    if (!this.sweepInterval) {
+      this.sweepInterval = setInterval(() => {
+        void this.sweepExpiredReservations().catch((error) => {
+          MetricsLogger.logAlert({
+            severity: AlertSeverity.ERROR,
+            message: 'Reservation expiry sweep failed',
+            metricType: MetricEventType.RESERVATION_EXPIRED,
+            timestamp: new Date(),
+            metadata: {
+              error: error instanceof Error ? error.message : 'Unknown error',
+            },
+          });
+        });
+      }, this.config.sweepIntervalMs);
+    }
+  }
+
+  /**
+   * Expire lapsed reservations one at a time and notify expiry handlers.
+   * Each reservation is claimed atomically so a concurrent commit or a
+   * second sweeper never causes a double notification.
+   */
+  async sweepExpiredReservations(): Promise<number> {
+    const now = new Date();
+
+    const candidates = await ReservationModel.find({
+      status: ReservationStatus.ACTIVE,
+      expiresAt: { $lte: now },
+    })
+      .sort({ expiresAt: 1 })
+      .limit(this.config.sweepBatchSize);
+
+    let expiredCount = 0;
+
+    for (const candidate of candidates) {
+      const reservation = await ReservationModel.findOneAndUpdate(
+        {
+          reservationId: candidate.reservationId,
+          status: ReservationStatus.ACTIVE,
+        },
+        {
+          $set: {
+            status: ReservationStatus.EXPIRED,
+            updatedAt: now,
+          },
+        },
+        { new: true }
+      );
+
+      if (!reservation) {
+        continue;
+      }
+
+      expiredCount++;
+      await this.notifyExpired(reservation);
+    }
+
+    if (expiredCount > 0) {
+      MetricsLogger.incrementCounter(MetricEventType.RESERVATION_EXPIRED, {
+        count: expiredCount,
+      });
+    }
+
+    return expiredCount;
+  }
+
+  /**
+   * Stop the expiry sweeper
+   */
+  close(): void {
+    if (this.sweepInterval) {
+      clearInterval(this.sweepInterval);
+      this.sweepInterval = undefined;
+    }
+  }
+
+  /**
+   * Invoke expiry handlers, isolating failures so one handler cannot
+   * prevent the others from running
+   */
+  private async notifyExpired(reservation: IReservation): Promise<void> {
+    for (const handler of this.expiredHandlers) {
+      try {
+        await handler(reservation.userId, reservation.amount, reservation.reservationId);
+      } catch (error) {
+        MetricsLogger.logAlert({
+          severity: AlertSeverity.WARNING,
+          message: 'Reservation expiry handler failed',
+          metricType: MetricEventType.RESERVATION_EXPIRED,
+          timestamp: new Date(),
+          metadata: {
+            reservationId: reservation.reservationId,
+            error: error instanceof Error ? error.message : 'Unknown error',
+          },
+        });
+      }
+    }
+  }
+
   /**
    * Get reservation statistics
    */
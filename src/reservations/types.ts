@@ -8,6 +8,7 @@ export interface CreateReservationRequest {
   amount: number;
   expiresAt: Date;
   sourceCorrelationId?: string;
+  itemId?: string;
 }
 
 export interface CommitReservationRequest {
@@ -24,3 +25,20 @@ export interface ReservationStats {
   totalReleased: number;
   totalExpired: number;
 }
+
+/**
+ * Callback invoked when an active reservation lapses without being committed
+ */
+export type ReservationExpiredHandler = (
+  userId: string,
+  amount: number,
+  reservationId: string
+) => void | Promise<void>;
+
+export interface ReservationServiceConfig {
+  /** How often the expiry sweeper checks for lapsed reservations */
+  sweepIntervalMs: number;
+
+  /** Maximum reservations expired per sweep */
+  sweepBatchSize: number;
+}
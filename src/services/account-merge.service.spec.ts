@@ -0,0 +1,273 @@
+/**
+ * Account Merge Service Tests
+ */
+
+import { AccountMergeService } from './account-merge.service';
+import { AccountAlreadyMergedError, AccountFrozenError, OptimisticLockError } from './types';
+import { ILedgerService } from '../ledger/types';
+import { WalletModel } from '../db/models/wallet.model';
+import { AccountMergeModel } from '../db/models/account-merge.model';
+
+// Mock mongoose models
+jest.mock('../db/models/wallet.model');
+jest.mock('../db/models/account-merge.model');
+
+describe('AccountMergeService', () => {
+  let service: AccountMergeService;
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  const wallet = (userId: string, availableBalance: number, extra: Record<string, any> = {}) => ({
+    userId,
+    availableBalance,
+    escrowBalance: 0,
+    version: 1,
+    frozen: false,
+    ...extra,
+  });
+
+  const mockWallets = (wallets: Record<string, any>) => {
+    (WalletModel.findOne as jest.Mock).mockImplementation((query: any) =>
+      Promise.resolve(wallets[query.userId.$eq] || null)
+    );
+  };
+
+  const session = {
+    withTransaction: jest.fn(async (fn: () => Promise<void>) => fn()),
+    endSession: jest.fn(),
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockLedgerService = {
+      createEntry: jest.fn().mockResolvedValue({}),
+      queryEntries: jest.fn(),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+    service = new AccountMergeService(mockLedgerService);
+
+    (AccountMergeModel.findOne as jest.Mock).mockResolvedValue(null);
+    (AccountMergeModel.create as jest.Mock).mockResolvedValue([{}]);
+    (AccountMergeModel.startSession as jest.Mock).mockResolvedValue(session);
+    (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue({});
+  });
+
+  describe('mergeAccounts', () => {
+    it('should move the source balance with a linked debit/credit pair', async () => {
+      mockWallets({
+        'user-old': wallet('user-old', 300),
+        'user-new': wallet('user-new', 50),
+      });
+
+      const result = await service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-1');
+
+      expect(result.amountMoved).toBe(300);
+      expect(AccountMergeModel.create).toHaveBeenCalledWith(
+        [
+          expect.objectContaining({
+            fromUserId: 'user-old',
+            toUserId: 'user-new',
+            targetBalanceBefore: 50,
+            committedBy: 'support-1',
+          }),
+        ],
+        { session }
+      );
+
+      expect(mockLedgerService.createEntry).toHaveBeenCalledTimes(2);
+      const [debit] = mockLedgerService.createEntry.mock.calls[0];
+      const [credit] = mockLedgerService.createEntry.mock.calls[1];
+      expect(debit).toMatchObject({ accountId: 'user-old', amount: -300, balanceAfter: 0 });
+      expect(credit).toMatchObject({ accountId: 'user-new', amount: 300, balanceAfter: 350 });
+      expect(debit.correlationId).toBe(result.correlationId);
+      expect(credit.correlationId).toBe(result.correlationId);
+      expect(debit.transactionId).toBe(credit.transactionId);
+    });
+
+    it('should pass a negative source balance on to the target as a debt', async () => {
+      mockWallets({
+        'user-old': wallet('user-old', -120),
+        'user-new': wallet('user-new', 50),
+      });
+
+      const result = await service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-1');
+
+      expect(result.amountMoved).toBe(-120);
+      const [drain, credit] = (WalletModel.findOneAndUpdate as jest.Mock).mock.calls;
+      expect(drain[1]).toMatchObject({ $set: { availableBalance: 0 } });
+      expect(credit[1]).toMatchObject({ $inc: { availableBalance: -120 } });
+      expect(AccountMergeModel.create).toHaveBeenCalledWith(
+        [expect.objectContaining({ amountMoved: -120, targetBalanceBefore: 50 })],
+        { session }
+      );
+
+      expect(mockLedgerService.createEntry).toHaveBeenCalledTimes(2);
+      const [sourceLeg] = mockLedgerService.createEntry.mock.calls[0];
+      const [targetLeg] = mockLedgerService.createEntry.mock.calls[1];
+      expect(sourceLeg).toMatchObject({
+        accountId: 'user-old',
+        amount: 120,
+        type: 'credit',
+        balanceBefore: -120,
+        balanceAfter: 0,
+      });
+      expect(targetLeg).toMatchObject({
+        accountId: 'user-new',
+        amount: -120,
+        type: 'debit',
+        balanceBefore: 50,
+        balanceAfter: -70,
+      });
+    });
+
+    it('should not create the target wallet for a merge it rejects', async () => {
+      mockWallets({ 'user-old': wallet('user-old', 300, { escrowBalance: 25 }) });
+
+      await expect(
+        service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-1')
+      ).rejects.toThrow('points held in escrow');
+      expect(WalletModel.create).not.toHaveBeenCalled();
+      expect(AccountMergeModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should drain, credit and claim the alias in one transaction', async () => {
+      mockWallets({
+        'user-old': wallet('user-old', 300),
+        'user-new': wallet('user-new', 50),
+      });
+
+      await service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-1');
+
+      expect(session.withTransaction).toHaveBeenCalledTimes(1);
+      for (const [, , options] of (WalletModel.findOneAndUpdate as jest.Mock).mock.calls) {
+        expect(options).toMatchObject({ session });
+      }
+      const claimOrder = (AccountMergeModel.create as jest.Mock).mock.invocationCallOrder[0];
+      const creditOrder = (WalletModel.findOneAndUpdate as jest.Mock).mock.invocationCallOrder[1];
+      expect(claimOrder).toBeGreaterThan(creditOrder);
+      expect(session.endSession).toHaveBeenCalled();
+    });
+
+    it('should claim nothing and append nothing when the credit loses a race', async () => {
+      mockWallets({
+        'user-old': wallet('user-old', 300),
+        'user-new': wallet('user-new', 50),
+      });
+      (WalletModel.findOneAndUpdate as jest.Mock)
+        .mockResolvedValueOnce({})
+        .mockResolvedValueOnce(null);
+
+      await expect(
+        service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-1')
+      ).rejects.toThrow(OptimisticLockError);
+      expect(AccountMergeModel.create).not.toHaveBeenCalled();
+      expect(mockLedgerService.createEntry).not.toHaveBeenCalled();
+      expect(session.endSession).toHaveBeenCalled();
+    });
+
+    it('should complete a recorded merge on retry by re-appending its legs', async () => {
+      const createdAt = new Date('2024-01-01T00:00:00Z');
+      (AccountMergeModel.findOne as jest.Mock).mockImplementation((query: any) =>
+        Promise.resolve(
+          query.fromUserId.$eq === 'user-old'
+            ? {
+                mergeId: 'merge-1',
+                fromUserId: 'user-old',
+                toUserId: 'user-new',
+                transactionId: 'txn-1',
+                correlationId: 'account-merge-merge-1',
+                amountMoved: 300,
+                targetBalanceBefore: 50,
+                committedBy: 'support-1',
+                createdAt,
+              }
+            : null
+        )
+      );
+
+      const result = await service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-retry');
+
+      expect(result).toMatchObject({ mergeId: 'merge-1', amountMoved: 300, timestamp: createdAt });
+      expect(WalletModel.findOneAndUpdate).not.toHaveBeenCalled();
+      expect(AccountMergeModel.create).not.toHaveBeenCalled();
+      const keys = mockLedgerService.createEntry.mock.calls.map(([entry]) => entry.idempotencyKey);
+      expect(keys).toEqual(['account-merge-merge-1_debit', 'account-merge-merge-1_credit']);
+      expect(mockLedgerService.createEntry.mock.calls[1][0]).toMatchObject({ balanceAfter: 350 });
+    });
+
+    it('should reject merging an already-merged account', async () => {
+      (AccountMergeModel.findOne as jest.Mock).mockImplementation((query: any) =>
+        Promise.resolve(query.fromUserId.$eq === 'user-old' ? { toUserId: 'user-other' } : null)
+      );
+
+      await expect(
+        service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-2')
+      ).rejects.toThrow(AccountAlreadyMergedError);
+      expect(mockLedgerService.createEntry).not.toHaveBeenCalled();
+    });
+
+    it('should reject merging into an account that was merged away', async () => {
+      (AccountMergeModel.findOne as jest.Mock).mockImplementation((query: any) =>
+        Promise.resolve(query.fromUserId.$eq === 'user-new' ? { toUserId: 'user-other' } : null)
+      );
+
+      await expect(
+        service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-3')
+      ).rejects.toThrow(AccountAlreadyMergedError);
+    });
+
+    it('should reject merging a frozen account', async () => {
+      mockWallets({
+        'user-old': wallet('user-old', 300, { frozen: true }),
+        'user-new': wallet('user-new', 50),
+      });
+
+      await expect(
+        service.mergeAccounts('user-old', 'user-new', 'support-1', 'req-4')
+      ).rejects.toThrow(AccountFrozenError);
+      expect(AccountMergeModel.create).not.toHaveBeenCalled();
+    });
+
+    it('should reject merging an account into itself', async () => {
+      await expect(
+        service.mergeAccounts('user-old', 'user-old', 'support-1', 'req-5')
+      ).rejects.toThrow('Cannot merge an account into itself');
+    });
+  });
+
+  describe('resolveAccountId', () => {
+    it('should return unmerged IDs unchanged', async () => {
+      await expect(service.resolveAccountId('user-123')).resolves.toBe('user-123');
+    });
+
+    it('should follow merge chains to the surviving account', async () => {
+      const aliases: Record<string, string> = { 'user-a': 'user-b', 'user-b': 'user-c' };
+      (AccountMergeModel.findOne as jest.Mock).mockImplementation((query: any) => {
+        const toUserId = aliases[query.fromUserId.$eq];
+        return Promise.resolve(toUserId ? { toUserId } : null);
+      });
+
+      await expect(service.resolveAccountId('user-a')).resolves.toBe('user-c');
+    });
+  });
+
+  describe('aliasesOf', () => {
+    it('should list every account merged in, through chains', async () => {
+      const merges = [
+        { fromUserId: 'user-a', toUserId: 'user-b' },
+        { fromUserId: 'user-b', toUserId: 'user-c' },
+        { fromUserId: 'user-d', toUserId: 'user-c' },
+      ];
+      (AccountMergeModel.find as jest.Mock).mockImplementation((query: any) => ({
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(merges.filter(m => query.toUserId.$in.includes(m.toUserId))),
+      }));
+
+      await expect(service.aliasesOf('user-c')).resolves.toEqual(['user-b', 'user-d', 'user-a']);
+    });
+  });
+});
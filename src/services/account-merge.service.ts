@@ -0,0 +1,359 @@
+/**
+ * Account Merge Service
+ *
+ * Consolidates duplicate user accounts. Because ledger entries are
+ * immutable, a merge is forward-only linkage:
+ * - A leg on the source and a leg on the target move the source's
+ *   available balance, sharing one transaction and correlation ID. A
+ *   source left negative by a clawback passes its debt on the same way,
+ *   with a credit on the source and a debit on the target
+ * - An immutable merge record maps the source ID to the target ID
+ * - Balance and query APIs resolve merged IDs through that alias map,
+ *   and queries on the surviving account also return the entries of the
+ *   accounts merged into it
+ *
+ * The wallet drain, the wallet credit and the merge record commit in one
+ * MongoDB transaction, which requires a replica set. The ledger pair is
+ * appended after the commit under keys derived from the record, so a
+ * merge interrupted between the two is completed by retrying it.
+ *
+ * Un-merge is out of scope. The merge record plus the paired ledger
+ * entries are sufficient to reconstruct exactly what a merge did.
+ *
+ * @module services/account-merge
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { ILedgerService, IAccountAliasResolver, CreateLedgerEntryRequest } from '../ledger/types';
+import { WalletModel } from '../db/models/wallet.model';
+import { AccountMergeModel, IAccountMerge } from '../db/models/account-merge.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import {
+  AccountAlreadyMergedError,
+  AccountFrozenError,
+  OptimisticLockError,
+} from './types';
+
+/**
+ * Result of an account merge
+ */
+export interface MergeResult {
+  /** Merge record identifier */
+  mergeId: string;
+
+  /** Account merged away */
+  fromUserId: string;
+
+  /** Surviving account */
+  toUserId: string;
+
+  /** Available balance moved from source to target (negative for a debt) */
+  amountMoved: number;
+
+  /** Transaction ID shared by both ledger entries */
+  transactionId: string;
+
+  /** Correlation ID shared by both ledger entries */
+  correlationId: string;
+
+  /** Merge timestamp */
+  timestamp: Date;
+}
+
+/**
+ * Configuration for the account merge service
+ */
+export interface AccountMergeConfig {
+  /** Default currency */
+  defaultCurrency: string;
+
+  /** Maximum alias hops followed when resolving an account */
+  maxAliasDepth: number;
+}
+
+const DEFAULT_CONFIG: AccountMergeConfig = {
+  defaultCurrency: 'points',
+  maxAliasDepth: 16,
+};
+
+/**
+ * Account Merge Service Implementation
+ */
+export class AccountMergeService implements IAccountAliasResolver {
+  private config: AccountMergeConfig;
+  private ledgerService: ILedgerService;
+
+  constructor(
+    ledgerService: ILedgerService,
+    config: Partial<AccountMergeConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Merge one user account into another
+   *
+   * @param fromUserId Duplicate account to merge away
+   * @param toUserId Surviving account
+   * @param committedBy Operator or service performing the merge
+   * @param requestId Request ID for tracing
+   * @returns Merge result; retrying a recorded merge returns its original result
+   * @throws AccountAlreadyMergedError if either account was already merged away
+   * @throws AccountFrozenError if either account is frozen
+   */
+  async mergeAccounts(
+    fromUserId: string,
+    toUserId: string,
+    committedBy: string,
+    requestId: string
+  ): Promise<MergeResult> {
+    if (!fromUserId || !toUserId) {
+      throw new Error('Both source and target user IDs are required');
+    }
+
+    if (fromUserId === toUserId) {
+      throw new Error('Cannot merge an account into itself');
+    }
+
+    if (!committedBy) {
+      throw new Error('committedBy is required for account merges');
+    }
+
+    // Neither side may already have been merged away. A record for this
+    // exact merge is a retry of one whose ledger legs may not all have
+    // landed, so it is completed rather than rejected.
+    for (const userId of [fromUserId, toUserId]) {
+      const existing = await AccountMergeModel.findOne({ fromUserId: { $eq: userId } });
+      if (existing && userId === fromUserId && existing.toUserId === toUserId) {
+        return this.appendMergeEntries(existing, requestId);
+      }
+      if (existing) {
+        throw new AccountAlreadyMergedError(userId, existing.toUserId);
+      }
+    }
+
+    const source = await WalletModel.findOne({ userId: { $eq: fromUserId } });
+    if (!source) {
+      throw new Error(`Wallet not found for user: ${fromUserId}`);
+    }
+
+    let target = await WalletModel.findOne({ userId: { $eq: toUserId } });
+
+    if (source.frozen) {
+      throw new AccountFrozenError(fromUserId);
+    }
+
+    if (target?.frozen) {
+      throw new AccountFrozenError(toUserId);
+    }
+
+    if (source.escrowBalance > 0) {
+      throw new Error('Cannot merge an account with points held in escrow');
+    }
+
+    // Only a merge that passed every check creates the target's wallet
+    if (!target) {
+      target = await WalletModel.create({
+        userId: toUserId,
+        availableBalance: 0,
+        escrowBalance: 0,
+        currency: this.config.defaultCurrency,
+        version: 0,
+      });
+    }
+
+    const mergeId = uuidv4();
+    const amountMoved = source.availableBalance;
+    const record = {
+      mergeId,
+      fromUserId,
+      toUserId,
+      transactionId: uuidv4(),
+      correlationId: `account-merge-${mergeId}`,
+      amountMoved,
+      targetBalanceBefore: target.availableBalance,
+      committedBy,
+    };
+    const sourceVersion = source.version;
+    const targetVersion = target.version;
+
+    // Drain, credit and claim commit together or not at all. The alias is
+    // claimed last: the unique fromUserId index aborts a concurrent merge
+    // of the same source along with its wallet updates.
+    const session = await AccountMergeModel.startSession();
+    try {
+      await session.withTransaction(async () => {
+        if (amountMoved !== 0) {
+          const drained = await WalletModel.findOneAndUpdate(
+            {
+              userId: { $eq: fromUserId },
+              version: { $eq: sourceVersion },
+            },
+            {
+              $set: { availableBalance: 0 },
+              $inc: { version: 1 },
+            },
+            { new: true, session }
+          );
+
+          if (!drained) {
+            throw new OptimisticLockError('wallet', fromUserId);
+          }
+
+          const credited = await WalletModel.findOneAndUpdate(
+            {
+              userId: { $eq: toUserId },
+              version: { $eq: targetVersion },
+            },
+            {
+              $inc: { availableBalance: amountMoved, version: 1 },
+            },
+            { new: true, session }
+          );
+
+          if (!credited) {
+            throw new OptimisticLockError('wallet', toUserId);
+          }
+        }
+
+        await AccountMergeModel.create([record], { session });
+      });
+    } finally {
+      await session.endSession();
+    }
+
+    return this.appendMergeEntries({ ...record, createdAt: new Date() }, requestId);
+  }
+
+  /**
+   * Append a committed merge's pair of legs
+   * The idempotency keys derive from the merge record, so re-running this
+   * for a merge whose legs already landed replays them.
+   */
+  private async appendMergeEntries(
+    merge: Pick<
+      IAccountMerge,
+      | 'mergeId'
+      | 'fromUserId'
+      | 'toUserId'
+      | 'transactionId'
+      | 'correlationId'
+      | 'amountMoved'
+      | 'targetBalanceBefore'
+      | 'committedBy'
+      | 'createdAt'
+    >,
+    requestId: string
+  ): Promise<MergeResult> {
+    const { mergeId, fromUserId, toUserId, transactionId, correlationId, amountMoved, committedBy } = merge;
+
+    if (amountMoved !== 0) {
+      const metadata = {
+        operationType: 'account_merge',
+        mergeId,
+        fromUserId,
+        toUserId,
+        committedBy,
+      };
+
+      await this.ledgerService.createEntry({
+        transactionId,
+        accountId: fromUserId,
+        accountType: 'user',
+        amount: -amountMoved,
+        ...this.legKind(-amountMoved),
+        balanceState: 'available',
+        idempotencyKey: `${correlationId}_debit`,
+        requestId,
+        balanceBefore: amountMoved,
+        balanceAfter: 0,
+        currency: this.config.defaultCurrency,
+        correlationId,
+        metadata,
+      });
+
+      await this.ledgerService.createEntry({
+        transactionId,
+        accountId: toUserId,
+        accountType: 'user',
+        amount: amountMoved,
+        ...this.legKind(amountMoved),
+        balanceState: 'available',
+        idempotencyKey: `${correlationId}_credit`,
+        requestId,
+        balanceBefore: merge.targetBalanceBefore,
+        balanceAfter: merge.targetBalanceBefore + amountMoved,
+        currency: this.config.defaultCurrency,
+        correlationId,
+        metadata,
+      });
+    }
+
+    return {
+      mergeId,
+      fromUserId,
+      toUserId,
+      amountMoved,
+      transactionId,
+      correlationId,
+      timestamp: merge.createdAt,
+    };
+  }
+
+  /**
+   * Type, transition and reason of a merge leg moving a signed amount
+   * The source's leg keeps its _debit key and the target's its _credit
+   * key even when a moved debt reverses their direction.
+   */
+  private legKind(amount: number): Pick<CreateLedgerEntryRequest, 'type' | 'stateTransition' | 'reason'> {
+    return amount < 0
+      ? { type: TransactionType.DEBIT, stateTransition: 'available→none', reason: TransactionReason.ADMIN_DEBIT }
+      : { type: TransactionType.CREDIT, stateTransition: 'none→available', reason: TransactionReason.ADMIN_CREDIT };
+  }
+
+  /**
+   * Resolve an account ID through the merge alias map
+   * Follows chains (A merged into B, B later merged into C)
+   */
+  async resolveAccountId(accountId: string): Promise<string> {
+    let current = accountId;
+
+    for (let depth = 0; depth < this.config.maxAliasDepth; depth++) {
+      const merge = await AccountMergeModel.findOne({ fromUserId: { $eq: current } });
+      if (!merge) {
+        return current;
+      }
+      current = merge.toUserId;
+    }
+
+    throw new Error(`Account alias chain too deep for: ${accountId}`);
+  }
+
+  /**
+   * Every account ID that resolves to accountId through the alias map,
+   * including those merged in through a chain
+   */
+  async aliasesOf(accountId: string): Promise<string[]> {
+    const aliases: string[] = [];
+    let frontier = [accountId];
+
+    for (let depth = 0; depth < this.config.maxAliasDepth && frontier.length > 0; depth++) {
+      const merges = await AccountMergeModel.find({ toUserId: { $in: frontier } }).lean().exec();
+      frontier = merges.map((merge: any) => merge.fromUserId);
+      aliases.push(...frontier);
+    }
+
+    return aliases;
+  }
+}
+
+/**
+ * Factory function to create account merge service
+ */
+export function createAccountMergeService(
+  ledgerService: ILedgerService,
+  config?: Partial<AccountMergeConfig>
+): AccountMergeService {
+  return new AccountMergeService(ledgerService, config);
+}
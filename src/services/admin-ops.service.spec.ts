@@ -0,0 +1,140 @@
+/**
+ * Admin Operations Service Tests
+ */
+
+import { AdminOpsService, AdminContext } from './admin-ops.service';
+import { ILedgerService } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { WalletModel } from '../db/models/wallet.model';
+
+// Mock mongoose models
+jest.mock('../db/models/wallet.model');
+
+describe('AdminOpsService', () => {
+  let service: AdminOpsService;
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  const admin: AdminContext = {
+    adminId: 'fraud-ops-1',
+    adminUsername: 'fraud-ops@example.com',
+    roles: ['admin'],
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    mockLedgerService = {
+      createEntry: jest.fn().mockResolvedValue({}),
+      queryEntries: jest.fn(),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+    service = new AdminOpsService(mockLedgerService, {} as any);
+
+    (WalletModel.findOne as jest.Mock).mockResolvedValue({
+      userId: 'user-123',
+      availableBalance: 200,
+      escrowBalance: 0,
+      version: 3,
+    });
+    (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue({});
+  });
+
+  describe('clawback', () => {
+    it('should drive the balance negative when the points were already spent', async () => {
+      const result = await service.clawback({
+        userId: 'user-123',
+        amount: 500,
+        reason: 'Stolen card purchase',
+        originalTransactionId: 'txn-earn-1',
+        admin,
+        requestId: 'req-1',
+      });
+
+      expect(result.newBalance).toBe(-300);
+      expect(WalletModel.findOneAndUpdate).toHaveBeenCalledWith(
+        expect.objectContaining({ version: { $eq: 3 } }),
+        { $inc: { availableBalance: -500, version: 1 } },
+        { new: true }
+      );
+    });
+
+    it('should tag the entry and link it to the original earn', async () => {
+      const result = await service.clawback({
+        userId: 'user-123',
+        amount: 50,
+        reason: 'Referral ring',
+        originalTransactionId: 'txn-earn-2',
+        admin,
+        requestId: 'req-2',
+      });
+
+      const [entry] = mockLedgerService.createEntry.mock.calls[0];
+      expect(entry).toMatchObject({
+        amount: -50,
+        type: TransactionType.DEBIT,
+        reason: TransactionReason.FRAUD_CLAWBACK,
+        correlationId: 'clawback-txn-earn-2',
+        balanceAfter: 150,
+      });
+      expect(entry.metadata).toMatchObject({
+        originalTransactionId: 'txn-earn-2',
+        adminId: 'fraud-ops-1',
+        adminReason: 'Referral ring',
+      });
+      expect(result.correlationId).toBe('clawback-txn-earn-2');
+    });
+
+    it('should require the original transaction reference', async () => {
+      await expect(
+        service.clawback({
+          userId: 'user-123',
+          amount: 50,
+          reason: 'Referral ring',
+          originalTransactionId: '',
+          admin,
+          requestId: 'req-3',
+        })
+      ).rejects.toThrow('Original transaction ID is required for clawbacks');
+    });
+
+    it('should still reject ordinary adjustments that overdraw', async () => {
+      await expect(
+        service.manualAdjustment({
+          userId: 'user-123',
+          amount: -500,
+          reason: 'Goodwill reversal',
+          admin,
+          requestId: 'req-4',
+        })
+      ).rejects.toThrow('Adjustment would result in negative balance');
+    });
+  });
+
+  describe('manualAdjustment', () => {
+    const adjustment = {
+      userId: 'user-123',
+      amount: 25,
+      reason: 'Goodwill',
+      admin,
+      requestId: 'req-5',
+    };
+
+    it('should derive the idempotency key from admin, user and request', async () => {
+      await service.manualAdjustment(adjustment);
+
+      expect(mockLedgerService.createEntry.mock.calls[0][0].idempotencyKey).toBe(
+        'admin-adjustment-fraud-ops-1-user-123-req-5'
+      );
+    });
+
+    it('should use a caller-supplied idempotency key', async () => {
+      await service.manualAdjustment({ ...adjustment, idempotencyKey: 'bulk-adjust-b1-row-1' });
+
+      expect(mockLedgerService.createEntry.mock.calls[0][0].idempotencyKey).toBe('bulk-adjust-b1-row-1');
+    });
+  });
+});
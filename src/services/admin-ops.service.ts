@@ -60,6 +60,15 @@ export interface ManualAdjustmentRequest {
   
   /** Additional metadata */
   metadata?: Record<string, any>;
+  
+  /** Ledger reason (defaults to ADMIN_CREDIT / ADMIN_DEBIT by sign) */
+  reasonCode?: TransactionReason;
+  
+  /** Correlation ID linking the entry to related transactions */
+  correlationId?: string;
+  
+  /** Ledger idempotency key (defaults to one derived from admin, user and request ID) */
+  idempotencyKey?: string;
 }
 
 /**
@@ -122,6 +131,49 @@ export interface AdminRefundResponse {
   timestamp: Date;
 }
 
+/**
+ * Request to claw back fraudulently earned points
+ */
+export interface ClawbackRequest {
+  /** User to claw back from */
+  userId: string;
+  
+  /** Amount to claw back (positive) */
+  amount: number;
+  
+  /** Fraud finding behind the clawback */
+  reason: string;
+  
+  /** Transaction ID of the fraudulent earn */
+  originalTransactionId: string;
+  
+  /** Admin performing the operation */
+  admin: AdminContext;
+  
+  /** Request ID for tracing */
+  requestId: string;
+}
+
+/**
+ * Response from a clawback
+ */
+export interface ClawbackResponse {
+  /** Transaction ID */
+  transactionId: string;
+  
+  /** Amount clawed back */
+  amountClawedBack: number;
+  
+  /** New balance (may be negative) */
+  newBalance: number;
+  
+  /** Correlation ID shared with the original earn's audit trail */
+  correlationId: string;
+  
+  /** Operation timestamp */
+  timestamp: Date;
+}
+
 /**
  * Balance correction request
  */
@@ -280,15 +332,16 @@ export class AdminOpsService {
     const timestamp = new Date();
     
     // Use deterministic idempotency key based on admin, user, and request
-    const idempotencyKey = `admin-adjustment-${request.admin.adminId}-${request.userId}-${request.requestId}`;
+    const idempotencyKey = request.idempotencyKey
+      ?? `admin-adjustment-${request.admin.adminId}-${request.userId}-${request.requestId}`;
     
     const transactionType = request.amount > 0 
       ? TransactionType.CREDIT 
       : TransactionType.DEBIT;
     
-    const reason = request.amount > 0
+    const reason = request.reasonCode ?? (request.amount > 0
       ? TransactionReason.ADMIN_CREDIT
-      : TransactionReason.ADMIN_DEBIT;
+      : TransactionReason.ADMIN_DEBIT);
     
     await this.ledgerService.createEntry({
       transactionId,
@@ -304,6 +357,7 @@ export class AdminOpsService {
       balanceBefore: previousBalance,
       balanceAfter: newBalance,
       currency: this.config.defaultCurrency,
+      correlationId: request.correlationId,
       metadata: {
         ...request.metadata,
         adminId: request.admin.adminId,
@@ -311,6 +365,7 @@ export class AdminOpsService {
         adminReason: request.reason,
         adminIpAddress: request.admin.ipAddress,
         operationType: 'manual_adjustment',
+        comment: request.reason,
       },
     });
     
@@ -369,6 +424,52 @@ export class AdminOpsService {
     };
   }
   
+  /**
+   * Claw back points earned through fraud
+   * 
+   * Debits the user even if that drives the balance negative - fraudulent
+   * points may already have been spent - so the usual overdraft guard is
+   * bypassed for this operation only. The entry is tagged FRAUD_CLAWBACK
+   * and linked to the original earn by transaction and correlation ID.
+   * 
+   * @param request Clawback request
+   * @returns Clawback response
+   */
+  async clawback(request: ClawbackRequest): Promise<ClawbackResponse> {
+    if (request.amount <= 0) {
+      throw new Error('Clawback amount must be positive');
+    }
+    
+    if (!request.originalTransactionId) {
+      throw new Error('Original transaction ID is required for clawbacks');
+    }
+    
+    const correlationId = `clawback-${request.originalTransactionId}`;
+    
+    const result = await this.manualAdjustment({
+      userId: request.userId,
+      amount: -request.amount,
+      reason: request.reason,
+      admin: request.admin,
+      requestId: request.requestId,
+      reasonCode: TransactionReason.FRAUD_CLAWBACK,
+      correlationId,
+      metadata: {
+        operationType: 'fraud_clawback',
+        originalTransactionId: request.originalTransactionId,
+        allowNegative: true,
+      },
+    });
+    
+    return {
+      transactionId: result.transactionId,
+      amountClawedBack: request.amount,
+      newBalance: result.newBalance,
+      correlationId,
+      timestamp: result.timestamp,
+    };
+  }
+  
   /**
    * Correct balance discrepancy
    * 
@@ -434,7 +535,8 @@ export class AdminOpsService {
     return result.entries.filter(entry => 
       entry.reason === TransactionReason.ADMIN_CREDIT ||
       entry.reason === TransactionReason.ADMIN_DEBIT ||
-      entry.reason === TransactionReason.ADMIN_REFUND
+      entry.reason === TransactionReason.ADMIN_REFUND ||
+      entry.reason === TransactionReason.FRAUD_CLAWBACK
     );
   }
   
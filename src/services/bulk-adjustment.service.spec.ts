@@ -0,0 +1,207 @@
+/**
+ * Bulk Adjustment Service Tests
+ *
+ * Tests for CSV validation, dry-run previews, approval gating, partial
+ * failures, and safe re-execution of crashed runs.
+ */
+
+import { Readable } from 'stream';
+import { BulkAdjustmentService, BulkAdjustOptions } from './bulk-adjustment.service';
+import { AdminContext } from './admin-ops.service';
+import { InvalidAuthorizationError } from './types';
+
+describe('BulkAdjustmentService', () => {
+  let service: BulkAdjustmentService;
+  let mockAdminOps: { manualAdjustment: jest.Mock };
+  let mockLedgerService: any;
+  let applied: Set<string>;
+
+  const submitter: AdminContext = { adminId: 'ops-1', adminUsername: 'ops1', roles: ['admin'] };
+  const approver: AdminContext = { adminId: 'fin-1', adminUsername: 'fin1', roles: ['finance_admin'] };
+
+  const csv = (...lines: string[]) => Readable.from([['userId,amount,reason', ...lines].join('\n')]);
+
+  const options = (overrides: Partial<BulkAdjustOptions> = {}): BulkAdjustOptions => ({
+    batchId: 'comp-2024-05',
+    admin: submitter,
+    dryRun: true,
+    ...overrides,
+  });
+
+  const VALID = ['user-1,100,outage compensation', 'user-2,50,"outage, part 2"', 'user-3,-20,reversal'];
+
+  const approvedRun = async (lines: string[]) => {
+    const preview = await service.bulkAdjust(csv(...lines), options());
+    const approvalToken = service.approve(preview, approver);
+    return service.bulkAdjust(csv(...lines), options({ dryRun: false, approvalToken }));
+  };
+
+  beforeEach(() => {
+    applied = new Set();
+    mockAdminOps = {
+      manualAdjustment: jest.fn().mockImplementation(async (request: any) => ({
+        transactionId: `txn-${request.requestId}`,
+        amountAdjusted: request.amount,
+        previousBalance: 0,
+        newBalance: request.amount,
+        timestamp: new Date(),
+      })),
+    };
+    mockLedgerService = {
+      checkIdempotency: jest.fn().mockImplementation(async (key: string) => applied.has(key)),
+      storeIdempotencyResult: jest.fn().mockImplementation(async (key: string) => {
+        applied.add(key);
+      }),
+    };
+    service = new BulkAdjustmentService(mockAdminOps as any, mockLedgerService, {
+      approvalSecret: 'test-secret',
+    });
+  });
+
+  describe('dry run', () => {
+    it('should preview totals and affected users without applying anything', async () => {
+      const report = await service.bulkAdjust(csv(...VALID, 'user-1,10,bonus'), options());
+
+      expect(report.dryRun).toBe(true);
+      expect(report.rowsRead).toBe(4);
+      expect(report.validRows).toBe(4);
+      expect(report.totalPoints).toBe(140);
+      expect(report.affectedUsers).toBe(3);
+      expect(report.errors).toEqual([]);
+      expect(mockAdminOps.manualAdjustment).not.toHaveBeenCalled();
+    });
+
+    it('should report per-row validation errors', async () => {
+      const report = await service.bulkAdjust(
+        csv('user-1,100,ok', ',5,missing user', 'user-3,1.5,fraction', 'user-4,0,zero', 'user-5,5,', 'user-6,5'),
+        options()
+      );
+
+      expect(report.validRows).toBe(1);
+      expect(report.errors.map(e => e.row)).toEqual([2, 3, 4, 5, 6]);
+      expect(report.errors[0].message).toBe('userId is required');
+      expect(report.errors[1].message).toContain('whole number');
+      expect(report.errors[2].message).toBe('amount cannot be zero');
+      expect(report.errors[3].message).toBe('reason is required');
+      expect(report.errors[4].message).toContain('expected 3 columns');
+    });
+
+    it('should reject a file with the wrong header', async () => {
+      await expect(
+        service.bulkAdjust(Readable.from(['user,points\nuser-1,5']), options())
+      ).rejects.toThrow('header must be: userId,amount,reason');
+    });
+  });
+
+  describe('approval gating', () => {
+    it('should refuse to execute without an approval token', async () => {
+      await expect(
+        service.bulkAdjust(csv(...VALID), options({ dryRun: false }))
+      ).rejects.toThrow(InvalidAuthorizationError);
+      expect(mockAdminOps.manualAdjustment).not.toHaveBeenCalled();
+    });
+
+    it('should refuse a token approved for a different file', async () => {
+      const preview = await service.bulkAdjust(csv(...VALID), options());
+      const approvalToken = service.approve(preview, approver);
+
+      await expect(
+        service.bulkAdjust(
+          csv(...VALID, 'user-9,999999,sneaked in'),
+          options({ dryRun: false, approvalToken })
+        )
+      ).rejects.toThrow('approval was issued for a different file');
+    });
+
+    it('should refuse a batch approved by its own submitter', async () => {
+      const preview = await service.bulkAdjust(csv(...VALID), options());
+      const approvalToken = service.approve(preview, { ...submitter, roles: ['finance_admin'] });
+
+      await expect(
+        service.bulkAdjust(csv(...VALID), options({ dryRun: false, approvalToken }))
+      ).rejects.toThrow('cannot be approved by its submitter');
+    });
+
+    it('should refuse a tampered token', async () => {
+      const preview = await service.bulkAdjust(csv(...VALID), options());
+      const [payload, signature] = service.approve(preview, approver).split('.');
+      const forged = Buffer.from(
+        JSON.stringify({ ...JSON.parse(Buffer.from(payload, 'base64url').toString()), approverId: 'fin-2' })
+      ).toString('base64url');
+
+      await expect(
+        service.bulkAdjust(csv(...VALID), options({ dryRun: false, approvalToken: `${forged}.${signature}` }))
+      ).rejects.toThrow('signature mismatch');
+    });
+
+    it('should only accept approvers with an approval role', async () => {
+      const preview = await service.bulkAdjust(csv(...VALID), options());
+
+      expect(() => service.approve(preview, { ...approver, roles: ['admin'] })).toThrow(
+        InvalidAuthorizationError
+      );
+    });
+
+    it('should not approve or execute a file with invalid rows', async () => {
+      const preview = await service.bulkAdjust(csv(...VALID, 'user-4,abc,bad'), options());
+
+      expect(() => service.approve(preview, approver)).toThrow('invalid rows');
+    });
+  });
+
+  describe('execution', () => {
+    it('should apply every row with deterministic idempotency keys', async () => {
+      const report = await approvedRun(VALID);
+
+      expect(report.summary).toEqual({ applied: 3, skipped: 0, failed: 0 });
+      expect(mockAdminOps.manualAdjustment).toHaveBeenCalledTimes(3);
+      expect(mockAdminOps.manualAdjustment.mock.calls[1][0]).toMatchObject({
+        userId: 'user-2',
+        amount: 50,
+        reason: 'outage, part 2',
+        requestId: 'bulk-adjust-comp-2024-05-row-2',
+        idempotencyKey: 'bulk-adjust-comp-2024-05-row-2',
+        correlationId: 'bulk-adjust-comp-2024-05',
+        metadata: { batchId: 'comp-2024-05', batchRow: 2, approvedBy: 'fin-1' },
+      });
+    });
+
+    it('should continue past failed rows and report them', async () => {
+      mockAdminOps.manualAdjustment.mockImplementation(async (request: any) => {
+        if (request.userId === 'user-2') {
+          throw new Error('Wallet not found for user: user-2');
+        }
+        return { transactionId: `txn-${request.requestId}`, newBalance: 0, timestamp: new Date() };
+      });
+
+      const report = await approvedRun(VALID);
+
+      expect(report.summary).toEqual({ applied: 2, skipped: 0, failed: 1 });
+      expect(report.results[1]).toMatchObject({
+        row: 2,
+        status: 'failed',
+        error: 'Wallet not found for user: user-2',
+      });
+      expect(applied.has('bulk-adjust-comp-2024-05-row-2')).toBe(false);
+    });
+
+    it('should skip already-applied rows when a crashed run is re-executed', async () => {
+      // First run crashes after the second row
+      let calls = 0;
+      mockAdminOps.manualAdjustment.mockImplementation(async (request: any) => {
+        if (++calls === 3) {
+          throw new Error('connection lost');
+        }
+        return { transactionId: `txn-${request.requestId}`, newBalance: 0, timestamp: new Date() };
+      });
+      const first = await approvedRun(VALID);
+      expect(first.summary).toEqual({ applied: 2, skipped: 0, failed: 1 });
+
+      const second = await approvedRun(VALID);
+
+      expect(second.summary).toEqual({ applied: 1, skipped: 2, failed: 0 });
+      expect(second.results.map(r => r.status)).toEqual(['skipped', 'skipped', 'applied']);
+      expect(mockAdminOps.manualAdjustment).toHaveBeenCalledTimes(4);
+    });
+  });
+});
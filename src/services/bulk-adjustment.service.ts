@@ -0,0 +1,487 @@
+/**
+ * Bulk Adjustment Service
+ *
+ * Grants or removes points for many users from a CSV file with columns
+ * userId,amount,reason. Every run is two-step:
+ * 1. Dry run - the file is parsed and validated and a preview report
+ *    (total points, affected users, per-row errors, plan hash) is returned
+ * 2. Execution - requires an approval token issued by a second admin for
+ *    exactly that plan hash, so the file cannot change after approval and
+ *    nobody can approve their own batch
+ *
+ * Each row is applied through AdminOpsService.manualAdjustment with an
+ * idempotency key derived from the batch ID and row number, which is also
+ * the row's ledger idempotency key. A run that crashed part-way can be
+ * re-executed with the same file and token: rows already applied are
+ * skipped, the rest are applied, and a row whose entry landed before the
+ * crash replays that entry whichever admin re-runs the batch.
+ *
+ * @module services/bulk-adjustment
+ */
+
+import { createHash, createHmac, timingSafeEqual } from 'crypto';
+import { createInterface } from 'readline';
+import { Readable } from 'stream';
+import { ILedgerService } from '../ledger/types';
+import { AdminOpsService, AdminContext } from './admin-ops.service';
+import { InvalidAuthorizationError } from './types';
+
+/**
+ * Expected CSV header
+ */
+const CSV_HEADER = ['userId', 'amount', 'reason'];
+
+/**
+ * Idempotency scope for applied rows
+ */
+const OPERATION_TYPE = 'bulk_adjustment';
+
+/**
+ * A validated CSV row
+ */
+export interface BulkAdjustmentRow {
+  /** 1-based data row number (the header is row 0) */
+  row: number;
+  userId: string;
+  amount: number;
+  reason: string;
+}
+
+/**
+ * A CSV row that failed validation
+ */
+export interface BulkRowError {
+  row: number;
+  message: string;
+}
+
+/**
+ * Outcome of applying one row
+ */
+export interface BulkRowResult {
+  row: number;
+  userId: string;
+  amount: number;
+  status: 'applied' | 'skipped' | 'failed';
+  transactionId?: string;
+  error?: string;
+}
+
+/**
+ * Options for a bulk adjustment run
+ */
+export interface BulkAdjustOptions {
+  /** Stable batch identifier; reuse it when re-executing a crashed run */
+  batchId: string;
+
+  /** Admin submitting the batch */
+  admin: AdminContext;
+
+  /** Validate and preview without applying anything */
+  dryRun: boolean;
+
+  /** Token from approve(), required when dryRun is false */
+  approvalToken?: string;
+}
+
+/**
+ * Preview or execution report
+ */
+export interface BulkReport {
+  batchId: string;
+  dryRun: boolean;
+
+  /** Hash of the batch ID and validated rows; approvals are bound to it */
+  planHash: string;
+
+  /** Data rows read (excluding the header and blank lines) */
+  rowsRead: number;
+
+  /** Rows that passed validation */
+  validRows: number;
+
+  /** Net points across valid rows */
+  totalPoints: number;
+
+  /** Distinct users across valid rows */
+  affectedUsers: number;
+
+  errors: BulkRowError[];
+
+  /** Per-row outcomes (execution only) */
+  results: BulkRowResult[];
+
+  summary: {
+    applied: number;
+    skipped: number;
+    failed: number;
+  };
+}
+
+/**
+ * Configuration for the bulk adjustment service
+ */
+export interface BulkAdjustmentConfig {
+  /** HMAC secret used to sign approval tokens */
+  approvalSecret: string;
+
+  /** How long an approval stays valid, in milliseconds */
+  approvalTtlMs: number;
+
+  /** Roles allowed to approve a batch */
+  approverRoles: string[];
+
+  /** Maximum data rows per file */
+  maxRows: number;
+
+  /** Maximum absolute amount per row */
+  maxRowAmount: number;
+
+  /** Idempotency record retention for applied rows, in seconds */
+  idempotencyTtlSeconds: number;
+}
+
+const DEFAULT_CONFIG: BulkAdjustmentConfig = {
+  approvalSecret: '',
+  approvalTtlMs: 86400000, // 24 hours
+  approverRoles: ['super_admin', 'finance_admin'],
+  maxRows: 50000,
+  maxRowAmount: 1000000,
+  idempotencyTtlSeconds: 7776000, // 90 days
+};
+
+/**
+ * Bulk Adjustment Service Implementation
+ */
+export class BulkAdjustmentService {
+  private config: BulkAdjustmentConfig;
+  private adminOps: AdminOpsService;
+  private ledgerService: ILedgerService;
+
+  constructor(
+    adminOps: AdminOpsService,
+    ledgerService: ILedgerService,
+    config: Partial<BulkAdjustmentConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.adminOps = adminOps;
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Preview or execute a bulk adjustment from CSV input
+   *
+   * @param input CSV stream (userId,amount,reason)
+   * @param options Batch options
+   * @returns Preview report (dry run) or execution report
+   * @throws InvalidAuthorizationError if executing without a valid approval
+   * @throws Error if executing a file with validation errors
+   */
+  async bulkAdjust(input: Readable, options: BulkAdjustOptions): Promise<BulkReport> {
+    if (!options.batchId) {
+      throw new Error('batchId is required for bulk adjustments');
+    }
+
+    const { rows, errors, rowsRead } = await this.parse(input);
+    const planHash = this.planHash(options.batchId, rows);
+
+    const report: BulkReport = {
+      batchId: options.batchId,
+      dryRun: options.dryRun,
+      planHash,
+      rowsRead,
+      validRows: rows.length,
+      totalPoints: rows.reduce((sum, row) => sum + row.amount, 0),
+      affectedUsers: new Set(rows.map(row => row.userId)).size,
+      errors,
+      results: [],
+      summary: { applied: 0, skipped: 0, failed: 0 },
+    };
+
+    if (options.dryRun) {
+      return report;
+    }
+
+    if (errors.length > 0) {
+      throw new Error(`Cannot execute bulk adjustment with ${errors.length} invalid rows`);
+    }
+
+    const approvedBy = this.verifyApproval(options.approvalToken, planHash, options.admin);
+
+    for (const row of rows) {
+      const result = await this.applyRow(row, options, approvedBy);
+      report.results.push(result);
+      report.summary[result.status]++;
+    }
+
+    return report;
+  }
+
+  /**
+   * Approve a previewed batch
+   *
+   * @param preview Dry-run report being approved
+   * @param approver Admin approving the batch (not the submitter)
+   * @returns Approval token bound to the preview's plan hash
+   */
+  approve(preview: BulkReport, approver: AdminContext): string {
+    if (!preview.dryRun) {
+      throw new Error('Only a dry-run preview can be approved');
+    }
+
+    if (preview.errors.length > 0) {
+      throw new Error('Cannot approve a bulk adjustment with invalid rows');
+    }
+
+    if (!approver.adminId || !approver.roles?.some(role => this.config.approverRoles.includes(role))) {
+      throw new InvalidAuthorizationError('approver lacks a bulk adjustment approval role');
+    }
+
+    const payload = Buffer.from(
+      JSON.stringify({
+        planHash: preview.planHash,
+        approverId: approver.adminId,
+        expiresAt: Date.now() + this.config.approvalTtlMs,
+      })
+    ).toString('base64url');
+
+    return `${payload}.${this.sign(payload)}`;
+  }
+
+  /**
+   * Apply one row unless a previous run already did
+   */
+  private async applyRow(
+    row: BulkAdjustmentRow,
+    options: BulkAdjustOptions,
+    approvedBy: string
+  ): Promise<BulkRowResult> {
+    const rowKey = `bulk-adjust-${options.batchId}-row-${row.row}`;
+    const base = { row: row.row, userId: row.userId, amount: row.amount };
+
+    try {
+      if (await this.ledgerService.checkIdempotency(rowKey, OPERATION_TYPE)) {
+        return { ...base, status: 'skipped' };
+      }
+
+      const result = await this.adminOps.manualAdjustment({
+        userId: row.userId,
+        amount: row.amount,
+        reason: row.reason,
+        admin: options.admin,
+        requestId: rowKey,
+        idempotencyKey: rowKey,
+        correlationId: `bulk-adjust-${options.batchId}`,
+        metadata: {
+          batchId: options.batchId,
+          batchRow: row.row,
+          approvedBy,
+        },
+      });
+
+      await this.ledgerService.storeIdempotencyResult(
+        rowKey,
+        OPERATION_TYPE,
+        { transactionId: result.transactionId },
+        200,
+        this.config.idempotencyTtlSeconds
+      );
+
+      return { ...base, status: 'applied', transactionId: result.transactionId };
+    } catch (error: any) {
+      return { ...base, status: 'failed', error: error.message };
+    }
+  }
+
+  /**
+   * Verify an approval token against the plan and submitter
+   *
+   * @returns Approver ID
+   */
+  private verifyApproval(token: string | undefined, planHash: string, submitter: AdminContext): string {
+    if (!token) {
+      throw new InvalidAuthorizationError('bulk adjustment requires an approval token');
+    }
+
+    const [payload, signature] = token.split('.');
+    const expected = this.sign(payload || '');
+    if (
+      !signature ||
+      signature.length !== expected.length ||
+      !timingSafeEqual(Buffer.from(signature), Buffer.from(expected))
+    ) {
+      throw new InvalidAuthorizationError('approval token signature mismatch');
+    }
+
+    const approval = JSON.parse(Buffer.from(payload, 'base64url').toString('utf8'));
+
+    if (approval.planHash !== planHash) {
+      throw new InvalidAuthorizationError('approval was issued for a different file');
+    }
+
+    if (approval.expiresAt < Date.now()) {
+      throw new InvalidAuthorizationError('approval token expired');
+    }
+
+    if (approval.approverId === submitter.adminId) {
+      throw new InvalidAuthorizationError('a bulk adjustment cannot be approved by its submitter');
+    }
+
+    return approval.approverId;
+  }
+
+  /**
+   * Parse and validate CSV input line by line
+   */
+  private async parse(
+    input: Readable
+  ): Promise<{ rows: BulkAdjustmentRow[]; errors: BulkRowError[]; rowsRead: number }> {
+    const rows: BulkAdjustmentRow[] = [];
+    const errors: BulkRowError[] = [];
+    let header: string[] | null = null;
+    let rowsRead = 0;
+
+    for await (const line of createInterface({ input, crlfDelay: Infinity })) {
+      if (line.trim() === '') {
+        continue;
+      }
+
+      const cells = parseCsvLine(line);
+
+      if (!header) {
+        header = cells.map(cell => cell.trim());
+        if (header.join(',') !== CSV_HEADER.join(',')) {
+          throw new Error(`Bulk adjustment CSV header must be: ${CSV_HEADER.join(',')}`);
+        }
+        continue;
+      }
+
+      rowsRead++;
+      if (rowsRead > this.config.maxRows) {
+        throw new Error(`Bulk adjustment exceeds maximum of ${this.config.maxRows} rows`);
+      }
+
+      const message = this.validateRow(cells);
+      if (message) {
+        errors.push({ row: rowsRead, message });
+        continue;
+      }
+
+      rows.push({
+        row: rowsRead,
+        userId: cells[0].trim(),
+        amount: Number(cells[1].trim()),
+        reason: cells[2].trim(),
+      });
+    }
+
+    if (!header) {
+      throw new Error('Bulk adjustment CSV is empty');
+    }
+
+    return { rows, errors, rowsRead };
+  }
+
+  /**
+   * Validate one row's cells
+   *
+   * @returns Error message, or null when the row is valid
+   */
+  private validateRow(cells: string[]): string | null {
+    if (cells.length !== CSV_HEADER.length) {
+      return `expected ${CSV_HEADER.length} columns, found ${cells.length}`;
+    }
+
+    const [userId, amountText, reason] = cells.map(cell => cell.trim());
+
+    if (!userId) {
+      return 'userId is required';
+    }
+
+    if (!/^-?\d+$/.test(amountText)) {
+      return `amount must be a whole number: ${amountText}`;
+    }
+
+    const amount = Number(amountText);
+    if (amount === 0) {
+      return 'amount cannot be zero';
+    }
+
+    if (!Number.isSafeInteger(amount) || Math.abs(amount) > this.config.maxRowAmount) {
+      return `amount exceeds maximum: ${this.config.maxRowAmount}`;
+    }
+
+    if (!reason) {
+      return 'reason is required';
+    }
+
+    return null;
+  }
+
+  /**
+   * Hash the batch ID and validated rows
+   */
+  private planHash(batchId: string, rows: BulkAdjustmentRow[]): string {
+    const hash = createHash('sha256');
+    hash.update(JSON.stringify(batchId));
+    for (const row of rows) {
+      hash.update('\n' + JSON.stringify([row.row, row.userId, row.amount, row.reason]));
+    }
+    return hash.digest('hex');
+  }
+
+  /**
+   * HMAC a token payload with the approval secret
+   */
+  private sign(payload: string): string {
+    if (!this.config.approvalSecret) {
+      throw new Error('approvalSecret must be configured for bulk adjustments');
+    }
+    return createHmac('sha256', this.config.approvalSecret).update(payload).digest('base64url');
+  }
+}
+
+/**
+ * Split one CSV line into cells (RFC 4180 quoting, no embedded newlines)
+ */
+export function parseCsvLine(line: string): string[] {
+  const cells: string[] = [];
+  let cell = '';
+  let quoted = false;
+
+  for (let i = 0; i < line.length; i++) {
+    const char = line[i];
+
+    if (quoted) {
+      if (char === '"' && line[i + 1] === '"') {
+        cell += '"';
+        i++;
+      } else if (char === '"') {
+        quoted = false;
+      } else {
+        cell += char;
+      }
+    } else if (char === '"') {
+      quoted = true;
+    } else if (char === ',') {
+      cells.push(cell);
+      cell = '';
+    } else {
+      cell += char;
+    }
+  }
+
+  cells.push(cell);
+  return cells;
+}
+
+/**
+ * Factory function to create a bulk adjustment service
+ */
+export function createBulkAdjustmentService(
+  adminOps: AdminOpsService,
+  ledgerService: ILedgerService,
+  config?: Partial<BulkAdjustmentConfig>
+): BulkAdjustmentService {
+  return new BulkAdjustmentService(adminOps, ledgerService, config);
+}
@@ -0,0 +1,247 @@
+/**
+ * Daily Earn Cap Guard Tests
+ */
+
+import { DailyEarnCapGuard, earnDay } from './daily-earn-cap-guard.service';
+import { DailyEarnCapExceededError } from './types';
+import { DailyEarnCounterModel } from '../db/models/daily-earn-counter.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { CreateLedgerEntryRequest } from '../ledger/types';
+import { StaticTimezoneSource } from '../ledger/timezone';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/daily-earn-counter.model');
+jest.mock('../db/models/ledger-entry.model');
+
+describe('DailyEarnCapGuard', () => {
+  // In-memory daily_earn_counters collection, keyed by tenant, user and day
+  let counters: Map<
+    string,
+    { tenantId?: string; userId: string; day: Date; points: number; idempotencyKeys: string[] }
+  >;
+  let ledgerRows: any[];
+
+  const key = (userId: string, day: Date, tenantId?: string) => `${tenantId ?? ''}:${userId}@${day.toISOString()}`;
+  const filterKey = (filter: any) => key(filter.userId.$eq, filter.day.$eq, filter.tenantId.$eq);
+
+  const earn = (idempotencyKey: string, amount = 100, userId = 'user-123'): CreateLedgerEntryRequest => ({
+    accountId: userId,
+    accountType: 'user',
+    amount,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey,
+    requestId: `req-${idempotencyKey}`,
+    balanceBefore: 0,
+    balanceAfter: amount,
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.useFakeTimers();
+    jest.setSystemTime(new Date('2025-03-10T23:00:00Z'));
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    counters = new Map();
+    ledgerRows = [];
+
+    (DailyEarnCounterModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => {
+        const doc = counters.get(filterKey(query));
+        return doc ? { ...doc, idempotencyKeys: [...doc.idempotencyKeys] } : null;
+      }),
+    }));
+    (DailyEarnCounterModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (counters.has(key(doc.userId, doc.day, doc.tenantId))) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      counters.set(key(doc.userId, doc.day, doc.tenantId), { ...doc, idempotencyKeys: [...doc.idempotencyKeys] });
+      return doc;
+    });
+    // Applies the conditional increment atomically, as MongoDB would
+    (DailyEarnCounterModel.updateOne as jest.Mock).mockImplementation(async (filter: any, update: any) => {
+      const doc = counters.get(filterKey(filter));
+      const matches =
+        doc && !doc.idempotencyKeys.includes(filter.idempotencyKeys.$ne) && doc.points <= filter.points.$lte;
+      if (!matches) {
+        return { modifiedCount: 0 };
+      }
+      doc.points += update.$inc.points;
+      doc.idempotencyKeys.push(update.$push.idempotencyKeys);
+      return { modifiedCount: 1 };
+    });
+    (LedgerEntryModel.aggregate as jest.Mock).mockImplementation(() => ({
+      exec: jest.fn().mockImplementation(async () => ledgerRows),
+    }));
+  });
+
+  afterEach(() => {
+    jest.useRealTimers();
+    jest.restoreAllMocks();
+  });
+
+  it('should accept earns up to and at the cap and reject one over it', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 300 });
+
+    await expect(guard.beforeAppend(earn('evt-1', 200))).resolves.toBeUndefined();
+    await expect(guard.beforeAppend(earn('evt-2', 100))).resolves.toBeUndefined();
+    const error = await guard.beforeAppend(earn('evt-3', 1)).catch(e => e);
+
+    expect(error).toBeInstanceOf(DailyEarnCapExceededError);
+    expect(error.code).toBe('DAILY_EARN_CAP_EXCEEDED');
+    expect(error.details).toEqual({
+      userId: 'user-123',
+      day: new Date('2025-03-10T00:00:00Z'),
+      max: 300,
+      observed: 301,
+    });
+  });
+
+  it('should start a fresh allowance at the UTC day boundary', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 300 });
+    await guard.beforeAppend(earn('evt-1', 300));
+    await expect(guard.beforeAppend(earn('evt-2', 50))).rejects.toThrow(DailyEarnCapExceededError);
+
+    jest.setSystemTime(new Date('2025-03-10T23:59:59.999Z'));
+    await expect(guard.beforeAppend(earn('evt-3', 50))).rejects.toThrow(DailyEarnCapExceededError);
+
+    jest.setSystemTime(new Date('2025-03-11T00:00:00Z'));
+    await expect(guard.beforeAppend(earn('evt-4', 300))).resolves.toBeUndefined();
+    await expect(guard.beforeAppend(earn('evt-5', 1))).rejects.toThrow(DailyEarnCapExceededError);
+  });
+
+  it("should start each day at the user's local midnight", async () => {
+    // Tokyo days start at 15:00 UTC
+    const guard = new DailyEarnCapGuard({
+      maxDailyEarnPerUser: 100,
+      timezoneSource: new StaticTimezoneSource({ 'user-123': 'Asia/Tokyo' }),
+    });
+
+    jest.setSystemTime(new Date('2025-03-10T14:30:00Z'));
+    await guard.beforeAppend(earn('evt-1', 100));
+
+    jest.setSystemTime(new Date('2025-03-10T15:00:00Z'));
+    await expect(guard.beforeAppend(earn('evt-2', 100))).resolves.toBeUndefined();
+    await expect(guard.beforeAppend(earn('evt-3', 100, 'user-456'))).resolves.toBeUndefined();
+
+    expect(counters.get(key('user-123', new Date('2025-03-09T15:00:00Z')))?.points).toBe(100);
+    expect(counters.get(key('user-123', new Date('2025-03-10T15:00:00Z')))?.points).toBe(100);
+    expect(counters.get(key('user-456', new Date('2025-03-10T00:00:00Z')))?.points).toBe(100);
+  });
+
+  it('should follow DST in the default timezone', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 100, defaultTimeZone: 'America/New_York' });
+
+    await guard.beforeAppend({ ...earn('evt-1', 100), timestamp: new Date('2025-03-09T12:00:00Z') });
+
+    // The day clocks go forward is 23 hours long
+    const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+    expect(pipeline[0].$match.timestamp).toEqual({
+      $gte: new Date('2025-03-09T05:00:00Z'),
+      $lt: new Date('2025-03-10T04:00:00Z'),
+    });
+    expect(earnDay(new Date('2025-03-09T12:00:00Z'), 'America/New_York')).toEqual({
+      start: new Date('2025-03-09T05:00:00Z'),
+      end: new Date('2025-03-10T04:00:00Z'),
+    });
+  });
+
+  it('should keep tenants apart', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 100, tenantId: 'tenant-a' });
+    await guard.beforeAppend(earn('evt-1', 100));
+
+    await expect(guard.beforeAppend({ ...earn('evt-2', 100), tenantId: 'tenant-b' })).resolves.toBeUndefined();
+    await expect(guard.beforeAppend(earn('evt-3', 1))).rejects.toThrow(DailyEarnCapExceededError);
+
+    const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+    expect(pipeline[0].$match.tenantId).toEqual({ $eq: 'tenant-a' });
+    expect(counters.get(key('user-123', new Date('2025-03-10T00:00:00Z'), 'tenant-a'))?.points).toBe(100);
+    expect(counters.get(key('user-123', new Date('2025-03-10T00:00:00Z'), 'tenant-b'))?.points).toBe(100);
+  });
+
+  it('should keep users apart and ignore non-earns', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 100 });
+    await guard.beforeAppend(earn('evt-1', 100));
+
+    await expect(guard.beforeAppend(earn('evt-2', 100, 'user-456'))).resolves.toBeUndefined();
+    await guard.beforeAppend({ ...earn('evt-3', -500), type: TransactionType.DEBIT });
+    await guard.beforeAppend({ ...earn('evt-4', 500), reason: TransactionReason.ADMIN_REFUND });
+
+    expect(DailyEarnCounterModel.updateOne).toHaveBeenCalledTimes(2);
+  });
+
+  it('should let replays of a counted earn through', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 100 });
+    await guard.beforeAppend(earn('evt-1', 100));
+
+    await expect(guard.beforeAppend(earn('evt-1', 100))).resolves.toBeUndefined();
+    expect(counters.get(key('user-123', new Date('2025-03-10T00:00:00Z')))?.points).toBe(100);
+  });
+
+  it('should count an earn reusing a key from another scope', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 100 });
+    await guard.beforeAppend({ ...earn('evt-1', 100), idempotencyScope: 'promo-a' });
+
+    await expect(guard.beforeAppend({ ...earn('evt-1', 100), idempotencyScope: 'promo-b' })).rejects.toThrow(
+      DailyEarnCapExceededError
+    );
+    await expect(guard.beforeAppend(earn('evt-1', 100))).rejects.toThrow(DailyEarnCapExceededError);
+    await expect(guard.beforeAppend({ ...earn('evt-1', 100), idempotencyScope: 'promo-a' })).resolves.toBeUndefined();
+  });
+
+  it("should seed the day's total from the ledger's timestamp range", async () => {
+    ledgerRows = [{ _id: null, points: 250, idempotencyKeys: ['\u0000evt-before-restart'] }];
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 300 });
+
+    await expect(guard.beforeAppend(earn('evt-after-restart', 100))).rejects.toThrow(DailyEarnCapExceededError);
+    await expect(guard.beforeAppend(earn('evt-before-restart', 250))).resolves.toBeUndefined();
+
+    const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+    expect(pipeline[0].$match).toMatchObject({
+      tenantId: { $exists: false },
+      accountId: { $eq: 'user-123' },
+      timestamp: { $gte: new Date('2025-03-10T00:00:00Z'), $lt: new Date('2025-03-11T00:00:00Z') },
+    });
+  });
+
+  it("should count an earn towards its own timestamp's day", async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 100 });
+
+    await guard.beforeAppend(earn('evt-1', 100));
+    await guard.beforeAppend({ ...earn('evt-2', 100), timestamp: new Date('2025-03-09T12:00:00Z') });
+
+    expect(counters.get(key('user-123', new Date('2025-03-09T00:00:00Z')))?.points).toBe(100);
+    expect(counters.get(key('user-123', new Date('2025-03-10T00:00:00Z')))?.points).toBe(100);
+  });
+
+  it('should key and seed the counter by the tokenized user ID', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 300, userIdTokenizer: userId => `tok-${userId}` });
+
+    await guard.beforeAppend(earn('evt-1', 100));
+
+    const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+    expect(pipeline[0].$match.accountId).toEqual({ $eq: 'tok-user-123' });
+    expect(counters.get(key('tok-user-123', new Date('2025-03-10T00:00:00Z')))?.points).toBe(100);
+  });
+
+  it('should admit only the earns that fit when they race for the last points', async () => {
+    const guard = new DailyEarnCapGuard({ maxDailyEarnPerUser: 250 });
+
+    const results = await Promise.allSettled(
+      ['evt-1', 'evt-2', 'evt-3', 'evt-4'].map(idempotencyKey => guard.beforeAppend(earn(idempotencyKey, 100)))
+    );
+
+    expect(results.filter(r => r.status === 'fulfilled')).toHaveLength(2);
+    expect(counters.get(key('user-123', new Date('2025-03-10T00:00:00Z')))?.points).toBe(200);
+  });
+
+  it('should reject an invalid cap or default timezone', () => {
+    expect(() => new DailyEarnCapGuard({ maxDailyEarnPerUser: -1 })).toThrow('non-negative integer');
+    expect(() => new DailyEarnCapGuard({ maxDailyEarnPerUser: 100, defaultTimeZone: 'Mars/Olympus' })).toThrow(
+      RangeError
+    );
+  });
+});
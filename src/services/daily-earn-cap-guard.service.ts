@@ -0,0 +1,287 @@
+/**
+ * Daily Earn Cap Guard
+ *
+ * Caps the points each user may earn per day, the per-user daily limit
+ * promotions carry, at the ledger's append path so no caller can skip
+ * it. An earn that would take the user's earns for the day past the cap
+ * is rejected with DailyEarnCapExceededError; an earn that lands exactly
+ * on the cap is accepted.
+ *
+ * Days run from the user's local midnight, in the zone their
+ * UserTimezoneSource gives or the program default (UTC unless set), so
+ * days around DST transitions are 23 or 25 hours long. An earn counts
+ * towards the day of the timestamp it will be stored with: the request's
+ * own timestamp when it carries one, otherwise the time the hook runs.
+ *
+ * The ledger stores user entries under their tokenized ID when it has a
+ * userIdTokenizer. Give the guard the same tokenizer, so each counter is
+ * keyed, and seeded, by the account ID the ledger actually stores.
+ *
+ * Counters live in daily_earn_counters, one row per tenant, user and
+ * day, and are seeded from that tenant's ledger entries over the day's
+ * timestamp range the first time a day is seen, so the cap holds
+ * across restarts and for earns written before the guard was enabled.
+ * Each earn is counted by a single conditional increment, so concurrent
+ * earns cannot both take the last points. An append that fails after
+ * its earn was counted keeps its points; retrying it with the same
+ * idempotency scope and key is allowed. An earn reusing a key from
+ * another scope is counted.
+ *
+ * @module services/daily-earn-cap-guard
+ */
+
+import { LedgerAppendHook, CreateLedgerEntryRequest, UserIdTokenizer } from '../ledger/types';
+import { DailyEarnCounterModel } from '../db/models/daily-earn-counter.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { ProgramConfigSource } from '../config/program';
+import {
+  UserTimezoneSource,
+  assertValidTimeZone,
+  nextDayKey,
+  resolveTimeZone,
+  startOfZonedDay,
+  zonedDayKey,
+} from '../ledger/timezone';
+import { DailyEarnCapExceededError, UserIdRejectedError } from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Configuration for the daily earn cap guard
+ */
+export interface DailyEarnCapGuardConfig {
+  /** Maximum points a user may earn per day */
+  maxDailyEarnPerUser: number;
+
+  /** Source of per-user timezones */
+  timezoneSource?: UserTimezoneSource;
+
+  /** Program default timezone, for users the source has no zone for */
+  defaultTimeZone: string;
+
+  /** Program config whose defaultTimeZone replaces defaultTimeZone */
+  program?: ProgramConfigSource;
+
+  /** Reasons treated as earns */
+  earnReasons: string[];
+
+  /** The ledger's userIdTokenizer (user IDs are stored as given when unset) */
+  userIdTokenizer?: UserIdTokenizer;
+
+  /** Tenant of a tenant-scoped ledger, for requests that name none */
+  tenantId?: string;
+}
+
+const DEFAULT_CONFIG: Omit<DailyEarnCapGuardConfig, 'maxDailyEarnPerUser'> = {
+  defaultTimeZone: 'UTC',
+  earnReasons: [
+    TransactionReason.USER_SIGNUP_BONUS,
+    TransactionReason.REFERRAL_BONUS,
+    TransactionReason.PROMOTIONAL_AWARD,
+    TransactionReason.ADMIN_CREDIT,
+    TransactionReason.PURCHASE_EARN,
+  ],
+};
+
+/**
+ * UTC bounds of the local earn day containing a moment: [start, end)
+ */
+export function earnDay(at: Date, timeZone = 'UTC'): { start: Date; end: Date } {
+  const day = zonedDayKey(at, timeZone);
+  return { start: startOfZonedDay(day, timeZone), end: startOfZonedDay(nextDayKey(day), timeZone) };
+}
+
+/**
+ * Key an earn is recorded under on its day's counter
+ */
+function countedKey(idempotencyScope: string | undefined, idempotencyKey: string): string {
+  return `${idempotencyScope ?? ''}\u0000${idempotencyKey}`;
+}
+
+/**
+ * Daily Earn Cap Guard Implementation
+ */
+export class DailyEarnCapGuard implements LedgerAppendHook {
+  readonly name = 'daily-earn-cap';
+
+  private config: DailyEarnCapGuardConfig;
+
+  /**
+   * @throws Error if the cap is not a non-negative integer
+   * @throws RangeError if the default timezone is unknown
+   */
+  constructor(config: Partial<DailyEarnCapGuardConfig> & Pick<DailyEarnCapGuardConfig, 'maxDailyEarnPerUser'>) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+
+    if (!Number.isSafeInteger(this.config.maxDailyEarnPerUser) || this.config.maxDailyEarnPerUser < 0) {
+      throw new Error(`maxDailyEarnPerUser must be a non-negative integer: ${this.config.maxDailyEarnPerUser}`);
+    }
+    assertValidTimeZone(this.config.defaultTimeZone);
+  }
+
+  /**
+   * Count the earn against the user's day before it is written
+   *
+   * @throws UserIdRejectedError if the tokenizer rejects the user ID
+   * @throws DailyEarnCapExceededError if the earn would exceed the cap
+   */
+  async beforeAppend(request: CreateLedgerEntryRequest): Promise<void> {
+    if (!this.isEarn(request)) {
+      return;
+    }
+
+    const tenantId = request.tenantId ?? this.config.tenantId;
+    const userId = await this.storedUserId(request.accountId);
+    const timeZone = await resolveTimeZone(this.config.timezoneSource, request.accountId, this.defaultTimeZone());
+    const at = request.timestamp ? new Date(request.timestamp) : new Date();
+    const { start: day, end } = earnDay(at, timeZone);
+    const key = countedKey(request.idempotencyScope, request.idempotencyKey);
+    const counter = await this.loadCounter(tenantId, userId, day, end);
+
+    // Replays of a counted earn are left to ledger idempotency
+    if (counter.idempotencyKeys.includes(key)) {
+      return;
+    }
+
+    const result = await DailyEarnCounterModel.updateOne(
+      {
+        ...this.counterFilter(tenantId, userId, day),
+        idempotencyKeys: { $ne: key },
+        points: { $lte: this.config.maxDailyEarnPerUser - request.amount },
+      },
+      {
+        $inc: { points: request.amount },
+        $push: { idempotencyKeys: key },
+      }
+    );
+
+    if (result.modifiedCount === 1) {
+      return;
+    }
+
+    const current = await this.loadCounter(tenantId, userId, day, end);
+    if (current.idempotencyKeys.includes(key)) {
+      return;
+    }
+
+    const observed = current.points + request.amount;
+    MetricsLogger.incrementCounter(MetricEventType.EARN_DAILY_CAP_EXCEEDED, {
+      userId,
+      day: day.toISOString(),
+      requestId: request.requestId,
+    });
+
+    throw new DailyEarnCapExceededError(userId, day, this.config.maxDailyEarnPerUser, observed);
+  }
+
+  /**
+   * Load a tenant's counter for a user's day, seeding it from that
+   * tenant's ledger entries if missing
+   */
+  private async loadCounter(
+    tenantId: string | undefined,
+    userId: string,
+    day: Date,
+    end: Date
+  ): Promise<{ points: number; idempotencyKeys: string[] }> {
+    const query = this.counterFilter(tenantId, userId, day);
+    const existing = await DailyEarnCounterModel.findOne(query).lean().exec();
+    if (existing) {
+      return existing;
+    }
+
+    const [row] = await LedgerEntryModel.aggregate([
+      {
+        $match: {
+          tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+          accountId: { $eq: userId },
+          type: { $eq: TransactionType.CREDIT },
+          timestamp: { $gte: day, $lt: end },
+          accountType: { $eq: 'user' },
+          balanceState: { $eq: 'available' },
+          reason: { $in: this.config.earnReasons },
+        },
+      },
+      {
+        $group: {
+          _id: null,
+          points: { $sum: '$amount' },
+          idempotencyKeys: {
+            $push: { $concat: [{ $ifNull: ['$idempotencyScope', ''] }, '\u0000', '$idempotencyKey'] },
+          },
+        },
+      },
+    ]).exec();
+
+    const seed = {
+      ...(tenantId !== undefined && { tenantId }),
+      userId,
+      day,
+      points: row ? row.points : 0,
+      idempotencyKeys: row ? row.idempotencyKeys : [],
+    };
+
+    try {
+      await DailyEarnCounterModel.create(seed);
+    } catch (error: any) {
+      // Another writer seeded it first
+      if (error.code !== 11000) {
+        throw error;
+      }
+      const seeded = await DailyEarnCounterModel.findOne(query).lean().exec();
+      if (seeded) {
+        return seeded;
+      }
+    }
+
+    return seed;
+  }
+
+  private counterFilter(tenantId: string | undefined, userId: string, day: Date): Record<string, unknown> {
+    return {
+      tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+      userId: { $eq: userId },
+      day: { $eq: day },
+    };
+  }
+
+  private defaultTimeZone(): string {
+    return this.config.program ? this.config.program.current().defaultTimeZone : this.config.defaultTimeZone;
+  }
+
+  /**
+   * The account ID the ledger stores for a user
+   */
+  private async storedUserId(userId: string): Promise<string> {
+    if (!this.config.userIdTokenizer) {
+      return userId;
+    }
+
+    try {
+      return await this.config.userIdTokenizer(userId);
+    } catch (error) {
+      throw new UserIdRejectedError(error);
+    }
+  }
+
+  /**
+   * Whether a request is an earn subject to the cap
+   */
+  private isEarn(request: CreateLedgerEntryRequest): boolean {
+    return (
+      request.accountType === 'user' &&
+      request.type === TransactionType.CREDIT &&
+      request.balanceState === 'available' &&
+      this.config.earnReasons.includes(request.reason)
+    );
+  }
+}
+
+/**
+ * Factory function to create a daily earn cap guard
+ */
+export function createDailyEarnCapGuard(
+  config: Partial<DailyEarnCapGuardConfig> & Pick<DailyEarnCapGuardConfig, 'maxDailyEarnPerUser'>
+): DailyEarnCapGuard {
+  return new DailyEarnCapGuard(config);
+}
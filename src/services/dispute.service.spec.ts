@@ -0,0 +1,166 @@
+/**
+ * Dispute Service Tests
+ */
+
+import { DisputeService } from './dispute.service';
+import { AdminContext } from './admin-ops.service';
+import { DisputeStateError } from './types';
+import { LedgerAnnotationModel } from '../db/models/ledger-annotation.model';
+
+jest.mock('../db/models/ledger-annotation.model');
+
+describe('DisputeService', () => {
+  let service: DisputeService;
+  let mockLedgerService: any;
+  let mockAdminOps: { manualAdjustment: jest.Mock };
+  let chain: any[];
+
+  const support: AdminContext = { adminId: 'support-1', adminUsername: 'support1', roles: ['admin'] };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    chain = [];
+
+    (LedgerAnnotationModel.find as jest.Mock).mockImplementation(() => ({
+      sort: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => [...chain]),
+    }));
+    (LedgerAnnotationModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (chain.some(a => a.sequence === doc.sequence)) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      chain.push(doc);
+      return doc;
+    });
+
+    mockLedgerService = {
+      getEntry: jest.fn().mockResolvedValue({
+        entryId: 'entry-1',
+        accountId: 'user-1',
+        accountType: 'user',
+        amount: -500,
+      }),
+    };
+    mockAdminOps = {
+      manualAdjustment: jest.fn().mockResolvedValue({
+        transactionId: 'txn-comp',
+        amountAdjusted: 200,
+        previousBalance: 0,
+        newBalance: 200,
+        timestamp: new Date(),
+      }),
+    };
+
+    service = new DisputeService(mockLedgerService, mockAdminOps as any);
+  });
+
+  it('should report no dispute for an unannotated entry', async () => {
+    const status = await service.disputeStatus('entry-1');
+
+    expect(status).toEqual({ entryId: 'entry-1', state: 'none', history: [] });
+  });
+
+  it('should open and resolve a dispute as linked annotations', async () => {
+    await service.openDispute('entry-1', support, 'user says purchase never delivered');
+    expect((await service.disputeStatus('entry-1')).state).toBe('open');
+
+    const { annotation, adjustment } = await service.resolveDispute('entry-1', support, 'confirmed, no refund');
+
+    expect(adjustment).toBeUndefined();
+    expect(chain.map(a => a.accountId)).toEqual(['user-1', 'user-1']);
+    expect(annotation).not.toHaveProperty('accountId');
+    expect(annotation).toMatchObject({ parentEntryId: 'entry-1', sequence: 1, kind: 'dispute_resolved' });
+    const status = await service.disputeStatus('entry-1');
+    expect(status.state).toBe('resolved');
+    expect(status.history.map(a => a.kind)).toEqual(['dispute_opened', 'dispute_resolved']);
+    expect(mockAdminOps.manualAdjustment).not.toHaveBeenCalled();
+  });
+
+  it('should apply a compensating adjustment linked to the dispute', async () => {
+    await service.openDispute('entry-1', support, 'charged twice');
+
+    const { annotation, adjustment } = await service.resolveDispute('entry-1', support, 'refund duplicate', 200);
+
+    expect(annotation.compensation).toBe(200);
+    expect(adjustment?.transactionId).toBe('txn-comp');
+    expect(mockAdminOps.manualAdjustment).toHaveBeenCalledWith({
+      userId: 'user-1',
+      amount: 200,
+      reason: 'refund duplicate',
+      admin: support,
+      requestId: 'dispute-entry-1-1',
+      idempotencyKey: 'dispute-entry-1-1',
+      correlationId: 'dispute-entry-1',
+      metadata: { parentEntryId: 'entry-1', disputeAnnotationId: annotation.annotationId },
+    });
+  });
+
+  it('should leave the dispute open when the compensation fails', async () => {
+    await service.openDispute('entry-1', support, 'charged twice');
+    mockAdminOps.manualAdjustment.mockRejectedValueOnce(new Error('Wallet not found for user: user-1'));
+
+    await expect(service.resolveDispute('entry-1', support, 'refund duplicate', 200)).rejects.toThrow(
+      'Wallet not found'
+    );
+    expect((await service.disputeStatus('entry-1')).state).toBe('open');
+
+    await service.resolveDispute('entry-1', support, 'refund duplicate', 200);
+
+    const keys = mockAdminOps.manualAdjustment.mock.calls.map(([request]) => request.idempotencyKey);
+    expect(keys).toEqual(['dispute-entry-1-1', 'dispute-entry-1-1']);
+    expect((await service.disputeStatus('entry-1')).state).toBe('resolved');
+  });
+
+  it('should reject opening a dispute that is already open', async () => {
+    await service.openDispute('entry-1', support, 'first');
+
+    await expect(service.openDispute('entry-1', support, 'second')).rejects.toThrow(DisputeStateError);
+    expect(chain).toHaveLength(1);
+  });
+
+  it('should reject resolving without an open dispute', async () => {
+    await expect(service.resolveDispute('entry-1', support, 'nothing to resolve')).rejects.toThrow(
+      DisputeStateError
+    );
+
+    await service.openDispute('entry-1', support, 'opened');
+    await service.resolveDispute('entry-1', support, 'done');
+
+    await expect(service.resolveDispute('entry-1', support, 'again', 50)).rejects.toThrow(DisputeStateError);
+    expect(mockAdminOps.manualAdjustment).not.toHaveBeenCalled();
+  });
+
+  it('should allow a resolved dispute to be reopened', async () => {
+    await service.openDispute('entry-1', support, 'opened');
+    await service.resolveDispute('entry-1', support, 'done');
+
+    await service.openDispute('entry-1', support, 'new evidence');
+
+    expect((await service.disputeStatus('entry-1')).state).toBe('open');
+  });
+
+  it('should reject a transition that loses a concurrent race', async () => {
+    // Another writer takes sequence 0 between the status read and the append
+    (LedgerAnnotationModel.find as jest.Mock).mockImplementationOnce(() => ({
+      sort: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => {
+        chain.push({ sequence: 0, kind: 'dispute_opened' });
+        return [];
+      }),
+    }));
+
+    await expect(service.openDispute('entry-1', support, 'racing')).rejects.toThrow(
+      'dispute is open'
+    );
+  });
+
+  it('should reject disputes on unknown entries', async () => {
+    mockLedgerService.getEntry.mockResolvedValue(null);
+
+    await expect(service.openDispute('missing', support, 'why')).rejects.toThrow(
+      'Ledger entry not found: missing'
+    );
+  });
+});
@@ -0,0 +1,276 @@
+/**
+ * Dispute Service
+ *
+ * Lets support mark a ledger entry as disputed and later resolve it
+ * without touching the entry. Each transition is an append-only ledger
+ * annotation pointing at the disputed entry (parentEntryId); the current
+ * status is derived by replaying the entry's annotation chain.
+ *
+ * A resolution may carry a compensating adjustment, applied through
+ * AdminOpsService.manualAdjustment before the resolution is recorded and
+ * linked back to the dispute by correlation ID and metadata. A failed
+ * adjustment leaves the dispute open, so the resolution can be retried;
+ * the adjustment's idempotency key is derived from the entry and the
+ * resolution's place in the chain, so a retry replays rather than
+ * compensating twice.
+ *
+ * Opening an already open dispute and resolving one that is not open are
+ * rejected. A resolved dispute may be opened again.
+ *
+ * @module services/dispute
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import { LedgerAnnotationModel, LedgerAnnotationKind } from '../db/models/ledger-annotation.model';
+import { AdminOpsService, AdminContext, ManualAdjustmentResponse } from './admin-ops.service';
+import { DisputeStateError } from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Dispute lifecycle state of a ledger entry
+ */
+export type DisputeState = 'none' | 'open' | 'resolved';
+
+/**
+ * One recorded dispute transition
+ */
+export interface DisputeAnnotation {
+  annotationId: string;
+
+  /** Disputed ledger entry */
+  parentEntryId: string;
+
+  /** Position in the entry's annotation chain */
+  sequence: number;
+
+  kind: LedgerAnnotationKind;
+
+  /** Admin who made the transition */
+  actorId: string;
+
+  /** Dispute reason or resolution */
+  note: string;
+
+  /** Compensation granted on resolution, if any */
+  compensation?: number;
+
+  createdAt: Date;
+}
+
+/**
+ * Current dispute status of a ledger entry
+ */
+export interface DisputeStatus {
+  entryId: string;
+  state: DisputeState;
+
+  /** Every transition, oldest first */
+  history: DisputeAnnotation[];
+}
+
+/**
+ * Result of resolving a dispute
+ */
+export interface DisputeResolution {
+  annotation: DisputeAnnotation;
+
+  /** Compensating adjustment, when one was requested */
+  adjustment?: ManualAdjustmentResponse;
+}
+
+/**
+ * Dispute Service Implementation
+ */
+export class DisputeService {
+  private ledgerService: ILedgerService;
+  private adminOps: AdminOpsService;
+
+  constructor(ledgerService: ILedgerService, adminOps: AdminOpsService) {
+    this.ledgerService = ledgerService;
+    this.adminOps = adminOps;
+  }
+
+  /**
+   * Open a dispute against a ledger entry
+   *
+   * @throws DisputeStateError if a dispute is already open
+   */
+  async openDispute(entryId: string, openedBy: AdminContext, reason: string): Promise<DisputeAnnotation> {
+    if (!reason) {
+      throw new Error('Dispute reason is required');
+    }
+
+    const entry = await this.requireEntry(entryId);
+    const status = await this.disputeStatus(entryId);
+
+    if (status.state === 'open') {
+      throw new DisputeStateError(entryId, status.state, 'open');
+    }
+
+    const annotation = await this.append(entry, status, 'dispute_opened', openedBy.adminId, reason, 'open');
+
+    MetricsLogger.incrementCounter(MetricEventType.ADMIN_DISPUTE_OPENED, {
+      entryId,
+      adminId: openedBy.adminId,
+    });
+
+    return annotation;
+  }
+
+  /**
+   * Resolve an open dispute, optionally compensating the entry's account
+   *
+   * @param compensation Points to credit (positive) or debit (negative)
+   * @throws DisputeStateError if no dispute is open
+   */
+  async resolveDispute(
+    entryId: string,
+    resolvedBy: AdminContext,
+    resolution: string,
+    compensation?: number
+  ): Promise<DisputeResolution> {
+    if (!resolution) {
+      throw new Error('Dispute resolution is required');
+    }
+
+    if (compensation !== undefined && (!Number.isSafeInteger(compensation) || compensation === 0)) {
+      throw new Error('Compensation must be a non-zero integer');
+    }
+
+    const entry = await this.requireEntry(entryId);
+    if (compensation !== undefined && entry.accountType !== 'user') {
+      throw new Error('Compensation can only be granted on user entries');
+    }
+
+    const status = await this.disputeStatus(entryId);
+    if (status.state !== 'open') {
+      throw new DisputeStateError(entryId, status.state, 'resolve');
+    }
+
+    // The resolution is recorded only once its compensation has been applied
+    const annotationId = uuidv4();
+    let adjustment: ManualAdjustmentResponse | undefined;
+    if (compensation !== undefined) {
+      const compensationKey = `dispute-${entryId}-${status.history.length}`;
+      adjustment = await this.adminOps.manualAdjustment({
+        userId: entry.accountId,
+        amount: compensation,
+        reason: resolution,
+        admin: resolvedBy,
+        requestId: compensationKey,
+        idempotencyKey: compensationKey,
+        correlationId: `dispute-${entryId}`,
+        metadata: {
+          parentEntryId: entryId,
+          disputeAnnotationId: annotationId,
+        },
+      });
+    }
+
+    const annotation = await this.append(
+      entry,
+      status,
+      'dispute_resolved',
+      resolvedBy.adminId,
+      resolution,
+      'resolve',
+      compensation,
+      annotationId
+    );
+
+    MetricsLogger.incrementCounter(MetricEventType.ADMIN_DISPUTE_RESOLVED, {
+      entryId,
+      adminId: resolvedBy.adminId,
+      compensation: compensation ?? 0,
+    });
+
+    return adjustment ? { annotation, adjustment } : { annotation };
+  }
+
+  /**
+   * Derive an entry's dispute status from its annotation chain
+   */
+  async disputeStatus(entryId: string): Promise<DisputeStatus> {
+    const docs = await LedgerAnnotationModel.find({ parentEntryId: { $eq: entryId } })
+      .sort({ sequence: 1 })
+      .lean()
+      .exec();
+
+    const history: DisputeAnnotation[] = docs.map((doc: any) => ({
+      annotationId: doc.annotationId,
+      parentEntryId: doc.parentEntryId,
+      sequence: doc.sequence,
+      kind: doc.kind,
+      actorId: doc.actorId,
+      note: doc.note,
+      compensation: doc.compensation,
+      createdAt: doc.createdAt,
+    }));
+
+    let state: DisputeState = 'none';
+    for (const annotation of history) {
+      state = annotation.kind === 'dispute_opened' ? 'open' : 'resolved';
+    }
+
+    return { entryId, state, history };
+  }
+
+  /**
+   * Append the next annotation in the chain
+   * A concurrent transition takes the same sequence number and loses on
+   * the unique index.
+   */
+  private async append(
+    entry: LedgerEntry,
+    status: DisputeStatus,
+    kind: LedgerAnnotationKind,
+    actorId: string,
+    note: string,
+    action: string,
+    compensation?: number,
+    annotationId: string = uuidv4()
+  ): Promise<DisputeAnnotation> {
+    const annotation: DisputeAnnotation = {
+      annotationId,
+      parentEntryId: status.entryId,
+      sequence: status.history.length,
+      kind,
+      actorId,
+      note,
+      compensation,
+      createdAt: new Date(),
+    };
+
+    try {
+      // The account is stored for per-user history, not returned
+      await LedgerAnnotationModel.create({ ...annotation, accountId: entry.accountId });
+    } catch (error: any) {
+      if (error.code === 11000) {
+        const current = await this.disputeStatus(status.entryId);
+        throw new DisputeStateError(status.entryId, current.state, action);
+      }
+      throw error;
+    }
+
+    return annotation;
+  }
+
+  private async requireEntry(entryId: string): Promise<LedgerEntry> {
+    const entry = await this.ledgerService.getEntry(entryId);
+    if (!entry) {
+      throw new Error(`Ledger entry not found: ${entryId}`);
+    }
+    return entry;
+  }
+}
+
+/**
+ * Factory function to create a dispute service
+ */
+export function createDisputeService(
+  ledgerService: ILedgerService,
+  adminOps: AdminOpsService
+): DisputeService {
+  return new DisputeService(ledgerService, adminOps);
+}
@@ -0,0 +1,269 @@
+/**
+ * Earn Ingestion Service Tests
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { EarnIngestionService, EarnRulesEngine, PointsPerUnitRule, PurchaseEvent } from './earn-ingestion.service';
+import { MultiplierResolver } from './earn-multipliers';
+import { DuplicateInBatchError, DuplicateReferenceError, LedgerAppendError } from './types';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import { TransactionReason } from '../wallets/types';
+
+jest.mock('../wallets/wallet-application');
+
+describe('EarnIngestionService', () => {
+  let entries: any[];
+  let balances: Record<string, number>;
+  let failKeys: Map<string, unknown>;
+  let appliedKeys: Set<string>;
+  let mockLedgerService: any;
+  let service: EarnIngestionService;
+
+  const purchase = (eventId: string, userId: string, amount: number, fields: Partial<PurchaseEvent> = {}): PurchaseEvent => ({
+    eventId,
+    userId,
+    amount,
+    currency: 'USD',
+    reference: `order-${eventId}`,
+    occurredAt: new Date('2025-03-01T12:00:00Z'),
+    ...fields,
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    let n = 0;
+    (uuidv4 as jest.Mock).mockImplementation(() => `uuid-${++n}`);
+    entries = [];
+    balances = {};
+    failKeys = new Map();
+    appliedKeys = new Set();
+    // One application per key, as the wallet_applications unique index enforces
+    (applyWalletDelta as jest.Mock).mockImplementation(async (_userId: string, _delta: number, key: string) => {
+      if (appliedKeys.has(key)) {
+        return false;
+      }
+      appliedKeys.add(key);
+      return true;
+    });
+
+    mockLedgerService = {
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string) => {
+        // Yield so events of different users interleave
+        await new Promise(resolve => setImmediate(resolve));
+        return { accountId, availableBalance: balances[accountId] || 0 };
+      }),
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        if (failKeys.has(request.idempotencyKey)) {
+          throw LedgerAppendError.from(failKeys.get(request.idempotencyKey), request);
+        }
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, ...request };
+        entries.push(entry);
+        balances[request.accountId] = request.balanceAfter;
+        return { entry, inserted: true };
+      }),
+    };
+
+    const engine = new EarnRulesEngine([
+      new PointsPerUnitRule('base', 1, 'USD'),
+      { ruleId: 'big-spender', points: event => (event.amount >= 10000 ? 50 : 0) },
+    ]);
+    service = new EarnIngestionService(mockLedgerService, engine);
+  });
+
+  it('should append each award under a key derived from the event ID', async () => {
+    const report = await service.ingestEvents([purchase('evt-1', 'user-1', 12550), purchase('evt-2', 'user-2', 999)]);
+
+    expect(report).toMatchObject({ created: 2, alreadyApplied: 0, rejected: 0 });
+    expect(report.outcomes).toEqual([
+      { eventId: 'evt-1', status: 'created', transactionIds: expect.any(Array), points: 175 },
+      { eventId: 'evt-2', status: 'created', transactionIds: expect.any(Array), points: 9 },
+    ]);
+    expect(entries.map(e => e.idempotencyKey)).toEqual(['earn-evt-1-base', 'earn-evt-2-base', 'earn-evt-1-big-spender']);
+    expect(entries[0]).toMatchObject({
+      accountId: 'user-1',
+      amount: 125,
+      reason: TransactionReason.PURCHASE_EARN,
+      correlationId: 'order-evt-1',
+      metadata: { eventId: 'evt-1', ruleId: 'base' },
+    });
+    expect(appliedKeys).toEqual(new Set(['earn-evt-1-base', 'earn-evt-2-base', 'earn-evt-1-big-spender']));
+  });
+
+  it('should create no transactions when a batch is replayed', async () => {
+    const batch = [purchase('evt-1', 'user-1', 12550), purchase('evt-2', 'user-1', 500), purchase('evt-3', 'user-2', 700)];
+    const first = await service.ingestEvents(batch);
+    const appended = entries.length;
+    const applied = appliedKeys.size;
+
+    const replay = await service.ingestEvents(batch);
+
+    expect(entries).toHaveLength(appended);
+    expect(appliedKeys.size).toBe(applied);
+    expect(replay).toMatchObject({ created: 0, alreadyApplied: 3, rejected: 0 });
+    expect(replay.outcomes.map(o => o.transactionIds)).toEqual(first.outcomes.map(o => o.transactionIds));
+  });
+
+  it('should credit the wallet on redelivery of an award whose wallet update failed', async () => {
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    const first = await service.ingestEvents([purchase('evt-1', 'user-1', 500)]);
+    expect(first.rejected).toBe(1);
+    expect(entries).toHaveLength(1);
+
+    const redelivered = await service.ingestEvents([purchase('evt-1', 'user-1', 500)]);
+
+    expect(redelivered).toMatchObject({ alreadyApplied: 1, rejected: 0 });
+    expect(entries).toHaveLength(1);
+    expect(applyWalletDelta).toHaveBeenLastCalledWith('user-1', 5, 'earn-evt-1-base');
+    expect(appliedKeys).toEqual(new Set(['earn-evt-1-base']));
+  });
+
+  it('should report a failing event and keep applying the rest of the batch', async () => {
+    failKeys.set('earn-evt-2-base', new Error('connection reset'));
+    failKeys.set('earn-evt-3-base', new DuplicateReferenceError('user-2', 'order-evt-3', new Date()));
+
+    const report = await service.ingestEvents([
+      purchase('evt-1', 'user-1', 100),
+      purchase('evt-2', 'user-1', 200),
+      purchase('evt-3', 'user-2', 300),
+      purchase('evt-4', 'user-1', 400),
+    ]);
+
+    expect(report.outcomes.map(o => [o.eventId, o.status, o.reason, o.retryable])).toEqual([
+      ['evt-1', 'created', undefined, undefined],
+      ['evt-2', 'rejected', 'LEDGER_APPEND_FAILED', true],
+      ['evt-3', 'rejected', 'DUPLICATE_REFERENCE', false],
+      ['evt-4', 'created', undefined, undefined],
+    ]);
+    expect(report).toMatchObject({ created: 2, rejected: 2 });
+  });
+
+  it('should reject malformed events and events no rule earns on', async () => {
+    const report = await service.ingestEvents([
+      purchase('', 'user-1', 100),
+      purchase('evt-2', 'user-1', -5),
+      purchase('evt-3', 'user-1', 500, { currency: 'EUR' }),
+    ]);
+
+    expect(report.outcomes.map(o => o.reason)).toEqual(['INVALID_EVENT', 'INVALID_EVENT', 'NO_EARN_RULE_MATCHED']);
+    expect(report.outcomes.every(o => o.retryable === false)).toBe(true);
+    expect(entries).toHaveLength(0);
+  });
+
+  it('should reject an event a misconfigured rule awards a fractional amount', async () => {
+    const broken = new EarnIngestionService(
+      mockLedgerService,
+      new EarnRulesEngine([{ ruleId: 'half', points: event => event.amount / 2 }])
+    );
+
+    const report = await broken.ingestEvents([purchase('evt-1', 'user-1', 3)]);
+
+    expect(report.outcomes[0]).toMatchObject({ status: 'rejected', reason: 'INVALID_EARN_AWARD', retryable: false });
+  });
+
+  it('should stack bonuses on each rule and record the breakdown on the entry', async () => {
+    const resolver = new MultiplierResolver({
+      rules: [
+        { bonusClass: 'tier', mode: 'multiplicative' },
+        { bonusClass: 'channel', mode: 'additive' },
+      ],
+      maxMultiplier: '2',
+    });
+    const engine = new EarnRulesEngine([new PointsPerUnitRule('base', 1, 'USD')], {
+      resolver,
+      sources: [
+        { bonuses: event => (event.userId === 'user-gold' ? [{ bonusClass: 'tier', source: 'gold', multiplier: '1.5' }] : []) },
+        { bonuses: event => (event.merchantId === 'app' ? [{ bonusClass: 'channel', source: 'app', multiplier: '1.1' }] : []) },
+      ],
+    });
+    const boosted = new EarnIngestionService(mockLedgerService, engine);
+
+    const report = await boosted.ingestEvents([
+      purchase('evt-1', 'user-gold', 10000, { merchantId: 'app' }),
+      purchase('evt-2', 'user-1', 10000),
+    ]);
+
+    expect(report.outcomes.map(o => o.points)).toEqual([160, 100]);
+    expect(entries.find(e => e.accountId === 'user-gold')).toMatchObject({
+      amount: 160,
+      metadata: {
+        earnBreakdown: {
+          basePoints: 100,
+          components: [
+            { bonusClass: 'tier', source: 'gold', points: 50 },
+            { bonusClass: 'channel', source: 'app', points: 10 },
+          ],
+          multiplier: '1.6',
+          totalPoints: 160,
+        },
+      },
+    });
+    expect(entries.find(e => e.accountId === 'user-1')!.metadata.earnBreakdown).toMatchObject({ components: [], totalPoints: 100 });
+  });
+
+  it('should apply one user\'s events in batch order while users run concurrently', async () => {
+    const events = Array.from({ length: 20 }, (_, i) => purchase(`evt-${i}`, `user-${i % 2}`, (i + 1) * 100));
+
+    await service.ingestEvents(events);
+
+    for (const userId of ['user-0', 'user-1']) {
+      const chain = entries.filter(e => e.accountId === userId);
+      expect(chain.map(e => e.metadata.eventId)).toEqual(events.filter(e => e.userId === userId).map(e => e.eventId));
+      chain.forEach((entry, i) => {
+        expect(entry.balanceBefore).toBe(i === 0 ? 0 : chain[i - 1].balanceAfter);
+      });
+    }
+    // Both users were in flight at once
+    const order = entries.map(e => e.accountId);
+    expect(order.slice(0, 2).sort()).toEqual(['user-0', 'user-1']);
+  });
+
+  describe('duplicates within a batch', () => {
+    let strict: EarnIngestionService;
+
+    beforeEach(() => {
+      strict = new EarnIngestionService(mockLedgerService, new EarnRulesEngine([new PointsPerUnitRule('base', 1, 'USD')]), {
+        rejectDuplicatesInBatch: true,
+      });
+    });
+
+    it('should reject a batch holding the same purchase under two event IDs', async () => {
+      const batch = [
+        purchase('evt-1', 'user-1', 500, { reference: 'order-9' }),
+        purchase('evt-2', 'user-2', 500, { reference: 'order-9' }),
+        purchase('evt-3', 'user-1', 500, { reference: 'order-9' }),
+      ];
+
+      const attempt = strict.ingestEvents(batch);
+
+      await expect(attempt).rejects.toThrow(DuplicateInBatchError);
+      await expect(attempt).rejects.toMatchObject({ details: { duplicates: [['evt-1', 'evt-3']] } });
+      expect(entries).toHaveLength(0);
+    });
+
+    it('should apply a batch whose events differ in user, reference, currency or amount', async () => {
+      const report = await strict.ingestEvents([
+        purchase('evt-1', 'user-1', 500, { reference: 'order-9' }),
+        purchase('evt-2', 'user-2', 500, { reference: 'order-9' }),
+        purchase('evt-3', 'user-1', 600, { reference: 'order-9' }),
+        purchase('evt-4', 'user-1', 500, { reference: 'order-10' }),
+        purchase('evt-5', 'user-1', 500, { reference: undefined }),
+        purchase('evt-6', 'user-1', 500, { reference: undefined }),
+      ]);
+
+      expect(report).toMatchObject({ created: 6, rejected: 0 });
+    });
+
+    it('should leave duplicates to the event IDs when not enabled', async () => {
+      const report = await service.ingestEvents([
+        purchase('evt-1', 'user-1', 500, { reference: 'order-9' }),
+        purchase('evt-2', 'user-1', 500, { reference: 'order-9' }),
+      ]);
+
+      expect(report.created).toBe(2);
+    });
+  });
+});
@@ -0,0 +1,480 @@
+/**
+ * Earn Ingestion Service
+ *
+ * Turns batches of upstream purchase events into earns. The POS delivers
+ * batches at least once, so every step is keyed by the upstream event ID:
+ * - each event is run through the earn rules engine, which yields zero or
+ *   more awards (one per matching rule)
+ * - each award is appended under the idempotency key
+ *   `earn-<eventId>-<ruleId>`, so a redelivered event replays its entries
+ *   instead of earning again
+ * - each award is applied to the wallet with applyWalletDelta under the
+ *   same key, so a redelivery also completes an award whose wallet
+ *   update never landed
+ * - each event gets its own status in the report: created,
+ *   already_applied, or rejected with an error code
+ *
+ * Events of one user are applied in batch order, one at a time; users
+ * are processed concurrently. A failing event is reported and the batch
+ * carries on, including with later events of the same user.
+ *
+ * Rejections carry the error taxonomy's code. Storage failures and rate
+ * limits are marked retryable (see isRetryableAppendError); anything
+ * else is a poison event that will fail the same way on redelivery.
+ *
+ * @module services/earn-ingestion
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { CreateLedgerEntryResult } from '../ledger/types';
+import { LedgerService } from '../ledger/ledger.service';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import {
+  DuplicateInBatchError,
+  InvalidEarnAwardError,
+  LedgerAppendError,
+  WalletServiceError,
+  findErrorCause,
+  isRetryableAppendError,
+} from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { ProgramConfigSource } from '../config/program';
+import { MultiplierResolver, EarnBonus, EarnBreakdown } from './earn-multipliers';
+
+/**
+ * A purchase reported by the POS
+ */
+export interface PurchaseEvent {
+  /** Upstream event ID, unique per purchase event */
+  eventId: string;
+
+  /** User who made the purchase */
+  userId: string;
+
+  /** Purchase total in minor currency units (e.g. cents) */
+  amount: number;
+
+  /** ISO 4217 currency of the purchase */
+  currency: string;
+
+  /** Upstream order reference, recorded as the correlation ID */
+  reference?: string;
+
+  /** Store or terminal that reported the purchase */
+  merchantId?: string;
+
+  occurredAt: Date;
+}
+
+/**
+ * A rule that awards points for purchases
+ */
+export interface EarnRule {
+  /** Stable identifier, part of each award's idempotency key */
+  readonly ruleId: string;
+
+  /**
+   * Points the event earns under this rule (0 if the rule does not apply)
+   * Must be deterministic, so a redelivered event earns the same.
+   */
+  points(event: PurchaseEvent): number;
+}
+
+/**
+ * Points one rule awards for one event
+ */
+export interface EarnAward {
+  ruleId: string;
+  points: number;
+
+  /** How the points were built, when multipliers are configured */
+  breakdown?: EarnBreakdown;
+}
+
+/**
+ * Supplies the bonuses (tier, campaign, channel, ...) applying to an event
+ * Must be deterministic, like an earn rule.
+ */
+export interface EarnBonusSource {
+  bonuses(event: PurchaseEvent): EarnBonus[];
+}
+
+/**
+ * Bonus multipliers applied on top of every rule's points
+ */
+export interface EarnMultipliers {
+  resolver: MultiplierResolver;
+  sources: EarnBonusSource[];
+}
+
+/**
+ * Earn rules engine: every rule is evaluated and each non-zero result
+ * is an award. With multipliers, each rule's points are the base that
+ * the event's bonuses stack on, and the award carries the breakdown.
+ */
+export class EarnRulesEngine {
+  private rules: EarnRule[];
+  private multipliers?: EarnMultipliers;
+
+  constructor(rules: EarnRule[], multipliers?: EarnMultipliers) {
+    const ids = new Set(rules.map(rule => rule.ruleId));
+    if (ids.size !== rules.length) {
+      throw new Error('Earn rule IDs must be unique');
+    }
+    this.rules = rules;
+    this.multipliers = multipliers;
+  }
+
+  /**
+   * Awards for an event, in rule order
+   *
+   * @throws InvalidEarnAwardError if a rule yields a negative or fractional amount
+   */
+  evaluate(event: PurchaseEvent): EarnAward[] {
+    const awards: EarnAward[] = [];
+    const bonuses = this.multipliers?.sources.flatMap(source => source.bonuses(event));
+
+    for (const rule of this.rules) {
+      const points = rule.points(event);
+      if (!Number.isSafeInteger(points) || points < 0) {
+        throw new InvalidEarnAwardError(rule.ruleId, points);
+      }
+      if (points === 0) {
+        continue;
+      }
+      if (this.multipliers) {
+        const breakdown = this.multipliers.resolver.resolve(points, bonuses!);
+        awards.push({ ruleId: rule.ruleId, points: breakdown.totalPoints, breakdown });
+      } else {
+        awards.push({ ruleId: rule.ruleId, points });
+      }
+    }
+    return awards;
+  }
+}
+
+/**
+ * Rule awarding a fixed number of points per whole currency unit spent
+ */
+export class PointsPerUnitRule implements EarnRule {
+  readonly ruleId: string;
+  private pointsPerUnit: number;
+  private minorUnitsPerUnit: number;
+  private currency: string;
+
+  constructor(ruleId: string, pointsPerUnit: number, currency: string, minorUnitsPerUnit = 100) {
+    this.ruleId = ruleId;
+    this.pointsPerUnit = pointsPerUnit;
+    this.currency = currency;
+    this.minorUnitsPerUnit = minorUnitsPerUnit;
+  }
+
+  points(event: PurchaseEvent): number {
+    if (event.currency !== this.currency) {
+      return 0;
+    }
+    return Math.floor(event.amount / this.minorUnitsPerUnit) * this.pointsPerUnit;
+  }
+}
+
+/**
+ * Rule awarding the program's earn rate for the purchase currency
+ * The rate is read when the event is evaluated, so a reload applies to
+ * events ingested after it; a redelivered event replays what it earned.
+ */
+export class ProgramEarnRule implements EarnRule {
+  readonly ruleId: string;
+  private program: ProgramConfigSource;
+
+  constructor(program: ProgramConfigSource, ruleId = 'program-rate') {
+    this.program = program;
+    this.ruleId = ruleId;
+  }
+
+  points(event: PurchaseEvent): number {
+    const rate = this.program.current().earnRates.find(r => r.currency === event.currency);
+    if (!rate) {
+      return 0;
+    }
+    return Math.floor(event.amount / rate.minorUnitsPerUnit) * rate.pointsPerUnit;
+  }
+}
+
+/**
+ * Per-event ingestion status
+ */
+export type IngestStatus = 'created' | 'already_applied' | 'rejected';
+
+/**
+ * Outcome of one event
+ */
+export interface EventOutcome {
+  eventId: string;
+  status: IngestStatus;
+
+  /** Transaction IDs of the event's earns (new or replayed) */
+  transactionIds: string[];
+
+  /** Points the event earned */
+  points: number;
+
+  /** Error code, when rejected */
+  reason?: string;
+
+  /** Whether redelivering the event may succeed, when rejected */
+  retryable?: boolean;
+}
+
+/**
+ * Ingestion report, one outcome per event in batch order
+ */
+export interface IngestReport {
+  outcomes: EventOutcome[];
+  created: number;
+  alreadyApplied: number;
+  rejected: number;
+}
+
+/**
+ * Configuration for earn ingestion
+ */
+export interface EarnIngestionConfig {
+  /** Currency stamped on earn entries */
+  defaultCurrency: string;
+
+  /**
+   * Program config whose expiration policy dates each earn; when its
+   * expiration is enabled, an earn expires lifetimeDays after the purchase
+   */
+  program?: ProgramConfigSource;
+
+  /**
+   * Reject a batch holding two events with the same user, reference,
+   * currency and amount, even under different event IDs. Events without
+   * a reference are never treated as duplicates.
+   */
+  rejectDuplicatesInBatch: boolean;
+}
+
+const DEFAULT_CONFIG: EarnIngestionConfig = {
+  defaultCurrency: 'points',
+  rejectDuplicatesInBatch: false,
+};
+
+type IngestLedger = Pick<LedgerService, 'createEntryWithResult' | 'getBalanceSnapshot'>;
+
+/**
+ * Earn Ingestion Service Implementation
+ */
+export class EarnIngestionService {
+  private config: EarnIngestionConfig;
+  private ledgerService: IngestLedger;
+  private engine: EarnRulesEngine;
+
+  constructor(ledgerService: IngestLedger, engine: EarnRulesEngine, config: Partial<EarnIngestionConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+    this.engine = engine;
+  }
+
+  /**
+   * Apply a batch of purchase events
+   * Never throws for a bad event; its outcome says why it was rejected.
+   *
+   * @throws DuplicateInBatchError if rejectDuplicatesInBatch is set and the
+   *   batch holds duplicate events; nothing in the batch is applied
+   */
+  async ingestEvents(events: PurchaseEvent[]): Promise<IngestReport> {
+    if (this.config.rejectDuplicatesInBatch) {
+      assertNoDuplicateEvents(events);
+    }
+
+    const outcomes: EventOutcome[] = new Array(events.length);
+
+    // Events per user, in batch order
+    const byUser = new Map<string, number[]>();
+    events.forEach((event, index) => {
+      if (!isValidEvent(event)) {
+        outcomes[index] = rejected(event, 'INVALID_EVENT', false);
+        return;
+      }
+      const indexes = byUser.get(event.userId) || [];
+      indexes.push(index);
+      byUser.set(event.userId, indexes);
+    });
+
+    await Promise.all(
+      [...byUser.values()].map(async indexes => {
+        for (const index of indexes) {
+          outcomes[index] = await this.applyEvent(events[index]);
+        }
+      })
+    );
+
+    return {
+      outcomes,
+      created: outcomes.filter(o => o.status === 'created').length,
+      alreadyApplied: outcomes.filter(o => o.status === 'already_applied').length,
+      rejected: outcomes.filter(o => o.status === 'rejected').length,
+    };
+  }
+
+  private async applyEvent(event: PurchaseEvent): Promise<EventOutcome> {
+    try {
+      const awards = this.engine.evaluate(event);
+      if (awards.length === 0) {
+        return rejected(event, 'NO_EARN_RULE_MATCHED', false);
+      }
+
+      const transactionIds: string[] = [];
+      let points = 0;
+      let inserted = 0;
+
+      for (const award of awards) {
+        const result = await this.appendAward(event, award);
+        transactionIds.push(result.entry.transactionId);
+        points += award.points;
+        if (result.inserted) {
+          inserted++;
+        }
+      }
+
+      return {
+        eventId: event.eventId,
+        status: inserted > 0 ? 'created' : 'already_applied',
+        transactionIds,
+        points,
+      };
+    } catch (error) {
+      return classifyRejection(event, error);
+    }
+  }
+
+  private async appendAward(event: PurchaseEvent, award: EarnAward): Promise<CreateLedgerEntryResult> {
+    const snapshot = await this.ledgerService.getBalanceSnapshot(event.userId, 'user');
+    const key = `earn-${event.eventId}-${award.ruleId}`;
+
+    const result = await this.ledgerService.createEntryWithResult({
+      transactionId: uuidv4(),
+      accountId: event.userId,
+      accountType: 'user',
+      amount: award.points,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PURCHASE_EARN,
+      idempotencyKey: key,
+      requestId: key,
+      balanceBefore: snapshot.availableBalance,
+      balanceAfter: snapshot.availableBalance + award.points,
+      currency: this.config.defaultCurrency,
+      correlationId: event.reference,
+      featureType: 'purchase_earn',
+      metadata: {
+        eventId: event.eventId,
+        ruleId: award.ruleId,
+        merchantId: event.merchantId,
+        occurredAt: new Date(event.occurredAt).toISOString(),
+        expiresAt: this.expiresAt(event),
+        earnBreakdown: award.breakdown,
+      },
+    });
+
+    // Re-driven on replay; a no-op once the award has moved the wallet
+    await applyWalletDelta(result.entry.accountId, award.points, key);
+
+    return result;
+  }
+
+  /**
+   * Expiry of an event's earns under the program's expiration policy (none without one)
+   */
+  private expiresAt(event: PurchaseEvent): string | undefined {
+    const expiration = this.config.program?.current().expiration;
+    if (!expiration?.enabled) {
+      return undefined;
+    }
+    const lifetimeMs = expiration.lifetimeDays * 24 * 60 * 60 * 1000;
+    return new Date(new Date(event.occurredAt).getTime() + lifetimeMs).toISOString();
+  }
+}
+
+/**
+ * Whether an event has every field an earn needs
+ */
+function isValidEvent(event: PurchaseEvent): boolean {
+  return (
+    !!event &&
+    typeof event.eventId === 'string' &&
+    event.eventId.length > 0 &&
+    typeof event.userId === 'string' &&
+    event.userId.length > 0 &&
+    Number.isSafeInteger(event.amount) &&
+    event.amount >= 0 &&
+    typeof event.currency === 'string' &&
+    event.currency.length > 0 &&
+    !Number.isNaN(new Date(event.occurredAt).getTime())
+  );
+}
+
+/**
+ * @throws DuplicateInBatchError if valid events share user, reference, currency and amount
+ */
+function assertNoDuplicateEvents(events: PurchaseEvent[]): void {
+  const groups = new Map<string, string[]>();
+  for (const event of events) {
+    if (!isValidEvent(event) || !event.reference) {
+      continue;
+    }
+    const key = JSON.stringify([event.userId, event.reference, event.currency, event.amount]);
+    groups.set(key, [...(groups.get(key) || []), event.eventId]);
+  }
+
+  const duplicates = [...groups.values()].filter(eventIds => eventIds.length > 1);
+  if (duplicates.length > 0) {
+    throw new DuplicateInBatchError(duplicates);
+  }
+}
+
+function rejected(event: PurchaseEvent, reason: string, retryable: boolean): EventOutcome {
+  return {
+    eventId: event && typeof event.eventId === 'string' ? event.eventId : '',
+    status: 'rejected',
+    transactionIds: [],
+    points: 0,
+    reason,
+    retryable,
+  };
+}
+
+/**
+ * Map an append failure onto a rejection using the error taxonomy
+ */
+function classifyRejection(event: PurchaseEvent, error: unknown): EventOutcome {
+  if (error instanceof InvalidEarnAwardError) {
+    return rejected(event, 'INVALID_EARN_AWARD', false);
+  }
+
+  const append = findErrorCause(error, LedgerAppendError);
+  if (append) {
+    return rejected(event, append.code, isRetryableAppendError(append));
+  }
+
+  const typed = findErrorCause(error, WalletServiceError);
+  if (typed) {
+    return rejected(event, typed.code, typed.statusCode >= 500);
+  }
+
+  return rejected(event, 'INTERNAL', true);
+}
+
+/**
+ * Factory function to create an earn ingestion service
+ */
+export function createEarnIngestionService(
+  ledgerService: IngestLedger,
+  engine: EarnRulesEngine,
+  config?: Partial<EarnIngestionConfig>
+): EarnIngestionService {
+  return new EarnIngestionService(ledgerService, engine, config);
+}
@@ -0,0 +1,107 @@
+/**
+ * Earn Multiplier Stacking Tests
+ */
+
+import { MultiplierResolver, StackingPolicy, EarnBonus, formatEarnBreakdown } from './earn-multipliers';
+
+const tierFirst: StackingPolicy = {
+  rules: [
+    { bonusClass: 'tier', mode: 'multiplicative' },
+    { bonusClass: 'campaign', mode: 'additive' },
+    { bonusClass: 'channel', mode: 'additive' },
+  ],
+  maxMultiplier: '3',
+};
+
+const campaignFirst: StackingPolicy = {
+  rules: [
+    { bonusClass: 'campaign', mode: 'additive' },
+    { bonusClass: 'tier', mode: 'multiplicative' },
+  ],
+  maxMultiplier: '3',
+};
+
+const capped: StackingPolicy = { ...tierFirst, maxMultiplier: '2.5' };
+
+const tier = (multiplier: string, source = 'gold'): EarnBonus => ({ bonusClass: 'tier', source, multiplier });
+const campaign = (multiplier: string, source = 'spring'): EarnBonus => ({ bonusClass: 'campaign', source, multiplier });
+const channel = (multiplier: string, source = 'app'): EarnBonus => ({ bonusClass: 'channel', source, multiplier });
+
+describe('MultiplierResolver', () => {
+  it.each<[string, StackingPolicy, number, EarnBonus[], string, number[], number, number]>([
+    // name, policy, base, bonuses, multiplier, component points, cap points, total
+    ['no bonuses', tierFirst, 100, [], '1', [], 0, 100],
+    ['one multiplicative bonus', tierFirst, 100, [tier('1.5')], '1.5', [50], 0, 150],
+    ['multiplicative bonuses compound', tierFirst, 100, [tier('1.5'), tier('1.2', 'promo')], '1.8', [50, 30], 0, 180],
+    ['additive bonuses add their increments', tierFirst, 100, [campaign('1.2'), campaign('1.1', 'launch')], '1.3', [20, 10], 0, 130],
+    ['additive after multiplicative', tierFirst, 100, [campaign('1.2'), tier('1.5')], '1.7', [50, 20], 0, 170],
+    ['multiplicative after additive', campaignFirst, 100, [tier('1.5'), campaign('1.2')], '1.8', [20, 60], 0, 180],
+    ['every class in policy order', tierFirst, 100, [channel('1.1'), campaign('1.2'), tier('2')], '2.3', [100, 20, 10], 0, 230],
+    ['capped at the maximum', capped, 100, [tier('2'), campaign('1.5'), channel('1.5')], '2.5', [100, 50, 50], -50, 250],
+    ['exactly at the maximum is not capped', capped, 100, [tier('2.5')], '2.5', [150], 0, 250],
+    ['a neutral bonus adds nothing', tierFirst, 100, [tier('1'), campaign('1')], '1', [0, 0], 0, 100],
+    ['decimals are exact', tierFirst, 100, [campaign('1.15')], '1.15', [15], 0, 115],
+    ['the total rounds half to even once', tierFirst, 7, [tier('1.5'), campaign('1.25')], '1.75', [3, 2], 0, 12],
+    ['zero base points stay zero', tierFirst, 0, [tier('2')], '2', [0], 0, 0],
+  ])('%s', (_name, policy, base, bonuses, multiplier, componentPoints, capPoints, total) => {
+    const breakdown = new MultiplierResolver(policy).resolve(base, bonuses);
+
+    expect(breakdown.multiplier).toBe(multiplier);
+    expect(breakdown.components.map(c => c.points)).toEqual(componentPoints);
+    expect(breakdown.capPoints).toBe(capPoints);
+    expect(breakdown.capped).toBe(capPoints < 0);
+    expect(breakdown.totalPoints).toBe(total);
+    expect(base + componentPoints.reduce((sum, p) => sum + p, 0) + capPoints).toBe(total);
+  });
+
+  it('records each component with its class, source and mode in application order', () => {
+    const breakdown = new MultiplierResolver(tierFirst).resolve(100, [campaign('1.2'), tier('1.5')]);
+
+    expect(breakdown).toEqual({
+      basePoints: 100,
+      components: [
+        { bonusClass: 'tier', source: 'gold', multiplier: '1.5', mode: 'multiplicative', points: 50 },
+        { bonusClass: 'campaign', source: 'spring', multiplier: '1.2', mode: 'additive', points: 20 },
+      ],
+      multiplier: '1.7',
+      capped: false,
+      capPoints: 0,
+      totalPoints: 170,
+    });
+  });
+
+  it('is pure', () => {
+    const resolver = new MultiplierResolver(capped);
+    const bonuses = [tier('2'), campaign('1.5'), channel('1.5')];
+    const copy = structuredClone(bonuses);
+
+    expect(resolver.resolve(100, bonuses)).toEqual(resolver.resolve(100, bonuses));
+    expect(bonuses).toEqual(copy);
+  });
+
+  it.each<[string, () => unknown, string]>([
+    ['a bonus class without a rule', () => new MultiplierResolver(tierFirst).resolve(100, [{ bonusClass: 'referral', source: 'x', multiplier: '2' }]), 'No stacking rule for bonus class referral'],
+    ['a multiplier below 1', () => new MultiplierResolver(tierFirst).resolve(100, [tier('0.5')]), 'Multiplier must be at least 1: 0.5'],
+    ['a malformed multiplier', () => new MultiplierResolver(tierFirst).resolve(100, [tier('1.5x')]), 'not a decimal number'],
+    ['fractional base points', () => new MultiplierResolver(tierFirst).resolve(1.5, []), 'Base points must be a non-negative integer'],
+    ['a class listed twice', () => new MultiplierResolver({ rules: [...tierFirst.rules, tierFirst.rules[0]], maxMultiplier: '3' }), 'appear in the stacking policy once'],
+    ['an unknown mode', () => new MultiplierResolver({ rules: [{ bonusClass: 'tier', mode: 'max' as any }], maxMultiplier: '3' }), 'Unknown stacking mode for tier: max'],
+    ['a cap below 1', () => new MultiplierResolver({ ...tierFirst, maxMultiplier: '0.9' }), 'Multiplier must be at least 1: 0.9'],
+  ])('rejects %s', (_name, run, message) => {
+    expect(run).toThrow(message);
+  });
+});
+
+describe('formatEarnBreakdown', () => {
+  it('explains the base, each bonus and the cap', () => {
+    const breakdown = new MultiplierResolver(capped).resolve(100, [tier('2'), campaign('1.5'), channel('1.5')]);
+
+    expect(formatEarnBreakdown(breakdown)).toBe(
+      '100 base + 100 tier gold (x2) + 50 campaign spring (x1.5) + 50 channel app (x1.5) - 50 cap (x2.5) = 250'
+    );
+  });
+
+  it('explains an award without bonuses', () => {
+    expect(formatEarnBreakdown(new MultiplierResolver(tierFirst).resolve(40, []))).toBe('40 base = 40');
+  });
+});
@@ -0,0 +1,233 @@
+/**
+ * Earn Multiplier Stacking
+ *
+ * Resolves how bonus multipliers (tier, campaign, channel, ...) combine
+ * on top of a rule's base points. The stacking policy lists bonus classes
+ * in application order, each combining additively or multiplicatively
+ * with the multiplier built so far, starting from 1:
+ * - additive: each bonus adds its increment (a 1.5 bonus adds 0.5)
+ * - multiplicative: each bonus multiplies the running multiplier
+ * so order matters whenever the two modes mix. The result is capped at
+ * the policy's maximum multiplier.
+ *
+ * Multipliers are decimal strings and all arithmetic is exact. The total
+ * is rounded half-to-even once, as the fixed-point policy requires. Each
+ * component is the rounded running total after it less the one before,
+ * so base points, components and the cap adjustment always sum to the
+ * total.
+ *
+ * @module services/earn-multipliers
+ */
+
+import { parseDecimal, divideRoundHalfEven, toSafeNumber } from '../points/fixed-point';
+
+/**
+ * How a bonus class combines with the multiplier built so far
+ */
+export type StackingMode = 'additive' | 'multiplicative';
+
+/**
+ * A bonus applying to one earn
+ */
+export interface EarnBonus {
+  /** Class the stacking policy orders by, e.g. tier, campaign or channel */
+  bonusClass: string;
+
+  /** What granted the bonus, e.g. the tier or campaign ID */
+  source: string;
+
+  /** Decimal multiplier, e.g. '1.5' for +50% */
+  multiplier: string;
+}
+
+export interface StackingRule {
+  bonusClass: string;
+  mode: StackingMode;
+}
+
+/**
+ * Stacking policy; rules are applied in order
+ */
+export interface StackingPolicy {
+  rules: StackingRule[];
+
+  /** Largest effective multiplier, as a decimal string of at least 1 */
+  maxMultiplier: string;
+}
+
+/**
+ * Points one bonus added
+ */
+export interface BonusComponent extends EarnBonus {
+  mode: StackingMode;
+  points: number;
+}
+
+/**
+ * How an award was built, recorded on its ledger entry
+ */
+export interface EarnBreakdown {
+  basePoints: number;
+
+  /** In application order */
+  components: BonusComponent[];
+
+  /** Effective multiplier after the cap */
+  multiplier: string;
+
+  capped: boolean;
+
+  /** Points removed by the cap (zero or negative) */
+  capPoints: number;
+
+  totalPoints: number;
+}
+
+/**
+ * Exact decimal: units / 10^places
+ */
+interface Decimal {
+  units: bigint;
+  places: number;
+}
+
+const ONE: Decimal = { units: 1n, places: 0 };
+
+/**
+ * @throws Error if the value is below 1; bonuses only ever add points
+ */
+function parseMultiplier(value: string): Decimal {
+  const { mantissa, places } = parseDecimal(value);
+  const multiplier = { units: mantissa, places };
+  if (compare(multiplier, ONE) < 0) {
+    throw new Error(`Multiplier must be at least 1: ${value}`);
+  }
+  return multiplier;
+}
+
+function align(a: Decimal, b: Decimal): [bigint, bigint, number] {
+  const places = Math.max(a.places, b.places);
+  return [a.units * 10n ** BigInt(places - a.places), b.units * 10n ** BigInt(places - b.places), places];
+}
+
+function add(a: Decimal, b: Decimal): Decimal {
+  const [x, y, places] = align(a, b);
+  return { units: x + y, places };
+}
+
+function subtract(a: Decimal, b: Decimal): Decimal {
+  const [x, y, places] = align(a, b);
+  return { units: x - y, places };
+}
+
+function multiply(a: Decimal, b: Decimal): Decimal {
+  return { units: a.units * b.units, places: a.places + b.places };
+}
+
+function compare(a: Decimal, b: Decimal): number {
+  const [x, y] = align(a, b);
+  return x < y ? -1 : x > y ? 1 : 0;
+}
+
+function format(value: Decimal): string {
+  const digits = value.units.toString().padStart(value.places + 1, '0');
+  const whole = digits.slice(0, digits.length - value.places);
+  const fraction = digits.slice(digits.length - value.places).replace(/0+$/, '');
+  return fraction ? `${whole}.${fraction}` : whole;
+}
+
+function pointsAt(basePoints: number, multiplier: Decimal): number {
+  return toSafeNumber(divideRoundHalfEven(BigInt(basePoints) * multiplier.units, 10n ** BigInt(multiplier.places)));
+}
+
+/**
+ * Applies a stacking policy to an award's base points
+ */
+export class MultiplierResolver {
+  private modes: Map<string, StackingMode>;
+  private order: string[];
+  private maxMultiplier: Decimal;
+
+  /**
+   * @throws Error if a class is listed twice, a mode is unknown, or the cap is below 1
+   */
+  constructor(policy: StackingPolicy) {
+    this.order = policy.rules.map(rule => rule.bonusClass);
+    this.modes = new Map(policy.rules.map(rule => [rule.bonusClass, rule.mode]));
+    if (this.modes.size !== policy.rules.length) {
+      throw new Error('Each bonus class may appear in the stacking policy once');
+    }
+    for (const rule of policy.rules) {
+      if (rule.mode !== 'additive' && rule.mode !== 'multiplicative') {
+        throw new Error(`Unknown stacking mode for ${rule.bonusClass}: ${rule.mode}`);
+      }
+    }
+
+    this.maxMultiplier = parseMultiplier(policy.maxMultiplier);
+  }
+
+  /**
+   * Build an award from base points and the bonuses that apply
+   * Pure: the same inputs always give the same breakdown.
+   *
+   * @throws Error if a bonus's class has no stacking rule or its multiplier is invalid
+   */
+  resolve(basePoints: number, bonuses: EarnBonus[]): EarnBreakdown {
+    if (!Number.isSafeInteger(basePoints) || basePoints < 0) {
+      throw new Error(`Base points must be a non-negative integer: ${basePoints}`);
+    }
+    for (const bonus of bonuses) {
+      if (!this.modes.has(bonus.bonusClass)) {
+        throw new Error(`No stacking rule for bonus class ${bonus.bonusClass}`);
+      }
+    }
+
+    const components: BonusComponent[] = [];
+    let running = ONE;
+    let points = basePoints;
+
+    for (const bonusClass of this.order) {
+      const mode = this.modes.get(bonusClass)!;
+      for (const bonus of bonuses.filter(b => b.bonusClass === bonusClass)) {
+        const multiplier = parseMultiplier(bonus.multiplier);
+        running = mode === 'additive' ? add(running, subtract(multiplier, ONE)) : multiply(running, multiplier);
+
+        const after = pointsAt(basePoints, running);
+        components.push({ ...bonus, mode, points: after - points });
+        points = after;
+      }
+    }
+
+    const capped = compare(running, this.maxMultiplier) > 0;
+    const effective = capped ? this.maxMultiplier : running;
+    const totalPoints = pointsAt(basePoints, effective);
+
+    return {
+      basePoints,
+      components,
+      multiplier: format(effective),
+      capped,
+      capPoints: totalPoints - points,
+      totalPoints,
+    };
+  }
+}
+
+/**
+ * One-line explanation of an award for statements and support
+ *
+ * @example '100 base + 50 tier gold (x1.5) - 10 cap (x1.4) = 140'
+ */
+export function formatEarnBreakdown(breakdown: EarnBreakdown): string {
+  const signed = (points: number) => (points < 0 ? `- ${-points}` : `+ ${points}`);
+  const parts = [`${breakdown.basePoints} base`];
+
+  for (const component of breakdown.components) {
+    parts.push(`${signed(component.points)} ${component.bonusClass} ${component.source} (x${component.multiplier})`);
+  }
+  if (breakdown.capped) {
+    parts.push(`${signed(breakdown.capPoints)} cap (x${breakdown.multiplier})`);
+  }
+
+  return `${parts.join(' ')} = ${breakdown.totalPoints}`;
+}
@@ -0,0 +1,229 @@
+/**
+ * Earn Reference Guard Tests
+ *
+ * Tests for reference-based earn deduplication, exemptions, lenient
+ * flagging, and concurrent duplicate arrivals.
+ */
+
+import { EarnReferenceGuard } from './earn-reference-guard.service';
+import { DuplicateReferenceError } from './types';
+import { EarnReferenceClaimModel } from '../db/models/earn-reference-claim.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { CreateLedgerEntryRequest } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/earn-reference-claim.model');
+jest.mock('../db/models/ledger-entry.model');
+
+describe('EarnReferenceGuard', () => {
+  let claims: Map<string, { idempotencyKey: string; claimedAt: Date }>;
+  let ledgerEarns: any[];
+
+  const claimKey = (query: any) =>
+    `${query.tenantId.$eq ?? ''}:${query.accountId.$eq ?? query.accountId}:${query.reference.$eq ?? query.reference}`;
+
+  const earn = (idempotencyKey: string, overrides: Partial<CreateLedgerEntryRequest> = {}) =>
+    ({
+      transactionId: `txn-${idempotencyKey}`,
+      accountId: 'user-123',
+      accountType: 'user',
+      amount: 100,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.PROMOTIONAL_AWARD,
+      idempotencyKey,
+      requestId: 'req-1',
+      balanceBefore: 0,
+      balanceAfter: 100,
+      currency: 'points',
+      correlationId: 'purchase-42',
+      ...overrides,
+    }) as CreateLedgerEntryRequest;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    claims = new Map();
+    ledgerEarns = [];
+
+    // Emulate the unique (tenantId, accountId, reference) index: a live
+    // claim makes the upsert collide, an expired one is overwritten
+    (EarnReferenceClaimModel.findOneAndUpdate as jest.Mock).mockImplementation(
+      (query: any, update: any) => {
+        const key = claimKey(query);
+        const existing = claims.get(key);
+        if (existing && existing.claimedAt > query.claimedAt.$lte) {
+          const error: any = new Error('E11000 duplicate key error');
+          error.code = 11000;
+          return Promise.reject(error);
+        }
+        claims.set(key, { ...update.$set });
+        return Promise.resolve(update.$set);
+      }
+    );
+    (EarnReferenceClaimModel.findOne as jest.Mock).mockImplementation((query: any) =>
+      Promise.resolve(claims.get(claimKey(query)) || null)
+    );
+    (EarnReferenceClaimModel.create as jest.Mock).mockImplementation((doc: any) => {
+      const key = `${doc.tenantId ?? ''}:${doc.accountId}:${doc.reference}`;
+      if (claims.has(key)) {
+        return Promise.reject(Object.assign(new Error('E11000 duplicate key error'), { code: 11000 }));
+      }
+      claims.set(key, { idempotencyKey: doc.idempotencyKey, claimedAt: doc.claimedAt });
+      return Promise.resolve(doc);
+    });
+    (LedgerEntryModel.findOne as jest.Mock).mockImplementation((query: any) => {
+      const found = ledgerEarns
+        .filter(e =>
+          e.tenantId === query.tenantId.$eq &&
+          e.accountId === query.accountId.$eq &&
+          e.correlationId === query.correlationId.$eq
+        )
+        .sort((a, b) => b.timestamp.getTime() - a.timestamp.getTime())[0];
+      const chain: any = {
+        sort: jest.fn().mockReturnThis(),
+        select: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockResolvedValue(found || null),
+      };
+      return chain;
+    });
+  });
+
+  it('should allow the first earn for a reference', async () => {
+    const guard = new EarnReferenceGuard();
+
+    await expect(guard.beforeAppend(earn('evt-1'))).resolves.toBeUndefined();
+    expect(claims.get(':user-123:purchase-42')?.idempotencyKey).toBe('evt-1');
+  });
+
+  it('should reject a second earn with the same reference inside the window', async () => {
+    const guard = new EarnReferenceGuard();
+    await guard.beforeAppend(earn('evt-1'));
+
+    const error = await guard.beforeAppend(earn('evt-2')).catch(e => e);
+
+    expect(error).toBeInstanceOf(DuplicateReferenceError);
+    expect(error.details.reference).toBe('purchase-42');
+  });
+
+  it('should allow the same reference once the window has passed', async () => {
+    const guard = new EarnReferenceGuard({ windowMs: 60000 });
+    claims.set(':user-123:purchase-42', {
+      idempotencyKey: 'evt-old',
+      claimedAt: new Date(Date.now() - 120000),
+    });
+
+    await expect(guard.beforeAppend(earn('evt-2'))).resolves.toBeUndefined();
+  });
+
+  it('should let replays of the claiming earn through to ledger idempotency', async () => {
+    const guard = new EarnReferenceGuard();
+    await guard.beforeAppend(earn('evt-1'));
+
+    await expect(guard.beforeAppend(earn('evt-1'))).resolves.toBeUndefined();
+  });
+
+  it('should scope references per user', async () => {
+    const guard = new EarnReferenceGuard();
+    await guard.beforeAppend(earn('evt-1'));
+
+    await expect(
+      guard.beforeAppend(earn('evt-2', { accountId: 'user-456' }))
+    ).resolves.toBeUndefined();
+  });
+
+  it('should scope references per tenant', async () => {
+    const guard = new EarnReferenceGuard();
+    await guard.beforeAppend(earn('evt-1', { tenantId: 'tenant-a' }));
+
+    await expect(guard.beforeAppend(earn('evt-2', { tenantId: 'tenant-b' }))).resolves.toBeUndefined();
+    await expect(guard.beforeAppend(earn('evt-3', { tenantId: 'tenant-a' }))).rejects.toThrow(DuplicateReferenceError);
+  });
+
+  it('should claim references under the account ID the ledger stores', async () => {
+    const guard = new EarnReferenceGuard({ userIdTokenizer: async userId => `tok-${userId}` });
+
+    await guard.beforeAppend(earn('evt-1'));
+
+    expect(claims.has(':tok-user-123:purchase-42')).toBe(true);
+    await expect(guard.beforeAppend(earn('evt-2'))).rejects.toThrow(DuplicateReferenceError);
+  });
+
+  it('should count an earn the ledger already holds for the reference', async () => {
+    ledgerEarns.push({
+      accountId: 'user-123',
+      correlationId: 'purchase-42',
+      idempotencyKey: 'evt-before-guard',
+      timestamp: new Date(Date.now() - 1000),
+    });
+    const guard = new EarnReferenceGuard();
+
+    const error = await guard.beforeAppend(earn('evt-2')).catch(e => e);
+
+    expect(error).toBeInstanceOf(DuplicateReferenceError);
+    expect(claims.get(':user-123:purchase-42')?.idempotencyKey).toBe('evt-before-guard');
+    await expect(guard.beforeAppend(earn('evt-before-guard'))).resolves.toBeUndefined();
+  });
+
+  it('should let a reference the ledger earned outside the window be claimed again', async () => {
+    ledgerEarns.push({
+      accountId: 'user-123',
+      correlationId: 'purchase-42',
+      idempotencyKey: 'evt-old',
+      timestamp: new Date(Date.now() - 120000),
+    });
+    const guard = new EarnReferenceGuard({ windowMs: 60000 });
+
+    await expect(guard.beforeAppend(earn('evt-2'))).resolves.toBeUndefined();
+    expect(claims.get(':user-123:purchase-42')?.idempotencyKey).toBe('evt-2');
+  });
+
+  it('should skip exempt reference prefixes', async () => {
+    const guard = new EarnReferenceGuard({ exemptReferencePrefixes: ['batch-'] });
+    await guard.beforeAppend(earn('evt-1', { correlationId: 'batch-7' }));
+
+    await expect(
+      guard.beforeAppend(earn('evt-2', { correlationId: 'batch-7' }))
+    ).resolves.toBeUndefined();
+    expect(EarnReferenceClaimModel.findOneAndUpdate).not.toHaveBeenCalled();
+  });
+
+  it('should ignore non-earn entries and entries without a reference', async () => {
+    const guard = new EarnReferenceGuard();
+
+    await guard.beforeAppend(earn('evt-1', { type: TransactionType.DEBIT, amount: -100 }));
+    await guard.beforeAppend(earn('evt-2', { correlationId: undefined }));
+
+    expect(EarnReferenceClaimModel.findOneAndUpdate).not.toHaveBeenCalled();
+  });
+
+  it('should allow but flag duplicates in lenient mode', async () => {
+    const guard = new EarnReferenceGuard({ lenient: true });
+    await guard.beforeAppend(earn('evt-1'));
+
+    await expect(guard.beforeAppend(earn('evt-2'))).resolves.toBeUndefined();
+
+    const report = guard.getFraudReport();
+    expect(report).toHaveLength(1);
+    expect(report[0]).toMatchObject({
+      userId: 'user-123',
+      reference: 'purchase-42',
+      idempotencyKey: 'evt-2',
+      firstIdempotencyKey: 'evt-1',
+    });
+  });
+
+  it('should admit exactly one of several concurrent duplicates', async () => {
+    const guard = new EarnReferenceGuard();
+
+    const results = await Promise.allSettled(
+      ['evt-1', 'evt-2', 'evt-3', 'evt-4'].map(key => guard.beforeAppend(earn(key)))
+    );
+
+    expect(results.filter(r => r.status === 'fulfilled')).toHaveLength(1);
+    const rejected = results.filter(r => r.status === 'rejected') as PromiseRejectedResult[];
+    expect(rejected).toHaveLength(3);
+    rejected.forEach(r => expect(r.reason).toBeInstanceOf(DuplicateReferenceError));
+  });
+});
@@ -0,0 +1,305 @@
+/**
+ * Earn Reference Guard
+ *
+ * Reference-based deduplication for earns. Upstream event systems can
+ * deliver the same purchase twice under different event IDs, which
+ * defeats idempotency keys. This guard rejects an earn when the same
+ * user already earned against the same reference (correlation ID)
+ * inside a configurable window.
+ *
+ * Registered as a ledger append hook so every earn path is covered.
+ * Claims are recorded with a unique (tenantId, accountId, reference)
+ * index, so two duplicates arriving concurrently cannot both pass. The
+ * account is the one the ledger stores: give the guard the ledger's
+ * userIdTokenizer when it has one. A reference with no claim yet is
+ * seeded from the latest earn the ledger holds for it, so earns written
+ * before the guard was enabled, or by a path that bypassed the hook,
+ * still count.
+ *
+ * In lenient mode duplicates are written but flagged in the fraud report.
+ *
+ * @module services/earn-reference-guard
+ */
+
+import { LedgerAppendHook, CreateLedgerEntryRequest, UserIdTokenizer } from '../ledger/types';
+import { EarnReferenceClaimModel } from '../db/models/earn-reference-claim.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { DuplicateReferenceError, UserIdRejectedError } from './types';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+
+/**
+ * Duplicate earn recorded in the fraud report
+ */
+export interface DuplicateReferenceFlag {
+  /** User credited */
+  userId: string;
+
+  /** Reference shared with the earlier earn */
+  reference: string;
+
+  /** Idempotency key of the duplicate */
+  idempotencyKey: string;
+
+  /** Idempotency key of the earn that first claimed the reference */
+  firstIdempotencyKey: string;
+
+  /** When the reference was first claimed */
+  firstSeenAt: Date;
+
+  /** Amount of the duplicate */
+  amount: number;
+
+  /** When the duplicate was flagged */
+  flaggedAt: Date;
+}
+
+/**
+ * Configuration for the earn reference guard
+ */
+export interface EarnReferenceGuardConfig {
+  /** Window in which a repeated reference counts as a duplicate, in milliseconds */
+  windowMs: number;
+
+  /** Allow duplicates but flag them instead of rejecting */
+  lenient: boolean;
+
+  /** References starting with any of these prefixes are never deduplicated */
+  exemptReferencePrefixes: string[];
+
+  /** Reasons treated as earns */
+  earnReasons: string[];
+
+  /** Maximum flags retained in the in-memory fraud report */
+  maxReportedFlags: number;
+
+  /** The ledger's userIdTokenizer (user IDs are stored as given when unset) */
+  userIdTokenizer?: UserIdTokenizer;
+
+  /** Tenant of a tenant-scoped ledger, for requests that name none */
+  tenantId?: string;
+}
+
+/**
+ * Identifies one claim
+ */
+interface ClaimKey {
+  tenantId?: string;
+  accountId: string;
+  reference: string;
+}
+
+const DEFAULT_CONFIG: EarnReferenceGuardConfig = {
+  windowMs: 86400000, // 24 hours
+  lenient: false,
+  exemptReferencePrefixes: [],
+  earnReasons: [
+    TransactionReason.USER_SIGNUP_BONUS,
+    TransactionReason.REFERRAL_BONUS,
+    TransactionReason.PROMOTIONAL_AWARD,
+    TransactionReason.ADMIN_CREDIT,
+    TransactionReason.PURCHASE_EARN,
+  ],
+  maxReportedFlags: 1000,
+};
+
+/**
+ * Earn Reference Guard Implementation
+ */
+export class EarnReferenceGuard implements LedgerAppendHook {
+  readonly name = 'earn-reference-dedup';
+
+  private config: EarnReferenceGuardConfig;
+  private flags: DuplicateReferenceFlag[] = [];
+
+  constructor(config: Partial<EarnReferenceGuardConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
+  /**
+   * Claim the earn's reference before it is written
+   *
+   * @throws DuplicateReferenceError if the reference was claimed inside the window
+   */
+  async beforeAppend(request: CreateLedgerEntryRequest): Promise<void> {
+    const reference = request.correlationId;
+    if (!reference || !this.isEarn(request) || this.isExempt(reference)) {
+      return;
+    }
+
+    const key: ClaimKey = {
+      tenantId: request.tenantId ?? this.config.tenantId,
+      accountId: await this.storedUserId(request.accountId),
+      reference,
+    };
+    await this.seedClaim(key);
+
+    const now = new Date();
+    const cutoff = new Date(now.getTime() - this.config.windowMs);
+
+    try {
+      // Matches only an expired claim; a live claim makes the upsert
+      // collide with the unique index instead
+      await EarnReferenceClaimModel.findOneAndUpdate(
+        { ...this.claimFilter(key), claimedAt: { $lte: cutoff } },
+        {
+          $set: { idempotencyKey: request.idempotencyKey, claimedAt: now },
+        },
+        { upsert: true, new: true }
+      );
+      return;
+    } catch (error: any) {
+      if (error.code !== 11000) {
+        throw error;
+      }
+    }
+
+    const existing = await EarnReferenceClaimModel.findOne(this.claimFilter(key));
+
+    // Replays of the claiming earn are left to ledger idempotency
+    if (!existing || existing.idempotencyKey === request.idempotencyKey) {
+      return;
+    }
+
+    const flag: DuplicateReferenceFlag = {
+      userId: key.accountId,
+      reference,
+      idempotencyKey: request.idempotencyKey,
+      firstIdempotencyKey: existing.idempotencyKey,
+      firstSeenAt: existing.claimedAt,
+      amount: request.amount,
+      flaggedAt: now,
+    };
+
+    MetricsLogger.incrementCounter(MetricEventType.EARN_DUPLICATE_REFERENCE, {
+      userId: flag.userId,
+      reference,
+      lenient: this.config.lenient,
+      requestId: request.requestId,
+    });
+
+    if (!this.config.lenient) {
+      throw new DuplicateReferenceError(flag.userId, reference, flag.firstSeenAt);
+    }
+
+    this.flags.push(flag);
+    if (this.flags.length > this.config.maxReportedFlags) {
+      this.flags.shift();
+    }
+
+    MetricsLogger.logAlert({
+      severity: AlertSeverity.WARNING,
+      message: `Duplicate earn reference allowed for ${flag.userId}: ${reference}`,
+      metricType: MetricEventType.ADMIN_FRAUD_FLAGGED,
+      timestamp: now,
+      metadata: {
+        userId: flag.userId,
+        reference,
+        idempotencyKey: flag.idempotencyKey,
+        firstIdempotencyKey: flag.firstIdempotencyKey,
+        requestId: request.requestId,
+      },
+    });
+  }
+
+  /**
+   * Duplicates allowed in lenient mode, oldest first
+   */
+  getFraudReport(): DuplicateReferenceFlag[] {
+    return [...this.flags];
+  }
+
+  /**
+   * Record the ledger's latest earn against a reference as its claim,
+   * when the reference has none
+   */
+  private async seedClaim(key: ClaimKey): Promise<void> {
+    const existing = await EarnReferenceClaimModel.findOne(this.claimFilter(key));
+    if (existing) {
+      return;
+    }
+
+    const latest = await LedgerEntryModel.findOne({
+      tenantId: key.tenantId !== undefined ? { $eq: key.tenantId } : { $exists: false },
+      accountId: { $eq: key.accountId },
+      correlationId: { $eq: key.reference },
+      accountType: { $eq: 'user' },
+      type: { $eq: TransactionType.CREDIT },
+      balanceState: { $eq: 'available' },
+      reason: { $in: this.config.earnReasons },
+    })
+      .sort({ timestamp: -1 })
+      .select({ idempotencyKey: 1, timestamp: 1 })
+      .lean()
+      .exec();
+    if (!latest) {
+      return;
+    }
+
+    try {
+      await EarnReferenceClaimModel.create({
+        ...(key.tenantId !== undefined && { tenantId: key.tenantId }),
+        accountId: key.accountId,
+        reference: key.reference,
+        idempotencyKey: latest.idempotencyKey,
+        claimedAt: latest.timestamp,
+      });
+    } catch (error: any) {
+      // Another writer claimed or seeded it first
+      if (error.code !== 11000) {
+        throw error;
+      }
+    }
+  }
+
+  private claimFilter(key: ClaimKey): Record<string, unknown> {
+    return {
+      tenantId: key.tenantId !== undefined ? { $eq: key.tenantId } : { $exists: false },
+      accountId: { $eq: key.accountId },
+      reference: { $eq: key.reference },
+    };
+  }
+
+  /**
+   * The account ID the ledger stores for a user
+   */
+  private async storedUserId(userId: string): Promise<string> {
+    if (!this.config.userIdTokenizer) {
+      return userId;
+    }
+
+    try {
+      return await this.config.userIdTokenizer(userId);
+    } catch (error) {
+      throw new UserIdRejectedError(error);
+    }
+  }
+
+  /**
+   * Whether a request is an earn subject to deduplication
+   */
+  private isEarn(request: CreateLedgerEntryRequest): boolean {
+    return (
+      request.accountType === 'user' &&
+      request.type === TransactionType.CREDIT &&
+      request.balanceState === 'available' &&
+      this.config.earnReasons.includes(request.reason)
+    );
+  }
+
+  /**
+   * Whether a reference is exempt from deduplication
+   */
+  private isExempt(reference: string): boolean {
+    return this.config.exemptReferencePrefixes.some(prefix => reference.startsWith(prefix));
+  }
+}
+
+/**
+ * Factory function to create an earn reference guard
+ */
+export function createEarnReferenceGuard(
+  config?: Partial<EarnReferenceGuardConfig>
+): EarnReferenceGuard {
+  return new EarnReferenceGuard(config);
+}
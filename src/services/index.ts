@@ -10,3 +10,21 @@ export * from './point-accrual.service';
 export * from './point-redemption.service';
 export * from './point-expiration.service';
 export * from './admin-ops.service';
+export * from './redeem-guard.service';
+export * from './account-merge.service';
+export * from './user-export.service';
+export * from './earn-reference-guard.service';
+export * from './bulk-adjustment.service';
+export * from './dispute.service';
+export * from './reference-limit-guard.service';
+export * from './opening-balance.service';
+export * from './legacy-import.service';
+export * from './reference-alias.service';
+export * from './support-admin.service';
+export * from './issuer-quota-guard.service';
+export * from './redemption-recredit.service';
+export * from './transaction-correction.service';
+export * from './earn-ingestion.service';
+export * from './earn-multipliers';
+export * from './daily-earn-cap-guard.service';
+export * from './reference-budget-guard.service';
@@ -0,0 +1,206 @@
+/**
+ * Issuer Quota Guard Tests
+ */
+
+import { IssuerQuotaGuard, IssuerQuotaAlert } from './issuer-quota-guard.service';
+import { IssuerQuotaExceededError, UnauthorizedCommitterError } from './types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { CreateLedgerEntryRequest } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/ledger-entry.model');
+
+describe('IssuerQuotaGuard', () => {
+  let ledgerRows: any[];
+
+  const issue = (idempotencyKey: string, amount = 100, committedBy = 'operator-alice'): CreateLedgerEntryRequest => ({
+    accountId: 'user-123',
+    accountType: 'user',
+    amount,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.ADMIN_CREDIT,
+    idempotencyKey,
+    requestId: `req-${idempotencyKey}`,
+    balanceBefore: 0,
+    balanceAfter: amount,
+    metadata: { committedBy },
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    jest.spyOn(MetricsLogger, 'logAlert').mockImplementation(() => undefined);
+    ledgerRows = [];
+
+    (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) => ({
+      sort: jest.fn().mockReturnThis(),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () =>
+        ledgerRows.filter(
+          row =>
+            row.metadata.committedBy === query['metadata.committedBy'].$eq &&
+            row.timestamp >= query.timestamp.$gte
+        )
+      ),
+    }));
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('rejects issuance past the transaction quota', async () => {
+    const guard = new IssuerQuotaGuard({ operatorQuota: { maxPoints: 10_000, maxTransactions: 2 } });
+
+    await guard.beforeAppend(issue('k1'));
+    await guard.beforeAppend(issue('k2'));
+
+    const error = await guard.beforeAppend(issue('k3')).catch(e => e);
+    expect(error).toBeInstanceOf(IssuerQuotaExceededError);
+    expect(error.code).toBe('ISSUER_QUOTA_EXCEEDED');
+    expect(error.details).toEqual({ principal: 'operator-alice', limit: 'transactions', max: 2, observed: 3 });
+  });
+
+  it('rejects issuance past the points quota', async () => {
+    const guard = new IssuerQuotaGuard({ operatorQuota: { maxPoints: 250, maxTransactions: 100 } });
+
+    await guard.beforeAppend(issue('k1', 200));
+
+    await expect(guard.beforeAppend(issue('k2', 100))).rejects.toMatchObject({
+      details: { limit: 'points', max: 250, observed: 300 },
+    });
+    await expect(guard.beforeAppend(issue('k3', 50))).resolves.toBeUndefined();
+  });
+
+  it('does not count replays of the same idempotency key', async () => {
+    const guard = new IssuerQuotaGuard({ operatorQuota: { maxPoints: 10_000, maxTransactions: 1 } });
+
+    await guard.beforeAppend(issue('k1'));
+    await expect(guard.beforeAppend(issue('k1'))).resolves.toBeUndefined();
+  });
+
+  it('ignores debits', async () => {
+    const guard = new IssuerQuotaGuard({ operatorQuota: { maxPoints: 10_000, maxTransactions: 1 } });
+
+    await guard.beforeAppend({ ...issue('k1'), type: TransactionType.DEBIT });
+    await guard.beforeAppend({ ...issue('k2'), type: TransactionType.DEBIT, metadata: {} });
+    await guard.beforeAppend(issue('k3'));
+
+    expect((await guard.usage('operator-alice')).transactions).toBe(1);
+  });
+
+  it('rejects unattributed issuance', async () => {
+    const guard = new IssuerQuotaGuard();
+
+    await expect(guard.beforeAppend({ ...issue('k1'), metadata: {} })).rejects.toThrow(UnauthorizedCommitterError);
+  });
+
+  it('counts issuance against the authenticated principal only', async () => {
+    let caller: string | undefined = 'operator-alice';
+    const guard = new IssuerQuotaGuard({
+      operatorQuota: { maxPoints: 10_000, maxTransactions: 1 },
+      authenticatedPrincipal: () => caller,
+    });
+
+    await guard.beforeAppend(issue('k1'));
+    await expect(guard.beforeAppend(issue('k2', 100, 'operator-bob'))).rejects.toThrow(UnauthorizedCommitterError);
+
+    caller = undefined;
+    await expect(guard.beforeAppend(issue('k3'))).rejects.toThrow(UnauthorizedCommitterError);
+    expect((await guard.usage('operator-alice')).transactions).toBe(1);
+    expect(LedgerEntryModel.find).toHaveBeenCalledTimes(1);
+  });
+
+  it('gives system principals their own quota', async () => {
+    const guard = new IssuerQuotaGuard({
+      operatorQuota: { maxPoints: 100, maxTransactions: 1 },
+      systemQuota: { maxPoints: 10_000, maxTransactions: 10 },
+      principalQuotas: { 'operator-bob': { maxTransactions: 3 } },
+    });
+
+    expect(guard.quotaFor('system:nightly-bonus')).toEqual({ maxPoints: 10_000, maxTransactions: 10 });
+    expect(guard.quotaFor('operator-alice')).toEqual({ maxPoints: 100, maxTransactions: 1 });
+    expect(guard.quotaFor('operator-bob')).toEqual({ maxPoints: 100, maxTransactions: 3 });
+
+    await guard.beforeAppend(issue('k1', 100, 'system:nightly-bonus'));
+    await expect(guard.beforeAppend(issue('k2', 100, 'system:nightly-bonus'))).resolves.toBeUndefined();
+  });
+
+  it('seeds the window from the ledger after a restart', async () => {
+    const now = Date.now();
+    ledgerRows = [
+      { amount: 300, idempotencyKey: 'old', timestamp: new Date(now - 2 * 60 * 60 * 1000), metadata: { committedBy: 'operator-alice' } },
+      { amount: 400, idempotencyKey: 'k1', timestamp: new Date(now - 60 * 1000), metadata: { committedBy: 'operator-alice' } },
+    ];
+    const guard = new IssuerQuotaGuard({ operatorQuota: { maxPoints: 500, maxTransactions: 100 } });
+
+    expect(await guard.usage('operator-alice')).toMatchObject({ points: 400, transactions: 1 });
+    await expect(guard.beforeAppend(issue('k2', 200))).rejects.toBeInstanceOf(IssuerQuotaExceededError);
+    await expect(guard.beforeAppend(issue('k1', 400))).resolves.toBeUndefined();
+  });
+
+  it('lets only one concurrent issuance take the last slot', async () => {
+    const guard = new IssuerQuotaGuard({ operatorQuota: { maxPoints: 10_000, maxTransactions: 1 } });
+
+    const results = await Promise.allSettled([guard.beforeAppend(issue('k1')), guard.beforeAppend(issue('k2'))]);
+
+    expect(results.filter(r => r.status === 'fulfilled')).toHaveLength(1);
+    expect(LedgerEntryModel.find).toHaveBeenCalledTimes(1);
+  });
+
+  it('picks up issuance by other instances on resync', async () => {
+    jest.useFakeTimers();
+    try {
+      const guard = new IssuerQuotaGuard({
+        operatorQuota: { maxPoints: 10_000, maxTransactions: 2 },
+        resyncIntervalMs: 1000,
+      });
+      await guard.beforeAppend(issue('k1'));
+
+      ledgerRows = [
+        { amount: 100, idempotencyKey: 'elsewhere', timestamp: new Date(), metadata: { committedBy: 'operator-alice' } },
+      ];
+      jest.advanceTimersByTime(1001);
+
+      // k1 has not reached the ledger yet, so it is carried over
+      const error = await guard.beforeAppend(issue('k2')).catch(e => e);
+      expect(error).toBeInstanceOf(IssuerQuotaExceededError);
+      expect(error.details.observed).toBe(3);
+    } finally {
+      jest.useRealTimers();
+    }
+  });
+
+  it('fires the soft-threshold alert once per crossing', async () => {
+    const alerts: IssuerQuotaAlert[] = [];
+    const guard = new IssuerQuotaGuard({
+      operatorQuota: { maxPoints: 1000, maxTransactions: 100 },
+      softThreshold: 0.8,
+      onSoftThreshold: alert => alerts.push(alert),
+    });
+
+    await guard.beforeAppend(issue('k1', 700));
+    expect(alerts).toHaveLength(0);
+
+    await guard.beforeAppend(issue('k2', 100));
+    await guard.beforeAppend(issue('k3', 100));
+
+    expect(alerts).toHaveLength(1);
+    expect(alerts[0]).toMatchObject({ principal: 'operator-alice', limit: 'points', points: 800, ratio: 0.8 });
+  });
+
+  it('does not fail the append when the alert callback throws', async () => {
+    const guard = new IssuerQuotaGuard({
+      operatorQuota: { maxPoints: 100, maxTransactions: 100 },
+      onSoftThreshold: () => {
+        throw new Error('pager down');
+      },
+    });
+
+    await expect(guard.beforeAppend(issue('k1', 90))).resolves.toBeUndefined();
+    expect(MetricsLogger.logAlert).toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,422 @@
+/**
+ * Issuer Quota Guard
+ *
+ * Caps how many points, and how many issuing transactions, each principal
+ * (the committedBy recorded on an entry) may issue per rolling window, so
+ * a compromised service account with earn permission cannot mint without
+ * limit. Issuance is any credit to a user's available balance. An
+ * issuance with no committedBy is rejected rather than let through
+ * uncounted.
+ *
+ * committedBy is caller-supplied. When authenticatedPrincipal is given it
+ * is the source of truth: it is called during the append (typically
+ * reading an AsyncLocalStorage the auth middleware fills from the verified
+ * token), and an issuance whose committedBy names anyone else, or made
+ * with no authenticated caller, is rejected. The ledger's committedBy then
+ * always matches the principal, so the windows read back from it are
+ * attributed correctly.
+ *
+ * Quotas are resolved per principal: an exact entry in principalQuotas
+ * wins, then systemQuota for principals with a system prefix (scheduled
+ * jobs and integrations), then operatorQuota for everyone else. A breach
+ * is rejected with IssuerQuotaExceededError. When an accepted issuance
+ * takes a principal past softThreshold of either quota, onSoftThreshold
+ * is called once until usage falls back below it.
+ *
+ * Window state is derived from the ledger: the first time a principal is
+ * seen, and again every resyncIntervalMs, its issuance in the window is
+ * read back from ledger entries, so quotas hold across restarts and pick
+ * up issuance by other instances. Between reads the in-memory window is
+ * authoritative for this process; check and reservation happen without
+ * yielding, so concurrent appends cannot both take the last slot. An
+ * append that fails after its reservation keeps the slot until the next
+ * resync.
+ *
+ * @module services/issuer-quota-guard
+ */
+
+import { LedgerAppendHook, CreateLedgerEntryRequest } from '../ledger/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType } from '../wallets/types';
+import { IssuerQuotaExceededError, UnauthorizedCommitterError } from './types';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+
+/**
+ * Issuance allowed per principal per window
+ */
+export interface IssuerQuota {
+  /** Maximum total points issued */
+  maxPoints: number;
+
+  /** Maximum issuing transactions */
+  maxTransactions: number;
+}
+
+/**
+ * A principal's issuance within the current window
+ */
+export interface IssuerUsage {
+  principal: string;
+  points: number;
+  transactions: number;
+  quota: IssuerQuota;
+}
+
+/**
+ * Raised when a principal crosses the soft threshold
+ */
+export interface IssuerQuotaAlert extends IssuerUsage {
+  /** Quota crossed first */
+  limit: 'points' | 'transactions';
+
+  /** Fraction of the quota used (0-1) */
+  ratio: number;
+
+  raisedAt: Date;
+}
+
+/**
+ * Configuration for the issuer quota guard
+ */
+export interface IssuerQuotaGuardConfig {
+  /** Rolling window length in milliseconds */
+  windowMs: number;
+
+  /** Quota for human operator accounts */
+  operatorQuota: IssuerQuota;
+
+  /** Quota for system principals (jobs, integrations) */
+  systemQuota: IssuerQuota;
+
+  /** committedBy prefixes identifying system principals */
+  systemPrincipalPrefixes: string[];
+
+  /** Quotas for specific principals, overriding the above */
+  principalQuotas: Record<string, Partial<IssuerQuota>>;
+
+  /** Fraction of either quota at which onSoftThreshold fires */
+  softThreshold: number;
+
+  /** Called when a principal crosses softThreshold */
+  onSoftThreshold?: (alert: IssuerQuotaAlert) => void;
+
+  /** How often a principal's window is re-read from the ledger */
+  resyncIntervalMs: number;
+
+  /** Authenticated caller of the current append (committedBy is trusted when unset) */
+  authenticatedPrincipal?: () => string | undefined;
+}
+
+const DEFAULT_CONFIG: IssuerQuotaGuardConfig = {
+  windowMs: 60 * 60 * 1000,
+  operatorQuota: { maxPoints: 50_000, maxTransactions: 100 },
+  systemQuota: { maxPoints: 5_000_000, maxTransactions: 50_000 },
+  systemPrincipalPrefixes: ['system:', 'job:'],
+  principalQuotas: {},
+  softThreshold: 0.8,
+  resyncIntervalMs: 60 * 1000,
+};
+
+/**
+ * One counted issuance
+ */
+interface IssuanceEvent {
+  at: number;
+  amount: number;
+  idempotencyKey: string;
+}
+
+/**
+ * In-memory window for one principal
+ */
+interface PrincipalWindow {
+  /** Counted issuance, oldest first */
+  events: IssuanceEvent[];
+  keys: Set<string>;
+  points: number;
+  syncedAt: number;
+  alerted: boolean;
+}
+
+/**
+ * Issuer Quota Guard Implementation
+ */
+export class IssuerQuotaGuard implements LedgerAppendHook {
+  readonly name = 'issuer-quota';
+
+  private config: IssuerQuotaGuardConfig;
+  private windows = new Map<string, PrincipalWindow>();
+  private loading = new Map<string, Promise<PrincipalWindow>>();
+
+  constructor(config: Partial<IssuerQuotaGuardConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+
+    if (!(this.config.softThreshold > 0 && this.config.softThreshold <= 1)) {
+      throw new Error('softThreshold must be in (0, 1]');
+    }
+  }
+
+  /**
+   * Count the issuance against its principal before it is written
+   *
+   * @throws UnauthorizedCommitterError if the issuance is not attributed
+   *         to its authenticated principal
+   * @throws IssuerQuotaExceededError if the issuance would exceed a quota
+   */
+  async beforeAppend(request: CreateLedgerEntryRequest): Promise<void> {
+    if (!this.isIssuance(request)) {
+      return;
+    }
+    const principal = this.principalOf(request);
+
+    const window = await this.windowFor(principal);
+    const now = Date.now();
+    this.prune(window, now);
+
+    // Replays of a counted issuance are left to ledger idempotency
+    if (window.keys.has(request.idempotencyKey)) {
+      return;
+    }
+
+    const quota = this.quotaFor(principal);
+    if (window.events.length + 1 > quota.maxTransactions) {
+      this.reject(request, principal, quota, 'transactions', window.events.length + 1);
+    }
+    if (window.points + request.amount > quota.maxPoints) {
+      this.reject(request, principal, quota, 'points', window.points + request.amount);
+    }
+
+    window.events.push({ at: now, amount: request.amount, idempotencyKey: request.idempotencyKey });
+    window.keys.add(request.idempotencyKey);
+    window.points += request.amount;
+
+    this.checkSoftThreshold(principal, window, quota);
+  }
+
+  /**
+   * A principal's issuance in the current window
+   */
+  async usage(principal: string): Promise<IssuerUsage> {
+    const window = await this.windowFor(principal);
+    this.prune(window, Date.now());
+
+    return {
+      principal,
+      points: window.points,
+      transactions: window.events.length,
+      quota: this.quotaFor(principal),
+    };
+  }
+
+  /**
+   * Resolve a principal's quota
+   */
+  quotaFor(principal: string): IssuerQuota {
+    const base = this.config.systemPrincipalPrefixes.some(prefix => principal.startsWith(prefix))
+      ? this.config.systemQuota
+      : this.config.operatorQuota;
+
+    return { ...base, ...this.config.principalQuotas[principal] };
+  }
+
+  /**
+   * Return a principal's window, reading it from the ledger when unseen
+   * or due for resync
+   */
+  private async windowFor(principal: string): Promise<PrincipalWindow> {
+    const current = this.windows.get(principal);
+    if (current && Date.now() - current.syncedAt < this.config.resyncIntervalMs) {
+      return current;
+    }
+
+    // Concurrent appends for the same principal share one ledger read
+    let pending = this.loading.get(principal);
+    if (!pending) {
+      pending = this.loadWindow(principal).finally(() => this.loading.delete(principal));
+      this.loading.set(principal, pending);
+    }
+
+    return pending;
+  }
+
+  /**
+   * Rebuild a principal's window from the ledger
+   * Reservations made since the previous read that the ledger does not
+   * show yet are carried over, so in-flight appends stay counted.
+   */
+  private async loadWindow(principal: string): Promise<PrincipalWindow> {
+    const startedAt = Date.now();
+    const rows = await LedgerEntryModel.find(
+      {
+        'metadata.committedBy': { $eq: principal },
+        accountType: { $eq: 'user' },
+        type: { $eq: TransactionType.CREDIT },
+        balanceState: { $eq: 'available' },
+        timestamp: { $gte: new Date(startedAt - this.config.windowMs) },
+      },
+      { amount: 1, idempotencyKey: 1, timestamp: 1 }
+    )
+      .sort({ timestamp: 1 })
+      .lean()
+      .exec();
+
+    const events: IssuanceEvent[] = rows.map((row: any) => ({
+      at: new Date(row.timestamp).getTime(),
+      amount: row.amount,
+      idempotencyKey: row.idempotencyKey,
+    }));
+
+    const previous = this.windows.get(principal);
+    if (previous) {
+      const recorded = new Set(events.map(event => event.idempotencyKey));
+      for (const event of previous.events) {
+        if (event.at >= previous.syncedAt && !recorded.has(event.idempotencyKey)) {
+          events.push(event);
+        }
+      }
+      events.sort((a, b) => a.at - b.at);
+    }
+
+    const window: PrincipalWindow = {
+      events,
+      keys: new Set(events.map(event => event.idempotencyKey)),
+      points: events.reduce((sum, event) => sum + event.amount, 0),
+      syncedAt: startedAt,
+      alerted: previous ? previous.alerted : false,
+    };
+
+    this.windows.set(principal, window);
+    return window;
+  }
+
+  /**
+   * Drop issuance that has left the window
+   */
+  private prune(window: PrincipalWindow, now: number): void {
+    const cutoff = now - this.config.windowMs;
+    while (window.events.length > 0 && window.events[0].at < cutoff) {
+      const expired = window.events.shift()!;
+      window.keys.delete(expired.idempotencyKey);
+      window.points -= expired.amount;
+    }
+  }
+
+  /**
+   * Fire the soft-threshold alert on the issuance that crosses it
+   */
+  private checkSoftThreshold(principal: string, window: PrincipalWindow, quota: IssuerQuota): void {
+    const pointsRatio = window.points / quota.maxPoints;
+    const transactionsRatio = window.events.length / quota.maxTransactions;
+    const ratio = Math.max(pointsRatio, transactionsRatio);
+
+    if (ratio < this.config.softThreshold) {
+      window.alerted = false;
+      return;
+    }
+
+    if (window.alerted) {
+      return;
+    }
+    window.alerted = true;
+
+    const alert: IssuerQuotaAlert = {
+      principal,
+      points: window.points,
+      transactions: window.events.length,
+      quota,
+      limit: pointsRatio >= transactionsRatio ? 'points' : 'transactions',
+      ratio,
+      raisedAt: new Date(),
+    };
+
+    MetricsLogger.incrementCounter(MetricEventType.ISSUER_QUOTA_SOFT_THRESHOLD, {
+      principal,
+      limit: alert.limit,
+    });
+    MetricsLogger.logAlert({
+      severity: AlertSeverity.WARNING,
+      message: `Issuer ${principal} has used ${Math.round(ratio * 100)}% of its ${alert.limit} quota`,
+      metricType: MetricEventType.ISSUER_QUOTA_SOFT_THRESHOLD,
+      timestamp: alert.raisedAt,
+      metadata: { principal, points: alert.points, transactions: alert.transactions },
+    });
+
+    // Monitoring callbacks never fail the append
+    try {
+      this.config.onSoftThreshold?.(alert);
+    } catch {
+      // The alert has already been logged
+    }
+  }
+
+  /**
+   * Record and raise a quota breach
+   */
+  private reject(
+    request: CreateLedgerEntryRequest,
+    principal: string,
+    quota: IssuerQuota,
+    limit: 'points' | 'transactions',
+    observed: number
+  ): never {
+    const max = limit === 'points' ? quota.maxPoints : quota.maxTransactions;
+
+    MetricsLogger.incrementCounter(MetricEventType.ISSUER_QUOTA_EXCEEDED, {
+      principal,
+      limit,
+      requestId: request.requestId,
+    });
+    MetricsLogger.logAlert({
+      severity: AlertSeverity.ERROR,
+      message: `Issuance rejected: ${principal} exceeded its ${limit} quota`,
+      metricType: MetricEventType.ISSUER_QUOTA_EXCEEDED,
+      timestamp: new Date(),
+      metadata: {
+        principal,
+        userId: request.accountId,
+        idempotencyKey: request.idempotencyKey,
+        max,
+        observed,
+      },
+    });
+
+    throw new IssuerQuotaExceededError(principal, limit, max, observed);
+  }
+
+  /**
+   * The principal an issuance counts against
+   *
+   * @throws UnauthorizedCommitterError if there is none, or committedBy
+   *         is not the authenticated principal
+   */
+  private principalOf(request: CreateLedgerEntryRequest): string {
+    const committedBy = request.metadata?.committedBy;
+    const principal = this.config.authenticatedPrincipal
+      ? this.config.authenticatedPrincipal()
+      : committedBy;
+
+    if (typeof principal !== 'string' || !principal || committedBy !== principal) {
+      throw new UnauthorizedCommitterError(typeof committedBy === 'string' ? committedBy : undefined);
+    }
+
+    return principal;
+  }
+
+  /**
+   * Whether a request issues points
+   */
+  private isIssuance(request: CreateLedgerEntryRequest): boolean {
+    return (
+      request.accountType === 'user' &&
+      request.type === TransactionType.CREDIT &&
+      request.balanceState === 'available'
+    );
+  }
+}
+
+/**
+ * Factory function to create an issuer quota guard
+ */
+export function createIssuerQuotaGuard(config?: Partial<IssuerQuotaGuardConfig>): IssuerQuotaGuard {
+  return new IssuerQuotaGuard(config);
+}
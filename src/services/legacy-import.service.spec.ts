@@ -0,0 +1,209 @@
+/**
+ * Legacy Import Service Tests
+ */
+
+import { Readable } from 'stream';
+import { LegacyImportService, LegacyMappingSpec, parseLegacyTimestamp } from './legacy-import.service';
+import { WalletModel } from '../db/models/wallet.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/wallet.model');
+
+describe('LegacyImportService', () => {
+  let service: LegacyImportService;
+  let mockLedgerService: { createEntryWithResult: jest.Mock };
+  let entries: any[];
+  let wallets: Map<string, any>;
+
+  const spec: LegacyMappingSpec = {
+    source: 'brand-a',
+    columns: { legacyId: 'TxnNo', userId: 'Member', amount: 'Pts', type: 'Kind', timestamp: 'When' },
+    timestampLayout: 'DD/MM/YYYY HH:mm',
+    sourceTimeZone: 'America/New_York',
+    typeRules: {
+      EARN: { type: TransactionType.CREDIT, reason: TransactionReason.PROMOTIONAL_AWARD, legacySign: 'positive' },
+      REDEEM: { type: TransactionType.DEBIT, reason: TransactionReason.CHIP_MENU_PURCHASE, legacySign: 'positive' },
+    },
+    userIdPrefix: 'brand-a:',
+  };
+
+  const csv = (...lines: string[]) => Readable.from([['TxnNo,Member,Kind,Pts,When', ...lines].join('\n')]);
+  const expected = (...lines: string[]) => Readable.from([['userId,balance', ...lines].join('\n')]);
+
+  const legacyFile = () =>
+    csv(
+      'T2,42,REDEEM,30,02/03/2023 10:00',
+      'T1,42,EARN,100,01/03/2023 09:00',
+      'T3,7,EARN,50,01/03/2023 12:30'
+    );
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    entries = [];
+    wallets = new Map();
+
+    // Unique idempotency key index: the first insert wins, later calls replay it
+    mockLedgerService = {
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, ...request };
+        entries.push(entry);
+        return { entry, inserted: true };
+      }),
+    };
+
+    // Conditional upsert on version 0, as MongoDB would apply it
+    (WalletModel.findOneAndUpdate as jest.Mock).mockImplementation(async (filter: any, update: any) => {
+      const userId = filter.userId.$eq;
+      const wallet = wallets.get(userId);
+      if (wallet && wallet.version === filter.version.$eq) {
+        Object.assign(wallet, update.$set);
+        wallet.version += update.$inc.version;
+        return wallet;
+      }
+      if (wallet) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      const created = { userId, version: 1, ...update.$set, ...update.$setOnInsert };
+      wallets.set(userId, created);
+      return created;
+    });
+
+    service = new LegacyImportService(mockLedgerService as any);
+  });
+
+  it('should preview an import and reconcile it without writing', async () => {
+    const report = await service.importLegacy(legacyFile(), spec, {
+      dryRun: true,
+      expectedBalances: expected('42,70', '7,60', '99,10'),
+    });
+
+    expect(report).toMatchObject({ dryRun: true, rowsRead: 3, imported: 0, errors: [] });
+    expect(report.reconciliation).toEqual({
+      users: [
+        { userId: 'brand-a:42', importedBalance: 70, expectedBalance: 70, difference: 0, matched: true },
+        { userId: 'brand-a:7', importedBalance: 50, expectedBalance: 60, difference: -10, matched: false },
+      ],
+      matched: 1,
+      mismatched: 1,
+      missingUsers: ['brand-a:99'],
+    });
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+    expect(WalletModel.findOneAndUpdate).not.toHaveBeenCalled();
+  });
+
+  it('should import rows in legacy time order with mapped signs, IDs and timestamps', async () => {
+    const report = await service.importLegacy(legacyFile(), spec, { dryRun: false });
+
+    expect(report).toMatchObject({ imported: 3, skipped: 0, errors: [] });
+    expect(entries.map(e => e.idempotencyKey)).toEqual([
+      'legacy-brand-a-T1',
+      'legacy-brand-a-T3',
+      'legacy-brand-a-T2',
+    ]);
+    expect(entries[2]).toMatchObject({
+      transactionId: 'legacy-brand-a-T2',
+      accountId: 'brand-a:42',
+      amount: -30,
+      type: TransactionType.DEBIT,
+      reason: TransactionReason.CHIP_MENU_PURCHASE,
+      balanceBefore: 100,
+      balanceAfter: 70,
+      metadata: { legacySource: 'brand-a', legacyId: 'T2', legacyTimestamp: '2023-03-02T15:00:00.000Z' },
+    });
+    expect(wallets.get('brand-a:42')).toMatchObject({ availableBalance: 70, version: 1 });
+    expect(wallets.get('brand-a:7')).toMatchObject({ availableBalance: 50, version: 1 });
+  });
+
+  it('should be idempotent when re-run', async () => {
+    await service.importLegacy(legacyFile(), spec, { dryRun: false });
+
+    const rerun = await service.importLegacy(legacyFile(), spec, {
+      dryRun: false,
+      expectedBalances: expected('42,70', '7,50'),
+    });
+
+    expect(rerun).toMatchObject({ imported: 0, skipped: 3 });
+    expect(rerun.reconciliation).toMatchObject({ matched: 2, mismatched: 0 });
+    expect(entries).toHaveLength(3);
+    expect(wallets.get('brand-a:42')).toMatchObject({ availableBalance: 70, version: 1 });
+  });
+
+  it('should collect per-row errors and hold back the users they belong to', async () => {
+    const report = await service.importLegacy(
+      csv(
+        'T1,42,EARN,100,01/03/2023 09:00',
+        'T2,42,REDEEM,-30,02/03/2023 10:00',
+        'T3,7,BONUS,50,01/03/2023 12:30',
+        'T4,8,EARN,50,2023-03-01',
+        'T1,8,EARN,20,01/03/2023 09:00',
+        'T5,9,EARN,25,01/03/2023 11:00'
+      ),
+      spec,
+      { dryRun: false }
+    );
+
+    expect(report.errors).toEqual([
+      { row: 2, legacyId: 'T2', userId: 'brand-a:42', message: 'amount sign does not match the positive convention for REDEEM' },
+      { row: 3, legacyId: 'T3', userId: 'brand-a:7', message: 'unmapped legacy type: BONUS' },
+      { row: 4, legacyId: 'T4', userId: 'brand-a:8', message: 'timestamp does not match layout DD/MM/YYYY HH:mm: 2023-03-01' },
+      { row: 5, legacyId: 'T1', userId: 'brand-a:8', message: 'duplicate legacy ID: T1' },
+    ]);
+    expect(report).toMatchObject({ imported: 1, held: 1 });
+    expect(entries.map(e => e.accountId)).toEqual(['brand-a:9']);
+    expect(wallets.has('brand-a:42')).toBe(false);
+    expect(wallets.get('brand-a:9')).toMatchObject({ availableBalance: 25 });
+  });
+
+  it('should hold back a user after the ledger rejects one of their rows', async () => {
+    mockLedgerService.createEntryWithResult.mockRejectedValueOnce(new Error('storage unavailable'));
+
+    const report = await service.importLegacy(legacyFile(), spec, { dryRun: false });
+
+    expect(report.errors).toEqual([
+      { row: 2, legacyId: 'T1', userId: 'brand-a:42', message: 'storage unavailable' },
+    ]);
+    expect(report).toMatchObject({ imported: 1, held: 1 });
+    expect(wallets.has('brand-a:42')).toBe(false);
+
+    const rerun = await service.importLegacy(legacyFile(), spec, { dryRun: false });
+
+    expect(rerun).toMatchObject({ imported: 2, skipped: 1, errors: [] });
+    expect(entries.find(e => e.idempotencyKey === 'legacy-brand-a-T2')).toMatchObject({
+      balanceBefore: 100,
+      balanceAfter: 70,
+    });
+    expect(wallets.get('brand-a:42')).toMatchObject({ availableBalance: 70 });
+  });
+
+  it('should reject files missing a mapped column and invalid specs', async () => {
+    await expect(
+      service.importLegacy(Readable.from(['TxnNo,Member,Pts\n']), spec, { dryRun: true })
+    ).rejects.toThrow('missing column Kind (mapped to type)');
+    await expect(
+      service.importLegacy(legacyFile(), { ...spec, userIdPrefix: '' }, { dryRun: true })
+    ).rejects.toThrow('userIdPrefix is required');
+    await expect(
+      service.importLegacy(legacyFile(), { ...spec, sourceTimeZone: 'Mars/Olympus' }, { dryRun: true })
+    ).rejects.toThrow(RangeError);
+  });
+
+  describe('parseLegacyTimestamp', () => {
+    it('should convert local times to UTC across DST', () => {
+      expect(parseLegacyTimestamp('15/01/2023 09:00', 'DD/MM/YYYY HH:mm', 'Europe/Berlin')?.toISOString())
+        .toBe('2023-01-15T08:00:00.000Z');
+      expect(parseLegacyTimestamp('15/07/2023 09:00', 'DD/MM/YYYY HH:mm', 'Europe/Berlin')?.toISOString())
+        .toBe('2023-07-15T07:00:00.000Z');
+      expect(parseLegacyTimestamp('2023-07-15 09:00:00.250', 'YYYY-MM-DD HH:mm:ss.SSS', 'UTC')?.toISOString())
+        .toBe('2023-07-15T09:00:00.250Z');
+    });
+
+    it('should reject text that does not match or is out of range', () => {
+      expect(parseLegacyTimestamp('31/02/2023 09:00', 'DD/MM/YYYY HH:mm', 'UTC')).toBeNull();
+      expect(parseLegacyTimestamp('15/07/2023', 'DD/MM/YYYY HH:mm', 'UTC')).toBeNull();
+    });
+  });
+});
@@ -0,0 +1,610 @@
+/**
+ * Legacy Import Service
+ *
+ * Imports the historical ledgers of acquired rewards programs from CSV.
+ * A LegacyMappingSpec describes each source: which legacy column holds
+ * each field, the timestamp layout and the timezone it is local to, how
+ * each legacy transaction type maps to a credit or debit (and which sign
+ * the legacy system used for it), and the prefix given to legacy user
+ * IDs so they cannot collide with existing accounts.
+ *
+ * Every row becomes one ledger entry whose idempotency key and
+ * transaction ID are `legacy-<source>-<legacyId>`, so a re-run (after a
+ * crash or after fixing rejected rows) replays rows already imported and
+ * continues from their recorded balances. The legacy timestamp is kept in metadata as
+ * legacyTimestamp; entry timestamps remain the time of import.
+ *
+ * A user with any rejected row is held back entirely (and their wallet
+ * left alone) until a re-run with the row fixed, so each user's balance
+ * chain is written in legacy time order. A dry run validates and maps
+ * the file and produces the same report without writing. Both modes reconcile the per-user balance implied by
+ * the file against an optional expected-balances CSV (userId,balance).
+ * Wallets of imported users whose rows were all accepted are credited
+ * with a version-0 conditional upsert, as OpeningBalanceService does.
+ *
+ * @module services/legacy-import
+ */
+
+import { createInterface } from 'readline';
+import { Readable } from 'stream';
+import { LedgerService } from '../ledger/ledger.service';
+import { assertValidTimeZone, zonedTimeToUtc } from '../ledger/timezone';
+import { WalletModel } from '../db/models/wallet.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { parseCsvLine } from './bulk-adjustment.service';
+
+const TIMESTAMP_TOKENS: Record<string, string> = {
+  YYYY: '(\\d{4})',
+  MM: '(\\d{2})',
+  DD: '(\\d{2})',
+  HH: '(\\d{2})',
+  mm: '(\\d{2})',
+  ss: '(\\d{2})',
+  SSS: '(\\d{3})',
+};
+
+/**
+ * How one legacy transaction type maps onto the ledger
+ */
+export interface LegacyTypeRule {
+  type: TransactionType;
+  reason: TransactionReason;
+
+  /** Sign the legacy system recorded amounts of this type with */
+  legacySign: 'positive' | 'negative';
+}
+
+/**
+ * Mapping from one legacy export to ledger entries
+ */
+export interface LegacyMappingSpec {
+  /** Source name, part of every derived ID (e.g. "brand-a") */
+  source: string;
+
+  /** Legacy column holding each field */
+  columns: {
+    legacyId: string;
+    userId: string;
+    amount: string;
+    type: string;
+    timestamp: string;
+  };
+
+  /** Timestamp layout built from YYYY, MM, DD, HH, mm, ss and SSS (e.g. "DD/MM/YYYY HH:mm") */
+  timestampLayout: string;
+
+  /** IANA timezone the legacy timestamps are local to */
+  sourceTimeZone: string;
+
+  /** Rules keyed by legacy transaction type value */
+  typeRules: Record<string, LegacyTypeRule>;
+
+  /** Prefix applied to legacy user IDs (e.g. "brand-a:") */
+  userIdPrefix: string;
+}
+
+/**
+ * Options for a legacy import run
+ */
+export interface LegacyImportOptions {
+  /** Validate and report without writing */
+  dryRun: boolean;
+
+  /** Expected final balance per legacy user (CSV userId,balance) */
+  expectedBalances?: Readable;
+}
+
+/**
+ * A row that failed mapping or could not be imported
+ */
+export interface LegacyRowError {
+  /** 1-based data row number (the header is row 0) */
+  row: number;
+  legacyId?: string;
+
+  /** Prefixed user ID, when the row named one */
+  userId?: string;
+  message: string;
+}
+
+/**
+ * Imported balance for one user compared with the expected balance
+ */
+export interface LegacyBalanceCheck {
+  /** Prefixed user ID */
+  userId: string;
+  importedBalance: number;
+
+  /** Expected balance, or null if the user is missing from the expected file */
+  expectedBalance: number | null;
+  difference: number | null;
+  matched: boolean;
+}
+
+/**
+ * Report of a legacy import run
+ */
+export interface LegacyImportReport {
+  source: string;
+  dryRun: boolean;
+
+  /** Data rows read (excluding the header and blank lines) */
+  rowsRead: number;
+
+  /** Entries written by this run */
+  imported: number;
+
+  /** Rows already imported by an earlier run */
+  skipped: number;
+
+  /** Valid rows held back because another row for the same user was rejected */
+  held: number;
+
+  errors: LegacyRowError[];
+
+  reconciliation: {
+    users: LegacyBalanceCheck[];
+    matched: number;
+    mismatched: number;
+
+    /** Users in the expected file with no imported rows */
+    missingUsers: string[];
+  };
+}
+
+/**
+ * A mapped legacy row ready to import
+ */
+interface LegacyRow {
+  row: number;
+  legacyId: string;
+  userId: string;
+  amount: number;
+  rule: LegacyTypeRule;
+  legacyTimestamp: Date;
+}
+
+/**
+ * Configuration for the legacy import service
+ */
+export interface LegacyImportConfig {
+  /** Currency stamped on imported entries and wallets */
+  defaultCurrency: string;
+
+  /** Maximum data rows per file */
+  maxRows: number;
+}
+
+const DEFAULT_CONFIG: LegacyImportConfig = {
+  defaultCurrency: 'points',
+  maxRows: 1000000,
+};
+
+/**
+ * Legacy Import Service Implementation
+ */
+export class LegacyImportService {
+  private config: LegacyImportConfig;
+  private ledgerService: Pick<LedgerService, 'createEntryWithResult'>;
+
+  constructor(
+    ledgerService: Pick<LedgerService, 'createEntryWithResult'>,
+    config: Partial<LegacyImportConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Import (or dry-run) a legacy ledger export
+   *
+   * @param input Legacy CSV with a header row naming its columns
+   * @throws Error if the spec is invalid or the file lacks a mapped column
+   */
+  async importLegacy(
+    input: Readable,
+    spec: LegacyMappingSpec,
+    options: LegacyImportOptions
+  ): Promise<LegacyImportReport> {
+    this.validateSpec(spec);
+
+    const { rows, errors, rowsRead } = await this.parse(input, spec);
+    const report: LegacyImportReport = {
+      source: spec.source,
+      dryRun: options.dryRun,
+      rowsRead,
+      imported: 0,
+      skipped: 0,
+      held: 0,
+      errors,
+      reconciliation: { users: [], matched: 0, mismatched: 0, missingUsers: [] },
+    };
+
+    // Legacy files are not reliably ordered; balances run in legacy time order
+    rows.sort((a, b) => a.legacyTimestamp.getTime() - b.legacyTimestamp.getTime() || a.row - b.row);
+
+    // A user's rows are imported all together or not at all, so a fixed
+    // re-run never has to insert a row before entries already recorded
+    const rejectedUsers = new Set(errors.map(e => e.userId));
+    const balances = new Map<string, number>();
+
+    for (const row of rows) {
+      const balanceBefore = balances.get(row.userId) || 0;
+
+      if (rejectedUsers.has(row.userId)) {
+        report.held++;
+        continue;
+      }
+
+      if (options.dryRun) {
+        balances.set(row.userId, balanceBefore + row.amount);
+        continue;
+      }
+
+      try {
+        const { entry, inserted } = await this.ledgerService.createEntryWithResult(
+          this.toRequest(row, spec, balanceBefore)
+        );
+        balances.set(row.userId, entry.balanceAfter);
+        if (inserted) {
+          report.imported++;
+        } else {
+          report.skipped++;
+        }
+      } catch (error: any) {
+        rejectedUsers.add(row.userId);
+        errors.push({ row: row.row, legacyId: row.legacyId, userId: row.userId, message: error.message });
+      }
+    }
+
+    // Users with a rejected row keep an untouched wallet until a clean re-run
+    if (!options.dryRun) {
+      for (const [userId, balance] of balances) {
+        if (!rejectedUsers.has(userId) && balance > 0) {
+          await this.applyToWallet(userId, balance);
+        }
+      }
+    }
+
+    errors.sort((a, b) => a.row - b.row);
+    report.reconciliation = await this.reconcile(balances, spec, options.expectedBalances);
+
+    return report;
+  }
+
+  /**
+   * Build the ledger request for a mapped row
+   */
+  private toRequest(row: LegacyRow, spec: LegacyMappingSpec, balanceBefore: number) {
+    const key = `legacy-${spec.source}-${row.legacyId}`;
+    const credit = row.rule.type === TransactionType.CREDIT;
+
+    return {
+      transactionId: key,
+      accountId: row.userId,
+      accountType: 'user' as const,
+      amount: row.amount,
+      type: row.rule.type,
+      balanceState: 'available' as const,
+      stateTransition: credit ? 'none→available' : 'available→none',
+      reason: row.rule.reason,
+      idempotencyKey: key,
+      requestId: key,
+      balanceBefore,
+      balanceAfter: balanceBefore + row.amount,
+      currency: this.config.defaultCurrency,
+      correlationId: `legacy-import-${spec.source}`,
+      metadata: {
+        legacySource: spec.source,
+        legacyId: row.legacyId,
+        legacyTimestamp: row.legacyTimestamp.toISOString(),
+      },
+    };
+  }
+
+  /**
+   * Parse the legacy CSV, mapping each row through the spec
+   */
+  private async parse(
+    input: Readable,
+    spec: LegacyMappingSpec
+  ): Promise<{ rows: LegacyRow[]; errors: LegacyRowError[]; rowsRead: number }> {
+    const rows: LegacyRow[] = [];
+    const errors: LegacyRowError[] = [];
+    const seenIds = new Set<string>();
+    let columnIndex: Record<keyof LegacyMappingSpec['columns'], number> | null = null;
+    let rowsRead = 0;
+
+    for await (const line of createInterface({ input, crlfDelay: Infinity })) {
+      if (line.trim() === '') {
+        continue;
+      }
+
+      const cells = parseCsvLine(line).map(cell => cell.trim());
+
+      if (!columnIndex) {
+        columnIndex = this.resolveColumns(cells, spec);
+        continue;
+      }
+
+      rowsRead++;
+      if (rowsRead > this.config.maxRows) {
+        throw new Error(`Legacy import exceeds maximum of ${this.config.maxRows} rows`);
+      }
+
+      const legacyId = cells[columnIndex.legacyId] || undefined;
+      const legacyUserId = cells[columnIndex.userId];
+      const userId = legacyUserId ? `${spec.userIdPrefix}${legacyUserId}` : undefined;
+      const mapped = this.mapRow(cells, columnIndex, spec, rowsRead);
+
+      if (typeof mapped === 'string') {
+        errors.push({ row: rowsRead, legacyId, userId, message: mapped });
+      } else if (seenIds.has(mapped.legacyId)) {
+        errors.push({ row: rowsRead, legacyId, userId, message: `duplicate legacy ID: ${legacyId}` });
+      } else {
+        seenIds.add(mapped.legacyId);
+        rows.push(mapped);
+      }
+    }
+
+    if (!columnIndex) {
+      throw new Error('Legacy import CSV is empty');
+    }
+
+    return { rows, errors, rowsRead };
+  }
+
+  /**
+   * Locate each mapped column in the header
+   */
+  private resolveColumns(
+    header: string[],
+    spec: LegacyMappingSpec
+  ): Record<keyof LegacyMappingSpec['columns'], number> {
+    const index = {} as Record<keyof LegacyMappingSpec['columns'], number>;
+
+    for (const [field, column] of Object.entries(spec.columns) as [keyof LegacyMappingSpec['columns'], string][]) {
+      const position = header.indexOf(column);
+      if (position === -1) {
+        throw new Error(`Legacy import CSV is missing column ${column} (mapped to ${field})`);
+      }
+      index[field] = position;
+    }
+
+    return index;
+  }
+
+  /**
+   * Map one row's cells to a legacy row
+   *
+   * @returns The mapped row, or an error message
+   */
+  private mapRow(
+    cells: string[],
+    index: Record<keyof LegacyMappingSpec['columns'], number>,
+    spec: LegacyMappingSpec,
+    row: number
+  ): LegacyRow | string {
+    const legacyId = cells[index.legacyId];
+    const legacyUserId = cells[index.userId];
+    const amountText = cells[index.amount];
+    const typeValue = cells[index.type];
+    const timestampText = cells[index.timestamp];
+
+    if (!legacyId) {
+      return 'legacy ID is required';
+    }
+
+    if (!legacyUserId) {
+      return 'userId is required';
+    }
+
+    const rule = typeValue === undefined ? undefined : spec.typeRules[typeValue];
+    if (!rule) {
+      return `unmapped legacy type: ${typeValue}`;
+    }
+
+    if (amountText === undefined || !/^-?\d+$/.test(amountText)) {
+      return `amount must be a whole number: ${amountText}`;
+    }
+
+    const legacyAmount = Number(amountText);
+    if (!Number.isSafeInteger(legacyAmount) || legacyAmount === 0) {
+      return 'amount must be a non-zero safe integer';
+    }
+
+    if ((legacyAmount > 0) !== (rule.legacySign === 'positive')) {
+      return `amount sign does not match the ${rule.legacySign} convention for ${typeValue}`;
+    }
+
+    const legacyTimestamp = parseLegacyTimestamp(timestampText || '', spec.timestampLayout, spec.sourceTimeZone);
+    if (!legacyTimestamp) {
+      return `timestamp does not match layout ${spec.timestampLayout}: ${timestampText}`;
+    }
+
+    const magnitude = Math.abs(legacyAmount);
+
+    return {
+      row,
+      legacyId,
+      userId: `${spec.userIdPrefix}${legacyUserId}`,
+      amount: rule.type === TransactionType.CREDIT ? magnitude : -magnitude,
+      rule,
+      legacyTimestamp,
+    };
+  }
+
+  /**
+   * Compare imported balances against the expected-balances file
+   */
+  private async reconcile(
+    balances: Map<string, number>,
+    spec: LegacyMappingSpec,
+    expectedInput: Readable | undefined
+  ): Promise<LegacyImportReport['reconciliation']> {
+    const expected = expectedInput ? await this.parseExpected(expectedInput, spec) : new Map<string, number>();
+    const users: LegacyBalanceCheck[] = [...balances.entries()]
+      .sort(([a], [b]) => a.localeCompare(b))
+      .map(([userId, importedBalance]) => {
+        const expectedBalance = expected.has(userId) ? expected.get(userId)! : null;
+        const difference = expectedBalance === null ? null : importedBalance - expectedBalance;
+        return { userId, importedBalance, expectedBalance, difference, matched: difference === 0 };
+      });
+
+    return {
+      users,
+      matched: users.filter(u => u.matched).length,
+      mismatched: users.filter(u => !u.matched).length,
+      missingUsers: [...expected.keys()].filter(userId => !balances.has(userId)).sort(),
+    };
+  }
+
+  /**
+   * Parse the expected-balances CSV, keyed by prefixed user ID
+   */
+  private async parseExpected(input: Readable, spec: LegacyMappingSpec): Promise<Map<string, number>> {
+    const expected = new Map<string, number>();
+    let header = true;
+
+    for await (const line of createInterface({ input, crlfDelay: Infinity })) {
+      if (line.trim() === '') {
+        continue;
+      }
+
+      const [userId, balanceText] = parseCsvLine(line).map(cell => cell.trim());
+
+      if (header) {
+        if (userId !== 'userId' || balanceText !== 'balance') {
+          throw new Error('Expected balances CSV header must be: userId,balance');
+        }
+        header = false;
+        continue;
+      }
+
+      if (!userId || !/^-?\d+$/.test(balanceText || '')) {
+        throw new Error(`Invalid expected balance row: ${line}`);
+      }
+      expected.set(`${spec.userIdPrefix}${userId}`, Number(balanceText));
+    }
+
+    return expected;
+  }
+
+  /**
+   * Credit an unused wallet (version 0), creating it if missing
+   * A wallet past version 0 was credited by an earlier run or is in use,
+   * so the duplicate-key upsert is ignored.
+   */
+  private async applyToWallet(userId: string, balance: number): Promise<void> {
+    try {
+      await WalletModel.findOneAndUpdate(
+        { userId: { $eq: userId }, version: { $eq: 0 } },
+        {
+          $set: { availableBalance: balance },
+          $setOnInsert: { escrowBalance: 0, currency: this.config.defaultCurrency },
+          $inc: { version: 1 },
+        },
+        { upsert: true, new: true }
+      );
+    } catch (error: any) {
+      if (error.code !== 11000) {
+        throw error;
+      }
+    }
+  }
+
+  /**
+   * Reject specs that cannot map any row
+   */
+  private validateSpec(spec: LegacyMappingSpec): void {
+    if (!spec.source || !/^[a-z0-9-]+$/.test(spec.source)) {
+      throw new Error('source must be lowercase letters, digits and dashes');
+    }
+
+    if (!spec.userIdPrefix) {
+      throw new Error('userIdPrefix is required to keep legacy accounts apart');
+    }
+
+    if (Object.keys(spec.typeRules).length === 0) {
+      throw new Error('typeRules must map at least one legacy type');
+    }
+
+    if (!compileLayout(spec.timestampLayout)) {
+      throw new Error(`timestampLayout must contain YYYY, MM and DD: ${spec.timestampLayout}`);
+    }
+
+    assertValidTimeZone(spec.sourceTimeZone);
+  }
+}
+
+/**
+ * Compile a timestamp layout into a pattern and the token order
+ */
+function compileLayout(layout: string): { pattern: RegExp; tokens: string[] } | null {
+  const tokens: string[] = [];
+  const source = layout
+    .split(/(YYYY|SSS|MM|DD|HH|mm|ss)/)
+    .map(part => {
+      if (TIMESTAMP_TOKENS[part]) {
+        tokens.push(part);
+        return TIMESTAMP_TOKENS[part];
+      }
+      return part.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+    })
+    .join('');
+
+  if (!['YYYY', 'MM', 'DD'].every(token => tokens.includes(token))) {
+    return null;
+  }
+
+  return { pattern: new RegExp(`^${source}$`), tokens };
+}
+
+/**
+ * Parse a legacy local timestamp into a UTC instant
+ *
+ * @returns The instant, or null if the text does not match the layout
+ */
+export function parseLegacyTimestamp(text: string, layout: string, timeZone: string): Date | null {
+  const compiled = compileLayout(layout);
+  const match = compiled ? compiled.pattern.exec(text) : null;
+  if (!compiled || !match) {
+    return null;
+  }
+
+  const values: Record<string, number> = { HH: 0, mm: 0, ss: 0, SSS: 0 };
+  compiled.tokens.forEach((token, i) => {
+    values[token] = Number(match[i + 1]);
+  });
+
+  if (
+    values.MM < 1 || values.MM > 12 ||
+    values.DD < 1 || values.DD > new Date(Date.UTC(values.YYYY, values.MM, 0)).getUTCDate() ||
+    values.HH > 23 || values.mm > 59 || values.ss > 59
+  ) {
+    return null;
+  }
+
+  return zonedTimeToUtc(
+    {
+      year: values.YYYY,
+      month: values.MM,
+      day: values.DD,
+      hour: values.HH,
+      minute: values.mm,
+      second: values.ss,
+      millisecond: values.SSS,
+    },
+    timeZone
+  );
+}
+
+/**
+ * Factory function to create a legacy import service
+ */
+export function createLegacyImportService(
+  ledgerService: Pick<LedgerService, 'createEntryWithResult'>,
+  config?: Partial<LegacyImportConfig>
+): LegacyImportService {
+  return new LegacyImportService(ledgerService, config);
+}
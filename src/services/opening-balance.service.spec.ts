@@ -0,0 +1,140 @@
+/**
+ * Opening Balance Service Tests
+ */
+
+import { OpeningBalanceService } from './opening-balance.service';
+import { WalletModel } from '../db/models/wallet.model';
+import { applyWalletDelta } from '../wallets/wallet-application';
+
+jest.mock('../db/models/wallet.model');
+jest.mock('../wallets/wallet-application');
+
+describe('OpeningBalanceService', () => {
+  let service: OpeningBalanceService;
+  let mockLedgerService: { createEntryWithResult: jest.Mock; queryEntries: jest.Mock };
+  let entries: any[];
+  let wallets: Map<string, any>;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    entries = [];
+    wallets = new Map();
+
+    mockLedgerService = {
+      queryEntries: jest.fn().mockImplementation(async (filter: any) => {
+        // Entries are appended in timestamp order
+        const matching = entries.filter(e => e.accountId === filter.accountId);
+        return { entries: matching.slice(0, filter.limit), totalCount: matching.length, offset: 0, limit: filter.limit, hasMore: false };
+      }),
+      // Unique idempotency key index: the first insert wins, later calls replay it
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, ...request };
+        entries.push(entry);
+        return { entry, inserted: true };
+      }),
+    };
+
+    (WalletModel.findOne as jest.Mock).mockImplementation(async (query: any) => wallets.get(query.userId.$eq) || null);
+    // One application per key, as the wallet_applications unique index enforces
+    const applied = new Set<string>();
+    (applyWalletDelta as jest.Mock).mockImplementation(async (userId: string, delta: number, key: string) => {
+      if (applied.has(key)) {
+        return false;
+      }
+      applied.add(key);
+      const wallet = wallets.get(userId) || { userId, availableBalance: 0, version: 0 };
+      wallet.availableBalance += delta;
+      wallet.version += 1;
+      wallets.set(userId, wallet);
+      return true;
+    });
+
+    service = new OpeningBalanceService(mockLedgerService as any);
+  });
+
+  it('should create the opening balance for a user without activity', async () => {
+    const result = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    expect(result.created).toBe(true);
+    expect(result.entry).toMatchObject({
+      accountId: 'user-1',
+      amount: 5000,
+      reason: 'admin_credit',
+      idempotencyKey: 'opening-balance-user-1',
+      correlationId: 'migration-2024-06',
+      balanceBefore: 0,
+      balanceAfter: 5000,
+      metadata: { openingBalance: true, committedBy: 'migrator' },
+    });
+    expect(wallets.get('user-1')).toMatchObject({ availableBalance: 5000, version: 1 });
+  });
+
+  it('should be a no-op when the migration is re-run', async () => {
+    const first = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    const second = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    expect(second.created).toBe(false);
+    expect(second.entry?.entryId).toBe(first.entry?.entryId);
+    expect(entries).toHaveLength(1);
+    expect(wallets.get('user-1')).toMatchObject({ availableBalance: 5000, version: 1 });
+  });
+
+  it('should create exactly one opening balance under a concurrent race', async () => {
+    const results = await Promise.all([
+      service.setOpeningBalance('user-1', 5000, 'migration-a', 'worker-1'),
+      service.setOpeningBalance('user-1', 5000, 'migration-b', 'worker-2'),
+    ]);
+
+    expect(results.filter(r => r.created)).toHaveLength(1);
+    expect(entries).toHaveLength(1);
+    expect(wallets.get('user-1')?.availableBalance).toBe(5000);
+  });
+
+  it('should finish the wallet update when a previous run crashed after the ledger write', async () => {
+    entries.push({ entryId: 'entry-1', accountId: 'user-1', amount: 5000, idempotencyKey: 'opening-balance-user-1' });
+
+    const result = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    expect(result.created).toBe(false);
+    expect(wallets.get('user-1')).toMatchObject({ availableBalance: 5000, version: 1 });
+  });
+
+  it('should finish the wallet update even after the user has other activity', async () => {
+    entries.push({ entryId: 'entry-1', accountId: 'user-1', amount: 5000, idempotencyKey: 'opening-balance-user-1' });
+    entries.push({ entryId: 'entry-2', accountId: 'user-1', amount: 100, idempotencyKey: 'earn-1' });
+
+    const result = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    expect(result).toMatchObject({ created: false, entry: { entryId: 'entry-1' } });
+    expect(applyWalletDelta).toHaveBeenCalledWith('user-1', 5000, 'opening-balance-user-1');
+  });
+
+  it('should leave users with prior transactions untouched', async () => {
+    entries.push({ entryId: 'entry-1', accountId: 'user-1', amount: 100, idempotencyKey: 'earn-1' });
+
+    const result = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    expect(result).toEqual({ entry: null, created: false });
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+  });
+
+  it('should leave users with a used wallet untouched', async () => {
+    wallets.set('user-1', { userId: 'user-1', availableBalance: 40, version: 3 });
+
+    const result = await service.setOpeningBalance('user-1', 5000, 'migration-2024-06', 'migrator');
+
+    expect(result.created).toBe(false);
+    expect(wallets.get('user-1')?.availableBalance).toBe(40);
+  });
+
+  it('should reject non-positive amounts', async () => {
+    await expect(service.setOpeningBalance('user-1', 0, 'm', 'migrator')).rejects.toThrow(
+      'Opening balance must be a positive integer'
+    );
+  });
+});
@@ -0,0 +1,144 @@
+/**
+ * Opening Balance Service
+ *
+ * Sets a migrated user's opening balance exactly once, so onboarding
+ * migrations can be re-run safely. The opening balance is an admin
+ * credit recorded under the deterministic idempotency key
+ * `opening-balance-<userId>`; the ledger's unique key index makes that
+ * the atomic claim, so of two concurrent migrations only one creates it.
+ *
+ * Users who already have activity (ledger entries or a used wallet) are
+ * left untouched and reported as not created. The wallet is credited
+ * after the ledger claim with applyWalletDelta under the same key, and
+ * every re-run that finds the opening balance re-drives it, so a crash
+ * between the two steps is completed by the next run, even once the
+ * user has other activity, without applying it twice.
+ *
+ * @module services/opening-balance
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { LedgerEntry } from '../ledger/types';
+import { LedgerService } from '../ledger/ledger.service';
+import { WalletModel } from '../db/models/wallet.model';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+/**
+ * Configuration for the opening balance service
+ */
+export interface OpeningBalanceConfig {
+  /** Currency stamped on new wallets and entries */
+  defaultCurrency: string;
+}
+
+const DEFAULT_CONFIG: OpeningBalanceConfig = {
+  defaultCurrency: 'points',
+};
+
+/**
+ * Result of setting an opening balance
+ */
+export interface OpeningBalanceResult {
+  /** The opening balance entry, or null if the user had other activity */
+  entry: LedgerEntry | null;
+
+  /** True only for the call that created the opening balance */
+  created: boolean;
+}
+
+/**
+ * Opening Balance Service Implementation
+ */
+export class OpeningBalanceService {
+  private config: OpeningBalanceConfig;
+  private ledgerService: Pick<LedgerService, 'createEntryWithResult' | 'queryEntries'>;
+
+  constructor(
+    ledgerService: Pick<LedgerService, 'createEntryWithResult' | 'queryEntries'>,
+    config: Partial<OpeningBalanceConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Set a user's opening balance if they have no prior activity
+   *
+   * @param reference Migration reference recorded as the correlation ID
+   * @param committedBy Operator or job applying the migration
+   */
+  async setOpeningBalance(
+    userId: string,
+    amount: number,
+    reference: string,
+    committedBy: string
+  ): Promise<OpeningBalanceResult> {
+    if (!Number.isSafeInteger(amount) || amount <= 0) {
+      throw new Error('Opening balance must be a positive integer');
+    }
+
+    if (!reference || !committedBy) {
+      throw new Error('reference and committedBy are required');
+    }
+
+    const idempotencyKey = `opening-balance-${userId}`;
+
+    // An opening balance is the user's first entry
+    const prior = await this.ledgerService.queryEntries({
+      accountId: userId,
+      accountType: 'user',
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      limit: 1,
+    });
+    const first = prior.entries[0];
+
+    if (first && first.idempotencyKey === idempotencyKey) {
+      // Re-driven on every re-run; a no-op once it has moved the wallet
+      await applyWalletDelta(first.accountId, first.amount, idempotencyKey);
+      return { entry: first, created: false };
+    }
+
+    if (first) {
+      return { entry: null, created: false };
+    }
+
+    const wallet = await WalletModel.findOne({ userId: { $eq: userId } });
+    if (wallet && wallet.version > 0) {
+      return { entry: null, created: false };
+    }
+
+    const { entry, inserted } = await this.ledgerService.createEntryWithResult({
+      transactionId: uuidv4(),
+      accountId: userId,
+      accountType: 'user',
+      amount,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.ADMIN_CREDIT,
+      idempotencyKey,
+      requestId: `${reference}-${userId}`,
+      balanceBefore: 0,
+      balanceAfter: amount,
+      currency: this.config.defaultCurrency,
+      correlationId: reference,
+      metadata: { openingBalance: true, committedBy },
+    });
+
+    await applyWalletDelta(entry.accountId, entry.amount, idempotencyKey);
+
+    return { entry, created: inserted };
+  }
+}
+
+/**
+ * Factory function to create an opening balance service
+ */
+export function createOpeningBalanceService(
+  ledgerService: Pick<LedgerService, 'createEntryWithResult' | 'queryEntries'>,
+  config?: Partial<OpeningBalanceConfig>
+): OpeningBalanceService {
+  return new OpeningBalanceService(ledgerService, config);
+}
@@ -73,6 +73,7 @@ describe('PointAccrualService', () => {
         balanceAfter: amount,
         timestamp: new Date(),
         currency: 'points',
+        streamVersion: 1,
       } as any);
 
       // Act
@@ -87,6 +88,7 @@ describe('PointAccrualService', () => {
       // Assert
       expect(result.amountAwarded).toBe(amount);
       expect(result.newBalance).toBe(amount);
+      expect(result.streamVersion).toBe(1);
       expect(mockLedgerService.createEntry).toHaveBeenCalledWith(
         expect.objectContaining({
           accountId: userId,
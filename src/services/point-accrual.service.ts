@@ -37,6 +37,9 @@ export interface AwardPointsRequest {
   
   /** Optional expiration date for points */
   expiresAt?: Date;
+  
+  /** Upstream reference (e.g. purchase ID) used for reference deduplication */
+  correlationId?: string;
 }
 
 /**
@@ -54,6 +57,9 @@ export interface AwardPointsResponse {
   
   /** Award timestamp */
   timestamp: Date;
+  
+  /** User's stream version after the award, for read-your-writes (when tracked) */
+  streamVersion?: number;
 }
 
 /**
@@ -191,7 +197,7 @@ export class PointAccrualService {
     const transactionId = uuidv4();
     const timestamp = new Date();
     
-    await this.ledgerService.createEntry({
+    const entry = await this.ledgerService.createEntry({
       transactionId,
       accountId: request.userId,
       accountType: 'user',
@@ -205,6 +211,7 @@ export class PointAccrualService {
       balanceBefore: previousBalance,
       balanceAfter: newBalance,
       currency: this.config.defaultCurrency,
+      correlationId: request.correlationId,
       metadata: {
         ...request.metadata,
         expiresAt: request.expiresAt?.toISOString(),
@@ -216,6 +223,7 @@ export class PointAccrualService {
       amountAwarded: request.amount,
       newBalance,
       timestamp,
+      streamVersion: entry.streamVersion,
     };
   }
   
@@ -363,6 +371,7 @@ export class PointAccrualService {
       TransactionReason.REFERRAL_BONUS,
       TransactionReason.PROMOTIONAL_AWARD,
       TransactionReason.ADMIN_CREDIT,
+      TransactionReason.PURCHASE_EARN,
     ];
     
     if (!earningReasons.includes(reason)) {
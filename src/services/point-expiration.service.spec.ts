@@ -0,0 +1,341 @@
+/**
+ * Point Expiration Service Tests
+ */
+
+import { PointExpirationService } from './point-expiration.service';
+import { RedemptionNotFoundError } from './types';
+import { WalletModel } from '../db/models/wallet.model';
+import { LedgerEntry } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { defaultProgram } from '../config/program';
+
+jest.mock('../db/models/wallet.model');
+
+const DAY = 24 * 60 * 60 * 1000;
+
+describe('PointExpirationService', () => {
+  let entries: LedgerEntry[];
+  let n: number;
+  let mockLedgerService: any;
+  let service: PointExpirationService;
+
+  const asOf = new Date('2025-06-01T00:00:00Z');
+  const at = (days: number) => new Date(asOf.getTime() + days * DAY);
+
+  const record = (userId: string, amount: number, timestamp: Date, fields: Partial<LedgerEntry> = {}) => {
+    n++;
+    entries.push({
+      entryId: `entry-${String(n).padStart(3, '0')}`,
+      transactionId: `tx-${n}`,
+      accountId: userId,
+      accountType: 'user',
+      amount,
+      type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+      balanceState: 'available',
+      stateTransition: amount >= 0 ? 'none→available' : 'available→none',
+      reason: amount >= 0 ? TransactionReason.PROMOTIONAL_AWARD : TransactionReason.CHIP_MENU_PURCHASE,
+      idempotencyKey: `key-${n}`,
+      requestId: `req-${n}`,
+      balanceBefore: 0,
+      balanceAfter: 0,
+      timestamp,
+      currency: 'points',
+      ...fields,
+    });
+  };
+  const credit = (userId: string, amount: number, creditedAt: Date, expiresAt?: Date) =>
+    record(userId, amount, creditedAt, expiresAt ? { metadata: { expiresAt: expiresAt.toISOString() } } : {});
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    entries = [];
+    n = 0;
+
+    mockLedgerService = {
+      queryEntries: jest.fn().mockImplementation(async (filter: any) => {
+        const matching = entries.filter(
+          e => e.accountId === filter.accountId && (!filter.endDate || e.timestamp <= filter.endDate)
+        );
+        return { entries: matching, totalCount: matching.length, hasMore: false };
+      }),
+      createEntry: jest.fn().mockImplementation(async (request: any) => {
+        record(request.accountId, request.amount, new Date(), { reason: request.reason, metadata: request.metadata });
+        return request;
+      }),
+    };
+
+    service = new PointExpirationService(mockLedgerService);
+  });
+
+  describe('expirableAmount', () => {
+    it('should count the held points of every lot past its own expiry', async () => {
+      credit('user-1', 100, at(-90), at(-30));
+      credit('user-1', 200, at(-60), at(-1));
+      credit('user-1', 400, at(-20), at(40));
+      credit('user-1', 50, at(-10));
+
+      await expect(service.expirableAmount('user-1', asOf)).resolves.toBe(300);
+    });
+
+    it('should let partial redemptions draw down the oldest lots first', async () => {
+      credit('user-1', 100, at(-90), at(-30));
+      credit('user-1', 300, at(-60), at(60));
+      credit('user-1', 200, at(-50), at(-5));
+      record('user-1', -150, at(-40));
+
+      // The redemption emptied the 100 lot and took 50 from the unexpired 300 lot
+      await expect(service.expirableAmount('user-1', asOf)).resolves.toBe(200);
+    });
+
+    it('should count a lot only once its expiry has passed', async () => {
+      credit('user-1', 100, at(-10), at(5));
+      record('user-1', -30, at(-5));
+
+      await expect(service.expirableAmount('user-1', asOf)).resolves.toBe(0);
+      await expect(service.expirableAmount('user-1', at(5))).resolves.toBe(70);
+    });
+
+    it('should not count points the sweeper already expired', async () => {
+      credit('user-1', 100, at(-40), at(-20));
+      record('user-1', -100, at(-19), {
+        reason: TransactionReason.POINT_EXPIRY,
+        metadata: { expiredThrough: at(-19).toISOString() },
+      });
+
+      await expect(service.expirableAmount('user-1', asOf)).resolves.toBe(0);
+    });
+  });
+
+  describe('expiringPoints', () => {
+    it('should report only the unredeemed part of a partially redeemed lot', async () => {
+      credit('user-1', 1000, at(-60), at(20));
+      credit('user-1', 2000, at(-30), at(25));
+      record('user-1', -600, at(-10));
+
+      const result = await service.expiringPoints('user-1', 30 * DAY, asOf);
+
+      expect(result.total).toBe(2400);
+      expect(result.lots.map(lot => [lot.entryId, lot.amount])).toEqual([
+        ['entry-001', 400],
+        ['entry-002', 2000],
+      ]);
+    });
+
+    it('should leave out lots expiring after the window and points that never expire', async () => {
+      credit('user-1', 500, at(-5));
+      credit('user-1', 300, at(-5), at(45));
+      credit('user-1', 200, at(-5), at(10));
+
+      const result = await service.expiringPoints('user-1', 30 * DAY, asOf);
+
+      expect(result.total).toBe(200);
+      expect(result.lots).toHaveLength(1);
+    });
+
+    it('should not report lots the sweeper already expired', async () => {
+      credit('user-1', 100, at(-40), at(-20));
+      record('user-1', -100, at(-19), {
+        reason: TransactionReason.POINT_EXPIRY,
+        metadata: { expiredThrough: at(-19).toISOString() },
+      });
+
+      await expect(service.expiringPoints('user-1', 30 * DAY, asOf)).resolves.toMatchObject({ total: 0, lots: [] });
+    });
+
+    it('should report lots past expiry that are awaiting the next sweep', async () => {
+      credit('user-1', 100, at(-40), at(-1));
+
+      await expect(service.expiringPoints('user-1', 30 * DAY, asOf)).resolves.toMatchObject({ total: 100 });
+    });
+
+    it('should delay expiry by the grace period', async () => {
+      credit('user-1', 100, at(-40), at(25));
+      const graceful = new PointExpirationService(mockLedgerService, { gracePeriodDays: 10 });
+
+      await expect(graceful.expiringPoints('user-1', 30 * DAY, asOf)).resolves.toMatchObject({ total: 0 });
+      await expect(graceful.expiringPoints('user-1', 35 * DAY, asOf)).resolves.toMatchObject({ total: 100 });
+    });
+
+    it('should match what the sweeper expires', async () => {
+      const now = new Date();
+      credit('user-1', 1000, new Date(now.getTime() - 60 * DAY), new Date(now.getTime() - DAY));
+      credit('user-1', 500, new Date(now.getTime() - 50 * DAY));
+      record('user-1', -700, new Date(now.getTime() - 40 * DAY));
+      (WalletModel.findOne as jest.Mock).mockResolvedValue({ userId: 'user-1', availableBalance: 800, version: 3 });
+      (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue({});
+
+      const reported = await service.expiringPoints('user-1', 0, now);
+      const swept = await service.processUserExpiration('user-1', 'req-1');
+
+      expect(reported.total).toBe(300);
+      expect(swept!.amountExpired).toBe(reported.total);
+      await expect(service.expiringPoints('user-1', 0, new Date())).resolves.toMatchObject({ total: 0 });
+    });
+  });
+
+  describe('redemptionSources', () => {
+    beforeEach(() => {
+      mockLedgerService.getAuditTrail = jest.fn().mockImplementation(async (transactionId: string) =>
+        entries.filter(e => e.transactionId === transactionId).map(e => ({ auditId: e.entryId, ledgerEntry: e }))
+      );
+    });
+
+    it('should list every lot a redemption spans, oldest first', async () => {
+      credit('user-1', 300, at(-60), at(30));
+      credit('user-1', 200, at(-40));
+      credit('user-1', 500, at(-20), at(60));
+      record('user-1', -600, at(-10));
+
+      const sources = await service.redemptionSources('tx-4');
+
+      expect(sources.map(lot => [lot.entryId, lot.consumed])).toEqual([
+        ['entry-001', 300],
+        ['entry-002', 200],
+        ['entry-003', 100],
+      ]);
+      expect(sources[0].expiresAt).toEqual(at(30));
+    });
+
+    it('should skip what earlier redemptions and expiries already drew down', async () => {
+      credit('user-1', 300, at(-60), at(-50));
+      credit('user-1', 200, at(-55));
+      credit('user-1', 500, at(-20));
+      record('user-1', -300, at(-45), {
+        reason: TransactionReason.POINT_EXPIRY,
+        metadata: { expiredThrough: at(-50).toISOString() },
+      });
+      record('user-1', -150, at(-30));
+      record('user-1', -250, at(-10));
+      // A later redemption does not change what this one drew
+      record('user-1', -100, at(-5));
+
+      const sources = await service.redemptionSources('tx-6');
+
+      expect(sources.map(lot => [lot.entryId, lot.consumed])).toEqual([
+        ['entry-002', 50],
+        ['entry-003', 200],
+      ]);
+    });
+
+    it('should reject a transaction that is not a redemption', async () => {
+      credit('user-1', 300, at(-60));
+
+      await expect(service.redemptionSources('tx-1')).rejects.toThrow(RedemptionNotFoundError);
+      await expect(service.redemptionSources('tx-missing')).rejects.toThrow('Redemption not found: tx-missing');
+    });
+  });
+
+  describe('redemptionLatencies', () => {
+    it('should time each lot from its credit to the first redemption drawing on it', async () => {
+      credit('user-1', 100, at(-90));
+      credit('user-1', 200, at(-80), at(30));
+      credit('user-1', 300, at(-20));
+      // Lot 1 is redeemed the day after it was earned
+      record('user-1', -100, at(-89));
+      // Lot 2 waits until the first lot is gone and long after
+      record('user-1', -150, at(-2));
+      record('user-1', -50, at(-1));
+
+      const latencies = await service.redemptionLatencies('user-1', asOf);
+
+      expect(latencies).toEqual([
+        { entryId: 'entry-001', creditedAt: at(-90), amount: 100, redeemedAt: at(-89), latencyMs: DAY },
+        { entryId: 'entry-002', creditedAt: at(-80), amount: 200, redeemedAt: at(-2), latencyMs: 78 * DAY },
+        { entryId: 'entry-003', creditedAt: at(-20), amount: 300, redeemedAt: null, latencyMs: null },
+      ]);
+    });
+
+    it('should leave out a balance carried in before the first entry', async () => {
+      credit('user-1', 100, at(-30));
+      entries[0].balanceBefore = 50;
+      record('user-1', -80, at(-10));
+
+      const latencies = await service.redemptionLatencies('user-1', asOf);
+
+      // The carried 50 went first; the redemption still reached the earned lot
+      expect(latencies.map(l => [l.entryId, l.latencyMs])).toEqual([['entry-001', 20 * DAY]]);
+    });
+
+    it('should not count expiries or adjustments as redemptions', async () => {
+      credit('user-1', 100, at(-90), at(-60));
+      credit('user-1', 100, at(-80));
+      record('user-1', -100, at(-59), {
+        reason: TransactionReason.POINT_EXPIRY,
+        metadata: { expiredThrough: at(-60).toISOString() },
+      });
+      record('user-1', -50, at(-50), { reason: TransactionReason.ADMIN_DEBIT });
+      record('user-1', -50, at(-10));
+
+      const latencies = await service.redemptionLatencies('user-1', asOf);
+
+      expect(latencies.map(l => [l.entryId, l.redeemedAt])).toEqual([
+        ['entry-001', null],
+        ['entry-002', at(-10)],
+      ]);
+      expect(latencies[1].latencyMs).toBe(70 * DAY);
+    });
+  });
+
+  describe('allUsersExpiring', () => {
+    it('should stream users with expiring points a page at a time', async () => {
+      const userIds = Array.from({ length: 5 }, (_, i) => `user-${i}`);
+      userIds.forEach((userId, i) => credit(userId, 100 * (i + 1), at(-10), i === 2 ? undefined : at(5)));
+      (WalletModel.find as jest.Mock).mockImplementation((query: any) => {
+        let limit = 0;
+        const chain: any = {
+          sort: jest.fn().mockReturnThis(),
+          limit: jest.fn().mockImplementation((value: number) => {
+            limit = value;
+            return chain;
+          }),
+          select: jest.fn().mockReturnThis(),
+          lean: jest.fn().mockReturnThis(),
+          exec: jest.fn().mockImplementation(async () =>
+            userIds.filter(userId => !query.userId || userId > query.userId.$gt).slice(0, limit).map(userId => ({ userId }))
+          ),
+        };
+        return chain;
+      });
+      const paged = new PointExpirationService(mockLedgerService, { batchSize: 2 });
+      const pages: string[][] = [];
+
+      const reported = await paged.allUsersExpiring(30 * DAY, asOf, async page => {
+        pages.push(page.map(result => `${result.userId}:${result.total}`));
+      });
+
+      expect(reported).toBe(4);
+      expect(pages).toEqual([['user-0:100', 'user-1:200'], ['user-3:400'], ['user-4:500']]);
+    });
+  });
+
+  describe('startSweeper', () => {
+    afterEach(() => {
+      service.stopSweeper();
+      jest.useRealTimers();
+    });
+
+    it('should sweep on the program interval, re-read before each run', async () => {
+      jest.useFakeTimers();
+      let config = { ...defaultProgram(), expiration: { ...defaultProgram().expiration, sweepIntervalMinutes: 30 } };
+      service = new PointExpirationService(mockLedgerService, { program: { current: () => config } });
+      const sweep = jest.spyOn(service, 'processBatchExpiration').mockResolvedValue({} as any);
+
+      service.startSweeper();
+      await jest.advanceTimersByTimeAsync(29 * 60 * 1000);
+      expect(sweep).not.toHaveBeenCalled();
+      config = { ...config, expiration: { ...config.expiration, sweepIntervalMinutes: 5 } };
+      await jest.advanceTimersByTimeAsync(60 * 1000);
+      expect(sweep).toHaveBeenCalledTimes(1);
+      await jest.advanceTimersByTimeAsync(5 * 60 * 1000);
+      expect(sweep).toHaveBeenCalledTimes(2);
+
+      service.stopSweeper();
+      await jest.advanceTimersByTimeAsync(60 * 60 * 1000);
+      expect(sweep).toHaveBeenCalledTimes(2);
+    });
+
+    it('should require a program config', () => {
+      expect(() => service.startSweeper()).toThrow('program config');
+    });
+  });
+});
@@ -9,9 +9,21 @@
  */
 
 import { v4 as uuidv4 } from 'uuid';
-import { ILedgerService, LedgerQueryFilter } from '../ledger/types';
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import {
+  ExpiryLot,
+  SourceLot,
+  RedemptionLatency,
+  projectExpiryLots,
+  expiredLots,
+  consumedLots,
+  redemptionLatencies,
+} from '../ledger/expiry-lots';
 import { WalletModel } from '../db/models/wallet.model';
-import { TransactionType, TransactionReason } from '../wallets/types';
+import { TransactionType, TransactionReason, REDEMPTION_REASONS } from '../wallets/types';
+import { ExpirationPolicy, ProgramConfigSource } from '../config/program';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+import { RedemptionNotFoundError } from './types';
 
 /**
  * Expiration batch result
@@ -53,6 +65,34 @@ export interface UserExpirationDetails {
   timestamp: Date;
 }
 
+/**
+ * Points from one lot that will expire
+ */
+export interface LotExpiry {
+  /** Credit that opened the lot */
+  entryId: string;
+  
+  creditedAt: Date;
+  
+  expiresAt: Date;
+  
+  /** Points of the lot still unspent, all of which will expire */
+  amount: number;
+}
+
+/**
+ * Points a user will lose within a window if they redeem nothing
+ */
+export interface ExpiringPoints {
+  userId: string;
+  
+  /** Sum of the lot amounts */
+  total: number;
+  
+  /** Expiring lots, oldest credit first */
+  lots: LotExpiry[];
+}
+
 /**
  * Configuration for expiration service
  */
@@ -71,6 +111,13 @@ export interface PointExpirationConfig {
   
   /** Warning period in days (notify before expiration) */
   warningPeriodDays: number;
+  
+  /**
+   * Program config to take the expiration policy from; when set it
+   * replaces gracePeriodDays and warningPeriodDays, and a program with
+   * expiration disabled expires nothing
+   */
+  program?: ProgramConfigSource;
 }
 
 const DEFAULT_CONFIG: PointExpirationConfig = {
@@ -81,16 +128,32 @@ const DEFAULT_CONFIG: PointExpirationConfig = {
   warningPeriodDays: 7,
 };
 
+/**
+ * Minutes between sweeps when the program sets no interval, which it
+ * may only do while expiration is disabled
+ */
+const FALLBACK_SWEEP_INTERVAL_MINUTES = 60;
+
+/**
+ * Page size used when reading a user's ledger entries
+ */
+const PAGE_SIZE = 1000;
+
 /**
  * Point Expiration Service Implementation
  * 
  * Processes point expirations automatically based on expiration
  * dates stored in ledger metadata. All expirations create new
  * immutable ledger entries (no destructive edits).
+ * 
+ * What expires is decided on the FIFO lot projection: only the unspent
+ * remainder of each expired credit. The expiring-points reports use the
+ * same projection and cut-off, so they match what a sweep would expire.
  */
 export class PointExpirationService {
   private config: PointExpirationConfig;
   private ledgerService: ILedgerService;
+  private sweepTimer?: NodeJS.Timeout;
 
   constructor(
     ledgerService: ILedgerService,
@@ -104,8 +167,8 @@ export class PointExpirationService {
    * Process expired points for a single user
    * 
    * This method:
-   * 1. Queries ledger for credit entries with expiration dates
-   * 2. Identifies expired points
+   * 1. Projects the user's lots from their ledger entries
+   * 2. Identifies the unspent points of expired lots
    * 3. Debits the expired amount
    * 4. Creates immutable ledger entry for the expiration
    * 
@@ -117,34 +180,20 @@ export class PointExpirationService {
     userId: string,
     requestId: string
   ): Promise<UserExpirationDetails | null> {
-    // Query ledger for credit entries with expiration dates
-    const filter: LedgerQueryFilter = {
-      accountId: userId,
-      accountType: 'user',
-      type: TransactionType.CREDIT,
-      balanceState: 'available',
-    };
-    
-    const ledgerResult = await this.ledgerService.queryEntries(filter);
+    const policy = this.policy();
+    if (!policy.enabled) {
+      return null;
+    }
     
-    // Find expired entries
     const now = new Date();
     const gracePeriodDate = new Date(
-      now.getTime() - this.config.gracePeriodDays * 24 * 60 * 60 * 1000
+      now.getTime() - policy.gracePeriodDays * 24 * 60 * 60 * 1000
     );
     
-    let totalExpired = 0;
-    
-    for (const entry of ledgerResult.entries) {
-      const expiresAt = entry.metadata?.expiresAt 
-        ? new Date(entry.metadata.expiresAt) 
-        : null;
-      
-      if (expiresAt && expiresAt <= gracePeriodDate) {
-        // This entry has expired
-        totalExpired += entry.amount;
-      }
-    }
+    // Unspent remainders of credits expired by the cut-off
+    const lots = await this.loadLots(userId, now);
+    const totalExpired = expiredLots(lots, gracePeriodDate)
+      .reduce((sum, lot) => sum + lot.remaining, 0);
     
     if (totalExpired === 0) {
       return null;
@@ -211,6 +260,7 @@ export class PointExpirationService {
       currency: this.config.defaultCurrency,
       metadata: {
         expirationDate: timestamp.toISOString(),
+        expiredThrough: gracePeriodDate.toISOString(),
         amountExpired: amountToExpire,
       },
     });
@@ -278,10 +328,118 @@ export class PointExpirationService {
     return result;
   }
   
+  /**
+   * Points a user will lose within a window if they redeem nothing
+   * 
+   * A lot counts when a sweep run within the window would expire it:
+   * its expiresAt, plus the grace period, falls at or before
+   * asOf + within. Lots already past expiry but not yet swept count
+   * too; lots already swept do not.
+   * 
+   * @param userId User ID
+   * @param withinMs Window length in milliseconds
+   * @param asOf Ledger cut-off and start of the window
+   */
+  async expiringPoints(
+    userId: string,
+    withinMs: number,
+    asOf: Date = new Date()
+  ): Promise<ExpiringPoints> {
+    const policy = this.policy();
+    if (!policy.enabled) {
+      return { userId, total: 0, lots: [] };
+    }
+    
+    const lots = await this.loadLots(userId, asOf);
+    const through = new Date(
+      asOf.getTime() + withinMs - policy.gracePeriodDays * 24 * 60 * 60 * 1000
+    );
+    
+    const expiring = expiredLots(lots, through).map(lot => ({
+      entryId: lot.entryId,
+      creditedAt: lot.creditedAt,
+      expiresAt: lot.expiresAt!,
+      amount: lot.remaining,
+    }));
+    
+    return {
+      userId,
+      total: expiring.reduce((sum, lot) => sum + lot.amount, 0),
+      lots: expiring,
+    };
+  }
+  
+  /**
+   * Points a user holds that are past their lot's own expiresAt at now
+   * 
+   * Lots are replayed FIFO, so redemptions draw down the oldest lots
+   * whether or not they have expired, and only what is left of an
+   * expired lot counts. The grace period is not applied: this is what
+   * has expired, not what the next sweep will take.
+   * 
+   * @param userId User ID
+   * @param now Ledger cut-off and expiry reference time
+   */
+  async expirableAmount(userId: string, now: Date = new Date()): Promise<number> {
+    const lots = await this.loadLots(userId, now);
+    return expiredLots(lots, now).reduce((sum, lot) => sum + lot.remaining, 0);
+  }
+  
+  /**
+   * Expiring points for every user with a wallet, streamed a page at a time
+   * 
+   * Wallets are walked in userId order, batchSize at a time; each page's
+   * users with points expiring are handed to onPage before the next page
+   * is read, so the notification pipeline can apply backpressure.
+   * 
+   * @param withinMs Window length in milliseconds
+   * @param asOf Ledger cut-off and start of the window
+   * @param onPage Receives each non-empty page of results
+   * @returns Number of users with points expiring
+   */
+  async allUsersExpiring(
+    withinMs: number,
+    asOf: Date,
+    onPage: (page: ExpiringPoints[]) => Promise<void>
+  ): Promise<number> {
+    let after: string | null = null;
+    let reported = 0;
+    
+    for (;;) {
+      const query = after === null ? {} : { userId: { $gt: after } };
+      const wallets = await WalletModel.find(query)
+        .sort({ userId: 1 })
+        .limit(this.config.batchSize)
+        .select('userId')
+        .lean()
+        .exec();
+      
+      if (wallets.length === 0) {
+        return reported;
+      }
+      after = wallets[wallets.length - 1].userId;
+      
+      const results = await Promise.all(
+        wallets.map(wallet => this.expiringPoints(wallet.userId, withinMs, asOf))
+      );
+      const page = results.filter(result => result.total > 0);
+      
+      if (page.length > 0) {
+        reported += page.length;
+        await onPage(page);
+      }
+      
+      if (wallets.length < this.config.batchSize) {
+        return reported;
+      }
+    }
+  }
+  
   /**
    * Get users with expiring points (for warning notifications)
    * 
-   * Returns users who have points expiring within the warning period.
+   * Returns users who have points expiring within the warning period,
+   * with the earliest expiry among their expiring lots.
    * 
    * @returns List of users with expiring points
    */
@@ -289,56 +447,156 @@ export class PointExpirationService {
     Array<{ userId: string; amountExpiring: number; expiresAt: Date }>
   > {
     const users: Array<{ userId: string; amountExpiring: number; expiresAt: Date }> = [];
+    const warningMs = this.policy().warningPeriodDays * 24 * 60 * 60 * 1000;
     
-    // Get all ledger entries with expiration dates
-    const now = new Date();
-    const warningDate = new Date(
-      now.getTime() + this.config.warningPeriodDays * 24 * 60 * 60 * 1000
-    );
+    await this.allUsersExpiring(warningMs, new Date(), async (page) => {
+      for (const result of page) {
+        users.push({
+          userId: result.userId,
+          amountExpiring: result.total,
+          expiresAt: new Date(Math.min(...result.lots.map(lot => lot.expiresAt.getTime()))),
+        });
+      }
+    });
     
-    // Query would need to be enhanced to filter by metadata.expiresAt
-    // This is a simplified implementation
-    const filter: LedgerQueryFilter = {
-      type: TransactionType.CREDIT,
-      balanceState: 'available',
+    return users;
+  }
+  
+  /**
+   * Run processBatchExpiration over every user on the program's sweep
+   * interval until stopSweeper is called
+   * The interval is read again before each run is scheduled, so a reload
+   * that changes sweepIntervalMinutes applies from the next run. A failed
+   * run is reported as an alert and the next one is still scheduled.
+   *
+   * @throws Error if no program config is set
+   */
+  startSweeper(): void {
+    if (!this.config.program) {
+      throw new Error('The expiration sweeper takes its interval from a program config');
+    }
+    if (!this.sweepTimer) {
+      this.scheduleSweep();
+    }
+  }
+
+  /**
+   * Stop the expiration sweeper
+   */
+  stopSweeper(): void {
+    if (this.sweepTimer) {
+      clearTimeout(this.sweepTimer);
+      this.sweepTimer = undefined;
+    }
+  }
+
+  private scheduleSweep(): void {
+    const minutes =
+      this.config.program?.current().expiration.sweepIntervalMinutes ?? FALLBACK_SWEEP_INTERVAL_MINUTES;
+
+    this.sweepTimer = setTimeout(() => {
+      void this.processBatchExpiration(null, `expiration-sweep-${uuidv4()}`)
+        .catch(error => {
+          MetricsLogger.logAlert({
+            severity: AlertSeverity.ERROR,
+            message: 'Point expiration sweep failed',
+            metricType: MetricEventType.POINT_EXPIRATION_SWEEP_FAILED,
+            timestamp: new Date(),
+            metadata: {
+              error: error instanceof Error ? error.name : 'Unknown error',
+            },
+          });
+        })
+        .finally(() => {
+          // Not rescheduled once stopped, including mid-run
+          if (this.sweepTimer) {
+            this.scheduleSweep();
+          }
+        });
+    }, minutes * 60 * 1000);
+  }
+
+  /**
+   * Active expiration settings
+   */
+  private policy(): Pick<ExpirationPolicy, 'enabled' | 'gracePeriodDays' | 'warningPeriodDays'> {
+    return this.config.program?.current().expiration || {
+      enabled: true,
+      gracePeriodDays: this.config.gracePeriodDays,
+      warningPeriodDays: this.config.warningPeriodDays,
     };
+  }
+  
+  /**
+   * Credits a redemption drew down under FIFO, for disputes
+   * Earlier redemptions and expiries are replayed first, so only what
+   * was left of each lot at the time can be attributed to this one.
+   * 
+   * @param transactionId Transaction ID of the redemption
+   * @returns Lots and the points taken from each, oldest credit first
+   * @throws RedemptionNotFoundError if the transaction holds no redemption
+   */
+  async redemptionSources(transactionId: string): Promise<SourceLot[]> {
+    const trail = await this.ledgerService.getAuditTrail(transactionId);
+    const redemption = trail
+      .map(audit => audit.ledgerEntry)
+      .find(
+        entry =>
+          entry.accountType === 'user' &&
+          entry.type === TransactionType.DEBIT &&
+          entry.balanceState === 'available' &&
+          REDEMPTION_REASONS.includes(entry.reason)
+      );
+    if (!redemption) {
+      throw new RedemptionNotFoundError(transactionId);
+    }
     
-    const ledgerResult = await this.ledgerService.queryEntries(filter);
-    
-    // Group by user and sum expiring amounts
-    const userExpirationMap = new Map<string, { amount: number; date: Date }>();
+    const entries = await this.loadEntries(redemption.accountId, new Date(redemption.timestamp));
+    return consumedLots(entries, redemption.entryId) || [];
+  }
+  
+  /**
+   * How long each of a user's earned lots sat before a redemption first
+   * drew on it under FIFO, oldest lot first; lots not yet redeemed have
+   * no redemption time
+   */
+  async redemptionLatencies(userId: string, asOf: Date = new Date()): Promise<RedemptionLatency[]> {
+    return redemptionLatencies(await this.loadEntries(userId, asOf), REDEMPTION_REASONS);
+  }
+  
+  /**
+   * Project a user's lots from their available-balance entries up to asOf
+   */
+  private async loadLots(userId: string, asOf: Date): Promise<ExpiryLot[]> {
+    return projectExpiryLots(await this.loadEntries(userId, asOf));
+  }
+  
+  /**
+   * A user's available-balance entries up to asOf, oldest first
+   */
+  private async loadEntries(userId: string, asOf: Date): Promise<LedgerEntry[]> {
+    const entries: LedgerEntry[] = [];
+    let offset = 0;
+    let hasMore = true;
     
-    for (const entry of ledgerResult.entries) {
-      const expiresAt = entry.metadata?.expiresAt
-        ? new Date(entry.metadata.expiresAt)
-        : null;
+    while (hasMore) {
+      const result = await this.ledgerService.queryEntries({
+        accountId: userId,
+        accountType: 'user',
+        balanceState: 'available',
+        endDate: asOf,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: PAGE_SIZE,
+      });
       
-      if (expiresAt && expiresAt >= now && expiresAt <= warningDate) {
-        const existing = userExpirationMap.get(entry.accountId);
-        if (existing) {
-          existing.amount += entry.amount;
-          if (expiresAt < existing.date) {
-            existing.date = expiresAt;
-          }
-        } else {
-          userExpirationMap.set(entry.accountId, {
-            amount: entry.amount,
-            date: expiresAt,
-          });
-        }
-      }
+      entries.push(...result.entries);
+      offset += result.entries.length;
+      hasMore = result.hasMore && result.entries.length > 0;
     }
     
-    // Convert map to array
-    userExpirationMap.forEach((value, userId) => {
-      users.push({
-        userId,
-        amountExpiring: value.amount,
-        expiresAt: value.date,
-      });
-    });
-    
-    return users;
+    return entries;
   }
   
   /**
@@ -52,6 +52,7 @@ describe('PointRedemptionService', () => {
         newAvailableBalance: 400,
         escrowBalance: 100,
         timestamp: new Date(),
+        streamVersion: 8,
       });
 
       // Act
@@ -70,6 +71,7 @@ describe('PointRedemptionService', () => {
       expect(result.escrowId).toBe('esc-1');
       expect(result.newAvailableBalance).toBe(400);
       expect(result.escrowBalance).toBe(100);
+      expect(result.streamVersion).toBe(8);
       expect(mockWalletService.holdInEscrow).toHaveBeenCalledWith(
         expect.objectContaining({
           userId,
@@ -315,4 +317,127 @@ describe('PointRedemptionService', () => {
       );
     });
   });
+
+  describe('with redeem guard', () => {
+    it('should not hold escrow when the guard blocks the redemption', async () => {
+      const mockGuard = {
+        check: jest.fn().mockRejectedValue(new Error('Redemption velocity limit exceeded')),
+        release: jest.fn(),
+      } as any;
+      const guardedService = new PointRedemptionService(mockWalletService, {}, mockGuard);
+
+      await expect(
+        guardedService.redeemPoints({
+          userId: 'user-123',
+          amount: 100,
+          featureType: 'chip_menu',
+          queueItemId: 'queue-guard',
+          reason: TransactionReason.CHIP_MENU_PURCHASE,
+          requestId: 'req-guard',
+          deviceId: 'device-1',
+        })
+      ).rejects.toThrow('Redemption velocity limit exceeded');
+
+      expect(mockGuard.check).toHaveBeenCalledWith(
+        expect.objectContaining({ userId: 'user-123', amount: 100, deviceId: 'device-1' })
+      );
+      expect(mockWalletService.holdInEscrow).not.toHaveBeenCalled();
+    });
+
+    it('should count the redemption under its hold idempotency key', async () => {
+      const mockGuard = {
+        check: jest.fn().mockResolvedValue(true),
+        release: jest.fn(),
+      } as any;
+      const guardedService = new PointRedemptionService(mockWalletService, {}, mockGuard);
+
+      mockWalletService.getUserBalance.mockResolvedValue({
+        available: 500,
+        escrow: 0,
+        total: 500,
+      });
+      mockWalletService.holdInEscrow.mockResolvedValue({
+        transactionId: 'tx-guard',
+        escrowId: 'esc-guard',
+        previousBalance: 500,
+        newAvailableBalance: 400,
+        escrowBalance: 100,
+        timestamp: new Date(),
+      });
+
+      await guardedService.redeemPoints({
+        userId: 'user-123',
+        amount: 100,
+        featureType: 'chip_menu',
+        queueItemId: 'queue-guard',
+        reason: TransactionReason.CHIP_MENU_PURCHASE,
+        requestId: 'req-guard',
+        deviceId: 'device-1',
+      });
+
+      expect(mockGuard.check).toHaveBeenCalledWith(
+        expect.objectContaining({ idempotencyKey: 'redemption-user-123-queue-guard' })
+      );
+      expect(mockWalletService.holdInEscrow).toHaveBeenCalledWith(
+        expect.objectContaining({ idempotencyKey: 'redemption-user-123-queue-guard' })
+      );
+      expect(mockGuard.release).not.toHaveBeenCalled();
+    });
+
+    it('should release a counted redemption whose hold fails', async () => {
+      const mockGuard = {
+        check: jest.fn().mockResolvedValue(true),
+        release: jest.fn(),
+      } as any;
+      const guardedService = new PointRedemptionService(mockWalletService, {}, mockGuard);
+
+      mockWalletService.getUserBalance.mockResolvedValue({
+        available: 500,
+        escrow: 0,
+        total: 500,
+      });
+      mockWalletService.holdInEscrow.mockRejectedValue(new Error('Hold failed'));
+
+      await expect(
+        guardedService.redeemPoints({
+          userId: 'user-123',
+          amount: 100,
+          featureType: 'chip_menu',
+          queueItemId: 'queue-guard',
+          reason: TransactionReason.CHIP_MENU_PURCHASE,
+          requestId: 'req-guard',
+        })
+      ).rejects.toThrow('Hold failed');
+
+      expect(mockGuard.release).toHaveBeenCalledWith('user-123', 'redemption-user-123-queue-guard');
+    });
+
+    it('should keep a replay\'s earlier count when its hold fails', async () => {
+      const mockGuard = {
+        check: jest.fn().mockResolvedValue(false),
+        release: jest.fn(),
+      } as any;
+      const guardedService = new PointRedemptionService(mockWalletService, {}, mockGuard);
+
+      mockWalletService.getUserBalance.mockResolvedValue({
+        available: 500,
+        escrow: 0,
+        total: 500,
+      });
+      mockWalletService.holdInEscrow.mockRejectedValue(new Error('Idempotency key already used'));
+
+      await expect(
+        guardedService.redeemPoints({
+          userId: 'user-123',
+          amount: 100,
+          featureType: 'chip_menu',
+          queueItemId: 'queue-guard',
+          reason: TransactionReason.CHIP_MENU_PURCHASE,
+          requestId: 'req-guard',
+        })
+      ).rejects.toThrow('Idempotency key already used');
+
+      expect(mockGuard.release).not.toHaveBeenCalled();
+    });
+  });
 });
@@ -11,8 +11,10 @@
  */
 
 import { IWalletService } from './types';
+import { RedeemGuard } from './redeem-guard.service';
 import { 
   EscrowHoldRequest, 
+  EscrowHoldResponse,
   TransactionReason 
 } from '../wallets/types';
 
@@ -41,6 +43,12 @@ export interface RedeemPointsRequest {
   /** Request ID for tracing */
   requestId: string;
   
+  /** Device reference the redemption originates from */
+  deviceId?: string;
+  
+  /** Operator overriding velocity limits; must be the authenticated caller */
+  overrideBy?: string;
+  
   /** Additional metadata */
   metadata?: Record<string, any>;
 }
@@ -69,6 +77,9 @@ export interface RedeemPointsResponse {
   
   /** Redemption timestamp */
   timestamp: Date;
+  
+  /** User's stream version after the redemption, for read-your-writes (when tracked) */
+  streamVersion?: number;
 }
 
 /**
@@ -100,13 +111,16 @@ const DEFAULT_CONFIG: PointRedemptionConfig = {
 export class PointRedemptionService {
   private config: PointRedemptionConfig;
   private walletService: IWalletService;
+  private redeemGuard?: RedeemGuard;
 
   constructor(
     walletService: IWalletService,
-    config: Partial<PointRedemptionConfig> = {}
+    config: Partial<PointRedemptionConfig> = {},
+    redeemGuard?: RedeemGuard
   ) {
     this.config = { ...DEFAULT_CONFIG, ...config };
     this.walletService = walletService;
+    this.redeemGuard = redeemGuard;
   }
 
   /**
@@ -121,6 +135,8 @@ export class PointRedemptionService {
    * @returns Redemption response with escrow details
    * @throws InsufficientBalanceError if user doesn't have enough points
    * @throws ValidationError if amount is invalid
+   * @throws RedemptionVelocityError if a redeem guard velocity rule blocks it
+   * @throws UnauthorizedCommitterError if overrideBy is not the authenticated caller
    */
   async redeemPoints(request: RedeemPointsRequest): Promise<RedeemPointsResponse> {
     // Validate amount
@@ -132,35 +148,57 @@ export class PointRedemptionService {
     // Validate feature type
     this.validateFeatureType(request.featureType);
     
-    // Check balance if enabled
-    if (this.config.validateBalance) {
-      const balance = await this.walletService.getUserBalance(request.userId);
-      if (balance.available < request.amount) {
-        throw new Error(
-          `Insufficient balance. Required: ${request.amount}, Available: ${balance.available}`
-        );
-      }
-    }
-    
-    // Hold in escrow via wallet service
     // Use request-specific idempotency key for proper duplicate detection
     const idempotencyKey = `redemption-${request.userId}-${request.queueItemId}`;
     
-    const escrowRequest: EscrowHoldRequest = {
-      userId: request.userId,
-      amount: request.amount,
-      reason: request.reason,
-      queueItemId: request.queueItemId,
-      featureType: request.featureType,
-      idempotencyKey,
-      requestId: request.requestId,
-      metadata: {
-        ...request.metadata,
-        modelId: request.modelId,
-      },
-    };
+    // Check fraud velocity limits, counting the redemption under its key
+    const counted = this.redeemGuard
+      ? await this.redeemGuard.check({
+          userId: request.userId,
+          amount: request.amount,
+          idempotencyKey,
+          deviceId: request.deviceId,
+          overrideBy: request.overrideBy,
+          requestId: request.requestId,
+        })
+      : false;
     
-    const escrowResponse = await this.walletService.holdInEscrow(escrowRequest);
+    let escrowResponse: EscrowHoldResponse;
+    try {
+      // Check balance if enabled
+      if (this.config.validateBalance) {
+        const balance = await this.walletService.getUserBalance(request.userId);
+        if (balance.available < request.amount) {
+          throw new Error(
+            `Insufficient balance. Required: ${request.amount}, Available: ${balance.available}`
+          );
+        }
+      }
+      
+      // Hold in escrow via wallet service
+      const escrowRequest: EscrowHoldRequest = {
+        userId: request.userId,
+        amount: request.amount,
+        reason: request.reason,
+        queueItemId: request.queueItemId,
+        featureType: request.featureType,
+        idempotencyKey,
+        requestId: request.requestId,
+        metadata: {
+          ...request.metadata,
+          modelId: request.modelId,
+          deviceId: request.deviceId,
+        },
+      };
+      
+      escrowResponse = await this.walletService.holdInEscrow(escrowRequest);
+    } catch (error) {
+      // Only a hold that was created stays counted against the velocity window
+      if (counted) {
+        this.redeemGuard!.release(request.userId, idempotencyKey);
+      }
+      throw error;
+    }
     
     return {
       transactionId: escrowResponse.transactionId,
@@ -170,6 +208,7 @@ export class PointRedemptionService {
       escrowBalance: escrowResponse.escrowBalance,
       queueItemId: request.queueItemId,
       timestamp: escrowResponse.timestamp,
+      streamVersion: escrowResponse.streamVersion,
     };
   }
   
@@ -344,7 +383,8 @@ export class PointRedemptionService {
  */
 export function createPointRedemptionService(
   walletService: IWalletService,
-  config?: Partial<PointRedemptionConfig>
+  config?: Partial<PointRedemptionConfig>,
+  redeemGuard?: RedeemGuard
 ): PointRedemptionService {
-  return new PointRedemptionService(walletService, config);
+  return new PointRedemptionService(walletService, config, redeemGuard);
 }
@@ -0,0 +1,228 @@
+/**
+ * Redeem Guard Tests
+ *
+ * Tests for redemption velocity limits, ledger-derived window state,
+ * and operator overrides.
+ */
+
+import { RedeemGuard, RedemptionVelocityRule } from './redeem-guard.service';
+import { RedemptionVelocityError, UnauthorizedCommitterError } from './types';
+import { ILedgerService } from '../ledger/types';
+import { TransactionReason } from '../wallets/types';
+import { RedemptionVelocityDecisionModel } from '../db/models/redemption-velocity-decision.model';
+
+jest.mock('../db/models/redemption-velocity-decision.model');
+
+describe('RedeemGuard', () => {
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+
+  let sequence = 0;
+
+  const redemptionEntry = (amount: number, deviceId?: string, reason = TransactionReason.CHIP_MENU_PURCHASE) => ({
+    entryId: `entry-${++sequence}`,
+    idempotencyKey: `redemption-user-123-queue-${sequence}_debit`,
+    accountId: 'user-123',
+    amount: -amount,
+    reason,
+    timestamp: new Date(),
+    metadata: deviceId ? { deviceId } : {},
+  });
+
+  const mockLedgerWindow = (entries: any[]) => {
+    mockLedgerService.queryEntries.mockResolvedValue({
+      entries,
+      totalCount: entries.length,
+      offset: 0,
+      limit: 1000,
+      hasMore: false,
+    });
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    (RedemptionVelocityDecisionModel.create as jest.Mock).mockResolvedValue({});
+    mockLedgerService = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn(),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+  });
+
+  it('should allow a redemption within all limits', async () => {
+    mockLedgerWindow([redemptionEntry(100)]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000 });
+
+    await expect(guard.check({ userId: 'user-123', amount: 100, idempotencyKey: 'redemption-new' })).resolves.toBe(true);
+  });
+
+  it('should block when the points total exceeds the window limit', async () => {
+    mockLedgerWindow([redemptionEntry(900)]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000 });
+
+    const error = await guard.check({ userId: 'user-123', amount: 200, idempotencyKey: 'redemption-new' }).catch(e => e);
+
+    expect(error).toBeInstanceOf(RedemptionVelocityError);
+    expect(error.details.rule).toBe(RedemptionVelocityRule.MAX_POINTS);
+    expect(error.details.observed).toBe(1100);
+  });
+
+  it('should block when the redemption count exceeds the window limit', async () => {
+    mockLedgerWindow([redemptionEntry(1), redemptionEntry(1)]);
+    const guard = new RedeemGuard(mockLedgerService, { maxRedemptionsPerWindow: 2 });
+
+    const error = await guard.check({ userId: 'user-123', amount: 1, idempotencyKey: 'redemption-new' }).catch(e => e);
+
+    expect(error.details.rule).toBe(RedemptionVelocityRule.MAX_REDEMPTIONS);
+  });
+
+  it('should block when too many distinct devices are used', async () => {
+    mockLedgerWindow([redemptionEntry(1, 'device-a'), redemptionEntry(1, 'device-b')]);
+    const guard = new RedeemGuard(mockLedgerService, { maxDistinctDevices: 2 });
+
+    const error = await guard.check({ userId: 'user-123', amount: 1, idempotencyKey: 'redemption-new', deviceId: 'device-c' }).catch(e => e);
+
+    expect(error.details.rule).toBe(RedemptionVelocityRule.MAX_DISTINCT_DEVICES);
+  });
+
+  it('should ignore non-redemption debits when deriving the window', async () => {
+    mockLedgerWindow([redemptionEntry(5000, undefined, TransactionReason.POINT_EXPIRY)]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000 });
+
+    await expect(guard.check({ userId: 'user-123', amount: 100, idempotencyKey: 'redemption-new' })).resolves.toBe(true);
+  });
+
+  it('should count an allowed redemption in the in-memory window', async () => {
+    mockLedgerWindow([]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000 });
+
+    await expect(guard.check({ userId: 'user-123', amount: 600, idempotencyKey: 'redemption-1' })).resolves.toBe(true);
+
+    await expect(guard.check({ userId: 'user-123', amount: 600, idempotencyKey: 'redemption-2' })).rejects.toThrow(
+      RedemptionVelocityError
+    );
+    expect(mockLedgerService.queryEntries).toHaveBeenCalledTimes(1);
+  });
+
+  it('should let only one of two concurrent redemptions take the last slot', async () => {
+    mockLedgerWindow([]);
+    const guard = new RedeemGuard(mockLedgerService, { maxRedemptionsPerWindow: 1 });
+
+    const results = await Promise.allSettled([
+      guard.check({ userId: 'user-123', amount: 1, idempotencyKey: 'redemption-1' }),
+      guard.check({ userId: 'user-123', amount: 1, idempotencyKey: 'redemption-2' }),
+    ]);
+
+    expect(results.map(result => result.status)).toEqual(['fulfilled', 'rejected']);
+  });
+
+  it('should not count a replayed redemption twice', async () => {
+    mockLedgerWindow([redemptionEntry(600)]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000 });
+
+    await expect(
+      guard.check({ userId: 'user-123', amount: 600, idempotencyKey: `redemption-user-123-queue-${sequence}` })
+    ).resolves.toBe(false);
+    await expect(guard.check({ userId: 'user-123', amount: 400, idempotencyKey: 'redemption-new' })).resolves.toBe(true);
+  });
+
+  it('should free the slot of a released redemption', async () => {
+    mockLedgerWindow([]);
+    const guard = new RedeemGuard(mockLedgerService, { maxRedemptionsPerWindow: 1 });
+
+    await guard.check({ userId: 'user-123', amount: 1, idempotencyKey: 'redemption-1' });
+    guard.release('user-123', 'redemption-1');
+
+    await expect(guard.check({ userId: 'user-123', amount: 1, idempotencyKey: 'redemption-2' })).resolves.toBe(true);
+  });
+
+  it('should re-read the window to pick up other instances\' redemptions', async () => {
+    mockLedgerWindow([]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000, resyncIntervalMs: 0 });
+
+    await guard.check({ userId: 'user-123', amount: 100, idempotencyKey: 'redemption-1' });
+    mockLedgerWindow([redemptionEntry(900)]);
+
+    const error = await guard.check({ userId: 'user-123', amount: 50, idempotencyKey: 'redemption-2' }).catch(e => e);
+
+    expect(error).toBeInstanceOf(RedemptionVelocityError);
+    expect(error.details.observed).toBe(1050);
+    expect(mockLedgerService.queryEntries).toHaveBeenCalledTimes(2);
+  });
+
+  it('should allow the authenticated designated operator to override a block', async () => {
+    mockLedgerWindow([redemptionEntry(900)]);
+    const guard = new RedeemGuard(mockLedgerService, {
+      maxPointsPerWindow: 1000,
+      overrideOperatorIds: ['ops-1'],
+      authenticatedPrincipal: () => 'ops-1',
+    });
+
+    await expect(
+      guard.check({ userId: 'user-123', amount: 200, idempotencyKey: 'redemption-new', overrideBy: 'ops-1' })
+    ).resolves.toBe(true);
+    expect(RedemptionVelocityDecisionModel.create).toHaveBeenCalledWith(
+      expect.objectContaining({ userId: 'user-123', decision: 'overridden', rule: RedemptionVelocityRule.MAX_POINTS, overrideBy: 'ops-1' })
+    );
+  });
+
+  it('should reject an override naming someone other than the authenticated caller', async () => {
+    mockLedgerWindow([redemptionEntry(900)]);
+    const guard = new RedeemGuard(mockLedgerService, {
+      maxPointsPerWindow: 1000,
+      overrideOperatorIds: ['ops-1'],
+      authenticatedPrincipal: () => 'user-123',
+    });
+
+    await expect(
+      guard.check({ userId: 'user-123', amount: 200, idempotencyKey: 'redemption-new', overrideBy: 'ops-1' })
+    ).rejects.toThrow(UnauthorizedCommitterError);
+  });
+
+  it('should refuse overrides when no authenticated caller is configured', async () => {
+    mockLedgerWindow([redemptionEntry(900)]);
+    const guard = new RedeemGuard(mockLedgerService, {
+      maxPointsPerWindow: 1000,
+      overrideOperatorIds: ['ops-1'],
+    });
+
+    await expect(
+      guard.check({ userId: 'user-123', amount: 200, idempotencyKey: 'redemption-new', overrideBy: 'ops-1' })
+    ).rejects.toThrow(UnauthorizedCommitterError);
+  });
+
+  it('should not honour overrides from non-designated identities', async () => {
+    mockLedgerWindow([redemptionEntry(900)]);
+    const guard = new RedeemGuard(mockLedgerService, {
+      maxPointsPerWindow: 1000,
+      overrideOperatorIds: ['ops-1'],
+      authenticatedPrincipal: () => 'someone-else',
+    });
+
+    await expect(
+      guard.check({ userId: 'user-123', amount: 200, idempotencyKey: 'redemption-new', overrideBy: 'someone-else' })
+    ).rejects.toThrow(RedemptionVelocityError);
+  });
+
+  it('should record each block for audit', async () => {
+    mockLedgerWindow([redemptionEntry(900)]);
+    const guard = new RedeemGuard(mockLedgerService, { maxPointsPerWindow: 1000 });
+
+    await guard.check({ userId: 'user-123', amount: 200, idempotencyKey: 'redemption-new', requestId: 'req-1' }).catch(() => undefined);
+
+    expect(RedemptionVelocityDecisionModel.create).toHaveBeenCalledWith(
+      expect.objectContaining({
+        decision: 'blocked',
+        rule: RedemptionVelocityRule.MAX_POINTS,
+        limit: 1000,
+        observed: 1100,
+        idempotencyKey: 'redemption-new',
+        requestId: 'req-1',
+      })
+    );
+  });
+});
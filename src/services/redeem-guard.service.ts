@@ -0,0 +1,462 @@
+/**
+ * Redeem Guard
+ *
+ * Fraud velocity protection for redemptions. Blocks a user's redemptions
+ * (never earns) when they exceed a points total, a redemption count, or a
+ * number of distinct devices inside a sliding window.
+ *
+ * A block can be overridden only by an operator in overrideOperatorIds,
+ * and only when that operator is the authenticated caller:
+ * authenticatedPrincipal is read during the check, and a request whose
+ * overrideBy names anyone else is rejected. Every block and every
+ * override is recorded in RedemptionVelocityDecisionModel for audit.
+ *
+ * Window state is derived from the ledger: the first time a user is seen,
+ * and again every resyncIntervalMs, their redemptions in the window are
+ * read back, so limits survive restarts and pick up redemptions made by
+ * other instances. Between reads the in-memory window is authoritative
+ * for this process. check() counts the redemption under its idempotency
+ * key without yielding between the limit check and the reservation, so
+ * concurrent redemptions cannot both take the last slot, and a replayed
+ * key is not counted twice. A redemption whose hold fails is released.
+ *
+ * @module services/redeem-guard
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import { TransactionType, REDEMPTION_REASONS } from '../wallets/types';
+import { RedemptionVelocityError, UnauthorizedCommitterError } from './types';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+import {
+  RedemptionVelocityDecisionModel,
+  RedemptionVelocityDecision,
+} from '../db/models/redemption-velocity-decision.model';
+
+/**
+ * Velocity rules that can block a redemption
+ */
+export enum RedemptionVelocityRule {
+  /** Total points redeemed within the window */
+  MAX_POINTS = 'max_points',
+
+  /** Number of redemptions within the window */
+  MAX_REDEMPTIONS = 'max_redemptions',
+
+  /** Number of distinct device references within the window */
+  MAX_DISTINCT_DEVICES = 'max_distinct_devices',
+}
+
+/**
+ * Redemption about to be attempted
+ */
+export interface RedeemGuardCheck {
+  /** User redeeming */
+  userId: string;
+
+  /** Amount being redeemed */
+  amount: number;
+
+  /** Idempotency key of the redemption, under which it is counted */
+  idempotencyKey: string;
+
+  /** Device reference the redemption originates from */
+  deviceId?: string;
+
+  /** Operator requesting a velocity override; must be the authenticated caller */
+  overrideBy?: string;
+
+  /** Request ID for tracing */
+  requestId?: string;
+}
+
+/**
+ * Configuration for the redeem guard
+ */
+export interface RedeemGuardConfig {
+  /** Sliding window length in milliseconds */
+  windowMs: number;
+
+  /** Maximum points redeemable within the window */
+  maxPointsPerWindow: number;
+
+  /** Maximum redemptions within the window */
+  maxRedemptionsPerWindow: number;
+
+  /** Maximum distinct device references within the window */
+  maxDistinctDevices: number;
+
+  /** Operator identities allowed to override a velocity block */
+  overrideOperatorIds: string[];
+
+  /** How often a user's window is re-read from the ledger */
+  resyncIntervalMs: number;
+
+  /** Authenticated caller of the current redemption (overrides are refused when unset) */
+  authenticatedPrincipal?: () => string | undefined;
+}
+
+const DEFAULT_CONFIG: RedeemGuardConfig = {
+  windowMs: 3600000, // 1 hour
+  maxPointsPerWindow: 50000,
+  maxRedemptionsPerWindow: 20,
+  maxDistinctDevices: 3,
+  overrideOperatorIds: [],
+  resyncIntervalMs: 60 * 1000,
+};
+
+/**
+ * Suffix the wallet service gives the available-balance debit of an
+ * escrow hold, stripped to recover the redemption's idempotency key
+ */
+const HOLD_DEBIT_SUFFIX = '_debit';
+
+/**
+ * A single redemption inside a user's window
+ */
+interface WindowedRedemption {
+  timestamp: number;
+  amount: number;
+  deviceId?: string;
+  idempotencyKey: string;
+}
+
+/**
+ * In-memory window for one user
+ */
+interface UserWindow {
+  /** Counted redemptions, oldest first */
+  redemptions: WindowedRedemption[];
+  keys: Set<string>;
+  syncedAt: number;
+}
+
+/**
+ * A velocity rule the redemption would break
+ */
+interface VelocityViolation {
+  rule: RedemptionVelocityRule;
+  limit: number;
+  observed: number;
+}
+
+/**
+ * Redeem Guard Implementation
+ */
+export class RedeemGuard {
+  private config: RedeemGuardConfig;
+  private ledgerService: ILedgerService;
+  private windows: Map<string, UserWindow> = new Map();
+  private loading: Map<string, Promise<UserWindow>> = new Map();
+
+  constructor(
+    ledgerService: ILedgerService,
+    config: Partial<RedeemGuardConfig> = {}
+  ) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Check a redemption against all velocity rules and count it
+   * A key already counted in the window is a replay and passes uncounted.
+   *
+   * @param check Redemption about to be attempted
+   * @returns Whether the redemption was counted, and so must be released
+   *          if its hold is not created
+   * @throws UnauthorizedCommitterError if overrideBy is not the
+   *         authenticated caller
+   * @throws RedemptionVelocityError with the triggering rule
+   */
+  async check(check: RedeemGuardCheck): Promise<boolean> {
+    const overrideBy = this.overrideOf(check);
+    const window = await this.windowFor(check.userId);
+    const now = Date.now();
+    this.prune(window, now);
+
+    // Replays of a counted redemption are left to hold idempotency
+    if (window.keys.has(check.idempotencyKey)) {
+      return false;
+    }
+
+    const violation = this.violationOf(window, check);
+    if (!violation) {
+      this.reserve(window, check, now);
+      return true;
+    }
+
+    if (overrideBy && this.config.overrideOperatorIds.includes(overrideBy)) {
+      // Reserved before the audit write yields; released if it fails
+      this.reserve(window, check, now);
+      try {
+        await this.recordDecision('overridden', check, violation, overrideBy);
+      } catch (error) {
+        this.release(check.userId, check.idempotencyKey);
+        throw error;
+      }
+
+      MetricsLogger.incrementCounter(MetricEventType.REDEMPTION_VELOCITY_OVERRIDE, {
+        userId: check.userId,
+        rule: violation.rule,
+        limit: violation.limit,
+        observed: violation.observed,
+        overrideBy,
+        requestId: check.requestId,
+      });
+      return true;
+    }
+
+    MetricsLogger.incrementCounter(MetricEventType.REDEMPTION_VELOCITY_BLOCKED, {
+      userId: check.userId,
+      rule: violation.rule,
+      limit: violation.limit,
+      observed: violation.observed,
+      requestId: check.requestId,
+    });
+    MetricsLogger.logAlert({
+      severity: AlertSeverity.WARNING,
+      message: `Redemption blocked by velocity rule ${violation.rule}`,
+      metricType: MetricEventType.REDEMPTION_VELOCITY_BLOCKED,
+      timestamp: new Date(now),
+      metadata: {
+        userId: check.userId,
+        rule: violation.rule,
+        requestId: check.requestId,
+      },
+    });
+
+    // A lost audit record never turns a block into a different error
+    try {
+      await this.recordDecision('blocked', check, violation);
+    } catch {
+      // The block has already been logged as an alert
+    }
+
+    throw new RedemptionVelocityError(
+      check.userId,
+      violation.rule,
+      violation.limit,
+      violation.observed
+    );
+  }
+
+  /**
+   * Drop a counted redemption whose hold was not created
+   */
+  release(userId: string, idempotencyKey: string): void {
+    const window = this.windows.get(userId);
+    if (!window || !window.keys.delete(idempotencyKey)) {
+      return;
+    }
+    window.redemptions = window.redemptions.filter(r => r.idempotencyKey !== idempotencyKey);
+  }
+
+  /**
+   * Drop a user's cached window so it is re-derived from the ledger
+   */
+  invalidate(userId: string): void {
+    this.windows.delete(userId);
+  }
+
+  /**
+   * The rule the redemption would break, if any
+   */
+  private violationOf(window: UserWindow, check: RedeemGuardCheck): VelocityViolation | null {
+    const totalPoints = window.redemptions.reduce((sum, r) => sum + r.amount, 0) + check.amount;
+    const redemptionCount = window.redemptions.length + 1;
+    const devices = new Set(
+      window.redemptions.map(r => r.deviceId).filter((d): d is string => !!d)
+    );
+    if (check.deviceId) {
+      devices.add(check.deviceId);
+    }
+
+    if (totalPoints > this.config.maxPointsPerWindow) {
+      return {
+        rule: RedemptionVelocityRule.MAX_POINTS,
+        limit: this.config.maxPointsPerWindow,
+        observed: totalPoints,
+      };
+    }
+    if (redemptionCount > this.config.maxRedemptionsPerWindow) {
+      return {
+        rule: RedemptionVelocityRule.MAX_REDEMPTIONS,
+        limit: this.config.maxRedemptionsPerWindow,
+        observed: redemptionCount,
+      };
+    }
+    if (devices.size > this.config.maxDistinctDevices) {
+      return {
+        rule: RedemptionVelocityRule.MAX_DISTINCT_DEVICES,
+        limit: this.config.maxDistinctDevices,
+        observed: devices.size,
+      };
+    }
+    return null;
+  }
+
+  /**
+   * Count a redemption in the user's window
+   */
+  private reserve(window: UserWindow, check: RedeemGuardCheck, now: number): void {
+    window.redemptions.push({
+      timestamp: now,
+      amount: check.amount,
+      deviceId: check.deviceId,
+      idempotencyKey: check.idempotencyKey,
+    });
+    window.keys.add(check.idempotencyKey);
+  }
+
+  /**
+   * Persist a block or override for audit
+   */
+  private async recordDecision(
+    decision: RedemptionVelocityDecision,
+    check: RedeemGuardCheck,
+    violation: VelocityViolation,
+    overrideBy?: string
+  ): Promise<void> {
+    await RedemptionVelocityDecisionModel.create({
+      decisionId: uuidv4(),
+      userId: check.userId,
+      decision,
+      rule: violation.rule,
+      limit: violation.limit,
+      observed: violation.observed,
+      amount: check.amount,
+      deviceId: check.deviceId,
+      overrideBy,
+      idempotencyKey: check.idempotencyKey,
+      requestId: check.requestId,
+    });
+  }
+
+  /**
+   * The operator overriding the check, if any
+   *
+   * @throws UnauthorizedCommitterError if overrideBy is not the
+   *         authenticated caller
+   */
+  private overrideOf(check: RedeemGuardCheck): string | undefined {
+    if (check.overrideBy === undefined) {
+      return undefined;
+    }
+
+    const principal = this.config.authenticatedPrincipal?.();
+    if (!principal || check.overrideBy !== principal) {
+      throw new UnauthorizedCommitterError(check.overrideBy);
+    }
+    return principal;
+  }
+
+  /**
+   * Return a user's window, reading it from the ledger when unseen or
+   * due for resync
+   */
+  private async windowFor(userId: string): Promise<UserWindow> {
+    const current = this.windows.get(userId);
+    if (current && Date.now() - current.syncedAt < this.config.resyncIntervalMs) {
+      return current;
+    }
+
+    // Concurrent checks for the same user share one ledger read
+    let pending = this.loading.get(userId);
+    if (!pending) {
+      pending = this.loadWindow(userId).finally(() => this.loading.delete(userId));
+      this.loading.set(userId, pending);
+    }
+
+    return pending;
+  }
+
+  /**
+   * Rebuild a user's window from the ledger
+   * Redemptions counted since the previous read that the ledger does not
+   * show yet are carried over, so in-flight holds stay counted.
+   */
+  private async loadWindow(userId: string): Promise<UserWindow> {
+    const startedAt = Date.now();
+    const redemptions = await this.deriveWindowFromLedger(
+      userId,
+      new Date(startedAt - this.config.windowMs)
+    );
+
+    const previous = this.windows.get(userId);
+    if (previous) {
+      const recorded = new Set(redemptions.map(r => r.idempotencyKey));
+      for (const redemption of previous.redemptions) {
+        if (redemption.timestamp >= previous.syncedAt && !recorded.has(redemption.idempotencyKey)) {
+          redemptions.push(redemption);
+        }
+      }
+      redemptions.sort((a, b) => a.timestamp - b.timestamp);
+    }
+
+    const window: UserWindow = {
+      redemptions,
+      keys: new Set(redemptions.map(r => r.idempotencyKey)),
+      syncedAt: startedAt,
+    };
+
+    this.windows.set(userId, window);
+    return window;
+  }
+
+  /**
+   * Drop redemptions that have slid out of the window
+   */
+  private prune(window: UserWindow, now: number): void {
+    const windowStart = now - this.config.windowMs;
+    while (window.redemptions.length > 0 && window.redemptions[0].timestamp <= windowStart) {
+      window.keys.delete(window.redemptions.shift()!.idempotencyKey);
+    }
+  }
+
+  /**
+   * Read a user's redemption debits in the window from the ledger
+   */
+  private async deriveWindowFromLedger(userId: string, since: Date): Promise<WindowedRedemption[]> {
+    const entries: LedgerEntry[] = [];
+    let offset = 0;
+    let hasMore = true;
+
+    while (hasMore) {
+      const result = await this.ledgerService.queryEntries({
+        accountId: userId,
+        accountType: 'user',
+        type: TransactionType.DEBIT,
+        balanceState: 'available',
+        startDate: since,
+        offset,
+        limit: 1000,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+      });
+      entries.push(...result.entries);
+      offset += result.entries.length;
+      hasMore = result.hasMore && result.entries.length > 0;
+    }
+
+    return entries
+      .filter(entry => REDEMPTION_REASONS.includes(entry.reason))
+      .map(entry => ({
+        timestamp: new Date(entry.timestamp).getTime(),
+        amount: Math.abs(entry.amount),
+        deviceId: entry.metadata?.deviceId,
+        idempotencyKey: entry.idempotencyKey.endsWith(HOLD_DEBIT_SUFFIX)
+          ? entry.idempotencyKey.slice(0, -HOLD_DEBIT_SUFFIX.length)
+          : entry.idempotencyKey,
+      }));
+  }
+}
+
+/**
+ * Factory function to create a redeem guard
+ */
+export function createRedeemGuard(
+  ledgerService: ILedgerService,
+  config?: Partial<RedeemGuardConfig>
+): RedeemGuard {
+  return new RedeemGuard(ledgerService, config);
+}
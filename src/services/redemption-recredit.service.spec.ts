@@ -0,0 +1,278 @@
+/**
+ * Redemption Re-credit Service Tests
+ */
+
+import { RedemptionRecreditService } from './redemption-recredit.service';
+import { RedemptionAlreadyRecreditedError, ReferenceAlreadyRecreditedError } from './types';
+import { EscrowItemModel } from '../db/models/escrow-item.model';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/escrow-item.model');
+jest.mock('../wallets/wallet-application');
+
+describe('RedemptionRecreditService', () => {
+  let service: RedemptionRecreditService;
+  let mockLedgerService: {
+    createEntryWithResult: jest.Mock;
+    getAuditTrail: jest.Mock;
+    getBalanceSnapshot: jest.Mock;
+    getByReference: jest.Mock;
+  };
+  let entries: any[];
+  let appliedKeys: Set<string>;
+
+  const redemption = (overrides: Record<string, any> = {}) => ({
+    entryId: 'entry-redeem',
+    transactionId: 'tx-redeem',
+    accountId: 'user-1',
+    accountType: 'user',
+    amount: -300,
+    type: TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: 'available→escrow',
+    reason: TransactionReason.CHIP_MENU_PURCHASE,
+    idempotencyKey: 'redemption-user-1-queue-1_debit',
+    queueItemId: 'queue-1',
+    featureType: 'chip_menu',
+    timestamp: new Date(),
+    ...overrides,
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    entries = [redemption(), { ...redemption(), entryId: 'entry-escrow', amount: 300, type: TransactionType.CREDIT, balanceState: 'escrow' }];
+
+    mockLedgerService = {
+      getAuditTrail: jest.fn().mockImplementation(async (transactionId: string) =>
+        entries
+          .filter(e => e.transactionId === transactionId)
+          .map(e => ({ auditId: e.entryId, ledgerEntry: e, auditedAt: e.timestamp }))
+      ),
+      getBalanceSnapshot: jest.fn().mockResolvedValue({ availableBalance: 200 }),
+      getByReference: jest.fn().mockImplementation(async (reference: string, options: any) => {
+        const matching = entries.filter(e => e.correlationId === reference);
+        const page = matching.slice(options.offset, options.offset + options.limit);
+        return { entries: page, hasMore: options.offset + page.length < matching.length };
+      }),
+      // Unique idempotency key index: the first insert wins, later calls replay it
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const entry = { entryId: `entry-${entries.length + 1}`, timestamp: new Date(), ...request };
+        entries.push(entry);
+        return { entry, inserted: true };
+      }),
+    };
+    (EscrowItemModel.findOne as jest.Mock).mockResolvedValue(null);
+    appliedKeys = new Set();
+    // One application per key, as the wallet_applications unique index enforces
+    (applyWalletDelta as jest.Mock).mockImplementation(async (_userId: string, _delta: number, key: string) => {
+      if (appliedKeys.has(key)) {
+        return false;
+      }
+      appliedKeys.add(key);
+      return true;
+    });
+
+    service = new RedemptionRecreditService(mockLedgerService as any);
+  });
+
+  it('should credit the redeemed amount back, linked to the redemption', async () => {
+    const entry = await service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'provider timeout');
+
+    expect(entry).toMatchObject({
+      accountId: 'user-1',
+      amount: 300,
+      type: TransactionType.CREDIT,
+      reason: TransactionReason.REDEMPTION_RECREDIT,
+      idempotencyKey: 'redemption-recredit-tx-redeem',
+      correlationId: 'recredit-tx-redeem',
+      balanceBefore: 200,
+      balanceAfter: 500,
+      queueItemId: 'queue-1',
+      metadata: {
+        recreditOf: 'tx-redeem',
+        originalEntryId: 'entry-redeem',
+        recreditReason: 'provider timeout',
+        committedBy: 'svc:fulfillment',
+      },
+    });
+    expect(applyWalletDelta).toHaveBeenCalledWith('user-1', 300, 'redemption-recredit-tx-redeem');
+  });
+
+  it('should reject a second re-credit of the same redemption', async () => {
+    const first = await service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'provider timeout');
+
+    const second = service.recreditRedemption('tx-redeem', 'ops:alice', 'retry');
+
+    await expect(second).rejects.toThrow(RedemptionAlreadyRecreditedError);
+    await expect(second).rejects.toMatchObject({
+      details: { transactionId: 'tx-redeem', recreditTransactionId: first.transactionId },
+    });
+    expect(appliedKeys).toEqual(new Set(['redemption-recredit-tx-redeem']));
+  });
+
+  it('should complete a re-credit whose wallet update did not land', async () => {
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'provider timeout')).rejects.toThrow(
+      'connection reset'
+    );
+
+    const entry = await service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'provider timeout');
+
+    expect(entry.idempotencyKey).toBe('redemption-recredit-tx-redeem');
+    await expect(mockLedgerService.createEntryWithResult.mock.results[1].value).resolves.toMatchObject({
+      inserted: false,
+    });
+    expect(appliedKeys).toEqual(new Set(['redemption-recredit-tx-redeem']));
+  });
+
+  it.each(['held', 'settling', 'refunding', 'refunded'])('should refuse a redemption whose escrow is %s', async status => {
+    entries = [redemption({ escrowId: 'escrow-1' })];
+    (EscrowItemModel.findOne as jest.Mock).mockResolvedValue({ escrowId: 'escrow-1', status });
+
+    await expect(service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'x')).rejects.toThrow(
+      `escrow is ${status}`
+    );
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+  });
+
+  it('should re-credit a redemption whose escrow settled', async () => {
+    entries = [redemption({ escrowId: 'escrow-1' })];
+    (EscrowItemModel.findOne as jest.Mock).mockResolvedValue({ escrowId: 'escrow-1', status: 'settled' });
+
+    await expect(service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'x')).resolves.toMatchObject({ amount: 300 });
+  });
+
+  it('should reject transactions that are not redemptions', async () => {
+    entries = [redemption({ transactionId: 'tx-earn', amount: 100, type: TransactionType.CREDIT, reason: TransactionReason.PROMOTIONAL_AWARD })];
+
+    await expect(service.recreditRedemption('tx-earn', 'svc:fulfillment', 'x')).rejects.toThrow('Redemption not found');
+    await expect(service.recreditRedemption('tx-missing', 'svc:fulfillment', 'x')).rejects.toThrow('Redemption not found');
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+  });
+
+  it('should reject redemptions past the grace period', async () => {
+    service = new RedemptionRecreditService(mockLedgerService as any, { gracePeriodMs: 60 * 60 * 1000 });
+    entries = [redemption({ timestamp: new Date(Date.now() - 2 * 60 * 60 * 1000) })];
+
+    await expect(service.recreditRedemption('tx-redeem', 'svc:fulfillment', 'x')).rejects.toThrow('grace period');
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+  });
+
+  it('should require committedBy and reason', async () => {
+    await expect(service.recreditRedemption('tx-redeem', '', 'x')).rejects.toThrow('required');
+    await expect(service.recreditRedemption('tx-redeem', 'svc:fulfillment', '')).rejects.toThrow('required');
+  });
+
+  describe('recreditReference', () => {
+    const batched = (transactionId: string, accountId: string, amount: number) =>
+      redemption({ entryId: `entry-${transactionId}`, transactionId, accountId, amount, correlationId: 'batch-7', idempotencyKey: `${transactionId}_debit` });
+
+    beforeEach(() => {
+      entries = [
+        batched('tx-1', 'user-1', -300),
+        batched('tx-2', 'user-1', -50),
+        batched('tx-3', 'user-2', -120),
+        { ...batched('tx-1', 'user-1', 300), entryId: 'entry-tx-1-escrow', type: TransactionType.CREDIT, balanceState: 'escrow' },
+      ];
+    });
+
+    it('should re-credit every redemption under the reference as one batch', async () => {
+      const recredits = await service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage');
+
+      expect(recredits.map(e => [e.accountId, e.amount, e.balanceBefore, e.balanceAfter])).toEqual([
+        ['user-1', 300, 200, 500],
+        ['user-1', 50, 500, 550],
+        ['user-2', 120, 200, 320],
+      ]);
+      for (const entry of recredits) {
+        expect(entry).toMatchObject({
+          transactionId: 'recredit-batch-batch-7',
+          reason: TransactionReason.REDEMPTION_RECREDIT,
+          metadata: { batchReference: 'batch-7', recreditReason: 'warehouse outage', committedBy: 'svc:fulfillment' },
+        });
+      }
+      expect(recredits[0].metadata).toMatchObject({ recreditOf: 'tx-1', originalEntryId: 'entry-tx-1' });
+      expect((applyWalletDelta as jest.Mock).mock.calls).toEqual([
+        ['user-1', 300, 'redemption-recredit-tx-1'],
+        ['user-1', 50, 'redemption-recredit-tx-2'],
+        ['user-2', 120, 'redemption-recredit-tx-3'],
+      ]);
+    });
+
+    it('should reject a second re-credit of the reference', async () => {
+      await service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage');
+
+      const second = service.recreditReference('batch-7', 'ops:alice', 'retry');
+
+      await expect(second).rejects.toThrow(ReferenceAlreadyRecreditedError);
+      await expect(second).rejects.toMatchObject({
+        details: { reference: 'batch-7', recreditTransactionId: 'recredit-batch-batch-7' },
+      });
+      expect(mockLedgerService.createEntryWithResult).toHaveBeenCalledTimes(3);
+      expect(appliedKeys.size).toBe(3);
+    });
+
+    it('should leave out a redemption already re-credited on its own', async () => {
+      await service.recreditRedemption('tx-2', 'ops:alice', 'customer complaint');
+
+      const recredits = await service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage');
+
+      expect(recredits.map(e => e.metadata?.recreditOf)).toEqual(['tx-1', 'tx-3']);
+      expect(appliedKeys).toEqual(
+        new Set(['redemption-recredit-tx-1', 'redemption-recredit-tx-2', 'redemption-recredit-tx-3'])
+      );
+      expect(applyWalletDelta).toHaveBeenCalledTimes(4);
+    });
+
+    it('should finish an interrupted batch, moving each wallet once per entry', async () => {
+      mockLedgerService.createEntryWithResult
+        .mockImplementationOnce(mockLedgerService.createEntryWithResult.getMockImplementation()!)
+        .mockRejectedValueOnce(new Error('connection reset'));
+
+      await expect(service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage')).rejects.toThrow(
+        'connection reset'
+      );
+      expect(appliedKeys).toEqual(new Set(['redemption-recredit-tx-1']));
+
+      const recredits = await service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage');
+
+      expect(recredits.map(e => e.metadata?.recreditOf)).toEqual(['tx-1', 'tx-2', 'tx-3']);
+      expect(appliedKeys.size).toBe(3);
+    });
+
+    it('should credit the wallets an interrupted batch recorded but did not move', async () => {
+      (applyWalletDelta as jest.Mock)
+        .mockImplementationOnce((applyWalletDelta as jest.Mock).getMockImplementation()!)
+        .mockRejectedValueOnce(new Error('connection reset'));
+
+      await expect(service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage')).rejects.toThrow(
+        'connection reset'
+      );
+
+      const recredits = await service.recreditReference('batch-7', 'svc:fulfillment', 'warehouse outage');
+
+      expect(recredits).toHaveLength(3);
+      expect(appliedKeys).toEqual(
+        new Set(['redemption-recredit-tx-1', 'redemption-recredit-tx-2', 'redemption-recredit-tx-3'])
+      );
+    });
+
+    it('should refuse the reference while one of its escrows is held', async () => {
+      entries[2] = { ...entries[2], escrowId: 'escrow-3' };
+      (EscrowItemModel.findOne as jest.Mock).mockResolvedValue({ escrowId: 'escrow-3', status: 'held' });
+
+      await expect(service.recreditReference('batch-7', 'svc:fulfillment', 'x')).rejects.toThrow('escrow is held');
+      expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+    });
+
+    it('should reject a reference without redemptions', async () => {
+      await expect(service.recreditReference('batch-none', 'svc:fulfillment', 'x')).rejects.toThrow('No redemptions');
+      await expect(service.recreditReference('batch-7', '', 'x')).rejects.toThrow('required');
+    });
+  });
+});
@@ -0,0 +1,304 @@
+/**
+ * Redemption Re-credit Service
+ *
+ * Returns a redemption's points to the user when downstream fulfillment
+ * fails, as a first-class operation linked to the original redemption.
+ * The re-credit is a REDEMPTION_RECREDIT credit of the same magnitude
+ * recorded under the deterministic idempotency key
+ * `redemption-recredit-<transactionId>` and the correlation ID
+ * `recredit-<transactionId>`, so the audit trail joins the two.
+ *
+ * The idempotency key is the link: the ledger's unique key index makes it
+ * the atomic claim, so a redemption is re-credited at most once even
+ * under concurrent retries. The wallet is moved with applyWalletDelta
+ * under the same key, so a retry of an attempt interrupted between the
+ * append and the wallet update completes it; once both have landed every
+ * later attempt is rejected with RedemptionAlreadyRecreditedError.
+ *
+ * A redemption whose points went into escrow is only re-credited once
+ * the escrow has settled. While it is held the queue can still settle or
+ * refund it, and a refunded escrow has already returned the points.
+ *
+ * Re-credits are only accepted within a configurable grace period after
+ * the redemption; older failures go through support instead.
+ *
+ * recreditReference re-credits every redemption under a failed batch
+ * reference as one operation. Its entries share the transaction ID
+ * `recredit-batch-<reference>` and use the same per-redemption keys, so a
+ * redemption re-credited on its own is never credited twice. Each entry
+ * is applied to its wallet with applyWalletDelta as it is written, and a
+ * retry re-applies every entry it finds, so an attempt interrupted
+ * part-way is completed by re-running it. Escrowed redemptions must have
+ * settled, as for a single re-credit. Once nothing is left to write or
+ * apply the reference is refused with ReferenceAlreadyRecreditedError.
+ *
+ * @module services/redemption-recredit
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { LedgerEntry, CreateLedgerEntryResult } from '../ledger/types';
+import { LedgerService } from '../ledger/ledger.service';
+import { EscrowItemModel } from '../db/models/escrow-item.model';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import { RedemptionAlreadyRecreditedError, ReferenceAlreadyRecreditedError } from './types';
+import { TransactionType, TransactionReason, REDEMPTION_REASONS } from '../wallets/types';
+
+/**
+ * Configuration for the redemption re-credit service
+ */
+export interface RedemptionRecreditConfig {
+  /** How long after a redemption it may still be re-credited */
+  gracePeriodMs: number;
+
+  /** Currency stamped on re-credit entries */
+  defaultCurrency: string;
+}
+
+const DEFAULT_CONFIG: RedemptionRecreditConfig = {
+  gracePeriodMs: 7 * 24 * 60 * 60 * 1000,
+  defaultCurrency: 'points',
+};
+
+/**
+ * Page size when reading the redemptions under a reference
+ */
+const REFERENCE_PAGE_SIZE = 1000;
+
+type RecreditLedger = Pick<
+  LedgerService,
+  'createEntryWithResult' | 'getAuditTrail' | 'getBalanceSnapshot' | 'getByReference'
+>;
+
+/**
+ * Whether an entry is the available-balance debit of a redemption
+ */
+function isRedemption(entry: LedgerEntry): boolean {
+  return (
+    entry.accountType === 'user' &&
+    entry.type === TransactionType.DEBIT &&
+    entry.balanceState === 'available' &&
+    REDEMPTION_REASONS.includes(entry.reason)
+  );
+}
+
+/**
+ * Redemption Re-credit Service Implementation
+ */
+export class RedemptionRecreditService {
+  private config: RedemptionRecreditConfig;
+  private ledgerService: RecreditLedger;
+
+  constructor(ledgerService: RecreditLedger, config: Partial<RedemptionRecreditConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Re-credit a redemption whose fulfillment failed
+   *
+   * @param originalTransactionId Transaction ID of the redemption
+   * @param committedBy Operator or job recording the re-credit
+   * @param reason Why fulfillment failed
+   * @returns The re-credit entry
+   * @throws RedemptionAlreadyRecreditedError if the redemption was already re-credited
+   * @throws Error if the transaction is not a redemption, is past the grace
+   *   period or its escrow has not settled
+   */
+  async recreditRedemption(
+    originalTransactionId: string,
+    committedBy: string,
+    reason: string
+  ): Promise<LedgerEntry> {
+    if (!originalTransactionId || !committedBy || !reason) {
+      throw new Error('originalTransactionId, committedBy and reason are required');
+    }
+
+    const trail = await this.ledgerService.getAuditTrail(originalTransactionId);
+    const redemption = trail.map(audit => audit.ledgerEntry).find(isRedemption);
+    if (!redemption) {
+      throw new Error(`Redemption not found: ${originalTransactionId}`);
+    }
+    this.assertWithinGracePeriod(redemption);
+    await this.assertEscrowSettled(redemption);
+
+    const snapshot = await this.ledgerService.getBalanceSnapshot(redemption.accountId, 'user');
+
+    const { entry, inserted } = await this.recordRecredit(redemption, uuidv4(), snapshot.availableBalance, {
+      recreditReason: reason,
+      committedBy,
+    });
+
+    // A replay whose wallet update had not landed completes that attempt
+    const applied = await applyWalletDelta(entry.accountId, entry.amount, entry.idempotencyKey);
+    if (!inserted && !applied) {
+      throw new RedemptionAlreadyRecreditedError(originalTransactionId, entry.transactionId);
+    }
+
+    return entry;
+  }
+
+  /**
+   * Re-credit every redemption under a reference whose batch failed
+   * downstream
+   * Redemptions already re-credited on their own are left out.
+   *
+   * @param reference Correlation ID shared by the batch's redemptions
+   * @param committedBy Operator or job recording the re-credits
+   * @param reason Why fulfillment of the batch failed
+   * @returns The batch's re-credit entries, in redemption order
+   * @throws ReferenceAlreadyRecreditedError if nothing under the reference is left to re-credit
+   * @throws Error if the reference has no redemptions, or one is past the
+   *   grace period or has an unsettled escrow
+   */
+  async recreditReference(reference: string, committedBy: string, reason: string): Promise<LedgerEntry[]> {
+    if (!reference || !committedBy || !reason) {
+      throw new Error('reference, committedBy and reason are required');
+    }
+
+    const redemptions = (await this.entriesUnder(reference)).filter(isRedemption);
+    if (redemptions.length === 0) {
+      throw new Error(`No redemptions found under reference ${reference}`);
+    }
+    for (const redemption of redemptions) {
+      this.assertWithinGracePeriod(redemption);
+      await this.assertEscrowSettled(redemption);
+    }
+
+    // Entries left by an interrupted attempt are kept and re-applied; only the missing ones are written
+    const batchTransactionId = `recredit-batch-${reference}`;
+    const recorded = new Map<string, LedgerEntry>();
+    for (const audit of await this.ledgerService.getAuditTrail(batchTransactionId)) {
+      recorded.set(audit.ledgerEntry.metadata?.recreditOf, audit.ledgerEntry);
+    }
+
+    const balances = new Map<string, number>();
+    let written = 0;
+    for (const redemption of redemptions) {
+      let entry = recorded.get(redemption.transactionId);
+      let inserted = false;
+
+      if (!entry) {
+        if (!balances.has(redemption.accountId)) {
+          const snapshot = await this.ledgerService.getBalanceSnapshot(redemption.accountId, 'user');
+          balances.set(redemption.accountId, snapshot.availableBalance);
+        }
+
+        const result = await this.recordRecredit(
+          redemption,
+          batchTransactionId,
+          balances.get(redemption.accountId)!,
+          { recreditReason: reason, committedBy, batchReference: reference }
+        );
+        entry = result.entry;
+        inserted = result.inserted;
+
+        // Replays of another re-credit of the redemption are not this batch's
+        if (inserted) {
+          recorded.set(redemption.transactionId, entry);
+          balances.set(redemption.accountId, entry.balanceAfter);
+        }
+      }
+
+      // Re-applied on every attempt, so wallets an interrupted one missed catch up
+      const applied = await applyWalletDelta(entry.accountId, entry.amount, entry.idempotencyKey);
+      if (inserted || applied) {
+        written++;
+      }
+    }
+
+    // A completed batch, or one a concurrent attempt finished first
+    if (written === 0) {
+      throw new ReferenceAlreadyRecreditedError(reference, batchTransactionId);
+    }
+
+    const entries = redemptions.map(r => recorded.get(r.transactionId)).filter((e): e is LedgerEntry => !!e);
+
+    return entries;
+  }
+
+  /**
+   * Append the re-credit of a redemption under its deterministic key
+   */
+  private recordRecredit(
+    redemption: LedgerEntry,
+    transactionId: string,
+    balanceBefore: number,
+    link: Record<string, string>
+  ): Promise<CreateLedgerEntryResult> {
+    const amount = Math.abs(redemption.amount);
+
+    return this.ledgerService.createEntryWithResult({
+      transactionId,
+      accountId: redemption.accountId,
+      accountType: 'user',
+      amount,
+      type: TransactionType.CREDIT,
+      balanceState: 'available',
+      stateTransition: 'none→available',
+      reason: TransactionReason.REDEMPTION_RECREDIT,
+      idempotencyKey: `redemption-recredit-${redemption.transactionId}`,
+      requestId: `recredit-${redemption.transactionId}`,
+      balanceBefore,
+      balanceAfter: balanceBefore + amount,
+      currency: this.config.defaultCurrency,
+      correlationId: `recredit-${redemption.transactionId}`,
+      queueItemId: redemption.queueItemId,
+      featureType: redemption.featureType,
+      metadata: {
+        recreditOf: redemption.transactionId,
+        originalEntryId: redemption.entryId,
+        ...link,
+      },
+    });
+  }
+
+  /**
+   * Every entry under a reference, read page by page
+   */
+  private async entriesUnder(reference: string): Promise<LedgerEntry[]> {
+    const entries: LedgerEntry[] = [];
+    for (let offset = 0; ; offset += REFERENCE_PAGE_SIZE) {
+      const page = await this.ledgerService.getByReference(reference, { offset, limit: REFERENCE_PAGE_SIZE });
+      entries.push(...page.entries);
+      if (!page.hasMore) {
+        return entries;
+      }
+    }
+  }
+
+  /**
+   * @throws Error if the redemption is past the re-credit grace period
+   */
+  private assertWithinGracePeriod(redemption: LedgerEntry): void {
+    const age = Date.now() - new Date(redemption.timestamp).getTime();
+    if (age > this.config.gracePeriodMs) {
+      throw new Error(`Redemption ${redemption.transactionId} is past the re-credit grace period`);
+    }
+  }
+
+  /**
+   * @throws Error if the redemption's escrow is still open or was refunded
+   */
+  private async assertEscrowSettled(redemption: LedgerEntry): Promise<void> {
+    if (!redemption.escrowId) {
+      return;
+    }
+
+    const escrow = await EscrowItemModel.findOne({ escrowId: { $eq: redemption.escrowId } });
+    if (escrow && escrow.status !== 'settled') {
+      throw new Error(
+        `Redemption ${redemption.transactionId} escrow is ${escrow.status}; only a settled redemption is re-credited`
+      );
+    }
+  }
+}
+
+/**
+ * Factory function to create a redemption re-credit service
+ */
+export function createRedemptionRecreditService(
+  ledgerService: RecreditLedger,
+  config?: Partial<RedemptionRecreditConfig>
+): RedemptionRecreditService {
+  return new RedemptionRecreditService(ledgerService, config);
+}
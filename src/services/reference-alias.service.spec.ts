@@ -0,0 +1,119 @@
+/**
+ * Reference Alias Service Tests
+ */
+
+import { ReferenceAliasService } from './reference-alias.service';
+import { ReferenceAlreadyAliasedError, ReferenceAliasCycleError } from './types';
+import { ReferenceAliasModel } from '../db/models/reference-alias.model';
+
+// Mock mongoose models
+jest.mock('../db/models/reference-alias.model');
+
+describe('ReferenceAliasService', () => {
+  let service: ReferenceAliasService;
+
+  // Alias records in the fake collection
+  let records: { alias: string; canonical: string }[];
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    service = new ReferenceAliasService();
+    records = [];
+
+    (ReferenceAliasModel.findOne as jest.Mock).mockImplementation((query: any) =>
+      Promise.resolve(records.find(record => record.alias === query.alias.$eq) || null)
+    );
+    (ReferenceAliasModel.find as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue(
+        query.canonical ? records.filter(record => query.canonical.$in.includes(record.canonical)) : records
+      ),
+    }));
+    (ReferenceAliasModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      records.push(doc);
+      return doc;
+    });
+  });
+
+  describe('aliasReference', () => {
+    it('should record the alias', async () => {
+      const record = await service.aliasReference('order-1', 'order-1-dup', 'ops-1');
+
+      expect(record).toMatchObject({ alias: 'order-1-dup', canonical: 'order-1', committedBy: 'ops-1' });
+      expect(ReferenceAliasModel.create).toHaveBeenCalledWith(record);
+    });
+
+    it('should reject aliasing a reference twice', async () => {
+      await service.aliasReference('order-1', 'order-dup', 'ops-1');
+
+      await expect(service.aliasReference('order-2', 'order-dup', 'ops-1')).rejects.toThrow(
+        ReferenceAlreadyAliasedError
+      );
+    });
+
+    it('should reject an alias that would close a cycle', async () => {
+      await service.aliasReference('order-b', 'order-a', 'ops-1');
+      await service.aliasReference('order-c', 'order-b', 'ops-1');
+
+      await expect(service.aliasReference('order-a', 'order-c', 'ops-1')).rejects.toThrow(
+        ReferenceAliasCycleError
+      );
+      await expect(service.aliasReference('order-a', 'order-a', 'ops-1')).rejects.toThrow('to itself');
+      expect(records).toHaveLength(2);
+    });
+
+    it('should report the winning alias on a concurrent duplicate', async () => {
+      const duplicateError: any = new Error('Duplicate key');
+      duplicateError.code = 11000;
+      (ReferenceAliasModel.findOne as jest.Mock)
+        .mockResolvedValueOnce(null)
+        .mockResolvedValueOnce(null)
+        .mockResolvedValueOnce({ canonical: 'order-9' });
+      (ReferenceAliasModel.create as jest.Mock).mockRejectedValue(duplicateError);
+
+      await expect(service.aliasReference('order-1', 'order-dup', 'ops-1')).rejects.toMatchObject({
+        code: 'REFERENCE_ALREADY_ALIASED',
+        details: { alias: 'order-dup', canonical: 'order-9' },
+      });
+    });
+  });
+
+  describe('resolution', () => {
+    beforeEach(async () => {
+      // order-a -> order-b -> order-c, plus order-d -> order-c
+      await service.aliasReference('order-b', 'order-a', 'ops-1');
+      await service.aliasReference('order-c', 'order-b', 'ops-1');
+      await service.aliasReference('order-c', 'order-d', 'ops-1');
+    });
+
+    it('should resolve alias chains to the canonical reference', async () => {
+      await expect(service.resolveReference('order-a')).resolves.toBe('order-c');
+      await expect(service.resolveReference('order-x')).resolves.toBe('order-x');
+    });
+
+    it('should expand any member to the whole group, canonical first', async () => {
+      const group = await service.referenceGroup('order-a');
+
+      expect(group[0]).toBe('order-c');
+      expect([...group].sort()).toEqual(['order-a', 'order-b', 'order-c', 'order-d']);
+      await expect(service.referenceGroup('order-x')).resolves.toEqual(['order-x']);
+    });
+
+    it('should map every alias to its canonical reference', async () => {
+      const map = await service.canonicalMap();
+
+      expect(Object.fromEntries(map)).toEqual({
+        'order-a': 'order-c',
+        'order-b': 'order-c',
+        'order-d': 'order-c',
+      });
+    });
+
+    it('should stop on cyclic records instead of looping', async () => {
+      records.push({ alias: 'order-c', canonical: 'order-a' });
+
+      await expect(service.resolveReference('order-a')).rejects.toThrow('too deep');
+      await expect(service.canonicalMap()).rejects.toThrow('too deep');
+    });
+  });
+});
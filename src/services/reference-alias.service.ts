@@ -0,0 +1,178 @@
+/**
+ * Reference Alias Service
+ *
+ * Treats two references (correlation IDs) that upstream assigned to one
+ * event as a single reference, without touching any ledger entry. An
+ * immutable alias record maps the alias to its canonical reference;
+ * LedgerService resolves reference lookups and sums through this map when
+ * the service is passed as its reference resolver.
+ *
+ * Aliasing is transitive: if A is an alias of B and B of C, all three
+ * resolve to C. A new alias is rejected if it would close a cycle, and a
+ * reference can only be aliased once.
+ *
+ * @module services/reference-alias
+ */
+
+import { v4 as uuidv4 } from 'uuid';
+import { IReferenceAliasResolver } from '../ledger/types';
+import { ReferenceAliasModel } from '../db/models/reference-alias.model';
+import { ReferenceAlreadyAliasedError, ReferenceAliasCycleError } from './types';
+
+/**
+ * A recorded reference alias
+ */
+export interface ReferenceAliasRecord {
+  aliasId: string;
+  alias: string;
+  canonical: string;
+  committedBy: string;
+}
+
+/**
+ * Configuration for the reference alias service
+ */
+export interface ReferenceAliasConfig {
+  /** Maximum alias hops followed when resolving a reference */
+  maxAliasDepth: number;
+}
+
+const DEFAULT_CONFIG: ReferenceAliasConfig = {
+  maxAliasDepth: 16,
+};
+
+/**
+ * Reference Alias Service Implementation
+ */
+export class ReferenceAliasService implements IReferenceAliasResolver {
+  private config: ReferenceAliasConfig;
+
+  constructor(config: Partial<ReferenceAliasConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
+  /**
+   * Record that alias names the same event as canonical
+   *
+   * @param canonical Reference the alias resolves to
+   * @param alias Reference to fold into canonical
+   * @param committedBy Operator or service recording the alias
+   * @throws ReferenceAlreadyAliasedError if alias was already aliased
+   * @throws ReferenceAliasCycleError if canonical resolves to alias
+   */
+  async aliasReference(canonical: string, alias: string, committedBy: string): Promise<ReferenceAliasRecord> {
+    if (!canonical || !alias) {
+      throw new Error('Both canonical and alias references are required');
+    }
+
+    if (canonical === alias) {
+      throw new Error('Cannot alias a reference to itself');
+    }
+
+    if (!committedBy) {
+      throw new Error('committedBy is required for reference aliases');
+    }
+
+    const existing = await ReferenceAliasModel.findOne({ alias: { $eq: alias } });
+    if (existing) {
+      throw new ReferenceAlreadyAliasedError(alias, existing.canonical);
+    }
+
+    if ((await this.resolveReference(canonical)) === alias) {
+      throw new ReferenceAliasCycleError(alias, canonical);
+    }
+
+    const record: ReferenceAliasRecord = {
+      aliasId: uuidv4(),
+      alias,
+      canonical,
+      committedBy,
+    };
+
+    // The unique alias index rejects a concurrent alias of the same reference
+    try {
+      await ReferenceAliasModel.create(record);
+    } catch (error: any) {
+      if (error && error.code === 11000) {
+        const winner = await ReferenceAliasModel.findOne({ alias: { $eq: alias } });
+        throw new ReferenceAlreadyAliasedError(alias, winner ? winner.canonical : canonical);
+      }
+      throw error;
+    }
+
+    return record;
+  }
+
+  /**
+   * Resolve a reference through the alias map to its canonical reference
+   * Returns the input unchanged if it was never aliased.
+   */
+  async resolveReference(reference: string): Promise<string> {
+    let current = reference;
+
+    for (let depth = 0; depth < this.config.maxAliasDepth; depth++) {
+      const alias = await ReferenceAliasModel.findOne({ alias: { $eq: current } });
+      if (!alias) {
+        return current;
+      }
+      current = alias.canonical;
+    }
+
+    throw new Error(`Reference alias chain too deep for: ${reference}`);
+  }
+
+  /**
+   * Canonical reference followed by every reference aliased to it
+   */
+  async referenceGroup(reference: string): Promise<string[]> {
+    const canonical = await this.resolveReference(reference);
+    const group = [canonical];
+    const seen = new Set(group);
+    let frontier = group;
+
+    for (let depth = 0; frontier.length > 0; depth++) {
+      if (depth >= this.config.maxAliasDepth) {
+        throw new Error(`Reference alias chain too deep for: ${reference}`);
+      }
+
+      const aliases = await ReferenceAliasModel.find({ canonical: { $in: frontier } }).lean().exec();
+      frontier = aliases.map((record: any) => record.alias).filter((alias: string) => !seen.has(alias));
+      for (const alias of frontier) {
+        seen.add(alias);
+        group.push(alias);
+      }
+    }
+
+    return group;
+  }
+
+  /**
+   * Canonical reference for every aliased reference, from one read of the
+   * alias map
+   */
+  async canonicalMap(): Promise<Map<string, string>> {
+    const records = await ReferenceAliasModel.find({}).lean().exec();
+    const direct = new Map<string, string>(records.map((record: any) => [record.alias, record.canonical]));
+    const resolved = new Map<string, string>();
+
+    for (const alias of direct.keys()) {
+      let current = alias;
+      for (let depth = 0; direct.has(current); depth++) {
+        if (depth >= this.config.maxAliasDepth) {
+          throw new Error(`Reference alias chain too deep for: ${alias}`);
+        }
+        current = direct.get(current)!;
+      }
+      resolved.set(alias, current);
+    }
+
+    return resolved;
+  }
+}
+
+/**
+ * Factory function to create reference alias service
+ */
+export function createReferenceAliasService(config?: Partial<ReferenceAliasConfig>): ReferenceAliasService {
+  return new ReferenceAliasService(config);
+}
@@ -0,0 +1,200 @@
+/**
+ * Reference Budget Guard Tests
+ */
+
+import { ReferenceBudgetGuard } from './reference-budget-guard.service';
+import { ReferenceOverdrawnError } from './types';
+import { ReferenceNetCounterModel } from '../db/models/reference-net-counter.model';
+import { ReferenceNetApplicationModel } from '../db/models/reference-net-application.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { CreateLedgerEntryRequest, LedgerEntry } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/reference-net-counter.model');
+jest.mock('../db/models/reference-net-application.model');
+jest.mock('../db/models/ledger-entry.model');
+
+describe('ReferenceBudgetGuard', () => {
+  // In-memory reference_net_counters and reference_net_applications collections
+  let counters: Map<string, { tenantId?: string; reference: string; net: number }>;
+  let applications: Set<string>;
+  let ledgerRows: any[];
+
+  const tenantOf = (field: any) => (field && field.$eq !== undefined ? field.$eq : undefined);
+  const counterKey = (tenantId: string | undefined, reference: string) => `${tenantId ?? ''}|${reference}`;
+  const applicationKey = (doc: any) =>
+    [doc.tenantId ?? '', doc.reference, doc.idempotencyScope ?? '', doc.idempotencyKey].join('|');
+
+  const request = (idempotencyKey: string, amount: number, reference = 'promo-spring'): CreateLedgerEntryRequest => ({
+    accountId: 'user-123',
+    accountType: 'user',
+    amount,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: amount >= 0 ? 'none→available' : 'available→none',
+    reason: amount >= 0 ? TransactionReason.PROMOTIONAL_AWARD : TransactionReason.CHIP_MENU_PURCHASE,
+    idempotencyKey,
+    requestId: `req-${idempotencyKey}`,
+    balanceBefore: 0,
+    balanceAfter: 0,
+    correlationId: reference,
+  });
+
+  // Runs an append through the guard as the hooked ledger would
+  const append = async (guard: ReferenceBudgetGuard, req: CreateLedgerEntryRequest) => {
+    await guard.beforeAppend(req);
+    const entry = { ...req, entryId: `entry-${req.idempotencyKey}`, transactionId: 'txn', timestamp: new Date() };
+    await guard.afterAppend(entry as LedgerEntry);
+  };
+
+  const net = (reference = 'promo-spring', tenantId?: string) => counters.get(counterKey(tenantId, reference))!.net;
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    counters = new Map();
+    applications = new Set();
+    ledgerRows = [];
+
+    (ReferenceNetCounterModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => {
+        const doc = counters.get(counterKey(tenantOf(query.tenantId), query.reference.$eq));
+        return doc ? { ...doc } : null;
+      }),
+    }));
+    (ReferenceNetCounterModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      const key = counterKey(doc.tenantId, doc.reference);
+      if (counters.has(key)) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      counters.set(key, { ...doc });
+      return doc;
+    });
+    // Applies the conditional increment atomically, as MongoDB would
+    (ReferenceNetCounterModel.updateOne as jest.Mock).mockImplementation(async (filter: any, update: any) => {
+      const doc = counters.get(counterKey(tenantOf(filter.tenantId), filter.reference.$eq));
+      if (!doc || (filter.net !== undefined && doc.net < filter.net.$gte)) {
+        return { modifiedCount: 0 };
+      }
+      doc.net += update.$inc.net;
+      return { modifiedCount: 1 };
+    });
+    (ReferenceNetApplicationModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => {
+        const key = applicationKey({
+          tenantId: tenantOf(query.tenantId),
+          reference: query.reference.$eq,
+          idempotencyScope: tenantOf(query.idempotencyScope),
+          idempotencyKey: query.idempotencyKey.$eq,
+        });
+        return applications.has(key) ? { idempotencyKey: query.idempotencyKey.$eq } : null;
+      }),
+    }));
+    (ReferenceNetApplicationModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (applications.has(applicationKey(doc))) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      applications.add(applicationKey(doc));
+      return doc;
+    });
+    (ReferenceNetApplicationModel.insertMany as jest.Mock).mockImplementation(async (docs: any[]) => {
+      docs.forEach(doc => applications.add(applicationKey(doc)));
+      return docs;
+    });
+    (LedgerEntryModel.aggregate as jest.Mock).mockImplementation((pipeline: any[]) => ({
+      exec: jest.fn().mockImplementation(async () =>
+        ledgerRows.filter(row => row.tenantId === tenantOf(pipeline[0].$match.tenantId))
+      ),
+    }));
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should accept redemptions within the reference earned total, down to zero', async () => {
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+
+    await append(guard, request('earn-1', 300));
+    await append(guard, request('redeem-1', -200));
+    await expect(guard.beforeAppend(request('redeem-2', -100))).resolves.toBeUndefined();
+
+    expect(net()).toBe(0);
+  });
+
+  it('should reject a redemption beyond the reference earned total', async () => {
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+    await append(guard, request('earn-1', 300));
+    await append(guard, request('redeem-1', -250));
+
+    const error = await guard.beforeAppend(request('redeem-2', -80)).catch(e => e);
+
+    expect(error).toBeInstanceOf(ReferenceOverdrawnError);
+    expect(error.code).toBe('REFERENCE_OVERDRAWN');
+    expect(error.details).toEqual({ reference: 'promo-spring', net: 50, amount: -80 });
+    expect(net()).toBe(50);
+    expect(MetricsLogger.incrementCounter).toHaveBeenCalledTimes(1);
+  });
+
+  it('should seed the net from entries already in the ledger', async () => {
+    ledgerRows = [
+      { amount: 200, idempotencyKey: 'old-earn' },
+      { amount: -80, idempotencyKey: 'old-redeem' },
+    ];
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+
+    await expect(guard.beforeAppend(request('redeem-1', -130))).rejects.toThrow(ReferenceOverdrawnError);
+    await expect(guard.beforeAppend(request('redeem-2', -120))).resolves.toBeUndefined();
+    await append(guard, request('old-earn', 200));
+    expect(net()).toBe(0);
+  });
+
+  it('should keep each tenant\'s net apart', async () => {
+    ledgerRows = [{ tenantId: 'tenant-a', amount: 300, idempotencyKey: 'earn-a' }];
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+
+    await expect(guard.beforeAppend({ ...request('redeem-b', -100), tenantId: 'tenant-b' })).rejects.toThrow(
+      ReferenceOverdrawnError
+    );
+    await guard.beforeAppend({ ...request('redeem-a', -100), tenantId: 'tenant-a' });
+
+    expect(net('promo-spring', 'tenant-a')).toBe(200);
+    expect(net('promo-spring', 'tenant-b')).toBe(0);
+  });
+
+  it('should count the same key in another idempotency scope separately', async () => {
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+    await append(guard, request('earn-1', 100));
+
+    await append(guard, { ...request('earn-1', 100), idempotencyScope: 'partner-x' });
+
+    expect(net()).toBe(200);
+  });
+
+  it('should let a replay of a counted debit through and count a credit once', async () => {
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+    await append(guard, request('earn-1', 100));
+    await append(guard, request('earn-1', 100));
+    await append(guard, request('redeem-1', -100));
+
+    await expect(guard.beforeAppend(request('redeem-1', -100))).resolves.toBeUndefined();
+    expect(net()).toBe(0);
+  });
+
+  it('should leave unconstrained references and non-user entries alone', async () => {
+    const guard = new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-'] });
+
+    await expect(guard.beforeAppend(request('redeem-1', -500, 'order-1'))).resolves.toBeUndefined();
+    await expect(guard.beforeAppend({ ...request('redeem-2', -500), accountType: 'model' })).resolves.toBeUndefined();
+    await expect(guard.beforeAppend({ ...request('redeem-3', -500), correlationId: undefined })).resolves.toBeUndefined();
+
+    expect(ReferenceNetCounterModel.findOne).not.toHaveBeenCalled();
+  });
+
+  it('should reject an empty prefix', () => {
+    expect(() => new ReferenceBudgetGuard({ constrainedPrefixes: ['promo-', ''] })).toThrow('must not be empty');
+  });
+});
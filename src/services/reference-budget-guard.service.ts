@@ -0,0 +1,274 @@
+/**
+ * Reference Budget Guard
+ *
+ * Keeps the net of the user entries under a balance-constrained
+ * reference (correlation ID) from going below zero, so a reversible
+ * promotion can never have more redeemed or adjusted away under it than
+ * was earned under it. User-level balance checks do not cover this: a
+ * user may hold enough points overall while the promotion's own points
+ * are spent. A debit that would overdraw its reference is rejected with
+ * ReferenceOverdrawnError; one that takes the net to exactly zero is
+ * accepted.
+ *
+ * Only references the caller marks as constrained are checked, by
+ * prefix (e.g. "promo-"); every other reference is left alone. Only
+ * user entries on the available balance count, the entries
+ * sumByReference({ accountType: 'user' }) totals.
+ *
+ * Counters live in reference_net_counters, one per tenant and
+ * reference, and are seeded from that tenant's ledger entries the first
+ * time a reference is seen, so they hold across restarts and for entries
+ * written before the guard was enabled. Each entry counted is recorded in
+ * reference_net_applications under its scoped idempotency key, whose
+ * unique index lets a replay through without counting it twice. Each
+ * debit is applied by a single conditional increment, so concurrent
+ * debits cannot both take the last points, and is recorded after it;
+ * a concurrent replay that records it first has its increment taken back.
+ * Credits are added after they are written, so a credit that fails to
+ * append never funds a debit. A debit that fails after it was counted
+ * keeps its reservation; retrying it with the same idempotency key is
+ * allowed.
+ *
+ * @module services/reference-budget-guard
+ */
+
+import { LedgerAppendHook, CreateLedgerEntryRequest, LedgerEntry } from '../ledger/types';
+import { ReferenceNetCounterModel } from '../db/models/reference-net-counter.model';
+import { ReferenceNetApplicationModel } from '../db/models/reference-net-application.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType } from '../wallets/types';
+import { ReferenceOverdrawnError } from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Configuration for the reference budget guard
+ */
+export interface ReferenceBudgetGuardConfig {
+  /** Prefixes of the references whose net must stay non-negative */
+  constrainedPrefixes: string[];
+
+  /** Tenant of a tenant-scoped ledger, for requests that name none */
+  tenantId?: string;
+}
+
+/**
+ * Identifies one entry counted against a reference
+ */
+type CountedEntry = Pick<LedgerEntry, 'tenantId' | 'idempotencyScope' | 'idempotencyKey' | 'amount'>;
+
+/**
+ * Reference Budget Guard Implementation
+ */
+export class ReferenceBudgetGuard implements LedgerAppendHook {
+  readonly name = 'reference-budget';
+
+  private config: ReferenceBudgetGuardConfig;
+
+  /**
+   * @throws Error if a prefix is empty, which would constrain every reference
+   */
+  constructor(config: ReferenceBudgetGuardConfig) {
+    this.config = { ...config, constrainedPrefixes: [...config.constrainedPrefixes] };
+
+    if (this.config.constrainedPrefixes.some(prefix => !prefix)) {
+      throw new Error('Constrained reference prefixes must not be empty');
+    }
+  }
+
+  /**
+   * Apply a debit to its reference's net before it is written
+   *
+   * @throws ReferenceOverdrawnError if the debit would take the net below zero
+   */
+  async beforeAppend(request: CreateLedgerEntryRequest): Promise<void> {
+    const reference = request.correlationId;
+    if (!reference || !this.isCounted(request, reference) || request.type !== TransactionType.DEBIT) {
+      return;
+    }
+
+    const tenantId = request.tenantId ?? this.config.tenantId;
+    const counted: CountedEntry = { ...request, tenantId };
+    await this.loadCounter(tenantId, reference);
+
+    // Replays of a counted debit are left to ledger idempotency
+    if (await this.isApplied(reference, counted)) {
+      return;
+    }
+
+    const result = await ReferenceNetCounterModel.updateOne(
+      { ...this.counterFilter(tenantId, reference), net: { $gte: -request.amount } },
+      { $inc: { net: request.amount } }
+    );
+
+    if (result.modifiedCount !== 1) {
+      if (await this.isApplied(reference, counted)) {
+        return;
+      }
+
+      const current = await this.loadCounter(tenantId, reference);
+      MetricsLogger.incrementCounter(MetricEventType.REDEMPTION_REFERENCE_OVERDRAWN, {
+        reference,
+        userId: request.accountId,
+        requestId: request.requestId,
+      });
+
+      throw new ReferenceOverdrawnError(reference, current.net, request.amount);
+    }
+
+    // A concurrent replay was counted first; take this increment back
+    if (!(await this.recordApplication(reference, counted))) {
+      await ReferenceNetCounterModel.updateOne(this.counterFilter(tenantId, reference), {
+        $inc: { net: -request.amount },
+      });
+    }
+  }
+
+  /**
+   * Add a written credit to its reference's net
+   */
+  async afterAppend(entry: LedgerEntry): Promise<void> {
+    const reference = entry.correlationId;
+    if (!reference || !this.isCounted(entry, reference) || entry.type !== TransactionType.CREDIT) {
+      return;
+    }
+
+    // A counter seeded now already includes the entry; its application stops a second count
+    await this.loadCounter(entry.tenantId, reference);
+    if (await this.recordApplication(reference, entry)) {
+      await ReferenceNetCounterModel.updateOne(this.counterFilter(entry.tenantId, reference), {
+        $inc: { net: entry.amount },
+      });
+    }
+  }
+
+  /**
+   * Whether a reference is constrained
+   */
+  isConstrained(reference: string): boolean {
+    return this.config.constrainedPrefixes.some(prefix => reference.startsWith(prefix));
+  }
+
+  /**
+   * Load a tenant's counter for a reference, seeding it from that
+   * tenant's ledger entries if missing
+   */
+  private async loadCounter(tenantId: string | undefined, reference: string): Promise<{ net: number }> {
+    const existing = await ReferenceNetCounterModel.findOne(this.counterFilter(tenantId, reference)).lean().exec();
+    if (existing) {
+      return existing;
+    }
+
+    const rows: CountedEntry[] = await LedgerEntryModel.aggregate([
+      {
+        $match: {
+          tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+          correlationId: { $eq: reference },
+          accountType: { $eq: 'user' },
+          balanceState: { $eq: 'available' },
+        },
+      },
+      { $project: { _id: 0, amount: 1, idempotencyScope: 1, idempotencyKey: 1 } },
+    ]).exec();
+
+    // Applications go first, so a counter never exists without them
+    if (rows.length > 0) {
+      try {
+        await ReferenceNetApplicationModel.insertMany(
+          rows.map(row => this.application(reference, { ...row, tenantId })),
+          { ordered: false }
+        );
+      } catch (error: any) {
+        // Applications left by an earlier or concurrent seed are kept as they are
+        const writeErrors: any[] = error?.writeErrors || [];
+        if (writeErrors.length === 0 || writeErrors.some(writeError => writeError.code !== 11000)) {
+          throw error;
+        }
+      }
+    }
+
+    const seed = {
+      ...(tenantId !== undefined && { tenantId }),
+      reference,
+      net: rows.reduce((sum, row) => sum + row.amount, 0),
+    };
+
+    try {
+      await ReferenceNetCounterModel.create(seed);
+    } catch (error: any) {
+      // Another writer seeded it first
+      if (error.code !== 11000) {
+        throw error;
+      }
+      const seeded = await ReferenceNetCounterModel.findOne(this.counterFilter(tenantId, reference)).lean().exec();
+      if (seeded) {
+        return seeded;
+      }
+    }
+
+    return seed;
+  }
+
+  /**
+   * Whether an entry has been counted against a reference
+   */
+  private async isApplied(reference: string, entry: CountedEntry): Promise<boolean> {
+    const applied = await ReferenceNetApplicationModel.findOne({
+      tenantId: entry.tenantId !== undefined ? { $eq: entry.tenantId } : { $exists: false },
+      reference: { $eq: reference },
+      idempotencyScope: entry.idempotencyScope ? { $eq: entry.idempotencyScope } : { $exists: false },
+      idempotencyKey: { $eq: entry.idempotencyKey },
+    })
+      .lean()
+      .exec();
+    return applied !== null;
+  }
+
+  /**
+   * Record an entry as counted against a reference
+   *
+   * @returns false if it was already recorded
+   */
+  private async recordApplication(reference: string, entry: CountedEntry): Promise<boolean> {
+    try {
+      await ReferenceNetApplicationModel.create(this.application(reference, entry));
+      return true;
+    } catch (error: any) {
+      if (error.code === 11000) {
+        return false;
+      }
+      throw error;
+    }
+  }
+
+  private application(reference: string, entry: CountedEntry): Record<string, unknown> {
+    return {
+      ...(entry.tenantId !== undefined && { tenantId: entry.tenantId }),
+      reference,
+      ...(entry.idempotencyScope && { idempotencyScope: entry.idempotencyScope }),
+      idempotencyKey: entry.idempotencyKey,
+      amount: entry.amount,
+      appliedAt: new Date(),
+    };
+  }
+
+  private counterFilter(tenantId: string | undefined, reference: string): Record<string, unknown> {
+    return {
+      tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+      reference: { $eq: reference },
+    };
+  }
+
+  /**
+   * Whether an entry counts towards a constrained reference's net
+   */
+  private isCounted(entry: Pick<LedgerEntry, 'accountType' | 'balanceState'>, reference: string): boolean {
+    return entry.accountType === 'user' && entry.balanceState === 'available' && this.isConstrained(reference);
+  }
+}
+
+/**
+ * Factory function to create a reference budget guard
+ */
+export function createReferenceBudgetGuard(config: ReferenceBudgetGuardConfig): ReferenceBudgetGuard {
+  return new ReferenceBudgetGuard(config);
+}
@@ -0,0 +1,189 @@
+/**
+ * Reference Limit Guard Tests
+ */
+
+import { ReferenceLimitGuard } from './reference-limit-guard.service';
+import { ReferenceLimitExceededError } from './types';
+import { ReferenceEarnCounterModel } from '../db/models/reference-earn-counter.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { CreateLedgerEntryRequest } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { MetricsLogger } from '../metrics';
+
+jest.mock('../db/models/reference-earn-counter.model');
+jest.mock('../db/models/ledger-entry.model');
+
+describe('ReferenceLimitGuard', () => {
+  // In-memory reference_earn_counters collection, keyed by tenant and reference
+  let counters: Map<
+    string,
+    { tenantId?: string; reference: string; count: number; points: number; idempotencyKeys: string[] }
+  >;
+  let ledgerRows: any[];
+
+  const key = (reference: string, tenantId?: string) => `${tenantId ?? ''}:${reference}`;
+
+  const earn = (idempotencyKey: string, reference = 'kiosk-7-receipt-1', amount = 100): CreateLedgerEntryRequest => ({
+    accountId: 'user-123',
+    accountType: 'user',
+    amount,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey,
+    requestId: `req-${idempotencyKey}`,
+    balanceBefore: 0,
+    balanceAfter: amount,
+    correlationId: reference,
+  });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    jest.spyOn(MetricsLogger, 'incrementCounter').mockImplementation(() => undefined);
+    jest.spyOn(MetricsLogger, 'logAlert').mockImplementation(() => undefined);
+    counters = new Map();
+    ledgerRows = [];
+
+    (ReferenceEarnCounterModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => {
+        const doc = counters.get(key(query.reference.$eq, query.tenantId.$eq));
+        return doc ? { ...doc, idempotencyKeys: [...doc.idempotencyKeys] } : null;
+      }),
+    }));
+    (ReferenceEarnCounterModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      if (counters.has(key(doc.reference, doc.tenantId))) {
+        throw Object.assign(new Error('E11000 duplicate key'), { code: 11000 });
+      }
+      counters.set(key(doc.reference, doc.tenantId), { ...doc, idempotencyKeys: [...doc.idempotencyKeys] });
+      return doc;
+    });
+    // Applies the conditional increment atomically, as MongoDB would
+    (ReferenceEarnCounterModel.updateOne as jest.Mock).mockImplementation(async (filter: any, update: any) => {
+      const doc = counters.get(key(filter.reference.$eq, filter.tenantId.$eq));
+      const matches =
+        doc &&
+        !doc.idempotencyKeys.includes(filter.idempotencyKeys.$ne) &&
+        doc.count < filter.count.$lt &&
+        (filter.points === undefined || doc.points <= filter.points.$lte);
+      if (!matches) {
+        return { modifiedCount: 0 };
+      }
+      doc.count += update.$inc.count;
+      doc.points += update.$inc.points;
+      doc.idempotencyKeys.push(update.$push.idempotencyKeys);
+      return { modifiedCount: 1 };
+    });
+    (LedgerEntryModel.aggregate as jest.Mock).mockImplementation(() => ({
+      exec: jest.fn().mockImplementation(async () => ledgerRows),
+    }));
+  });
+
+  afterEach(() => {
+    jest.restoreAllMocks();
+  });
+
+  it('should allow one earn per reference by default', async () => {
+    const guard = new ReferenceLimitGuard();
+
+    await expect(guard.beforeAppend(earn('evt-1'))).resolves.toBeUndefined();
+    const error = await guard.beforeAppend(earn('evt-2')).catch(e => e);
+
+    expect(error).toBeInstanceOf(ReferenceLimitExceededError);
+    expect(error.details).toMatchObject({ reference: 'kiosk-7-receipt-1', limit: 'earns', max: 1, observed: 2 });
+  });
+
+  it('should let replays of a counted earn through', async () => {
+    const guard = new ReferenceLimitGuard();
+    await guard.beforeAppend(earn('evt-1'));
+
+    await expect(guard.beforeAppend(earn('evt-1'))).resolves.toBeUndefined();
+    expect(counters.get(key('kiosk-7-receipt-1'))?.count).toBe(1);
+  });
+
+  it('should apply the longest matching prefix limit', async () => {
+    const guard = new ReferenceLimitGuard({
+      prefixLimits: { 'kiosk-': { maxEarns: 3 }, 'kiosk-7-': { maxEarns: 2 } },
+    });
+
+    await guard.beforeAppend(earn('evt-1'));
+    await guard.beforeAppend(earn('evt-2'));
+
+    await expect(guard.beforeAppend(earn('evt-3'))).rejects.toThrow(ReferenceLimitExceededError);
+    expect(guard.limitsFor('kiosk-9-receipt')).toEqual({ maxEarns: 3 });
+  });
+
+  it('should cap the points a reference can accumulate', async () => {
+    const guard = new ReferenceLimitGuard({ defaultLimits: { maxEarns: 10, maxPoints: 250 } });
+
+    await guard.beforeAppend(earn('evt-1', 'promo-x', 100));
+    await guard.beforeAppend(earn('evt-2', 'promo-x', 150));
+    const error = await guard.beforeAppend(earn('evt-3', 'promo-x', 1)).catch(e => e);
+
+    expect(error.details).toMatchObject({ limit: 'points', max: 250, observed: 251 });
+  });
+
+  it('should seed counters from the ledger so limits survive a restart', async () => {
+    ledgerRows = [{ _id: null, count: 1, points: 100, idempotencyKeys: ['evt-before-restart'] }];
+    const guard = new ReferenceLimitGuard();
+
+    await expect(guard.beforeAppend(earn('evt-after-restart'))).rejects.toThrow(ReferenceLimitExceededError);
+    await expect(guard.beforeAppend(earn('evt-before-restart'))).resolves.toBeUndefined();
+
+    const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+    expect(pipeline[0].$match).toMatchObject({
+      tenantId: { $exists: false },
+      correlationId: { $eq: 'kiosk-7-receipt-1' },
+      type: { $eq: 'credit' },
+    });
+  });
+
+  it('should keep tenants reusing a reference apart', async () => {
+    const guard = new ReferenceLimitGuard({ tenantId: 'tenant-a' });
+    await guard.beforeAppend(earn('evt-1'));
+
+    await expect(guard.beforeAppend({ ...earn('evt-2'), tenantId: 'tenant-b' })).resolves.toBeUndefined();
+    await expect(guard.beforeAppend(earn('evt-3'))).rejects.toThrow(ReferenceLimitExceededError);
+
+    const [pipeline] = (LedgerEntryModel.aggregate as jest.Mock).mock.calls[0];
+    expect(pipeline[0].$match.tenantId).toEqual({ $eq: 'tenant-a' });
+    expect(counters.get(key('kiosk-7-receipt-1', 'tenant-a'))?.count).toBe(1);
+    expect(counters.get(key('kiosk-7-receipt-1', 'tenant-b'))?.count).toBe(1);
+  });
+
+  it('should admit exactly one of several concurrent earns', async () => {
+    const guard = new ReferenceLimitGuard();
+
+    const results = await Promise.allSettled(
+      ['evt-1', 'evt-2', 'evt-3', 'evt-4'].map(key => guard.beforeAppend(earn(key)))
+    );
+
+    expect(results.filter(r => r.status === 'fulfilled')).toHaveLength(1);
+    expect(counters.get(key('kiosk-7-receipt-1'))?.count).toBe(1);
+  });
+
+  it('should record breaches in the fraud report', async () => {
+    const guard = new ReferenceLimitGuard();
+    await guard.beforeAppend(earn('evt-1'));
+    await guard.beforeAppend(earn('evt-2')).catch(() => undefined);
+
+    expect(guard.getFraudReport()).toEqual([
+      expect.objectContaining({
+        reference: 'kiosk-7-receipt-1',
+        userId: 'user-123',
+        idempotencyKey: 'evt-2',
+        limit: 'earns',
+      }),
+    ]);
+  });
+
+  it('should ignore debits and earns without a reference', async () => {
+    const guard = new ReferenceLimitGuard();
+
+    await guard.beforeAppend({ ...earn('evt-1'), correlationId: undefined });
+    await guard.beforeAppend({ ...earn('evt-2'), type: TransactionType.DEBIT, amount: -100 });
+
+    expect(ReferenceEarnCounterModel.updateOne).not.toHaveBeenCalled();
+  });
+});
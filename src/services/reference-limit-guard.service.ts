@@ -0,0 +1,318 @@
+/**
+ * Reference Limit Guard
+ *
+ * Caps how many earns may share one upstream reference (correlation ID)
+ * and how many points a reference may accumulate, across all users. This
+ * stops an integration replaying the same kiosk or receipt reference
+ * under fresh event IDs, which idempotency keys and the per-user
+ * EarnReferenceGuard window do not catch.
+ *
+ * Limits default to one earn per reference and can be set per reference
+ * prefix; the longest matching prefix wins. Breaches are rejected and
+ * recorded in the fraud report.
+ *
+ * Counters live in reference_earn_counters, one per tenant and
+ * reference, so tenants reusing a reference do not share its limits.
+ * Each is seeded from that tenant's ledger entries on the correlationId
+ * index the first time the reference is seen, so counters stay correct
+ * across restarts and for earns written before the guard was enabled.
+ * Each earn is counted by a single conditional
+ * increment, so concurrent earns cannot both take the last slot. An
+ * append that fails after its earn was counted keeps its slot; retrying
+ * it with the same idempotency key is allowed.
+ *
+ * @module services/reference-limit-guard
+ */
+
+import { LedgerAppendHook, CreateLedgerEntryRequest } from '../ledger/types';
+import { ReferenceEarnCounterModel } from '../db/models/reference-earn-counter.model';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { ReferenceLimitExceededError } from './types';
+import { MetricsLogger, MetricEventType, AlertSeverity } from '../metrics';
+
+/**
+ * Limits applied to one reference
+ */
+export interface ReferenceLimits {
+  /** Maximum earns sharing the reference */
+  maxEarns: number;
+
+  /** Maximum total points credited against the reference (unset = unlimited) */
+  maxPoints?: number;
+}
+
+/**
+ * Rejected earn recorded in the fraud report
+ */
+export interface ReferenceLimitFlag {
+  reference: string;
+
+  /** User the earn was for */
+  userId: string;
+
+  /** Idempotency key of the rejected earn */
+  idempotencyKey: string;
+
+  /** Limit breached */
+  limit: 'earns' | 'points';
+
+  /** Configured maximum */
+  max: number;
+
+  /** Earn count or point total the earn would have reached */
+  observed: number;
+
+  /** Amount of the rejected earn */
+  amount: number;
+
+  flaggedAt: Date;
+}
+
+/**
+ * Configuration for the reference limit guard
+ */
+export interface ReferenceLimitGuardConfig {
+  /** Limits for references without a matching prefix */
+  defaultLimits: ReferenceLimits;
+
+  /** Limits keyed by reference prefix (e.g. "kiosk-") */
+  prefixLimits: Record<string, Partial<ReferenceLimits>>;
+
+  /** Reasons treated as earns */
+  earnReasons: string[];
+
+  /** Maximum flags retained in the in-memory fraud report */
+  maxReportedFlags: number;
+
+  /** Tenant of a tenant-scoped ledger, for requests that name none */
+  tenantId?: string;
+}
+
+const DEFAULT_CONFIG: ReferenceLimitGuardConfig = {
+  defaultLimits: { maxEarns: 1 },
+  prefixLimits: {},
+  earnReasons: [
+    TransactionReason.USER_SIGNUP_BONUS,
+    TransactionReason.REFERRAL_BONUS,
+    TransactionReason.PROMOTIONAL_AWARD,
+    TransactionReason.ADMIN_CREDIT,
+    TransactionReason.PURCHASE_EARN,
+  ],
+  maxReportedFlags: 1000,
+};
+
+/**
+ * Reference Limit Guard Implementation
+ */
+export class ReferenceLimitGuard implements LedgerAppendHook {
+  readonly name = 'earn-reference-limit';
+
+  private config: ReferenceLimitGuardConfig;
+  private flags: ReferenceLimitFlag[] = [];
+
+  constructor(config: Partial<ReferenceLimitGuardConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+  }
+
+  /**
+   * Count the earn against its reference before it is written
+   *
+   * @throws ReferenceLimitExceededError if the earn would exceed a limit
+   */
+  async beforeAppend(request: CreateLedgerEntryRequest): Promise<void> {
+    const reference = request.correlationId;
+    if (!reference || !this.isEarn(request)) {
+      return;
+    }
+
+    const tenantId = request.tenantId ?? this.config.tenantId;
+    const limits = this.limitsFor(reference);
+    const counter = await this.loadCounter(tenantId, reference);
+
+    // Replays of a counted earn are left to ledger idempotency
+    if (counter.idempotencyKeys.includes(request.idempotencyKey)) {
+      return;
+    }
+
+    const filter: Record<string, any> = {
+      ...this.counterFilter(tenantId, reference),
+      idempotencyKeys: { $ne: request.idempotencyKey },
+      count: { $lt: limits.maxEarns },
+    };
+    if (limits.maxPoints !== undefined) {
+      filter.points = { $lte: limits.maxPoints - request.amount };
+    }
+
+    const result = await ReferenceEarnCounterModel.updateOne(filter, {
+      $inc: { count: 1, points: request.amount },
+      $push: { idempotencyKeys: request.idempotencyKey },
+    });
+
+    if (result.modifiedCount === 1) {
+      return;
+    }
+
+    const current = await this.loadCounter(tenantId, reference);
+    if (current.idempotencyKeys.includes(request.idempotencyKey)) {
+      return;
+    }
+
+    this.reject(request, reference, limits, current);
+  }
+
+  /**
+   * Earns rejected for exceeding a reference limit, oldest first
+   */
+  getFraudReport(): ReferenceLimitFlag[] {
+    return [...this.flags];
+  }
+
+  /**
+   * Resolve the limits for a reference from its longest matching prefix
+   */
+  limitsFor(reference: string): ReferenceLimits {
+    const prefix = Object.keys(this.config.prefixLimits)
+      .filter(p => reference.startsWith(p))
+      .sort((a, b) => b.length - a.length)[0];
+
+    return prefix === undefined
+      ? this.config.defaultLimits
+      : { ...this.config.defaultLimits, ...this.config.prefixLimits[prefix] };
+  }
+
+  /**
+   * Load a tenant's counter for a reference, seeding it from that
+   * tenant's ledger entries if missing
+   */
+  private async loadCounter(
+    tenantId: string | undefined,
+    reference: string
+  ): Promise<{ count: number; points: number; idempotencyKeys: string[] }> {
+    const existing = await ReferenceEarnCounterModel.findOne(this.counterFilter(tenantId, reference)).lean().exec();
+    if (existing) {
+      return existing;
+    }
+
+    const [row] = await LedgerEntryModel.aggregate([
+      {
+        $match: {
+          tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+          correlationId: { $eq: reference },
+          accountType: { $eq: 'user' },
+          type: { $eq: TransactionType.CREDIT },
+          balanceState: { $eq: 'available' },
+          reason: { $in: this.config.earnReasons },
+        },
+      },
+      {
+        $group: {
+          _id: null,
+          count: { $sum: 1 },
+          points: { $sum: '$amount' },
+          idempotencyKeys: { $push: '$idempotencyKey' },
+        },
+      },
+    ]).exec();
+
+    const seed = {
+      ...(tenantId !== undefined && { tenantId }),
+      reference,
+      count: row ? row.count : 0,
+      points: row ? row.points : 0,
+      idempotencyKeys: row ? row.idempotencyKeys : [],
+    };
+
+    try {
+      await ReferenceEarnCounterModel.create(seed);
+    } catch (error: any) {
+      // Another writer seeded it first
+      if (error.code !== 11000) {
+        throw error;
+      }
+      const seeded = await ReferenceEarnCounterModel.findOne(this.counterFilter(tenantId, reference)).lean().exec();
+      if (seeded) {
+        return seeded;
+      }
+    }
+
+    return seed;
+  }
+
+  private counterFilter(tenantId: string | undefined, reference: string): Record<string, unknown> {
+    return {
+      tenantId: tenantId !== undefined ? { $eq: tenantId } : { $exists: false },
+      reference: { $eq: reference },
+    };
+  }
+
+  /**
+   * Record and raise a limit breach
+   */
+  private reject(
+    request: CreateLedgerEntryRequest,
+    reference: string,
+    limits: ReferenceLimits,
+    counter: { count: number; points: number }
+  ): never {
+    const earnsExceeded = counter.count >= limits.maxEarns;
+    const flag: ReferenceLimitFlag = {
+      reference,
+      userId: request.accountId,
+      idempotencyKey: request.idempotencyKey,
+      limit: earnsExceeded ? 'earns' : 'points',
+      max: earnsExceeded ? limits.maxEarns : limits.maxPoints!,
+      observed: earnsExceeded ? counter.count + 1 : counter.points + request.amount,
+      amount: request.amount,
+      flaggedAt: new Date(),
+    };
+
+    this.flags.push(flag);
+    if (this.flags.length > this.config.maxReportedFlags) {
+      this.flags.shift();
+    }
+
+    MetricsLogger.incrementCounter(MetricEventType.EARN_REFERENCE_LIMIT_EXCEEDED, {
+      reference,
+      userId: flag.userId,
+      limit: flag.limit,
+      requestId: request.requestId,
+    });
+    MetricsLogger.logAlert({
+      severity: AlertSeverity.WARNING,
+      message: `Earn rejected: reference ${reference} exceeded its ${flag.limit} limit`,
+      metricType: MetricEventType.ADMIN_FRAUD_FLAGGED,
+      timestamp: flag.flaggedAt,
+      metadata: {
+        reference,
+        userId: flag.userId,
+        idempotencyKey: flag.idempotencyKey,
+        max: flag.max,
+        observed: flag.observed,
+      },
+    });
+
+    throw new ReferenceLimitExceededError(reference, flag.limit, flag.max, flag.observed);
+  }
+
+  /**
+   * Whether a request is an earn subject to reference limits
+   */
+  private isEarn(request: CreateLedgerEntryRequest): boolean {
+    return (
+      request.accountType === 'user' &&
+      request.type === TransactionType.CREDIT &&
+      request.balanceState === 'available' &&
+      this.config.earnReasons.includes(request.reason)
+    );
+  }
+}
+
+/**
+ * Factory function to create a reference limit guard
+ */
+export function createReferenceLimitGuard(
+  config?: Partial<ReferenceLimitGuardConfig>
+): ReferenceLimitGuard {
+  return new ReferenceLimitGuard(config);
+}
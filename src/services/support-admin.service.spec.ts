@@ -0,0 +1,267 @@
+/**
+ * Support Admin Service Tests
+ */
+
+import { SupportAdminService } from './support-admin.service';
+import { BulkAdjustmentService } from './bulk-adjustment.service';
+import { AdminContext } from './admin-ops.service';
+import { InvalidAuthorizationError } from './types';
+import { WalletModel } from '../db/models/wallet.model';
+import { AdminAccessLogModel } from '../db/models/admin-access-log.model';
+
+// Mock mongoose models
+jest.mock('../db/models/wallet.model');
+jest.mock('../db/models/admin-access-log.model');
+
+describe('SupportAdminService', () => {
+  let service: SupportAdminService;
+  let mockLedgerService: any;
+  let mockAdminOps: any;
+  let applied: Set<string>;
+
+  const support: AdminContext = {
+    adminId: 'sup-1',
+    adminUsername: 'sup1',
+    roles: ['support'],
+    ipAddress: '10.0.0.1',
+  };
+  const ops: AdminContext = { adminId: 'ops-1', adminUsername: 'ops1', roles: ['admin'] };
+  const finance: AdminContext = { adminId: 'fin-1', adminUsername: 'fin1', roles: ['finance_admin'] };
+
+  const entry = (entryId: string) => ({ entryId, transactionId: 'txn-1', accountId: 'user-1', amount: 100 });
+
+  // Access log records written so far
+  const accessLog = () => (AdminAccessLogModel.create as jest.Mock).mock.calls.map(([record]) => record);
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    applied = new Set();
+    mockLedgerService = {
+      getAuditTrail: jest.fn().mockResolvedValue([{ ledgerEntry: entry('entry-1') }]),
+      queryEntries: jest.fn().mockResolvedValue({ entries: [entry('entry-2'), entry('entry-1')] }),
+      generateReconciliationReport: jest.fn().mockResolvedValue({ accountId: 'user-1', reconciled: true }),
+      checkIdempotency: jest.fn().mockImplementation(async (key: string) => applied.has(key)),
+      storeIdempotencyResult: jest.fn().mockImplementation(async (key: string) => {
+        applied.add(key);
+      }),
+    };
+    mockAdminOps = {
+      manualAdjustment: jest.fn().mockImplementation(async (request: any) => ({
+        transactionId: `txn-${request.requestId}`,
+        amountAdjusted: request.amount,
+        previousBalance: 0,
+        newBalance: request.amount,
+        timestamp: new Date(),
+      })),
+      clawback: jest.fn().mockResolvedValue({ transactionId: 'txn-claw', amountClawedBack: 40 }),
+    };
+    const bulk = new BulkAdjustmentService(mockAdminOps, mockLedgerService, { approvalSecret: 'test-secret' });
+    service = new SupportAdminService(mockLedgerService, mockAdminOps, bulk);
+
+    (AdminAccessLogModel.create as jest.Mock).mockResolvedValue({});
+    (WalletModel.findOne as jest.Mock).mockResolvedValue({
+      userId: 'user-1',
+      availableBalance: 500,
+      escrowBalance: 25,
+      frozen: false,
+    });
+  });
+
+  describe('access control', () => {
+    it('should log every allowed invocation with the operator identity', async () => {
+      await service.lookupTransaction(support, 'txn-1');
+
+      expect(accessLog()).toEqual([
+        expect.objectContaining({
+          operation: 'lookupTransaction',
+          adminId: 'sup-1',
+          adminUsername: 'sup1',
+          roles: ['support'],
+          ipAddress: '10.0.0.1',
+          target: 'txn-1',
+          decision: 'allowed',
+        }),
+      ]);
+    });
+
+    it('should log and reject operations the roles do not permit', async () => {
+      await expect(service.freeze(support, 'user-1')).rejects.toThrow(InvalidAuthorizationError);
+
+      expect(accessLog()).toEqual([expect.objectContaining({ operation: 'freeze', decision: 'denied' })]);
+      expect(WalletModel.findOneAndUpdate).not.toHaveBeenCalled();
+    });
+
+    it('should reject a context without an operator ID', async () => {
+      await expect(service.viewUser({ ...ops, adminId: '' }, 'user-1')).rejects.toThrow(
+        InvalidAuthorizationError
+      );
+      expect(accessLog()[0]).toMatchObject({ adminId: 'unknown', decision: 'denied' });
+    });
+
+    it('should not run the operation if the access log cannot be written', async () => {
+      (AdminAccessLogModel.create as jest.Mock).mockRejectedValue(new Error('log unavailable'));
+
+      await expect(service.lookupTransaction(support, 'txn-1')).rejects.toThrow('log unavailable');
+      expect(mockLedgerService.getAuditTrail).not.toHaveBeenCalled();
+    });
+
+    it('should accept permission overrides', async () => {
+      const bulk = new BulkAdjustmentService(mockAdminOps, mockLedgerService, { approvalSecret: 'test-secret' });
+      service = new SupportAdminService(mockLedgerService, mockAdminOps, bulk, {
+        permissions: { freeze: ['support'] } as any,
+      });
+      (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue({ frozen: true });
+
+      await expect(service.freeze(support, 'user-1')).resolves.toEqual({ userId: 'user-1', frozen: true });
+      await expect(service.viewUser(support, 'user-1')).resolves.toBeDefined();
+    });
+  });
+
+  describe('lookupTransaction', () => {
+    it('should return the transaction entries', async () => {
+      const view = await service.lookupTransaction(support, 'txn-1');
+
+      expect(view).toEqual({ transactionId: 'txn-1', found: true, entries: [entry('entry-1')] });
+    });
+
+    it('should report unknown transactions as not found', async () => {
+      mockLedgerService.getAuditTrail.mockResolvedValue([]);
+
+      const view = await service.lookupTransaction(support, 'txn-x');
+
+      expect(view).toMatchObject({ found: false, entries: [] });
+    });
+  });
+
+  describe('viewUser', () => {
+    it('should return balances and recent history', async () => {
+      const view = await service.viewUser(support, 'user-1');
+
+      expect(view).toEqual({
+        userId: 'user-1',
+        availableBalance: 500,
+        escrowBalance: 25,
+        frozen: false,
+        recentEntries: [entry('entry-2'), entry('entry-1')],
+      });
+      expect(mockLedgerService.queryEntries).toHaveBeenCalledWith(
+        expect.objectContaining({ accountId: 'user-1', sortOrder: 'desc', limit: 20 })
+      );
+    });
+
+    it('should reject unknown users', async () => {
+      (WalletModel.findOne as jest.Mock).mockResolvedValue(null);
+
+      await expect(service.viewUser(support, 'user-x')).rejects.toThrow('Wallet not found');
+    });
+  });
+
+  describe('adjustments', () => {
+    const adjustment = { userId: 'user-1', amount: 75, reason: 'outage, compensation', proposalId: 'prop-1' };
+
+    it('should propose without applying', async () => {
+      const proposal = await service.proposeAdjustment(ops, adjustment);
+
+      expect(proposal).toMatchObject({ proposalId: 'prop-1', userId: 'user-1', amount: 75, proposedBy: 'ops-1' });
+      expect(proposal.preview).toMatchObject({ dryRun: true, validRows: 1, totalPoints: 75 });
+      expect(mockAdminOps.manualAdjustment).not.toHaveBeenCalled();
+    });
+
+    it('should reject an invalid proposal', async () => {
+      await expect(service.proposeAdjustment(ops, { ...adjustment, amount: 0 })).rejects.toThrow(
+        'Invalid adjustment'
+      );
+    });
+
+    it('should apply an approved proposal once', async () => {
+      const proposal = await service.proposeAdjustment(ops, adjustment);
+      const token = await service.approveAdjustment(finance, proposal);
+
+      const outcome = await service.applyAdjustment(ops, proposal, token);
+      const replay = await service.applyAdjustment(ops, proposal, token);
+
+      expect(outcome).toMatchObject({ proposalId: 'prop-1', status: 'applied' });
+      expect(replay.status).toBe('skipped');
+      expect(mockAdminOps.manualAdjustment).toHaveBeenCalledTimes(1);
+      expect(mockAdminOps.manualAdjustment).toHaveBeenCalledWith(
+        expect.objectContaining({ userId: 'user-1', amount: 75, reason: 'outage, compensation' })
+      );
+    });
+
+    it('should not let the proposer approve their own adjustment', async () => {
+      const proposal = await service.proposeAdjustment(finance, adjustment);
+
+      await expect(service.approveAdjustment(finance, proposal)).rejects.toThrow('approved by its proposer');
+    });
+
+    it('should not let the approver apply the adjustment', async () => {
+      const proposal = await service.proposeAdjustment(ops, adjustment);
+      const token = await service.approveAdjustment(finance, proposal);
+
+      await expect(service.applyAdjustment(finance, proposal, token)).rejects.toThrow(InvalidAuthorizationError);
+    });
+
+    it('should require an approver role', async () => {
+      const proposal = await service.proposeAdjustment(ops, adjustment);
+
+      await expect(service.approveAdjustment(ops, proposal)).rejects.toThrow(InvalidAuthorizationError);
+    });
+  });
+
+  describe('freeze', () => {
+    it('should freeze and unfreeze a wallet', async () => {
+      (WalletModel.findOneAndUpdate as jest.Mock)
+        .mockResolvedValueOnce({ frozen: true })
+        .mockResolvedValueOnce({ frozen: false });
+
+      await expect(service.freeze(ops, 'user-1')).resolves.toEqual({ userId: 'user-1', frozen: true });
+      await expect(service.unfreeze(ops, 'user-1')).resolves.toEqual({ userId: 'user-1', frozen: false });
+      expect(WalletModel.findOneAndUpdate).toHaveBeenCalledWith(
+        { userId: { $eq: 'user-1' } },
+        { $set: { frozen: true }, $inc: { version: 1 } },
+        { new: true }
+      );
+    });
+
+    it('should reject unknown users', async () => {
+      (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue(null);
+
+      await expect(service.freeze(ops, 'user-x')).rejects.toThrow('Wallet not found');
+    });
+  });
+
+  describe('clawback', () => {
+    it('should claw back with the operator as admin', async () => {
+      const request = {
+        userId: 'user-1',
+        amount: 40,
+        reason: 'fraud ring',
+        originalTransactionId: 'txn-9',
+        requestId: 'req-1',
+      };
+
+      const result = await service.clawback(finance, request);
+
+      expect(result).toMatchObject({ transactionId: 'txn-claw' });
+      expect(mockAdminOps.clawback).toHaveBeenCalledWith({ ...request, admin: finance });
+      expect(accessLog()[0]).toMatchObject({ operation: 'clawback', target: 'user-1', requestId: 'req-1' });
+    });
+
+    it('should not let plain admins claw back', async () => {
+      const request = { userId: 'user-1', amount: 40, reason: 'x', originalTransactionId: 'txn-9', requestId: 'r' };
+
+      await expect(service.clawback(ops, request)).rejects.toThrow(InvalidAuthorizationError);
+      expect(mockAdminOps.clawback).not.toHaveBeenCalled();
+    });
+  });
+
+  describe('verifyIntegrity', () => {
+    it('should reconcile the full history', async () => {
+      const report = await service.verifyIntegrity(support, 'user-1');
+
+      expect(report).toMatchObject({ reconciled: true });
+      const [accountId, accountType, range] = mockLedgerService.generateReconciliationReport.mock.calls[0];
+      expect([accountId, accountType, range.start]).toEqual(['user-1', 'user', new Date(0)]);
+    });
+  });
+});
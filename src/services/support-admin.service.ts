@@ -0,0 +1,385 @@
+/**
+ * Support Admin Service
+ *
+ * One audited entry point for support engineering's admin operations,
+ * so none of them needs direct database access:
+ * - Look up a transaction, view a user's balance and recent history
+ * - Propose, approve and apply single adjustments (two-person rule, via
+ *   BulkAdjustmentService)
+ * - Freeze and unfreeze wallets
+ * - Claw back fraudulent earns (via AdminOpsService)
+ * - Run a user's integrity verification (ledger reconciliation)
+ *
+ * Every method checks the operator's roles against the permission table
+ * and appends an access log record before doing anything, including for
+ * denied calls. Results are plain objects ready for an internal tool to
+ * render.
+ *
+ * @module services/support-admin
+ */
+
+import { Readable } from 'stream';
+import { v4 as uuidv4 } from 'uuid';
+import { ILedgerService, LedgerEntry, ReconciliationReport } from '../ledger/types';
+import { WalletModel } from '../db/models/wallet.model';
+import { AdminAccessLogModel } from '../db/models/admin-access-log.model';
+import { AdminOpsService, AdminContext, ClawbackRequest, ClawbackResponse } from './admin-ops.service';
+import { BulkAdjustmentService, BulkReport } from './bulk-adjustment.service';
+import { InvalidAuthorizationError } from './types';
+
+/**
+ * Operations exposed by the support admin service
+ */
+export type SupportOperation =
+  | 'lookupTransaction'
+  | 'viewUser'
+  | 'proposeAdjustment'
+  | 'approveAdjustment'
+  | 'applyAdjustment'
+  | 'freeze'
+  | 'unfreeze'
+  | 'clawback'
+  | 'verifyIntegrity';
+
+/**
+ * Configuration for the support admin service
+ */
+export interface SupportAdminConfig {
+  /** Roles allowed to invoke each operation */
+  permissions: Record<SupportOperation, string[]>;
+
+  /** Ledger entries returned by viewUser */
+  recentHistoryLimit: number;
+}
+
+const READ_ROLES = ['support', 'admin', 'super_admin', 'finance_admin'];
+const WRITE_ROLES = ['admin', 'super_admin', 'finance_admin'];
+
+const DEFAULT_CONFIG: SupportAdminConfig = {
+  permissions: {
+    lookupTransaction: READ_ROLES,
+    viewUser: READ_ROLES,
+    proposeAdjustment: WRITE_ROLES,
+    approveAdjustment: ['super_admin', 'finance_admin'],
+    applyAdjustment: WRITE_ROLES,
+    freeze: WRITE_ROLES,
+    unfreeze: WRITE_ROLES,
+    clawback: ['super_admin', 'finance_admin'],
+    verifyIntegrity: READ_ROLES,
+  },
+  recentHistoryLimit: 20,
+};
+
+/**
+ * A transaction and its ledger entries
+ */
+export interface TransactionView {
+  transactionId: string;
+  found: boolean;
+  entries: LedgerEntry[];
+}
+
+/**
+ * A user's wallet state and recent history
+ */
+export interface UserView {
+  userId: string;
+  availableBalance: number;
+  escrowBalance: number;
+  frozen: boolean;
+
+  /** Most recent entries, newest first */
+  recentEntries: LedgerEntry[];
+}
+
+/**
+ * A single adjustment awaiting approval
+ */
+export interface AdjustmentProposal {
+  /** Stable ID; also the batch ID of the underlying bulk adjustment */
+  proposalId: string;
+  userId: string;
+  amount: number;
+  reason: string;
+
+  /** Admin who proposed the adjustment; cannot approve it */
+  proposedBy: string;
+
+  /** Dry-run report the approval is bound to */
+  preview: BulkReport;
+}
+
+/**
+ * Outcome of applying an approved adjustment
+ */
+export interface AdjustmentOutcome {
+  proposalId: string;
+  status: 'applied' | 'skipped' | 'failed';
+  transactionId?: string;
+  error?: string;
+}
+
+/**
+ * Wallet freeze state after freeze or unfreeze
+ */
+export interface FreezeResult {
+  userId: string;
+  frozen: boolean;
+}
+
+/**
+ * Support Admin Service Implementation
+ */
+export class SupportAdminService {
+  private config: SupportAdminConfig;
+  private ledgerService: ILedgerService;
+  private adminOps: AdminOpsService;
+  private bulkAdjustments: BulkAdjustmentService;
+
+  constructor(
+    ledgerService: ILedgerService,
+    adminOps: AdminOpsService,
+    bulkAdjustments: BulkAdjustmentService,
+    config: Partial<SupportAdminConfig> = {}
+  ) {
+    this.config = {
+      ...DEFAULT_CONFIG,
+      ...config,
+      permissions: { ...DEFAULT_CONFIG.permissions, ...config.permissions },
+    };
+    this.ledgerService = ledgerService;
+    this.adminOps = adminOps;
+    this.bulkAdjustments = bulkAdjustments;
+  }
+
+  /**
+   * Look up a transaction's ledger entries by transaction ID
+   */
+  async lookupTransaction(admin: AdminContext, transactionId: string): Promise<TransactionView> {
+    await this.authorize('lookupTransaction', admin, transactionId);
+
+    const trail = await this.ledgerService.getAuditTrail(transactionId);
+
+    return {
+      transactionId,
+      found: trail.length > 0,
+      entries: trail.map(audit => audit.ledgerEntry),
+    };
+  }
+
+  /**
+   * View a user's balances, freeze state and recent history
+   *
+   * @throws Error if the user has no wallet
+   */
+  async viewUser(admin: AdminContext, userId: string): Promise<UserView> {
+    await this.authorize('viewUser', admin, userId);
+
+    const wallet = await WalletModel.findOne({ userId: { $eq: userId } });
+    if (!wallet) {
+      throw new Error(`Wallet not found for user: ${userId}`);
+    }
+
+    const history = await this.ledgerService.queryEntries({
+      accountId: userId,
+      accountType: 'user',
+      sortBy: 'timestamp',
+      sortOrder: 'desc',
+      limit: this.config.recentHistoryLimit,
+    });
+
+    return {
+      userId,
+      availableBalance: wallet.availableBalance,
+      escrowBalance: wallet.escrowBalance,
+      frozen: Boolean(wallet.frozen),
+      recentEntries: history.entries,
+    };
+  }
+
+  /**
+   * Propose a single adjustment; nothing is applied until a second admin
+   * approves it
+   *
+   * @throws Error if the adjustment fails validation
+   */
+  async proposeAdjustment(
+    admin: AdminContext,
+    adjustment: { userId: string; amount: number; reason: string; proposalId?: string }
+  ): Promise<AdjustmentProposal> {
+    await this.authorize('proposeAdjustment', admin, adjustment.userId);
+
+    const proposal = {
+      proposalId: adjustment.proposalId || `support-adjust-${uuidv4()}`,
+      userId: adjustment.userId,
+      amount: adjustment.amount,
+      reason: adjustment.reason,
+    };
+
+    const preview = await this.bulkAdjustments.bulkAdjust(adjustmentCsv(proposal), {
+      batchId: proposal.proposalId,
+      admin,
+      dryRun: true,
+    });
+
+    if (preview.errors.length > 0) {
+      throw new Error(`Invalid adjustment: ${preview.errors[0].message}`);
+    }
+
+    return { ...proposal, proposedBy: admin.adminId, preview };
+  }
+
+  /**
+   * Approve another admin's proposal
+   *
+   * @returns Approval token for applyAdjustment
+   * @throws InvalidAuthorizationError if the approver proposed the adjustment
+   */
+  async approveAdjustment(admin: AdminContext, proposal: AdjustmentProposal): Promise<string> {
+    await this.authorize('approveAdjustment', admin, proposal.userId);
+
+    if (admin.adminId === proposal.proposedBy) {
+      throw new InvalidAuthorizationError('an adjustment cannot be approved by its proposer');
+    }
+
+    return this.bulkAdjustments.approve(proposal.preview, admin);
+  }
+
+  /**
+   * Apply an approved proposal; re-applying an applied proposal is skipped
+   *
+   * @throws InvalidAuthorizationError if the approval does not match
+   */
+  async applyAdjustment(
+    admin: AdminContext,
+    proposal: AdjustmentProposal,
+    approvalToken: string
+  ): Promise<AdjustmentOutcome> {
+    await this.authorize('applyAdjustment', admin, proposal.userId);
+
+    const report = await this.bulkAdjustments.bulkAdjust(adjustmentCsv(proposal), {
+      batchId: proposal.proposalId,
+      admin,
+      dryRun: false,
+      approvalToken,
+    });
+    const [result] = report.results;
+
+    return {
+      proposalId: proposal.proposalId,
+      status: result.status,
+      transactionId: result.transactionId,
+      error: result.error,
+    };
+  }
+
+  /**
+   * Freeze a user's wallet
+   */
+  async freeze(admin: AdminContext, userId: string): Promise<FreezeResult> {
+    await this.authorize('freeze', admin, userId);
+    return this.setFrozen(userId, true);
+  }
+
+  /**
+   * Unfreeze a user's wallet
+   */
+  async unfreeze(admin: AdminContext, userId: string): Promise<FreezeResult> {
+    await this.authorize('unfreeze', admin, userId);
+    return this.setFrozen(userId, false);
+  }
+
+  /**
+   * Claw back points earned through fraud
+   */
+  async clawback(admin: AdminContext, request: Omit<ClawbackRequest, 'admin'>): Promise<ClawbackResponse> {
+    await this.authorize('clawback', admin, request.userId, request.requestId);
+
+    return this.adminOps.clawback({ ...request, admin });
+  }
+
+  /**
+   * Reconcile a user's full ledger history against their balance
+   */
+  async verifyIntegrity(admin: AdminContext, userId: string): Promise<ReconciliationReport> {
+    await this.authorize('verifyIntegrity', admin, userId);
+
+    return this.ledgerService.generateReconciliationReport(userId, 'user', {
+      start: new Date(0),
+      end: new Date(),
+    });
+  }
+
+  /**
+   * Log the invocation, then reject it unless a role permits the operation
+   *
+   * @throws InvalidAuthorizationError if no role permits the operation
+   */
+  private async authorize(
+    operation: SupportOperation,
+    admin: AdminContext,
+    target: string,
+    requestId?: string
+  ): Promise<void> {
+    const permitted = this.config.permissions[operation];
+    const allowed = Boolean(admin.adminId) && (admin.roles || []).some(role => permitted.includes(role));
+
+    await AdminAccessLogModel.create({
+      logId: uuidv4(),
+      operation,
+      adminId: admin.adminId || 'unknown',
+      adminUsername: admin.adminUsername,
+      roles: admin.roles || [],
+      ipAddress: admin.ipAddress,
+      userAgent: admin.userAgent,
+      target: target || 'unknown',
+      decision: allowed ? 'allowed' : 'denied',
+      requestId,
+    });
+
+    if (!allowed) {
+      throw new InvalidAuthorizationError(`${operation} requires one of: ${permitted.join(', ')}`);
+    }
+  }
+
+  private async setFrozen(userId: string, frozen: boolean): Promise<FreezeResult> {
+    const updated = await WalletModel.findOneAndUpdate(
+      { userId: { $eq: userId } },
+      { $set: { frozen }, $inc: { version: 1 } },
+      { new: true }
+    );
+
+    if (!updated) {
+      throw new Error(`Wallet not found for user: ${userId}`);
+    }
+
+    return { userId, frozen: Boolean(updated.frozen) };
+  }
+}
+
+/**
+ * Render one adjustment as bulk adjustment CSV
+ */
+function adjustmentCsv(adjustment: { userId: string; amount: number; reason: string }): Readable {
+  const cell = (value: string) => (/[",]/.test(value) ? `"${value.replace(/"/g, '""')}"` : value);
+
+  if (/[\r\n]/.test(adjustment.reason) || /[\r\n]/.test(adjustment.userId)) {
+    throw new Error('Adjustment fields cannot contain line breaks');
+  }
+
+  return Readable.from([
+    `userId,amount,reason\n${cell(adjustment.userId)},${adjustment.amount},${cell(adjustment.reason)}\n`,
+  ]);
+}
+
+/**
+ * Factory function to create support admin service
+ */
+export function createSupportAdminService(
+  ledgerService: ILedgerService,
+  adminOps: AdminOpsService,
+  bulkAdjustments: BulkAdjustmentService,
+  config?: Partial<SupportAdminConfig>
+): SupportAdminService {
+  return new SupportAdminService(ledgerService, adminOps, bulkAdjustments, config);
+}
@@ -0,0 +1,212 @@
+/**
+ * Transaction Correction Service Tests
+ */
+
+import { TransactionCorrectionService } from './transaction-correction.service';
+import { InsufficientBalanceError, InvalidPointAmountError, TransactionAlreadyCorrectedError } from './types';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../wallets/wallet-application');
+
+describe('TransactionCorrectionService', () => {
+  let service: TransactionCorrectionService;
+  let mockLedgerService: { createEntryWithResult: jest.Mock; getAuditTrail: jest.Mock; getBalanceSnapshot: jest.Mock };
+  let entries: any[];
+  let appliedKeys: Set<string>;
+
+  const entry = (transactionId: string, amount: number, reason: TransactionReason) => ({
+    entryId: `entry-${transactionId}`,
+    transactionId,
+    accountId: 'user-1',
+    accountType: 'user',
+    amount,
+    type: amount > 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    reason,
+    idempotencyKey: `key-${transactionId}`,
+    currency: 'points',
+    timestamp: new Date(),
+  });
+
+  // What the ledger says the user holds
+  const balance = () =>
+    entries
+      .filter(e => e.accountId === 'user-1' && e.balanceState === 'available')
+      .reduce((sum, e) => sum + e.amount, 0);
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    entries = [
+      entry('tx-earn', 500, TransactionReason.PURCHASE_EARN),
+      entry('tx-spend', -300, TransactionReason.CHIP_MENU_PURCHASE),
+    ];
+
+    mockLedgerService = {
+      getAuditTrail: jest.fn().mockImplementation(async (transactionId: string) =>
+        entries
+          .filter(e => e.transactionId === transactionId)
+          .map(e => ({ auditId: e.entryId, ledgerEntry: e, auditedAt: e.timestamp }))
+      ),
+      getBalanceSnapshot: jest.fn().mockImplementation(async () => ({ availableBalance: balance() })),
+      // Unique idempotency key index: the first insert wins, later calls replay it
+      createEntryWithResult: jest.fn().mockImplementation(async (request: any) => {
+        const existing = entries.find(e => e.idempotencyKey === request.idempotencyKey);
+        if (existing) {
+          return { entry: existing, inserted: false };
+        }
+        const created = { entryId: `entry-${entries.length + 1}`, timestamp: new Date(), ...request };
+        entries.push(created);
+        return { entry: created, inserted: true };
+      }),
+    };
+    appliedKeys = new Set();
+    // One application per key, as the wallet_applications unique index enforces
+    (applyWalletDelta as jest.Mock).mockImplementation(async (_userId: string, _delta: number, key: string) => {
+      if (appliedKeys.has(key)) {
+        return false;
+      }
+      appliedKeys.add(key);
+      return true;
+    });
+
+    service = new TransactionCorrectionService(mockLedgerService as any);
+  });
+
+  it('should reverse the original and record the corrected amount', async () => {
+    const { reversal, correction } = await service.correctTransaction(
+      'tx-earn', 350, 'ops:alice', 'earn rate misconfigured'
+    );
+
+    const link = {
+      correctionOf: 'tx-earn',
+      originalEntryId: 'entry-tx-earn',
+      correctionReason: 'earn rate misconfigured',
+      committedBy: 'ops:alice',
+    };
+    expect(reversal).toMatchObject({
+      transactionId: 'correction-tx-earn',
+      amount: -500,
+      type: TransactionType.DEBIT,
+      reason: TransactionReason.CORRECTION_REVERSAL,
+      balanceBefore: 200,
+      balanceAfter: -300,
+      metadata: link,
+    });
+    expect(correction).toMatchObject({
+      transactionId: 'correction-tx-earn',
+      amount: 350,
+      type: TransactionType.CREDIT,
+      reason: TransactionReason.PURCHASE_EARN,
+      balanceBefore: -300,
+      balanceAfter: 50,
+      correlationId: 'correction-tx-earn',
+      metadata: link,
+    });
+
+    // The original stays; the three entries net to the corrected amount
+    expect(entries.find(e => e.transactionId === 'tx-earn')).toMatchObject({ amount: 500 });
+    expect([500, reversal.amount, correction.amount].reduce((a, b) => a + b, 0)).toBe(350);
+    expect(balance()).toBe(350 - 300);
+    expect(applyWalletDelta).toHaveBeenCalledWith('user-1', -150, 'correction-tx-earn');
+  });
+
+  it('should correct a debit with a debit', async () => {
+    const { reversal, correction } = await service.correctTransaction('tx-spend', 200, 'ops:alice', 'price error');
+
+    expect(reversal).toMatchObject({ amount: 300, type: TransactionType.CREDIT });
+    expect(correction).toMatchObject({ amount: -200, type: TransactionType.DEBIT, reason: TransactionReason.CHIP_MENU_PURCHASE });
+    expect(balance()).toBe(500 - 200);
+  });
+
+  it('should reject a second correction of the same transaction', async () => {
+    await service.correctTransaction('tx-earn', 350, 'ops:alice', 'earn rate misconfigured');
+    const count = entries.length;
+
+    const second = service.correctTransaction('tx-earn', 400, 'ops:bob', 'second opinion');
+
+    await expect(second).rejects.toThrow(TransactionAlreadyCorrectedError);
+    await expect(second).rejects.toMatchObject({
+      details: { transactionId: 'tx-earn', correctionTransactionId: 'correction-tx-earn' },
+    });
+    expect(entries).toHaveLength(count);
+    expect(balance()).toBe(50);
+    expect(appliedKeys).toEqual(new Set(['correction-tx-earn']));
+  });
+
+  it('should reject the loser of two concurrent corrections', async () => {
+    const results = await Promise.allSettled([
+      service.correctTransaction('tx-earn', 350, 'ops:alice', 'a'),
+      service.correctTransaction('tx-earn', 400, 'ops:bob', 'b'),
+    ]);
+
+    expect(results.map(r => r.status).sort()).toEqual(['fulfilled', 'rejected']);
+    expect((results.find(r => r.status === 'rejected') as PromiseRejectedResult).reason).toBeInstanceOf(
+      TransactionAlreadyCorrectedError
+    );
+    expect(entries.filter(e => e.transactionId === 'correction-tx-earn')).toHaveLength(2);
+    expect(appliedKeys).toEqual(new Set(['correction-tx-earn']));
+  });
+
+  it('should complete a correction interrupted after its reversal', async () => {
+    const append = mockLedgerService.createEntryWithResult.getMockImplementation()!;
+    mockLedgerService.createEntryWithResult
+      .mockImplementationOnce(append)
+      .mockRejectedValueOnce(new Error('write timeout'));
+    await expect(service.correctTransaction('tx-earn', 350, 'ops:alice', 'x')).rejects.toThrow('write timeout');
+    expect(applyWalletDelta).not.toHaveBeenCalled();
+
+    const { correction } = await service.correctTransaction('tx-earn', 350, 'ops:alice', 'x');
+
+    expect(entries.filter(e => e.reason === TransactionReason.CORRECTION_REVERSAL)).toHaveLength(1);
+    expect(correction).toMatchObject({ balanceBefore: -300, balanceAfter: 50 });
+    expect(balance()).toBe(50);
+    expect(applyWalletDelta).toHaveBeenCalledWith('user-1', -150, 'correction-tx-earn');
+  });
+
+  it('should move the wallet for a correction recorded before an interruption', async () => {
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.correctTransaction('tx-earn', 350, 'ops:alice', 'x')).rejects.toThrow('connection reset');
+
+    const { correction } = await service.correctTransaction('tx-earn', 350, 'ops:alice', 'x');
+
+    expect(correction).toMatchObject({ amount: 350, balanceAfter: 50 });
+    expect(entries.filter(e => e.transactionId === 'correction-tx-earn')).toHaveLength(2);
+    expect(appliedKeys).toEqual(new Set(['correction-tx-earn']));
+  });
+
+  it('should complete but not return a recorded correction of another amount', async () => {
+    (applyWalletDelta as jest.Mock).mockRejectedValueOnce(new Error('connection reset'));
+    await expect(service.correctTransaction('tx-earn', 350, 'ops:alice', 'x')).rejects.toThrow('connection reset');
+
+    await expect(service.correctTransaction('tx-earn', 400, 'ops:bob', 'y')).rejects.toThrow(
+      TransactionAlreadyCorrectedError
+    );
+    expect(appliedKeys).toEqual(new Set(['correction-tx-earn']));
+  });
+
+  it('should correct a correction through its own transaction', async () => {
+    await service.correctTransaction('tx-earn', 350, 'ops:alice', 'first fix');
+
+    const { correction } = await service.correctTransaction('correction-tx-earn', 450, 'ops:bob', 'first fix was off');
+
+    expect(correction).toMatchObject({ transactionId: 'correction-correction-tx-earn', amount: 450 });
+    expect(balance()).toBe(450 - 300);
+  });
+
+  it('should refuse a correction that would overdraw the balance', async () => {
+    const correcting = service.correctTransaction('tx-earn', 100, 'ops:alice', 'x');
+
+    await expect(correcting).rejects.toThrow(InsufficientBalanceError);
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+  });
+
+  it('should validate the request', async () => {
+    await expect(service.correctTransaction('tx-earn', 0, 'ops:alice', 'x')).rejects.toThrow(InvalidPointAmountError);
+    await expect(service.correctTransaction('tx-earn', 1.5, 'ops:alice', 'x')).rejects.toThrow(InvalidPointAmountError);
+    await expect(service.correctTransaction('tx-earn', 500, 'ops:alice', 'x')).rejects.toThrow('already has amount 500');
+    await expect(service.correctTransaction('tx-missing', 10, 'ops:alice', 'x')).rejects.toThrow('Transaction not found');
+    await expect(service.correctTransaction('tx-earn', 10, '', 'x')).rejects.toThrow('required');
+    expect(mockLedgerService.createEntryWithResult).not.toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,222 @@
+/**
+ * Transaction Correction Service
+ *
+ * Corrects the amount of a recorded transaction without touching it.
+ * A correction appends two entries under the transaction ID
+ * `correction-<transactionId>`: a CORRECTION_REVERSAL that negates the
+ * original's available-balance entry, then a correcting entry of the
+ * original's type and reason for the intended amount. Both carry the original transaction and entry IDs
+ * in their metadata, and the correction's transaction ID doubles as its
+ * correlation ID, so the audit trail joins all three.
+ *
+ * Each entry has a deterministic idempotency key derived from the
+ * original transaction ID. The correcting entry's key is the claim: the
+ * ledger's unique key index lets a transaction be corrected at most once,
+ * and every later attempt is rejected with TransactionAlreadyCorrectedError.
+ * The wallet moves once, by the net of both entries, through
+ * applyWalletDelta under the correcting entry's key. A correction
+ * interrupted between its two appends, or after them but before the
+ * wallet moved, is completed by the next attempt; the attempt returns
+ * the correction only if it asked for the recorded amount. To correct a
+ * correction, correct the correction's own transaction.
+ *
+ * @module services/transaction-correction
+ */
+
+import { LedgerEntry } from '../ledger/types';
+import { LedgerService } from '../ledger/ledger.service';
+import { applyWalletDelta } from '../wallets/wallet-application';
+import { InsufficientBalanceError, InvalidPointAmountError, TransactionAlreadyCorrectedError } from './types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+/**
+ * Configuration for the transaction correction service
+ */
+export interface TransactionCorrectionConfig {
+  /** Currency stamped on correction entries */
+  defaultCurrency: string;
+}
+
+const DEFAULT_CONFIG: TransactionCorrectionConfig = {
+  defaultCurrency: 'points',
+};
+
+/**
+ * Entries appended by a correction
+ */
+export interface TransactionCorrection {
+  /** Negates the original entry */
+  reversal: LedgerEntry;
+
+  /** Records the intended amount */
+  correction: LedgerEntry;
+}
+
+type CorrectionLedger = Pick<LedgerService, 'createEntryWithResult' | 'getAuditTrail' | 'getBalanceSnapshot'>;
+
+/**
+ * Transaction Correction Service Implementation
+ */
+export class TransactionCorrectionService {
+  private config: TransactionCorrectionConfig;
+  private ledgerService: CorrectionLedger;
+
+  constructor(ledgerService: CorrectionLedger, config: Partial<TransactionCorrectionConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Supersede a transaction's amount, keeping the original in the ledger
+   *
+   * @param originalTransactionId Transaction ID of the entry to correct
+   * @param newAmount Intended magnitude; the correction keeps the original's type
+   * @param committedBy Operator recording the correction
+   * @param reason Why the original amount was wrong
+   * @returns The reversal and the correcting entry
+   * @throws InvalidPointAmountError if newAmount is not a positive integer
+   * @throws TransactionAlreadyCorrectedError if the transaction was already corrected
+   * @throws InsufficientBalanceError if the correction would leave the balance negative
+   * @throws Error if the transaction is missing or already has that amount
+   */
+  async correctTransaction(
+    originalTransactionId: string,
+    newAmount: number,
+    committedBy: string,
+    reason: string
+  ): Promise<TransactionCorrection> {
+    if (!originalTransactionId || !committedBy || !reason) {
+      throw new Error('originalTransactionId, committedBy and reason are required');
+    }
+    if (!Number.isSafeInteger(newAmount) || newAmount < 1) {
+      throw new InvalidPointAmountError(newAmount, 'must be a positive integer');
+    }
+
+    const original = await this.findOriginal(originalTransactionId);
+    if (Math.abs(original.amount) === newAmount) {
+      throw new Error(`Transaction ${originalTransactionId} already has amount ${newAmount}`);
+    }
+
+    // Both entries form one transaction, so its trail shows how far an earlier attempt got
+    const correctionTransactionId = `correction-${originalTransactionId}`;
+    const trail = (await this.ledgerService.getAuditTrail(correctionTransactionId)).map(audit => audit.ledgerEntry);
+    const recorded = trail.find(entry => entry.reason !== TransactionReason.CORRECTION_REVERSAL);
+    if (recorded) {
+      const recordedReversal = trail.find(entry => entry.reason === TransactionReason.CORRECTION_REVERSAL);
+      // Both entries landed; re-drive the wallet in case that attempt stopped before it
+      const applied = recordedReversal ? await this.applyToWallet(recordedReversal, recorded) : false;
+      if (applied && Math.abs(recorded.amount) === newAmount) {
+        return { reversal: recordedReversal!, correction: recorded };
+      }
+      throw new TransactionAlreadyCorrectedError(originalTransactionId, correctionTransactionId);
+    }
+    const pendingReversal = trail.length > 0;
+
+    const credit = original.type === TransactionType.CREDIT;
+    const correctedAmount = credit ? newAmount : -newAmount;
+    const before = await this.ledgerService.getBalanceSnapshot(original.accountId, 'user');
+    const delta = correctedAmount - original.amount;
+
+    // The snapshot already reflects a reversal left by an interrupted attempt
+    const remainingDelta = pendingReversal ? correctedAmount : delta;
+    if (before.availableBalance + remainingDelta < 0) {
+      throw new InsufficientBalanceError(-remainingDelta, before.availableBalance);
+    }
+
+    const link = {
+      correctionOf: originalTransactionId,
+      originalEntryId: original.entryId,
+      correctionReason: reason,
+      committedBy,
+    };
+    const common = {
+      transactionId: correctionTransactionId,
+      accountId: original.accountId,
+      accountType: 'user' as const,
+      balanceState: 'available' as const,
+      currency: original.currency || this.config.defaultCurrency,
+      correlationId: correctionTransactionId,
+      requestId: correctionTransactionId,
+      metadata: link,
+    };
+
+    // Replays the reversal of an interrupted attempt without moving the balance again
+    const { entry: reversal } = await this.ledgerService.createEntryWithResult({
+      ...common,
+      amount: -original.amount,
+      type: credit ? TransactionType.DEBIT : TransactionType.CREDIT,
+      stateTransition: credit ? 'available→none' : 'none→available',
+      reason: TransactionReason.CORRECTION_REVERSAL,
+      idempotencyKey: `correction-reversal-${originalTransactionId}`,
+      balanceBefore: before.availableBalance,
+      balanceAfter: before.availableBalance - original.amount,
+    });
+
+    const afterReversal = pendingReversal ? before.availableBalance : reversal.balanceAfter;
+    const { entry: correction, inserted } = await this.ledgerService.createEntryWithResult({
+      ...common,
+      amount: correctedAmount,
+      type: original.type,
+      stateTransition: credit ? 'none→available' : 'available→none',
+      reason: original.reason,
+      idempotencyKey: correctionTransactionId,
+      balanceBefore: afterReversal,
+      balanceAfter: afterReversal + correctedAmount,
+      featureType: original.featureType,
+    });
+
+    // The wallet moves once, after both entries are recorded
+    const applied = await this.applyToWallet(reversal, correction);
+
+    // A concurrent attempt claimed the correction first; it is only this
+    // attempt's if it was for the same amount and had not moved the wallet
+    if (!inserted && (!applied || Math.abs(correction.amount) !== newAmount)) {
+      throw new TransactionAlreadyCorrectedError(originalTransactionId, correction.transactionId);
+    }
+
+    return { reversal, correction };
+  }
+
+  /**
+   * Move the wallet by a correction's net, once per correction
+   *
+   * @returns Whether this call moved it
+   */
+  private applyToWallet(reversal: LedgerEntry, correction: LedgerEntry): Promise<boolean> {
+    return applyWalletDelta(correction.accountId, reversal.amount + correction.amount, correction.idempotencyKey);
+  }
+
+  /**
+   * The user's available-balance entry of a transaction, passing over
+   * the reversal when the transaction is itself a correction
+   */
+  private async findOriginal(transactionId: string): Promise<LedgerEntry> {
+    const trail = await this.ledgerService.getAuditTrail(transactionId);
+    const candidates = trail
+      .map(audit => audit.ledgerEntry)
+      .filter(
+        entry =>
+          entry.accountType === 'user' &&
+          entry.balanceState === 'available' &&
+          entry.reason !== TransactionReason.CORRECTION_REVERSAL
+      );
+
+    if (candidates.length === 0) {
+      throw new Error(`Transaction not found: ${transactionId}`);
+    }
+    if (candidates.length > 1) {
+      throw new Error(`Transaction ${transactionId} moves more than one available balance entry`);
+    }
+    return candidates[0];
+  }
+}
+
+/**
+ * Factory function to create a transaction correction service
+ */
+export function createTransactionCorrectionService(
+  ledgerService: CorrectionLedger,
+  config?: Partial<TransactionCorrectionConfig>
+): TransactionCorrectionService {
+  return new TransactionCorrectionService(ledgerService, config);
+}
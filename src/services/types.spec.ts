@@ -0,0 +1,95 @@
+/**
+ * Service Error Classification Tests
+ */
+
+import {
+  AccountFrozenError,
+  AppendErrorCode,
+  AppendValidationError,
+  CrossTenantError,
+  DailyEarnCapExceededError,
+  DuplicateReferenceError,
+  IdempotencyConflictError,
+  IdempotencyKeyRejectedError,
+  MissingGroupIdError,
+  MissingAdjustReasonError,
+  ReferenceFormatError,
+  ReferenceOverdrawnError,
+  InsufficientBalanceError,
+  InvalidPointAmountError,
+  IssuerQuotaExceededError,
+  LedgerAppendError,
+  LedgerInconsistencyError,
+  MaintenanceModeError,
+  MirrorWriteError,
+  OptimisticLockError,
+  QuorumWriteError,
+  RedemptionVelocityError,
+  ReferenceLimitExceededError,
+  ReplayContentConflictError,
+  TimestampRegressionError,
+  UnauthorizedCommitterError,
+  WriteQueueFullError,
+  isRetryableAppendError,
+} from './types';
+
+const wrap = (error: unknown) => LedgerAppendError.from(error, { idempotencyKey: 'key-1' });
+
+const timeout = Object.assign(new Error('operation exceeded time limit'), { name: 'MongoServerSelectionError' });
+const uniqueViolation = Object.assign(new Error('E11000 duplicate key error'), { code: 11000 });
+
+describe('isRetryableAppendError', () => {
+  it.each<[string, unknown]>([
+    ['velocity limit', new RedemptionVelocityError('user-1', 'hourly', 3, 4)],
+    ['reference limit', new ReferenceLimitExceededError('ref-1', 'earns', 3, 4)],
+    ['issuer quota', new IssuerQuotaExceededError('issuer-1', 'points', 1000, 1200)],
+    ['daily earn cap', new DailyEarnCapExceededError('user-1', new Date(0), 1000, 1200)],
+    ['maintenance mode', new MaintenanceModeError('read_only', 'migrating', 30)],
+    ['missed quorum', new QuorumWriteError('key-1', 2, ['a'], [{ name: 'b', error: 'timeout' }])],
+    ['failed mirror', new MirrorWriteError('entry-1', 'archive', 'timeout')],
+    ['optimistic lock', new OptimisticLockError('wallet', 'user-1')],
+    ['full write queue', new WriteQueueFullError(1000)],
+    ['driver timeout', timeout],
+    ['dropped connection', new Error('connection reset')],
+  ])('retries %s', (_, error) => {
+    expect(isRetryableAppendError(error)).toBe(true);
+    expect(isRetryableAppendError(wrap(error))).toBe(true);
+  });
+
+  it.each<[string, unknown]>([
+    ['idempotency conflict', new IdempotencyConflictError('key-1', {})],
+    ['replay content conflict', new ReplayContentConflictError('key-1', 'entry-1', ['amount'])],
+    ['duplicate reference', new DuplicateReferenceError('user-1', 'order-1', new Date())],
+    ['overdraft', new InsufficientBalanceError(500, 100)],
+    ['overdrawn reference', new ReferenceOverdrawnError('promo-1', 50, -80)],
+    ['invalid amount', new InvalidPointAmountError(1.5, 'not an integer')],
+    ['malformed idempotency key', new IdempotencyKeyRejectedError(new Error('not a ULID'))],
+    ['missing group ID', new MissingGroupIdError('key-1')],
+    ['missing adjustment comment', new MissingAdjustReasonError('key-1', 'admin_debit')],
+    ['malformed reference', new ReferenceFormatError('ord-1', 'credit')],
+    ['schema validation', Object.assign(new Error('validation failed'), { name: 'ValidationError' })],
+    ['rejected validator', new AppendValidationError('amount-cap', new Error('too large'))],
+    ['cross tenant', new CrossTenantError('tenant-a', 'tenant-b')],
+    ['timestamp regression', new TimestampRegressionError(new Date(1), new Date(2))],
+    ['unauthorized committer', new UnauthorizedCommitterError('svc:rogue')],
+    ['frozen account', new AccountFrozenError('user-1')],
+    ['ledger inconsistency', new LedgerInconsistencyError('balance drift')],
+    ['unique index violation', uniqueViolation],
+  ])('dead-letters %s', (_, error) => {
+    expect(isRetryableAppendError(error)).toBe(false);
+    expect(isRetryableAppendError(wrap(error))).toBe(false);
+  });
+
+  it('classifies by append code when the cause is untyped', () => {
+    expect(isRetryableAppendError(new LedgerAppendError(AppendErrorCode.STORAGE, 'k', new Error('x')))).toBe(true);
+    expect(isRetryableAppendError(new LedgerAppendError(AppendErrorCode.RATE_LIMITED, 'k', new Error('x')))).toBe(true);
+    expect(isRetryableAppendError(new LedgerAppendError(AppendErrorCode.INVALID, 'k', new Error('x')))).toBe(false);
+    expect(isRetryableAppendError(new LedgerAppendError(AppendErrorCode.OVERDRAFT, 'k', new Error('x')))).toBe(false);
+  });
+
+  it('finds an append failure further down the cause chain', () => {
+    const outer = new Error('earn failed', { cause: wrap(new InsufficientBalanceError(500, 100)) });
+
+    expect(isRetryableAppendError(outer)).toBe(false);
+  });
+});
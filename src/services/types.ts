@@ -420,6 +420,36 @@ export class EscrowNotFoundError extends WalletServiceError {
   }
 }
 
+/**
+ * Error thrown when a transaction holds no redemption
+ */
+export class RedemptionNotFoundError extends WalletServiceError {
+  constructor(transactionId: string) {
+    super(
+      `Redemption not found: ${transactionId}`,
+      'REDEMPTION_NOT_FOUND',
+      404,
+      { transactionId }
+    );
+    this.name = 'RedemptionNotFoundError';
+  }
+}
+
+/**
+ * Error thrown when an entry is not in the account's history
+ */
+export class EntryNotFoundError extends WalletServiceError {
+  constructor(entryId: string, accountId: string) {
+    super(
+      `Entry ${entryId} not found for account ${accountId}`,
+      'ENTRY_NOT_FOUND',
+      404,
+      { entryId, accountId }
+    );
+    this.name = 'EntryNotFoundError';
+  }
+}
+
 export class EscrowAlreadyProcessedError extends WalletServiceError {
   constructor(escrowId: string, status: string) {
     super(
@@ -467,6 +497,863 @@ export class IdempotencyConflictError extends WalletServiceError {
   }
 }
 
+/**
+ * Error thrown when a replayed idempotency key carries a different
+ * transaction than the entry already recorded under it
+ */
+export class ReplayContentConflictError extends WalletServiceError {
+  constructor(key: string, entryId: string, fields: string[]) {
+    super(
+      `Idempotency key ${key} is already recorded as entry ${entryId} with different ${fields.join(', ')}`,
+      'REPLAY_CONTENT_CONFLICT',
+      409,
+      { key, entryId, fields }
+    );
+    this.name = 'ReplayContentConflictError';
+  }
+}
+
+/**
+ * Error thrown when a wallet application key is reused to move a
+ * different wallet or amount than the one it already applied
+ */
+export class WalletApplicationConflictError extends WalletServiceError {
+  constructor(key: string, fields: string[]) {
+    super(
+      `Wallet application ${key} already applied a different ${fields.join(', ')}`,
+      'WALLET_APPLICATION_CONFLICT',
+      409,
+      { key, fields }
+    );
+    this.name = 'WalletApplicationConflictError';
+  }
+}
+
+export class RedemptionVelocityError extends WalletServiceError {
+  constructor(userId: string, rule: string, limit: number, observed: number) {
+    super(
+      `Redemption velocity limit exceeded for ${userId}: ${rule} (limit: ${limit}, observed: ${observed})`,
+      'REDEMPTION_VELOCITY',
+      429,
+      { userId, rule, limit, observed }
+    );
+    this.name = 'RedemptionVelocityError';
+  }
+}
+
+export class AccountAlreadyMergedError extends WalletServiceError {
+  constructor(userId: string, mergedInto: string) {
+    super(
+      `Account already merged: ${userId} (merged into: ${mergedInto})`,
+      'ACCOUNT_ALREADY_MERGED',
+      409,
+      { userId, mergedInto }
+    );
+    this.name = 'AccountAlreadyMergedError';
+  }
+}
+
+export class AccountFrozenError extends WalletServiceError {
+  constructor(userId: string) {
+    super(
+      `Account is frozen: ${userId}`,
+      'ACCOUNT_FROZEN',
+      423,
+      { userId }
+    );
+    this.name = 'AccountFrozenError';
+  }
+}
+
+export class CrossTenantError extends WalletServiceError {
+  constructor(scopedTenantId: string | undefined, requestedTenantId: string | undefined) {
+    super(
+      `Cross-tenant access rejected (scope: ${scopedTenantId ?? 'none'}, requested: ${requestedTenantId ?? 'none'})`,
+      'CROSS_TENANT',
+      403,
+      { scopedTenantId, requestedTenantId }
+    );
+    this.name = 'CrossTenantError';
+  }
+}
+
+export class TagNotIndexedError extends WalletServiceError {
+  constructor(key: string) {
+    super(
+      `Tag key is not indexed: ${key}`,
+      'TAG_NOT_INDEXED',
+      400,
+      { key }
+    );
+    this.name = 'TagNotIndexedError';
+  }
+}
+
+export class MaintenanceModeError extends WalletServiceError {
+  constructor(mode: string, operatorMessage: string, retryAfterSeconds?: number) {
+    super(
+      `Ledger writes are unavailable (${mode}): ${operatorMessage}`,
+      'MAINTENANCE_MODE',
+      503,
+      { mode, operatorMessage, retryAfterSeconds }
+    );
+    this.name = 'MaintenanceModeError';
+  }
+}
+
+export class LedgerModeMismatchError extends WalletServiceError {
+  constructor(configuredMode: string, ledgerMode: string) {
+    super(
+      `Ledger was initialised in ${ledgerMode}-entry mode and cannot be posted to in ${configuredMode}-entry mode`,
+      'LEDGER_MODE_MISMATCH',
+      409,
+      { configuredMode, ledgerMode }
+    );
+    this.name = 'LedgerModeMismatchError';
+  }
+}
+
+export class LedgerInconsistencyError extends WalletServiceError {
+  constructor(message: string, details?: Record<string, any>) {
+    super(message, 'LEDGER_INCONSISTENT', 500, details);
+    this.name = 'LedgerInconsistencyError';
+  }
+}
+
+export class DuplicateReferenceError extends WalletServiceError {
+  constructor(userId: string, reference: string, firstSeenAt: Date) {
+    super(
+      `Duplicate earn reference for ${userId}: ${reference} (first seen: ${firstSeenAt.toISOString()})`,
+      'DUPLICATE_REFERENCE',
+      409,
+      { userId, reference, firstSeenAt }
+    );
+    this.name = 'DuplicateReferenceError';
+  }
+}
+
+export class InvalidPointAmountError extends WalletServiceError {
+  constructor(value: string | number, reason: string) {
+    super(
+      `Invalid point amount ${JSON.stringify(value)}: ${reason}`,
+      'INVALID_POINT_AMOUNT',
+      400,
+      { value, reason }
+    );
+    this.name = 'InvalidPointAmountError';
+  }
+}
+
+export class MirrorWriteError extends WalletServiceError {
+  constructor(entryId: string, route: string, cause: string, entry?: any) {
+    super(
+      `Entry ${entryId} was written to the primary ledger but not mirrored to ${route}: ${cause}`,
+      'MIRROR_WRITE_FAILED',
+      502,
+      { entryId, route, cause, entry }
+    );
+    this.name = 'MirrorWriteError';
+  }
+}
+
+export class QuorumWriteError extends WalletServiceError {
+  /**
+   * @param stamped The entryId and timestamp sent to every replica, for a
+   *   retry to reuse; absent for writes that are not entries
+   */
+  constructor(
+    idempotencyKey: string,
+    writeQuorum: number,
+    acknowledged: string[],
+    failed: { name: string; error: string }[],
+    stamped?: { entryId: string; timestamp: Date }
+  ) {
+    super(
+      `Entry ${idempotencyKey} acknowledged by ${acknowledged.length} of ${writeQuorum} required replicas`,
+      'QUORUM_WRITE_FAILED',
+      503,
+      { idempotencyKey, writeQuorum, acknowledged, failed, ...stamped }
+    );
+    this.name = 'QuorumWriteError';
+  }
+}
+
+/**
+ * Error thrown when too few replicas answer a quorum read
+ */
+export class QuorumReadError extends WalletServiceError {
+  constructor(operation: string, readQuorum: number, responded: string[], failed: { name: string; error: string }[]) {
+    super(
+      `${operation} answered by ${responded.length} of ${readQuorum} required replicas`,
+      'QUORUM_READ_FAILED',
+      503,
+      { operation, readQuorum, responded, failed }
+    );
+    this.name = 'QuorumReadError';
+  }
+}
+
+export class RewardSoldOutError extends WalletServiceError {
+  constructor(itemId: string) {
+    super(`Reward ${itemId} is sold out`, 'REWARD_SOLD_OUT', 409, { itemId });
+    this.name = 'RewardSoldOutError';
+  }
+}
+
+export class ReservationNotActiveError extends WalletServiceError {
+  constructor(reservationId: string, status: string) {
+    super(
+      `Reservation ${reservationId} is not active: ${status}`,
+      'RESERVATION_NOT_ACTIVE',
+      409,
+      { reservationId, status }
+    );
+    this.name = 'ReservationNotActiveError';
+  }
+}
+
+/**
+ * Error thrown when a gift would take the sender past their monthly
+ * gifting limit
+ */
+export class GiftLimitExceededError extends WalletServiceError {
+  constructor(userId: string, limit: number, used: number, requested: number) {
+    super(
+      `Gift limit exceeded for ${userId}: ${used} of ${limit} points used this month, ${requested} requested`,
+      'GIFT_LIMIT_EXCEEDED',
+      429,
+      { userId, limit, used, requested }
+    );
+    this.name = 'GiftLimitExceededError';
+  }
+}
+
+export class GiftNotPendingError extends WalletServiceError {
+  constructor(giftId: string, state: string) {
+    super(`Gift ${giftId} is not pending: ${state}`, 'GIFT_NOT_PENDING', 409, { giftId, state });
+    this.name = 'GiftNotPendingError';
+  }
+}
+
+/**
+ * Error thrown when one ingestion batch holds the same purchase twice
+ * under different event IDs
+ */
+export class DuplicateInBatchError extends WalletServiceError {
+  /**
+   * @param duplicates Event IDs of each group of identical events, in batch order
+   */
+  constructor(duplicates: string[][]) {
+    super(
+      `Batch holds duplicate events: ${duplicates.map(group => group.join(' = ')).join('; ')}`,
+      'DUPLICATE_IN_BATCH',
+      400,
+      { duplicates }
+    );
+    this.name = 'DuplicateInBatchError';
+  }
+}
+
+/**
+ * Error thrown when an entry added to a ledger batch reuses the
+ * idempotency key of an entry already in the batch
+ */
+export class DuplicateBatchEntryError extends WalletServiceError {
+  /**
+   * @param index Position the duplicate would have taken in the batch
+   * @param firstIndex Position of the entry already holding the key
+   */
+  constructor(batchId: string, idempotencyKey: string, index: number, firstIndex: number) {
+    super(
+      `Batch ${batchId} already holds idempotency key ${idempotencyKey} at entry ${firstIndex}`,
+      'DUPLICATE_BATCH_ENTRY',
+      400,
+      { batchId, idempotencyKey, index, firstIndex }
+    );
+    this.name = 'DuplicateBatchEntryError';
+  }
+}
+
+/**
+ * Error thrown when the legs passed to appendGroup cannot form a group
+ */
+export class InvalidLedgerGroupError extends WalletServiceError {
+  constructor(message: string, details?: Record<string, any>) {
+    super(message, 'INVALID_LEDGER_GROUP', 400, details);
+    this.name = 'InvalidLedgerGroupError';
+  }
+}
+
+/**
+ * Error thrown when a ledger that requires group IDs is given an entry
+ * without one
+ */
+export class MissingGroupIdError extends WalletServiceError {
+  constructor(idempotencyKey: string) {
+    super(
+      `Entry ${idempotencyKey} has no group ID; this ledger requires one`,
+      'MISSING_GROUP_ID',
+      400,
+      { idempotencyKey }
+    );
+    this.name = 'MissingGroupIdError';
+  }
+}
+
+/**
+ * Error thrown when a ledger that requires adjustment comments is given a
+ * manual adjustment without one
+ */
+export class MissingAdjustReasonError extends WalletServiceError {
+  constructor(idempotencyKey: string, reason: string) {
+    super(
+      `Adjustment ${idempotencyKey} (${reason}) has no comment; this ledger requires one`,
+      'MISSING_ADJUST_REASON',
+      400,
+      { idempotencyKey, reason }
+    );
+    this.name = 'MissingAdjustReasonError';
+  }
+}
+
+/**
+ * Error thrown when a reference does not match the pattern configured
+ * for its transaction type
+ */
+export class ReferenceFormatError extends WalletServiceError {
+  constructor(reference: string, type: string) {
+    super(
+      `Reference ${reference} is not a valid ${type} reference`,
+      'REFERENCE_FORMAT',
+      400,
+      { reference, type }
+    );
+    this.name = 'ReferenceFormatError';
+  }
+}
+
+/**
+ * Error thrown when an earn rule yields an amount that cannot be awarded
+ * A misconfigured rule, not a bad event.
+ */
+export class InvalidEarnAwardError extends WalletServiceError {
+  constructor(ruleId: string, points: number) {
+    super(
+      `Earn rule ${ruleId} yielded an invalid award: ${points}`,
+      'INVALID_EARN_AWARD',
+      500,
+      { ruleId, points }
+    );
+    this.name = 'InvalidEarnAwardError';
+  }
+}
+
+/**
+ * Error thrown when the user ID tokenizer rejects an identifier, carrying
+ * the tokenizer's error as `cause`
+ * The identifier itself is not included.
+ */
+export class UserIdRejectedError extends WalletServiceError {
+  constructor(cause: unknown) {
+    super(
+      `User ID rejected by tokenizer: ${cause instanceof Error ? cause.message : String(cause)}`,
+      'USER_ID_REJECTED',
+      400
+    );
+    this.name = 'UserIdRejectedError';
+    this.cause = cause;
+  }
+}
+
+/**
+ * Error thrown when the configured idempotency key validator rejects a
+ * key, carrying the validator's error as `cause`
+ */
+export class IdempotencyKeyRejectedError extends WalletServiceError {
+  constructor(cause: unknown) {
+    super(
+      `Idempotency key rejected: ${cause instanceof Error ? cause.message : String(cause)}`,
+      'IDEMPOTENCY_KEY_REJECTED',
+      400
+    );
+    this.name = 'IdempotencyKeyRejectedError';
+    this.cause = cause;
+  }
+}
+
+/**
+ * Error thrown when a pagination cursor cannot be decoded
+ */
+export class InvalidCursorError extends WalletServiceError {
+  constructor(cursor: string) {
+    super(`Invalid cursor: ${cursor}`, 'INVALID_CURSOR', 400, { cursor });
+    this.name = 'InvalidCursorError';
+  }
+}
+
+export class InvalidTimeRangeError extends WalletServiceError {
+  constructor(from: Date, to: Date) {
+    super(
+      `Invalid time range: ${from.toISOString()} is after ${to.toISOString()}`,
+      'INVALID_TIME_RANGE',
+      400,
+      { from, to }
+    );
+    this.name = 'InvalidTimeRangeError';
+  }
+}
+
+export class TimestampRegressionError extends WalletServiceError {
+  constructor(timestamp: Date, lastTimestamp: Date) {
+    super(
+      `Entry timestamp ${timestamp.toISOString()} is earlier than the last appended entry (${lastTimestamp.toISOString()})`,
+      'TIMESTAMP_REGRESSION',
+      409,
+      { timestamp, lastTimestamp }
+    );
+    this.name = 'TimestampRegressionError';
+  }
+}
+
+export class DisputeStateError extends WalletServiceError {
+  constructor(entryId: string, state: string, action: string) {
+    super(
+      `Cannot ${action} dispute for entry ${entryId}: dispute is ${state}`,
+      'DISPUTE_STATE_CONFLICT',
+      409,
+      { entryId, state, action }
+    );
+    this.name = 'DisputeStateError';
+  }
+}
+
+export class ReferenceLimitExceededError extends WalletServiceError {
+  constructor(reference: string, limit: 'earns' | 'points', max: number, observed: number) {
+    super(
+      `Earn limit exceeded for reference ${reference}: ${limit} (limit: ${max}, observed: ${observed})`,
+      'REFERENCE_LIMIT_EXCEEDED',
+      429,
+      { reference, limit, max, observed }
+    );
+    this.name = 'ReferenceLimitExceededError';
+  }
+}
+
+/**
+ * Error thrown when a debit would take a balance-constrained reference's
+ * net below zero
+ */
+export class ReferenceOverdrawnError extends WalletServiceError {
+  /**
+   * @param net Net of the reference's entries before the debit
+   * @param amount Signed amount of the rejected debit
+   */
+  constructor(reference: string, net: number, amount: number) {
+    super(
+      `Debit of ${-amount} would overdraw reference ${reference} (net: ${net})`,
+      'REFERENCE_OVERDRAWN',
+      402,
+      { reference, net, amount }
+    );
+    this.name = 'ReferenceOverdrawnError';
+  }
+}
+
+/**
+ * Error thrown when a write queue is full and set to reject
+ */
+export class WriteQueueFullError extends WalletServiceError {
+  constructor(maxDepth: number) {
+    super(
+      `Write queue is full (max depth: ${maxDepth})`,
+      'WRITE_QUEUE_FULL',
+      429,
+      { maxDepth }
+    );
+    this.name = 'WriteQueueFullError';
+  }
+}
+
+export class DailyEarnCapExceededError extends WalletServiceError {
+  constructor(userId: string, day: Date, max: number, observed: number) {
+    super(
+      `Daily earn cap exceeded for user ${userId} on ${day.toISOString()} (limit: ${max}, observed: ${observed})`,
+      'DAILY_EARN_CAP_EXCEEDED',
+      429,
+      { userId, day, max, observed }
+    );
+    this.name = 'DailyEarnCapExceededError';
+  }
+}
+
+/**
+ * Machine-readable reasons a ledger append failed
+ */
+export enum AppendErrorCode {
+  /** Idempotency key or upstream reference already used */
+  DUPLICATE = 'duplicate',
+
+  /** Entry fields failed validation */
+  INVALID = 'invalid',
+
+  /** Append would overdraw the account */
+  OVERDRAFT = 'overdraft',
+
+  /** A velocity or rate limit rejected the append */
+  RATE_LIMITED = 'rate_limited',
+
+  /** Entry belongs to a different tenant */
+  CROSS_TENANT = 'cross_tenant',
+
+  /** Timestamp earlier than the last appended entry */
+  TIMESTAMP_REGRESSION = 'timestamp_regression',
+
+  /** Committer is not allowed to write to the ledger */
+  UNAUTHORIZED = 'unauthorized',
+
+  /** Idempotency key already recorded for a different transaction */
+  CONTENT_CONFLICT = 'content_conflict',
+
+  /** Storage or unexpected failure - usually safe to retry */
+  STORAGE = 'storage',
+}
+
+/**
+ * Failed ledger append, carrying the offending entry's identifiers, a
+ * machine-readable code and the underlying error as `cause`
+ * The HTTP code and status are taken from a typed cause, so error mapping
+ * is unchanged. Use findErrorCause to test for a specific underlying error.
+ */
+export class LedgerAppendError extends WalletServiceError {
+  constructor(
+    public appendCode: AppendErrorCode,
+    public idempotencyKey: string,
+    cause: unknown,
+    public transactionId?: string
+  ) {
+    const typed = cause instanceof WalletServiceError ? cause : undefined;
+    super(
+      cause instanceof Error ? cause.message : String(cause),
+      typed ? typed.code : 'LEDGER_APPEND_FAILED',
+      typed ? typed.statusCode : appendCode === AppendErrorCode.INVALID ? 400 : 500,
+      typed ? typed.details : undefined
+    );
+    this.name = 'LedgerAppendError';
+    this.cause = cause;
+  }
+
+  /**
+   * Wrap an append failure, classifying its cause
+   * Errors that are already LedgerAppendErrors are returned unchanged.
+   */
+  static from(
+    error: unknown,
+    request: { idempotencyKey: string; transactionId?: string }
+  ): LedgerAppendError {
+    if (error instanceof LedgerAppendError) {
+      return error;
+    }
+    return new LedgerAppendError(classifyAppendError(error), request.idempotencyKey, error, request.transactionId);
+  }
+}
+
+function classifyAppendError(error: unknown): AppendErrorCode {
+  if (error instanceof IdempotencyConflictError || error instanceof DuplicateReferenceError) {
+    return AppendErrorCode.DUPLICATE;
+  }
+  if (error instanceof ReplayContentConflictError) {
+    return AppendErrorCode.CONTENT_CONFLICT;
+  }
+  if (error instanceof InsufficientBalanceError || error instanceof ReferenceOverdrawnError) {
+    return AppendErrorCode.OVERDRAFT;
+  }
+  if (
+    error instanceof RedemptionVelocityError ||
+    error instanceof ReferenceLimitExceededError ||
+    error instanceof DailyEarnCapExceededError ||
+    error instanceof WriteQueueFullError
+  ) {
+    return AppendErrorCode.RATE_LIMITED;
+  }
+  if (error instanceof CrossTenantError) {
+    return AppendErrorCode.CROSS_TENANT;
+  }
+  if (error instanceof TimestampRegressionError) {
+    return AppendErrorCode.TIMESTAMP_REGRESSION;
+  }
+  if (error instanceof UnauthorizedCommitterError || error instanceof InvalidAuthorizationError) {
+    return AppendErrorCode.UNAUTHORIZED;
+  }
+  if (error instanceof AppendValidationError) {
+    // A validator's own error decides the code; anything else is invalid
+    const code = classifyAppendError(error.cause);
+    return code === AppendErrorCode.STORAGE ? AppendErrorCode.INVALID : code;
+  }
+  if (
+    error instanceof InvalidPointAmountError ||
+    error instanceof UserIdRejectedError ||
+    error instanceof IdempotencyKeyRejectedError ||
+    error instanceof MissingGroupIdError ||
+    error instanceof MissingAdjustReasonError ||
+    error instanceof ReferenceFormatError ||
+    (error instanceof Error && (error.name === 'ValidationError' || error.name === 'CastError'))
+  ) {
+    return AppendErrorCode.INVALID;
+  }
+  return AppendErrorCode.STORAGE;
+}
+
+/**
+ * Find an error of the given type in an error's cause chain
+ */
+export function findErrorCause<T extends Error>(
+  error: unknown,
+  type: new (...args: any[]) => T
+): T | undefined {
+  let current: unknown = error;
+  while (current instanceof Error) {
+    if (current instanceof type) {
+      return current;
+    }
+    current = current.cause;
+  }
+  return undefined;
+}
+
+export class TailOverflowError extends WalletServiceError {
+  constructor(subscriberId: string, bufferSize: number) {
+    super(
+      `Tail subscriber ${subscriberId} fell more than ${bufferSize} entries behind`,
+      'TAIL_OVERFLOW',
+      503,
+      { subscriberId, bufferSize }
+    );
+    this.name = 'TailOverflowError';
+  }
+}
+
+/**
+ * Error thrown when a projection has not applied a user's sequence in time
+ */
+export class ProjectionLagError extends WalletServiceError {
+  constructor(projection: string, userId: string, seq: number, applied: number) {
+    super(
+      `Projection ${projection} applied ${userId} up to ${applied}, not ${seq}`,
+      'PROJECTION_LAG',
+      503,
+      { projection, userId, seq, applied }
+    );
+    this.name = 'ProjectionLagError';
+  }
+}
+
+export class ReadTokenExpiredError extends WalletServiceError {
+  constructor(tokenId: string) {
+    super(
+      `Read token ${tokenId} has expired or been released`,
+      'READ_TOKEN_EXPIRED',
+      410,
+      { tokenId }
+    );
+    this.name = 'ReadTokenExpiredError';
+  }
+}
+
+export class ReferenceAlreadyAliasedError extends WalletServiceError {
+  constructor(alias: string, canonical: string) {
+    super(
+      `Reference already aliased: ${alias} (alias of: ${canonical})`,
+      'REFERENCE_ALREADY_ALIASED',
+      409,
+      { alias, canonical }
+    );
+    this.name = 'ReferenceAlreadyAliasedError';
+  }
+}
+
+export class ReferenceAliasCycleError extends WalletServiceError {
+  constructor(alias: string, canonical: string) {
+    super(
+      `Aliasing ${alias} to ${canonical} would create a cycle`,
+      'REFERENCE_ALIAS_CYCLE',
+      409,
+      { alias, canonical }
+    );
+    this.name = 'ReferenceAliasCycleError';
+  }
+}
+
+export class TransactionAlreadyConcealedError extends WalletServiceError {
+  constructor(transactionId: string) {
+    super(
+      `Transaction already concealed: ${transactionId}`,
+      'TRANSACTION_ALREADY_CONCEALED',
+      409,
+      { transactionId }
+    );
+    this.name = 'TransactionAlreadyConcealedError';
+  }
+}
+
+/**
+ * Error thrown when a principal's issuance would exceed its quota
+ */
+export class IssuerQuotaExceededError extends WalletServiceError {
+  constructor(principal: string, limit: 'points' | 'transactions', max: number, observed: number) {
+    super(
+      `Issuer quota exceeded for ${principal}: ${limit} (limit: ${max}, observed: ${observed})`,
+      'ISSUER_QUOTA_EXCEEDED',
+      429,
+      { principal, limit, max, observed }
+    );
+    this.name = 'IssuerQuotaExceededError';
+  }
+}
+
+/**
+ * Error thrown when an append's committer is not on the allowlist
+ */
+export class UnauthorizedCommitterError extends WalletServiceError {
+  constructor(committedBy: string | undefined) {
+    super(
+      `Committer is not allowed to write to the ledger: ${committedBy ?? 'none'}`,
+      'UNAUTHORIZED_COMMITTER',
+      403,
+      { committedBy }
+    );
+    this.name = 'UnauthorizedCommitterError';
+  }
+}
+
+/**
+ * Error thrown when an append validator rejects an entry, carrying the
+ * validator's name and its error as `cause`
+ * The code and status are taken from a typed cause.
+ */
+export class AppendValidationError extends WalletServiceError {
+  constructor(public validator: string, cause: unknown) {
+    const typed = cause instanceof WalletServiceError ? cause : undefined;
+    super(
+      `${validator}: ${cause instanceof Error ? cause.message : String(cause)}`,
+      typed ? typed.code : 'APPEND_VALIDATION_FAILED',
+      typed ? typed.statusCode : 400,
+      { validator, ...(typed ? typed.details : {}) }
+    );
+    this.name = 'AppendValidationError';
+    this.cause = cause;
+  }
+}
+
+/**
+ * One way an entry failed its registered schema
+ */
+export interface SchemaViolation {
+  /** Metadata field at fault (absent for whole-entry violations) */
+  field?: string;
+  message: string;
+}
+
+/**
+ * Error thrown when an entry does not match the schema registered for its type
+ */
+export class SchemaViolationError extends WalletServiceError {
+  constructor(transactionType: string, public violations: SchemaViolation[]) {
+    super(
+      `Entry does not match the ${transactionType} schema: ${violations.map(v => v.message).join('; ')}`,
+      'SCHEMA_VIOLATION',
+      400,
+      { transactionType, violations }
+    );
+    this.name = 'SchemaViolationError';
+  }
+}
+
+/**
+ * Error thrown when a redemption has already been re-credited
+ */
+export class RedemptionAlreadyRecreditedError extends WalletServiceError {
+  constructor(transactionId: string, recreditTransactionId: string) {
+    super(
+      `Redemption ${transactionId} was already re-credited by ${recreditTransactionId}`,
+      'REDEMPTION_ALREADY_RECREDITED',
+      409,
+      { transactionId, recreditTransactionId }
+    );
+    this.name = 'RedemptionAlreadyRecreditedError';
+  }
+}
+
+/**
+ * Error thrown when every redemption under a reference was already re-credited
+ */
+export class ReferenceAlreadyRecreditedError extends WalletServiceError {
+  constructor(reference: string, recreditTransactionId: string) {
+    super(
+      `Redemptions under reference ${reference} were already re-credited by ${recreditTransactionId}`,
+      'REFERENCE_ALREADY_RECREDITED',
+      409,
+      { reference, recreditTransactionId }
+    );
+    this.name = 'ReferenceAlreadyRecreditedError';
+  }
+}
+
+/**
+ * Error thrown when a transaction has already been corrected
+ */
+export class TransactionAlreadyCorrectedError extends WalletServiceError {
+  constructor(transactionId: string, correctionTransactionId: string) {
+    super(
+      `Transaction ${transactionId} was already corrected by ${correctionTransactionId}`,
+      'TRANSACTION_ALREADY_CORRECTED',
+      409,
+      { transactionId, correctionTransactionId }
+    );
+    this.name = 'TransactionAlreadyCorrectedError';
+  }
+}
+
+/**
+ * Typed errors that clear on their own, so a later attempt may succeed
+ */
+const TRANSIENT_ERRORS: (new (...args: any[]) => WalletServiceError)[] = [
+  MaintenanceModeError,
+  QuorumWriteError,
+  MirrorWriteError,
+  OptimisticLockError,
+  IssuerQuotaExceededError,
+];
+
+/**
+ * Whether retrying a failed append may succeed
+ * Rate limits and storage failures (timeouts, dropped connections, a
+ * store in maintenance or short of quorum) are retryable; duplicates,
+ * invalid fields, overdrafts and other typed business rejections will
+ * fail the same way again and should be dead-lettered. Retries are safe
+ * because appends replay on their idempotency key.
+ */
+export function isRetryableAppendError(error: unknown): boolean {
+  const append = findErrorCause(error, LedgerAppendError);
+  const code = append ? append.appendCode : classifyAppendError(error);
+
+  if (code === AppendErrorCode.RATE_LIMITED) {
+    return true;
+  }
+  if (code !== AppendErrorCode.STORAGE) {
+    return false;
+  }
+
+  // Storage covers anything unclassified; only untyped or transient causes retry
+  const cause = append ? append.cause : error;
+  const typed = findErrorCause(cause, WalletServiceError);
+  if (typed) {
+    return TRANSIENT_ERRORS.some(type => typed instanceof type);
+  }
+
+  // A unique index other than the idempotency key rejects every attempt
+  return !(cause instanceof Error && (cause as any).code === 11000);
+}
+
 /**
  * Service health check
  */
@@ -0,0 +1,385 @@
+/**
+ * User Export Service Tests
+ */
+
+import { createHash } from 'crypto';
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import { PassThrough } from 'stream';
+import { UserExportService, PORTABLE_EXPORT_FIELDS } from './user-export.service';
+import { IterationThrottle, ThrottleControl } from '../ledger/throttle';
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+import { WalletModel } from '../db/models/wallet.model';
+import { EscrowItemModel } from '../db/models/escrow-item.model';
+
+// Mock mongoose models
+jest.mock('../db/models/wallet.model');
+jest.mock('../db/models/escrow-item.model');
+
+describe('UserExportService', () => {
+  let mockLedgerService: jest.Mocked<ILedgerService>;
+  let history: LedgerEntry[];
+
+  const entry = (i: number, amount: number): LedgerEntry => ({
+    entryId: `entry-${i}`,
+    transactionId: `txn-${i}`,
+    accountId: 'user-123',
+    accountType: 'user',
+    amount,
+    type: amount >= 0 ? TransactionType.CREDIT : TransactionType.DEBIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `idem-${i}`,
+    requestId: `req-${i}`,
+    balanceBefore: 0,
+    balanceAfter: 0,
+    timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, i)),
+    currency: 'points',
+    metadata: { committedBy: 'svc-payments', note: 'has "quotes", and commas' },
+  });
+
+  const runExport = async (service: UserExportService, format: 'json' | 'csv') => {
+    const output = new PassThrough();
+    const chunks: string[] = [];
+    output.on('data', chunk => chunks.push(chunk.toString()));
+    await service.exportUser('user-123', output, format);
+    output.end();
+    return chunks.join('');
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    history = [entry(0, 500), entry(1, -120), entry(2, 30)];
+    mockLedgerService = {
+      createEntry: jest.fn(),
+      queryEntries: jest.fn().mockImplementation(async (filter: any) => {
+        const matching = history.filter(e => !filter.startDate || e.timestamp >= filter.startDate);
+        return {
+          entries: matching.slice(filter.offset, filter.offset + filter.limit),
+          totalCount: matching.length,
+          offset: filter.offset,
+          limit: filter.limit,
+          hasMore: filter.offset + filter.limit < matching.length,
+        };
+      }),
+      getEntry: jest.fn(),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+
+    (WalletModel.findOne as jest.Mock).mockResolvedValue({ availableBalance: 360, escrowBalance: 50 });
+    (EscrowItemModel.find as jest.Mock).mockReturnValue({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue([
+        { escrowId: 'esc-1', amount: 50, featureType: 'slot_machine', createdAt: new Date('2024-01-02') },
+      ]),
+    });
+  });
+
+  it('should export every transaction and summary as JSON across pages', async () => {
+    const service = new UserExportService(mockLedgerService, { pageSize: 2 });
+
+    const doc = JSON.parse(await runExport(service, 'json'));
+
+    expect(doc.userId).toBe('user-123');
+    expect(doc.generatedAt).toBeDefined();
+    expect(doc.transactions.map((t: any) => t.entryId)).toEqual(['entry-0', 'entry-1', 'entry-2']);
+    expect(doc.summary).toMatchObject({
+      availableBalance: 360,
+      escrowBalance: 50,
+      lifetimeCredits: 530,
+      lifetimeDebits: 120,
+      entryCount: 3,
+    });
+    expect(doc.summary.activeHolds).toHaveLength(1);
+    expect(mockLedgerService.queryEntries).toHaveBeenCalledTimes(2);
+  });
+
+  it('should total only available-balance entries in the lifetime sums', async () => {
+    history = [
+      entry(0, 500),
+      { ...entry(1, -120), balanceState: 'available', stateTransition: 'available→escrow' },
+      { ...entry(2, 120), balanceState: 'escrow', stateTransition: 'available→escrow' },
+      { ...entry(3, -120), balanceState: 'escrow', stateTransition: 'escrow→none' },
+    ];
+    const service = new UserExportService(mockLedgerService);
+
+    const doc = JSON.parse(await runExport(service, 'json'));
+
+    expect(doc.summary).toMatchObject({ lifetimeCredits: 500, lifetimeDebits: 120, entryCount: 4 });
+  });
+
+  it('should embed a checksum over all preceding JSON bytes', async () => {
+    const service = new UserExportService(mockLedgerService);
+
+    const text = await runExport(service, 'json');
+
+    const marker = ',"checksum":"sha256:';
+    const body = text.slice(0, text.indexOf(marker));
+    const checksum = JSON.parse(text).checksum;
+    expect(checksum).toBe(`sha256:${createHash('sha256').update(body).digest('hex')}`);
+  });
+
+  it('should export CSV with escaped cells and a checksum trailer', async () => {
+    const service = new UserExportService(mockLedgerService);
+
+    const text = await runExport(service, 'csv');
+    const lines = text.trimEnd().split('\n');
+
+    expect(lines[0]).toBe('# userId=user-123');
+    expect(lines[2].startsWith('entryId,transactionId,timestamp')).toBe(true);
+    expect(lines[3]).toContain('"{""committedBy"":""svc-payments""');
+    const checksumLine = lines[lines.length - 1];
+    const body = text.slice(0, text.lastIndexOf('# checksum='));
+    expect(checksumLine).toBe(`# checksum=sha256:${createHash('sha256').update(body).digest('hex')}`);
+  });
+
+  it('should redact fields outside the allowlist', async () => {
+    const service = new UserExportService(mockLedgerService, {
+      fieldAllowlist: PORTABLE_EXPORT_FIELDS,
+    });
+
+    const doc = JSON.parse(await runExport(service, 'json'));
+
+    expect(doc.transactions[0].amount).toBe(500);
+    expect(doc.transactions[0].metadata).toBeUndefined();
+    expect(doc.transactions[0].requestId).toBeUndefined();
+    expect(doc.transactions[0].idempotencyKey).toBeUndefined();
+  });
+
+  it('should render amounts as decimals when a point scale is configured', async () => {
+    history = [entry(0, 2500), entry(1, -1250)];
+    const service = new UserExportService(mockLedgerService, { pointScale: 3 });
+
+    const doc = JSON.parse(await runExport(service, 'json'));
+
+    expect(doc.transactions[0].amount).toBe('2.5');
+    expect(doc.transactions[1].amount).toBe('-1.25');
+    expect(doc.summary.lifetimeCredits).toBe('2.5');
+    expect(doc.summary.availableBalance).toBe('0.36');
+    expect(doc.summary.activeHolds[0].amount).toBe('0.05');
+    expect(doc.summary.entryCount).toBe(2);
+  });
+
+  describe('writeStatementCsv', () => {
+    const runStatement = async (service: UserExportService) => {
+      const output = new PassThrough();
+      const chunks: string[] = [];
+      output.on('data', chunk => chunks.push(chunk.toString()));
+      await service.writeStatementCsv('user-123', output);
+      output.end();
+      return chunks.join('');
+    };
+
+    beforeEach(() => {
+      history = [
+        { ...entry(0, 500), balanceBefore: 100, metadata: { comment: 'Welcome bonus, "VIP" tier' } },
+        { ...entry(1, 50), balanceState: 'escrow', metadata: undefined },
+        {
+          ...entry(2, -120),
+          reason: TransactionReason.CHIP_MENU_PURCHASE,
+          metadata: { committedBy: 'svc-payments', comment: 'Chip menu: "Spin" x2\npaid in full' },
+        },
+        { ...entry(3, 30), reason: TransactionReason.ADMIN_CREDIT, metadata: { comment: 'Goodwill – café' } },
+      ];
+      mockLedgerService.queryEntries.mockImplementation(async (filter: any) => {
+        const matching = history.filter(e => !filter.balanceState || e.balanceState === filter.balanceState);
+        return {
+          entries: matching.slice(filter.offset, filter.offset + filter.limit),
+          totalCount: matching.length,
+          offset: filter.offset,
+          limit: filter.limit,
+          hasMore: filter.offset + filter.limit < matching.length,
+        };
+      });
+      (WalletModel.findOne as jest.Mock).mockResolvedValue({ availableBalance: 510, escrowBalance: 50 });
+    });
+
+    it('should match the golden statement, ending at the current balance', async () => {
+      const service = new UserExportService(mockLedgerService, { pageSize: 2 });
+
+      const text = await runStatement(service);
+
+      expect(text).toBe(readFileSync(join(__dirname, '__fixtures__', 'user-statement', 'sample.csv'), 'utf8'));
+      const lastRow = text.trimEnd().split('\n').pop()!.split(',');
+      const wallet = await WalletModel.findOne({ userId: 'user-123' });
+      expect(Number(lastRow[6])).toBe(wallet!.availableBalance);
+    });
+
+    it('should write only the header for a user without entries', async () => {
+      history = [];
+
+      await expect(runStatement(new UserExportService(mockLedgerService))).resolves.toBe(
+        'timestamp,entryId,transactionId,type,reason,amount,runningBalance,comment\n'
+      );
+    });
+  });
+
+  describe('throttling', () => {
+    beforeEach(() => {
+      jest.useFakeTimers();
+    });
+
+    afterEach(() => {
+      jest.useRealTimers();
+    });
+
+    const startExport = (service: UserExportService, throttle: IterationThrottle) => {
+      const output = new PassThrough();
+      const chunks: string[] = [];
+      output.on('data', chunk => chunks.push(chunk.toString()));
+      const done = service.exportUser('user-123', output, 'json', { throttle });
+      return { done, text: () => chunks.join('') };
+    };
+
+    it('should pace pages and report effective throughput', async () => {
+      const service = new UserExportService(mockLedgerService, { pageSize: 1 });
+
+      const run = startExport(service, new IterationThrottle({ entriesPerSecond: 10 }));
+      await jest.advanceTimersByTimeAsync(1000);
+      const report = await run.done;
+
+      expect(report).toMatchObject({ entries: 3, elapsedMs: 300, throttledMs: 300, pausedMs: 0 });
+      expect(report.entriesPerSecond).toBeCloseTo(10);
+      expect(report.bytes).toBe(Buffer.byteLength(run.text()));
+    });
+
+    it('should hold a paused export and record the pause', async () => {
+      const service = new UserExportService(mockLedgerService, { pageSize: 1 });
+      const control = new ThrottleControl();
+      control.pause();
+
+      const run = startExport(service, new IterationThrottle({ entriesPerSecond: 10 }, control));
+      await jest.advanceTimersByTimeAsync(1000);
+      expect(mockLedgerService.queryEntries).toHaveBeenCalledTimes(1);
+
+      control.resume();
+      await jest.advanceTimersByTimeAsync(1000);
+      const report = await run.done;
+
+      expect(report).toMatchObject({ entries: 3, elapsedMs: 1200, pausedMs: 900 });
+      expect(JSON.parse(run.text()).transactions).toHaveLength(3);
+    });
+
+    it('should report throughput when unthrottled', async () => {
+      const service = new UserExportService(mockLedgerService);
+
+      const report = await service.exportUser('user-123', new PassThrough(), 'csv');
+
+      expect(report).toMatchObject({ entries: 3, throttledMs: 0, pausedMs: 0 });
+    });
+  });
+
+  it('should build a statement whose summary agrees with its transactions', async () => {
+    let balance = 0;
+    history = [entry(0, 500), entry(1, -120), entry(2, 30)].map(e => {
+      const chained = { ...e, balanceBefore: balance, balanceAfter: balance + e.amount };
+      balance += e.amount;
+      return chained;
+    });
+    const service = new UserExportService(mockLedgerService, { pageSize: 2 });
+
+    const statement = await service.userStatement('user-123');
+
+    const { transactions, summary } = statement;
+    expect(transactions.map(t => t.entryId)).toEqual(['entry-0', 'entry-1', 'entry-2']);
+    expect(summary.entryCount).toBe(transactions.length);
+    expect(summary.lifetimeCredits - summary.lifetimeDebits).toBe(
+      transactions.reduce((sum, t) => sum + t.amount, 0)
+    );
+    expect(statement.currentBalance).toBe(transactions[transactions.length - 1].balanceAfter);
+    expect(statement.currentBalance).toBe(summary.availableBalance);
+    expect(statement.firstActivityAt).toEqual(transactions[0].timestamp);
+    expect(statement.lastActivityAt).toEqual(transactions[2].timestamp);
+
+    // Every page is read up to the same cut-off
+    const cutoffs = mockLedgerService.queryEntries.mock.calls.map(([filter]) => filter.endDate);
+    expect(cutoffs).toEqual([statement.asOf, statement.asOf]);
+  });
+
+  it('should page the statement by position, unshifted by a late commit', async () => {
+    const service = new UserExportService(mockLedgerService, { pageSize: 2 });
+    const original = mockLedgerService.queryEntries.getMockImplementation()!;
+    mockLedgerService.queryEntries.mockImplementation(async (filter: any) => {
+      const result = await original(filter);
+      // An entry stamped before the first page commits once it has been read
+      if (history.length === 3) {
+        history.unshift({ ...entry(9, 10), timestamp: new Date(Date.UTC(2023, 11, 31)) });
+      }
+      return result;
+    });
+
+    const statement = await service.userStatement('user-123');
+
+    expect(statement.transactions.map(t => t.entryId)).toEqual(['entry-0', 'entry-1', 'entry-2']);
+    expect(mockLedgerService.queryEntries.mock.calls[1][0].startDate).toEqual(history[2].timestamp);
+  });
+
+  it('should count only available-balance entries in the statement lifetime sums', async () => {
+    history = [
+      entry(0, 500),
+      { ...entry(1, 120), balanceState: 'escrow', stateTransition: 'available→escrow' },
+      { ...entry(2, -120), stateTransition: 'available→escrow' },
+    ];
+    const service = new UserExportService(mockLedgerService);
+
+    const { summary } = await service.userStatement('user-123');
+
+    expect(summary).toMatchObject({ lifetimeCredits: 500, lifetimeDebits: 120, entryCount: 3 });
+  });
+
+  it('should return copies of the statement transactions', async () => {
+    const service = new UserExportService(mockLedgerService);
+
+    const statement = await service.userStatement('user-123');
+    statement.transactions[0].metadata!.note = 'changed';
+
+    expect(history[0].metadata!.note).toBe('has "quotes", and commas');
+  });
+
+  it('should explain multiplied earns in the statement', async () => {
+    history[0].metadata = {
+      earnBreakdown: {
+        basePoints: 400,
+        components: [{ bonusClass: 'tier', source: 'gold', multiplier: '1.25', mode: 'multiplicative', points: 100 }],
+        multiplier: '1.25',
+        capped: false,
+        capPoints: 0,
+        totalPoints: 500,
+      },
+    };
+    const service = new UserExportService(mockLedgerService);
+
+    const statement = await service.userStatement('user-123');
+
+    expect(statement.earnExplanations).toEqual({ 'entry-0': '400 base + 100 tier gold (x1.25) = 500' });
+  });
+
+  it('should build an empty statement for a user without activity', async () => {
+    history = [];
+    const service = new UserExportService(mockLedgerService);
+
+    const statement = await service.userStatement('user-123');
+
+    expect(statement).toMatchObject({
+      transactions: [],
+      firstActivityAt: null,
+      lastActivityAt: null,
+      currentBalance: 0,
+      summary: { entryCount: 0, lifetimeCredits: 0, lifetimeDebits: 0 },
+    });
+  });
+
+  it('should reject unsupported formats', async () => {
+    const service = new UserExportService(mockLedgerService);
+
+    await expect(
+      service.exportUser('user-123', new PassThrough(), 'xml' as any)
+    ).rejects.toThrow('Unsupported export format: xml');
+  });
+});
@@ -0,0 +1,589 @@
+/**
+ * User Data Export Service
+ *
+ * Produces a user's complete ledger history for data-portability
+ * requests, as JSON or CSV. Entries are streamed page by page so users
+ * with very large histories never need to be held in memory. Each export
+ * ends with derived summaries (current balance, lifetime totals, active
+ * holds) and a SHA-256 checksum over every byte written before it.
+ *
+ * Internal fields (request IDs, idempotency keys, operator metadata) can
+ * be withheld by exporting only an allowlist of entry fields;
+ * PORTABLE_EXPORT_FIELDS is the recommended set for external hand-off.
+ *
+ * A long-running export can be paced with an IterationThrottle so it
+ * does not crowd out user traffic; the export returns the throttle's
+ * throughput report either way.
+ *
+ * userStatement() returns the same history as a structured object, with
+ * its summary derived from the transactions read. It pages by
+ * (timestamp, entryId) position rather than offset, so an entry stamped
+ * before the cut-off but committed during the read cannot shift a page
+ * and repeat or skip a transaction. writeStatementCsv()
+ * writes the available-balance history as a finance statement with a
+ * running-balance column, quoted like the CSV export.
+ *
+ * @module services/user-export
+ */
+
+import { createHash, Hash } from 'crypto';
+import { once } from 'events';
+import { Writable } from 'stream';
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import { TransactionType } from '../wallets/types';
+import { WalletModel } from '../db/models/wallet.model';
+import { EscrowItemModel } from '../db/models/escrow-item.model';
+import { toDecimal } from '../points/fixed-point';
+import { IterationThrottle, ThrottleReport } from '../ledger/throttle';
+import { ReplayPosition, comparePositions } from '../ledger/replay';
+import { ProgramConfigSource } from '../config/program';
+import { formatEarnBreakdown } from './earn-multipliers';
+
+/**
+ * Supported export formats
+ */
+export type ExportFormat = 'json' | 'csv';
+
+/**
+ * Every entry field an export can contain, in output order
+ */
+export const EXPORT_FIELDS = [
+  'entryId',
+  'transactionId',
+  'timestamp',
+  'type',
+  'amount',
+  'reason',
+  'balanceState',
+  'balanceBefore',
+  'balanceAfter',
+  'currency',
+  'featureType',
+  'escrowId',
+  'queueItemId',
+  'correlationId',
+  'requestId',
+  'idempotencyKey',
+  'metadata',
+] as const;
+
+export type ExportField = typeof EXPORT_FIELDS[number];
+
+/**
+ * Entry fields safe to hand to the user - excludes internal references
+ * and metadata that may carry operator or service-account identities
+ */
+export const PORTABLE_EXPORT_FIELDS: ExportField[] = [
+  'entryId',
+  'transactionId',
+  'timestamp',
+  'type',
+  'amount',
+  'reason',
+  'balanceState',
+  'balanceBefore',
+  'balanceAfter',
+  'currency',
+  'featureType',
+];
+
+/**
+ * Columns of a CSV statement, in output order
+ */
+export const STATEMENT_CSV_COLUMNS = [
+  'timestamp',
+  'entryId',
+  'transactionId',
+  'type',
+  'reason',
+  'amount',
+  'runningBalance',
+  'comment',
+] as const;
+
+/**
+ * Entry fields holding point amounts
+ */
+const AMOUNT_FIELDS: ExportField[] = ['amount', 'balanceBefore', 'balanceAfter'];
+
+/**
+ * Configuration for the user export service
+ */
+export interface UserExportConfig {
+  /** Entry fields to include (all fields when unset) */
+  fieldAllowlist?: ExportField[];
+
+  /** Entries read from the ledger per page */
+  pageSize: number;
+
+  /**
+   * Scale of the program's fixed-point amounts; when set, amounts are
+   * rendered as decimal strings (e.g. 2500 at scale 3 as "2.5")
+   */
+  pointScale?: number;
+
+  /** Program config whose point scale replaces pointScale */
+  program?: ProgramConfigSource;
+}
+
+const DEFAULT_CONFIG: UserExportConfig = {
+  pageSize: 1000,
+};
+
+/**
+ * Options for a single export
+ */
+export interface ExportOptions {
+  /** Paces the export page by page (unthrottled when unset) */
+  throttle?: IterationThrottle;
+}
+
+/**
+ * Derived summary appended to every export
+ */
+export interface UserExportSummary {
+  /** Current available balance */
+  availableBalance: number;
+
+  /** Current escrow balance */
+  escrowBalance: number;
+
+  /** Sum of all available-balance credits */
+  lifetimeCredits: number;
+
+  /** Sum of all available-balance debit magnitudes */
+  lifetimeDebits: number;
+
+  /** Number of entries exported */
+  entryCount: number;
+
+  /** Escrow holds not yet settled or refunded */
+  activeHolds: { escrowId: string; amount: number; featureType: string; createdAt: Date }[];
+}
+
+/**
+ * Balance summary derived from a statement's transactions
+ */
+export interface StatementBalanceSummary {
+  /** Available balance after the last transaction */
+  availableBalance: number;
+
+  /** Escrow balance after the last transaction */
+  escrowBalance: number;
+
+  /** Sum of all available-balance credits */
+  lifetimeCredits: number;
+
+  /** Sum of all available-balance debit magnitudes */
+  lifetimeDebits: number;
+
+  /** Number of transactions in the statement */
+  entryCount: number;
+}
+
+/**
+ * A user's complete history and summary as structured data
+ */
+export interface UserStatement {
+  userId: string;
+
+  /** Cut-off the statement was read at */
+  asOf: Date;
+
+  /** Every transaction up to asOf, oldest first (copies) */
+  transactions: LedgerEntry[];
+
+  summary: StatementBalanceSummary;
+
+  /** Timestamp of the first transaction (null when there are none) */
+  firstActivityAt: Date | null;
+
+  /** Timestamp of the last transaction (null when there are none) */
+  lastActivityAt: Date | null;
+
+  /** Available balance as of the cut-off */
+  currentBalance: number;
+
+  /** How each multiplied earn was built, by entry ID */
+  earnExplanations: Record<string, string>;
+}
+
+/**
+ * User Data Export Service Implementation
+ */
+export class UserExportService {
+  private config: UserExportConfig;
+  private ledgerService: ILedgerService;
+
+  constructor(ledgerService: ILedgerService, config: Partial<UserExportConfig> = {}) {
+    this.config = { ...DEFAULT_CONFIG, ...config };
+    this.ledgerService = ledgerService;
+  }
+
+  /**
+   * Stream a user's complete ledger history to an output
+   *
+   * @param userId User to export
+   * @param output Destination stream (not ended by the export)
+   * @param format Output format
+   * @returns Throughput of the export, including time throttled and paused
+   */
+  async exportUser(
+    userId: string,
+    output: Writable,
+    format: ExportFormat,
+    options: ExportOptions = {}
+  ): Promise<ThrottleReport> {
+    if (!userId) {
+      throw new Error('userId is required for export');
+    }
+
+    if (format !== 'json' && format !== 'csv') {
+      throw new Error(`Unsupported export format: ${format}`);
+    }
+
+    const fields = this.config.fieldAllowlist
+      ? EXPORT_FIELDS.filter(f => this.config.fieldAllowlist!.includes(f))
+      : [...EXPORT_FIELDS];
+    const hash = createHash('sha256');
+    const throttle = options.throttle || new IterationThrottle();
+
+    // One scale for the whole export, even if the program is reloaded mid-way
+    const scale = this.config.program ? this.config.program.current().pointScale : this.config.pointScale;
+    let bytesWritten = 0;
+    const write = (chunk: string) => {
+      bytesWritten += Buffer.byteLength(chunk, 'utf8');
+      return this.write(output, hash, chunk);
+    };
+    throttle.start();
+    const generatedAt = new Date().toISOString();
+
+    if (format === 'json') {
+      await write(`{"userId":${JSON.stringify(userId)},"generatedAt":"${generatedAt}","transactions":[`);
+    } else {
+      await write(`# userId=${userId}\n# generatedAt=${generatedAt}\n`);
+      await write(fields.join(',') + '\n');
+    }
+
+    let lifetimeCredits = 0;
+    let lifetimeDebits = 0;
+    let entryCount = 0;
+    let offset = 0;
+    let hasMore = true;
+
+    while (hasMore) {
+      const result = await this.ledgerService.queryEntries({
+        accountId: userId,
+        accountType: 'user',
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: this.config.pageSize,
+      });
+
+      for (const entry of result.entries) {
+        // Escrow and earned legs move points the available legs already count
+        if (entry.balanceState === 'available') {
+          if (entry.type === TransactionType.CREDIT) {
+            lifetimeCredits += Math.abs(entry.amount);
+          } else {
+            lifetimeDebits += Math.abs(entry.amount);
+          }
+        }
+
+        const row = this.renderAmounts(pickFields(entry, fields), AMOUNT_FIELDS, scale);
+        if (format === 'json') {
+          await write((entryCount > 0 ? ',' : '') + JSON.stringify(row));
+        } else {
+          await write(fields.map(f => csvCell(row[f])).join(',') + '\n');
+        }
+        entryCount++;
+      }
+
+      offset += result.entries.length;
+      hasMore = result.hasMore && result.entries.length > 0;
+
+      await throttle.consume(result.entries.length, bytesWritten);
+      bytesWritten = 0;
+    }
+
+    const summary = await this.summarize(userId, lifetimeCredits, lifetimeDebits, entryCount);
+    const renderedSummary = this.renderAmounts(
+      { ...summary, activeHolds: summary.activeHolds.map(hold => this.renderAmounts(hold, ['amount'], scale)) },
+      ['availableBalance', 'escrowBalance', 'lifetimeCredits', 'lifetimeDebits'],
+      scale
+    );
+
+    if (format === 'json') {
+      await write(`],"summary":${JSON.stringify(renderedSummary)}`);
+    } else {
+      await write(`# summary=${JSON.stringify(renderedSummary)}\n`);
+    }
+
+    const digest = hash.digest('hex');
+    const checksum = format === 'json' ? `,"checksum":"sha256:${digest}"}\n` : `# checksum=sha256:${digest}\n`;
+    bytesWritten += Buffer.byteLength(checksum, 'utf8');
+    await this.write(output, null, checksum);
+    await throttle.consume(0, bytesWritten);
+
+    return throttle.report();
+  }
+
+  /**
+   * Build a user's statement for data-access requests and customer statements
+   * The ledger is read up to a single cut-off and every figure is derived
+   * from the transactions returned, so the summary always agrees with the
+   * history even while new entries are being written.
+   */
+  async userStatement(userId: string): Promise<UserStatement> {
+    if (!userId) {
+      throw new Error('userId is required for a statement');
+    }
+
+    const asOf = new Date();
+    const transactions: LedgerEntry[] = [];
+    const summary: StatementBalanceSummary = {
+      availableBalance: 0,
+      escrowBalance: 0,
+      lifetimeCredits: 0,
+      lifetimeDebits: 0,
+      entryCount: 0,
+    };
+    const earnExplanations: Record<string, string> = {};
+    let after: ReplayPosition | null = null;
+
+    for (;;) {
+      const page = await this.statementPage(userId, asOf, after);
+
+      for (const entry of page) {
+        // Escrow and earned legs move points the available legs already count
+        if (entry.balanceState === 'available') {
+          if (entry.type === TransactionType.CREDIT) {
+            summary.lifetimeCredits += Math.abs(entry.amount);
+          } else {
+            summary.lifetimeDebits += Math.abs(entry.amount);
+          }
+        }
+
+        if (entry.balanceState === 'available') {
+          summary.availableBalance = entry.balanceAfter;
+        } else if (entry.balanceState === 'escrow') {
+          summary.escrowBalance = entry.balanceAfter;
+        }
+
+        if (entry.metadata?.earnBreakdown) {
+          earnExplanations[entry.entryId] = formatEarnBreakdown(entry.metadata.earnBreakdown);
+        }
+
+        transactions.push(structuredClone(entry));
+      }
+
+      if (page.length < this.config.pageSize) {
+        break;
+      }
+      const last = page[page.length - 1];
+      after = { timestamp: last.timestamp, entryId: last.entryId };
+    }
+
+    summary.entryCount = transactions.length;
+
+    return {
+      userId,
+      asOf,
+      transactions,
+      summary,
+      firstActivityAt: transactions.length > 0 ? new Date(transactions[0].timestamp) : null,
+      lastActivityAt: transactions.length > 0 ? new Date(transactions[transactions.length - 1].timestamp) : null,
+      currentBalance: summary.availableBalance,
+      earnExplanations,
+    };
+  }
+
+  /**
+   * Read the page of a user's entries up to asOf that follows a position
+   * Relies on the ledger ordering timestamp ties by entry ID. Entries at
+   * the position's timestamp are read from its start and skipped up to
+   * the position, so a run of one timestamp longer than a page still
+   * advances.
+   */
+  private async statementPage(userId: string, asOf: Date, after: ReplayPosition | null): Promise<LedgerEntry[]> {
+    const page: LedgerEntry[] = [];
+    let offset = 0;
+
+    while (page.length < this.config.pageSize) {
+      const result = await this.ledgerService.queryEntries({
+        accountId: userId,
+        accountType: 'user',
+        startDate: after ? after.timestamp : undefined,
+        endDate: asOf,
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: this.config.pageSize,
+      });
+
+      for (const entry of result.entries) {
+        if (!after || comparePositions(entry, after) > 0) {
+          page.push(entry);
+        }
+      }
+
+      offset += result.entries.length;
+      if (!result.hasMore || result.entries.length === 0) {
+        break;
+      }
+    }
+
+    return page.slice(0, this.config.pageSize);
+  }
+
+  /**
+   * Write a user's available-balance history as a CSV statement: a header,
+   * then one row per transaction oldest first with the balance after it
+   * The running balance starts from the balance before the first entry
+   * and adds each amount, so the last row shows the current balance.
+   *
+   * @param output Destination stream (not ended by the call)
+   */
+  async writeStatementCsv(userId: string, output: Writable): Promise<void> {
+    if (!userId) {
+      throw new Error('userId is required for a statement');
+    }
+
+    const scale = this.config.program ? this.config.program.current().pointScale : this.config.pointScale;
+    await this.write(output, null, STATEMENT_CSV_COLUMNS.join(',') + '\n');
+
+    let runningBalance: number | undefined;
+    let offset = 0;
+    let hasMore = true;
+
+    while (hasMore) {
+      const result = await this.ledgerService.queryEntries({
+        accountId: userId,
+        accountType: 'user',
+        balanceState: 'available',
+        sortBy: 'timestamp',
+        sortOrder: 'asc',
+        offset,
+        limit: this.config.pageSize,
+      });
+
+      for (const entry of result.entries) {
+        runningBalance = (runningBalance ?? entry.balanceBefore) + entry.amount;
+        const row = this.renderAmounts(
+          {
+            timestamp: new Date(entry.timestamp).toISOString(),
+            entryId: entry.entryId,
+            transactionId: entry.transactionId,
+            type: entry.type,
+            reason: entry.reason,
+            amount: entry.amount,
+            runningBalance,
+            comment: entry.metadata?.comment,
+          },
+          ['amount', 'runningBalance'],
+          scale
+        );
+        await this.write(output, null, STATEMENT_CSV_COLUMNS.map(column => csvCell(row[column])).join(',') + '\n');
+      }
+
+      offset += result.entries.length;
+      hasMore = result.hasMore && result.entries.length > 0;
+    }
+  }
+
+  /**
+   * Build the derived summary from current wallet state and active holds
+   */
+  private async summarize(
+    userId: string,
+    lifetimeCredits: number,
+    lifetimeDebits: number,
+    entryCount: number
+  ): Promise<UserExportSummary> {
+    const wallet = await WalletModel.findOne({ userId: { $eq: userId } });
+    const holds = await EscrowItemModel.find({
+      userId: { $eq: userId },
+      status: { $eq: 'held' },
+    }).lean().exec();
+
+    return {
+      availableBalance: wallet ? wallet.availableBalance : 0,
+      escrowBalance: wallet ? wallet.escrowBalance : 0,
+      lifetimeCredits,
+      lifetimeDebits,
+      entryCount,
+      activeHolds: holds.map((hold: any) => ({
+        escrowId: hold.escrowId,
+        amount: hold.amount,
+        featureType: hold.featureType,
+        createdAt: hold.createdAt,
+      })),
+    };
+  }
+
+  /**
+   * Render the named amount fields as decimals at a point scale (unchanged without one)
+   */
+  private renderAmounts<T extends Record<string, any>>(row: T, amountFields: string[], scale?: number): T {
+    if (scale === undefined) {
+      return row;
+    }
+
+    const rendered: Record<string, any> = { ...row };
+    for (const field of amountFields) {
+      if (typeof rendered[field] === 'number') {
+        rendered[field] = toDecimal(rendered[field], scale);
+      }
+    }
+    return rendered as T;
+  }
+
+  /**
+   * Write a chunk, folding it into the checksum and honouring backpressure
+   */
+  private async write(output: Writable, hash: Hash | null, chunk: string): Promise<void> {
+    if (hash) {
+      hash.update(chunk, 'utf8');
+    }
+    if (!output.write(chunk)) {
+      await once(output, 'drain');
+    }
+  }
+}
+
+/**
+ * Copy the allowlisted fields of an entry
+ */
+function pickFields(entry: LedgerEntry, fields: ExportField[]): Partial<Record<ExportField, any>> {
+  const row: Partial<Record<ExportField, any>> = {};
+  for (const field of fields) {
+    const value = entry[field];
+    if (value !== undefined) {
+      row[field] = value instanceof Date ? value.toISOString() : value;
+    }
+  }
+  return row;
+}
+
+/**
+ * Format a value as an RFC 4180 CSV cell
+ */
+function csvCell(value: any): string {
+  if (value === undefined || value === null) {
+    return '';
+  }
+
+  const text = typeof value === 'object' ? JSON.stringify(value) : String(value);
+  return /[",\r\n]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+}
+
+/**
+ * Factory function to create a user export service
+ */
+export function createUserExportService(
+  ledgerService: ILedgerService,
+  config?: Partial<UserExportConfig>
+): UserExportService {
+  return new UserExportService(ledgerService, config);
+}
@@ -0,0 +1,136 @@
+/**
+ * Anonymization Audit Tests
+ */
+
+import { generateKeyPairSync } from 'crypto';
+import { anonymizationAudit } from './audit';
+import { ShreddingLedgerService } from './service';
+import { InMemoryKeyVault } from './key-vault';
+import { ErasureResult } from './types';
+import { CreateLedgerEntryRequest, ILedgerService, LedgerEntry } from '../ledger/types';
+import { signEntry } from '../ledger/entry-signing';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('anonymizationAudit', () => {
+  const { publicKey, privateKey } = generateKeyPairSync('ed25519', {
+    publicKeyEncoding: { type: 'spki', format: 'pem' },
+    privateKeyEncoding: { type: 'pkcs8', format: 'pem' },
+  });
+  const options = { verificationPublicKey: publicKey, pageSize: 2 };
+
+  let stored: LedgerEntry[];
+  let inner: jest.Mocked<ILedgerService>;
+  let keyVault: InMemoryKeyVault;
+  let service: ShreddingLedgerService;
+
+  const request = (accountId: string, amount = 100): CreateLedgerEntryRequest => ({
+    accountId,
+    accountType: 'user',
+    amount,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.ADMIN_CREDIT,
+    idempotencyKey: `key-${stored.length}`,
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: amount,
+    currency: 'points',
+    metadata: { email: `${accountId}@example.com` },
+  });
+
+  const seed = async () => {
+    for (const accountId of ['user-erased', 'user-erased', 'user-erased', 'user-kept']) {
+      await service.createEntry(request(accountId));
+    }
+  };
+
+  beforeEach(() => {
+    stored = [];
+    inner = {
+      createEntry: jest.fn().mockImplementation(async (req: CreateLedgerEntryRequest) => {
+        const entry = {
+          ...req,
+          entryId: `entry-${stored.length}`,
+          transactionId: `txn-${stored.length}`,
+          timestamp: new Date(Date.UTC(2024, 0, 1, 0, 0, stored.length)),
+        } as LedgerEntry;
+        entry.signature = signEntry(entry, privateKey);
+        stored.push(entry);
+        return entry;
+      }),
+      queryEntries: jest.fn().mockImplementation(async (filter: any) => {
+        const matching = stored.filter(e => e.accountId === filter.accountId);
+        return {
+          entries: matching.slice(filter.offset, filter.offset + filter.limit),
+          totalCount: matching.length,
+          offset: filter.offset,
+          limit: filter.limit,
+          hasMore: filter.offset + filter.limit < matching.length,
+        };
+      }),
+      getEntry: jest.fn().mockImplementation(async (id: string) => stored.find(e => e.entryId === id) || null),
+    } as any;
+    keyVault = new InMemoryKeyVault();
+    service = new ShreddingLedgerService(inner, keyVault);
+  });
+
+  it('should pass an erasure that left every financial field intact', async () => {
+    await seed();
+    const erasure = await service.erase('user-erased');
+
+    const report = await anonymizationAudit(inner, keyVault, [erasure], options);
+
+    expect(report).toMatchObject({ passed: true, entriesChecked: 3, violations: [] });
+    expect(report.users).toEqual([
+      { userId: 'user-erased', erasedAt: erasure.erasedAt, entriesChecked: 3, violations: [] },
+    ]);
+    // Users outside the log are neither audited nor affected
+    expect((await service.getEntry('entry-3'))?.metadata).toEqual({ email: 'user-kept@example.com' });
+  });
+
+  it('should report a transaction whose amount changed after erasure', async () => {
+    await seed();
+    const erasure = await service.erase('user-erased');
+    stored[1] = { ...stored[1], amount: 1 };
+
+    const report = await anonymizationAudit(inner, keyVault, [erasure], options);
+
+    expect(report.passed).toBe(false);
+    expect(report.violations).toEqual([
+      { userId: 'user-erased', reason: 'signature_invalid', entryId: 'entry-1', transactionId: 'txn-1' },
+    ]);
+  });
+
+  it('should report a user in the log whose key still exists', async () => {
+    await seed();
+    const erasure: ErasureResult = { userId: 'user-kept', keyDestroyed: true, erasedAt: new Date() };
+
+    const report = await anonymizationAudit(inner, keyVault, [erasure], options);
+
+    expect(report.violations.map(v => [v.reason, v.entryId])).toEqual([
+      ['key_not_destroyed', undefined],
+      ['metadata_readable', 'entry-3'],
+    ]);
+  });
+
+  it('should report metadata stored in plaintext and entries without a signature', async () => {
+    await seed();
+    const erasure = await service.erase('user-erased');
+    stored[0] = { ...stored[0], metadata: { email: 'user-erased@example.com' } };
+    delete stored[2].signature;
+
+    const report = await anonymizationAudit(inner, keyVault, [erasure], options);
+
+    expect(report.violations).toEqual([
+      { userId: 'user-erased', reason: 'metadata_readable', entryId: 'entry-0', transactionId: 'txn-0' },
+      { userId: 'user-erased', reason: 'unsigned', entryId: 'entry-2', transactionId: 'txn-2' },
+    ]);
+  });
+
+  it('should reject a log entry without a user', async () => {
+    await expect(
+      anonymizationAudit(inner, keyVault, [{ userId: '', keyDestroyed: true, erasedAt: new Date() }], options)
+    ).rejects.toThrow('needs a userId');
+  });
+});
@@ -0,0 +1,157 @@
+/**
+ * Anonymization Audit
+ *
+ * Proves that erasures destroyed only what they were meant to. For each
+ * user in an erasure log, every stored entry of theirs is read from the
+ * underlying ledger (not through the shredding wrapper) and checked:
+ *
+ * - its Ed25519 signature still verifies. The signature covers the
+ *   canonical financial fields (IDs, amount, type, balances, timestamp,
+ *   currency), and metadata is outside it, so encrypting or shredding
+ *   metadata never affects it. A failing signature means a financial
+ *   field changed after the entry was written.
+ * - its metadata, if any, is an encrypted envelope, and reading it
+ *   through a ShreddingLedgerService yields no metadata (key destroyed).
+ *
+ * The user's data key must also be gone from the vault. Erasure never
+ * rewrites stored entries, so the ledger's chain hash (which covers the
+ * stored ciphertext) is unaffected as well; verifyPrefix stays the check
+ * for the ledger as a whole.
+ *
+ * @module shred/audit
+ */
+
+import { ILedgerService, LedgerEntry } from '../ledger/types';
+import { verifyEntrySignature } from '../ledger/entry-signing';
+import { ShreddingLedgerService, isShreddedMetadata } from './service';
+import { IKeyVault, ErasureResult } from './types';
+
+/**
+ * Why an entry or user failed the audit
+ */
+export type AnonymizationViolationReason =
+  /** The vault still holds a data key for the user */
+  | 'key_not_destroyed'
+  /** A signed financial field no longer matches its signature */
+  | 'signature_invalid'
+  /** The entry carries no signature, so its fields cannot be proven */
+  | 'unsigned'
+  /** Metadata is stored in plaintext or still decrypts */
+  | 'metadata_readable';
+
+export interface AnonymizationViolation {
+  userId: string;
+  reason: AnonymizationViolationReason;
+
+  /** Absent for user-level violations */
+  entryId?: string;
+  transactionId?: string;
+}
+
+/**
+ * Audit outcome for one erased user
+ */
+export interface UserAnonymizationResult {
+  userId: string;
+  erasedAt: Date;
+  entriesChecked: number;
+  violations: AnonymizationViolation[];
+}
+
+export interface AnonymizationAuditReport {
+  /** True when no user has a violation */
+  passed: boolean;
+  users: UserAnonymizationResult[];
+  entriesChecked: number;
+  violations: AnonymizationViolation[];
+  auditedAt: Date;
+}
+
+export interface AnonymizationAuditOptions {
+  /** PEM-encoded Ed25519 key the ledger's entries are signed with */
+  verificationPublicKey: string;
+
+  /** Entries read per page */
+  pageSize?: number;
+}
+
+const DEFAULT_PAGE_SIZE = 500;
+
+/**
+ * Audit every erasure in a log
+ *
+ * @param ledger The ledger the shredding wrapper writes to. It must return
+ *   entries as stored, so it must not filter on signature verification
+ * @param erasureLog Results of ShreddingLedgerService.erase
+ * @throws Error if the log holds an entry without a user ID
+ */
+export async function anonymizationAudit(
+  ledger: ILedgerService,
+  keyVault: IKeyVault,
+  erasureLog: ErasureResult[],
+  options: AnonymizationAuditOptions
+): Promise<AnonymizationAuditReport> {
+  if (erasureLog.some(erasure => !erasure.userId)) {
+    throw new Error('Every erasure record needs a userId');
+  }
+
+  const shredding = new ShreddingLedgerService(ledger, keyVault);
+  const pageSize = options.pageSize || DEFAULT_PAGE_SIZE;
+  const users: UserAnonymizationResult[] = [];
+
+  for (const erasure of erasureLog) {
+    const violations: AnonymizationViolation[] = [];
+    const userId = erasure.userId;
+
+    if (!(await keyVault.isDestroyed(userId)) || (await keyVault.getKey(userId)) !== null) {
+      violations.push({ userId, reason: 'key_not_destroyed' });
+    }
+
+    const entries = await readHistory(ledger, userId, pageSize);
+    for (const entry of entries) {
+      const found = (reason: AnonymizationViolationReason) =>
+        violations.push({ userId, reason, entryId: entry.entryId, transactionId: entry.transactionId });
+
+      if (!entry.signature) {
+        found('unsigned');
+      } else if (!verifyEntrySignature(entry, options.verificationPublicKey)) {
+        found('signature_invalid');
+      }
+
+      if (entry.metadata && (!isShreddedMetadata(entry.metadata) || (await shredding.getEntry(entry.entryId))?.metadata)) {
+        found('metadata_readable');
+      }
+    }
+
+    users.push({ userId, erasedAt: erasure.erasedAt, entriesChecked: entries.length, violations });
+  }
+
+  const violations = users.flatMap(user => user.violations);
+  return {
+    passed: violations.length === 0,
+    users,
+    entriesChecked: users.reduce((total, user) => total + user.entriesChecked, 0),
+    violations,
+    auditedAt: new Date(),
+  };
+}
+
+async function readHistory(ledger: ILedgerService, userId: string, pageSize: number): Promise<LedgerEntry[]> {
+  const entries: LedgerEntry[] = [];
+  let hasMore = true;
+
+  while (hasMore) {
+    const page = await ledger.queryEntries({
+      accountId: userId,
+      accountType: 'user',
+      sortBy: 'timestamp',
+      sortOrder: 'asc',
+      offset: entries.length,
+      limit: pageSize,
+    });
+    entries.push(...page.entries);
+    hasMore = page.hasMore && page.entries.length > 0;
+  }
+
+  return entries;
+}
@@ -0,0 +1,8 @@
+/**
+ * Crypto-Shredding Module Exports
+ */
+
+export { ShreddingLedgerService, createShreddingLedgerService, isShreddedMetadata } from './service';
+export * from './audit';
+export { InMemoryKeyVault } from './key-vault';
+export * from './types';
@@ -0,0 +1,45 @@
+/**
+ * In-Memory Key Vault
+ *
+ * Process-local IKeyVault for development and tests. Production
+ * deployments should back IKeyVault with a KMS so that destroyed keys
+ * are unrecoverable.
+ */
+
+import { randomBytes } from 'crypto';
+import { IKeyVault } from './types';
+
+export class InMemoryKeyVault implements IKeyVault {
+  private keys: Map<string, Buffer> = new Map();
+  private destroyed: Set<string> = new Set();
+
+  async getKey(userId: string): Promise<Buffer | null> {
+    return this.keys.get(userId) || null;
+  }
+
+  async getOrCreateKey(userId: string): Promise<Buffer> {
+    if (this.destroyed.has(userId)) {
+      throw new Error(`Data key for user ${userId} was destroyed`);
+    }
+
+    let key = this.keys.get(userId);
+    if (!key) {
+      key = randomBytes(32);
+      this.keys.set(userId, key);
+    }
+    return key;
+  }
+
+  async destroyKey(userId: string): Promise<void> {
+    const key = this.keys.get(userId);
+    if (key) {
+      key.fill(0);
+    }
+    this.keys.delete(userId);
+    this.destroyed.add(userId);
+  }
+
+  async isDestroyed(userId: string): Promise<boolean> {
+    return this.destroyed.has(userId);
+  }
+}
@@ -0,0 +1,98 @@
+/**
+ * Shredding Ledger Service Tests
+ */
+
+import { ShreddingLedgerService } from './service';
+import { InMemoryKeyVault } from './key-vault';
+import { CreateLedgerEntryRequest, ILedgerService, LedgerEntry } from '../ledger/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+describe('ShreddingLedgerService', () => {
+  let stored: LedgerEntry[];
+  let inner: jest.Mocked<ILedgerService>;
+  let keyVault: InMemoryKeyVault;
+  let service: ShreddingLedgerService;
+
+  const request = (overrides: Partial<CreateLedgerEntryRequest> = {}): CreateLedgerEntryRequest => ({
+    transactionId: 'txn-1',
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.ADMIN_CREDIT,
+    idempotencyKey: `key-${stored.length}`,
+    requestId: 'req-1',
+    balanceBefore: 0,
+    balanceAfter: 100,
+    currency: 'points',
+    metadata: { note: 'goodwill credit' },
+    ...overrides,
+  });
+
+  beforeEach(() => {
+    stored = [];
+    inner = {
+      createEntry: jest.fn().mockImplementation(async (req: CreateLedgerEntryRequest) => {
+        const entry = { ...req, entryId: `entry-${stored.length}`, timestamp: new Date() } as LedgerEntry;
+        stored.push(entry);
+        return entry;
+      }),
+      queryEntries: jest.fn().mockImplementation(async () => ({
+        entries: stored,
+        totalCount: stored.length,
+        offset: 0,
+        limit: 100,
+        hasMore: false,
+      })),
+      getEntry: jest.fn().mockImplementation(async (id: string) =>
+        stored.find(e => e.entryId === id) || null
+      ),
+      getBalanceSnapshot: jest.fn(),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn(),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+    keyVault = new InMemoryKeyVault();
+    service = new ShreddingLedgerService(inner, keyVault);
+  });
+
+  it('should store user metadata encrypted and return it decrypted', async () => {
+    const entry = await service.createEntry(request());
+
+    expect(entry.metadata).toEqual({ note: 'goodwill credit' });
+    expect(JSON.stringify(stored[0].metadata)).not.toContain('goodwill');
+
+    const read = await service.getEntry(entry.entryId);
+    expect(read?.metadata).toEqual({ note: 'goodwill credit' });
+    expect(read?.metadataErased).toBeUndefined();
+  });
+
+  it('should leave model account metadata in plaintext', async () => {
+    await service.createEntry(request({ accountId: 'model-1', accountType: 'model' }));
+
+    expect(stored[0].metadata).toEqual({ note: 'goodwill credit' });
+  });
+
+  it('should redact erased users without affecting others', async () => {
+    await service.createEntry(request());
+    await service.createEntry(request({ accountId: 'user-456' }));
+
+    const result = await service.erase('user-123');
+    expect(result.keyDestroyed).toBe(true);
+
+    const { entries } = await service.queryEntries({});
+    expect(entries[0].metadata).toBeUndefined();
+    expect(entries[0].metadataErased).toBe(true);
+    expect(entries[0].amount).toBe(100);
+    expect(entries[1].metadata).toEqual({ note: 'goodwill credit' });
+  });
+
+  it('should refuse new encrypted writes for an erased user', async () => {
+    await service.erase('user-123');
+
+    await expect(service.createEntry(request())).rejects.toThrow('was destroyed');
+  });
+});
@@ -0,0 +1,216 @@
+/**
+ * Shredding Ledger Service
+ *
+ * Wraps an ILedgerService so that entry metadata on user accounts is
+ * encrypted with a per-user data key before it is written and decrypted
+ * transparently on read. Destroying a user's key (erase) makes their
+ * metadata permanently unreadable while leaving amounts, balances and
+ * the rest of the append-only ledger intact.
+ *
+ * Reads of erased entries never fail: metadata is removed and the entry
+ * is flagged with metadataErased.
+ *
+ * @module shred/service
+ */
+
+import { createCipheriv, createDecipheriv, randomBytes } from 'crypto';
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from '../ledger/types';
+import { IKeyVault, ShreddedEnvelope, ErasureResult } from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+
+/**
+ * Metadata key under which the encrypted envelope is stored
+ */
+const ENVELOPE_KEY = '__shredded';
+
+const CIPHER = 'aes-256-gcm';
+
+/**
+ * Whether stored metadata is an encrypted envelope and nothing else
+ */
+export function isShreddedMetadata(metadata: Record<string, any>): boolean {
+  const keys = Object.keys(metadata);
+  return keys.length === 1 && keys[0] === ENVELOPE_KEY && metadata[ENVELOPE_KEY]?.v === 1;
+}
+
+/**
+ * ShreddingLedgerService implementation
+ */
+export class ShreddingLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private keyVault: IKeyVault;
+
+  constructor(inner: ILedgerService, keyVault: IKeyVault) {
+    this.inner = inner;
+    this.keyVault = keyVault;
+  }
+
+  /**
+   * Destroy a user's data key, crypto-shredding their entry metadata
+   */
+  async erase(userId: string): Promise<ErasureResult> {
+    if (!userId) {
+      throw new Error('userId is required for erasure');
+    }
+
+    const keyDestroyed = (await this.keyVault.getKey(userId)) !== null;
+    await this.keyVault.destroyKey(userId);
+    const erasedAt = new Date();
+
+    MetricsLogger.incrementCounter(MetricEventType.LEDGER_DATA_ERASED, {
+      userId,
+      keyDestroyed,
+    });
+
+    return { userId, keyDestroyed, erasedAt };
+  }
+
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    if (request.accountType !== 'user' || !request.metadata) {
+      return this.inner.createEntry(request);
+    }
+
+    const key = await this.keyVault.getOrCreateKey(request.accountId);
+    const metadata = { [ENVELOPE_KEY]: encryptMetadata(request.metadata, key, request.accountId) };
+    const entry = await this.inner.createEntry({ ...request, metadata });
+
+    return this.decryptEntry(entry);
+  }
+
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    const result = await this.inner.queryEntries(filter);
+    const entries = await Promise.all(result.entries.map(entry => this.decryptEntry(entry)));
+    return { ...result, entries };
+  }
+
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    const entry = await this.inner.getEntry(entryId);
+    return entry ? this.decryptEntry(entry) : null;
+  }
+
+  async entryExists(entryId: string): Promise<boolean> {
+    return this.inner.entryExists(entryId);
+  }
+
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    return this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    const trail = await this.inner.getAuditTrail(transactionId);
+    return Promise.all(
+      trail.map(async audit => ({
+        ...audit,
+        ledgerEntry: await this.decryptEntry(audit.ledgerEntry),
+      }))
+    );
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  /**
+   * Replace an entry's encrypted metadata with plaintext, or redact it
+   * if the owning user's key has been destroyed
+   */
+  private async decryptEntry(entry: LedgerEntry): Promise<LedgerEntry> {
+    const envelope = entry.metadata?.[ENVELOPE_KEY] as ShreddedEnvelope | undefined;
+    if (!envelope) {
+      return entry;
+    }
+
+    const key = await this.keyVault.getKey(entry.accountId);
+    if (!key) {
+      const redacted: LedgerEntry = { ...entry, metadataErased: true };
+      delete redacted.metadata;
+      return redacted;
+    }
+
+    return { ...entry, metadata: decryptMetadata(envelope, key, entry.accountId) };
+  }
+}
+
+/**
+ * Encrypt metadata with AES-256-GCM, binding the ciphertext to the account
+ */
+function encryptMetadata(
+  metadata: Record<string, any>,
+  key: Buffer,
+  accountId: string
+): ShreddedEnvelope {
+  const iv = randomBytes(12);
+  const cipher = createCipheriv(CIPHER, key, iv);
+  cipher.setAAD(Buffer.from(accountId, 'utf8'));
+  const data = Buffer.concat([
+    cipher.update(JSON.stringify(metadata), 'utf8'),
+    cipher.final(),
+  ]);
+
+  return {
+    v: 1,
+    iv: iv.toString('base64'),
+    tag: cipher.getAuthTag().toString('base64'),
+    data: data.toString('base64'),
+  };
+}
+
+/**
+ * Decrypt an envelope produced by encryptMetadata
+ */
+function decryptMetadata(
+  envelope: ShreddedEnvelope,
+  key: Buffer,
+  accountId: string
+): Record<string, any> {
+  const decipher = createDecipheriv(CIPHER, key, Buffer.from(envelope.iv, 'base64'));
+  decipher.setAAD(Buffer.from(accountId, 'utf8'));
+  decipher.setAuthTag(Buffer.from(envelope.tag, 'base64'));
+  const plaintext = Buffer.concat([
+    decipher.update(Buffer.from(envelope.data, 'base64')),
+    decipher.final(),
+  ]);
+
+  return JSON.parse(plaintext.toString('utf8'));
+}
+
+/**
+ * Factory function to create a shredding ledger service
+ */
+export function createShreddingLedgerService(
+  inner: ILedgerService,
+  keyVault: IKeyVault
+): ShreddingLedgerService {
+  return new ShreddingLedgerService(inner, keyVault);
+}
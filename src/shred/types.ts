@@ -0,0 +1,61 @@
+/**
+ * Crypto-Shredding Types
+ */
+
+/**
+ * Store of per-user data encryption keys
+ * Destroying a user's key makes their encrypted ledger fields unreadable.
+ */
+export interface IKeyVault {
+  /**
+   * Get a user's data key, or null if none exists (never created or destroyed)
+   */
+  getKey(userId: string): Promise<Buffer | null>;
+
+  /**
+   * Get a user's data key, creating one if none exists
+   * @throws Error if the user's key was destroyed
+   */
+  getOrCreateKey(userId: string): Promise<Buffer>;
+
+  /**
+   * Permanently destroy a user's data key
+   */
+  destroyKey(userId: string): Promise<void>;
+
+  /**
+   * Whether a user's key was destroyed
+   */
+  isDestroyed(userId: string): Promise<boolean>;
+}
+
+/**
+ * Encrypted field envelope stored in place of plaintext metadata
+ */
+export interface ShreddedEnvelope {
+  /** Envelope format version */
+  v: 1;
+
+  /** AES-256-GCM initialisation vector (base64) */
+  iv: string;
+
+  /** AES-256-GCM authentication tag (base64) */
+  tag: string;
+
+  /** Ciphertext (base64) */
+  data: string;
+}
+
+/**
+ * Result of an erasure request
+ */
+export interface ErasureResult {
+  /** User whose key was destroyed */
+  userId: string;
+
+  /** Whether a key existed to destroy */
+  keyDestroyed: boolean;
+
+  /** Erasure timestamp */
+  erasedAt: Date;
+}
@@ -0,0 +1,33 @@
+/**
+ * In-Memory Archive
+ *
+ * Process-local IArchiveWriter for development and tests. Production
+ * deployments should back IArchiveWriter with durable, write-once
+ * storage.
+ */
+
+import { LedgerEntry } from '../ledger/types';
+import { IArchiveWriter } from './types';
+
+export class InMemoryArchive implements IArchiveWriter {
+  private entries: Map<string, LedgerEntry> = new Map();
+
+  async write(entries: LedgerEntry[]): Promise<void> {
+    for (const entry of entries) {
+      this.entries.set(entry.entryId, structuredClone(entry));
+    }
+  }
+
+  async read(entryIds: string[]): Promise<LedgerEntry[]> {
+    return entryIds
+      .filter(entryId => this.entries.has(entryId))
+      .map(entryId => structuredClone(this.entries.get(entryId)!));
+  }
+
+  /**
+   * Number of archived entries
+   */
+  get size(): number {
+    return this.entries.size;
+  }
+}
@@ -0,0 +1,8 @@
+/**
+ * Retention Tiering Module Exports
+ */
+
+export { TieredLedgerService, TieredEntryScanStore, createTieredLedgerService } from './service';
+export { tierOldEntries, entryChecksum, TierOptions } from './tiering';
+export { InMemoryArchive } from './archive';
+export * from './types';
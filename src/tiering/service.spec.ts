@@ -0,0 +1,282 @@
+/**
+ * Tiered Ledger Service Tests
+ */
+
+import { TieredLedgerService, TieredEntryScanStore } from './service';
+import { InMemoryArchive } from './archive';
+import { entryChecksum } from './tiering';
+import { ILedgerService, LedgerEntry, LedgerQueryFilter } from '../ledger/types';
+import { LedgerTierStubModel } from '../db/models/ledger-tier-stub.model';
+import { LedgerInconsistencyError, ReplayContentConflictError } from '../services/types';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/ledger-tier-stub.model');
+
+describe('TieredLedgerService', () => {
+  let stubs: any[];
+  let hotEntries: LedgerEntry[];
+  let archive: InMemoryArchive;
+  let inner: jest.Mocked<ILedgerService>;
+  let service: TieredLedgerService;
+
+  const entry = (entryId: string, timestamp: string, overrides: Partial<LedgerEntry> = {}): LedgerEntry => ({
+    entryId,
+    transactionId: `tx-${entryId}`,
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `key-${entryId}`,
+    requestId: `req-${entryId}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+    timestamp: new Date(timestamp),
+    currency: 'points',
+    ...overrides,
+  });
+
+  const tier = async (...entries: LedgerEntry[]) => {
+    await archive.write(entries);
+    stubs.push(
+      ...entries.map(e => ({
+        entryId: e.entryId,
+        transactionId: e.transactionId,
+        accountId: e.accountId,
+        accountType: e.accountType,
+        balanceState: e.balanceState,
+        balanceAfter: e.balanceAfter,
+        idempotencyKey: e.idempotencyKey,
+        timestamp: e.timestamp,
+        checksum: entryChecksum(e),
+        manifestId: 'manifest-1',
+      }))
+    );
+  };
+
+  const stubMatches = (stub: any, query: any): boolean =>
+    Object.entries(query).every(([field, condition]: [string, any]) => {
+      const value = stub[field];
+      return (
+        (condition.$exists === undefined || (value !== undefined) === condition.$exists) &&
+        (condition.$eq === undefined || value === condition.$eq) &&
+        (condition.$gte === undefined || value >= condition.$gte) &&
+        (condition.$lte === undefined || value <= condition.$lte)
+      );
+    });
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    stubs = [];
+    hotEntries = [];
+    archive = new InMemoryArchive();
+
+    (LedgerTierStubModel.find as jest.Mock).mockImplementation((query: any) => {
+      let rows = () => stubs.filter(stub => stubMatches(stub, query));
+      const chain: any = {
+        sort: jest.fn().mockImplementation(() => {
+          const unsorted = rows;
+          rows = () => unsorted().sort((a, b) => b.timestamp - a.timestamp);
+          return chain;
+        }),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockImplementation(async () => rows()),
+      };
+      return chain;
+    });
+    (LedgerTierStubModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockResolvedValue(stubs.find(stub => stubMatches(stub, query)) || null),
+    }));
+
+    inner = {
+      createEntry: jest.fn().mockImplementation(async () => entry('new', '2025-01-01')),
+      queryEntries: jest.fn().mockImplementation(async (filter: LedgerQueryFilter) => {
+        const matching = hotEntries
+          .filter(e => e.accountId === filter.accountId)
+          .filter(e => !filter.balanceState || e.balanceState === filter.balanceState)
+          .filter(e => !filter.endDate || e.timestamp <= filter.endDate)
+          .sort((a, b) => (filter.sortOrder === 'asc' ? 1 : -1) * (a.timestamp.getTime() - b.timestamp.getTime()));
+        const offset = filter.offset || 0;
+        const limit = filter.limit || 100;
+        return {
+          entries: matching.slice(offset, offset + limit),
+          totalCount: matching.length,
+          offset,
+          limit,
+          hasMore: offset + limit < matching.length,
+        };
+      }),
+      getEntry: jest.fn().mockImplementation(async (id: string) => hotEntries.find(e => e.entryId === id) || null),
+      entryExists: jest.fn(),
+      getBalanceSnapshot: jest.fn().mockImplementation(async (accountId: string, accountType: 'user') => {
+        const latest = hotEntries.filter(e => e.balanceState === 'available').pop();
+        return {
+          accountId,
+          accountType,
+          availableBalance: latest ? latest.balanceAfter : 0,
+          escrowBalance: 0,
+          asOf: new Date(),
+          currency: 'points',
+        };
+      }),
+      generateReconciliationReport: jest.fn(),
+      getAuditTrail: jest.fn().mockResolvedValue([]),
+      checkIdempotency: jest.fn(),
+      storeIdempotencyResult: jest.fn(),
+    } as any;
+
+    service = new TieredLedgerService(inner, archive);
+  });
+
+  it('finds a tiered entry by ID through the archive', async () => {
+    const old = entry('old', '2016-01-01');
+    await tier(old);
+
+    await expect(service.getEntry('old')).resolves.toEqual(old);
+    await expect(service.getEntry('missing')).resolves.toBeNull();
+  });
+
+  it('reports tiered entries as existing', async () => {
+    await tier(entry('old', '2016-01-01'));
+    inner.entryExists.mockResolvedValue(false);
+    (LedgerTierStubModel.exists as jest.Mock).mockImplementation((query: any) => ({
+      exec: jest.fn().mockResolvedValue(stubs.some(stub => stubMatches(stub, query)) ? { _id: 'oid' } : null),
+    }));
+
+    await expect(service.entryExists('old')).resolves.toBe(true);
+    await expect(service.entryExists('missing')).resolves.toBe(false);
+  });
+
+  it('raises an inconsistency when an archived copy is altered', async () => {
+    await tier(entry('old', '2016-01-01'));
+    await archive.write([entry('old', '2016-01-01', { amount: 5 })]);
+
+    await expect(service.getEntry('old')).rejects.toBeInstanceOf(LedgerInconsistencyError);
+  });
+
+  it('merges archived entries into account queries with combined paging', async () => {
+    await tier(entry('a1', '2016-01-01'), entry('a2', '2016-02-01', { type: TransactionType.DEBIT }));
+    hotEntries = [entry('h1', '2024-01-01'), entry('h2', '2024-02-01')];
+
+    const all = await service.queryEntries({ accountId: 'user-123', sortOrder: 'asc' });
+    expect(all.entries.map(e => e.entryId)).toEqual(['a1', 'a2', 'h1', 'h2']);
+    expect(all.totalCount).toBe(4);
+
+    const page = await service.queryEntries({ accountId: 'user-123', sortOrder: 'desc', offset: 1, limit: 2 });
+    expect(page.entries.map(e => e.entryId)).toEqual(['h1', 'a2']);
+    expect(page.hasMore).toBe(true);
+
+    const credits = await service.queryEntries({ accountId: 'user-123', type: TransactionType.CREDIT, sortOrder: 'asc' });
+    expect(credits.entries.map(e => e.entryId)).toContain('a1');
+    expect(credits.entries.map(e => e.entryId)).not.toContain('a2');
+  });
+
+  it('leaves queries without an account filter to the primary store', async () => {
+    await tier(entry('a1', '2016-01-01'));
+
+    await service.queryEntries({ reason: TransactionReason.PROMOTIONAL_AWARD });
+
+    expect(LedgerTierStubModel.find).not.toHaveBeenCalled();
+  });
+
+  it('includes archived entries in the audit trail', async () => {
+    const old = entry('a1', '2016-01-01', { transactionId: 'tx-shared' });
+    await tier(old);
+    const recent = entry('h1', '2024-01-01', { transactionId: 'tx-shared' });
+    inner.getAuditTrail.mockResolvedValue([{ auditId: 'h1', ledgerEntry: recent, auditedAt: recent.timestamp }]);
+
+    const trail = await service.getAuditTrail('tx-shared');
+
+    expect(trail.map(a => a.auditId)).toEqual(['a1', 'h1']);
+  });
+
+  it('takes the balance from the archive when every entry for a state is archived', async () => {
+    await tier(entry('a1', '2016-01-01', { balanceAfter: 750 }));
+
+    const snapshot = await service.getBalanceSnapshot('user-123', 'user');
+
+    expect(snapshot.availableBalance).toBe(750);
+  });
+
+  it('prefers a later primary store balance', async () => {
+    await tier(entry('a1', '2016-01-01', { balanceAfter: 750 }));
+    hotEntries = [entry('h1', '2024-01-01', { balanceAfter: 900 })];
+
+    await expect(service.getBalanceSnapshot('user-123', 'user')).resolves.toMatchObject({ availableBalance: 900 });
+  });
+
+  it('replays an archived entry instead of reusing its idempotency key', async () => {
+    const old = entry('a1', '2016-01-01');
+    await tier(old);
+
+    const replayed = await service.createEntry({ ...old, idempotencyKey: 'key-a1' });
+
+    expect(replayed).toEqual(old);
+    expect(inner.createEntry).not.toHaveBeenCalled();
+  });
+
+  it('rejects a replay of an archived key carrying a different transaction', async () => {
+    const old = entry('a1', '2016-01-01');
+    await tier(old);
+
+    const error = await service.createEntry({ ...old, amount: 500 }).catch(e => e);
+
+    expect(error).toBeInstanceOf(ReplayContentConflictError);
+    expect(error.details).toMatchObject({ entryId: 'a1', fields: ['amount'] });
+    expect(inner.createEntry).not.toHaveBeenCalled();
+  });
+
+  it('reads archived entries for a page a batch of stubs at a time', async () => {
+    await tier(entry('a1', '2016-01-01'), entry('a2', '2016-02-01'));
+    hotEntries = [entry('h1', '2024-01-01')];
+
+    await service.queryEntries({ accountId: 'user-123', limit: 2 });
+
+    const stubRead = (LedgerTierStubModel.find as jest.Mock).mock.results[0].value;
+    expect(stubRead.sort).toHaveBeenCalledWith({ timestamp: -1, entryId: -1 });
+    expect(stubRead.limit).toHaveBeenCalledWith(1000);
+  });
+
+  it('does not replay an archived entry from another idempotency scope', async () => {
+    const old = entry('a1', '2016-01-01');
+    await tier(old);
+
+    await service.createEntry({ ...old, idempotencyKey: 'key-a1', idempotencyScope: 'merchant-1' });
+
+    expect(inner.createEntry).toHaveBeenCalled();
+  });
+
+  describe('TieredEntryScanStore', () => {
+    const scanStubs = () =>
+      (LedgerTierStubModel.find as jest.Mock).mockImplementation(() => ({
+        sort: jest.fn().mockReturnThis(),
+        limit: jest.fn().mockReturnThis(),
+        lean: jest.fn().mockReturnThis(),
+        exec: jest.fn().mockImplementation(async () => [...stubs].sort((a, b) => a.timestamp - b.timestamp)),
+      }));
+
+    it('scans both tiers in chain order, seeing an entry caught mid-move once', async () => {
+      await tier(entry('a1', '2016-01-01'), entry('a3', '2016-03-01'), entry('h4', '2016-04-01'));
+      hotEntries = [entry('h2', '2016-02-01'), entry('h4', '2016-04-01')];
+      scanStubs();
+      const scan = new TieredEntryScanStore({ scanEntries: jest.fn().mockResolvedValue(hotEntries) }, archive);
+
+      const page = await scan.scanEntries(null, 10);
+
+      expect(page.map(e => e.entryId)).toEqual(['a1', 'h2', 'a3', 'h4']);
+    });
+
+    it('rejects an altered archived entry', async () => {
+      await tier(entry('a1', '2016-01-01'));
+      await archive.write([entry('a1', '2016-01-01', { amount: 999 })]);
+      scanStubs();
+      const scan = new TieredEntryScanStore({ scanEntries: jest.fn().mockResolvedValue([]) }, archive);
+
+      await expect(scan.scanEntries(null, 10)).rejects.toBeInstanceOf(LedgerInconsistencyError);
+    });
+  });
+});
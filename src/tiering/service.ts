@@ -0,0 +1,496 @@
+/**
+ * Tiered Ledger Service
+ *
+ * Wraps an ILedgerService so that entries moved out of the primary store
+ * by tierOldEntries (removeFromPrimary) stay part of the ledger. Reads
+ * consult the stub index and merge archived entries with the primary
+ * store:
+ * - getEntry falls back to the archive for a tiered entry
+ * - queryEntries by account merges archived entries into the result,
+ *   with paging and counts over the combined set; archived entries are
+ *   read a page of stubs at a time, in the query's timestamp order, up
+ *   to the end of the requested page
+ * - getAuditTrail includes a transaction's archived entries
+ * - Balance snapshots use an archived entry when it is the latest for a
+ *   balance state
+ * - createEntry replays an archived entry whose idempotency key matches,
+ *   and rejects a replay carrying a different transaction
+ *
+ * Archived copies are checked against the checksum on their stub; a
+ * missing or altered copy is a LedgerInconsistencyError rather than a
+ * silent gap. Queries without an account filter and reconciliation
+ * reports cover the primary store only.
+ *
+ * TieredEntryScanStore does the same for full (timestamp, entryId)
+ * scans, so the attestation chain hash still folds tiered entries.
+ *
+ * @module tiering/service
+ */
+
+import {
+  ILedgerService,
+  LedgerEntry,
+  CreateLedgerEntryRequest,
+  LedgerQueryFilter,
+  LedgerQueryResult,
+  BalanceSnapshot,
+  ReconciliationReport,
+  AuditTrailEntry,
+} from '../ledger/types';
+import { LedgerTierStubModel } from '../db/models/ledger-tier-stub.model';
+import { LedgerInconsistencyError, ReplayContentConflictError } from '../services/types';
+import { IArchiveWriter } from './types';
+import { entryChecksum } from './tiering';
+import { IEntryScanStore } from '../ledger/attestation';
+import { ReplayPosition } from '../ledger/replay';
+
+/**
+ * Largest page the inner ledger service returns
+ */
+const MAX_PAGE_SIZE = 1000;
+
+/**
+ * Entry fields a replay of an archived entry must repeat
+ */
+const REPLAY_CONTENT_FIELDS = [
+  'accountId',
+  'accountType',
+  'amount',
+  'type',
+  'balanceState',
+  'stateTransition',
+  'reason',
+  'correlationId',
+  'groupId',
+  'escrowId',
+  'queueItemId',
+  'featureType',
+] as const;
+
+/**
+ * Stub fields used by the merged read path
+ */
+interface TierStub {
+  entryId: string;
+  balanceState: 'available' | 'escrow' | 'earned';
+  balanceAfter: number;
+  timestamp: Date;
+  checksum: string;
+}
+
+/**
+ * TieredLedgerService implementation
+ */
+export class TieredLedgerService implements ILedgerService {
+  private inner: ILedgerService;
+  private archive: IArchiveWriter;
+
+  constructor(inner: ILedgerService, archive: IArchiveWriter) {
+    this.inner = inner;
+    this.archive = archive;
+  }
+
+  /**
+   * Create an entry; a key already used by an archived entry in the same
+   * idempotency scope replays it
+   *
+   * @throws ReplayContentConflictError if the replay differs from the archived entry
+   */
+  async createEntry(request: CreateLedgerEntryRequest): Promise<LedgerEntry> {
+    const stub = await LedgerTierStubModel.findOne({
+      idempotencyKey: { $eq: request.idempotencyKey },
+      idempotencyScope: request.idempotencyScope ? { $eq: request.idempotencyScope } : { $exists: false },
+    })
+      .lean()
+      .exec();
+    if (stub) {
+      const [archived] = await this.readArchived([stub as TierStub]);
+      assertSameContent(request, archived);
+      return archived;
+    }
+
+    return this.inner.createEntry(request);
+  }
+
+  /**
+   * Query entries, merging archived entries when filtering by account
+   */
+  async queryEntries(filter: LedgerQueryFilter): Promise<LedgerQueryResult> {
+    if (!filter.accountId) {
+      return this.inner.queryEntries(filter);
+    }
+
+    const stubQuery: Record<string, any> = { accountId: { $eq: filter.accountId } };
+    if (filter.accountType) {
+      stubQuery.accountType = { $eq: filter.accountType };
+    }
+    if (filter.balanceState) {
+      stubQuery.balanceState = { $eq: filter.balanceState };
+    }
+    if (filter.startDate || filter.endDate) {
+      stubQuery.timestamp = {};
+      if (filter.startDate) {
+        stubQuery.timestamp.$gte = filter.startDate;
+      }
+      if (filter.endDate) {
+        stubQuery.timestamp.$lte = filter.endDate;
+      }
+    }
+
+    const offset = filter.offset || 0;
+    const limit = Math.min(filter.limit || 100, MAX_PAGE_SIZE);
+    const archived = await this.leadingArchived(stubQuery, filter, offset + limit);
+    if (archived.totalCount === 0) {
+      return this.inner.queryEntries(filter);
+    }
+
+    // The first offset + limit primary entries are enough for any merged page
+    const hot = await this.leadingEntries(filter, offset + limit);
+    const sortBy = filter.sortBy || 'timestamp';
+    const direction = filter.sortOrder === 'asc' ? 1 : -1;
+    const merged = [...archived.entries, ...hot.entries].sort(
+      (a, b) => direction * (sortBy === 'amount' ? a.amount - b.amount : a.timestamp.getTime() - b.timestamp.getTime())
+    );
+
+    const totalCount = hot.totalCount + archived.totalCount;
+    return {
+      entries: merged.slice(offset, offset + limit),
+      totalCount,
+      offset,
+      limit,
+      hasMore: offset + limit < totalCount,
+    };
+  }
+
+  /**
+   * Get an entry by ID from the primary store or the archive
+   */
+  async getEntry(entryId: string): Promise<LedgerEntry | null> {
+    const entry = await this.inner.getEntry(entryId);
+    if (entry) {
+      return entry;
+    }
+
+    const stub = await LedgerTierStubModel.findOne({ entryId: { $eq: entryId } }).lean().exec();
+    if (!stub) {
+      return null;
+    }
+
+    const [archived] = await this.readArchived([stub as TierStub]);
+    return archived;
+  }
+
+  /**
+   * Whether an entry exists in the primary store or the archive tier
+   */
+  async entryExists(entryId: string): Promise<boolean> {
+    if (await this.inner.entryExists(entryId)) {
+      return true;
+    }
+
+    return (await LedgerTierStubModel.exists({ entryId: { $eq: entryId } }).exec()) !== null;
+  }
+
+  /**
+   * Balance snapshot, taking a balance from the archive when an archived
+   * entry is the latest for its state
+   */
+  async getBalanceSnapshot(
+    accountId: string,
+    accountType: 'user' | 'model',
+    asOf?: Date
+  ): Promise<BalanceSnapshot> {
+    const snapshot = await this.inner.getBalanceSnapshot(accountId, accountType, asOf);
+
+    const stubQuery: Record<string, any> = {
+      accountId: { $eq: snapshot.accountId },
+      accountType: { $eq: accountType },
+    };
+    if (asOf) {
+      stubQuery.timestamp = { $lte: asOf };
+    }
+
+    const stubs = (await LedgerTierStubModel.find(stubQuery).sort({ timestamp: -1 }).lean().exec()) as TierStub[];
+    if (stubs.length === 0) {
+      return snapshot;
+    }
+
+    const adjusted = { ...snapshot };
+    for (const balanceState of ['available', 'escrow', 'earned'] as const) {
+      const latestArchived = stubs.find(stub => stub.balanceState === balanceState);
+      if (!latestArchived) {
+        continue;
+      }
+
+      const latestHot = await this.inner.queryEntries({
+        accountId: snapshot.accountId,
+        accountType,
+        balanceState,
+        endDate: asOf,
+        sortBy: 'timestamp',
+        sortOrder: 'desc',
+        limit: 1,
+      });
+      const hot = latestHot.entries[0];
+      if (hot && hot.timestamp >= latestArchived.timestamp) {
+        continue;
+      }
+
+      if (balanceState === 'available') {
+        adjusted.availableBalance = latestArchived.balanceAfter;
+      } else if (balanceState === 'escrow' && accountType === 'user') {
+        adjusted.escrowBalance = latestArchived.balanceAfter;
+      } else if (balanceState === 'earned' && accountType === 'model') {
+        adjusted.earnedBalance = latestArchived.balanceAfter;
+      }
+    }
+
+    return adjusted;
+  }
+
+  async generateReconciliationReport(
+    accountId: string,
+    accountType: 'user' | 'model',
+    dateRange: { start: Date; end: Date }
+  ): Promise<ReconciliationReport> {
+    return this.inner.generateReconciliationReport(accountId, accountType, dateRange);
+  }
+
+  /**
+   * Audit trail including the transaction's archived entries
+   */
+  async getAuditTrail(transactionId: string): Promise<AuditTrailEntry[]> {
+    const trail = await this.inner.getAuditTrail(transactionId);
+    const stubs = await LedgerTierStubModel.find({ transactionId: { $eq: transactionId } }).lean().exec();
+    if (stubs.length === 0) {
+      return trail;
+    }
+
+    const archived = (await this.readArchived(stubs as TierStub[])).map(entry => ({
+      auditId: entry.entryId,
+      ledgerEntry: entry,
+      auditedAt: entry.timestamp,
+    }));
+
+    return [...archived, ...trail].sort((a, b) => a.auditedAt.getTime() - b.auditedAt.getTime());
+  }
+
+  async checkIdempotency(key: string, operationType: string): Promise<boolean> {
+    return this.inner.checkIdempotency(key, operationType);
+  }
+
+  async storeIdempotencyResult(
+    key: string,
+    operationType: string,
+    result: any,
+    statusCode: number,
+    ttlSeconds: number
+  ): Promise<void> {
+    return this.inner.storeIdempotencyResult(key, operationType, result, statusCode, ttlSeconds);
+  }
+
+  /**
+   * The first count primary store entries matching a filter, paging past
+   * the inner service's page size
+   */
+  private async leadingEntries(
+    filter: LedgerQueryFilter,
+    count: number
+  ): Promise<{ entries: LedgerEntry[]; totalCount: number }> {
+    const entries: LedgerEntry[] = [];
+    let totalCount = 0;
+
+    while (entries.length < count) {
+      const page = await this.inner.queryEntries({
+        ...filter,
+        offset: entries.length,
+        limit: Math.min(count - entries.length, MAX_PAGE_SIZE),
+      });
+      entries.push(...page.entries);
+      totalCount = page.totalCount;
+      if (!page.hasMore || page.entries.length === 0) {
+        break;
+      }
+    }
+
+    return { entries, totalCount };
+  }
+
+  /**
+   * The first count archived entries matching a filter, in its order,
+   * with their total
+   * Stubs are read a page at a time by (timestamp, entryId). Stubs carry
+   * no amount, so an amount-ordered query reads every matching stub. The
+   * total is exact once the stubs run out; otherwise it is the stub
+   * index count, which does not apply the filter fields stubs lack.
+   */
+  private async leadingArchived(
+    stubQuery: Record<string, any>,
+    filter: LedgerQueryFilter,
+    count: number
+  ): Promise<{ entries: LedgerEntry[]; totalCount: number }> {
+    if (filter.sortBy === 'amount') {
+      const stubs = (await LedgerTierStubModel.find(stubQuery).lean().exec()) as TierStub[];
+      const entries = (await this.readArchived(stubs)).filter(entry => matchesFilter(entry, filter));
+      return { entries, totalCount: entries.length };
+    }
+
+    const direction = filter.sortOrder === 'asc' ? 1 : -1;
+    const beyond = direction === 1 ? '$gt' : '$lt';
+    const entries: LedgerEntry[] = [];
+    let after: TierStub | undefined;
+
+    for (;;) {
+      const query = after
+        ? {
+            ...stubQuery,
+            $or: [
+              { timestamp: { [beyond]: after.timestamp } },
+              { timestamp: { $eq: after.timestamp }, entryId: { [beyond]: after.entryId } },
+            ],
+          }
+        : stubQuery;
+      const stubs = (await LedgerTierStubModel.find(query)
+        .sort({ timestamp: direction, entryId: direction })
+        .limit(MAX_PAGE_SIZE)
+        .lean()
+        .exec()) as TierStub[];
+      entries.push(...(await this.readArchived(stubs)).filter(entry => matchesFilter(entry, filter)));
+
+      if (stubs.length < MAX_PAGE_SIZE) {
+        return { entries, totalCount: entries.length };
+      }
+      if (entries.length >= count) {
+        break;
+      }
+      after = stubs[stubs.length - 1];
+    }
+
+    const indexed = await LedgerTierStubModel.countDocuments(stubQuery).exec();
+    return { entries, totalCount: Math.max(entries.length, indexed) };
+  }
+
+  private readArchived(stubs: TierStub[]): Promise<LedgerEntry[]> {
+    return readArchived(this.archive, stubs);
+  }
+}
+
+/**
+ * Entry scan over the primary store and the archive tier
+ * Each page merges the primary store's page with the archived entries of
+ * the stubs after the same position, so an entry is seen once whichever
+ * tier holds it, including one caught mid-move in both.
+ */
+export class TieredEntryScanStore implements IEntryScanStore {
+  private primary: IEntryScanStore;
+  private archive: IArchiveWriter;
+
+  constructor(primary: IEntryScanStore, archive: IArchiveWriter) {
+    this.primary = primary;
+    this.archive = archive;
+  }
+
+  /**
+   * Entries after a position across both tiers, ordered by timestamp then entry ID
+   *
+   * @throws LedgerInconsistencyError if an archived copy is missing or altered
+   */
+  async scanEntries(after: ReplayPosition | null, limit: number): Promise<LedgerEntry[]> {
+    const stubQuery = after
+      ? {
+          $or: [
+            { timestamp: { $gt: after.timestamp } },
+            { timestamp: { $eq: after.timestamp }, entryId: { $gt: after.entryId } },
+          ],
+        }
+      : {};
+    const [hot, stubs] = await Promise.all([
+      this.primary.scanEntries(after, limit),
+      LedgerTierStubModel.find(stubQuery).sort({ timestamp: 1, entryId: 1 }).limit(limit).lean().exec(),
+    ]);
+
+    const byId = new Map<string, LedgerEntry>();
+    for (const entry of [...hot, ...(await readArchived(this.archive, stubs as TierStub[]))]) {
+      byId.set(entry.entryId, byId.get(entry.entryId) || entry);
+    }
+
+    return [...byId.values()]
+      .sort(
+        (a, b) =>
+          new Date(a.timestamp).getTime() - new Date(b.timestamp).getTime() ||
+          (a.entryId < b.entryId ? -1 : a.entryId > b.entryId ? 1 : 0)
+      )
+      .slice(0, limit);
+  }
+}
+
+/**
+ * Read archived entries for stubs, in stub order
+ *
+ * @throws LedgerInconsistencyError if a copy is missing or does not match its stub
+ */
+async function readArchived(archive: IArchiveWriter, stubs: TierStub[]): Promise<LedgerEntry[]> {
+  const copies = new Map((await archive.read(stubs.map(stub => stub.entryId))).map(entry => [entry.entryId, entry]));
+
+  return stubs.map(stub => {
+    const copy = copies.get(stub.entryId);
+    if (!copy || entryChecksum(copy) !== stub.checksum) {
+      throw new LedgerInconsistencyError(
+        `Archived entry ${stub.entryId} is ${copy ? 'altered' : 'missing'}`,
+        { entryId: stub.entryId }
+      );
+    }
+    return copy;
+  });
+}
+
+/**
+ * Reject a replay whose transaction differs from the archived entry
+ * holding its key
+ * The archived entry is compared as stored, so behind a tokenizing
+ * ledger the replay must carry the stored account ID. Metadata is not
+ * compared, since it may be archived sealed.
+ *
+ * @throws ReplayContentConflictError naming the fields that differ
+ */
+function assertSameContent(request: CreateLedgerEntryRequest, archived: LedgerEntry): void {
+  const differing: string[] = REPLAY_CONTENT_FIELDS.filter(
+    field => (request[field] ?? null) !== (archived[field] ?? null)
+  );
+  if (request.currency && request.currency !== archived.currency) {
+    differing.push('currency');
+  }
+  if (request.transactionId && request.transactionId !== archived.transactionId) {
+    differing.push('transactionId');
+  }
+
+  if (differing.length > 0) {
+    throw new ReplayContentConflictError(request.idempotencyKey, archived.entryId, differing);
+  }
+}
+
+/**
+ * Whether an archived entry matches the filter fields the stub index does
+ * not cover
+ */
+function matchesFilter(entry: LedgerEntry, filter: LedgerQueryFilter): boolean {
+  return (
+    (!filter.type || entry.type === filter.type) &&
+    (!filter.reason || entry.reason === filter.reason) &&
+    (!filter.escrowId || entry.escrowId === filter.escrowId) &&
+    (!filter.queueItemId || entry.queueItemId === filter.queueItemId) &&
+    (!filter.featureType || entry.featureType === filter.featureType) &&
+    (!filter.tenantId || entry.tenantId === filter.tenantId) &&
+    !(filter.excludeTransactionIds || []).includes(entry.transactionId) &&
+    (filter.fromStreamVersion === undefined ||
+      entry.streamVersion === undefined ||
+      entry.streamVersion >= filter.fromStreamVersion)
+  );
+}
+
+/**
+ * Factory function to create a tiered ledger service
+ */
+export function createTieredLedgerService(inner: ILedgerService, archive: IArchiveWriter): TieredLedgerService {
+  return new TieredLedgerService(inner, archive);
+}
@@ -0,0 +1,307 @@
+/**
+ * Retention Tiering Job Tests
+ */
+
+import { tierOldEntries, entryChecksum } from './tiering';
+import { InMemoryArchive } from './archive';
+import { IterationThrottle } from '../ledger/throttle';
+import { LedgerEntry } from '../ledger/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { LedgerTierStubModel } from '../db/models/ledger-tier-stub.model';
+import { LedgerTierManifestModel } from '../db/models/ledger-tier-manifest.model';
+import { TransactionType, TransactionReason } from '../wallets/types';
+
+jest.mock('../db/models/ledger-entry.model');
+jest.mock('../db/models/ledger-tier-stub.model');
+jest.mock('../db/models/ledger-tier-manifest.model');
+
+describe('tierOldEntries', () => {
+  const cutoff = new Date('2018-01-01T00:00:00Z');
+  const removing = { removeFromPrimary: true };
+
+  // In-memory primary store, stub index and manifests
+  let hot: Map<string, any>;
+  let stubs: Map<string, any>;
+  let manifests: any[];
+
+  const entry = (entryId: string, timestamp: string, overrides: Partial<LedgerEntry> = {}): LedgerEntry => ({
+    entryId,
+    transactionId: `tx-${entryId}`,
+    accountId: 'user-123',
+    accountType: 'user',
+    amount: 100,
+    type: TransactionType.CREDIT,
+    balanceState: 'available',
+    stateTransition: 'none→available',
+    reason: TransactionReason.PROMOTIONAL_AWARD,
+    idempotencyKey: `key-${entryId}`,
+    requestId: `req-${entryId}`,
+    balanceBefore: 0,
+    balanceAfter: 100,
+    timestamp: new Date(timestamp),
+    currency: 'points',
+    ...overrides,
+  });
+
+  const seed = (...entries: LedgerEntry[]) => {
+    for (const e of entries) {
+      hot.set(e.entryId, { _id: `oid-${e.entryId}`, __v: 0, ...e });
+    }
+  };
+
+  const matches = (doc: any, query: any): boolean => {
+    if (query['metadata.parentEntryId']) {
+      return query['metadata.parentEntryId'].$in.includes(doc.metadata?.parentEntryId);
+    }
+    if (doc.timestamp >= query.timestamp.$lt) {
+      return false;
+    }
+    if (query.$or) {
+      const [later, sameTime] = query.$or;
+      return (
+        doc.timestamp > later.timestamp.$gt ||
+        (doc.timestamp.getTime() === sameTime.timestamp.$eq.getTime() && doc.entryId > sameTime.entryId.$gt)
+      );
+    }
+    return true;
+  };
+
+  const chain = (rows: () => any[]) => {
+    let limit = Infinity;
+    const query: any = {
+      sort: jest.fn().mockReturnThis(),
+      limit: jest.fn().mockImplementation((n: number) => {
+        limit = n;
+        return query;
+      }),
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () =>
+        rows()
+          .sort((a, b) => a.timestamp - b.timestamp || (a.entryId < b.entryId ? -1 : 1))
+          .slice(0, limit)
+          .map(row => ({ ...row }))
+      ),
+    };
+    return query;
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    hot = new Map();
+    stubs = new Map();
+    manifests = [];
+
+    (LedgerEntryModel.find as jest.Mock).mockImplementation((query: any) =>
+      chain(() => [...hot.values()].filter(doc => matches(doc, query)))
+    );
+    (LedgerEntryModel.deleteMany as jest.Mock).mockImplementation(async (query: any) => {
+      for (const entryId of query.entryId.$in) {
+        hot.delete(entryId);
+      }
+      return { deletedCount: query.entryId.$in.length };
+    });
+    (LedgerTierStubModel.insertMany as jest.Mock).mockImplementation(async (docs: any[]) => {
+      const writeErrors: any[] = [];
+      for (const doc of docs) {
+        if (stubs.has(doc.entryId)) {
+          writeErrors.push({ code: 11000 });
+        } else {
+          stubs.set(doc.entryId, doc);
+        }
+      }
+      if (writeErrors.length > 0) {
+        throw Object.assign(new Error('E11000 duplicate key'), { writeErrors });
+      }
+      return docs;
+    });
+    (LedgerTierManifestModel.create as jest.Mock).mockImplementation(async (doc: any) => {
+      manifests.push(doc);
+      return doc;
+    });
+  });
+
+  it('archives, verifies and stubs entries older than the cutoff', async () => {
+    seed(entry('e1', '2016-05-01'), entry('e2', '2017-06-01'), entry('e3', '2019-01-01'));
+    const archive = new InMemoryArchive();
+
+    const report = await tierOldEntries(archive, cutoff, removing);
+
+    expect(report).toMatchObject({ candidates: 2, tiered: 2, blocked: [], verificationFailures: [], aborted: false });
+    expect([...hot.keys()]).toEqual(['e3']);
+    expect(archive.size).toBe(2);
+
+    const [archived] = await archive.read(['e1']);
+    expect(archived).not.toHaveProperty('_id');
+    expect(stubs.get('e1')).toMatchObject({
+      accountId: 'user-123',
+      idempotencyKey: 'key-e1',
+      checksum: entryChecksum(archived),
+      manifestId: report.manifestIds[0],
+    });
+    expect(manifests[0]).toMatchObject({ runId: report.runId, olderThan: cutoff, entryIds: ['e1', 'e2'] });
+  });
+
+  it('pages through candidates in batches', async () => {
+    seed(...Array.from({ length: 7 }, (_, i) => entry(`e${i}`, `2015-01-0${i + 1}`)));
+
+    const report = await tierOldEntries(new InMemoryArchive(), cutoff, { ...removing, batchSize: 3 });
+
+    expect(report.tiered).toBe(7);
+    expect(report.manifestIds).toHaveLength(3);
+    expect(hot.size).toBe(0);
+  });
+
+  it('keeps entries whose archive copy does not verify', async () => {
+    seed(entry('e1', '2016-05-01'), entry('e2', '2016-06-01'));
+    const archive = new InMemoryArchive();
+    const read = archive.read.bind(archive);
+    jest.spyOn(archive, 'read').mockImplementation(async ids =>
+      (await read(ids)).map(copy => (copy.entryId === 'e2' ? { ...copy, amount: 999 } : copy))
+    );
+
+    const report = await tierOldEntries(archive, cutoff, removing);
+
+    expect(report.tiered).toBe(1);
+    expect(report.verificationFailures).toEqual(['e2']);
+    expect(hot.has('e2')).toBe(true);
+    expect(stubs.has('e2')).toBe(false);
+  });
+
+  it('never removes anything when the archive write fails', async () => {
+    seed(entry('e1', '2016-05-01'));
+    const archive = new InMemoryArchive();
+    jest.spyOn(archive, 'write').mockRejectedValue(new Error('archive unavailable'));
+
+    await expect(tierOldEntries(archive, cutoff, removing)).rejects.toThrow('archive unavailable');
+
+    expect(hot.has('e1')).toBe(true);
+    expect(LedgerEntryModel.deleteMany).not.toHaveBeenCalled();
+  });
+
+  it('is idempotent when re-run, including after an interrupted run', async () => {
+    seed(entry('e1', '2016-05-01'), entry('e2', '2016-06-01'));
+    const archive = new InMemoryArchive();
+
+    // First run stubs everything but stops before removing
+    (LedgerEntryModel.deleteMany as jest.Mock).mockRejectedValueOnce(new Error('connection lost'));
+    await expect(tierOldEntries(archive, cutoff, removing)).rejects.toThrow('connection lost');
+    expect(hot.size).toBe(2);
+
+    const resumed = await tierOldEntries(archive, cutoff, removing);
+    expect(resumed.tiered).toBe(2);
+    expect(hot.size).toBe(0);
+
+    const again = await tierOldEntries(archive, cutoff, removing);
+    expect(again).toMatchObject({ candidates: 0, tiered: 0, manifestIds: [] });
+    expect(archive.size).toBe(2);
+    expect(stubs.size).toBe(2);
+  });
+
+  it('refuses to tier a parent whose child stays in the primary store', async () => {
+    seed(
+      entry('parent', '2016-05-01'),
+      entry('child', '2019-02-01', { metadata: { parentEntryId: 'parent' } }),
+      entry('unrelated', '2016-07-01')
+    );
+
+    const report = await tierOldEntries(new InMemoryArchive(), cutoff, removing);
+
+    expect(report.blocked).toEqual([{ entryId: 'parent', childEntryId: 'child' }]);
+    expect(report.tiered).toBe(1);
+    expect(hot.has('parent')).toBe(true);
+    expect(stubs.has('parent')).toBe(false);
+  });
+
+  it('moves a qualifying child together with its parent', async () => {
+    seed(
+      entry('parent', '2016-05-01'),
+      entry('child', '2017-03-01', { metadata: { parentEntryId: 'parent' } }),
+      entry('grandchild', '2017-04-01', { metadata: { parentEntryId: 'child' } })
+    );
+
+    const report = await tierOldEntries(new InMemoryArchive(), cutoff, { ...removing, batchSize: 1 });
+
+    expect(report).toMatchObject({ candidates: 3, tiered: 3, blocked: [] });
+    expect(manifests).toHaveLength(1);
+    expect(manifests[0].entryIds).toEqual(['parent', 'child', 'grandchild']);
+  });
+
+  it('keeps a parent when its child fails verification', async () => {
+    seed(entry('parent', '2016-05-01'), entry('child', '2017-03-01', { metadata: { parentEntryId: 'parent' } }));
+    const archive = new InMemoryArchive();
+    const read = archive.read.bind(archive);
+    jest.spyOn(archive, 'read').mockImplementation(async ids => (await read(ids)).filter(copy => copy.entryId !== 'child'));
+
+    const report = await tierOldEntries(archive, cutoff, removing);
+
+    expect(report.verificationFailures).toEqual(['child']);
+    expect(report.blocked).toEqual([{ entryId: 'parent', childEntryId: 'child' }]);
+    expect(report.tiered).toBe(0);
+    expect(hot.size).toBe(2);
+    expect(manifests).toHaveLength(0);
+  });
+
+  it('stops between batches when aborted', async () => {
+    seed(entry('e1', '2016-05-01'), entry('e2', '2016-06-01'));
+    const controller = new AbortController();
+    const archive = new InMemoryArchive();
+    const write = archive.write.bind(archive);
+    jest.spyOn(archive, 'write').mockImplementation(async entries => {
+      controller.abort();
+      return write(entries);
+    });
+
+    const report = await tierOldEntries(archive, cutoff, { ...removing, batchSize: 1, signal: controller.signal });
+
+    expect(report).toMatchObject({ tiered: 1, aborted: true });
+    expect(hot.has('e2')).toBe(true);
+  });
+
+  it('paces batches and reports throughput when throttled', async () => {
+    seed(...Array.from({ length: 4 }, (_, i) => entry(`e${i}`, `2015-01-0${i + 1}`)));
+    jest.useFakeTimers();
+
+    const run = tierOldEntries(new InMemoryArchive(), cutoff, {
+      ...removing,
+      batchSize: 2,
+      throttle: new IterationThrottle({ entriesPerSecond: 20 }),
+    });
+    await jest.runAllTimersAsync();
+    const report = await run;
+    jest.useRealTimers();
+
+    expect(report.tiered).toBe(4);
+    expect(report.throughput).toMatchObject({ entries: 4, elapsedMs: 200, throttledMs: 200 });
+  });
+
+  it('archives without removing anything by default', async () => {
+    (LedgerTierManifestModel.find as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () =>
+        manifests.filter(manifest => manifest.entryIds.some((id: string) => query.entryIds.$in.includes(id)))
+      ),
+    }));
+    seed(entry('e1', '2016-05-01'), entry('e2', '2017-06-01'));
+    const archive = new InMemoryArchive();
+
+    const report = await tierOldEntries(archive, cutoff);
+    const again = await tierOldEntries(archive, cutoff);
+
+    expect(report).toMatchObject({ candidates: 2, tiered: 2 });
+    expect(archive.size).toBe(2);
+    expect(hot.size).toBe(2);
+    expect(stubs.size).toBe(0);
+    expect(LedgerEntryModel.deleteMany).not.toHaveBeenCalled();
+    expect(again).toMatchObject({ candidates: 2, tiered: 0, manifestIds: [] });
+    expect(manifests).toHaveLength(1);
+  });
+
+  it('computes checksums independent of key order', () => {
+    const e = entry('e1', '2016-05-01', { metadata: { a: 1, b: { c: 2, d: 3 } } });
+    const reordered = JSON.parse(JSON.stringify({ ...e, metadata: { b: { d: 3, c: 2 }, a: 1 } }));
+    reordered.timestamp = new Date(reordered.timestamp);
+
+    expect(entryChecksum(reordered)).toBe(entryChecksum(e));
+    expect(entryChecksum({ ...e, amount: 101 })).not.toBe(entryChecksum(e));
+  });
+});
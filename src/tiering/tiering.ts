@@ -0,0 +1,363 @@
+/**
+ * Retention Tiering Job
+ *
+ * Copies ledger entries older than a cutoff into the archive tier and,
+ * when asked to, moves them out of the primary store.
+ *
+ * By default entries are archived and verified but stay in the primary
+ * store, so every reader of the ledger keeps seeing them. Only
+ * TieredLedgerService and TieredEntryScanStore read the archive tier;
+ * everything else reads LedgerEntryModel directly (references, reports,
+ * exports, aggregates). Set removeFromPrimary only where every reader of
+ * the tiered range goes through those two. Then nothing leaves the
+ * logical ledger either: each moved entry leaves a stub in
+ * ledger_tier_stubs, which the tiered readers merge back in.
+ *
+ * Each batch goes through the same steps, and an entry is only removed
+ * from the primary store after the earlier ones succeeded:
+ *   1. Hold back entries that a staying entry names as its parentEntryId
+ *      (when removing)
+ *   2. Write the batch to the archive
+ *   3. Read it back and compare each copy's checksum with the original
+ *   4. Record a manifest
+ *   5. When removing, record a stub per verified entry and remove the
+ *      verified entries from the primary store
+ *
+ * A qualifying child is pulled into its parent's batch so the two move
+ * together. Entries that fail verification stay where they are and are
+ * reported. Re-running the job is safe at any point: archive writes are
+ * idempotent, entries a manifest already covers are passed over when
+ * copying, existing stubs are kept, and entries already removed are no
+ * longer candidates.
+ */
+
+import { createHash } from 'crypto';
+import { v4 as uuidv4 } from 'uuid';
+import { LedgerEntry } from '../ledger/types';
+import { LedgerEntryModel } from '../db/models/ledger-entry.model';
+import { LedgerTierStubModel } from '../db/models/ledger-tier-stub.model';
+import { LedgerTierManifestModel } from '../db/models/ledger-tier-manifest.model';
+import { IArchiveWriter, TierBlockedEntry, TierReport } from './types';
+import { MetricsLogger, MetricEventType } from '../metrics';
+import { IterationThrottle } from '../ledger/throttle';
+
+/**
+ * Options for a tiering run
+ */
+export interface TierOptions {
+  /** Candidate entries read from the primary store per batch */
+  batchSize: number;
+
+  /** Stop after the current batch when aborted */
+  signal?: AbortSignal;
+
+  /** Paces the run batch by batch (unthrottled when unset) */
+  throttle?: IterationThrottle;
+
+  /**
+   * Remove verified entries from the primary store, leaving stubs
+   * Only safe when every reader of the tiered range is tier-aware.
+   */
+  removeFromPrimary: boolean;
+}
+
+const DEFAULT_OPTIONS: TierOptions = {
+  batchSize: 500,
+  removeFromPrimary: false,
+};
+
+/**
+ * Move entries older than a cutoff to the archive tier
+ *
+ * @param olderThan Entries with a timestamp strictly before this qualify
+ */
+export async function tierOldEntries(
+  archive: IArchiveWriter,
+  olderThan: Date,
+  options: Partial<TierOptions> = {}
+): Promise<TierReport> {
+  const resolved = { ...DEFAULT_OPTIONS, ...options };
+
+  if (!Number.isInteger(resolved.batchSize) || resolved.batchSize < 1) {
+    throw new Error('batchSize must be a positive integer');
+  }
+
+  const report: TierReport = {
+    runId: uuidv4(),
+    olderThan,
+    candidates: 0,
+    tiered: 0,
+    blocked: [],
+    verificationFailures: [],
+    manifestIds: [],
+    aborted: false,
+  };
+
+  // Keyset pagination, so entries left behind are not read again
+  let after: { timestamp: Date; entryId: string } | undefined;
+  resolved.throttle?.start();
+
+  for (;;) {
+    if (resolved.signal?.aborted) {
+      report.aborted = true;
+      break;
+    }
+
+    const query: Record<string, any> = { timestamp: { $lt: olderThan } };
+    if (after) {
+      query.$or = [
+        { timestamp: { $gt: after.timestamp } },
+        { timestamp: { $eq: after.timestamp }, entryId: { $gt: after.entryId } },
+      ];
+    }
+
+    const docs = await LedgerEntryModel.find(query)
+      .sort({ timestamp: 1, entryId: 1 })
+      .limit(resolved.batchSize)
+      .lean()
+      .exec();
+
+    if (docs.length === 0) {
+      break;
+    }
+
+    const last = docs[docs.length - 1];
+    after = { timestamp: last.timestamp, entryId: last.entryId };
+
+    await tierBatch(archive, docs.map(toEntry), report, resolved.removeFromPrimary);
+    await resolved.throttle?.consume(docs.length);
+  }
+
+  if (resolved.throttle) {
+    report.throughput = resolved.throttle.report();
+  }
+
+  MetricsLogger.incrementCounter(MetricEventType.LEDGER_ENTRIES_TIERED, {
+    runId: report.runId,
+    tiered: report.tiered,
+    blocked: report.blocked.length,
+    verificationFailures: report.verificationFailures.length,
+  });
+
+  return report;
+}
+
+/**
+ * Checksum of an entry's content, independent of key order
+ */
+export function entryChecksum(entry: LedgerEntry): string {
+  return createHash('sha256').update(canonicalJson(entry)).digest('hex');
+}
+
+/**
+ * Archive, verify and (when removing) remove one batch of candidates
+ */
+async function tierBatch(
+  archive: IArchiveWriter,
+  batch: LedgerEntry[],
+  report: TierReport,
+  removeFromPrimary: boolean
+): Promise<void> {
+  const moving = new Map(batch.map(entry => [entry.entryId, entry]));
+  report.candidates += moving.size;
+
+  if (!removeFromPrimary) {
+    await copyBatch(archive, moving, report);
+    return;
+  }
+
+  // Pull qualifying descendants in, collecting every child seen
+  const children: LedgerEntry[] = [];
+  let frontier = [...moving.keys()];
+  while (frontier.length > 0) {
+    const found = await LedgerEntryModel.find({ 'metadata.parentEntryId': { $in: frontier } }).lean().exec();
+    frontier = [];
+    for (const child of found.map(toEntry)) {
+      children.push(child);
+      if (!moving.has(child.entryId) && child.timestamp < report.olderThan) {
+        moving.set(child.entryId, child);
+        frontier.push(child.entryId);
+        report.candidates++;
+      }
+    }
+  }
+
+  report.blocked.push(...holdBackParents(moving, children));
+  if (moving.size === 0) {
+    return;
+  }
+
+  const checksums = await archiveVerified(archive, moving, report);
+
+  // A child that failed verification keeps its parent in place
+  report.blocked.push(...holdBackParents(moving, children));
+  if (moving.size === 0) {
+    return;
+  }
+
+  const entryIds = [...moving.keys()];
+  const manifestId = await recordManifest(entryIds, checksums, report);
+
+  const stubs = [...moving.values()].map(entry => ({
+    entryId: entry.entryId,
+    transactionId: entry.transactionId,
+    accountId: entry.accountId,
+    accountType: entry.accountType,
+    balanceState: entry.balanceState,
+    balanceAfter: entry.balanceAfter,
+    idempotencyKey: entry.idempotencyKey,
+    ...(entry.idempotencyScope && { idempotencyScope: entry.idempotencyScope }),
+    timestamp: entry.timestamp,
+    checksum: checksums.get(entry.entryId),
+    manifestId,
+  }));
+
+  try {
+    await LedgerTierStubModel.insertMany(stubs, { ordered: false });
+  } catch (error: any) {
+    // Stubs left by an interrupted earlier run are kept as they are
+    const writeErrors: any[] = error?.writeErrors || [];
+    if (writeErrors.length === 0 || writeErrors.some(writeError => writeError.code !== 11000)) {
+      throw error;
+    }
+  }
+
+  await LedgerEntryModel.deleteMany({ entryId: { $in: entryIds } });
+  report.tiered += entryIds.length;
+}
+
+/**
+ * Archive and verify one batch, leaving it in the primary store
+ * Entries an earlier run's manifest covers are already archived.
+ */
+async function copyBatch(archive: IArchiveWriter, moving: Map<string, LedgerEntry>, report: TierReport): Promise<void> {
+  const covered = await LedgerTierManifestModel.find({ entryIds: { $in: [...moving.keys()] } }, { entryIds: 1 })
+    .lean()
+    .exec();
+  for (const manifest of covered) {
+    manifest.entryIds.forEach(entryId => moving.delete(entryId));
+  }
+  if (moving.size === 0) {
+    return;
+  }
+
+  const checksums = await archiveVerified(archive, moving, report);
+  if (moving.size === 0) {
+    return;
+  }
+
+  await recordManifest([...moving.keys()], checksums, report);
+  report.tiered += moving.size;
+}
+
+/**
+ * Write entries to the archive and read them back, dropping from moving
+ * (and reporting) each one whose copy does not match
+ *
+ * @returns Checksum of every entry written
+ */
+async function archiveVerified(
+  archive: IArchiveWriter,
+  moving: Map<string, LedgerEntry>,
+  report: TierReport
+): Promise<Map<string, string>> {
+  const entries = [...moving.values()];
+  const checksums = new Map(entries.map(entry => [entry.entryId, entryChecksum(entry)]));
+
+  await archive.write(entries);
+  const copies = await archive.read([...moving.keys()]);
+
+  const verified = new Set(
+    copies.filter(copy => checksums.get(copy.entryId) === entryChecksum(copy)).map(copy => copy.entryId)
+  );
+  for (const entryId of moving.keys()) {
+    if (!verified.has(entryId)) {
+      moving.delete(entryId);
+      report.verificationFailures.push(entryId);
+      MetricsLogger.incrementCounter(MetricEventType.LEDGER_TIER_VERIFICATION_FAILED, {
+        runId: report.runId,
+        entryId,
+      });
+    }
+  }
+
+  return checksums;
+}
+
+/**
+ * Record the manifest of a verified batch
+ *
+ * @returns The manifest ID
+ */
+async function recordManifest(entryIds: string[], checksums: Map<string, string>, report: TierReport): Promise<string> {
+  const manifestId = uuidv4();
+  await LedgerTierManifestModel.create({
+    manifestId,
+    runId: report.runId,
+    olderThan: report.olderThan,
+    entryIds,
+    checksum: createHash('sha256')
+      .update(entryIds.map(entryId => checksums.get(entryId)).join('\n'))
+      .digest('hex'),
+    verifiedAt: new Date(),
+  });
+  report.manifestIds.push(manifestId);
+  return manifestId;
+}
+
+/**
+ * Remove entries from the moving set while a staying child names them as
+ * its parent, repeating until no more are removed
+ */
+function holdBackParents(moving: Map<string, LedgerEntry>, children: LedgerEntry[]): TierBlockedEntry[] {
+  const blocked: TierBlockedEntry[] = [];
+  let changed = true;
+
+  while (changed) {
+    changed = false;
+    for (const child of children) {
+      const parentEntryId = child.metadata?.parentEntryId;
+      if (moving.has(parentEntryId) && !moving.has(child.entryId)) {
+        moving.delete(parentEntryId);
+        blocked.push({ entryId: parentEntryId, childEntryId: child.entryId });
+        changed = true;
+      }
+    }
+  }
+
+  return blocked;
+}
+
+/**
+ * Strip storage-only fields from a primary store document
+ */
+function toEntry(doc: any): LedgerEntry {
+  const entry = { ...doc };
+  delete entry._id;
+  delete entry.__v;
+  delete entry.indexedTags;
+  return entry;
+}
+
+/**
+ * JSON with object keys sorted and undefined fields dropped, dates as ISO strings
+ */
+export function canonicalJson(value: unknown): string {
+  if (value instanceof Date) {
+    return JSON.stringify(value.toISOString());
+  }
+
+  if (Array.isArray(value)) {
+    return `[${value.map(canonicalJson).join(',')}]`;
+  }
+
+  if (value && typeof value === 'object') {
+    const fields = Object.keys(value)
+      .filter(key => (value as Record<string, unknown>)[key] !== undefined)
+      .sort()
+      .map(key => `${JSON.stringify(key)}:${canonicalJson((value as Record<string, unknown>)[key])}`);
+    return `{${fields.join(',')}}`;
+  }
+
+  return JSON.stringify(value);
+}
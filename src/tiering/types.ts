@@ -0,0 +1,65 @@
+/**
+ * Retention Tiering Types
+ */
+
+import { LedgerEntry } from '../ledger/types';
+import { ThrottleReport } from '../ledger/throttle';
+
+/**
+ * Long-term store ledger entries are moved to
+ * Writes must be idempotent: writing an entry that is already archived
+ * leaves a single copy.
+ */
+export interface IArchiveWriter {
+  /**
+   * Store entries in the archive
+   */
+  write(entries: LedgerEntry[]): Promise<void>;
+
+  /**
+   * Read archived entries back by ID; missing IDs are omitted
+   */
+  read(entryIds: string[]): Promise<LedgerEntry[]>;
+}
+
+/**
+ * An entry left in the primary store because moving it would orphan a
+ * child entry
+ */
+export interface TierBlockedEntry {
+  entryId: string;
+
+  /** Non-tiered entry whose parentEntryId references it */
+  childEntryId: string;
+}
+
+/**
+ * Outcome of a tiering run
+ */
+export interface TierReport {
+  runId: string;
+
+  /** Cutoff: entries strictly older than this qualify */
+  olderThan: Date;
+
+  /** Qualifying entries found in the primary store */
+  candidates: number;
+
+  /** Entries archived and verified (and removed from the primary store, when removing) */
+  tiered: number;
+
+  /** Entries kept back by the parent rule */
+  blocked: TierBlockedEntry[];
+
+  /** Entries whose archive copy was missing or did not match */
+  verificationFailures: string[];
+
+  /** Manifests recorded by this run */
+  manifestIds: string[];
+
+  /** Whether the run stopped early because its signal was aborted */
+  aborted: boolean;
+
+  /** Throughput of the run, when it was throttled */
+  throughput?: ThrottleReport;
+}
@@ -16,7 +16,7 @@ import {
 // Mock implementations
 const mockLedgerService = {
   checkIdempotency: jest.fn(),
-  createEntry: jest.fn(),
+  createEntry: jest.fn().mockResolvedValue({}),
   queryEntries: jest.fn(),
   getBalanceSnapshot: jest.fn(),
   generateReconciliationReport: jest.fn(),
@@ -6,3 +6,4 @@
 
 export * from './types';
 export * from './wallet.service';
+export * from './wallet-application';
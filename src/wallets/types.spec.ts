@@ -0,0 +1,39 @@
+/**
+ * Wallet Type Helper Tests
+ */
+
+import { TransactionType, isValidTransactionType, parseTransactionType } from './types';
+
+describe('TransactionType helpers', () => {
+  describe('isValidTransactionType', () => {
+    it('should accept known types', () => {
+      expect(isValidTransactionType('credit')).toBe(true);
+      expect(isValidTransactionType('debit')).toBe(true);
+    });
+
+    it('should reject unknown values and non-strings', () => {
+      expect(isValidTransactionType('CREDIT')).toBe(false);
+      expect(isValidTransactionType('refund')).toBe(false);
+      expect(isValidTransactionType(undefined)).toBe(false);
+      expect(isValidTransactionType(1)).toBe(false);
+    });
+  });
+
+  describe('parseTransactionType', () => {
+    it('should parse known types', () => {
+      expect(parseTransactionType('credit')).toBe(TransactionType.CREDIT);
+      expect(parseTransactionType('debit')).toBe(TransactionType.DEBIT);
+    });
+
+    it('should normalize case and whitespace', () => {
+      expect(parseTransactionType('CREDIT')).toBe(TransactionType.CREDIT);
+      expect(parseTransactionType(' Debit ')).toBe(TransactionType.DEBIT);
+    });
+
+    it('should reject garbage input', () => {
+      expect(() => parseTransactionType('')).toThrow('Invalid transaction type');
+      expect(() => parseTransactionType('earn')).toThrow('Invalid transaction type: earn');
+      expect(() => parseTransactionType('cred it')).toThrow('Invalid transaction type');
+    });
+  });
+});
@@ -36,6 +36,28 @@ export enum TransactionType {
   DEBIT = 'debit',
 }
 
+const TRANSACTION_TYPES: string[] = Object.values(TransactionType);
+
+/**
+ * Whether a value is a known transaction type
+ */
+export function isValidTransactionType(value: unknown): value is TransactionType {
+  return typeof value === 'string' && TRANSACTION_TYPES.includes(value);
+}
+
+/**
+ * Parse a transaction type, normalizing case and surrounding whitespace
+ * Single source of truth for every path that deserializes a type.
+ * @throws Error if the value is not a known transaction type
+ */
+export function parseTransactionType(value: string): TransactionType {
+  const normalized = typeof value === 'string' ? value.trim().toLowerCase() : value;
+  if (!isValidTransactionType(normalized)) {
+    throw new Error(`Invalid transaction type: ${value}`);
+  }
+  return normalized;
+}
+
 /**
  * Escrow item status tracking
  */
@@ -60,12 +82,14 @@ export enum TransactionReason {
   REFERRAL_BONUS = 'referral_bonus',
   PROMOTIONAL_AWARD = 'promotional_award',
   ADMIN_CREDIT = 'admin_credit',
+  PURCHASE_EARN = 'purchase_earn',
   
   // Purchasing reasons
   CHIP_MENU_PURCHASE = 'chip_menu_purchase',
   SLOT_MACHINE_PLAY = 'slot_machine_play',
   SPIN_WHEEL_PLAY = 'spin_wheel_play',
   PERFORMANCE_REQUEST = 'performance_request',
+  REWARD_DROP_REDEMPTION = 'reward_drop_redemption',
   
   // Settlement reasons
   PERFORMANCE_COMPLETED = 'performance_completed',
@@ -77,13 +101,36 @@ export enum TransactionReason {
   MODEL_INITIATED_REFUND = 'model_initiated_refund',
   ROPE_DROP_TIMEOUT = 'rope_drop_timeout',
   ADMIN_REFUND = 'admin_refund',
+  REDEMPTION_RECREDIT = 'redemption_recredit',
   
   // Debit reasons
   POINT_EXPIRY = 'point_expiry',
   ADMIN_DEBIT = 'admin_debit',
   CHARGEBACK = 'chargeback',
+  FRAUD_CLAWBACK = 'fraud_clawback',
+  
+  // Correction reasons
+  CORRECTION_REVERSAL = 'correction_reversal',
+
+  // Conversion reasons
+  PROGRAM_CONVERSION = 'program_conversion',
+  
+  // Gift reasons
+  GIFT_SENT = 'gift_sent',
+  GIFT_RECEIVED = 'gift_received',
 }
 
+/**
+ * Reasons recorded on the available-balance debit of a redemption
+ */
+export const REDEMPTION_REASONS: readonly string[] = [
+  TransactionReason.CHIP_MENU_PURCHASE,
+  TransactionReason.SLOT_MACHINE_PLAY,
+  TransactionReason.SPIN_WHEEL_PLAY,
+  TransactionReason.PERFORMANCE_REQUEST,
+  TransactionReason.REWARD_DROP_REDEMPTION,
+];
+
 /**
  * User wallet structure with all balance states
  */
@@ -274,6 +321,9 @@ export interface EscrowHoldResponse {
   
   /** Operation timestamp */
   timestamp: Date;
+  
+  /** User's stream version after the hold, for read-your-writes (when tracked) */
+  streamVersion?: number;
 }
 
 /**
@@ -0,0 +1,93 @@
+/**
+ * Wallet Application Tests
+ */
+
+import { applyWalletDelta } from './wallet-application';
+import { WalletModel } from '../db/models/wallet.model';
+import { WalletApplicationModel } from '../db/models/wallet-application.model';
+import { InsufficientBalanceError, WalletApplicationConflictError } from '../services/types';
+
+jest.mock('../db/models/wallet.model');
+jest.mock('../db/models/wallet-application.model');
+
+describe('applyWalletDelta', () => {
+  let applied: Map<string, { userId: string; delta: number }>;
+  const session = {
+    withTransaction: jest.fn(async (fn: () => Promise<void>) => fn()),
+    endSession: jest.fn(),
+  };
+
+  beforeEach(() => {
+    jest.clearAllMocks();
+    applied = new Map();
+    (WalletApplicationModel.startSession as jest.Mock).mockResolvedValue(session);
+    (WalletApplicationModel.create as jest.Mock).mockImplementation(async ([doc]: any[]) => {
+      if (applied.has(doc.applicationKey)) {
+        throw Object.assign(new Error('Duplicate key'), { code: 11000, keyPattern: { applicationKey: 1 } });
+      }
+      applied.set(doc.applicationKey, doc);
+      return [doc];
+    });
+    (WalletApplicationModel.findOne as jest.Mock).mockImplementation((query: any) => ({
+      lean: jest.fn().mockReturnThis(),
+      exec: jest.fn().mockImplementation(async () => applied.get(query.applicationKey.$eq) || null),
+    }));
+    (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue({});
+  });
+
+  it('should move the wallet and record the application in one transaction', async () => {
+    await expect(applyWalletDelta('user-1', 300, 'key-1')).resolves.toBe(true);
+
+    expect(WalletApplicationModel.create).toHaveBeenCalledWith(
+      [expect.objectContaining({ applicationKey: 'key-1', userId: 'user-1', delta: 300 })],
+      { session }
+    );
+    expect(WalletModel.findOneAndUpdate).toHaveBeenCalledWith(
+      { userId: { $eq: 'user-1' } },
+      { $inc: { availableBalance: 300, version: 1 } },
+      { new: true, upsert: true, session }
+    );
+    expect(session.endSession).toHaveBeenCalled();
+  });
+
+  it('should not move the wallet again for an applied key', async () => {
+    await applyWalletDelta('user-1', 300, 'key-1');
+
+    await expect(applyWalletDelta('user-1', 300, 'key-1')).resolves.toBe(false);
+
+    expect(WalletModel.findOneAndUpdate).toHaveBeenCalledTimes(1);
+  });
+
+  it('should refuse a key reused for another wallet or amount', async () => {
+    await applyWalletDelta('user-1', -100, 'key-1');
+
+    const error = await applyWalletDelta('user-1', -50, 'key-1').catch(e => e);
+    expect(error).toBeInstanceOf(WalletApplicationConflictError);
+    expect(error.details).toEqual({ key: 'key-1', fields: ['delta'] });
+    await expect(applyWalletDelta('user-2', -100, 'key-1')).rejects.toThrow(WalletApplicationConflictError);
+    expect(WalletModel.findOneAndUpdate).toHaveBeenCalledTimes(1);
+  });
+
+  it('should only apply a debit the available balance covers', async () => {
+    (WalletModel.findOneAndUpdate as jest.Mock).mockResolvedValue(null);
+    (WalletModel.findOne as jest.Mock).mockReturnValue({
+      session: jest.fn().mockResolvedValue({ availableBalance: 40 }),
+    });
+
+    await expect(applyWalletDelta('user-1', -100, 'key-2')).rejects.toThrow(InsufficientBalanceError);
+
+    expect(WalletModel.findOneAndUpdate).toHaveBeenCalledWith(
+      { userId: { $eq: 'user-1' }, availableBalance: { $gte: 100 } },
+      { $inc: { availableBalance: -100, version: 1 } },
+      { new: true, upsert: false, session }
+    );
+  });
+
+  it('should rethrow other duplicate key errors', async () => {
+    (WalletModel.findOneAndUpdate as jest.Mock).mockRejectedValue(
+      Object.assign(new Error('Duplicate key'), { code: 11000, keyPattern: { userId: 1 } })
+    );
+
+    await expect(applyWalletDelta('user-1', 300, 'key-3')).rejects.toThrow('Duplicate key');
+  });
+});
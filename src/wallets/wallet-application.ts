@@ -0,0 +1,85 @@
+/**
+ * Wallet Applications
+ *
+ * Applies a ledger entry's balance change to a user wallet exactly once.
+ * The wallet $inc and a wallet_applications row keyed by the entry's
+ * idempotency key commit in one MongoDB transaction, so a caller whose
+ * append replayed (inserted === false) can always re-drive the wallet
+ * step: the first application moves the wallet and every later one is a
+ * no-op. This is what lets a crash between an append and its wallet
+ * update be recovered by retrying the operation. The row records the
+ * wallet and delta it applied, and a later call that asks for another
+ * wallet or amount under the same key is refused rather than taken as
+ * already done.
+ */
+
+import { WalletModel } from '../db/models/wallet.model';
+import { WalletApplicationModel } from '../db/models/wallet-application.model';
+import { InsufficientBalanceError, WalletApplicationConflictError } from '../services/types';
+
+/**
+ * Apply delta to a user's available balance once per applicationKey
+ * Callers applying an appended entry pass its stored accountId, so the
+ * wallet is keyed the same way as the ledger when IDs are tokenized.
+ * A debit only applies while the balance covers it; a credit to a user
+ * without a wallet creates one.
+ *
+ * @param applicationKey Idempotency key of the ledger entry being applied
+ * @returns Whether this call moved the wallet (false if already applied)
+ * @throws InsufficientBalanceError if a debit exceeds the available balance
+ * @throws WalletApplicationConflictError if the key already applied another wallet or delta
+ */
+export async function applyWalletDelta(userId: string, delta: number, applicationKey: string): Promise<boolean> {
+  const session = await WalletApplicationModel.startSession();
+  try {
+    await session.withTransaction(async () => {
+      await WalletApplicationModel.create([{ applicationKey, userId, delta, appliedAt: new Date() }], { session });
+
+      const filter: any = { userId: { $eq: userId } };
+      if (delta < 0) {
+        filter.availableBalance = { $gte: -delta };
+      }
+
+      const updated = await WalletModel.findOneAndUpdate(
+        filter,
+        { $inc: { availableBalance: delta, version: 1 } },
+        { new: true, upsert: delta >= 0, session }
+      );
+
+      if (!updated) {
+        const wallet = await WalletModel.findOne({ userId: { $eq: userId } }).session(session);
+        throw new InsufficientBalanceError(-delta, wallet ? wallet.availableBalance : 0);
+      }
+    });
+    return true;
+  } catch (error: any) {
+    // The application row already exists: an earlier call moved the wallet
+    if (error && error.code === 11000 && error.keyPattern?.applicationKey) {
+      const applied = await WalletApplicationModel.findOne({ applicationKey: { $eq: applicationKey } }).lean().exec();
+      const differing = applied
+        ? [...(applied.userId !== userId ? ['wallet'] : []), ...(applied.delta !== delta ? ['delta'] : [])]
+        : [];
+      if (differing.length > 0) {
+        throw new WalletApplicationConflictError(applicationKey, differing);
+      }
+      return false;
+    }
+    throw error;
+  } finally {
+    await session.endSession();
+  }
+}
+
+/**
+ * The wallet and delta applied under applicationKey, if any
+ * Lets a caller that moved a wallet ahead of its ledger entry find and
+ * return that move when the entry is never written.
+ */
+export async function findWalletApplication(
+  applicationKey: string
+): Promise<{ userId: string; delta: number } | null> {
+  return WalletApplicationModel.findOne({ applicationKey: { $eq: applicationKey } })
+    .select('userId delta')
+    .lean()
+    .exec();
+}
@@ -53,7 +53,7 @@ import {
 import { WalletModel } from '../db/models/wallet.model';
 import { ModelWalletModel } from '../db/models/model-wallet.model';
 import { EscrowItemModel } from '../db/models/escrow-item.model';
-import { ILedgerService } from '../ledger/types';
+import { ILedgerService, IAccountAliasResolver } from '../ledger/types';
 import { WalletEventPublisher } from '../events/wallet-event-publisher';
 import { WalletEventType } from '../events/types';
 import { MetricsLogger, MetricEventType } from '../metrics';
@@ -79,10 +79,16 @@ const DEFAULT_CONFIG: WalletServiceConfigOptions = {
 export class WalletService implements IWalletService {
   private config: WalletServiceConfigOptions;
   private ledgerService: ILedgerService;
+  private aliasResolver?: IAccountAliasResolver;
 
-  constructor(ledgerService: ILedgerService, config: Partial<WalletServiceConfigOptions> = {}) {
+  constructor(
+    ledgerService: ILedgerService,
+    config: Partial<WalletServiceConfigOptions> = {},
+    aliasResolver?: IAccountAliasResolver
+  ) {
     this.config = { ...DEFAULT_CONFIG, ...config };
     this.ledgerService = ledgerService;
+    this.aliasResolver = aliasResolver;
   }
 
   /**
@@ -203,7 +209,7 @@ export class WalletService implements IWalletService {
     });
 
     // Entry 2: Credit to escrow
-    await this.ledgerService.createEntry({
+    const escrowEntry = await this.ledgerService.createEntry({
       transactionId,
       accountId: request.userId,
       accountType: 'user',
@@ -230,6 +236,7 @@ export class WalletService implements IWalletService {
       newAvailableBalance,
       escrowBalance: newEscrowBalance,
       timestamp,
+      streamVersion: escrowEntry.streamVersion,
     };
 
     // Publish escrow held event for real-time updates
@@ -815,6 +822,10 @@ export class WalletService implements IWalletService {
     escrow: number;
     total: number;
   }> {
+    if (this.aliasResolver) {
+      userId = await this.aliasResolver.resolveAccountId(userId);
+    }
+
     const wallet = await WalletModel.findOne({ userId: { $eq: userId } });
     
     if (!wallet) {
@@ -864,7 +875,8 @@ export class WalletService implements IWalletService {
  */
 export function createWalletService(
   ledgerService: ILedgerService,
-  config?: Partial<WalletServiceConfigOptions>
+  config?: Partial<WalletServiceConfigOptions>,
+  aliasResolver?: IAccountAliasResolver
 ): IWalletService {
-  return new WalletService(ledgerService, config);
+  return new WalletService(ledgerService, config, aliasResolver);
 }